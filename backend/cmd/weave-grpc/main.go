@@ -0,0 +1,114 @@
+// Command weave-grpc serves the weave gRPC API (proto/weave/v1/weave.proto)
+// in front of a running weave server.
+//
+// Usage:
+//
+//	weave-grpc [--weave-url http://localhost:8080] [--listen localhost:9090]
+//
+// The gateway speaks plaintext gRPC. Like weave, it listens on localhost by
+// default; put it behind a TLS-terminating proxy before exposing it.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/grpcapi"
+	"github.com/hurricanerix/weave/internal/logging"
+)
+
+// defaultListen is the gateway's default listen address.
+const defaultListen = "localhost:9090"
+
+// options are the gateway's command-line options.
+type options struct {
+	weaveURL    string
+	listen      string
+	idleTimeout time.Duration
+	logLevel    string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// parseOptions parses the command-line arguments.
+func parseOptions(args []string, output io.Writer) (*options, error) {
+	opts := &options{}
+	fs := flag.NewFlagSet("weave-grpc", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&opts.weaveURL, "weave-url", "http://"+config.DefaultAddr, "base URL of the weave server")
+	fs.StringVar(&opts.listen, "listen", defaultListen, "address to serve gRPC on")
+	fs.DurationVar(&opts.idleTimeout, "idle-timeout", grpcapi.DefaultIdleTimeout, "close sessions without calls for this long")
+	fs.StringVar(&opts.logLevel, "log-level", "info", "log level (debug, info, warn, error)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+	if opts.idleTimeout <= 0 {
+		return nil, fmt.Errorf("--idle-timeout must be positive, got %s", opts.idleTimeout)
+	}
+	if _, _, err := net.SplitHostPort(opts.listen); err != nil {
+		return nil, fmt.Errorf("invalid --listen address %q: %w", opts.listen, err)
+	}
+	return opts, nil
+}
+
+func run(args []string, stderr io.Writer) int {
+	opts, err := parseOptions(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	logger := logging.NewFromString(opts.logLevel, stderr)
+
+	gateway, err := grpcapi.NewServer(opts.weaveURL)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: invalid --weave-url: %v\n", err)
+		return 1
+	}
+	gateway.SetIdleTimeout(opts.idleTimeout)
+
+	listener, err := net.Listen("tcp", opts.listen)
+	if err != nil {
+		logger.Error("Failed to listen on %s: %v", opts.listen, err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	gateway.StartCleanup(ctx)
+
+	server := grpc.NewServer()
+	gateway.Register(server)
+	go func() {
+		<-ctx.Done()
+		logger.Info("Shutting down...")
+		// Streams end once their sessions are closed
+		gateway.Close()
+		server.GracefulStop()
+	}()
+
+	logger.Info("Serving weave gRPC API on %s for %s", listener.Addr(), opts.weaveURL)
+	if err := server.Serve(listener); err != nil {
+		logger.Error("gRPC server failed: %v", err)
+		return 1
+	}
+	return 0
+}
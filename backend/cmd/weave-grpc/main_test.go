@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/grpcapi"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    options
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: options{weaveURL: "http://localhost:8080", listen: defaultListen, idleTimeout: grpcapi.DefaultIdleTimeout, logLevel: "info"},
+		},
+		{
+			name: "all flags",
+			args: []string{"--weave-url", "http://127.0.0.1:9000", "--listen", ":9191", "--idle-timeout", "5m", "--log-level", "debug"},
+			want: options{weaveURL: "http://127.0.0.1:9000", listen: ":9191", idleTimeout: 5 * time.Minute, logLevel: "debug"},
+		},
+		{name: "zero idle timeout", args: []string{"--idle-timeout", "0s"}, wantErr: true},
+		{name: "listen without port", args: []string{"--listen", "localhost"}, wantErr: true},
+		{name: "extra argument", args: []string{"serve"}, wantErr: true},
+		{name: "unknown flag", args: []string{"--port", "9090"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOptions(tt.args, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("parseOptions() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_InvalidWeaveURL(t *testing.T) {
+	if code := run([]string{"--weave-url", "localhost:8080"}, io.Discard); code != 1 {
+		t.Errorf("run() = %d, want 1", code)
+	}
+}
@@ -5,13 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/hurricanerix/weave/internal/client"
 	"github.com/hurricanerix/weave/internal/config"
 	"github.com/hurricanerix/weave/internal/logging"
+	"github.com/hurricanerix/weave/internal/ollama"
 	"github.com/hurricanerix/weave/internal/startup"
+	"github.com/hurricanerix/weave/internal/web"
 )
 
 func main() {
@@ -55,51 +59,89 @@ func run() int {
 		return 1
 	}
 
+	// With --mcp stdio, stdout carries MCP messages. Point os.Stdout at
+	// stderr so nothing else, including the compute process, writes there.
+	mcpOut := os.Stdout
+	if cfg.MCP == config.MCPStdio {
+		os.Stdout = os.Stderr
+	}
+
 	// Create logger early
 	logger := startup.CreateLogger(cfg)
 
 	// Log startup
 	logger.Info("Starting weave...")
-	logger.Debug("Configuration: port=%d, steps=%d, cfg=%.1f, width=%d, height=%d, seed=%d, llm-seed=%d",
-		cfg.Port, cfg.Steps, cfg.CFG, cfg.Width, cfg.Height, cfg.Seed, cfg.LLMSeed)
-	logger.Debug("Ollama: url=%s, model=%s", cfg.OllamaURL, cfg.OllamaModel)
+	logger.Debug("Configuration: listen=%s, steps=%d, cfg=%.1f, width=%d, height=%d, seed=%d, llm-seed=%d",
+		cfg.Addr(), cfg.Steps, cfg.CFG, cfg.Width, cfg.Height, cfg.Seed, cfg.LLMSeed)
+	logger.Debug("LLM: backend=%s, ollama-url=%s, ollama-model=%s, openai-url=%s, openai-model=%s",
+		cfg.LLMBackend, cfg.OllamaURL, cfg.OllamaModel, cfg.OpenAIURL, cfg.OpenAIModel)
 	logger.Debug("Log level: %s", cfg.LogLevel)
+	warnLAN(cfg, logger)
+
+	// Gallery-only mode serves published images without ollama or compute
+	if cfg.GalleryOnly {
+		return runGalleryOnly(cfg, logger)
+	}
 
-	// Validate ollama is running
-	logger.Debug("Validating ollama connection...")
-	if err := startup.ValidateOllama(cfg.OllamaURL); err != nil {
-		logger.Error("Ollama validation failed: %v", err)
+	// Validate the LLM backend is running
+	logger.Debug("Validating LLM connection...")
+	if err := startup.ValidateLLM(cfg); err != nil {
+		logger.Error("LLM validation failed: %v", err)
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if cfg.LLMBackend == config.LLMBackendOpenAI {
+			fmt.Fprintf(os.Stderr, "\nPlease ensure the OpenAI-compatible server is running at %s\n", cfg.OpenAIURL)
+			fmt.Fprintf(os.Stderr, "and, if it requires one, that %s holds its API key.\n", startup.OpenAIAPIKeyEnv)
+			return 1
+		}
 		fmt.Fprintf(os.Stderr, "\nPlease ensure ollama is running:\n")
 		fmt.Fprintf(os.Stderr, "  ollama serve\n")
 		fmt.Fprintf(os.Stderr, "\nAnd that the model is available:\n")
 		fmt.Fprintf(os.Stderr, "  ollama pull %s\n", cfg.OllamaModel)
 		return 1
 	}
-	logger.Info("Connected to ollama at %s (model: %s)", cfg.OllamaURL, cfg.OllamaModel)
-
-	// Create socket for weave-compute communication
-	logger.Debug("Creating socket for weave-compute...")
-	listener, socketPath, err := startup.CreateSocket()
-	if err != nil {
-		logger.Error("Failed to create socket: %v", err)
-		fmt.Fprintf(os.Stderr, "Error: failed to create socket: %v\n", err)
-		return 1
+	var pullEndpoints []string
+	if cfg.LLMBackend == config.LLMBackendOpenAI {
+		logger.Info("Connected to OpenAI-compatible server at %s (model: %s)", cfg.OpenAIURL, cfg.OpenAIModel)
+	} else {
+		logger.Info("Connected to ollama at %s (model: %s)", cfg.OllamaURL, cfg.OllamaModel)
+		pullEndpoints = startup.MissingOllamaModel(cfg)
+		if len(pullEndpoints) > 0 && !cfg.OllamaPull {
+			logger.Error("Model %s not found in ollama at %s", cfg.OllamaModel, strings.Join(pullEndpoints, ", "))
+			fmt.Fprintf(os.Stderr, "Error: model %s is not available in ollama\n", cfg.OllamaModel)
+			fmt.Fprintf(os.Stderr, "\nPull it with:\n")
+			fmt.Fprintf(os.Stderr, "  ollama pull %s\n", cfg.OllamaModel)
+			fmt.Fprintf(os.Stderr, "\nOr start weave with --ollama-pull to download it automatically.\n")
+			return 1
+		}
 	}
-	defer listener.Close()
-	logger.Info("Created socket at %s", socketPath)
 
-	// Spawn compute process
-	logger.Debug("Spawning weave-compute process...")
-	computeProcess, computeStdin, err := startup.SpawnCompute(socketPath)
-	if err != nil {
-		logger.Error("Failed to spawn compute process: %v", err)
-		fmt.Fprintf(os.Stderr, "Error: failed to spawn compute process: %v\n", err)
-		fmt.Fprintf(os.Stderr, "\nEnsure the compute binary is available.\n")
-		fmt.Fprintf(os.Stderr, "See docs/DEVELOPMENT.md for build instructions.\n")
-		return 1
+	// Create socket for weave-compute communication and spawn compute
+	// processes, one per worker, unless compute runs on another machine
+	var listener net.Listener
+	var socketPath string
+	var computeWorkers []startup.ComputeWorker
+	if cfg.ComputeAddr == "" {
+		logger.Debug("Creating socket for weave-compute...")
+		listener, socketPath, err = startup.CreateSocket()
+		if err != nil {
+			logger.Error("Failed to create socket: %v", err)
+			fmt.Fprintf(os.Stderr, "Error: failed to create socket: %v\n", err)
+			return 1
+		}
+		defer listener.Close()
+		logger.Info("Created socket at %s", socketPath)
+
+		// Spawn compute processes, one per worker
+		logger.Debug("Spawning weave-compute processes...")
+		computeWorkers, err = startup.SpawnComputeWorkers(socketPath, cfg, logger)
+		if err != nil {
+			logger.Error("Failed to spawn compute process: %v", err)
+			fmt.Fprintf(os.Stderr, "Error: failed to spawn compute process: %v\n", err)
+			fmt.Fprintf(os.Stderr, "\nEnsure the compute binary is available.\n")
+			fmt.Fprintf(os.Stderr, "See docs/DEVELOPMENT.md for build instructions.\n")
+			return 1
+		}
 	}
-	logger.Info("Spawned weave-compute process (PID: %d)", computeProcess.Process.Pid)
 
 	// Accept connection from compute process
 	logger.Debug("Waiting for compute process to connect...")
@@ -110,19 +152,45 @@ func run() int {
 	defer cancel()
 
 	// Start stdin monitoring for orphan process detection
-	// When parent process dies, stdin EOF triggers graceful shutdown
-	go monitorStdin(cancel, os.Stdin, logger)
+	// When parent process dies, stdin EOF triggers graceful shutdown.
+	// With --mcp stdio, stdin belongs to the MCP client; its EOF is handled
+	// by serveMCP instead.
+	if cfg.MCP != config.MCPStdio {
+		go monitorStdin(cancel, os.Stdin, logger)
+	}
+
+	if !startPprof(ctx, cfg, logger) {
+		return 1
+	}
 
 	acceptCtx, acceptCancel := context.WithTimeout(ctx, 10*time.Second)
 	defer acceptCancel()
 
-	computeConn, err := client.AcceptConnection(acceptCtx, listener)
-	if err != nil {
-		logger.Error("Failed to accept compute connection: %v", err)
-		fmt.Fprintf(os.Stderr, "Error: failed to accept compute connection: %v\n", err)
+	var computeConn *client.Conn
+	if cfg.ComputeAddr != "" {
+		computeConn, err = startup.DialRemoteCompute(acceptCtx, cfg, logger)
+		if err != nil {
+			logger.Error("Failed to connect to remote compute: %v", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintf(os.Stderr, "\nEnsure weave-compute runs there with --listen and the same %s.\n", client.TokenEnv)
+			return 1
+		}
+		logger.Info("Connected to remote weave-compute at %s", cfg.ComputeAddr)
+	} else {
+		computeConn, err = startup.AcceptComputeWorkers(acceptCtx, listener, len(computeWorkers))
+		if err != nil {
+			logger.Error("Failed to accept compute connection: %v", err)
+			fmt.Fprintf(os.Stderr, "Error: failed to accept compute connection: %v\n", err)
+			return 1
+		}
+		logger.Info("Accepted connection from weave-compute process")
+	}
+	computeConn.SetMaxResponseSize(cfg.ComputeMaxResponseMB << 20)
+	if err := startup.NegotiateComputeVersion(ctx, computeConn, logger); err != nil {
+		logger.Error("%v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
 	}
-	logger.Info("Accepted connection from weave-compute process")
 
 	// Initialize all components
 	logger.Debug("Initializing components...")
@@ -134,18 +202,157 @@ func run() int {
 	}
 
 	// Set compute-specific fields on components
-	components.ComputeListener = listener
-	components.ComputeSocketPath = socketPath
-	components.ComputeProcess = computeProcess
-	components.ComputeStdin = computeStdin
+	if cfg.ComputeAddr != "" {
+		components.ComputeRemote = cfg.ComputeAddr
+	} else {
+		components.ComputeListener = listener
+		components.ComputeSocketPath = socketPath
+		components.SetComputeWorkers(computeWorkers)
+	}
+
+	// Pull the missing model while serving, so GET /ready can report the
+	// download. The self-test needs the model, so it waits for the pull.
+	if len(pullEndpoints) > 0 {
+		if cfg.SelfTest {
+			if err := pullModel(ctx, cfg, pullEndpoints, components.WebServer, logger); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				startup.CleanupCompute(components, logger)
+				return 1
+			}
+		} else {
+			go pullModel(ctx, cfg, pullEndpoints, components.WebServer, logger)
+		}
+	}
+
+	// Verify the whole pipeline before accepting requests
+	if cfg.SelfTest {
+		logger.Info("Running self-test...")
+		if err := startup.SelfTest(ctx, components.LLMClient, components.ComputeClient, cfg, logger); err != nil {
+			logger.Error("Self-test failed: %v", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			startup.CleanupCompute(components, logger)
+			return 1
+		}
+		logger.Info("Self-test passed")
+	}
+
+	// Enable soft restarts through POST /admin/restart
+	restarter := startup.NewRestarter(os.Args[1:], cfg, components, logger)
+	components.WebServer.SetRestartFunc(restarter.Restart)
 
-	defer startup.CleanupCompute(components, logger)
+	// Restart compute if it crashes; Shutdown stops this before terminating it
+	if components.ComputeClient != nil {
+		components.ComputeSupervisor = startup.NewSupervisor(restarter)
+		components.ComputeSupervisor.Start(ctx)
+	}
+
+	if cfg.MCP == config.MCPStdio {
+		go serveMCP(ctx, cancel, components.WebServer, os.Stdin, mcpOut, logger)
+	}
 
 	// Log server startup
-	logger.Info("Listening on http://localhost:%d", cfg.Port)
+	logger.Info("Listening on http://%s", cfg.Addr())
+
+	// Run server and wait for shutdown signal; Serve stops the web server
+	// before terminating compute
+	if err := startup.Serve(ctx, components, logger); err != nil {
+		logger.Error("Server error: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// serveMCP serves MCP over stdio until the client closes stdin, then
+// cancels the context to shut down, as the client owns the process.
+func serveMCP(ctx context.Context, cancel context.CancelFunc, server *web.Server, in io.Reader, out io.Writer, logger *logging.Logger) {
+	logger.Info("Serving MCP on stdio")
+	if err := server.ServeMCP(ctx, in, out); err != nil {
+		logger.Error("MCP: %v", err)
+	}
+	logger.Info("MCP client disconnected, initiating shutdown")
+	cancel()
+}
+
+// pullModel pulls the ollama model to endpoints, reporting its progress
+// through the server's GET /ready until it finishes. A failed pull is
+// logged and left on GET /ready; chats fail until the model is pulled.
+func pullModel(ctx context.Context, cfg *config.Config, endpoints []string, server *web.Server, logger *logging.Logger) error {
+	server.SetReadiness(&web.Readiness{Status: web.ReadinessPulling, Model: cfg.OllamaModel})
+	err := startup.PullOllamaModel(ctx, cfg, endpoints, logger, func(p ollama.PullProgress) {
+		server.SetReadiness(&web.Readiness{
+			Status:    web.ReadinessPulling,
+			Model:     cfg.OllamaModel,
+			Detail:    p.Status,
+			Completed: p.Completed,
+			Total:     p.Total,
+		})
+	})
+	if err != nil {
+		logger.Error("Model pull failed: %v", err)
+		server.SetReadiness(&web.Readiness{Status: web.ReadinessFailed, Model: cfg.OllamaModel, Error: err.Error()})
+		return err
+	}
+	server.SetReadiness(nil)
+	return nil
+}
+
+// warnLAN warns when --listen makes the server reachable from other
+// machines, and again if nothing authenticates their requests.
+func warnLAN(cfg *config.Config, logger *logging.Logger) {
+	if !cfg.LAN() {
+		return
+	}
+	logger.Warn("Listening on %s is reachable from other machines", cfg.Addr())
+	auth := cfg.APIToken != "" || cfg.APITokensFile != "" || cfg.UsersFile != "" || cfg.UserHeader != ""
+	if !auth && !cfg.GalleryOnly {
+		logger.Warn("No --api-token, --api-tokens-file, --users-file or --user-header: anyone on the network can chat and generate")
+	}
+}
+
+// startPprof serves pprof profiles when --debug-pprof is set.
+// Returns false if the pprof server could not start.
+func startPprof(ctx context.Context, cfg *config.Config, logger *logging.Logger) bool {
+	if !cfg.DebugPprof {
+		return true
+	}
+	addr, err := startup.StartPprof(ctx, cfg.DebugPprofPort, logger)
+	if err != nil {
+		logger.Error("Failed to start pprof: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return false
+	}
+	logger.Warn("Serving pprof profiles on http://%s/debug/pprof/", addr)
+	return true
+}
+
+// runGalleryOnly serves the read-only gallery without validating ollama or
+// spawning the compute process, since chat and generation are disabled.
+func runGalleryOnly(cfg *config.Config, logger *logging.Logger) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go monitorStdin(cancel, os.Stdin, logger)
+
+	if !startPprof(ctx, cfg, logger) {
+		return 1
+	}
+
+	if cfg.SelfTest {
+		logger.Warn("--selftest is skipped in gallery-only mode")
+	}
+
+	components, err := startup.InitializeAll(ctx, cfg, logger, nil)
+	if err != nil {
+		logger.Error("Initialization failed: %v", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	logger.Info("Serving gallery on http://%s/gallery", cfg.Addr())
 
-	// Run server and wait for shutdown signal
-	if err := startup.Run(ctx, components.WebServer, logger); err != nil {
+	if err := startup.Serve(ctx, components, logger); err != nil {
 		logger.Error("Server error: %v", err)
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/hurricanerix/weave/internal/config"
 	"github.com/hurricanerix/weave/internal/logging"
 )
 
@@ -146,3 +148,49 @@ func (r *slowReader) Read(p []byte) (n int, err error) {
 	r.index++
 	return 1, nil
 }
+
+func TestWarnLAN(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		wantWarn []string
+	}{
+		{name: "localhost", cfg: &config.Config{Port: 8080}},
+		{name: "loopback listen", cfg: &config.Config{Listen: "127.0.0.1:8080"}},
+		{
+			name:     "lan without auth",
+			cfg:      &config.Config{Listen: "0.0.0.0:8080", AllowLAN: true},
+			wantWarn: []string{"reachable from other machines", "anyone on the network"},
+		},
+		{
+			name:     "lan with tokens",
+			cfg:      &config.Config{Listen: "0.0.0.0:8080", AllowLAN: true, APITokensFile: "tokens"},
+			wantWarn: []string{"reachable from other machines"},
+		},
+		{
+			name:     "lan gallery",
+			cfg:      &config.Config{Listen: ":8080", AllowLAN: true, GalleryOnly: true},
+			wantWarn: []string{"reachable from other machines"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			warnLAN(tt.cfg, logging.New(logging.LevelWarn, &out))
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if out.Len() == 0 {
+				lines = nil
+			}
+			if len(lines) != len(tt.wantWarn) {
+				t.Fatalf("warnings = %q, want %d", lines, len(tt.wantWarn))
+			}
+			for i, want := range tt.wantWarn {
+				if !strings.Contains(lines[i], want) {
+					t.Errorf("warning %d = %q, want it to contain %q", i, lines[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// ErrChecksumMismatch is returned for a request whose response does not
+// match its checksum (protocol.FlagChecksum), having been corrupted on the
+// way. The rest of the response is read and discarded, so the connection
+// keeps working.
+var ErrChecksumMismatch = errors.New("weave-compute response does not match its checksum")
+
+// appendChecksum returns message with protocol.FlagChecksum set and the
+// CRC-32 of its payload appended, counted in the payload length. message
+// is not modified.
+func appendChecksum(message []byte) []byte {
+	out := make([]byte, len(message), len(message)+protocol.ChecksumSize)
+	copy(out, message)
+	binary.BigEndian.PutUint32(out[8:12], uint32(len(message)-16+protocol.ChecksumSize))
+	binary.BigEndian.PutUint32(out[12:16], binary.BigEndian.Uint32(out[12:16])|protocol.FlagChecksum)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(message[16:]))
+}
+
+// verifyChecksum checks and removes the checksum of frame, whose header
+// has protocol.FlagChecksum, and clears the flag, so the frame reads as if
+// it had been sent without one. The frame is returned without its checksum
+// even if it does not match, so the caller can tell whose response it was.
+func verifyChecksum(frame []byte) ([]byte, error) {
+	payloadLen := len(frame) - 16 - protocol.ChecksumSize
+	if payloadLen < 0 {
+		return frame, ErrChecksumMismatch
+	}
+	want := binary.BigEndian.Uint32(frame[16+payloadLen:])
+	frame = frame[:16+payloadLen]
+	binary.BigEndian.PutUint32(frame[8:12], uint32(payloadLen))
+	binary.BigEndian.PutUint32(frame[12:16], binary.BigEndian.Uint32(frame[12:16])&^protocol.FlagChecksum)
+	if crc32.ChecksumIEEE(frame[16:]) != want {
+		return frame, ErrChecksumMismatch
+	}
+	return frame, nil
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+func TestChecksum(t *testing.T) {
+	ping := protocol.EncodePing(7)
+
+	checked := appendChecksum(ping)
+	if got := binary.BigEndian.Uint32(checked[8:12]); got != 8+protocol.ChecksumSize {
+		t.Errorf("payload length = %d, want %d", got, 8+protocol.ChecksumSize)
+	}
+	if binary.BigEndian.Uint32(checked[12:16])&protocol.FlagChecksum == 0 {
+		t.Error("FlagChecksum not set")
+	}
+	if len(ping) != 24 || binary.BigEndian.Uint32(ping[12:16]) != 0 {
+		t.Fatal("appendChecksum() modified the message")
+	}
+
+	got, err := verifyChecksum(bytes.Clone(checked))
+	if err != nil {
+		t.Fatalf("verifyChecksum() failed: %v", err)
+	}
+	if !bytes.Equal(got, ping) {
+		t.Errorf("verifyChecksum() = %v, want the message without its checksum %v", got, ping)
+	}
+
+	corrupted := bytes.Clone(checked)
+	corrupted[20] ^= 0x10
+	if _, err := verifyChecksum(corrupted); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("verifyChecksum() of a corrupted message error = %v, want %v", err, ErrChecksumMismatch)
+	}
+	if _, err := verifyChecksum(checked[:18]); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("verifyChecksum() without room for a checksum error = %v, want %v", err, ErrChecksumMismatch)
+	}
+}
+
+func TestReadMessage_Checksum(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0x5A}, 64*64*3)
+	message := generateResponseFor([]byte{1, 0, 0, 0, 0, 0, 0, 0}, 0, pixels)
+	pong := appendChecksum(pongFor([]byte{2, 0, 0, 0, 0, 0, 0, 0}))
+
+	// checksumFrames splits message into chunks that each get a checksum
+	checksumFrames := func(corrupt int) []byte {
+		var out []byte
+		stream := chunkMessage(message, 4096)
+		for i := 0; len(stream) > 0; i++ {
+			n := 16 + int(binary.BigEndian.Uint32(stream[8:12]))
+			frame := appendChecksum(stream[:n])
+			if i == corrupt {
+				frame[100] ^= 0x01
+			}
+			out = append(out, frame...)
+			stream = stream[n:]
+		}
+		return append(out, pong...)
+	}
+
+	stream := bytes.NewReader(checksumFrames(-1))
+	got, err := readMessage(stream, DefaultMaxResponseSize)
+	if err != nil {
+		t.Fatalf("readMessage() failed: %v", err)
+	}
+	if !bytes.Equal(got, message) {
+		t.Error("readMessage() did not return the message without its checksums")
+	}
+
+	for _, corrupt := range []int{0, 2} {
+		stream := bytes.NewReader(checksumFrames(corrupt))
+		got, err := readMessage(stream, DefaultMaxResponseSize)
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("readMessage() with frame %d corrupted error = %v, want %v", corrupt, err, ErrChecksumMismatch)
+		}
+		if corrupt != 0 && !bytes.Equal(got[16:24], message[16:24]) {
+			t.Errorf("readMessage() returned request ID %v, want %v", got[16:24], message[16:24])
+		}
+		if got, err := readMessage(stream, DefaultMaxResponseSize); err != nil || !bytes.Equal(got, pongFor([]byte{2, 0, 0, 0, 0, 0, 0, 0})) {
+			t.Errorf("message after the corrupted one = %v, %v, want the pong", got, err)
+		}
+	}
+}
+
+func TestSend_Checksum(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0x5A}, 64*64*3)
+	corrupt := make(chan bool, 1)
+
+	conn := acceptWithFakeCompute(t, func(request []byte) []byte {
+		msgType := binary.BigEndian.Uint16(request[6:8])
+		if msgType == protocol.MsgHelloRequest {
+			hello := helloFor(request[16:24], protocol.ProtocolVersion1)
+			binary.BigEndian.PutUint16(hello[30:32], uint16(protocol.FlagChecksum))
+			return hello
+		}
+		if binary.BigEndian.Uint32(request[12:16])&protocol.FlagChecksum == 0 {
+			t.Errorf("request of type 0x%04X has no checksum", msgType)
+			return nil
+		}
+		request, err := verifyChecksum(request)
+		if err != nil {
+			t.Errorf("request checksum: %v", err)
+			return nil
+		}
+		response := appendChecksum(generateResponseFor(request[16:24], 0, pixels))
+		if <-corrupt {
+			response[1000] ^= 0x01
+		}
+		return response
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := conn.Negotiate(ctx); err != nil {
+		t.Fatalf("Negotiate() failed: %v", err)
+	}
+	req, err := protocol.NewSD35GenerateRequest(1, "a cat", 64, 64, 4, 4.5, 0)
+	if err != nil {
+		t.Fatalf("NewSD35GenerateRequest() failed: %v", err)
+	}
+	request, err := protocol.EncodeSD35GenerateRequest(req)
+	if err != nil {
+		t.Fatalf("EncodeSD35GenerateRequest() failed: %v", err)
+	}
+
+	corrupt <- false
+	response, err := conn.Send(ctx, request)
+	if err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+	if _, err := protocol.DecodeResponse(response); err != nil {
+		t.Errorf("DecodeResponse() failed: %v", err)
+	}
+
+	// A corrupted response fails only its request
+	corrupt <- true
+	if _, err := conn.Send(ctx, request); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Send() of a corrupted response error = %v, want %v", err, ErrChecksumMismatch)
+	}
+	req.RequestID = 2
+	if request, err = protocol.EncodeSD35GenerateRequest(req); err != nil {
+		t.Fatalf("EncodeSD35GenerateRequest() failed: %v", err)
+	}
+	corrupt <- false
+	if _, err := conn.Send(ctx, request); err != nil {
+		t.Errorf("Send() after a corrupted response failed: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// DefaultMaxResponseSize is the largest response payload, reassembled from
+// its chunks, a connection accepts unless SetMaxResponseSize changes it.
+const DefaultMaxResponseSize = 128 * 1024 * 1024
+
+// ErrResponseTooLarge is returned for a request whose response is larger
+// than the connection's maximum response size. The response is read and
+// discarded, so the connection keeps working.
+var ErrResponseTooLarge = errors.New("weave-compute response exceeds the maximum response size")
+
+// SetMaxResponseSize sets the largest response payload accepted, in bytes;
+// n <= 0 restores DefaultMaxResponseSize. For a pool it applies to every
+// worker. Call it before sending requests: the response being waited for
+// keeps the limit it had.
+func (c *Conn) SetMaxResponseSize(n int) {
+	if c.workers != nil {
+		for _, w := range c.workers {
+			w.conn.SetMaxResponseSize(n)
+		}
+		return
+	}
+	c.maxResponseSize.Store(int64(n))
+}
+
+// maxResponse returns the largest response payload accepted, in bytes.
+func (c *Conn) maxResponse() int {
+	if n := c.maxResponseSize.Load(); n > 0 {
+		return int(n)
+	}
+	return DefaultMaxResponseSize
+}
+
+// readMessage reads one message, header included, from r: a single frame,
+// or the frames compute split it into with protocol.FlagChunked, read one at
+// a time and reassembled as if it had been sent in one. The header of a
+// reassembled message has the payload length of all of them and the flags
+// of the last, which is the only one without protocol.FlagChunked.
+//
+// A message with more than maxSize bytes of payload, or a frame that does
+// not match its checksum (protocol.FlagChecksum), is read to its end and
+// discarded; its first frame is returned with ErrResponseTooLarge or
+// ErrChecksumMismatch, so the caller can tell whose response it was. Any
+// other error leaves r in an unknown state.
+func readMessage(r io.Reader, maxSize int) ([]byte, error) {
+	message, discard := readFrame(r)
+	if discard != nil && !errors.Is(discard, ErrChecksumMismatch) {
+		return nil, discard
+	}
+	if discard == nil && len(message)-16 > maxSize {
+		discard = ErrResponseTooLarge
+	}
+
+	for binary.BigEndian.Uint32(message[12:16])&protocol.FlagChunked != 0 {
+		frame, err := readFrame(r)
+		if errors.Is(err, ErrChecksumMismatch) {
+			if discard == nil {
+				discard = err
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		if msgType := binary.BigEndian.Uint16(frame[6:8]); msgType != binary.BigEndian.Uint16(message[6:8]) {
+			return nil, fmt.Errorf("chunk of message type 0x%04X inside message type 0x%04X",
+				msgType, binary.BigEndian.Uint16(message[6:8]))
+		}
+		// Only the flags are kept of a discarded message's later frames,
+		// to find its end
+		copy(message[12:16], frame[12:16])
+		if discard == nil && len(message)-16+len(frame)-16 > maxSize {
+			discard = ErrResponseTooLarge
+		}
+		if discard != nil {
+			continue
+		}
+		message = append(message, frame[16:]...)
+	}
+
+	if discard != nil {
+		return message, discard
+	}
+	binary.BigEndian.PutUint32(message[8:12], uint32(len(message)-16))
+	return message, nil
+}
+
+// readFrame reads one frame, header included, from r, and checks and
+// removes its checksum if it has one.
+func readFrame(r io.Reader) ([]byte, error) {
+	// Read response header first (16 bytes) to determine payload length
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, classifyReadError(err)
+	}
+
+	// Extract payload length from header (bytes 8-11, big-endian)
+	payloadLen := binary.BigEndian.Uint32(header[8:12])
+
+	// Validate payload length (protect against malicious compute process)
+	if payloadLen > maxPayloadSize {
+		return nil, fmt.Errorf("payload too large: %d bytes (max %d)", payloadLen, maxPayloadSize)
+	}
+
+	// Allocate buffer for full frame (header + payload)
+	frame := make([]byte, 16+payloadLen)
+	copy(frame, header)
+
+	// Read remaining payload
+	if payloadLen > 0 {
+		if _, err := io.ReadFull(r, frame[16:]); err != nil {
+			return nil, classifyReadError(err)
+		}
+	}
+
+	if binary.BigEndian.Uint32(header[12:16])&protocol.FlagChecksum != 0 {
+		return verifyChecksum(frame)
+	}
+	return frame, nil
+}
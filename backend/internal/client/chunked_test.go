@@ -0,0 +1,165 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// chunkMessage splits message into frames of at most size bytes of
+// payload, as compute does with protocol.FlagChunked.
+func chunkMessage(message []byte, size int) []byte {
+	var out []byte
+	payload := message[16:]
+	flags := binary.BigEndian.Uint32(message[12:16])
+	for {
+		n := min(size, len(payload))
+		frame := make([]byte, 16+n)
+		copy(frame, message[:16])
+		binary.BigEndian.PutUint32(frame[8:12], uint32(n))
+		copy(frame[16:], payload[:n])
+		payload = payload[n:]
+		if len(payload) > 0 {
+			binary.BigEndian.PutUint32(frame[12:16], flags|protocol.FlagChunked)
+		}
+		out = append(out, frame...)
+		if len(payload) == 0 {
+			return out
+		}
+	}
+}
+
+func TestReadMessage_Chunked(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0x5A}, 64*64*3)
+	message := generateResponseFor([]byte{1, 0, 0, 0, 0, 0, 0, 0}, protocol.FlagSeed, pixels)
+	pong := pongFor([]byte{2, 0, 0, 0, 0, 0, 0, 0})
+
+	t.Run("reassembled", func(t *testing.T) {
+		stream := bytes.NewReader(append(chunkMessage(message, 1000), pong...))
+		got, err := readMessage(stream, DefaultMaxResponseSize)
+		if err != nil {
+			t.Fatalf("readMessage() failed: %v", err)
+		}
+		if !bytes.Equal(got, message) {
+			t.Errorf("readMessage() = %d bytes with flags 0x%X, want the %d-byte message with flags 0x%X",
+				len(got), binary.BigEndian.Uint32(got[12:16]), len(message), protocol.FlagSeed)
+		}
+		if got, err := readMessage(stream, DefaultMaxResponseSize); err != nil || !bytes.Equal(got, pong) {
+			t.Errorf("message after the chunks = %v, %v, want the pong", got, err)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		stream := bytes.NewReader(append(chunkMessage(message, 1000), pong...))
+		got, err := readMessage(stream, 5000)
+		if !errors.Is(err, ErrResponseTooLarge) {
+			t.Fatalf("readMessage() error = %v, want %v", err, ErrResponseTooLarge)
+		}
+		if !bytes.Equal(got[16:24], message[16:24]) {
+			t.Errorf("readMessage() returned request ID %v, want %v", got[16:24], message[16:24])
+		}
+		if got, err := readMessage(stream, 5000); err != nil || !bytes.Equal(got, pong) {
+			t.Errorf("message after the discarded one = %v, %v, want the pong", got, err)
+		}
+	})
+
+	t.Run("single frame too large", func(t *testing.T) {
+		if _, err := readMessage(bytes.NewReader(message), 1000); !errors.Is(err, ErrResponseTooLarge) {
+			t.Errorf("readMessage() error = %v, want %v", err, ErrResponseTooLarge)
+		}
+	})
+
+	t.Run("mixed message types", func(t *testing.T) {
+		stream := chunkMessage(message, 1000)
+		binary.BigEndian.PutUint16(stream[16+1000+6:], protocol.MsgPong)
+		if _, err := readMessage(bytes.NewReader(stream), DefaultMaxResponseSize); err == nil {
+			t.Error("readMessage() succeeded, want an error")
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		stream := chunkMessage(message, 1000)
+		if _, err := readMessage(bytes.NewReader(stream[:3000]), DefaultMaxResponseSize); err == nil {
+			t.Error("readMessage() succeeded, want an error")
+		}
+	})
+}
+
+func TestSend_ChunkedResponse(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0x5A}, 64*64*3)
+
+	start := func(t *testing.T, maxSize int) (*Conn, []byte) {
+		t.Helper()
+		conn := acceptWithFakeCompute(t, func(request []byte) []byte {
+			switch binary.BigEndian.Uint16(request[6:8]) {
+			case protocol.MsgHelloRequest:
+				hello := helloFor(request[16:24], protocol.ProtocolVersion1)
+				binary.BigEndian.PutUint16(hello[30:32], uint16(protocol.FlagChunked))
+				return hello
+			case protocol.MsgGenerateRequest:
+				response := generateResponseFor(request[16:24], 0, pixels)
+				if binary.BigEndian.Uint32(request[12:16])&protocol.FlagChunked == 0 {
+					t.Error("chunked responses not offered after negotiation")
+					return response
+				}
+				return chunkMessage(response, 4096)
+			case protocol.MsgPing:
+				return pongFor(request[16:24])
+			}
+			return nil
+		})
+		conn.SetMaxResponseSize(maxSize)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.Negotiate(ctx); err != nil {
+			t.Fatalf("Negotiate() failed: %v", err)
+		}
+		req, err := protocol.NewSD35GenerateRequest(1, "a cat", 64, 64, 4, 4.5, 0)
+		if err != nil {
+			t.Fatalf("NewSD35GenerateRequest() failed: %v", err)
+		}
+		request, err := protocol.EncodeSD35GenerateRequest(req)
+		if err != nil {
+			t.Fatalf("EncodeSD35GenerateRequest() failed: %v", err)
+		}
+		return conn, request
+	}
+
+	t.Run("reassembled", func(t *testing.T) {
+		conn, request := start(t, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		response, err := conn.Send(ctx, request)
+		if err != nil {
+			t.Fatalf("Send() failed: %v", err)
+		}
+		decoded, err := protocol.DecodeResponse(response)
+		if err != nil {
+			t.Fatalf("DecodeResponse() failed: %v", err)
+		}
+		if resp := decoded.(*protocol.SD35GenerateResponse); !bytes.Equal(resp.ImageData, pixels) {
+			t.Error("image data of the reassembled response differs")
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		conn, request := start(t, 10000)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if _, err := conn.Send(ctx, request); !errors.Is(err, ErrResponseTooLarge) {
+			t.Errorf("Send() error = %v, want %v", err, ErrResponseTooLarge)
+		}
+		// Only the request failed, not the connection
+		if err := conn.Ping(ctx); err != nil {
+			t.Errorf("Ping() after a response over the limit failed: %v", err)
+		}
+	})
+}
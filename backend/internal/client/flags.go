@@ -0,0 +1,64 @@
+package client
+
+import (
+	"encoding/binary"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// optionalFlags are request header flags that do not change the image
+// compute returns, so they are dropped for compute that does not accept
+// them instead of failing the request.
+const optionalFlags = protocol.FlagPriorityMask
+
+// reportFlags ask compute to report how it generated an image after it;
+// they are set on generations for compute that accepts them.
+const reportFlags = protocol.FlagSeed | protocol.FlagMetadata
+
+// adaptFlags returns request with its header flags adapted to what compute
+// said in the hello that it accepts: optional flags it does not accept are
+// cleared, protocol.FlagChunked is set on every request if it accepts that,
+// so compute may split large responses into frames,
+// protocol.FlagSharedMemory is set on image requests if it accepts that, so
+// compute may hand the pixels over in shared memory, and the reportFlags it
+// accepts on generations, so the response says which seed compute picked
+// and how it generated the image. If compute accepts protocol.FlagChecksum,
+// the request gets a checksum, which has compute checksum its responses.
+// request is not modified.
+func (c *Conn) adaptFlags(request []byte) []byte {
+	if len(request) < 16 {
+		return request
+	}
+	c.mu.Lock()
+	accepted := uint32(c.acceptedFlags)
+	c.mu.Unlock()
+
+	flags := binary.BigEndian.Uint32(request[12:16])
+	adapted := flags | accepted&protocol.FlagChunked
+	if accepted&optionalFlags != optionalFlags {
+		adapted &^= optionalFlags
+	}
+	switch binary.BigEndian.Uint16(request[6:8]) {
+	case protocol.MsgGenerateRequest, protocol.MsgImg2ImgRequest, protocol.MsgInpaintRequest,
+		protocol.MsgControlRequest:
+		adapted |= accepted & reportFlags
+		fallthrough
+	case protocol.MsgUpscaleRequest:
+		if c.shmDir != "" && accepted&protocol.FlagSharedMemory != 0 {
+			adapted |= protocol.FlagSharedMemory
+		}
+	}
+	if accepted&protocol.FlagChecksum != 0 {
+		out := appendChecksum(request)
+		binary.BigEndian.PutUint32(out[12:16], adapted|protocol.FlagChecksum)
+		return out
+	}
+	if adapted == flags {
+		return request
+	}
+
+	out := make([]byte, len(request))
+	copy(out, request)
+	binary.BigEndian.PutUint32(out[12:16], adapted)
+	return out
+}
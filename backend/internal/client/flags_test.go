@@ -0,0 +1,64 @@
+package client
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+func TestAdaptFlags(t *testing.T) {
+	req, err := protocol.NewSD35GenerateRequest(1, "a cat", 64, 64, 4, 4.5, 0)
+	if err != nil {
+		t.Fatalf("NewSD35GenerateRequest() failed: %v", err)
+	}
+	req.Priority = protocol.PriorityHigh
+	req.VAETiling = true
+	request, err := protocol.EncodeSD35GenerateRequest(req)
+	if err != nil {
+		t.Fatalf("EncodeSD35GenerateRequest() failed: %v", err)
+	}
+	priority := binary.BigEndian.Uint32(request[12:16]) & protocol.FlagPriorityMask
+
+	tests := []struct {
+		name      string
+		conn      *Conn
+		wantFlags uint32
+	}{
+		{name: "not negotiated", conn: &Conn{}, wantFlags: protocol.FlagVAETiling},
+		{name: "priority accepted", conn: &Conn{acceptedFlags: uint16(protocol.FlagVAETiling | protocol.FlagPriorityMask)}, wantFlags: protocol.FlagVAETiling | priority},
+		{name: "shared memory accepted", conn: &Conn{shmDir: "/run", acceptedFlags: uint16(protocol.FlagVAETiling | protocol.FlagSharedMemory)}, wantFlags: protocol.FlagVAETiling | protocol.FlagSharedMemory},
+		{name: "shared memory without directory", conn: &Conn{acceptedFlags: uint16(protocol.FlagSharedMemory | protocol.FlagPriorityMask)}, wantFlags: protocol.FlagVAETiling | priority},
+		{name: "seed accepted", conn: &Conn{acceptedFlags: uint16(protocol.FlagSeed)}, wantFlags: protocol.FlagVAETiling | protocol.FlagSeed},
+		{name: "metadata accepted", conn: &Conn{acceptedFlags: uint16(protocol.FlagSeed | protocol.FlagMetadata)}, wantFlags: protocol.FlagVAETiling | protocol.FlagSeed | protocol.FlagMetadata},
+		{name: "checksum accepted", conn: &Conn{acceptedFlags: uint16(protocol.FlagChecksum)}, wantFlags: protocol.FlagVAETiling | protocol.FlagChecksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.conn.adaptFlags(request)
+			if flags := binary.BigEndian.Uint32(got[12:16]); flags != tt.wantFlags {
+				t.Errorf("flags = 0x%08X, want 0x%08X", flags, tt.wantFlags)
+			}
+			if binary.BigEndian.Uint32(request[12:16]) != protocol.FlagVAETiling|priority {
+				t.Fatal("adaptFlags() modified the request")
+			}
+		})
+	}
+
+	// Requests without image data are never offered shared memory
+	ping := protocol.EncodePing(1)
+	conn := &Conn{shmDir: "/run", acceptedFlags: uint16(protocol.FlagSharedMemory)}
+	if got := conn.adaptFlags(ping); binary.BigEndian.Uint32(got[12:16]) != 0 {
+		t.Error("shared memory offered on a ping")
+	}
+
+	// Upscaling has no seed or metadata to report
+	upscale, err := protocol.EncodeUpscaleRequest(&protocol.UpscaleRequest{RequestID: 1, Width: 64, Height: 64, Channels: 3, TargetWidth: 128, TargetHeight: 128, Image: make([]byte, 64*64*3)})
+	if err != nil {
+		t.Fatalf("EncodeUpscaleRequest() failed: %v", err)
+	}
+	conn = &Conn{shmDir: "/run", acceptedFlags: uint16(protocol.FlagSharedMemory | protocol.FlagSeed | protocol.FlagMetadata)}
+	if got := conn.adaptFlags(upscale); binary.BigEndian.Uint32(got[12:16]) != protocol.FlagSharedMemory {
+		t.Errorf("upscale flags = 0x%08X, want shared memory only", binary.BigEndian.Uint32(got[12:16]))
+	}
+}
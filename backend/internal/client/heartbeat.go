@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// MaxHeartbeatFailures is how many heartbeat pings in a row may fail
+	// before the connection is closed as lost
+	MaxHeartbeatFailures = 3
+	// maxHeartbeatTimeout bounds the wait for the answer to a heartbeat
+	// ping; shorter intervals wait for one interval
+	maxHeartbeatTimeout = 5 * time.Second
+)
+
+// ErrHeartbeatLost is the error of a connection closed because compute
+// stopped answering heartbeat pings.
+var ErrHeartbeatLost = errors.New("weave-compute process stopped answering pings")
+
+// StartHeartbeat pings compute every interval until the connection is
+// closed, so a compute process that hangs is noticed before a user asks for
+// an image. A ping that times out while requests are pending is not a
+// failure: compute answers it after the generation in progress. After
+// MaxHeartbeatFailures pings in a row fail, the connection is closed, which
+// closes Done. For a pool every worker is pinged on its own. It does
+// nothing for per-request connections.
+func (c *Conn) StartHeartbeat(interval time.Duration) {
+	if c.workers != nil {
+		for _, w := range c.workers {
+			w.conn.StartHeartbeat(interval)
+		}
+		return
+	}
+	if c.readerDone == nil {
+		return
+	}
+	go c.heartbeat(interval)
+}
+
+// HeartbeatFailures returns how many heartbeat pings in a row failed and
+// the error of the last one, for a pool those of the worker with the most.
+func (c *Conn) HeartbeatFailures() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.workers != nil {
+		var failures int
+		var err error
+		for _, w := range c.workers {
+			if n, wErr := w.conn.HeartbeatFailures(); n > failures {
+				failures, err = n, wErr
+			}
+		}
+		return failures, err
+	}
+	return c.heartbeatFailures, c.heartbeatErr
+}
+
+// heartbeat runs the pings of StartHeartbeat.
+func (c *Conn) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	timeout := min(interval, maxHeartbeatTimeout)
+
+	for {
+		select {
+		case <-c.readerDone:
+			return
+		case <-ticker.C:
+		}
+
+		pending := c.Pending()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := c.Ping(ctx)
+		cancel()
+		if err != nil && pending > 0 && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrReadTimeout)) {
+			// Busy with a generation
+			continue
+		}
+
+		c.mu.Lock()
+		if err == nil {
+			c.heartbeatFailures, c.heartbeatErr = 0, nil
+		} else {
+			c.heartbeatFailures++
+			c.heartbeatErr = err
+		}
+		lost := c.heartbeatFailures >= MaxHeartbeatFailures
+		if lost {
+			c.heartbeatErr = fmt.Errorf("%w: %v", ErrHeartbeatLost, err)
+		}
+		c.mu.Unlock()
+
+		if lost {
+			c.conn.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat_ClosesUnresponsiveConnection(t *testing.T) {
+	// Compute reads pings and never answers them
+	conn := acceptWithFakeCompute(t, func(request []byte) []byte { return nil })
+	conn.StartHeartbeat(10 * time.Millisecond)
+
+	select {
+	case <-conn.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done() not closed for a compute that does not answer pings")
+	}
+	failures, err := conn.HeartbeatFailures()
+	if failures != MaxHeartbeatFailures || !errors.Is(err, ErrHeartbeatLost) {
+		t.Errorf("HeartbeatFailures() = %d, %v, want %d, ErrHeartbeatLost", failures, err, MaxHeartbeatFailures)
+	}
+}
+
+func TestHeartbeat_KeepsResponsiveConnection(t *testing.T) {
+	var pings atomic.Int32
+	conn := acceptWithFakeCompute(t, func(request []byte) []byte {
+		pings.Add(1)
+		return pongFor(request[16:24])
+	})
+	conn.StartHeartbeat(5 * time.Millisecond)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pings.Load() < 2*MaxHeartbeatFailures && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-conn.Done():
+		t.Fatal("Done() closed for a compute that answers pings")
+	default:
+	}
+	if failures, err := conn.HeartbeatFailures(); failures != 0 {
+		t.Errorf("HeartbeatFailures() = %d, %v, want 0", failures, err)
+	}
+}
+
+func TestHeartbeat_Pool(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	conns, _, _ := acceptPoolWorkers(t, 1, release)
+	hung := acceptWithFakeCompute(t, func(request []byte) []byte { return nil })
+	pool := NewPool(conns[0], hung)
+	pool.StartHeartbeat(10 * time.Millisecond)
+
+	select {
+	case <-pool.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done() of the pool not closed for a worker that does not answer pings")
+	}
+	if failures, _ := pool.HeartbeatFailures(); failures != MaxHeartbeatFailures {
+		t.Errorf("HeartbeatFailures() = %d, want %d from the hung worker", failures, MaxHeartbeatFailures)
+	}
+}
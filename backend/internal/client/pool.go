@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// maxWorkerFailures is how many requests in a row may fail on a worker
+// before the pool stops sending it requests while others are healthy.
+const maxWorkerFailures = 3
+
+// worker is one compute process of a pool. Its counters are guarded by the
+// pool's mu.
+type worker struct {
+	conn *Conn
+	// inFlight is how many requests sent through the pool await a response
+	inFlight int
+	// failures counts the requests in a row that failed
+	failures int
+	// served counts the requests answered
+	served uint64
+}
+
+// healthy reports whether the worker's connection is up and its recent
+// requests did not keep failing.
+func (w *worker) healthy() bool {
+	if w.failures >= maxWorkerFailures {
+		return false
+	}
+	if w.conn.readerDone != nil {
+		select {
+		case <-w.conn.readerDone:
+			return false
+		default:
+		}
+	}
+	return true
+}
+
+// WorkerStatus describes one compute process of a pool.
+type WorkerStatus struct {
+	Healthy  bool   // Connected, and its recent requests did not keep failing
+	Pending  int    // Requests waiting for a response
+	Failures int    // Requests in a row that failed
+	Served   uint64 // Requests answered
+}
+
+// NewPool returns a connection that spreads requests over conns, one per
+// compute process, so generations run on several GPUs at once. Each
+// request goes to the healthy worker with the fewest requests in flight,
+// taking turns between idle ones; compute handles one request at a time,
+// so a request sent to a busy worker waits behind it. A worker whose
+// connection closed, or whose last few requests failed, gets requests
+// again only when no worker is healthy or a ping to it succeeds.
+//
+// Ping checks every worker, Pending counts the requests of all of them and
+// Close closes them all. Done is closed when any worker's connection is
+// lost. ListModels and Capabilities answer for one worker.
+// A pool of one connection is that connection. Returns nil if conns is
+// empty.
+func NewPool(conns ...*Conn) *Conn {
+	switch len(conns) {
+	case 0:
+		return nil
+	case 1:
+		return conns[0]
+	}
+	c := &Conn{lost: make(chan struct{})}
+	var lostOnce sync.Once
+	for _, conn := range conns {
+		c.workers = append(c.workers, &worker{conn: conn})
+		if conn.readerDone != nil {
+			go func() {
+				<-conn.readerDone
+				lostOnce.Do(func() { close(c.lost) })
+			}()
+		}
+	}
+	return c
+}
+
+// Workers describes the compute processes of a pool, in the order given to
+// NewPool. It is nil for a single connection.
+func (c *Conn) Workers() []WorkerStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.workers == nil {
+		return nil
+	}
+	statuses := make([]WorkerStatus, len(c.workers))
+	for i, w := range c.workers {
+		statuses[i] = WorkerStatus{
+			Healthy:  w.healthy(),
+			Pending:  w.conn.Pending(),
+			Failures: w.failures,
+			Served:   w.served,
+		}
+	}
+	return statuses
+}
+
+// dispatch runs send on the worker acquireWorker picks and records how it
+// went.
+func (c *Conn) dispatch(send func(conn *Conn) ([]byte, error)) ([]byte, error) {
+	w := c.acquireWorker()
+	response, err := send(w.conn)
+	c.releaseWorker(w, err)
+	return response, err
+}
+
+// acquireWorker picks the worker for the next request: a healthy one
+// before an unhealthy one, then the one with the fewest requests in flight,
+// starting after the last one picked so idle workers take turns.
+func (c *Conn) acquireWorker() *worker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	best := -1
+	bestHealthy := false
+	for i := range c.workers {
+		idx := (c.nextWorker + i) % len(c.workers)
+		w := c.workers[idx]
+		healthy := w.healthy()
+		switch {
+		case best == -1,
+			healthy && !bestHealthy,
+			healthy == bestHealthy && w.inFlight < c.workers[best].inFlight:
+			best, bestHealthy = idx, healthy
+		}
+	}
+	c.nextWorker = (best + 1) % len(c.workers)
+	c.workers[best].inFlight++
+	return c.workers[best]
+}
+
+// releaseWorker records the outcome of a request sent to w. Requests the
+// caller cancelled don't count against the worker.
+func (c *Conn) releaseWorker(w *worker, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w.inFlight--
+	switch {
+	case err == nil:
+		w.failures = 0
+		w.served++
+	case errors.Is(err, context.Canceled):
+	default:
+		w.failures++
+	}
+}
+
+// pingWorkers pings every worker at once. A worker that answers is healthy
+// again. Returns nil if any worker answered, or the errors of all of them.
+func (c *Conn) pingWorkers(ctx context.Context) error {
+	errs := make([]error, len(c.workers))
+	var wg sync.WaitGroup
+	for i, w := range c.workers {
+		wg.Go(func() {
+			errs[i] = w.conn.Ping(ctx)
+			if errs[i] == nil {
+				c.mu.Lock()
+				w.failures = 0
+				c.mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closeWorkers closes the connections of every worker.
+func (c *Conn) closeWorkers() error {
+	var errs []error
+	for _, w := range c.workers {
+		if err := w.conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// acceptPoolWorkers returns n connections to fake computes that answer
+// pings once release is closed, counting the requests each one gets.
+func acceptPoolWorkers(t *testing.T, n int, release <-chan struct{}) ([]*Conn, []int, *sync.Mutex) {
+	t.Helper()
+
+	var mu sync.Mutex
+	counts := make([]int, n)
+	conns := make([]*Conn, n)
+	for i := range n {
+		conns[i] = acceptWithFakeCompute(t, func(request []byte) []byte {
+			mu.Lock()
+			counts[i]++
+			mu.Unlock()
+			<-release
+			return pongFor(request[16:24])
+		})
+	}
+	return conns, counts, &mu
+}
+
+func TestNewPool_Single(t *testing.T) {
+	conn := acceptWithFakeCompute(t, func(request []byte) []byte { return pongFor(request[16:24]) })
+	if got := NewPool(conn); got != conn {
+		t.Error("NewPool() of one connection is not that connection")
+	}
+	if NewPool() != nil {
+		t.Error("NewPool() of no connections is not nil")
+	}
+	if conn.Workers() != nil {
+		t.Error("Workers() of a single connection is not nil")
+	}
+}
+
+func TestPool_SpreadsRequests(t *testing.T) {
+	release := make(chan struct{})
+	conns, counts, mu := acceptPoolWorkers(t, 2, release)
+	pool := NewPool(conns...)
+
+	var wg sync.WaitGroup
+	for i := range 2 {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if _, err := pool.Send(ctx, protocol.EncodePing(uint64(i+1))); err != nil {
+				t.Errorf("Send() failed: %v", err)
+			}
+		})
+	}
+
+	// Both requests are in flight before either is answered
+	deadline := time.Now().Add(time.Second)
+	for pool.Pending() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := pool.Pending(); got != 2 {
+		t.Errorf("Pending() = %d, want 2", got)
+	}
+	close(release)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if counts[0] != 1 || counts[1] != 1 {
+		t.Errorf("requests per worker = %v, want one each", counts)
+	}
+	for i, w := range pool.Workers() {
+		if !w.Healthy || w.Served != 1 {
+			t.Errorf("worker %d = %+v, want healthy with one request served", i, w)
+		}
+	}
+}
+
+func TestPool_SkipsClosedWorker(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	conns, counts, mu := acceptPoolWorkers(t, 2, release)
+	pool := NewPool(conns...)
+	conns[0].Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := range 3 {
+		if _, err := pool.Send(ctx, protocol.EncodePing(uint64(i+1))); err != nil {
+			t.Fatalf("Send() failed: %v", err)
+		}
+	}
+
+	mu.Lock()
+	if counts[0] != 0 || counts[1] != 3 {
+		t.Errorf("requests per worker = %v, want all on worker 1", counts)
+	}
+	mu.Unlock()
+	if workers := pool.Workers(); workers[0].Healthy || !workers[1].Healthy {
+		t.Errorf("Workers() = %+v, want worker 0 unhealthy", workers)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		t.Errorf("Ping() = %v, want nil with one worker up", err)
+	}
+}
+
+func TestPool_PingAllDown(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	conns, _, _ := acceptPoolWorkers(t, 2, release)
+	pool := NewPool(conns...)
+	if err := pool.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := pool.Ping(ctx); err == nil {
+		t.Error("Ping() = nil, want an error with every worker closed")
+	}
+}
+
+func TestPool_DoneWhenWorkerLost(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	conns, _, _ := acceptPoolWorkers(t, 2, release)
+	pool := NewPool(conns...)
+
+	select {
+	case <-pool.Done():
+		t.Fatal("Done() closed with every worker connected")
+	default:
+	}
+
+	conns[1].Close()
+	select {
+	case <-conns[1].Done():
+	default:
+		t.Error("Done() of a closed connection is not closed")
+	}
+	select {
+	case <-pool.Done():
+	case <-time.After(time.Second):
+		t.Error("Done() of the pool not closed after a worker was lost")
+	}
+}
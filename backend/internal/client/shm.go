@@ -0,0 +1,81 @@
+package client
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// sharedImageOffset is where the image data, or the shared memory segment
+// name replacing it, starts in a generate response: header (16), response
+// fields (16), image metadata (16).
+const sharedImageOffset = 48
+
+// inlineSharedImage returns response with the image compute put in a shared
+// memory segment read into it, as if compute had sent it inline, and
+// unlinks the segment. What follows the segment name, the seed and
+// metadata of protocol.FlagSeed and protocol.FlagMetadata, is kept after the
+// pixels. Other responses are returned as they are.
+func (c *Conn) inlineSharedImage(response []byte) ([]byte, error) {
+	path, ok, err := c.sharedImagePath(response)
+	if !ok || err != nil {
+		return response, err
+	}
+	pixels, err := os.ReadFile(path)
+	os.Remove(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image from shared memory: %w", err)
+	}
+
+	dataLen := binary.BigEndian.Uint32(response[44:48])
+	if uint32(len(pixels)) != dataLen {
+		return nil, fmt.Errorf("shared memory segment holds %d bytes, image_data_len is %d", len(pixels), dataLen)
+	}
+	nameLen := int(binary.BigEndian.Uint16(response[sharedImageOffset : sharedImageOffset+2]))
+	trailer := response[sharedImageOffset+2+nameLen:]
+	inline := make([]byte, sharedImageOffset+len(pixels)+len(trailer))
+	copy(inline, response[:sharedImageOffset])
+	binary.BigEndian.PutUint32(inline[8:12], uint32(len(inline)-16))
+	flags := binary.BigEndian.Uint32(inline[12:16])
+	binary.BigEndian.PutUint32(inline[12:16], flags&^protocol.FlagSharedMemory)
+	copy(inline[sharedImageOffset:], pixels)
+	copy(inline[sharedImageOffset+len(pixels):], trailer)
+	return inline, nil
+}
+
+// discardSharedImage unlinks the shared memory segment of a response that
+// no caller waits for any more.
+func (c *Conn) discardSharedImage(response []byte) {
+	if path, ok, err := c.sharedImagePath(response); ok && err == nil {
+		os.Remove(path)
+	}
+}
+
+// sharedImagePath returns the path of the shared memory segment holding
+// the image of response. ok is false if response has its image inline.
+// Names that are not a segment in the socket directory are rejected.
+func (c *Conn) sharedImagePath(response []byte) (path string, ok bool, err error) {
+	if len(response) < 16 || binary.BigEndian.Uint16(response[6:8]) != protocol.MsgGenerateResponse ||
+		binary.BigEndian.Uint32(response[12:16])&protocol.FlagSharedMemory == 0 {
+		return "", false, nil
+	}
+	if c.shmDir == "" {
+		return "", true, fmt.Errorf("image in shared memory, which was not offered")
+	}
+	if len(response) < sharedImageOffset+2 {
+		return "", true, fmt.Errorf("shared memory response too short: %d bytes", len(response))
+	}
+	nameLen := int(binary.BigEndian.Uint16(response[sharedImageOffset : sharedImageOffset+2]))
+	if len(response) < sharedImageOffset+2+nameLen {
+		return "", true, fmt.Errorf("shared memory response is %d bytes, name_len is %d", len(response), nameLen)
+	}
+	name := string(response[sharedImageOffset+2 : sharedImageOffset+2+nameLen])
+	if !strings.HasPrefix(name, protocol.SharedMemoryPrefix) || filepath.Base(name) != name {
+		return "", true, fmt.Errorf("invalid shared memory segment name %q", name)
+	}
+	return filepath.Join(c.shmDir, name), true, nil
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// generateResponseFor builds a 64x64 RGB generate response for requestID
+// whose image data is data, setting flags in the header.
+func generateResponseFor(requestID []byte, flags uint32, data []byte) []byte {
+	resp := make([]byte, 48+len(data))
+	binary.BigEndian.PutUint32(resp[0:4], protocol.MagicNumber)
+	binary.BigEndian.PutUint16(resp[4:6], protocol.ProtocolVersion1)
+	binary.BigEndian.PutUint16(resp[6:8], protocol.MsgGenerateResponse)
+	binary.BigEndian.PutUint32(resp[8:12], uint32(len(resp)-16))
+	binary.BigEndian.PutUint32(resp[12:16], flags)
+	copy(resp[16:24], requestID)
+	binary.BigEndian.PutUint32(resp[24:28], protocol.StatusOK)
+	binary.BigEndian.PutUint32(resp[32:36], 64)
+	binary.BigEndian.PutUint32(resp[36:40], 64)
+	binary.BigEndian.PutUint32(resp[40:44], 3)
+	binary.BigEndian.PutUint32(resp[44:48], 64*64*3)
+	copy(resp[48:], data)
+	return resp
+}
+
+// sharedResponseFor builds a generate response for requestID whose image is
+// in the shared memory segment name.
+func sharedResponseFor(requestID []byte, name string) []byte {
+	handle := binary.BigEndian.AppendUint16(nil, uint16(len(name)))
+	return generateResponseFor(requestID, protocol.FlagSharedMemory, append(handle, name...))
+}
+
+func TestSend_SharedMemory(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0x5A}, 64*64*3)
+	dirs := make(chan string, 1)
+	offered := make(chan bool, 2)
+
+	conn := acceptWithFakeCompute(t, func(request []byte) []byte {
+		switch binary.BigEndian.Uint16(request[6:8]) {
+		case protocol.MsgHelloRequest:
+			hello := helloFor(request[16:24], protocol.ProtocolVersion1)
+			binary.BigEndian.PutUint16(hello[30:32], uint16(protocol.FlagSharedMemory))
+			return hello
+		case protocol.MsgGenerateRequest:
+			if binary.BigEndian.Uint32(request[12:16])&protocol.FlagSharedMemory == 0 {
+				offered <- false
+				return generateResponseFor(request[16:24], 0, pixels)
+			}
+			offered <- true
+			name := protocol.SharedMemoryPrefix + "1-0"
+			if err := os.WriteFile(filepath.Join(<-dirs, name), pixels, 0600); err != nil {
+				return nil
+			}
+			return sharedResponseFor(request[16:24], name)
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := protocol.NewSD35GenerateRequest(1, "a cat", 64, 64, 4, 4.5, 0)
+	if err != nil {
+		t.Fatalf("NewSD35GenerateRequest() failed: %v", err)
+	}
+	request, err := protocol.EncodeSD35GenerateRequest(req)
+	if err != nil {
+		t.Fatalf("EncodeSD35GenerateRequest() failed: %v", err)
+	}
+
+	// Shared memory is only offered to compute that accepts it
+	if _, err := conn.Send(ctx, request); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+	if <-offered {
+		t.Error("shared memory offered before negotiation")
+	}
+
+	if _, err := conn.Negotiate(ctx); err != nil {
+		t.Fatalf("Negotiate() failed: %v", err)
+	}
+	dirs <- conn.shmDir
+	response, err := conn.Send(ctx, request)
+	if err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+	if !<-offered {
+		t.Error("shared memory not offered after negotiation")
+	}
+	if binary.BigEndian.Uint32(request[12:16])&protocol.FlagSharedMemory != 0 {
+		t.Error("Send() modified the request")
+	}
+
+	decoded, err := protocol.DecodeResponse(response)
+	if err != nil {
+		t.Fatalf("DecodeResponse() failed: %v", err)
+	}
+	resp, ok := decoded.(*protocol.SD35GenerateResponse)
+	if !ok {
+		t.Fatalf("DecodeResponse() returned %T, want *protocol.SD35GenerateResponse", decoded)
+	}
+	if !bytes.Equal(resp.ImageData, pixels) {
+		t.Error("image data read from shared memory differs from the segment")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(conn.shmDir, protocol.SharedMemoryPrefix+"*")); len(matches) != 0 {
+		t.Errorf("segments left behind: %v", matches)
+	}
+}
+
+func TestInlineSharedImage_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	conn := &Conn{shmDir: dir}
+	id := make([]byte, 8)
+
+	// A file outside the socket directory is never read or removed
+	outside := filepath.Join(t.TempDir(), protocol.SharedMemoryPrefix+"1-0")
+	if err := os.WriteFile(outside, make([]byte, 64*64*3), 0600); err != nil {
+		t.Fatal(err)
+	}
+	short := protocol.SharedMemoryPrefix + "1-1"
+	if err := os.WriteFile(filepath.Join(dir, short), make([]byte, 10), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		conn     *Conn
+		response []byte
+	}{
+		{name: "path traversal", conn: conn, response: sharedResponseFor(id, "../"+filepath.Base(filepath.Dir(outside))+"/"+filepath.Base(outside))},
+		{name: "absolute path", conn: conn, response: sharedResponseFor(id, outside)},
+		{name: "not a segment", conn: conn, response: sharedResponseFor(id, "weave.sock")},
+		{name: "missing segment", conn: conn, response: sharedResponseFor(id, protocol.SharedMemoryPrefix+"1-2")},
+		{name: "segment too short", conn: conn, response: sharedResponseFor(id, short)},
+		{name: "truncated name", conn: conn, response: sharedResponseFor(id, protocol.SharedMemoryPrefix+"1-0")[:50]},
+		{name: "not offered", conn: &Conn{}, response: sharedResponseFor(id, protocol.SharedMemoryPrefix+"1-0")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.conn.inlineSharedImage(tt.response); err == nil {
+				t.Error("inlineSharedImage() succeeded, want an error")
+			}
+		})
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside the socket directory touched: %v", err)
+	}
+
+	// Responses with the image inline are left as they are
+	inline := generateResponseFor(id, 0, make([]byte, 64*64*3))
+	if got, err := conn.inlineSharedImage(inline); err != nil || !bytes.Equal(got, inline) {
+		t.Errorf("inlineSharedImage() of an inline response = %d bytes, %v, want it unchanged", len(got), err)
+	}
+}
+
+func TestInlineSharedImage_Seed(t *testing.T) {
+	dir := t.TempDir()
+	conn := &Conn{shmDir: dir}
+	pixels := bytes.Repeat([]byte{0x5A}, 64*64*3)
+	name := protocol.SharedMemoryPrefix + "1-0"
+	if err := os.WriteFile(filepath.Join(dir, name), pixels, 0600); err != nil {
+		t.Fatal(err)
+	}
+	response := binary.BigEndian.AppendUint64(sharedResponseFor(make([]byte, 8), name), 1234567890)
+	binary.BigEndian.PutUint32(response[8:12], uint32(len(response)-16))
+	binary.BigEndian.PutUint32(response[12:16], protocol.FlagSharedMemory|protocol.FlagSeed)
+
+	inline, err := conn.inlineSharedImage(response)
+	if err != nil {
+		t.Fatalf("inlineSharedImage() failed: %v", err)
+	}
+	decoded, err := protocol.DecodeResponse(inline)
+	if err != nil {
+		t.Fatalf("DecodeResponse() failed: %v", err)
+	}
+	resp := decoded.(*protocol.SD35GenerateResponse)
+	if resp.Seed != 1234567890 || !bytes.Equal(resp.ImageData, pixels) {
+		t.Errorf("decoded seed %d with %d bytes of image, want seed 1234567890 with the segment's pixels", resp.Seed, len(resp.ImageData))
+	}
+}
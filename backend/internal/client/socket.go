@@ -25,6 +25,13 @@
 //
 //	// Multiple goroutines can call Send() concurrently
 //	response, err := conn.Send(ctx, request)
+//
+// Compute may send preview frames (protocol.MsgPreview) for a generation
+// before its response. Send discards them; SendWithPreviews passes them to
+// a callback.
+//
+// With several compute processes, NewPool combines their connections into
+// one that sends each request to an idle process.
 package client
 
 import (
@@ -37,8 +44,12 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/hurricanerix/weave/internal/metrics"
+	"github.com/hurricanerix/weave/internal/protocol"
 )
 
 const (
@@ -51,8 +62,9 @@ const (
 	// readTimeout is the maximum time to wait for reading from the socket
 	// Set to 65s to be slightly longer than compute's 60s timeout to avoid race
 	readTimeout = 65 * time.Second
-	// maxPayloadSize is the maximum size of a response payload (10 MB)
-	maxPayloadSize = 10 * 1024 * 1024
+	// maxPayloadSize is the maximum size of a response frame's payload
+	// (20 MB); larger responses come in chunks (see chunked.go)
+	maxPayloadSize = 20 * 1024 * 1024
 )
 
 var (
@@ -70,10 +82,20 @@ var (
 	ErrConnectionClosed = errors.New("weave-compute process closed connection")
 	// ErrAcceptTimeout is returned when accepting a connection times out
 	ErrAcceptTimeout = errors.New("timeout waiting for compute process connection")
+	// ErrVersionNotNegotiated is returned by Negotiate when compute does not
+	// answer the hello, as compute that predates version negotiation does
+	ErrVersionNotNegotiated = errors.New("weave-compute process did not negotiate a protocol version")
 	// ErrReaderDead is returned when the response reader goroutine has stopped
 	ErrReaderDead = errors.New("response reader goroutine has stopped")
 )
 
+// Compute request metrics, exported at GET /metrics
+var (
+	queueDepth      = metrics.NewGauge("weave_compute_queue_depth", "Requests sent to the compute process that are waiting for a response.")
+	requestDuration = metrics.NewHistogram("weave_compute_request_duration_seconds", "Time from sending a request to the compute process to receiving its response.", metrics.SlowBuckets)
+	requestErrors   = metrics.NewCounter("weave_compute_request_errors_total", "Requests to the compute process that failed.")
+)
+
 // Conn represents a connection to the weave-compute process.
 //
 // For persistent connections (created via AcceptConnection), the connection
@@ -82,16 +104,62 @@ var (
 //
 // For per-request connections (created via Connect), the connection is not
 // multiplexed and behaves like the legacy pattern.
+//
+// For pools (created via NewPool), requests are sent over the connection of
+// one of the workers.
 type Conn struct {
 	conn net.Conn
 
 	// Multiplexing fields (nil for per-request connections)
 	mu              sync.Mutex
-	pendingRequests map[uint64]chan []byte // Maps request ID to response channel
-	readerDone      chan struct{}          // Closed when response reader exits
-	readerErr       error                  // Error from response reader (if any)
+	pendingRequests map[uint64]*pendingRequest // Maps request ID to its waiting caller
+	readerDone      chan struct{}              // Closed when response reader exits
+	readerErr       error                      // Error from response reader (if any)
+
+	// Heartbeat state, guarded by mu; see heartbeat.go
+	heartbeatFailures int   // Pings in a row that failed
+	heartbeatErr      error // Error of the last failed ping
+
+	pingSeq atomic.Uint64 // Counter for ping request IDs
+
+	// version is the protocol version agreed by Negotiate, guarded by mu;
+	// 0 until then
+	version uint16
+	// acceptedFlags are the header flags compute accepts, from the hello,
+	// guarded by mu
+	acceptedFlags uint16
+
+	// maxResponseSize is the largest response payload accepted, 0 for
+	// DefaultMaxResponseSize; see SetMaxResponseSize
+	maxResponseSize atomic.Int64
+
+	// shmDir is the socket directory, where compute puts images in shared
+	// memory; see shm.go. Empty for per-request connections.
+	shmDir string
+
+	// Pool fields (nil for single connections), guarded by mu; see pool.go
+	workers    []*worker
+	nextWorker int           // Index at which acquireWorker starts looking
+	lost       chan struct{} // Closed when the connection of a worker is lost
+}
+
+// pendingRequest is a request waiting for its response on a multiplexed
+// connection.
+type pendingRequest struct {
+	// response receives the response; it is closed if the reader fails
+	// or err is set
+	response chan []byte
+	// err is why the response failed when the connection did not, set
+	// before response is closed
+	err error
+	// previews receives preview frames; nil if the caller does not want them
+	previews chan []byte
 }
 
+// previewBuffer is how many preview frames may wait for a caller before
+// newer ones are dropped.
+const previewBuffer = 4
+
 // Connect establishes a connection to the weave-compute process.
 // It reads XDG_RUNTIME_DIR from the environment, constructs the socket path,
 // and connects with appropriate timeouts.
@@ -177,22 +245,36 @@ func AcceptConnection(ctx context.Context, listener net.Listener) (*Conn, error)
 	// behavior for a persistent connection. Individual request timeouts are
 	// handled by context deadlines in Send().
 
-	// Create multiplexed connection
+	shmDir := ""
+	if addr := listener.Addr(); addr.Network() == "unix" {
+		shmDir = filepath.Dir(addr.String())
+	}
+	return newMultiplexedConn(conn, shmDir), nil
+}
+
+// newMultiplexedConn returns a multiplexed connection over conn and starts
+// its response reader goroutine. shmDir is where compute may put images in
+// shared memory, empty if it can't.
+func newMultiplexedConn(conn net.Conn, shmDir string) *Conn {
 	c := &Conn{
 		conn:            conn,
-		pendingRequests: make(map[uint64]chan []byte),
+		pendingRequests: make(map[uint64]*pendingRequest),
 		readerDone:      make(chan struct{}),
+		shmDir:          shmDir,
 	}
 
 	// Start response reader goroutine
 	go c.responseReader()
 
-	return c, nil
+	return c
 }
 
 // Close closes the connection to the compute process.
 // For multiplexed connections, this also stops the response reader goroutine.
 func (c *Conn) Close() error {
+	if c.workers != nil {
+		return c.closeWorkers()
+	}
 	if c.conn == nil {
 		return nil
 	}
@@ -209,8 +291,19 @@ func (c *Conn) Close() error {
 	return err
 }
 
+// Done returns a channel that is closed when the connection to compute is
+// closed or lost, for a pool when that of any worker is. It is nil, and
+// never closed, for per-request connections.
+func (c *Conn) Done() <-chan struct{} {
+	if c.workers != nil {
+		return c.lost
+	}
+	return c.readerDone
+}
+
 // RawConn returns the underlying net.Conn for protocol layer access.
-// Use this for reading/writing binary protocol messages.
+// Use this for reading/writing binary protocol messages. It is nil for a
+// pool.
 func (c *Conn) RawConn() net.Conn {
 	return c.conn
 }
@@ -221,60 +314,28 @@ func (c *Conn) RawConn() net.Conn {
 //
 // The reader extracts the request ID from each response header (bytes 16-23)
 // and delivers the response to the corresponding channel in pendingRequests.
+// Preview frames go to the request's preview channel, which keeps it
+// pending; they are dropped if the caller does not want them or is behind.
 func (c *Conn) responseReader() {
 	defer close(c.readerDone)
 
 	for {
-		// Read response header (16 bytes)
-		header := make([]byte, 16)
-		if _, err := io.ReadFull(c.conn, header); err != nil {
-			c.mu.Lock()
-			c.readerErr = classifyReadError(err)
-			// Notify all pending requests of the error
-			for _, ch := range c.pendingRequests {
-				close(ch)
-			}
-			c.pendingRequests = make(map[uint64]chan []byte)
-			c.mu.Unlock()
-			return
+		response, err := readMessage(c.conn, c.maxResponse())
+		if errors.Is(err, ErrResponseTooLarge) || errors.Is(err, ErrChecksumMismatch) {
+			c.failRequest(response, err)
+			continue
 		}
-
-		// Extract payload length from header (bytes 8-11, big-endian)
-		payloadLen := binary.BigEndian.Uint32(header[8:12])
-
-		// Validate payload length
-		if payloadLen > maxPayloadSize {
+		if err != nil {
 			c.mu.Lock()
-			c.readerErr = fmt.Errorf("payload too large: %d bytes (max %d)", payloadLen, maxPayloadSize)
+			c.readerErr = err
 			// Notify all pending requests of the error
-			for _, ch := range c.pendingRequests {
-				close(ch)
+			for _, p := range c.pendingRequests {
+				close(p.response)
 			}
-			c.pendingRequests = make(map[uint64]chan []byte)
+			c.pendingRequests = make(map[uint64]*pendingRequest)
 			c.mu.Unlock()
 			return
 		}
-
-		// Allocate buffer for full message (header + payload)
-		totalLen := 16 + payloadLen
-		response := make([]byte, totalLen)
-		copy(response, header)
-
-		// Read remaining payload
-		if payloadLen > 0 {
-			if _, err := io.ReadFull(c.conn, response[16:]); err != nil {
-				c.mu.Lock()
-				c.readerErr = classifyReadError(err)
-				// Notify all pending requests of the error
-				for _, ch := range c.pendingRequests {
-					close(ch)
-				}
-				c.pendingRequests = make(map[uint64]chan []byte)
-				c.mu.Unlock()
-				return
-			}
-		}
-
 		// Extract request ID from response payload (bytes 16-23, little-endian)
 		// The protocol has: Header (16 bytes) + RequestID (8 bytes) + ...
 		if len(response) < 24 {
@@ -283,9 +344,24 @@ func (c *Conn) responseReader() {
 		}
 		requestID := binary.LittleEndian.Uint64(response[16:24])
 
+		// Preview frames precede the response and leave the request pending
+		if binary.BigEndian.Uint16(response[6:8]) == protocol.MsgPreview {
+			c.mu.Lock()
+			p, ok := c.pendingRequests[requestID]
+			c.mu.Unlock()
+			if ok && p.previews != nil {
+				select {
+				case p.previews <- response:
+				default:
+					// Caller is behind - drop the frame
+				}
+			}
+			continue
+		}
+
 		// Route response to the correct pending request
 		c.mu.Lock()
-		ch, ok := c.pendingRequests[requestID]
+		p, ok := c.pendingRequests[requestID]
 		if ok {
 			delete(c.pendingRequests, requestID)
 			c.mu.Unlock()
@@ -293,18 +369,39 @@ func (c *Conn) responseReader() {
 			// Send response to waiting goroutine
 			// Use non-blocking send in case the receiver has timed out
 			select {
-			case ch <- response:
+			case p.response <- response:
 			default:
 				// Receiver already timed out - discard response
+				c.discardSharedImage(response)
 			}
 		} else {
 			c.mu.Unlock()
 			// No pending request for this ID - likely a late response after timeout
 			// This is benign, just discard it
+			c.discardSharedImage(response)
 		}
 	}
 }
 
+// failRequest fails the pending request whose response starts with
+// response with err, without failing the connection.
+func (c *Conn) failRequest(response []byte, err error) {
+	if len(response) < 24 {
+		return
+	}
+	requestID := binary.LittleEndian.Uint64(response[16:24])
+	c.mu.Lock()
+	p, ok := c.pendingRequests[requestID]
+	if ok {
+		delete(c.pendingRequests, requestID)
+	}
+	c.mu.Unlock()
+	if ok {
+		p.err = err
+		close(p.response)
+	}
+}
+
 // Send sends a protocol message to the compute process and reads the response.
 //
 // For multiplexed connections (created via AcceptConnection), this method:
@@ -324,6 +421,20 @@ func (c *Conn) responseReader() {
 //
 // Returns the response bytes or an error if the send/receive fails.
 func (c *Conn) Send(ctx context.Context, request []byte) ([]byte, error) {
+	return c.SendWithPreviews(ctx, request, nil)
+}
+
+// SendWithPreviews is Send, also calling onPreview with each preview frame
+// (a complete protocol.MsgPreview message) compute sends for the request
+// before its response. onPreview runs on the calling goroutine. On a
+// multiplexed connection, frames arriving faster than onPreview handles
+// them are dropped. A nil onPreview discards them.
+func (c *Conn) SendWithPreviews(ctx context.Context, request []byte, onPreview func(frame []byte)) ([]byte, error) {
+	if c.workers != nil {
+		return c.dispatch(func(conn *Conn) ([]byte, error) {
+			return conn.SendWithPreviews(ctx, request, onPreview)
+		})
+	}
 	if c.conn == nil {
 		return nil, errors.New("connection is nil")
 	}
@@ -333,19 +444,259 @@ func (c *Conn) Send(ctx context.Context, request []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	// Check if this is a multiplexed connection
+	queueDepth.Inc()
+	defer queueDepth.Dec()
+	start := time.Now()
+	defer requestDuration.ObserveSince(start)
+
+	var response []byte
+	var err error
+	if c.pendingRequests != nil {
+		// Multiplexed connection
+		response, err = c.sendMultiplexed(ctx, c.adaptFlags(request), onPreview)
+		if err == nil {
+			response, err = c.inlineSharedImage(response)
+		}
+	} else {
+		// Non-multiplexed connection (legacy behavior)
+		response, err = c.sendDirect(ctx, c.adaptFlags(request), onPreview)
+	}
+	if err != nil {
+		requestErrors.Inc()
+	}
+	return response, err
+}
+
+// pingIDFlag is set in the request ID of every ping and models request so
+// that they never share an ID with generation requests, which count up
+// from 1 or are derived from a request ID (see package requestid) with the
+// top bit clear.
+const pingIDFlag = 1 << 63
+
+// Ping sends a PING frame and waits for the matching PONG. It checks that
+// the compute process is alive and reading requests. Compute handles one
+// request at a time, so a ping sent during a generation waits for it to
+// finish; use a context deadline and Pending to tell busy from stuck.
+//
+// Pings are not counted in the compute request metrics.
+func (c *Conn) Ping(ctx context.Context) error {
+	if c.workers != nil {
+		return c.pingWorkers(ctx)
+	}
+	if c.conn == nil {
+		return errors.New("connection is nil")
+	}
+
+	requestID := pingIDFlag | c.pingSeq.Add(1)
+	data, err := c.sendUncounted(ctx, protocol.EncodePing(requestID))
+	if err != nil {
+		return err
+	}
+
+	resp, err := protocol.DecodeResponse(data)
+	if err != nil {
+		return fmt.Errorf("invalid ping response: %w", err)
+	}
+	switch resp := resp.(type) {
+	case *protocol.PongResponse:
+		if resp.RequestID != requestID {
+			return fmt.Errorf("pong for request %d, expected %d", resp.RequestID, requestID)
+		}
+		return nil
+	case *protocol.ErrorResponse:
+		return fmt.Errorf("ping rejected: %s", resp.ErrorMessage)
+	default:
+		return fmt.Errorf("unexpected ping response: %T", resp)
+	}
+}
+
+// ListModels asks compute for the diffusion models it knows, with whether
+// each is installed and which one is loaded. Like a ping, the request waits
+// for any generation in progress.
+func (c *Conn) ListModels(ctx context.Context) ([]protocol.ModelInfo, error) {
+	if c.conn == nil && c.workers == nil {
+		return nil, errors.New("connection is nil")
+	}
+
+	requestID := pingIDFlag | c.pingSeq.Add(1)
+	data, err := c.sendUncounted(ctx, protocol.EncodeModelsRequest(requestID))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := protocol.DecodeResponse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid models response: %w", err)
+	}
+	switch resp := resp.(type) {
+	case *protocol.ModelsResponse:
+		if resp.RequestID != requestID {
+			return nil, fmt.Errorf("models response for request %d, expected %d", resp.RequestID, requestID)
+		}
+		return resp.Models, nil
+	case *protocol.ErrorResponse:
+		return nil, fmt.Errorf("models request rejected: %s", resp.ErrorMessage)
+	default:
+		return nil, fmt.Errorf("unexpected models response: %T", resp)
+	}
+}
+
+// Capabilities asks compute what it can do: the protocol versions and
+// request types it accepts, the largest image it generates, its GPU memory
+// and its models. It fails if compute does not speak this protocol version.
+// Like a ping, the request waits for any generation in progress.
+func (c *Conn) Capabilities(ctx context.Context) (*protocol.Capabilities, error) {
+	if c.conn == nil && c.workers == nil {
+		return nil, errors.New("connection is nil")
+	}
+
+	requestID := pingIDFlag | c.pingSeq.Add(1)
+	data, err := c.sendUncounted(ctx, protocol.EncodeCapabilitiesRequest(requestID))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := protocol.DecodeResponse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capabilities response: %w", err)
+	}
+	switch resp := resp.(type) {
+	case *protocol.Capabilities:
+		if resp.RequestID != requestID {
+			return nil, fmt.Errorf("capabilities response for request %d, expected %d", resp.RequestID, requestID)
+		}
+		if version := c.Version(); version < resp.MinVersion || version > resp.MaxVersion {
+			return nil, fmt.Errorf("compute speaks protocol versions %d to %d, not %d", resp.MinVersion, resp.MaxVersion, version)
+		}
+		return resp, nil
+	case *protocol.ErrorResponse:
+		return nil, fmt.Errorf("capabilities request rejected: %s", resp.ErrorMessage)
+	default:
+		return nil, fmt.Errorf("unexpected capabilities response: %T", resp)
+	}
+}
+
+// Negotiate agrees on the protocol version to speak with compute: the
+// newest both sides speak. It should be the first request on a connection.
+// For a pool every worker negotiates.
+//
+// Compute that predates negotiation does not answer the hello, so it times
+// out with ctx; the connection then keeps speaking version 1, the only
+// version such compute knows, and ErrVersionNotNegotiated is returned. If
+// compute speaks no version weave does, the error names the versions of
+// both sides. Compute also says which header flags it accepts; image
+// requests then offer to take the image in shared memory if it does.
+func (c *Conn) Negotiate(ctx context.Context) (uint16, error) {
+	if c.workers != nil {
+		var notNegotiated error
+		for _, w := range c.workers {
+			if _, err := w.conn.Negotiate(ctx); errors.Is(err, ErrVersionNotNegotiated) {
+				notNegotiated = err
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		return c.Version(), notNegotiated
+	}
+	if c.conn == nil {
+		return 0, errors.New("connection is nil")
+	}
+
+	requestID := pingIDFlag | c.pingSeq.Add(1)
+	hello := protocol.EncodeHelloRequest(requestID, protocol.MinSupportedVersion, protocol.MaxSupportedVersion)
+	data, err := c.sendUncounted(ctx, hello)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrReadTimeout) {
+			return protocol.ProtocolVersion1, fmt.Errorf("%w: %v", ErrVersionNotNegotiated, err)
+		}
+		return 0, err
+	}
+
+	resp, err := protocol.DecodeResponse(data)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hello response: %w", err)
+	}
+	switch resp := resp.(type) {
+	case *protocol.HelloResponse:
+		if resp.RequestID != requestID {
+			return 0, fmt.Errorf("hello response for request %d, expected %d", resp.RequestID, requestID)
+		}
+		if resp.Version < protocol.MinSupportedVersion || resp.Version > protocol.MaxSupportedVersion {
+			return 0, fmt.Errorf("%w: compute chose version %d, weave speaks %d to %d",
+				protocol.ErrUnsupportedVersion, resp.Version, protocol.MinSupportedVersion, protocol.MaxSupportedVersion)
+		}
+		c.mu.Lock()
+		c.version = resp.Version
+		c.acceptedFlags = resp.Flags
+		c.mu.Unlock()
+		return resp.Version, nil
+	case *protocol.ErrorResponse:
+		if resp.ErrorCode == protocol.ErrCodeUnsupportedVersion {
+			return 0, fmt.Errorf("%w: %s, weave speaks %d to %d",
+				protocol.ErrUnsupportedVersion, resp.ErrorMessage, protocol.MinSupportedVersion, protocol.MaxSupportedVersion)
+		}
+		return 0, fmt.Errorf("hello rejected: %s", resp.ErrorMessage)
+	default:
+		return 0, fmt.Errorf("unexpected hello response: %T", resp)
+	}
+}
+
+// Version returns the protocol version agreed with compute by Negotiate,
+// for a pool the oldest of its workers'. It is version 1, which every
+// compute speaks, until Negotiate succeeds.
+func (c *Conn) Version() uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.workers != nil {
+		var version uint16
+		for _, w := range c.workers {
+			if v := w.conn.Version(); version == 0 || v < version {
+				version = v
+			}
+		}
+		return version
+	}
+	if c.version == 0 {
+		return protocol.ProtocolVersion1
+	}
+	return c.version
+}
+
+// sendUncounted sends a request that is not counted in the compute request
+// metrics and returns its response.
+func (c *Conn) sendUncounted(ctx context.Context, request []byte) ([]byte, error) {
+	if c.workers != nil {
+		return c.dispatch(func(conn *Conn) ([]byte, error) {
+			return conn.sendUncounted(ctx, request)
+		})
+	}
 	if c.pendingRequests != nil {
-		return c.sendMultiplexed(ctx, request)
+		return c.sendMultiplexed(ctx, request, nil)
 	}
+	return c.sendDirect(ctx, request, nil)
+}
 
-	// Non-multiplexed connection (legacy behavior)
-	return c.sendDirect(ctx, request)
+// Pending returns the number of requests waiting for a response on a
+// multiplexed connection, or on all the workers of a pool. It is always 0
+// for per-request connections.
+func (c *Conn) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.workers != nil {
+		pending := 0
+		for _, w := range c.workers {
+			pending += w.conn.Pending()
+		}
+		return pending
+	}
+	return len(c.pendingRequests)
 }
 
 // sendMultiplexed sends a request over a multiplexed connection.
 // It extracts the request ID, registers a response channel, and waits for
-// the response reader to deliver the response.
-func (c *Conn) sendMultiplexed(ctx context.Context, request []byte) ([]byte, error) {
+// the response reader to deliver the response, passing preview frames to
+// onPreview (if not nil) meanwhile.
+func (c *Conn) sendMultiplexed(ctx context.Context, request []byte, onPreview func(frame []byte)) ([]byte, error) {
 	// Extract request ID from request (bytes 16-23, little-endian)
 	// Protocol: Header (16 bytes) + RequestID (8 bytes) + ...
 	if len(request) < 24 {
@@ -354,7 +705,10 @@ func (c *Conn) sendMultiplexed(ctx context.Context, request []byte) ([]byte, err
 	requestID := binary.LittleEndian.Uint64(request[16:24])
 
 	// Create response channel for this request
-	responseCh := make(chan []byte, 1)
+	pending := &pendingRequest{response: make(chan []byte, 1)}
+	if onPreview != nil {
+		pending.previews = make(chan []byte, previewBuffer)
+	}
 
 	// Register pending request
 	c.mu.Lock()
@@ -368,7 +722,7 @@ func (c *Conn) sendMultiplexed(ctx context.Context, request []byte) ([]byte, err
 		return nil, ErrReaderDead
 	default:
 	}
-	c.pendingRequests[requestID] = responseCh
+	c.pendingRequests[requestID] = pending
 	c.mu.Unlock()
 
 	// Write request to socket
@@ -398,50 +752,68 @@ func (c *Conn) sendMultiplexed(ctx context.Context, request []byte) ([]byte, err
 	timer := time.NewTimer(timeout)
 	defer timer.Stop()
 
-	select {
-	case <-ctx.Done():
-		// Context cancelled - remove pending request
-		c.mu.Lock()
-		delete(c.pendingRequests, requestID)
-		c.mu.Unlock()
-		return nil, ctx.Err()
-
-	case <-timer.C:
-		// Timeout - remove pending request
-		c.mu.Lock()
-		delete(c.pendingRequests, requestID)
-		c.mu.Unlock()
-		return nil, ErrReadTimeout
+	for {
+		select {
+		case <-ctx.Done():
+			// Context cancelled - remove pending request
+			c.mu.Lock()
+			delete(c.pendingRequests, requestID)
+			c.mu.Unlock()
+			return nil, ctx.Err()
 
-	case <-c.readerDone:
-		// Response reader died - return error
-		c.mu.Lock()
-		delete(c.pendingRequests, requestID)
-		err := c.readerErr
-		c.mu.Unlock()
-		if err != nil {
-			return nil, err
-		}
-		return nil, ErrReaderDead
+		case <-timer.C:
+			// Timeout - remove pending request
+			c.mu.Lock()
+			delete(c.pendingRequests, requestID)
+			c.mu.Unlock()
+			return nil, ErrReadTimeout
 
-	case response, ok := <-responseCh:
-		if !ok {
-			// Channel closed by response reader due to error
+		case <-c.readerDone:
+			// Response reader died - return error
 			c.mu.Lock()
+			delete(c.pendingRequests, requestID)
 			err := c.readerErr
 			c.mu.Unlock()
 			if err != nil {
 				return nil, err
 			}
-			return nil, ErrConnectionClosed
+			return nil, ErrReaderDead
+
+		case frame := <-pending.previews:
+			// Never ready when previews is nil
+			onPreview(frame)
+
+		case response, ok := <-pending.response:
+			if !ok && pending.err != nil {
+				return nil, pending.err
+			}
+			if !ok {
+				// Channel closed by response reader due to error
+				c.mu.Lock()
+				err := c.readerErr
+				c.mu.Unlock()
+				if err != nil {
+					return nil, err
+				}
+				return nil, ErrConnectionClosed
+			}
+			// Frames queued before the response still go out, in order
+			for {
+				select {
+				case frame := <-pending.previews:
+					onPreview(frame)
+				default:
+					return response, nil
+				}
+			}
 		}
-		return response, nil
 	}
 }
 
 // sendDirect sends a request over a non-multiplexed connection (legacy behavior).
-// This is the original implementation used by Connect().
-func (c *Conn) sendDirect(ctx context.Context, request []byte) ([]byte, error) {
+// This is the original implementation used by Connect(). Preview frames
+// read before the response are passed to onPreview if it is not nil.
+func (c *Conn) sendDirect(ctx context.Context, request []byte, onPreview func(frame []byte)) ([]byte, error) {
 	// Write request to socket
 	if _, err := c.conn.Write(request); err != nil {
 		return nil, fmt.Errorf("failed to write request: %w", err)
@@ -456,33 +828,18 @@ func (c *Conn) sendDirect(ctx context.Context, request []byte) ([]byte, error) {
 		return nil, fmt.Errorf("failed to reset read deadline: %w", err)
 	}
 
-	// Read response header first (16 bytes) to determine payload length
-	header := make([]byte, 16)
-	if _, err := io.ReadFull(c.conn, header); err != nil {
-		return nil, classifyReadError(err)
-	}
-
-	// Extract payload length from header (bytes 8-11, big-endian)
-	payloadLen := binary.BigEndian.Uint32(header[8:12])
-
-	// Validate payload length (protect against malicious compute process)
-	if payloadLen > maxPayloadSize {
-		return nil, fmt.Errorf("payload too large: %d bytes (max %d)", payloadLen, maxPayloadSize)
-	}
-
-	// Allocate buffer for full message (header + payload)
-	totalLen := 16 + payloadLen
-	response := make([]byte, totalLen)
-	copy(response, header)
-
-	// Read remaining payload
-	if payloadLen > 0 {
-		if _, err := io.ReadFull(c.conn, response[16:]); err != nil {
-			return nil, classifyReadError(err)
+	for {
+		response, err := readMessage(c.conn, c.maxResponse())
+		if err != nil {
+			return nil, err
+		}
+		if binary.BigEndian.Uint16(response[6:8]) != protocol.MsgPreview {
+			return response, nil
+		}
+		if onPreview != nil {
+			onPreview(response)
 		}
 	}
-
-	return response, nil
 }
 
 // getSocketPath constructs the socket path from XDG_RUNTIME_DIR
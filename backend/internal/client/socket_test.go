@@ -2,15 +2,20 @@ package client
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"syscall"
 	"testing"
 	"time"
+
+	"github.com/hurricanerix/weave/internal/protocol"
 )
 
 func TestGetSocketPath(t *testing.T) {
@@ -925,7 +930,7 @@ func TestMultiplexedSend(t *testing.T) {
 	// since we already have the connection
 	conn := &Conn{
 		conn:            clientConn,
-		pendingRequests: make(map[uint64]chan []byte),
+		pendingRequests: make(map[uint64]*pendingRequest),
 		readerDone:      make(chan struct{}),
 	}
 	go conn.responseReader()
@@ -1077,3 +1082,364 @@ func TestMultiplexedCloseWaitsForReader(t *testing.T) {
 		t.Error("Close() did not wait for response reader to exit")
 	}
 }
+
+// acceptWithFakeCompute accepts a connection from a fake compute process
+// that answers every request with respond(request).
+func acceptWithFakeCompute(t *testing.T, respond func(request []byte) []byte) *Conn {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			header := make([]byte, 16)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+			request := make([]byte, 16+binary.BigEndian.Uint32(header[8:12]))
+			copy(request, header)
+			if _, err := io.ReadFull(conn, request[16:]); err != nil {
+				return
+			}
+			if response := respond(request); response != nil {
+				conn.Write(response)
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := AcceptConnection(ctx, listener)
+	if err != nil {
+		t.Fatalf("AcceptConnection() failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// pongFor builds a PONG for the given request ID.
+func pongFor(requestID []byte) []byte {
+	pong := make([]byte, 24)
+	binary.BigEndian.PutUint32(pong[0:4], protocol.MagicNumber)
+	binary.BigEndian.PutUint16(pong[4:6], protocol.ProtocolVersion1)
+	binary.BigEndian.PutUint16(pong[6:8], protocol.MsgPong)
+	binary.BigEndian.PutUint32(pong[8:12], 8)
+	copy(pong[16:24], requestID)
+	return pong
+}
+
+func TestPing(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(request []byte) []byte
+		wantErr bool
+	}{
+		{
+			name: "pong",
+			respond: func(request []byte) []byte {
+				if binary.BigEndian.Uint16(request[6:8]) != protocol.MsgPing {
+					return nil
+				}
+				return pongFor(request[16:24])
+			},
+		},
+		{
+			name: "error response",
+			respond: func(request []byte) []byte {
+				resp := make([]byte, 16+18+4)
+				binary.BigEndian.PutUint32(resp[0:4], protocol.MagicNumber)
+				binary.BigEndian.PutUint16(resp[4:6], protocol.ProtocolVersion1)
+				binary.BigEndian.PutUint16(resp[6:8], protocol.MsgError)
+				binary.BigEndian.PutUint32(resp[8:12], uint32(len(resp)-16))
+				copy(resp[16:24], request[16:24])
+				binary.BigEndian.PutUint32(resp[24:28], protocol.StatusBadRequest)
+				binary.BigEndian.PutUint16(resp[32:34], 4)
+				copy(resp[34:], "nope")
+				return resp
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no response",
+			respond: func(request []byte) []byte { return nil },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := acceptWithFakeCompute(t, tt.respond)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err := conn.Ping(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Ping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := conn.Pending(); got != 0 {
+				t.Errorf("Pending() = %d after ping, want 0", got)
+			}
+		})
+	}
+}
+
+func TestPingUsesDistinctRequestIDs(t *testing.T) {
+	ids := make(chan uint64, 2)
+	conn := acceptWithFakeCompute(t, func(request []byte) []byte {
+		ids <- binary.BigEndian.Uint64(request[16:24])
+		return pongFor(request[16:24])
+	})
+
+	for range 2 {
+		if err := conn.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping() failed: %v", err)
+		}
+	}
+
+	first, second := <-ids, <-ids
+	if first == second {
+		t.Errorf("pings shared request ID %d", first)
+	}
+	if first&pingIDFlag == 0 || second&pingIDFlag == 0 {
+		t.Errorf("ping request IDs %#x, %#x missing the ping flag", first, second)
+	}
+}
+
+func TestListModels(t *testing.T) {
+	conn := acceptWithFakeCompute(t, func(request []byte) []byte {
+		if binary.BigEndian.Uint16(request[6:8]) != protocol.MsgModelsRequest {
+			return nil
+		}
+		if binary.BigEndian.Uint64(request[16:24])&pingIDFlag == 0 {
+			return nil
+		}
+		name := "flux1-schnell"
+		resp := make([]byte, 16+8+4+16+len(name))
+		binary.BigEndian.PutUint32(resp[0:4], protocol.MagicNumber)
+		binary.BigEndian.PutUint16(resp[4:6], protocol.ProtocolVersion1)
+		binary.BigEndian.PutUint16(resp[6:8], protocol.MsgModelsResponse)
+		binary.BigEndian.PutUint32(resp[8:12], uint32(len(resp)-16))
+		copy(resp[16:24], request[16:24])
+		binary.BigEndian.PutUint32(resp[24:28], 1)
+		binary.BigEndian.PutUint32(resp[28:32], protocol.ModelIDFlux)
+		binary.BigEndian.PutUint32(resp[32:36], protocol.ModelStatusLoaded)
+		binary.BigEndian.PutUint32(resp[36:40], 11000)
+		binary.BigEndian.PutUint32(resp[40:44], uint32(len(name)))
+		copy(resp[44:], name)
+		return resp
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	models, err := conn.ListModels(ctx)
+	if err != nil {
+		t.Fatalf("ListModels() failed: %v", err)
+	}
+	want := []protocol.ModelInfo{{ModelID: protocol.ModelIDFlux, Status: protocol.ModelStatusLoaded, VRAMMB: 11000, Name: "flux1-schnell"}}
+	if !reflect.DeepEqual(models, want) {
+		t.Errorf("ListModels() = %+v, want %+v", models, want)
+	}
+}
+
+// capabilitiesFor returns a capabilities response for requestID from a
+// compute speaking protocol versions minVersion to maxVersion that accepts
+// generate requests up to 1024x1024 and knows no models.
+func capabilitiesFor(requestID []byte, minVersion, maxVersion uint16) []byte {
+	resp := make([]byte, 16+8+24+4)
+	binary.BigEndian.PutUint32(resp[0:4], protocol.MagicNumber)
+	binary.BigEndian.PutUint16(resp[4:6], protocol.ProtocolVersion1)
+	binary.BigEndian.PutUint16(resp[6:8], protocol.MsgCapabilitiesResponse)
+	binary.BigEndian.PutUint32(resp[8:12], uint32(len(resp)-16))
+	copy(resp[16:24], requestID)
+	binary.BigEndian.PutUint16(resp[24:26], minVersion)
+	binary.BigEndian.PutUint16(resp[26:28], maxVersion)
+	binary.BigEndian.PutUint32(resp[28:32], 1<<protocol.MsgGenerateRequest)
+	binary.BigEndian.PutUint32(resp[32:36], 1024)
+	binary.BigEndian.PutUint32(resp[36:40], 1024)
+	return resp
+}
+
+func TestCapabilities(t *testing.T) {
+	conn := acceptWithFakeCompute(t, func(request []byte) []byte {
+		if binary.BigEndian.Uint16(request[6:8]) != protocol.MsgCapabilitiesRequest {
+			return nil
+		}
+		return capabilitiesFor(request[16:24], protocol.ProtocolVersion1, protocol.ProtocolVersion1)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	caps, err := conn.Capabilities(ctx)
+	if err != nil {
+		t.Fatalf("Capabilities() failed: %v", err)
+	}
+	if !caps.Supports(protocol.MsgGenerateRequest) || caps.Supports(protocol.MsgUpscaleRequest) {
+		t.Errorf("RequestTypes = %#x, want generate requests only", caps.RequestTypes)
+	}
+	if caps.MaxWidth != 1024 || caps.MaxHeight != 1024 {
+		t.Errorf("max size = %dx%d, want 1024x1024", caps.MaxWidth, caps.MaxHeight)
+	}
+}
+
+func TestCapabilities_UnsupportedVersion(t *testing.T) {
+	conn := acceptWithFakeCompute(t, func(request []byte) []byte {
+		return capabilitiesFor(request[16:24], protocol.ProtocolVersion1+1, protocol.ProtocolVersion1+1)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := conn.Capabilities(ctx); err == nil {
+		t.Error("Capabilities() succeeded for a compute that does not speak this protocol version")
+	}
+}
+
+// helloFor returns a hello response for requestID agreeing on version.
+func helloFor(requestID []byte, version uint16) []byte {
+	resp := make([]byte, 16+16)
+	binary.BigEndian.PutUint32(resp[0:4], protocol.MagicNumber)
+	binary.BigEndian.PutUint16(resp[4:6], protocol.ProtocolVersion1)
+	binary.BigEndian.PutUint16(resp[6:8], protocol.MsgHelloResponse)
+	binary.BigEndian.PutUint32(resp[8:12], 16)
+	copy(resp[16:24], requestID)
+	binary.BigEndian.PutUint16(resp[24:26], version)
+	binary.BigEndian.PutUint16(resp[26:28], protocol.ProtocolVersion1)
+	binary.BigEndian.PutUint16(resp[28:30], version)
+	return resp
+}
+
+func TestNegotiate(t *testing.T) {
+	const message = "compute speaks protocol versions 2 to 3"
+	tests := []struct {
+		name        string
+		respond     func(request []byte) []byte
+		wantVersion uint16
+		wantErr     error
+	}{
+		{
+			name:        "agreed",
+			respond:     func(request []byte) []byte { return helloFor(request[16:24], protocol.ProtocolVersion1) },
+			wantVersion: protocol.ProtocolVersion1,
+		},
+		{
+			name:    "version weave does not speak",
+			respond: func(request []byte) []byte { return helloFor(request[16:24], protocol.MaxSupportedVersion+1) },
+			wantErr: protocol.ErrUnsupportedVersion,
+		},
+		{
+			name: "no common version",
+			respond: func(request []byte) []byte {
+				resp := make([]byte, 16+18+len(message))
+				binary.BigEndian.PutUint32(resp[0:4], protocol.MagicNumber)
+				binary.BigEndian.PutUint16(resp[4:6], protocol.ProtocolVersion1)
+				binary.BigEndian.PutUint16(resp[6:8], protocol.MsgError)
+				binary.BigEndian.PutUint32(resp[8:12], uint32(len(resp)-16))
+				copy(resp[16:24], request[16:24])
+				binary.BigEndian.PutUint32(resp[24:28], protocol.StatusBadRequest)
+				binary.BigEndian.PutUint32(resp[28:32], protocol.ErrCodeUnsupportedVersion)
+				binary.BigEndian.PutUint16(resp[32:34], uint16(len(message)))
+				copy(resp[34:], message)
+				return resp
+			},
+			wantErr: protocol.ErrUnsupportedVersion,
+		},
+		{
+			// Compute that predates the hello answers with request ID 0
+			name:        "compute without hello",
+			respond:     func(request []byte) []byte { return nil },
+			wantVersion: protocol.ProtocolVersion1,
+			wantErr:     ErrVersionNotNegotiated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := acceptWithFakeCompute(t, tt.respond)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			version, err := conn.Negotiate(ctx)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Negotiate() error = %v, want %v", err, tt.wantErr)
+			}
+			if version != tt.wantVersion {
+				t.Errorf("Negotiate() = %d, want %d", version, tt.wantVersion)
+			}
+			if got := conn.Version(); got != protocol.ProtocolVersion1 {
+				t.Errorf("Version() = %d, want %d", got, protocol.ProtocolVersion1)
+			}
+		})
+	}
+}
+
+// previewFor returns a 1x1 preview frame for requestID at step of 20.
+func previewFor(requestID []byte, step uint32) []byte {
+	frame := make([]byte, 16+32+3)
+	binary.BigEndian.PutUint32(frame[0:4], protocol.MagicNumber)
+	binary.BigEndian.PutUint16(frame[4:6], protocol.ProtocolVersion1)
+	binary.BigEndian.PutUint16(frame[6:8], protocol.MsgPreview)
+	binary.BigEndian.PutUint32(frame[8:12], 32+3)
+	copy(frame[16:24], requestID)
+	binary.BigEndian.PutUint32(frame[24:28], step)
+	binary.BigEndian.PutUint32(frame[28:32], 20)
+	binary.BigEndian.PutUint32(frame[32:36], 1)
+	binary.BigEndian.PutUint32(frame[36:40], 1)
+	binary.BigEndian.PutUint32(frame[40:44], 3)
+	binary.BigEndian.PutUint32(frame[44:48], 3)
+	return frame
+}
+
+func TestSendWithPreviews(t *testing.T) {
+	tests := []struct {
+		name      string
+		previews  bool
+		wantSteps []uint32
+	}{
+		{name: "previews delivered in order", previews: true, wantSteps: []uint32{4, 8}},
+		{name: "nil callback discards previews", previews: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := acceptWithFakeCompute(t, func(request []byte) []byte {
+				var resp []byte
+				resp = append(resp, previewFor(request[16:24], 4)...)
+				resp = append(resp, previewFor(request[16:24], 8)...)
+				return append(resp, pongFor(request[16:24])...)
+			})
+
+			var steps []uint32
+			var onPreview func(frame []byte)
+			if tt.previews {
+				onPreview = func(frame []byte) {
+					steps = append(steps, binary.BigEndian.Uint32(frame[24:28]))
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			resp, err := conn.SendWithPreviews(ctx, protocol.EncodePing(5), onPreview)
+			if err != nil {
+				t.Fatalf("SendWithPreviews() error = %v", err)
+			}
+			if got := binary.BigEndian.Uint16(resp[6:8]); got != protocol.MsgPong {
+				t.Errorf("response msg_type = 0x%04X, want pong", got)
+			}
+			if !slices.Equal(steps, tt.wantSteps) {
+				t.Errorf("preview steps = %v, want %v", steps, tt.wantSteps)
+			}
+			if got := conn.Pending(); got != 0 {
+				t.Errorf("Pending() = %d, want 0", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Where Unix domain sockets are not available, as on Windows, compute
+// connects over TCP on the loopback interface instead. Any local user can
+// connect there, so compute proves it was spawned by weave by sending the
+// token weave gave it in the TokenEnv environment variable before anything
+// else. Remote compute, running on another machine with --listen, works the
+// other way around: weave dials it and sends the token they share.
+const (
+	// TokenEnv is the environment variable compute reads its token from
+	TokenEnv = "WEAVE_COMPUTE_TOKEN"
+	// TCPScheme starts compute addresses that are TCP rather than a socket
+	// path, as in tcp://127.0.0.1:50123
+	TCPScheme = "tcp://"
+	// tokenBytes is how many random bytes a token has; it is sent hex-encoded
+	tokenBytes = 32
+	// tokenTimeout is how long a new connection has to send its token
+	tokenTimeout = 5 * time.Second
+)
+
+// ErrInvalidToken is returned when a TCP connection does not start with the
+// token of the listener.
+var ErrInvalidToken = errors.New("compute connection sent an invalid token")
+
+// TokenListener is a TCP listener on the loopback interface that only
+// accepts connections that start with its token. It stands in for the Unix
+// socket listener AcceptConnection takes.
+type TokenListener struct {
+	net.Listener
+	token string
+}
+
+// ListenTCP listens on a free port of the loopback interface with a new
+// random token.
+//
+// CALLER MUST CLOSE THE LISTENER when done to avoid resource leaks.
+func ListenTCP() (*TokenListener, error) {
+	raw := make([]byte, tokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return &TokenListener{Listener: listener, token: hex.EncodeToString(raw)}, nil
+}
+
+// Token returns the token connections must start with, to hand to compute
+// in TokenEnv.
+func (l *TokenListener) Token() string {
+	return l.token
+}
+
+// Address returns the address compute connects to, for its --socket-path.
+func (l *TokenListener) Address() string {
+	return TCPScheme + l.Addr().String()
+}
+
+// Accept waits for a connection that sends the token and returns it with
+// the token consumed. Connections that send anything else, or nothing
+// within tokenTimeout, are closed.
+func (l *TokenListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if err := l.authenticate(conn); err != nil {
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+// authenticate reads the token from conn.
+func (l *TokenListener) authenticate(conn net.Conn) error {
+	if err := conn.SetReadDeadline(time.Now().Add(tokenTimeout)); err != nil {
+		return err
+	}
+	got := make([]byte, len(l.token))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(got, []byte(l.token)) != 1 {
+		return ErrInvalidToken
+	}
+	return conn.SetReadDeadline(time.Time{})
+}
+
+// IsTCPAddress reports whether addr is a TCP compute address rather than a
+// socket path.
+func IsTCPAddress(addr string) bool {
+	return strings.HasPrefix(addr, TCPScheme)
+}
+
+// DialRemote connects to compute running on another machine with --listen
+// at addr, a host:port, and sends it token. With tlsConfig the connection
+// is encrypted, for compute behind a TLS terminating proxy. Compute closes
+// the connection if token is wrong, which the first request then reports.
+//
+// Shared memory is never offered to remote compute.
+//
+// CALLER MUST call Close() on the returned Conn to stop the background
+// goroutine and release resources.
+func DialRemote(ctx context.Context, addr, token string, tlsConfig *tls.Config) (*Conn, error) {
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, classifyDialError(err)
+	}
+
+	if err := conn.SetWriteDeadline(time.Now().Add(tokenTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := io.WriteString(conn, token); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send token to compute: %w", err)
+	}
+	if err := conn.SetWriteDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newMultiplexedConn(conn, ""), nil
+}
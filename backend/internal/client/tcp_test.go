@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenListener(t *testing.T) {
+	listener, err := ListenTCP()
+	if err != nil {
+		t.Fatalf("ListenTCP() failed: %v", err)
+	}
+	defer listener.Close()
+
+	if !IsTCPAddress(listener.Address()) || !strings.HasPrefix(listener.Address(), TCPScheme+"127.0.0.1:") {
+		t.Errorf("Address() = %q, want a tcp:// address on the loopback interface", listener.Address())
+	}
+	if IsTCPAddress("/run/user/1000/weave/weave.sock") {
+		t.Error("IsTCPAddress() of a socket path = true")
+	}
+	other, err := ListenTCP()
+	if err != nil {
+		t.Fatalf("ListenTCP() failed: %v", err)
+	}
+	other.Close()
+	if other.Token() == listener.Token() {
+		t.Error("two listeners have the same token")
+	}
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	addr := strings.TrimPrefix(listener.Address(), TCPScheme)
+	dial := func(token string) net.Conn {
+		t.Helper()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Dial() failed: %v", err)
+		}
+		if _, err := conn.Write([]byte(token)); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+		return conn
+	}
+
+	// A wrong token is closed without being accepted
+	wrong := dial(strings.Repeat("0", len(listener.Token())))
+	defer wrong.Close()
+	wrong.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := wrong.Read(make([]byte, 1)); err == nil {
+		t.Error("connection with a wrong token was not closed")
+	}
+	select {
+	case <-accepted:
+		t.Fatal("connection with a wrong token accepted")
+	default:
+	}
+
+	// The right token is consumed and the connection returned
+	right := dial(listener.Token() + "hello")
+	defer right.Close()
+	conn, ok := <-accepted
+	if !ok {
+		t.Fatal("Accept() failed")
+	}
+	defer conn.Close()
+	got := make([]byte, 5)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(got); err != nil || string(got) != "hello" {
+		t.Errorf("read %q, %v after the token, want \"hello\"", got, err)
+	}
+}
+
+func TestAcceptConnection_TokenListener(t *testing.T) {
+	listener, err := ListenTCP()
+	if err != nil {
+		t.Fatalf("ListenTCP() failed: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(listener.Address(), TCPScheme))
+		if err != nil {
+			return
+		}
+		conn.Write([]byte(listener.Token()))
+		<-time.After(time.Second)
+		conn.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := AcceptConnection(ctx, listener)
+	if err != nil {
+		t.Fatalf("AcceptConnection() failed: %v", err)
+	}
+	defer conn.Close()
+	if conn.shmDir != "" {
+		t.Errorf("shmDir = %q over TCP, want shared memory not offered", conn.shmDir)
+	}
+}
+
+func TestDialRemote(t *testing.T) {
+	listener, err := ListenTCP()
+	if err != nil {
+		t.Fatalf("ListenTCP() failed: %v", err)
+	}
+	defer listener.Close()
+	addr := strings.TrimPrefix(listener.Address(), TCPScheme)
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := DialRemote(ctx, addr, listener.Token(), nil)
+	if err != nil {
+		t.Fatalf("DialRemote() failed: %v", err)
+	}
+	defer conn.Close()
+	remote, ok := <-accepted
+	if !ok {
+		t.Fatal("compute did not accept the token")
+	}
+	defer remote.Close()
+	if conn.shmDir != "" {
+		t.Errorf("shmDir = %q for remote compute, want shared memory not offered", conn.shmDir)
+	}
+
+	// Nothing listening
+	listener.Close()
+	if _, err := DialRemote(ctx, addr, listener.Token(), nil); err == nil {
+		t.Error("DialRemote() to a closed port succeeded")
+	}
+}
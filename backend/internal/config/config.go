@@ -9,9 +9,18 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hurricanerix/weave/internal/hooks"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/moderation"
+	"github.com/hurricanerix/weave/internal/ollama"
 )
 
 const (
@@ -19,6 +28,7 @@ const (
 	Version = "0.1.0-mvp"
 
 	// Default values for CLI flags
+	defaultHost        = "localhost"
 	defaultPort        = 8080
 	defaultSteps       = 20
 	defaultCFG         = 3.5
@@ -29,8 +39,25 @@ const (
 	defaultOllamaURL   = "http://localhost:11434"
 	defaultOllamaModel = "llama3.1:8b"
 	defaultLogLevel    = "info"
+	defaultDevDir      = "internal/web"
+	defaultLoRADir     = "config/loras"
 	// DefaultAgentPrompt is the default path to the agent prompt file
 	DefaultAgentPrompt = "config/agents/ara.md"
+	defaultHookEvents  = "pre-prompt,pre-generate,post-generate,post-save"
+	defaultHookTimeout = hooks.DefaultTimeout
+	// defaultGenerateTimeout is how long a generation of 20 steps at
+	// 1024x1024 may take
+	defaultGenerateTimeout = 2 * time.Minute
+	// defaultSessionIdleTimeout is how long a session may be idle before
+	// it is removed from memory
+	defaultSessionIdleTimeout = 24 * time.Hour
+
+	defaultModerationMode = string(moderation.ModeBlock)
+
+	defaultDebugPprofPort = 6060
+
+	defaultWatermarkCorner  = string(image.CornerBottomRight)
+	defaultWatermarkOpacity = 0.5
 
 	// Validation constraints
 	minPort    = 1024
@@ -47,11 +74,40 @@ const (
 	heightStep = 64
 	minLLMSeed = 0
 	minSeed    = -1
+
+	// maxComputeWorkers is the most compute processes --compute-workers
+	// starts
+	maxComputeWorkers = 8
+	// maxGPUIndex is the highest Vulkan device index --gpu accepts
+	maxGPUIndex = 999
+	// defaultComputeMaxResponseMB and maxComputeMaxResponseMB bound the
+	// size of one compute response, in MiB
+	defaultComputeMaxResponseMB = 128
+	maxComputeMaxResponseMB     = 1024
+
+	// defaultImageMemoryMB and defaultImageDiskMB are the budgets of
+	// disk-backed image storage, in MiB
+	defaultImageMemoryMB = 256
+	defaultImageDiskMB   = 4096
+
+	// minAPITokenLength is the shortest accepted API token
+	minAPITokenLength = 16
+	// maxUserNameLength is the longest accepted user name
+	maxUserNameLength = 64
 )
 
+// DefaultAddr is the address the server listens on without --listen or --port.
+var DefaultAddr = net.JoinHostPort(defaultHost, strconv.Itoa(defaultPort))
+
 var (
 	// ErrInvalidPort is returned when port is out of valid range
 	ErrInvalidPort = errors.New("port must be between 1024 and 65535")
+	// ErrInvalidListen is returned when the listen address is not host:port with a valid port
+	ErrInvalidListen = errors.New("listen must be host:port with a port between 1024 and 65535")
+	// ErrConflictingListen is returned when --port and --listen name different ports
+	ErrConflictingListen = errors.New("port and listen cannot name different ports")
+	// ErrLANNotAllowed is returned when the listen address is reachable from other machines without --allow-lan
+	ErrLANNotAllowed = errors.New("listen address is reachable from other machines; pass --allow-lan to confirm")
 	// ErrInvalidSteps is returned when steps is out of valid range
 	ErrInvalidSteps = errors.New("steps must be between 1 and 100")
 	// ErrInvalidCFG is returned when CFG scale is out of valid range
@@ -62,8 +118,34 @@ var (
 	ErrInvalidHeight = errors.New("height must be between 64 and 2048 and a multiple of 64")
 	// ErrInvalidSeed is returned when seed is less than -1
 	ErrInvalidSeed = errors.New("seed must be >= -1 (use -1 for random)")
+	// ErrInvalidComputeWorkers is returned when compute-workers is out of range
+	ErrInvalidComputeWorkers = errors.New("compute-workers must be between 1 and 8")
+	// ErrInvalidGPU is returned when gpu does not list one device per compute worker
+	ErrInvalidGPU = errors.New("gpu must list one device index per compute worker, e.g. --gpu 1 or --gpu 0,2")
+	// ErrInvalidComputeAddr is returned when compute-addr is not host:port
+	ErrInvalidComputeAddr = errors.New("compute-addr must be host:port")
+	// ErrRemoteComputeWorkers is returned when compute-addr is combined with
+	// flags for spawned compute processes
+	ErrRemoteComputeWorkers = errors.New("compute-addr can't be combined with compute-workers or gpu; set --gpu on the remote weave-compute")
+	// ErrComputeTLSWithoutAddr is returned when compute-tls or compute-ca is
+	// set without compute-addr
+	ErrComputeTLSWithoutAddr = errors.New("compute-tls and compute-ca require compute-addr")
+	// ErrInvalidComputeMaxResponse is returned when compute-max-response-mb is out of range
+	ErrInvalidComputeMaxResponse = errors.New("compute-max-response-mb must be between 1 and 1024")
+	// ErrInvalidImageStorage is returned when an image storage budget is out of range
+	ErrInvalidImageStorage = errors.New("image-memory-mb must be >= 0 and image-disk-mb at least 16")
+	// ErrInvalidImageQuality is returned when image-quality is out of range
+	ErrInvalidImageQuality = errors.New("image-quality must be between 1 and 100")
+	// ErrInvalidImageFormat is returned for an unknown image format
+	ErrInvalidImageFormat = errors.New("image-format must be png, jpeg or webp")
+	// ErrInvalidGenerateTimeout is returned when the generate timeout is not positive
+	ErrInvalidGenerateTimeout = errors.New("generate-timeout must be positive")
 	// ErrInvalidLLMSeed is returned when llm-seed is negative
 	ErrInvalidLLMSeed = errors.New("llm-seed must be >= 0")
+	// ErrInvalidOllamaKeepAlive is returned when ollama-keep-alive is not a duration
+	ErrInvalidOllamaKeepAlive = errors.New("ollama-keep-alive must be a duration such as 5m, 0 to unload after each reply, or negative to keep the model loaded")
+	// ErrInvalidLLMSampling is returned when a sampling flag is out of range
+	ErrInvalidLLMSampling = errors.New("llm-temperature must be 0-2, llm-top-p 0-1, llm-top-k 1-1000 and llm-repeat-penalty 0-2")
 	// ErrInvalidLogLevel is returned when log level is not recognized
 	ErrInvalidLogLevel = errors.New("log-level must be one of: debug, info, warn, error")
 	// ErrShowHelp is returned when --help flag is requested
@@ -72,6 +154,81 @@ var (
 	ErrShowVersion = errors.New("version requested")
 	// ErrInvalidPath is returned when agent prompt path is invalid
 	ErrInvalidPath = errors.New("agent prompt path must be relative, not absolute")
+	// ErrInvalidHookURL is returned when the hook URL is not an absolute http(s) URL
+	ErrInvalidHookURL = errors.New("hook-url must be an absolute http or https URL")
+	// ErrInvalidHookEvents is returned when hook events contain an unknown event
+	ErrInvalidHookEvents = errors.New("hook-events must be a comma-separated list of: pre-prompt, pre-generate, post-generate, post-save, generate-failed")
+	// ErrInvalidWebhook is returned when a webhook URL is not an absolute http(s) URL
+	ErrInvalidWebhook = errors.New("webhook must be an absolute http or https URL")
+	// ErrInvalidHookTimeout is returned when the hook timeout is negative
+	ErrInvalidHookTimeout = errors.New("hook-timeout must not be negative")
+	// ErrConflictingWatermark is returned when both a text and an image watermark are given
+	ErrConflictingWatermark = errors.New("watermark-text and watermark-image cannot both be set")
+	// ErrInvalidWatermarkText is returned when the watermark text is too long
+	ErrInvalidWatermarkText = errors.New("watermark-text must be at most 100 characters")
+	// ErrInvalidWatermarkCorner is returned for an unknown watermark corner
+	ErrInvalidWatermarkCorner = errors.New("watermark-corner must be one of: top-left, top-right, bottom-left, bottom-right")
+	// ErrInvalidWatermarkOpacity is returned when the watermark opacity is out of range
+	ErrInvalidWatermarkOpacity = errors.New("watermark-opacity must be greater than 0.0 and at most 1.0")
+	// ErrInvalidDebugPprofPort is returned when the pprof port is out of range or equals --port
+	ErrInvalidDebugPprofPort = errors.New("debug-pprof-port must be between 1024 and 65535 and differ from port")
+	// ErrInvalidAPIToken is returned when an API token is too short or contains whitespace
+	ErrInvalidAPIToken = errors.New("api tokens must be at least 16 characters without whitespace")
+	// ErrInvalidUserName is returned when a user name is empty, too long or has unsupported characters
+	ErrInvalidUserName = errors.New("user names must be 1-64 letters, digits, '.', '_', '-' or '@'")
+	// ErrInvalidUserHeader is returned when user-header is not a valid HTTP header name
+	ErrInvalidUserHeader = errors.New("user-header must be a valid HTTP header name")
+	// ErrInvalidUserQuota is returned when the quota is negative or no user identity is configured
+	ErrInvalidUserQuota = errors.New("user-daily-generations must be >= 0 and requires users-file or user-header")
+	// ErrInvalidMCP is returned for an unknown MCP transport or MCP in gallery-only mode
+	ErrInvalidMCP = errors.New("mcp must be stdio or sse, and cannot be used with gallery-only")
+	// ErrInvalidLLMBackend is returned for an unknown LLM backend
+	ErrInvalidLLMBackend = errors.New("llm-backend must be ollama or openai")
+	// ErrInvalidStorage is returned for an unknown storage backend
+	ErrInvalidStorage = errors.New("storage must be files or sqlite")
+	// ErrInvalidSessionIdleTimeout is returned when the session idle timeout is not positive
+	ErrInvalidSessionIdleTimeout = errors.New("session-idle-timeout must be positive")
+	// ErrInvalidExpiredSessionImages is returned for an unknown expired session image policy
+	ErrInvalidExpiredSessionImages = errors.New("expired-session-images must be keep, archive or delete")
+	// ErrInvalidSessionsQuota is returned for a negative sessions quota or an unknown policy for exceeding it
+	ErrInvalidSessionsQuota = errors.New("sessions-max-mb must be 0 (unlimited) or positive and sessions-full evict or refuse")
+	// ErrInvalidModerationMode is returned for an unknown moderation mode
+	ErrInvalidModerationMode = errors.New("moderation-mode must be block or warn")
+	// ErrInvalidOpenAI is returned when the openai backend lacks a valid URL or model
+	ErrInvalidOpenAI = errors.New("llm-backend openai requires --openai-url (an absolute http or https URL) and --openai-model")
+)
+
+// LLM backends accepted by --llm-backend
+const (
+	LLMBackendOllama = "ollama"
+	LLMBackendOpenAI = "openai"
+)
+
+// Storage backends accepted by --storage
+const (
+	StorageFiles  = "files"
+	StorageSQLite = "sqlite"
+)
+
+// What happens to the images of expired sessions, set by
+// --expired-session-images
+const (
+	ExpiredSessionImagesKeep    = "keep"
+	ExpiredSessionImagesArchive = "archive"
+	ExpiredSessionImagesDelete  = "delete"
+)
+
+// What happens when config/sessions reaches --sessions-max-mb, set by
+// --sessions-full
+const (
+	SessionsFullEvict  = "evict"
+	SessionsFullRefuse = "refuse"
+)
+
+// MCP transports accepted by --mcp
+const (
+	MCPStdio = "stdio"
+	MCPSSE   = "sse"
 )
 
 // Config holds all configuration values for the weave application.
@@ -80,6 +237,11 @@ type Config struct {
 	// Server configuration
 	Port int
 
+	// Listen is the host:port to listen on ("" for localhost:Port).
+	// Addresses reachable from other machines need AllowLAN.
+	Listen   string
+	AllowLAN bool
+
 	// Image generation parameters
 	Steps  int
 	CFG    float64
@@ -87,20 +249,201 @@ type Config struct {
 	Height int
 	Seed   int64
 
-	// LLM configuration
+	// Directory of LoRA files the agent may apply to generations; compute
+	// is started with it as --lora-dir
+	LoRADir string
+
+	// VAETiling has compute decode images in tiles, which is slower but
+	// lets sizes up to 1024x1024 fit in VRAM (768x768 otherwise)
+	VAETiling bool
+
+	// ComputeWorkers is how many compute processes to start, one per GPU;
+	// generations are spread over them
+	ComputeWorkers int
+
+	// GPUs are the Vulkan devices compute workers generate on, one per
+	// worker (--gpu); empty for the first device, or device n for worker n
+	GPUs []int
+
+	// ComputeAddr is the host:port of weave-compute running on another
+	// machine with --listen; weave connects to it instead of spawning
+	// compute processes
+	ComputeAddr string
+
+	// ComputeTLS encrypts the connection to ComputeAddr, for compute
+	// behind a TLS terminating proxy
+	ComputeTLS bool
+
+	// ComputeCA is a PEM file of certificates to verify ComputeAddr with
+	// instead of the system's; implies ComputeTLS
+	ComputeCA string
+
+	// ComputeMaxResponseMB is the largest compute response weave accepts,
+	// in MiB; a generation whose image is larger fails
+	ComputeMaxResponseMB int
+
+	// ImageStorageDir is where generated images are kept instead of in
+	// memory ("" = memory only), with up to ImageMemoryMB MiB of them
+	// cached in memory and ImageDiskMB MiB on disk; the least recently
+	// used are dropped first
+	ImageStorageDir string
+	ImageMemoryMB   int
+	ImageDiskMB     int
+
+	// ImageQuality is the quality (1-100) of images served or stored as
+	// JPEG or WebP, unless a request asks for another
+	ImageQuality int
+
+	// ImageFormat is the format session images are stored in: png (or
+	// ""), jpeg or webp, at ImageQuality
+	ImageFormat string
+
+	// GenerateTimeout is how long a generation of 20 steps at 1024x1024
+	// may take before it is given up; generations with more steps or
+	// pixels get proportionally longer
+	GenerateTimeout time.Duration
+
+	// LLM configuration. LLMBackend selects Ollama or an OpenAI-compatible
+	// server; the API key for the latter comes from $WEAVE_OPENAI_API_KEY.
 	LLMSeed     int64
+	LLMBackend  string
 	OllamaURL   string
 	OllamaModel string
+	OpenAIURL   string
+	OpenAIModel string
+
+	// Every ollama endpoint given with --ollama-url, in order; OllamaURL is
+	// the first. Chat requests are spread over them when there are several.
+	// Empty if the flag was not given.
+	OllamaURLs []string
+
+	// How long ollama keeps the model loaded after a chat ("" = ollama's
+	// default). Short values free VRAM for image generation sooner.
+	OllamaKeepAlive string
+
+	// Pull the ollama model at startup if it is missing, instead of
+	// exiting with instructions to pull it
+	OllamaPull bool
+
+	// Have ollama reply with JSON matching a schema, carrying the chat text
+	// and the generation settings, instead of calling update_generation
+	OllamaStructuredOutput bool
+
+	// Default sampling parameters for chat requests; sessions may override
+	// them. Unset parameters are left to the model.
+	LLMSampling ollama.Sampling
+
+	// Have the LLM summarize conversation history that is left out of its
+	// context, instead of only noting that it was
+	LLMSummarize bool
+
+	// Model to retry with once when the LLM's replies keep failing format
+	// checks, before the conversation is cleared ("" = no fallback)
+	LLMFallbackModel string
+
+	// Ollama model that embeds prompts and replies for GET /search/semantic
+	// ("" = semantic search disabled)
+	EmbeddingModel string
 
 	// Logging configuration
 	LogLevel string
 
-	// Agent configuration
+	// Write every LLM chat request and its raw response to a file under
+	// config/debug/llm, for debugging the agent
+	CaptureLLM bool
+
+	// Agent configuration: a prompt file, or a directory of persona
+	// prompt files (see LoadPersonas)
 	AgentPromptPath string
 
+	// Plugin hook configuration
+	HookURL     string
+	HookEvents  string
+	HookTimeout time.Duration
+
+	// Webhooks notified in the background when an image is saved or fails
+	Webhooks []string
+
+	// Command run after each image is saved to disk
+	PostSaveExec string
+
+	// Content moderation of image prompts. Disabled unless ModerationList
+	// or ModerationLLM is set; ModerationMode is block (or "") or warn.
+	ModerationList string
+	ModerationLLM  bool
+	ModerationMode string
+
+	// Gallery configuration
+	GalleryOnly bool
+
+	// Serve image generation as an MCP tool over MCPStdio or MCPSSE
+	// ("" = disabled)
+	MCP string
+
+	// Encrypt conversations at rest with a key derived from the
+	// WEAVE_PASSPHRASE environment variable
+	EncryptSessions bool
+
+	// Where sessions are stored: StorageFiles, a directory per session in
+	// config/sessions, or StorageSQLite, one database that the files are
+	// imported into the first time
+	Storage string
+
+	// How long a session may be idle before it is removed from memory,
+	// and what then happens to its images: ExpiredSessionImagesKeep (or
+	// ""), ExpiredSessionImagesArchive to move them to
+	// config/archive/sessions, or ExpiredSessionImagesDelete. Stored
+	// conversations are kept either way.
+	SessionIdleTimeout   time.Duration
+	ExpiredSessionImages string
+
+	// Largest size of config/sessions in MiB, 0 for no limit, and what
+	// happens when a new image would exceed it: SessionsFullEvict (or "")
+	// deletes the oldest images that aren't favorites, SessionsFullRefuse
+	// fails the save
+	SessionsMaxMB int
+	SessionsFull  string
+
+	// Run a chat and a small generation before serving
+	SelfTest bool
+
+	// API tokens required for mutating requests and the SSE stream.
+	// Authentication is disabled unless one of them is set.
+	APIToken      string
+	APITokensFile string
+
+	// Per-user identity. When either is set, every session belongs to a
+	// user and anonymous sessions are only used for public pages.
+	UsersFile  string
+	UserHeader string
+
+	// Generations allowed per user per UTC day (0 = unlimited)
+	UserDailyGenerations int
+
+	// Skip CSRF token checks on requests that change state. Only safe when
+	// no other site can reach the server, as with the Electron app.
+	DisableCSRF bool
+
+	// Serve templates and static assets from DevDir, reloading templates
+	// on every request, instead of the copies embedded in the binary
+	Dev    bool
+	DevDir string
+
+	// Serve net/http/pprof on localhost:DebugPprofPort
+	DebugPprof     bool
+	DebugPprofPort int
+
+	// Watermark drawn on images served from the public gallery.
+	// Disabled unless WatermarkText or WatermarkImage is set.
+	WatermarkText    string
+	WatermarkImage   string
+	WatermarkCorner  string
+	WatermarkOpacity float64
+
 	// Internal flags
 	showHelp    bool
 	showVersion bool
+	portSet     bool
 }
 
 // Parse parses CLI flags into a Config struct.
@@ -114,6 +457,8 @@ func Parse(args []string, output io.Writer) (*Config, error) {
 
 	// Server flags
 	fs.IntVar(&c.Port, "port", defaultPort, "HTTP server port")
+	fs.StringVar(&c.Listen, "listen", "", "Address to listen on as host:port (default: localhost:--port)")
+	fs.BoolVar(&c.AllowLAN, "allow-lan", false, "Confirm that --listen exposes weave to other machines")
 
 	// Image generation flags
 	fs.IntVar(&c.Steps, "steps", defaultSteps, "Number of inference steps")
@@ -121,17 +466,117 @@ func Parse(args []string, output io.Writer) (*Config, error) {
 	fs.IntVar(&c.Width, "width", defaultWidth, "Image width in pixels")
 	fs.IntVar(&c.Height, "height", defaultHeight, "Image height in pixels")
 	fs.Int64Var(&c.Seed, "seed", defaultSeed, "Image generation seed (-1 = random)")
+	fs.StringVar(&c.LoRADir, "lora-dir", defaultLoRADir, "Directory of LoRA files the agent may apply")
+	fs.BoolVar(&c.VAETiling, "vae-tiling", false, "Decode images in tiles so sizes up to 1024x1024 fit in VRAM (slower)")
+	fs.IntVar(&c.ComputeWorkers, "compute-workers", 1, "Number of compute processes, one per GPU")
+	fs.Func("gpu", "Comma-separated Vulkan device indices compute generates on, one per worker", func(value string) error {
+		c.GPUs = nil
+		for _, field := range strings.Split(value, ",") {
+			index, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || index < 0 || index > maxGPUIndex {
+				return ErrInvalidGPU
+			}
+			c.GPUs = append(c.GPUs, index)
+		}
+		return nil
+	})
+	fs.StringVar(&c.ComputeAddr, "compute-addr", "", "host:port of a remote weave-compute started with --listen, instead of spawning compute")
+	fs.BoolVar(&c.ComputeTLS, "compute-tls", false, "Connect to --compute-addr over TLS")
+	fs.StringVar(&c.ComputeCA, "compute-ca", "", "PEM file of CA certificates to verify --compute-addr with (implies --compute-tls)")
+	fs.IntVar(&c.ComputeMaxResponseMB, "compute-max-response-mb", defaultComputeMaxResponseMB, "Largest compute response to accept, in MiB")
+	fs.StringVar(&c.ImageStorageDir, "image-storage-dir", "", "Directory generated images are kept in instead of memory (default: memory only)")
+	fs.IntVar(&c.ImageMemoryMB, "image-memory-mb", defaultImageMemoryMB, "MiB of images from --image-storage-dir cached in memory")
+	fs.IntVar(&c.ImageDiskMB, "image-disk-mb", defaultImageDiskMB, "MiB of images kept in --image-storage-dir")
+	fs.IntVar(&c.ImageQuality, "image-quality", image.DefaultQuality, "Quality of images served or stored as JPEG or WebP (1-100)")
+	fs.StringVar(&c.ImageFormat, "image-format", string(image.OutputPNG), "Format session images are stored in: png, jpeg or webp")
+	fs.DurationVar(&c.GenerateTimeout, "generate-timeout", defaultGenerateTimeout, "Time a 20-step 1024x1024 generation may take; scaled by steps and size")
 
 	// LLM flags
 	fs.Int64Var(&c.LLMSeed, "llm-seed", defaultLLMSeed, "LLM seed for deterministic responses (0 = random)")
-	fs.StringVar(&c.OllamaURL, "ollama-url", defaultOllamaURL, "Ollama API endpoint URL")
+	c.OllamaURL = defaultOllamaURL
+	fs.Func("ollama-url", "Ollama API endpoint URL (repeatable to spread chats over several servers)", func(value string) error {
+		c.OllamaURLs = append(c.OllamaURLs, value)
+		c.OllamaURL = c.OllamaURLs[0]
+		return nil
+	})
 	fs.StringVar(&c.OllamaModel, "ollama-model", defaultOllamaModel, "Ollama model name")
+	fs.StringVar(&c.OllamaKeepAlive, "ollama-keep-alive", "", "How long ollama keeps the model loaded after a chat (default: ollama's, 5m)")
+	fs.BoolVar(&c.OllamaPull, "ollama-pull", false, "Pull the ollama model at startup if it is missing")
+	fs.BoolVar(&c.OllamaStructuredOutput, "ollama-structured-output", false, "Get generation settings from ollama as JSON matching a schema instead of a tool call")
+	fs.StringVar(&c.LLMBackend, "llm-backend", LLMBackendOllama, "LLM backend (ollama, openai)")
+	fs.StringVar(&c.OpenAIURL, "openai-url", "", "OpenAI-compatible API base URL, e.g. http://localhost:8000/v1")
+	fs.StringVar(&c.OpenAIModel, "openai-model", "", "Model name for the OpenAI-compatible API")
+	fs.Func("llm-temperature", "LLM sampling temperature (default: model's)", floatFlag(&c.LLMSampling.Temperature))
+	fs.Func("llm-top-p", "LLM nucleus sampling threshold (default: model's)", floatFlag(&c.LLMSampling.TopP))
+	fs.Func("llm-top-k", "LLM top-k sampling limit (default: model's)", func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		c.LLMSampling.TopK = &n
+		return nil
+	})
+	fs.Func("llm-repeat-penalty", "LLM repetition penalty (default: model's)", floatFlag(&c.LLMSampling.RepeatPenalty))
+	fs.BoolVar(&c.LLMSummarize, "llm-summarize", false, "Have the LLM summarize history that no longer fits its context")
+	fs.StringVar(&c.LLMFallbackModel, "llm-fallback-model", "", "Model to retry with when replies keep failing (default: none)")
+	fs.StringVar(&c.EmbeddingModel, "embedding-model", "", "Ollama embedding model for semantic search (default: none, disabled)")
 
 	// Logging flags
 	fs.StringVar(&c.LogLevel, "log-level", defaultLogLevel, "Log level (debug, info, warn, error)")
+	fs.BoolVar(&c.CaptureLLM, "capture-llm", false, "Write each LLM request and raw response to config/debug/llm")
 
 	// Agent flags
-	fs.StringVar(&c.AgentPromptPath, "agent-prompt", DefaultAgentPrompt, "Path to agent prompt file")
+	fs.StringVar(&c.AgentPromptPath, "agent-prompt", DefaultAgentPrompt, "Path to agent prompt file or directory of persona prompts")
+
+	// Plugin hook flags
+	fs.StringVar(&c.HookURL, "hook-url", "", "Webhook URL notified of generation lifecycle events")
+	fs.StringVar(&c.HookEvents, "hook-events", defaultHookEvents, "Comma-separated lifecycle events sent to --hook-url")
+	fs.DurationVar(&c.HookTimeout, "hook-timeout", defaultHookTimeout, "Maximum time a single hook may run")
+	fs.Func("webhook", "Webhook URL notified when an image is saved or fails (repeatable)", func(value string) error {
+		c.Webhooks = append(c.Webhooks, value)
+		return nil
+	})
+	fs.StringVar(&c.PostSaveExec, "post-save-exec", "", "Command run after each image save (file path as argument, metadata JSON on stdin)")
+
+	// Moderation flags
+	fs.StringVar(&c.ModerationList, "moderation-list", "", "File of words, phrases and /regexps/ that flag image prompts")
+	fs.BoolVar(&c.ModerationLLM, "moderation-llm", false, "Have the LLM classify image prompts before generating them")
+	fs.StringVar(&c.ModerationMode, "moderation-mode", defaultModerationMode, "What happens to flagged prompts: block or warn")
+
+	// Gallery flags
+	fs.BoolVar(&c.GalleryOnly, "gallery-only", false, "Serve only the read-only public gallery (no chat or generation)")
+
+	// MCP flags
+	fs.StringVar(&c.MCP, "mcp", "", "Serve image generation as an MCP tool over stdio or sse")
+
+	// Storage flags
+	fs.BoolVar(&c.EncryptSessions, "encrypt-sessions", false, "Encrypt stored conversations with a key derived from $WEAVE_PASSPHRASE")
+	fs.StringVar(&c.Storage, "storage", StorageFiles, "Where sessions are stored: files or sqlite")
+	fs.DurationVar(&c.SessionIdleTimeout, "session-idle-timeout", defaultSessionIdleTimeout, "Time a session may be idle before it is removed from memory")
+	fs.StringVar(&c.ExpiredSessionImages, "expired-session-images", ExpiredSessionImagesKeep, "What happens to the images of idle sessions: keep, archive or delete")
+	fs.IntVar(&c.SessionsMaxMB, "sessions-max-mb", 0, "Largest size of config/sessions in MiB (0 = unlimited)")
+	fs.StringVar(&c.SessionsFull, "sessions-full", SessionsFullEvict, "What happens to new images once --sessions-max-mb is reached: evict or refuse")
+
+	// Auth flags
+	fs.StringVar(&c.APIToken, "api-token", "", "Token required for mutating requests and the SSE stream")
+	fs.StringVar(&c.APITokensFile, "api-tokens-file", "", "File of tokens, one per line, accepted like --api-token")
+	fs.StringVar(&c.UsersFile, "users-file", "", "File of users, one \"NAME TOKEN\" per line; each user gets their own sessions")
+	fs.StringVar(&c.UserHeader, "user-header", "", "Header carrying the user name from a trusted reverse proxy")
+	fs.IntVar(&c.UserDailyGenerations, "user-daily-generations", 0, "Generations allowed per user per UTC day (0 = unlimited)")
+	fs.BoolVar(&c.DisableCSRF, "disable-csrf", false, "Skip CSRF token checks (localhost-only use such as the Electron app)")
+
+	// Debug flags
+	fs.BoolVar(&c.Dev, "dev", false, "Serve templates and static assets from --dev-dir and reload them per request")
+	fs.StringVar(&c.DevDir, "dev-dir", defaultDevDir, "Directory holding templates/ and static/ for --dev")
+	fs.BoolVar(&c.SelfTest, "selftest", false, "Run one LLM exchange and one 64x64 generation at startup and exit if either fails")
+	fs.BoolVar(&c.DebugPprof, "debug-pprof", false, "Serve pprof profiles on localhost:--debug-pprof-port")
+	fs.IntVar(&c.DebugPprofPort, "debug-pprof-port", defaultDebugPprofPort, "Port for --debug-pprof (localhost only)")
+
+	// Watermark flags
+	fs.StringVar(&c.WatermarkText, "watermark-text", "", "Text drawn on images served from the public gallery")
+	fs.StringVar(&c.WatermarkImage, "watermark-image", "", "PNG overlay drawn on images served from the public gallery")
+	fs.StringVar(&c.WatermarkCorner, "watermark-corner", defaultWatermarkCorner, "Watermark corner (top-left, top-right, bottom-left, bottom-right)")
+	fs.Float64Var(&c.WatermarkOpacity, "watermark-opacity", defaultWatermarkOpacity, "Watermark opacity (0.0-1.0)")
 
 	// Special flags
 	fs.BoolVar(&c.showHelp, "help", false, "Show help message")
@@ -141,6 +586,11 @@ func Parse(args []string, output io.Writer) (*Config, error) {
 	if err := fs.Parse(args); err != nil {
 		return nil, err
 	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "port" {
+			c.portSet = true
+		}
+	})
 
 	// Handle --help
 	if c.showHelp {
@@ -169,6 +619,25 @@ func (c *Config) validate() error {
 		return ErrInvalidPort
 	}
 
+	// Validate listen address; its port replaces --port
+	if c.Listen != "" {
+		host, portStr, err := net.SplitHostPort(c.Listen)
+		if err != nil {
+			return ErrInvalidListen
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < minPort || port > maxPort {
+			return ErrInvalidListen
+		}
+		if c.portSet && port != c.Port {
+			return ErrConflictingListen
+		}
+		c.Port = port
+		if !isLoopbackHost(host) && !c.AllowLAN {
+			return ErrLANNotAllowed
+		}
+	}
+
 	// Validate steps
 	if c.Steps < minSteps || c.Steps > maxSteps {
 		return ErrInvalidSteps
@@ -194,11 +663,109 @@ func (c *Config) validate() error {
 		return ErrInvalidSeed
 	}
 
+	// Validate compute workers
+	if c.ComputeWorkers < 1 || c.ComputeWorkers > maxComputeWorkers {
+		return ErrInvalidComputeWorkers
+	}
+
+	// Validate GPUs
+	if len(c.GPUs) > 0 && len(c.GPUs) != c.ComputeWorkers {
+		return ErrInvalidGPU
+	}
+
+	// Validate remote compute
+	if c.ComputeAddr != "" {
+		if _, port, err := net.SplitHostPort(c.ComputeAddr); err != nil || port == "" {
+			return ErrInvalidComputeAddr
+		}
+		if c.ComputeWorkers != 1 || len(c.GPUs) > 0 {
+			return ErrRemoteComputeWorkers
+		}
+	} else if c.ComputeTLS || c.ComputeCA != "" {
+		return ErrComputeTLSWithoutAddr
+	}
+
+	// Validate compute response size
+	if c.ComputeMaxResponseMB < 1 || c.ComputeMaxResponseMB > maxComputeMaxResponseMB {
+		return ErrInvalidComputeMaxResponse
+	}
+
+	// Validate image storage budgets; a disk budget below the largest
+	// image could not hold it
+	if c.ImageStorageDir != "" && (c.ImageMemoryMB < 0 || c.ImageDiskMB < image.MaxImageSize>>20) {
+		return ErrInvalidImageStorage
+	}
+
+	// Validate lossy image quality
+	if c.ImageQuality < image.MinQuality || c.ImageQuality > image.MaxQuality {
+		return ErrInvalidImageQuality
+	}
+
+	// Validate image storage format
+	if c.ImageFormat != "" {
+		if _, err := image.ParseOutputFormat(c.ImageFormat); err != nil {
+			return ErrInvalidImageFormat
+		}
+	}
+
+	// Validate generate timeout
+	if c.GenerateTimeout <= 0 {
+		return ErrInvalidGenerateTimeout
+	}
+
 	// Validate LLM seed
 	if c.LLMSeed < minLLMSeed {
 		return ErrInvalidLLMSeed
 	}
 
+	// Validate ollama keep-alive ("0" is a valid duration)
+	if c.OllamaKeepAlive != "" {
+		if _, err := time.ParseDuration(c.OllamaKeepAlive); err != nil {
+			return ErrInvalidOllamaKeepAlive
+		}
+	}
+
+	// Validate LLM sampling parameters
+	if c.LLMSampling.Validate() != nil {
+		return ErrInvalidLLMSampling
+	}
+
+	// Validate LLM backend
+	switch c.LLMBackend {
+	case "", LLMBackendOllama:
+	case LLMBackendOpenAI:
+		if hooks.ValidateURL(c.OpenAIURL) != nil || c.OpenAIModel == "" {
+			return ErrInvalidOpenAI
+		}
+	default:
+		return ErrInvalidLLMBackend
+	}
+
+	// Validate storage backend
+	switch c.Storage {
+	case "", StorageFiles, StorageSQLite:
+	default:
+		return ErrInvalidStorage
+	}
+
+	// Validate session expiry
+	if c.SessionIdleTimeout <= 0 {
+		return ErrInvalidSessionIdleTimeout
+	}
+	switch c.ExpiredSessionImages {
+	case "", ExpiredSessionImagesKeep, ExpiredSessionImagesArchive, ExpiredSessionImagesDelete:
+	default:
+		return ErrInvalidExpiredSessionImages
+	}
+	if c.SessionsMaxMB < 0 {
+		return ErrInvalidSessionsQuota
+	}
+	switch c.SessionsFull {
+	case "", SessionsFullEvict, SessionsFullRefuse:
+	default:
+		return ErrInvalidSessionsQuota
+	}
+
 	// Validate log level
 	switch c.LogLevel {
 	case "debug", "info", "warn", "error":
@@ -207,9 +774,117 @@ func (c *Config) validate() error {
 		return ErrInvalidLogLevel
 	}
 
+	// Validate plugin hooks
+	if c.HookURL != "" {
+		if err := hooks.ValidateURL(c.HookURL); err != nil {
+			return ErrInvalidHookURL
+		}
+	}
+	for _, webhook := range c.Webhooks {
+		if err := hooks.ValidateURL(webhook); err != nil {
+			return ErrInvalidWebhook
+		}
+	}
+	if _, err := hooks.ParseEvents(c.HookEvents); err != nil {
+		return ErrInvalidHookEvents
+	}
+	if c.HookTimeout < 0 {
+		return ErrInvalidHookTimeout
+	}
+
+	// Validate watermark (corner and opacity only matter when one is set)
+	if c.WatermarkText != "" && c.WatermarkImage != "" {
+		return ErrConflictingWatermark
+	}
+	if utf8.RuneCountInString(c.WatermarkText) > image.MaxWatermarkTextLength {
+		return ErrInvalidWatermarkText
+	}
+	if c.WatermarkText != "" || c.WatermarkImage != "" {
+		if _, err := image.ParseCorner(c.WatermarkCorner); err != nil {
+			return ErrInvalidWatermarkCorner
+		}
+		if !(c.WatermarkOpacity > 0 && c.WatermarkOpacity <= 1) {
+			return ErrInvalidWatermarkOpacity
+		}
+	}
+
+	// Validate moderation mode ("" = block)
+	if c.ModerationMode != "" {
+		if _, err := moderation.ParseMode(c.ModerationMode); err != nil {
+			return ErrInvalidModerationMode
+		}
+	}
+
+	// Validate authentication and users
+	if c.APIToken != "" && !validAPIToken(c.APIToken) {
+		return ErrInvalidAPIToken
+	}
+	if c.UserHeader != "" && !validHeaderName(c.UserHeader) {
+		return ErrInvalidUserHeader
+	}
+	if c.UserDailyGenerations < 0 || (c.UserDailyGenerations > 0 && c.UsersFile == "" && c.UserHeader == "") {
+		return ErrInvalidUserQuota
+	}
+
+	// Validate MCP transport
+	if (c.MCP != "" && c.MCP != MCPStdio && c.MCP != MCPSSE) || (c.MCP != "" && c.GalleryOnly) {
+		return ErrInvalidMCP
+	}
+
+	// Validate pprof port (only matters when enabled)
+	if c.DebugPprof && (c.DebugPprofPort < minPort || c.DebugPprofPort > maxPort || c.DebugPprofPort == c.Port) {
+		return ErrInvalidDebugPprofPort
+	}
+
 	return nil
 }
 
+// Addr returns the address the server listens on.
+func (c *Config) Addr() string {
+	if c.Listen != "" {
+		return c.Listen
+	}
+	return net.JoinHostPort(defaultHost, strconv.Itoa(c.Port))
+}
+
+// OllamaEndpoints returns the ollama endpoints to use: OllamaURLs, or
+// OllamaURL if none were given.
+func (c *Config) OllamaEndpoints() []string {
+	if len(c.OllamaURLs) > 0 {
+		return c.OllamaURLs
+	}
+	return []string{c.OllamaURL}
+}
+
+// ComputeGPUs returns the Vulkan device each compute worker generates on:
+// GPUs if given, otherwise device n for worker n.
+func (c *Config) ComputeGPUs() []int {
+	if len(c.GPUs) > 0 {
+		return c.GPUs
+	}
+	gpus := make([]int, max(c.ComputeWorkers, 1))
+	for i := range gpus {
+		gpus[i] = i
+	}
+	return gpus
+}
+
+// LAN reports whether the server is reachable from other machines.
+func (c *Config) LAN() bool {
+	host, _, err := net.SplitHostPort(c.Addr())
+	return err == nil && !isLoopbackHost(host)
+}
+
+// isLoopbackHost reports whether host only accepts connections from this
+// machine. An empty host listens on every interface.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 // printHelp prints usage information
 func printHelp(w io.Writer) {
 	fmt.Fprintf(w, `weave - High-performance image generation system
@@ -219,16 +894,151 @@ USAGE:
 
 FLAGS:
     --port <PORT>              HTTP server port (default: %d)
+    --listen <HOST:PORT>       Address to listen on, e.g. 0.0.0.0:8080 for the LAN
+                               (default: localhost:<PORT>)
+    --allow-lan                Confirm that --listen is reachable from other
+                               machines. Set --api-tokens-file or --users-file as
+                               well, and serve over HTTPS: session cookies are
+                               only sent over HTTPS except to localhost
     --steps <STEPS>            Number of inference steps (default: %d)
     --cfg <CFG>                CFG scale (default: %.1f)
     --width <WIDTH>            Image width in pixels (default: %d)
     --height <HEIGHT>          Image height in pixels (default: %d)
     --seed <SEED>              Image generation seed, -1 = random (default: %d)
+    --lora-dir <PATH>          Directory of LoRA files (*.safetensors, *.ckpt,
+                               *.gguf) the agent may apply, listed by GET /loras;
+                               weave-compute loads them from here (default: %s)
+    --vae-tiling               Decode images in tiles: slower, but sizes up to
+                               1024x1024 fit in VRAM instead of 768x768
+    --compute-workers <N>      Start N weave-compute processes, one per GPU, and
+                               send each generation to an idle one (1-8, default: 1)
+    --gpu <N>[,<N>...]         Vulkan device compute generates on, one per worker,
+                               e.g. 1 to leave device 0 to the LLM; GET /system
+                               lists the devices (default: device n for worker n)
+    --image-storage-dir <PATH> Keep generated images in this directory instead of
+                               memory, for long sessions (default: memory only,
+                               the newest 100 images)
+    --image-memory-mb <N>      MiB of the most recently used images from
+                               --image-storage-dir kept in memory (default: %d)
+    --image-disk-mb <N>        MiB of images kept in --image-storage-dir; the
+                               least recently used are deleted (default: %d)
+    --image-quality <N>        Quality of images served or stored as JPEG or WebP,
+                               1-100; image endpoints take ?format=webp or
+                               ?format=jpeg, or an Accept header preferring them
+                               (default: %d)
+    --image-format <FORMAT>    Format session images are stored in: png, jpeg or
+                               webp; webp is several times smaller but drops
+                               provenance manifests (default: png)
+    --generate-timeout <DUR>   How long a 20-step 1024x1024 generation may take before
+                               it is given up; more steps or pixels get
+                               proportionally longer (default: %s)
     --llm-seed <SEED>          LLM seed for deterministic responses, 0 = random (default: %d)
-    --ollama-url <URL>         Ollama API endpoint (default: %s)
+    --ollama-url <URL>         Ollama API endpoint (default: %s); repeat to spread
+                               chats over several servers with the same model,
+                               failing over when one is down
     --ollama-model <MODEL>     Ollama model name (default: %s)
+    --ollama-keep-alive <DUR>  How long ollama keeps the model loaded after a chat,
+                               e.g. 1m; 0 unloads it after every reply to free
+                               VRAM for generation, negative keeps it loaded
+                               (default: ollama's, 5m). POST /admin/llm/unload
+                               unloads it on demand
+    --ollama-pull              Pull the ollama model at startup if it is missing,
+                               logging download progress; GET /ready reports
+                               "pulling" until it finishes
+    --ollama-structured-output
+                               Have ollama reply with JSON matching a schema
+                               instead of calling update_generation; for models
+                               whose tool calls are unreliable
+    --llm-backend <BACKEND>    Chat backend: "ollama", or "openai" for any server
+                               speaking the OpenAI chat-completions API, such as
+                               llama.cpp, vLLM or LM Studio (default: ollama)
+    --openai-url <URL>         OpenAI-compatible API base URL, including /v1;
+                               required with --llm-backend openai. The API key,
+                               if any, is read from $WEAVE_OPENAI_API_KEY
+    --openai-model <MODEL>     Model name sent to the OpenAI-compatible API;
+                               required with --llm-backend openai
+    --llm-temperature <T>      Sampling temperature, 0-2 (default: model's)
+    --llm-top-p <P>            Nucleus sampling threshold, 0-1 (default: model's)
+    --llm-top-k <K>            Sample from the K likeliest tokens, 1-1000
+                               (default: model's)
+    --llm-repeat-penalty <R>   Penalty for repeated tokens, 0-2 (default: model's).
+                               Sessions can override these with POST /settings/sampling
+    --llm-summarize            When a long conversation no longer fits the model's
+                               context, ask the LLM for a short summary of what the
+                               user wants (subject, style, exclusions) and send it
+                               in place of the oldest messages; also used instead of
+                               keyword extraction when retrying a failed reply
+    --llm-fallback-model <MODEL>
+                               Model to retry with once, such as a smaller model
+                               that follows the reply format more reliably, when
+                               the model's reply still fails after the compacted
+                               retry; the conversation is cleared only if it fails
+                               too (default: none)
+    --embedding-model <MODEL>  Ollama embedding model, such as nomic-embed-text,
+                               used to index prompts and replies for
+                               GET /search/semantic (default: none, disabled)
     --log-level <LEVEL>        Log level: debug, info, warn, error (default: %s)
-    --agent-prompt <PATH>      Path to agent prompt file (default: %s)
+    --capture-llm              Write each LLM chat request and its raw streamed
+                               response to a file in config/debug/llm, with API
+                               keys redacted; GET /admin/llm/capture downloads
+                               the latest
+    --agent-prompt <PATH>      Path to agent prompt file, or a directory of persona
+                               prompts (*.md) users choose from (default: %s)
+    --hook-url <URL>           Webhook URL notified of lifecycle events (default: none)
+    --hook-events <LIST>       Events sent to --hook-url (default: %s)
+    --hook-timeout <DURATION>  Maximum time a single hook may run (default: %s)
+    --webhook <URL>            Webhook URL notified in the background when an image
+                               is saved or fails; repeat for several (default: none)
+    --post-save-exec <CMD>     Command run in the background after each image save;
+                               receives the file path as its last argument and
+                               metadata JSON on stdin
+    --moderation-list <PATH>   File of words, phrases and /regexps/, one per line,
+                               that flag image prompts (default: none)
+    --moderation-llm           Have the LLM classify image prompts as safe or unsafe
+                               before generating them
+    --moderation-mode <MODE>   What happens to flagged prompts: "block" refuses to
+                               generate them, "warn" generates them and tells the
+                               user (default: %s)
+    --gallery-only             Serve only the read-only gallery at /gallery
+    --mcp <TRANSPORT>          Serve image generation as an MCP tool: "stdio"
+                               speaks MCP on stdin/stdout, "sse" adds the
+                               /mcp/sse and /mcp/message endpoints (default: off)
+    --encrypt-sessions         Encrypt stored conversations; the passphrase is read
+                               from $WEAVE_PASSPHRASE. Once enabled, sessions stay
+                               encrypted and the passphrase is always required
+    --sessions-max-mb <N>      Largest size of config/sessions in MiB, 0 =
+                               unlimited (default: 0)
+    --sessions-full <POLICY>   At --sessions-max-mb, "evict" deletes the oldest
+                               images that aren't favorites to make room, "refuse"
+                               fails new images and uploads (default: evict)
+    --api-token <TOKEN>        Require this token for mutating requests and the
+                               SSE stream (default: none, no authentication)
+    --api-tokens-file <PATH>   File of accepted tokens, one per line; blank lines
+                               and lines starting with # are ignored
+    --users-file <PATH>        File of users, one "NAME TOKEN" per line. Each user
+                               signs in with their token and has their own
+                               conversations, images and rate limits
+    --user-header <NAME>       Take the user name from this request header, set by
+                               a trusted reverse proxy (default: none)
+    --user-daily-generations <N>
+                               Generations allowed per user per UTC day, 0 =
+                               unlimited (default: 0)
+    --disable-csrf             Skip CSRF token checks on requests that change state.
+                               Only for localhost-only use such as the Electron app
+    --dev                      Serve templates and static assets from disk and reload
+                               them on every request, for UI development
+    --dev-dir <PATH>           Directory holding templates/ and static/ for --dev
+                               (default: %s)
+    --selftest                 Run one LLM exchange and one 64x64 generation at
+                               startup; exit with an error if either fails
+    --debug-pprof              Serve pprof profiles at /debug/pprof/ on a separate
+                               localhost-only port
+    --debug-pprof-port <PORT>  Port for --debug-pprof (default: %d)
+    --watermark-text <TEXT>    Text drawn on gallery images (default: none)
+    --watermark-image <PATH>   PNG overlay drawn on gallery images (default: none)
+    --watermark-corner <NAME>  Watermark corner: top-left, top-right, bottom-left,
+                               bottom-right (default: %s)
+    --watermark-opacity <N>    Watermark opacity, 0.0-1.0 (default: %.1f)
     --help                     Show this help message
     --version                  Show version information
 
@@ -245,15 +1055,77 @@ EXAMPLES:
     # Use different ollama model
     weave --ollama-model llama3.2:3b
 
+    # Download the model on first run instead of running ollama pull
+    weave --ollama-model llama3.2:3b --ollama-pull
+
+    # Spread chats over two GPU machines
+    weave --ollama-url http://gpu1.local:11434 --ollama-url http://gpu2.local:11434
+
+    # Chat through a llama.cpp or vLLM server instead of ollama
+    weave --llm-backend openai --openai-url http://localhost:8000/v1 --openai-model qwen2.5-7b-instruct
+
+    # Sync saved images to a NAS via a webhook
+    weave --hook-url http://nas.local:9000/weave --hook-events post-save
+
+    # Notify two automations whenever an image finishes or fails
+    weave --webhook http://nas.local:9000/done --webhook https://example.com/weave
+
+    # Share published images without exposing chat or generation
+    weave --gallery-only --port 8081
+
+    # Brand shared images
+    weave --watermark-text "made with weave" --watermark-corner bottom-left
+
+    # Keep conversations encrypted on a shared machine
+    WEAVE_PASSPHRASE=... weave --encrypt-sessions
+
+    # Require a token when listening on the LAN
+    weave --listen 0.0.0.0:8080 --allow-lan --api-tokens-file ~/.config/weave/tokens
+    curl -H "Authorization: Bearer $TOKEN" -d message=hi http://host:8080/chat
+
+    # Share one GPU box between several people
+    weave --users-file ~/.config/weave/users --user-daily-generations 200
+
+    # Behind an authenticating proxy such as oauth2-proxy
+    weave --user-header X-Forwarded-User
+
+    # Let an MCP client such as Claude Desktop generate images
+    weave --mcp stdio
+
+    # Edit templates and static files without rebuilding (run from backend/)
+    go run ./cmd/weave --dev
+
+    # Profile memory and goroutines
+    weave --debug-pprof
+    go tool pprof http://localhost:6060/debug/pprof/heap
+
+    # Post-process each saved image with a script
+    weave --post-save-exec "scripts/thumbnail.sh --size 256" --hook-timeout 30s
+
 REQUIREMENTS:
-    - ollama must be running (default: http://localhost:11434)
+    - ollama must be running (default: http://localhost:11434), or the
+      --openai-url server with --llm-backend openai
     - weave-compute process must be running
 
 For more information, see docs/DEVELOPMENT.md
 `,
 		defaultPort, defaultSteps, defaultCFG, defaultWidth, defaultHeight,
-		defaultSeed, defaultLLMSeed, defaultOllamaURL, defaultOllamaModel,
-		defaultLogLevel, DefaultAgentPrompt)
+		defaultSeed, defaultLoRADir, defaultImageMemoryMB, defaultImageDiskMB, image.DefaultQuality, defaultGenerateTimeout, defaultLLMSeed, defaultOllamaURL, defaultOllamaModel,
+		defaultLogLevel, DefaultAgentPrompt, defaultHookEvents, defaultHookTimeout,
+		defaultModerationMode, defaultDevDir, defaultDebugPprofPort, defaultWatermarkCorner, defaultWatermarkOpacity)
+}
+
+// floatFlag returns a flag.Func parser storing its value in *dst, which
+// stays nil unless the flag is given.
+func floatFlag(dst **float64) func(string) error {
+	return func(value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*dst = &f
+		return nil
+	}
 }
 
 // printVersion prints version information
@@ -286,3 +1158,119 @@ func LoadAgentPrompt(path string) (string, error) {
 	}
 	return string(data), nil
 }
+
+// LoadAPITokens loads API tokens from a file with one token per line.
+// Blank lines and lines starting with # are ignored. Returns ErrInvalidAPIToken
+// if a token is too short, and an error if the file has no tokens.
+func LoadAPITokens(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load api tokens from %s: %w", path, err)
+	}
+
+	var tokens []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !validAPIToken(line) {
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, ErrInvalidAPIToken)
+		}
+		tokens = append(tokens, line)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no api tokens in %s", path)
+	}
+	return tokens, nil
+}
+
+// User is an account from the users file.
+type User struct {
+	Name  string
+	Token string
+}
+
+// LoadUsers loads users from a file with one "NAME TOKEN" pair per line.
+// Blank lines and lines starting with # are ignored. Returns ErrInvalidUserName
+// or ErrInvalidAPIToken for a malformed line, and an error if a name or token
+// is repeated or the file has no users.
+func LoadUsers(path string) ([]User, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load users from %s: %w", path, err)
+	}
+
+	var users []User
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s line %d: want \"NAME TOKEN\"", path, i+1)
+		}
+		user := User{Name: fields[0], Token: fields[1]}
+		if !ValidUserName(user.Name) {
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, ErrInvalidUserName)
+		}
+		if !validAPIToken(user.Token) {
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, ErrInvalidAPIToken)
+		}
+		if names[user.Name] {
+			return nil, fmt.Errorf("%s line %d: duplicate user %q", path, i+1, user.Name)
+		}
+		if tokens[user.Token] {
+			return nil, fmt.Errorf("%s line %d: token already used by another user", path, i+1)
+		}
+		names[user.Name] = true
+		tokens[user.Token] = true
+		users = append(users, user)
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("no users in %s", path)
+	}
+	return users, nil
+}
+
+// ValidUserName reports whether name can identify a user. Names are limited
+// to characters that are safe in logs and headers.
+func ValidUserName(name string) bool {
+	if name == "" || len(name) > maxUserNameLength {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == '-', r == '@':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validHeaderName reports whether name is a valid HTTP header field name.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validAPIToken reports whether token is long enough to resist guessing and
+// can be sent in an Authorization header.
+func validAPIToken(token string) bool {
+	return len(token) >= minAPITokenLength && !strings.ContainsAny(token, " \t\r\n")
+}
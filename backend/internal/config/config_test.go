@@ -5,8 +5,12 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/image"
 )
 
 func TestParse_Defaults(t *testing.T) {
@@ -309,6 +313,91 @@ func TestParse_Validation(t *testing.T) {
 			args:    []string{"--log-level", "trace"},
 			wantErr: ErrInvalidLogLevel,
 		},
+		{
+			name:    "hook url without scheme",
+			args:    []string{"--hook-url", "nas.local/hook"},
+			wantErr: ErrInvalidHookURL,
+		},
+		{
+			name:    "hook url with unsupported scheme",
+			args:    []string{"--hook-url", "ftp://nas.local/hook"},
+			wantErr: ErrInvalidHookURL,
+		},
+		{
+			name:    "webhook with unsupported scheme",
+			args:    []string{"--webhook", "https://nas.local/ok", "--webhook", "ftp://nas.local/hook"},
+			wantErr: ErrInvalidWebhook,
+		},
+		{
+			name:    "ollama keep-alive without unit",
+			args:    []string{"--ollama-keep-alive", "5"},
+			wantErr: ErrInvalidOllamaKeepAlive,
+		},
+		{
+			name:    "unknown llm backend",
+			args:    []string{"--llm-backend", "llamafile"},
+			wantErr: ErrInvalidLLMBackend,
+		},
+		{
+			name:    "unknown storage",
+			args:    []string{"--storage", "postgres"},
+			wantErr: ErrInvalidStorage,
+		},
+		{
+			name:    "openai backend without url",
+			args:    []string{"--llm-backend", "openai", "--openai-model", "qwen"},
+			wantErr: ErrInvalidOpenAI,
+		},
+		{
+			name:    "openai backend without model",
+			args:    []string{"--llm-backend", "openai", "--openai-url", "http://localhost:8000/v1"},
+			wantErr: ErrInvalidOpenAI,
+		},
+		{
+			name:    "llm temperature too high",
+			args:    []string{"--llm-temperature", "2.5"},
+			wantErr: ErrInvalidLLMSampling,
+		},
+		{
+			name:    "llm top-k zero",
+			args:    []string{"--llm-top-k", "0"},
+			wantErr: ErrInvalidLLMSampling,
+		},
+		{
+			name:    "unknown hook event",
+			args:    []string{"--hook-events", "post-save,pre-upload"},
+			wantErr: ErrInvalidHookEvents,
+		},
+		{
+			name:    "negative hook timeout",
+			args:    []string{"--hook-timeout", "-1s"},
+			wantErr: ErrInvalidHookTimeout,
+		},
+		{
+			name:    "text and image watermark",
+			args:    []string{"--watermark-text", "weave", "--watermark-image", "logo.png"},
+			wantErr: ErrConflictingWatermark,
+		},
+		{
+			name:    "watermark text too long",
+			args:    []string{"--watermark-text", strings.Repeat("a", 101)},
+			wantErr: ErrInvalidWatermarkText,
+		},
+		{
+			name:    "unknown watermark corner",
+			args:    []string{"--watermark-text", "weave", "--watermark-corner", "center"},
+			wantErr: ErrInvalidWatermarkCorner,
+		},
+		{
+			name:    "zero watermark opacity",
+			args:    []string{"--watermark-text", "weave", "--watermark-opacity", "0"},
+			wantErr: ErrInvalidWatermarkOpacity,
+		},
+		{
+			name:    "watermark opacity above 1",
+			args:    []string{"--watermark-image", "logo.png", "--watermark-opacity", "1.5"},
+			wantErr: ErrInvalidWatermarkOpacity,
+		},
 	}
 
 	for _, tt := range tests {
@@ -339,11 +428,25 @@ func TestPrintHelp(t *testing.T) {
 		"--width",
 		"--height",
 		"--seed",
+		"--gpu",
+		"--generate-timeout",
 		"--llm-seed",
 		"--ollama-url",
 		"--ollama-model",
 		"--log-level",
 		"--agent-prompt",
+		"--hook-url",
+		"--hook-events",
+		"--hook-timeout",
+		"--webhook",
+		"--post-save-exec",
+		"--gallery-only",
+		"--dev",
+		"--dev-dir",
+		"--watermark-text",
+		"--watermark-image",
+		"--watermark-corner",
+		"--watermark-opacity",
 		"--help",
 		"--version",
 		"EXAMPLES:",
@@ -386,16 +489,21 @@ func TestValidate_AllLevels(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := &Config{
-				Port:        defaultPort,
-				Steps:       defaultSteps,
-				CFG:         defaultCFG,
-				Width:       defaultWidth,
-				Height:      defaultHeight,
-				Seed:        defaultSeed,
-				LLMSeed:     defaultLLMSeed,
-				OllamaURL:   defaultOllamaURL,
-				OllamaModel: defaultOllamaModel,
-				LogLevel:    tt.logLevel,
+				Port:                 defaultPort,
+				Steps:                defaultSteps,
+				CFG:                  defaultCFG,
+				Width:                defaultWidth,
+				Height:               defaultHeight,
+				Seed:                 defaultSeed,
+				LLMSeed:              defaultLLMSeed,
+				OllamaURL:            defaultOllamaURL,
+				OllamaModel:          defaultOllamaModel,
+				LogLevel:             tt.logLevel,
+				ComputeWorkers:       1,
+				ComputeMaxResponseMB: defaultComputeMaxResponseMB,
+				ImageQuality:         image.DefaultQuality,
+				GenerateTimeout:      defaultGenerateTimeout,
+				SessionIdleTimeout:   defaultSessionIdleTimeout,
 			}
 
 			err := c.validate()
@@ -539,40 +647,1316 @@ func TestParse_AgentPromptFlag(t *testing.T) {
 	}
 }
 
-func TestLoadAgentPrompt_AbsolutePath(t *testing.T) {
-	// Try to read an absolute path (should be rejected)
-	content, err := LoadAgentPrompt("/etc/passwd")
-	if err != ErrInvalidPath {
-		t.Errorf("LoadAgentPrompt() error = %v, want ErrInvalidPath", err)
+func TestParse_HookFlags(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantURL     string
+		wantEvents  string
+		wantTimeout time.Duration
+		wantExec    string
+	}{
+		{
+			name:        "hooks disabled by default",
+			args:        []string{},
+			wantURL:     "",
+			wantEvents:  defaultHookEvents,
+			wantTimeout: defaultHookTimeout,
+			wantExec:    "",
+		},
+		{
+			name:        "custom hook settings",
+			args:        []string{"--hook-url", "https://nas.local/weave", "--hook-events", "post-save", "--hook-timeout", "30s"},
+			wantURL:     "https://nas.local/weave",
+			wantEvents:  "post-save",
+			wantTimeout: 30 * time.Second,
+			wantExec:    "",
+		},
+		{
+			name:        "post-save exec command",
+			args:        []string{"--post-save-exec", "convert -resize 50%"},
+			wantURL:     "",
+			wantEvents:  defaultHookEvents,
+			wantTimeout: defaultHookTimeout,
+			wantExec:    "convert -resize 50%",
+		},
 	}
 
-	if content != "" {
-		t.Errorf("LoadAgentPrompt() content = %q, want empty string on error", content)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+
+			if cfg.HookURL != tt.wantURL {
+				t.Errorf("HookURL = %s, want %s", cfg.HookURL, tt.wantURL)
+			}
+			if cfg.HookEvents != tt.wantEvents {
+				t.Errorf("HookEvents = %s, want %s", cfg.HookEvents, tt.wantEvents)
+			}
+			if cfg.HookTimeout != tt.wantTimeout {
+				t.Errorf("HookTimeout = %v, want %v", cfg.HookTimeout, tt.wantTimeout)
+			}
+			if cfg.PostSaveExec != tt.wantExec {
+				t.Errorf("PostSaveExec = %s, want %s", cfg.PostSaveExec, tt.wantExec)
+			}
+		})
 	}
 }
 
-func TestLoadAgentPrompt_PathTraversal(t *testing.T) {
-	// Test that path traversal attacks are rejected
+func TestParse_Webhooks(t *testing.T) {
 	tests := []struct {
 		name string
-		path string
+		args []string
+		want []string
 	}{
-		{"simple traversal", "../etc/passwd"},
-		{"double traversal", "../../etc/passwd"},
-		{"deep traversal", "../../../../../../../etc/passwd"},
-		{"embedded traversal", "foo/../../../etc/passwd"},
-		{"dot-dot-slash", ".."},
+		{name: "none by default", args: []string{}, want: nil},
+		{name: "single", args: []string{"--webhook", "http://nas.local:9000/done"}, want: []string{"http://nas.local:9000/done"}},
+		{
+			name: "repeated",
+			args: []string{"--webhook", "http://nas.local:9000/done", "--webhook", "https://example.com/weave"},
+			want: []string{"http://nas.local:9000/done", "https://example.com/weave"},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			content, err := LoadAgentPrompt(tt.path)
-			if err != ErrInvalidPath {
-				t.Errorf("LoadAgentPrompt(%q) error = %v, want ErrInvalidPath", tt.path, err)
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if !slices.Equal(cfg.Webhooks, tt.want) {
+				t.Errorf("Webhooks = %v, want %v", cfg.Webhooks, tt.want)
 			}
+		})
+	}
+}
 
-			if content != "" {
-				t.Errorf("LoadAgentPrompt(%q) content = %q, want empty string on error", tt.path, content)
+func TestParse_Dev(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantDev bool
+		wantDir string
+	}{
+		{name: "disabled by default", args: []string{}, wantDev: false, wantDir: defaultDevDir},
+		{name: "enabled", args: []string{"--dev"}, wantDev: true, wantDir: defaultDevDir},
+		{name: "custom directory", args: []string{"--dev", "--dev-dir", "/src/weave/backend/internal/web"}, wantDev: true, wantDir: "/src/weave/backend/internal/web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.Dev != tt.wantDev {
+				t.Errorf("Dev = %v, want %v", cfg.Dev, tt.wantDev)
+			}
+			if cfg.DevDir != tt.wantDir {
+				t.Errorf("DevDir = %s, want %s", cfg.DevDir, tt.wantDir)
+			}
+		})
+	}
+}
+
+func TestParse_LoRADir(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantDir string
+	}{
+		{name: "default", args: []string{}, wantDir: defaultLoRADir},
+		{name: "custom directory", args: []string{"--lora-dir", "/srv/loras"}, wantDir: "/srv/loras"},
+		{name: "disabled", args: []string{"--lora-dir", ""}, wantDir: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.LoRADir != tt.wantDir {
+				t.Errorf("LoRADir = %q, want %q", cfg.LoRADir, tt.wantDir)
+			}
+		})
+	}
+}
+
+func TestParse_LLMBackend(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantBackend string
+		wantURL     string
+		wantModel   string
+	}{
+		{name: "ollama by default", args: []string{}, wantBackend: LLMBackendOllama},
+		{
+			name:        "openai",
+			args:        []string{"--llm-backend", "openai", "--openai-url", "http://localhost:8000/v1", "--openai-model", "qwen2.5-7b-instruct"},
+			wantBackend: LLMBackendOpenAI,
+			wantURL:     "http://localhost:8000/v1",
+			wantModel:   "qwen2.5-7b-instruct",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.LLMBackend != tt.wantBackend || cfg.OpenAIURL != tt.wantURL || cfg.OpenAIModel != tt.wantModel {
+				t.Errorf("LLMBackend, OpenAIURL, OpenAIModel = %q, %q, %q, want %q, %q, %q",
+					cfg.LLMBackend, cfg.OpenAIURL, cfg.OpenAIModel, tt.wantBackend, tt.wantURL, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestParse_Storage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"files by default", []string{}, StorageFiles},
+		{"sqlite", []string{"--storage", "sqlite"}, StorageSQLite},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.Storage != tt.want {
+				t.Errorf("Storage = %q, want %q", cfg.Storage, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_OllamaKeepAlive(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"ollama default", []string{}, ""},
+		{"duration", []string{"--ollama-keep-alive", "1m"}, "1m"},
+		{"unload after each reply", []string{"--ollama-keep-alive", "0"}, "0"},
+		{"keep loaded", []string{"--ollama-keep-alive", "-1s"}, "-1s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.OllamaKeepAlive != tt.want {
+				t.Errorf("OllamaKeepAlive = %q, want %q", cfg.OllamaKeepAlive, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_OllamaPull(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"off by default", []string{}, false},
+		{"enabled", []string{"--ollama-pull"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.OllamaPull != tt.want {
+				t.Errorf("OllamaPull = %v, want %v", cfg.OllamaPull, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_OllamaStructuredOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"off by default", []string{}, false},
+		{"enabled", []string{"--ollama-structured-output"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.OllamaStructuredOutput != tt.want {
+				t.Errorf("OllamaStructuredOutput = %v, want %v", cfg.OllamaStructuredOutput, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_LLMFallbackModel(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"none by default", []string{}, ""},
+		{"fallback model", []string{"--llm-fallback-model", "llama3.2:3b"}, "llama3.2:3b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.LLMFallbackModel != tt.want {
+				t.Errorf("LLMFallbackModel = %q, want %q", cfg.LLMFallbackModel, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_CaptureLLM(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"off by default", []string{}, false},
+		{"enabled", []string{"--capture-llm"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.CaptureLLM != tt.want {
+				t.Errorf("CaptureLLM = %v, want %v", cfg.CaptureLLM, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_LLMSampling(t *testing.T) {
+	cfg, err := Parse([]string{}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("Parse() error = %v, want nil", err)
+	}
+	if !cfg.LLMSampling.IsZero() {
+		t.Errorf("LLMSampling = %+v, want unset by default", cfg.LLMSampling)
+	}
+
+	cfg, err = Parse([]string{"--llm-temperature", "0", "--llm-top-p", "0.9", "--llm-top-k", "40", "--llm-repeat-penalty", "1.1"}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("Parse() error = %v, want nil", err)
+	}
+	s := cfg.LLMSampling
+	if s.Temperature == nil || *s.Temperature != 0 {
+		t.Errorf("Temperature = %v, want 0", s.Temperature)
+	}
+	if s.TopP == nil || *s.TopP != 0.9 {
+		t.Errorf("TopP = %v, want 0.9", s.TopP)
+	}
+	if s.TopK == nil || *s.TopK != 40 {
+		t.Errorf("TopK = %v, want 40", s.TopK)
+	}
+	if s.RepeatPenalty == nil || *s.RepeatPenalty != 1.1 {
+		t.Errorf("RepeatPenalty = %v, want 1.1", s.RepeatPenalty)
+	}
+
+	if _, err := Parse([]string{"--llm-top-p", "high"}, &bytes.Buffer{}); err == nil {
+		t.Error("Parse() error = nil for a non-numeric --llm-top-p")
+	}
+}
+
+func TestParse_OllamaURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantURL  string
+		wantPool []string
+	}{
+		{"default", []string{}, defaultOllamaURL, []string{defaultOllamaURL}},
+		{"one", []string{"--ollama-url", "http://gpu1:11434"}, "http://gpu1:11434", []string{"http://gpu1:11434"}},
+		{"several", []string{"--ollama-url", "http://gpu1:11434", "--ollama-url", "http://gpu2:11434"}, "http://gpu1:11434", []string{"http://gpu1:11434", "http://gpu2:11434"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.OllamaURL != tt.wantURL {
+				t.Errorf("OllamaURL = %s, want %s", cfg.OllamaURL, tt.wantURL)
+			}
+			if got := cfg.OllamaEndpoints(); !slices.Equal(got, tt.wantPool) {
+				t.Errorf("OllamaEndpoints() = %v, want %v", got, tt.wantPool)
+			}
+		})
+	}
+}
+
+func TestParse_LLMSummarize(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"disabled by default", []string{}, false},
+		{"enabled", []string{"--llm-summarize"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.LLMSummarize != tt.want {
+				t.Errorf("LLMSummarize = %v, want %v", cfg.LLMSummarize, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_VAETilingFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"disabled by default", []string{}, false},
+		{"enabled", []string{"--vae-tiling"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.VAETiling != tt.want {
+				t.Errorf("VAETiling = %v, want %v", cfg.VAETiling, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_ComputeWorkersFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    int
+		wantErr error
+	}{
+		{name: "one by default", args: []string{}, want: 1},
+		{name: "several", args: []string{"--compute-workers", "4"}, want: 4},
+		{name: "zero", args: []string{"--compute-workers", "0"}, wantErr: ErrInvalidComputeWorkers},
+		{name: "too many", args: []string{"--compute-workers", "9"}, wantErr: ErrInvalidComputeWorkers},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && cfg.ComputeWorkers != tt.want {
+				t.Errorf("ComputeWorkers = %d, want %d", cfg.ComputeWorkers, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_GPUFlag(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		want        []int
+		wantCompute []int
+		wantErr     error
+		wantAnyErr  bool
+	}{
+		{name: "first device by default", args: []string{}, wantCompute: []int{0}},
+		{name: "one per worker by default", args: []string{"--compute-workers", "2"}, wantCompute: []int{0, 1}},
+		{name: "second device", args: []string{"--gpu", "1"}, want: []int{1}, wantCompute: []int{1}},
+		{name: "one per worker", args: []string{"--compute-workers", "2", "--gpu", "0, 2"}, want: []int{0, 2}, wantCompute: []int{0, 2}},
+		{name: "more than workers", args: []string{"--gpu", "0,1"}, wantErr: ErrInvalidGPU},
+		{name: "fewer than workers", args: []string{"--compute-workers", "2", "--gpu", "1"}, wantErr: ErrInvalidGPU},
+		{name: "not a number", args: []string{"--gpu", "nvidia"}, wantAnyErr: true},
+		{name: "negative", args: []string{"--gpu", "-1"}, wantAnyErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if tt.wantAnyErr {
+				if err == nil {
+					t.Fatal("Parse() succeeded, want an error")
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !slices.Equal(cfg.GPUs, tt.want) {
+				t.Errorf("GPUs = %v, want %v", cfg.GPUs, tt.want)
+			}
+			if got := cfg.ComputeGPUs(); !slices.Equal(got, tt.wantCompute) {
+				t.Errorf("ComputeGPUs() = %v, want %v", got, tt.wantCompute)
+			}
+		})
+	}
+}
+
+func TestParse_ComputeAddrFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr error
+	}{
+		{name: "spawned by default", args: []string{}, want: ""},
+		{name: "remote", args: []string{"--compute-addr", "gpu-box:7860"}, want: "gpu-box:7860"},
+		{name: "remote over TLS", args: []string{"--compute-addr", "gpu-box:7860", "--compute-ca", "ca.pem"}, want: "gpu-box:7860"},
+		{name: "no port", args: []string{"--compute-addr", "gpu-box"}, wantErr: ErrInvalidComputeAddr},
+		{name: "with workers", args: []string{"--compute-addr", "gpu-box:7860", "--compute-workers", "2"}, wantErr: ErrRemoteComputeWorkers},
+		{name: "with gpu", args: []string{"--compute-addr", "gpu-box:7860", "--gpu", "1"}, wantErr: ErrRemoteComputeWorkers},
+		{name: "tls without addr", args: []string{"--compute-tls"}, wantErr: ErrComputeTLSWithoutAddr},
+		{name: "ca without addr", args: []string{"--compute-ca", "ca.pem"}, wantErr: ErrComputeTLSWithoutAddr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && cfg.ComputeAddr != tt.want {
+				t.Errorf("ComputeAddr = %q, want %q", cfg.ComputeAddr, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_ComputeMaxResponseFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    int
+		wantErr error
+	}{
+		{name: "default", args: []string{}, want: 128},
+		{name: "larger", args: []string{"--compute-max-response-mb", "512"}, want: 512},
+		{name: "zero", args: []string{"--compute-max-response-mb", "0"}, wantErr: ErrInvalidComputeMaxResponse},
+		{name: "too large", args: []string{"--compute-max-response-mb", "1025"}, wantErr: ErrInvalidComputeMaxResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && cfg.ComputeMaxResponseMB != tt.want {
+				t.Errorf("ComputeMaxResponseMB = %d, want %d", cfg.ComputeMaxResponseMB, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_ImageStorageFlags(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantDir    string
+		wantMemory int
+		wantDisk   int
+		wantErr    error
+	}{
+		{name: "default", args: []string{}, wantMemory: 256, wantDisk: 4096},
+		{name: "disk", args: []string{"--image-storage-dir", "cache/images", "--image-memory-mb", "0", "--image-disk-mb", "16"}, wantDir: "cache/images", wantMemory: 0, wantDisk: 16},
+		{name: "negative memory", args: []string{"--image-storage-dir", "cache/images", "--image-memory-mb", "-1"}, wantErr: ErrInvalidImageStorage},
+		{name: "disk smaller than an image", args: []string{"--image-storage-dir", "cache/images", "--image-disk-mb", "15"}, wantErr: ErrInvalidImageStorage},
+		{name: "budgets ignored in memory", args: []string{"--image-disk-mb", "0"}, wantMemory: 256, wantDisk: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (cfg.ImageStorageDir != tt.wantDir || cfg.ImageMemoryMB != tt.wantMemory || cfg.ImageDiskMB != tt.wantDisk) {
+				t.Errorf("ImageStorageDir, ImageMemoryMB, ImageDiskMB = %q, %d, %d, want %q, %d, %d",
+					cfg.ImageStorageDir, cfg.ImageMemoryMB, cfg.ImageDiskMB, tt.wantDir, tt.wantMemory, tt.wantDisk)
+			}
+		})
+	}
+}
+
+func TestParse_ImageQualityFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    int
+		wantErr error
+	}{
+		{name: "default", args: []string{}, want: 90},
+		{name: "lower", args: []string{"--image-quality", "60"}, want: 60},
+		{name: "zero", args: []string{"--image-quality", "0"}, wantErr: ErrInvalidImageQuality},
+		{name: "too high", args: []string{"--image-quality", "101"}, wantErr: ErrInvalidImageQuality},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && cfg.ImageQuality != tt.want {
+				t.Errorf("ImageQuality = %d, want %d", cfg.ImageQuality, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_ImageFormatFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr error
+	}{
+		{name: "default", args: []string{}, want: "png"},
+		{name: "webp", args: []string{"--image-format", "webp"}, want: "webp"},
+		{name: "jpg", args: []string{"--image-format", "jpg"}, want: "jpg"},
+		{name: "unknown", args: []string{"--image-format", "gif"}, wantErr: ErrInvalidImageFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && cfg.ImageFormat != tt.want {
+				t.Errorf("ImageFormat = %q, want %q", cfg.ImageFormat, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_GenerateTimeoutFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    time.Duration
+		wantErr error
+	}{
+		{name: "two minutes by default", args: []string{}, want: 2 * time.Minute},
+		{name: "longer", args: []string{"--generate-timeout", "10m"}, want: 10 * time.Minute},
+		{name: "zero", args: []string{"--generate-timeout", "0"}, wantErr: ErrInvalidGenerateTimeout},
+		{name: "negative", args: []string{"--generate-timeout", "-1s"}, wantErr: ErrInvalidGenerateTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && cfg.GenerateTimeout != tt.want {
+				t.Errorf("GenerateTimeout = %v, want %v", cfg.GenerateTimeout, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_SessionExpiry(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantTimeout time.Duration
+		wantImages  string
+		wantErr     error
+	}{
+		{name: "defaults", args: []string{}, wantTimeout: 24 * time.Hour, wantImages: ExpiredSessionImagesKeep},
+		{name: "archive", args: []string{"--session-idle-timeout", "2h", "--expired-session-images", "archive"}, wantTimeout: 2 * time.Hour, wantImages: ExpiredSessionImagesArchive},
+		{name: "delete", args: []string{"--expired-session-images", "delete"}, wantTimeout: 24 * time.Hour, wantImages: ExpiredSessionImagesDelete},
+		{name: "zero timeout", args: []string{"--session-idle-timeout", "0"}, wantErr: ErrInvalidSessionIdleTimeout},
+		{name: "unknown image policy", args: []string{"--expired-session-images", "compress"}, wantErr: ErrInvalidExpiredSessionImages},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (cfg.SessionIdleTimeout != tt.wantTimeout || cfg.ExpiredSessionImages != tt.wantImages) {
+				t.Errorf("SessionIdleTimeout, ExpiredSessionImages = %v, %q, want %v, %q",
+					cfg.SessionIdleTimeout, cfg.ExpiredSessionImages, tt.wantTimeout, tt.wantImages)
+			}
+		})
+	}
+}
+
+func TestParse_SessionsQuota(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantMaxMB  int
+		wantPolicy string
+		wantErr    error
+	}{
+		{name: "defaults", args: []string{}, wantMaxMB: 0, wantPolicy: SessionsFullEvict},
+		{name: "evict", args: []string{"--sessions-max-mb", "2048"}, wantMaxMB: 2048, wantPolicy: SessionsFullEvict},
+		{name: "refuse", args: []string{"--sessions-max-mb", "512", "--sessions-full", "refuse"}, wantMaxMB: 512, wantPolicy: SessionsFullRefuse},
+		{name: "negative", args: []string{"--sessions-max-mb", "-1"}, wantErr: ErrInvalidSessionsQuota},
+		{name: "unknown policy", args: []string{"--sessions-full", "compress"}, wantErr: ErrInvalidSessionsQuota},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (cfg.SessionsMaxMB != tt.wantMaxMB || cfg.SessionsFull != tt.wantPolicy) {
+				t.Errorf("SessionsMaxMB, SessionsFull = %d, %q, want %d, %q",
+					cfg.SessionsMaxMB, cfg.SessionsFull, tt.wantMaxMB, tt.wantPolicy)
+			}
+		})
+	}
+}
+
+func TestParse_GalleryOnlyFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"disabled by default", []string{}, false},
+		{"enabled", []string{"--gallery-only"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.GalleryOnly != tt.want {
+				t.Errorf("GalleryOnly = %v, want %v", cfg.GalleryOnly, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_EncryptSessionsFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"disabled by default", []string{}, false},
+		{"enabled", []string{"--encrypt-sessions"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.EncryptSessions != tt.want {
+				t.Errorf("EncryptSessions = %v, want %v", cfg.EncryptSessions, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_SelfTestFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"disabled by default", []string{}, false},
+		{"enabled", []string{"--selftest"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.SelfTest != tt.want {
+				t.Errorf("SelfTest = %v, want %v", cfg.SelfTest, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_ListenFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantAddr string
+		wantPort int
+		wantLAN  bool
+		wantErr  error
+	}{
+		{name: "default", args: []string{}, wantAddr: "localhost:8080", wantPort: 8080},
+		{name: "port", args: []string{"--port", "3000"}, wantAddr: "localhost:3000", wantPort: 3000},
+		{name: "loopback listen", args: []string{"--listen", "127.0.0.1:3000"}, wantAddr: "127.0.0.1:3000", wantPort: 3000},
+		{name: "ipv6 loopback", args: []string{"--listen", "[::1]:3000"}, wantAddr: "[::1]:3000", wantPort: 3000},
+		{
+			name:     "all interfaces",
+			args:     []string{"--listen", "0.0.0.0:8081", "--allow-lan"},
+			wantAddr: "0.0.0.0:8081",
+			wantPort: 8081,
+			wantLAN:  true,
+		},
+		{
+			name:     "empty host",
+			args:     []string{"--listen", ":8080", "--allow-lan"},
+			wantAddr: ":8080",
+			wantPort: 8080,
+			wantLAN:  true,
+		},
+		{
+			name:     "matching port",
+			args:     []string{"--port", "8081", "--listen", "localhost:8081"},
+			wantAddr: "localhost:8081",
+			wantPort: 8081,
+		},
+		{name: "lan without allow-lan", args: []string{"--listen", "0.0.0.0:8080"}, wantErr: ErrLANNotAllowed},
+		{name: "hostname without allow-lan", args: []string{"--listen", "gpu-box.local:8080"}, wantErr: ErrLANNotAllowed},
+		{name: "missing port", args: []string{"--listen", "0.0.0.0"}, wantErr: ErrInvalidListen},
+		{name: "privileged port", args: []string{"--listen", "localhost:80"}, wantErr: ErrInvalidListen},
+		{name: "conflicting port", args: []string{"--port", "3000", "--listen", "localhost:8080"}, wantErr: ErrConflictingListen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if cfg.Addr() != tt.wantAddr {
+				t.Errorf("Addr() = %q, want %q", cfg.Addr(), tt.wantAddr)
+			}
+			if cfg.Port != tt.wantPort {
+				t.Errorf("Port = %d, want %d", cfg.Port, tt.wantPort)
+			}
+			if cfg.LAN() != tt.wantLAN {
+				t.Errorf("LAN() = %v, want %v", cfg.LAN(), tt.wantLAN)
+			}
+		})
+	}
+}
+
+func TestParse_DisableCSRFFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"enabled by default", []string{}, false},
+		{"disabled", []string{"--disable-csrf"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.DisableCSRF != tt.want {
+				t.Errorf("DisableCSRF = %v, want %v", cfg.DisableCSRF, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_DebugPprofFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		want     bool
+		wantPort int
+		wantErr  error
+	}{
+		{name: "disabled by default", args: []string{}, want: false, wantPort: 6060},
+		{name: "enabled", args: []string{"--debug-pprof"}, want: true, wantPort: 6060},
+		{name: "custom port", args: []string{"--debug-pprof", "--debug-pprof-port=7070"}, want: true, wantPort: 7070},
+		{name: "port ignored when disabled", args: []string{"--debug-pprof-port=1"}, want: false, wantPort: 1},
+		{name: "port too low", args: []string{"--debug-pprof", "--debug-pprof-port=80"}, wantErr: ErrInvalidDebugPprofPort},
+		{name: "same as server port", args: []string{"--debug-pprof", "--port=6060"}, wantErr: ErrInvalidDebugPprofPort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Parse() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.DebugPprof != tt.want || cfg.DebugPprofPort != tt.wantPort {
+				t.Errorf("DebugPprof, DebugPprofPort = %v, %d, want %v, %d", cfg.DebugPprof, cfg.DebugPprofPort, tt.want, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestParse_WatermarkFlags(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantText    string
+		wantImage   string
+		wantCorner  string
+		wantOpacity float64
+	}{
+		{
+			name:        "disabled by default",
+			args:        []string{},
+			wantCorner:  defaultWatermarkCorner,
+			wantOpacity: defaultWatermarkOpacity,
+		},
+		{
+			name:        "text watermark",
+			args:        []string{"--watermark-text", "made with weave", "--watermark-corner", "top-left", "--watermark-opacity", "1"},
+			wantText:    "made with weave",
+			wantCorner:  "top-left",
+			wantOpacity: 1,
+		},
+		{
+			name:        "image watermark",
+			args:        []string{"--watermark-image", "logo.png"},
+			wantImage:   "logo.png",
+			wantCorner:  defaultWatermarkCorner,
+			wantOpacity: defaultWatermarkOpacity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.WatermarkText != tt.wantText {
+				t.Errorf("WatermarkText = %q, want %q", cfg.WatermarkText, tt.wantText)
+			}
+			if cfg.WatermarkImage != tt.wantImage {
+				t.Errorf("WatermarkImage = %q, want %q", cfg.WatermarkImage, tt.wantImage)
+			}
+			if cfg.WatermarkCorner != tt.wantCorner {
+				t.Errorf("WatermarkCorner = %q, want %q", cfg.WatermarkCorner, tt.wantCorner)
+			}
+			if cfg.WatermarkOpacity != tt.wantOpacity {
+				t.Errorf("WatermarkOpacity = %v, want %v", cfg.WatermarkOpacity, tt.wantOpacity)
+			}
+		})
+	}
+}
+
+func TestParse_APITokenFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantToken string
+		wantFile  string
+		wantErr   error
+	}{
+		{name: "disabled by default", args: []string{}},
+		{
+			name:      "token",
+			args:      []string{"--api-token", "0123456789abcdef"},
+			wantToken: "0123456789abcdef",
+		},
+		{
+			name:     "tokens file",
+			args:     []string{"--api-tokens-file", "/etc/weave/tokens"},
+			wantFile: "/etc/weave/tokens",
+		},
+		{name: "token too short", args: []string{"--api-token", "secret"}, wantErr: ErrInvalidAPIToken},
+		{name: "token with space", args: []string{"--api-token", "0123456789 abcdef"}, wantErr: ErrInvalidAPIToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if cfg.APIToken != tt.wantToken {
+				t.Errorf("APIToken = %q, want %q", cfg.APIToken, tt.wantToken)
+			}
+			if cfg.APITokensFile != tt.wantFile {
+				t.Errorf("APITokensFile = %q, want %q", cfg.APITokensFile, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestLoadAPITokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:    "tokens with comments and blank lines",
+			content: "# laptop\n0123456789abcdef\n\n  fedcba9876543210  \r\n",
+			want:    []string{"0123456789abcdef", "fedcba9876543210"},
+		},
+		{
+			name:    "short token",
+			content: "0123456789abcdef\nshort\n",
+			wantErr: ErrInvalidAPIToken,
+		},
+		{
+			name:    "no tokens",
+			content: "# empty\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("failed to write tokens file: %v", err)
+			}
+
+			got, err := LoadAPITokens(path)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("LoadAPITokens() = %v, want error", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("LoadAPITokens() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadAPITokens() error = %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("LoadAPITokens() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadAPITokens_MissingFile(t *testing.T) {
+	if _, err := LoadAPITokens(filepath.Join(t.TempDir(), "tokens")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadAPITokens() error = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestParse_UserFlags(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantFile   string
+		wantHeader string
+		wantQuota  int
+		wantErr    error
+	}{
+		{name: "disabled by default", args: []string{}},
+		{
+			name:      "users file with quota",
+			args:      []string{"--users-file", "/etc/weave/users", "--user-daily-generations", "200"},
+			wantFile:  "/etc/weave/users",
+			wantQuota: 200,
+		},
+		{
+			name:       "user header",
+			args:       []string{"--user-header", "X-Forwarded-User"},
+			wantHeader: "X-Forwarded-User",
+		},
+		{name: "header with space", args: []string{"--user-header", "X User"}, wantErr: ErrInvalidUserHeader},
+		{name: "header with colon", args: []string{"--user-header", "X-User:"}, wantErr: ErrInvalidUserHeader},
+		{name: "negative quota", args: []string{"--users-file", "users", "--user-daily-generations", "-1"}, wantErr: ErrInvalidUserQuota},
+		{name: "quota without users", args: []string{"--user-daily-generations", "10"}, wantErr: ErrInvalidUserQuota},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			cfg, err := Parse(tt.args, output)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if cfg.UsersFile != tt.wantFile {
+				t.Errorf("UsersFile = %q, want %q", cfg.UsersFile, tt.wantFile)
+			}
+			if cfg.UserHeader != tt.wantHeader {
+				t.Errorf("UserHeader = %q, want %q", cfg.UserHeader, tt.wantHeader)
+			}
+			if cfg.UserDailyGenerations != tt.wantQuota {
+				t.Errorf("UserDailyGenerations = %d, want %d", cfg.UserDailyGenerations, tt.wantQuota)
+			}
+		})
+	}
+}
+
+func TestParse_MCP(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr error
+	}{
+		{name: "disabled by default", args: []string{}},
+		{name: "stdio", args: []string{"--mcp", "stdio"}, want: MCPStdio},
+		{name: "sse", args: []string{"--mcp", "sse"}, want: MCPSSE},
+		{name: "unknown transport", args: []string{"--mcp", "http"}, wantErr: ErrInvalidMCP},
+		{name: "gallery only", args: []string{"--mcp", "sse", "--gallery-only"}, wantErr: ErrInvalidMCP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && cfg.MCP != tt.want {
+				t.Errorf("MCP = %q, want %q", cfg.MCP, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadUsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []User
+		wantErr error
+	}{
+		{
+			name:    "users with comments and blank lines",
+			content: "# lab\nalice 0123456789abcdef\n\n  bob@lab\tfedcba9876543210  \r\n",
+			want: []User{
+				{Name: "alice", Token: "0123456789abcdef"},
+				{Name: "bob@lab", Token: "fedcba9876543210"},
+			},
+		},
+		{name: "missing token", content: "alice\n"},
+		{name: "extra field", content: "alice 0123456789abcdef admin\n"},
+		{name: "invalid name", content: "al/ice 0123456789abcdef\n", wantErr: ErrInvalidUserName},
+		{name: "short token", content: "alice secret\n", wantErr: ErrInvalidAPIToken},
+		{name: "duplicate name", content: "alice 0123456789abcdef\nalice fedcba9876543210\n"},
+		{name: "shared token", content: "alice 0123456789abcdef\nbob 0123456789abcdef\n"},
+		{name: "no users", content: "# empty\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "users")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("failed to write users file: %v", err)
+			}
+
+			got, err := LoadUsers(path)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("LoadUsers() = %v, want error", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("LoadUsers() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadUsers() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("LoadUsers() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("LoadUsers()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidUserName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"alice", true},
+		{"alice.smith@lab-2_b", true},
+		{strings.Repeat("a", 64), true},
+		{"", false},
+		{strings.Repeat("a", 65), false},
+		{"../alice", false},
+		{"alice smith", false},
+		{"ålice", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidUserName(tt.name); got != tt.want {
+				t.Errorf("ValidUserName(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadAgentPrompt_AbsolutePath(t *testing.T) {
+	// Try to read an absolute path (should be rejected)
+	content, err := LoadAgentPrompt("/etc/passwd")
+	if err != ErrInvalidPath {
+		t.Errorf("LoadAgentPrompt() error = %v, want ErrInvalidPath", err)
+	}
+
+	if content != "" {
+		t.Errorf("LoadAgentPrompt() content = %q, want empty string on error", content)
+	}
+}
+
+func TestLoadAgentPrompt_PathTraversal(t *testing.T) {
+	// Test that path traversal attacks are rejected
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"simple traversal", "../etc/passwd"},
+		{"double traversal", "../../etc/passwd"},
+		{"deep traversal", "../../../../../../../etc/passwd"},
+		{"embedded traversal", "foo/../../../etc/passwd"},
+		{"dot-dot-slash", ".."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := LoadAgentPrompt(tt.path)
+			if err != ErrInvalidPath {
+				t.Errorf("LoadAgentPrompt(%q) error = %v, want ErrInvalidPath", tt.path, err)
+			}
+
+			if content != "" {
+				t.Errorf("LoadAgentPrompt(%q) content = %q, want empty string on error", tt.path, content)
+			}
+		})
+	}
+}
+
+func TestParse_EmbeddingModel(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"disabled by default", []string{}, ""},
+		{"set", []string{"--embedding-model", "nomic-embed-text"}, "nomic-embed-text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.EmbeddingModel != tt.want {
+				t.Errorf("EmbeddingModel = %q, want %q", cfg.EmbeddingModel, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Moderation(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantList string
+		wantLLM  bool
+		wantMode string
+		wantErr  error
+	}{
+		{name: "disabled by default", args: []string{}, wantMode: "block"},
+		{name: "keyword list", args: []string{"--moderation-list", "config/blocked.txt"}, wantList: "config/blocked.txt", wantMode: "block"},
+		{name: "llm warn", args: []string{"--moderation-llm", "--moderation-mode", "warn"}, wantLLM: true, wantMode: "warn"},
+		{name: "unknown mode", args: []string{"--moderation-mode", "log"}, wantErr: ErrInvalidModerationMode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(tt.args, &bytes.Buffer{})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil", err)
+			}
+			if cfg.ModerationList != tt.wantList || cfg.ModerationLLM != tt.wantLLM || cfg.ModerationMode != tt.wantMode {
+				t.Errorf("moderation = %q, %v, %q, want %q, %v, %q",
+					cfg.ModerationList, cfg.ModerationLLM, cfg.ModerationMode, tt.wantList, tt.wantLLM, tt.wantMode)
 			}
 		})
 	}
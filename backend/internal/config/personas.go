@@ -0,0 +1,191 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// personaExt is the extension of persona files in an agent prompt directory
+const personaExt = ".md"
+
+// ErrInvalidPersona is returned when a persona's front matter can't be parsed
+var ErrInvalidPersona = errors.New("invalid persona front matter")
+
+// Persona is an agent prompt the user can choose, with the generation
+// settings it works best with. Settings left nil keep the server's.
+type Persona struct {
+	// ID selects the persona: its file name without the extension
+	ID          string
+	Name        string
+	Description string
+	// Prompt is the agent prompt, without the front matter
+	Prompt string
+
+	Steps *int
+	CFG   *float64
+	Seed  *int64
+}
+
+// LoadPersonas loads the agent prompts at path, which may be a single
+// prompt file or a directory of them (*.md, sorted by file name). The
+// first persona is the default.
+//
+// A prompt file may start with front matter between "---" lines:
+//
+//	---
+//	name: Photography coach
+//	description: Talks light, lenses and composition
+//	steps: 28
+//	cfg: 5.5
+//	seed: -1
+//	---
+//	You are a photography coach...
+//
+// Every field is optional; the name defaults to the file name. Like
+// LoadAgentPrompt, only relative paths within the working directory are
+// accepted.
+func LoadPersonas(path string) ([]Persona, error) {
+	cleanPath := filepath.Clean(path)
+	if filepath.IsAbs(cleanPath) || strings.HasPrefix(cleanPath, "..") {
+		return nil, ErrInvalidPath
+	}
+
+	info, err := os.Stat(cleanPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load agent prompt from %s: %w", cleanPath, err)
+	}
+	if !info.IsDir() {
+		persona, err := loadPersona(cleanPath)
+		if err != nil {
+			return nil, err
+		}
+		return []Persona{persona}, nil
+	}
+
+	entries, err := os.ReadDir(cleanPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load agent prompts from %s: %w", cleanPath, err)
+	}
+	var personas []Persona
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != personaExt {
+			continue
+		}
+		persona, err := loadPersona(filepath.Join(cleanPath, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		personas = append(personas, persona)
+	}
+	if len(personas) == 0 {
+		return nil, fmt.Errorf("no agent prompts (*%s) in %s", personaExt, cleanPath)
+	}
+	sort.Slice(personas, func(i, j int) bool { return personas[i].ID < personas[j].ID })
+	return personas, nil
+}
+
+// loadPersona reads one prompt file.
+func loadPersona(path string) (Persona, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Persona{}, fmt.Errorf("failed to load agent prompt from %s: %w", path, err)
+	}
+
+	id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	persona := Persona{ID: id, Name: id, Prompt: string(data)}
+
+	frontMatter, body, ok := splitFrontMatter(string(data))
+	if !ok {
+		return persona, nil
+	}
+	persona.Prompt = body
+	if err := parseFrontMatter(frontMatter, &persona); err != nil {
+		return Persona{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return persona, nil
+}
+
+// splitFrontMatter separates the front matter of a prompt file from its
+// body. ok is false if the file has none.
+func splitFrontMatter(content string) (frontMatter, body string, ok bool) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	rest, found := strings.CutPrefix(content, "---\n")
+	if !found {
+		rest, found = strings.CutPrefix(content, "---\r\n")
+	}
+	if !found {
+		return "", content, false
+	}
+
+	for offset := 0; offset < len(rest); {
+		end := strings.IndexByte(rest[offset:], '\n')
+		line := rest[offset:]
+		next := len(rest)
+		if end >= 0 {
+			line = rest[offset : offset+end]
+			next = offset + end + 1
+		}
+		if strings.TrimSpace(line) == "---" {
+			return rest[:offset], strings.TrimLeft(rest[next:], "\r\n"), true
+		}
+		offset = next
+	}
+	return "", content, false
+}
+
+// parseFrontMatter sets the persona fields given as "key: value" lines.
+func parseFrontMatter(frontMatter string, persona *Persona) error {
+	for i, line := range strings.Split(frontMatter, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return fmt.Errorf("%w: line %d: want key: value", ErrInvalidPersona, i+2)
+		}
+		key = strings.TrimSpace(key)
+		value = unquote(strings.TrimSpace(value))
+
+		switch key {
+		case "name":
+			persona.Name = value
+		case "description":
+			persona.Description = value
+		case "steps":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 100 {
+				return fmt.Errorf("%w: line %d: steps must be 1-100", ErrInvalidPersona, i+2)
+			}
+			persona.Steps = &n
+		case "cfg":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil || f < 0 || f > 20 {
+				return fmt.Errorf("%w: line %d: cfg must be 0-20", ErrInvalidPersona, i+2)
+			}
+			persona.CFG = &f
+		case "seed":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < -1 {
+				return fmt.Errorf("%w: line %d: seed must be >= -1", ErrInvalidPersona, i+2)
+			}
+			persona.Seed = &n
+		default:
+			return fmt.Errorf("%w: line %d: unknown key %q", ErrInvalidPersona, i+2, key)
+		}
+	}
+	return nil
+}
+
+// unquote strips matching single or double quotes around a value.
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePersonaFiles writes files into a directory within the current test
+// directory, since persona paths must be relative, and removes it after
+// the test.
+func writePersonaFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestLoadPersonas_File(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Persona
+		wantErr error
+	}{
+		{
+			name:    "plain prompt",
+			content: "You are a helpful assistant.\n",
+			want:    Persona{ID: "coach", Name: "coach", Prompt: "You are a helpful assistant.\n"},
+		},
+		{
+			name:    "front matter",
+			content: "---\nname: Photography coach\ndescription: \"Light, lenses: composition\"\nsteps: 28\ncfg: 5.5\nseed: -1\n---\n\nYou coach photographers.\n",
+			want: Persona{
+				ID:          "coach",
+				Name:        "Photography coach",
+				Description: "Light, lenses: composition",
+				Prompt:      "You coach photographers.\n",
+				Steps:       intPtr(28),
+				CFG:         floatPtr(5.5),
+				Seed:        int64Ptr(-1),
+			},
+		},
+		{
+			name:    "unterminated front matter is prompt text",
+			content: "---\nname: Coach\n",
+			want:    Persona{ID: "coach", Name: "coach", Prompt: "---\nname: Coach\n"},
+		},
+		{
+			name:    "unknown key",
+			content: "---\nmodel: llama3\n---\nprompt",
+			wantErr: ErrInvalidPersona,
+		},
+		{
+			name:    "steps out of range",
+			content: "---\nsteps: 0\n---\nprompt",
+			wantErr: ErrInvalidPersona,
+		},
+		{
+			name:    "invalid cfg",
+			content: "---\ncfg: high\n---\nprompt",
+			wantErr: ErrInvalidPersona,
+		},
+		{
+			name:    "line without colon",
+			content: "---\njust text\n---\nprompt",
+			wantErr: ErrInvalidPersona,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := "testdata_persona_file"
+			writePersonaFiles(t, dir, map[string]string{"coach.md": tt.content})
+
+			personas, err := LoadPersonas(filepath.Join(dir, "coach.md"))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("LoadPersonas() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadPersonas() error = %v", err)
+			}
+			if len(personas) != 1 {
+				t.Fatalf("LoadPersonas() returned %d personas, want 1", len(personas))
+			}
+			assertPersona(t, personas[0], tt.want)
+		})
+	}
+}
+
+func TestLoadPersonas_Directory(t *testing.T) {
+	dir := "testdata_personas"
+	writePersonaFiles(t, dir, map[string]string{
+		"pixel-art.md": "---\nname: Pixel-art assistant\nsteps: 12\n---\nYou draw pixel art.",
+		"coach.md":     "You coach photographers.",
+		"notes.txt":    "not a persona",
+	})
+
+	personas, err := LoadPersonas(dir)
+	if err != nil {
+		t.Fatalf("LoadPersonas() error = %v", err)
+	}
+	if len(personas) != 2 {
+		t.Fatalf("LoadPersonas() returned %d personas, want 2", len(personas))
+	}
+	assertPersona(t, personas[0], Persona{ID: "coach", Name: "coach", Prompt: "You coach photographers."})
+	assertPersona(t, personas[1], Persona{ID: "pixel-art", Name: "Pixel-art assistant", Prompt: "You draw pixel art.", Steps: intPtr(12)})
+}
+
+func TestLoadPersonas_Errors(t *testing.T) {
+	emptyDir := "testdata_personas_empty"
+	writePersonaFiles(t, emptyDir, map[string]string{"readme.txt": "no prompts here"})
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr error
+	}{
+		{name: "absolute path", path: "/etc/weave", wantErr: ErrInvalidPath},
+		{name: "parent directory", path: "../agents", wantErr: ErrInvalidPath},
+		{name: "missing", path: "nonexistent_personas", wantErr: os.ErrNotExist},
+		{name: "no prompt files", path: emptyDir},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			personas, err := LoadPersonas(tt.path)
+			if err == nil {
+				t.Fatalf("LoadPersonas() = %v, want error", personas)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("LoadPersonas() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func assertPersona(t *testing.T, got, want Persona) {
+	t.Helper()
+	if got.ID != want.ID || got.Name != want.Name || got.Description != want.Description || got.Prompt != want.Prompt {
+		t.Errorf("persona = {%q %q %q %q}, want {%q %q %q %q}",
+			got.ID, got.Name, got.Description, got.Prompt, want.ID, want.Name, want.Description, want.Prompt)
+	}
+	if (got.Steps == nil) != (want.Steps == nil) || got.Steps != nil && *got.Steps != *want.Steps {
+		t.Errorf("Steps = %v, want %v", got.Steps, want.Steps)
+	}
+	if (got.CFG == nil) != (want.CFG == nil) || got.CFG != nil && *got.CFG != *want.CFG {
+		t.Errorf("CFG = %v, want %v", got.CFG, want.CFG)
+	}
+	if (got.Seed == nil) != (want.Seed == nil) || got.Seed != nil && *got.Seed != *want.Seed {
+		t.Errorf("Seed = %v, want %v", got.Seed, want.Seed)
+	}
+}
+
+func intPtr(v int) *int           { return &v }
+func floatPtr(v float64) *float64 { return &v }
+func int64Ptr(v int64) *int64     { return &v }
@@ -0,0 +1,441 @@
+package conversation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hurricanerix/weave/internal/timestamp"
+)
+
+const (
+	// DefaultChatID is the ID of the chat every session starts with.
+	// It is persisted in the session's original conversation file so
+	// sessions created before multiple chats existed load unchanged.
+	DefaultChatID = "main"
+
+	// DefaultChatName is the name given to the default chat.
+	DefaultChatName = "Chat 1"
+
+	// MaxChatsPerSession limits how many chats a session can hold.
+	MaxChatsPerSession = 20
+
+	// MaxChatNameLength is the maximum chat name length in characters.
+	MaxChatNameLength = 100
+)
+
+var (
+	// ErrChatNotFound is returned when a chat ID does not exist in the session
+	ErrChatNotFound = errors.New("chat not found")
+
+	// ErrTooManyChats is returned when creating a chat would exceed MaxChatsPerSession
+	ErrTooManyChats = errors.New("too many chats")
+
+	// ErrLastChat is returned when deleting the only remaining chat
+	ErrLastChat = errors.New("cannot delete the last chat")
+
+	// ErrInvalidChatName is returned for empty or overlong chat names
+	ErrInvalidChatName = errors.New("invalid chat name")
+)
+
+// chatPersistence is implemented by stores that can persist chats beyond
+// the default one. Stores that only implement persistence keep the default
+// chat; additional chats then live in memory only.
+type chatPersistence interface {
+	SaveChat(sessionID, chatID string, conv *Conversation) error
+	LoadChat(sessionID, chatID string) (*Conversation, error)
+	DeleteChat(sessionID, chatID string) error
+	SaveChatIndex(sessionID string, index *ChatIndex) error
+	LoadChatIndex(sessionID string) (*ChatIndex, error)
+}
+
+// ChatInfo describes a named chat within a session.
+type ChatInfo struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChatIndex is the persisted list of a session's chats.
+// Chats are ordered by creation time.
+type ChatIndex struct {
+	ActiveChatID string     `json:"active_chat_id"`
+	Chats        []ChatInfo `json:"chats"`
+}
+
+// chat pairs chat metadata with its conversation manager.
+type chat struct {
+	info    ChatInfo
+	manager *Manager
+}
+
+// ActiveChatID returns the ID of the chat that Manager() currently returns.
+func (s *Session) ActiveChatID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeChatID
+}
+
+// ActiveChat returns the active chat's ID and manager together.
+// Request handlers use this to pin a chat for the lifetime of a request so
+// that switching chats mid-request does not redirect the response.
+func (s *Session) ActiveChat() (string, *Manager) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeChatID, s.findChatLocked(s.activeChatID).manager
+}
+
+// ChatManager returns the manager for a chat, or nil if it doesn't exist.
+func (s *Session) ChatManager(chatID string) *Manager {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c := s.findChatLocked(chatID); c != nil {
+		return c.manager
+	}
+	return nil
+}
+
+// ManagerForMessage returns the manager of the chat containing a message,
+// or nil if no chat has it. Message IDs are unique across a session's chats.
+func (s *Session) ManagerForMessage(messageID int) *Manager {
+	_, manager := s.ChatForMessage(messageID)
+	return manager
+}
+
+// ChatForMessage returns the ID and manager of the chat containing a message.
+// The manager is nil if no chat has it.
+func (s *Session) ChatForMessage(messageID int) (string, *Manager) {
+	s.mu.Lock()
+	chats := append([]*chat(nil), s.chats...)
+	s.mu.Unlock()
+
+	for _, c := range chats {
+		if c.manager.GetMessage(messageID) != nil {
+			return c.info.ID, c.manager
+		}
+	}
+	return "", nil
+}
+
+// Chats returns the session's chats in creation order.
+func (s *Session) Chats() []ChatInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chats := make([]ChatInfo, len(s.chats))
+	for i, c := range s.chats {
+		chats[i] = c.info
+	}
+	return chats
+}
+
+// CreateChat adds a new, empty chat and makes it active.
+// An empty name is replaced with "Chat N".
+func (s *Session) CreateChat(name string) (ChatInfo, error) {
+	name = strings.TrimSpace(name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.chats) >= MaxChatsPerSession {
+		return ChatInfo{}, ErrTooManyChats
+	}
+	if name == "" {
+		name = fmt.Sprintf("Chat %d", len(s.chats)+1)
+	}
+	if err := validateChatName(name); err != nil {
+		return ChatInfo{}, err
+	}
+
+	id, err := newChatID()
+	if err != nil {
+		return ChatInfo{}, err
+	}
+
+	createdAt, _ := timestamp.Next()
+	info := ChatInfo{ID: id, Name: name, CreatedAt: createdAt}
+	s.chats = append(s.chats, &chat{info: info, manager: s.newChatManager(id, NewConversation())})
+	s.activeChatID = id
+	s.saveIndexLocked()
+
+	return info, nil
+}
+
+// RenameChat changes a chat's name.
+func (s *Session) RenameChat(chatID, name string) (ChatInfo, error) {
+	name = strings.TrimSpace(name)
+	if err := validateChatName(name); err != nil {
+		return ChatInfo{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.findChatLocked(chatID)
+	if c == nil {
+		return ChatInfo{}, ErrChatNotFound
+	}
+	c.info.Name = name
+	s.saveIndexLocked()
+
+	return c.info, nil
+}
+
+// SwitchChat makes a chat active.
+func (s *Session) SwitchChat(chatID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findChatLocked(chatID) == nil {
+		return ErrChatNotFound
+	}
+	s.activeChatID = chatID
+	s.saveIndexLocked()
+
+	return nil
+}
+
+// DeleteChat removes a chat and its persisted conversation.
+// Deleting the active chat activates the most recently created remaining chat.
+// The last chat cannot be deleted; use Manager().Clear() to reset it instead.
+func (s *Session) DeleteChat(chatID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := -1
+	for i, c := range s.chats {
+		if c.info.ID == chatID {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return ErrChatNotFound
+	}
+	if len(s.chats) == 1 {
+		return ErrLastChat
+	}
+
+	removed := s.chats[idx]
+	s.chats = append(s.chats[:idx:idx], s.chats[idx+1:]...)
+
+	// Stop persisting changes from requests still holding the manager
+	removed.manager.SetOnChange(nil)
+
+	if s.activeChatID == chatID {
+		s.activeChatID = s.chats[len(s.chats)-1].info.ID
+	}
+	s.saveIndexLocked()
+
+	if cs, ok := s.store.(chatPersistence); ok && chatID != DefaultChatID {
+		if err := cs.DeleteChat(s.id, chatID); err != nil {
+			log.Printf("Failed to delete chat %s for session %s: %v", chatID, s.id, err)
+		}
+	} else if chatID == DefaultChatID && s.store != nil {
+		// The default chat lives in the legacy conversation file; empty it
+		if err := s.store.Save(s.id, NewConversation()); err != nil {
+			log.Printf("Failed to clear default chat for session %s: %v", s.id, err)
+		}
+	}
+
+	return nil
+}
+
+// findChatLocked returns the chat with the given ID, or nil.
+// Must be called with s.mu held.
+func (s *Session) findChatLocked(chatID string) *chat {
+	for _, c := range s.chats {
+		if c.info.ID == chatID {
+			return c
+		}
+	}
+	return nil
+}
+
+// newChatManager creates a manager for a chat that draws message IDs from
+// the session and persists itself on change.
+func (s *Session) newChatManager(chatID string, conv *Conversation) *Manager {
+	manager := NewManagerWithConversation(conv)
+	manager.idSource = s.allocateMessageID
+
+	// Keep the session counter ahead of IDs already used by this chat
+	s.idMu.Lock()
+	if conv.nextMessageID > s.nextMessageID {
+		s.nextMessageID = conv.nextMessageID
+	}
+	s.idMu.Unlock()
+
+	if s.store != nil {
+		manager.SetOnChange(func() {
+			s.saveChat(chatID, manager)
+		})
+	}
+	return manager
+}
+
+// allocateMessageID returns the next session-wide message ID that is at least min.
+// Message IDs are unique across all chats in a session because images and
+// message state endpoints are keyed by session and message ID only.
+func (s *Session) allocateMessageID(min int) int {
+	s.idMu.Lock()
+	defer s.idMu.Unlock()
+
+	id := s.nextMessageID
+	if min > id {
+		id = min
+	}
+	s.nextMessageID = id + 1
+	return id
+}
+
+// ReserveMessageIDs reserves n consecutive session-wide message IDs and
+// returns the first. This is used when restoring messages whose original
+// IDs may collide with other chats.
+func (s *Session) ReserveMessageIDs(n int) int {
+	s.idMu.Lock()
+	defer s.idMu.Unlock()
+
+	if s.nextMessageID < 1 {
+		s.nextMessageID = 1
+	}
+	first := s.nextMessageID
+	s.nextMessageID += n
+	return first
+}
+
+// saveChat persists one chat's conversation.
+// Errors are logged but not returned - persistence failures don't block the request.
+func (s *Session) saveChat(chatID string, manager *Manager) {
+	if err := s.writeChat(chatID, manager); err != nil {
+		log.Printf("Failed to save chat %s for session %s: %v", chatID, s.id, err)
+	}
+}
+
+// writeChat persists one chat's conversation.
+// The default chat uses the legacy per-session file.
+func (s *Session) writeChat(chatID string, manager *Manager) error {
+	conv := manager.GetConversation()
+
+	if chatID == DefaultChatID {
+		return s.store.Save(s.id, conv)
+	}
+	if cs, ok := s.store.(chatPersistence); ok {
+		return cs.SaveChat(s.id, chatID, conv)
+	}
+	return nil
+}
+
+// Flush persists every chat, the chat index and the settings, returning any
+// errors.
+// Changes are already saved as they happen; Flush is used at shutdown so a
+// save that failed earlier gets one more attempt.
+func (s *Session) Flush() error {
+	if s.store == nil {
+		return nil
+	}
+
+	var errs []error
+	s.mu.Lock()
+	chats := make([]*chat, len(s.chats))
+	copy(chats, s.chats)
+	s.saveIndexLocked()
+	if err := s.writeSettingsLocked(); err != nil {
+		errs = append(errs, fmt.Errorf("settings: %w", err))
+	}
+	s.mu.Unlock()
+
+	for _, c := range chats {
+		if err := s.writeChat(c.info.ID, c.manager); err != nil {
+			errs = append(errs, fmt.Errorf("chat %s: %w", c.info.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// saveIndexLocked persists the chat list and active chat.
+// Must be called with s.mu held.
+func (s *Session) saveIndexLocked() {
+	cs, ok := s.store.(chatPersistence)
+	if !ok {
+		return
+	}
+
+	index := &ChatIndex{ActiveChatID: s.activeChatID, Chats: make([]ChatInfo, len(s.chats))}
+	for i, c := range s.chats {
+		index.Chats[i] = c.info
+	}
+	if err := cs.SaveChatIndex(s.id, index); err != nil {
+		log.Printf("Failed to save chat index for session %s: %v", s.id, err)
+	}
+}
+
+// loadChats restores the chat list from persistence.
+// The default chat's conversation has already been loaded into s.chats.
+// Must be called before the session is shared.
+func (s *Session) loadChats() {
+	cs, ok := s.store.(chatPersistence)
+	if !ok {
+		return
+	}
+
+	index, err := cs.LoadChatIndex(s.id)
+	if err != nil {
+		log.Printf("Failed to load chat index for session %s: %v", s.id, err)
+		return
+	}
+	if index == nil {
+		return
+	}
+
+	defaultChat := s.chats[0]
+	chats := make([]*chat, 0, len(index.Chats))
+	for _, info := range index.Chats {
+		if info.ID == DefaultChatID {
+			defaultChat.info = info
+			chats = append(chats, defaultChat)
+			continue
+		}
+
+		conv, err := cs.LoadChat(s.id, info.ID)
+		if err != nil {
+			log.Printf("Failed to load chat %s for session %s: %v", info.ID, s.id, err)
+			continue
+		}
+		chats = append(chats, &chat{info: info, manager: s.newChatManager(info.ID, conv)})
+	}
+
+	if len(chats) == 0 {
+		return
+	}
+	s.chats = chats
+	if s.findChatLocked(index.ActiveChatID) != nil {
+		s.activeChatID = index.ActiveChatID
+	} else {
+		s.activeChatID = chats[0].info.ID
+	}
+}
+
+// validateChatName checks that a trimmed chat name is usable.
+func validateChatName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name cannot be empty", ErrInvalidChatName)
+	}
+	if utf8.RuneCountInString(name) > MaxChatNameLength {
+		return fmt.Errorf("%w: name exceeds %d characters", ErrInvalidChatName, MaxChatNameLength)
+	}
+	return nil
+}
+
+// newChatID generates a random 16-character hex chat ID.
+func newChatID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate chat ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,311 @@
+package conversation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// mockChatPersistence extends mockPersistence with chat storage.
+type mockChatPersistence struct {
+	*mockPersistence
+	chats   map[string]*Conversation
+	indexes map[string]*ChatIndex
+}
+
+func newMockChatPersistence() *mockChatPersistence {
+	return &mockChatPersistence{
+		mockPersistence: newMockPersistence(),
+		chats:           make(map[string]*Conversation),
+		indexes:         make(map[string]*ChatIndex),
+	}
+}
+
+func (m *mockChatPersistence) SaveChat(sessionID, chatID string, conv *Conversation) error {
+	m.chats[sessionID+"/"+chatID] = &Conversation{
+		messages:      append([]ConversationMessage(nil), conv.GetMessages()...),
+		nextMessageID: conv.GetNextMessageID(),
+		currentPrompt: conv.GetCurrentPrompt(),
+	}
+	return nil
+}
+
+func (m *mockChatPersistence) LoadChat(sessionID, chatID string) (*Conversation, error) {
+	conv, exists := m.chats[sessionID+"/"+chatID]
+	if !exists {
+		return NewConversation(), nil
+	}
+	return &Conversation{
+		messages:      append([]ConversationMessage(nil), conv.messages...),
+		nextMessageID: conv.nextMessageID,
+		currentPrompt: conv.currentPrompt,
+	}, nil
+}
+
+func (m *mockChatPersistence) DeleteChat(sessionID, chatID string) error {
+	delete(m.chats, sessionID+"/"+chatID)
+	return nil
+}
+
+func (m *mockChatPersistence) SaveChatIndex(sessionID string, index *ChatIndex) error {
+	m.indexes[sessionID] = &ChatIndex{
+		ActiveChatID: index.ActiveChatID,
+		Chats:        append([]ChatInfo(nil), index.Chats...),
+	}
+	return nil
+}
+
+func (m *mockChatPersistence) LoadChatIndex(sessionID string) (*ChatIndex, error) {
+	return m.indexes[sessionID], nil
+}
+
+func TestSession_DefaultChat(t *testing.T) {
+	sm := NewSessionManager()
+	defer sm.Shutdown()
+
+	session := sm.GetSession("test-session")
+	chats := session.Chats()
+	if len(chats) != 1 {
+		t.Fatalf("new session has %d chats, want 1", len(chats))
+	}
+	if chats[0].ID != DefaultChatID || chats[0].Name != DefaultChatName {
+		t.Errorf("default chat = %+v, want ID %q and name %q", chats[0], DefaultChatID, DefaultChatName)
+	}
+	if session.ActiveChatID() != DefaultChatID {
+		t.Errorf("ActiveChatID() = %q, want %q", session.ActiveChatID(), DefaultChatID)
+	}
+	if session.Manager() != session.ChatManager(DefaultChatID) {
+		t.Error("Manager() does not return the default chat's manager")
+	}
+}
+
+func TestSession_CreateChat(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantName string
+		wantErr  error
+	}{
+		{name: "named", input: "Landscapes", wantName: "Landscapes"},
+		{name: "trimmed", input: "  Portraits  ", wantName: "Portraits"},
+		{name: "empty name gets default", input: "", wantName: "Chat 2"},
+		{name: "overlong name", input: strings.Repeat("x", MaxChatNameLength+1), wantErr: ErrInvalidChatName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := NewSessionManager()
+			defer sm.Shutdown()
+			session := sm.GetSession("test-session")
+
+			info, err := session.CreateChat(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateChat() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if session.ActiveChatID() != DefaultChatID {
+					t.Error("failed CreateChat() changed the active chat")
+				}
+				return
+			}
+			if info.Name != tt.wantName {
+				t.Errorf("Name = %q, want %q", info.Name, tt.wantName)
+			}
+			if len(info.ID) != 16 {
+				t.Errorf("ID = %q, want 16 hex characters", info.ID)
+			}
+			if session.ActiveChatID() != info.ID {
+				t.Errorf("ActiveChatID() = %q, want new chat %q", session.ActiveChatID(), info.ID)
+			}
+		})
+	}
+}
+
+func TestSession_CreateChat_Limit(t *testing.T) {
+	sm := NewSessionManager()
+	defer sm.Shutdown()
+	session := sm.GetSession("test-session")
+
+	for i := 1; i < MaxChatsPerSession; i++ {
+		if _, err := session.CreateChat(""); err != nil {
+			t.Fatalf("CreateChat() #%d error = %v", i, err)
+		}
+	}
+	if _, err := session.CreateChat(""); !errors.Is(err, ErrTooManyChats) {
+		t.Errorf("CreateChat() past limit error = %v, want %v", err, ErrTooManyChats)
+	}
+}
+
+func TestSession_SwitchChatKeepsHistoriesSeparate(t *testing.T) {
+	sm := NewSessionManager()
+	defer sm.Shutdown()
+	session := sm.GetSession("test-session")
+
+	session.Manager().AddUserMessage("in first chat")
+	info, err := session.CreateChat("second")
+	if err != nil {
+		t.Fatalf("CreateChat() error = %v", err)
+	}
+	if n := len(session.Manager().GetMessages()); n != 0 {
+		t.Errorf("new chat has %d messages, want 0", n)
+	}
+	session.Manager().AddUserMessage("in second chat")
+
+	if err := session.SwitchChat(DefaultChatID); err != nil {
+		t.Fatalf("SwitchChat() error = %v", err)
+	}
+	messages := session.Manager().GetMessages()
+	if len(messages) != 1 || messages[0].Content != "in first chat" {
+		t.Errorf("default chat messages = %+v, want only its own message", messages)
+	}
+
+	if err := session.SwitchChat("0000000000000000"); !errors.Is(err, ErrChatNotFound) {
+		t.Errorf("SwitchChat(unknown) error = %v, want %v", err, ErrChatNotFound)
+	}
+	if session.ActiveChatID() != DefaultChatID {
+		t.Error("failed SwitchChat() changed the active chat")
+	}
+	if session.ChatManager(info.ID) == nil {
+		t.Error("ChatManager() returned nil for existing chat")
+	}
+}
+
+func TestSession_MessageIDsUniqueAcrossChats(t *testing.T) {
+	sm := NewSessionManager()
+	defer sm.Shutdown()
+	session := sm.GetSession("test-session")
+
+	first := session.Manager()
+	firstID := first.AddUserMessage("one")
+
+	if _, err := session.CreateChat("second"); err != nil {
+		t.Fatalf("CreateChat() error = %v", err)
+	}
+	second := session.Manager()
+	secondID := second.AddUserMessage("two")
+
+	if firstID == secondID {
+		t.Fatalf("both chats allocated message ID %d", firstID)
+	}
+	if session.ManagerForMessage(firstID) != first {
+		t.Error("ManagerForMessage() did not find the first chat")
+	}
+	if session.ManagerForMessage(secondID) != second {
+		t.Error("ManagerForMessage() did not find the second chat")
+	}
+	if session.ManagerForMessage(999) != nil {
+		t.Error("ManagerForMessage() found a chat for an unknown message")
+	}
+
+	reserved := session.ReserveMessageIDs(3)
+	if reserved <= secondID {
+		t.Errorf("ReserveMessageIDs() = %d, want greater than %d", reserved, secondID)
+	}
+	if next := first.AddUserMessage("three"); next < reserved+3 {
+		t.Errorf("next message ID = %d, want at least %d", next, reserved+3)
+	}
+}
+
+func TestSession_RenameChat(t *testing.T) {
+	sm := NewSessionManager()
+	defer sm.Shutdown()
+	session := sm.GetSession("test-session")
+
+	info, err := session.RenameChat(DefaultChatID, " Renamed ")
+	if err != nil {
+		t.Fatalf("RenameChat() error = %v", err)
+	}
+	if info.Name != "Renamed" || session.Chats()[0].Name != "Renamed" {
+		t.Errorf("name after rename = %q, want %q", session.Chats()[0].Name, "Renamed")
+	}
+
+	if _, err := session.RenameChat(DefaultChatID, "   "); !errors.Is(err, ErrInvalidChatName) {
+		t.Errorf("RenameChat(blank) error = %v, want %v", err, ErrInvalidChatName)
+	}
+	if _, err := session.RenameChat("0000000000000000", "x"); !errors.Is(err, ErrChatNotFound) {
+		t.Errorf("RenameChat(unknown) error = %v, want %v", err, ErrChatNotFound)
+	}
+}
+
+func TestSession_DeleteChat(t *testing.T) {
+	sm := NewSessionManager()
+	defer sm.Shutdown()
+	session := sm.GetSession("test-session")
+
+	if err := session.DeleteChat(DefaultChatID); !errors.Is(err, ErrLastChat) {
+		t.Errorf("DeleteChat(last) error = %v, want %v", err, ErrLastChat)
+	}
+
+	second, _ := session.CreateChat("second")
+	third, _ := session.CreateChat("third")
+
+	// Deleting an inactive chat keeps the active one
+	if err := session.DeleteChat(second.ID); err != nil {
+		t.Fatalf("DeleteChat() error = %v", err)
+	}
+	if session.ActiveChatID() != third.ID {
+		t.Errorf("ActiveChatID() = %q, want %q", session.ActiveChatID(), third.ID)
+	}
+
+	// Deleting the active chat activates the most recent remaining chat
+	if err := session.DeleteChat(third.ID); err != nil {
+		t.Fatalf("DeleteChat() error = %v", err)
+	}
+	if session.ActiveChatID() != DefaultChatID {
+		t.Errorf("ActiveChatID() = %q, want %q", session.ActiveChatID(), DefaultChatID)
+	}
+	if len(session.Chats()) != 1 {
+		t.Errorf("%d chats remain, want 1", len(session.Chats()))
+	}
+
+	if err := session.DeleteChat(second.ID); !errors.Is(err, ErrChatNotFound) {
+		t.Errorf("DeleteChat(deleted) error = %v, want %v", err, ErrChatNotFound)
+	}
+}
+
+func TestSession_ChatsPersistAcrossRestart(t *testing.T) {
+	store := newMockChatPersistence()
+	sessionID := "test-session"
+
+	sm1 := NewSessionManagerWithPersistence(store)
+	session1 := sm1.GetSession(sessionID)
+	session1.Manager().AddUserMessage("default chat message")
+	info, err := session1.CreateChat("Second")
+	if err != nil {
+		t.Fatalf("CreateChat() error = %v", err)
+	}
+	secondID := session1.Manager().AddUserMessage("second chat message")
+	sm1.Shutdown()
+
+	sm2 := NewSessionManagerWithPersistence(store)
+	defer sm2.Shutdown()
+	session2 := sm2.GetSession(sessionID)
+
+	chats := session2.Chats()
+	if len(chats) != 2 || chats[1].ID != info.ID || chats[1].Name != "Second" {
+		t.Fatalf("restored chats = %+v, want default and %q", chats, "Second")
+	}
+	if session2.ActiveChatID() != info.ID {
+		t.Errorf("ActiveChatID() = %q, want %q", session2.ActiveChatID(), info.ID)
+	}
+
+	messages := session2.Manager().GetMessages()
+	if len(messages) != 1 || messages[0].Content != "second chat message" {
+		t.Errorf("second chat messages = %+v, want its own message", messages)
+	}
+	if n := len(session2.ChatManager(DefaultChatID).GetMessages()); n != 1 {
+		t.Errorf("default chat has %d messages, want 1", n)
+	}
+
+	// IDs keep advancing past every restored chat
+	if next := session2.ChatManager(DefaultChatID).AddUserMessage("after restart"); next <= secondID {
+		t.Errorf("message ID after restart = %d, want greater than %d", next, secondID)
+	}
+
+	if err := session2.DeleteChat(info.ID); err != nil {
+		t.Fatalf("DeleteChat() error = %v", err)
+	}
+	if _, exists := store.chats[sessionID+"/"+info.ID]; exists {
+		t.Error("deleted chat is still persisted")
+	}
+}
@@ -0,0 +1,44 @@
+package conversation
+
+import "fmt"
+
+// Token estimates for BuildLLMContextWithin. Without the model's tokenizer,
+// text is assumed to average charsPerToken characters per token, which
+// holds for English with common tokenizers; each message adds the tokens of
+// its chat template framing.
+const (
+	charsPerToken    = 4
+	tokensPerMessage = 4
+)
+
+// MaxSummaryLength is the longest summary, in bytes, Manager.SetSummary
+// keeps.
+const MaxSummaryLength = 1000
+
+// EstimateTokens estimates the number of tokens messages take up in an LLM
+// request. It errs on the high side for English text.
+func EstimateTokens(messages ...Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += tokensPerMessage + (len(msg.Role)+len(msg.Content)+charsPerToken-1)/charsPerToken
+	}
+	return total
+}
+
+// droppedNote tells the LLM that the oldest n history messages were left
+// out of its context.
+func droppedNote(n int) Message {
+	return Message{
+		Role:    RoleUser,
+		Content: fmt.Sprintf("[%d earlier messages were left out to fit the context window]", n),
+	}
+}
+
+// summaryNote gives the LLM a summary of the history messages left out of
+// its context.
+func summaryNote(summary string) Message {
+	return Message{
+		Role:    RoleUser,
+		Content: "[Summary of earlier messages left out to fit the context window:\n" + summary + "]",
+	}
+}
@@ -0,0 +1,24 @@
+package conversation
+
+import "testing"
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []Message
+		want     int
+	}{
+		{"none", nil, 0},
+		{"empty content", []Message{{Role: RoleUser}}, tokensPerMessage + 1},
+		{"rounds up", []Message{{Role: RoleUser, Content: "a cat"}}, tokensPerMessage + 3},
+		{"sums messages", []Message{{Role: RoleUser, Content: "a cat"}, {Role: RoleAssistant, Content: "Sure!"}}, 2*tokensPerMessage + 3 + 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateTokens(tt.messages...); got != tt.want {
+				t.Errorf("EstimateTokens() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package conversation
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/timestamp"
 )
 
 const (
@@ -12,6 +15,21 @@ const (
 	// When this limit is reached, the oldest messages are removed to make room for new ones.
 	// This prevents unbounded memory growth in long-running sessions.
 	MaxHistorySize = 100
+
+	// MaxAlternatesPerMessage limits how many times a message's image can be regenerated.
+	MaxAlternatesPerMessage = 10
+
+	// MaxPromptRevisions is the number of prompt revisions kept per
+	// conversation. The oldest are dropped first.
+	MaxPromptRevisions = 100
+)
+
+var (
+	// ErrMessageNotFound is returned when a message ID does not exist in the conversation
+	ErrMessageNotFound = errors.New("message not found")
+
+	// ErrNotUserMessage is returned when an operation requires a user message
+	ErrNotUserMessage = errors.New("not a user message")
 )
 
 // Manager provides operations for managing a conversation.
@@ -24,6 +42,11 @@ type Manager struct {
 	mu       sync.Mutex
 	conv     *Conversation
 	onChange func() // Called after any mutation to trigger persistence
+
+	// idSource allocates message IDs shared with other chats in the session.
+	// It receives the conversation's own next ID as a lower bound.
+	// nil means IDs come from the conversation alone.
+	idSource func(min int) int
 }
 
 // NewManager creates a new conversation manager with an empty conversation.
@@ -57,6 +80,17 @@ func (m *Manager) triggerOnChangeLocked() {
 	}
 }
 
+// nextMessageIDLocked assigns the next message ID.
+// Must be called while holding the mutex (hence the Locked suffix).
+func (m *Manager) nextMessageIDLocked() int {
+	id := m.conv.nextMessageID
+	if m.idSource != nil {
+		id = m.idSource(id)
+	}
+	m.conv.nextMessageID = id + 1
+	return id
+}
+
 // AddUserMessage adds a user message to the conversation history.
 // If the history exceeds MaxHistorySize, the oldest messages are removed.
 // Returns the assigned message ID.
@@ -64,14 +98,16 @@ func (m *Manager) AddUserMessage(content string) int {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	id := m.conv.nextMessageID
-	m.conv.nextMessageID++
+	id := m.nextMessageIDLocked()
 
+	createdAt, seq := timestamp.Next()
 	m.conv.messages = append(m.conv.messages, ConversationMessage{
-		ID:       id,
-		Role:     RoleUser,
-		Content:  content,
-		Snapshot: nil, // User messages don't have snapshots
+		ID:        id,
+		Role:      RoleUser,
+		Content:   content,
+		Snapshot:  nil, // User messages don't have snapshots
+		CreatedAt: createdAt,
+		Seq:       seq,
 	})
 	m.trimHistoryLocked()
 	m.triggerOnChangeLocked()
@@ -90,8 +126,7 @@ func (m *Manager) AddAssistantMessage(content string, prompt string, metadata *o
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	id := m.conv.nextMessageID
-	m.conv.nextMessageID++
+	id := m.nextMessageIDLocked()
 
 	// Determine if we need to create a snapshot.
 	// A snapshot is created if metadata differs from the last snapshot state.
@@ -112,11 +147,14 @@ func (m *Manager) AddAssistantMessage(content string, prompt string, metadata *o
 		}
 	}
 
+	createdAt, seq := timestamp.Next()
 	m.conv.messages = append(m.conv.messages, ConversationMessage{
-		ID:       id,
-		Role:     RoleAssistant,
-		Content:  content,
-		Snapshot: snapshot,
+		ID:        id,
+		Role:      RoleAssistant,
+		Content:   content,
+		Snapshot:  snapshot,
+		CreatedAt: createdAt,
+		Seq:       seq,
 	})
 
 	// Update current prompt if the assistant provided one.
@@ -125,6 +163,7 @@ func (m *Manager) AddAssistantMessage(content string, prompt string, metadata *o
 	if prompt != "" {
 		m.conv.previousPrompt = m.conv.currentPrompt
 		m.conv.currentPrompt = prompt
+		m.recordPromptLocked(PromptSourceAgent)
 	}
 
 	m.trimHistoryLocked()
@@ -155,6 +194,59 @@ func (m *Manager) GetHistory() []Message {
 	return history
 }
 
+// GetMessages returns a copy of the full message history, including IDs and
+// state snapshots. Snapshots are copied so callers cannot mutate history.
+func (m *Manager) GetMessages() []ConversationMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]ConversationMessage, len(m.conv.messages))
+	for i, msg := range m.conv.messages {
+		messages[i] = msg
+		if msg.Snapshot != nil {
+			snapshot := *msg.Snapshot
+			messages[i].Snapshot = &snapshot
+		}
+	}
+	return messages
+}
+
+// PromptHistory returns the revisions of the current prompt, oldest first.
+// The last revision is the current prompt, unless the history was cleared
+// since, such as by Restore.
+func (m *Manager) PromptHistory() []PromptRevision {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.conv.GetPromptHistory()
+}
+
+// recordPromptLocked adds the current prompt to the prompt history if it
+// differs from the last revision. The oldest revisions are dropped beyond
+// MaxPromptRevisions.
+// Must be called while holding the mutex (hence the Locked suffix).
+func (m *Manager) recordPromptLocked(source string) {
+	history := m.conv.promptHistory
+	if n := len(history); n > 0 && history[n-1].Prompt == m.conv.currentPrompt {
+		return
+	}
+	if len(history) == 0 && m.conv.currentPrompt == "" {
+		return
+	}
+
+	createdAt, seq := timestamp.Next()
+	history = append(history, PromptRevision{
+		Prompt:    m.conv.currentPrompt,
+		Source:    source,
+		CreatedAt: createdAt,
+		Seq:       seq,
+	})
+	if excess := len(history) - MaxPromptRevisions; excess > 0 {
+		history = append(history[:0:0], history[excess:]...)
+	}
+	m.conv.promptHistory = history
+}
+
 // GetConversation returns the underlying Conversation.
 // This is used by SessionManager to access conversation state for persistence.
 // The returned Conversation is NOT thread-safe - caller must hold Manager's mutex.
@@ -171,7 +263,7 @@ func (m *Manager) GetCurrentPrompt() string {
 }
 
 // Clear resets the conversation to an empty state.
-// All messages are removed and the prompt is cleared.
+// All messages are removed and the prompt and its history are cleared.
 //
 // The underlying message slice capacity is preserved to avoid reallocations
 // in active sessions. For sessions that have grown very large, consider
@@ -184,10 +276,152 @@ func (m *Manager) Clear() {
 	m.conv.currentPrompt = ""
 	m.conv.previousPrompt = ""
 	m.conv.promptEdited = false
+	m.conv.promptHistory = nil
 	m.conv.nextMessageID = 1 // Reset message ID counter
+	m.clearSummaryLocked()
 	m.triggerOnChangeLocked()
 }
 
+// Restore replaces the conversation with previously saved messages.
+// This is used when importing an exported session. Messages are copied,
+// the oldest are trimmed to MaxHistorySize, and the message ID counter
+// continues after the highest restored ID. Timestamps are migrated as
+// described in MigrateTimestamps. The prompt history starts over.
+func (m *Manager) Restore(messages []ConversationMessage, currentPrompt string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	restored := make([]ConversationMessage, len(messages))
+	nextID := 1
+	for i, msg := range messages {
+		restored[i] = msg
+		if msg.Snapshot != nil {
+			snapshot := *msg.Snapshot
+			restored[i].Snapshot = &snapshot
+		}
+		if msg.ID >= nextID {
+			nextID = msg.ID + 1
+		}
+	}
+
+	MigrateTimestamps(restored)
+
+	m.conv.messages = restored
+	m.conv.currentPrompt = currentPrompt
+	m.conv.previousPrompt = ""
+	m.conv.promptEdited = false
+	m.conv.promptHistory = nil
+	m.conv.nextMessageID = nextID
+	m.clearSummaryLocked()
+	m.trimHistoryLocked()
+	m.triggerOnChangeLocked()
+}
+
+// MigrateTimestamps brings messages saved by older versions up to the
+// current timestamp format: CreatedAt is converted to UTC and messages
+// without a Seq get one in history order. Messages must be oldest first.
+// The process-wide clock is advanced past them so new messages sort after
+// them.
+func MigrateTimestamps(messages []ConversationMessage) {
+	var prev int64
+	for i := range messages {
+		msg := &messages[i]
+		if msg.Seq == 0 {
+			msg.CreatedAt, msg.Seq = timestamp.Migrate(msg.CreatedAt, prev)
+		} else {
+			msg.CreatedAt = timestamp.Normalize(msg.CreatedAt)
+		}
+		prev = max(prev, msg.Seq)
+		timestamp.Observe(msg.CreatedAt, msg.Seq)
+	}
+}
+
+// RewindTo removes the user message with the given ID and every message
+// after it, so the conversation can continue from just before that message.
+// This is used when the user edits an earlier message and resends it.
+//
+// The current prompt is rolled back to the prompt of the last remaining
+// snapshot (or cleared if none remain), and any pending prompt edit is
+// discarded. Message IDs are not reused.
+//
+// Returns ErrMessageNotFound if no message has the ID, or ErrNotUserMessage
+// if the message was not written by the user.
+func (m *Manager) RewindTo(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := -1
+	for i := range m.conv.messages {
+		if m.conv.messages[i].ID == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return ErrMessageNotFound
+	}
+	if m.conv.messages[index].Role != RoleUser {
+		return ErrNotUserMessage
+	}
+
+	m.conv.messages = m.conv.messages[:index]
+	if id <= m.conv.summaryThrough {
+		m.clearSummaryLocked()
+	}
+	m.conv.currentPrompt = ""
+	if snapshot := m.getLastSnapshotLocked(); snapshot != nil {
+		m.conv.currentPrompt = snapshot.Prompt
+	}
+	m.conv.previousPrompt = ""
+	m.conv.promptEdited = false
+	m.recordPromptLocked(PromptSourceRewind)
+	m.triggerOnChangeLocked()
+	return nil
+}
+
+// DeleteMessage removes the message with the given ID and returns a copy of it
+// so the caller can clean up its images.
+//
+// Removing the message that holds the latest snapshot rolls the current
+// prompt back to the previous snapshot's prompt (or clears it), unless the
+// user has edited the prompt since. This keeps BuildLLMContext from telling
+// the agent about a prompt that only existed in the deleted message.
+//
+// Returns ErrMessageNotFound if no message has the ID.
+func (m *Manager) DeleteMessage(id int) (ConversationMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := -1
+	for i := range m.conv.messages {
+		if m.conv.messages[i].ID == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return ConversationMessage{}, ErrMessageNotFound
+	}
+
+	removed := m.conv.messages[index]
+	wasLatest := removed.Snapshot != nil && m.getLastSnapshotLocked() == removed.Snapshot
+	m.conv.messages = append(m.conv.messages[:index:index], m.conv.messages[index+1:]...)
+	if id <= m.conv.summaryThrough {
+		m.clearSummaryLocked()
+	}
+
+	if wasLatest && !m.conv.promptEdited && m.conv.currentPrompt == removed.Snapshot.Prompt {
+		m.conv.currentPrompt = ""
+		if snapshot := m.getLastSnapshotLocked(); snapshot != nil {
+			m.conv.currentPrompt = snapshot.Prompt
+		}
+		m.recordPromptLocked(PromptSourceRewind)
+	}
+
+	m.triggerOnChangeLocked()
+	return removed, nil
+}
+
 // UpdatePrompt updates the current prompt with a user-provided value.
 // This is called when the user directly edits the prompt in the UI.
 //
@@ -202,6 +436,7 @@ func (m *Manager) UpdatePrompt(newPrompt string) {
 		m.conv.previousPrompt = m.conv.currentPrompt
 		m.conv.currentPrompt = newPrompt
 		m.conv.promptEdited = true
+		m.recordPromptLocked(PromptSourceUser)
 		m.triggerOnChangeLocked()
 	}
 }
@@ -242,16 +477,18 @@ func (m *Manager) NotifyPromptEdited() {
 		return
 	}
 
-	id := m.conv.nextMessageID
-	m.conv.nextMessageID++
+	id := m.nextMessageIDLocked()
 
 	// Inject user message with the current prompt (not system - ollama
 	// requires system messages to be first in conversation)
+	createdAt, seq := timestamp.Next()
 	notification := ConversationMessage{
-		ID:       id,
-		Role:     RoleUser,
-		Content:  `[user edited prompt to: "` + m.conv.currentPrompt + `"]`,
-		Snapshot: nil, // Edit notifications don't have snapshots
+		ID:        id,
+		Role:      RoleUser,
+		Content:   `[user edited prompt to: "` + m.conv.currentPrompt + `"]`,
+		Snapshot:  nil, // Edit notifications don't have snapshots
+		CreatedAt: createdAt,
+		Seq:       seq,
 	}
 	m.conv.messages = append(m.conv.messages, notification)
 
@@ -314,29 +551,28 @@ func (m *Manager) trimHistoryLocked() {
 //	[user] Make it orange
 //	[user] [current prompt: "a fluffy cat"]
 func (m *Manager) BuildLLMContext(systemPrompt string, currentSteps int, currentCFG float64, currentSeed int64) []Message {
+	context, _ := m.BuildLLMContextWithin(systemPrompt, currentSteps, currentCFG, currentSeed, 0)
+	return context
+}
+
+// BuildLLMContextWithin is BuildLLMContext for a model with a limited
+// context window. If the context would exceed maxTokens (as estimated by
+// EstimateTokens), the oldest turns of history are left out, and a note
+// saying how many were dropped takes their place after the settings
+// message. History is only cut before a user message so turns stay whole.
+// The system prompt, settings and current prompt are always included.
+//
+// maxTokens <= 0 means no limit. Returns the context and the number of
+// history messages left out.
+func (m *Manager) BuildLLMContextWithin(systemPrompt string, currentSteps int, currentCFG float64, currentSeed int64, maxTokens int) ([]Message, int) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Pre-allocate exact capacity to avoid slice growth during appends.
-	// Capacity = history + optional system prompt + optional settings + optional trailing context.
-	capacity := len(m.conv.messages)
-	if systemPrompt != "" {
-		capacity++
-	}
-	// Check if any settings are non-zero (settings are set)
-	hasSettings := currentSteps != 0 || currentCFG != 0 || currentSeed != 0
-	if hasSettings {
-		capacity++
-	}
-	if m.conv.currentPrompt != "" {
-		capacity++
-	}
-
-	context := make([]Message, 0, capacity)
+	var head []Message
 
 	// Prepend system prompt if provided
 	if systemPrompt != "" {
-		context = append(context, Message{
+		head = append(head, Message{
 			Role:    RoleSystem,
 			Content: systemPrompt,
 		})
@@ -347,37 +583,79 @@ func (m *Manager) BuildLLMContext(systemPrompt string, currentSteps int, current
 	// so the agent sees current UI values when generating responses.
 	// Note: We use RoleUser instead of RoleSystem because Ollama requires
 	// system messages to be first in the conversation (only one allowed).
-	if hasSettings {
+	if currentSteps != 0 || currentCFG != 0 || currentSeed != 0 {
 		// Format: [Current generation settings: steps=20, cfg=7.5, seed=42]
 		settingsMsg := fmt.Sprintf("[Current generation settings: steps=%d, cfg=%.1f, seed=%d]",
 			currentSteps, currentCFG, currentSeed)
-		context = append(context, Message{
+		head = append(head, Message{
 			Role:    RoleUser,
 			Content: settingsMsg,
 		})
 	}
 
-	// Add all conversation history (convert ConversationMessage to Message)
-	for _, msg := range m.conv.messages {
-		context = append(context, Message{
-			Role:      msg.Role,
-			Content:   msg.Content,
-			ToolCalls: msg.ToolCalls,
-		})
-	}
-
 	// Append trailing context with current prompt if set.
 	// Note: We use RoleUser instead of RoleSystem because Ollama requires
 	// system messages to be first in the conversation. This context message
 	// represents state information for the agent, similar to edit notifications.
+	var tail []Message
 	if m.conv.currentPrompt != "" {
-		context = append(context, Message{
+		tail = append(tail, Message{
 			Role:    RoleUser,
 			Content: `[current prompt: "` + m.conv.currentPrompt + `"]`,
 		})
 	}
 
-	return context
+	// Keep as much recent history as fits alongside the fixed messages
+	history := m.conv.messages
+	start := 0
+	if maxTokens > 0 {
+		note := droppedNote(len(history))
+		if m.conv.summary != "" {
+			// Leave room for the longest summary so writing a new one
+			// does not change what is left out
+			note = summaryNote(strings.Repeat(" ", MaxSummaryLength))
+		}
+		budget := maxTokens - EstimateTokens(head...) - EstimateTokens(tail...) - EstimateTokens(note)
+		start = len(history)
+		for start > 0 {
+			cost := EstimateTokens(Message{Role: history[start-1].Role, Content: history[start-1].Content})
+			if cost > budget {
+				break
+			}
+			budget -= cost
+			start--
+		}
+		for start < len(history) && start > 0 && history[start].Role != RoleUser {
+			start++
+		}
+	}
+
+	// Pre-allocate exact capacity to avoid slice growth during appends.
+	capacity := len(head) + len(history) - start + len(tail)
+	if start > 0 {
+		capacity++
+	}
+	context := make([]Message, 0, capacity)
+	context = append(context, head...)
+	if start > 0 {
+		if m.conv.summary != "" && m.conv.summaryThrough == history[start-1].ID {
+			context = append(context, summaryNote(m.conv.summary))
+		} else {
+			context = append(context, droppedNote(start))
+		}
+	}
+
+	// Add conversation history (convert ConversationMessage to Message)
+	for _, msg := range history[start:] {
+		context = append(context, Message{
+			Role:      msg.Role,
+			Content:   msg.Content,
+			ToolCalls: msg.ToolCalls,
+		})
+	}
+
+	context = append(context, tail...)
+	return context, start
 }
 
 // getLastSnapshotLocked returns the most recent state snapshot from the conversation.
@@ -425,3 +703,150 @@ func (m *Manager) UpdateMessagePreview(id int, status string, url string) {
 		}
 	}
 }
+
+// SetMessageImageSeed records the seed the preview image of a message with a
+// snapshot was generated with. If the message doesn't exist or has no
+// snapshot, this method does nothing.
+func (m *Manager) SetMessageImageSeed(id int, seed int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.conv.messages {
+		if m.conv.messages[i].ID == id && m.conv.messages[i].Snapshot != nil {
+			m.conv.messages[i].Snapshot.ImageSeed = seed
+			m.triggerOnChangeLocked()
+			return
+		}
+	}
+}
+
+// SetMessageSettings records the generation settings the preview image of a
+// message with a snapshot was generated with, so they can be restored. If
+// the message doesn't exist or has no snapshot, this method does nothing.
+func (m *Manager) SetMessageSettings(id int, steps int, cfg float64, seed int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.conv.messages {
+		if m.conv.messages[i].ID == id && m.conv.messages[i].Snapshot != nil {
+			snapshot := m.conv.messages[i].Snapshot
+			snapshot.Steps, snapshot.CFG, snapshot.Seed = steps, cfg, seed
+			m.triggerOnChangeLocked()
+			return
+		}
+	}
+}
+
+// SetMessageGeneration records how the preview image of a message with a
+// snapshot was generated; nil clears it. If the message doesn't exist or has
+// no snapshot, this method does nothing.
+func (m *Manager) SetMessageGeneration(id int, generation *GenerationMetadata) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.conv.messages {
+		if m.conv.messages[i].ID == id && m.conv.messages[i].Snapshot != nil {
+			m.conv.messages[i].Snapshot.Generation = generation
+			m.triggerOnChangeLocked()
+			return
+		}
+	}
+}
+
+// AddMessageAlternate appends an alternate image to a message with a snapshot
+// and returns its 1-based alternate number.
+//
+// Returns 0 if the message doesn't exist, has no snapshot, or already has
+// MaxAlternatesPerMessage alternates.
+func (m *Manager) AddMessageAlternate(id int, alternate ImageAlternate) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.conv.messages {
+		msg := &m.conv.messages[i]
+		if msg.ID != id || msg.Snapshot == nil {
+			continue
+		}
+		if len(msg.Alternates) >= MaxAlternatesPerMessage {
+			return 0
+		}
+		msg.Alternates = append(msg.Alternates, alternate)
+		m.triggerOnChangeLocked()
+		return len(msg.Alternates)
+	}
+	return 0
+}
+
+// SetMessageUsage records the token usage of the LLM request that produced
+// a message. If the message doesn't exist, this method does nothing.
+func (m *Manager) SetMessageUsage(id int, usage ollama.Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.conv.messages {
+		if m.conv.messages[i].ID == id {
+			m.conv.messages[i].Usage = &usage
+			m.triggerOnChangeLocked()
+			return
+		}
+	}
+}
+
+// SetMessageModel records the LLM model that produced a message. If the
+// message doesn't exist, this method does nothing.
+func (m *Manager) SetMessageModel(id int, model string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.conv.messages {
+		if m.conv.messages[i].ID == id {
+			m.conv.messages[i].Model = model
+			m.triggerOnChangeLocked()
+			return
+		}
+	}
+}
+
+// TokenUsage returns the token usage summed over the messages in history.
+func (m *Manager) TokenUsage() ollama.Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var total ollama.Usage
+	for _, msg := range m.conv.messages {
+		if msg.Usage != nil {
+			total = total.Add(*msg.Usage)
+		}
+	}
+	return total
+}
+
+// Summary returns the summary of the oldest messages set by SetSummary and
+// the ID of the last message it covers, or "" and 0 if there is none.
+func (m *Manager) Summary() (string, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conv.summary, m.conv.summaryThrough
+}
+
+// SetSummary stores a summary of every message up to and including the one
+// with ID throughID. BuildLLMContextWithin sends it in place of exactly those
+// messages when they do not fit the context window. The summary is cut to
+// MaxSummaryLength bytes and is forgotten when a message it covers is
+// removed.
+func (m *Manager) SetSummary(summary string, throughID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(summary) > MaxSummaryLength {
+		summary = summary[:MaxSummaryLength]
+	}
+	m.conv.summary = summary
+	m.conv.summaryThrough = throughID
+}
+
+// clearSummaryLocked forgets the summary. Caller must hold m.mu.
+func (m *Manager) clearSummaryLocked() {
+	m.conv.summary = ""
+	m.conv.summaryThrough = 0
+}
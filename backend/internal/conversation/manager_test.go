@@ -1,7 +1,13 @@
 package conversation
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/ollama"
 )
 
 func TestNewManager(t *testing.T) {
@@ -44,6 +50,60 @@ func TestAddUserMessage(t *testing.T) {
 	}
 }
 
+func TestAddMessageRecordsCreatedAt(t *testing.T) {
+	m := NewManager()
+
+	// Timestamps are stored at microsecond precision
+	before := time.Now().Truncate(time.Microsecond)
+	m.AddUserMessage("hello")
+	m.AddAssistantMessage("hi", "a cat", nil)
+
+	var prevSeq int64
+	for _, msg := range m.GetMessages() {
+		if msg.Seq <= prevSeq {
+			t.Errorf("message %d Seq = %d, want greater than %d", msg.ID, msg.Seq, prevSeq)
+		}
+		prevSeq = msg.Seq
+		if msg.CreatedAt.Before(before) || msg.CreatedAt.After(time.Now()) {
+			t.Errorf("message %d CreatedAt = %v, want time of creation", msg.ID, msg.CreatedAt)
+		}
+		if msg.CreatedAt.Location() != time.UTC {
+			t.Errorf("message %d CreatedAt location = %v, want UTC", msg.ID, msg.CreatedAt.Location())
+		}
+	}
+}
+
+func TestMigrateTimestamps(t *testing.T) {
+	offset := time.FixedZone("UTC+2", 2*60*60)
+	created := time.Date(2025, 3, 1, 14, 0, 0, 0, offset)
+
+	messages := []ConversationMessage{
+		{ID: 1, Role: RoleUser, Content: "legacy, no time"},
+		{ID: 2, Role: RoleUser, Content: "legacy", CreatedAt: created},
+		{ID: 3, Role: RoleUser, Content: "legacy, same time", CreatedAt: created},
+	}
+	MigrateTimestamps(messages)
+
+	if !messages[0].CreatedAt.IsZero() {
+		t.Errorf("message 1 CreatedAt = %v, want zero", messages[0].CreatedAt)
+	}
+	if got, want := messages[1].CreatedAt, created.UTC(); got != want {
+		t.Errorf("message 2 CreatedAt = %v, want %v", got, want)
+	}
+	for i := 1; i < len(messages); i++ {
+		if messages[i].Seq <= messages[i-1].Seq {
+			t.Errorf("message %d Seq = %d, want greater than %d", messages[i].ID, messages[i].Seq, messages[i-1].Seq)
+		}
+	}
+
+	// New messages sort after migrated ones
+	m := NewManager()
+	m.AddUserMessage("new")
+	if got := m.GetMessages()[0].Seq; got <= messages[2].Seq {
+		t.Errorf("new message Seq = %d, want greater than %d", got, messages[2].Seq)
+	}
+}
+
 func TestAddAssistantMessage(t *testing.T) {
 	m := NewManager()
 
@@ -182,6 +242,193 @@ func TestClearPreservesCapacity(t *testing.T) {
 	}
 }
 
+func TestRestore(t *testing.T) {
+	m := NewManager()
+	m.AddUserMessage("old message")
+	m.UpdatePrompt("old prompt")
+
+	snapshot := &StateSnapshot{Prompt: "a cat", Steps: 20, CFG: 5.0, Seed: 42}
+	m.Restore([]ConversationMessage{
+		{ID: 3, Role: RoleUser, Content: "I want a cat"},
+		{ID: 7, Role: RoleAssistant, Content: "Here's a cat", Snapshot: snapshot},
+	}, "a cat")
+
+	messages := m.GetMessages()
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages after restore, got %d", len(messages))
+	}
+	if messages[0].Content != "I want a cat" || messages[1].ID != 7 {
+		t.Errorf("Restored messages = %+v, want imported history", messages)
+	}
+	if m.GetCurrentPrompt() != "a cat" {
+		t.Errorf("GetCurrentPrompt() = %q, want %q", m.GetCurrentPrompt(), "a cat")
+	}
+	if m.IsPromptEdited() {
+		t.Error("IsPromptEdited() = true after restore, want false")
+	}
+
+	// Restored snapshots are copies
+	snapshot.Prompt = "mutated"
+	if m.GetMessage(7).Snapshot.Prompt != "a cat" {
+		t.Error("Restore() did not copy snapshot")
+	}
+
+	// New messages continue after the highest restored ID
+	if id := m.AddUserMessage("next"); id != 8 {
+		t.Errorf("AddUserMessage() ID = %d, want 8", id)
+	}
+}
+
+func TestRestoreTrimsHistory(t *testing.T) {
+	m := NewManager()
+
+	messages := make([]ConversationMessage, MaxHistorySize+5)
+	for i := range messages {
+		messages[i] = ConversationMessage{ID: i + 1, Role: RoleUser, Content: "msg"}
+	}
+	m.Restore(messages, "")
+
+	restored := m.GetMessages()
+	if len(restored) != MaxHistorySize {
+		t.Fatalf("Expected %d messages after restore, got %d", MaxHistorySize, len(restored))
+	}
+	if restored[0].ID != 6 {
+		t.Errorf("Oldest restored ID = %d, want 6", restored[0].ID)
+	}
+}
+
+func TestRewindTo(t *testing.T) {
+	m := NewManager()
+	m.AddUserMessage("I want a cat")
+	m.AddAssistantMessage("Here's a cat", "a cat", &ollama.LLMMetadata{Prompt: "a cat"})
+	edited := m.AddUserMessage("make it blue")
+	last := m.AddAssistantMessage("Here's a blue cat", "a blue cat", &ollama.LLMMetadata{Prompt: "a blue cat"})
+	m.UpdatePrompt("a blue cat, watercolor")
+
+	if err := m.RewindTo(edited); err != nil {
+		t.Fatalf("RewindTo() error = %v", err)
+	}
+
+	messages := m.GetMessages()
+	if len(messages) != 2 || messages[1].Content != "Here's a cat" {
+		t.Fatalf("messages after rewind = %+v, want the first exchange", messages)
+	}
+	if got := m.GetCurrentPrompt(); got != "a cat" {
+		t.Errorf("GetCurrentPrompt() = %q, want %q", got, "a cat")
+	}
+	if m.IsPromptEdited() {
+		t.Error("IsPromptEdited() = true after rewind, want false")
+	}
+
+	// Removed IDs are not reused
+	if id := m.AddUserMessage("make it a dog"); id <= last {
+		t.Errorf("AddUserMessage() ID = %d, want greater than %d", id, last)
+	}
+}
+
+func TestRewindToFirstMessageClearsPrompt(t *testing.T) {
+	m := NewManager()
+	first := m.AddUserMessage("I want a cat")
+	m.AddAssistantMessage("Here's a cat", "a cat", &ollama.LLMMetadata{Prompt: "a cat"})
+
+	if err := m.RewindTo(first); err != nil {
+		t.Fatalf("RewindTo() error = %v", err)
+	}
+	if len(m.GetMessages()) != 0 {
+		t.Errorf("messages after rewind = %d, want 0", len(m.GetMessages()))
+	}
+	if got := m.GetCurrentPrompt(); got != "" {
+		t.Errorf("GetCurrentPrompt() = %q, want empty", got)
+	}
+}
+
+func TestRewindToErrors(t *testing.T) {
+	m := NewManager()
+	m.AddUserMessage("I want a cat")
+	assistant := m.AddAssistantMessage("Here's a cat", "a cat", nil)
+
+	tests := []struct {
+		name string
+		id   int
+		want error
+	}{
+		{name: "unknown message", id: 99, want: ErrMessageNotFound},
+		{name: "assistant message", id: assistant, want: ErrNotUserMessage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.RewindTo(tt.id); !errors.Is(err, tt.want) {
+				t.Errorf("RewindTo() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if len(m.GetMessages()) != 2 {
+		t.Errorf("messages = %d after failed rewind, want 2", len(m.GetMessages()))
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	m := NewManager()
+	m.AddUserMessage("I want a cat")
+	m.AddAssistantMessage("Here's a cat", "a cat", &ollama.LLMMetadata{Prompt: "a cat"})
+	user := m.AddUserMessage("make it blue")
+	last := m.AddAssistantMessage("Here's a blue cat", "a blue cat", &ollama.LLMMetadata{Prompt: "a blue cat"})
+
+	// A message without a snapshot leaves the prompt alone
+	if _, err := m.DeleteMessage(user); err != nil {
+		t.Fatalf("DeleteMessage() error = %v", err)
+	}
+	if got := m.GetCurrentPrompt(); got != "a blue cat" {
+		t.Errorf("GetCurrentPrompt() = %q, want %q", got, "a blue cat")
+	}
+
+	// Deleting the latest snapshot rolls the prompt back
+	removed, err := m.DeleteMessage(last)
+	if err != nil {
+		t.Fatalf("DeleteMessage() error = %v", err)
+	}
+	if removed.Content != "Here's a blue cat" {
+		t.Errorf("removed message = %q, want the deleted message", removed.Content)
+	}
+	if got := m.GetCurrentPrompt(); got != "a cat" {
+		t.Errorf("GetCurrentPrompt() = %q, want %q", got, "a cat")
+	}
+
+	messages := m.GetMessages()
+	if len(messages) != 2 || messages[1].Content != "Here's a cat" {
+		t.Fatalf("messages after delete = %+v, want the first exchange", messages)
+	}
+	for _, msg := range m.BuildLLMContext("", 0, 0, 0) {
+		if msg.Content == "make it blue" || msg.Content == "Here's a blue cat" {
+			t.Errorf("LLM context still contains deleted message %q", msg.Content)
+		}
+	}
+
+	if _, err := m.DeleteMessage(last); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("DeleteMessage() of deleted message error = %v, want %v", err, ErrMessageNotFound)
+	}
+	if id := m.AddUserMessage("make it a dog"); id <= last {
+		t.Errorf("AddUserMessage() ID = %d, want greater than %d", id, last)
+	}
+}
+
+func TestDeleteMessageKeepsEditedPrompt(t *testing.T) {
+	m := NewManager()
+	m.AddUserMessage("I want a cat")
+	m.AddAssistantMessage("Here's a cat", "a cat", &ollama.LLMMetadata{Prompt: "a cat"})
+	last := m.AddAssistantMessage("Here's a blue cat", "a blue cat", &ollama.LLMMetadata{Prompt: "a blue cat"})
+	m.UpdatePrompt("a blue cat, watercolor")
+
+	if _, err := m.DeleteMessage(last); err != nil {
+		t.Fatalf("DeleteMessage() error = %v", err)
+	}
+	if got := m.GetCurrentPrompt(); got != "a blue cat, watercolor" {
+		t.Errorf("GetCurrentPrompt() = %q, want the user's edit kept", got)
+	}
+}
+
 func TestUpdatePromptSetsEditedFlag(t *testing.T) {
 	m := NewManager()
 
@@ -202,6 +449,59 @@ func TestUpdatePromptSetsEditedFlag(t *testing.T) {
 	}
 }
 
+func TestPromptHistory(t *testing.T) {
+	m := NewManager()
+
+	m.AddAssistantMessage("Here's your prompt", "a cat", nil)
+	m.AddAssistantMessage("Same prompt", "a cat", nil)
+	m.UpdatePrompt("a fluffy cat")
+	userID := m.AddUserMessage("Make it orange")
+	m.AddAssistantMessage("Done", "an orange fluffy cat", &ollama.LLMMetadata{Prompt: "an orange fluffy cat"})
+	if err := m.RewindTo(userID); err != nil {
+		t.Fatalf("RewindTo() error = %v", err)
+	}
+
+	want := []struct{ prompt, source string }{
+		{"a cat", PromptSourceAgent},
+		{"a fluffy cat", PromptSourceUser},
+		{"an orange fluffy cat", PromptSourceAgent},
+		{"", PromptSourceRewind},
+	}
+	history := m.PromptHistory()
+	if len(history) != len(want) {
+		t.Fatalf("PromptHistory() = %+v, want %d revisions", history, len(want))
+	}
+	for i, w := range want {
+		if history[i].Prompt != w.prompt || history[i].Source != w.source {
+			t.Errorf("PromptHistory()[%d] = %q from %s, want %q from %s", i, history[i].Prompt, history[i].Source, w.prompt, w.source)
+		}
+		if i > 0 && history[i].Seq <= history[i-1].Seq {
+			t.Errorf("PromptHistory()[%d].Seq = %d, want it after %d", i, history[i].Seq, history[i-1].Seq)
+		}
+	}
+
+	m.Clear()
+	if history := m.PromptHistory(); len(history) != 0 {
+		t.Errorf("PromptHistory() after Clear() = %+v, want empty", history)
+	}
+}
+
+func TestPromptHistoryLimit(t *testing.T) {
+	m := NewManager()
+
+	for i := 0; i < MaxPromptRevisions+5; i++ {
+		m.UpdatePrompt(fmt.Sprintf("prompt %d", i))
+	}
+
+	history := m.PromptHistory()
+	if len(history) != MaxPromptRevisions {
+		t.Fatalf("PromptHistory() length = %d, want %d", len(history), MaxPromptRevisions)
+	}
+	if history[0].Prompt != "prompt 5" {
+		t.Errorf("oldest revision = %q, want %q", history[0].Prompt, "prompt 5")
+	}
+}
+
 func TestUpdatePromptNoChangeDoesNotSetFlag(t *testing.T) {
 	m := NewManager()
 
@@ -867,3 +1167,164 @@ func TestBuildLLMContextSettingsWithTrailing(t *testing.T) {
 		t.Errorf("Trailing not at last position: %s", trailing.Content)
 	}
 }
+
+func TestManagerTokenUsage(t *testing.T) {
+	m := NewManager()
+	m.AddUserMessage("a cat")
+	first := m.AddAssistantMessage("Here's a cat", "", nil)
+	m.AddUserMessage("make it orange")
+	second := m.AddAssistantMessage("Orange it is", "", nil)
+
+	if got := m.TokenUsage(); got != (ollama.Usage{}) {
+		t.Errorf("TokenUsage() before usage was recorded = %+v, want zero", got)
+	}
+
+	m.SetMessageUsage(first, ollama.Usage{PromptTokens: 500, CompletionTokens: 20})
+	m.SetMessageUsage(second, ollama.Usage{PromptTokens: 540, CompletionTokens: 12})
+	m.SetMessageUsage(999, ollama.Usage{PromptTokens: 1})
+
+	if got := m.GetMessage(second).Usage; got == nil || got.PromptTokens != 540 {
+		t.Errorf("message usage = %+v, want prompt tokens 540", got)
+	}
+	if got, want := m.TokenUsage(), (ollama.Usage{PromptTokens: 1040, CompletionTokens: 32}); got != want {
+		t.Errorf("TokenUsage() = %+v, want %+v", got, want)
+	}
+}
+
+func TestManagerSetMessageModel(t *testing.T) {
+	m := NewManager()
+	user := m.AddUserMessage("a cat")
+	reply := m.AddAssistantMessage("Here's a cat", "", nil)
+
+	m.SetMessageModel(reply, "llama3.2:3b")
+	m.SetMessageModel(999, "ignored")
+
+	if got := m.GetMessage(reply).Model; got != "llama3.2:3b" {
+		t.Errorf("reply model = %q, want %q", got, "llama3.2:3b")
+	}
+	if got := m.GetMessage(user).Model; got != "" {
+		t.Errorf("user message model = %q, want empty", got)
+	}
+}
+
+func TestBuildLLMContextWithin(t *testing.T) {
+	m := NewManager()
+	for i := 0; i < 10; i++ {
+		m.AddUserMessage(strings.Repeat("u", 400))
+		m.AddAssistantMessage(strings.Repeat("a", 400), "", nil)
+	}
+	m.UpdatePrompt("a cat")
+	full := m.BuildLLMContext("system", 20, 3.5, 42)
+
+	tests := []struct {
+		name        string
+		maxTokens   int
+		wantDropped int
+	}{
+		{"no limit", 0, 0},
+		{"everything fits", EstimateTokens(full...) + 100, 0},
+		{"room for two turns", 600, 16},
+		{"room for nothing", 50, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, dropped := m.BuildLLMContextWithin("system", 20, 3.5, 42, tt.maxTokens)
+			if dropped != tt.wantDropped {
+				t.Fatalf("dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+			if got[0].Role != RoleSystem || !strings.HasPrefix(got[1].Content, "[Current generation settings") {
+				t.Errorf("context does not start with system prompt and settings: %+v", got[:2])
+			}
+			if last := got[len(got)-1].Content; last != `[current prompt: "a cat"]` {
+				t.Errorf("last message = %q, want current prompt", last)
+			}
+			if dropped == 0 {
+				if len(got) != len(full) {
+					t.Errorf("len(context) = %d, want %d", len(got), len(full))
+				}
+				return
+			}
+			if !strings.Contains(got[2].Content, "earlier messages were left out") {
+				t.Errorf("message after settings = %q, want dropped note", got[2].Content)
+			}
+			if len(got) > 4 && got[3].Role != RoleUser {
+				t.Errorf("kept history starts with %s, want user", got[3].Role)
+			}
+			if tt.maxTokens > 100 && EstimateTokens(got...) > tt.maxTokens {
+				t.Errorf("EstimateTokens(context) = %d, exceeds %d", EstimateTokens(got...), tt.maxTokens)
+			}
+		})
+	}
+}
+
+func TestBuildLLMContextWithin_Summary(t *testing.T) {
+	m := NewManager()
+	for i := 0; i < 10; i++ {
+		m.AddUserMessage(strings.Repeat("u", 400))
+		m.AddAssistantMessage(strings.Repeat("a", 400), "", nil)
+	}
+	_, dropped := m.BuildLLMContextWithin("system", 0, 0, 0, 1000)
+	if dropped == 0 {
+		t.Fatal("dropped = 0, want some messages left out")
+	}
+
+	// A summary of other messages is not used, but reserves its room
+	m.SetSummary("Subject: cat", 1)
+	got, dropped := m.BuildLLMContextWithin("system", 0, 0, 0, 1000)
+	if strings.Contains(got[1].Content, "Subject: cat") {
+		t.Errorf("summary of message 1 used for %d dropped messages", dropped)
+	}
+
+	history := m.GetMessages()
+	m.SetSummary("Subject: cat\nAvoid: hats", history[dropped-1].ID)
+	got, again := m.BuildLLMContextWithin("system", 0, 0, 0, 1000)
+	if again != dropped {
+		t.Fatalf("dropped = %d after setting summary, want %d", again, dropped)
+	}
+	if !strings.Contains(got[1].Content, "Avoid: hats") {
+		t.Errorf("message after system prompt = %q, want summary", got[1].Content)
+	}
+	if EstimateTokens(got...) > 1000 {
+		t.Errorf("EstimateTokens(context) = %d, exceeds 1000", EstimateTokens(got...))
+	}
+}
+
+func TestManagerSummary(t *testing.T) {
+	m := NewManager()
+	first := m.AddUserMessage("a cat")
+	second := m.AddAssistantMessage("What kind of cat?", "", nil)
+	third := m.AddUserMessage("no hats")
+
+	m.SetSummary(strings.Repeat("x", MaxSummaryLength+10), second)
+	if summary, through := m.Summary(); len(summary) != MaxSummaryLength || through != second {
+		t.Errorf("Summary() = %d bytes through %d, want %d bytes through %d", len(summary), through, MaxSummaryLength, second)
+	}
+
+	tests := []struct {
+		name        string
+		change      func(m *Manager)
+		wantSummary bool
+	}{
+		{"deleting a later message keeps it", func(m *Manager) { _, _ = m.DeleteMessage(third) }, true},
+		{"deleting a covered message forgets it", func(m *Manager) { _, _ = m.DeleteMessage(first) }, false},
+		{"rewinding past it forgets it", func(m *Manager) { _ = m.RewindTo(first) }, false},
+		{"clearing forgets it", func(m *Manager) { m.Clear() }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			first = m.AddUserMessage("a cat")
+			second = m.AddAssistantMessage("What kind of cat?", "", nil)
+			third = m.AddUserMessage("no hats")
+			m.SetSummary("Subject: cat", second)
+
+			tt.change(m)
+			summary, _ := m.Summary()
+			if (summary != "") != tt.wantSummary {
+				t.Errorf("Summary() = %q, want summary kept %v", summary, tt.wantSummary)
+			}
+		})
+	}
+}
@@ -2,9 +2,13 @@ package conversation
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
+
+	"github.com/hurricanerix/weave/internal/ollama"
 )
 
 // persistence is the interface for session persistence operations.
@@ -15,6 +19,12 @@ type persistence interface {
 	Load(sessionID string) (*Conversation, error)
 }
 
+// sessionDeleter is implemented by persistence backends that can delete
+// everything they hold of a session.
+type sessionDeleter interface {
+	DeleteSession(sessionID string) error
+}
+
 const (
 	// SessionInactivityTimeout is how long a session can be inactive before cleanup.
 	SessionInactivityTimeout = 24 * time.Hour
@@ -26,19 +36,60 @@ const (
 	MaxSessions = 1000
 )
 
-// Session tracks a session, its conversation manager, generation settings,
+// Session tracks a session, its named chats, generation settings,
 // and last activity time.
 //
-// Session is thread-safe. All access to the manager and settings is protected
+// Every session has at least one chat. Manager returns the active chat's
+// conversation manager; see chat.go for creating and switching chats.
+//
+// Session is thread-safe. All access to the chats and settings is protected
 // by a mutex. This allows multiple HTTP requests for the same session to be
 // handled concurrently without data races.
 type Session struct {
+	id    string      // immutable
+	store persistence // immutable; nil when not persisted
+
 	mu           sync.Mutex // protects all fields below
-	manager      *Manager
+	chats        []*chat    // in creation order, never empty
+	activeChatID string
 	lastActivity time.Time
 	// settings stores the current generation settings for this session.
 	// nil means settings have not been set yet (use server defaults).
 	settings *GenerationSettings
+	// model is the chat model chosen for this session; "" means the
+	// server's configured model.
+	model string
+	// diffusionModel is the compute model ID images are generated with;
+	// 0 is SD 3.5, compute's default.
+	diffusionModel uint32
+	// loras are the LoRAs the agent chose for this session's images
+	loras []LoRA
+	// control guides the composition of this session's images with a
+	// ControlNet; nil means none
+	control *Control
+	// persona is the ID of the agent persona chosen for this session; ""
+	// means the server's default persona.
+	persona string
+
+	// sampling overrides the server's default sampling parameters for
+	// this session's chats
+	sampling ollama.Sampling
+
+	// llmSeed is the LLM seed for this session's chats; nil means the
+	// server's default
+	llmSeed *int64
+
+	// width and height are the image size chosen for this session; 0
+	// means the server's default
+	width  int
+	height int
+
+	// title names the session in listings; "" until one is set
+	title string
+
+	idMu sync.Mutex // protects nextMessageID
+	// nextMessageID is the next message ID across all chats in the session.
+	nextMessageID int
 }
 
 // SessionManager provides thread-safe management of conversation sessions.
@@ -49,14 +100,19 @@ type Session struct {
 // It uses a read-write mutex to allow concurrent reads while serializing
 // writes.
 //
-// Sessions are automatically cleaned up after 24 hours of inactivity.
-// A background goroutine runs every hour to remove stale sessions.
+// Sessions are removed from memory after SessionInactivityTimeout of
+// inactivity, or the timeout set with SetIdleTimeout. A background
+// goroutine runs every hour to remove stale sessions.
 // If the session count exceeds MaxSessions, the least recently used session
 // is evicted.
 type SessionManager struct {
-	mu            sync.RWMutex
-	sessions      map[string]*Session
-	store         persistence // Optional persistence backend
+	mu          sync.RWMutex
+	sessions    map[string]*Session
+	store       persistence // Optional persistence backend
+	idleTimeout time.Duration
+	// onExpire is called with the IDs of sessions removed for inactivity;
+	// nil if nothing else needs to be cleaned up
+	onExpire      func(sessionIDs []string)
 	cancelCleanup context.CancelFunc
 	cleanupDone   chan struct{}
 }
@@ -76,6 +132,7 @@ func NewSessionManagerWithPersistence(store persistence) *SessionManager {
 	sm := &SessionManager{
 		sessions:      make(map[string]*Session),
 		store:         store,
+		idleTimeout:   SessionInactivityTimeout,
 		cancelCleanup: cancel,
 		cleanupDone:   make(chan struct{}),
 	}
@@ -125,34 +182,33 @@ func (sm *SessionManager) GetSession(sessionID string) *Session {
 	}
 
 	// Try to load from persistence if available
-	var manager *Manager
+	conv := NewConversation()
 	if sm.store != nil {
-		conv, err := sm.store.Load(sessionID)
+		loaded, err := sm.store.Load(sessionID)
 		if err != nil {
 			log.Printf("Failed to load session %s from persistence: %v", sessionID, err)
 			// Fall through to create new session
-			manager = NewManager()
 		} else {
 			// Session recovered from disk
 			log.Printf("Recovered session %s from persistence", sessionID)
-			manager = NewManagerWithConversation(conv)
+			conv = loaded
 		}
-	} else {
-		// No persistence configured
-		manager = NewManager()
-	}
-
-	// Set up persistence callback
-	if sm.store != nil {
-		manager.SetOnChange(func() {
-			sm.saveSession(sessionID, manager)
-		})
 	}
 
 	session := &Session{
-		manager:      manager,
-		lastActivity: now,
+		id:            sessionID,
+		store:         sm.store,
+		activeChatID:  DefaultChatID,
+		lastActivity:  now,
+		nextMessageID: 1,
 	}
+	session.chats = []*chat{{
+		info:    ChatInfo{ID: DefaultChatID, Name: DefaultChatName, CreatedAt: now.UTC()},
+		manager: session.newChatManager(DefaultChatID, conv),
+	}}
+	session.loadChats()
+	session.loadSettings()
+
 	sm.sessions[sessionID] = session
 	return session
 }
@@ -166,7 +222,7 @@ func (sm *SessionManager) GetSession(sessionID string) *Session {
 //
 // Deprecated: Use GetSession() instead to access both Manager and settings.
 func (sm *SessionManager) GetOrCreate(sessionID string) *Manager {
-	return sm.GetSession(sessionID).manager
+	return sm.GetSession(sessionID).Manager()
 }
 
 // Get returns the Manager for the given session ID, or nil if it doesn't exist.
@@ -177,7 +233,7 @@ func (sm *SessionManager) Get(sessionID string) *Manager {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 	if info, ok := sm.sessions[sessionID]; ok {
-		return info.manager
+		return info.Manager()
 	}
 	return nil
 }
@@ -192,6 +248,24 @@ func (sm *SessionManager) Delete(sessionID string) {
 	delete(sm.sessions, sessionID)
 }
 
+// Erase removes the session with the given ID from memory and from
+// persistence, if the backend supports deleting sessions. A request
+// already holding the session can still save it again afterwards.
+//
+// This method is thread-safe.
+func (sm *SessionManager) Erase(sessionID string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	delete(sm.sessions, sessionID)
+
+	if deleter, ok := sm.store.(sessionDeleter); ok {
+		if err := deleter.DeleteSession(sessionID); err != nil {
+			return fmt.Errorf("failed to delete session: %w", err)
+		}
+	}
+	return nil
+}
+
 // Count returns the number of active sessions.
 //
 // This method is thread-safe.
@@ -201,6 +275,27 @@ func (sm *SessionManager) Count() int {
 	return len(sm.sessions)
 }
 
+// Flush persists every in-memory session. Errors for individual sessions
+// are collected so one failing session does not stop the others being saved.
+//
+// This method is thread-safe.
+func (sm *SessionManager) Flush() error {
+	sm.mu.RLock()
+	sessions := make([]*Session, 0, len(sm.sessions))
+	for _, session := range sm.sessions {
+		sessions = append(sessions, session)
+	}
+	sm.mu.RUnlock()
+
+	var errs []error
+	for _, session := range sessions {
+		if err := session.Flush(); err != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", session.id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // Shutdown stops the cleanup goroutine and waits for it to finish.
 func (sm *SessionManager) Shutdown() {
 	if sm.cancelCleanup != nil {
@@ -226,31 +321,59 @@ func (sm *SessionManager) cleanupLoop(ctx context.Context) {
 	}
 }
 
-// cleanupInactiveSessions removes sessions that have been inactive for too long.
-func (sm *SessionManager) cleanupInactiveSessions() {
+// SetIdleTimeout sets how long a session can be inactive before it is
+// removed from memory. Persisted sessions are loaded again on their next
+// request.
+//
+// This method is thread-safe.
+func (sm *SessionManager) SetIdleTimeout(timeout time.Duration) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	sm.idleTimeout = timeout
+}
 
-	now := time.Now()
-	removed := 0
+// SetExpireFunc sets the function called with the IDs of sessions removed
+// for inactivity, so resources kept outside the manager can be reclaimed.
+// It is called from the cleanup goroutine, without locks held. Sessions
+// evicted to stay under MaxSessions are not expired.
+//
+// This method is thread-safe.
+func (sm *SessionManager) SetExpireFunc(fn func(sessionIDs []string)) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.onExpire = fn
+}
 
+// cleanupInactiveSessions removes sessions that have been inactive for too
+// long and passes their IDs to the expire function.
+func (sm *SessionManager) cleanupInactiveSessions() {
+	sm.mu.Lock()
+	now := time.Now()
+	var expired []string
 	for sessionID, info := range sm.sessions {
-		if now.Sub(info.lastActivity) > SessionInactivityTimeout {
+		if now.Sub(info.lastActivity) > sm.idleTimeout {
 			delete(sm.sessions, sessionID)
-			removed++
+			expired = append(expired, sessionID)
 		}
 	}
+	remaining := len(sm.sessions)
+	onExpire := sm.onExpire
+	sm.mu.Unlock()
 
-	if removed > 0 {
-		log.Printf("Cleaned up %d inactive sessions (total: %d)", removed, len(sm.sessions))
+	if len(expired) == 0 {
+		return
+	}
+	log.Printf("Cleaned up %d inactive sessions (total: %d)", len(expired), remaining)
+	if onExpire != nil {
+		onExpire(expired)
 	}
 }
 
-// Manager returns the conversation manager for this session.
+// Manager returns the conversation manager for the session's active chat.
 // The returned Manager is thread-safe and can be used concurrently.
 func (s *Session) Manager() *Manager {
-	// No lock needed - manager itself is thread-safe and the pointer is immutable.
-	return s.manager
+	_, manager := s.ActiveChat()
+	return manager
 }
 
 // SetGenerationSettings updates the generation settings for this session.
@@ -258,6 +381,7 @@ func (s *Session) Manager() *Manager {
 func (s *Session) SetGenerationSettings(steps int, cfg float64, seed int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	defer s.saveSettingsLocked()
 
 	s.settings = &GenerationSettings{
 		Steps: steps,
@@ -279,6 +403,200 @@ func (s *Session) GetGenerationSettings() (steps int, cfg float64, seed int64, h
 	return s.settings.Steps, s.settings.CFG, s.settings.Seed, true
 }
 
+// SetModel sets the chat model for this session. An empty name reverts to
+// the server's configured model.
+func (s *Session) SetModel(model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.saveSettingsLocked()
+
+	s.model = model
+}
+
+// Model returns the chat model chosen for this session, or "" if the
+// server's configured model should be used.
+func (s *Session) Model() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.model
+}
+
+// SetDiffusionModel sets the compute model ID (protocol.ModelID*) this
+// session's images are generated with.
+func (s *Session) SetDiffusionModel(modelID uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.saveSettingsLocked()
+
+	s.diffusionModel = modelID
+}
+
+// DiffusionModel returns the compute model ID this session's images are
+// generated with.
+func (s *Session) DiffusionModel() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.diffusionModel
+}
+
+// LoRA is a LoRA applied to a session's images, by file name without
+// extension in the LoRA directory, at a weight.
+type LoRA struct {
+	Name   string  `json:"name"`
+	Weight float32 `json:"weight"`
+}
+
+// SetLoRAs replaces the LoRAs this session's images are generated with.
+// An empty list removes them all.
+func (s *Session) SetLoRAs(loras []LoRA) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.saveSettingsLocked()
+
+	s.loras = append([]LoRA(nil), loras...)
+}
+
+// LoRAs returns a copy of the LoRAs this session's images are generated
+// with.
+func (s *Session) LoRAs() []LoRA {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]LoRA(nil), s.loras...)
+}
+
+// Control is a control image guiding the composition of a session's
+// images: an upload from POST /upload, the kind of control map it is, and
+// how closely to follow it.
+type Control struct {
+	UploadID string  `json:"upload_id"`
+	Type     uint32  `json:"type"`
+	Strength float32 `json:"strength"`
+}
+
+// SetControl sets the control image of this session's images. nil removes
+// it.
+func (s *Session) SetControl(control *Control) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.saveSettingsLocked()
+
+	if control == nil {
+		s.control = nil
+		return
+	}
+	c := *control
+	s.control = &c
+}
+
+// Control returns the control image of this session's images, and false if
+// there is none.
+func (s *Session) Control() (Control, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.control == nil {
+		return Control{}, false
+	}
+	return *s.control, true
+}
+
+// SetPersona sets the agent persona for this session. An empty ID reverts
+// to the server's default persona.
+func (s *Session) SetPersona(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.saveSettingsLocked()
+
+	s.persona = id
+}
+
+// Persona returns the ID of the agent persona chosen for this session, or
+// "" if the server's default persona should be used.
+func (s *Session) Persona() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.persona
+}
+
+// SetSampling sets the sampling parameters overriding the server's defaults
+// for this session. Unset parameters fall back to the defaults.
+func (s *Session) SetSampling(sampling ollama.Sampling) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.saveSettingsLocked()
+
+	s.sampling = sampling
+}
+
+// Sampling returns the sampling parameters set for this session.
+func (s *Session) Sampling() ollama.Sampling {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sampling
+}
+
+// SetLLMSeed sets the LLM seed for this session's chats, so the agent
+// answers the same message the same way. 0 asks for a random seed each
+// time; nil reverts to the server's default.
+func (s *Session) SetLLMSeed(seed *int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.saveSettingsLocked()
+
+	s.llmSeed = seed
+}
+
+// LLMSeed returns the LLM seed set for this session, or nil if none was set.
+func (s *Session) LLMSeed() *int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.llmSeed
+}
+
+// SetResolution sets the size of the images generated for this session.
+// 0 reverts to the server's default.
+func (s *Session) SetResolution(width, height int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.saveSettingsLocked()
+
+	s.width = width
+	s.height = height
+}
+
+// Resolution returns the image size set for this session, or 0, 0 if none
+// was set.
+func (s *Session) Resolution() (width, height int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.width, s.height
+}
+
+// SetTitle sets the title the session is listed under. Whitespace is
+// collapsed and long titles are shortened to maxTitleLength.
+func (s *Session) SetTitle(title string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.saveSettingsLocked()
+
+	s.title = sessionTitle(title)
+}
+
+// Title returns the session's title, or "" if none was set.
+func (s *Session) Title() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.title
+}
+
 // evictLRU removes the least recently used session.
 // Must be called with sm.mu held for writing.
 func (sm *SessionManager) evictLRU() {
@@ -298,17 +616,3 @@ func (sm *SessionManager) evictLRU() {
 		log.Printf("Evicted LRU session %s (was inactive for %v)", oldestID, time.Since(oldestTime))
 	}
 }
-
-// saveSession saves a session's conversation to persistence.
-// This is called by the onChange callback when conversation state changes.
-// Errors are logged but not returned - persistence failures don't block the request.
-func (sm *SessionManager) saveSession(sessionID string, manager *Manager) {
-	if sm.store == nil {
-		return
-	}
-
-	conv := manager.GetConversation()
-	if err := sm.store.Save(sessionID, conv); err != nil {
-		log.Printf("Failed to save session %s: %v", sessionID, err)
-	}
-}
@@ -143,3 +143,35 @@ func TestSessionManager_Shutdown(t *testing.T) {
 		t.Fatal("Shutdown timed out")
 	}
 }
+
+func TestSessionManager_IdleTimeoutAndExpireFunc(t *testing.T) {
+	sm := NewSessionManager()
+	defer sm.Shutdown()
+
+	var expired []string
+	sm.SetIdleTimeout(time.Minute)
+	sm.SetExpireFunc(func(sessionIDs []string) {
+		expired = append(expired, sessionIDs...)
+	})
+
+	sm.GetOrCreate("idle")
+	sm.GetOrCreate("active")
+	sm.mu.Lock()
+	sm.sessions["idle"].lastActivity = time.Now().Add(-2 * time.Minute)
+	sm.mu.Unlock()
+
+	sm.cleanupInactiveSessions()
+
+	if sm.Get("idle") != nil || sm.Get("active") == nil {
+		t.Error("expected only the session idle for longer than the timeout to be cleaned up")
+	}
+	if len(expired) != 1 || expired[0] != "idle" {
+		t.Errorf("expire func called with %v, want [idle]", expired)
+	}
+
+	// Nothing expired, so the func is not called again
+	sm.cleanupInactiveSessions()
+	if len(expired) != 1 {
+		t.Errorf("expire func called with %v after a cleanup that removed nothing", expired)
+	}
+}
@@ -155,6 +155,74 @@ func TestSessionRecovery_PersistenceOnChange(t *testing.T) {
 	}
 }
 
+// mockSettingsPersistence adds settings persistence to mockPersistence.
+type mockSettingsPersistence struct {
+	*mockPersistence
+	settings map[string]*SessionSettings
+}
+
+func (m *mockSettingsPersistence) SaveSettings(sessionID string, settings *SessionSettings) error {
+	m.settings[sessionID] = settings
+	return nil
+}
+
+func (m *mockSettingsPersistence) LoadSettings(sessionID string) (*SessionSettings, error) {
+	return m.settings[sessionID], nil
+}
+
+func TestSessionRecovery_Settings(t *testing.T) {
+	store := &mockSettingsPersistence{mockPersistence: newMockPersistence(), settings: make(map[string]*SessionSettings)}
+	sessionID := "test-settings"
+
+	sm := NewSessionManagerWithPersistence(store)
+	defer sm.Shutdown()
+	session := sm.GetSession(sessionID)
+	seed := int64(5)
+	session.SetGenerationSettings(28, 4.5, 99)
+	session.SetModel("llama3.2")
+	session.SetDiffusionModel(1)
+	session.SetLoRAs([]LoRA{{Name: "watercolor", Weight: 0.8}})
+	session.SetControl(&Control{UploadID: "abc", Type: 2, Strength: 0.5})
+	session.SetPersona("critic")
+	session.SetLLMSeed(&seed)
+	session.SetResolution(768, 512)
+	session.SetTitle("Lighthouse at dusk")
+
+	// A restarted server restores them when the session returns
+	sm2 := NewSessionManagerWithPersistence(store)
+	defer sm2.Shutdown()
+	session2 := sm2.GetSession(sessionID)
+
+	if steps, cfg, seed, ok := session2.GetGenerationSettings(); !ok || steps != 28 || cfg != 4.5 || seed != 99 {
+		t.Errorf("GetGenerationSettings() = %d, %v, %d, %v, want 28, 4.5, 99, true", steps, cfg, seed, ok)
+	}
+	if session2.Model() != "llama3.2" || session2.DiffusionModel() != 1 || session2.Persona() != "critic" {
+		t.Errorf("model, diffusion model, persona = %q, %d, %q, want llama3.2, 1, critic",
+			session2.Model(), session2.DiffusionModel(), session2.Persona())
+	}
+	if loras := session2.LoRAs(); len(loras) != 1 || loras[0].Name != "watercolor" {
+		t.Errorf("LoRAs() = %+v, want watercolor", loras)
+	}
+	if control, ok := session2.Control(); !ok || control.UploadID != "abc" {
+		t.Errorf("Control() = %+v, %v, want upload abc", control, ok)
+	}
+	if seed := session2.LLMSeed(); seed == nil || *seed != 5 {
+		t.Errorf("LLMSeed() = %v, want 5", seed)
+	}
+	if width, height := session2.Resolution(); width != 768 || height != 512 {
+		t.Errorf("Resolution() = %d, %d, want 768, 512", width, height)
+	}
+	if title := session2.Title(); title != "Lighthouse at dusk" {
+		t.Errorf("Title() = %q, want %q", title, "Lighthouse at dusk")
+	}
+
+	// Changing a restored setting keeps the others
+	session2.SetPersona("")
+	if saved := store.settings[sessionID]; saved.Persona != "" || saved.Model != "llama3.2" {
+		t.Errorf("saved settings = %+v, want persona cleared and model kept", saved)
+	}
+}
+
 func TestSessionManager_WithoutPersistence(t *testing.T) {
 	// Create session manager without persistence (nil store)
 	sm := NewSessionManagerWithPersistence(nil)
@@ -1,8 +1,12 @@
 package conversation
 
 import (
+	"errors"
+	"strings"
 	"sync"
 	"testing"
+
+	"github.com/hurricanerix/weave/internal/ollama"
 )
 
 func TestNewSessionManager(t *testing.T) {
@@ -108,6 +112,43 @@ func TestDeleteNonExistentSession(t *testing.T) {
 	}
 }
 
+// deletingPersistence is a mockPersistence that can delete sessions.
+type deletingPersistence struct {
+	*mockPersistence
+}
+
+func (d deletingPersistence) DeleteSession(sessionID string) error {
+	delete(d.data, sessionID)
+	return nil
+}
+
+func TestEraseSession(t *testing.T) {
+	store := deletingPersistence{newMockPersistence()}
+	sm := NewSessionManagerWithPersistence(store)
+	defer sm.Shutdown()
+
+	sm.GetSession("session-1").Manager().AddUserMessage("a secret")
+	sm.GetSession("session-2").Manager().AddUserMessage("hello")
+
+	if err := sm.Erase("session-1"); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	if sm.Get("session-1") != nil {
+		t.Error("Erased session should return nil on Get")
+	}
+	if _, ok := store.data["session-1"]; ok {
+		t.Error("Erased session is still persisted")
+	}
+	if _, ok := store.data["session-2"]; !ok {
+		t.Error("Other session should still be persisted")
+	}
+
+	// Loading the erased session again starts empty
+	if n := len(sm.GetSession("session-1").Manager().GetMessages()); n != 0 {
+		t.Errorf("erased session has %d messages after reloading, want 0", n)
+	}
+}
+
 func TestSessionIsolation(t *testing.T) {
 	sm := NewSessionManager()
 
@@ -409,3 +450,257 @@ func TestGenerationSettings_ZeroValues(t *testing.T) {
 		t.Errorf("Zero values should be preserved: got (%d, %f, %d)", steps, cfg, seed)
 	}
 }
+
+func TestSessionModel(t *testing.T) {
+	sm := NewSessionManager()
+	session1 := sm.GetSession("session-1")
+	session2 := sm.GetSession("session-2")
+
+	if got := session1.Model(); got != "" {
+		t.Errorf("Model() before SetModel = %q, want empty", got)
+	}
+
+	session1.SetModel("qwen2.5:7b")
+	if got := session1.Model(); got != "qwen2.5:7b" {
+		t.Errorf("Model() = %q, want %q", got, "qwen2.5:7b")
+	}
+	if got := session2.Model(); got != "" {
+		t.Errorf("other session Model() = %q, want empty", got)
+	}
+
+	session1.SetModel("")
+	if got := session1.Model(); got != "" {
+		t.Errorf("Model() after reset = %q, want empty", got)
+	}
+}
+
+func TestSessionDiffusionModel(t *testing.T) {
+	sm := NewSessionManager()
+	session1 := sm.GetSession("session-1")
+	session2 := sm.GetSession("session-2")
+
+	if got := session1.DiffusionModel(); got != 0 {
+		t.Errorf("DiffusionModel() before SetDiffusionModel = %d, want 0", got)
+	}
+
+	session1.SetDiffusionModel(2)
+	if got := session1.DiffusionModel(); got != 2 {
+		t.Errorf("DiffusionModel() = %d, want 2", got)
+	}
+	if got := session2.DiffusionModel(); got != 0 {
+		t.Errorf("other session DiffusionModel() = %d, want 0", got)
+	}
+}
+
+func TestSessionLoRAs(t *testing.T) {
+	sm := NewSessionManager()
+	session := sm.GetSession("session-1")
+
+	if got := session.LoRAs(); len(got) != 0 {
+		t.Errorf("LoRAs() before SetLoRAs = %v, want none", got)
+	}
+
+	loras := []LoRA{{Name: "film-grain", Weight: 0.8}}
+	session.SetLoRAs(loras)
+	loras[0].Weight = 2 // The session keeps its own copy
+
+	got := session.LoRAs()
+	if len(got) != 1 || got[0] != (LoRA{Name: "film-grain", Weight: 0.8}) {
+		t.Fatalf("LoRAs() = %v, want [{film-grain 0.8}]", got)
+	}
+	got[0].Name = "changed"
+	if session.LoRAs()[0].Name != "film-grain" {
+		t.Error("LoRAs() returned the session's slice")
+	}
+
+	session.SetLoRAs(nil)
+	if got := session.LoRAs(); len(got) != 0 {
+		t.Errorf("LoRAs() after SetLoRAs(nil) = %v, want none", got)
+	}
+}
+
+func TestSessionControl(t *testing.T) {
+	sm := NewSessionManager()
+	session := sm.GetSession("session-1")
+
+	if _, ok := session.Control(); ok {
+		t.Error("Control() before SetControl reports a control image")
+	}
+
+	control := &Control{UploadID: "abc", Type: 1, Strength: 0.5}
+	session.SetControl(control)
+	control.Strength = 2 // The session keeps its own copy
+
+	got, ok := session.Control()
+	if !ok || got != (Control{UploadID: "abc", Type: 1, Strength: 0.5}) {
+		t.Fatalf("Control() = %+v, %v, want {abc 1 0.5}", got, ok)
+	}
+
+	session.SetControl(nil)
+	if _, ok := session.Control(); ok {
+		t.Error("Control() after SetControl(nil) reports a control image")
+	}
+}
+
+func TestSessionPersona(t *testing.T) {
+	sm := NewSessionManager()
+	session1 := sm.GetSession("session-1")
+	session2 := sm.GetSession("session-2")
+
+	if got := session1.Persona(); got != "" {
+		t.Errorf("Persona() before SetPersona = %q, want empty", got)
+	}
+
+	session1.SetPersona("pixel-art")
+	if got := session1.Persona(); got != "pixel-art" {
+		t.Errorf("Persona() = %q, want %q", got, "pixel-art")
+	}
+	if got := session2.Persona(); got != "" {
+		t.Errorf("other session Persona() = %q, want empty", got)
+	}
+
+	session1.SetPersona("")
+	if got := session1.Persona(); got != "" {
+		t.Errorf("Persona() after reset = %q, want empty", got)
+	}
+}
+
+func TestSessionLLMSeed(t *testing.T) {
+	sm := NewSessionManager()
+	session1 := sm.GetSession("session-1")
+	session2 := sm.GetSession("session-2")
+
+	if got := session1.LLMSeed(); got != nil {
+		t.Errorf("LLMSeed() before SetLLMSeed = %d, want nil", *got)
+	}
+
+	seed := int64(123)
+	session1.SetLLMSeed(&seed)
+	if got := session1.LLMSeed(); got == nil || *got != 123 {
+		t.Errorf("LLMSeed() = %v, want 123", got)
+	}
+	if got := session2.LLMSeed(); got != nil {
+		t.Errorf("other session LLMSeed() = %d, want nil", *got)
+	}
+
+	session1.SetLLMSeed(nil)
+	if got := session1.LLMSeed(); got != nil {
+		t.Errorf("LLMSeed() after reset = %d, want nil", *got)
+	}
+}
+
+func TestSessionResolution(t *testing.T) {
+	sm := NewSessionManager()
+	session1 := sm.GetSession("session-1")
+	session2 := sm.GetSession("session-2")
+
+	if w, h := session1.Resolution(); w != 0 || h != 0 {
+		t.Errorf("Resolution() before SetResolution = %dx%d, want 0x0", w, h)
+	}
+
+	session1.SetResolution(512, 768)
+	if w, h := session1.Resolution(); w != 512 || h != 768 {
+		t.Errorf("Resolution() = %dx%d, want 512x768", w, h)
+	}
+	if w, h := session2.Resolution(); w != 0 || h != 0 {
+		t.Errorf("other session Resolution() = %dx%d, want 0x0", w, h)
+	}
+
+	session1.SetResolution(0, 0)
+	if w, h := session1.Resolution(); w != 0 || h != 0 {
+		t.Errorf("Resolution() after reset = %dx%d, want 0x0", w, h)
+	}
+}
+
+func TestSessionTitle(t *testing.T) {
+	sm := NewSessionManager()
+	defer sm.Shutdown()
+	session := sm.GetSession("session-1")
+
+	if title := session.Title(); title != "" {
+		t.Errorf("Title() before SetTitle = %q, want empty", title)
+	}
+
+	session.SetTitle("  Foggy\n harbor ")
+	if title := session.Title(); title != "Foggy harbor" {
+		t.Errorf("Title() = %q, want %q", title, "Foggy harbor")
+	}
+
+	// The title replaces the first user message in listings
+	session.Manager().AddUserMessage("draw a harbor in fog")
+	if summary, _ := sm.SessionSummary("session-1"); summary.Title != "Foggy harbor" {
+		t.Errorf("SessionSummary().Title = %q, want %q", summary.Title, "Foggy harbor")
+	}
+
+	session.SetTitle(strings.Repeat("x", 100))
+	if n := len([]rune(session.Title())); n != maxTitleLength {
+		t.Errorf("Title() of a long title has %d runes, want %d", n, maxTitleLength)
+	}
+}
+
+func TestSessionSampling(t *testing.T) {
+	sm := NewSessionManager()
+	session1 := sm.GetSession("session-1")
+	session2 := sm.GetSession("session-2")
+
+	if !session1.Sampling().IsZero() {
+		t.Errorf("Sampling() before SetSampling = %+v, want unset", session1.Sampling())
+	}
+
+	temperature := 0.2
+	session1.SetSampling(ollama.Sampling{Temperature: &temperature})
+	if got := session1.Sampling(); got.Temperature == nil || *got.Temperature != temperature {
+		t.Errorf("Sampling() = %+v, want temperature %v", got, temperature)
+	}
+	if !session2.Sampling().IsZero() {
+		t.Errorf("other session Sampling() = %+v, want unset", session2.Sampling())
+	}
+}
+
+// failingPersistence fails every Save while fail is set.
+type failingPersistence struct {
+	*mockPersistence
+	fail bool
+}
+
+func (f *failingPersistence) Save(sessionID string, conv *Conversation) error {
+	if f.fail {
+		return errors.New("disk full")
+	}
+	return f.mockPersistence.Save(sessionID, conv)
+}
+
+func TestSessionManagerFlush(t *testing.T) {
+	store := &failingPersistence{mockPersistence: newMockPersistence(), fail: true}
+	sm := NewSessionManagerWithPersistence(store)
+	defer sm.Shutdown()
+
+	// The save on change fails and is only logged
+	sm.GetSession("session-1").Manager().AddUserMessage("I want a cat")
+	if _, ok := store.data["session-1"]; ok {
+		t.Fatal("session saved while persistence was failing")
+	}
+
+	if err := sm.Flush(); err == nil {
+		t.Error("Flush() error = nil while persistence is failing, want error")
+	}
+
+	store.fail = false
+	if err := sm.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	saved, ok := store.data["session-1"]
+	if !ok || len(saved.GetMessages()) != 1 {
+		t.Errorf("flushed session = %v, want the unsaved message persisted", saved)
+	}
+}
+
+func TestSessionManagerFlush_NoPersistence(t *testing.T) {
+	sm := NewSessionManager()
+	defer sm.Shutdown()
+
+	sm.GetSession("session-1").Manager().AddUserMessage("I want a cat")
+	if err := sm.Flush(); err != nil {
+		t.Errorf("Flush() error = %v, want nil without persistence", err)
+	}
+}
@@ -0,0 +1,109 @@
+package conversation
+
+import (
+	"log"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// settingsPersistence is implemented by stores that can persist session
+// settings. With stores that only implement persistence, settings live in
+// memory only and reset to the server's defaults on restart.
+type settingsPersistence interface {
+	SaveSettings(sessionID string, settings *SessionSettings) error
+	LoadSettings(sessionID string) (*SessionSettings, error)
+}
+
+// SessionSettings is the persisted form of a session's settings: what the
+// user and agent chose besides the chats. Zero values mean the server's
+// defaults, as for the Session fields they come from.
+type SessionSettings struct {
+	Generation     *GenerationSettings `json:"generation,omitempty"`
+	Model          string              `json:"model,omitempty"`
+	DiffusionModel uint32              `json:"diffusion_model,omitempty"`
+	LoRAs          []LoRA              `json:"loras,omitempty"`
+	Control        *Control            `json:"control,omitempty"`
+	Persona        string              `json:"persona,omitempty"`
+	Sampling       ollama.Sampling     `json:"sampling,omitzero"`
+	LLMSeed        *int64              `json:"llm_seed,omitempty"`
+	Width          int                 `json:"width,omitempty"`
+	Height         int                 `json:"height,omitempty"`
+	Title          string              `json:"title,omitempty"`
+}
+
+// settingsLocked returns a copy of the session's settings.
+// Must be called with s.mu held.
+func (s *Session) settingsLocked() *SessionSettings {
+	settings := &SessionSettings{
+		Model:          s.model,
+		DiffusionModel: s.diffusionModel,
+		LoRAs:          append([]LoRA(nil), s.loras...),
+		Persona:        s.persona,
+		Sampling:       s.sampling,
+		Width:          s.width,
+		Height:         s.height,
+		Title:          s.title,
+	}
+	if s.settings != nil {
+		generation := *s.settings
+		settings.Generation = &generation
+	}
+	if s.control != nil {
+		control := *s.control
+		settings.Control = &control
+	}
+	if s.llmSeed != nil {
+		seed := *s.llmSeed
+		settings.LLMSeed = &seed
+	}
+	return settings
+}
+
+// saveSettingsLocked persists the session's settings.
+// Errors are logged but not returned - persistence failures don't block the request.
+// Must be called with s.mu held.
+func (s *Session) saveSettingsLocked() {
+	if err := s.writeSettingsLocked(); err != nil {
+		log.Printf("Failed to save settings for session %s: %v", s.id, err)
+	}
+}
+
+// writeSettingsLocked persists the session's settings, if the store can.
+// Must be called with s.mu held.
+func (s *Session) writeSettingsLocked() error {
+	ss, ok := s.store.(settingsPersistence)
+	if !ok {
+		return nil
+	}
+	return ss.SaveSettings(s.id, s.settingsLocked())
+}
+
+// loadSettings restores the session's settings from persistence.
+// Must be called before the session is shared.
+func (s *Session) loadSettings() {
+	ss, ok := s.store.(settingsPersistence)
+	if !ok {
+		return
+	}
+
+	settings, err := ss.LoadSettings(s.id)
+	if err != nil {
+		log.Printf("Failed to load settings for session %s: %v", s.id, err)
+		return
+	}
+	if settings == nil {
+		return
+	}
+
+	s.settings = settings.Generation
+	s.model = settings.Model
+	s.diffusionModel = settings.DiffusionModel
+	s.loras = settings.LoRAs
+	s.control = settings.Control
+	s.persona = settings.Persona
+	s.sampling = settings.Sampling
+	s.llmSeed = settings.LLMSeed
+	s.width = settings.Width
+	s.height = settings.Height
+	s.title = settings.Title
+}
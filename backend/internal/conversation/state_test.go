@@ -218,6 +218,34 @@ func TestGetMessageByIDNotFound(t *testing.T) {
 	}
 }
 
+// TestGetMessages tests that GetMessages returns an isolated copy of history.
+func TestGetMessages(t *testing.T) {
+	m := NewManager()
+
+	m.AddUserMessage("draw a cat")
+	id := m.AddAssistantMessage("Here's a cat", "a cat", &ollama.LLMMetadata{Prompt: "a cat"})
+
+	messages := m.GetMessages()
+	if len(messages) != 2 {
+		t.Fatalf("GetMessages() length = %d, want 2", len(messages))
+	}
+	if messages[1].ID != id || messages[1].Snapshot == nil {
+		t.Fatalf("GetMessages()[1] = %+v, want assistant message with snapshot", messages[1])
+	}
+
+	// Mutating the copy must not affect the manager
+	messages[1].Content = "changed"
+	messages[1].Snapshot.Prompt = "changed"
+
+	msg := m.GetMessage(id)
+	if msg.Content != "Here's a cat" {
+		t.Errorf("Content = %q, want %q", msg.Content, "Here's a cat")
+	}
+	if msg.Snapshot.Prompt != "a cat" {
+		t.Errorf("Snapshot.Prompt = %q, want %q", msg.Snapshot.Prompt, "a cat")
+	}
+}
+
 // TestUpdateMessagePreview tests updating the preview status and URL.
 func TestUpdateMessagePreview(t *testing.T) {
 	m := NewManager()
@@ -262,6 +290,45 @@ func TestUpdateMessagePreview(t *testing.T) {
 	}
 }
 
+// TestSetMessageImageSeed tests recording the seed a preview was generated with.
+func TestSetMessageImageSeed(t *testing.T) {
+	m := NewManager()
+
+	id := m.AddAssistantMessage("Here's a cat", "a cat", &ollama.LLMMetadata{Prompt: "a cat"})
+	m.SetMessageImageSeed(id, 1234567890)
+
+	msg := m.GetMessage(id)
+	if msg.Snapshot.ImageSeed != 1234567890 {
+		t.Errorf("ImageSeed = %d, want 1234567890", msg.Snapshot.ImageSeed)
+	}
+
+	// Messages without a snapshot are left alone
+	plain := m.AddAssistantMessage("No snapshot", "", nil)
+	m.SetMessageImageSeed(plain, 42)
+	if msg := m.GetMessage(plain); msg.Snapshot != nil {
+		t.Error("Expected no snapshot, got snapshot")
+	}
+}
+
+// TestSetMessageGeneration tests recording how a preview was generated.
+func TestSetMessageGeneration(t *testing.T) {
+	m := NewManager()
+
+	id := m.AddAssistantMessage("Here's a cat", "a cat", &ollama.LLMMetadata{Prompt: "a cat"})
+	generation := &GenerationMetadata{ModelHash: "a1b2c3d4", Sampler: "euler", DiffusionMS: 9000}
+	m.SetMessageGeneration(id, generation)
+
+	if msg := m.GetMessage(id); msg.Snapshot.Generation == nil || *msg.Snapshot.Generation != *generation {
+		t.Errorf("Generation = %+v, want %+v", msg.Snapshot.Generation, generation)
+	}
+
+	// A regeneration compute says nothing about clears it
+	m.SetMessageGeneration(id, nil)
+	if msg := m.GetMessage(id); msg.Snapshot.Generation != nil {
+		t.Errorf("Generation = %+v after clearing, want nil", msg.Snapshot.Generation)
+	}
+}
+
 // TestUpdateMessagePreviewNoSnapshot tests that UpdateMessagePreview does nothing for messages without snapshots.
 func TestUpdateMessagePreviewNoSnapshot(t *testing.T) {
 	m := NewManager()
@@ -288,6 +355,38 @@ func TestUpdateMessagePreviewNotFound(t *testing.T) {
 	m.UpdateMessagePreview(999, PreviewStatusComplete, "/image.png")
 }
 
+// TestAddMessageAlternate tests that alternates are numbered from 1 and capped.
+func TestAddMessageAlternate(t *testing.T) {
+	m := NewManager()
+
+	userID := m.AddUserMessage("draw a cat")
+	id := m.AddAssistantMessage("Here's a cat", "a cat", &ollama.LLMMetadata{Prompt: "a cat"})
+
+	if got := m.AddMessageAlternate(userID, ImageAlternate{URL: "/x.png"}); got != 0 {
+		t.Errorf("AddMessageAlternate() on message without snapshot = %d, want 0", got)
+	}
+	if got := m.AddMessageAlternate(999, ImageAlternate{URL: "/x.png"}); got != 0 {
+		t.Errorf("AddMessageAlternate() on unknown message = %d, want 0", got)
+	}
+
+	for want := 1; want <= MaxAlternatesPerMessage; want++ {
+		if got := m.AddMessageAlternate(id, ImageAlternate{URL: "/alt.png", Seed: int64(want)}); got != want {
+			t.Fatalf("AddMessageAlternate() = %d, want %d", got, want)
+		}
+	}
+	if got := m.AddMessageAlternate(id, ImageAlternate{URL: "/alt.png"}); got != 0 {
+		t.Errorf("AddMessageAlternate() past limit = %d, want 0", got)
+	}
+
+	msg := m.GetMessage(id)
+	if len(msg.Alternates) != MaxAlternatesPerMessage || msg.Alternates[0].Seed != 1 {
+		t.Errorf("Alternates = %+v, want %d in order", msg.Alternates, MaxAlternatesPerMessage)
+	}
+	if msg.Snapshot.PreviewURL != "" {
+		t.Errorf("PreviewURL = %q, want primary preview untouched", msg.Snapshot.PreviewURL)
+	}
+}
+
 // TestClearResetsMessageID tests that Clear resets the message ID counter.
 func TestClearResetsMessageID(t *testing.T) {
 	m := NewManager()
@@ -0,0 +1,226 @@
+package conversation
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sessionLister is implemented by persistence backends that can list the
+// sessions they hold.
+type sessionLister interface {
+	ListSessions() ([]string, error)
+}
+
+// maxTitleLength is the longest session title, in runes, before it is cut
+// off with an ellipsis.
+const maxTitleLength = 60
+
+// SessionSummary describes a session for listing, without its messages.
+type SessionSummary struct {
+	ID string
+	// Title is the title set with Session.SetTitle, or if there is none,
+	// the session's first user message in chat creation order, shortened
+	// to maxTitleLength
+	Title string
+	// MessageCount is the number of messages in all of the session's chats
+	MessageCount int
+	// LastActivity is the last request to the session, or for a session
+	// that isn't in memory, when its newest message was added. Zero if
+	// neither is known.
+	LastActivity time.Time
+}
+
+// Sessions returns summaries of every known session, in memory or
+// persisted, most recently active first. Sessions without messages, such
+// as those of browsers that only opened the page, are left out. Persisted
+// sessions are read without being loaded into memory, so listing doesn't
+// evict anyone's session.
+//
+// This method is thread-safe.
+func (sm *SessionManager) Sessions() ([]SessionSummary, error) {
+	sm.mu.RLock()
+	sessions := make([]*Session, 0, len(sm.sessions))
+	lastActivity := make([]time.Time, 0, len(sm.sessions))
+	for _, session := range sm.sessions {
+		sessions = append(sessions, session)
+		lastActivity = append(lastActivity, session.lastActivity)
+	}
+	sm.mu.RUnlock()
+
+	summaries := make([]SessionSummary, 0, len(sessions))
+	seen := make(map[string]bool, len(sessions))
+	for i, session := range sessions {
+		seen[session.id] = true
+		if summary := session.summary(lastActivity[i]); summary.MessageCount > 0 {
+			summaries = append(summaries, summary)
+		}
+	}
+
+	if lister, ok := sm.store.(sessionLister); ok {
+		ids, err := lister.ListSessions()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			summary, err := sm.storedSummary(id)
+			if err != nil {
+				log.Printf("Failed to read session %s for listing: %v", id, err)
+				continue
+			}
+			if summary.MessageCount > 0 {
+				summaries = append(summaries, summary)
+			}
+		}
+	}
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if !summaries[i].LastActivity.Equal(summaries[j].LastActivity) {
+			return summaries[i].LastActivity.After(summaries[j].LastActivity)
+		}
+		return summaries[i].ID < summaries[j].ID
+	})
+	return summaries, nil
+}
+
+// SessionSummary returns the summary of a session in memory or persisted.
+// Returns false if the session is not known or has no messages, as Sessions
+// would leave it out.
+//
+// This method is thread-safe.
+func (sm *SessionManager) SessionSummary(sessionID string) (SessionSummary, bool) {
+	sm.mu.RLock()
+	session, ok := sm.sessions[sessionID]
+	var lastActivity time.Time
+	if ok {
+		lastActivity = session.lastActivity
+	}
+	sm.mu.RUnlock()
+	if ok {
+		summary := session.summary(lastActivity)
+		return summary, summary.MessageCount > 0
+	}
+
+	lister, ok := sm.store.(sessionLister)
+	if !ok {
+		return SessionSummary{}, false
+	}
+	ids, err := lister.ListSessions()
+	if err != nil {
+		log.Printf("Failed to list sessions: %v", err)
+		return SessionSummary{}, false
+	}
+	for _, id := range ids {
+		if id != sessionID {
+			continue
+		}
+		summary, err := sm.storedSummary(id)
+		if err != nil {
+			log.Printf("Failed to read session %s: %v", id, err)
+			return SessionSummary{}, false
+		}
+		return summary, summary.MessageCount > 0
+	}
+	return SessionSummary{}, false
+}
+
+// summary describes an in-memory session last used at lastActivity.
+func (s *Session) summary(lastActivity time.Time) SessionSummary {
+	s.mu.Lock()
+	managers := make([]*Manager, len(s.chats))
+	for i, c := range s.chats {
+		managers[i] = c.manager
+	}
+	title := s.title
+	s.mu.Unlock()
+
+	chats := make([][]ConversationMessage, len(managers))
+	for i, manager := range managers {
+		chats[i] = manager.GetMessages()
+	}
+	summary := summarize(s.id, chats)
+	summary.LastActivity = lastActivity
+	if title != "" {
+		summary.Title = title
+	}
+	return summary
+}
+
+// storedSummary describes a persisted session that isn't in memory.
+func (sm *SessionManager) storedSummary(sessionID string) (SessionSummary, error) {
+	conv, err := sm.store.Load(sessionID)
+	if err != nil {
+		return SessionSummary{}, err
+	}
+	chats := [][]ConversationMessage{conv.GetMessages()}
+
+	if cs, ok := sm.store.(chatPersistence); ok {
+		index, err := cs.LoadChatIndex(sessionID)
+		if err != nil {
+			return SessionSummary{}, err
+		}
+		if index != nil {
+			chats = chats[:0]
+			for _, info := range index.Chats {
+				if info.ID == DefaultChatID {
+					chats = append(chats, conv.GetMessages())
+					continue
+				}
+				chat, err := cs.LoadChat(sessionID, info.ID)
+				if err != nil {
+					return SessionSummary{}, err
+				}
+				chats = append(chats, chat.GetMessages())
+			}
+		}
+	}
+
+	summary := summarize(sessionID, chats)
+	for _, messages := range chats {
+		for _, msg := range messages {
+			if msg.CreatedAt.After(summary.LastActivity) {
+				summary.LastActivity = msg.CreatedAt
+			}
+		}
+	}
+
+	if ss, ok := sm.store.(settingsPersistence); ok {
+		settings, err := ss.LoadSettings(sessionID)
+		if err != nil {
+			return SessionSummary{}, err
+		}
+		if settings != nil && settings.Title != "" {
+			summary.Title = settings.Title
+		}
+	}
+	return summary, nil
+}
+
+// summarize counts the messages of a session's chats, in creation order,
+// and titles it after the first user message.
+func summarize(sessionID string, chats [][]ConversationMessage) SessionSummary {
+	summary := SessionSummary{ID: sessionID}
+	for _, messages := range chats {
+		summary.MessageCount += len(messages)
+		for _, msg := range messages {
+			if summary.Title == "" && msg.Role == RoleUser {
+				summary.Title = sessionTitle(msg.Content)
+			}
+		}
+	}
+	return summary
+}
+
+// sessionTitle shortens a message to a one-line title.
+func sessionTitle(content string) string {
+	title := strings.Join(strings.Fields(content), " ")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = strings.TrimSpace(string(runes[:maxTitleLength-1])) + "…"
+	}
+	return title
+}
@@ -0,0 +1,102 @@
+package conversation
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listingPersistence is a mockPersistence that can list its sessions.
+type listingPersistence struct {
+	*mockPersistence
+}
+
+func (l listingPersistence) ListSessions() ([]string, error) {
+	ids := make([]string, 0, len(l.data))
+	for id := range l.data {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func TestSessionManager_Sessions(t *testing.T) {
+	store := listingPersistence{newMockPersistence()}
+	sm := NewSessionManagerWithPersistence(store)
+	defer sm.Shutdown()
+
+	// A persisted session that is not in memory
+	stored := NewConversation()
+	stored.SetMessages([]ConversationMessage{
+		{ID: 1, Role: RoleUser, Content: "  a   red\nbarn ", CreatedAt: time.Unix(100, 0)},
+		{ID: 2, Role: RoleAssistant, Content: "Here it is", CreatedAt: time.Unix(200, 0)},
+	})
+	store.Save("stored", stored)
+	// A persisted session without messages
+	store.Save("empty-stored", NewConversation())
+
+	// An in-memory session, the most recently active
+	manager := sm.GetSession("active").Manager()
+	manager.AddAssistantMessage("Hello", "", nil)
+	manager.AddUserMessage(strings.Repeat("x", 100))
+	// An in-memory session without messages
+	sm.GetSession("empty")
+
+	summaries, err := sm.Sessions()
+	if err != nil {
+		t.Fatalf("Sessions() error = %v", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("Sessions() = %+v, want 2 sessions", summaries)
+	}
+
+	active := summaries[0]
+	if active.ID != "active" || active.MessageCount != 2 || active.LastActivity.IsZero() {
+		t.Errorf("Sessions()[0] = %+v, want the in-memory session with 2 messages", active)
+	}
+	if n := len([]rune(active.Title)); n != maxTitleLength || !strings.HasSuffix(active.Title, "…") {
+		t.Errorf("Sessions()[0].Title = %q (%d runes), want it cut to %d runes", active.Title, n, maxTitleLength)
+	}
+
+	want := SessionSummary{ID: "stored", Title: "a red barn", MessageCount: 2, LastActivity: time.Unix(200, 0)}
+	if got := summaries[1]; got.ID != want.ID || got.Title != want.Title ||
+		got.MessageCount != want.MessageCount || !got.LastActivity.Equal(want.LastActivity) {
+		t.Errorf("Sessions()[1] = %+v, want %+v", got, want)
+	}
+	if sm.Count() != 2 {
+		t.Errorf("Count() after listing = %d, want 2 (stored sessions are not loaded)", sm.Count())
+	}
+}
+
+func TestSessionManager_SessionSummary(t *testing.T) {
+	store := listingPersistence{newMockPersistence()}
+	sm := NewSessionManagerWithPersistence(store)
+	defer sm.Shutdown()
+
+	stored := NewConversation()
+	stored.SetMessages([]ConversationMessage{{ID: 1, Role: RoleUser, Content: "a lighthouse"}})
+	store.Save("stored", stored)
+	sm.GetSession("active").Manager().AddUserMessage("a cat")
+	sm.GetSession("empty")
+
+	tests := []struct {
+		id        string
+		wantTitle string
+		wantOK    bool
+	}{
+		{"active", "a cat", true},
+		{"stored", "a lighthouse", true},
+		{"empty", "", false},
+		{"unknown", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			summary, ok := sm.SessionSummary(tt.id)
+			if ok != tt.wantOK || summary.Title != tt.wantTitle {
+				t.Errorf("SessionSummary(%q) = %+v, %v, want title %q, %v", tt.id, summary, ok, tt.wantTitle, tt.wantOK)
+			}
+		})
+	}
+}
@@ -38,6 +38,9 @@
 // The trailing context ensures the LLM knows the current prompt even if many
 // turns have passed since it was last updated.
 //
+// BuildLLMContextWithin does the same within a token budget, leaving out the
+// oldest turns when the conversation would not fit the model's context.
+//
 // 4. Session Management
 //
 // SessionManager provides thread-safe session isolation using double-check
@@ -65,7 +68,11 @@
 //	context := m.BuildLLMContext(systemPrompt)
 package conversation
 
-import "github.com/hurricanerix/weave/internal/ollama"
+import (
+	"time"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+)
 
 // Message represents a single message in a conversation.
 // This is an alias for ollama.Message to ensure type compatibility
@@ -79,7 +86,9 @@ type StateSnapshot struct {
 	// Prompt is the image generation prompt at this point.
 	Prompt string `json:"prompt"`
 
-	// Steps is the number of inference steps (1-100).
+	// Steps is the number of inference steps (1-100). Steps, CFG and Seed
+	// are recorded when the preview image is generated; Steps is 0 until
+	// then.
 	Steps int `json:"steps"`
 
 	// CFG is the classifier-free guidance scale (0-20).
@@ -89,6 +98,14 @@ type StateSnapshot struct {
 	// -1 means random, 0+ means deterministic.
 	Seed int64 `json:"seed"`
 
+	// ImageSeed is the seed the preview image was generated with, which
+	// reproduces it when Seed is -1. 0 if unknown.
+	ImageSeed int64 `json:"image_seed,omitempty"`
+
+	// Generation is how compute generated the preview image, nil if it did
+	// not say.
+	Generation *GenerationMetadata `json:"generation,omitempty"`
+
 	// PreviewStatus indicates the state of the preview image for this message.
 	// Values: "none" (no preview generated), "generating" (in progress), "complete" (done).
 	PreviewStatus string `json:"preview_status"`
@@ -98,6 +115,36 @@ type StateSnapshot struct {
 	PreviewURL string `json:"preview_url"`
 }
 
+// GenerationMetadata is how compute generated an image, recorded so
+// configurations can be compared.
+type GenerationMetadata struct {
+	// ModelHash is a short hash of the model weights, as the AUTOMATIC1111
+	// web UI reports it. Empty if unknown.
+	ModelHash string `json:"model_hash,omitempty"`
+
+	// Sampler and Scheduler are the sampling method and noise schedule, as
+	// stable-diffusion.cpp names them. Empty if unknown.
+	Sampler   string `json:"sampler,omitempty"`
+	Scheduler string `json:"scheduler,omitempty"`
+
+	// TextEncodeMS, DiffusionMS and VAEMS are how long the phases of the
+	// generation took in milliseconds: encoding the prompt (and the init
+	// image of img2img), sampling, and decoding the image.
+	TextEncodeMS int64 `json:"text_encode_ms"`
+	DiffusionMS  int64 `json:"diffusion_ms"`
+	VAEMS        int64 `json:"vae_ms"`
+}
+
+// ImageAlternate is an additional image generated for a message from the
+// same snapshot with a different seed.
+type ImageAlternate struct {
+	// URL is the URL or path to the alternate image.
+	URL string `json:"url"`
+
+	// Seed is the seed the alternate was generated with.
+	Seed int64 `json:"seed"`
+}
+
 // ConversationMessage represents a message with additional metadata for conversation history.
 // This wraps the basic message concept with stable IDs and optional state snapshots.
 // Unlike the ollama.Message which is used for LLM API communication, this type is for
@@ -121,8 +168,53 @@ type ConversationMessage struct {
 	// Only set for assistant messages that changed the prompt or settings.
 	// Nil for user messages and assistant messages that are pure conversation.
 	Snapshot *StateSnapshot `json:"snapshot,omitempty"`
+
+	// Alternates are extra images regenerated from Snapshot with new seeds,
+	// oldest first. Alternate n (1-based) is Alternates[n-1].
+	Alternates []ImageAlternate `json:"alternates,omitempty"`
+
+	// Usage is the token count of the LLM request that produced an
+	// assistant message. PromptTokens is the size of the context sent,
+	// which is what context compaction keeps in check. Nil for user
+	// messages and replies from servers that do not report usage.
+	Usage *ollama.Usage `json:"usage,omitempty"`
+
+	// Model is the LLM model that produced an assistant message. Empty for
+	// user messages and messages saved before models were recorded.
+	Model string `json:"model,omitempty"`
+
+	// CreatedAt is when the message was added, in UTC.
+	// Zero for messages saved before creation times were recorded.
+	CreatedAt time.Time `json:"created_at,omitzero"`
+
+	// Seq orders messages across sessions and devices even when wall
+	// clocks disagree. It increases with every message created by this
+	// server; see package timestamp.
+	Seq int64 `json:"seq,omitempty"`
 }
 
+// PromptRevision is one value the current prompt had.
+type PromptRevision struct {
+	// Prompt is the prompt text, empty if the prompt was cleared.
+	Prompt string `json:"prompt"`
+
+	// Source is what changed the prompt: one of the PromptSource constants.
+	Source string `json:"source"`
+
+	// CreatedAt is when the prompt changed, in UTC.
+	CreatedAt time.Time `json:"created_at"`
+
+	// Seq orders revisions like ConversationMessage.Seq.
+	Seq int64 `json:"seq"`
+}
+
+// Prompt revision sources.
+const (
+	PromptSourceAgent  = "agent"  // The agent wrote a new prompt
+	PromptSourceUser   = "user"   // The user edited the prompt
+	PromptSourceRewind = "rewind" // Rewinding or deleting messages rolled it back
+)
+
 // Role constants for message roles.
 // These are re-exported from ollama for convenience.
 const (
@@ -143,15 +235,15 @@ const (
 type GenerationSettings struct {
 	// Steps controls the number of generation steps (1-100).
 	// Higher values produce more detailed images but take longer.
-	Steps int
+	Steps int `json:"steps"`
 
 	// CFG (Classifier-Free Guidance) controls prompt adherence (0-20).
 	// Higher values make the image follow the prompt more strictly.
-	CFG float64
+	CFG float64 `json:"cfg"`
 
 	// Seed controls reproducibility.
 	// -1 means random (new seed each time), 0+ means deterministic.
-	Seed int64
+	Seed int64 `json:"seed"`
 }
 
 // Conversation holds the state for a single conversation session.
@@ -181,9 +273,19 @@ type Conversation struct {
 	// Used to detect whether the prompt actually changed.
 	previousPrompt string
 
+	// promptHistory holds the revisions of currentPrompt, oldest first,
+	// up to MaxPromptRevisions.
+	promptHistory []PromptRevision
+
 	// nextMessageID is the next ID to assign to a new message.
 	// IDs start at 1 and increment sequentially.
 	nextMessageID int
+
+	// summary is an LLM-written summary of the oldest messages, up to and
+	// including the message with ID summaryThrough. BuildLLMContextWithin
+	// sends it in place of those messages when they do not fit.
+	summary        string
+	summaryThrough int
 }
 
 // NewConversation creates a new empty conversation.
@@ -239,6 +341,17 @@ func (c *Conversation) SetPreviousPrompt(prompt string) {
 	c.previousPrompt = prompt
 }
 
+// GetPromptHistory returns a copy of the prompt revisions, oldest first.
+func (c *Conversation) GetPromptHistory() []PromptRevision {
+	return append([]PromptRevision(nil), c.promptHistory...)
+}
+
+// SetPromptHistory replaces the prompt revisions.
+// This is used when deserializing from persistence.
+func (c *Conversation) SetPromptHistory(history []PromptRevision) {
+	c.promptHistory = history
+}
+
 // IsPromptEdited returns whether the prompt has been edited.
 func (c *Conversation) IsPromptEdited() bool {
 	return c.promptEdited
@@ -0,0 +1,426 @@
+// Package grpcapi implements the weave gRPC API (pkg/weavepb) as a gateway
+// in front of a weave server's HTTP API.
+//
+// The gateway forwards every call through weaveclient, so the weave
+// server's API tokens, users, rate limits and quotas apply unchanged. Each
+// weave session the gateway serves holds one open event stream, which is
+// reused across calls and closed after the session has been idle for a
+// while.
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/hurricanerix/weave/pkg/weaveclient"
+	"github.com/hurricanerix/weave/pkg/weavepb"
+)
+
+const (
+	// SessionMetadataKey is the metadata key carrying the weave session ID.
+	// The gateway sends it in the response headers of every call; clients
+	// send it to stay in the same session.
+	SessionMetadataKey = "weave-session"
+
+	// DefaultIdleTimeout is how long a session's event stream is kept open
+	// without calls.
+	DefaultIdleTimeout = 30 * time.Minute
+
+	// connectTimeout bounds opening a session's event stream. The weave
+	// server never registers a second stream for a session, so a session
+	// whose stream is held elsewhere, such as by a browser tab, would
+	// otherwise wait forever.
+	connectTimeout = 10 * time.Second
+
+	// cleanupInterval is how often idle sessions are closed
+	cleanupInterval = time.Minute
+)
+
+// Server implements weavepb.WeaveServiceServer.
+type Server struct {
+	weavepb.UnimplementedWeaveServiceServer
+
+	baseURL     string
+	httpClient  *http.Client
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	sessions map[sessionKey]*session
+}
+
+// sessionKey identifies a session by its ID and the API token used with
+// it, so a session ID alone doesn't give access to a session opened with a
+// token. Servers with users derive the session from the token and don't
+// return an ID; those sessions are keyed by token with an empty ID.
+type sessionKey struct {
+	id    string
+	token string
+}
+
+// session is a weave session with its open event stream.
+type session struct {
+	client *weaveclient.Client
+	events *weaveclient.EventStream
+
+	// busy is held for the duration of a call: the event stream delivers
+	// the events of one request at a time
+	busy sync.Mutex
+
+	// lastUsed is guarded by Server.mu
+	lastUsed time.Time
+}
+
+// NewServer creates a gateway for the weave server at baseURL, for example
+// "http://localhost:8080".
+func NewServer(baseURL string) (*Server, error) {
+	// Validate the URL the same way clients will
+	if _, err := weaveclient.NewClient(baseURL); err != nil {
+		return nil, err
+	}
+	return &Server{
+		baseURL:     baseURL,
+		httpClient:  &http.Client{},
+		idleTimeout: DefaultIdleTimeout,
+		sessions:    make(map[sessionKey]*session),
+	}, nil
+}
+
+// SetIdleTimeout sets how long a session is kept open without calls.
+func (s *Server) SetIdleTimeout(d time.Duration) {
+	s.idleTimeout = d
+}
+
+// SetHTTPClient replaces the HTTP client used to reach the weave server. It
+// must not time out requests; see weaveclient.Client.SetHTTPClient.
+func (s *Server) SetHTTPClient(httpClient *http.Client) {
+	s.httpClient = httpClient
+}
+
+// Register registers the service with a gRPC server.
+func (s *Server) Register(registrar grpc.ServiceRegistrar) {
+	weavepb.RegisterWeaveServiceServer(registrar, s)
+}
+
+// Chat sends a message to the agent and streams the response.
+func (s *Server) Chat(req *weavepb.ChatRequest, stream weavepb.WeaveService_ChatServer) (err error) {
+	if strings.TrimSpace(req.GetMessage()) == "" {
+		return status.Error(codes.InvalidArgument, "message required")
+	}
+	ctx := stream.Context()
+	sess, key, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { s.release(key, sess, err) }()
+	if err := stream.SetHeader(sessionHeader(sess)); err != nil {
+		return err
+	}
+
+	var sendErr error
+	onToken := func(token string) {
+		if sendErr == nil {
+			sendErr = stream.Send(&weavepb.ChatResponse{Response: &weavepb.ChatResponse_Token{Token: token}})
+		}
+	}
+	reply, err := sess.client.Chat(ctx, sess.events, weaveclient.ChatRequest{
+		Message:  req.GetMessage(),
+		Settings: fromSettings(req.GetSettings()),
+	}, onToken)
+	if err != nil {
+		return toStatus(err)
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+
+	out := &weavepb.ChatReply{
+		MessageId: int32(reply.MessageID),
+		Text:      reply.Text,
+		Prompt:    reply.Prompt,
+		Settings:  toSettings(reply.Settings),
+	}
+	if reply.ImageURL != "" {
+		out.Image = &weavepb.Image{Url: reply.ImageURL, MessageId: int32(reply.MessageID)}
+		if req.GetIncludeImage() {
+			if out.Image.Data, err = download(ctx, sess.client, reply.ImageURL); err != nil {
+				return toStatus(err)
+			}
+		}
+	}
+	return stream.Send(&weavepb.ChatResponse{Response: &weavepb.ChatResponse_Reply{Reply: out}})
+}
+
+// Generate generates an image and returns it once it is ready.
+func (s *Server) Generate(ctx context.Context, req *weavepb.GenerateRequest) (_ *weavepb.GenerateResponse, err error) {
+	sess, key, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { s.release(key, sess, err) }()
+	if err := grpc.SetHeader(ctx, sessionHeader(sess)); err != nil {
+		return nil, err
+	}
+
+	image, err := sess.client.Generate(ctx, sess.events, weaveclient.GenerateRequest{
+		Prompt:    req.GetPrompt(),
+		MessageID: int(req.GetMessageId()),
+		Settings:  fromSettings(req.GetSettings()),
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	out := &weavepb.Image{
+		Url:       image.URL,
+		Width:     int32(image.Width),
+		Height:    int32(image.Height),
+		MessageId: int32(image.MessageID),
+	}
+	if req.GetIncludeImage() {
+		if out.Data, err = download(ctx, sess.client, image.URL); err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	return &weavepb.GenerateResponse{Image: out}, nil
+}
+
+// StreamEvents forwards the session's events until the call is cancelled.
+// The session can't be used by other calls meanwhile.
+func (s *Server) StreamEvents(_ *weavepb.StreamEventsRequest, stream weavepb.WeaveService_StreamEventsServer) (err error) {
+	ctx := stream.Context()
+	sess, key, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { s.release(key, sess, err) }()
+	if err := stream.SetHeader(sessionHeader(sess)); err != nil {
+		return err
+	}
+	// Send the header now so clients learn the session before the first
+	// event arrives
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	for {
+		event, err := sess.events.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return toStatus(err)
+		}
+		if err := stream.Send(&weavepb.StreamEventsResponse{Event: &weavepb.Event{
+			Type: event.Type,
+			Data: string(event.Data),
+		}}); err != nil {
+			return err
+		}
+	}
+}
+
+// acquire returns the caller's session, opening it if needed, and marks it
+// busy until release. Calls made while the session is busy fail with
+// ABORTED.
+func (s *Server) acquire(ctx context.Context) (*session, sessionKey, error) {
+	key := callerKey(ctx)
+
+	s.mu.Lock()
+	if sess, ok := s.sessions[key]; ok {
+		if !sess.busy.TryLock() {
+			s.mu.Unlock()
+			return nil, key, status.Error(codes.Aborted, "session is busy with another call")
+		}
+		sess.lastUsed = time.Now()
+		s.mu.Unlock()
+		return sess, key, nil
+	}
+
+	client, err := weaveclient.NewClient(s.baseURL)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, key, status.Error(codes.Internal, err.Error())
+	}
+	client.SetHTTPClient(s.httpClient)
+	client.SetToken(key.token)
+	client.SetSessionID(key.id)
+
+	// Reserve the key while the stream is opened, so concurrent calls for
+	// the same session don't open a second one
+	sess := &session{client: client, lastUsed: time.Now()}
+	sess.busy.Lock()
+	s.sessions[key] = sess
+	s.mu.Unlock()
+
+	connectCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	sess.events, err = client.Events(connectCtx)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.sessions, key)
+		s.mu.Unlock()
+		sess.busy.Unlock()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return nil, key, status.Error(codes.Unavailable, "timed out opening the session's event stream; is another client connected to the session?")
+		}
+		return nil, key, toStatus(err)
+	}
+
+	// A new session is known by the ID the server assigned
+	if id := client.SessionID(); id != key.id {
+		s.mu.Lock()
+		delete(s.sessions, key)
+		key.id = id
+		s.sessions[key] = sess
+		s.mu.Unlock()
+	}
+	return sess, key, nil
+}
+
+// release marks the session idle. A session whose call failed with
+// UNAVAILABLE, for example because the weave server restarted and ended the
+// event stream, is closed so the next call opens a new stream.
+func (s *Server) release(key sessionKey, sess *session, err error) {
+	if status.Code(err) == codes.Unavailable {
+		s.mu.Lock()
+		if s.sessions[key] == sess {
+			delete(s.sessions, key)
+		}
+		s.mu.Unlock()
+		sess.events.Close()
+	}
+	s.mu.Lock()
+	sess.lastUsed = time.Now()
+	s.mu.Unlock()
+	sess.busy.Unlock()
+}
+
+// StartCleanup starts a background goroutine that closes idle sessions.
+// The goroutine stops when ctx is cancelled.
+func (s *Server) StartCleanup(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.closeIdle(time.Now().Add(-s.idleTimeout))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// closeIdle closes the sessions last used before cutoff that are not busy.
+func (s *Server) closeIdle(cutoff time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, sess := range s.sessions {
+		if !sess.lastUsed.Before(cutoff) || !sess.busy.TryLock() {
+			continue
+		}
+		delete(s.sessions, key)
+		sess.events.Close()
+		sess.busy.Unlock()
+	}
+}
+
+// Close closes the event streams of all sessions. Calls in progress fail.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, sess := range s.sessions {
+		delete(s.sessions, key)
+		if sess.events != nil {
+			sess.events.Close()
+		}
+	}
+}
+
+// callerKey returns the session and API token sent in the call's metadata.
+func callerKey(ctx context.Context) sessionKey {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var key sessionKey
+	if values := md.Get(SessionMetadataKey); len(values) > 0 {
+		key.id = values[0]
+	}
+	if values := md.Get("authorization"); len(values) > 0 {
+		key.token = strings.TrimSpace(strings.TrimPrefix(values[0], "Bearer "))
+	}
+	return key
+}
+
+// sessionHeader returns the response header naming the session. Servers
+// with users don't assign session IDs; the header is empty then.
+func sessionHeader(sess *session) metadata.MD {
+	if id := sess.client.SessionID(); id != "" {
+		return metadata.Pairs(SessionMetadataKey, id)
+	}
+	return metadata.MD{}
+}
+
+// download returns the image at imageURL.
+func download(ctx context.Context, client *weaveclient.Client, imageURL string) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := client.DownloadImage(ctx, imageURL, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fromSettings converts request settings; nil keeps the server defaults.
+func fromSettings(settings *weavepb.Settings) *weaveclient.Settings {
+	if settings == nil {
+		return nil
+	}
+	return &weaveclient.Settings{
+		Steps: int(settings.GetSteps()),
+		CFG:   settings.GetCfg(),
+		Seed:  settings.GetSeed(),
+	}
+}
+
+// toSettings converts reply settings.
+func toSettings(settings *weaveclient.Settings) *weavepb.Settings {
+	if settings == nil {
+		return nil
+	}
+	return &weavepb.Settings{
+		Steps: int32(settings.Steps),
+		Cfg:   settings.CFG,
+		Seed:  settings.Seed,
+	}
+}
+
+// toStatus converts a weaveclient error to a gRPC status error.
+func toStatus(err error) error {
+	var code codes.Code
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, weaveclient.ErrUnauthorized):
+		code = codes.Unauthenticated
+	case errors.Is(err, weaveclient.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, weaveclient.ErrRateLimited):
+		code = codes.ResourceExhausted
+	case errors.Is(err, weaveclient.ErrUnavailable), errors.Is(err, weaveclient.ErrStreamClosed):
+		code = codes.Unavailable
+	case errors.Is(err, weaveclient.ErrChatFailed), errors.Is(err, weaveclient.ErrGenerateFailed):
+		code = codes.Internal
+	default:
+		code = codes.Unknown
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,383 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/hurricanerix/weave/pkg/weaveclient"
+	"github.com/hurricanerix/weave/pkg/weavepb"
+)
+
+const testImage = "\x89PNG fake image"
+
+// fakeWeave is a weave server with one chat reply and one image. Each
+// session gets its own event stream.
+type fakeWeave struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	streams map[string]chan string // session ID -> SSE frames
+	opened  int                    // event streams opened
+	token   string                 // API token required, if set
+	next    int                    // last session ID handed out
+}
+
+func newFakeWeave(t *testing.T) *fakeWeave {
+	t.Helper()
+
+	f := &fakeWeave{streams: make(map[string]chan string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events", f.handleEvents)
+	mux.HandleFunc("POST /chat", func(w http.ResponseWriter, r *http.Request) {
+		f.send(r, weaveclient.EventAgentToken, `{"token":"A fox "}`)
+		f.send(r, weaveclient.EventAgentToken, `{"token":"in snow"}`)
+		f.send(r, weaveclient.EventPromptUpdate, `{"prompt":"a red fox in snow"}`)
+		f.send(r, weaveclient.EventAgentDone, `{"message_id":2}`)
+		fmt.Fprint(w, `{"status":"ok"}`)
+	})
+	mux.HandleFunc("GET /message/2/state", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"prompt":"a red fox in snow","preview_status":"complete","preview_url":"/images/2.png"}`)
+	})
+	mux.HandleFunc("POST /generate", func(w http.ResponseWriter, r *http.Request) {
+		f.send(r, weaveclient.EventImageReady, `{"url":"/images/3.png","width":512,"height":512,"message_id":0}`)
+		fmt.Fprint(w, `{"status":"ok"}`)
+	})
+	mux.HandleFunc("GET /images/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testImage)
+	})
+	f.Server = httptest.NewServer(f.requireToken(mux))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeWeave) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.token != "" && r.Header.Get("Authorization") != "Bearer "+f.token {
+			http.Error(w, "API token required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *fakeWeave) handleEvents(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	sessionID := sessionOf(r)
+	if sessionID == "" {
+		f.next++
+		sessionID = fmt.Sprintf("session-%d", f.next)
+		http.SetCookie(w, &http.Cookie{Name: weaveclient.SessionCookieName, Value: sessionID, Secure: true})
+	}
+	frames := make(chan string, 16)
+	f.streams[sessionID] = frames
+	f.opened++
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprintf(w, "event: connected\ndata: {\"session\":%q}\n\n", sessionID)
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case frame := <-frames:
+			fmt.Fprint(w, frame)
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// send queues an event on the stream of r's session.
+func (f *fakeWeave) send(r *http.Request, eventType, data string) {
+	f.mu.Lock()
+	frames := f.streams[sessionOf(r)]
+	f.mu.Unlock()
+	frames <- fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, data)
+}
+
+func (f *fakeWeave) openedStreams() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.opened
+}
+
+func sessionOf(r *http.Request) string {
+	cookie, err := r.Cookie(weaveclient.SessionCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// startGateway serves a gateway for weave over an in-memory connection and
+// returns a client for it.
+func startGateway(t *testing.T, weave *fakeWeave) (*Server, weavepb.WeaveServiceClient) {
+	t.Helper()
+
+	gateway, err := NewServer(weave.URL)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	gateway.Register(server)
+	go server.Serve(listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient() error = %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		gateway.Close()
+		server.Stop()
+	})
+	return gateway, weavepb.NewWeaveServiceClient(conn)
+}
+
+func testContext(t *testing.T, kv ...string) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// chat calls Chat and returns the streamed tokens, the reply and the
+// session ID sent by the gateway.
+func chat(ctx context.Context, client weavepb.WeaveServiceClient, req *weavepb.ChatRequest) ([]string, *weavepb.ChatReply, string, error) {
+	stream, err := client.Chat(ctx, req)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	var tokens []string
+	var reply *weavepb.ChatReply
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if resp.GetReply() != nil {
+			reply = resp.GetReply()
+		} else {
+			tokens = append(tokens, resp.GetToken())
+		}
+	}
+	header, _ := stream.Header()
+	var sessionID string
+	if values := header.Get(SessionMetadataKey); len(values) > 0 {
+		sessionID = values[0]
+	}
+	return tokens, reply, sessionID, nil
+}
+
+func TestServer_Chat(t *testing.T) {
+	weave := newFakeWeave(t)
+	_, client := startGateway(t, weave)
+
+	tokens, reply, sessionID, err := chat(testContext(t), client, &weavepb.ChatRequest{Message: "a fox", IncludeImage: true})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if strings.Join(tokens, "") != "A fox in snow" {
+		t.Errorf("tokens = %q, want %q", tokens, "A fox in snow")
+	}
+	if reply.GetMessageId() != 2 || reply.GetText() != "A fox in snow" || reply.GetPrompt() != "a red fox in snow" {
+		t.Errorf("reply = %v, want message 2 with text and prompt", reply)
+	}
+	if reply.GetImage().GetUrl() != "/images/2.png" || string(reply.GetImage().GetData()) != testImage {
+		t.Errorf("reply image = %v, want /images/2.png with data", reply.GetImage())
+	}
+	if sessionID != "session-1" {
+		t.Errorf("%s header = %q, want %q", SessionMetadataKey, sessionID, "session-1")
+	}
+
+	// The session's event stream is reused
+	_, _, sessionID, err = chat(testContext(t, SessionMetadataKey, sessionID), client, &weavepb.ChatRequest{Message: "again"})
+	if err != nil {
+		t.Fatalf("second Chat() error = %v", err)
+	}
+	if sessionID != "session-1" {
+		t.Errorf("second %s header = %q, want %q", SessionMetadataKey, sessionID, "session-1")
+	}
+	if got := weave.openedStreams(); got != 1 {
+		t.Errorf("event streams opened = %d, want 1", got)
+	}
+}
+
+func TestServer_ChatRequiresMessage(t *testing.T) {
+	_, client := startGateway(t, newFakeWeave(t))
+
+	_, _, _, err := chat(testContext(t), client, &weavepb.ChatRequest{Message: "  "})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Chat() error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestServer_Generate(t *testing.T) {
+	_, client := startGateway(t, newFakeWeave(t))
+
+	tests := []struct {
+		name     string
+		include  bool
+		wantData string
+	}{
+		{"url only", false, ""},
+		{"with image", true, testImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Generate(testContext(t), &weavepb.GenerateRequest{Prompt: "a fox", IncludeImage: tt.include})
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			image := resp.GetImage()
+			if image.GetUrl() != "/images/3.png" || image.GetWidth() != 512 || image.GetHeight() != 512 {
+				t.Errorf("image = %v, want /images/3.png at 512x512", image)
+			}
+			if string(image.GetData()) != tt.wantData {
+				t.Errorf("image data = %q, want %q", image.GetData(), tt.wantData)
+			}
+		})
+	}
+}
+
+func TestServer_StreamEventsHoldsSession(t *testing.T) {
+	_, client := startGateway(t, newFakeWeave(t))
+
+	ctx, cancel := context.WithCancel(testContext(t))
+	defer cancel()
+	stream, err := client.StreamEvents(ctx, &weavepb.StreamEventsRequest{})
+	if err != nil {
+		t.Fatalf("StreamEvents() error = %v", err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatalf("Header() error = %v", err)
+	}
+	sessionID := header.Get(SessionMetadataKey)
+	if len(sessionID) != 1 {
+		t.Fatalf("%s header = %q, want one session ID", SessionMetadataKey, sessionID)
+	}
+
+	// Chat in the same session can't share the stream
+	_, _, _, err = chat(testContext(t, SessionMetadataKey, sessionID[0]), client, &weavepb.ChatRequest{Message: "a fox"})
+	if status.Code(err) != codes.Aborted {
+		t.Errorf("Chat() during StreamEvents error = %v, want Aborted", err)
+	}
+
+	// A different session is not affected
+	if _, _, _, err := chat(testContext(t), client, &weavepb.ChatRequest{Message: "a fox"}); err != nil {
+		t.Errorf("Chat() in another session error = %v", err)
+	}
+}
+
+func TestServer_Token(t *testing.T) {
+	weave := newFakeWeave(t)
+	weave.token = "0123456789abcdef"
+	_, client := startGateway(t, weave)
+
+	tests := []struct {
+		name     string
+		md       []string
+		wantCode codes.Code
+	}{
+		{"no token", nil, codes.Unauthenticated},
+		{"wrong token", []string{"authorization", "Bearer fedcba9876543210"}, codes.Unauthenticated},
+		{"token", []string{"authorization", "Bearer 0123456789abcdef"}, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Generate(testContext(t, tt.md...), &weavepb.GenerateRequest{Prompt: "a fox"})
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("Generate() error = %v, want %v", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestServer_SessionsAreKeyedByToken(t *testing.T) {
+	weave := newFakeWeave(t)
+	gateway, client := startGateway(t, weave)
+
+	_, _, sessionID, err := chat(testContext(t, "authorization", "Bearer 0123456789abcdef"), client, &weavepb.ChatRequest{Message: "a fox"})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	// The session ID with another token opens its own stream rather than
+	// reusing the first caller's
+	if _, _, _, err := chat(testContext(t, SessionMetadataKey, sessionID), client, &weavepb.ChatRequest{Message: "a fox"}); err != nil {
+		t.Fatalf("Chat() without token error = %v", err)
+	}
+	gateway.mu.Lock()
+	n := len(gateway.sessions)
+	gateway.mu.Unlock()
+	if n != 2 {
+		t.Errorf("gateway sessions = %d, want 2", n)
+	}
+}
+
+func TestServer_CloseIdle(t *testing.T) {
+	weave := newFakeWeave(t)
+	gateway, client := startGateway(t, weave)
+
+	if _, err := client.Generate(testContext(t), &weavepb.GenerateRequest{Prompt: "a fox"}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	gateway.closeIdle(time.Now().Add(-time.Hour))
+	if len(gateway.sessions) != 1 {
+		t.Fatalf("recently used session was closed")
+	}
+	gateway.closeIdle(time.Now().Add(time.Second))
+	if len(gateway.sessions) != 0 {
+		t.Errorf("idle session was not closed")
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{fmt.Errorf("%w: 401: API token required", weaveclient.ErrUnauthorized), codes.Unauthenticated},
+		{fmt.Errorf("%w: 404: Message not found", weaveclient.ErrNotFound), codes.NotFound},
+		{&weaveclient.RateLimitError{Limit: 5}, codes.ResourceExhausted},
+		{fmt.Errorf("%w: 503: compute unavailable", weaveclient.ErrUnavailable), codes.Unavailable},
+		{fmt.Errorf("%w: EOF", weaveclient.ErrStreamClosed), codes.Unavailable},
+		{fmt.Errorf("%w: no response", weaveclient.ErrChatFailed), codes.Internal},
+		{fmt.Errorf("%w: 400: bad request", weaveclient.ErrRequestFailed), codes.Unknown},
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{context.Canceled, codes.Canceled},
+		{errors.New("other"), codes.Unknown},
+	}
+	for _, tt := range tests {
+		if got := status.Code(toStatus(tt.err)); got != tt.want {
+			t.Errorf("toStatus(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
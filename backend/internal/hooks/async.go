@@ -0,0 +1,43 @@
+package hooks
+
+import (
+	"context"
+	"time"
+)
+
+// AsyncHook runs another hook in the background so a slow or unreachable
+// receiver never delays the operation that fired the event. Run always
+// returns nil; use it only for notifications, never for pre-* hooks that
+// are meant to veto an operation.
+type AsyncHook struct {
+	hook    Hook
+	onError func(error)
+}
+
+// NewAsyncHook wraps hook so it runs in its own goroutine. onError, if not
+// nil, is called with any error the hook returns.
+func NewAsyncHook(hook Hook, onError func(error)) *AsyncHook {
+	return &AsyncHook{hook: hook, onError: onError}
+}
+
+// Run starts the wrapped hook and returns immediately.
+// The hook keeps the time remaining on ctx, which carries the registry's
+// per-hook timeout, but is not cancelled when ctx is; the request that
+// fired the event usually finishes first.
+func (h *AsyncHook) Run(ctx context.Context, payload Payload) error {
+	timeout := DefaultTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if err := h.hook.Run(ctx, payload); err != nil && h.onError != nil {
+			h.onError(err)
+		}
+	}()
+
+	return nil
+}
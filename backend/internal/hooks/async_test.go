@@ -0,0 +1,86 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAsyncHook_Run(t *testing.T) {
+	release := make(chan struct{})
+	ran := make(chan Payload, 1)
+	hook := NewAsyncHook(HookFunc(func(ctx context.Context, payload Payload) error {
+		<-release
+		if ctx.Err() != nil {
+			t.Errorf("hook context done early: %v", ctx.Err())
+		}
+		ran <- payload
+		return nil
+	}), nil)
+
+	// Run must return before the hook finishes, and cancelling the caller's
+	// context must not cancel the hook
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	payload := Payload{Event: EventPostSave, SessionID: "abc"}
+	if err := hook.Run(ctx, payload); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	cancel()
+	close(release)
+
+	select {
+	case got := <-ran:
+		if got != payload {
+			t.Errorf("payload = %+v, want %+v", got, payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("hook did not run")
+	}
+}
+
+func TestAsyncHook_Errors(t *testing.T) {
+	errBoom := errors.New("boom")
+	gotErr := make(chan error, 1)
+	hook := NewAsyncHook(HookFunc(func(ctx context.Context, payload Payload) error {
+		return errBoom
+	}), func(err error) { gotErr <- err })
+
+	if err := hook.Run(context.Background(), Payload{Event: EventGenerateFailed}); err != nil {
+		t.Fatalf("Run() error = %v, want nil for async hooks", err)
+	}
+
+	select {
+	case err := <-gotErr:
+		if !errors.Is(err, errBoom) {
+			t.Errorf("onError(%v), want %v", err, errBoom)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("onError was not called")
+	}
+}
+
+func TestAsyncHook_KeepsTimeout(t *testing.T) {
+	deadline := make(chan bool, 1)
+	hook := NewAsyncHook(HookFunc(func(ctx context.Context, payload Payload) error {
+		_, ok := ctx.Deadline()
+		deadline <- ok
+		<-ctx.Done()
+		return ctx.Err()
+	}), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := hook.Run(ctx, Payload{Event: EventPostSave}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	select {
+	case ok := <-deadline:
+		if !ok {
+			t.Error("hook context has no deadline")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("hook did not run")
+	}
+}
@@ -0,0 +1,108 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// maxExecOutput is the maximum amount of stderr kept for error reporting
+	maxExecOutput = 4 * 1024
+
+	// execWaitDelay bounds how long Run waits for output pipes to close after
+	// the command is killed, in case it spawned children that inherited them
+	execWaitDelay = 1 * time.Second
+)
+
+var (
+	// ErrEmptyCommand is returned when an exec hook command is blank
+	ErrEmptyCommand = errors.New("hook command cannot be empty")
+)
+
+// ExecHook runs an external command for each event.
+// The image file path is appended as the final argument and the payload is
+// written to stdin as JSON, so scripts and tools like ImageMagick can be
+// wired in without a webhook server.
+//
+// The command is split on whitespace and executed directly, not through a
+// shell. Wrap it in a script if you need pipes or quoting.
+type ExecHook struct {
+	name string
+	args []string
+}
+
+// NewExecHook creates a hook that runs command for each event.
+// Returns ErrEmptyCommand if command is blank.
+func NewExecHook(command string) (*ExecHook, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, ErrEmptyCommand
+	}
+	return &ExecHook{
+		name: fields[0],
+		args: fields[1:],
+	}, nil
+}
+
+// Run executes the command and waits for it to exit.
+// Payloads without an image path are skipped since there is no file to process.
+// The command is killed when ctx, which carries the registry's per-hook
+// timeout, is done. A non-zero exit status is returned as an error that
+// includes the tail of stderr.
+func (h *ExecHook) Run(ctx context.Context, payload Payload) error {
+	if payload.ImagePath == "" {
+		return nil
+	}
+
+	stdin, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal hook payload: %w", err)
+	}
+
+	args := append(append([]string(nil), h.args...), payload.ImagePath)
+	cmd := exec.CommandContext(ctx, h.name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.WaitDelay = execWaitDelay
+
+	stderr := &tailBuffer{max: maxExecOutput}
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s timed out: %w", h.name, ctx.Err())
+		}
+		output := strings.TrimSpace(string(stderr.buf))
+		if output != "" {
+			return fmt.Errorf("%s failed: %w: %s", h.name, err, output)
+		}
+		return fmt.Errorf("%s failed: %w", h.name, err)
+	}
+
+	return nil
+}
+
+// tailBuffer keeps the last max bytes written to it, so a command that
+// floods stderr can't grow memory while it runs.
+type tailBuffer struct {
+	buf []byte
+	max int
+}
+
+// Write appends p, dropping the oldest bytes beyond max.
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) > b.max {
+		p = p[len(p)-b.max:]
+	}
+	b.buf = append(b.buf, p...)
+	if extra := len(b.buf) - b.max; extra > 0 {
+		b.buf = append(b.buf[:0], b.buf[extra:]...)
+	}
+	return n, nil
+}
@@ -0,0 +1,137 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript writes a shell script to a temp dir and returns its path.
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0700); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+	return path
+}
+
+func TestNewExecHook_EmptyCommand(t *testing.T) {
+	for _, command := range []string{"", "   "} {
+		if _, err := NewExecHook(command); !errors.Is(err, ErrEmptyCommand) {
+			t.Errorf("NewExecHook(%q) error = %v, want ErrEmptyCommand", command, err)
+		}
+	}
+}
+
+func TestExecHook_Run(t *testing.T) {
+	outDir := t.TempDir()
+	argFile := filepath.Join(outDir, "arg")
+	stdinFile := filepath.Join(outDir, "stdin")
+	script := writeScript(t, `echo "$1 $2" > "`+argFile+`"
+cat > "`+stdinFile+`"
+`)
+
+	hook, err := NewExecHook("sh " + script + " --flag")
+	if err != nil {
+		t.Fatalf("NewExecHook() error = %v", err)
+	}
+
+	payload := Payload{
+		Event:     EventPostSave,
+		SessionID: "abc",
+		MessageID: 2,
+		Prompt:    "a cat",
+		ImagePath: "/tmp/images/2.png",
+	}
+	if err := hook.Run(context.Background(), payload); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	args, err := os.ReadFile(argFile)
+	if err != nil {
+		t.Fatalf("failed to read args: %v", err)
+	}
+	if got := strings.TrimSpace(string(args)); got != "--flag /tmp/images/2.png" {
+		t.Errorf("args = %q, want %q", got, "--flag /tmp/images/2.png")
+	}
+
+	stdin, err := os.ReadFile(stdinFile)
+	if err != nil {
+		t.Fatalf("failed to read stdin: %v", err)
+	}
+	var got Payload
+	if err := json.Unmarshal(stdin, &got); err != nil {
+		t.Fatalf("stdin is not JSON: %v", err)
+	}
+	if got != payload {
+		t.Errorf("stdin payload = %+v, want %+v", got, payload)
+	}
+}
+
+func TestExecHook_Failure(t *testing.T) {
+	script := writeScript(t, "echo 'convert: no decode delegate' >&2\nexit 3\n")
+
+	hook, err := NewExecHook("sh " + script)
+	if err != nil {
+		t.Fatalf("NewExecHook() error = %v", err)
+	}
+
+	err = hook.Run(context.Background(), Payload{Event: EventPostSave, ImagePath: "/tmp/x.png"})
+	if err == nil {
+		t.Fatal("Run() error = nil, want error for non-zero exit")
+	}
+	if !strings.Contains(err.Error(), "no decode delegate") {
+		t.Errorf("Run() error = %q, want stderr output included", err)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 8}
+	for _, chunk := range []string{"abc", "defgh", "ij", "0123456789xyz"} {
+		if n, err := b.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	if got := string(b.buf); got != "56789xyz" {
+		t.Errorf("buffer = %q, want the last 8 bytes", got)
+	}
+}
+
+func TestExecHook_Timeout(t *testing.T) {
+	script := writeScript(t, "sleep 5\n")
+
+	hook, err := NewExecHook("sh " + script)
+	if err != nil {
+		t.Fatalf("NewExecHook() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = hook.Run(ctx, Payload{Event: EventPostSave, ImagePath: "/tmp/x.png"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Run() took %v, want it killed at the timeout", elapsed)
+	}
+}
+
+func TestExecHook_SkipsWithoutImagePath(t *testing.T) {
+	hook, err := NewExecHook("/nonexistent/command")
+	if err != nil {
+		t.Fatalf("NewExecHook() error = %v", err)
+	}
+
+	// In-memory images have no file path, so the command must not run
+	if err := hook.Run(context.Background(), Payload{Event: EventPostSave}); err != nil {
+		t.Errorf("Run() error = %v, want nil when ImagePath is empty", err)
+	}
+}
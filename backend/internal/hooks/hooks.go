@@ -0,0 +1,198 @@
+// Package hooks provides a lightweight plugin system for the generation lifecycle.
+//
+// Hooks are registered against lifecycle events and run synchronously, in
+// registration order, when the event fires. This lets users add behaviors such
+// as watermarking, quality scoring, or syncing images to a NAS without forking.
+//
+// Lifecycle events:
+//
+//	pre-prompt       before a user chat message is sent to the LLM
+//	pre-generate     before a generation request is sent to the compute process
+//	post-generate    after the compute process returns an image
+//	post-save        after the image has been written to storage
+//	generate-failed  when generating or saving an image fails
+//
+// Errors returned by pre-* hooks abort the operation, and the remaining hooks
+// for the event are skipped. Every post-* and generate-failed hook runs even
+// if an earlier one fails; their errors are logged by the caller but do not
+// undo completed work.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event identifies a point in the generation lifecycle.
+type Event string
+
+const (
+	// EventPrePrompt fires before a user chat message is sent to the LLM.
+	EventPrePrompt Event = "pre-prompt"
+	// EventPreGenerate fires before a generation request is sent to compute.
+	EventPreGenerate Event = "pre-generate"
+	// EventPostGenerate fires after the compute process returns an image.
+	EventPostGenerate Event = "post-generate"
+	// EventPostSave fires after the image has been written to storage.
+	EventPostSave Event = "post-save"
+	// EventGenerateFailed fires when generating or saving an image fails.
+	EventGenerateFailed Event = "generate-failed"
+
+	// DefaultTimeout is the maximum time a single hook may run.
+	DefaultTimeout = 10 * time.Second
+)
+
+var (
+	// ErrUnknownEvent is returned when an event name is not recognized
+	ErrUnknownEvent = errors.New("unknown hook event")
+)
+
+// Events lists all lifecycle events in the order they occur.
+var Events = []Event{EventPrePrompt, EventPreGenerate, EventPostGenerate, EventPostSave, EventGenerateFailed}
+
+// ParseEvent converts an event name to an Event.
+// Returns ErrUnknownEvent if the name does not match a lifecycle event.
+func ParseEvent(name string) (Event, error) {
+	name = strings.TrimSpace(name)
+	for _, e := range Events {
+		if string(e) == name {
+			return e, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownEvent, name)
+}
+
+// ParseEvents converts a comma-separated list of event names to Events.
+// Empty entries are ignored.
+func ParseEvents(list string) ([]Event, error) {
+	var events []Event
+	for _, name := range strings.Split(list, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		e, err := ParseEvent(name)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// Payload describes the lifecycle event passed to a hook.
+// Fields that do not apply to an event are left at their zero value.
+type Payload struct {
+	Event     Event   `json:"event"`
+	SessionID string  `json:"session_id"`
+	MessageID int     `json:"message_id,omitempty"`
+	Message   string  `json:"message,omitempty"`
+	Prompt    string  `json:"prompt,omitempty"`
+	Steps     int     `json:"steps,omitempty"`
+	CFG       float64 `json:"cfg,omitempty"`
+	Seed      int64   `json:"seed,omitempty"`
+	Width     int     `json:"width,omitempty"`
+	Height    int     `json:"height,omitempty"`
+	ImageURL  string  `json:"image_url,omitempty"`
+	ImagePath string  `json:"image_path,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Hook is implemented by anything that reacts to a lifecycle event.
+type Hook interface {
+	Run(ctx context.Context, payload Payload) error
+}
+
+// HookFunc adapts an ordinary function to the Hook interface.
+type HookFunc func(ctx context.Context, payload Payload) error
+
+// Run calls f(ctx, payload).
+func (f HookFunc) Run(ctx context.Context, payload Payload) error {
+	return f(ctx, payload)
+}
+
+// Registry holds the hooks registered for each lifecycle event.
+// It is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	hooks   map[Event][]Hook
+	timeout time.Duration
+}
+
+// NewRegistry creates an empty registry using DefaultTimeout per hook.
+func NewRegistry() *Registry {
+	return &Registry{
+		hooks:   make(map[Event][]Hook),
+		timeout: DefaultTimeout,
+	}
+}
+
+// SetTimeout sets the maximum time a single hook may run.
+// A non-positive timeout restores DefaultTimeout.
+func (r *Registry) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	r.mu.Lock()
+	r.timeout = timeout
+	r.mu.Unlock()
+}
+
+// Register adds a hook for the given event.
+// Hooks run in the order they were registered.
+func (r *Registry) Register(event Event, hook Hook) {
+	if hook == nil {
+		return
+	}
+	r.mu.Lock()
+	r.hooks[event] = append(r.hooks[event], hook)
+	r.mu.Unlock()
+}
+
+// Count returns the number of hooks registered for an event.
+func (r *Registry) Count(event Event) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.hooks[event])
+}
+
+// Fire runs every hook registered for payload.Event.
+// Each hook runs with its own timeout derived from ctx.
+// For pre-* events Fire stops at the first hook that returns an error and
+// returns that error. For other events every hook runs and the errors are
+// joined. A nil registry has no hooks and always returns nil.
+func (r *Registry) Fire(ctx context.Context, payload Payload) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	hooks := append([]Hook(nil), r.hooks[payload.Event]...)
+	timeout := r.timeout
+	r.mu.RUnlock()
+
+	var errs []error
+	for i, hook := range hooks {
+		hookCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := hook.Run(hookCtx, payload)
+		cancel()
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("%s hook %d failed: %w", payload.Event, i+1, err)
+		if payload.Event.vetoes() {
+			return err
+		}
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// vetoes reports whether a hook error for the event aborts the operation.
+func (e Event) vetoes() bool {
+	return e == EventPrePrompt || e == EventPreGenerate
+}
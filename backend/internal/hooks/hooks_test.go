@@ -0,0 +1,182 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Event
+		wantErr bool
+	}{
+		{"pre-prompt", "pre-prompt", EventPrePrompt, false},
+		{"pre-generate", "pre-generate", EventPreGenerate, false},
+		{"post-generate", "post-generate", EventPostGenerate, false},
+		{"post-save with whitespace", " post-save ", EventPostSave, false},
+		{"unknown event", "pre-upload", "", true},
+		{"empty", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEvent(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrUnknownEvent) {
+				t.Errorf("ParseEvent() error = %v, want ErrUnknownEvent", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseEvent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Event
+		wantErr bool
+	}{
+		{"single event", "post-save", []Event{EventPostSave}, false},
+		{"multiple events", "pre-prompt,post-save", []Event{EventPrePrompt, EventPostSave}, false},
+		{"failure event", "post-save,generate-failed", []Event{EventPostSave, EventGenerateFailed}, false},
+		{"empty entries ignored", "pre-generate,,", []Event{EventPreGenerate}, false},
+		{"empty list", "", nil, false},
+		{"unknown event", "post-save,bogus", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEvents(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEvents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseEvents() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ParseEvents()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRegistry_FireOrder(t *testing.T) {
+	r := NewRegistry()
+
+	var calls []string
+	r.Register(EventPostSave, HookFunc(func(ctx context.Context, p Payload) error {
+		calls = append(calls, "first:"+p.SessionID)
+		return nil
+	}))
+	r.Register(EventPostSave, HookFunc(func(ctx context.Context, p Payload) error {
+		calls = append(calls, "second:"+p.SessionID)
+		return nil
+	}))
+	r.Register(EventPreGenerate, HookFunc(func(ctx context.Context, p Payload) error {
+		calls = append(calls, "wrong-event")
+		return nil
+	}))
+
+	if err := r.Fire(context.Background(), Payload{Event: EventPostSave, SessionID: "abc"}); err != nil {
+		t.Fatalf("Fire() error = %v", err)
+	}
+
+	want := []string{"first:abc", "second:abc"}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("calls[%d] = %q, want %q", i, calls[i], want[i])
+		}
+	}
+}
+
+func TestRegistry_FireStopsOnError(t *testing.T) {
+	r := NewRegistry()
+	errVeto := errors.New("veto")
+
+	secondCalled := false
+	r.Register(EventPrePrompt, HookFunc(func(ctx context.Context, p Payload) error {
+		return errVeto
+	}))
+	r.Register(EventPrePrompt, HookFunc(func(ctx context.Context, p Payload) error {
+		secondCalled = true
+		return nil
+	}))
+
+	err := r.Fire(context.Background(), Payload{Event: EventPrePrompt})
+	if !errors.Is(err, errVeto) {
+		t.Errorf("Fire() error = %v, want %v", err, errVeto)
+	}
+	if secondCalled {
+		t.Error("second hook ran after first hook failed")
+	}
+}
+
+func TestRegistry_FireRunsEveryPostHook(t *testing.T) {
+	r := NewRegistry()
+	errFirst, errSecond := errors.New("first"), errors.New("second")
+
+	thirdCalled := false
+	r.Register(EventPostSave, HookFunc(func(ctx context.Context, p Payload) error {
+		return errFirst
+	}))
+	r.Register(EventPostSave, HookFunc(func(ctx context.Context, p Payload) error {
+		return errSecond
+	}))
+	r.Register(EventPostSave, HookFunc(func(ctx context.Context, p Payload) error {
+		thirdCalled = true
+		return nil
+	}))
+
+	err := r.Fire(context.Background(), Payload{Event: EventPostSave})
+	if !errors.Is(err, errFirst) || !errors.Is(err, errSecond) {
+		t.Errorf("Fire() error = %v, want both hook errors", err)
+	}
+	if !thirdCalled {
+		t.Error("third hook did not run after earlier hooks failed")
+	}
+}
+
+func TestRegistry_Timeout(t *testing.T) {
+	r := NewRegistry()
+	r.SetTimeout(10 * time.Millisecond)
+
+	r.Register(EventPostGenerate, HookFunc(func(ctx context.Context, p Payload) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	err := r.Fire(context.Background(), Payload{Event: EventPostGenerate})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Fire() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRegistry_NilAndEmpty(t *testing.T) {
+	var nilRegistry *Registry
+	if err := nilRegistry.Fire(context.Background(), Payload{Event: EventPostSave}); err != nil {
+		t.Errorf("nil registry Fire() error = %v, want nil", err)
+	}
+
+	r := NewRegistry()
+	r.Register(EventPostSave, nil)
+	if r.Count(EventPostSave) != 0 {
+		t.Errorf("Count() = %d, want 0 after registering nil hook", r.Count(EventPostSave))
+	}
+	if err := r.Fire(context.Background(), Payload{Event: EventPostSave}); err != nil {
+		t.Errorf("empty registry Fire() error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,79 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+var (
+	// ErrInvalidURL is returned when a webhook URL is not an absolute http(s) URL
+	ErrInvalidURL = errors.New("hook URL must be an absolute http or https URL")
+	// ErrHookFailed is returned when a webhook responds with a non-2xx status
+	ErrHookFailed = errors.New("hook returned an error status")
+)
+
+// WebhookHook posts the event payload as JSON to an external URL.
+// A 2xx response means success; any other status is treated as a failure,
+// which lets pre-* webhooks veto a prompt or generation.
+type WebhookHook struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewWebhookHook creates a hook that POSTs payloads to rawURL.
+// Returns ErrInvalidURL if rawURL is not an absolute http or https URL.
+func NewWebhookHook(rawURL string) (*WebhookHook, error) {
+	if err := ValidateURL(rawURL); err != nil {
+		return nil, err
+	}
+	return &WebhookHook{
+		url:        rawURL,
+		httpClient: &http.Client{},
+	}, nil
+}
+
+// ValidateURL checks that rawURL is an absolute http or https URL.
+func ValidateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// Run sends the payload to the webhook URL.
+// The request is bounded by ctx, which carries the registry's per-hook timeout.
+func (h *WebhookHook) Run(ctx context.Context, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal hook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create hook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Weave-Event", string(payload.Event))
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call hook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Drain a bounded amount so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %d", ErrHookFailed, resp.StatusCode)
+	}
+
+	return nil
+}
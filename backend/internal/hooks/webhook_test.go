@@ -0,0 +1,88 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewWebhookHook_InvalidURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"empty", ""},
+		{"no scheme", "nas.local/hook"},
+		{"unsupported scheme", "ftp://nas.local/hook"},
+		{"no host", "http://"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWebhookHook(tt.url)
+			if !errors.Is(err, ErrInvalidURL) {
+				t.Errorf("NewWebhookHook(%q) error = %v, want ErrInvalidURL", tt.url, err)
+			}
+		})
+	}
+}
+
+func TestWebhookHook_Run(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"success", http.StatusOK, false},
+		{"no content", http.StatusNoContent, false},
+		{"rejected", http.StatusForbidden, true},
+		{"server error", http.StatusInternalServerError, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Payload
+			var gotEvent string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("method = %s, want POST", r.Method)
+				}
+				gotEvent = r.Header.Get("X-Weave-Event")
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("failed to decode payload: %v", err)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			hook, err := NewWebhookHook(server.URL)
+			if err != nil {
+				t.Fatalf("NewWebhookHook() error = %v", err)
+			}
+
+			payload := Payload{
+				Event:     EventPostSave,
+				SessionID: "abc",
+				MessageID: 3,
+				ImagePath: "config/sessions/abc/images/3.png",
+			}
+			err = hook.Run(context.Background(), payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrHookFailed) {
+				t.Errorf("Run() error = %v, want ErrHookFailed", err)
+			}
+
+			if gotEvent != string(EventPostSave) {
+				t.Errorf("X-Weave-Event = %q, want %q", gotEvent, EventPostSave)
+			}
+			if got != payload {
+				t.Errorf("payload = %+v, want %+v", got, payload)
+			}
+		})
+	}
+}
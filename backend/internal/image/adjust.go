@@ -0,0 +1,190 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+var (
+	// ErrInvalidAdjustment indicates adjustment parameters are out of range
+	ErrInvalidAdjustment = errors.New("invalid adjustment")
+)
+
+// CropRect selects a region of an image in pixels, relative to its top-left corner.
+type CropRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Adjustments describes post-processing applied to an image.
+// The zero value leaves the image unchanged.
+type Adjustments struct {
+	// Brightness is added to every channel (-1 to 1, 0 = unchanged).
+	Brightness float64 `json:"brightness"`
+
+	// Contrast scales channels around mid-grey (-1 to 1, 0 = unchanged,
+	// -1 = flat grey).
+	Contrast float64 `json:"contrast"`
+
+	// Saturation scales color away from luma (-1 to 1, 0 = unchanged,
+	// -1 = greyscale).
+	Saturation float64 `json:"saturation"`
+
+	// Crop is the region to keep, or nil to keep the whole image.
+	// Cropping happens before the color adjustments.
+	Crop *CropRect `json:"crop,omitempty"`
+}
+
+// Validate checks that adjustment values are in range.
+// Crop bounds are checked against the image in Adjust.
+func (a Adjustments) Validate() error {
+	for _, v := range []struct {
+		name  string
+		value float64
+	}{
+		{"brightness", a.Brightness},
+		{"contrast", a.Contrast},
+		{"saturation", a.Saturation},
+	} {
+		// NaN fails both comparisons, so test the accepted range
+		if !(v.value >= -1 && v.value <= 1) {
+			return fmt.Errorf("%w: %s must be between -1 and 1", ErrInvalidAdjustment, v.name)
+		}
+	}
+	if a.Crop != nil && (a.Crop.Width <= 0 || a.Crop.Height <= 0) {
+		return fmt.Errorf("%w: crop width and height must be positive", ErrInvalidAdjustment)
+	}
+	return nil
+}
+
+// AdjustResult holds an adjusted image.
+type AdjustResult struct {
+	PNG    []byte
+	Width  int
+	Height int
+}
+
+// Adjust applies adjustments to a PNG image and returns a new PNG.
+// The input is not modified. Alpha is preserved.
+func Adjust(pngData []byte, adj Adjustments) (AdjustResult, error) {
+	if err := adj.Validate(); err != nil {
+		return AdjustResult{}, err
+	}
+
+	src, err := decodeBounded(pngData)
+	if err != nil {
+		return AdjustResult{}, err
+	}
+
+	region := src.Bounds()
+	if adj.Crop != nil {
+		crop := image.Rect(adj.Crop.X, adj.Crop.Y, adj.Crop.X+adj.Crop.Width, adj.Crop.Y+adj.Crop.Height).
+			Add(region.Min)
+		if adj.Crop.X < 0 || adj.Crop.Y < 0 || !crop.In(region) {
+			return AdjustResult{}, fmt.Errorf("%w: crop exceeds %dx%d image", ErrInvalidAdjustment, region.Dx(), region.Dy())
+		}
+		region = crop
+	}
+
+	contrast := 1 + adj.Contrast
+	saturation := 1 + adj.Saturation
+
+	width, height := region.Dx(), region.Dy()
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(src.At(region.Min.X+x, region.Min.Y+y)).(color.NRGBA)
+			r := float64(c.R) / 255
+			g := float64(c.G) / 255
+			b := float64(c.B) / 255
+
+			r = (r+adj.Brightness-0.5)*contrast + 0.5
+			g = (g+adj.Brightness-0.5)*contrast + 0.5
+			b = (b+adj.Brightness-0.5)*contrast + 0.5
+
+			luma := 0.2126*r + 0.7152*g + 0.0722*b
+			r = luma + (r-luma)*saturation
+			g = luma + (g-luma)*saturation
+			b = luma + (b-luma)*saturation
+
+			out.SetNRGBA(x, y, color.NRGBA{R: toChannel(r), G: toChannel(g), B: toChannel(b), A: c.A})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return AdjustResult{}, fmt.Errorf("failed to encode adjusted image: %w", err)
+	}
+
+	return AdjustResult{PNG: buf.Bytes(), Width: width, Height: height}, nil
+}
+
+// Histogram counts pixels per channel value.
+type Histogram struct {
+	Red   [256]int `json:"red"`
+	Green [256]int `json:"green"`
+	Blue  [256]int `json:"blue"`
+
+	// Luma uses Rec. 709 weights on the gamma-encoded values,
+	// matching the brightness readout of most image editors.
+	Luma [256]int `json:"luma"`
+}
+
+// ComputeHistogram counts the channel values of a PNG image.
+// Alpha is ignored.
+func ComputeHistogram(pngData []byte) (Histogram, error) {
+	img, err := decodeBounded(pngData)
+	if err != nil {
+		return Histogram{}, err
+	}
+
+	var h Histogram
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			h.Red[c.R]++
+			h.Green[c.G]++
+			h.Blue[c.B]++
+			luma := 0.2126*float64(c.R) + 0.7152*float64(c.G) + 0.0722*float64(c.B)
+			h.Luma[uint8(math.Round(luma))]++
+		}
+	}
+	return h, nil
+}
+
+// decodeBounded decodes a PNG, refusing images larger than MaxImageDimension
+// before allocating their pixels.
+func decodeBounded(pngData []byte) (image.Image, error) {
+	cfg, err := png.DecodeConfig(bytes.NewReader(pngData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if cfg.Width > MaxImageDimension || cfg.Height > MaxImageDimension {
+		return nil, fmt.Errorf("%w: %dx%d exceeds %d", ErrInvalidDimensions, cfg.Width, cfg.Height, MaxImageDimension)
+	}
+
+	img, err := png.Decode(bytes.NewReader(pngData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// toChannel converts a 0-1 channel value to 8 bits, clamping out-of-range values.
+func toChannel(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 255
+	}
+	return uint8(math.Round(v * 255))
+}
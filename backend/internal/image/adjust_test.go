@@ -0,0 +1,158 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// decodePixels returns the NRGBA pixels of a PNG in row order.
+func decodePixels(t *testing.T, data []byte) []color.NRGBA {
+	t.Helper()
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+	bounds := img.Bounds()
+	var pixels []color.NRGBA
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixels = append(pixels, color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA))
+		}
+	}
+	return pixels
+}
+
+func TestAdjust(t *testing.T) {
+	// 2x1: a dark red pixel and a mid grey pixel
+	src := mustEncodeRGB(t, 2, 1, []byte{100, 20, 20, 128, 128, 128})
+
+	tests := []struct {
+		name       string
+		adj        Adjustments
+		wantWidth  int
+		wantPixels []color.NRGBA
+	}{
+		{
+			name:       "zero value is identity",
+			adj:        Adjustments{},
+			wantWidth:  2,
+			wantPixels: []color.NRGBA{{100, 20, 20, 255}, {128, 128, 128, 255}},
+		},
+		{
+			name:       "full brightness saturates",
+			adj:        Adjustments{Brightness: 1},
+			wantWidth:  2,
+			wantPixels: []color.NRGBA{{255, 255, 255, 255}, {255, 255, 255, 255}},
+		},
+		{
+			name:       "minimum contrast flattens to grey",
+			adj:        Adjustments{Contrast: -1},
+			wantWidth:  2,
+			wantPixels: []color.NRGBA{{128, 128, 128, 255}, {128, 128, 128, 255}},
+		},
+		{
+			name:      "minimum saturation is greyscale",
+			adj:       Adjustments{Saturation: -1},
+			wantWidth: 2,
+			// Rec. 709 luma of (100, 20, 20) is 37
+			wantPixels: []color.NRGBA{{37, 37, 37, 255}, {128, 128, 128, 255}},
+		},
+		{
+			name:       "crop keeps the selected region",
+			adj:        Adjustments{Crop: &CropRect{X: 1, Y: 0, Width: 1, Height: 1}},
+			wantWidth:  1,
+			wantPixels: []color.NRGBA{{128, 128, 128, 255}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Adjust(src, tt.adj)
+			if err != nil {
+				t.Fatalf("Adjust() error = %v", err)
+			}
+			if result.Width != tt.wantWidth || result.Height != 1 {
+				t.Errorf("dimensions = %dx%d, want %dx1", result.Width, result.Height, tt.wantWidth)
+			}
+
+			got := decodePixels(t, result.PNG)
+			if len(got) != len(tt.wantPixels) {
+				t.Fatalf("got %d pixels, want %d", len(got), len(tt.wantPixels))
+			}
+			for i := range got {
+				if got[i] != tt.wantPixels[i] {
+					t.Errorf("pixel %d = %v, want %v", i, got[i], tt.wantPixels[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAdjust_PreservesAlpha(t *testing.T) {
+	src, err := EncodePNG(1, 1, []byte{200, 100, 50, 128}, FormatRGBA)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+
+	result, err := Adjust(src, Adjustments{Brightness: -0.1})
+	if err != nil {
+		t.Fatalf("Adjust() error = %v", err)
+	}
+	if got := decodePixels(t, result.PNG)[0].A; got != 128 {
+		t.Errorf("alpha = %d, want 128", got)
+	}
+}
+
+func TestAdjust_Invalid(t *testing.T) {
+	src := mustEncodeRGB(t, 2, 2, make([]byte, 12))
+
+	tests := []struct {
+		name string
+		adj  Adjustments
+	}{
+		{name: "brightness too high", adj: Adjustments{Brightness: 1.5}},
+		{name: "contrast too low", adj: Adjustments{Contrast: -2}},
+		{name: "saturation NaN", adj: Adjustments{Saturation: math.NaN()}},
+		{name: "empty crop", adj: Adjustments{Crop: &CropRect{Width: 0, Height: 1}}},
+		{name: "negative crop origin", adj: Adjustments{Crop: &CropRect{X: -1, Width: 1, Height: 1}}},
+		{name: "crop past edge", adj: Adjustments{Crop: &CropRect{X: 1, Y: 1, Width: 2, Height: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Adjust(src, tt.adj); !errors.Is(err, ErrInvalidAdjustment) {
+				t.Errorf("Adjust() error = %v, want %v", err, ErrInvalidAdjustment)
+			}
+		})
+	}
+}
+
+func TestComputeHistogram(t *testing.T) {
+	src := mustEncodeRGB(t, 3, 1, []byte{255, 0, 0, 255, 0, 0, 10, 10, 10})
+
+	h, err := ComputeHistogram(src)
+	if err != nil {
+		t.Fatalf("ComputeHistogram() error = %v", err)
+	}
+	if h.Red[255] != 2 || h.Red[10] != 1 {
+		t.Errorf("Red[255], Red[10] = %d, %d, want 2, 1", h.Red[255], h.Red[10])
+	}
+	if h.Green[0] != 2 || h.Blue[0] != 2 {
+		t.Errorf("Green[0], Blue[0] = %d, %d, want 2, 2", h.Green[0], h.Blue[0])
+	}
+	// Pure red has luma 0.2126 * 255 = 54
+	if h.Luma[54] != 2 || h.Luma[10] != 1 {
+		t.Errorf("Luma[54], Luma[10] = %d, %d, want 2, 1", h.Luma[54], h.Luma[10])
+	}
+}
+
+func TestComputeHistogram_InvalidPNG(t *testing.T) {
+	if _, err := ComputeHistogram([]byte("not a png")); err == nil {
+		t.Error("ComputeHistogram() error = nil, want error")
+	}
+}
@@ -0,0 +1,164 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+const (
+	// JustNoticeableDelta is the CIE76 color difference generally considered
+	// the smallest change a viewer can notice. Pixels above it count as changed.
+	JustNoticeableDelta = 2.3
+
+	// heatmapMaxDelta is the color difference mapped to the hottest heatmap color.
+	// Larger differences saturate.
+	heatmapMaxDelta = 50.0
+)
+
+var (
+	// ErrDimensionMismatch indicates the compared images have different sizes
+	ErrDimensionMismatch = errors.New("images have different dimensions")
+)
+
+// DiffResult holds the output of a perceptual image comparison.
+type DiffResult struct {
+	// PNG is the encoded heatmap image.
+	PNG []byte
+
+	// MeanDelta is the average CIE76 color difference across all pixels.
+	MeanDelta float64
+
+	// ChangedRatio is the fraction of pixels whose difference exceeds
+	// JustNoticeableDelta (0-1).
+	ChangedRatio float64
+}
+
+// heatmapStops is the colormap from no difference (black) to maximum
+// difference (white), passing through blue, red and yellow.
+var heatmapStops = [...]color.RGBA{
+	{0, 0, 0, 255},
+	{40, 0, 140, 255},
+	{210, 30, 50, 255},
+	{255, 190, 0, 255},
+	{255, 255, 255, 255},
+}
+
+// srgbToLinear maps 8-bit sRGB channel values to linear light.
+var srgbToLinear = func() [256]float64 {
+	var lut [256]float64
+	for i := range lut {
+		c := float64(i) / 255
+		if c <= 0.04045 {
+			lut[i] = c / 12.92
+		} else {
+			lut[i] = math.Pow((c+0.055)/1.055, 2.4)
+		}
+	}
+	return lut
+}()
+
+// DiffHeatmap compares two PNG images and renders a heatmap of their
+// perceptual difference.
+//
+// Each pixel is converted to CIELAB and compared with the CIE76 distance,
+// which tracks perceived color difference far better than raw RGB deltas.
+// Alpha is ignored. Both images must have the same dimensions.
+func DiffHeatmap(pngA, pngB []byte) (DiffResult, error) {
+	imgA, err := png.Decode(bytes.NewReader(pngA))
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("failed to decode first image: %w", err)
+	}
+	imgB, err := png.Decode(bytes.NewReader(pngB))
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("failed to decode second image: %w", err)
+	}
+
+	boundsA, boundsB := imgA.Bounds(), imgB.Bounds()
+	if boundsA.Dx() != boundsB.Dx() || boundsA.Dy() != boundsB.Dy() {
+		return DiffResult{}, fmt.Errorf("%w: %dx%d vs %dx%d", ErrDimensionMismatch,
+			boundsA.Dx(), boundsA.Dy(), boundsB.Dx(), boundsB.Dy())
+	}
+
+	width, height := boundsA.Dx(), boundsA.Dy()
+	heatmap := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	var total float64
+	var changed int
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			l1, a1, b1 := toLab(imgA.At(boundsA.Min.X+x, boundsA.Min.Y+y))
+			l2, a2, b2 := toLab(imgB.At(boundsB.Min.X+x, boundsB.Min.Y+y))
+
+			delta := math.Sqrt((l1-l2)*(l1-l2) + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2))
+			total += delta
+			if delta > JustNoticeableDelta {
+				changed++
+			}
+
+			heatmap.SetRGBA(x, y, heatmapColor(delta/heatmapMaxDelta))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, heatmap); err != nil {
+		return DiffResult{}, fmt.Errorf("failed to encode heatmap: %w", err)
+	}
+
+	pixels := float64(width * height)
+	return DiffResult{
+		PNG:          buf.Bytes(),
+		MeanDelta:    total / pixels,
+		ChangedRatio: float64(changed) / pixels,
+	}, nil
+}
+
+// toLab converts a color to CIELAB (D65 white point).
+func toLab(c color.Color) (l, a, b float64) {
+	nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	r := srgbToLinear[nrgba.R]
+	g := srgbToLinear[nrgba.G]
+	bl := srgbToLinear[nrgba.B]
+
+	// Linear sRGB to XYZ, normalized by the D65 reference white
+	x := (0.4124*r + 0.3576*g + 0.1805*bl) / 0.95047
+	y := 0.2126*r + 0.7152*g + 0.0722*bl
+	z := (0.0193*r + 0.1192*g + 0.9505*bl) / 1.08883
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+// labF is the CIELAB companding function.
+func labF(t float64) float64 {
+	const epsilon = 216.0 / 24389.0
+	const kappa = 24389.0 / 27.0
+	if t > epsilon {
+		return math.Cbrt(t)
+	}
+	return (kappa*t + 16) / 116
+}
+
+// heatmapColor maps a normalized difference (0-1, clamped) onto heatmapStops.
+func heatmapColor(t float64) color.RGBA {
+	if t <= 0 {
+		return heatmapStops[0]
+	}
+	if t >= 1 {
+		return heatmapStops[len(heatmapStops)-1]
+	}
+
+	pos := t * float64(len(heatmapStops)-1)
+	i := int(pos)
+	frac := pos - float64(i)
+	lo, hi := heatmapStops[i], heatmapStops[i+1]
+
+	lerp := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*frac))
+	}
+	return color.RGBA{lerp(lo.R, hi.R), lerp(lo.G, hi.G), lerp(lo.B, hi.B), 255}
+}
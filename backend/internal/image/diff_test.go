@@ -0,0 +1,106 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// mustEncodeRGB encodes raw RGB pixels for use as a comparison input.
+func mustEncodeRGB(t *testing.T, width, height int, pixels []byte) []byte {
+	t.Helper()
+	pngData, err := EncodePNG(width, height, pixels, FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG failed: %v", err)
+	}
+	return pngData
+}
+
+func TestDiffHeatmap_Identical(t *testing.T) {
+	pixels := []byte{
+		255, 0, 0, 0, 255, 0,
+		0, 0, 255, 255, 255, 0,
+	}
+	a := mustEncodeRGB(t, 2, 2, pixels)
+
+	result, err := DiffHeatmap(a, a)
+	if err != nil {
+		t.Fatalf("DiffHeatmap failed: %v", err)
+	}
+	if result.MeanDelta != 0 || result.ChangedRatio != 0 {
+		t.Errorf("got mean=%v changed=%v, want 0 for identical images", result.MeanDelta, result.ChangedRatio)
+	}
+
+	img, err := png.Decode(bytes.NewReader(result.PNG))
+	if err != nil {
+		t.Fatalf("Failed to decode heatmap: %v", err)
+	}
+	if r, g, b, _ := img.At(1, 1).RGBA(); r != 0 || g != 0 || b != 0 {
+		t.Errorf("unchanged pixel = (%d,%d,%d), want black", r, g, b)
+	}
+}
+
+func TestDiffHeatmap_SinglePixelChange(t *testing.T) {
+	a := mustEncodeRGB(t, 2, 1, []byte{0, 0, 0, 0, 0, 0})
+	b := mustEncodeRGB(t, 2, 1, []byte{0, 0, 0, 255, 255, 255})
+
+	result, err := DiffHeatmap(a, b)
+	if err != nil {
+		t.Fatalf("DiffHeatmap failed: %v", err)
+	}
+
+	// Black to white is a lightness difference of 100
+	if math.Abs(result.MeanDelta-50) > 0.1 {
+		t.Errorf("MeanDelta = %v, want ~50", result.MeanDelta)
+	}
+	if result.ChangedRatio != 0.5 {
+		t.Errorf("ChangedRatio = %v, want 0.5", result.ChangedRatio)
+	}
+
+	img, err := png.Decode(bytes.NewReader(result.PNG))
+	if err != nil {
+		t.Fatalf("Failed to decode heatmap: %v", err)
+	}
+	if r, g, b, _ := img.At(1, 0).RGBA(); r>>8 != 255 || g>>8 != 255 || b>>8 != 255 {
+		t.Errorf("changed pixel = (%d,%d,%d), want saturated white", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestDiffHeatmap_SubtleChangeBelowThreshold(t *testing.T) {
+	a := mustEncodeRGB(t, 1, 1, []byte{128, 128, 128})
+	b := mustEncodeRGB(t, 1, 1, []byte{129, 128, 128})
+
+	result, err := DiffHeatmap(a, b)
+	if err != nil {
+		t.Fatalf("DiffHeatmap failed: %v", err)
+	}
+	if result.MeanDelta <= 0 {
+		t.Errorf("MeanDelta = %v, want > 0", result.MeanDelta)
+	}
+	if result.ChangedRatio != 0 {
+		t.Errorf("ChangedRatio = %v, want 0 for imperceptible change", result.ChangedRatio)
+	}
+}
+
+func TestDiffHeatmap_DimensionMismatch(t *testing.T) {
+	a := mustEncodeRGB(t, 1, 1, []byte{0, 0, 0})
+	b := mustEncodeRGB(t, 2, 1, []byte{0, 0, 0, 0, 0, 0})
+
+	_, err := DiffHeatmap(a, b)
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("got error %v, want ErrDimensionMismatch", err)
+	}
+}
+
+func TestDiffHeatmap_InvalidPNG(t *testing.T) {
+	a := mustEncodeRGB(t, 1, 1, []byte{0, 0, 0})
+
+	if _, err := DiffHeatmap([]byte("not a png"), a); err == nil {
+		t.Error("expected error for invalid first image")
+	}
+	if _, err := DiffHeatmap(a, []byte("not a png")); err == nil {
+		t.Error("expected error for invalid second image")
+	}
+}
@@ -0,0 +1,259 @@
+package image
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// a1111Keyword is the PNG text keyword AUTOMATIC1111's web UI (and
+	// Forge, SD.Next and others copying it) stores generation parameters under
+	a1111Keyword = "parameters"
+	// comfyUIKeyword is the PNG text keyword ComfyUI stores the executed
+	// workflow under, in its API format
+	comfyUIKeyword = "prompt"
+
+	// ParamsSourceA1111 marks parameters read from an AUTOMATIC1111 parameters chunk
+	ParamsSourceA1111 = "a1111"
+	// ParamsSourceComfyUI marks parameters read from a ComfyUI prompt chunk
+	ParamsSourceComfyUI = "comfyui"
+)
+
+// EmbeddedParameters is what another tool recorded about how it generated
+// an image. Fields the tool didn't record are zero, except Seed, which is
+// -1 (random) if unknown.
+type EmbeddedParameters struct {
+	// Source is ParamsSourceA1111 or ParamsSourceComfyUI
+	Source         string
+	Prompt         string
+	NegativePrompt string
+	Steps          int
+	CFG            float64
+	Seed           int64
+	Sampler        string
+	Width          int
+	Height         int
+	Model          string
+
+	// keyword and text are the PNG text chunk the parameters were read from
+	keyword string
+	text    string
+}
+
+// ParseEmbeddedParameters reads the generation parameters AUTOMATIC1111
+// or ComfyUI embed in the PNGs they write. ok is false if the data is not
+// a PNG or holds neither, or if no prompt can be found in it.
+func ParseEmbeddedParameters(pngData []byte) (meta EmbeddedParameters, ok bool) {
+	if text, found, err := PNGText(pngData, a1111Keyword); err == nil && found {
+		if meta, ok = parseA1111Parameters(text); ok {
+			meta.keyword, meta.text = a1111Keyword, text
+			return meta, true
+		}
+	}
+	if text, found, err := PNGText(pngData, comfyUIKeyword); err == nil && found {
+		if meta, ok = parseComfyUIPrompt(text); ok {
+			meta.keyword, meta.text = comfyUIKeyword, text
+			return meta, true
+		}
+	}
+	return EmbeddedParameters{}, false
+}
+
+// keepEmbeddedParameters copies the text chunk meta was read from into a
+// re-encoded PNG, so it can be parsed again later.
+func keepEmbeddedParameters(pngData []byte, meta EmbeddedParameters) ([]byte, error) {
+	return SetPNGText(pngData, meta.keyword, meta.text)
+}
+
+// parseA1111Parameters parses AUTOMATIC1111's infotext: the prompt, an
+// optional "Negative prompt: " section, and a last line of comma-separated
+// "Key: value" settings starting with "Steps: ".
+func parseA1111Parameters(text string) (EmbeddedParameters, bool) {
+	meta := EmbeddedParameters{Source: ParamsSourceA1111, Seed: -1}
+
+	lines := strings.Split(strings.ReplaceAll(strings.TrimSpace(text), "\r\n", "\n"), "\n")
+	if last := lines[len(lines)-1]; len(lines) > 1 && strings.HasPrefix(last, "Steps: ") {
+		applyA1111Settings(&meta, last)
+		lines = lines[:len(lines)-1]
+	}
+
+	var prompt, negative []string
+	inNegative := false
+	for _, line := range lines {
+		if rest, found := strings.CutPrefix(line, "Negative prompt:"); found && !inNegative {
+			inNegative = true
+			line = strings.TrimSpace(rest)
+		}
+		if inNegative {
+			negative = append(negative, line)
+		} else {
+			prompt = append(prompt, line)
+		}
+	}
+	meta.Prompt = strings.TrimSpace(strings.Join(prompt, "\n"))
+	meta.NegativePrompt = strings.TrimSpace(strings.Join(negative, "\n"))
+	return meta, meta.Prompt != ""
+}
+
+// applyA1111Settings sets the fields named in an infotext settings line.
+// Unknown keys and malformed values are ignored.
+func applyA1111Settings(meta *EmbeddedParameters, line string) {
+	for _, field := range splitA1111Settings(line) {
+		key, value, found := strings.Cut(field, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Steps":
+			if n, err := strconv.Atoi(value); err == nil {
+				meta.Steps = n
+			}
+		case "CFG scale":
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				meta.CFG = f
+			}
+		case "Seed":
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				meta.Seed = n
+			}
+		case "Sampler":
+			meta.Sampler = value
+		case "Size":
+			w, h, _ := strings.Cut(value, "x")
+			width, errW := strconv.Atoi(w)
+			height, errH := strconv.Atoi(h)
+			if errW == nil && errH == nil {
+				meta.Width, meta.Height = width, height
+			}
+		case "Model":
+			meta.Model = value
+		}
+	}
+}
+
+// splitA1111Settings splits a settings line on commas outside double
+// quotes; values such as LoRA hashes are quoted lists themselves.
+func splitA1111Settings(line string) []string {
+	var fields []string
+	start, quoted := 0, false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				fields = append(fields, line[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, line[start:])
+}
+
+// comfyUINode is a node of a ComfyUI workflow in API format. Inputs are
+// literal values or links, [nodeID, outputIndex], to other nodes.
+type comfyUINode struct {
+	ClassType string                     `json:"class_type"`
+	Inputs    map[string]json.RawMessage `json:"inputs"`
+}
+
+// parseComfyUIPrompt reads the settings of a ComfyUI workflow's first
+// sampler node, following its links to the text encoders, latent image and
+// checkpoint loader. Workflows with several samplers, such as hires fix
+// passes, are described by the one with the lowest node ID.
+func parseComfyUIPrompt(text string) (EmbeddedParameters, bool) {
+	var nodes map[string]comfyUINode
+	if err := json.Unmarshal([]byte(text), &nodes); err != nil {
+		return EmbeddedParameters{}, false
+	}
+
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, errA := strconv.Atoi(ids[i])
+		b, errB := strconv.Atoi(ids[j])
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return ids[i] < ids[j]
+	})
+
+	for _, id := range ids {
+		sampler := nodes[id]
+		if sampler.ClassType != "KSampler" && sampler.ClassType != "KSamplerAdvanced" {
+			continue
+		}
+
+		meta := EmbeddedParameters{Source: ParamsSourceComfyUI, Seed: -1}
+		meta.Prompt = comfyUIText(nodes, sampler.Inputs["positive"])
+		meta.NegativePrompt = comfyUIText(nodes, sampler.Inputs["negative"])
+		if steps, ok := comfyUINumber(sampler.Inputs["steps"]); ok {
+			meta.Steps = int(steps)
+		}
+		if cfg, ok := comfyUINumber(sampler.Inputs["cfg"]); ok {
+			meta.CFG = cfg
+		}
+		for _, name := range []string{"seed", "noise_seed"} {
+			if seed, ok := comfyUINumber(sampler.Inputs[name]); ok {
+				meta.Seed = int64(seed)
+			}
+		}
+		_ = json.Unmarshal(sampler.Inputs["sampler_name"], &meta.Sampler)
+		if latent, ok := comfyUILinked(nodes, sampler.Inputs["latent_image"]); ok {
+			width, okW := comfyUINumber(latent.Inputs["width"])
+			height, okH := comfyUINumber(latent.Inputs["height"])
+			if okW && okH {
+				meta.Width, meta.Height = int(width), int(height)
+			}
+		}
+		if loader, ok := comfyUILinked(nodes, sampler.Inputs["model"]); ok {
+			_ = json.Unmarshal(loader.Inputs["ckpt_name"], &meta.Model)
+		}
+		return meta, meta.Prompt != ""
+	}
+	return EmbeddedParameters{}, false
+}
+
+// comfyUILinked returns the node an input links to.
+func comfyUILinked(nodes map[string]comfyUINode, input json.RawMessage) (comfyUINode, bool) {
+	var link []json.RawMessage
+	if err := json.Unmarshal(input, &link); err != nil || len(link) != 2 {
+		return comfyUINode{}, false
+	}
+	var id string
+	if err := json.Unmarshal(link[0], &id); err != nil {
+		return comfyUINode{}, false
+	}
+	node, ok := nodes[id]
+	return node, ok
+}
+
+// comfyUIText returns the text of the encoder a conditioning input links
+// to: its text input, or text_g for SDXL's dual encoder.
+func comfyUIText(nodes map[string]comfyUINode, input json.RawMessage) string {
+	encoder, ok := comfyUILinked(nodes, input)
+	if !ok {
+		return ""
+	}
+	for _, name := range []string{"text", "text_g"} {
+		var text string
+		if err := json.Unmarshal(encoder.Inputs[name], &text); err == nil && text != "" {
+			return strings.TrimSpace(text)
+		}
+	}
+	return ""
+}
+
+// comfyUINumber returns a literal numeric input.
+func comfyUINumber(input json.RawMessage) (float64, bool) {
+	var n float64
+	if err := json.Unmarshal(input, &n); err != nil {
+		return 0, false
+	}
+	return n, true
+}
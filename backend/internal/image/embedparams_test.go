@@ -0,0 +1,124 @@
+package image
+
+import (
+	"testing"
+)
+
+const testA1111Parameters = `masterpiece, a lighthouse at dusk,
+dramatic sky
+Negative prompt: blurry, lowres
+Steps: 28, Sampler: DPM++ 2M Karras, CFG scale: 6.5, Seed: 1234567890, Size: 832x1216, Model hash: 31e35c80fc, Model: sd_xl_base_1.0, Lora hashes: "detail: abc123, style: def456", Version: v1.7.0`
+
+const testComfyUIPrompt = `{
+  "3": {"class_type": "KSampler", "inputs": {"seed": 42, "steps": 30, "cfg": 4.5, "sampler_name": "euler", "scheduler": "sgm_uniform", "denoise": 1, "model": ["4", 0], "positive": ["6", 0], "negative": ["7", 0], "latent_image": ["5", 0]}},
+  "4": {"class_type": "CheckpointLoaderSimple", "inputs": {"ckpt_name": "sd3.5_medium.safetensors"}},
+  "5": {"class_type": "EmptySD3LatentImage", "inputs": {"width": 1024, "height": 768, "batch_size": 1}},
+  "6": {"class_type": "CLIPTextEncode", "inputs": {"text": "a red fox in fresh snow", "clip": ["4", 1]}},
+  "7": {"class_type": "CLIPTextEncode", "inputs": {"text": "", "clip": ["4", 1]}},
+  "12": {"class_type": "KSampler", "inputs": {"seed": 7, "steps": 10, "cfg": 1, "positive": ["6", 0], "negative": ["7", 0], "latent_image": ["5", 0]}}
+}`
+
+// pngWithText returns a test PNG holding text under keyword.
+func pngWithText(t *testing.T, keyword, text string) []byte {
+	t.Helper()
+
+	data, err := SetPNGText(encodeTestImage(t, "png", 64, 64), keyword, text)
+	if err != nil {
+		t.Fatalf("SetPNGText() error = %v", err)
+	}
+	return data
+}
+
+func TestParseEmbeddedParameters(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		want   EmbeddedParameters
+		wantOK bool
+	}{
+		{
+			name: "a1111",
+			data: pngWithText(t, "parameters", testA1111Parameters),
+			want: EmbeddedParameters{
+				Source:         ParamsSourceA1111,
+				Prompt:         "masterpiece, a lighthouse at dusk,\ndramatic sky",
+				NegativePrompt: "blurry, lowres",
+				Steps:          28,
+				CFG:            6.5,
+				Seed:           1234567890,
+				Sampler:        "DPM++ 2M Karras",
+				Width:          832,
+				Height:         1216,
+				Model:          "sd_xl_base_1.0",
+			},
+			wantOK: true,
+		},
+		{
+			name:   "a1111 prompt only",
+			data:   pngWithText(t, "parameters", "a quiet harbor"),
+			want:   EmbeddedParameters{Source: ParamsSourceA1111, Prompt: "a quiet harbor", Seed: -1},
+			wantOK: true,
+		},
+		{
+			name: "comfyui",
+			data: pngWithText(t, "prompt", testComfyUIPrompt),
+			want: EmbeddedParameters{
+				Source:  ParamsSourceComfyUI,
+				Prompt:  "a red fox in fresh snow",
+				Steps:   30,
+				CFG:     4.5,
+				Seed:    42,
+				Sampler: "euler",
+				Width:   1024,
+				Height:  768,
+				Model:   "sd3.5_medium.safetensors",
+			},
+			wantOK: true,
+		},
+		{name: "no parameters", data: encodeTestImage(t, "png", 64, 64)},
+		{name: "comfyui without sampler", data: pngWithText(t, "prompt", `{"1": {"class_type": "LoadImage", "inputs": {}}}`)},
+		{name: "not json", data: pngWithText(t, "prompt", "a lighthouse")},
+		{name: "empty parameters", data: pngWithText(t, "parameters", "  ")},
+		{name: "jpeg", data: encodeTestImage(t, "jpeg", 64, 64)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseEmbeddedParameters(tt.data)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseEmbeddedParameters() ok = %v, want %v", ok, tt.wantOK)
+			}
+			got.keyword, got.text = "", ""
+			if got != tt.want {
+				t.Errorf("ParseEmbeddedParameters() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeUpload_KeepsEmbeddedParameters(t *testing.T) {
+	data, err := SetPNGText(pngWithText(t, "parameters", testA1111Parameters), "Comment", "private note")
+	if err != nil {
+		t.Fatalf("SetPNGText() error = %v", err)
+	}
+
+	upload, err := NormalizeUpload(data)
+	if err != nil {
+		t.Fatalf("NormalizeUpload() error = %v", err)
+	}
+	if upload.Parameters == nil || upload.Parameters.Steps != 28 {
+		t.Fatalf("Parameters = %+v, want the A1111 parameters", upload.Parameters)
+	}
+
+	// The stored PNG can be parsed again, but other text is dropped
+	if meta, ok := ParseEmbeddedParameters(upload.PNG); !ok || meta.Prompt != upload.Parameters.Prompt {
+		t.Errorf("ParseEmbeddedParameters(upload.PNG) = %+v, %v, want the same parameters", meta, ok)
+	}
+	if _, found, _ := PNGText(upload.PNG, "Comment"); found {
+		t.Error("NormalizeUpload() kept an unrelated text chunk")
+	}
+
+	if plain, err := NormalizeUpload(encodeTestImage(t, "png", 64, 64)); err != nil || plain.Parameters != nil {
+		t.Errorf("NormalizeUpload() without parameters = %+v, %v, want nil Parameters", plain.Parameters, err)
+	}
+}
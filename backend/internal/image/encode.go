@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"errors"
 	"image"
+	"image/jpeg"
 	"image/png"
 	"math"
+
+	"github.com/gen2brain/webp"
 )
 
 // PixelFormat specifies the format of raw pixel data
@@ -97,3 +100,64 @@ func EncodePNG(width, height int, pixels []byte, format PixelFormat) ([]byte, er
 
 	return buf.Bytes(), nil
 }
+
+// EncodeJPEG converts raw RGB pixel data to JPEG at the given quality
+// (1-100). JPEG has no alpha, so only FormatRGB data is accepted; it is
+// meant for small, lossy images such as generation previews.
+func EncodeJPEG(width, height int, pixels []byte, quality int) ([]byte, error) {
+	img, err := rgbImage(width, height, pixels)
+	if err != nil {
+		return nil, err
+	}
+	return encodeLossy(img, OutputJPEG, quality)
+}
+
+// EncodeWebP converts raw RGB pixel data to lossy WebP at the given
+// quality (1-100). Only FormatRGB data is accepted, as for EncodeJPEG.
+func EncodeWebP(width, height int, pixels []byte, quality int) ([]byte, error) {
+	img, err := rgbImage(width, height, pixels)
+	if err != nil {
+		return nil, err
+	}
+	return encodeLossy(img, OutputWebP, quality)
+}
+
+// rgbImage wraps raw RGB pixel data in an opaque image.
+func rgbImage(width, height int, pixels []byte) (*image.RGBA, error) {
+	if width <= 0 || height <= 0 {
+		return nil, ErrInvalidDimensions
+	}
+	if width > MaxImageDimension || height > MaxImageDimension {
+		return nil, errors.New("dimensions exceed maximum allowed (4096x4096)")
+	}
+	if len(pixels) != width*height*3 {
+		return nil, ErrInvalidPixelDataLength
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		img.Pix[i*4] = pixels[i*3]
+		img.Pix[i*4+1] = pixels[i*3+1]
+		img.Pix[i*4+2] = pixels[i*3+2]
+		img.Pix[i*4+3] = 255
+	}
+	return img, nil
+}
+
+// encodeLossy encodes an image as JPEG or WebP at the given quality.
+func encodeLossy(img image.Image, format OutputFormat, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case OutputJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case OutputWebP:
+		err = webp.Encode(&buf, img, webp.Options{Quality: quality, Method: webp.DefaultMethod})
+	default:
+		return nil, ErrUnknownOutputFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -2,8 +2,12 @@ package image
 
 import (
 	"bytes"
+	"errors"
+	"image/jpeg"
 	"image/png"
 	"testing"
+
+	"github.com/gen2brain/webp"
 )
 
 func TestEncodePNG_RGB_SolidColor(t *testing.T) {
@@ -238,3 +242,56 @@ func TestEncodePNG_MaxDimensions(t *testing.T) {
 		t.Errorf("max dimensions should work: %v", err)
 	}
 }
+
+func TestEncodeJPEG(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		pixels        []byte
+		wantErr       error
+	}{
+		{name: "valid", width: 2, height: 1, pixels: []byte{255, 0, 0, 0, 0, 255}},
+		{name: "zero width", width: 0, height: 1, pixels: nil, wantErr: ErrInvalidDimensions},
+		{name: "rgba data", width: 2, height: 1, pixels: make([]byte, 8), wantErr: ErrInvalidPixelDataLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeJPEG(tt.width, tt.height, tt.pixels, 70)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("EncodeJPEG() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EncodeJPEG() error = %v", err)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("jpeg.Decode() error = %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+				t.Errorf("decoded size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestEncodeWebP(t *testing.T) {
+	data, err := EncodeWebP(2, 1, []byte{255, 0, 0, 0, 0, 255}, 80)
+	if err != nil {
+		t.Fatalf("EncodeWebP() error = %v", err)
+	}
+	img, err := webp.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("webp.Decode() error = %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 2 || b.Dy() != 1 {
+		t.Errorf("decoded size = %dx%d, want 2x1", b.Dx(), b.Dy())
+	}
+
+	if _, err := EncodeWebP(2, 1, make([]byte, 8), 80); !errors.Is(err, ErrInvalidPixelDataLength) {
+		t.Errorf("EncodeWebP() with RGBA data error = %v, want %v", err, ErrInvalidPixelDataLength)
+	}
+}
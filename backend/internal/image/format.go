@@ -0,0 +1,112 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Registers JPEG for Convert
+	"image/png"
+	"strings"
+
+	_ "github.com/gen2brain/webp" // Registers WebP for Convert
+)
+
+// OutputFormat is an encoding images can be served and stored in. Images
+// are always generated as PNG.
+type OutputFormat string
+
+const (
+	// OutputPNG is lossless and carries metadata such as provenance manifests
+	OutputPNG OutputFormat = "png"
+	// OutputJPEG is lossy and supported everywhere
+	OutputJPEG OutputFormat = "jpeg"
+	// OutputWebP is lossy and several times smaller than PNG for
+	// photographic images
+	OutputWebP OutputFormat = "webp"
+
+	// DefaultQuality is the quality of lossy output unless configured
+	DefaultQuality = 90
+	// MinQuality and MaxQuality bound the quality of lossy output
+	MinQuality = 1
+	MaxQuality = 100
+)
+
+// ErrUnknownOutputFormat indicates an output format other than png, jpeg or webp
+var ErrUnknownOutputFormat = errors.New("format must be png, jpeg or webp")
+
+// ParseOutputFormat parses a format name, case-insensitively. "jpg" is
+// accepted for OutputJPEG.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "png":
+		return OutputPNG, nil
+	case "jpeg", "jpg":
+		return OutputJPEG, nil
+	case "webp":
+		return OutputWebP, nil
+	}
+	return "", ErrUnknownOutputFormat
+}
+
+// ContentType returns the MIME type of the format.
+func (f OutputFormat) ContentType() string {
+	return "image/" + string(f)
+}
+
+// Extension returns the file extension of the format, with its dot.
+func (f OutputFormat) Extension() string {
+	if f == OutputJPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+// DetectFormat returns the format of encoded image data: PNG, JPEG or WebP.
+// Only the header is read.
+func DetectFormat(data []byte) (OutputFormat, error) {
+	_, name, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	format, err := ParseOutputFormat(name)
+	if err != nil {
+		return "", fmt.Errorf("unsupported image format %q", name)
+	}
+	return format, nil
+}
+
+// Convert re-encodes a PNG, JPEG or WebP in the given format at quality
+// (MinQuality to MaxQuality), which lossless PNG ignores. Data already in
+// the format is returned unchanged. Metadata in PNG text chunks is not
+// carried over.
+func Convert(data []byte, format OutputFormat, quality int) ([]byte, error) {
+	source, err := DetectFormat(data)
+	if err != nil {
+		return nil, err
+	}
+	if source == format {
+		return data, nil
+	}
+	if format != OutputPNG && (quality < MinQuality || quality > MaxQuality) {
+		return nil, fmt.Errorf("quality must be between %d and %d", MinQuality, MaxQuality)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", source, err)
+	}
+
+	if format == OutputPNG {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("failed to encode png: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	encoded, err := encodeLossy(img, format, quality)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+	return encoded, nil
+}
@@ -0,0 +1,120 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"image/jpeg"
+	"math/rand"
+	"testing"
+
+	"github.com/gen2brain/webp"
+)
+
+// noisePNG returns a PNG of random pixels, which compresses about as
+// poorly as a photograph.
+func noisePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	rng := rand.New(rand.NewSource(1))
+	pixels := make([]byte, width*height*3)
+	for i := range pixels {
+		// Smooth noise, so lossy formats have something to keep
+		pixels[i] = byte(i/3%width + rng.Intn(32))
+	}
+	data, err := EncodePNG(width, height, pixels, FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	return data
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    OutputFormat
+		wantErr error
+	}{
+		{name: "png", want: OutputPNG},
+		{name: "JPEG", want: OutputJPEG},
+		{name: "jpg", want: OutputJPEG},
+		{name: " webp ", want: OutputWebP},
+		{name: "gif", wantErr: ErrUnknownOutputFormat},
+		{name: "", wantErr: ErrUnknownOutputFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOutputFormat(tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseOutputFormat(%q) error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseOutputFormat(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	pngData := noisePNG(t, 64, 64)
+
+	got, err := Convert(pngData, OutputPNG, 0)
+	if err != nil || !bytes.Equal(got, pngData) {
+		t.Errorf("Convert(png) = %d bytes, %v, want the PNG unchanged", len(got), err)
+	}
+
+	jpegData, err := Convert(pngData, OutputJPEG, 80)
+	if err != nil {
+		t.Fatalf("Convert(jpeg) error = %v", err)
+	}
+	if img, err := jpeg.Decode(bytes.NewReader(jpegData)); err != nil || img.Bounds().Dx() != 64 {
+		t.Errorf("Convert(jpeg) did not produce a 64x64 JPEG: %v", err)
+	}
+
+	webpData, err := Convert(pngData, OutputWebP, 80)
+	if err != nil {
+		t.Fatalf("Convert(webp) error = %v", err)
+	}
+	if img, err := webp.Decode(bytes.NewReader(webpData)); err != nil || img.Bounds().Dx() != 64 {
+		t.Errorf("Convert(webp) did not produce a 64x64 WebP: %v", err)
+	}
+	if len(webpData) >= len(pngData) {
+		t.Errorf("WebP is %d bytes, want smaller than the %d byte PNG", len(webpData), len(pngData))
+	}
+
+	if _, err := Convert(pngData, OutputWebP, 0); err == nil {
+		t.Error("Convert() with quality 0 error = nil, want error")
+	}
+	if _, err := Convert([]byte("not a png"), OutputJPEG, 80); err == nil {
+		t.Error("Convert() of invalid PNG error = nil, want error")
+	}
+
+	got, err = Convert(webpData, OutputWebP, 50)
+	if err != nil || !bytes.Equal(got, webpData) {
+		t.Errorf("Convert(webp to webp) = %d bytes, %v, want the WebP unchanged", len(got), err)
+	}
+	backToPNG, err := Convert(webpData, OutputPNG, 0)
+	if err != nil {
+		t.Fatalf("Convert(webp to png) error = %v", err)
+	}
+	if format, err := DetectFormat(backToPNG); err != nil || format != OutputPNG {
+		t.Errorf("DetectFormat() of WebP converted to PNG = %q, %v, want png", format, err)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	pngData := noisePNG(t, 8, 8)
+	for _, want := range []OutputFormat{OutputPNG, OutputJPEG, OutputWebP} {
+		data, err := Convert(pngData, want, 80)
+		if err != nil {
+			t.Fatalf("Convert(%s) error = %v", want, err)
+		}
+		if got, err := DetectFormat(data); err != nil || got != want {
+			t.Errorf("DetectFormat() = %q, %v, want %q", got, err, want)
+		}
+	}
+
+	if _, err := DetectFormat([]byte("not an image")); err == nil {
+		t.Error("DetectFormat() of invalid data error = nil, want error")
+	}
+}
@@ -0,0 +1,112 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// InitImageRGB decodes a PNG and returns it as raw RGB pixels of exactly
+// width x height, the form compute takes img2img init images in. The image
+// is scaled to cover the target and centre-cropped, so the aspect ratio is
+// kept; transparent areas become black.
+//
+// Returns ErrInvalidDimensions if the PNG or target is larger than
+// MaxImageDimension or the target is empty.
+func InitImageRGB(pngData []byte, width, height int) ([]byte, error) {
+	if width <= 0 || height <= 0 || width > MaxImageDimension || height > MaxImageDimension {
+		return nil, fmt.Errorf("%w: %dx%d", ErrInvalidDimensions, width, height)
+	}
+	src, err := decodeBounded(pngData)
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	if b.Empty() {
+		return nil, fmt.Errorf("%w: image is empty", ErrInvalidDimensions)
+	}
+
+	// Scale by the larger ratio so the image covers the target, then take
+	// the centre of what overflows
+	scale := max(float64(width)/float64(b.Dx()), float64(height)/float64(b.Dy()))
+	offsetX := (float64(b.Dx())*scale - float64(width)) / 2
+	offsetY := (float64(b.Dy())*scale - float64(height)) / 2
+
+	pixels := make([]byte, 0, width*height*3)
+	for y := 0; y < height; y++ {
+		sy := (float64(y)+offsetY+0.5)/scale - 0.5
+		for x := 0; x < width; x++ {
+			sx := (float64(x)+offsetX+0.5)/scale - 0.5
+			c := sampleBilinear(src, sx, sy)
+			pixels = append(pixels, c.R, c.G, c.B)
+		}
+	}
+	return pixels, nil
+}
+
+// DecodeRGB decodes a PNG into raw RGB pixels at its own size, the form
+// compute takes images to upscale in. Transparent areas become black.
+//
+// Returns ErrInvalidDimensions if the PNG is empty or larger than
+// MaxImageDimension.
+func DecodeRGB(pngData []byte) (pixels []byte, width, height int, err error) {
+	src, err := decodeBounded(pngData)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	b := src.Bounds()
+	if b.Empty() {
+		return nil, 0, 0, fmt.Errorf("%w: image is empty", ErrInvalidDimensions)
+	}
+
+	pixels = make([]byte, 0, b.Dx()*b.Dy()*3)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			// RGBA() is premultiplied 16-bit; dropping alpha leaves black
+			r, g, bl, _ := src.At(x, y).RGBA()
+			pixels = append(pixels, uint8(r>>8), uint8(g>>8), uint8(bl>>8))
+		}
+	}
+	return pixels, b.Dx(), b.Dy(), nil
+}
+
+// sampleBilinear returns the colour at (x, y), relative to the top-left of
+// src's bounds, interpolated between the four nearest pixels. Coordinates
+// outside the image are clamped to its edge.
+func sampleBilinear(src image.Image, x, y float64) color.RGBA {
+	b := src.Bounds()
+	x0, fx := splitCoord(x, b.Dx())
+	y0, fy := splitCoord(y, b.Dy())
+	x1 := min(x0+1, b.Dx()-1)
+	y1 := min(y0+1, b.Dy()-1)
+
+	at := func(px, py int) [3]float64 {
+		r, g, bl, _ := src.At(b.Min.X+px, b.Min.Y+py).RGBA()
+		return [3]float64{float64(r), float64(g), float64(bl)}
+	}
+	tl, tr, bl, br := at(x0, y0), at(x1, y0), at(x0, y1), at(x1, y1)
+
+	var out [3]uint8
+	for i := range out {
+		top := tl[i]*(1-fx) + tr[i]*fx
+		bottom := bl[i]*(1-fx) + br[i]*fx
+		// RGBA() is premultiplied 16-bit; dropping alpha leaves black
+		out[i] = toChannel((top*(1-fy) + bottom*fy) / 0xffff)
+	}
+	return color.RGBA{R: out[0], G: out[1], B: out[2], A: 0xff}
+}
+
+// splitCoord clamps a sample coordinate to [0, size-1] and splits it into
+// the pixel index and the fraction towards the next pixel.
+func splitCoord(v float64, size int) (int, float64) {
+	if v <= 0 {
+		return 0, 0
+	}
+	if v >= float64(size-1) {
+		return size - 1, 0
+	}
+	i := int(v)
+	return i, v - float64(i)
+}
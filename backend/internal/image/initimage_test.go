@@ -0,0 +1,92 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestInitImageRGB(t *testing.T) {
+	red, blue := []byte{255, 0, 0}, []byte{0, 0, 255}
+
+	tests := []struct {
+		name          string
+		src           []byte
+		width, height int
+		want          []byte
+	}{
+		{
+			name:   "same size is identity",
+			src:    mustEncodeRGB(t, 2, 1, []byte{100, 20, 20, 128, 128, 128}),
+			width:  2,
+			height: 1,
+			want:   []byte{100, 20, 20, 128, 128, 128},
+		},
+		{
+			name:   "upscale a flat image",
+			src:    mustEncodeRGB(t, 1, 1, red),
+			width:  2,
+			height: 2,
+			want:   bytes.Repeat(red, 4),
+		},
+		{
+			name: "wide image is centre-cropped",
+			// 4x2: red, red, blue, blue on both rows
+			src:    mustEncodeRGB(t, 4, 2, bytes.Repeat(append(append(append(append([]byte{}, red...), red...), blue...), blue...), 2)),
+			width:  2,
+			height: 2,
+			want:   bytes.Repeat(append(append([]byte{}, red...), blue...), 2),
+		},
+		{
+			name:   "downscale a flat image",
+			src:    mustEncodeRGB(t, 8, 8, bytes.Repeat(blue, 64)),
+			width:  2,
+			height: 2,
+			want:   bytes.Repeat(blue, 4),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InitImageRGB(tt.src, tt.width, tt.height)
+			if err != nil {
+				t.Fatalf("InitImageRGB() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("InitImageRGB() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitImageRGB_Invalid(t *testing.T) {
+	src := mustEncodeRGB(t, 1, 1, []byte{1, 2, 3})
+
+	if _, err := InitImageRGB(src, 0, 64); !errors.Is(err, ErrInvalidDimensions) {
+		t.Errorf("zero width: error = %v, want %v", err, ErrInvalidDimensions)
+	}
+	if _, err := InitImageRGB(src, 64, MaxImageDimension+1); !errors.Is(err, ErrInvalidDimensions) {
+		t.Errorf("oversized target: error = %v, want %v", err, ErrInvalidDimensions)
+	}
+	if _, err := InitImageRGB([]byte("not a png"), 64, 64); err == nil {
+		t.Error("invalid PNG: expected error")
+	}
+}
+
+func TestDecodeRGB(t *testing.T) {
+	src := mustEncodeRGB(t, 2, 1, []byte{100, 20, 20, 128, 128, 128})
+	pixels, width, height, err := DecodeRGB(src)
+	if err != nil {
+		t.Fatalf("DecodeRGB() error = %v", err)
+	}
+	if width != 2 || height != 1 {
+		t.Errorf("DecodeRGB() size = %dx%d, want 2x1", width, height)
+	}
+	if want := []byte{100, 20, 20, 128, 128, 128}; !bytes.Equal(pixels, want) {
+		t.Errorf("DecodeRGB() pixels = %v, want %v", pixels, want)
+	}
+
+	if _, _, _, err := DecodeRGB([]byte("not a png")); err == nil {
+		t.Error("DecodeRGB(invalid) error = nil, want error")
+	}
+}
@@ -0,0 +1,46 @@
+package image
+
+import "fmt"
+
+// InpaintMask decodes a PNG mask and returns it as one byte per pixel at
+// exactly width x height, scaled and cropped the same way as InitImageRGB so
+// it lines up with the init image. White marks pixels to redraw and black
+// (or transparent) pixels to keep; grey values blend.
+//
+// Returns ErrInvalidDimensions as InitImageRGB does.
+func InpaintMask(pngData []byte, width, height int) ([]byte, error) {
+	rgb, err := InitImageRGB(pngData, width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	mask := make([]byte, width*height)
+	for i := range mask {
+		r, g, b := int(rgb[i*3]), int(rgb[i*3+1]), int(rgb[i*3+2])
+		// Rec. 601 luma, so any painted colour counts in proportion to its lightness
+		mask[i] = uint8((299*r + 587*g + 114*b + 500) / 1000)
+	}
+	return mask, nil
+}
+
+// CompositeMasked blends generated over base, both raw RGB pixels of the
+// same size, by mask (one byte per pixel): where the mask is 255 the
+// generated pixel is kept, where it is 0 the base pixel, and in between a
+// mix. Inpainting redraws the whole image, so this puts back what the mask
+// did not select. The result is written to a new slice.
+//
+// Returns ErrInvalidPixelDataLength if the lengths do not match.
+func CompositeMasked(base, generated, mask []byte) ([]byte, error) {
+	if len(base) != len(generated) || len(base) != len(mask)*3 {
+		return nil, fmt.Errorf("%w: base %d, generated %d and mask %d bytes", ErrInvalidPixelDataLength, len(base), len(generated), len(mask))
+	}
+
+	out := make([]byte, len(base))
+	for i, m := range mask {
+		for c := 0; c < 3; c++ {
+			j := i*3 + c
+			out[j] = uint8((int(generated[j])*int(m) + int(base[j])*(255-int(m)) + 127) / 255)
+		}
+	}
+	return out, nil
+}
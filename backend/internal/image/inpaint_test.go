@@ -0,0 +1,45 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestInpaintMask(t *testing.T) {
+	// 2x1: white on the left, black on the right
+	src := mustEncodeRGB(t, 2, 1, []byte{255, 255, 255, 0, 0, 0})
+
+	got, err := InpaintMask(src, 2, 1)
+	if err != nil {
+		t.Fatalf("InpaintMask() error = %v", err)
+	}
+	if want := []byte{255, 0}; !bytes.Equal(got, want) {
+		t.Errorf("InpaintMask() = %v, want %v", got, want)
+	}
+
+	if _, err := InpaintMask(src, 0, 1); !errors.Is(err, ErrInvalidDimensions) {
+		t.Errorf("zero width: error = %v, want %v", err, ErrInvalidDimensions)
+	}
+}
+
+func TestCompositeMasked(t *testing.T) {
+	base := []byte{10, 20, 30, 10, 20, 30, 0, 0, 0}
+	generated := []byte{200, 210, 220, 200, 210, 220, 255, 255, 255}
+
+	got, err := CompositeMasked(base, generated, []byte{0, 255, 128})
+	if err != nil {
+		t.Fatalf("CompositeMasked() error = %v", err)
+	}
+	want := []byte{10, 20, 30, 200, 210, 220, 128, 128, 128}
+	if !bytes.Equal(got, want) {
+		t.Errorf("CompositeMasked() = %v, want %v", got, want)
+	}
+
+	if _, err := CompositeMasked(base, generated[:3], []byte{0, 255, 128}); !errors.Is(err, ErrInvalidPixelDataLength) {
+		t.Errorf("mismatched lengths: error = %v, want %v", err, ErrInvalidPixelDataLength)
+	}
+	if _, err := CompositeMasked(base, generated, []byte{0}); !errors.Is(err, ErrInvalidPixelDataLength) {
+		t.Errorf("short mask: error = %v, want %v", err, ErrInvalidPixelDataLength)
+	}
+}
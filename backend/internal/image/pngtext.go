@@ -0,0 +1,197 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// pngSignature is the 8-byte header every PNG file starts with.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+var (
+	// ErrInvalidPNG indicates data is not a well-formed PNG chunk stream
+	ErrInvalidPNG = errors.New("invalid PNG")
+	// ErrInvalidKeyword indicates a PNG text keyword is empty, too long or not printable
+	ErrInvalidKeyword = errors.New("invalid PNG text keyword")
+)
+
+// pngChunk is one chunk of a PNG file. raw holds the complete chunk
+// (length, type, data and CRC) so untouched chunks are copied byte for byte.
+type pngChunk struct {
+	typ  string
+	data []byte
+	raw  []byte
+}
+
+// SetPNGText stores text under keyword in an iTXt chunk, replacing any
+// existing text chunk with the same keyword. The chunk is placed just
+// before IEND; all other chunks are kept unchanged.
+//
+// Keywords are 1-79 printable ASCII characters without leading or trailing
+// spaces. Text is stored as uncompressed UTF-8.
+func SetPNGText(pngData []byte, keyword, text string) ([]byte, error) {
+	if err := validateKeyword(keyword); err != nil {
+		return nil, err
+	}
+	chunks, err := parsePNGChunks(pngData)
+	if err != nil {
+		return nil, err
+	}
+
+	// keyword, null, compression flag and method, empty language tag and
+	// translated keyword, then the text
+	data := make([]byte, 0, len(keyword)+5+len(text))
+	data = append(data, keyword...)
+	data = append(data, 0, 0, 0, 0, 0)
+	data = append(data, text...)
+
+	var buf bytes.Buffer
+	buf.Grow(len(pngData) + len(data) + 12)
+	buf.Write(pngSignature)
+	for _, c := range chunks {
+		if isTextChunk(c, keyword) {
+			continue
+		}
+		if c.typ == "IEND" {
+			writePNGChunk(&buf, "iTXt", data)
+		}
+		buf.Write(c.raw)
+	}
+	return buf.Bytes(), nil
+}
+
+// PNGText returns the text stored under keyword in a tEXt or uncompressed
+// iTXt chunk. ok is false if there is no such chunk.
+func PNGText(pngData []byte, keyword string) (text string, ok bool, err error) {
+	chunks, err := parsePNGChunks(pngData)
+	if err != nil {
+		return "", false, err
+	}
+	for _, c := range chunks {
+		if !isTextChunk(c, keyword) {
+			continue
+		}
+		value := c.data[len(keyword)+1:]
+		if c.typ == "tEXt" {
+			return string(value), true, nil
+		}
+		if c.typ != "iTXt" || len(value) < 2 || value[0] != 0 {
+			// zTXt and compressed iTXt are not supported
+			continue
+		}
+		// Skip compression method, language tag and translated keyword
+		rest := value[2:]
+		for skip := 0; skip < 2; skip++ {
+			i := bytes.IndexByte(rest, 0)
+			if i < 0 {
+				return "", false, fmt.Errorf("%w: malformed iTXt chunk", ErrInvalidPNG)
+			}
+			rest = rest[i+1:]
+		}
+		return string(rest), true, nil
+	}
+	return "", false, nil
+}
+
+// RemovePNGText removes every text chunk stored under keyword.
+// Other chunks are copied unchanged, so removing text added by SetPNGText
+// restores the original file.
+func RemovePNGText(pngData []byte, keyword string) ([]byte, error) {
+	chunks, err := parsePNGChunks(pngData)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(pngData))
+	buf.Write(pngSignature)
+	for _, c := range chunks {
+		if !isTextChunk(c, keyword) {
+			buf.Write(c.raw)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// parsePNGChunks splits a PNG into chunks, checking lengths and CRCs.
+// The stream must start with the PNG signature and end with IEND.
+func parsePNGChunks(pngData []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(pngData, pngSignature) {
+		return nil, fmt.Errorf("%w: missing signature", ErrInvalidPNG)
+	}
+
+	var chunks []pngChunk
+	rest := pngData[len(pngSignature):]
+	for len(rest) > 0 {
+		if len(rest) < 12 {
+			return nil, fmt.Errorf("%w: truncated chunk", ErrInvalidPNG)
+		}
+		length := binary.BigEndian.Uint32(rest[:4])
+		if uint64(length) > uint64(len(rest)-12) {
+			return nil, fmt.Errorf("%w: chunk length %d exceeds data", ErrInvalidPNG, length)
+		}
+		end := 8 + int(length)
+		c := pngChunk{
+			typ:  string(rest[4:8]),
+			data: rest[8:end],
+			raw:  rest[:end+4],
+		}
+		if crc32.ChecksumIEEE(rest[4:end]) != binary.BigEndian.Uint32(rest[end:end+4]) {
+			return nil, fmt.Errorf("%w: bad CRC in %s chunk", ErrInvalidPNG, c.typ)
+		}
+		chunks = append(chunks, c)
+		rest = rest[end+4:]
+		if c.typ == "IEND" {
+			break
+		}
+	}
+
+	if len(chunks) == 0 || chunks[len(chunks)-1].typ != "IEND" {
+		return nil, fmt.Errorf("%w: missing IEND chunk", ErrInvalidPNG)
+	}
+	return chunks, nil
+}
+
+// writePNGChunk appends a chunk with its length and CRC.
+func writePNGChunk(buf *bytes.Buffer, typ string, data []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], typ)
+	buf.Write(header[:])
+	buf.Write(data)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	buf.Write(sum[:])
+}
+
+// isTextChunk reports whether c is a tEXt, zTXt or iTXt chunk for keyword.
+func isTextChunk(c pngChunk, keyword string) bool {
+	if c.typ != "tEXt" && c.typ != "zTXt" && c.typ != "iTXt" {
+		return false
+	}
+	return len(c.data) > len(keyword) && c.data[len(keyword)] == 0 &&
+		string(c.data[:len(keyword)]) == keyword
+}
+
+// validateKeyword checks a PNG text keyword.
+func validateKeyword(keyword string) error {
+	if len(keyword) == 0 || len(keyword) > 79 {
+		return fmt.Errorf("%w: must be 1-79 characters", ErrInvalidKeyword)
+	}
+	if keyword[0] == ' ' || keyword[len(keyword)-1] == ' ' {
+		return fmt.Errorf("%w: leading or trailing space", ErrInvalidKeyword)
+	}
+	for i := 0; i < len(keyword); i++ {
+		if keyword[i] < 0x20 || keyword[i] > 0x7e {
+			return fmt.Errorf("%w: non-printable character", ErrInvalidKeyword)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestSetPNGText(t *testing.T) {
+	src := mustEncodeRGB(t, 2, 2, make([]byte, 12))
+
+	out, err := SetPNGText(src, "weave:test", "héllo wörld")
+	if err != nil {
+		t.Fatalf("SetPNGText() error = %v", err)
+	}
+
+	// Still a valid PNG
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("png.Decode() error = %v", err)
+	}
+
+	got, ok, err := PNGText(out, "weave:test")
+	if err != nil || !ok || got != "héllo wörld" {
+		t.Errorf("PNGText() = %q, %v, %v, want stored text", got, ok, err)
+	}
+
+	// Setting again replaces rather than duplicates
+	out, err = SetPNGText(out, "weave:test", "second")
+	if err != nil {
+		t.Fatalf("SetPNGText() error = %v", err)
+	}
+	if n := bytes.Count(out, []byte("weave:test")); n != 1 {
+		t.Errorf("keyword appears %d times, want 1", n)
+	}
+	if got, _, _ := PNGText(out, "weave:test"); got != "second" {
+		t.Errorf("PNGText() = %q, want %q", got, "second")
+	}
+
+	// Removing restores the original bytes
+	restored, err := RemovePNGText(out, "weave:test")
+	if err != nil {
+		t.Fatalf("RemovePNGText() error = %v", err)
+	}
+	if !bytes.Equal(restored, src) {
+		t.Error("RemovePNGText() did not restore the original PNG")
+	}
+}
+
+func TestPNGText_Missing(t *testing.T) {
+	src := mustEncodeRGB(t, 1, 1, make([]byte, 3))
+	withOther, err := SetPNGText(src, "other", "x")
+	if err != nil {
+		t.Fatalf("SetPNGText() error = %v", err)
+	}
+
+	// A keyword that is a prefix of another keyword does not match
+	if _, ok, err := PNGText(withOther, "oth"); ok || err != nil {
+		t.Errorf("PNGText() ok = %v, err = %v, want not found", ok, err)
+	}
+}
+
+func TestSetPNGText_Invalid(t *testing.T) {
+	src := mustEncodeRGB(t, 1, 1, make([]byte, 3))
+	corrupt := append([]byte{}, src...)
+	corrupt[len(corrupt)-20] ^= 0xff
+
+	tests := []struct {
+		name    string
+		data    []byte
+		keyword string
+		want    error
+	}{
+		{name: "not a PNG", data: []byte("hello"), keyword: "k", want: ErrInvalidPNG},
+		{name: "truncated", data: src[:len(src)-6], keyword: "k", want: ErrInvalidPNG},
+		{name: "bad CRC", data: corrupt, keyword: "k", want: ErrInvalidPNG},
+		{name: "empty keyword", data: src, keyword: "", want: ErrInvalidKeyword},
+		{name: "long keyword", data: src, keyword: strings.Repeat("k", 80), want: ErrInvalidKeyword},
+		{name: "leading space", data: src, keyword: " k", want: ErrInvalidKeyword},
+		{name: "control character", data: src, keyword: "k\n", want: ErrInvalidKeyword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SetPNGText(tt.data, tt.keyword, "text"); !errors.Is(err, tt.want) {
+				t.Errorf("SetPNGText() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,16 @@
 package image
 
 import (
+	"container/list"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,14 +19,16 @@ import (
 )
 
 const (
-	// MaxImages is the maximum number of images to keep in storage
+	// MaxImages is the maximum number of images to keep in in-memory
+	// storage; disk-backed storage is limited by size instead
 	MaxImages = 100
 	// MaxAge is the maximum age of an image before cleanup
 	MaxAge = 1 * time.Hour
 	// CleanupInterval is how often cleanup runs
 	CleanupInterval = 10 * time.Minute
-	// MaxImageSize is the maximum size of a single image (10MB)
-	MaxImageSize = 10 * 1024 * 1024
+	// MaxImageSize is the maximum size of a single image (16MB, room for
+	// a 2048x2048 upscale)
+	MaxImageSize = 16 * 1024 * 1024
 )
 
 var (
@@ -31,30 +40,161 @@ var (
 	ErrImageTooLarge = errors.New("image exceeds maximum size")
 )
 
-// storedImage holds image data with metadata
+// storedImage holds image data with metadata. In disk-backed storage,
+// Data is nil while the image is only on disk.
 type storedImage struct {
+	SessionID  string // Session that produced the image
 	Data       []byte
+	Size       int64
 	Width      int
 	Height     int
+	Hash       string
 	CreatedAt  time.Time
 	AccessedAt time.Time
+	Derivation *Derivation
+
+	// element is the image's entry in Storage.lru
+	element *list.Element
+}
+
+// Generation holds the parameters an image was generated with.
+type Generation struct {
+	Prompt string  `json:"prompt"`
+	Steps  int     `json:"steps"`
+	CFG    float64 `json:"cfg"`
+	Seed   int64   `json:"seed"`
+}
+
+// Derivation links a derived image to the image it was produced from.
+type Derivation struct {
+	// Source is the image the adjustments were applied to: an in-memory
+	// image ID or a session message ID.
+	Source string `json:"source"`
+
+	// Adjustments are the post-processing steps applied to Source.
+	Adjustments Adjustments `json:"adjustments"`
+
+	// Upscaled is set when Source was enlarged by the compute process's
+	// upscaler rather than adjusted.
+	Upscaled bool `json:"upscaled,omitempty"`
+
+	// Generation is carried over from the original generated image so
+	// derived images stay attributable. Nil if unknown.
+	Generation *Generation `json:"generation,omitempty"`
 }
 
-// Storage provides thread-safe in-memory image storage
+// Storage provides thread-safe image storage, either in memory or backed
+// by a directory on disk with an in-memory cache (see NewDiskStorage).
 type Storage struct {
 	mu     sync.RWMutex
 	images map[string]*storedImage
+
+	// lru orders image IDs from most to least recently stored or read
+	lru *list.List
+
+	// dir holds one {id}.png per image in disk-backed storage; "" keeps
+	// images in memory only
+	dir string
+
+	// cacheLimit and diskLimit are the byte budgets of image data kept in
+	// memory and of all images, with cachedBytes and totalBytes in use.
+	// Only disk-backed storage enforces them.
+	cacheLimit  int64
+	diskLimit   int64
+	cachedBytes int64
+	totalBytes  int64
 }
 
-// NewStorage creates a new image storage
+// NewStorage creates a new in-memory image storage
 func NewStorage() *Storage {
 	return &Storage{
 		images: make(map[string]*storedImage),
+		lru:    list.New(),
+	}
+}
+
+// NewDiskStorage creates image storage that writes every image to dir and
+// keeps up to cacheBytes of the most recently used ones in memory. When the
+// images on disk exceed diskBytes, the least recently used are deleted.
+// diskBytes must be at least MaxImageSize.
+//
+// Images are only reachable through the Storage that stored them, so
+// images left in dir by a previous run are removed.
+func NewDiskStorage(dir string, cacheBytes, diskBytes int64) (*Storage, error) {
+	if cacheBytes < 0 || diskBytes < MaxImageSize {
+		return nil, fmt.Errorf("invalid image storage budget: cache %d bytes, disk %d bytes", cacheBytes, diskBytes)
+	}
+
+	// 0700: owner-only access
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create image storage directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image storage directory: %w", err)
+	}
+	for _, entry := range entries {
+		// Only files this storage could have written are removed, in case
+		// dir is shared with anything else
+		id, ok := strings.CutSuffix(entry.Name(), ".png")
+		if _, err := uuid.Parse(id); !ok || err != nil || entry.IsDir() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			return nil, fmt.Errorf("failed to remove stale image: %w", err)
+		}
+	}
+
+	s := NewStorage()
+	s.dir = dir
+	s.cacheLimit = cacheBytes
+	s.diskLimit = diskBytes
+	return s, nil
+}
+
+// Store saves PNG bytes produced by a session and returns a unique ID
+func (s *Storage) Store(sessionID string, pngData []byte, width, height int) (string, error) {
+	return s.store(sessionID, pngData, width, height, nil)
+}
+
+// StoreDerived saves PNG bytes a session produced from another image and
+// returns a unique ID. The derivation can be read back with GetDerivation.
+func (s *Storage) StoreDerived(sessionID string, pngData []byte, width, height int, derivation Derivation) (string, error) {
+	return s.store(sessionID, pngData, width, height, &derivation)
+}
+
+// Owner returns the session that produced an image.
+// Returns ErrInvalidID for a malformed ID and ErrNotFound if it does not exist.
+func (s *Storage) Owner(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", ErrInvalidID
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	img, exists := s.images[id]
+	if !exists {
+		return "", ErrNotFound
 	}
+	return img.SessionID, nil
 }
 
-// Store saves PNG bytes and returns a unique ID
-func (s *Storage) Store(pngData []byte, width, height int) (string, error) {
+// GetDerivation returns how an image was derived.
+// ok is false if the image does not exist or was not derived.
+func (s *Storage) GetDerivation(id string) (derivation Derivation, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	img, exists := s.images[id]
+	if !exists || img.Derivation == nil {
+		return Derivation{}, false
+	}
+	return *img.Derivation, true
+}
+
+// store saves PNG bytes with optional derivation metadata.
+func (s *Storage) store(sessionID string, pngData []byte, width, height int, derivation *Derivation) (string, error) {
 	if len(pngData) == 0 {
 		return "", errors.New("empty PNG data")
 	}
@@ -70,47 +210,100 @@ func (s *Storage) Store(pngData []byte, width, height int) (string, error) {
 	// Generate unique ID
 	id := uuid.New().String()
 
+	if s.dir != "" {
+		// 0600: owner read/write only
+		if err := os.WriteFile(s.path(id), pngData, 0600); err != nil {
+			return "", fmt.Errorf("failed to write image: %w", err)
+		}
+	}
+
 	now := time.Now()
 	img := &storedImage{
+		SessionID:  sessionID,
 		Data:       pngData,
+		Size:       int64(len(pngData)),
 		Width:      width,
 		Height:     height,
+		Hash:       ContentHash(pngData),
 		CreatedAt:  now,
 		AccessedAt: now,
+		Derivation: derivation,
 	}
 
 	s.mu.Lock()
 	s.images[id] = img
+	img.element = s.lru.PushFront(id)
+	s.cachedBytes += img.Size
+	s.totalBytes += img.Size
+	stale := s.evictLocked()
 	s.mu.Unlock()
 
+	s.removeFiles(stale)
 	return id, nil
 }
 
+// Image is a stored image with the metadata needed to serve it.
+type Image struct {
+	Data      []byte
+	Width     int
+	Height    int
+	Hash      string // ContentHash of Data
+	CreatedAt time.Time
+}
+
+// ContentHash returns the hex SHA-256 of data, used to tell whether two
+// images are identical without comparing them.
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 // Get retrieves PNG bytes by ID, returns ErrNotFound if not exists
 func (s *Storage) Get(id string) ([]byte, int, int, error) {
+	img, err := s.GetImage(id)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return img.Data, img.Width, img.Height, nil
+}
+
+// GetImage retrieves an image and its metadata by ID.
+// Returns ErrInvalidID for a malformed ID and ErrNotFound if it does not exist.
+func (s *Storage) GetImage(id string) (Image, error) {
 	// Validate ID format (no lock needed)
 	if _, err := uuid.Parse(id); err != nil {
-		return nil, 0, 0, ErrInvalidID
+		return Image{}, ErrInvalidID
 	}
 
-	// Use read lock to check existence
-	s.mu.RLock()
+	s.mu.Lock()
 	img, exists := s.images[id]
-	s.mu.RUnlock()
-
 	if !exists {
-		return nil, 0, 0, ErrNotFound
+		s.mu.Unlock()
+		return Image{}, ErrNotFound
 	}
-
-	// Update access time with write lock (separate from read)
-	s.mu.Lock()
 	img.AccessedAt = time.Now()
+	s.lru.MoveToFront(img.element)
+	cached := img.Data
 	s.mu.Unlock()
 
+	if cached == nil {
+		var err error
+		cached, err = s.load(id, img)
+		if err != nil {
+			return Image{}, err
+		}
+	}
+
 	// Return copy of data to prevent external modification
-	data := make([]byte, len(img.Data))
-	copy(data, img.Data)
-	return data, img.Width, img.Height, nil
+	data := make([]byte, len(cached))
+	copy(data, cached)
+	return Image{
+		Data:      data,
+		Width:     img.Width,
+		Height:    img.Height,
+		Hash:      img.Hash,
+		CreatedAt: img.CreatedAt,
+	}, nil
 }
 
 // Count returns number of stored images
@@ -124,14 +317,98 @@ func (s *Storage) Count() int {
 // Delete removes an image by ID. Returns true if image was deleted.
 func (s *Storage) Delete(id string) bool {
 	s.mu.Lock()
-	_, exists := s.images[id]
+	img, exists := s.images[id]
 	if exists {
-		delete(s.images, id)
+		s.removeLocked(id, img)
 	}
 	s.mu.Unlock()
+
+	if exists {
+		s.removeFiles([]string{id})
+	}
 	return exists
 }
 
+// load reads an image that is only on disk back into the memory cache.
+// Returns ErrNotFound if it was deleted in the meantime.
+func (s *Storage) load(id string, img *storedImage) ([]byte, error) {
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	s.mu.Lock()
+	var stale []string
+	if s.images[id] == img && img.Data == nil {
+		img.Data = data
+		s.cachedBytes += img.Size
+		stale = s.evictLocked()
+	}
+	s.mu.Unlock()
+
+	s.removeFiles(stale)
+	return data, nil
+}
+
+// evictLocked drops the least recently used images from memory until the
+// cache fits its budget, and deletes them until the images on disk fit
+// theirs. The most recently used image is always kept. Returns the IDs of
+// deleted images, whose files the caller removes with removeFiles once the
+// lock is released. Does nothing for in-memory storage.
+// Must be called with s.mu held.
+func (s *Storage) evictLocked() []string {
+	if s.dir == "" {
+		return nil
+	}
+
+	var deleted []string
+	for s.totalBytes > s.diskLimit && s.lru.Len() > 1 {
+		id := s.lru.Back().Value.(string)
+		s.removeLocked(id, s.images[id])
+		deleted = append(deleted, id)
+	}
+
+	for e := s.lru.Back(); e != nil && s.cachedBytes > s.cacheLimit; e = e.Prev() {
+		img := s.images[e.Value.(string)]
+		if img.Data != nil {
+			img.Data = nil
+			s.cachedBytes -= img.Size
+		}
+	}
+	return deleted
+}
+
+// removeLocked removes an image from the index.
+// Must be called with s.mu held.
+func (s *Storage) removeLocked(id string, img *storedImage) {
+	delete(s.images, id)
+	s.lru.Remove(img.element)
+	if img.Data != nil {
+		s.cachedBytes -= img.Size
+	}
+	s.totalBytes -= img.Size
+}
+
+// removeFiles deletes the files of removed images from disk-backed storage.
+func (s *Storage) removeFiles(ids []string) {
+	if s.dir == "" {
+		return
+	}
+	for _, id := range ids {
+		// Already gone is fine; anything else leaves an unreachable file
+		// that the next start removes
+		_ = os.Remove(s.path(id))
+	}
+}
+
+// path returns the file of an image in disk-backed storage.
+func (s *Storage) path(id string) string {
+	return filepath.Join(s.dir, id+".png")
+}
+
 // StartCleanup starts a background goroutine that periodically removes
 // old images (older than MaxAge) and enforces the MaxImages limit via LRU.
 // The goroutine runs until ctx is cancelled. Caller MUST cancel ctx
@@ -152,8 +429,12 @@ func (s *Storage) StartCleanup(ctx context.Context, logger *logging.Logger) {
 	}()
 }
 
-// cleanup removes images older than MaxAge and enforces MaxImages limit
+// cleanup removes images older than MaxAge and, for in-memory storage,
+// enforces the MaxImages limit
 func (s *Storage) cleanup(logger *logging.Logger) {
+	var removed []string
+	defer func() { s.removeFiles(removed) }()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -164,7 +445,8 @@ func (s *Storage) cleanup(logger *logging.Logger) {
 	ageDeleted := 0
 	for id, img := range s.images {
 		if now.Sub(img.CreatedAt) > MaxAge {
-			delete(s.images, id)
+			s.removeLocked(id, img)
+			removed = append(removed, id)
 			ageDeleted++
 		}
 	}
@@ -173,8 +455,9 @@ func (s *Storage) cleanup(logger *logging.Logger) {
 		logger.Debug("Removed %d images older than %v", ageDeleted, MaxAge)
 	}
 
-	// Enforce MaxImages limit using LRU eviction
-	if len(s.images) > MaxImages {
+	// Enforce MaxImages limit using LRU eviction. Disk-backed storage
+	// evicts by size as images are stored instead.
+	if s.dir == "" && len(s.images) > MaxImages {
 		// Build sorted list by AccessedAt (oldest first)
 		type imageEntry struct {
 			id         string
@@ -198,7 +481,7 @@ func (s *Storage) cleanup(logger *logging.Logger) {
 		toDelete := len(entries) - MaxImages
 		if toDelete > 0 {
 			for i := 0; i < toDelete; i++ {
-				delete(s.images, entries[i].id)
+				s.removeLocked(entries[i].id, s.images[entries[i].id])
 				lruDeleted++
 			}
 		}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -19,7 +21,7 @@ func TestStorage_StoreAndRetrieve(t *testing.T) {
 	pngData := []byte{1, 2, 3, 4}
 	width, height := 100, 200
 
-	id, err := storage.Store(pngData, width, height)
+	id, err := storage.Store("", pngData, width, height)
 	if err != nil {
 		t.Fatalf("Store failed: %v", err)
 	}
@@ -54,6 +56,52 @@ func TestStorage_StoreAndRetrieve(t *testing.T) {
 	}
 }
 
+func TestStorage_GetImage(t *testing.T) {
+	storage := NewStorage()
+
+	before := time.Now()
+	id, err := storage.Store("", []byte{1, 2, 3, 4}, 100, 200)
+	if err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	same, err := storage.Store("", []byte{1, 2, 3, 4}, 100, 200)
+	if err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	other, err := storage.Store("", []byte{5, 6, 7, 8}, 100, 200)
+	if err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	img, err := storage.GetImage(id)
+	if err != nil {
+		t.Fatalf("GetImage failed: %v", err)
+	}
+	if !bytes.Equal(img.Data, []byte{1, 2, 3, 4}) || img.Width != 100 || img.Height != 200 {
+		t.Errorf("GetImage = %+v, want the stored image", img)
+	}
+	if img.Hash != ContentHash([]byte{1, 2, 3, 4}) {
+		t.Errorf("Hash = %q, want ContentHash of the data", img.Hash)
+	}
+	if img.CreatedAt.Before(before) {
+		t.Errorf("CreatedAt = %v, want at or after %v", img.CreatedAt, before)
+	}
+
+	// Identical content hashes the same; different content does not
+	sameImg, _ := storage.GetImage(same)
+	otherImg, _ := storage.GetImage(other)
+	if sameImg.Hash != img.Hash {
+		t.Error("identical images have different hashes")
+	}
+	if otherImg.Hash == img.Hash {
+		t.Error("different images have the same hash")
+	}
+
+	if _, err := storage.GetImage(uuid.New().String()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetImage(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
 func TestStorage_GetNonExistent(t *testing.T) {
 	storage := NewStorage()
 
@@ -93,7 +141,7 @@ func TestStorage_ConcurrentAccess(t *testing.T) {
 
 	// Store initial image
 	pngData := []byte{1, 2, 3, 4}
-	id, err := storage.Store(pngData, 100, 100)
+	id, err := storage.Store("", pngData, 100, 100)
 	if err != nil {
 		t.Fatalf("Store failed: %v", err)
 	}
@@ -119,7 +167,7 @@ func TestStorage_ConcurrentAccess(t *testing.T) {
 		go func(n int) {
 			defer wg.Done()
 			data := []byte{byte(n), byte(n + 1), byte(n + 2)}
-			_, err := storage.Store(data, 50, 50)
+			_, err := storage.Store("", data, 50, 50)
 			if err != nil {
 				t.Errorf("concurrent Store failed: %v", err)
 			}
@@ -147,7 +195,7 @@ func TestStorage_Count(t *testing.T) {
 
 	// Store some images
 	for i := 0; i < 5; i++ {
-		_, err := storage.Store([]byte{byte(i)}, 10, 10)
+		_, err := storage.Store("", []byte{byte(i)}, 10, 10)
 		if err != nil {
 			t.Fatalf("Store failed: %v", err)
 		}
@@ -165,7 +213,7 @@ func TestStorage_IDUniqueness(t *testing.T) {
 	ids := make(map[string]bool)
 
 	for i := 0; i < numImages; i++ {
-		id, err := storage.Store([]byte{byte(i)}, 10, 10)
+		id, err := storage.Store("", []byte{byte(i)}, 10, 10)
 		if err != nil {
 			t.Fatalf("Store failed: %v", err)
 		}
@@ -184,7 +232,7 @@ func TestStorage_IDUniqueness(t *testing.T) {
 func TestStorage_StoreEmptyData(t *testing.T) {
 	storage := NewStorage()
 
-	_, err := storage.Store([]byte{}, 100, 100)
+	_, err := storage.Store("", []byte{}, 100, 100)
 	if err == nil {
 		t.Error("Store with empty data should fail")
 	}
@@ -206,7 +254,7 @@ func TestStorage_StoreInvalidDimensions(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := storage.Store([]byte{1, 2, 3}, tt.width, tt.height)
+			_, err := storage.Store("", []byte{1, 2, 3}, tt.width, tt.height)
 			if err != ErrInvalidDimensions {
 				t.Errorf("got error %v, want %v", err, ErrInvalidDimensions)
 			}
@@ -218,7 +266,7 @@ func TestStorage_Delete(t *testing.T) {
 	storage := NewStorage()
 
 	// Store an image
-	id, err := storage.Store([]byte{1, 2, 3}, 10, 10)
+	id, err := storage.Store("", []byte{1, 2, 3}, 10, 10)
 	if err != nil {
 		t.Fatalf("Store failed: %v", err)
 	}
@@ -252,13 +300,13 @@ func TestStorage_CleanupAge(t *testing.T) {
 	newTime := now.Add(-30 * time.Minute) // Newer than MaxAge
 
 	// Store old image
-	id1, _ := storage.Store([]byte{1}, 10, 10)
+	id1, _ := storage.Store("", []byte{1}, 10, 10)
 	storage.mu.Lock()
 	storage.images[id1].CreatedAt = oldTime
 	storage.mu.Unlock()
 
 	// Store new image
-	id2, _ := storage.Store([]byte{2}, 10, 10)
+	id2, _ := storage.Store("", []byte{2}, 10, 10)
 	storage.mu.Lock()
 	storage.images[id2].CreatedAt = newTime
 	storage.mu.Unlock()
@@ -293,7 +341,7 @@ func TestStorage_CleanupLRU(t *testing.T) {
 	// Store more than MaxImages
 	ids := make([]string, MaxImages+10)
 	for i := 0; i < MaxImages+10; i++ {
-		id, err := storage.Store([]byte{byte(i)}, 10, 10)
+		id, err := storage.Store("", []byte{byte(i)}, 10, 10)
 		if err != nil {
 			t.Fatalf("Store failed: %v", err)
 		}
@@ -348,7 +396,7 @@ func TestStorage_StartCleanup(t *testing.T) {
 	storage.StartCleanup(ctx, logger)
 
 	// Store an old image
-	id, _ := storage.Store([]byte{1}, 10, 10)
+	id, _ := storage.Store("", []byte{1}, 10, 10)
 	storage.mu.Lock()
 	storage.images[id].CreatedAt = time.Now().Add(-2 * time.Hour)
 	storage.mu.Unlock()
@@ -393,14 +441,14 @@ func TestStorage_MaxImageSize(t *testing.T) {
 
 	// Test oversized image rejected
 	largeData := make([]byte, MaxImageSize+1)
-	_, err := storage.Store(largeData, 100, 100)
+	_, err := storage.Store("", largeData, 100, 100)
 	if !errors.Is(err, ErrImageTooLarge) {
 		t.Errorf("expected ErrImageTooLarge, got %v", err)
 	}
 
 	// Test max size accepted
 	maxData := make([]byte, MaxImageSize)
-	id, err := storage.Store(maxData, 100, 100)
+	id, err := storage.Store("", maxData, 100, 100)
 	if err != nil {
 		t.Errorf("max size should be accepted: %v", err)
 	}
@@ -408,3 +456,176 @@ func TestStorage_MaxImageSize(t *testing.T) {
 		t.Error("expected valid ID")
 	}
 }
+
+func TestStorage_StoreDerived(t *testing.T) {
+	storage := NewStorage()
+
+	sourceID, err := storage.Store("", []byte("source"), 2, 2)
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if _, ok := storage.GetDerivation(sourceID); ok {
+		t.Error("GetDerivation() ok = true for an original image, want false")
+	}
+
+	want := Derivation{
+		Source:      sourceID,
+		Adjustments: Adjustments{Brightness: 0.2},
+		Generation:  &Generation{Prompt: "a cat", Steps: 4, CFG: 1, Seed: 7},
+	}
+	id, err := storage.StoreDerived("", []byte("derived"), 2, 2, want)
+	if err != nil {
+		t.Fatalf("StoreDerived() error = %v", err)
+	}
+
+	data, _, _, err := storage.Get(id)
+	if err != nil || string(data) != "derived" {
+		t.Errorf("Get() = %q, %v, want derived data", data, err)
+	}
+	got, ok := storage.GetDerivation(id)
+	if !ok {
+		t.Fatal("GetDerivation() ok = false, want true")
+	}
+	if got.Source != want.Source || got.Adjustments.Brightness != 0.2 || got.Generation.Prompt != "a cat" {
+		t.Errorf("GetDerivation() = %+v, want %+v", got, want)
+	}
+
+	if _, ok := storage.GetDerivation("00000000-0000-0000-0000-000000000000"); ok {
+		t.Error("GetDerivation() ok = true for unknown image, want false")
+	}
+}
+
+func TestStorage_Owner(t *testing.T) {
+	storage := NewStorage()
+
+	id, err := storage.Store("0123456789abcdef0123456789abcdef", []byte{1}, 10, 10)
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if owner, err := storage.Owner(id); err != nil || owner != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("Owner() = %q, %v, want the storing session", owner, err)
+	}
+
+	if _, err := storage.Owner("not-an-id"); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("Owner() of malformed ID error = %v, want %v", err, ErrInvalidID)
+	}
+	storage.Delete(id)
+	if _, err := storage.Owner(id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Owner() of deleted image error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestDiskStorage_StoreAndRetrieve(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewDiskStorage(dir, 0, MaxImageSize)
+	if err != nil {
+		t.Fatalf("NewDiskStorage() error = %v", err)
+	}
+
+	id, err := storage.Store("", []byte("on disk"), 2, 3)
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// With no memory cache the image is only on disk
+	storage.mu.Lock()
+	cached := storage.images[id].Data
+	storage.mu.Unlock()
+	if cached != nil {
+		t.Error("image is cached in memory with a cache budget of 0")
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, id+".png")); err != nil || string(data) != "on disk" {
+		t.Fatalf("image file = %q, %v, want the stored image", data, err)
+	}
+
+	data, w, h, err := storage.Get(id)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if string(data) != "on disk" || w != 2 || h != 3 {
+		t.Errorf("Get() = %q, %d, %d, want on disk, 2, 3", data, w, h)
+	}
+
+	if !storage.Delete(id) {
+		t.Fatal("Delete() = false, want true")
+	}
+	if _, err := os.Stat(filepath.Join(dir, id+".png")); !os.IsNotExist(err) {
+		t.Errorf("image file after Delete() stat error = %v, want not exist", err)
+	}
+	if _, _, _, err := storage.Get(id); err != ErrNotFound {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestDiskStorage_LRUEviction(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewDiskStorage(dir, 8, MaxImageSize)
+	if err != nil {
+		t.Fatalf("NewDiskStorage() error = %v", err)
+	}
+	// A budget below MaxImageSize keeps the test's images small
+	storage.diskLimit = 12
+
+	first, _ := storage.Store("", []byte("aaaa"), 1, 1)
+	second, _ := storage.Store("", []byte("bbbb"), 1, 1)
+
+	// Reading the first image makes the second the least recently used
+	if _, _, _, err := storage.Get(first); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	third, _ := storage.Store("", []byte("cccc"), 1, 1)
+
+	storage.mu.Lock()
+	cachedBytes, totalBytes := storage.cachedBytes, storage.totalBytes
+	firstCached := storage.images[first].Data != nil
+	secondCached := storage.images[second].Data != nil
+	storage.mu.Unlock()
+	if cachedBytes > 8 || totalBytes != 12 {
+		t.Errorf("cached %d bytes, %d on disk, want at most 8 and 12", cachedBytes, totalBytes)
+	}
+	if !firstCached || secondCached {
+		t.Errorf("first cached = %v, second cached = %v, want only the recently read first", firstCached, secondCached)
+	}
+
+	// Going over the disk budget deletes the least recently used image
+	fourth, _ := storage.Store("", []byte("dddd"), 1, 1)
+	if _, _, _, err := storage.Get(second); err != ErrNotFound {
+		t.Errorf("Get(second) error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := os.Stat(filepath.Join(dir, second+".png")); !os.IsNotExist(err) {
+		t.Errorf("evicted image file stat error = %v, want not exist", err)
+	}
+	for _, id := range []string{first, third, fourth} {
+		if _, _, _, err := storage.Get(id); err != nil {
+			t.Errorf("Get(%s) error = %v, want nil", id, err)
+		}
+	}
+	if storage.Count() != 3 {
+		t.Errorf("Count() = %d, want 3", storage.Count())
+	}
+}
+
+func TestNewDiskStorage_RemovesStaleImages(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, uuid.New().String()+".png")
+	other := filepath.Join(dir, "notes.txt")
+	for _, path := range []string{stale, other} {
+		if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := NewDiskStorage(dir, 0, MaxImageSize); err != nil {
+		t.Fatalf("NewDiskStorage() error = %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale image stat error = %v, want not exist", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("unrelated file was removed: %v", err)
+	}
+
+	if _, err := NewDiskStorage(dir, 0, MaxImageSize-1); err == nil {
+		t.Error("NewDiskStorage() with a disk budget below MaxImageSize error = nil, want error")
+	}
+}
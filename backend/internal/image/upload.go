@@ -0,0 +1,92 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+const (
+	// MinUploadDimension is the smallest width or height accepted for an
+	// uploaded reference image, matching the smallest image compute renders
+	MinUploadDimension = 64
+)
+
+var (
+	// ErrUnsupportedFormat indicates an upload that is not a PNG or JPEG
+	ErrUnsupportedFormat = errors.New("unsupported image format: must be PNG or JPEG")
+	// ErrNotPNG indicates data that should be a PNG image but isn't
+	ErrNotPNG = errors.New("not a PNG image")
+)
+
+// Upload is a validated reference image, re-encoded as PNG.
+type Upload struct {
+	PNG    []byte
+	Width  int
+	Height int
+	// Parameters holds the generation parameters embedded by another tool,
+	// or nil if there were none
+	Parameters *EmbeddedParameters
+}
+
+// NormalizeUpload validates an uploaded PNG or JPEG and re-encodes it as
+// PNG. Dimensions are checked before the pixels are decoded, so oversized
+// images are refused without allocating them. Re-encoding also drops
+// metadata such as EXIF location data; only the generation parameters
+// recognized by ParseEmbeddedParameters are kept.
+//
+// Returns ErrUnsupportedFormat for other formats and ErrInvalidDimensions
+// if either side is outside MinUploadDimension..MaxImageDimension.
+func NormalizeUpload(data []byte) (Upload, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "png" && format != "jpeg") {
+		return Upload{}, ErrUnsupportedFormat
+	}
+	if cfg.Width < MinUploadDimension || cfg.Height < MinUploadDimension ||
+		cfg.Width > MaxImageDimension || cfg.Height > MaxImageDimension {
+		return Upload{}, fmt.Errorf("%w: %dx%d is outside %d-%d", ErrInvalidDimensions,
+			cfg.Width, cfg.Height, MinUploadDimension, MaxImageDimension)
+	}
+
+	var img image.Image
+	if format == "png" {
+		img, err = png.Decode(bytes.NewReader(data))
+	} else {
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return Upload{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return Upload{}, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+
+	upload := Upload{PNG: buf.Bytes(), Width: cfg.Width, Height: cfg.Height}
+	if meta, ok := ParseEmbeddedParameters(data); ok {
+		if upload.PNG, err = keepEmbeddedParameters(upload.PNG, meta); err != nil {
+			return Upload{}, fmt.Errorf("failed to keep generation parameters: %w", err)
+		}
+		upload.Parameters = &meta
+	}
+	return upload, nil
+}
+
+// CheckPNG checks that data is a PNG image with sides of 1 to
+// MaxImageDimension pixels, as weave stores. Only the header is decoded.
+//
+// Returns ErrNotPNG for other data and ErrInvalidDimensions for other sizes.
+func CheckPNG(data []byte) error {
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ErrNotPNG
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > MaxImageDimension || cfg.Height > MaxImageDimension {
+		return fmt.Errorf("%w: %dx%d is outside 1-%d", ErrInvalidDimensions, cfg.Width, cfg.Height, MaxImageDimension)
+	}
+	return nil
+}
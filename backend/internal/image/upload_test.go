@@ -0,0 +1,101 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// encodeTestImage encodes a solid width x height image in the given format.
+func encodeTestImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("failed to encode %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+func TestNormalizeUpload(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		wantWidth  int
+		wantHeight int
+		wantErr    error
+	}{
+		{name: "png", data: encodeTestImage(t, "png", 128, 64), wantWidth: 128, wantHeight: 64},
+		{name: "jpeg", data: encodeTestImage(t, "jpeg", 96, 200), wantWidth: 96, wantHeight: 200},
+		{name: "gif", data: encodeTestImage(t, "gif", 64, 64), wantErr: ErrUnsupportedFormat},
+		{name: "not an image", data: []byte("hello"), wantErr: ErrUnsupportedFormat},
+		{name: "too small", data: encodeTestImage(t, "png", 32, 128), wantErr: ErrInvalidDimensions},
+		{name: "too large", data: encodeTestImage(t, "png", MaxImageDimension+1, 64), wantErr: ErrInvalidDimensions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeUpload(tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("NormalizeUpload() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeUpload() error = %v", err)
+			}
+			if got.Width != tt.wantWidth || got.Height != tt.wantHeight {
+				t.Errorf("size = %dx%d, want %dx%d", got.Width, got.Height, tt.wantWidth, tt.wantHeight)
+			}
+
+			// The result is always a PNG of the same size
+			cfg, err := png.DecodeConfig(bytes.NewReader(got.PNG))
+			if err != nil {
+				t.Fatalf("result is not a PNG: %v", err)
+			}
+			if cfg.Width != tt.wantWidth || cfg.Height != tt.wantHeight {
+				t.Errorf("PNG size = %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestCheckPNG(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "png", data: encodeTestImage(t, "png", 32, 16)},
+		{name: "jpeg", data: encodeTestImage(t, "jpeg", 32, 16), wantErr: ErrNotPNG},
+		{name: "not an image", data: []byte("<script>alert(1)</script>"), wantErr: ErrNotPNG},
+		{name: "too large", data: encodeTestImage(t, "png", MaxImageDimension+1, 1), wantErr: ErrInvalidDimensions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckPNG(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckPNG() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
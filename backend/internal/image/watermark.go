@@ -0,0 +1,358 @@
+package image
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// MaxWatermarkTextLength is the maximum watermark text length in characters.
+	MaxWatermarkTextLength = 100
+
+	// DefaultWatermarkCacheSize is the number of watermarked images kept by
+	// a WatermarkCache unless another size is given.
+	DefaultWatermarkCacheSize = 50
+)
+
+var (
+	// ErrInvalidWatermark indicates watermark settings are missing or out of range
+	ErrInvalidWatermark = errors.New("invalid watermark")
+)
+
+// Corner selects where a watermark is placed.
+type Corner string
+
+// Watermark corners, as accepted by ParseCorner.
+const (
+	CornerTopLeft     Corner = "top-left"
+	CornerTopRight    Corner = "top-right"
+	CornerBottomLeft  Corner = "bottom-left"
+	CornerBottomRight Corner = "bottom-right"
+)
+
+// ParseCorner converts a corner name to a Corner.
+// An empty name selects CornerBottomRight.
+func ParseCorner(name string) (Corner, error) {
+	switch c := Corner(strings.TrimSpace(name)); c {
+	case "":
+		return CornerBottomRight, nil
+	case CornerTopLeft, CornerTopRight, CornerBottomLeft, CornerBottomRight:
+		return c, nil
+	default:
+		return "", fmt.Errorf("%w: unknown corner %q", ErrInvalidWatermark, name)
+	}
+}
+
+// Watermark describes a text or image overlay drawn in a corner of an image.
+type Watermark struct {
+	// Text is drawn in a built-in bitmap font. Letters are drawn upper case;
+	// characters without a glyph are drawn as '?'.
+	Text string
+
+	// Overlay is a PNG drawn instead of Text when set. Overlays wider than a
+	// quarter of the image are scaled down to fit.
+	Overlay []byte
+
+	Corner Corner
+
+	// Opacity scales the watermark's alpha, from 0 (exclusive) to 1.
+	Opacity float64
+}
+
+// Validate checks that exactly one of Text and Overlay is set and that the
+// corner and opacity are valid. The overlay PNG itself is checked when decoded.
+func (w Watermark) Validate() error {
+	if (w.Text == "") == (len(w.Overlay) == 0) {
+		return fmt.Errorf("%w: exactly one of text and overlay must be set", ErrInvalidWatermark)
+	}
+	if utf8.RuneCountInString(w.Text) > MaxWatermarkTextLength {
+		return fmt.Errorf("%w: text exceeds %d characters", ErrInvalidWatermark, MaxWatermarkTextLength)
+	}
+	if _, err := ParseCorner(string(w.Corner)); err != nil {
+		return err
+	}
+	if math.IsNaN(w.Opacity) || w.Opacity <= 0 || w.Opacity > 1 {
+		return fmt.Errorf("%w: opacity must be greater than 0 and at most 1", ErrInvalidWatermark)
+	}
+	return nil
+}
+
+// ApplyWatermark draws a watermark onto a PNG image and returns a new PNG.
+// The input is not modified. Use a WatermarkCache when the same images are
+// watermarked repeatedly.
+func ApplyWatermark(pngData []byte, wm Watermark) ([]byte, error) {
+	mark, err := renderWatermark(wm)
+	if err != nil {
+		return nil, err
+	}
+	return compositeWatermark(pngData, wm, mark)
+}
+
+// WatermarkCache applies a fixed watermark and keeps the most recently used
+// results, so serving the same image again skips decoding and compositing.
+// Entries are keyed by the SHA-256 of the source PNG, so a changed source is
+// never served with a stale watermark.
+//
+// WatermarkCache is thread-safe.
+type WatermarkCache struct {
+	wm   Watermark
+	mark image.Image
+
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[[sha256.Size]byte]*list.Element
+	order      *list.List // front is most recently used
+}
+
+// watermarkEntry is a cached watermarked image.
+type watermarkEntry struct {
+	key [sha256.Size]byte
+	png []byte
+}
+
+// NewWatermarkCache validates a watermark, prepares its overlay and returns
+// a cache holding up to maxEntries results. maxEntries <= 0 selects
+// DefaultWatermarkCacheSize.
+func NewWatermarkCache(wm Watermark, maxEntries int) (*WatermarkCache, error) {
+	mark, err := renderWatermark(wm)
+	if err != nil {
+		return nil, err
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultWatermarkCacheSize
+	}
+	return &WatermarkCache{
+		wm:         wm,
+		mark:       mark,
+		maxEntries: maxEntries,
+		entries:    make(map[[sha256.Size]byte]*list.Element),
+		order:      list.New(),
+	}, nil
+}
+
+// Apply returns pngData with the cache's watermark drawn on it.
+// The returned slice is shared with the cache and must not be modified.
+func (c *WatermarkCache) Apply(pngData []byte) ([]byte, error) {
+	key := sha256.Sum256(pngData)
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		out := elem.Value.(*watermarkEntry).png
+		c.mu.Unlock()
+		return out, nil
+	}
+	c.mu.Unlock()
+
+	// Composite without holding the lock; concurrent misses for the same
+	// image do the work twice but store the same result
+	out, err := compositeWatermark(pngData, c.wm, c.mark)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return out, nil
+	}
+	c.entries[key] = c.order.PushFront(&watermarkEntry{key: key, png: out})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*watermarkEntry).key)
+	}
+	return out, nil
+}
+
+// Len returns the number of cached images.
+func (c *WatermarkCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// renderWatermark validates a watermark and returns the image to overlay:
+// the decoded overlay PNG, or the text rendered at a scale of 1.
+func renderWatermark(wm Watermark) (image.Image, error) {
+	if err := wm.Validate(); err != nil {
+		return nil, err
+	}
+	if len(wm.Overlay) > 0 {
+		overlay, err := decodeBounded(wm.Overlay)
+		if err != nil {
+			return nil, fmt.Errorf("%w: overlay: %v", ErrInvalidWatermark, err)
+		}
+		return overlay, nil
+	}
+	return renderText(wm.Text), nil
+}
+
+// compositeWatermark draws mark onto a PNG image in the watermark's corner.
+// Text marks are scaled with the image; overlay marks are only scaled down.
+func compositeWatermark(pngData []byte, wm Watermark, mark image.Image) ([]byte, error) {
+	src, err := decodeBounded(pngData)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Bounds(), src, bounds.Min, draw.Src)
+
+	// Scale text so it stays legible on large images, and keep overlays
+	// within a quarter of the image width
+	shortSide := min(bounds.Dx(), bounds.Dy())
+	if len(wm.Overlay) == 0 {
+		mark = scaleNearest(mark, max(1, shortSide/256), 1)
+	} else if limit := max(1, bounds.Dx()/4); mark.Bounds().Dx() > limit {
+		mark = scaleNearest(mark, limit, mark.Bounds().Dx())
+	}
+
+	margin := max(2, shortSide/64)
+	size := mark.Bounds().Size()
+	var at image.Point
+	switch wm.Corner {
+	case CornerTopLeft:
+		at = image.Pt(margin, margin)
+	case CornerTopRight:
+		at = image.Pt(bounds.Dx()-margin-size.X, margin)
+	case CornerBottomLeft:
+		at = image.Pt(margin, bounds.Dy()-margin-size.Y)
+	default:
+		at = image.Pt(bounds.Dx()-margin-size.X, bounds.Dy()-margin-size.Y)
+	}
+
+	opacity := image.NewUniform(color.Alpha{A: uint8(math.Round(wm.Opacity * 255))})
+	draw.DrawMask(out, image.Rectangle{Min: at, Max: at.Add(size)}, mark, mark.Bounds().Min, opacity, image.Point{}, draw.Over)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return nil, fmt.Errorf("failed to encode watermarked image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleNearest resizes an image by num/den using nearest-neighbour sampling.
+// The result is at least 1x1.
+func scaleNearest(src image.Image, num, den int) image.Image {
+	if num == den {
+		return src
+	}
+	b := src.Bounds()
+	width := max(1, b.Dx()*num/den)
+	height := max(1, b.Dy()*num/den)
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			out.Set(x, y, src.At(b.Min.X+x*den/num, b.Min.Y+y*den/num))
+		}
+	}
+	return out
+}
+
+// Glyphs are 5x7 pixels with one pixel of spacing, drawn in white over a
+// one pixel dark shadow so text stays readable on light and dark images.
+const (
+	glyphWidth   = 5
+	glyphHeight  = 7
+	glyphAdvance = glyphWidth + 1
+)
+
+// renderText draws text in the built-in font at one pixel per font pixel.
+func renderText(text string) image.Image {
+	runes := []rune(strings.ToUpper(text))
+	// +1 in each direction leaves room for the shadow
+	out := image.NewNRGBA(image.Rect(0, 0, len(runes)*glyphAdvance+1, glyphHeight+1))
+
+	shadow := color.NRGBA{A: 160}
+	fill := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	for _, layer := range []struct {
+		offset int
+		c      color.NRGBA
+	}{{1, shadow}, {0, fill}} {
+		for i, r := range runes {
+			glyph, ok := glyphs[r]
+			if !ok {
+				glyph = glyphs['?']
+			}
+			for row, bits := range glyph {
+				for col := 0; col < glyphWidth; col++ {
+					if bits&(1<<(glyphWidth-1-col)) != 0 {
+						out.SetNRGBA(i*glyphAdvance+col+layer.offset, row+layer.offset, layer.c)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// glyphs is a 5x7 bitmap font. Each row's low five bits are its pixels,
+// most significant bit on the left.
+var glyphs = map[rune][glyphHeight]uint8{
+	' ':  {},
+	'A':  {0x0E, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'B':  {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C':  {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E},
+	'D':  {0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C},
+	'E':  {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F},
+	'F':  {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G':  {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F},
+	'H':  {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I':  {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'J':  {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K':  {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L':  {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M':  {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N':  {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O':  {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'P':  {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q':  {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D},
+	'R':  {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S':  {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E},
+	'T':  {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'V':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W':  {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A},
+	'X':  {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y':  {0x11, 0x11, 0x0A, 0x04, 0x04, 0x04, 0x04},
+	'Z':  {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+	'0':  {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1':  {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2':  {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3':  {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4':  {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5':  {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6':  {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7':  {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8':  {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9':  {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	'.':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	',':  {0x00, 0x00, 0x00, 0x00, 0x0C, 0x04, 0x08},
+	'-':  {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	'_':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1F},
+	':':  {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00},
+	'/':  {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'@':  {0x0E, 0x11, 0x01, 0x0D, 0x15, 0x15, 0x0E},
+	'!':  {0x04, 0x04, 0x04, 0x04, 0x04, 0x00, 0x04},
+	'?':  {0x0E, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+	'\'': {0x0C, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00},
+	'(':  {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')':  {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'&':  {0x0C, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0D},
+	'+':  {0x00, 0x04, 0x04, 0x1F, 0x04, 0x04, 0x00},
+	'#':  {0x0A, 0x0A, 0x1F, 0x0A, 0x1F, 0x0A, 0x0A},
+}
@@ -0,0 +1,168 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseCorner(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Corner
+		wantErr bool
+	}{
+		{name: "", want: CornerBottomRight},
+		{name: "top-left", want: CornerTopLeft},
+		{name: "bottom-left", want: CornerBottomLeft},
+		{name: "middle", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCorner(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCorner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCorner() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatermark_Validate(t *testing.T) {
+	overlay := mustEncodeRGB(t, 1, 1, []byte{255, 0, 0})
+
+	tests := []struct {
+		name    string
+		wm      Watermark
+		wantErr bool
+	}{
+		{name: "text", wm: Watermark{Text: "weave", Opacity: 0.5}},
+		{name: "overlay", wm: Watermark{Overlay: overlay, Corner: CornerTopLeft, Opacity: 1}},
+		{name: "neither", wm: Watermark{Opacity: 0.5}, wantErr: true},
+		{name: "both", wm: Watermark{Text: "weave", Overlay: overlay, Opacity: 0.5}, wantErr: true},
+		{name: "text too long", wm: Watermark{Text: strings.Repeat("a", MaxWatermarkTextLength+1), Opacity: 0.5}, wantErr: true},
+		{name: "unknown corner", wm: Watermark{Text: "weave", Corner: "center", Opacity: 0.5}, wantErr: true},
+		{name: "zero opacity", wm: Watermark{Text: "weave"}, wantErr: true},
+		{name: "opacity above 1", wm: Watermark{Text: "weave", Opacity: 1.5}, wantErr: true},
+		{name: "opacity NaN", wm: Watermark{Text: "weave", Opacity: math.NaN()}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.wm.Validate()
+			if tt.wantErr && !errors.Is(err, ErrInvalidWatermark) {
+				t.Errorf("Validate() error = %v, want %v", err, ErrInvalidWatermark)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Validate() error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestApplyWatermark_Text(t *testing.T) {
+	// 64x64 black: text scale 1, margin 2
+	src := mustEncodeRGB(t, 64, 64, make([]byte, 64*64*3))
+
+	tests := []struct {
+		corner Corner
+		// first lit pixel of 'A' (top row, second column)
+		lit   [2]int
+		unlit [2]int
+	}{
+		{corner: CornerTopLeft, lit: [2]int{3, 2}, unlit: [2]int{60, 60}},
+		{corner: CornerBottomRight, lit: [2]int{56, 54}, unlit: [2]int{3, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.corner), func(t *testing.T) {
+			out, err := ApplyWatermark(src, Watermark{Text: "a", Corner: tt.corner, Opacity: 1})
+			if err != nil {
+				t.Fatalf("ApplyWatermark() error = %v", err)
+			}
+			pixels := decodePixels(t, out)
+			if got := pixels[tt.lit[1]*64+tt.lit[0]]; got != (color.NRGBA{255, 255, 255, 255}) {
+				t.Errorf("pixel %v = %v, want white", tt.lit, got)
+			}
+			if got := pixels[tt.unlit[1]*64+tt.unlit[0]]; got != (color.NRGBA{0, 0, 0, 255}) {
+				t.Errorf("pixel %v = %v, want unchanged black", tt.unlit, got)
+			}
+		})
+	}
+}
+
+func TestApplyWatermark_OverlayOpacity(t *testing.T) {
+	src := mustEncodeRGB(t, 8, 8, make([]byte, 8*8*3))
+	overlay := mustEncodeRGB(t, 1, 1, []byte{255, 0, 0})
+
+	out, err := ApplyWatermark(src, Watermark{Overlay: overlay, Corner: CornerTopLeft, Opacity: 0.5})
+	if err != nil {
+		t.Fatalf("ApplyWatermark() error = %v", err)
+	}
+
+	// Drawn at the 2 pixel margin, half blended over black
+	got := decodePixels(t, out)[2*8+2]
+	if got.R < 127 || got.R > 129 || got.G != 0 || got.B != 0 {
+		t.Errorf("overlay pixel = %v, want half-strength red", got)
+	}
+}
+
+func TestApplyWatermark_InvalidOverlay(t *testing.T) {
+	src := mustEncodeRGB(t, 8, 8, make([]byte, 8*8*3))
+
+	_, err := ApplyWatermark(src, Watermark{Overlay: []byte("not a png"), Opacity: 1})
+	if !errors.Is(err, ErrInvalidWatermark) {
+		t.Errorf("ApplyWatermark() error = %v, want %v", err, ErrInvalidWatermark)
+	}
+}
+
+func TestWatermarkCache(t *testing.T) {
+	cache, err := NewWatermarkCache(Watermark{Text: "weave", Opacity: 0.8}, 1)
+	if err != nil {
+		t.Fatalf("NewWatermarkCache() error = %v", err)
+	}
+	black := mustEncodeRGB(t, 32, 32, make([]byte, 32*32*3))
+	grey := mustEncodeRGB(t, 32, 32, bytes.Repeat([]byte{128}, 32*32*3))
+
+	first, err := cache.Apply(black)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	again, err := cache.Apply(black)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if &first[0] != &again[0] {
+		t.Error("second Apply() of the same image was not served from the cache")
+	}
+
+	// A different source evicts the only entry
+	if _, err := cache.Apply(grey); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", cache.Len())
+	}
+	evicted, err := cache.Apply(black)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if &evicted[0] == &first[0] {
+		t.Error("Apply() returned an evicted entry")
+	}
+	if !bytes.Equal(evicted, first) {
+		t.Error("recomputed watermark differs from the original")
+	}
+}
+
+func TestNewWatermarkCache_Invalid(t *testing.T) {
+	if _, err := NewWatermarkCache(Watermark{}, 0); !errors.Is(err, ErrInvalidWatermark) {
+		t.Errorf("NewWatermarkCache() error = %v, want %v", err, ErrInvalidWatermark)
+	}
+}
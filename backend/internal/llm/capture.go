@@ -0,0 +1,166 @@
+package llm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCaptureDir is where --capture-llm writes its captures.
+const DefaultCaptureDir = "config/debug/llm"
+
+// captureSuffix ends the name of every capture file.
+const captureSuffix = ".txt"
+
+// redacted replaces the values of headers that carry secrets.
+const redacted = "[REDACTED]"
+
+// secretHeaders are left out of captures.
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key", "Api-Key"}
+
+// captureSeq orders captures written in the same microsecond.
+var captureSeq atomic.Int64
+
+// NewCaptureTransport returns a transport that sends requests with next
+// (http.DefaultTransport if nil) and writes each request and its raw
+// response, as streamed, to a new file in dir. Headers carrying secrets,
+// such as the OpenAI API key, are redacted. Files are named by time, so the
+// newest sorts last; see LatestCapture.
+//
+// Capturing is best effort: if a file cannot be written the request is
+// still sent and the failure is logged.
+func NewCaptureTransport(dir string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &captureTransport{dir: dir, next: next}
+}
+
+type captureTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f, err := t.create()
+	if err != nil {
+		log.Printf("Failed to capture LLM request: %v", err)
+		return t.next.RoundTrip(req)
+	}
+
+	if err := writeCapturedRequest(f, req); err != nil {
+		log.Printf("Failed to capture LLM request to %s: %v", f.Name(), err)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		fmt.Fprintf(f, "\n\n--- request failed: %v\n", err)
+		f.Close()
+		return nil, err
+	}
+
+	fmt.Fprintf(f, "\n\n%s %s\n", resp.Proto, resp.Status)
+	scrubbedHeader(resp.Header).Write(f)
+	io.WriteString(f, "\n")
+	resp.Body = &captureBody{ReadCloser: resp.Body, file: f}
+	return resp, nil
+}
+
+// create opens a new capture file in the directory.
+func (t *captureTransport) create() (*os.File, error) {
+	// Captures hold the user's conversations: keep them private
+	if err := os.MkdirAll(t.dir, 0o700); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("llm-%s-%06d%s", time.Now().UTC().Format("20060102-150405.000000"), captureSeq.Add(1)%1000000, captureSuffix)
+	return os.OpenFile(filepath.Join(t.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+}
+
+// writeCapturedRequest writes the request line, scrubbed headers and body
+// to w. The body is read and replaced so the request can still be sent.
+func writeCapturedRequest(w io.Writer, req *http.Request) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "%s %s\n", req.Method, req.URL.Redacted()); err != nil {
+		return err
+	}
+	if err := scrubbedHeader(req.Header).Write(w); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// scrubbedHeader returns a copy of h with secret values redacted.
+func scrubbedHeader(h http.Header) http.Header {
+	scrubbed := h.Clone()
+	for _, name := range secretHeaders {
+		if scrubbed.Get(name) != "" {
+			scrubbed.Set(name, redacted)
+		}
+	}
+	return scrubbed
+}
+
+// captureBody copies a response body to the capture file as it is read.
+type captureBody struct {
+	io.ReadCloser
+	file      *os.File
+	closeOnce sync.Once
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.file.Write(p[:n])
+	}
+	return n, err
+}
+
+func (b *captureBody) Close() error {
+	b.closeOnce.Do(func() { b.file.Close() })
+	return b.ReadCloser.Close()
+}
+
+// LatestCapture returns the path of the newest capture in dir.
+// Returns an error wrapping fs.ErrNotExist if there is none.
+func LatestCapture(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), captureSuffix) {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no LLM captures in %s: %w", dir, fs.ErrNotExist)
+	}
+	return filepath.Join(dir, slices.Max(names)), nil
+}
@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCaptureTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"model":"llama3.2:1b"}` {
+			t.Errorf("server got body %q, want the request body", body)
+		}
+		w.Write([]byte("{\"message\":\"hel\"}\n{\"message\":\"lo\",\"done\":true}\n"))
+	}))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "captures")
+	client := &http.Client{Transport: NewCaptureTransport(dir, nil)}
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/chat", strings.NewReader(`{"model":"llama3.2:1b"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	path, err := LatestCapture(dir)
+	if err != nil {
+		t.Fatalf("LatestCapture() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capture := string(data)
+	for _, want := range []string{
+		"POST " + server.URL + "/api/chat\n",
+		"Authorization: " + redacted,
+		`{"model":"llama3.2:1b"}`,
+		"200 OK",
+		"{\"message\":\"hel\"}\n{\"message\":\"lo\",\"done\":true}\n",
+	} {
+		if !strings.Contains(capture, want) {
+			t.Errorf("capture = %q, want it to contain %q", capture, want)
+		}
+	}
+	if strings.Contains(capture, "sk-secret") {
+		t.Errorf("capture contains the API key: %q", capture)
+	}
+}
+
+func TestLatestCapture(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LatestCapture(dir); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("LatestCapture(empty) error = %v, want %v", err, fs.ErrNotExist)
+	}
+	if _, err := LatestCapture(filepath.Join(dir, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("LatestCapture(missing) error = %v, want %v", err, fs.ErrNotExist)
+	}
+
+	for _, name := range []string{
+		"llm-20260101-120000.000000-000002.txt",
+		"llm-20260102-090000.000000-000001.txt",
+		"notes.md",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path, err := LatestCapture(dir)
+	if err != nil {
+		t.Fatalf("LatestCapture() error = %v", err)
+	}
+	if want := filepath.Join(dir, "llm-20260102-090000.000000-000001.txt"); path != want {
+		t.Errorf("LatestCapture() = %q, want %q", path, want)
+	}
+}
@@ -0,0 +1,81 @@
+// Package llm defines the chat backend weave's agent talks to. Ollama is
+// the default backend; OpenAIClient speaks the OpenAI chat-completions API
+// served by llama.cpp, vLLM, LM Studio and hosted providers.
+//
+// The message, tool and result types are shared with the ollama package,
+// whose API mirrors OpenAI's closely enough to serve both backends, so
+// both produce the same ChatResult from the agent's update_generation call.
+package llm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// Types shared by all backends.
+type (
+	Message        = ollama.Message
+	Tool           = ollama.Tool
+	ToolCall       = ollama.ToolCall
+	StreamToken    = ollama.StreamToken
+	StreamCallback = ollama.StreamCallback
+	ChatResult     = ollama.ChatResult
+	ModelInfo      = ollama.ModelInfo
+)
+
+// Sentinel errors for OpenAI-compatible backends. The ollama client returns
+// the equivalent ollama errors. Both backends return ollama.ErrMissingFields
+// when the agent's tool call lacks a required field.
+var (
+	// ErrNotRunning is returned when nothing is listening at the endpoint
+	ErrNotRunning = errors.New("LLM server not running")
+	// ErrConnectionTimeout is returned when the connection times out
+	ErrConnectionTimeout = errors.New("LLM server connection timeout")
+	// ErrRequestFailed is returned when an API request fails
+	ErrRequestFailed = errors.New("LLM server request failed")
+	// ErrConnectionFailed is returned when connection fails for unknown reasons
+	ErrConnectionFailed = errors.New("LLM server connection failed")
+)
+
+// Client sends a conversation to an LLM and streams the reply. See
+// ollama.Client.Chat for the meaning of the parameters; implementations use
+// the model named by ollama.WithModel when the context carries one.
+type Client interface {
+	Chat(ctx context.Context, messages []Message, seed *int64, tools []Tool, callback StreamCallback) (ChatResult, error)
+}
+
+// Checker is implemented by clients that can check that the backend is
+// reachable and the model is available.
+type Checker interface {
+	Connect(ctx context.Context) error
+	Model() string
+}
+
+// ModelLister is implemented by clients that can list the backend's models
+// and report the configured default.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+	Model() string
+}
+
+// Unloader is implemented by clients that can unload the backend's models
+// from memory, freeing VRAM for image generation. Unload returns the names
+// of the unloaded models.
+type Unloader interface {
+	Unload(ctx context.Context) ([]string, error)
+}
+
+// ContextSizer is implemented by clients that can report how many tokens a
+// model attends to, so conversations can be trimmed to fit. An empty model
+// means the configured one.
+type ContextSizer interface {
+	ContextLength(ctx context.Context, model string) (int, error)
+}
+
+// Embedder is implemented by clients that can compute text embeddings with
+// an embedding model, for semantic search over conversations.
+type Embedder interface {
+	Embed(ctx context.Context, model, text string) ([]float32, error)
+}
@@ -0,0 +1,364 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/requestid"
+)
+
+// OpenAI API endpoints, relative to the base URL (e.g. http://localhost:8000/v1)
+const (
+	EndpointChatCompletions = "/chat/completions"
+	EndpointModels          = "/models"
+)
+
+// maxResponseSize bounds a streamed reply, as for ollama.
+const maxResponseSize = 1024 * 1024
+
+// OpenAIClient talks to a server implementing the OpenAI chat-completions
+// API. Replies are streamed as server-sent events.
+type OpenAIClient struct {
+	endpoint   string // base URL, including any /v1 prefix
+	model      string
+	apiKey     string // sent as a bearer token when set
+	httpClient *http.Client
+
+	chatTransport http.RoundTripper // sends chat requests (nil = default)
+}
+
+// NewOpenAIClient creates a client for the OpenAI-compatible API at
+// endpoint (e.g., "http://localhost:8000/v1"). apiKey may be empty for
+// local servers. timeout applies to non-streaming requests.
+func NewOpenAIClient(endpoint, model, apiKey string, timeout time.Duration) *OpenAIClient {
+	return &OpenAIClient{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		model:    model,
+		apiKey:   apiKey,
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+// SetChatTransport sets the transport chat requests are sent with, such
+// as one from NewCaptureTransport. nil uses http.DefaultTransport.
+func (c *OpenAIClient) SetChatTransport(transport http.RoundTripper) {
+	c.chatTransport = transport
+}
+
+// Model returns the configured model name.
+func (c *OpenAIClient) Model() string {
+	return c.model
+}
+
+// Endpoint returns the configured base URL.
+func (c *OpenAIClient) Endpoint() string {
+	return c.endpoint
+}
+
+// Connect verifies that the server is reachable and accepts the API key.
+// The model is not checked: single-model servers such as llama.cpp report
+// a name that need not match the configured one.
+func (c *OpenAIClient) Connect(ctx context.Context) error {
+	_, err := c.ListModels(ctx)
+	return err
+}
+
+// openAIModelList is the response from GET /models.
+type openAIModelList struct {
+	Data []struct {
+		ID      string `json:"id"`
+		Created int64  `json:"created"`
+	} `json:"data"`
+}
+
+// ListModels returns the models the server offers, from GET /models.
+func (c *OpenAIClient) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+EndpointModels, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(ctx, req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, c.classifyError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrRequestFailed, resp.StatusCode)
+	}
+
+	var list openAIModelList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	models := make([]ModelInfo, 0, len(list.Data))
+	for _, m := range list.Data {
+		info := ModelInfo{Name: m.ID}
+		if m.Created > 0 {
+			info.ModifiedAt = time.Unix(m.Created, 0).UTC().Format(time.RFC3339)
+		}
+		models = append(models, info)
+	}
+	return models, nil
+}
+
+// openAIMessage is a message in a chat-completions request. Tool calls from
+// earlier turns are not sent back; the history holds only their text.
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// openAIChatRequest is a request to POST /chat/completions. top_k and
+// repeat_penalty are extensions understood by llama.cpp and vLLM; other
+// servers ignore them.
+type openAIChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Seed     *int64          `json:"seed,omitempty"`
+	Tools    []Tool          `json:"tools,omitempty"`
+	ollama.Sampling
+
+	// StreamOptions asks for a final event carrying the token usage
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+// openAIStreamOptions are the options for a streamed chat request.
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// openAIChunk is one streamed chat-completions event. Tool calls arrive in
+// pieces: the first piece for an index carries the name, and the arguments
+// string is split across pieces.
+type openAIChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int `json:"index"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+
+	// Usage is only set on the last event, which has no choices
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// Chat sends the conversation to POST /chat/completions and streams the
+// reply. It behaves like ollama.Client.Chat: the callback receives each
+// token, and the update_generation tool call is parsed into the result's
+// metadata. The model named by ctx (see ollama.WithModel) is used instead
+// of the configured model if there is one, and sampling parameters set
+// with ollama.WithSampling are sent with the request.
+//
+// Returns ErrNotRunning if the server is not reachable.
+// Returns ollama.ErrMissingFields if the tool call lacks a required field.
+func (c *OpenAIClient) Chat(ctx context.Context, messages []Message, seed *int64, tools []Tool, callback StreamCallback) (ChatResult, error) {
+	if len(messages) == 0 {
+		return ChatResult{}, errors.New("messages cannot be empty")
+	}
+
+	chatReq := openAIChatRequest{
+		Model:    c.model,
+		Messages: make([]openAIMessage, 0, len(messages)),
+		Stream:   true,
+		Seed:     seed,
+		Tools:    tools,
+		Sampling: ollama.SamplingFromContext(ctx),
+
+		StreamOptions: &openAIStreamOptions{IncludeUsage: true},
+	}
+	if m := ollama.ModelFromContext(ctx); m != "" {
+		chatReq.Model = m
+	}
+	// Only the first message may be a system prompt, as for ollama
+	for i, msg := range messages {
+		switch msg.Role {
+		case ollama.RoleSystem:
+			if i != 0 {
+				return ChatResult{}, errors.New("system message must be first in conversation")
+			}
+		case ollama.RoleUser, ollama.RoleAssistant:
+		default:
+			return ChatResult{}, fmt.Errorf("invalid message role: %q", msg.Role)
+		}
+		chatReq.Messages = append(chatReq.Messages, openAIMessage{Role: msg.Role, Content: msg.Content})
+	}
+
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return ChatResult{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+EndpointChatCompletions, bytes.NewReader(body))
+	if err != nil {
+		return ChatResult{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	c.setHeaders(ctx, req)
+
+	// No client timeout: it would cut off long streams. The context
+	// bounds the request instead.
+	streamClient := &http.Client{Transport: c.chatTransport}
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return ChatResult{}, c.classifyError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return ChatResult{}, fmt.Errorf("%w: status %d: %s", ErrRequestFailed, resp.StatusCode, string(errBody))
+	}
+
+	text, toolCalls, usage, err := parseEventStream(ctx, resp.Body, callback)
+	if err != nil {
+		return ChatResult{}, err
+	}
+	result, err := ollama.ResultFromStream(text, toolCalls)
+	if err != nil {
+		return ChatResult{}, err
+	}
+	result.Usage = usage
+	result.Model = chatReq.Model
+	return result, nil
+}
+
+// parseEventStream reads a streamed chat-completions reply, passing content
+// tokens to callback. It returns the reply text, the assembled tool calls in
+// index order with arguments encoded as a JSON string as ollama sends them,
+// and the token usage if the server reported it.
+func parseEventStream(ctx context.Context, body io.Reader, callback StreamCallback) (string, []ToolCall, ollama.Usage, error) {
+	reqID := requestid.FromContext(ctx)
+	scanner := bufio.NewScanner(body)
+	var text strings.Builder
+	type partialCall struct {
+		name string
+		args strings.Builder
+	}
+	calls := make(map[int]*partialCall)
+	var usage ollama.Usage
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Blank lines separate events; lines starting with ":" are comments
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			log.Printf("DEBUG: [request %s] failed to parse event: %v, raw: %s", reqID, err, data)
+			return "", nil, ollama.Usage{}, fmt.Errorf("failed to parse response: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = ollama.Usage{PromptTokens: chunk.Usage.PromptTokens, CompletionTokens: chunk.Usage.CompletionTokens}
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+
+		for _, tc := range delta.ToolCalls {
+			call, ok := calls[tc.Index]
+			if !ok {
+				call = &partialCall{}
+				calls[tc.Index] = call
+			}
+			if tc.Function.Name != "" {
+				call.name = tc.Function.Name
+			}
+			call.args.WriteString(tc.Function.Arguments)
+		}
+
+		if delta.Content != "" {
+			text.WriteString(delta.Content)
+			if text.Len() > maxResponseSize {
+				return "", nil, ollama.Usage{}, fmt.Errorf("response too large (>%d bytes)", maxResponseSize)
+			}
+			if callback != nil {
+				if err := callback(StreamToken{Content: delta.Content}); err != nil {
+					return "", nil, ollama.Usage{}, fmt.Errorf("callback error after %d bytes: %w", text.Len(), err)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, ollama.Usage{}, fmt.Errorf("stream read error: %w", err)
+	}
+
+	indexes := make([]int, 0, len(calls))
+	for i := range calls {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	toolCalls := make([]ToolCall, 0, len(indexes))
+	for _, i := range indexes {
+		args, err := json.Marshal(calls[i].args.String())
+		if err != nil {
+			return "", nil, ollama.Usage{}, fmt.Errorf("failed to encode tool call arguments: %w", err)
+		}
+		toolCalls = append(toolCalls, ToolCall{Function: ollama.ToolCallFunction{Name: calls[i].name, Arguments: args}})
+	}
+
+	log.Printf("DEBUG: [request %s] Raw LLM response: %q, tool calls: %d", reqID, text.String(), len(toolCalls))
+	return text.String(), toolCalls, usage, nil
+}
+
+// setHeaders adds the API key and request ID to a request.
+func (c *OpenAIClient) setHeaders(ctx context.Context, req *http.Request) {
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+}
+
+// classifyError converts low-level HTTP errors into the package's errors.
+func (c *OpenAIClient) classifyError(err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return context.Canceled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrConnectionTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Errorf("%w at %s", ErrNotRunning, c.endpoint)
+	}
+	return fmt.Errorf("%w: %v", ErrConnectionFailed, err)
+}
@@ -0,0 +1,249 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// sseEvents renders chat-completions chunks as a server-sent event stream.
+func sseEvents(chunks ...string) string {
+	var b strings.Builder
+	for _, c := range chunks {
+		fmt.Fprintf(&b, "data: %s\n\n", c)
+	}
+	b.WriteString("data: [DONE]\n\n")
+	return b.String()
+}
+
+// newOpenAIServer returns a fake chat-completions server that records the
+// last chat request and replies with stream.
+func newOpenAIServer(t *testing.T, stream string, got *openAIChatRequest, gotHeader *http.Header) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1"+EndpointChatCompletions {
+			http.NotFound(w, r)
+			return
+		}
+		if got != nil {
+			json.NewDecoder(r.Body).Decode(got)
+		}
+		if gotHeader != nil {
+			*gotHeader = r.Header.Clone()
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(stream))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenAIClient_Chat(t *testing.T) {
+	tests := []struct {
+		name         string
+		stream       string
+		wantResponse string
+		wantTokens   []string
+		wantToolCall bool
+		wantPrompt   string
+		wantUsage    ollama.Usage
+		wantErr      error
+	}{
+		{
+			name: "text only",
+			stream: sseEvents(
+				`{"choices":[{"delta":{"role":"assistant","content":"Hello"}}]}`,
+				`{"choices":[{"delta":{"content":" there"}}]}`,
+				`{"choices":[{"delta":{},"finish_reason":"stop"}]}`,
+				`{"choices":[],"usage":{"prompt_tokens":120,"completion_tokens":2,"total_tokens":122}}`,
+			),
+			wantResponse: "Hello there",
+			wantTokens:   []string{"Hello", " there"},
+			wantUsage:    ollama.Usage{PromptTokens: 120, CompletionTokens: 2},
+		},
+		{
+			name: "tool call split across events",
+			stream: ": keep-alive\n\n" + sseEvents(
+				`{"choices":[{"delta":{"content":"Drawing it."}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"update_generation","arguments":"{\"prompt\":\"a c"}}]}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"at\",\"steps\":20,\"cfg\":4.5,\"seed\":-1,\"generate_image\":true}"}}]}}]}`,
+				`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+			),
+			wantResponse: "Drawing it.",
+			wantTokens:   []string{"Drawing it."},
+			wantToolCall: true,
+			wantPrompt:   "a cat",
+		},
+		{
+			name: "tool call missing fields",
+			stream: sseEvents(
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"name":"update_generation","arguments":"{\"prompt\":\"a cat\"}"}}]}}]}`,
+			),
+			wantErr: ollama.ErrMissingFields,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newOpenAIServer(t, tt.stream, nil, nil)
+			client := NewOpenAIClient(server.URL+"/v1", "test-model", "", 5*time.Second)
+
+			var tokens []string
+			result, err := client.Chat(context.Background(), []Message{{Role: ollama.RoleUser, Content: "a cat"}}, nil, nil, func(token StreamToken) error {
+				tokens = append(tokens, token.Content)
+				return nil
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Chat() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if result.Response != tt.wantResponse {
+				t.Errorf("Response = %q, want %q", result.Response, tt.wantResponse)
+			}
+			if strings.Join(tokens, "|") != strings.Join(tt.wantTokens, "|") {
+				t.Errorf("tokens = %q, want %q", tokens, tt.wantTokens)
+			}
+			if result.HasToolCall != tt.wantToolCall {
+				t.Errorf("HasToolCall = %v, want %v", result.HasToolCall, tt.wantToolCall)
+			}
+			if result.Metadata.Prompt != tt.wantPrompt {
+				t.Errorf("Metadata.Prompt = %q, want %q", result.Metadata.Prompt, tt.wantPrompt)
+			}
+			if result.Usage != tt.wantUsage {
+				t.Errorf("Usage = %+v, want %+v", result.Usage, tt.wantUsage)
+			}
+		})
+	}
+}
+
+func TestOpenAIClient_ChatRequest(t *testing.T) {
+	var got openAIChatRequest
+	var header http.Header
+	server := newOpenAIServer(t, sseEvents(`{"choices":[{"delta":{"content":"ok"}}]}`), &got, &header)
+	client := NewOpenAIClient(server.URL+"/v1/", "default-model", "sk-test", 5*time.Second)
+
+	seed := int64(42)
+	temperature := 0.4
+	ctx := ollama.WithModel(context.Background(), "session-model")
+	ctx = ollama.WithSampling(ctx, ollama.Sampling{Temperature: &temperature})
+	messages := []Message{
+		{Role: ollama.RoleSystem, Content: "be helpful"},
+		{Role: ollama.RoleUser, Content: "hi"},
+	}
+	result, err := client.Chat(ctx, messages, &seed, []Tool{ollama.UpdateGenerationTool()}, nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	if got.Model != "session-model" {
+		t.Errorf("model = %q, want %q", got.Model, "session-model")
+	}
+	if result.Model != "session-model" {
+		t.Errorf("result model = %q, want %q", result.Model, "session-model")
+	}
+	if !got.Stream || got.StreamOptions == nil || !got.StreamOptions.IncludeUsage {
+		t.Errorf("stream, stream_options = %v, %+v, want streamed with usage", got.Stream, got.StreamOptions)
+	}
+	if got.Seed == nil || *got.Seed != 42 {
+		t.Errorf("seed = %v, want 42", got.Seed)
+	}
+	if got.Temperature == nil || *got.Temperature != temperature {
+		t.Errorf("temperature = %v, want %v", got.Temperature, temperature)
+	}
+	if got.TopP != nil {
+		t.Errorf("top_p = %v, want unset", *got.TopP)
+	}
+	if len(got.Messages) != 2 || got.Messages[0].Role != "system" || got.Messages[1].Content != "hi" {
+		t.Errorf("messages = %+v", got.Messages)
+	}
+	if len(got.Tools) != 1 || got.Tools[0].Function.Name != "update_generation" {
+		t.Errorf("tools = %+v, want update_generation", got.Tools)
+	}
+	if auth := header.Get("Authorization"); auth != "Bearer sk-test" {
+		t.Errorf("Authorization = %q, want %q", auth, "Bearer sk-test")
+	}
+}
+
+func TestOpenAIClient_ChatErrors(t *testing.T) {
+	messages := []Message{{Role: ollama.RoleUser, Content: "hi"}}
+
+	t.Run("server error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error":{"message":"bad key"}}`, http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		_, err := NewOpenAIClient(server.URL, "m", "", time.Second).Chat(context.Background(), messages, nil, nil, nil)
+		if !errors.Is(err, ErrRequestFailed) {
+			t.Errorf("Chat() error = %v, want %v", err, ErrRequestFailed)
+		}
+	})
+
+	t.Run("not running", func(t *testing.T) {
+		_, err := NewOpenAIClient("http://127.0.0.1:1", "m", "", time.Second).Chat(context.Background(), messages, nil, nil, nil)
+		if !errors.Is(err, ErrNotRunning) {
+			t.Errorf("Chat() error = %v, want %v", err, ErrNotRunning)
+		}
+	})
+
+	t.Run("misplaced system message", func(t *testing.T) {
+		bad := []Message{{Role: ollama.RoleUser, Content: "hi"}, {Role: ollama.RoleSystem, Content: "obey"}}
+		if _, err := NewOpenAIClient("http://127.0.0.1:1", "m", "", time.Second).Chat(context.Background(), bad, nil, nil, nil); err == nil {
+			t.Error("Chat() error = nil, want error")
+		}
+	})
+}
+
+func TestOpenAIClient_ListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1"+EndpointModels {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"object":"list","data":[{"id":"qwen2.5-7b-instruct","object":"model","created":1700000000},{"id":"local","object":"model"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenAIClient(server.URL+"/v1", "qwen2.5-7b-instruct", "", time.Second)
+	models, err := client.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if len(models) != 2 || models[0].Name != "qwen2.5-7b-instruct" || models[1].Name != "local" {
+		t.Fatalf("ListModels() = %+v", models)
+	}
+	if models[0].ModifiedAt != "2023-11-14T22:13:20Z" {
+		t.Errorf("ModifiedAt = %q, want creation time", models[0].ModifiedAt)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Errorf("Connect() error = %v", err)
+	}
+}
+
+func TestClientsImplementCapabilities(t *testing.T) {
+	clients := map[string]Client{
+		"ollama": ollama.NewClient(),
+		"openai": NewOpenAIClient("http://localhost:8000/v1", "m", "", time.Second),
+	}
+	for name, c := range clients {
+		if _, ok := c.(Checker); !ok {
+			t.Errorf("%s client does not implement Checker", name)
+		}
+		if _, ok := c.(ModelLister); !ok {
+			t.Errorf("%s client does not implement ModelLister", name)
+		}
+	}
+}
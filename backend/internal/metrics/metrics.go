@@ -0,0 +1,384 @@
+// Package metrics provides counters, gauges and histograms exported in the
+// Prometheus text exposition format.
+//
+// Packages define their metrics as package-level variables with NewCounter,
+// NewGauge and friends, which register them with Default. The web server
+// serves Default at GET /metrics.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefBuckets are histogram buckets in seconds suited to request latencies.
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// SlowBuckets are histogram buckets in seconds suited to LLM chats and
+// image generation, which take from a second to minutes.
+var SlowBuckets = []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300}
+
+// collector is a registered metric family.
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds metric families and writes them in the text format.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// Default is the registry metrics are added to by NewCounter, NewGauge,
+// NewCounterVec and NewHistogram.
+var Default = NewRegistry()
+
+// register adds a collector. Registering a name twice is a programming
+// error and panics.
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.collectors[c.name()]; exists {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	r.collectors[c.name()] = c
+}
+
+// WriteTo writes all metric families, sorted by name, in the Prometheus
+// text exposition format (version 0.0.4).
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].name() < collectors[j].name()
+	})
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ContentType is the media type of the output of WriteTo.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// countingWriter counts bytes written, for WriteTo's return value.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	bits atomic.Uint64
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds v to the counter. Negative values are ignored.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	addFloat(&c.bits, v)
+}
+
+// Value returns the current count.
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Inc adds one to the gauge.
+func (g *Gauge) Inc() {
+	addFloat(&g.bits, 1)
+}
+
+// Dec subtracts one from the gauge.
+func (g *Gauge) Dec() {
+	addFloat(&g.bits, -1)
+}
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// addFloat atomically adds v to a float64 stored as bits.
+func addFloat(bits *atomic.Uint64, v float64) {
+	for {
+		old := bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + v)
+		if bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// ObserveSince records the seconds elapsed since start.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// counterFamily is a registered counter without labels.
+type counterFamily struct {
+	Counter
+	metricName, help string
+}
+
+func (f *counterFamily) name() string { return f.metricName }
+
+func (f *counterFamily) write(w *bufio.Writer) {
+	writeHeader(w, f.metricName, f.help, "counter")
+	writeSample(w, f.metricName, "", f.Value())
+}
+
+// gaugeFamily is a registered gauge.
+type gaugeFamily struct {
+	Gauge
+	metricName, help string
+}
+
+func (f *gaugeFamily) name() string { return f.metricName }
+
+func (f *gaugeFamily) write(w *bufio.Writer) {
+	writeHeader(w, f.metricName, f.help, "gauge")
+	writeSample(w, f.metricName, "", f.Value())
+}
+
+// histogramFamily is a registered histogram.
+type histogramFamily struct {
+	Histogram
+	metricName, help string
+}
+
+func (f *histogramFamily) name() string { return f.metricName }
+
+func (f *histogramFamily) write(w *bufio.Writer) {
+	f.mu.Lock()
+	counts := append([]uint64(nil), f.counts...)
+	sum, count := f.sum, f.count
+	f.mu.Unlock()
+
+	writeHeader(w, f.metricName, f.help, "histogram")
+	for i, upper := range f.buckets {
+		writeSample(w, f.metricName+"_bucket", `le="`+formatFloat(upper)+`"`, float64(counts[i]))
+	}
+	writeSample(w, f.metricName+"_bucket", `le="+Inf"`, float64(count))
+	writeSample(w, f.metricName+"_sum", "", sum)
+	writeSample(w, f.metricName+"_count", "", float64(count))
+}
+
+// CounterVec is a counter family partitioned by label values.
+type CounterVec struct {
+	metricName, help string
+	labelNames       []string
+
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+// With returns the counter for the given label values, in the order the
+// label names were declared. It panics if the number of values is wrong.
+func (v *CounterVec) With(values ...string) *Counter {
+	if len(values) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.metricName, len(v.labelNames), len(values)))
+	}
+
+	pairs := make([]string, len(values))
+	for i, value := range values {
+		pairs[i] = v.labelNames[i] + `="` + escapeLabel(value) + `"`
+	}
+	key := strings.Join(pairs, ",")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c, ok := v.counters[key]
+	if !ok {
+		c = &Counter{}
+		v.counters[key] = c
+	}
+	return c
+}
+
+func (v *CounterVec) name() string { return v.metricName }
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.counters))
+	for key := range v.counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]float64, len(keys))
+	for i, key := range keys {
+		values[i] = v.counters[key].Value()
+	}
+	v.mu.Unlock()
+
+	writeHeader(w, v.metricName, v.help, "counter")
+	for i, key := range keys {
+		writeSample(w, v.metricName, key, values[i])
+	}
+}
+
+// NewCounter registers a counter with r.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	f := &counterFamily{metricName: name, help: help}
+	r.register(f)
+	return &f.Counter
+}
+
+// NewGauge registers a gauge with r.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	f := &gaugeFamily{metricName: name, help: help}
+	r.register(f)
+	return &f.Gauge
+}
+
+// NewHistogram registers a histogram with r. Buckets are upper bounds in
+// increasing order; a +Inf bucket is always added.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	f := &histogramFamily{metricName: name, help: help}
+	f.buckets = append([]float64(nil), buckets...)
+	f.counts = make([]uint64, len(buckets))
+	r.register(f)
+	return &f.Histogram
+}
+
+// NewCounterVec registers a counter family with the given label names.
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	v := &CounterVec{
+		metricName: name,
+		help:       help,
+		labelNames: labelNames,
+		counters:   make(map[string]*Counter),
+	}
+	r.register(v)
+	return v
+}
+
+// NewCounter registers a counter with Default.
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+
+// NewGauge registers a gauge with Default.
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+// NewHistogram registers a histogram with Default.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return Default.NewHistogram(name, help, buckets)
+}
+
+// NewCounterVec registers a counter family with Default.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labelNames...)
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric family.
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// writeSample writes one sample line. labels is already formatted.
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	if labels != "" {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, labels, formatFloat(value))
+		return
+	}
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+// escapeLabel escapes a label value for the text format.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// formatFloat formats a sample value for the text format.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
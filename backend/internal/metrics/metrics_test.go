@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounterVec("test_requests_total", "Requests handled.", "method", "code")
+	requests.With("GET", "200").Inc()
+	requests.With("GET", "200").Inc()
+	requests.With("POST", "500").Add(3)
+
+	depth := r.NewGauge("test_queue_depth", "Queued items.")
+	depth.Inc()
+	depth.Inc()
+	depth.Dec()
+
+	latency := r.NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(2)
+
+	errs := r.NewCounter("test_errors_total", "Errors.\nSecond line.")
+	errs.Add(-1) // ignored
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	want := `# HELP test_errors_total Errors.\nSecond line.
+# TYPE test_errors_total counter
+test_errors_total 0
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 1
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 2.55
+test_latency_seconds_count 3
+# HELP test_queue_depth Queued items.
+# TYPE test_queue_depth gauge
+test_queue_depth 1
+# HELP test_requests_total Requests handled.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",code="200"} 2
+test_requests_total{method="POST",code="500"} 3
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCounterVec_EscapesLabels(t *testing.T) {
+	r := NewRegistry()
+	v := r.NewCounterVec("test_total", "Test.", "path")
+	v.With("a\"b\\c\nd").Inc()
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if want := `test_total{path="a\"b\\c\nd"} 1`; !strings.Contains(b.String(), want) {
+		t.Errorf("WriteTo() = %q, want line %q", b.String(), want)
+	}
+}
+
+func TestCounterVec_WrongLabelCount(t *testing.T) {
+	v := NewRegistry().NewCounterVec("test_total", "Test.", "method", "code")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("With() with missing label value did not panic")
+		}
+	}()
+	v.With("GET")
+}
+
+func TestRegistry_DuplicateName(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "Test.")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate name did not panic")
+		}
+	}()
+	r.NewGauge("test_total", "Test.")
+}
@@ -0,0 +1,185 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Mode
+		wantErr bool
+	}{
+		{"block", ModeBlock, false},
+		{" warn ", ModeWarn, false},
+		{"log", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMode(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrUnknownMode) {
+				t.Errorf("ParseMode() error = %v, want ErrUnknownMode", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeywordList_Moderate(t *testing.T) {
+	list, err := ParseKeywordList(`
+# words and phrases match whole words
+gore
+blood  bath
+/nud(e|ity)/
+`)
+	if err != nil {
+		t.Fatalf("ParseKeywordList() error = %v", err)
+	}
+	if list.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", list.Len())
+	}
+
+	tests := []struct {
+		prompt      string
+		wantFlagged bool
+		wantReason  string
+	}{
+		{"a cat in the snow", false, ""},
+		{"a scene full of GORE", true, `matched keyword "gore"`},
+		{"a gorey scene", false, ""},
+		{"Gorey-style illustration of a mountain gorge", false, ""},
+		{"a blood\tbath", true, `matched keyword "blood  bath"`},
+		{"a nude statue", true, `matched keyword "/nud(e|ity)/"`},
+		{"partial nudity", true, `matched keyword "/nud(e|ity)/"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			result, err := list.Moderate(context.Background(), tt.prompt)
+			if err != nil {
+				t.Fatalf("Moderate() error = %v", err)
+			}
+			if result.Flagged != tt.wantFlagged || result.Reason != tt.wantReason {
+				t.Errorf("Moderate() = %+v, want flagged %v reason %q", result, tt.wantFlagged, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestParseKeywordList_InvalidPattern(t *testing.T) {
+	_, err := ParseKeywordList("ok\n/(unclosed/\n")
+	if !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("ParseKeywordList() error = %v, want ErrInvalidPattern", err)
+	}
+}
+
+func TestLoadKeywordList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocked.txt")
+	if err := os.WriteFile(path, []byte("gore\n"), 0644); err != nil {
+		t.Fatalf("failed to write list: %v", err)
+	}
+	list, err := LoadKeywordList(path)
+	if err != nil {
+		t.Fatalf("LoadKeywordList() error = %v", err)
+	}
+	if list.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", list.Len())
+	}
+
+	if _, err := LoadKeywordList(filepath.Join(t.TempDir(), "missing.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadKeywordList(missing) error = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestClassifier_Moderate(t *testing.T) {
+	tests := []struct {
+		name        string
+		reply       string
+		chatErr     error
+		wantFlagged bool
+		wantReason  string
+		wantErr     bool
+	}{
+		{name: "safe", reply: "SAFE"},
+		{name: "safe lowercase with text", reply: " safe.\n"},
+		{name: "unsafe with reason", reply: "UNSAFE: graphic violence", wantFlagged: true, wantReason: "classified unsafe: graphic violence"},
+		{name: "unsafe without reason", reply: "unsafe", wantFlagged: true, wantReason: "classified unsafe: unspecified"},
+		{name: "unexpected reply", reply: "I can't help with that", wantErr: true},
+		{name: "chat error", chatErr: errors.New("connection refused"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser string
+			c := NewClassifier(func(_ context.Context, system, user string) (string, error) {
+				gotUser = user
+				return tt.reply, tt.chatErr
+			})
+
+			result, err := c.Moderate(context.Background(), "a knight")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Moderate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotUser != "a knight" {
+				t.Errorf("classifier got prompt %q, want %q", gotUser, "a knight")
+			}
+			if result.Flagged != tt.wantFlagged || result.Reason != tt.wantReason {
+				t.Errorf("Moderate() = %+v, want flagged %v reason %q", result, tt.wantFlagged, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestChain_Moderate(t *testing.T) {
+	calls := 0
+	counting := ModeratorFunc(func(context.Context, string) (Result, error) {
+		calls++
+		return Result{}, nil
+	})
+	flagging := ModeratorFunc(func(context.Context, string) (Result, error) {
+		return Result{Flagged: true, Reason: "first"}, nil
+	})
+	failing := ModeratorFunc(func(context.Context, string) (Result, error) {
+		return Result{}, errors.New("classifier down")
+	})
+
+	tests := []struct {
+		name        string
+		chain       Chain
+		wantFlagged bool
+		wantErr     bool
+		wantCalls   int
+	}{
+		{name: "empty", chain: nil},
+		{name: "all pass", chain: Chain{counting, counting}, wantCalls: 2},
+		{name: "stops at flag", chain: Chain{counting, flagging, counting}, wantFlagged: true, wantCalls: 1},
+		{name: "stops at error", chain: Chain{failing, counting}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			result, err := tt.chain.Moderate(context.Background(), "a cat")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Moderate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result.Flagged != tt.wantFlagged {
+				t.Errorf("Flagged = %v, want %v", result.Flagged, tt.wantFlagged)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("moderators called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -11,8 +11,12 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/hurricanerix/weave/internal/metrics"
+	"github.com/hurricanerix/weave/internal/requestid"
 )
 
 // Sentinel errors for ollama client operations
@@ -29,11 +33,28 @@ var (
 	ErrConnectionFailed = errors.New("ollama connection failed")
 )
 
+// Chat metrics, exported at GET /metrics
+var (
+	chatDuration   = metrics.NewHistogram("weave_ollama_chat_duration_seconds", "Time to complete a streamed chat request to ollama.", metrics.SlowBuckets)
+	chatErrors     = metrics.NewCounter("weave_ollama_chat_errors_total", "Chat requests to ollama that failed.")
+	tokensStreamed = metrics.NewCounter("weave_ollama_tokens_streamed_total", "Response chunks streamed from ollama; each chunk is usually one token.")
+	promptTokens   = metrics.NewCounter("weave_ollama_prompt_tokens_total", "Prompt tokens evaluated by ollama, as reported in prompt_eval_count.")
+	evalTokens     = metrics.NewCounter("weave_ollama_eval_tokens_total", "Tokens generated by ollama, as reported in eval_count.")
+)
+
 // Client provides methods to communicate with the ollama API.
 type Client struct {
 	endpoint   string
 	model      string
+	keepAlive  string // sent with chat requests ("" = ollama's default)
+	structured bool   // see SetStructuredOutput
 	httpClient *http.Client
+
+	chatTransport http.RoundTripper // sends chat requests (nil = default)
+
+	// contextLengths caches ContextLength results by model
+	contextMu      sync.Mutex
+	contextLengths map[string]int
 }
 
 // NewClient creates a new ollama client with default settings.
@@ -63,6 +84,30 @@ func NewClientWithConfig(endpoint, model string, timeout time.Duration) *Client
 	}
 }
 
+// SetKeepAlive sets how long ollama keeps the model loaded after each chat,
+// as a duration such as "5m". "0" unloads it after every reply, freeing
+// VRAM for image generation; a negative duration keeps it loaded. "" leaves
+// it to ollama (5 minutes by default).
+func (c *Client) SetKeepAlive(keepAlive string) {
+	c.keepAlive = keepAlive
+}
+
+// SetStructuredOutput sets whether chats ask ollama for a reply in JSON
+// matching StructuredOutputSchema instead of offering the update_generation
+// tool. Ollama constrains the reply to the schema, so models whose tool calls
+// are unreliable still return complete settings. The JSON is not streamed:
+// the callback gets the conversational text and the update_generation call
+// once the reply is complete.
+func (c *Client) SetStructuredOutput(structured bool) {
+	c.structured = structured
+}
+
+// SetChatTransport sets the transport chat requests are sent with, such
+// as one from llm.NewCaptureTransport. nil uses http.DefaultTransport.
+func (c *Client) SetChatTransport(transport http.RoundTripper) {
+	c.chatTransport = transport
+}
+
 // Connect verifies that ollama is reachable and the required model is available.
 // It makes a GET request to /api/tags to check connectivity and model availability.
 //
@@ -70,11 +115,37 @@ func NewClientWithConfig(endpoint, model string, timeout time.Duration) *Client
 // Returns ErrModelNotFound if the configured model is not available.
 // Returns ErrConnectionTimeout if the connection times out.
 func (c *Client) Connect(ctx context.Context) error {
+	models, err := c.ListModels(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Check if the required model is available
+	modelFound := false
+	for _, model := range models {
+		if model.Name == c.model {
+			modelFound = true
+			break
+		}
+	}
+
+	if !modelFound {
+		return fmt.Errorf("%w: %s (pull with: ollama pull %s)", ErrModelNotFound, c.model, c.model)
+	}
+
+	return nil
+}
+
+// ListModels returns the models available in ollama, from GET /api/tags.
+//
+// Returns ErrNotRunning if ollama is not reachable.
+// Returns ErrConnectionTimeout if the connection times out.
+func (c *Client) ListModels(ctx context.Context) ([]ModelInfo, error) {
 	url := c.endpoint + EndpointTags
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	resp, err := c.httpClient.Do(req)
@@ -82,38 +153,87 @@ func (c *Client) Connect(ctx context.Context) error {
 		classified := c.classifyError(err)
 		// Add endpoint context and actionable suggestion for connection errors
 		if errors.Is(classified, ErrNotRunning) {
-			return fmt.Errorf("%w at %s (start with: ollama serve)", ErrNotRunning, c.endpoint)
+			return nil, fmt.Errorf("%w at %s (start with: ollama serve)", ErrNotRunning, c.endpoint)
 		}
-		return classified
+		return nil, classified
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%w: unexpected status %d", ErrRequestFailed, resp.StatusCode)
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrRequestFailed, resp.StatusCode)
 	}
 
 	var tagsResp TagsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&tagsResp); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// Check if the required model is available
-	modelFound := false
-	for _, model := range tagsResp.Models {
-		if model.Name == c.model {
-			modelFound = true
-			break
+	return tagsResp.Models, nil
+}
+
+// Unload asks ollama to unload every model it has in memory, freeing VRAM
+// for image generation. Each model is loaded again by its next chat. It
+// returns the names of the unloaded models.
+//
+// Returns ErrNotRunning if ollama is not reachable.
+// Returns ErrConnectionTimeout if the connection times out.
+func (c *Client) Unload(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+EndpointPs, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, c.classifyError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrRequestFailed, resp.StatusCode)
+	}
+	var ps PsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ps); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	unloaded := make([]string, 0, len(ps.Models))
+	for _, m := range ps.Models {
+		if err := c.unloadModel(ctx, m.Name); err != nil {
+			return unloaded, fmt.Errorf("failed to unload %s: %w", m.Name, err)
 		}
+		unloaded = append(unloaded, m.Name)
 	}
+	return unloaded, nil
+}
 
-	if !modelFound {
-		return fmt.Errorf("%w: %s (pull with: ollama pull %s)", ErrModelNotFound, c.model, c.model)
+// unloadModel sends a chat request with no messages and keep_alive 0,
+// which makes ollama unload the model.
+func (c *Client) unloadModel(ctx context.Context, model string) error {
+	body, err := json.Marshal(ChatRequest{Model: model, Messages: []Message{}, KeepAlive: "0"})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+EndpointChat, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return c.classifyError(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
 
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: unexpected status %d", ErrRequestFailed, resp.StatusCode)
+	}
 	return nil
 }
 
-// Model returns the configured model name.
+// Model returns the configured model name. Chat uses it unless the context
+// names another model; see WithModel.
 func (c *Client) Model() string {
 	return c.model
 }
@@ -123,6 +243,20 @@ func (c *Client) Endpoint() string {
 	return c.endpoint
 }
 
+type modelKey struct{}
+
+// WithModel returns a copy of ctx that makes Chat use model instead of the
+// client's configured model, so the model can be chosen per session.
+func WithModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelKey{}, model)
+}
+
+// ModelFromContext returns the model set by WithModel, or "" if none.
+func ModelFromContext(ctx context.Context) string {
+	model, _ := ctx.Value(modelKey{}).(string)
+	return model
+}
+
 // StreamCallback is called for each token received during streaming.
 // The callback receives the token text and a done flag indicating completion.
 // If the callback returns an error, streaming is aborted.
@@ -130,7 +264,9 @@ type StreamCallback func(token StreamToken) error
 
 // Chat sends a chat request to ollama and streams the response.
 // It posts to /api/chat with the conversation history and streams tokens
-// as they arrive via the callback function.
+// as they arrive via the callback function. The model named by ctx (see
+// WithModel) is used instead of the configured model if there is one, and
+// sampling parameters set with WithSampling are sent with the request.
 //
 // Parameters:
 //   - ctx: Context for cancellation and timeout. IMPORTANT: Use context.WithTimeout
@@ -148,7 +284,7 @@ type StreamCallback func(token StreamToken) error
 // Returns ErrNotRunning if ollama is not reachable.
 // Returns an error if messages is empty.
 // Returns ErrMissingFields if response parsing fails.
-func (c *Client) Chat(ctx context.Context, messages []Message, seed *int64, tools []Tool, callback StreamCallback) (ChatResult, error) {
+func (c *Client) Chat(ctx context.Context, messages []Message, seed *int64, tools []Tool, callback StreamCallback) (result ChatResult, err error) {
 	// Validate messages
 	if len(messages) == 0 {
 		return ChatResult{}, errors.New("messages cannot be empty")
@@ -171,18 +307,37 @@ func (c *Client) Chat(ctx context.Context, messages []Message, seed *int64, tool
 		}
 	}
 
+	start := time.Now()
+	defer func() {
+		chatDuration.ObserveSince(start)
+		if err != nil {
+			chatErrors.Inc()
+		}
+	}()
+
 	url := c.endpoint + EndpointChat
 
 	// Build request body
+	model := c.model
+	if m := ModelFromContext(ctx); m != "" {
+		model = m
+	}
 	chatReq := ChatRequest{
-		Model:    c.model,
-		Messages: messages,
-		Stream:   true,
+		Model:     model,
+		Messages:  messages,
+		Stream:    true,
+		KeepAlive: c.keepAlive,
+	}
+
+	// Add seed and sampling parameters if provided
+	if sampling := SamplingFromContext(ctx); seed != nil || !sampling.IsZero() {
+		chatReq.Options = &ChatOptions{Seed: seed, Sampling: sampling}
 	}
 
-	// Add seed if provided
-	if seed != nil {
-		chatReq.Options = &ChatOptions{Seed: seed}
+	// In structured output mode the schema replaces update_generation
+	if c.structured {
+		chatReq.Format = StructuredOutputSchema()
+		tools = withoutTool(tools, UpdateGenerationToolName)
 	}
 
 	// Add tools if provided
@@ -200,12 +355,15 @@ func (c *Client) Chat(ctx context.Context, messages []Message, seed *int64, tool
 		return ChatResult{}, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
 
 	// Use a separate client without timeout for streaming.
 	// We cannot use c.httpClient because its 60-second timeout would
 	// terminate long-running LLM streams. Context cancellation handles
 	// request lifetime instead.
-	streamClient := &http.Client{}
+	streamClient := &http.Client{Transport: c.chatTransport}
 	resp, err := streamClient.Do(req)
 	if err != nil {
 		classified := c.classifyError(err)
@@ -225,45 +383,63 @@ func (c *Client) Chat(ctx context.Context, messages []Message, seed *int64, tool
 		return ChatResult{}, fmt.Errorf("%w: status %d: %s", ErrRequestFailed, resp.StatusCode, string(errBody))
 	}
 
-	// Parse streaming response (newline-delimited JSON)
-	fullResponse, err := c.parseStreamingResponse(resp.Body, callback)
+	// Parse streaming response (newline-delimited JSON). Structured
+	// output is JSON until it is complete, so only tool calls stream.
+	streamCallback := callback
+	if c.structured && callback != nil {
+		streamCallback = func(token StreamToken) error {
+			if len(token.ToolCalls) == 0 {
+				return nil
+			}
+			return callback(token)
+		}
+	}
+	fullResponse, usage, err := c.parseStreamingResponse(ctx, resp.Body, streamCallback)
 	if err != nil {
 		return ChatResult{}, err
 	}
+	promptTokens.Add(float64(usage.PromptTokens))
+	evalTokens.Add(float64(usage.CompletionTokens))
 
 	// Parse the response to extract conversational text and metadata
-	conversationalText, metadata, hasToolCall, err := parseResponse(fullResponse)
+	if c.structured {
+		result, err = structuredResult(fullResponse)
+		if err == nil {
+			err = replayStructuredResult(result, callback)
+		}
+	} else {
+		result, err = chatResult(fullResponse)
+	}
 	if err != nil {
 		return ChatResult{}, err
 	}
-
-	return ChatResult{
-		Response:    conversationalText,
-		Metadata:    metadata,
-		HasToolCall: hasToolCall,
-		RawResponse: fullResponse,
-	}, nil
+	result.Usage = usage
+	result.Model = model
+	return result, nil
 }
 
 // Maximum response size to prevent unbounded memory usage (1 MB)
 const maxResponseSize = 1024 * 1024
 
 // parseStreamingResponse reads newline-delimited JSON from the response body
-// and calls the callback for each token.
+// and calls the callback for each token. It returns the token usage from
+// the final message.
 //
 // FUNCTION CALL HANDLING:
 // Conversational text streams normally, giving the user a live typing effect.
-// When Done=true, the final chunk may contain tool_calls with the update_generation
-// function arguments. Tool calls are appended to the full response for parsing
-// after the stream completes.
+// Any chunk may contain tool_calls with the update_generation function
+// arguments. They are passed to the callback as soon as they arrive, and
+// appended to the full response for parsing after the stream completes.
 //
 // RESPONSE SIZE LIMIT:
 // We enforce a 1MB limit to prevent unbounded memory usage if the LLM generates
 // an extremely long response (malicious or malfunctioning model).
-func (c *Client) parseStreamingResponse(body io.Reader, callback StreamCallback) (string, error) {
+func (c *Client) parseStreamingResponse(ctx context.Context, body io.Reader, callback StreamCallback) (string, Usage, error) {
+	reqID := requestid.FromContext(ctx)
 	scanner := bufio.NewScanner(body)
 	var fullResponse bytes.Buffer
 	var toolCalls []ToolCall // Collect tool calls from any chunk
+	var usage Usage
 
 	chunkCount := 0
 	for scanner.Scan() {
@@ -273,7 +449,7 @@ func (c *Client) parseStreamingResponse(body io.Reader, callback StreamCallback)
 			// Skip empty lines in newline-delimited JSON stream.
 			// WHY SKIP: Ollama's streaming format may include blank lines between
 			// JSON objects. These are not part of the protocol and should be ignored.
-			log.Printf("DEBUG: Chunk %d: empty line, skipping", chunkCount)
+			log.Printf("DEBUG: [request %s] Chunk %d: empty line, skipping", reqID, chunkCount)
 			continue
 		}
 
@@ -285,19 +461,19 @@ func (c *Client) parseStreamingResponse(body io.Reader, callback StreamCallback)
 			// Parsing failed - malformed JSON from ollama.
 			// WHY FAIL IMMEDIATELY: If ollama sends malformed JSON, we can't trust
 			// the rest of the stream. Better to fail fast than continue with corrupted data.
-			log.Printf("DEBUG: Chunk %d: failed to parse JSON: %v, raw: %s", chunkCount, err, string(line))
-			return "", fmt.Errorf("failed to parse response: %w", err)
+			log.Printf("DEBUG: [request %s] Chunk %d: failed to parse JSON: %v, raw: %s", reqID, chunkCount, err, string(line))
+			return "", Usage{}, fmt.Errorf("failed to parse response: %w", err)
 		}
 
 		// Log each chunk for debugging
-		log.Printf("DEBUG: Chunk %d: Done=%v, Content=%q, ToolCalls=%d", chunkCount, chatResp.Done, chatResp.Message.Content, len(chatResp.Message.ToolCalls))
+		log.Printf("DEBUG: [request %s] Chunk %d: Done=%v, Content=%q, ToolCalls=%d", reqID, chunkCount, chatResp.Done, chatResp.Message.Content, len(chatResp.Message.ToolCalls))
 
 		// Collect tool calls from ANY chunk (not just the final one).
 		// WHY: Ollama may return tool calls in non-final chunks with Done=false.
 		// We need to capture them regardless of which chunk they appear in.
 		if len(chatResp.Message.ToolCalls) > 0 {
 			toolCalls = append(toolCalls, chatResp.Message.ToolCalls...)
-			log.Printf("DEBUG: Captured %d tool calls from chunk %d", len(chatResp.Message.ToolCalls), chunkCount)
+			log.Printf("DEBUG: [request %s] Captured %d tool calls from chunk %d", reqID, len(chatResp.Message.ToolCalls), chunkCount)
 		}
 
 		token := chatResp.Message.Content
@@ -312,23 +488,37 @@ func (c *Client) parseStreamingResponse(body io.Reader, callback StreamCallback)
 		// WHY: Without a limit, a malicious or malfunctioning LLM could exhaust
 		// server memory by generating an infinite response.
 		if fullResponse.Len() > maxResponseSize {
-			return fullResponse.String(), fmt.Errorf("response too large (>%d bytes)", maxResponseSize)
+			return fullResponse.String(), Usage{}, fmt.Errorf("response too large (>%d bytes)", maxResponseSize)
 		}
 
 		// Send token to callback for live streaming display.
 		// WHY SKIP EMPTY: Tool calls may appear in a chunk with empty content.
 		// Empty tokens provide no value to the UI and should be filtered out.
+		if token != "" {
+			tokensStreamed.Inc()
+		}
 		if callback != nil && token != "" {
 			streamToken := StreamToken{
 				Content: token,
 				Done:    false,
 			}
 			if err := callback(streamToken); err != nil {
-				return fullResponse.String(), fmt.Errorf("callback error after %d bytes: %w", fullResponse.Len(), err)
+				return fullResponse.String(), Usage{}, fmt.Errorf("callback error after %d bytes: %w", fullResponse.Len(), err)
+			}
+		}
+
+		// Pass tool calls on as they arrive.
+		// WHY NOT WAIT: Ollama sends each tool call whole, often before the
+		// conversational text ends, so the UI can show new settings and start
+		// generating while the rest of the reply streams.
+		if callback != nil && len(chatResp.Message.ToolCalls) > 0 {
+			if err := callback(StreamToken{ToolCalls: chatResp.Message.ToolCalls}); err != nil {
+				return fullResponse.String(), Usage{}, fmt.Errorf("callback error after %d bytes: %w", fullResponse.Len(), err)
 			}
 		}
 
 		if chatResp.Done {
+			usage = Usage{PromptTokens: chatResp.PromptEvalCount, CompletionTokens: chatResp.EvalCount}
 			// Stream is complete - stop reading.
 			// WHY CHECK DONE: Ollama signals stream completion by setting Done=true
 			// in the final JSON object. This is more reliable than waiting for EOF
@@ -342,36 +532,21 @@ func (c *Client) parseStreamingResponse(body io.Reader, callback StreamCallback)
 	// We must distinguish between clean completion (Done=true) and I/O errors
 	// (network failure, connection closed). Scanner.Err() tells us which it was.
 	if err := scanner.Err(); err != nil {
-		return fullResponse.String(), fmt.Errorf("stream read error: %w", err)
+		return fullResponse.String(), Usage{}, fmt.Errorf("stream read error: %w", err)
 	}
 
 	// DEBUG: Log raw response and tool calls
-	log.Printf("DEBUG: Raw LLM response: %q, has tool calls: %v", fullResponse.String(), len(toolCalls) > 0)
+	log.Printf("DEBUG: [request %s] Raw LLM response: %q, has tool calls: %v", reqID, fullResponse.String(), len(toolCalls) > 0)
 	if len(toolCalls) > 0 {
-		log.Printf("DEBUG: Tool calls: %+v", toolCalls)
+		log.Printf("DEBUG: [request %s] Tool calls: %+v", reqID, toolCalls)
 	}
 
 	// If we collected any tool calls (from any chunk), append them to the response
 	// in a format that parseResponse() can extract.
 	//
-	// WHY APPEND TOOL CALLS: parseResponse() expects to find tool calls at the end
-	// of the response. By appending them with a marker, we preserve both the
-	// conversational text (for display) and the structured function call data
-	// (for parameter extraction).
-	//
 	// NOTE: Tool calls may appear in non-final chunks (Done=false), so we collect
 	// them from all chunks during streaming rather than only the last chunk.
-	if len(toolCalls) > 0 {
-		// Append tool calls as JSON array with marker
-		toolCallData, err := json.Marshal(toolCalls)
-		if err == nil {
-			// Append tool calls with a marker that parseResponse() can detect
-			fullResponse.WriteString("\n__TOOL_CALLS__\n")
-			fullResponse.Write(toolCallData)
-		}
-	}
-
-	return fullResponse.String(), nil
+	return appendToolCalls(fullResponse.String(), toolCalls), usage, nil
 }
 
 // classifyError converts low-level HTTP errors into user-friendly errors.
@@ -11,6 +11,8 @@ import (
 	"syscall"
 	"testing"
 	"time"
+
+	"github.com/hurricanerix/weave/internal/requestid"
 )
 
 // timeoutError implements net.Error with Timeout() returning true
@@ -92,6 +94,67 @@ func TestConnectSuccess(t *testing.T) {
 	}
 }
 
+func TestListModels(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "models",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(TagsResponse{Models: []ModelInfo{
+					{Name: "llama3.1:8b", Size: 1000},
+					{Name: "qwen2.5:7b", Size: 2000},
+				}})
+			},
+			want: []string{"llama3.1:8b", "qwen2.5:7b"},
+		},
+		{
+			name: "no models",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"models":[]}`))
+			},
+			want: []string{},
+		},
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "boom", http.StatusInternalServerError)
+			},
+			wantErr: ErrRequestFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			client := NewClientWithConfig(server.URL, DefaultModel, 5*time.Second)
+			models, err := client.ListModels(context.Background())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ListModels() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListModels() error = %v", err)
+			}
+			if len(models) != len(tt.want) {
+				t.Fatalf("ListModels() returned %d models, want %d", len(models), len(tt.want))
+			}
+			for i, name := range tt.want {
+				if models[i].Name != name {
+					t.Errorf("models[%d].Name = %q, want %q", i, models[i].Name, name)
+				}
+			}
+		})
+	}
+}
+
 func TestConnectModelNotFound(t *testing.T) {
 	// Create test server that returns different models
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -446,7 +509,9 @@ func TestChatSuccess(t *testing.T) {
 
 	var tokens []string
 	callback := func(token StreamToken) error {
-		tokens = append(tokens, token.Content)
+		if len(token.ToolCalls) == 0 {
+			tokens = append(tokens, token.Content)
+		}
 		return nil
 	}
 
@@ -604,6 +669,243 @@ func TestChatWithoutSeed(t *testing.T) {
 	}
 }
 
+func TestChatWithModel(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"configured model", context.Background(), DefaultModel},
+		{"context model", WithModel(context.Background(), "qwen2.5:7b"), "qwen2.5:7b"},
+		{"empty context model", WithModel(context.Background(), ""), DefaultModel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var chatReq ChatRequest
+				json.NewDecoder(r.Body).Decode(&chatReq)
+				received = chatReq.Model
+				data, _ := json.Marshal(ChatResponse{Model: chatReq.Model, Message: Message{
+					Role: RoleAssistant,
+					ToolCalls: []ToolCall{{Function: ToolCallFunction{
+						Name:      "update_generation",
+						Arguments: []byte(`{"prompt": "", "generate_image": false, "steps": 20, "cfg": 7.0, "seed": 0}`),
+					}}},
+				}, Done: true})
+				w.Write(data)
+				w.Write([]byte("\n"))
+			}))
+			defer server.Close()
+
+			client := NewClientWithConfig(server.URL, DefaultModel, 5*time.Second)
+			result, err := client.Chat(tt.ctx, []Message{{Role: RoleUser, Content: "test"}}, nil, nil, nil)
+			if err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if received != tt.want {
+				t.Errorf("request model = %q, want %q", received, tt.want)
+			}
+			if result.Model != tt.want {
+				t.Errorf("result model = %q, want %q", result.Model, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"message":{"role":"assistant","content":"Hi"},"done":false}` + "\n"))
+		w.Write([]byte(`{"message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":812,"eval_count":37}` + "\n"))
+	}))
+	defer server.Close()
+
+	prompt, eval := promptTokens.Value(), evalTokens.Value()
+
+	client := NewClientWithConfig(server.URL, DefaultModel, 5*time.Second)
+	result, err := client.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if want := (Usage{PromptTokens: 812, CompletionTokens: 37}); result.Usage != want {
+		t.Errorf("Usage = %+v, want %+v", result.Usage, want)
+	}
+	if got := promptTokens.Value() - prompt; got != 812 {
+		t.Errorf("prompt tokens metric grew by %v, want 812", got)
+	}
+	if got := evalTokens.Value() - eval; got != 37 {
+		t.Errorf("eval tokens metric grew by %v, want 37", got)
+	}
+}
+
+func TestChatWithSampling(t *testing.T) {
+	temperature := 0.3
+	topK := 20
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"no sampling", context.Background(), ""},
+		{"empty sampling", WithSampling(context.Background(), Sampling{}), ""},
+		{"sampling", WithSampling(context.Background(), Sampling{Temperature: &temperature, TopK: &topK}), `{"temperature":0.3,"top_k":20}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received json.RawMessage
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var chatReq struct {
+					Options json.RawMessage `json:"options"`
+				}
+				json.NewDecoder(r.Body).Decode(&chatReq)
+				received = chatReq.Options
+				data, _ := json.Marshal(ChatResponse{Model: DefaultModel, Message: Message{
+					Role: RoleAssistant,
+					ToolCalls: []ToolCall{{Function: ToolCallFunction{
+						Name:      "update_generation",
+						Arguments: []byte(`{"prompt": "", "generate_image": false, "steps": 20, "cfg": 7.0, "seed": 0}`),
+					}}},
+				}, Done: true})
+				w.Write(data)
+				w.Write([]byte("\n"))
+			}))
+			defer server.Close()
+
+			client := NewClientWithConfig(server.URL, DefaultModel, 5*time.Second)
+			if _, err := client.Chat(tt.ctx, []Message{{Role: RoleUser, Content: "test"}}, nil, nil, nil); err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if got := string(received); got != tt.want {
+				t.Errorf("request options = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatKeepAlive(t *testing.T) {
+	tests := []struct {
+		name      string
+		keepAlive string
+		want      string
+	}{
+		{"ollama default", "", ""},
+		{"unload after reply", "0", "0"},
+		{"duration", "30m", "30m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received ChatRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&received)
+				data, _ := json.Marshal(ChatResponse{Model: DefaultModel, Message: Message{
+					Role: RoleAssistant,
+					ToolCalls: []ToolCall{{Function: ToolCallFunction{
+						Name:      "update_generation",
+						Arguments: []byte(`{"prompt": "", "generate_image": false, "steps": 20, "cfg": 7.0, "seed": 0}`),
+					}}},
+				}, Done: true})
+				w.Write(data)
+				w.Write([]byte("\n"))
+			}))
+			defer server.Close()
+
+			client := NewClientWithConfig(server.URL, DefaultModel, 5*time.Second)
+			client.SetKeepAlive(tt.keepAlive)
+			if _, err := client.Chat(context.Background(), []Message{{Role: RoleUser, Content: "test"}}, nil, nil, nil); err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if received.KeepAlive != tt.want {
+				t.Errorf("keep_alive = %q, want %q", received.KeepAlive, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnload(t *testing.T) {
+	var unloaded []ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case EndpointPs:
+			json.NewEncoder(w).Encode(PsResponse{Models: []ModelInfo{{Name: "llama3.1:8b"}, {Name: "qwen2.5:7b"}}})
+		case EndpointChat:
+			var req ChatRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			unloaded = append(unloaded, req)
+			w.Write([]byte(`{"model":"` + req.Model + `","done":true,"done_reason":"unload"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClientWithConfig(server.URL, DefaultModel, 5*time.Second)
+	names, err := client.Unload(context.Background())
+	if err != nil {
+		t.Fatalf("Unload() error = %v", err)
+	}
+	if strings.Join(names, ",") != "llama3.1:8b,qwen2.5:7b" {
+		t.Errorf("Unload() = %v, want both loaded models", names)
+	}
+	for _, req := range unloaded {
+		if req.KeepAlive != "0" || len(req.Messages) != 0 || req.Stream {
+			t.Errorf("unload request = %+v, want keep_alive 0, no messages, not streamed", req)
+		}
+	}
+	if len(unloaded) != 2 {
+		t.Errorf("sent %d unload requests, want 2", len(unloaded))
+	}
+
+	if _, err := NewClientWithConfig("http://127.0.0.1:1", DefaultModel, time.Second).Unload(context.Background()); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Unload() error = %v, want %v", err, ErrNotRunning)
+	}
+}
+
+func TestChatRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"without request ID", context.Background(), ""},
+		{"with request ID", requestid.NewContext(context.Background(), "00a1b2c3d4e5f6"), "00a1b2c3d4e5f6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r.Header.Get(requestid.Header)
+				data, _ := json.Marshal(ChatResponse{Model: DefaultModel, Message: Message{
+					Role: RoleAssistant,
+					ToolCalls: []ToolCall{{Function: ToolCallFunction{
+						Name:      "update_generation",
+						Arguments: []byte(`{"prompt": "", "generate_image": false, "steps": 20, "cfg": 7.0, "seed": 0}`),
+					}}},
+				}, Done: true})
+				w.Write(data)
+				w.Write([]byte("\n"))
+			}))
+			defer server.Close()
+
+			client := &Client{
+				endpoint:   server.URL,
+				model:      DefaultModel,
+				httpClient: &http.Client{Timeout: 5 * time.Second},
+			}
+
+			if _, err := client.Chat(tt.ctx, []Message{{Role: RoleUser, Content: "test"}}, nil, nil, nil); err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if received != tt.want {
+				t.Errorf("%s header = %q, want %q", requestid.Header, received, tt.want)
+			}
+		})
+	}
+}
+
 func TestChatCallbackError(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		responses := []ChatResponse{
@@ -766,7 +1068,7 @@ func TestParseStreamingResponse(t *testing.T) {
 				return nil
 			}
 
-			response, err := client.parseStreamingResponse(strings.NewReader(tt.input), callback)
+			response, _, err := client.parseStreamingResponse(context.Background(), strings.NewReader(tt.input), callback)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("parseStreamingResponse() error = %v, wantErr %v", err, tt.wantErr)
@@ -857,7 +1159,7 @@ func TestParseStreamingResponseTooLarge(t *testing.T) {
 		input.WriteString("\n")
 	}
 
-	_, err := client.parseStreamingResponse(strings.NewReader(input.String()), nil)
+	_, _, err := client.parseStreamingResponse(context.Background(), strings.NewReader(input.String()), nil)
 	if err == nil {
 		t.Error("parseStreamingResponse() should return error for response > 1MB")
 	}
@@ -1000,19 +1302,27 @@ func TestChatMessageRoleValidation(t *testing.T) {
 func TestParseStreamingResponseWithToolCalls(t *testing.T) {
 	client := NewClient()
 
-	// Test that tool calls are extracted from the final chunk and appended to response
+	// Test that a tool call arriving mid-stream is passed to the callback
+	// before the rest of the text, and appended to the response
 	input := `{"model":"test","message":{"role":"assistant","content":"Perfect! "},"done":false}
-{"model":"test","message":{"role":"assistant","content":"Generating now."},"done":false}
-{"model":"test","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"update_generation","arguments":"{\"prompt\":\"a cat in space\",\"steps\":28,\"cfg\":7.5,\"seed\":42,\"generate_image\":true}"}}]},"done":true}
+{"model":"test","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"update_generation","arguments":"{\"prompt\":\"a cat in space\",\"steps\":28,\"cfg\":7.5,\"seed\":42,\"generate_image\":true}"}}]},"done":false}
+{"model":"test","message":{"role":"assistant","content":"Generating now."},"done":true}
 `
 
 	var tokens []string
+	var toolCallsAt int
+	var toolCalls []ToolCall
 	callback := func(token StreamToken) error {
+		if len(token.ToolCalls) > 0 {
+			toolCallsAt = len(tokens)
+			toolCalls = append(toolCalls, token.ToolCalls...)
+			return nil
+		}
 		tokens = append(tokens, token.Content)
 		return nil
 	}
 
-	response, err := client.parseStreamingResponse(strings.NewReader(input), callback)
+	response, _, err := client.parseStreamingResponse(context.Background(), strings.NewReader(input), callback)
 	if err != nil {
 		t.Errorf("parseStreamingResponse() error = %v", err)
 	}
@@ -1028,7 +1338,14 @@ func TestParseStreamingResponseWithToolCalls(t *testing.T) {
 		t.Errorf("response missing tool call data: %q", response)
 	}
 
-	// Callback should receive all conversational text (tool calls are not streamed)
+	// Callback should receive the tool call between the text tokens
+	if len(toolCalls) != 1 || toolCallsAt != 1 {
+		t.Errorf("got %d tool calls after token %d, want 1 after token 1", len(toolCalls), toolCallsAt)
+	} else if metadata, err := ParseToolCalls(toolCalls); err != nil || metadata.Prompt != "a cat in space" {
+		t.Errorf("ParseToolCalls() = %+v, %v, want prompt %q", metadata, err, "a cat in space")
+	}
+
+	// Callback should receive all conversational text
 	expectedTokens := []string{"Perfect! ", "Generating now."}
 	if len(tokens) != len(expectedTokens) {
 		t.Errorf("got %d tokens, want %d", len(tokens), len(expectedTokens))
@@ -1052,11 +1369,13 @@ func TestParseStreamingResponseWithToolCallsNoContent(t *testing.T) {
 
 	var tokens []string
 	callback := func(token StreamToken) error {
-		tokens = append(tokens, token.Content)
+		if len(token.ToolCalls) == 0 {
+			tokens = append(tokens, token.Content)
+		}
 		return nil
 	}
 
-	response, err := client.parseStreamingResponse(strings.NewReader(input), callback)
+	response, _, err := client.parseStreamingResponse(context.Background(), strings.NewReader(input), callback)
 	if err != nil {
 		t.Errorf("parseStreamingResponse() error = %v", err)
 	}
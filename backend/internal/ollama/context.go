@@ -0,0 +1,107 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultNumCtx is the context window ollama runs a model with when its
+// modelfile does not set num_ctx.
+const DefaultNumCtx = 4096
+
+// ContextLength returns the number of tokens model can attend to as ollama
+// runs it: num_ctx from the modelfile if set, otherwise DefaultNumCtx capped
+// at the length the model was trained with. An empty model means the
+// configured one. Results are cached per model.
+//
+// Returns ErrNotRunning if ollama is not reachable.
+// Returns ErrModelNotFound if ollama does not have the model.
+func (c *Client) ContextLength(ctx context.Context, model string) (int, error) {
+	if model == "" {
+		model = c.model
+	}
+
+	c.contextMu.Lock()
+	n, ok := c.contextLengths[model]
+	c.contextMu.Unlock()
+	if ok {
+		return n, nil
+	}
+
+	show, err := c.show(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+	n = contextLength(show)
+
+	c.contextMu.Lock()
+	if c.contextLengths == nil {
+		c.contextLengths = make(map[string]int)
+	}
+	c.contextLengths[model] = n
+	c.contextMu.Unlock()
+	return n, nil
+}
+
+// show fetches a model's details from POST /api/show.
+func (c *Client) show(ctx context.Context, model string) (ShowResponse, error) {
+	body, err := json.Marshal(ShowRequest{Model: model})
+	if err != nil {
+		return ShowResponse{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+EndpointShow, bytes.NewReader(body))
+	if err != nil {
+		return ShowResponse{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return ShowResponse{}, c.classifyError(err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return ShowResponse{}, fmt.Errorf("%w: %s", ErrModelNotFound, model)
+	default:
+		return ShowResponse{}, fmt.Errorf("%w: unexpected status %d", ErrRequestFailed, resp.StatusCode)
+	}
+
+	var show ShowResponse
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return ShowResponse{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return show, nil
+}
+
+// contextLength picks the context window from a show response; see
+// ContextLength.
+func contextLength(show ShowResponse) int {
+	scanner := bufio.NewScanner(strings.NewReader(show.Parameters))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "num_ctx" {
+			if n, err := strconv.Atoi(fields[1]); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+
+	for key, value := range show.ModelInfo {
+		if !strings.HasSuffix(key, ".context_length") {
+			continue
+		}
+		if trained, ok := value.(float64); ok && trained > 0 && int(trained) < DefaultNumCtx {
+			return int(trained)
+		}
+	}
+	return DefaultNumCtx
+}
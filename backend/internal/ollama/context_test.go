@@ -0,0 +1,84 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContextLength(t *testing.T) {
+	tests := []struct {
+		name string
+		show ShowResponse
+		want int
+	}{
+		{
+			name: "num_ctx parameter",
+			show: ShowResponse{
+				Parameters: "stop \"<|eot_id|>\"\nnum_ctx 8192",
+				ModelInfo:  map[string]any{"llama.context_length": 131072.0},
+			},
+			want: 8192,
+		},
+		{
+			name: "ollama default below trained length",
+			show: ShowResponse{ModelInfo: map[string]any{"general.architecture": "llama", "llama.context_length": 131072.0}},
+			want: DefaultNumCtx,
+		},
+		{
+			name: "trained length below ollama default",
+			show: ShowResponse{ModelInfo: map[string]any{"phi.context_length": 2048.0}},
+			want: 2048,
+		},
+		{
+			name: "no information",
+			show: ShowResponse{},
+			want: DefaultNumCtx,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contextLength(tt.show); got != tt.want {
+				t.Errorf("contextLength() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientContextLength(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var req ShowRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "llama3.1:8b" {
+			http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(ShowResponse{Parameters: "num_ctx 16384"})
+	}))
+	defer server.Close()
+
+	client := NewClientWithConfig(server.URL, "llama3.1:8b", 5*time.Second)
+	for i := 0; i < 2; i++ {
+		n, err := client.ContextLength(context.Background(), "")
+		if err != nil {
+			t.Fatalf("ContextLength() error = %v", err)
+		}
+		if n != 16384 {
+			t.Errorf("ContextLength() = %d, want 16384", n)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("ollama received %d show requests, want 1 (cached)", requests)
+	}
+
+	if _, err := client.ContextLength(context.Background(), "missing:1b"); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("ContextLength() error = %v, want %v", err, ErrModelNotFound)
+	}
+}
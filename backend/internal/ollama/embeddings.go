@@ -0,0 +1,61 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrEmptyEmbedding is returned when ollama returns no embedding, which
+// happens when the model cannot produce embeddings.
+var ErrEmptyEmbedding = errors.New("ollama returned an empty embedding")
+
+// Embed returns the embedding of text computed by model, an embedding
+// model such as nomic-embed-text, from POST /api/embeddings. Texts with
+// similar meaning have embeddings pointing in similar directions.
+//
+// Returns ErrNotRunning if ollama is not reachable.
+// Returns ErrModelNotFound if ollama does not have the model.
+// Returns ErrEmptyEmbedding if the model does not produce embeddings.
+func (c *Client) Embed(ctx context.Context, model, text string) ([]float32, error) {
+	body, err := json.Marshal(EmbeddingRequest{Model: model, Prompt: text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+EndpointEmbeddings, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, c.classifyError(err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s (pull with: ollama pull %s)", ErrModelNotFound, model, model)
+	default:
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrRequestFailed, resp.StatusCode)
+	}
+
+	var embedding EmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embedding); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(embedding.Embedding) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrEmptyEmbedding, model)
+	}
+
+	vector := make([]float32, len(embedding.Embedding))
+	for i, v := range embedding.Embedding {
+		vector[i] = float32(v)
+	}
+	return vector, nil
+}
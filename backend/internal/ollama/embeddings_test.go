@@ -0,0 +1,58 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEmbed(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    []float32
+		wantErr error
+	}{
+		{"embedding", http.StatusOK, `{"embedding":[0.5,-1,2]}`, []float32{0.5, -1, 2}, nil},
+		{"model missing", http.StatusNotFound, `{"error":"model not found"}`, nil, ErrModelNotFound},
+		{"not an embedding model", http.StatusOK, `{"embedding":[]}`, nil, ErrEmptyEmbedding},
+		{"server error", http.StatusInternalServerError, `{}`, nil, ErrRequestFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received EmbeddingRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != EndpointEmbeddings {
+					t.Errorf("path = %s, want %s", r.URL.Path, EndpointEmbeddings)
+				}
+				json.NewDecoder(r.Body).Decode(&received)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClientWithConfig(server.URL, DefaultModel, 5*time.Second)
+			got, err := client.Embed(context.Background(), "nomic-embed-text", "a cat in a hat")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Embed() error = %v, want %v", err, tt.wantErr)
+			}
+			if received.Model != "nomic-embed-text" || received.Prompt != "a cat in a hat" {
+				t.Errorf("request = %+v, want model and text", received)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Embed() = %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("Embed()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
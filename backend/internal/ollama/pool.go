@@ -0,0 +1,251 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PoolRetryAfter is how long a Pool skips an endpoint that could not be
+// reached before sending it requests again. Connect checks every endpoint
+// regardless and brings recovered ones back at once.
+const PoolRetryAfter = 30 * time.Second
+
+// Pool spreads requests over several ollama servers running the same model,
+// such as the GPU machines in a household or lab. Requests go to the
+// endpoints in turn; one that cannot be reached is marked down and the
+// request fails over to the next. Endpoints that are down are skipped for
+// PoolRetryAfter and tried last while every endpoint is down.
+//
+// Pool offers the same methods as Client, so either can serve as the
+// agent's LLM client.
+type Pool struct {
+	clients []*Client
+
+	mu        sync.Mutex
+	next      int         // index of the endpoint for the next request
+	downUntil []time.Time // zero while the endpoint is up
+}
+
+// NewPool creates a pool of clients, which should use the same model. It
+// panics if clients is empty.
+func NewPool(clients ...*Client) *Pool {
+	if len(clients) == 0 {
+		panic("ollama: NewPool needs at least one client")
+	}
+	return &Pool{
+		clients:   clients,
+		downUntil: make([]time.Time, len(clients)),
+	}
+}
+
+// errPartialReply stops a Pool from failing over a chat whose reply was
+// partly streamed before its endpoint went away.
+var errPartialReply = errors.New("reply partly streamed")
+
+// isUnreachable reports whether err means the endpoint could not be
+// reached, so the request can be sent to another one.
+func isUnreachable(err error) bool {
+	return errors.Is(err, ErrNotRunning) || errors.Is(err, ErrConnectionTimeout) || errors.Is(err, ErrConnectionFailed)
+}
+
+// order returns the endpoints to try for the next request: those up, in
+// turn from the next one, then those down, soonest to retry first.
+func (p *Pool) order() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	start := p.next
+	p.next = (p.next + 1) % len(p.clients)
+
+	order := make([]int, 0, len(p.clients))
+	var down []int
+	for n := range p.clients {
+		i := (start + n) % len(p.clients)
+		if p.downUntil[i].After(now) {
+			down = append(down, i)
+		} else {
+			order = append(order, i)
+		}
+	}
+	slices.SortStableFunc(down, func(a, b int) int {
+		return p.downUntil[a].Compare(p.downUntil[b])
+	})
+	return append(order, down...)
+}
+
+// setHealth records whether endpoint i answered, logging changes.
+func (p *Pool) setHealth(i int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wasDown := !p.downUntil[i].IsZero()
+	if err == nil {
+		p.downUntil[i] = time.Time{}
+		if wasDown {
+			log.Printf("ollama endpoint %s is back up", p.clients[i].Endpoint())
+		}
+		return
+	}
+	p.downUntil[i] = time.Now().Add(PoolRetryAfter)
+	if !wasDown {
+		log.Printf("ollama endpoint %s is down, failing over: %v", p.clients[i].Endpoint(), err)
+	}
+}
+
+// failover calls fn with each endpoint in order until one can be reached,
+// and returns the last error if none can. Errors other than unreachable
+// ones are returned at once, as are those after ctx ends.
+func (p *Pool) failover(ctx context.Context, fn func(c *Client) error) error {
+	var err error
+	for _, i := range p.order() {
+		err = fn(p.clients[i])
+		if err != nil && !isUnreachable(err) {
+			return err
+		}
+		p.setHealth(i, err)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// Chat sends the chat request to the next endpoint, failing over to the
+// others while they cannot be reached. A request that fails after tokens
+// were streamed to callback is not sent again, so callback never sees a
+// reply twice. See Client.Chat.
+func (p *Pool) Chat(ctx context.Context, messages []Message, seed *int64, tools []Tool, callback StreamCallback) (ChatResult, error) {
+	var result ChatResult
+	streamed := false
+	stream := callback
+	if callback != nil {
+		stream = func(token StreamToken) error {
+			streamed = true
+			return callback(token)
+		}
+	}
+
+	var partialErr error
+	err := p.failover(ctx, func(c *Client) error {
+		var err error
+		result, err = c.Chat(ctx, messages, seed, tools, stream)
+		if err != nil && streamed && isUnreachable(err) {
+			partialErr = err
+			return errPartialReply
+		}
+		return err
+	})
+	if partialErr != nil {
+		return result, partialErr
+	}
+	return result, err
+}
+
+// Connect checks every endpoint, marking each up or down, and succeeds if
+// any of them is reachable and has the model. Otherwise it returns the
+// errors of all endpoints. See Client.Connect.
+func (p *Pool) Connect(ctx context.Context) error {
+	errs := make([]error, len(p.clients))
+	var wg sync.WaitGroup
+	for i, c := range p.clients {
+		wg.Go(func() { errs[i] = c.Connect(ctx) })
+	}
+	wg.Wait()
+
+	healthy := false
+	for i, err := range errs {
+		p.setHealth(i, err)
+		healthy = healthy || err == nil
+	}
+	if healthy {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// ListModels lists the models of the first endpoint that can be reached.
+// See Client.ListModels.
+func (p *Pool) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var models []ModelInfo
+	err := p.failover(ctx, func(c *Client) error {
+		var err error
+		models, err = c.ListModels(ctx)
+		return err
+	})
+	return models, err
+}
+
+// ContextLength reports the context window of model on the first endpoint
+// that can be reached. See Client.ContextLength.
+func (p *Pool) ContextLength(ctx context.Context, model string) (int, error) {
+	var n int
+	err := p.failover(ctx, func(c *Client) error {
+		var err error
+		n, err = c.ContextLength(ctx, model)
+		return err
+	})
+	return n, err
+}
+
+// Embed computes the embedding of text on the first endpoint that can be
+// reached. See Client.Embed.
+func (p *Pool) Embed(ctx context.Context, model, text string) ([]float32, error) {
+	var vector []float32
+	err := p.failover(ctx, func(c *Client) error {
+		var err error
+		vector, err = c.Embed(ctx, model, text)
+		return err
+	})
+	return vector, err
+}
+
+// Unload unloads the models of every endpoint and returns the names of
+// those unloaded, which may repeat across endpoints. Endpoints that fail do
+// not stop the others; their errors are returned together. See
+// Client.Unload.
+func (p *Pool) Unload(ctx context.Context) ([]string, error) {
+	var unloaded []string
+	var errs []error
+	for _, c := range p.clients {
+		names, err := c.Unload(ctx)
+		unloaded = append(unloaded, names...)
+		errs = append(errs, err)
+	}
+	return unloaded, errors.Join(errs...)
+}
+
+// SetKeepAlive sets the keep-alive of every endpoint. See
+// Client.SetKeepAlive.
+func (p *Pool) SetKeepAlive(keepAlive string) {
+	for _, c := range p.clients {
+		c.SetKeepAlive(keepAlive)
+	}
+}
+
+// SetStructuredOutput sets the structured output mode of every endpoint.
+// See Client.SetStructuredOutput.
+func (p *Pool) SetStructuredOutput(structured bool) {
+	for _, c := range p.clients {
+		c.SetStructuredOutput(structured)
+	}
+}
+
+// Model returns the model of the first endpoint.
+func (p *Pool) Model() string {
+	return p.clients[0].Model()
+}
+
+// Endpoint returns the endpoint URLs, separated by commas.
+func (p *Pool) Endpoint() string {
+	endpoints := make([]string, len(p.clients))
+	for i, c := range p.clients {
+		endpoints[i] = c.Endpoint()
+	}
+	return strings.Join(endpoints, ",")
+}
@@ -0,0 +1,168 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// poolServer is an ollama server that replies to every chat with its name
+// and counts the chats.
+type poolServer struct {
+	*httptest.Server
+	chats atomic.Int32
+}
+
+func newPoolServer(t *testing.T, name string) *poolServer {
+	t.Helper()
+	s := &poolServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case EndpointTags:
+			json.NewEncoder(w).Encode(TagsResponse{Models: []ModelInfo{{Name: DefaultModel}}})
+		case EndpointChat:
+			s.chats.Add(1)
+			data, _ := json.Marshal(ChatResponse{Model: DefaultModel, Message: Message{Role: RoleAssistant, Content: name}, Done: true})
+			w.Write(data)
+			w.Write([]byte("\n"))
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// downURL returns the URL of a server that is no longer running.
+func downURL() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL
+}
+
+func newTestPool(urls ...string) *Pool {
+	clients := make([]*Client, len(urls))
+	for i, url := range urls {
+		clients[i] = NewClientWithConfig(url, DefaultModel, 5*time.Second)
+	}
+	return NewPool(clients...)
+}
+
+func poolChat(t *testing.T, p *Pool) string {
+	t.Helper()
+	result, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "test"}}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	return result.Response
+}
+
+func TestPoolChat_RoundRobin(t *testing.T) {
+	a, b := newPoolServer(t, "a"), newPoolServer(t, "b")
+	p := newTestPool(a.URL, b.URL)
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, poolChat(t, p))
+	}
+	want := []string{"a", "b", "a", "b"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("replies = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPoolChat_Failover(t *testing.T) {
+	a := newPoolServer(t, "a")
+	p := newTestPool(downURL(), a.URL)
+
+	for i := 0; i < 3; i++ {
+		if got := poolChat(t, p); got != "a" {
+			t.Fatalf("reply %d = %q, want %q", i, got, "a")
+		}
+	}
+	if p.downUntil[0].IsZero() {
+		t.Error("unreachable endpoint not marked down")
+	}
+	if n := a.chats.Load(); n != 3 {
+		t.Errorf("chats on the up endpoint = %d, want 3", n)
+	}
+}
+
+func TestPoolChat_AllDown(t *testing.T) {
+	p := newTestPool(downURL(), downURL())
+	_, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "test"}}, nil, nil, nil)
+	if !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Chat() error = %v, want ErrNotRunning", err)
+	}
+}
+
+func TestPoolChat_RequestErrorNotRetried(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not found", http.StatusNotFound)
+	}))
+	defer failing.Close()
+	a := newPoolServer(t, "a")
+	p := newTestPool(failing.URL, a.URL)
+
+	if _, err := p.Chat(context.Background(), []Message{{Role: RoleUser, Content: "test"}}, nil, nil, nil); err == nil {
+		t.Fatal("Chat() error = nil, want the endpoint's error")
+	}
+	if n := a.chats.Load(); n != 0 {
+		t.Errorf("chats on the other endpoint = %d, want 0", n)
+	}
+}
+
+func TestPoolConnect(t *testing.T) {
+	a := newPoolServer(t, "a")
+
+	tests := []struct {
+		name    string
+		urls    []string
+		wantErr bool
+	}{
+		{"all up", []string{a.URL, a.URL}, false},
+		{"one down", []string{downURL(), a.URL}, false},
+		{"all down", []string{downURL(), downURL()}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPool(tt.urls...)
+			err := p.Connect(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Connect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrNotRunning) {
+				t.Errorf("Connect() error = %v, want ErrNotRunning", err)
+			}
+		})
+	}
+}
+
+func TestPoolConnect_RecoversEndpoint(t *testing.T) {
+	a := newPoolServer(t, "a")
+	p := newTestPool(a.URL)
+	p.downUntil[0] = time.Now().Add(time.Hour)
+
+	if err := p.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if !p.downUntil[0].IsZero() {
+		t.Error("reachable endpoint still marked down after Connect")
+	}
+}
+
+func TestPoolEndpoint(t *testing.T) {
+	p := newTestPool("http://gpu1:11434", "http://gpu2:11434")
+	if got, want := p.Endpoint(), "http://gpu1:11434,http://gpu2:11434"; got != want {
+		t.Errorf("Endpoint() = %q, want %q", got, want)
+	}
+	if got := p.Model(); got != DefaultModel {
+		t.Errorf("Model() = %q, want %q", got, DefaultModel)
+	}
+}
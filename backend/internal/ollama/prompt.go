@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -15,6 +16,51 @@ var (
 	ErrMissingFields = errors.New("JSON missing required fields")
 )
 
+// ResultFromStream builds a ChatResult from the text of a streamed reply and
+// the tool calls collected from it. It lets other chat backends share the
+// tool call parsing used for ollama.
+//
+// Returns ErrMissingFields if the update_generation call lacks a field.
+func ResultFromStream(text string, toolCalls []ToolCall) (ChatResult, error) {
+	return chatResult(appendToolCalls(text, toolCalls))
+}
+
+// chatResult parses a complete response, with any tool calls appended by
+// appendToolCalls, into a ChatResult.
+func chatResult(fullResponse string) (ChatResult, error) {
+	conversationalText, metadata, hasToolCall, err := parseResponse(fullResponse)
+	if err != nil {
+		return ChatResult{}, err
+	}
+
+	_, toolCalls, _ := extractToolCallsFromResponse(fullResponse)
+	return ChatResult{
+		Response:    conversationalText,
+		Metadata:    metadata,
+		HasToolCall: hasToolCall,
+		ToolCalls:   toolCalls,
+		RawResponse: fullResponse,
+	}, nil
+}
+
+// appendToolCalls appends tool calls to a response after the
+// __TOOL_CALLS__ marker.
+//
+// WHY APPEND TOOL CALLS: parseResponse() expects to find tool calls at the end
+// of the response. By appending them with a marker, we preserve both the
+// conversational text (for display) and the structured function call data
+// (for parameter extraction).
+func appendToolCalls(response string, toolCalls []ToolCall) string {
+	if len(toolCalls) == 0 {
+		return response
+	}
+	toolCallData, err := json.Marshal(toolCalls)
+	if err != nil {
+		return response
+	}
+	return response + "\n__TOOL_CALLS__\n" + string(toolCallData)
+}
+
 // parseResponse parses a complete LLM response into conversational text and metadata.
 //
 // This function uses function calling to extract structured generation parameters.
@@ -32,8 +78,10 @@ var (
 // Returns:
 //   - Conversational text (displayed to user)
 //   - LLMMetadata with generation parameters (zero values if no tool call)
-//   - hasToolCall indicates if the LLM called a function
+//   - hasToolCall indicates if the LLM called update_generation
 //   - Error only if tool calls are malformed (not if missing)
+//
+// Calls to other tools are left to the caller; see ChatResult.ToolCalls.
 func parseResponse(response string) (string, LLMMetadata, bool, error) {
 	// Extract tool calls from response
 	conversationalText, toolCalls, hasToolCalls := extractToolCallsFromResponse(response)
@@ -42,6 +90,11 @@ func parseResponse(response string) (string, LLMMetadata, bool, error) {
 		// Return the full response as conversational text with empty metadata
 		return response, LLMMetadata{}, false, nil
 	}
+	if !slices.ContainsFunc(toolCalls, isUpdateGeneration) {
+		// Only other tools were called - conversational as far as the
+		// generation settings go
+		return conversationalText, LLMMetadata{}, false, nil
+	}
 
 	// Parse tool calls to extract metadata
 	metadata, err := parseToolCalls(toolCalls)
@@ -52,6 +105,18 @@ func parseResponse(response string) (string, LLMMetadata, bool, error) {
 	return conversationalText, metadata, true, nil
 }
 
+// isUpdateGeneration reports whether call is to the update_generation function.
+func isUpdateGeneration(call ToolCall) bool {
+	return call.Function.Name == UpdateGenerationToolName
+}
+
+// ParseToolCalls extracts LLMMetadata from the update_generation call among
+// toolCalls, such as those a StreamToken carries while the reply streams.
+// Returns ErrMissingFields if required arguments are absent.
+func ParseToolCalls(toolCalls []ToolCall) (LLMMetadata, error) {
+	return parseToolCalls(toolCalls)
+}
+
 // parseToolCalls extracts LLMMetadata from a tool call response.
 // This function parses the tool call arguments to extract generation parameters
 // using the model's native function calling capability.
@@ -81,7 +146,7 @@ func parseToolCalls(toolCalls []ToolCall) (LLMMetadata, error) {
 	// We specifically need the update_generation call for image generation.
 	var updateGenCall *ToolCall
 	for i := range toolCalls {
-		if toolCalls[i].Function.Name == "update_generation" {
+		if isUpdateGeneration(toolCalls[i]) {
 			updateGenCall = &toolCalls[i]
 			break
 		}
@@ -1,6 +1,10 @@
 package ollama
 
-import "testing"
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
 
 func TestParseResponse(t *testing.T) {
 	tests := []struct {
@@ -46,6 +50,13 @@ func TestParseResponse(t *testing.T) {
 			wantHasToolCall: false,
 			wantErr:         false,
 		},
+		{
+			name:            "other tool only - conversational with no metadata",
+			response:        "Starring it.\n__TOOL_CALLS__\n[{\"function\":{\"name\":\"favorite_image\",\"arguments\":{}}}]",
+			wantText:        "Starring it.",
+			wantHasToolCall: false,
+			wantErr:         false,
+		},
 		{
 			name:            "invalid tool call JSON - falls back to conversational",
 			response:        "Text before\n__TOOL_CALLS__\n{invalid json}",
@@ -333,6 +344,87 @@ func TestParseToolCalls(t *testing.T) {
 	}
 }
 
+func TestResultFromStream(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		toolCalls    []ToolCall
+		wantResponse string
+		wantToolCall bool
+		wantPrompt   string
+		wantCalls    int
+		wantErr      error
+	}{
+		{
+			name:         "text only",
+			text:         "What would you like?",
+			wantResponse: "What would you like?",
+		},
+		{
+			name: "string-encoded arguments",
+			text: "Here you go.",
+			toolCalls: []ToolCall{{Function: ToolCallFunction{
+				Name:      "update_generation",
+				Arguments: json.RawMessage(`"{\"prompt\":\"a cat\",\"steps\":20,\"cfg\":4.5,\"seed\":-1,\"generate_image\":true}"`),
+			}}},
+			wantResponse: "Here you go.",
+			wantToolCall: true,
+			wantPrompt:   "a cat",
+			wantCalls:    1,
+		},
+		{
+			name: "other tools",
+			text: "Starred, and here it is again.",
+			toolCalls: []ToolCall{
+				{Function: ToolCallFunction{Name: "favorite_image", Arguments: json.RawMessage(`{}`)}},
+				{Function: ToolCallFunction{
+					Name:      "update_generation",
+					Arguments: json.RawMessage(`{"prompt":"a cat","steps":20,"cfg":4.5,"seed":-1,"generate_image":true}`),
+				}},
+			},
+			wantResponse: "Starred, and here it is again.",
+			wantToolCall: true,
+			wantPrompt:   "a cat",
+			wantCalls:    2,
+		},
+		{
+			name: "missing fields",
+			toolCalls: []ToolCall{{Function: ToolCallFunction{
+				Name:      "update_generation",
+				Arguments: json.RawMessage(`{"prompt":"a cat"}`),
+			}}},
+			wantErr: ErrMissingFields,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ResultFromStream(tt.text, tt.toolCalls)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResultFromStream() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResultFromStream() error = %v", err)
+			}
+			if result.Response != tt.wantResponse {
+				t.Errorf("Response = %q, want %q", result.Response, tt.wantResponse)
+			}
+			if result.HasToolCall != tt.wantToolCall {
+				t.Errorf("HasToolCall = %v, want %v", result.HasToolCall, tt.wantToolCall)
+			}
+			if result.Metadata.Prompt != tt.wantPrompt {
+				t.Errorf("Metadata.Prompt = %q, want %q", result.Metadata.Prompt, tt.wantPrompt)
+			}
+			if len(result.ToolCalls) != tt.wantCalls {
+				t.Errorf("ToolCalls = %d calls, want %d", len(result.ToolCalls), tt.wantCalls)
+			}
+		})
+	}
+}
+
 func TestExtractToolCallsFromResponse(t *testing.T) {
 	tests := []struct {
 		name                  string
@@ -0,0 +1,87 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrPullFailed is returned when ollama reports an error while pulling a
+// model, such as a model name that doesn't exist in the registry.
+var ErrPullFailed = errors.New("ollama pull failed")
+
+// PullFunc receives each progress update of a model pull.
+type PullFunc func(progress PullProgress)
+
+// Pull downloads model into ollama from its registry with POST /api/pull,
+// calling progress, if not nil, with each update ollama streams. It returns
+// when the pull has finished. A model that is already present is checked
+// and returns quickly.
+//
+// Pulls can take many minutes, so only ctx limits how long it runs.
+//
+// Returns ErrNotRunning if ollama is not reachable.
+// Returns ErrPullFailed if ollama reports an error.
+func (c *Client) Pull(ctx context.Context, model string, progress PullFunc) error {
+	body, err := json.Marshal(PullRequest{Model: model, Stream: true})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+EndpointPull, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Like Chat, stream without the client's timeout
+	streamClient := &http.Client{}
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		classified := c.classifyError(err)
+		if errors.Is(classified, ErrNotRunning) {
+			return fmt.Errorf("%w at %s (start with: ollama serve)", ErrNotRunning, c.endpoint)
+		}
+		return classified
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%w: %s: status %d: %s", ErrPullFailed, model, resp.StatusCode, bytes.TrimSpace(errBody))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	succeeded := false
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var update PullProgress
+		if err := json.Unmarshal(line, &update); err != nil {
+			return fmt.Errorf("failed to decode pull progress: %w", err)
+		}
+		if update.Error != "" {
+			return fmt.Errorf("%w: %s: %s", ErrPullFailed, model, update.Error)
+		}
+		if progress != nil {
+			progress(update)
+		}
+		succeeded = update.Status == "success"
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("failed to read pull progress: %w", err)
+	}
+	if !succeeded {
+		return fmt.Errorf("%w: %s: stream ended before the pull finished", ErrPullFailed, model)
+	}
+	return nil
+}
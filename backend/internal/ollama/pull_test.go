@@ -0,0 +1,113 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPull(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantErr      error
+		wantProgress int
+	}{
+		{
+			name:   "download",
+			status: http.StatusOK,
+			body: `{"status":"pulling manifest"}
+{"status":"pulling 6a0746a1ec1a","digest":"sha256:6a0746a1ec1a","total":4000,"completed":1000}
+{"status":"pulling 6a0746a1ec1a","digest":"sha256:6a0746a1ec1a","total":4000,"completed":4000}
+{"status":"verifying sha256 digest"}
+{"status":"success"}
+`,
+			wantProgress: 5,
+		},
+		{
+			name:         "unknown model",
+			status:       http.StatusOK,
+			body:         `{"status":"pulling manifest"}` + "\n" + `{"error":"pull model manifest: file does not exist"}` + "\n",
+			wantErr:      ErrPullFailed,
+			wantProgress: 1,
+		},
+		{
+			name:         "stream cut short",
+			status:       http.StatusOK,
+			body:         `{"status":"pulling manifest"}` + "\n",
+			wantErr:      ErrPullFailed,
+			wantProgress: 1,
+		},
+		{
+			name:    "server error",
+			status:  http.StatusInternalServerError,
+			body:    `{"error":"disk full"}`,
+			wantErr: ErrPullFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received PullRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != EndpointPull {
+					t.Errorf("path = %s, want %s", r.URL.Path, EndpointPull)
+				}
+				json.NewDecoder(r.Body).Decode(&received)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClientWithConfig(server.URL, DefaultModel, 5*time.Second)
+			var updates []PullProgress
+			err := client.Pull(context.Background(), "llama3.2:1b", func(p PullProgress) {
+				updates = append(updates, p)
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Pull() error = %v, want %v", err, tt.wantErr)
+			}
+			if received.Model != "llama3.2:1b" || !received.Stream {
+				t.Errorf("request = %+v, want a streamed pull of llama3.2:1b", received)
+			}
+			if len(updates) != tt.wantProgress {
+				t.Errorf("progress updates = %d, want %d", len(updates), tt.wantProgress)
+			}
+		})
+	}
+}
+
+func TestPull_Progress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"pulling 6a0746a1ec1a","digest":"sha256:6a0746a1ec1a","total":4000,"completed":1000}` + "\n" + `{"status":"success"}` + "\n"))
+	}))
+	defer server.Close()
+
+	var first PullProgress
+	client := NewClientWithConfig(server.URL, DefaultModel, 5*time.Second)
+	err := client.Pull(context.Background(), "llama3.2:1b", func(p PullProgress) {
+		if first.Status == "" {
+			first = p
+		}
+	})
+	if err != nil {
+		t.Fatalf("Pull() error = %v, want nil", err)
+	}
+	want := PullProgress{Status: "pulling 6a0746a1ec1a", Digest: "sha256:6a0746a1ec1a", Total: 4000, Completed: 1000}
+	if first != want {
+		t.Errorf("progress = %+v, want %+v", first, want)
+	}
+}
+
+func TestPull_NotRunning(t *testing.T) {
+	client := NewClientWithConfig("http://127.0.0.1:1", DefaultModel, 5*time.Second)
+	err := client.Pull(context.Background(), "llama3.2:1b", nil)
+	if !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Pull() error = %v, want %v", err, ErrNotRunning)
+	}
+}
@@ -0,0 +1,86 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Sampling parameter ranges accepted by Validate
+const (
+	MinTemperature   = 0.0
+	MaxTemperature   = 2.0
+	MinTopP          = 0.0
+	MaxTopP          = 1.0
+	MinTopK          = 1
+	MaxTopK          = 1000
+	MinRepeatPenalty = 0.0
+	MaxRepeatPenalty = 2.0
+)
+
+// ErrInvalidSampling is returned when a sampling parameter is out of range.
+var ErrInvalidSampling = errors.New("invalid sampling parameter")
+
+// Sampling holds the optional sampling parameters sent with chat requests.
+// Nil fields are left to the model's defaults.
+type Sampling struct {
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"top_p,omitempty"`
+	TopK          *int     `json:"top_k,omitempty"`
+	RepeatPenalty *float64 `json:"repeat_penalty,omitempty"`
+}
+
+// IsZero reports whether no sampling parameter is set.
+func (s Sampling) IsZero() bool {
+	return s.Temperature == nil && s.TopP == nil && s.TopK == nil && s.RepeatPenalty == nil
+}
+
+// Merge returns s with every parameter set in override replacing its own.
+func (s Sampling) Merge(override Sampling) Sampling {
+	if override.Temperature != nil {
+		s.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		s.TopP = override.TopP
+	}
+	if override.TopK != nil {
+		s.TopK = override.TopK
+	}
+	if override.RepeatPenalty != nil {
+		s.RepeatPenalty = override.RepeatPenalty
+	}
+	return s
+}
+
+// Validate returns an error wrapping ErrInvalidSampling if a parameter is
+// set and out of range.
+func (s Sampling) Validate() error {
+	if s.Temperature != nil && (*s.Temperature < MinTemperature || *s.Temperature > MaxTemperature) {
+		return fmt.Errorf("%w: temperature must be between %g and %g", ErrInvalidSampling, MinTemperature, MaxTemperature)
+	}
+	if s.TopP != nil && (*s.TopP < MinTopP || *s.TopP > MaxTopP) {
+		return fmt.Errorf("%w: top_p must be between %g and %g", ErrInvalidSampling, MinTopP, MaxTopP)
+	}
+	if s.TopK != nil && (*s.TopK < MinTopK || *s.TopK > MaxTopK) {
+		return fmt.Errorf("%w: top_k must be between %d and %d", ErrInvalidSampling, MinTopK, MaxTopK)
+	}
+	if s.RepeatPenalty != nil && (*s.RepeatPenalty < MinRepeatPenalty || *s.RepeatPenalty > MaxRepeatPenalty) {
+		return fmt.Errorf("%w: repeat_penalty must be between %g and %g", ErrInvalidSampling, MinRepeatPenalty, MaxRepeatPenalty)
+	}
+	return nil
+}
+
+type samplingKey struct{}
+
+// WithSampling returns a copy of ctx that makes Chat send sampling with the
+// request, so the parameters can be tuned per session.
+func WithSampling(ctx context.Context, sampling Sampling) context.Context {
+	return context.WithValue(ctx, samplingKey{}, sampling)
+}
+
+// SamplingFromContext returns the parameters set by WithSampling, or the
+// zero Sampling if none.
+func SamplingFromContext(ctx context.Context) Sampling {
+	sampling, _ := ctx.Value(samplingKey{}).(Sampling)
+	return sampling
+}
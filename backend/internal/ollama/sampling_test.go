@@ -0,0 +1,73 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSamplingValidate(t *testing.T) {
+	float := func(v float64) *float64 { return &v }
+	integer := func(v int) *int { return &v }
+
+	tests := []struct {
+		name     string
+		sampling Sampling
+		wantErr  bool
+	}{
+		{"unset", Sampling{}, false},
+		{"all in range", Sampling{Temperature: float(0.7), TopP: float(0.9), TopK: integer(40), RepeatPenalty: float(1.1)}, false},
+		{"bounds", Sampling{Temperature: float(MaxTemperature), TopP: float(MinTopP), TopK: integer(MaxTopK), RepeatPenalty: float(MinRepeatPenalty)}, false},
+		{"temperature too high", Sampling{Temperature: float(2.5)}, true},
+		{"negative temperature", Sampling{Temperature: float(-0.1)}, true},
+		{"top_p too high", Sampling{TopP: float(1.5)}, true},
+		{"top_k zero", Sampling{TopK: integer(0)}, true},
+		{"top_k too high", Sampling{TopK: integer(MaxTopK + 1)}, true},
+		{"repeat_penalty too high", Sampling{RepeatPenalty: float(3)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sampling.Validate()
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSampling) {
+				t.Errorf("Validate() error = %v, want %v", err, ErrInvalidSampling)
+			}
+		})
+	}
+}
+
+func TestSamplingMerge(t *testing.T) {
+	low, high := 0.2, 0.9
+	topK := 40
+
+	base := Sampling{Temperature: &low, TopK: &topK}
+	got := base.Merge(Sampling{Temperature: &high})
+
+	if got.Temperature == nil || *got.Temperature != high {
+		t.Errorf("Temperature = %v, want %v", got.Temperature, high)
+	}
+	if got.TopK == nil || *got.TopK != topK {
+		t.Errorf("TopK = %v, want %v", got.TopK, topK)
+	}
+	if got.TopP != nil || got.RepeatPenalty != nil {
+		t.Errorf("unset parameters were set: %+v", got)
+	}
+	if *base.Temperature != low {
+		t.Error("Merge() modified the receiver")
+	}
+}
+
+func TestSamplingFromContext(t *testing.T) {
+	if !SamplingFromContext(context.Background()).IsZero() {
+		t.Error("SamplingFromContext() is not zero for a context without sampling")
+	}
+
+	temperature := 0.5
+	ctx := WithSampling(context.Background(), Sampling{Temperature: &temperature})
+	if got := SamplingFromContext(ctx); got.Temperature == nil || *got.Temperature != temperature {
+		t.Errorf("SamplingFromContext() = %+v, want temperature %v", got, temperature)
+	}
+}
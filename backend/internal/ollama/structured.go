@@ -0,0 +1,89 @@
+package ollama
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// structuredReply is the reply ollama writes in structured output mode, as
+// described by StructuredOutputSchema. Generation holds the arguments the
+// agent would otherwise pass to update_generation, and is absent while it is
+// still asking questions.
+type structuredReply struct {
+	Message    string          `json:"message"`
+	Generation json.RawMessage `json:"generation"`
+}
+
+// StructuredOutputSchema returns the JSON schema sent as ollama's format
+// parameter in structured output mode (see Client.SetStructuredOutput). The
+// reply is an object with the conversational text in "message" and, when the
+// agent sets the prompt or settings, the update_generation arguments in
+// "generation".
+func StructuredOutputSchema() map[string]interface{} {
+	generation := UpdateGenerationTool().Function.Parameters
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "Conversational reply shown to the user.",
+			},
+			"generation": generation,
+		},
+		"required": []string{"message"},
+	}
+}
+
+// structuredResult parses a complete structured output reply, with any
+// calls to other tools appended by appendToolCalls, into a ChatResult. The
+// generation settings become an update_generation tool call, so the result
+// and the RawResponse kept in history look the same as in tool call mode.
+//
+// Returns ErrMissingFields if the reply is not JSON matching the schema or
+// the settings lack a field.
+func structuredResult(fullResponse string) (ChatResult, error) {
+	text, toolCalls, _ := extractToolCallsFromResponse(fullResponse)
+
+	var reply structuredReply
+	if err := json.Unmarshal([]byte(text), &reply); err != nil {
+		return ChatResult{}, fmt.Errorf("%w: structured reply is not valid JSON: %v", ErrMissingFields, err)
+	}
+	if len(reply.Generation) > 0 && string(reply.Generation) != "null" {
+		toolCalls = append(toolCalls, ToolCall{Function: ToolCallFunction{
+			Name:      UpdateGenerationToolName,
+			Arguments: reply.Generation,
+		}})
+	}
+	return chatResult(appendToolCalls(reply.Message, toolCalls))
+}
+
+// replayStructuredResult passes the parsed reply to callback the way a tool
+// call mode reply streams: the conversational text, then the
+// update_generation call. The JSON itself is not streamed, so this is what
+// the user sees of the reply.
+func replayStructuredResult(result ChatResult, callback StreamCallback) error {
+	if callback == nil {
+		return nil
+	}
+	if result.Response != "" {
+		if err := callback(StreamToken{Content: result.Response}); err != nil {
+			return fmt.Errorf("callback error: %w", err)
+		}
+	}
+	i := slices.IndexFunc(result.ToolCalls, isUpdateGeneration)
+	if i < 0 {
+		return nil
+	}
+	if err := callback(StreamToken{ToolCalls: result.ToolCalls[i : i+1]}); err != nil {
+		return fmt.Errorf("callback error: %w", err)
+	}
+	return nil
+}
+
+// withoutTool returns tools without the one named name.
+func withoutTool(tools []Tool, name string) []Tool {
+	return slices.DeleteFunc(slices.Clone(tools), func(tool Tool) bool {
+		return tool.Function.Name == name
+	})
+}
@@ -0,0 +1,128 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStructuredResult(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     string
+		wantErr      error
+		wantResponse string
+		wantToolCall bool
+		wantMetadata LLMMetadata
+	}{
+		{
+			name:         "settings",
+			response:     `{"message": "Here is a cat.", "generation": {"prompt": "a cat", "steps": 4, "cfg": 1.0, "seed": -1, "generate_image": true}}`,
+			wantResponse: "Here is a cat.",
+			wantToolCall: true,
+			wantMetadata: LLMMetadata{Prompt: "a cat", Steps: 4, CFG: 1.0, Seed: -1, GenerateImage: true},
+		},
+		{
+			name:         "still asking",
+			response:     `{"message": "What kind of cat?"}`,
+			wantResponse: "What kind of cat?",
+		},
+		{
+			name:         "null settings",
+			response:     `{"message": "What kind of cat?", "generation": null}`,
+			wantResponse: "What kind of cat?",
+		},
+		{
+			name:     "not JSON",
+			response: "What kind of cat?",
+			wantErr:  ErrMissingFields,
+		},
+		{
+			name:     "settings missing fields",
+			response: `{"message": "Here is a cat.", "generation": {"prompt": "a cat"}}`,
+			wantErr:  ErrMissingFields,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := structuredResult(tt.response)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("structuredResult() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if result.Response != tt.wantResponse {
+				t.Errorf("Response = %q, want %q", result.Response, tt.wantResponse)
+			}
+			if result.HasToolCall != tt.wantToolCall {
+				t.Errorf("HasToolCall = %v, want %v", result.HasToolCall, tt.wantToolCall)
+			}
+			if result.Metadata != tt.wantMetadata {
+				t.Errorf("Metadata = %+v, want %+v", result.Metadata, tt.wantMetadata)
+			}
+		})
+	}
+}
+
+func TestChatStructuredOutput(t *testing.T) {
+	var received ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		chunks := []string{
+			`{"message": "Here is `,
+			`a cat.", "generation": {"prompt": "a cat", "steps": 4, "cfg": 1.0, "seed": 7, "generate_image": true}}`,
+		}
+		for i, chunk := range chunks {
+			data, _ := json.Marshal(ChatResponse{
+				Model:   DefaultModel,
+				Message: Message{Role: RoleAssistant, Content: chunk},
+				Done:    i == len(chunks)-1,
+			})
+			w.Write(data)
+			w.Write([]byte("\n"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClientWithConfig(server.URL, DefaultModel, 5*time.Second)
+	client.SetStructuredOutput(true)
+
+	var text strings.Builder
+	var streamedCalls []ToolCall
+	other := Tool{Type: "function", Function: ToolFunction{Name: "search_gallery"}}
+	result, err := client.Chat(context.Background(), []Message{{Role: RoleUser, Content: "a cat"}}, nil,
+		[]Tool{UpdateGenerationTool(), other}, func(token StreamToken) error {
+			text.WriteString(token.Content)
+			streamedCalls = append(streamedCalls, token.ToolCalls...)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	if received.Format == nil {
+		t.Error("request has no format schema")
+	}
+	if len(received.Tools) != 1 || received.Tools[0].Function.Name != "search_gallery" {
+		t.Errorf("tools = %+v, want only search_gallery", received.Tools)
+	}
+	if got := text.String(); got != "Here is a cat." {
+		t.Errorf("streamed text = %q, want the message only", got)
+	}
+	if len(streamedCalls) != 1 || !isUpdateGeneration(streamedCalls[0]) {
+		t.Errorf("streamed tool calls = %+v, want update_generation", streamedCalls)
+	}
+	if !result.HasToolCall || result.Metadata.Prompt != "a cat" || result.Metadata.Seed != 7 {
+		t.Errorf("result = %+v, want the generation settings", result)
+	}
+	if !strings.HasPrefix(result.RawResponse, "Here is a cat.\n__TOOL_CALLS__\n") {
+		t.Errorf("RawResponse = %q, want the tool call mode format", result.RawResponse)
+	}
+}
@@ -15,8 +15,12 @@ const (
 
 // API endpoints
 const (
-	EndpointTags = "/api/tags"
-	EndpointChat = "/api/chat"
+	EndpointTags       = "/api/tags"
+	EndpointChat       = "/api/chat"
+	EndpointPs         = "/api/ps"
+	EndpointShow       = "/api/show"
+	EndpointEmbeddings = "/api/embeddings"
+	EndpointPull       = "/api/pull"
 )
 
 // Message roles
@@ -68,6 +72,9 @@ type ChatOptions struct {
 	// If nil, ollama uses random seed (non-deterministic).
 	// If non-nil (including 0), produces deterministic output with that seed.
 	Seed *int64 `json:"seed,omitempty"`
+
+	// Sampling parameters; see WithSampling
+	Sampling
 }
 
 // ChatRequest represents a request to ollama's /api/chat endpoint.
@@ -77,6 +84,15 @@ type ChatRequest struct {
 	Stream   bool         `json:"stream"`            // Whether to stream response
 	Options  *ChatOptions `json:"options,omitempty"` // Optional parameters
 	Tools    []Tool       `json:"tools,omitempty"`   // Available tools for function calling
+
+	// Format constrains the reply to a JSON schema (ollama's structured
+	// outputs); see StructuredOutputSchema
+	Format map[string]interface{} `json:"format,omitempty"`
+
+	// KeepAlive is how long ollama keeps the model loaded after the
+	// request, as a duration such as "5m" ("" = ollama's default, "0" =
+	// unload now, negative = forever)
+	KeepAlive string `json:"keep_alive,omitempty"`
 }
 
 // ChatResponse represents a streaming response from ollama's /api/chat endpoint.
@@ -97,12 +113,80 @@ type ChatResponse struct {
 	EvalDuration       int64 `json:"eval_duration,omitempty"`        // Generation time
 }
 
+// Usage counts the tokens of one chat request, from prompt_eval_count and
+// eval_count in ollama's final streamed message. Either count may be zero
+// if the server does not report it (ollama omits prompt_eval_count when
+// the prompt was cached).
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// Add returns the sum of u and other.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+	}
+}
+
 // TagsResponse represents the response from ollama's /api/tags endpoint.
 // Used to verify ollama is running and check available models.
 type TagsResponse struct {
 	Models []ModelInfo `json:"models"`
 }
 
+// PsResponse represents the response from ollama's /api/ps endpoint,
+// listing the models currently loaded in memory.
+type PsResponse struct {
+	Models []ModelInfo `json:"models"`
+}
+
+// ShowRequest represents a request to ollama's /api/show endpoint.
+type ShowRequest struct {
+	Model string `json:"model"`
+}
+
+// ShowResponse represents the parts of ollama's /api/show response used to
+// find a model's context length.
+type ShowResponse struct {
+	// Parameters holds the modelfile parameters, one "name value" per line
+	Parameters string `json:"parameters"`
+
+	// ModelInfo holds GGUF metadata such as "llama.context_length"
+	ModelInfo map[string]any `json:"model_info"`
+}
+
+// EmbeddingRequest represents a request to ollama's /api/embeddings endpoint.
+type EmbeddingRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+// EmbeddingResponse represents the response from ollama's /api/embeddings
+// endpoint.
+type EmbeddingResponse struct {
+	Embedding []float64 `json:"embedding"`
+}
+
+// PullRequest represents a request to ollama's /api/pull endpoint.
+type PullRequest struct {
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+}
+
+// PullProgress is one line of ollama's streamed /api/pull response. Status
+// describes the step, such as "pulling manifest", "pulling <digest>" or
+// "success". Total and Completed count the bytes of the layer being
+// downloaded and are zero for the other steps.
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
 // ModelInfo represents information about an available model.
 type ModelInfo struct {
 	Name       string `json:"name"`        // Model name (e.g., "llama3.2:1b")
@@ -112,9 +196,14 @@ type ModelInfo struct {
 
 // StreamToken represents a token received during streaming.
 // Used by the streaming callback to receive tokens as they arrive.
+//
+// Tool calls are passed as soon as their chunk arrives, in a token of their
+// own with empty Content, so callers can act on them before the
+// conversational text finishes. They are also in the final ChatResult.
 type StreamToken struct {
-	Content string // Token text
-	Done    bool   // True if this is the final token
+	Content   string     // Token text
+	Done      bool       // True if this is the final token
+	ToolCalls []ToolCall // Tool calls received in this chunk, if any
 }
 
 // LLMMetadata represents the structured metadata extracted from function calls.
@@ -163,12 +252,26 @@ type ChatResult struct {
 	// If false, this is a pure conversational response with no generation metadata.
 	HasToolCall bool
 
+	// ToolCalls holds every function call in the response, including
+	// update_generation, in the order the LLM made them.
+	ToolCalls []ToolCall
+
 	// RawResponse is the full LLM response including conversational text
 	// and tool call marker/data. This is what should be stored in
 	// conversation history to preserve the complete response format.
 	RawResponse string
+
+	// Usage is the token count of the request, if the server reported it.
+	Usage Usage
+
+	// Model is the model that produced the response.
+	Model string
 }
 
+// UpdateGenerationToolName is the name of the function that sets the
+// prompt and generation settings.
+const UpdateGenerationToolName = "update_generation"
+
 // UpdateGenerationTool returns the tool definition for the update_generation function.
 // This function allows the LLM to update generation parameters and optionally trigger
 // image generation through structured function calling.
@@ -176,7 +279,7 @@ func UpdateGenerationTool() Tool {
 	return Tool{
 		Type: "function",
 		Function: ToolFunction{
-			Name:        "update_generation",
+			Name:        UpdateGenerationToolName,
 			Description: "Update image generation prompt and settings. Use this to set or modify the generation parameters and optionally trigger image generation.",
 			Parameters: map[string]interface{}{
 				"type": "object",
@@ -205,6 +308,25 @@ func UpdateGenerationTool() Tool {
 						"type":        "boolean",
 						"description": "Whether to automatically trigger image generation. Set to true to generate immediately, false to just update settings without generating.",
 					},
+					"loras": map[string]interface{}{
+						"type":        "array",
+						"description": "LoRAs to apply, by name from the available LoRAs, each with a weight (-2 to 2, default 1; lower is subtler, negative inverts). At most 4. Omit to keep the current LoRAs; an empty list removes them.",
+						"maxItems":    4,
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"name": map[string]interface{}{
+									"type": "string",
+								},
+								"weight": map[string]interface{}{
+									"type":    "number",
+									"minimum": -2,
+									"maximum": 2,
+								},
+							},
+							"required": []string{"name"},
+						},
+					},
 				},
 				"required": []string{"prompt", "steps", "cfg", "seed", "generate_image"},
 			},
@@ -0,0 +1,238 @@
+package persistence
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// EncryptionFileName is the file in the sessions directory that holds
+	// the key derivation salt. Its presence means sessions are encrypted.
+	EncryptionFileName = "encryption.json"
+
+	keySize  = 32 // AES-256
+	saltSize = 16
+)
+
+// keyIterations is the PBKDF2 iteration count for new encryption files.
+// Existing files keep the count they were created with.
+var keyIterations = 600000
+
+// encryptedMagic prefixes every encrypted file so plaintext files written
+// before encryption was enabled can still be read.
+var encryptedMagic = []byte("WEAVEENC1")
+
+// encryptionCheck is sealed into the encryption file to detect a wrong
+// passphrase before any session is read or overwritten.
+var encryptionCheck = []byte("weave")
+
+var (
+	// ErrWrongPassphrase is returned when the passphrase doesn't match the
+	// one the sessions were encrypted with
+	ErrWrongPassphrase = errors.New("wrong passphrase for encrypted sessions")
+	// ErrEncrypted is returned when reading an encrypted file without a key
+	ErrEncrypted = errors.New("file is encrypted and no passphrase was given")
+	// ErrDecryptFailed is returned when an encrypted file was modified or
+	// was encrypted with a different key
+	ErrDecryptFailed = errors.New("failed to decrypt file")
+)
+
+// Encryptor encrypts files at rest with AES-256-GCM.
+//
+// Encrypted format: "WEAVEENC1" + nonce (12 bytes) + ciphertext and tag.
+type Encryptor struct {
+	aead cipher.AEAD
+}
+
+// NewEncryptor creates an Encryptor from a 32-byte key.
+func NewEncryptor(key []byte) (*Encryptor, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return &Encryptor{aead: aead}, nil
+}
+
+// Seal encrypts plaintext with a random nonce.
+func (e *Encryptor) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, len(encryptedMagic)+len(nonce)+len(plaintext)+e.aead.Overhead())
+	out = append(out, encryptedMagic...)
+	out = append(out, nonce...)
+	return e.aead.Seal(out, nonce, plaintext, encryptedMagic), nil
+}
+
+// Open decrypts data written by Seal.
+// Returns ErrDecryptFailed if data was modified or sealed with another key.
+func (e *Encryptor) Open(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, fmt.Errorf("%w: not an encrypted file", ErrDecryptFailed)
+	}
+	data = data[len(encryptedMagic):]
+
+	nonceSize := e.aead.NonceSize()
+	if len(data) < nonceSize+e.aead.Overhead() {
+		return nil, fmt.Errorf("%w: file too short", ErrDecryptFailed)
+	}
+	plaintext, err := e.aead.Open(nil, data[:nonceSize], data[nonceSize:], encryptedMagic)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted reports whether data was written by an Encryptor.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// writeSealed encrypts data with e, if not nil, and writes it atomically.
+func writeSealed(e *Encryptor, path string, data []byte) error {
+	if e != nil {
+		sealed, err := e.Seal(data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", filepath.Base(path), err)
+		}
+		data = sealed
+	}
+	return writeFileAtomic(path, data)
+}
+
+// readSealed reads a file written by writeSealed, decrypting it if needed.
+// Plaintext files are returned as-is, and encrypted files without e return
+// ErrEncrypted.
+func readSealed(e *Encryptor, path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	if e == nil {
+		return nil, ErrEncrypted
+	}
+	return e.Open(data)
+}
+
+// encryptionFile is the JSON format of EncryptionFileName.
+type encryptionFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Check      []byte `json:"check"`
+}
+
+// EncryptionConfigured reports whether the sessions in basePath are
+// encrypted.
+func EncryptionConfigured(basePath string) bool {
+	_, err := os.Stat(filepath.Join(basePath, EncryptionFileName))
+	return err == nil
+}
+
+// OpenEncryption derives the key for the sessions in basePath from a
+// passphrase with PBKDF2-SHA256. The first call creates the encryption file
+// with a random salt; later calls return ErrWrongPassphrase if the
+// passphrase differs.
+func OpenEncryption(basePath, passphrase string) (*Encryptor, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase cannot be empty")
+	}
+
+	path := filepath.Join(basePath, EncryptionFileName)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return createEncryption(path, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", EncryptionFileName, err)
+	}
+
+	var file encryptionFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", EncryptionFileName, err)
+	}
+	if file.Version != 1 || file.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("unsupported %s: version %d, kdf %q", EncryptionFileName, file.Version, file.KDF)
+	}
+
+	enc, err := deriveEncryptor(passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	check, err := enc.Open(file.Check)
+	if err != nil || !bytes.Equal(check, encryptionCheck) {
+		return nil, ErrWrongPassphrase
+	}
+	return enc, nil
+}
+
+// createEncryption writes a new encryption file for passphrase.
+func createEncryption(path, passphrase string) (*Encryptor, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	enc, err := deriveEncryptor(passphrase, salt, keyIterations)
+	if err != nil {
+		return nil, err
+	}
+	check, err := enc.Seal(encryptionCheck)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(encryptionFile{
+		Version:    1,
+		KDF:        "pbkdf2-sha256",
+		Iterations: keyIterations,
+		Salt:       salt,
+		Check:      check,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize %s: %w", EncryptionFileName, err)
+	}
+
+	// 0700: owner-only access
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// deriveEncryptor derives a key from passphrase and creates an Encryptor.
+func deriveEncryptor(passphrase string, salt []byte, iterations int) (*Encryptor, error) {
+	if len(salt) != saltSize || iterations < 1 {
+		return nil, fmt.Errorf("invalid key parameters in %s", EncryptionFileName)
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return NewEncryptor(key)
+}
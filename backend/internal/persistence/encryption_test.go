@@ -0,0 +1,118 @@
+package persistence
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// fastKeyDerivation lowers the PBKDF2 iteration count for the test.
+func fastKeyDerivation(t *testing.T) {
+	t.Helper()
+	old := keyIterations
+	keyIterations = 1000
+	t.Cleanup(func() { keyIterations = old })
+}
+
+func TestEncryptor_RoundTrip(t *testing.T) {
+	enc, err := NewEncryptor(bytes.Repeat([]byte{7}, keySize))
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+
+	plaintext := []byte(`{"current_prompt":"a secret garden"}`)
+	sealed, err := enc.Seal(plaintext)
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if !IsEncrypted(sealed) {
+		t.Error("IsEncrypted() = false for sealed data")
+	}
+	if bytes.Contains(sealed, []byte("secret garden")) {
+		t.Error("sealed data contains the plaintext")
+	}
+
+	again, err := enc.Seal(plaintext)
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Error("Seal() reused a nonce")
+	}
+
+	opened, err := enc.Open(sealed)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open() = %q, want %q", opened, plaintext)
+	}
+}
+
+func TestEncryptor_OpenInvalid(t *testing.T) {
+	enc, _ := NewEncryptor(bytes.Repeat([]byte{7}, keySize))
+	other, _ := NewEncryptor(bytes.Repeat([]byte{8}, keySize))
+	sealed, _ := enc.Seal([]byte("hello"))
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name string
+		enc  *Encryptor
+		data []byte
+	}{
+		{"plaintext", enc, []byte(`{"messages":[]}`)},
+		{"truncated", enc, sealed[:len(encryptedMagic)+4]},
+		{"tampered", enc, tampered},
+		{"wrong key", other, sealed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.enc.Open(tt.data); !errors.Is(err, ErrDecryptFailed) {
+				t.Errorf("Open() error = %v, want ErrDecryptFailed", err)
+			}
+		})
+	}
+}
+
+func TestNewEncryptor_InvalidKey(t *testing.T) {
+	if _, err := NewEncryptor([]byte("short")); err == nil {
+		t.Error("NewEncryptor() with short key error = nil, want error")
+	}
+}
+
+func TestOpenEncryption(t *testing.T) {
+	fastKeyDerivation(t)
+	dir := t.TempDir()
+
+	if EncryptionConfigured(dir) {
+		t.Fatal("EncryptionConfigured() = true before first use")
+	}
+
+	first, err := OpenEncryption(dir, "correct horse")
+	if err != nil {
+		t.Fatalf("OpenEncryption() error = %v", err)
+	}
+	if !EncryptionConfigured(dir) {
+		t.Fatal("EncryptionConfigured() = false after first use")
+	}
+
+	// The same passphrase derives the same key
+	second, err := OpenEncryption(dir, "correct horse")
+	if err != nil {
+		t.Fatalf("OpenEncryption() reopen error = %v", err)
+	}
+	sealed, _ := first.Seal([]byte("hello"))
+	if _, err := second.Open(sealed); err != nil {
+		t.Errorf("reopened encryptor Open() error = %v", err)
+	}
+
+	if _, err := OpenEncryption(dir, "battery staple"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("OpenEncryption() with wrong passphrase error = %v, want ErrWrongPassphrase", err)
+	}
+	if _, err := OpenEncryption(dir, ""); err == nil {
+		t.Error("OpenEncryption() with empty passphrase error = nil, want error")
+	}
+}
@@ -0,0 +1,236 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/timestamp"
+)
+
+const (
+	// favoritesFileName is the name of a session's favorites file within its directory
+	favoritesFileName = "favorites.json"
+
+	// MaxFavoritesPerSession limits the number of favorited images per session.
+	MaxFavoritesPerSession = 1000
+)
+
+var (
+	// ErrFavoritesFull is returned when starring would exceed MaxFavoritesPerSession
+	ErrFavoritesFull = errors.New("too many favorites")
+)
+
+// Favorite records that a session image was starred.
+type Favorite struct {
+	MessageID   int       `json:"message_id"`
+	FavoritedAt time.Time `json:"favorited_at"`
+	Seq         int64     `json:"seq"`
+}
+
+// FavoriteStore manages the starred images of each session. Favorites are
+// stored next to the session's images so they are removed with the session.
+//
+// Storage structure:
+//
+//	config/sessions/{session_id}/favorites.json
+type FavoriteStore struct {
+	mu       sync.Mutex
+	basePath string
+}
+
+// NewFavoriteStore creates a favorite store rooted at the specified base path.
+// The base path is typically "config/sessions".
+func NewFavoriteStore(basePath string) *FavoriteStore {
+	return &FavoriteStore{
+		basePath: basePath,
+	}
+}
+
+// Add stars an image. Starring an image that is already a favorite
+// keeps its original timestamp.
+func (f *FavoriteStore) Add(sessionID string, messageID int) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return fmt.Errorf("invalid session ID: %w", err)
+	}
+	if messageID <= 0 {
+		return fmt.Errorf("message ID must be positive")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	favorites, err := f.loadLocked(sessionID)
+	if err != nil {
+		return err
+	}
+	for _, fav := range favorites {
+		if fav.MessageID == messageID {
+			return nil
+		}
+	}
+	if len(favorites) >= MaxFavoritesPerSession {
+		return ErrFavoritesFull
+	}
+
+	favoritedAt, seq := timestamp.Next()
+	favorites = append(favorites, Favorite{
+		MessageID:   messageID,
+		FavoritedAt: favoritedAt,
+		Seq:         seq,
+	})
+	return f.saveLocked(sessionID, favorites)
+}
+
+// Remove unstars an image.
+// Returns false if the image was not a favorite.
+func (f *FavoriteStore) Remove(sessionID string, messageID int) (bool, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return false, fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	favorites, err := f.loadLocked(sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	kept := make([]Favorite, 0, len(favorites))
+	for _, fav := range favorites {
+		if fav.MessageID != messageID {
+			kept = append(kept, fav)
+		}
+	}
+	if len(kept) == len(favorites) {
+		return false, nil
+	}
+
+	if err := f.saveLocked(sessionID, kept); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// List returns a session's favorites, most recently starred first.
+// Returns an empty slice if the session has none.
+func (f *FavoriteStore) List(sessionID string) ([]Favorite, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	favorites, err := f.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(favorites, func(i, j int) bool {
+		return favorites[i].Seq > favorites[j].Seq
+	})
+	return favorites, nil
+}
+
+// IsFavorite reports whether an image is starred.
+func (f *FavoriteStore) IsFavorite(sessionID string, messageID int) (bool, error) {
+	favorites, err := f.List(sessionID)
+	if err != nil {
+		return false, err
+	}
+	for _, fav := range favorites {
+		if fav.MessageID == messageID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// loadLocked reads a session's favorites from disk.
+// A missing file is treated as no favorites. Favorites starred before
+// sequence numbers existed are migrated; see migrateFavorites.
+// Must be called with f.mu held.
+func (f *FavoriteStore) loadLocked(sessionID string) ([]Favorite, error) {
+	data, err := os.ReadFile(f.path(sessionID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Favorite{}, nil
+		}
+		return nil, fmt.Errorf("failed to read favorites: %w", err)
+	}
+
+	var favorites []Favorite
+	if err := json.Unmarshal(data, &favorites); err != nil {
+		return nil, fmt.Errorf("failed to parse favorites: %w", err)
+	}
+	migrateFavorites(favorites)
+	return favorites, nil
+}
+
+// migrateFavorites converts star times to UTC and gives favorites without
+// a Seq one in star order. The file is rewritten with the result on the
+// next change.
+func migrateFavorites(favorites []Favorite) {
+	order := make([]int, len(favorites))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return favorites[order[a]].FavoritedAt.Before(favorites[order[b]].FavoritedAt)
+	})
+
+	var prev int64
+	for _, i := range order {
+		fav := &favorites[i]
+		if fav.Seq == 0 {
+			fav.FavoritedAt, fav.Seq = timestamp.Migrate(fav.FavoritedAt, prev)
+		} else {
+			fav.FavoritedAt = timestamp.Normalize(fav.FavoritedAt)
+		}
+		prev = max(prev, fav.Seq)
+		timestamp.Observe(fav.FavoritedAt, fav.Seq)
+	}
+}
+
+// saveLocked writes a session's favorites atomically.
+// Must be called with f.mu held.
+func (f *FavoriteStore) saveLocked(sessionID string, favorites []Favorite) error {
+	data, err := json.MarshalIndent(favorites, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize favorites: %w", err)
+	}
+
+	path := f.path(sessionID)
+
+	// 0700: owner-only access
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	// Write to temp file first, then rename (atomic write)
+	// 0600: owner read/write only
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write favorites: %w", err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		// Clean up temp file if rename fails
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("failed to commit favorites: %w", err)
+	}
+
+	return nil
+}
+
+// path returns the favorites file for a session.
+func (f *FavoriteStore) path(sessionID string) string {
+	return filepath.Join(f.basePath, sessionID, favoritesFileName)
+}
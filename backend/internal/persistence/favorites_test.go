@@ -0,0 +1,133 @@
+package persistence
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFavoriteStore_AddListRemove(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := NewFavoriteStore(tmpDir)
+	sessionID := createTestSessionID(30)
+
+	if err := store.Add(sessionID, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := store.Add(sessionID, 2); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	// Starring again is a no-op
+	if err := store.Add(sessionID, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	// A new store on the same path sees the persisted favorites
+	favorites, err := NewFavoriteStore(tmpDir).List(sessionID)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(favorites) != 2 {
+		t.Fatalf("List() length = %d, want 2", len(favorites))
+	}
+	if favorites[0].MessageID != 2 {
+		t.Errorf("List()[0] = message %d, want most recent favorite 2", favorites[0].MessageID)
+	}
+
+	removed, err := store.Remove(sessionID, 1)
+	if err != nil || !removed {
+		t.Fatalf("Remove() = %v, %v, want true, nil", removed, err)
+	}
+	if ok, err := store.IsFavorite(sessionID, 1); err != nil || ok {
+		t.Errorf("IsFavorite() = %v, %v, want false, nil", ok, err)
+	}
+	if ok, err := store.IsFavorite(sessionID, 2); err != nil || !ok {
+		t.Errorf("IsFavorite() = %v, %v, want true, nil", ok, err)
+	}
+
+	removed, err = store.Remove(sessionID, 1)
+	if err != nil || removed {
+		t.Errorf("second Remove() = %v, %v, want false, nil", removed, err)
+	}
+
+	// Sessions don't see each other's favorites
+	other, err := store.List(createTestSessionID(31))
+	if err != nil || len(other) != 0 {
+		t.Errorf("List() of other session = %v, %v, want empty", other, err)
+	}
+}
+
+func TestFavoriteStore_Validation(t *testing.T) {
+	store := NewFavoriteStore(t.TempDir())
+
+	tests := []struct {
+		name      string
+		sessionID string
+		messageID int
+	}{
+		{"invalid session ID", "../etc", 1},
+		{"zero message ID", createTestSessionID(32), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.Add(tt.sessionID, tt.messageID); err == nil {
+				t.Error("Add() error = nil, want error")
+			}
+		})
+	}
+
+	if _, err := store.List("../etc"); err == nil {
+		t.Error("List() error = nil, want error for invalid session ID")
+	}
+}
+
+func TestFavoriteStore_Full(t *testing.T) {
+	store := NewFavoriteStore(t.TempDir())
+	sessionID := createTestSessionID(33)
+
+	favorites := make([]Favorite, MaxFavoritesPerSession)
+	for i := range favorites {
+		favorites[i] = Favorite{MessageID: i + 1, FavoritedAt: time.Now().UTC()}
+	}
+	if err := store.saveLocked(sessionID, favorites); err != nil {
+		t.Fatalf("saveLocked() error = %v", err)
+	}
+
+	if err := store.Add(sessionID, MaxFavoritesPerSession+1); !errors.Is(err, ErrFavoritesFull) {
+		t.Errorf("Add() error = %v, want ErrFavoritesFull", err)
+	}
+}
+
+func TestFavoriteStore_MigratesLegacyFile(t *testing.T) {
+	store := NewFavoriteStore(t.TempDir())
+	sessionID := createTestSessionID(34)
+
+	// A file written before favorites had sequence numbers
+	legacy := `[
+  {"message_id": 1, "favorited_at": "2025-03-01T11:00:00Z"},
+  {"message_id": 2, "favorited_at": "2025-03-01T14:00:00+02:00"}
+]`
+	if err := os.MkdirAll(filepath.Dir(store.path(sessionID)), 0700); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := os.WriteFile(store.path(sessionID), []byte(legacy), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	favorites, err := store.List(sessionID)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(favorites) != 2 || favorites[0].MessageID != 2 || favorites[1].MessageID != 1 {
+		t.Fatalf("List() = %+v, want message 2 then 1", favorites)
+	}
+	if favorites[0].Seq <= favorites[1].Seq || favorites[1].Seq == 0 {
+		t.Errorf("Seq = %d, %d, want increasing in star order", favorites[1].Seq, favorites[0].Seq)
+	}
+	if want := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC); favorites[0].FavoritedAt != want {
+		t.Errorf("FavoritedAt = %v, want %v", favorites[0].FavoritedAt, want)
+	}
+}
@@ -0,0 +1,318 @@
+package persistence
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/timestamp"
+)
+
+const (
+	// galleryFileName is the name of the gallery index within the base path
+	galleryFileName = "gallery.json"
+
+	// MaxGalleryEntries limits the number of published images.
+	// This bounds the size of the index file and the gallery page.
+	MaxGalleryEntries = 1000
+)
+
+var (
+	// ErrGalleryFull is returned when publishing would exceed MaxGalleryEntries
+	ErrGalleryFull = errors.New("gallery is full")
+)
+
+// GalleryEntry describes a published image.
+// ID is a random public identifier so gallery URLs never reveal the
+// owning session ID (which doubles as the session cookie value).
+type GalleryEntry struct {
+	ID          string    `json:"id"`
+	SessionID   string    `json:"session_id"`
+	MessageID   int       `json:"message_id"`
+	Prompt      string    `json:"prompt"`
+	PublishedAt time.Time `json:"published_at"`
+	Seq         int64     `json:"seq"`
+}
+
+// GalleryStore manages the index of images published to the public gallery.
+// Image data stays in the owning session's ImageStore; the gallery only
+// records which images are published.
+//
+// Storage structure:
+//
+//	config/sessions/gallery.json
+type GalleryStore struct {
+	mu      sync.Mutex
+	path    string
+	entries []GalleryEntry
+	loaded  bool
+}
+
+// NewGalleryStore creates a gallery store rooted at the specified base path.
+// The base path is typically "config/sessions".
+//
+// The index is loaded on first use and created when the first image is published.
+func NewGalleryStore(basePath string) *GalleryStore {
+	return &GalleryStore{
+		path: filepath.Join(basePath, galleryFileName),
+	}
+}
+
+// Publish adds an image to the gallery and returns its entry.
+// Publishing an image that is already published returns the existing entry.
+func (g *GalleryStore) Publish(sessionID string, messageID int, prompt string) (GalleryEntry, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return GalleryEntry{}, fmt.Errorf("invalid session ID: %w", err)
+	}
+	if messageID <= 0 {
+		return GalleryEntry{}, fmt.Errorf("message ID must be positive")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.loadLocked(); err != nil {
+		return GalleryEntry{}, err
+	}
+
+	for _, e := range g.entries {
+		if e.SessionID == sessionID && e.MessageID == messageID {
+			return e, nil
+		}
+	}
+
+	if len(g.entries) >= MaxGalleryEntries {
+		return GalleryEntry{}, ErrGalleryFull
+	}
+
+	id, err := newGalleryID()
+	if err != nil {
+		return GalleryEntry{}, err
+	}
+
+	publishedAt, seq := timestamp.Next()
+	entry := GalleryEntry{
+		ID:          id,
+		SessionID:   sessionID,
+		MessageID:   messageID,
+		Prompt:      prompt,
+		PublishedAt: publishedAt,
+		Seq:         seq,
+	}
+
+	entries := append(append([]GalleryEntry(nil), g.entries...), entry)
+	if err := g.saveLocked(entries); err != nil {
+		return GalleryEntry{}, err
+	}
+	g.entries = entries
+
+	return entry, nil
+}
+
+// Unpublish removes an image from the gallery.
+// Returns false if the image was not published.
+func (g *GalleryStore) Unpublish(sessionID string, messageID int) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.loadLocked(); err != nil {
+		return false, err
+	}
+
+	entries := make([]GalleryEntry, 0, len(g.entries))
+	for _, e := range g.entries {
+		if e.SessionID != sessionID || e.MessageID != messageID {
+			entries = append(entries, e)
+		}
+	}
+
+	if len(entries) == len(g.entries) {
+		return false, nil
+	}
+
+	if err := g.saveLocked(entries); err != nil {
+		return false, err
+	}
+	g.entries = entries
+
+	return true, nil
+}
+
+// UnpublishSession removes all of a session's images from the gallery.
+// Returns how many were removed.
+func (g *GalleryStore) UnpublishSession(sessionID string) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.loadLocked(); err != nil {
+		return 0, err
+	}
+
+	entries := make([]GalleryEntry, 0, len(g.entries))
+	for _, e := range g.entries {
+		if e.SessionID != sessionID {
+			entries = append(entries, e)
+		}
+	}
+
+	removed := len(g.entries) - len(entries)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if err := g.saveLocked(entries); err != nil {
+		return 0, err
+	}
+	g.entries = entries
+
+	return removed, nil
+}
+
+// Get returns the entry with the given public ID.
+func (g *GalleryStore) Get(id string) (GalleryEntry, bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.loadLocked(); err != nil {
+		return GalleryEntry{}, false, err
+	}
+
+	for _, e := range g.entries {
+		if e.ID == id {
+			return e, true, nil
+		}
+	}
+	return GalleryEntry{}, false, nil
+}
+
+// IsPublished reports whether the image for a message is in the gallery.
+func (g *GalleryStore) IsPublished(sessionID string, messageID int) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.loadLocked(); err != nil {
+		return false, err
+	}
+
+	for _, e := range g.entries {
+		if e.SessionID == sessionID && e.MessageID == messageID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// List returns all published entries, most recently published first.
+func (g *GalleryStore) List() ([]GalleryEntry, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.loadLocked(); err != nil {
+		return nil, err
+	}
+
+	entries := append([]GalleryEntry(nil), g.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Seq > entries[j].Seq
+	})
+	return entries, nil
+}
+
+// loadLocked reads the index from disk on first use.
+// A missing index is treated as an empty gallery. Entries published before
+// sequence numbers existed are migrated; see migrateGalleryEntries.
+// Must be called with g.mu held.
+func (g *GalleryStore) loadLocked() error {
+	if g.loaded {
+		return nil
+	}
+
+	data, err := os.ReadFile(g.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			g.loaded = true
+			return nil
+		}
+		return fmt.Errorf("failed to read gallery index: %w", err)
+	}
+
+	var entries []GalleryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse gallery index: %w", err)
+	}
+
+	migrateGalleryEntries(entries)
+	g.entries = entries
+	g.loaded = true
+	return nil
+}
+
+// migrateGalleryEntries converts publish times to UTC and gives entries
+// without a Seq one in publish order. The index is rewritten with the
+// result on the next publish or unpublish.
+func migrateGalleryEntries(entries []GalleryEntry) {
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return entries[order[a]].PublishedAt.Before(entries[order[b]].PublishedAt)
+	})
+
+	var prev int64
+	for _, i := range order {
+		e := &entries[i]
+		if e.Seq == 0 {
+			e.PublishedAt, e.Seq = timestamp.Migrate(e.PublishedAt, prev)
+		} else {
+			e.PublishedAt = timestamp.Normalize(e.PublishedAt)
+		}
+		prev = max(prev, e.Seq)
+		timestamp.Observe(e.PublishedAt, e.Seq)
+	}
+}
+
+// saveLocked writes the index atomically.
+// Must be called with g.mu held.
+func (g *GalleryStore) saveLocked(entries []GalleryEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize gallery index: %w", err)
+	}
+
+	// 0700: owner-only access
+	if err := os.MkdirAll(filepath.Dir(g.path), 0700); err != nil {
+		return fmt.Errorf("failed to create gallery directory: %w", err)
+	}
+
+	// Write to temp file first, then rename (atomic write)
+	// 0600: owner read/write only
+	tempPath := g.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write gallery index: %w", err)
+	}
+
+	if err := os.Rename(tempPath, g.path); err != nil {
+		// Clean up temp file if rename fails
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("failed to commit gallery index: %w", err)
+	}
+
+	return nil
+}
+
+// newGalleryID generates a random 32-character hex public ID.
+func newGalleryID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate gallery ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
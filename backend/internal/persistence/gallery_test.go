@@ -0,0 +1,185 @@
+package persistence
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGalleryStore_PublishAndList(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := NewGalleryStore(tmpDir)
+	sessionID := createTestSessionID(20)
+
+	first, err := store.Publish(sessionID, 1, "a cat")
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if len(first.ID) != 32 || first.ID == sessionID {
+		t.Errorf("entry ID = %q, want random 32-char ID distinct from session", first.ID)
+	}
+
+	second, err := store.Publish(sessionID, 2, "a dog")
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	// Publishing again returns the existing entry
+	again, err := store.Publish(sessionID, 1, "ignored")
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if again.ID != first.ID || again.Prompt != "a cat" {
+		t.Errorf("re-publish = %+v, want existing entry %+v", again, first)
+	}
+
+	entries, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("List() length = %d, want 2", len(entries))
+	}
+	if entries[0].ID != second.ID {
+		t.Errorf("List()[0] = %q, want newest entry %q", entries[0].ID, second.ID)
+	}
+
+	// A new store on the same path sees the persisted index
+	reloaded := NewGalleryStore(tmpDir)
+	got, ok, err := reloaded.Get(first.ID)
+	if err != nil || !ok {
+		t.Fatalf("Get() = %v, %v, want entry", ok, err)
+	}
+	if got.SessionID != sessionID || got.MessageID != 1 {
+		t.Errorf("Get() = %+v, want session %s message 1", got, sessionID)
+	}
+}
+
+func TestGalleryStore_Unpublish(t *testing.T) {
+	store := NewGalleryStore(t.TempDir())
+	sessionID := createTestSessionID(21)
+
+	if _, err := store.Publish(sessionID, 3, "a fox"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	removed, err := store.Unpublish(sessionID, 3)
+	if err != nil || !removed {
+		t.Fatalf("Unpublish() = %v, %v, want true, nil", removed, err)
+	}
+
+	published, err := store.IsPublished(sessionID, 3)
+	if err != nil || published {
+		t.Errorf("IsPublished() = %v, %v, want false, nil", published, err)
+	}
+
+	removed, err = store.Unpublish(sessionID, 3)
+	if err != nil || removed {
+		t.Errorf("second Unpublish() = %v, %v, want false, nil", removed, err)
+	}
+}
+
+func TestGalleryStore_UnpublishSession(t *testing.T) {
+	store := NewGalleryStore(t.TempDir())
+	sessionID := createTestSessionID(23)
+	otherID := createTestSessionID(24)
+
+	for _, messageID := range []int{1, 2} {
+		if _, err := store.Publish(sessionID, messageID, "a fox"); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	if _, err := store.Publish(otherID, 1, "a hare"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	removed, err := store.UnpublishSession(sessionID)
+	if err != nil || removed != 2 {
+		t.Fatalf("UnpublishSession() = %d, %v, want 2, nil", removed, err)
+	}
+	if entries, _ := store.List(); len(entries) != 1 || entries[0].SessionID != otherID {
+		t.Errorf("List() after UnpublishSession() = %+v, want only the other session's image", entries)
+	}
+	if removed, err := store.UnpublishSession(sessionID); err != nil || removed != 0 {
+		t.Errorf("second UnpublishSession() = %d, %v, want 0, nil", removed, err)
+	}
+}
+
+func TestGalleryStore_PublishValidation(t *testing.T) {
+	store := NewGalleryStore(t.TempDir())
+
+	tests := []struct {
+		name      string
+		sessionID string
+		messageID int
+	}{
+		{"invalid session ID", "../etc", 1},
+		{"zero message ID", createTestSessionID(22), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.Publish(tt.sessionID, tt.messageID, ""); err == nil {
+				t.Error("Publish() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestGalleryStore_Full(t *testing.T) {
+	store := NewGalleryStore(t.TempDir())
+	sessionID := createTestSessionID(23)
+
+	for i := 1; i <= MaxGalleryEntries; i++ {
+		store.entries = append(store.entries, GalleryEntry{ID: newTestGalleryID(i), SessionID: sessionID, MessageID: i})
+	}
+	store.loaded = true
+
+	if _, err := store.Publish(sessionID, MaxGalleryEntries+1, ""); !errors.Is(err, ErrGalleryFull) {
+		t.Errorf("Publish() error = %v, want ErrGalleryFull", err)
+	}
+}
+
+func newTestGalleryID(i int) string {
+	return createTestSessionID(i % 1000)
+}
+
+func TestGalleryStore_MigratesLegacyIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	sessionID := createTestSessionID(21)
+
+	// An index written before entries had sequence numbers, with a local offset
+	legacy := `[
+  {"id": "` + newTestGalleryID(1) + `", "session_id": "` + sessionID + `", "message_id": 1, "prompt": "newer", "published_at": "2025-03-01T14:00:00+02:00"},
+  {"id": "` + newTestGalleryID(2) + `", "session_id": "` + sessionID + `", "message_id": 2, "prompt": "older", "published_at": "2025-03-01T11:00:00Z"}
+]`
+	if err := os.WriteFile(filepath.Join(tmpDir, galleryFileName), []byte(legacy), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	store := NewGalleryStore(tmpDir)
+	entries, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Prompt != "newer" || entries[1].Prompt != "older" {
+		t.Fatalf("List() = %+v, want newer then older", entries)
+	}
+	if entries[0].Seq <= entries[1].Seq || entries[1].Seq == 0 {
+		t.Errorf("Seq = %d, %d, want increasing in publish order", entries[1].Seq, entries[0].Seq)
+	}
+	if want := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC); entries[0].PublishedAt != want {
+		t.Errorf("PublishedAt = %v, want %v", entries[0].PublishedAt, want)
+	}
+
+	// Newly published entries sort after migrated ones
+	entry, err := store.Publish(sessionID, 3, "newest")
+	if err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if entry.Seq <= entries[0].Seq {
+		t.Errorf("new entry Seq = %d, want greater than %d", entry.Seq, entries[0].Seq)
+	}
+}
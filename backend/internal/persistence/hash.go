@@ -0,0 +1,92 @@
+package persistence
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// maxCachedHashes bounds the content hashes kept in memory. The cache
+	// is cleared when it fills; hashes are recomputed on the next request.
+	maxCachedHashes = 10000
+)
+
+// hashCache remembers the content hash of image files, keyed by path and
+// valid while the file's size and modification time are unchanged. Hashes
+// are recorded when an image is saved, so serving it does not have to read
+// the file just to answer a conditional request.
+type hashCache struct {
+	mu      sync.Mutex
+	entries map[string]hashEntry
+}
+
+type hashEntry struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+func newHashCache() *hashCache {
+	return &hashCache{entries: make(map[string]hashEntry)}
+}
+
+// get returns the cached hash for path if info still matches the file it
+// was computed from.
+func (c *hashCache) get(path string, info os.FileInfo) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[path]
+	if !ok || entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) {
+		return "", false
+	}
+	return entry.hash, true
+}
+
+// put records the hash of the file at path as described by info.
+func (c *hashCache) put(path string, info os.FileInfo, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxCachedHashes {
+		clear(c.entries)
+	}
+	c.entries[path] = hashEntry{size: info.Size(), modTime: info.ModTime(), hash: hash}
+}
+
+// remember caches the hash of data, just written to path.
+func (c *hashCache) remember(path string, data []byte) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	sum := sha256.Sum256(data)
+	c.put(path, info, hex.EncodeToString(sum[:]))
+}
+
+// ContentHash returns the hex SHA-256 of an image opened with Open or
+// OpenAlternate, as described by info. Hashes of images saved by this
+// store are cached; otherwise the file is read and left positioned at its
+// start.
+func (s *ImageStore) ContentHash(file *os.File, info os.FileInfo) (string, error) {
+	if hash, ok := s.hashes.get(file.Name(), info); ok {
+		return hash, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to hash image: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to rewind image: %w", err)
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	s.hashes.put(file.Name(), info, hash)
+	return hash, nil
+}
@@ -0,0 +1,108 @@
+package persistence
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestImageStore_ContentHash(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(1)
+	data := createTestPNGData(100)
+
+	if err := store.Save(sessionID, 1, data); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	file, err := store.Open(sessionID, 1)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+
+	hash, err := store.ContentHash(file, info)
+	if err != nil {
+		t.Fatalf("ContentHash() error = %v", err)
+	}
+	if hash != sha256Hex(data) {
+		t.Errorf("ContentHash() = %s, want %s", hash, sha256Hex(data))
+	}
+}
+
+func TestImageStore_ContentHash_Uncached(t *testing.T) {
+	dir := t.TempDir()
+	sessionID := createTestSessionID(1)
+	data := createTestPNGData(100)
+	if err := NewImageStore(dir).Save(sessionID, 1, data); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// A new store, as after a restart, hashes the file and rewinds it
+	store := NewImageStore(dir)
+	file, err := store.Open(sessionID, 1)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+
+	hash, err := store.ContentHash(file, info)
+	if err != nil {
+		t.Fatalf("ContentHash() error = %v", err)
+	}
+	if hash != sha256Hex(data) {
+		t.Errorf("ContentHash() = %s, want %s", hash, sha256Hex(data))
+	}
+	got, err := io.ReadAll(file)
+	if err != nil || len(got) != len(data) {
+		t.Errorf("file after ContentHash read %d bytes (err %v), want %d", len(got), err, len(data))
+	}
+}
+
+func TestImageStore_ContentHash_FileChanged(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(1)
+	if err := store.Save(sessionID, 1, createTestPNGData(100)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// Rewrite the file behind the store's back
+	changed := createTestPNGData(200)
+	path := filepath.Join(store.BasePath(), sessionID, "images", "1.png")
+	if err := os.WriteFile(path, changed, 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+
+	file, err := store.Open(sessionID, 1)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+
+	hash, err := store.ContentHash(file, info)
+	if err != nil {
+		t.Fatalf("ContentHash() error = %v", err)
+	}
+	if hash != sha256Hex(changed) {
+		t.Errorf("ContentHash() = %s, want hash of the new content", hash)
+	}
+}
@@ -1,9 +1,16 @@
 package persistence
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/image"
 )
 
 const (
@@ -14,13 +21,45 @@ const (
 )
 
 // ImageStore manages persisting session images to disk.
-// Images are stored per-session, keyed by message ID.
+// Images are stored per-session, keyed by message ID. A message can also
+// have numbered alternates (regenerations with a different seed).
 //
 // Storage structure:
 //
 //	config/sessions/{session_id}/images/{message_id}.png
+//	config/sessions/{session_id}/images/{message_id}-{alternate}.png
+//
+// Images are stored as PNG unless SetStorageFormat picks JPEG or WebP, in
+// which case the files are named .jpg or .webp. Images of every format are
+// found, so changing it leaves earlier images readable.
 type ImageStore struct {
 	basePath string // Base directory for all sessions (e.g., "config/sessions")
+	hashes   *hashCache
+	index    ImageIndex // Records saved and deleted images; nil if none
+
+	encryptor *Encryptor // Encrypts uploads at rest; nil writes plaintext
+
+	// Format images are saved in, set by SetStorageFormat; "" is PNG
+	formatMu sync.Mutex
+	format   image.OutputFormat
+	quality  int
+
+	// Quota on the base path, set by SetQuota
+	reserveMu     sync.Mutex
+	quotaMu       sync.Mutex
+	quotaBytes    int64
+	reclaim       ReclaimFunc
+	usedBytes     int64
+	usageMeasured time.Time
+}
+
+// ImageIndex is told about the images an ImageStore saves and deletes, so
+// they can be queried without listing directories. The image files stay
+// authoritative: a failure to update the index is only logged.
+type ImageIndex interface {
+	RecordImage(sessionID string, messageID, alternate int, size int64) error
+	RemoveImage(sessionID string, messageID, alternate int) error
+	RemoveImages(sessionID string, messageID int) error
 }
 
 // NewImageStore creates a new image store rooted at the specified base path.
@@ -30,16 +69,75 @@ type ImageStore struct {
 func NewImageStore(basePath string) *ImageStore {
 	return &ImageStore{
 		basePath: basePath,
+		hashes:   newHashCache(),
+	}
+}
+
+// SetIndex sets the index told about saved and deleted images. It must be
+// called before the store is used.
+func (s *ImageStore) SetIndex(index ImageIndex) {
+	s.index = index
+}
+
+// SetEncryptor encrypts uploaded reference images at rest. Generated
+// images are written as they are. It must be called before the store is
+// used.
+func (s *ImageStore) SetEncryptor(e *Encryptor) {
+	s.encryptor = e
+}
+
+// SetStorageFormat sets the format new images are saved in and the
+// quality of JPEG and WebP. Images already saved keep their format.
+func (s *ImageStore) SetStorageFormat(format image.OutputFormat, quality int) {
+	s.formatMu.Lock()
+	defer s.formatMu.Unlock()
+
+	s.format = format
+	s.quality = quality
+}
+
+// StorageFormat returns the format new images are saved in and its
+// quality.
+func (s *ImageStore) StorageFormat() (image.OutputFormat, int) {
+	s.formatMu.Lock()
+	defer s.formatMu.Unlock()
+
+	if s.format == "" {
+		return image.OutputPNG, s.quality
 	}
+	return s.format, s.quality
+}
+
+// BasePath returns the base directory for all sessions.
+func (s *ImageStore) BasePath() string {
+	return s.basePath
 }
 
-// Save persists an image to disk.
+// Save persists an image to disk, converted to the storage format.
 // The image is written to:
 // {basePath}/{sessionID}/images/{messageID}.png
 //
 // The session and images directories are created if they don't exist.
-// If the image file exists, it is overwritten atomically.
+// If the image file exists, it is overwritten atomically, and a copy in
+// another format is removed.
+// Returns ErrQuotaExceeded if the image doesn't fit in the quota.
 func (s *ImageStore) Save(sessionID string, messageID int, pngData []byte) error {
+	return s.save(sessionID, messageID, 0, pngData)
+}
+
+// SaveAlternate persists an alternate image for a message to:
+// {basePath}/{sessionID}/images/{messageID}-{alternate}.png
+//
+// Alternates are numbered from 1. The primary image is unaffected.
+func (s *ImageStore) SaveAlternate(sessionID string, messageID int, alternate int, pngData []byte) error {
+	if alternate <= 0 {
+		return fmt.Errorf("alternate must be positive")
+	}
+	return s.save(sessionID, messageID, alternate, pngData)
+}
+
+// save writes a primary (alternate 0) or alternate image atomically.
+func (s *ImageStore) save(sessionID string, messageID int, alternate int, pngData []byte) error {
 	if err := validateSessionID(sessionID); err != nil {
 		return fmt.Errorf("invalid session ID: %w", err)
 	}
@@ -55,6 +153,18 @@ func (s *ImageStore) Save(sessionID string, messageID int, pngData []byte) error
 		return fmt.Errorf("image size %d bytes exceeds maximum %d bytes", len(pngData), MaxImageSizeBytes)
 	}
 
+	data := pngData
+	format, quality := s.StorageFormat()
+	if format != image.OutputPNG {
+		var err error
+		if data, err = image.Convert(pngData, format, quality); err != nil {
+			return fmt.Errorf("failed to convert image to %s: %w", format, err)
+		}
+	}
+	if err := s.reserve(int64(len(data))); err != nil {
+		return err
+	}
+
 	// Create images directory structure (0700: owner-only access)
 	imagesDir := filepath.Join(s.basePath, sessionID, "images")
 	if err := os.MkdirAll(imagesDir, 0700); err != nil {
@@ -63,10 +173,10 @@ func (s *ImageStore) Save(sessionID string, messageID int, pngData []byte) error
 
 	// Write to temp file first, then rename (atomic write)
 	// 0600: owner read/write only
-	imagePath := filepath.Join(imagesDir, fmt.Sprintf("%d.png", messageID))
+	imagePath := filepath.Join(imagesDir, imageFilename(messageID, alternate, format))
 	tempPath := imagePath + ".tmp"
 
-	if err := os.WriteFile(tempPath, pngData, 0600); err != nil {
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write image file: %w", err)
 	}
 
@@ -75,11 +185,29 @@ func (s *ImageStore) Save(sessionID string, messageID int, pngData []byte) error
 		_ = os.Remove(tempPath)
 		return fmt.Errorf("failed to commit image file: %w", err)
 	}
+	s.hashes.remember(imagePath, data)
+
+	// A copy saved before the format changed would shadow or outlive this one
+	for _, other := range storedFormats {
+		if other == format {
+			continue
+		}
+		if err := os.Remove(filepath.Join(imagesDir, imageFilename(messageID, alternate, other))); err == nil {
+			s.invalidateUsage()
+		}
+	}
+
+	if s.index != nil {
+		if err := s.index.RecordImage(sessionID, messageID, alternate, int64(len(data))); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: failed to index image %s for session %s: %v\n", imageFilename(messageID, alternate, format), sessionID, err)
+		}
+	}
 
 	return nil
 }
 
-// Load reads an image from disk and returns the PNG data.
+// Load reads an image from disk and returns the PNG data, converted from
+// the format it is stored in.
 // Returns os.ErrNotExist if the image doesn't exist.
 func (s *ImageStore) Load(sessionID string, messageID int) ([]byte, error) {
 	if err := validateSessionID(sessionID); err != nil {
@@ -89,7 +217,28 @@ func (s *ImageStore) Load(sessionID string, messageID int) ([]byte, error) {
 		return nil, fmt.Errorf("message ID must be positive")
 	}
 
-	imagePath := filepath.Join(s.basePath, sessionID, "images", fmt.Sprintf("%d.png", messageID))
+	return s.load(sessionID, messageID, 0)
+}
+
+// LoadAlternate reads an alternate image for a message.
+// Returns os.ErrNotExist if the alternate doesn't exist.
+func (s *ImageStore) LoadAlternate(sessionID string, messageID int, alternate int) ([]byte, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+	if messageID <= 0 || alternate <= 0 {
+		return nil, fmt.Errorf("message ID and alternate must be positive")
+	}
+
+	return s.load(sessionID, messageID, alternate)
+}
+
+// load reads a primary (alternate 0) or alternate image as PNG.
+func (s *ImageStore) load(sessionID string, messageID int, alternate int) ([]byte, error) {
+	imagePath, err := s.find(sessionID, messageID, alternate)
+	if err != nil {
+		return nil, err
+	}
 
 	// Read the file
 	data, err := os.ReadFile(imagePath)
@@ -98,9 +247,70 @@ func (s *ImageStore) Load(sessionID string, messageID int) ([]byte, error) {
 		return nil, err
 	}
 
+	if filepath.Ext(imagePath) != image.OutputPNG.Extension() {
+		if data, err = image.Convert(data, image.OutputPNG, 0); err != nil {
+			return nil, fmt.Errorf("failed to convert image to png: %w", err)
+		}
+	}
 	return data, nil
 }
 
+// find returns the path of a primary (alternate 0) or alternate image in
+// whichever format it is stored in.
+// Returns os.ErrNotExist if the image doesn't exist.
+func (s *ImageStore) find(sessionID string, messageID int, alternate int) (string, error) {
+	imagesDir := filepath.Join(s.basePath, sessionID, "images")
+	for _, format := range storedFormats {
+		imagePath := filepath.Join(imagesDir, imageFilename(messageID, alternate, format))
+		_, err := os.Stat(imagePath)
+		if err == nil {
+			return imagePath, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", os.ErrNotExist
+}
+
+// Open opens an image for streaming, so large images don't have to be read
+// into memory. The file is in the format the image is stored in, which
+// StoredFormat tells from its name. The caller must close the file.
+// Returns os.ErrNotExist if the image doesn't exist.
+func (s *ImageStore) Open(sessionID string, messageID int) (*os.File, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+	if messageID <= 0 {
+		return nil, fmt.Errorf("message ID must be positive")
+	}
+
+	return s.open(sessionID, messageID, 0)
+}
+
+// OpenAlternate opens an alternate image for streaming. The caller must
+// close the file.
+// Returns os.ErrNotExist if the alternate doesn't exist.
+func (s *ImageStore) OpenAlternate(sessionID string, messageID int, alternate int) (*os.File, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+	if messageID <= 0 || alternate <= 0 {
+		return nil, fmt.Errorf("message ID and alternate must be positive")
+	}
+
+	return s.open(sessionID, messageID, alternate)
+}
+
+// open opens a primary (alternate 0) or alternate image.
+func (s *ImageStore) open(sessionID string, messageID int, alternate int) (*os.File, error) {
+	imagePath, err := s.find(sessionID, messageID, alternate)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(imagePath)
+}
+
 // Exists checks if an image exists on disk.
 // Returns true if the image file exists.
 func (s *ImageStore) Exists(sessionID string, messageID int) bool {
@@ -111,11 +321,30 @@ func (s *ImageStore) Exists(sessionID string, messageID int) bool {
 		return false
 	}
 
-	imagePath := filepath.Join(s.basePath, sessionID, "images", fmt.Sprintf("%d.png", messageID))
-	_, err := os.Stat(imagePath)
+	_, err := s.find(sessionID, messageID, 0)
 	return err == nil
 }
 
+// Count returns the number of images stored for a session, alternates
+// included. Returns 0 if the session has none or the ID is invalid.
+func (s *ImageStore) Count(sessionID string) int {
+	if err := validateSessionID(sessionID); err != nil {
+		return 0
+	}
+
+	entries, err := os.ReadDir(filepath.Join(s.basePath, sessionID, "images"))
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, entry := range entries {
+		if _, _, ok := ParseImageFilename(entry.Name()); ok && entry.Type().IsRegular() {
+			count++
+		}
+	}
+	return count
+}
+
 // Delete removes an image from disk.
 // Returns nil if the image was deleted or didn't exist.
 // Returns an error only if deletion fails for a file that exists.
@@ -127,20 +356,218 @@ func (s *ImageStore) Delete(sessionID string, messageID int) error {
 		return fmt.Errorf("message ID must be positive")
 	}
 
-	imagePath := filepath.Join(s.basePath, sessionID, "images", fmt.Sprintf("%d.png", messageID))
+	// Remove the file, in whichever format it is stored in
+	for _, format := range storedFormats {
+		imagePath := filepath.Join(s.basePath, sessionID, "images", imageFilename(messageID, 0, format))
+		err := os.Remove(imagePath)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete image: %w", err)
+		}
+	}
+	s.invalidateUsage()
+
+	if s.index != nil {
+		if err := s.index.RemoveImage(sessionID, messageID, 0); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: failed to unindex image %d for session %s: %v\n", messageID, sessionID, err)
+		}
+	}
+
+	return nil
+}
 
-	// Remove the file
-	err := os.Remove(imagePath)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete image: %w", err)
+// DeleteAll removes a message's primary image and all of its alternates.
+// Returns nil if the message has no images.
+func (s *ImageStore) DeleteAll(sessionID string, messageID int) error {
+	if err := s.Delete(sessionID, messageID); err != nil {
+		return err
+	}
+
+	pattern := filepath.Join(s.basePath, sessionID, "images", fmt.Sprintf("%d-*", messageID))
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("failed to list alternates: %w", err)
+	}
+	for _, path := range matches {
+		if id, _, ok := ParseImageFilename(filepath.Base(path)); !ok || id != messageID {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete alternate: %w", err)
+		}
+	}
+	s.invalidateUsage()
+
+	if s.index != nil {
+		if err := s.index.RemoveImages(sessionID, messageID); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: failed to unindex images of message %d for session %s: %v\n", messageID, sessionID, err)
+		}
 	}
 
 	return nil
 }
 
+// ReclaimedImages counts the images removed from a session's images
+// directory by DeleteSession or ArchiveSession.
+type ReclaimedImages struct {
+	Files int
+	Bytes int64
+}
+
+// DeleteSession removes all of a session's images, alternates included.
+// Returns what was removed, which is nothing if the session has no images.
+func (s *ImageStore) DeleteSession(sessionID string) (ReclaimedImages, error) {
+	return s.removeSession(sessionID, func(path, name string) error {
+		return os.Remove(path)
+	})
+}
+
+// ArchiveSession moves all of a session's images to
+// {archivePath}/{sessionID}/images, replacing archived images of the same
+// name. archivePath must be on the same filesystem as the store. Returns
+// what was moved, which is nothing if the session has no images.
+func (s *ImageStore) ArchiveSession(sessionID, archivePath string) (ReclaimedImages, error) {
+	dir := filepath.Join(archivePath, sessionID, "images")
+	created := false
+	return s.removeSession(sessionID, func(path, name string) error {
+		if !created {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				return err
+			}
+			created = true
+		}
+		return os.Rename(path, filepath.Join(dir, name))
+	})
+}
+
+// removeSession calls remove for each image of a session and removes the
+// images directory once it is empty. Images that were removed are
+// unindexed even if a later one fails.
+func (s *ImageStore) removeSession(sessionID string, remove func(path, name string) error) (ReclaimedImages, error) {
+	var reclaimed ReclaimedImages
+	if err := validateSessionID(sessionID); err != nil {
+		return reclaimed, fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	imagesDir := filepath.Join(s.basePath, sessionID, "images")
+	entries, err := os.ReadDir(imagesDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return reclaimed, nil
+	}
+	if err != nil {
+		return reclaimed, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	for _, entry := range entries {
+		messageID, alternate, ok := ParseImageFilename(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return reclaimed, fmt.Errorf("failed to stat image: %w", err)
+		}
+		if err := remove(filepath.Join(imagesDir, entry.Name()), entry.Name()); err != nil {
+			return reclaimed, fmt.Errorf("failed to remove image %s: %w", entry.Name(), err)
+		}
+		reclaimed.Files++
+		reclaimed.Bytes += info.Size()
+
+		if s.index != nil {
+			if err := s.index.RemoveImage(sessionID, messageID, alternate); err != nil {
+				fmt.Fprintf(os.Stderr, "WARNING: failed to unindex image %s for session %s: %v\n", entry.Name(), sessionID, err)
+			}
+		}
+	}
+
+	// Leftover temporary files keep the directory; they are harmless
+	_ = os.Remove(imagesDir)
+	s.invalidateUsage()
+	return reclaimed, nil
+}
+
 // GetURL returns the URL path for an image.
 // The path is relative and suitable for HTTP serving:
 // /sessions/{sessionID}/images/{messageID}.png
 func (s *ImageStore) GetURL(sessionID string, messageID int) string {
 	return fmt.Sprintf("/sessions/%s/images/%d.png", sessionID, messageID)
 }
+
+// GetPath returns the filesystem path for an image:
+// {basePath}/{sessionID}/images/{messageID}.png
+// The extension is that of the format the image is stored in.
+func (s *ImageStore) GetPath(sessionID string, messageID int) string {
+	return s.path(sessionID, messageID, 0)
+}
+
+// GetAlternateURL returns the URL path for an alternate image:
+// /sessions/{sessionID}/images/{messageID}-{alternate}.png
+func (s *ImageStore) GetAlternateURL(sessionID string, messageID int, alternate int) string {
+	return fmt.Sprintf("/sessions/%s/images/%s", sessionID, imageFilename(messageID, alternate, image.OutputPNG))
+}
+
+// GetAlternatePath returns the filesystem path for an alternate image:
+// {basePath}/{sessionID}/images/{messageID}-{alternate}.png
+// The extension is that of the format the image is stored in.
+func (s *ImageStore) GetAlternatePath(sessionID string, messageID int, alternate int) string {
+	return s.path(sessionID, messageID, alternate)
+}
+
+// path returns the path of a primary (alternate 0) or alternate image, or
+// where it would be saved if it doesn't exist.
+func (s *ImageStore) path(sessionID string, messageID int, alternate int) string {
+	if imagePath, err := s.find(sessionID, messageID, alternate); err == nil {
+		return imagePath
+	}
+	format, _ := s.StorageFormat()
+	return filepath.Join(s.basePath, sessionID, "images", imageFilename(messageID, alternate, format))
+}
+
+// storedFormats are the formats images can be stored in, most common first.
+var storedFormats = []image.OutputFormat{image.OutputPNG, image.OutputWebP, image.OutputJPEG}
+
+// imageFilename returns the file name for a message's primary image
+// (alternate 0) or one of its alternates stored in format.
+func imageFilename(messageID int, alternate int, format image.OutputFormat) string {
+	if alternate == 0 {
+		return fmt.Sprintf("%d%s", messageID, format.Extension())
+	}
+	return fmt.Sprintf("%d-%d%s", messageID, alternate, format.Extension())
+}
+
+// StoredFormat returns the format of an image file from its name, which
+// is PNG unless it ends in .webp or .jpg.
+func StoredFormat(name string) image.OutputFormat {
+	for _, format := range storedFormats {
+		if strings.HasSuffix(name, format.Extension()) {
+			return format
+		}
+	}
+	return image.OutputPNG
+}
+
+// ParseImageFilename parses the name of an image file:
+// {messageID}.png or {messageID}-{alternate}.png, or the same with the
+// extension of another stored format.
+func ParseImageFilename(name string) (messageID, alternate int, ok bool) {
+	var base string
+	found := false
+	for _, format := range storedFormats {
+		if base, found = strings.CutSuffix(name, format.Extension()); found {
+			break
+		}
+	}
+	if !found {
+		return 0, 0, false
+	}
+	id, alt, hasAlternate := strings.Cut(base, "-")
+	messageID, err := strconv.Atoi(id)
+	if err != nil || messageID <= 0 {
+		return 0, 0, false
+	}
+	if hasAlternate {
+		if alternate, err = strconv.Atoi(alt); err != nil || alternate <= 0 {
+			return 0, 0, false
+		}
+	}
+	return messageID, alternate, true
+}
@@ -3,9 +3,14 @@ package persistence
 import (
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/hurricanerix/weave/internal/image"
 )
 
 // createTestSessionID creates a valid test session ID.
@@ -258,6 +263,88 @@ func TestImageStore_Load_ReturnsNotExist(t *testing.T) {
 	}
 }
 
+func TestImageStore_Open(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(31)
+	if err := store.Save(sessionID, 1, []byte("primary")); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if err := store.SaveAlternate(sessionID, 1, 2, []byte("alternate")); err != nil {
+		t.Fatalf("SaveAlternate() failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		open      func() (*os.File, error)
+		want      string
+		wantErr   bool
+		notExists bool
+	}{
+		{"primary", func() (*os.File, error) { return store.Open(sessionID, 1) }, "primary", false, false},
+		{"alternate", func() (*os.File, error) { return store.OpenAlternate(sessionID, 1, 2) }, "alternate", false, false},
+		{"missing", func() (*os.File, error) { return store.Open(sessionID, 2) }, "", true, true},
+		{"missing alternate", func() (*os.File, error) { return store.OpenAlternate(sessionID, 1, 3) }, "", true, true},
+		{"invalid session", func() (*os.File, error) { return store.Open("../escape", 1) }, "", true, false},
+		{"invalid message", func() (*os.File, error) { return store.Open(sessionID, 0) }, "", true, false},
+		{"invalid alternate", func() (*os.File, error) { return store.OpenAlternate(sessionID, 1, 0) }, "", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := tt.open()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if tt.notExists && !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("Open() error = %v, want os.ErrNotExist", err)
+				}
+				return
+			}
+			defer f.Close()
+
+			data, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Open() content = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageStore_Count(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(90)
+
+	if n := store.Count(sessionID); n != 0 {
+		t.Errorf("Count() of a session without images = %d, want 0", n)
+	}
+
+	pngData := createTestPNGData(100)
+	if err := store.Save(sessionID, 1, pngData); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.SaveAlternate(sessionID, 1, 1, pngData); err != nil {
+		t.Fatalf("SaveAlternate() error = %v", err)
+	}
+	if err := store.Save(sessionID, 3, pngData); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	// Leftover temp files are not images
+	if err := os.WriteFile(store.GetPath(sessionID, 4)+".tmp", pngData, 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if n := store.Count(sessionID); n != 3 {
+		t.Errorf("Count() = %d, want 3", n)
+	}
+	if n := store.Count("../escape"); n != 0 {
+		t.Errorf("Count() of an invalid session ID = %d, want 0", n)
+	}
+}
+
 func TestImageStore_Exists(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -480,6 +567,26 @@ func TestImageStore_GetURL(t *testing.T) {
 	}
 }
 
+func TestImageStore_GetPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := NewImageStore(tmpDir)
+	sessionID := createTestSessionID(13)
+
+	got := store.GetPath(sessionID, 7)
+	want := filepath.Join(tmpDir, sessionID, "images", "7.png")
+	if got != want {
+		t.Errorf("GetPath() = %q, want %q", got, want)
+	}
+
+	// The path must point at the file written by Save
+	if err := store.Save(sessionID, 7, createTestPNGData(64)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := os.Stat(got); err != nil {
+		t.Errorf("Stat(GetPath()) error = %v", err)
+	}
+}
+
 func TestImageStore_SaveLoad_RoundTrip(t *testing.T) {
 	tmpDir := t.TempDir()
 	store := NewImageStore(tmpDir)
@@ -624,3 +731,294 @@ func TestImageStore_MultipleImages(t *testing.T) {
 		}
 	}
 }
+
+func TestImageStore_Alternates(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(50)
+
+	primary := createTestPNGData(16)
+	alternate := createTestPNGData(32)
+
+	if err := store.Save(sessionID, 7, primary); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.SaveAlternate(sessionID, 7, 1, alternate); err != nil {
+		t.Fatalf("SaveAlternate() error = %v", err)
+	}
+
+	got, err := store.LoadAlternate(sessionID, 7, 1)
+	if err != nil || len(got) != len(alternate) {
+		t.Errorf("LoadAlternate() = %d bytes, %v, want %d bytes", len(got), err, len(alternate))
+	}
+	got, err = store.Load(sessionID, 7)
+	if err != nil || len(got) != len(primary) {
+		t.Errorf("Load() = %d bytes, %v, want primary untouched", len(got), err)
+	}
+
+	if _, err := store.LoadAlternate(sessionID, 7, 2); !os.IsNotExist(err) {
+		t.Errorf("LoadAlternate() of missing alternate error = %v, want not exist", err)
+	}
+
+	wantURL := "/sessions/" + sessionID + "/images/7-1.png"
+	if url := store.GetAlternateURL(sessionID, 7, 1); url != wantURL {
+		t.Errorf("GetAlternateURL() = %q, want %q", url, wantURL)
+	}
+	if _, err := os.Stat(store.GetAlternatePath(sessionID, 7, 1)); err != nil {
+		t.Errorf("GetAlternatePath() does not point at the saved file: %v", err)
+	}
+}
+
+func TestImageStore_AlternatesInvalid(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(51)
+	data := createTestPNGData(16)
+
+	tests := []struct {
+		name      string
+		sessionID string
+		messageID int
+		alternate int
+	}{
+		{name: "zero alternate", sessionID: sessionID, messageID: 1, alternate: 0},
+		{name: "negative alternate", sessionID: sessionID, messageID: 1, alternate: -1},
+		{name: "zero message ID", sessionID: sessionID, messageID: 0, alternate: 1},
+		{name: "invalid session ID", sessionID: "../etc", messageID: 1, alternate: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.SaveAlternate(tt.sessionID, tt.messageID, tt.alternate, data); err == nil {
+				t.Error("SaveAlternate() error = nil, want error")
+			}
+			if _, err := store.LoadAlternate(tt.sessionID, tt.messageID, tt.alternate); err == nil {
+				t.Error("LoadAlternate() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestImageStore_DeleteAll(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(52)
+	data := createTestPNGData(16)
+
+	if err := store.Save(sessionID, 7, data); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	for alternate := 1; alternate <= 2; alternate++ {
+		if err := store.SaveAlternate(sessionID, 7, alternate, data); err != nil {
+			t.Fatalf("SaveAlternate() error = %v", err)
+		}
+	}
+	// Message 70's alternates share the "7" prefix but must survive
+	if err := store.SaveAlternate(sessionID, 70, 1, data); err != nil {
+		t.Fatalf("SaveAlternate() error = %v", err)
+	}
+
+	if err := store.DeleteAll(sessionID, 7); err != nil {
+		t.Fatalf("DeleteAll() error = %v", err)
+	}
+	if store.Exists(sessionID, 7) {
+		t.Error("primary image still exists after DeleteAll()")
+	}
+	for alternate := 1; alternate <= 2; alternate++ {
+		if _, err := store.LoadAlternate(sessionID, 7, alternate); !os.IsNotExist(err) {
+			t.Errorf("alternate %d error = %v, want not exist", alternate, err)
+		}
+	}
+	if _, err := store.LoadAlternate(sessionID, 70, 1); err != nil {
+		t.Errorf("DeleteAll() removed another message's alternate: %v", err)
+	}
+
+	// Nothing left to delete is not an error
+	if err := store.DeleteAll(sessionID, 7); err != nil {
+		t.Errorf("DeleteAll() of deleted message error = %v", err)
+	}
+	if err := store.DeleteAll("../etc", 7); err == nil {
+		t.Error("DeleteAll() with invalid session ID error = nil, want error")
+	}
+}
+
+// saveSessionImages saves a primary image, an alternate and a leftover
+// temporary file for a session.
+func saveSessionImages(t *testing.T, store *ImageStore, sessionID string) {
+	t.Helper()
+
+	pngData := createTestPNGData(100)
+	if err := store.Save(sessionID, 1, pngData); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.SaveAlternate(sessionID, 1, 2, pngData); err != nil {
+		t.Fatalf("SaveAlternate() error = %v", err)
+	}
+	if err := os.WriteFile(store.GetPath(sessionID, 3)+".tmp", pngData, 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
+
+func TestImageStore_DeleteSession(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(91)
+	saveSessionImages(t, store, sessionID)
+
+	reclaimed, err := store.DeleteSession(sessionID)
+	if err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+	if want := (ReclaimedImages{Files: 2, Bytes: 200}); reclaimed != want {
+		t.Errorf("DeleteSession() = %+v, want %+v", reclaimed, want)
+	}
+	if n := store.Count(sessionID); n != 0 {
+		t.Errorf("Count() after DeleteSession() = %d, want 0", n)
+	}
+
+	// A session without images has nothing to reclaim
+	if reclaimed, err := store.DeleteSession(createTestSessionID(92)); err != nil || reclaimed.Files != 0 {
+		t.Errorf("DeleteSession() of a session without images = %+v, %v, want nothing", reclaimed, err)
+	}
+	if _, err := store.DeleteSession("../escape"); err == nil {
+		t.Error("DeleteSession() of an invalid session ID succeeded, want error")
+	}
+}
+
+func TestImageStore_ArchiveSession(t *testing.T) {
+	store := NewImageStore(filepath.Join(t.TempDir(), "sessions"))
+	archive := filepath.Join(t.TempDir(), "archive")
+	sessionID := createTestSessionID(93)
+	saveSessionImages(t, store, sessionID)
+
+	reclaimed, err := store.ArchiveSession(sessionID, archive)
+	if err != nil {
+		t.Fatalf("ArchiveSession() error = %v", err)
+	}
+	if reclaimed.Files != 2 {
+		t.Errorf("ArchiveSession() moved %d files, want 2", reclaimed.Files)
+	}
+	if n := store.Count(sessionID); n != 0 {
+		t.Errorf("Count() after ArchiveSession() = %d, want 0", n)
+	}
+	if n := NewImageStore(archive).Count(sessionID); n != 2 {
+		t.Errorf("archived images = %d, want 2", n)
+	}
+
+	// Archiving again replaces archived images of the same name
+	saveSessionImages(t, store, sessionID)
+	if _, err := store.ArchiveSession(sessionID, archive); err != nil {
+		t.Fatalf("second ArchiveSession() error = %v", err)
+	}
+	if n := NewImageStore(archive).Count(sessionID); n != 2 {
+		t.Errorf("archived images after archiving again = %d, want 2", n)
+	}
+}
+
+func TestParseImageFilename(t *testing.T) {
+	tests := []struct {
+		name          string
+		wantMessageID int
+		wantAlternate int
+		wantOK        bool
+	}{
+		{"12.png", 12, 0, true},
+		{"12-3.png", 12, 3, true},
+		{"12.png.tmp", 0, 0, false},
+		{"0.png", 0, 0, false},
+		{"12-0.png", 0, 0, false},
+		{"a.png", 0, 0, false},
+		{"12-b.png", 0, 0, false},
+		{"12.webp", 12, 0, true},
+		{"12-3.jpg", 12, 3, true},
+		{"12.gif", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messageID, alternate, ok := ParseImageFilename(tt.name)
+			if messageID != tt.wantMessageID || alternate != tt.wantAlternate || ok != tt.wantOK {
+				t.Errorf("ParseImageFilename(%q) = %d, %d, %v, want %d, %d, %v", tt.name,
+					messageID, alternate, ok, tt.wantMessageID, tt.wantAlternate, tt.wantOK)
+			}
+		})
+	}
+}
+
+// noisePNG returns a PNG of smooth noise, which compresses about as poorly
+// as a photograph.
+func noisePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	rng := rand.New(rand.NewSource(1))
+	pixels := make([]byte, width*height*3)
+	for i := range pixels {
+		pixels[i] = byte(i/3%width + rng.Intn(32))
+	}
+	data, err := image.EncodePNG(width, height, pixels, image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	return data
+}
+
+func TestImageStore_StorageFormat(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(60)
+	pngData := noisePNG(t, 64, 64)
+
+	store.SetStorageFormat(image.OutputWebP, 80)
+	if err := store.Save(sessionID, 1, pngData); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.SaveAlternate(sessionID, 1, 1, pngData); err != nil {
+		t.Fatalf("SaveAlternate() error = %v", err)
+	}
+
+	path := store.GetPath(sessionID, 1)
+	if !strings.HasSuffix(path, "1.webp") {
+		t.Fatalf("GetPath() = %q, want a .webp file", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stored image missing: %v", err)
+	}
+	if info.Size() >= int64(len(pngData)) {
+		t.Errorf("stored WebP is %d bytes, want smaller than the %d byte PNG", info.Size(), len(pngData))
+	}
+	if !store.Exists(sessionID, 1) || store.Count(sessionID) != 2 {
+		t.Errorf("Exists() = %v, Count() = %d, want true, 2", store.Exists(sessionID, 1), store.Count(sessionID))
+	}
+
+	// Callers still get PNG
+	got, err := store.LoadAlternate(sessionID, 1, 1)
+	if err != nil {
+		t.Fatalf("LoadAlternate() error = %v", err)
+	}
+	if format, err := image.DetectFormat(got); err != nil || format != image.OutputPNG {
+		t.Errorf("LoadAlternate() format = %q, %v, want png", format, err)
+	}
+	file, err := store.Open(sessionID, 1)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if format := StoredFormat(file.Name()); format != image.OutputWebP {
+		t.Errorf("StoredFormat() of opened file = %q, want webp", format)
+	}
+	file.Close()
+
+	// Saving again in another format replaces the WebP
+	store.SetStorageFormat(image.OutputPNG, 0)
+	if err := store.Save(sessionID, 1, pngData); err != nil {
+		t.Fatalf("Save() as PNG error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("WebP left behind after saving as PNG: %v", err)
+	}
+	if got, err := store.Load(sessionID, 1); err != nil || len(got) != len(pngData) {
+		t.Errorf("Load() = %d bytes, %v, want the PNG", len(got), err)
+	}
+
+	if err := store.DeleteAll(sessionID, 1); err != nil {
+		t.Fatalf("DeleteAll() error = %v", err)
+	}
+	if n := store.Count(sessionID); n != 0 {
+		t.Errorf("Count() after DeleteAll = %d, want 0", n)
+	}
+}
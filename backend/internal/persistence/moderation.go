@@ -0,0 +1,141 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// moderationFileName is the name of a session's moderation audit within its directory
+	moderationFileName = "moderation.json"
+
+	// MaxModerationEntriesPerSession limits the audit entries kept per
+	// session. The oldest entries are dropped first.
+	MaxModerationEntriesPerSession = 1000
+)
+
+// Actions taken on a flagged prompt.
+const (
+	// ModerationBlocked means the prompt was not generated
+	ModerationBlocked = "blocked"
+	// ModerationWarned means the prompt was generated with a warning
+	ModerationWarned = "warned"
+)
+
+// ModerationEntry records a prompt flagged by content moderation.
+type ModerationEntry struct {
+	Time time.Time `json:"time"`
+	// MessageID is the message the image was for, 0 if none
+	MessageID int    `json:"message_id,omitempty"`
+	Prompt    string `json:"prompt"`
+	Reason    string `json:"reason"`
+	Action    string `json:"action"`
+}
+
+// ModerationLog keeps an audit of each session's flagged prompts, so
+// operators of shared deployments can review what was blocked. Entries are
+// stored next to the session's images so they are removed with the
+// session.
+//
+// Storage structure:
+//
+//	config/sessions/{session_id}/moderation.json
+//
+// With SetEncryptor, the audit is encrypted at rest like the session's
+// conversations.
+type ModerationLog struct {
+	mu        sync.Mutex
+	basePath  string
+	encryptor *Encryptor // Encrypts the audit at rest; nil writes plaintext
+}
+
+// NewModerationLog creates a moderation log rooted at the specified base
+// path. The base path is typically "config/sessions".
+func NewModerationLog(basePath string) *ModerationLog {
+	return &ModerationLog{
+		basePath: basePath,
+	}
+}
+
+// SetEncryptor enables encryption at rest. It must be called before the
+// log is used.
+func (m *ModerationLog) SetEncryptor(e *Encryptor) {
+	m.encryptor = e
+}
+
+// Record appends an entry to a session's audit.
+func (m *ModerationLog) Record(sessionID string, entry ModerationEntry) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries, err := m.loadLocked(sessionID)
+	if err != nil {
+		return err
+	}
+	entries = append(entries, entry)
+	if len(entries) > MaxModerationEntriesPerSession {
+		entries = entries[len(entries)-MaxModerationEntriesPerSession:]
+	}
+	return m.saveLocked(sessionID, entries)
+}
+
+// List returns a session's audit, oldest first.
+// Returns an empty slice if nothing was flagged.
+func (m *ModerationLog) List(sessionID string) ([]ModerationEntry, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.loadLocked(sessionID)
+}
+
+// loadLocked reads a session's audit. A missing file is treated as empty.
+// Must be called with m.mu held.
+func (m *ModerationLog) loadLocked(sessionID string) ([]ModerationEntry, error) {
+	data, err := readSealed(m.encryptor, m.path(sessionID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ModerationEntry{}, nil
+		}
+		return nil, fmt.Errorf("failed to read moderation log: %w", err)
+	}
+
+	var entries []ModerationEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse moderation log: %w", err)
+	}
+	return entries, nil
+}
+
+// saveLocked writes a session's audit atomically.
+// Must be called with m.mu held.
+func (m *ModerationLog) saveLocked(sessionID string, entries []ModerationEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize moderation log: %w", err)
+	}
+
+	path := m.path(sessionID)
+
+	// 0700: owner-only access
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+	return writeSealed(m.encryptor, path, data)
+}
+
+// path returns the moderation log file for a session.
+func (m *ModerationLog) path(sessionID string) string {
+	return filepath.Join(m.basePath, sessionID, moderationFileName)
+}
@@ -0,0 +1,110 @@
+package persistence
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestModerationLog_RecordList(t *testing.T) {
+	tmpDir := t.TempDir()
+	log := NewModerationLog(tmpDir)
+	sessionID := createTestSessionID(70)
+
+	entries, err := log.List(sessionID)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("List() of empty log = %v, %v, want empty", entries, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := log.Record(sessionID, ModerationEntry{Time: now, MessageID: 3, Prompt: "gore", Reason: `matched keyword "gore"`, Action: ModerationBlocked}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if err := log.Record(sessionID, ModerationEntry{Time: now, Prompt: "a duel", Reason: "classified unsafe: violence", Action: ModerationWarned}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	// A new log on the same path sees the persisted entries
+	entries, err = NewModerationLog(tmpDir).List(sessionID)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("List() length = %d, want 2", len(entries))
+	}
+	if entries[0].MessageID != 3 || entries[0].Action != ModerationBlocked || !entries[0].Time.Equal(now) {
+		t.Errorf("List()[0] = %+v, want the blocked entry first", entries[0])
+	}
+	if entries[1].Action != ModerationWarned {
+		t.Errorf("List()[1].Action = %q, want %q", entries[1].Action, ModerationWarned)
+	}
+
+	// Sessions don't see each other's entries
+	other, err := log.List(createTestSessionID(71))
+	if err != nil || len(other) != 0 {
+		t.Errorf("List() of other session = %v, %v, want empty", other, err)
+	}
+}
+
+func TestModerationLog_Encrypted(t *testing.T) {
+	tmpDir := t.TempDir()
+	enc, _ := NewEncryptor(bytes.Repeat([]byte{7}, keySize))
+	log := NewModerationLog(tmpDir)
+	log.SetEncryptor(enc)
+	sessionID := createTestSessionID(72)
+
+	if err := log.Record(sessionID, ModerationEntry{Prompt: "a secret garden", Reason: "matched keyword", Action: ModerationBlocked}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	data, err := os.ReadFile(log.path(sessionID))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !IsEncrypted(data) || bytes.Contains(data, []byte("secret garden")) {
+		t.Error("moderation log was written in plaintext")
+	}
+
+	entries, err := log.List(sessionID)
+	if err != nil || len(entries) != 1 || entries[0].Prompt != "a secret garden" {
+		t.Errorf("List() = %v, %v, want the decrypted entry", entries, err)
+	}
+	if _, err := NewModerationLog(tmpDir).List(sessionID); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("List() without a key error = %v, want ErrEncrypted", err)
+	}
+}
+
+func TestModerationLog_Cap(t *testing.T) {
+	log := NewModerationLog(t.TempDir())
+	sessionID := createTestSessionID(72)
+
+	for i := 0; i < MaxModerationEntriesPerSession+2; i++ {
+		if err := log.Record(sessionID, ModerationEntry{Prompt: fmt.Sprintf("prompt %d", i), Action: ModerationBlocked}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	entries, err := log.List(sessionID)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != MaxModerationEntriesPerSession {
+		t.Fatalf("List() length = %d, want %d", len(entries), MaxModerationEntriesPerSession)
+	}
+	if entries[0].Prompt != "prompt 2" {
+		t.Errorf("oldest entry = %q, want %q", entries[0].Prompt, "prompt 2")
+	}
+}
+
+func TestModerationLog_InvalidSessionID(t *testing.T) {
+	log := NewModerationLog(t.TempDir())
+	if err := log.Record("../escape", ModerationEntry{}); err == nil {
+		t.Error("Record() error = nil, want error for invalid session ID")
+	}
+	if _, err := log.List("../escape"); err == nil {
+		t.Error("List() error = nil, want error for invalid session ID")
+	}
+}
@@ -0,0 +1,205 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hurricanerix/weave/internal/timestamp"
+)
+
+const (
+	// promptsFileName is the name of a session's saved prompts file within its directory
+	promptsFileName = "prompts.json"
+
+	// MaxSavedPromptsPerSession limits the number of saved prompts per session.
+	MaxSavedPromptsPerSession = 500
+
+	// MaxPromptNameLength is the maximum saved prompt name length in characters.
+	MaxPromptNameLength = 100
+)
+
+var (
+	// ErrPromptLibraryFull is returned when saving would exceed MaxSavedPromptsPerSession
+	ErrPromptLibraryFull = errors.New("too many saved prompts")
+
+	// ErrInvalidPromptName is returned for empty or overly long prompt names
+	ErrInvalidPromptName = errors.New("invalid prompt name")
+)
+
+// SavedPrompt is a prompt a session saved under a name for reuse.
+type SavedPrompt struct {
+	Name    string    `json:"name"`
+	Prompt  string    `json:"prompt"`
+	SavedAt time.Time `json:"saved_at"`
+	Seq     int64     `json:"seq"`
+}
+
+// PromptStore manages the prompt library of each session. Signed-in users
+// always get the same session, so their library follows them. Prompts are
+// stored next to the session's images so they are removed with the session.
+//
+// Storage structure:
+//
+//	config/sessions/{session_id}/prompts.json
+//
+// With SetEncryptor, saved prompts are encrypted at rest like the session's
+// conversations.
+type PromptStore struct {
+	mu        sync.Mutex
+	basePath  string
+	encryptor *Encryptor // Encrypts saved prompts at rest; nil writes plaintext
+}
+
+// NewPromptStore creates a prompt store rooted at the specified base path.
+// The base path is typically "config/sessions".
+func NewPromptStore(basePath string) *PromptStore {
+	return &PromptStore{
+		basePath: basePath,
+	}
+}
+
+// SetEncryptor enables encryption at rest. It must be called before the
+// store is used.
+func (p *PromptStore) SetEncryptor(e *Encryptor) {
+	p.encryptor = e
+}
+
+// Save stores prompt under name, replacing a prompt saved under the same
+// name. Names are trimmed and compared case-insensitively.
+func (p *PromptStore) Save(sessionID, name, prompt string) (SavedPrompt, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return SavedPrompt{}, fmt.Errorf("invalid session ID: %w", err)
+	}
+	name = strings.TrimSpace(name)
+	if err := validatePromptName(name); err != nil {
+		return SavedPrompt{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	prompts, err := p.loadLocked(sessionID)
+	if err != nil {
+		return SavedPrompt{}, err
+	}
+
+	savedAt, seq := timestamp.Next()
+	saved := SavedPrompt{Name: name, Prompt: prompt, SavedAt: savedAt, Seq: seq}
+
+	kept := make([]SavedPrompt, 0, len(prompts)+1)
+	for _, existing := range prompts {
+		if !strings.EqualFold(existing.Name, name) {
+			kept = append(kept, existing)
+		}
+	}
+	if len(kept) >= MaxSavedPromptsPerSession {
+		return SavedPrompt{}, ErrPromptLibraryFull
+	}
+	kept = append(kept, saved)
+
+	if err := p.saveLocked(sessionID, kept); err != nil {
+		return SavedPrompt{}, err
+	}
+	return saved, nil
+}
+
+// Get returns the prompt saved under name.
+// Returns false if there is none.
+func (p *PromptStore) Get(sessionID, name string) (SavedPrompt, bool, error) {
+	prompts, err := p.List(sessionID)
+	if err != nil {
+		return SavedPrompt{}, false, err
+	}
+	name = strings.TrimSpace(name)
+	for _, saved := range prompts {
+		if strings.EqualFold(saved.Name, name) {
+			return saved, true, nil
+		}
+	}
+	return SavedPrompt{}, false, nil
+}
+
+// List returns a session's saved prompts, most recently saved first.
+// Returns an empty slice if the session has none.
+func (p *PromptStore) List(sessionID string) ([]SavedPrompt, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	prompts, err := p.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(prompts, func(i, j int) bool {
+		return prompts[i].Seq > prompts[j].Seq
+	})
+	return prompts, nil
+}
+
+// validatePromptName checks a trimmed prompt name.
+func validatePromptName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name cannot be empty", ErrInvalidPromptName)
+	}
+	if utf8.RuneCountInString(name) > MaxPromptNameLength {
+		return fmt.Errorf("%w: name exceeds %d characters", ErrInvalidPromptName, MaxPromptNameLength)
+	}
+	return nil
+}
+
+// loadLocked reads a session's saved prompts from disk.
+// A missing file is treated as no saved prompts.
+// Must be called with p.mu held.
+func (p *PromptStore) loadLocked(sessionID string) ([]SavedPrompt, error) {
+	data, err := readSealed(p.encryptor, p.path(sessionID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []SavedPrompt{}, nil
+		}
+		return nil, fmt.Errorf("failed to read saved prompts: %w", err)
+	}
+
+	var prompts []SavedPrompt
+	if err := json.Unmarshal(data, &prompts); err != nil {
+		return nil, fmt.Errorf("failed to parse saved prompts: %w", err)
+	}
+	for _, saved := range prompts {
+		timestamp.Observe(saved.SavedAt, saved.Seq)
+	}
+	return prompts, nil
+}
+
+// saveLocked writes a session's saved prompts atomically.
+// Must be called with p.mu held.
+func (p *PromptStore) saveLocked(sessionID string, prompts []SavedPrompt) error {
+	data, err := json.MarshalIndent(prompts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize saved prompts: %w", err)
+	}
+
+	path := p.path(sessionID)
+
+	// 0700: owner-only access
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	return writeSealed(p.encryptor, path, data)
+}
+
+// path returns the saved prompts file for a session.
+func (p *PromptStore) path(sessionID string) string {
+	return filepath.Join(p.basePath, sessionID, promptsFileName)
+}
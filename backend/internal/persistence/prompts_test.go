@@ -0,0 +1,116 @@
+package persistence
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPromptStore_SaveGetList(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := NewPromptStore(tmpDir)
+	sessionID := createTestSessionID(40)
+
+	if _, err := store.Save(sessionID, "Portrait", "a portrait, soft light"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := store.Save(sessionID, "Landscape", "a valley at dawn"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	// Saving under an existing name replaces it, ignoring case and spaces
+	if _, err := store.Save(sessionID, " portrait ", "a portrait, rim light"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// A new store on the same path sees the persisted prompts
+	prompts, err := NewPromptStore(tmpDir).List(sessionID)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(prompts) != 2 {
+		t.Fatalf("List() = %+v, want 2 prompts", prompts)
+	}
+	if prompts[0].Name != "portrait" || prompts[0].Prompt != "a portrait, rim light" {
+		t.Errorf("List()[0] = %+v, want the replaced prompt first", prompts[0])
+	}
+
+	saved, ok, err := store.Get(sessionID, "LANDSCAPE")
+	if err != nil || !ok || saved.Prompt != "a valley at dawn" {
+		t.Errorf("Get() = %+v, %v, %v, want the landscape prompt", saved, ok, err)
+	}
+	if _, ok, err := store.Get(sessionID, "missing"); err != nil || ok {
+		t.Errorf("Get() of a missing name = %v, %v, want false, nil", ok, err)
+	}
+
+	// Sessions don't see each other's prompts
+	other, err := store.List(createTestSessionID(41))
+	if err != nil || len(other) != 0 {
+		t.Errorf("List() of other session = %v, %v, want empty", other, err)
+	}
+}
+
+func TestPromptStore_Encrypted(t *testing.T) {
+	tmpDir := t.TempDir()
+	enc, _ := NewEncryptor(bytes.Repeat([]byte{7}, keySize))
+	store := NewPromptStore(tmpDir)
+	store.SetEncryptor(enc)
+	sessionID := createTestSessionID(43)
+
+	if _, err := store.Save(sessionID, "Garden", "a secret garden"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(store.path(sessionID))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !IsEncrypted(data) || bytes.Contains(data, []byte("secret garden")) {
+		t.Error("saved prompts were written in plaintext")
+	}
+
+	saved, ok, err := store.Get(sessionID, "Garden")
+	if err != nil || !ok || saved.Prompt != "a secret garden" {
+		t.Errorf("Get() = %+v, %v, %v, want the decrypted prompt", saved, ok, err)
+	}
+	if _, err := NewPromptStore(tmpDir).List(sessionID); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("List() without a key error = %v, want ErrEncrypted", err)
+	}
+}
+
+func TestPromptStore_Save_InvalidName(t *testing.T) {
+	store := NewPromptStore(t.TempDir())
+	sessionID := createTestSessionID(42)
+
+	for _, name := range []string{"", "   ", strings.Repeat("x", MaxPromptNameLength+1)} {
+		if _, err := store.Save(sessionID, name, "a cat"); !errors.Is(err, ErrInvalidPromptName) {
+			t.Errorf("Save(%q) error = %v, want ErrInvalidPromptName", name, err)
+		}
+	}
+}
+
+func TestPromptStore_Save_Full(t *testing.T) {
+	store := NewPromptStore(t.TempDir())
+	sessionID := createTestSessionID(43)
+
+	prompts := make([]SavedPrompt, MaxSavedPromptsPerSession)
+	for i := range prompts {
+		prompts[i] = SavedPrompt{Name: fmt.Sprintf("prompt %d", i), Seq: int64(i + 1)}
+	}
+	store.mu.Lock()
+	err := store.saveLocked(sessionID, prompts)
+	store.mu.Unlock()
+	if err != nil {
+		t.Fatalf("saveLocked() error = %v", err)
+	}
+
+	if _, err := store.Save(sessionID, "one more", "a cat"); !errors.Is(err, ErrPromptLibraryFull) {
+		t.Errorf("Save() on a full library error = %v, want ErrPromptLibraryFull", err)
+	}
+	// Replacing an existing prompt still works
+	if _, err := store.Save(sessionID, prompts[0].Name, "a dog"); err != nil {
+		t.Errorf("Save() replacing a prompt in a full library error = %v", err)
+	}
+}
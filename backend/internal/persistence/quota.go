@@ -0,0 +1,187 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// usageRefreshInterval is how long the measured size of the base path is
+// trusted. Saves through the store are added to it in between; files
+// written by other stores, such as conversations, are picked up at the
+// next measurement.
+const usageRefreshInterval = time.Minute
+
+// ErrQuotaExceeded is returned when saving would take the base path over
+// the quota set with SetQuota and no space could be reclaimed.
+var ErrQuotaExceeded = errors.New("session storage quota exceeded")
+
+// ReclaimFunc frees at least need bytes of storage if it can, and returns
+// the bytes it freed.
+type ReclaimFunc func(need int64) int64
+
+// StoredImage is an image file of an ImageStore.
+type StoredImage struct {
+	SessionID string
+	MessageID int
+	Alternate int
+	Size      int64
+	ModTime   time.Time
+}
+
+// SetQuota limits the total size of everything under the base path
+// (conversations, uploads and images) to maxBytes; 0 removes the limit.
+// When an image or upload would exceed it, reclaim is asked for the
+// difference; without reclaim, or if it frees too little, the save fails
+// with ErrQuotaExceeded.
+func (s *ImageStore) SetQuota(maxBytes int64, reclaim ReclaimFunc) {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	s.quotaBytes = maxBytes
+	s.reclaim = reclaim
+	// Saves are only counted while there is a quota
+	s.usageMeasured = time.Time{}
+}
+
+// Usage returns the size of everything under the base path and the quota,
+// 0 if there is none.
+func (s *ImageStore) Usage() (used, quota int64, err error) {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	used, err = s.usageLocked()
+	return used, s.quotaBytes, err
+}
+
+// reserve makes room for size more bytes under the quota, reclaiming space
+// if needed. Reservations are serialized so concurrent saves don't reclaim
+// the same space twice.
+func (s *ImageStore) reserve(size int64) error {
+	s.reserveMu.Lock()
+	defer s.reserveMu.Unlock()
+
+	s.quotaMu.Lock()
+	quota, reclaim := s.quotaBytes, s.reclaim
+	if quota <= 0 {
+		s.quotaMu.Unlock()
+		return nil
+	}
+	used, err := s.usageLocked()
+	s.quotaMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to measure session storage: %w", err)
+	}
+
+	if need := used + size - quota; need > 0 {
+		if reclaim != nil {
+			// Called unlocked, as it deletes through the store
+			need -= reclaim(need)
+			s.invalidateUsage()
+		}
+		if need > 0 {
+			return fmt.Errorf("%w: limit is %d MiB", ErrQuotaExceeded, quota>>20)
+		}
+	}
+
+	s.quotaMu.Lock()
+	s.usedBytes += size
+	s.quotaMu.Unlock()
+	return nil
+}
+
+// invalidateUsage makes the next Usage measure the base path again.
+func (s *ImageStore) invalidateUsage() {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	s.usageMeasured = time.Time{}
+}
+
+// usageLocked returns the size of the base path, measuring it if the last
+// measurement is older than usageRefreshInterval. The caller must hold
+// quotaMu.
+func (s *ImageStore) usageLocked() (int64, error) {
+	if !s.usageMeasured.IsZero() && time.Since(s.usageMeasured) < usageRefreshInterval {
+		return s.usedBytes, nil
+	}
+
+	var total int64
+	err := filepath.WalkDir(s.basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can be removed while walking
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.usedBytes = total
+	s.usageMeasured = time.Now()
+	return total, nil
+}
+
+// Images returns every image of every session, alternates included, least
+// recently saved first.
+func (s *ImageStore) Images() ([]StoredImage, error) {
+	sessions, err := os.ReadDir(s.basePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	var images []StoredImage
+	for _, session := range sessions {
+		if !session.IsDir() || validateSessionID(session.Name()) != nil {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.basePath, session.Name(), "images"))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			messageID, alternate, ok := ParseImageFilename(entry.Name())
+			if !ok || !entry.Type().IsRegular() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			images = append(images, StoredImage{
+				SessionID: session.Name(),
+				MessageID: messageID,
+				Alternate: alternate,
+				Size:      info.Size(),
+				ModTime:   info.ModTime(),
+			})
+		}
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].ModTime.Before(images[j].ModTime)
+	})
+	return images, nil
+}
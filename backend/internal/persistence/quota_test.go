@@ -0,0 +1,133 @@
+package persistence
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestImageStore_QuotaRefusesSaves(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(1)
+
+	if err := store.Save(sessionID, 1, createTestPNGData(600)); err != nil {
+		t.Fatalf("Save() without a quota error = %v", err)
+	}
+
+	store.SetQuota(1000, nil)
+	if err := store.Save(sessionID, 2, createTestPNGData(300)); err != nil {
+		t.Fatalf("Save() within the quota error = %v", err)
+	}
+	if err := store.Save(sessionID, 3, createTestPNGData(300)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Save() over the quota error = %v, want %v", err, ErrQuotaExceeded)
+	}
+	if _, err := store.SaveUpload(sessionID, createTestPNGData(300)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("SaveUpload() over the quota error = %v, want %v", err, ErrQuotaExceeded)
+	}
+	if store.Exists(sessionID, 3) {
+		t.Error("refused image was written")
+	}
+
+	used, quota, err := store.Usage()
+	if err != nil {
+		t.Fatalf("Usage() error = %v", err)
+	}
+	if used != 900 || quota != 1000 {
+		t.Errorf("Usage() = %d, %d, want 900, 1000", used, quota)
+	}
+
+	// Deleting frees the space at once
+	if err := store.Delete(sessionID, 1); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := store.Save(sessionID, 3, createTestPNGData(300)); err != nil {
+		t.Errorf("Save() after deleting error = %v", err)
+	}
+}
+
+func TestImageStore_QuotaReclaims(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(1)
+	for id := 1; id <= 3; id++ {
+		if err := store.Save(sessionID, id, createTestPNGData(300)); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	var asked int64
+	store.SetQuota(1000, func(need int64) int64 {
+		asked = need
+		if err := store.Delete(sessionID, 1); err != nil {
+			t.Errorf("Delete() error = %v", err)
+		}
+		return 300
+	})
+	if err := store.Save(sessionID, 4, createTestPNGData(200)); err != nil {
+		t.Fatalf("Save() with reclaim error = %v", err)
+	}
+	if asked != 100 {
+		t.Errorf("reclaim asked for %d bytes, want 100", asked)
+	}
+	if store.Exists(sessionID, 1) || !store.Exists(sessionID, 4) {
+		t.Error("Save() did not replace the reclaimed image")
+	}
+
+	// Reclaiming too little still refuses the save
+	store.SetQuota(1000, func(need int64) int64 { return 0 })
+	if err := store.Save(sessionID, 5, createTestPNGData(300)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Save() error = %v, want %v", err, ErrQuotaExceeded)
+	}
+}
+
+func TestImageStore_Images(t *testing.T) {
+	dir := t.TempDir()
+	store := NewImageStore(dir)
+	first, second := createTestSessionID(1), createTestSessionID(2)
+
+	if err := store.Save(second, 1, createTestPNGData(10)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.Save(first, 2, createTestPNGData(20)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.SaveAlternate(first, 2, 1, createTestPNGData(30)); err != nil {
+		t.Fatalf("SaveAlternate() error = %v", err)
+	}
+	// Not an image of a session
+	if err := os.WriteFile(filepath.Join(dir, first, "images", "notes.txt"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().Add(-time.Hour)
+	for i, path := range []string{store.GetAlternatePath(first, 2, 1), store.GetPath(second, 1), store.GetPath(first, 2)} {
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	images, err := store.Images()
+	if err != nil {
+		t.Fatalf("Images() error = %v", err)
+	}
+	want := []StoredImage{
+		{SessionID: first, MessageID: 2, Alternate: 1, Size: 30},
+		{SessionID: second, MessageID: 1, Size: 10},
+		{SessionID: first, MessageID: 2, Size: 20},
+	}
+	if len(images) != len(want) {
+		t.Fatalf("Images() = %+v, want %d images", images, len(want))
+	}
+	for i, img := range images {
+		img.ModTime = time.Time{}
+		if img != want[i] {
+			t.Errorf("Images()[%d] = %+v, want %+v", i, img, want[i])
+		}
+	}
+
+	if images, err := NewImageStore(filepath.Join(dir, "missing")).Images(); err != nil || len(images) != 0 {
+		t.Errorf("Images() of a missing directory = %v, %v, want none", images, err)
+	}
+}
@@ -23,10 +23,18 @@ const (
 // Storage structure:
 //
 //	config/sessions/{session_id}/
-//	  conversation.json
+//	  conversation.json      (default chat)
+//	  chats.json             (chat index, once a second chat exists)
+//	  chats/{chat_id}.json   (additional chats)
+//	  settings.json          (session settings, once one is changed)
 //	  images/
+//
+// With SetEncryptor, conversation files, the chat index and the settings
+// are encrypted at rest. Plaintext files written before encryption was enabled are still
+// read, and are encrypted on their next save.
 type SessionStore struct {
-	basePath string // Base directory for all sessions (e.g., "config/sessions")
+	basePath  string     // Base directory for all sessions (e.g., "config/sessions")
+	encryptor *Encryptor // Encrypts files at rest; nil writes plaintext
 }
 
 // NewSessionStore creates a new session store rooted at the specified base path.
@@ -39,6 +47,12 @@ func NewSessionStore(basePath string) *SessionStore {
 	}
 }
 
+// SetEncryptor enables encryption at rest. It must be called before the
+// store is used.
+func (s *SessionStore) SetEncryptor(e *Encryptor) {
+	s.encryptor = e
+}
+
 // Save persists a conversation to disk.
 // The conversation is serialized to JSON and written to:
 // {basePath}/{sessionID}/conversation.json
@@ -65,33 +79,7 @@ func (s *SessionStore) Save(sessionID string, conv *conversation.Conversation) e
 		return fmt.Errorf("failed to create images directory: %w", err)
 	}
 
-	// Serialize conversation to JSON
-	data, err := serializeConversation(conv)
-	if err != nil {
-		return fmt.Errorf("failed to serialize conversation: %w", err)
-	}
-
-	// Check size limit to prevent disk exhaustion
-	if len(data) > MaxConversationSizeBytes {
-		return fmt.Errorf("conversation size %d bytes exceeds maximum %d bytes", len(data), MaxConversationSizeBytes)
-	}
-
-	// Write to temp file first, then rename (atomic write)
-	// 0600: owner read/write only
-	conversationPath := filepath.Join(sessionDir, "conversation.json")
-	tempPath := conversationPath + ".tmp"
-
-	if err := os.WriteFile(tempPath, data, 0600); err != nil {
-		return fmt.Errorf("failed to write conversation file: %w", err)
-	}
-
-	if err := os.Rename(tempPath, conversationPath); err != nil {
-		// Clean up temp file if rename fails
-		_ = os.Remove(tempPath)
-		return fmt.Errorf("failed to commit conversation file: %w", err)
-	}
-
-	return nil
+	return s.writeConversation(filepath.Join(sessionDir, "conversation.json"), conv)
 }
 
 // Load reads a conversation from disk and returns it.
@@ -110,7 +98,7 @@ func (s *SessionStore) Load(sessionID string) (*conversation.Conversation, error
 	}
 
 	// Read the file
-	data, err := os.ReadFile(conversationPath)
+	data, err := s.readFile(conversationPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read conversation file: %w", err)
 	}
@@ -138,6 +126,20 @@ func (s *SessionStore) Exists(sessionID string) bool {
 	return err == nil
 }
 
+// DeleteSession removes a session's directory: its conversations and
+// settings, and everything else stored next to them, such as images,
+// favorites and tags. Deleting a session that doesn't exist is a no-op.
+func (s *SessionStore) DeleteSession(sessionID string) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	if err := os.RemoveAll(filepath.Join(s.basePath, sessionID)); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
 // ListSessions returns a list of all session IDs found in the base directory.
 // Each session is identified by its directory name.
 // Returns an empty slice if no sessions exist or if the base directory doesn't exist.
@@ -174,6 +176,7 @@ type conversationJSON struct {
 	CurrentPrompt  string                             `json:"current_prompt"`
 	PreviousPrompt string                             `json:"previous_prompt,omitempty"`
 	PromptEdited   bool                               `json:"prompt_edited,omitempty"`
+	PromptHistory  []conversation.PromptRevision      `json:"prompt_history,omitempty"`
 }
 
 // serializeConversation converts a Conversation to JSON bytes.
@@ -184,6 +187,7 @@ func serializeConversation(conv *conversation.Conversation) ([]byte, error) {
 		CurrentPrompt:  conv.GetCurrentPrompt(),
 		PreviousPrompt: conv.GetPreviousPrompt(),
 		PromptEdited:   conv.IsPromptEdited(),
+		PromptHistory:  conv.GetPromptHistory(),
 	}
 
 	return json.MarshalIndent(data, "", "  ")
@@ -196,6 +200,10 @@ func deserializeConversation(data []byte) (*conversation.Conversation, error) {
 		return nil, fmt.Errorf("failed to parse JSON: %w", err)
 	}
 
+	// Files written before messages had sequence numbers are migrated
+	// in memory and rewritten on the next save
+	conversation.MigrateTimestamps(jsonData.Messages)
+
 	// Create new conversation and restore state
 	conv := conversation.NewConversation()
 	conv.SetMessages(jsonData.Messages)
@@ -203,6 +211,217 @@ func deserializeConversation(data []byte) (*conversation.Conversation, error) {
 	conv.SetCurrentPrompt(jsonData.CurrentPrompt)
 	conv.SetPreviousPrompt(jsonData.PreviousPrompt)
 	conv.SetPromptEdited(jsonData.PromptEdited)
+	conv.SetPromptHistory(jsonData.PromptHistory)
+
+	return conv, nil
+}
+
+// SaveChat persists an additional chat's conversation to:
+// {basePath}/{sessionID}/chats/{chatID}.json
+func (s *SessionStore) SaveChat(sessionID, chatID string, conv *conversation.Conversation) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return fmt.Errorf("invalid session ID: %w", err)
+	}
+	if err := validateChatID(chatID); err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+	if conv == nil {
+		return fmt.Errorf("conversation cannot be nil")
+	}
+
+	// 0700: owner-only access
+	chatsDir := filepath.Join(s.basePath, sessionID, "chats")
+	if err := os.MkdirAll(chatsDir, 0700); err != nil {
+		return fmt.Errorf("failed to create chats directory: %w", err)
+	}
+
+	return s.writeConversation(filepath.Join(chatsDir, chatID+".json"), conv)
+}
+
+// LoadChat reads an additional chat's conversation.
+// Returns an empty conversation if the file doesn't exist or is corrupt.
+func (s *SessionStore) LoadChat(sessionID, chatID string) (*conversation.Conversation, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+	if err := validateChatID(chatID); err != nil {
+		return nil, fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	data, err := s.readFile(filepath.Join(s.basePath, sessionID, "chats", chatID+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return conversation.NewConversation(), nil
+		}
+		return nil, fmt.Errorf("failed to read chat file: %w", err)
+	}
+
+	conv, err := deserializeConversation(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: corrupt chat file %s for session %s: %v\n", chatID, sessionID, err)
+		return conversation.NewConversation(), nil
+	}
 
 	return conv, nil
 }
+
+// DeleteChat removes an additional chat's conversation file.
+// Returns nil if the file didn't exist.
+func (s *SessionStore) DeleteChat(sessionID, chatID string) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return fmt.Errorf("invalid session ID: %w", err)
+	}
+	if err := validateChatID(chatID); err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	err := os.Remove(filepath.Join(s.basePath, sessionID, "chats", chatID+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete chat file: %w", err)
+	}
+	return nil
+}
+
+// SaveChatIndex persists the session's chat list to {basePath}/{sessionID}/chats.json.
+func (s *SessionStore) SaveChatIndex(sessionID string, index *conversation.ChatIndex) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return fmt.Errorf("invalid session ID: %w", err)
+	}
+	if index == nil {
+		return fmt.Errorf("chat index cannot be nil")
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize chat index: %w", err)
+	}
+
+	// 0700: owner-only access
+	sessionDir := filepath.Join(s.basePath, sessionID)
+	if err := os.MkdirAll(sessionDir, 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	return s.writeFile(filepath.Join(sessionDir, "chats.json"), data)
+}
+
+// LoadChatIndex reads the session's chat list.
+// Returns nil (and no error) if the session has never had more than one chat.
+func (s *SessionStore) LoadChatIndex(sessionID string) (*conversation.ChatIndex, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	data, err := s.readFile(filepath.Join(s.basePath, sessionID, "chats.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read chat index: %w", err)
+	}
+
+	var index conversation.ChatIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse chat index: %w", err)
+	}
+
+	// Drop entries that could escape the session directory
+	chats := index.Chats[:0]
+	for _, info := range index.Chats {
+		if info.ID == conversation.DefaultChatID || validateChatID(info.ID) == nil {
+			chats = append(chats, info)
+		}
+	}
+	index.Chats = chats
+
+	return &index, nil
+}
+
+// SaveSettings persists the session's settings to {basePath}/{sessionID}/settings.json.
+func (s *SessionStore) SaveSettings(sessionID string, settings *conversation.SessionSettings) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return fmt.Errorf("invalid session ID: %w", err)
+	}
+	if settings == nil {
+		return fmt.Errorf("settings cannot be nil")
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize settings: %w", err)
+	}
+
+	// 0700: owner-only access
+	sessionDir := filepath.Join(s.basePath, sessionID)
+	if err := os.MkdirAll(sessionDir, 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	return s.writeFile(filepath.Join(sessionDir, "settings.json"), data)
+}
+
+// LoadSettings reads the session's settings.
+// Returns nil (and no error) if the session has never changed a setting.
+func (s *SessionStore) LoadSettings(sessionID string) (*conversation.SessionSettings, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	data, err := s.readFile(filepath.Join(s.basePath, sessionID, "settings.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read settings: %w", err)
+	}
+
+	var settings conversation.SessionSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse settings: %w", err)
+	}
+	return &settings, nil
+}
+
+// writeConversation serializes a conversation and writes it atomically.
+func (s *SessionStore) writeConversation(path string, conv *conversation.Conversation) error {
+	data, err := serializeConversation(conv)
+	if err != nil {
+		return fmt.Errorf("failed to serialize conversation: %w", err)
+	}
+
+	// Check size limit to prevent disk exhaustion
+	if len(data) > MaxConversationSizeBytes {
+		return fmt.Errorf("conversation size %d bytes exceeds maximum %d bytes", len(data), MaxConversationSizeBytes)
+	}
+
+	return s.writeFile(path, data)
+}
+
+// writeFile encrypts data if encryption is enabled and writes it atomically.
+func (s *SessionStore) writeFile(path string, data []byte) error {
+	return writeSealed(s.encryptor, path, data)
+}
+
+// readFile reads a file written by writeFile, decrypting it if needed.
+// Plaintext files are returned as-is.
+func (s *SessionStore) readFile(path string) ([]byte, error) {
+	return readSealed(s.encryptor, path)
+}
+
+// writeFileAtomic writes data to a temp file and renames it into place.
+// 0600: owner read/write only
+func writeFileAtomic(path string, data []byte) error {
+	tempPath := path + ".tmp"
+
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		// Clean up temp file if rename fails
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("failed to commit %s: %w", filepath.Base(path), err)
+	}
+
+	return nil
+}
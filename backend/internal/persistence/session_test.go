@@ -1,11 +1,16 @@
 package persistence
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/ollama"
 )
 
 func TestSessionStore_Save(t *testing.T) {
@@ -272,6 +277,40 @@ func TestSessionStore_Load_CorruptJSON(t *testing.T) {
 	}
 }
 
+func TestSessionStore_Load_MigratesTimestamps(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := NewSessionStore(tmpDir)
+	sessionID := createTestSessionID(41)
+
+	// A conversation written before messages had sequence numbers
+	sessionDir := filepath.Join(tmpDir, sessionID)
+	if err := os.MkdirAll(sessionDir, 0700); err != nil {
+		t.Fatalf("failed to create session directory: %v", err)
+	}
+	legacy := `{"messages":[` +
+		`{"id":1,"role":"user","content":"old"},` +
+		`{"id":2,"role":"assistant","content":"newer","created_at":"2025-03-01T14:00:00+02:00"}` +
+		`],"next_message_id":3,"current_prompt":""}`
+	if err := os.WriteFile(filepath.Join(sessionDir, "conversation.json"), []byte(legacy), 0600); err != nil {
+		t.Fatalf("failed to write conversation: %v", err)
+	}
+
+	conv, err := store.Load(sessionID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	messages := conv.GetMessages()
+	if len(messages) != 2 {
+		t.Fatalf("Load() returned %d messages, want 2", len(messages))
+	}
+	if messages[0].Seq == 0 || messages[1].Seq <= messages[0].Seq {
+		t.Errorf("Seq = %d, %d, want increasing in history order", messages[0].Seq, messages[1].Seq)
+	}
+	if want := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC); messages[1].CreatedAt != want {
+		t.Errorf("CreatedAt = %v, want %v", messages[1].CreatedAt, want)
+	}
+}
+
 func TestSessionStore_Exists(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -339,6 +378,33 @@ func TestSessionStore_Exists(t *testing.T) {
 	}
 }
 
+func TestSessionStore_DeleteSession(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := NewSessionStore(tmpDir)
+	sessionID := createTestSessionID(25)
+
+	if err := store.Save(sessionID, conversation.NewConversation()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := NewImageStore(tmpDir).Save(sessionID, 1, createTestPNGData(10)); err != nil {
+		t.Fatalf("Save() image error = %v", err)
+	}
+
+	if err := store.DeleteSession(sessionID); err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, sessionID)); !os.IsNotExist(err) {
+		t.Errorf("session directory after DeleteSession() stat error = %v, want not exist", err)
+	}
+
+	if err := store.DeleteSession(sessionID); err != nil {
+		t.Errorf("DeleteSession() of a deleted session error = %v, want nil", err)
+	}
+	if err := store.DeleteSession("../escape"); err == nil {
+		t.Error("DeleteSession() of an invalid session ID succeeded, want error")
+	}
+}
+
 func TestSessionStore_ListSessions(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -481,6 +547,10 @@ func TestSessionStore_SaveLoad_RoundTrip(t *testing.T) {
 	original.SetCurrentPrompt("an orange fluffy cat")
 	original.SetPreviousPrompt("a fluffy cat")
 	original.SetPromptEdited(true)
+	original.SetPromptHistory([]conversation.PromptRevision{
+		{Prompt: "a fluffy cat", Source: conversation.PromptSourceAgent, Seq: 1},
+		{Prompt: "an orange fluffy cat", Source: conversation.PromptSourceUser, Seq: 2},
+	})
 
 	// Save
 	if err := store.Save(createTestSessionID(43), original); err != nil {
@@ -510,6 +580,11 @@ func TestSessionStore_SaveLoad_RoundTrip(t *testing.T) {
 		t.Errorf("PromptEdited = %v, want %v", loaded.IsPromptEdited(), original.IsPromptEdited())
 	}
 
+	if history := loaded.GetPromptHistory(); len(history) != 2 || history[1].Source != conversation.PromptSourceUser ||
+		history[1].Prompt != "an orange fluffy cat" {
+		t.Errorf("PromptHistory = %+v, want the 2 saved revisions", history)
+	}
+
 	// Compare messages
 	loadedMsgs := loaded.GetMessages()
 	if len(loadedMsgs) != len(msgs) {
@@ -595,3 +670,241 @@ func TestSessionStore_Save_AtomicWrite(t *testing.T) {
 		t.Errorf("CurrentPrompt = %q, want 'second prompt'", loaded.GetCurrentPrompt())
 	}
 }
+
+func TestSessionStore_ChatRoundTrip(t *testing.T) {
+	store := NewSessionStore(t.TempDir())
+	sessionID := createTestSessionID(40)
+	chatID := "0123456789abcdef"
+
+	conv := conversation.NewConversation()
+	conv.SetMessages([]conversation.ConversationMessage{
+		{ID: 7, Role: conversation.RoleUser, Content: "second chat"},
+	})
+	conv.SetNextMessageID(8)
+
+	if err := store.SaveChat(sessionID, chatID, conv); err != nil {
+		t.Fatalf("SaveChat() error = %v", err)
+	}
+
+	path := filepath.Join(store.basePath, sessionID, "chats", chatID+".json")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("chat file not created: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("chat file permissions = %o, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := store.LoadChat(sessionID, chatID)
+	if err != nil {
+		t.Fatalf("LoadChat() error = %v", err)
+	}
+	messages := loaded.GetMessages()
+	if len(messages) != 1 || messages[0].ID != 7 || messages[0].Content != "second chat" {
+		t.Errorf("loaded messages = %+v, want the saved message", messages)
+	}
+	if loaded.GetNextMessageID() != 8 {
+		t.Errorf("nextMessageID = %d, want 8", loaded.GetNextMessageID())
+	}
+
+	// The default conversation file is unaffected
+	if store.Exists(sessionID) {
+		t.Error("SaveChat() created the default conversation file")
+	}
+
+	if err := store.DeleteChat(sessionID, chatID); err != nil {
+		t.Fatalf("DeleteChat() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("chat file still exists after DeleteChat()")
+	}
+	if err := store.DeleteChat(sessionID, chatID); err != nil {
+		t.Errorf("DeleteChat() of missing chat error = %v, want nil", err)
+	}
+
+	loaded, err = store.LoadChat(sessionID, chatID)
+	if err != nil || len(loaded.GetMessages()) != 0 {
+		t.Errorf("LoadChat() of missing chat = %d messages, %v, want empty conversation", len(loaded.GetMessages()), err)
+	}
+}
+
+func TestSessionStore_ChatInvalidIDs(t *testing.T) {
+	store := NewSessionStore(t.TempDir())
+	conv := conversation.NewConversation()
+
+	tests := []struct {
+		name      string
+		sessionID string
+		chatID    string
+	}{
+		{name: "invalid session ID", sessionID: "../x", chatID: "0123456789abcdef"},
+		{name: "path traversal chat ID", sessionID: createTestSessionID(41), chatID: "../../secrets"},
+		{name: "default chat ID", sessionID: createTestSessionID(41), chatID: conversation.DefaultChatID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.SaveChat(tt.sessionID, tt.chatID, conv); err == nil {
+				t.Error("SaveChat() error = nil, want error")
+			}
+			if _, err := store.LoadChat(tt.sessionID, tt.chatID); err == nil {
+				t.Error("LoadChat() error = nil, want error")
+			}
+			if err := store.DeleteChat(tt.sessionID, tt.chatID); err == nil {
+				t.Error("DeleteChat() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestSessionStore_ChatIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := NewSessionStore(tmpDir)
+	sessionID := createTestSessionID(42)
+
+	index, err := store.LoadChatIndex(sessionID)
+	if err != nil || index != nil {
+		t.Fatalf("LoadChatIndex() with no index = %v, %v, want nil, nil", index, err)
+	}
+
+	want := &conversation.ChatIndex{
+		ActiveChatID: "0123456789abcdef",
+		Chats: []conversation.ChatInfo{
+			{ID: conversation.DefaultChatID, Name: "Chat 1"},
+			{ID: "0123456789abcdef", Name: "Landscapes"},
+		},
+	}
+	if err := store.SaveChatIndex(sessionID, want); err != nil {
+		t.Fatalf("SaveChatIndex() error = %v", err)
+	}
+
+	index, err = store.LoadChatIndex(sessionID)
+	if err != nil {
+		t.Fatalf("LoadChatIndex() error = %v", err)
+	}
+	if index.ActiveChatID != want.ActiveChatID || len(index.Chats) != 2 || index.Chats[1].Name != "Landscapes" {
+		t.Errorf("LoadChatIndex() = %+v, want %+v", index, want)
+	}
+
+	// Tampered entries that could escape the session directory are dropped
+	tampered := `{"active_chat_id":"main","chats":[{"id":"main","name":"Chat 1"},{"id":"../../etc","name":"bad"}]}`
+	if err := os.WriteFile(filepath.Join(tmpDir, sessionID, "chats.json"), []byte(tampered), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	index, err = store.LoadChatIndex(sessionID)
+	if err != nil {
+		t.Fatalf("LoadChatIndex() error = %v", err)
+	}
+	if len(index.Chats) != 1 || index.Chats[0].ID != conversation.DefaultChatID {
+		t.Errorf("LoadChatIndex() chats = %+v, want only the default chat", index.Chats)
+	}
+}
+
+func TestSessionStore_Settings(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := NewSessionStore(tmpDir)
+	sessionID := createTestSessionID(43)
+
+	settings, err := store.LoadSettings(sessionID)
+	if err != nil || settings != nil {
+		t.Fatalf("LoadSettings() with no settings = %v, %v, want nil, nil", settings, err)
+	}
+
+	temperature := 0.4
+	seed := int64(12)
+	want := &conversation.SessionSettings{
+		Generation: &conversation.GenerationSettings{Steps: 28, CFG: 4.5, Seed: 99},
+		Model:      "llama3.2",
+		LoRAs:      []conversation.LoRA{{Name: "watercolor", Weight: 0.8}},
+		Control:    &conversation.Control{UploadID: "abc", Type: 1, Strength: 0.5},
+		Persona:    "critic",
+		Sampling:   ollama.Sampling{Temperature: &temperature},
+		LLMSeed:    &seed,
+		Width:      768,
+		Height:     512,
+	}
+	if err := store.SaveSettings(sessionID, want); err != nil {
+		t.Fatalf("SaveSettings() error = %v", err)
+	}
+
+	settings, err = store.LoadSettings(sessionID)
+	if err != nil {
+		t.Fatalf("LoadSettings() error = %v", err)
+	}
+	if !reflect.DeepEqual(settings, want) {
+		t.Errorf("LoadSettings() = %+v, want %+v", settings, want)
+	}
+
+	if err := store.SaveSettings("../escape", want); err == nil {
+		t.Error("SaveSettings() with an invalid session ID succeeded")
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, sessionID, "settings.json"), []byte("{"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := store.LoadSettings(sessionID); err == nil {
+		t.Error("LoadSettings() of a corrupt file succeeded")
+	}
+}
+
+func TestSessionStore_Encrypted(t *testing.T) {
+	tmpDir := t.TempDir()
+	sessionID := createTestSessionID(7)
+	enc, err := NewEncryptor(bytes.Repeat([]byte{1}, keySize))
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+
+	// A plaintext file from before encryption was enabled
+	plain := NewSessionStore(tmpDir)
+	conv := conversation.NewConversation()
+	conv.SetCurrentPrompt("a hidden lighthouse")
+	if err := plain.Save(sessionID, conv); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	store := NewSessionStore(tmpDir)
+	store.SetEncryptor(enc)
+	loaded, err := store.Load(sessionID)
+	if err != nil {
+		t.Fatalf("Load() plaintext error = %v", err)
+	}
+	if loaded.GetCurrentPrompt() != "a hidden lighthouse" {
+		t.Errorf("Load() prompt = %q, want plaintext file to be read", loaded.GetCurrentPrompt())
+	}
+
+	// Saving encrypts conversations and the chat index
+	if err := store.Save(sessionID, loaded); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	index := &conversation.ChatIndex{
+		ActiveChatID: conversation.DefaultChatID,
+		Chats:        []conversation.ChatInfo{{ID: conversation.DefaultChatID, Name: "Private chat"}},
+	}
+	if err := store.SaveChatIndex(sessionID, index); err != nil {
+		t.Fatalf("SaveChatIndex() error = %v", err)
+	}
+	for name, secret := range map[string]string{"conversation.json": "lighthouse", "chats.json": "Private chat"} {
+		data, err := os.ReadFile(filepath.Join(tmpDir, sessionID, name))
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", name, err)
+		}
+		if !IsEncrypted(data) || bytes.Contains(data, []byte(secret)) {
+			t.Errorf("%s is not encrypted", name)
+		}
+	}
+
+	loaded, err = store.Load(sessionID)
+	if err != nil || loaded.GetCurrentPrompt() != "a hidden lighthouse" {
+		t.Errorf("Load() encrypted = %q, %v, want decrypted prompt", loaded.GetCurrentPrompt(), err)
+	}
+	gotIndex, err := store.LoadChatIndex(sessionID)
+	if err != nil || gotIndex.Chats[0].Name != "Private chat" {
+		t.Errorf("LoadChatIndex() encrypted = %+v, %v, want decrypted index", gotIndex, err)
+	}
+
+	// Without the key, encrypted files are an error rather than an empty
+	// conversation that would overwrite them
+	if _, err := plain.Load(sessionID); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Load() without key error = %v, want ErrEncrypted", err)
+	}
+}
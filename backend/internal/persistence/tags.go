@@ -0,0 +1,287 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	// tagsFileName is the name of a session's tag index within its directory
+	tagsFileName = "tags.json"
+
+	// MaxTagsPerImage limits the number of tags on a single image.
+	MaxTagsPerImage = 20
+
+	// MaxTagLength is the maximum length of a tag in bytes.
+	MaxTagLength = 32
+)
+
+var (
+	// ErrTooManyTags is returned when an image would exceed MaxTagsPerImage
+	ErrTooManyTags = errors.New("too many tags")
+
+	// ErrInvalidTag is returned for tags that are too long or contain
+	// control characters or commas
+	ErrInvalidTag = errors.New("invalid tag")
+)
+
+// ImageTags records the tags attached to a session image.
+type ImageTags struct {
+	MessageID int      `json:"message_id"`
+	Tags      []string `json:"tags"`
+}
+
+// sessionTags is the in-memory index of one session's tags.
+type sessionTags struct {
+	images map[int][]string // message ID -> sorted tags
+	byTag  map[string][]int // tag -> sorted message IDs
+}
+
+// TagIndex manages the free-form tags attached to session images.
+// Each session's tags are stored next to its images and indexed in memory
+// by tag on first use, so tag lookups don't scan every image.
+//
+// Storage structure:
+//
+//	config/sessions/{session_id}/tags.json
+type TagIndex struct {
+	mu       sync.Mutex
+	basePath string
+	sessions map[string]*sessionTags
+}
+
+// NewTagIndex creates a tag index rooted at the specified base path.
+// The base path is typically "config/sessions".
+func NewTagIndex(basePath string) *TagIndex {
+	return &TagIndex{
+		basePath: basePath,
+		sessions: make(map[string]*sessionTags),
+	}
+}
+
+// NormalizeTags trims and lowercases tags, drops empty and duplicate tags,
+// and sorts the result. Returns ErrInvalidTag or ErrTooManyTags if the
+// tags can't be stored.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > MaxTagLength || strings.ContainsFunc(tag, func(r rune) bool {
+			return r == ',' || unicode.IsControl(r)
+		}) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > MaxTagsPerImage {
+		return nil, ErrTooManyTags
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// SetTags replaces an image's tags and returns the normalized tags.
+// An empty list removes all of the image's tags.
+func (t *TagIndex) SetTags(sessionID string, messageID int, tags []string) ([]string, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+	if messageID <= 0 {
+		return nil, fmt.Errorf("message ID must be positive")
+	}
+	normalized, err := NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	index, err := t.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[int][]string, len(index.images)+1)
+	for id, existing := range index.images {
+		images[id] = existing
+	}
+	if len(normalized) == 0 {
+		delete(images, messageID)
+	} else {
+		images[messageID] = normalized
+	}
+
+	if err := t.saveLocked(sessionID, images); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// Tags returns an image's tags, sorted.
+// Returns an empty slice if the image has none.
+func (t *TagIndex) Tags(sessionID string, messageID int) ([]string, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	index, err := t.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{}, index.images[messageID]...), nil
+}
+
+// Find returns the IDs of the session's images tagged with tag, in
+// ascending order. The tag is normalized before lookup.
+func (t *TagIndex) Find(sessionID string, tag string) ([]int, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+	tag = strings.ToLower(strings.TrimSpace(tag))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	index, err := t.loadLocked(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]int{}, index.byTag[tag]...), nil
+}
+
+// Remove deletes all of an image's tags.
+// Removing an image without tags is a no-op.
+func (t *TagIndex) Remove(sessionID string, messageID int) error {
+	_, err := t.SetTags(sessionID, messageID, nil)
+	return err
+}
+
+// DeleteSession removes all of a session's tags.
+func (t *TagIndex) DeleteSession(sessionID string) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.sessions, sessionID)
+	if err := os.Remove(t.path(sessionID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete tags: %w", err)
+	}
+	return nil
+}
+
+// loadLocked returns a session's index, reading it from disk on first use.
+// A missing file is treated as no tags.
+// Must be called with t.mu held.
+func (t *TagIndex) loadLocked(sessionID string) (*sessionTags, error) {
+	if index, ok := t.sessions[sessionID]; ok {
+		return index, nil
+	}
+
+	images := make(map[int][]string)
+	data, err := os.ReadFile(t.path(sessionID))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+	if err == nil {
+		var entries []ImageTags
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse tags: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.MessageID > 0 && len(entry.Tags) > 0 {
+				images[entry.MessageID] = entry.Tags
+			}
+		}
+	}
+
+	index := newSessionTags(images)
+	// Sessions without tags aren't cached, so looking up many untagged
+	// sessions doesn't grow the cache
+	if len(images) > 0 {
+		t.sessions[sessionID] = index
+	}
+	return index, nil
+}
+
+// saveLocked writes a session's tags atomically and replaces its
+// in-memory index.
+// Must be called with t.mu held.
+func (t *TagIndex) saveLocked(sessionID string, images map[int][]string) error {
+	entries := make([]ImageTags, 0, len(images))
+	for id, tags := range images {
+		entries = append(entries, ImageTags{MessageID: id, Tags: tags})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].MessageID < entries[j].MessageID
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize tags: %w", err)
+	}
+
+	path := t.path(sessionID)
+
+	// 0700: owner-only access
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	// Write to temp file first, then rename (atomic write)
+	// 0600: owner read/write only
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		// Clean up temp file if rename fails
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("failed to commit tags: %w", err)
+	}
+
+	if len(images) == 0 {
+		delete(t.sessions, sessionID)
+	} else {
+		t.sessions[sessionID] = newSessionTags(images)
+	}
+	return nil
+}
+
+// path returns the tag index file for a session.
+func (t *TagIndex) path(sessionID string) string {
+	return filepath.Join(t.basePath, sessionID, tagsFileName)
+}
+
+// newSessionTags builds the by-tag index for a session's image tags.
+func newSessionTags(images map[int][]string) *sessionTags {
+	byTag := make(map[string][]int)
+	for id, tags := range images {
+		for _, tag := range tags {
+			byTag[tag] = append(byTag[tag], id)
+		}
+	}
+	for _, ids := range byTag {
+		sort.Ints(ids)
+	}
+	return &sessionTags{images: images, byTag: byTag}
+}
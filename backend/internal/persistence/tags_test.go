@@ -0,0 +1,149 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tooMany := make([]string, MaxTagsPerImage+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag%d", i)
+	}
+
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		wantErr error
+	}{
+		{name: "trims, lowercases and sorts", tags: []string{" Sunset", "beach "}, want: []string{"beach", "sunset"}},
+		{name: "drops empty and duplicate tags", tags: []string{"cat", "", "CAT", "  "}, want: []string{"cat"}},
+		{name: "empty", tags: nil, want: []string{}},
+		{name: "too long", tags: []string{strings.Repeat("a", MaxTagLength+1)}, wantErr: ErrInvalidTag},
+		{name: "comma", tags: []string{"a,b"}, wantErr: ErrInvalidTag},
+		{name: "control character", tags: []string{"a\nb"}, wantErr: ErrInvalidTag},
+		{name: "too many", tags: tooMany, wantErr: ErrTooManyTags},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeTags(tt.tags)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("NormalizeTags() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeTags() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeTags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagIndex_SetFindRemove(t *testing.T) {
+	tmpDir := t.TempDir()
+	index := NewTagIndex(tmpDir)
+	sessionID := createTestSessionID(40)
+
+	if _, err := index.SetTags(sessionID, 1, []string{"beach", "sunset"}); err != nil {
+		t.Fatalf("SetTags() error = %v", err)
+	}
+	if _, err := index.SetTags(sessionID, 2, []string{"Sunset"}); err != nil {
+		t.Fatalf("SetTags() error = %v", err)
+	}
+
+	// A new index on the same path sees the persisted tags
+	reloaded := NewTagIndex(tmpDir)
+	ids, err := reloaded.Find(sessionID, " SUNSET ")
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("Find(sunset) = %v, want [1 2]", ids)
+	}
+
+	// Replacing tags updates the by-tag index
+	if _, err := reloaded.SetTags(sessionID, 1, []string{"beach"}); err != nil {
+		t.Fatalf("SetTags() error = %v", err)
+	}
+	if ids, _ := reloaded.Find(sessionID, "sunset"); !reflect.DeepEqual(ids, []int{2}) {
+		t.Errorf("Find(sunset) after retag = %v, want [2]", ids)
+	}
+	if tags, _ := reloaded.Tags(sessionID, 1); !reflect.DeepEqual(tags, []string{"beach"}) {
+		t.Errorf("Tags(1) = %q, want [beach]", tags)
+	}
+
+	if err := reloaded.Remove(sessionID, 1); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if ids, _ := reloaded.Find(sessionID, "beach"); len(ids) != 0 {
+		t.Errorf("Find(beach) after Remove = %v, want none", ids)
+	}
+	if tags, err := reloaded.Tags(sessionID, 1); err != nil || len(tags) != 0 {
+		t.Errorf("Tags(1) after Remove = %q, %v, want empty", tags, err)
+	}
+
+	// Sessions don't see each other's tags
+	if ids, err := reloaded.Find(createTestSessionID(41), "sunset"); err != nil || len(ids) != 0 {
+		t.Errorf("Find() in other session = %v, %v, want empty", ids, err)
+	}
+}
+
+func TestTagIndex_DeleteSession(t *testing.T) {
+	tmpDir := t.TempDir()
+	index := NewTagIndex(tmpDir)
+	sessionID := createTestSessionID(42)
+
+	if _, err := index.SetTags(sessionID, 1, []string{"beach"}); err != nil {
+		t.Fatalf("SetTags() error = %v", err)
+	}
+	if err := index.DeleteSession(sessionID); err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+
+	// Neither the cached index nor the file keeps the tags
+	if ids, err := index.Find(sessionID, "beach"); err != nil || len(ids) != 0 {
+		t.Errorf("Find() after DeleteSession() = %v, %v, want empty", ids, err)
+	}
+	if ids, _ := NewTagIndex(tmpDir).Find(sessionID, "beach"); len(ids) != 0 {
+		t.Errorf("Find() on a new index after DeleteSession() = %v, want empty", ids)
+	}
+	if err := index.DeleteSession(sessionID); err != nil {
+		t.Errorf("second DeleteSession() error = %v, want nil", err)
+	}
+}
+
+func TestTagIndex_Validation(t *testing.T) {
+	index := NewTagIndex(t.TempDir())
+
+	tests := []struct {
+		name      string
+		sessionID string
+		messageID int
+		tags      []string
+	}{
+		{"invalid session ID", "../etc", 1, []string{"a"}},
+		{"zero message ID", createTestSessionID(42), 0, []string{"a"}},
+		{"invalid tag", createTestSessionID(42), 1, []string{"a\x00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := index.SetTags(tt.sessionID, tt.messageID, tt.tags); err == nil {
+				t.Error("SetTags() error = nil, want error")
+			}
+		})
+	}
+
+	if _, err := index.Find("../etc", "a"); err == nil {
+		t.Error("Find() error = nil, want error for invalid session ID")
+	}
+}
@@ -0,0 +1,123 @@
+package persistence
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const (
+	// MaxUploadsPerSession bounds the reference images one session can keep
+	// on disk.
+	MaxUploadsPerSession = 50
+)
+
+var (
+	// ErrTooManyUploads is returned when a session already holds
+	// MaxUploadsPerSession reference images
+	ErrTooManyUploads = errors.New("too many uploaded images")
+)
+
+// validUploadIDPattern matches generated upload IDs (16 lowercase hex characters).
+var validUploadIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// Reference images uploaded for img2img and inpainting are stored next to
+// the session's generated images:
+//
+//	config/sessions/{session_id}/uploads/{upload_id}.png
+//
+// They are removed with the session directory. With SetEncryptor they are
+// encrypted at rest, as they can hold the prompt another tool embedded in
+// them.
+
+// SaveUpload stores a reference image for a session and returns its
+// generated upload ID. The data must already be a validated PNG.
+//
+// Returns ErrTooManyUploads if the session holds MaxUploadsPerSession
+// uploads, and ErrQuotaExceeded if the image doesn't fit in the quota.
+func (s *ImageStore) SaveUpload(sessionID string, pngData []byte) (string, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return "", fmt.Errorf("invalid session ID: %w", err)
+	}
+	if len(pngData) == 0 {
+		return "", fmt.Errorf("PNG data cannot be empty")
+	}
+	if len(pngData) > MaxImageSizeBytes {
+		return "", fmt.Errorf("image size %d bytes exceeds maximum %d bytes", len(pngData), MaxImageSizeBytes)
+	}
+
+	uploadsDir := filepath.Join(s.basePath, sessionID, "uploads")
+	existing, err := filepath.Glob(filepath.Join(uploadsDir, "*.png"))
+	if err != nil {
+		return "", fmt.Errorf("failed to list uploads: %w", err)
+	}
+	if len(existing) >= MaxUploadsPerSession {
+		return "", fmt.Errorf("%w: limit is %d", ErrTooManyUploads, MaxUploadsPerSession)
+	}
+	data := pngData
+	if s.encryptor != nil {
+		sealed, err := s.encryptor.Seal(pngData)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt upload: %w", err)
+		}
+		data = sealed
+	}
+	if err := s.reserve(int64(len(data))); err != nil {
+		return "", err
+	}
+
+	uploadID, err := newUploadID()
+	if err != nil {
+		return "", err
+	}
+
+	// 0700: owner-only access
+	if err := os.MkdirAll(uploadsDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create uploads directory: %w", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(uploadsDir, uploadID+".png"), data); err != nil {
+		return "", err
+	}
+	return uploadID, nil
+}
+
+// LoadUpload reads a session's reference image, decrypting it if needed.
+// Returns os.ErrNotExist if the upload doesn't exist.
+func (s *ImageStore) LoadUpload(sessionID string, uploadID string) ([]byte, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+	if err := validateUploadID(uploadID); err != nil {
+		return nil, err
+	}
+
+	return readSealed(s.encryptor, s.GetUploadPath(sessionID, uploadID))
+}
+
+// GetUploadPath returns the filesystem path for a reference image:
+// {basePath}/{sessionID}/uploads/{uploadID}.png
+func (s *ImageStore) GetUploadPath(sessionID string, uploadID string) string {
+	return filepath.Join(s.basePath, sessionID, "uploads", uploadID+".png")
+}
+
+// validateUploadID validates that an upload ID is safe to use in file paths.
+func validateUploadID(uploadID string) error {
+	if !validUploadIDPattern.MatchString(uploadID) {
+		return fmt.Errorf("upload ID must be 16 lowercase hexadecimal characters")
+	}
+	return nil
+}
+
+// newUploadID generates a random 16-character hex upload ID.
+func newUploadID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate upload ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
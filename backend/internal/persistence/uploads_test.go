@@ -0,0 +1,111 @@
+package persistence
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestImageStore_SaveUpload(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(1)
+	data := createTestPNGData(100)
+
+	uploadID, err := store.SaveUpload(sessionID, data)
+	if err != nil {
+		t.Fatalf("SaveUpload() error = %v", err)
+	}
+	if err := validateUploadID(uploadID); err != nil {
+		t.Errorf("SaveUpload() ID %q is invalid: %v", uploadID, err)
+	}
+
+	got, err := store.LoadUpload(sessionID, uploadID)
+	if err != nil {
+		t.Fatalf("LoadUpload() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("LoadUpload() returned different data")
+	}
+
+	// Uploads belong to the session that made them
+	if _, err := store.LoadUpload(createTestSessionID(2), uploadID); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadUpload() from another session error = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestImageStore_SaveUpload_Encrypted(t *testing.T) {
+	tmpDir := t.TempDir()
+	enc, _ := NewEncryptor(bytes.Repeat([]byte{7}, keySize))
+	store := NewImageStore(tmpDir)
+	store.SetEncryptor(enc)
+	sessionID := createTestSessionID(3)
+	// An upload keeps the prompt another tool embedded in a text chunk
+	data := append(createTestPNGData(100), []byte("tEXtparameters\x00a secret garden")...)
+
+	uploadID, err := store.SaveUpload(sessionID, data)
+	if err != nil {
+		t.Fatalf("SaveUpload() error = %v", err)
+	}
+
+	stored, err := os.ReadFile(store.GetUploadPath(sessionID, uploadID))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !IsEncrypted(stored) || bytes.Contains(stored, []byte("secret garden")) {
+		t.Error("upload was written in plaintext")
+	}
+
+	got, err := store.LoadUpload(sessionID, uploadID)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("LoadUpload() = %d bytes, %v, want the decrypted upload", len(got), err)
+	}
+	if _, err := NewImageStore(tmpDir).LoadUpload(sessionID, uploadID); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("LoadUpload() without a key error = %v, want ErrEncrypted", err)
+	}
+}
+
+func TestImageStore_SaveUpload_Invalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		sessionID string
+		pngData   []byte
+	}{
+		{name: "invalid session", sessionID: "../etc", pngData: createTestPNGData(100)},
+		{name: "empty data", sessionID: createTestSessionID(1), pngData: nil},
+		{name: "too large", sessionID: createTestSessionID(1), pngData: make([]byte, MaxImageSizeBytes+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewImageStore(t.TempDir())
+			if _, err := store.SaveUpload(tt.sessionID, tt.pngData); err == nil {
+				t.Error("SaveUpload() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestImageStore_SaveUpload_Limit(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+	sessionID := createTestSessionID(1)
+
+	for i := range MaxUploadsPerSession {
+		if _, err := store.SaveUpload(sessionID, createTestPNGData(10)); err != nil {
+			t.Fatalf("SaveUpload() %d error = %v", i, err)
+		}
+	}
+	if _, err := store.SaveUpload(sessionID, createTestPNGData(10)); !errors.Is(err, ErrTooManyUploads) {
+		t.Errorf("SaveUpload() over limit error = %v, want ErrTooManyUploads", err)
+	}
+}
+
+func TestImageStore_LoadUpload_InvalidID(t *testing.T) {
+	store := NewImageStore(t.TempDir())
+
+	for _, uploadID := range []string{"", "../../secret", "0123456789ABCDEF", "0123"} {
+		if _, err := store.LoadUpload(createTestSessionID(1), uploadID); err == nil || errors.Is(err, os.ErrNotExist) {
+			t.Errorf("LoadUpload(%q) error = %v, want validation error", uploadID, err)
+		}
+	}
+}
@@ -11,6 +11,10 @@ import (
 // - Fixed length of 32 characters (matching session ID generation)
 var validSessionIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
 
+// validChatIDPattern matches generated chat IDs (16 lowercase hex characters).
+// The default chat is never stored under its ID, so it is not accepted here.
+var validChatIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
 // validateSessionID validates that a session ID is safe to use in file paths.
 // It checks for:
 // - Empty string
@@ -40,3 +44,11 @@ func validateSessionID(sessionID string) error {
 
 	return nil
 }
+
+// validateChatID validates that a chat ID is safe to use in file paths.
+func validateChatID(chatID string) error {
+	if !validChatIDPattern.MatchString(chatID) {
+		return fmt.Errorf("chat ID must be 16 lowercase hexadecimal characters")
+	}
+	return nil
+}
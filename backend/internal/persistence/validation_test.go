@@ -96,3 +96,27 @@ func TestValidateSessionID(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateChatID(t *testing.T) {
+	tests := []struct {
+		name    string
+		chatID  string
+		wantErr bool
+	}{
+		{name: "valid chat ID", chatID: "0123456789abcdef", wantErr: false},
+		{name: "default chat is not a file-backed chat", chatID: "main", wantErr: true},
+		{name: "empty string", chatID: "", wantErr: true},
+		{name: "uppercase hex", chatID: "0123456789ABCDEF", wantErr: true},
+		{name: "path traversal", chatID: "../../../../etc", wantErr: true},
+		{name: "session ID length", chatID: "abcdef0123456789abcdef0123456789", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateChatID(tt.chatID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateChatID(%q) error = %v, wantErr %v", tt.chatID, err, tt.wantErr)
+			}
+		})
+	}
+}
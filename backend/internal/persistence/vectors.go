@@ -0,0 +1,227 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	// vectorsFileName is the name of a session's vector store within its directory
+	vectorsFileName = "embeddings.json"
+
+	// MaxEmbeddingsPerSession limits the embeddings kept per session. The
+	// embeddings of the oldest messages are dropped first.
+	MaxEmbeddingsPerSession = 5000
+)
+
+// Kinds of message text that are embedded.
+const (
+	// EmbeddingPrompt is the image prompt an assistant message set
+	EmbeddingPrompt = "prompt"
+	// EmbeddingReply is the text of an assistant message
+	EmbeddingReply = "reply"
+)
+
+// EmbeddingKey identifies an embedded text: the prompt or reply of a
+// message. Message IDs are unique across a session's chats.
+type EmbeddingKey struct {
+	MessageID int    `json:"message_id"`
+	Kind      string `json:"kind"`
+}
+
+// Embedding is the vector of one embedded text. The text itself is not
+// stored; it stays in the conversation.
+type Embedding struct {
+	EmbeddingKey
+	Vector []float32 `json:"vector"`
+}
+
+// VectorMatch is a search result. Score is the cosine similarity to the
+// query, from -1 to 1; higher is more similar.
+type VectorMatch struct {
+	EmbeddingKey
+	Score float64
+}
+
+// vectorsFile is the on-disk form of a session's vector store. Vectors from
+// different models can't be compared, so the store is emptied when the
+// embedding model changes.
+type vectorsFile struct {
+	Model      string      `json:"model"`
+	Embeddings []Embedding `json:"embeddings"`
+}
+
+// VectorStore keeps the embeddings of each session's prompts and replies
+// for semantic search. Each session's embeddings are stored next to its
+// images so they are removed with the session, and searched by comparing
+// the query with every vector, which is fast enough at
+// MaxEmbeddingsPerSession.
+//
+// Storage structure:
+//
+//	config/sessions/{session_id}/embeddings.json
+type VectorStore struct {
+	mu       sync.Mutex
+	basePath string
+}
+
+// NewVectorStore creates a vector store rooted at the specified base path.
+// The base path is typically "config/sessions".
+func NewVectorStore(basePath string) *VectorStore {
+	return &VectorStore{
+		basePath: basePath,
+	}
+}
+
+// Keys returns the texts of a session that have embeddings from model.
+func (v *VectorStore) Keys(sessionID, model string) (map[EmbeddingKey]bool, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	embeddings, err := v.loadLocked(sessionID, model)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[EmbeddingKey]bool, len(embeddings))
+	for _, e := range embeddings {
+		keys[e.EmbeddingKey] = true
+	}
+	return keys, nil
+}
+
+// Add stores embeddings computed by model, replacing any with the same key.
+// Embeddings from another model are discarded.
+func (v *VectorStore) Add(sessionID, model string, embeddings []Embedding) error {
+	if err := validateSessionID(sessionID); err != nil {
+		return fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	stored, err := v.loadLocked(sessionID, model)
+	if err != nil {
+		return err
+	}
+
+	added := make(map[EmbeddingKey]bool, len(embeddings))
+	for _, e := range embeddings {
+		added[e.EmbeddingKey] = true
+	}
+	kept := make([]Embedding, 0, len(stored)+len(embeddings))
+	for _, e := range stored {
+		if !added[e.EmbeddingKey] {
+			kept = append(kept, e)
+		}
+	}
+	kept = append(kept, embeddings...)
+
+	if len(kept) > MaxEmbeddingsPerSession {
+		sort.SliceStable(kept, func(i, j int) bool {
+			return kept[i].MessageID < kept[j].MessageID
+		})
+		kept = kept[len(kept)-MaxEmbeddingsPerSession:]
+	}
+	return v.saveLocked(sessionID, vectorsFile{Model: model, Embeddings: kept})
+}
+
+// Search returns the session's embeddings from model most similar to
+// query, best first. limit <= 0 returns them all.
+func (v *VectorStore) Search(sessionID, model string, query []float32, limit int) ([]VectorMatch, error) {
+	if err := validateSessionID(sessionID); err != nil {
+		return nil, fmt.Errorf("invalid session ID: %w", err)
+	}
+
+	v.mu.Lock()
+	embeddings, err := v.loadLocked(sessionID, model)
+	v.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]VectorMatch, 0, len(embeddings))
+	for _, e := range embeddings {
+		matches = append(matches, VectorMatch{
+			EmbeddingKey: e.EmbeddingKey,
+			Score:        cosineSimilarity(query, e.Vector),
+		})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b, or 0
+// if their lengths differ or either is zero.
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// loadLocked reads a session's embeddings from model. A missing file, or
+// one written with another model, is treated as no embeddings.
+// Must be called with v.mu held.
+func (v *VectorStore) loadLocked(sessionID, model string) ([]Embedding, error) {
+	data, err := os.ReadFile(v.path(sessionID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Embedding{}, nil
+		}
+		return nil, fmt.Errorf("failed to read embeddings: %w", err)
+	}
+
+	var file vectorsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse embeddings: %w", err)
+	}
+	if file.Model != model {
+		return []Embedding{}, nil
+	}
+	return file.Embeddings, nil
+}
+
+// saveLocked writes a session's embeddings atomically.
+// Must be called with v.mu held.
+func (v *VectorStore) saveLocked(sessionID string, file vectorsFile) error {
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to serialize embeddings: %w", err)
+	}
+
+	path := v.path(sessionID)
+
+	// 0700: owner-only access
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// path returns the vector store file for a session.
+func (v *VectorStore) path(sessionID string) string {
+	return filepath.Join(v.basePath, sessionID, vectorsFileName)
+}
@@ -0,0 +1,136 @@
+package persistence
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVectorStore_AddSearch(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := NewVectorStore(tmpDir)
+	sessionID := createTestSessionID(60)
+
+	err := store.Add(sessionID, "nomic", []Embedding{
+		{EmbeddingKey{1, EmbeddingReply}, []float32{1, 0}},
+		{EmbeddingKey{2, EmbeddingPrompt}, []float32{0, 1}},
+		{EmbeddingKey{3, EmbeddingPrompt}, []float32{1, 1}},
+	})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	// Re-embedding a text replaces its vector
+	if err := store.Add(sessionID, "nomic", []Embedding{{EmbeddingKey{2, EmbeddingPrompt}, []float32{-1, 0}}}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	// A new store on the same path sees the persisted embeddings
+	matches, err := NewVectorStore(tmpDir).Search(sessionID, "nomic", []float32{2, 0}, 0)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	want := []EmbeddingKey{{1, EmbeddingReply}, {3, EmbeddingPrompt}, {2, EmbeddingPrompt}}
+	if len(matches) != len(want) {
+		t.Fatalf("Search() = %v, want keys %v", matches, want)
+	}
+	for i := range want {
+		if matches[i].EmbeddingKey != want[i] {
+			t.Errorf("Search()[%d] = %v, want %v", i, matches[i].EmbeddingKey, want[i])
+		}
+	}
+	if math.Abs(matches[0].Score-1) > 1e-6 {
+		t.Errorf("Search()[0].Score = %v, want 1", matches[0].Score)
+	}
+
+	limited, err := store.Search(sessionID, "nomic", []float32{2, 0}, 1)
+	if err != nil || len(limited) != 1 {
+		t.Errorf("Search() with limit 1 = %v, %v, want 1 match", limited, err)
+	}
+
+	keys, err := store.Keys(sessionID, "nomic")
+	if err != nil || len(keys) != 3 || !keys[EmbeddingKey{2, EmbeddingPrompt}] {
+		t.Errorf("Keys() = %v, %v, want the 3 embedded texts", keys, err)
+	}
+}
+
+func TestVectorStore_ModelChange(t *testing.T) {
+	store := NewVectorStore(t.TempDir())
+	sessionID := createTestSessionID(61)
+
+	if err := store.Add(sessionID, "nomic", []Embedding{{EmbeddingKey{1, EmbeddingReply}, []float32{1, 0}}}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	keys, err := store.Keys(sessionID, "mxbai")
+	if err != nil || len(keys) != 0 {
+		t.Errorf("Keys() for another model = %v, %v, want empty", keys, err)
+	}
+
+	// Adding with the new model discards the old vectors
+	if err := store.Add(sessionID, "mxbai", []Embedding{{EmbeddingKey{2, EmbeddingReply}, []float32{0, 1, 0}}}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	keys, err = store.Keys(sessionID, "nomic")
+	if err != nil || len(keys) != 0 {
+		t.Errorf("Keys() for the old model = %v, %v, want empty", keys, err)
+	}
+}
+
+func TestVectorStore_Limit(t *testing.T) {
+	store := NewVectorStore(t.TempDir())
+	sessionID := createTestSessionID(62)
+
+	embeddings := make([]Embedding, MaxEmbeddingsPerSession+1)
+	for i := range embeddings {
+		// Newest first, so the cap can't rely on insertion order
+		embeddings[i] = Embedding{EmbeddingKey{len(embeddings) - i, EmbeddingReply}, []float32{1}}
+	}
+	if err := store.Add(sessionID, "nomic", embeddings); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	keys, err := store.Keys(sessionID, "nomic")
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	if len(keys) != MaxEmbeddingsPerSession {
+		t.Errorf("Keys() length = %d, want %d", len(keys), MaxEmbeddingsPerSession)
+	}
+	if keys[EmbeddingKey{1, EmbeddingReply}] {
+		t.Error("oldest message kept past the limit")
+	}
+}
+
+func TestVectorStore_InvalidSessionID(t *testing.T) {
+	store := NewVectorStore(t.TempDir())
+
+	if err := store.Add("../etc", "nomic", nil); err == nil {
+		t.Error("Add() error = nil, want error")
+	}
+	if _, err := store.Keys("../etc", "nomic"); err == nil {
+		t.Error("Keys() error = nil, want error")
+	}
+	if _, err := store.Search("../etc", "nomic", nil, 0); err == nil {
+		t.Error("Search() error = nil, want error")
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"same direction", []float32{1, 2}, []float32{2, 4}, 1},
+		{"orthogonal", []float32{1, 0}, []float32{0, 3}, 0},
+		{"opposite", []float32{1, 1}, []float32{-1, -1}, -1},
+		{"different lengths", []float32{1}, []float32{1, 0}, 0},
+		{"zero vector", []float32{0, 0}, []float32{1, 0}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cosineSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("cosineSimilarity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
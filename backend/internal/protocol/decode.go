@@ -9,7 +9,8 @@ import (
 )
 
 // DecodeResponse decodes a response message from the given byte slice.
-// It returns either a *SD35GenerateResponse or *ErrorResponse depending on the message type.
+// It returns a *SD35GenerateResponse, *PongResponse, *ModelsResponse, *Capabilities,
+// *HelloResponse, *PreviewFrame or *ErrorResponse depending on the message type.
 // Returns an error if the message is invalid, truncated, or malformed.
 func DecodeResponse(data []byte) (interface{}, error) {
 	// Validate minimum message size (common header = 16 bytes)
@@ -23,8 +24,9 @@ func DecodeResponse(data []byte) (interface{}, error) {
 		return nil, err
 	}
 
-	// Validate payload length
-	if header.PayloadLen > MaxMessageSize {
+	// Validate payload length; only a message reassembled from chunks
+	// (FlagChunked), whose payload is all there, may be larger
+	if header.PayloadLen > MaxMessageSize && uint64(len(data)) < 16+uint64(header.PayloadLen) {
 		return nil, fmt.Errorf("%w: payload_len %d exceeds max %d", ErrMessageTooLarge, header.PayloadLen, MaxMessageSize)
 	}
 
@@ -38,10 +40,20 @@ func DecodeResponse(data []byte) (interface{}, error) {
 	switch header.MsgType {
 	case MsgGenerateResponse:
 		return decodeGenerateResponse(header, data[16:16+header.PayloadLen])
+	case MsgPong:
+		return decodePongResponse(header, data[16:16+header.PayloadLen])
+	case MsgModelsResponse:
+		return decodeModelsResponse(header, data[16:16+header.PayloadLen])
+	case MsgCapabilitiesResponse:
+		return decodeCapabilities(header, data[16:16+header.PayloadLen])
+	case MsgHelloResponse:
+		return decodeHelloResponse(header, data[16:16+header.PayloadLen])
+	case MsgPreview:
+		return decodePreviewFrame(header, data[16:16+header.PayloadLen])
 	case MsgError:
 		return decodeErrorResponse(header, data[16:16+header.PayloadLen])
 	default:
-		return nil, fmt.Errorf("unexpected message type: 0x%04X (expected RESPONSE or ERROR)", header.MsgType)
+		return nil, fmt.Errorf("unexpected message type: 0x%04X (expected RESPONSE, PONG, MODELS_RESPONSE, CAPABILITIES_RESPONSE, PREVIEW or ERROR)", header.MsgType)
 	}
 }
 
@@ -96,6 +108,12 @@ func decodeHeader(data []byte) (Header, error) {
 //   - image_data_len (4 bytes)
 //   - image_data (variable)
 func decodeGenerateResponse(header Header, payload []byte) (*SD35GenerateResponse, error) {
+	// The client replaces a shared memory segment name with the pixels
+	// before the response is decoded
+	if header.Reserved&FlagSharedMemory != 0 {
+		return nil, fmt.Errorf("generate response image data is in shared memory, not inline")
+	}
+
 	// Minimum payload: common response (16) + image header (16) = 32 bytes
 	if len(payload) < 32 {
 		return nil, fmt.Errorf("generate response payload too small: got %d bytes, need at least 32", len(payload))
@@ -177,9 +195,66 @@ func decodeGenerateResponse(header Header, payload []byte) (*SD35GenerateRespons
 		return nil, fmt.Errorf("failed to read image data: %w", err)
 	}
 
+	// The seed follows the image
+	if header.Reserved&FlagSeed != 0 {
+		if err := binary.Read(buf, binary.BigEndian, &resp.Seed); err != nil {
+			return nil, fmt.Errorf("failed to read seed: %w", err)
+		}
+	}
+
+	// Then the metadata
+	if header.Reserved&FlagMetadata != 0 {
+		metadata, err := decodeGenerationMetadata(buf)
+		if err != nil {
+			return nil, err
+		}
+		resp.Metadata = metadata
+	}
+
 	return &resp, nil
 }
 
+// decodeGenerationMetadata reads the GenerationMetadata that ends a generate
+// response with FlagMetadata:
+//   - model_hash_len (2 bytes), model_hash (model_hash_len bytes)
+//   - sampler_len (2 bytes), sampler (sampler_len bytes)
+//   - scheduler_len (2 bytes), scheduler (scheduler_len bytes)
+//   - text_encode_ms (4 bytes), diffusion_ms (4 bytes), vae_ms (4 bytes)
+func decodeGenerationMetadata(buf *bytes.Reader) (*GenerationMetadata, error) {
+	var metadata GenerationMetadata
+	for _, field := range []struct {
+		name string
+		dst  *string
+	}{
+		{"model_hash", &metadata.ModelHash},
+		{"sampler", &metadata.Sampler},
+		{"scheduler", &metadata.Scheduler},
+	} {
+		var n uint16
+		if err := binary.Read(buf, binary.BigEndian, &n); err != nil {
+			return nil, fmt.Errorf("failed to read %s_len: %w", field.name, err)
+		}
+		value := make([]byte, n)
+		if _, err := io.ReadFull(buf, value); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", field.name, err)
+		}
+		*field.dst = string(value)
+	}
+	for _, field := range []struct {
+		name string
+		dst  *uint32
+	}{
+		{"text_encode_ms", &metadata.TextEncodeMS},
+		{"diffusion_ms", &metadata.DiffusionMS},
+		{"vae_ms", &metadata.VAEMS},
+	} {
+		if err := binary.Read(buf, binary.BigEndian, field.dst); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", field.name, err)
+		}
+	}
+	return &metadata, nil
+}
+
 // decodeErrorResponse decodes a MSG_ERROR payload (status 400/500).
 // Payload structure:
 //   - request_id (8 bytes)
@@ -234,3 +309,157 @@ func decodeErrorResponse(header Header, payload []byte) (*ErrorResponse, error)
 
 	return &resp, nil
 }
+
+// decodePongResponse decodes a PONG payload, which is only the request ID.
+func decodePongResponse(header Header, payload []byte) (*PongResponse, error) {
+	if len(payload) != 8 {
+		return nil, fmt.Errorf("pong payload must be 8 bytes, got %d", len(payload))
+	}
+	return &PongResponse{
+		Header:    header,
+		RequestID: binary.BigEndian.Uint64(payload),
+	}, nil
+}
+
+// decodeModelsResponse decodes a MODELS_RESPONSE payload.
+// Payload structure:
+//   - request_id (8 bytes)
+//   - model_count (4 bytes)
+//   - per model: model_id (4), status (4), vram_mb (4), name_len (4), name
+func decodeModelsResponse(header Header, payload []byte) (*ModelsResponse, error) {
+	if len(payload) < 12 {
+		return nil, fmt.Errorf("models response payload too small: got %d bytes, need at least 12", len(payload))
+	}
+	models, err := decodeModelList(payload[8:])
+	if err != nil {
+		return nil, fmt.Errorf("models response: %w", err)
+	}
+	return &ModelsResponse{
+		Header:    header,
+		RequestID: binary.BigEndian.Uint64(payload[0:8]),
+		Models:    models,
+	}, nil
+}
+
+// decodeCapabilities decodes a CAPABILITIES_RESPONSE payload.
+// Payload structure:
+//   - request_id (8 bytes)
+//   - min_version (2 bytes), max_version (2 bytes)
+//   - request_types (4 bytes)
+//   - max_width (4), max_height (4), vram_total_mb (4), vram_free_mb (4)
+//   - model_count (4 bytes) and the models, as in a models response
+func decodeCapabilities(header Header, payload []byte) (*Capabilities, error) {
+	if len(payload) < 36 {
+		return nil, fmt.Errorf("capabilities payload too small: got %d bytes, need at least 36", len(payload))
+	}
+	models, err := decodeModelList(payload[32:])
+	if err != nil {
+		return nil, fmt.Errorf("capabilities: %w", err)
+	}
+	return &Capabilities{
+		Header:       header,
+		RequestID:    binary.BigEndian.Uint64(payload[0:8]),
+		MinVersion:   binary.BigEndian.Uint16(payload[8:10]),
+		MaxVersion:   binary.BigEndian.Uint16(payload[10:12]),
+		RequestTypes: binary.BigEndian.Uint32(payload[12:16]),
+		MaxWidth:     binary.BigEndian.Uint32(payload[16:20]),
+		MaxHeight:    binary.BigEndian.Uint32(payload[20:24]),
+		VRAMTotalMB:  binary.BigEndian.Uint32(payload[24:28]),
+		VRAMFreeMB:   binary.BigEndian.Uint32(payload[28:32]),
+		Models:       models,
+	}, nil
+}
+
+// decodeHelloResponse decodes a HELLO_RESPONSE payload.
+// Payload structure:
+//   - request_id (8 bytes)
+//   - version (2 bytes), min_version (2 bytes), max_version (2 bytes)
+//   - flags (2 bytes), the header flags compute accepts
+func decodeHelloResponse(header Header, payload []byte) (*HelloResponse, error) {
+	if len(payload) != 16 {
+		return nil, fmt.Errorf("hello payload must be 16 bytes, got %d", len(payload))
+	}
+	return &HelloResponse{
+		Header:     header,
+		RequestID:  binary.BigEndian.Uint64(payload[0:8]),
+		Version:    binary.BigEndian.Uint16(payload[8:10]),
+		MinVersion: binary.BigEndian.Uint16(payload[10:12]),
+		MaxVersion: binary.BigEndian.Uint16(payload[12:14]),
+		Flags:      binary.BigEndian.Uint16(payload[14:16]),
+	}, nil
+}
+
+// decodeModelList decodes a model count followed by that many model
+// entries: model_id (4), status (4), vram_mb (4), name_len (4), name. The
+// list must end the payload.
+func decodeModelList(data []byte) ([]ModelInfo, error) {
+	count := binary.BigEndian.Uint32(data[0:4])
+	rest := data[4:]
+	// Each entry takes at least 17 bytes, which bounds count before allocating
+	if uint64(count)*17 > uint64(len(rest)) {
+		return nil, fmt.Errorf("truncated model list: %d models in %d bytes", count, len(rest))
+	}
+	models := make([]ModelInfo, 0, count)
+	for i := uint32(0); i < count; i++ {
+		if len(rest) < 16 {
+			return nil, fmt.Errorf("truncated model list at model %d", i)
+		}
+		nameLen := binary.BigEndian.Uint32(rest[12:16])
+		if nameLen == 0 || nameLen > MaxModelNameLen {
+			return nil, fmt.Errorf("invalid model name length %d at model %d", nameLen, i)
+		}
+		if uint32(len(rest)-16) < nameLen {
+			return nil, fmt.Errorf("truncated model list at model %d name", i)
+		}
+		models = append(models, ModelInfo{
+			ModelID: binary.BigEndian.Uint32(rest[0:4]),
+			Status:  binary.BigEndian.Uint32(rest[4:8]),
+			VRAMMB:  binary.BigEndian.Uint32(rest[8:12]),
+			Name:    string(rest[16 : 16+nameLen]),
+		})
+		rest = rest[16+nameLen:]
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after model list", len(rest))
+	}
+	return models, nil
+}
+
+// decodePreviewFrame decodes a MSG_PREVIEW payload.
+// Payload structure:
+//   - request_id (8 bytes)
+//   - step (4 bytes), steps (4 bytes)
+//   - width (4 bytes), height (4 bytes), channels (4 bytes)
+//   - image_data_len (4 bytes)
+//   - image_data (width * height * 3 bytes)
+func decodePreviewFrame(header Header, payload []byte) (*PreviewFrame, error) {
+	if len(payload) < 32 {
+		return nil, fmt.Errorf("preview payload too small: got %d bytes, need at least 32", len(payload))
+	}
+	frame := &PreviewFrame{
+		Header:       header,
+		RequestID:    binary.BigEndian.Uint64(payload[0:8]),
+		Step:         binary.BigEndian.Uint32(payload[8:12]),
+		Steps:        binary.BigEndian.Uint32(payload[12:16]),
+		Width:        binary.BigEndian.Uint32(payload[16:20]),
+		Height:       binary.BigEndian.Uint32(payload[20:24]),
+		Channels:     binary.BigEndian.Uint32(payload[24:28]),
+		ImageDataLen: binary.BigEndian.Uint32(payload[28:32]),
+	}
+
+	if frame.Width < 1 || frame.Width > PreviewMaxDimension || frame.Height < 1 || frame.Height > PreviewMaxDimension {
+		return nil, fmt.Errorf("%w: preview %dx%d not within 1-%d", ErrInvalidDimensions, frame.Width, frame.Height, PreviewMaxDimension)
+	}
+	if frame.Channels != SD35ChannelsRGB {
+		return nil, fmt.Errorf("invalid preview channels: got %d, expected %d (RGB)", frame.Channels, SD35ChannelsRGB)
+	}
+	if frame.Step < 1 || frame.Step > frame.Steps {
+		return nil, fmt.Errorf("invalid preview step %d of %d", frame.Step, frame.Steps)
+	}
+	if frame.ImageDataLen != frame.Width*frame.Height*SD35ChannelsRGB || int(frame.ImageDataLen) != len(payload)-32 {
+		return nil, fmt.Errorf("preview image_data_len %d does not match %dx%d RGB and payload %d bytes",
+			frame.ImageDataLen, frame.Width, frame.Height, len(payload))
+	}
+	frame.ImageData = payload[32:]
+	return frame, nil
+}
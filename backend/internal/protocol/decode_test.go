@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"math"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -360,6 +361,92 @@ func TestDecodeGenerateResponse(t *testing.T) {
 	}
 }
 
+func TestDecodeGenerateResponse_SharedMemory(t *testing.T) {
+	data := buildGenerateResponse(1, StatusOK, 1000, 64, 64, 3, 64*64*3, nil)
+	binary.BigEndian.PutUint32(data[12:16], FlagSharedMemory)
+	if _, err := DecodeResponse(data); err == nil || !strings.Contains(err.Error(), "shared memory") {
+		t.Errorf("DecodeResponse() error = %v, want the image is in shared memory", err)
+	}
+}
+
+func TestDecodeGenerateResponse_Seed(t *testing.T) {
+	pixels := make([]byte, 64*64*3)
+	data := buildGenerateResponse(1, StatusOK, 1000, 64, 64, 3, 64*64*3, pixels)
+	data = binary.BigEndian.AppendUint64(data, 1234567890)
+	binary.BigEndian.PutUint32(data[8:12], uint32(len(data)-16))
+	binary.BigEndian.PutUint32(data[12:16], FlagSeed)
+
+	decoded, err := DecodeResponse(data)
+	if err != nil {
+		t.Fatalf("DecodeResponse() error = %v", err)
+	}
+	if resp := decoded.(*SD35GenerateResponse); resp.Seed != 1234567890 || len(resp.ImageData) != len(pixels) {
+		t.Errorf("DecodeResponse() seed = %d with %d bytes of image, want 1234567890 with %d", resp.Seed, len(resp.ImageData), len(pixels))
+	}
+
+	// Without the flag trailing bytes are not a seed
+	binary.BigEndian.PutUint32(data[12:16], 0)
+	if decoded, err := DecodeResponse(data); err != nil || decoded.(*SD35GenerateResponse).Seed != 0 {
+		t.Errorf("DecodeResponse() without FlagSeed failed or read a seed: %v", err)
+	}
+
+	// Missing seed
+	binary.BigEndian.PutUint32(data[12:16], FlagSeed)
+	truncated := data[:len(data)-8]
+	binary.BigEndian.PutUint32(truncated[8:12], uint32(len(truncated)-16))
+	if _, err := DecodeResponse(truncated); err == nil {
+		t.Error("DecodeResponse() without the seed succeeded, want an error")
+	}
+}
+
+func TestDecodeGenerateResponse_Metadata(t *testing.T) {
+	pixels := make([]byte, 64*64*3)
+	data := buildGenerateResponse(1, StatusOK, 1000, 64, 64, 3, 64*64*3, pixels)
+	data = binary.BigEndian.AppendUint64(data, 1234567890)
+	for _, s := range []string{"a1b2c3d4", "euler", "discrete"} {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(s)))
+		data = append(data, s...)
+	}
+	data = binary.BigEndian.AppendUint32(data, 250)
+	data = binary.BigEndian.AppendUint32(data, 9000)
+	data = binary.BigEndian.AppendUint32(data, 700)
+	binary.BigEndian.PutUint32(data[8:12], uint32(len(data)-16))
+	binary.BigEndian.PutUint32(data[12:16], FlagSeed|FlagMetadata)
+
+	decoded, err := DecodeResponse(data)
+	if err != nil {
+		t.Fatalf("DecodeResponse() error = %v", err)
+	}
+	resp := decoded.(*SD35GenerateResponse)
+	want := GenerationMetadata{
+		ModelHash:    "a1b2c3d4",
+		Sampler:      "euler",
+		Scheduler:    "discrete",
+		TextEncodeMS: 250,
+		DiffusionMS:  9000,
+		VAEMS:        700,
+	}
+	if resp.Seed != 1234567890 || resp.Metadata == nil || *resp.Metadata != want {
+		t.Errorf("DecodeResponse() seed = %d, metadata = %+v, want 1234567890 and %+v", resp.Seed, resp.Metadata, want)
+	}
+
+	// Without the flag trailing bytes are not metadata
+	binary.BigEndian.PutUint32(data[12:16], FlagSeed)
+	if decoded, err := DecodeResponse(data); err != nil || decoded.(*SD35GenerateResponse).Metadata != nil {
+		t.Errorf("DecodeResponse() without FlagMetadata failed or read metadata: %v", err)
+	}
+
+	// Truncated metadata
+	binary.BigEndian.PutUint32(data[12:16], FlagSeed|FlagMetadata)
+	for _, cut := range []int{1, 12, 20} {
+		truncated := slices.Clone(data[:len(data)-cut])
+		binary.BigEndian.PutUint32(truncated[8:12], uint32(len(truncated)-16))
+		if _, err := DecodeResponse(truncated); err == nil {
+			t.Errorf("DecodeResponse() without the last %d bytes of metadata succeeded, want an error", cut)
+		}
+	}
+}
+
 func TestDecodeGenerateResponse_OverflowCheck(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -678,3 +765,297 @@ func TestDecodeResponse_RoundTrip(t *testing.T) {
 		}
 	})
 }
+
+func TestDecodePongResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantID  uint64
+		wantErr bool
+	}{
+		{
+			name: "valid pong",
+			data: func() []byte {
+				buf := bytes.NewBuffer(buildHeader(MsgPong, 8))
+				binary.Write(buf, binary.BigEndian, uint64(1<<63|7))
+				return buf.Bytes()
+			}(),
+			wantID: 1<<63 | 7,
+		},
+		{
+			name: "short payload",
+			data: func() []byte {
+				return append(buildHeader(MsgPong, 4), 0, 0, 0, 1)
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "long payload",
+			data: func() []byte {
+				return append(buildHeader(MsgPong, 12), make([]byte, 12)...)
+			}(),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := DecodeResponse(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			pong, ok := resp.(*PongResponse)
+			if !ok {
+				t.Fatalf("DecodeResponse() returned %T, want *PongResponse", resp)
+			}
+			if pong.RequestID != tt.wantID {
+				t.Errorf("RequestID = %d, want %d", pong.RequestID, tt.wantID)
+			}
+		})
+	}
+}
+
+// buildModelsResponse returns a MODELS_RESPONSE message for request 7
+// listing models, whose IDs are their indexes.
+func buildModelsResponse(names ...string) []byte {
+	payload := new(bytes.Buffer)
+	binary.Write(payload, binary.BigEndian, uint64(7))
+	binary.Write(payload, binary.BigEndian, uint32(len(names)))
+	for i, name := range names {
+		binary.Write(payload, binary.BigEndian, uint32(i))
+		binary.Write(payload, binary.BigEndian, ModelStatusAvailable)
+		binary.Write(payload, binary.BigEndian, uint32(1000*(i+1)))
+		binary.Write(payload, binary.BigEndian, uint32(len(name)))
+		payload.WriteString(name)
+	}
+	return append(buildHeader(MsgModelsResponse, uint32(payload.Len())), payload.Bytes()...)
+}
+
+func TestDecodeModelsResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		wantNames []string
+		wantErr   bool
+	}{
+		{name: "two models", data: buildModelsResponse("sd3.5-medium", "flux1-schnell"), wantNames: []string{"sd3.5-medium", "flux1-schnell"}},
+		{name: "no models", data: buildModelsResponse(), wantNames: []string{}},
+		{name: "empty name", data: buildModelsResponse(""), wantErr: true},
+		{name: "name too long", data: buildModelsResponse(strings.Repeat("m", MaxModelNameLen+1)), wantErr: true},
+		{
+			name: "truncated name",
+			data: func() []byte {
+				data := buildModelsResponse("sd3.5-medium")
+				data = data[:len(data)-1]
+				binary.BigEndian.PutUint32(data[8:12], uint32(len(data)-16))
+				return data
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "count beyond payload",
+			data: func() []byte {
+				data := buildModelsResponse("sd3.5-medium")
+				binary.BigEndian.PutUint32(data[24:28], 0xFFFFFFFF)
+				return data
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "trailing bytes",
+			data: func() []byte {
+				data := append(buildModelsResponse("sd3.5-medium"), 0)
+				binary.BigEndian.PutUint32(data[8:12], uint32(len(data)-16))
+				return data
+			}(),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := DecodeResponse(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			models, ok := resp.(*ModelsResponse)
+			if !ok {
+				t.Fatalf("DecodeResponse() returned %T, want *ModelsResponse", resp)
+			}
+			if models.RequestID != 7 {
+				t.Errorf("RequestID = %d, want 7", models.RequestID)
+			}
+			if len(models.Models) != len(tt.wantNames) {
+				t.Fatalf("got %d models, want %d", len(models.Models), len(tt.wantNames))
+			}
+			for i, m := range models.Models {
+				if m.Name != tt.wantNames[i] || m.ModelID != uint32(i) || m.Status != ModelStatusAvailable || m.VRAMMB != uint32(1000*(i+1)) {
+					t.Errorf("model %d = %+v, want %q", i, m, tt.wantNames[i])
+				}
+			}
+		})
+	}
+}
+
+// buildCapabilities returns a CAPABILITIES_RESPONSE message for request 7
+// from a compute that accepts generate requests and pings, up to 1024x768,
+// on a 12 GB GPU, listing models as buildModelsResponse does.
+func buildCapabilities(names ...string) []byte {
+	models := buildModelsResponse(names...)[24:]
+	payload := new(bytes.Buffer)
+	binary.Write(payload, binary.BigEndian, uint64(7))
+	binary.Write(payload, binary.BigEndian, MinSupportedVersion)
+	binary.Write(payload, binary.BigEndian, MaxSupportedVersion)
+	binary.Write(payload, binary.BigEndian, uint32(1<<MsgGenerateRequest|1<<MsgPing))
+	binary.Write(payload, binary.BigEndian, uint32(1024))
+	binary.Write(payload, binary.BigEndian, uint32(768))
+	binary.Write(payload, binary.BigEndian, uint32(12288))
+	binary.Write(payload, binary.BigEndian, uint32(4096))
+	payload.Write(models)
+	return append(buildHeader(MsgCapabilitiesResponse, uint32(payload.Len())), payload.Bytes()...)
+}
+
+func TestDecodeCapabilities(t *testing.T) {
+	resp, err := DecodeResponse(buildCapabilities("sd3.5-medium"))
+	if err != nil {
+		t.Fatalf("DecodeResponse() error = %v", err)
+	}
+	caps, ok := resp.(*Capabilities)
+	if !ok {
+		t.Fatalf("DecodeResponse() returned %T, want *Capabilities", resp)
+	}
+	if caps.RequestID != 7 || caps.MinVersion != MinSupportedVersion || caps.MaxVersion != MaxSupportedVersion {
+		t.Errorf("request %d, versions %d-%d, want 7, %d-%d", caps.RequestID, caps.MinVersion, caps.MaxVersion, MinSupportedVersion, MaxSupportedVersion)
+	}
+	if caps.MaxWidth != 1024 || caps.MaxHeight != 768 || caps.VRAMTotalMB != 12288 || caps.VRAMFreeMB != 4096 {
+		t.Errorf("capabilities = %+v", caps)
+	}
+	if len(caps.Models) != 1 || caps.Models[0].Name != "sd3.5-medium" {
+		t.Errorf("Models = %+v, want sd3.5-medium", caps.Models)
+	}
+	if !caps.Supports(MsgGenerateRequest) || !caps.Supports(MsgPing) {
+		t.Error("Supports() = false for generate requests and pings")
+	}
+	if caps.Supports(MsgUpscaleRequest) || caps.Supports(MsgError) {
+		t.Error("Supports() = true for a message type compute does not accept")
+	}
+
+	truncated := buildCapabilities()[:16+35]
+	binary.BigEndian.PutUint32(truncated[8:12], 35)
+	if _, err := DecodeResponse(truncated); err == nil {
+		t.Error("DecodeResponse() of a truncated payload succeeded")
+	}
+	trailing := append(buildCapabilities("sd3.5-medium"), 0)
+	binary.BigEndian.PutUint32(trailing[8:12], uint32(len(trailing)-16))
+	if _, err := DecodeResponse(trailing); err == nil {
+		t.Error("DecodeResponse() with trailing bytes succeeded")
+	}
+}
+
+func TestDecodeHelloResponse(t *testing.T) {
+	payload := new(bytes.Buffer)
+	binary.Write(payload, binary.BigEndian, uint64(7))
+	binary.Write(payload, binary.BigEndian, ProtocolVersion1)
+	binary.Write(payload, binary.BigEndian, uint16(1))
+	binary.Write(payload, binary.BigEndian, uint16(2))
+	binary.Write(payload, binary.BigEndian, uint16(FlagLoRAs|FlagSharedMemory))
+	data := append(buildHeader(MsgHelloResponse, uint32(payload.Len())), payload.Bytes()...)
+
+	resp, err := DecodeResponse(data)
+	if err != nil {
+		t.Fatalf("DecodeResponse() error = %v", err)
+	}
+	hello, ok := resp.(*HelloResponse)
+	if !ok {
+		t.Fatalf("DecodeResponse() returned %T, want *HelloResponse", resp)
+	}
+	if hello.RequestID != 7 || hello.Version != ProtocolVersion1 || hello.MinVersion != 1 || hello.MaxVersion != 2 {
+		t.Errorf("hello = %+v, want request 7, version 1 of 1-2", hello)
+	}
+	if hello.Flags != uint16(FlagLoRAs|FlagSharedMemory) {
+		t.Errorf("Flags = 0x%04X, want LoRAs and shared memory", hello.Flags)
+	}
+
+	truncated := data[:len(data)-2]
+	binary.BigEndian.PutUint32(truncated[8:12], 14)
+	if _, err := DecodeResponse(truncated); err == nil {
+		t.Error("DecodeResponse() of a truncated payload succeeded")
+	}
+}
+
+// buildPreviewFrame returns a MSG_PREVIEW message for request 7, step 4 of
+// 20, with width x height RGB pixels of value 9.
+func buildPreviewFrame(width, height, channels uint32) []byte {
+	pixels := bytes.Repeat([]byte{9}, int(width*height*3))
+	buf := bytes.NewBuffer(buildHeader(MsgPreview, uint32(32+len(pixels))))
+	binary.Write(buf, binary.BigEndian, uint64(7))
+	binary.Write(buf, binary.BigEndian, uint32(4))
+	binary.Write(buf, binary.BigEndian, uint32(20))
+	binary.Write(buf, binary.BigEndian, width)
+	binary.Write(buf, binary.BigEndian, height)
+	binary.Write(buf, binary.BigEndian, channels)
+	binary.Write(buf, binary.BigEndian, uint32(len(pixels)))
+	buf.Write(pixels)
+	return buf.Bytes()
+}
+
+func TestDecodePreviewFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "valid preview", data: buildPreviewFrame(4, 2, 3)},
+		{name: "largest preview", data: buildPreviewFrame(PreviewMaxDimension, PreviewMaxDimension, 3)},
+		{name: "too wide", data: buildPreviewFrame(PreviewMaxDimension+1, 1, 3), wantErr: true},
+		{name: "empty", data: buildPreviewFrame(0, 2, 3), wantErr: true},
+		{name: "rgba", data: buildPreviewFrame(4, 2, 4), wantErr: true},
+		{name: "short payload", data: append(buildHeader(MsgPreview, 16), make([]byte, 16)...), wantErr: true},
+		{
+			name: "data length mismatch",
+			data: func() []byte {
+				data := buildPreviewFrame(4, 2, 3)
+				binary.BigEndian.PutUint32(data[44:48], 3)
+				return data
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "step beyond steps",
+			data: func() []byte {
+				data := buildPreviewFrame(4, 2, 3)
+				binary.BigEndian.PutUint32(data[24:28], 21)
+				return data
+			}(),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := DecodeResponse(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			frame, ok := resp.(*PreviewFrame)
+			if !ok {
+				t.Fatalf("DecodeResponse() returned %T, want *PreviewFrame", resp)
+			}
+			if frame.RequestID != 7 || frame.Step != 4 || frame.Steps != 20 {
+				t.Errorf("frame = request %d step %d/%d, want request 7 step 4/20", frame.RequestID, frame.Step, frame.Steps)
+			}
+			if len(frame.ImageData) != int(frame.Width*frame.Height*3) || frame.ImageData[0] != 9 {
+				t.Errorf("ImageData has %d bytes, want %dx%d RGB", len(frame.ImageData), frame.Width, frame.Height)
+			}
+		})
+	}
+}
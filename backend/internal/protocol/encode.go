@@ -19,9 +19,12 @@ func EncodeSD35GenerateRequest(req *SD35GenerateRequest) ([]byte, error) {
 	// Common request fields: 12 bytes (request_id=8 + model_id=4)
 	// SD35 params: 48 bytes (width=4 + height=4 + steps=4 + cfg=4 + seed=8 + offset_table=24)
 	// Prompt data: 3 * len(prompt) bytes
+	// LoRA section: only with LoRAs
 	promptLen := uint32(len(req.PromptData))
+	loras, flags := encodeLoRASection(req.LoRAs)
+	flags |= vaeTilingFlag(req.VAETiling) | priorityFlags(req.Priority)
 	sd35PayloadSize := uint32(48 + promptLen)
-	payloadLen := 12 + sd35PayloadSize
+	payloadLen := 12 + sd35PayloadSize + uint32(len(loras))
 
 	// Check total message size
 	totalSize := 16 + payloadLen // header + payload
@@ -36,8 +39,230 @@ func EncodeSD35GenerateRequest(req *SD35GenerateRequest) ([]byte, error) {
 	binary.Write(buf, binary.BigEndian, ProtocolVersion1)
 	binary.Write(buf, binary.BigEndian, MsgGenerateRequest)
 	binary.Write(buf, binary.BigEndian, payloadLen)
+	binary.Write(buf, binary.BigEndian, flags) // reserved
+
+	writeSD35Params(buf, req)
+
+	// LoRA section and prompt data (variable)
+	buf.Write(loras)
+	buf.Write(req.PromptData)
+
+	return buf.Bytes(), nil
+}
+
+// EncodeSD35Img2ImgRequest encodes an SD35Img2ImgRequest to bytes. The
+// message is laid out as a generate request with strength, init_channels
+// and init_data_len after the prompt offset table and the init image after
+// the prompt data.
+// Returns the encoded message or an error if validation fails.
+func EncodeSD35Img2ImgRequest(req *SD35Img2ImgRequest) ([]byte, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request is nil")
+	}
+	return encodeInitImageRequest(req, MsgImg2ImgRequest, nil)
+}
+
+// EncodeSD35InpaintRequest encodes an SD35InpaintRequest to bytes. The
+// message is laid out as an img2img request with mask_data_len after
+// init_data_len and the mask after the init image.
+// Returns the encoded message or an error if validation fails.
+func EncodeSD35InpaintRequest(req *SD35InpaintRequest) ([]byte, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request is nil")
+	}
+	wantLen := uint64(req.Width) * uint64(req.Height)
+	if uint64(len(req.Mask)) != wantLen {
+		return nil, fmt.Errorf("%w: mask is %d bytes, want %d for %dx%d", ErrInvalidMask, len(req.Mask), wantLen, req.Width, req.Height)
+	}
+	return encodeInitImageRequest(&req.SD35Img2ImgRequest, MsgInpaintRequest, req.Mask)
+}
+
+// EncodeSD35ControlRequest encodes an SD35ControlRequest to bytes. The
+// message is laid out as a generate request with control_type,
+// control_strength, control_channels and control_data_len after the prompt
+// offset table and the control image after the prompt data.
+// Returns the encoded message or an error if validation fails.
+func EncodeSD35ControlRequest(req *SD35ControlRequest) ([]byte, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request is nil")
+	}
+	if err := validateSD35Request(&req.SD35GenerateRequest); err != nil {
+		return nil, err
+	}
+
+	if req.ControlType >= ControlTypeCount {
+		return nil, fmt.Errorf("%w: unknown control type %d", ErrInvalidControl, req.ControlType)
+	}
+	// Written as a negation so NaN is rejected too
+	if !(req.ControlStrength > MinControlStrength && req.ControlStrength <= MaxControlStrength) {
+		return nil, fmt.Errorf("%w: strength %v not in range (%.1f, %.1f]", ErrInvalidControl, req.ControlStrength, MinControlStrength, MaxControlStrength)
+	}
+	if req.ControlChannels != SD35ChannelsRGB && req.ControlChannels != SD35ChannelsRGBA {
+		return nil, fmt.Errorf("%w: control_channels %d not %d or %d", ErrInvalidControl, req.ControlChannels, SD35ChannelsRGB, SD35ChannelsRGBA)
+	}
+	wantLen := uint64(req.Width) * uint64(req.Height) * uint64(req.ControlChannels)
+	if uint64(len(req.ControlImage)) != wantLen {
+		return nil, fmt.Errorf("%w: control image is %d bytes, want %d for %dx%dx%d", ErrInvalidControl, len(req.ControlImage), wantLen, req.Width, req.Height, req.ControlChannels)
+	}
+
+	// Common request fields and SD35 params: 60 bytes
+	// Control fields: 16 bytes (type=4 + strength=4 + channels=4 + data_len=4)
+	loras, flags := encodeLoRASection(req.LoRAs)
+	flags |= vaeTilingFlag(req.VAETiling) | priorityFlags(req.Priority)
+	payloadLen := uint64(12+48+16) + uint64(len(loras)) + uint64(len(req.PromptData)) + wantLen
+	totalSize := 16 + payloadLen
+	if totalSize > uint64(MaxMessageSize) {
+		return nil, fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrMessageTooLarge, totalSize, MaxMessageSize)
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Grow(int(totalSize))
+
+	// Common header (16 bytes)
+	binary.Write(buf, binary.BigEndian, MagicNumber)
+	binary.Write(buf, binary.BigEndian, ProtocolVersion1)
+	binary.Write(buf, binary.BigEndian, MsgControlRequest)
+	binary.Write(buf, binary.BigEndian, uint32(payloadLen))
+	binary.Write(buf, binary.BigEndian, flags) // reserved
+
+	writeSD35Params(buf, &req.SD35GenerateRequest)
+
+	// Control parameters (16 bytes)
+	binary.Write(buf, binary.BigEndian, req.ControlType)
+	binary.Write(buf, binary.BigEndian, math.Float32bits(req.ControlStrength))
+	binary.Write(buf, binary.BigEndian, req.ControlChannels)
+	binary.Write(buf, binary.BigEndian, uint32(len(req.ControlImage)))
+
+	// LoRA section and prompt data, then the control image (variable)
+	buf.Write(loras)
+	buf.Write(req.PromptData)
+	buf.Write(req.ControlImage)
+
+	return buf.Bytes(), nil
+}
+
+// EncodeUpscaleRequest encodes an UpscaleRequest to bytes.
+// Returns the encoded message or an error if validation fails.
+func EncodeUpscaleRequest(req *UpscaleRequest) ([]byte, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request is nil")
+	}
+	if req.Width == 0 || req.Width > SD35MaxWidth || req.Height == 0 || req.Height > SD35MaxHeight {
+		return nil, fmt.Errorf("%w: image %dx%d not within 1-%d", ErrInvalidDimensions, req.Width, req.Height, SD35MaxWidth)
+	}
+	if req.TargetWidth < req.Width || req.TargetHeight < req.Height ||
+		req.TargetWidth > SD35MaxWidth || req.TargetHeight > SD35MaxHeight ||
+		req.TargetWidth > req.Width*UpscaleMaxFactor || req.TargetHeight > req.Height*UpscaleMaxFactor {
+		return nil, fmt.Errorf("%w: cannot upscale %dx%d to %dx%d (at most %dx, up to %d)",
+			ErrInvalidDimensions, req.Width, req.Height, req.TargetWidth, req.TargetHeight, UpscaleMaxFactor, SD35MaxWidth)
+	}
+	if req.Channels != SD35ChannelsRGB && req.Channels != SD35ChannelsRGBA {
+		return nil, fmt.Errorf("%w: channels %d not %d or %d", ErrInvalidInitImage, req.Channels, SD35ChannelsRGB, SD35ChannelsRGBA)
+	}
+	wantLen := uint64(req.Width) * uint64(req.Height) * uint64(req.Channels)
+	if uint64(len(req.Image)) != wantLen {
+		return nil, fmt.Errorf("%w: image is %d bytes, want %d for %dx%dx%d", ErrInvalidInitImage, len(req.Image), wantLen, req.Width, req.Height, req.Channels)
+	}
+
+	// request_id=8 + width, height, channels, target_width, target_height,
+	// image_data_len=24
+	payloadLen := 32 + wantLen
+	totalSize := 16 + payloadLen
+	if totalSize > uint64(MaxMessageSize) {
+		return nil, fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrMessageTooLarge, totalSize, MaxMessageSize)
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Grow(int(totalSize))
+
+	// Common header (16 bytes)
+	binary.Write(buf, binary.BigEndian, MagicNumber)
+	binary.Write(buf, binary.BigEndian, ProtocolVersion1)
+	binary.Write(buf, binary.BigEndian, MsgUpscaleRequest)
+	binary.Write(buf, binary.BigEndian, uint32(payloadLen))
 	binary.Write(buf, binary.BigEndian, uint32(0)) // reserved
 
+	// Upscale fields (32 bytes)
+	binary.Write(buf, binary.BigEndian, req.RequestID)
+	binary.Write(buf, binary.BigEndian, req.Width)
+	binary.Write(buf, binary.BigEndian, req.Height)
+	binary.Write(buf, binary.BigEndian, req.Channels)
+	binary.Write(buf, binary.BigEndian, req.TargetWidth)
+	binary.Write(buf, binary.BigEndian, req.TargetHeight)
+	binary.Write(buf, binary.BigEndian, uint32(len(req.Image)))
+
+	// Image (variable)
+	buf.Write(req.Image)
+
+	return buf.Bytes(), nil
+}
+
+// encodeInitImageRequest encodes an img2img request, or an inpaint request
+// if msgType is MsgInpaintRequest, with mask appended.
+func encodeInitImageRequest(req *SD35Img2ImgRequest, msgType uint16, mask []byte) ([]byte, error) {
+	if err := validateSD35Request(&req.SD35GenerateRequest); err != nil {
+		return nil, err
+	}
+
+	// Written as a negation so NaN is rejected too
+	if !(req.Strength > SD35MinStrength && req.Strength <= SD35MaxStrength) {
+		return nil, fmt.Errorf("%w: strength %v not in range (%.1f, %.1f]", ErrInvalidInitImage, req.Strength, SD35MinStrength, SD35MaxStrength)
+	}
+	if req.InitChannels != SD35ChannelsRGB && req.InitChannels != SD35ChannelsRGBA {
+		return nil, fmt.Errorf("%w: init_channels %d not %d or %d", ErrInvalidInitImage, req.InitChannels, SD35ChannelsRGB, SD35ChannelsRGBA)
+	}
+	wantLen := uint64(req.Width) * uint64(req.Height) * uint64(req.InitChannels)
+	if uint64(len(req.InitImage)) != wantLen {
+		return nil, fmt.Errorf("%w: init image is %d bytes, want %d for %dx%dx%d", ErrInvalidInitImage, len(req.InitImage), wantLen, req.Width, req.Height, req.InitChannels)
+	}
+
+	// Common request fields and SD35 params: 60 bytes
+	// Img2img fields: 12 bytes (strength=4 + init_channels=4 + init_data_len=4)
+	// Inpaint adds mask_data_len: 4 bytes
+	fieldsLen := uint64(12)
+	if msgType == MsgInpaintRequest {
+		fieldsLen += 4
+	}
+	loras, flags := encodeLoRASection(req.LoRAs)
+	flags |= vaeTilingFlag(req.VAETiling) | priorityFlags(req.Priority)
+	payloadLen := uint64(12+48) + fieldsLen + uint64(len(loras)) + uint64(len(req.PromptData)) + wantLen + uint64(len(mask))
+	totalSize := 16 + payloadLen
+	if totalSize > uint64(MaxMessageSize) {
+		return nil, fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrMessageTooLarge, totalSize, MaxMessageSize)
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Grow(int(totalSize))
+
+	// Common header (16 bytes)
+	binary.Write(buf, binary.BigEndian, MagicNumber)
+	binary.Write(buf, binary.BigEndian, ProtocolVersion1)
+	binary.Write(buf, binary.BigEndian, msgType)
+	binary.Write(buf, binary.BigEndian, uint32(payloadLen))
+	binary.Write(buf, binary.BigEndian, flags) // reserved
+
+	writeSD35Params(buf, &req.SD35GenerateRequest)
+
+	// Img2img parameters (12 bytes)
+	binary.Write(buf, binary.BigEndian, math.Float32bits(req.Strength))
+	binary.Write(buf, binary.BigEndian, req.InitChannels)
+	binary.Write(buf, binary.BigEndian, uint32(len(req.InitImage)))
+	if msgType == MsgInpaintRequest {
+		binary.Write(buf, binary.BigEndian, uint32(len(mask)))
+	}
+
+	// LoRA section and prompt data, then the init image and mask (variable)
+	buf.Write(loras)
+	buf.Write(req.PromptData)
+	buf.Write(req.InitImage)
+	buf.Write(mask)
+
+	return buf.Bytes(), nil
+}
+
+// writeSD35Params writes the common request fields (12 bytes) and the SD35
+// generation parameters (48 bytes) of req to buf.
+func writeSD35Params(buf *bytes.Buffer, req *SD35GenerateRequest) {
 	// Common request fields (12 bytes)
 	binary.Write(buf, binary.BigEndian, req.RequestID)
 	binary.Write(buf, binary.BigEndian, req.ModelID)
@@ -56,11 +281,55 @@ func EncodeSD35GenerateRequest(req *SD35GenerateRequest) ([]byte, error) {
 	binary.Write(buf, binary.BigEndian, req.CLIPGLength)
 	binary.Write(buf, binary.BigEndian, req.T5Offset)
 	binary.Write(buf, binary.BigEndian, req.T5Length)
+}
 
-	// Prompt data (variable)
-	buf.Write(req.PromptData)
+// encodeLoRASection encodes the LoRA section of a request and returns it
+// with the header flags announcing it. Without LoRAs there is no section
+// and no flag, so the message is as before LoRAs were added.
+//
+// The section is lora_count (4 bytes) followed by, per LoRA, the weight
+// (float32, 4 bytes), name_len (4 bytes) and the name.
+func encodeLoRASection(loras []LoRA) ([]byte, uint32) {
+	if len(loras) == 0 {
+		return nil, 0
+	}
+	section := binary.BigEndian.AppendUint32(nil, uint32(len(loras)))
+	for _, l := range loras {
+		section = binary.BigEndian.AppendUint32(section, math.Float32bits(l.Weight))
+		section = binary.BigEndian.AppendUint32(section, uint32(len(l.Name)))
+		section = append(section, l.Name...)
+	}
+	return section, FlagLoRAs
+}
 
-	return buf.Bytes(), nil
+// vaeTilingFlag returns the header flag asking compute to decode in tiles,
+// or 0 if tiling is off.
+func vaeTilingFlag(tiling bool) uint32 {
+	if tiling {
+		return FlagVAETiling
+	}
+	return 0
+}
+
+// priorityFlags returns priority in the header bits of FlagPriorityMask.
+func priorityFlags(priority Priority) uint32 {
+	return uint32(priority) << flagPriorityShift & FlagPriorityMask
+}
+
+// ValidLoRAName reports whether name can name a LoRA: 1 to MaxLoRANameLen
+// bytes of [A-Za-z0-9._-], not starting with '.', so it cannot leave the
+// LoRA directory.
+func ValidLoRAName(name string) bool {
+	if name == "" || len(name) > MaxLoRANameLen || name[0] == '.' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
 }
 
 // validateSD35Request validates all parameters of an SD35GenerateRequest.
@@ -100,8 +369,27 @@ func validateSD35Request(req *SD35GenerateRequest) error {
 	}
 
 	// Validate model ID
-	if req.ModelID != ModelIDSD35 {
-		return fmt.Errorf("%w: model_id %d not supported (expected %d)", ErrInvalidModelID, req.ModelID, ModelIDSD35)
+	if req.ModelID > ModelIDFlux {
+		return fmt.Errorf("%w: model_id %d not supported (expected %d-%d)", ErrInvalidModelID, req.ModelID, ModelIDSD35, ModelIDFlux)
+	}
+
+	// Validate priority
+	if req.Priority > PriorityHigh {
+		return fmt.Errorf("%w: %d not in range [%d, %d]", ErrInvalidPriority, req.Priority, PriorityNormal, PriorityHigh)
+	}
+
+	// Validate LoRAs
+	if len(req.LoRAs) > MaxLoRAs {
+		return fmt.Errorf("%w: %d LoRAs exceeds maximum %d", ErrInvalidLoRA, len(req.LoRAs), MaxLoRAs)
+	}
+	for _, l := range req.LoRAs {
+		if !ValidLoRAName(l.Name) {
+			return fmt.Errorf("%w: name %q", ErrInvalidLoRA, l.Name)
+		}
+		// Written as a negation so NaN is rejected too
+		if !(l.Weight >= MinLoRAWeight && l.Weight <= MaxLoRAWeight) {
+			return fmt.Errorf("%w: %s weight %v not in range [%.1f, %.1f]", ErrInvalidLoRA, l.Name, l.Weight, MinLoRAWeight, MaxLoRAWeight)
+		}
 	}
 
 	// Validate prompt data
@@ -152,6 +440,69 @@ func validateSD35Request(req *SD35GenerateRequest) error {
 	return nil
 }
 
+// EncodePing encodes a PING message. The payload is only the request ID.
+func EncodePing(requestID uint64) []byte {
+	return encodeIDOnly(MsgPing, requestID)
+}
+
+// EncodeModelsRequest encodes a MODELS_REQUEST message, which asks compute
+// for the models it knows. The payload is only the request ID.
+func EncodeModelsRequest(requestID uint64) []byte {
+	return encodeIDOnly(MsgModelsRequest, requestID)
+}
+
+// EncodeCapabilitiesRequest encodes a CAPABILITIES_REQUEST message, which
+// asks compute what it can do. The payload is only the request ID.
+func EncodeCapabilitiesRequest(requestID uint64) []byte {
+	return encodeIDOnly(MsgCapabilitiesRequest, requestID)
+}
+
+// EncodeHelloRequest encodes a HELLO_REQUEST message, which offers compute
+// the protocol versions minVersion to maxVersion. Its header is always
+// version 1, so any compute can read it.
+func EncodeHelloRequest(requestID uint64, minVersion, maxVersion uint16) []byte {
+	buf := make([]byte, 28)
+	binary.BigEndian.PutUint32(buf[0:4], MagicNumber)
+	binary.BigEndian.PutUint16(buf[4:6], ProtocolVersion1)
+	binary.BigEndian.PutUint16(buf[6:8], MsgHelloRequest)
+	binary.BigEndian.PutUint32(buf[8:12], 12)
+	binary.BigEndian.PutUint32(buf[12:16], 0) // reserved
+	binary.BigEndian.PutUint64(buf[16:24], requestID)
+	binary.BigEndian.PutUint16(buf[24:26], minVersion)
+	binary.BigEndian.PutUint16(buf[26:28], maxVersion)
+	return buf
+}
+
+// encodeIDOnly encodes a message whose payload is only the request ID.
+func encodeIDOnly(msgType uint16, requestID uint64) []byte {
+	buf := make([]byte, 24)
+	binary.BigEndian.PutUint32(buf[0:4], MagicNumber)
+	binary.BigEndian.PutUint16(buf[4:6], ProtocolVersion1)
+	binary.BigEndian.PutUint16(buf[6:8], msgType)
+	binary.BigEndian.PutUint32(buf[8:12], 8)
+	binary.BigEndian.PutUint32(buf[12:16], 0) // reserved
+	binary.BigEndian.PutUint64(buf[16:24], requestID)
+	return buf
+}
+
+// NewSD35Img2ImgRequest creates a new SD35Img2ImgRequest that redraws
+// initImage, raw pixels of width x height x channels, from prompt. The
+// prompt is duplicated for the three encoders as in NewSD35GenerateRequest.
+func NewSD35Img2ImgRequest(requestID uint64, prompt string, width, height, steps uint32, cfgScale float32, seed uint64, strength float32, channels uint32, initImage []byte) (*SD35Img2ImgRequest, error) {
+	gen, err := NewSD35GenerateRequest(requestID, prompt, width, height, steps, cfgScale, seed)
+	if err != nil {
+		return nil, err
+	}
+	gen.Header.MsgType = MsgImg2ImgRequest
+
+	return &SD35Img2ImgRequest{
+		SD35GenerateRequest: *gen,
+		Strength:            strength,
+		InitChannels:        channels,
+		InitImage:           initImage,
+	}, nil
+}
+
 // NewSD35GenerateRequest creates a new SD35GenerateRequest with the prompt
 // automatically duplicated three times as required by the SD35 spec.
 // This is a convenience function for the common case where all three encoders
@@ -3,7 +3,9 @@ package protocol
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"math"
+	"strings"
 	"testing"
 )
 
@@ -819,3 +821,541 @@ func TestEncodeSD35GenerateRequest_HexDump(t *testing.T) {
 		t.Errorf("total message size = %d bytes, want 118", len(data))
 	}
 }
+
+func TestEncodePing(t *testing.T) {
+	got := EncodePing(0x0102030405060708)
+
+	want := append(buildHeader(MsgPing, 8), 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08)
+	if !bytes.Equal(got, want) {
+		t.Errorf("EncodePing() = % x, want % x", got, want)
+	}
+}
+
+func TestEncodeModelsRequest(t *testing.T) {
+	got := EncodeModelsRequest(0x0102030405060708)
+
+	want := append(buildHeader(MsgModelsRequest, 8), 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08)
+	if !bytes.Equal(got, want) {
+		t.Errorf("EncodeModelsRequest() = % x, want % x", got, want)
+	}
+}
+
+func TestEncodeCapabilitiesRequest(t *testing.T) {
+	got := EncodeCapabilitiesRequest(0x0102030405060708)
+
+	want := append(buildHeader(MsgCapabilitiesRequest, 8), 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08)
+	if !bytes.Equal(got, want) {
+		t.Errorf("EncodeCapabilitiesRequest() = % x, want % x", got, want)
+	}
+}
+
+func TestEncodeHelloRequest(t *testing.T) {
+	got := EncodeHelloRequest(0x0102030405060708, 1, 3)
+
+	want := append(buildHeader(MsgHelloRequest, 12), 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x00, 0x01, 0x00, 0x03)
+	if !bytes.Equal(got, want) {
+		t.Errorf("EncodeHelloRequest() = % x, want % x", got, want)
+	}
+}
+
+func TestEncodeSD35Img2ImgRequest(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0x80}, 64*64*3)
+
+	tests := []struct {
+		name     string
+		strength float32
+		channels uint32
+		image    []byte
+		wantErr  error
+	}{
+		{name: "valid", strength: 0.6, channels: SD35ChannelsRGB, image: pixels},
+		{name: "full strength", strength: 1.0, channels: SD35ChannelsRGB, image: pixels},
+		{name: "rgba", strength: 0.5, channels: SD35ChannelsRGBA, image: bytes.Repeat([]byte{0x80}, 64*64*4)},
+		{name: "zero strength", strength: 0, channels: SD35ChannelsRGB, image: pixels, wantErr: ErrInvalidInitImage},
+		{name: "strength above one", strength: 1.5, channels: SD35ChannelsRGB, image: pixels, wantErr: ErrInvalidInitImage},
+		{name: "NaN strength", strength: float32(math.NaN()), channels: SD35ChannelsRGB, image: pixels, wantErr: ErrInvalidInitImage},
+		{name: "grayscale", strength: 0.5, channels: 1, image: pixels[:64*64], wantErr: ErrInvalidInitImage},
+		{name: "wrong size", strength: 0.5, channels: SD35ChannelsRGB, image: pixels[:100], wantErr: ErrInvalidInitImage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := NewSD35Img2ImgRequest(7, "a cat", 64, 64, 28, 7.0, 42, tt.strength, tt.channels, tt.image)
+			if err != nil {
+				t.Fatalf("NewSD35Img2ImgRequest() error = %v", err)
+			}
+
+			data, err := EncodeSD35Img2ImgRequest(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("EncodeSD35Img2ImgRequest() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			promptLen := 3 * len("a cat")
+			wantPayload := 12 + 48 + 12 + promptLen + len(tt.image)
+			if got := binary.BigEndian.Uint16(data[6:8]); got != MsgImg2ImgRequest {
+				t.Errorf("msg_type = 0x%04X, want 0x%04X", got, MsgImg2ImgRequest)
+			}
+			if got := binary.BigEndian.Uint32(data[8:12]); got != uint32(wantPayload) {
+				t.Errorf("payload_len = %d, want %d", got, wantPayload)
+			}
+			if len(data) != 16+wantPayload {
+				t.Fatalf("len = %d, want %d", len(data), 16+wantPayload)
+			}
+
+			// Everything up to the prompt offset table matches a generate request
+			gen, _ := EncodeSD35GenerateRequest(&req.SD35GenerateRequest)
+			if !bytes.Equal(data[16:76], gen[16:76]) {
+				t.Errorf("request fields = % x, want % x", data[16:76], gen[16:76])
+			}
+
+			if got := math.Float32frombits(binary.BigEndian.Uint32(data[76:80])); got != tt.strength {
+				t.Errorf("strength = %v, want %v", got, tt.strength)
+			}
+			if got := binary.BigEndian.Uint32(data[80:84]); got != tt.channels {
+				t.Errorf("init_channels = %d, want %d", got, tt.channels)
+			}
+			if got := binary.BigEndian.Uint32(data[84:88]); got != uint32(len(tt.image)) {
+				t.Errorf("init_data_len = %d, want %d", got, len(tt.image))
+			}
+			if got := string(data[88 : 88+promptLen]); got != "a cata cata cat" {
+				t.Errorf("prompt data = %q", got)
+			}
+			if !bytes.Equal(data[88+promptLen:], tt.image) {
+				t.Error("init image does not end the message")
+			}
+		})
+	}
+}
+
+func TestEncodeSD35InpaintRequest_TooLarge(t *testing.T) {
+	// The largest img2img request fits; an RGBA one with a mask does not
+	pixels := make([]byte, 2048*2048*4)
+	img2img, err := NewSD35Img2ImgRequest(1, "a cat", 2048, 2048, 28, 7.0, 0, 0.5, SD35ChannelsRGBA, pixels)
+	if err != nil {
+		t.Fatalf("NewSD35Img2ImgRequest() error = %v", err)
+	}
+	if _, err := EncodeSD35Img2ImgRequest(img2img); err != nil {
+		t.Errorf("EncodeSD35Img2ImgRequest() error = %v, want nil", err)
+	}
+
+	req := &SD35InpaintRequest{SD35Img2ImgRequest: *img2img, Mask: make([]byte, 2048*2048)}
+	if _, err := EncodeSD35InpaintRequest(req); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("EncodeSD35InpaintRequest() error = %v, want %v", err, ErrMessageTooLarge)
+	}
+}
+
+func TestEncodeSD35InpaintRequest(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0x80}, 64*64*3)
+	mask := bytes.Repeat([]byte{0xFF}, 64*64)
+
+	tests := []struct {
+		name    string
+		mask    []byte
+		wantErr error
+	}{
+		{name: "valid", mask: mask},
+		{name: "mask too short", mask: mask[:100], wantErr: ErrInvalidMask},
+		{name: "RGB mask", mask: pixels, wantErr: ErrInvalidMask},
+		{name: "no mask", mask: nil, wantErr: ErrInvalidMask},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img2img, err := NewSD35Img2ImgRequest(7, "a hat", 64, 64, 28, 7.0, 42, 1.0, SD35ChannelsRGB, pixels)
+			if err != nil {
+				t.Fatalf("NewSD35Img2ImgRequest() error = %v", err)
+			}
+			req := &SD35InpaintRequest{SD35Img2ImgRequest: *img2img, Mask: tt.mask}
+
+			data, err := EncodeSD35InpaintRequest(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("EncodeSD35InpaintRequest() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			promptLen := 3 * len("a hat")
+			wantPayload := 12 + 48 + 16 + promptLen + len(pixels) + len(mask)
+			if got := binary.BigEndian.Uint16(data[6:8]); got != MsgInpaintRequest {
+				t.Errorf("msg_type = 0x%04X, want 0x%04X", got, MsgInpaintRequest)
+			}
+			if got := binary.BigEndian.Uint32(data[8:12]); got != uint32(wantPayload) {
+				t.Errorf("payload_len = %d, want %d", got, wantPayload)
+			}
+			if got := binary.BigEndian.Uint32(data[84:88]); got != uint32(len(pixels)) {
+				t.Errorf("init_data_len = %d, want %d", got, len(pixels))
+			}
+			if got := binary.BigEndian.Uint32(data[88:92]); got != uint32(len(mask)) {
+				t.Errorf("mask_data_len = %d, want %d", got, len(mask))
+			}
+			if got := string(data[92 : 92+promptLen]); got != "a hata hata hat" {
+				t.Errorf("prompt data = %q", got)
+			}
+			initStart := 92 + promptLen
+			if !bytes.Equal(data[initStart:initStart+len(pixels)], pixels) {
+				t.Error("init image does not follow the prompt data")
+			}
+			if !bytes.Equal(data[initStart+len(pixels):], mask) {
+				t.Error("mask does not end the message")
+			}
+		})
+	}
+
+	if _, err := EncodeSD35InpaintRequest(nil); err == nil {
+		t.Error("EncodeSD35InpaintRequest(nil) error = nil, want error")
+	}
+}
+
+func TestEncodeSD35GenerateRequest_LoRAs(t *testing.T) {
+	tests := []struct {
+		name    string
+		loras   []LoRA
+		wantErr error
+	}{
+		{name: "none"},
+		{name: "two", loras: []LoRA{{Name: "film-grain_v2", Weight: 0.8}, {Name: "Sketch.XL", Weight: -1.5}}},
+		{name: "too many", loras: []LoRA{{"a", 1}, {"b", 1}, {"c", 1}, {"d", 1}, {"e", 1}}, wantErr: ErrInvalidLoRA},
+		{name: "weight too high", loras: []LoRA{{"style", 2.5}}, wantErr: ErrInvalidLoRA},
+		{name: "NaN weight", loras: []LoRA{{"style", float32(math.NaN())}}, wantErr: ErrInvalidLoRA},
+		{name: "empty name", loras: []LoRA{{"", 1}}, wantErr: ErrInvalidLoRA},
+		{name: "path in name", loras: []LoRA{{"../style", 1}}, wantErr: ErrInvalidLoRA},
+		{name: "hidden name", loras: []LoRA{{".style", 1}}, wantErr: ErrInvalidLoRA},
+		{name: "name too long", loras: []LoRA{{strings.Repeat("s", MaxLoRANameLen+1), 1}}, wantErr: ErrInvalidLoRA},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := NewSD35GenerateRequest(1, "a cat", 512, 512, 28, 7.0, 0)
+			if err != nil {
+				t.Fatalf("NewSD35GenerateRequest() error = %v", err)
+			}
+			req.LoRAs = tt.loras
+
+			data, err := EncodeSD35GenerateRequest(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("EncodeSD35GenerateRequest() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// The section follows the fixed fields; the prompts follow it
+			var wantSection []byte
+			wantFlags := uint32(0)
+			if len(tt.loras) > 0 {
+				wantFlags = FlagLoRAs
+				wantSection = binary.BigEndian.AppendUint32(nil, uint32(len(tt.loras)))
+				for _, l := range tt.loras {
+					wantSection = binary.BigEndian.AppendUint32(wantSection, math.Float32bits(l.Weight))
+					wantSection = binary.BigEndian.AppendUint32(wantSection, uint32(len(l.Name)))
+					wantSection = append(wantSection, l.Name...)
+				}
+			}
+			if got := binary.BigEndian.Uint32(data[12:16]); got != wantFlags {
+				t.Errorf("reserved = 0x%08X, want 0x%08X", got, wantFlags)
+			}
+			if got := binary.BigEndian.Uint32(data[8:12]); got != uint32(60+len(wantSection)+len(req.PromptData)) {
+				t.Errorf("payload_len = %d, want %d", got, 60+len(wantSection)+len(req.PromptData))
+			}
+			if got := data[76 : 76+len(wantSection)]; !bytes.Equal(got, wantSection) {
+				t.Errorf("LoRA section = %x, want %x", got, wantSection)
+			}
+			if got := data[76+len(wantSection):]; !bytes.Equal(got, req.PromptData) {
+				t.Errorf("prompt data = %q, want %q", got, req.PromptData)
+			}
+		})
+	}
+}
+
+func TestEncodeSD35Img2ImgRequest_LoRAs(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0x80}, 64*64*3)
+	req, err := NewSD35Img2ImgRequest(7, "a hat", 64, 64, 28, 7.0, 42, 0.5, SD35ChannelsRGB, pixels)
+	if err != nil {
+		t.Fatalf("NewSD35Img2ImgRequest() error = %v", err)
+	}
+	req.LoRAs = []LoRA{{Name: "style", Weight: 1}}
+
+	data, err := EncodeSD35Img2ImgRequest(req)
+	if err != nil {
+		t.Fatalf("EncodeSD35Img2ImgRequest() error = %v", err)
+	}
+
+	// lora_count, weight, name_len and "style" after the img2img fields
+	sectionLen := 4 + 8 + len("style")
+	if got := binary.BigEndian.Uint32(data[12:16]); got != FlagLoRAs {
+		t.Errorf("reserved = 0x%08X, want 0x%08X", got, FlagLoRAs)
+	}
+	if got := binary.BigEndian.Uint32(data[88:92]); got != 1 {
+		t.Errorf("lora_count = %d, want 1", got)
+	}
+	if got := string(data[100 : 100+len("style")]); got != "style" {
+		t.Errorf("LoRA name = %q, want style", got)
+	}
+	if got := data[88+sectionLen : 88+sectionLen+len(req.PromptData)]; !bytes.Equal(got, req.PromptData) {
+		t.Errorf("prompt data = %q, want %q", got, req.PromptData)
+	}
+	if got := data[len(data)-len(pixels):]; !bytes.Equal(got, pixels) {
+		t.Error("init image is not at the end of the payload")
+	}
+}
+
+func TestEncodeSD35GenerateRequest_VAETiling(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0x80}, 64*64*3)
+
+	tests := []struct {
+		name      string
+		tiling    bool
+		loras     []LoRA
+		wantFlags uint32
+	}{
+		{name: "off", wantFlags: 0},
+		{name: "on", tiling: true, wantFlags: FlagVAETiling},
+		{name: "with LoRAs", tiling: true, loras: []LoRA{{"style", 1}}, wantFlags: FlagLoRAs | FlagVAETiling},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewSD35GenerateRequest(1, "a cat", 64, 64, 28, 7.0, 0)
+			if err != nil {
+				t.Fatalf("NewSD35GenerateRequest() error = %v", err)
+			}
+			gen.LoRAs = tt.loras
+			gen.VAETiling = tt.tiling
+
+			img2img := &SD35Img2ImgRequest{SD35GenerateRequest: *gen, Strength: 0.5, InitChannels: SD35ChannelsRGB, InitImage: pixels}
+			control := &SD35ControlRequest{SD35GenerateRequest: *gen, ControlStrength: 1, ControlChannels: SD35ChannelsRGB, ControlImage: pixels}
+			encoders := map[string]func() ([]byte, error){
+				"generate": func() ([]byte, error) { return EncodeSD35GenerateRequest(gen) },
+				"img2img":  func() ([]byte, error) { return EncodeSD35Img2ImgRequest(img2img) },
+				"control":  func() ([]byte, error) { return EncodeSD35ControlRequest(control) },
+			}
+			for kind, encode := range encoders {
+				data, err := encode()
+				if err != nil {
+					t.Fatalf("%s: encode error = %v", kind, err)
+				}
+				if got := binary.BigEndian.Uint32(data[12:16]); got != tt.wantFlags {
+					t.Errorf("%s: reserved = 0x%08X, want 0x%08X", kind, got, tt.wantFlags)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeSD35GenerateRequest_Priority(t *testing.T) {
+	tests := []struct {
+		name      string
+		priority  Priority
+		tiling    bool
+		wantFlags uint32
+		wantErr   error
+	}{
+		{name: "normal", priority: PriorityNormal, wantFlags: 0},
+		{name: "low", priority: PriorityLow, wantFlags: 0x08},
+		{name: "high", priority: PriorityHigh, wantFlags: 0x10},
+		{name: "high with tiling", priority: PriorityHigh, tiling: true, wantFlags: 0x10 | FlagVAETiling},
+		{name: "unknown", priority: PriorityHigh + 1, wantErr: ErrInvalidPriority},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewSD35GenerateRequest(1, "a cat", 64, 64, 28, 7.0, 0)
+			if err != nil {
+				t.Fatalf("NewSD35GenerateRequest() error = %v", err)
+			}
+			gen.Priority = tt.priority
+			gen.VAETiling = tt.tiling
+
+			data, err := EncodeSD35GenerateRequest(gen)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("EncodeSD35GenerateRequest() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EncodeSD35GenerateRequest() error = %v", err)
+			}
+			if got := binary.BigEndian.Uint32(data[12:16]); got != tt.wantFlags {
+				t.Errorf("reserved = 0x%08X, want 0x%08X", got, tt.wantFlags)
+			}
+		})
+	}
+}
+
+func TestEncodeSD35ControlRequest(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0x80}, 64*64*3)
+
+	tests := []struct {
+		name        string
+		controlType uint32
+		strength    float32
+		channels    uint32
+		image       []byte
+		loras       []LoRA
+		wantErr     error
+	}{
+		{name: "canny", controlType: ControlTypeCanny, strength: 0.9, channels: SD35ChannelsRGB, image: pixels},
+		{name: "pose at max strength", controlType: ControlTypePose, strength: MaxControlStrength, channels: SD35ChannelsRGB, image: pixels},
+		{name: "depth with LoRA", controlType: ControlTypeDepth, strength: 1, channels: SD35ChannelsRGB, image: pixels, loras: []LoRA{{"style", 1}}},
+		{name: "unknown type", controlType: ControlTypeCount, strength: 1, channels: SD35ChannelsRGB, image: pixels, wantErr: ErrInvalidControl},
+		{name: "zero strength", controlType: ControlTypeCanny, strength: 0, channels: SD35ChannelsRGB, image: pixels, wantErr: ErrInvalidControl},
+		{name: "NaN strength", controlType: ControlTypeCanny, strength: float32(math.NaN()), channels: SD35ChannelsRGB, image: pixels, wantErr: ErrInvalidControl},
+		{name: "grayscale", controlType: ControlTypeCanny, strength: 1, channels: 1, image: pixels[:64*64], wantErr: ErrInvalidControl},
+		{name: "wrong size", controlType: ControlTypeCanny, strength: 1, channels: SD35ChannelsRGB, image: pixels[:100], wantErr: ErrInvalidControl},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewSD35GenerateRequest(7, "a cat", 64, 64, 28, 7.0, 42)
+			if err != nil {
+				t.Fatalf("NewSD35GenerateRequest() error = %v", err)
+			}
+			gen.LoRAs = tt.loras
+			req := &SD35ControlRequest{
+				SD35GenerateRequest: *gen,
+				ControlType:         tt.controlType,
+				ControlStrength:     tt.strength,
+				ControlChannels:     tt.channels,
+				ControlImage:        tt.image,
+			}
+
+			data, err := EncodeSD35ControlRequest(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("EncodeSD35ControlRequest() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			sectionLen := 0
+			if len(tt.loras) > 0 {
+				sectionLen = 4 + 8 + len(tt.loras[0].Name)
+			}
+			promptLen := 3 * len("a cat")
+			wantPayload := 12 + 48 + 16 + sectionLen + promptLen + len(tt.image)
+			if got := binary.BigEndian.Uint16(data[6:8]); got != MsgControlRequest {
+				t.Errorf("msg_type = 0x%04X, want 0x%04X", got, MsgControlRequest)
+			}
+			if got := binary.BigEndian.Uint32(data[8:12]); got != uint32(wantPayload) {
+				t.Errorf("payload_len = %d, want %d", got, wantPayload)
+			}
+			if len(data) != 16+wantPayload {
+				t.Fatalf("len = %d, want %d", len(data), 16+wantPayload)
+			}
+
+			// Everything up to the prompt offset table matches a generate request
+			genData, _ := EncodeSD35GenerateRequest(gen)
+			if !bytes.Equal(data[16:76], genData[16:76]) {
+				t.Errorf("request fields = % x, want % x", data[16:76], genData[16:76])
+			}
+
+			if got := binary.BigEndian.Uint32(data[76:80]); got != tt.controlType {
+				t.Errorf("control_type = %d, want %d", got, tt.controlType)
+			}
+			if got := math.Float32frombits(binary.BigEndian.Uint32(data[80:84])); got != tt.strength {
+				t.Errorf("control_strength = %v, want %v", got, tt.strength)
+			}
+			if got := binary.BigEndian.Uint32(data[84:88]); got != tt.channels {
+				t.Errorf("control_channels = %d, want %d", got, tt.channels)
+			}
+			if got := binary.BigEndian.Uint32(data[88:92]); got != uint32(len(tt.image)) {
+				t.Errorf("control_data_len = %d, want %d", got, len(tt.image))
+			}
+			promptStart := 92 + sectionLen
+			if got := string(data[promptStart : promptStart+promptLen]); got != "a cata cata cat" {
+				t.Errorf("prompt data = %q", got)
+			}
+			if !bytes.Equal(data[promptStart+promptLen:], tt.image) {
+				t.Error("control image does not end the message")
+			}
+		})
+	}
+
+	if _, err := EncodeSD35ControlRequest(nil); err == nil {
+		t.Error("EncodeSD35ControlRequest(nil) error = nil, want error")
+	}
+}
+
+func TestEncodeUpscaleRequest(t *testing.T) {
+	pixels := bytes.Repeat([]byte{0x80}, 64*48*3)
+
+	tests := []struct {
+		name          string
+		width, height uint32
+		channels      uint32
+		targetW       uint32
+		targetH       uint32
+		image         []byte
+		wantErr       error
+	}{
+		{name: "valid", width: 64, height: 48, channels: 3, targetW: 170, targetH: 128, image: pixels},
+		{name: "same size", width: 64, height: 48, channels: 3, targetW: 64, targetH: 48, image: pixels},
+		{name: "smaller target", width: 64, height: 48, channels: 3, targetW: 32, targetH: 48, image: pixels, wantErr: ErrInvalidDimensions},
+		{name: "beyond factor", width: 64, height: 48, channels: 3, targetW: 257, targetH: 192, image: pixels, wantErr: ErrInvalidDimensions},
+		{name: "beyond max", width: 768, height: 1, channels: 3, targetW: 2049, targetH: 1, image: make([]byte, 768*3), wantErr: ErrInvalidDimensions},
+		{name: "empty image", width: 0, height: 48, channels: 3, targetW: 0, targetH: 48, wantErr: ErrInvalidDimensions},
+		{name: "bad channels", width: 64, height: 48, channels: 1, targetW: 128, targetH: 96, image: pixels[:64*48], wantErr: ErrInvalidInitImage},
+		{name: "short image", width: 64, height: 48, channels: 3, targetW: 128, targetH: 96, image: pixels[:100], wantErr: ErrInvalidInitImage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &UpscaleRequest{
+				RequestID:    9,
+				Width:        tt.width,
+				Height:       tt.height,
+				Channels:     tt.channels,
+				TargetWidth:  tt.targetW,
+				TargetHeight: tt.targetH,
+				Image:        tt.image,
+			}
+
+			data, err := EncodeUpscaleRequest(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("EncodeUpscaleRequest() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got := binary.BigEndian.Uint16(data[6:8]); got != MsgUpscaleRequest {
+				t.Errorf("msg_type = 0x%04X, want 0x%04X", got, MsgUpscaleRequest)
+			}
+			if got := binary.BigEndian.Uint32(data[8:12]); got != uint32(32+len(tt.image)) {
+				t.Errorf("payload_len = %d, want %d", got, 32+len(tt.image))
+			}
+			if got := binary.BigEndian.Uint64(data[16:24]); got != 9 {
+				t.Errorf("request_id = %d, want 9", got)
+			}
+			fields := []struct {
+				name   string
+				offset int
+				want   uint32
+			}{
+				{"width", 24, tt.width},
+				{"height", 28, tt.height},
+				{"channels", 32, tt.channels},
+				{"target_width", 36, tt.targetW},
+				{"target_height", 40, tt.targetH},
+				{"image_data_len", 44, uint32(len(tt.image))},
+			}
+			for _, f := range fields {
+				if got := binary.BigEndian.Uint32(data[f.offset : f.offset+4]); got != f.want {
+					t.Errorf("%s = %d, want %d", f.name, got, f.want)
+				}
+			}
+			if !bytes.Equal(data[48:], tt.image) {
+				t.Error("image does not end the message")
+			}
+		})
+	}
+
+	if _, err := EncodeUpscaleRequest(nil); err == nil {
+		t.Error("EncodeUpscaleRequest(nil) error = nil, want error")
+	}
+}
@@ -10,14 +10,27 @@ const (
 	MinSupportedVersion uint16 = ProtocolVersion1
 	MaxSupportedVersion uint16 = ProtocolVersion1
 	MagicNumber         uint32 = 0x57455645       // "WEVE"
-	MaxMessageSize      uint32 = 10 * 1024 * 1024 // 10 MB
+	MaxMessageSize      uint32 = 20 * 1024 * 1024 // 20 MB
 )
 
 // Message type constants
 const (
-	MsgGenerateRequest  uint16 = 0x0001
-	MsgGenerateResponse uint16 = 0x0002
-	MsgError            uint16 = 0x00FF
+	MsgGenerateRequest      uint16 = 0x0001
+	MsgGenerateResponse     uint16 = 0x0002
+	MsgPing                 uint16 = 0x0003
+	MsgPong                 uint16 = 0x0004
+	MsgImg2ImgRequest       uint16 = 0x0005
+	MsgInpaintRequest       uint16 = 0x0006
+	MsgUpscaleRequest       uint16 = 0x0007
+	MsgPreview              uint16 = 0x0008
+	MsgModelsRequest        uint16 = 0x0009
+	MsgModelsResponse       uint16 = 0x000A
+	MsgControlRequest       uint16 = 0x000B
+	MsgCapabilitiesRequest  uint16 = 0x000C
+	MsgCapabilitiesResponse uint16 = 0x000D
+	MsgHelloRequest         uint16 = 0x000E
+	MsgHelloResponse        uint16 = 0x000F
+	MsgError                uint16 = 0x00FF
 )
 
 // Status codes (HTTP-like)
@@ -29,40 +42,168 @@ const (
 
 // Error codes
 const (
-	ErrCodeNone               uint32 = 0
-	ErrCodeInvalidMagic       uint32 = 1
-	ErrCodeUnsupportedVersion uint32 = 2
-	ErrCodeInvalidModelID     uint32 = 3
-	ErrCodeInvalidPrompt      uint32 = 4
-	ErrCodeInvalidDimensions  uint32 = 5
-	ErrCodeInvalidSteps       uint32 = 6
-	ErrCodeInvalidCFG         uint32 = 7
-	ErrCodeOutOfMemory        uint32 = 8
-	ErrCodeGPUError           uint32 = 9
-	ErrCodeTimeout            uint32 = 10
-	ErrCodeInternal           uint32 = 99
+	ErrCodeNone                  uint32 = 0
+	ErrCodeInvalidMagic          uint32 = 1
+	ErrCodeUnsupportedVersion    uint32 = 2
+	ErrCodeInvalidModelID        uint32 = 3
+	ErrCodeInvalidPrompt         uint32 = 4
+	ErrCodeInvalidDimensions     uint32 = 5
+	ErrCodeInvalidSteps          uint32 = 6
+	ErrCodeInvalidCFG            uint32 = 7
+	ErrCodeOutOfMemory           uint32 = 8
+	ErrCodeGPUError              uint32 = 9
+	ErrCodeTimeout               uint32 = 10
+	ErrCodeInvalidInitImage      uint32 = 11
+	ErrCodeInvalidMask           uint32 = 12
+	ErrCodeUpscalerUnavailable   uint32 = 13
+	ErrCodeModelUnavailable      uint32 = 14
+	ErrCodeInvalidLoRA           uint32 = 15
+	ErrCodeInvalidControl        uint32 = 16
+	ErrCodeControlNetUnavailable uint32 = 17
+	ErrCodeChecksumMismatch      uint32 = 18
+	ErrCodeInternal              uint32 = 99
 )
 
 // Model identifiers
 const (
 	ModelIDSD35 uint32 = 0x00000000 // Stable Diffusion 3.5
+	ModelIDSDXL uint32 = 0x00000001 // Stable Diffusion XL
+	ModelIDFlux uint32 = 0x00000002 // Flux.1
+)
+
+// Model statuses reported in a models response
+const (
+	ModelStatusMissing   uint32 = 0 // Model files are not installed
+	ModelStatusAvailable uint32 = 1 // Installed, loaded on first use
+	ModelStatusLoaded    uint32 = 2 // Loaded in VRAM
+)
+
+// MaxModelNameLen is the longest model name in a models response.
+const MaxModelNameLen = 64
+
+// FlagLoRAs is set in the header's reserved field of generate, img2img,
+// inpaint and control requests that carry a LoRA section after their fixed
+// fields.
+const FlagLoRAs uint32 = 0x00000001
+
+// FlagVAETiling is set in the header's reserved field of generate, img2img,
+// inpaint and control requests whose image should be VAE-decoded in tiles.
+// Tiling is slower but lets large images decode in little VRAM.
+const FlagVAETiling uint32 = 0x00000002
+
+// FlagSharedMemory is set in the header of image requests by a client that
+// can read the image from a shared memory segment, and in the header of a
+// generate response whose image data is the name of such a segment (see
+// SharedMemoryPrefix) instead of the pixels. Compute advertises whether it
+// accepts it in HelloResponse.Flags.
+const FlagSharedMemory uint32 = 0x00000004
+
+// FlagPriorityMask covers the header bits, 3 and 4, of generate, img2img,
+// inpaint and control requests that hold their Priority. Compute accepts
+// them when HelloResponse.Flags has all of the mask.
+const FlagPriorityMask uint32 = 0x00000018
+
+// FlagSeed is set in the header of generate, img2img, inpaint and control
+// requests by a client that wants to know the seed the image was generated
+// with, which compute picks when the request's seed is 0, and in the header
+// of a generate response that ends with that seed. Compute advertises
+// whether it accepts it in HelloResponse.Flags.
+const FlagSeed uint32 = 0x00000020
+
+// FlagMetadata is set in the header of generate, img2img, inpaint and
+// control requests by a client that wants to know how the image was
+// generated, and in the header of a generate response that ends with a
+// GenerationMetadata. Compute advertises whether it accepts it in
+// HelloResponse.Flags.
+const FlagMetadata uint32 = 0x00000040
+
+// FlagChunked is set in the header of any request by a client that can
+// read responses split into several frames, and in the header of every
+// frame of such a response but the last. Each frame repeats the message
+// type and carries the next part of the payload; the payload is all of
+// them in order. Compute advertises whether it accepts it in
+// HelloResponse.Flags.
+const FlagChunked uint32 = 0x00000080
+
+// FlagChecksum is set in the header of a message whose payload ends with
+// a CRC-32 (IEEE) of the rest of it, ChecksumSize bytes big-endian,
+// counted in PayloadLen. A client sets it on requests when compute
+// accepts it, as advertised in HelloResponse.Flags; compute then sets it
+// on every frame it sends in response.
+const FlagChecksum uint32 = 0x00000100
+
+// ChecksumSize is the size of the CRC-32 that ends a payload with
+// FlagChecksum.
+const ChecksumSize = 4
+
+// flagPriorityShift is the bit FlagPriorityMask starts at.
+const flagPriorityShift = 3
+
+// Priority is how urgently a generation is wanted. Weave queues requests by
+// it before they reach compute, which handles one at a time in the order
+// received.
+type Priority uint8
+
+// Priorities. PriorityNormal is 0, so requests that do not set one are
+// encoded as before.
+const (
+	PriorityNormal Priority = 0 // Requests that do not say
+	PriorityLow    Priority = 1 // Background work, such as agent autogeneration
+	PriorityHigh   Priority = 2 // Explicitly asked for by the user
+)
+
+// SharedMemoryPrefix starts the names of the shared memory segments compute
+// creates next to its socket. The client unlinks a segment once read.
+const SharedMemoryPrefix = "weave-shm-"
+
+// LoRA bounds
+const (
+	MaxLoRAs       int     = 4
+	MaxLoRANameLen int     = 64
+	MinLoRAWeight  float32 = -2.0
+	MaxLoRAWeight  float32 = 2.0
+)
+
+// ControlNet control types: the kind of control map a control request's
+// image is. Compute does not derive the map from a photo.
+const (
+	ControlTypeCanny uint32 = 0 // Edge map
+	ControlTypeDepth uint32 = 1 // Depth map, near is bright
+	ControlTypePose  uint32 = 2 // OpenPose skeleton
+)
+
+// ControlTypeCount is the number of control types; valid types are below it.
+const ControlTypeCount uint32 = 3
+
+// Control strength bounds
+const (
+	MinControlStrength float32 = 0.0 // Exclusive
+	MaxControlStrength float32 = 2.0
 )
 
 // Sentinel errors
 var (
-	ErrInvalidMagic       = errors.New("invalid magic number")
-	ErrUnsupportedVersion = errors.New("unsupported protocol version")
-	ErrInvalidModelID     = errors.New("invalid model ID")
-	ErrInvalidPrompt      = errors.New("invalid prompt")
-	ErrInvalidDimensions  = errors.New("invalid dimensions")
-	ErrInvalidSteps       = errors.New("invalid steps")
-	ErrInvalidCFG         = errors.New("invalid CFG scale")
-	ErrOutOfMemory        = errors.New("out of memory")
-	ErrGPUError           = errors.New("GPU error")
-	ErrTimeout            = errors.New("timeout")
-	ErrInternal           = errors.New("internal error")
-	ErrBufferTooSmall     = errors.New("buffer too small")
-	ErrMessageTooLarge    = errors.New("message too large")
+	ErrInvalidMagic          = errors.New("invalid magic number")
+	ErrUnsupportedVersion    = errors.New("unsupported protocol version")
+	ErrInvalidModelID        = errors.New("invalid model ID")
+	ErrInvalidPrompt         = errors.New("invalid prompt")
+	ErrInvalidDimensions     = errors.New("invalid dimensions")
+	ErrInvalidSteps          = errors.New("invalid steps")
+	ErrInvalidCFG            = errors.New("invalid CFG scale")
+	ErrOutOfMemory           = errors.New("out of memory")
+	ErrGPUError              = errors.New("GPU error")
+	ErrTimeout               = errors.New("timeout")
+	ErrInvalidInitImage      = errors.New("invalid init image")
+	ErrInvalidMask           = errors.New("invalid inpaint mask")
+	ErrUpscalerUnavailable   = errors.New("upscaler unavailable")
+	ErrModelUnavailable      = errors.New("model unavailable")
+	ErrInvalidLoRA           = errors.New("invalid LoRA")
+	ErrInvalidControl        = errors.New("invalid control image")
+	ErrInvalidPriority       = errors.New("invalid priority")
+	ErrControlNetUnavailable = errors.New("ControlNet unavailable")
+	ErrInternal              = errors.New("internal error")
+	ErrBufferTooSmall        = errors.New("buffer too small")
+	ErrMessageTooLarge       = errors.New("message too large")
 )
 
 // Header represents the common 16-byte header present in every message.
@@ -71,7 +212,7 @@ type Header struct {
 	Version    uint16 // Protocol version
 	MsgType    uint16 // Message type (request/response/error)
 	PayloadLen uint32 // Length of data following header
-	Reserved   uint32 // Must be 0x00000000
+	Reserved   uint32 // Flags (FlagLoRAs, FlagVAETiling, FlagSharedMemory, FlagPriorityMask, FlagSeed, FlagMetadata, FlagChunked, FlagChecksum), otherwise 0x00000000
 }
 
 // GenerateRequest represents the common fields in all generation requests.
@@ -100,6 +241,72 @@ type ErrorResponse struct {
 	ErrorMessage string // Human-readable error description (UTF-8)
 }
 
+// PongResponse is the response to a ping.
+type PongResponse struct {
+	Header    Header
+	RequestID uint64 // Echoed from the ping
+}
+
+// PreviewFrame is a low-resolution look at a generation in progress. Compute
+// may send any number of them for a request before its response.
+type PreviewFrame struct {
+	Header       Header
+	RequestID    uint64 // Request ID of the generation
+	Step         uint32 // Sampling steps done
+	Steps        uint32 // Sampling steps in the generation
+	Width        uint32 // Preview width, 1-PreviewMaxDimension
+	Height       uint32 // Preview height, 1-PreviewMaxDimension
+	Channels     uint32 // Number of channels (3 = RGB)
+	ImageDataLen uint32 // Width * Height * 3
+	ImageData    []byte // Raw RGB pixels
+}
+
+// ModelInfo describes one model compute can generate with.
+type ModelInfo struct {
+	ModelID uint32 // Model identifier (ModelID*)
+	Status  uint32 // ModelStatus*
+	VRAMMB  uint32 // Approximate VRAM in use when loaded, in MB
+	Name    string // Model name, e.g. "sd3.5-medium"
+}
+
+// ModelsResponse is the response to a models request.
+type ModelsResponse struct {
+	Header    Header
+	RequestID uint64      // Echoed from the request
+	Models    []ModelInfo // All models compute knows, installed or not
+}
+
+// Capabilities is the response to a capabilities request: what the
+// connected compute process can do.
+type Capabilities struct {
+	Header       Header
+	RequestID    uint64      // Echoed from the request
+	MinVersion   uint16      // Oldest protocol version compute accepts
+	MaxVersion   uint16      // Newest protocol version compute accepts
+	RequestTypes uint32      // Bit n is set if compute accepts message type n
+	MaxWidth     uint32      // Widest image compute generates
+	MaxHeight    uint32      // Tallest image compute generates
+	VRAMTotalMB  uint32      // GPU memory, 0 if unknown
+	VRAMFreeMB   uint32      // Free GPU memory when asked, 0 if unknown
+	Models       []ModelInfo // All models compute knows, installed or not
+}
+
+// HelloResponse is the response to a hello request: the protocol version
+// both sides speak from then on.
+type HelloResponse struct {
+	Header     Header
+	RequestID  uint64 // Echoed from the request
+	Version    uint16 // Newest version both sides speak
+	MinVersion uint16 // Oldest protocol version compute accepts
+	MaxVersion uint16 // Newest protocol version compute accepts
+	Flags      uint16 // Header flags compute accepts (FlagLoRAs, ...)
+}
+
+// Supports reports whether compute accepts messages of type msgType.
+func (c *Capabilities) Supports(msgType uint16) bool {
+	return msgType < 32 && c.RequestTypes&(1<<msgType) != 0
+}
+
 // SD35GenerateRequest represents a Stable Diffusion 3.5 generation request.
 // This includes the common request fields plus SD35-specific parameters.
 type SD35GenerateRequest struct {
@@ -122,6 +329,75 @@ type SD35GenerateRequest struct {
 
 	// Prompt data (contains all three prompts)
 	PromptData []byte
+
+	// LoRAs applied to the generation, at most MaxLoRAs
+	LoRAs []LoRA
+
+	// VAETiling decodes the image in tiles (FlagVAETiling)
+	VAETiling bool
+
+	// Priority of the generation (FlagPriorityMask)
+	Priority Priority
+}
+
+// LoRA is a LoRA applied to a generation: a file in compute's LoRA
+// directory, named without its extension, and the weight it is applied at.
+type LoRA struct {
+	Name   string  // [A-Za-z0-9._-], not starting with '.', at most MaxLoRANameLen bytes
+	Weight float32 // MinLoRAWeight to MaxLoRAWeight
+}
+
+// SD35Img2ImgRequest represents a Stable Diffusion 3.5 img2img request: a
+// generation that starts from an init image instead of noise.
+type SD35Img2ImgRequest struct {
+	SD35GenerateRequest
+
+	Strength     float32 // Denoise strength (0.0-1.0], how much of the init image is redrawn
+	InitChannels uint32  // Init image channels (3=RGB, 4=RGBA)
+
+	// Init image (raw pixels, Width x Height x InitChannels)
+	InitImage []byte
+}
+
+// SD35InpaintRequest represents a Stable Diffusion 3.5 inpaint request: an
+// img2img request that only redraws the pixels set in the mask.
+type SD35InpaintRequest struct {
+	SD35Img2ImgRequest
+
+	// Mask (one byte per pixel, Width x Height; 255 redraws, 0 keeps)
+	Mask []byte
+}
+
+// SD35ControlRequest represents a Stable Diffusion 3.5 control request: a
+// generation guided by the model's ControlNet of ControlType, which makes
+// it follow the composition of the control image.
+type SD35ControlRequest struct {
+	SD35GenerateRequest
+
+	ControlType     uint32  // Control map kind (ControlType*)
+	ControlStrength float32 // How closely to follow the control image (0.0-2.0]
+	ControlChannels uint32  // Control image channels (3=RGB, 4=RGBA)
+
+	// Control image (raw pixels, Width x Height x ControlChannels)
+	ControlImage []byte
+}
+
+// UpscaleRequest represents a request to enlarge an image without
+// regenerating it. The compute process upscales it with its ESRGAN model and
+// resizes the result to the target size. The response is an
+// SD35GenerateResponse.
+type UpscaleRequest struct {
+	Header    Header
+	RequestID uint64 // Unique request ID for tracing
+
+	Width        uint32 // Input width (1-2048)
+	Height       uint32 // Input height (1-2048)
+	Channels     uint32 // Input channels (3=RGB, 4=RGBA)
+	TargetWidth  uint32 // Output width (Width to Width*UpscaleMaxFactor, at most 2048)
+	TargetHeight uint32 // Output height (Height to Height*UpscaleMaxFactor, at most 2048)
+
+	// Image (raw pixels, Width x Height x Channels)
+	Image []byte
 }
 
 // SD35GenerateResponse represents a successful SD 3.5 generation response.
@@ -136,6 +412,25 @@ type SD35GenerateResponse struct {
 
 	// Image data (raw RGB/RGBA pixels)
 	ImageData []byte
+
+	// Seed the image was generated with (FlagSeed), 0 if compute did not
+	// report it
+	Seed uint64
+
+	// How the image was generated (FlagMetadata), nil if compute did not
+	// report it
+	Metadata *GenerationMetadata
+}
+
+// GenerationMetadata is how compute generated an image, for comparing
+// configurations. Strings are empty if compute does not know them.
+type GenerationMetadata struct {
+	ModelHash    string // Short hash of the model weights, as the AUTOMATIC1111 web UI's "model hash"
+	Sampler      string // Sampling method, as stable-diffusion.cpp names it
+	Scheduler    string // Noise schedule, as stable-diffusion.cpp names it
+	TextEncodeMS uint32 // Milliseconds encoding the prompt, and the init image of img2img
+	DiffusionMS  uint32 // Milliseconds sampling
+	VAEMS        uint32 // Milliseconds decoding the image with the VAE
 }
 
 // SD35 parameter bounds
@@ -154,4 +449,13 @@ const (
 	SD35MaxPromptData  uint32  = 768 // 3 * 256
 	SD35ChannelsRGB    uint32  = 3
 	SD35ChannelsRGBA   uint32  = 4
+	SD35MinStrength    float32 = 0.0 // Exclusive
+	SD35MaxStrength    float32 = 1.0
 )
+
+// PreviewMaxDimension is the largest width and height of a preview frame.
+const PreviewMaxDimension uint32 = 256
+
+// UpscaleMaxFactor is how much an upscale request may enlarge each
+// dimension: the ESRGAN model upscales 4x.
+const UpscaleMaxFactor uint32 = 4
@@ -53,7 +53,7 @@ func TestProtocolConstants(t *testing.T) {
 		{"ProtocolVersion1", ProtocolVersion1, uint16(0x0001)},
 		{"MinSupportedVersion", MinSupportedVersion, uint16(0x0001)},
 		{"MaxSupportedVersion", MaxSupportedVersion, uint16(0x0001)},
-		{"MaxMessageSize", MaxMessageSize, uint32(10 * 1024 * 1024)},
+		{"MaxMessageSize", MaxMessageSize, uint32(20 * 1024 * 1024)},
 	}
 
 	for _, tt := range tests {
@@ -74,6 +74,17 @@ func TestMessageTypes(t *testing.T) {
 	}{
 		{"MsgGenerateRequest", MsgGenerateRequest, 0x0001},
 		{"MsgGenerateResponse", MsgGenerateResponse, 0x0002},
+		{"MsgImg2ImgRequest", MsgImg2ImgRequest, 0x0005},
+		{"MsgInpaintRequest", MsgInpaintRequest, 0x0006},
+		{"MsgUpscaleRequest", MsgUpscaleRequest, 0x0007},
+		{"MsgPreview", MsgPreview, 0x0008},
+		{"MsgModelsRequest", MsgModelsRequest, 0x0009},
+		{"MsgModelsResponse", MsgModelsResponse, 0x000A},
+		{"MsgControlRequest", MsgControlRequest, 0x000B},
+		{"MsgCapabilitiesRequest", MsgCapabilitiesRequest, 0x000C},
+		{"MsgCapabilitiesResponse", MsgCapabilitiesResponse, 0x000D},
+		{"MsgHelloRequest", MsgHelloRequest, 0x000E},
+		{"MsgHelloResponse", MsgHelloResponse, 0x000F},
 		{"MsgError", MsgError, 0x00FF},
 	}
 
@@ -125,6 +136,14 @@ func TestErrorCodes(t *testing.T) {
 		{"ErrCodeOutOfMemory", ErrCodeOutOfMemory, 8},
 		{"ErrCodeGPUError", ErrCodeGPUError, 9},
 		{"ErrCodeTimeout", ErrCodeTimeout, 10},
+		{"ErrCodeInvalidInitImage", ErrCodeInvalidInitImage, 11},
+		{"ErrCodeInvalidMask", ErrCodeInvalidMask, 12},
+		{"ErrCodeUpscalerUnavailable", ErrCodeUpscalerUnavailable, 13},
+		{"ErrCodeModelUnavailable", ErrCodeModelUnavailable, 14},
+		{"ErrCodeInvalidLoRA", ErrCodeInvalidLoRA, 15},
+		{"ErrCodeInvalidControl", ErrCodeInvalidControl, 16},
+		{"ErrCodeControlNetUnavailable", ErrCodeControlNetUnavailable, 17},
+		{"ErrCodeChecksumMismatch", ErrCodeChecksumMismatch, 18},
 		{"ErrCodeInternal", ErrCodeInternal, 99},
 	}
 
@@ -142,6 +161,12 @@ func TestModelIDs(t *testing.T) {
 	if ModelIDSD35 != 0x00000000 {
 		t.Errorf("ModelIDSD35 = 0x%08X, want 0x00000000", ModelIDSD35)
 	}
+	if ModelIDSDXL != 0x00000001 {
+		t.Errorf("ModelIDSDXL = 0x%08X, want 0x00000001", ModelIDSDXL)
+	}
+	if ModelIDFlux != 0x00000002 {
+		t.Errorf("ModelIDFlux = 0x%08X, want 0x00000002", ModelIDFlux)
+	}
 }
 
 // TestSentinelErrors verifies sentinel errors are defined.
@@ -160,6 +185,10 @@ func TestSentinelErrors(t *testing.T) {
 		{"ErrOutOfMemory", ErrOutOfMemory},
 		{"ErrGPUError", ErrGPUError},
 		{"ErrTimeout", ErrTimeout},
+		{"ErrInvalidInitImage", ErrInvalidInitImage},
+		{"ErrInvalidMask", ErrInvalidMask},
+		{"ErrUpscalerUnavailable", ErrUpscalerUnavailable},
+		{"ErrModelUnavailable", ErrModelUnavailable},
 		{"ErrInternal", ErrInternal},
 		{"ErrBufferTooSmall", ErrBufferTooSmall},
 		{"ErrMessageTooLarge", ErrMessageTooLarge},
@@ -267,6 +296,8 @@ func TestSD35ParameterBounds(t *testing.T) {
 		{"SD35MaxPromptData", SD35MaxPromptData, uint32(768)},
 		{"SD35ChannelsRGB", SD35ChannelsRGB, uint32(3)},
 		{"SD35ChannelsRGBA", SD35ChannelsRGBA, uint32(4)},
+		{"SD35MinStrength", SD35MinStrength, float32(0.0)},
+		{"SD35MaxStrength", SD35MaxStrength, float32(1.0)},
 	}
 
 	for _, tt := range tests {
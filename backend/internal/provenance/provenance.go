@@ -0,0 +1,288 @@
+// Package provenance embeds signed provenance manifests in generated images.
+//
+// A manifest records that an image was generated by this weave instance:
+// the generator, the model, a hash of the prompt (not the prompt itself), a
+// timestamp, and a hash of the image. It is signed with an Ed25519 key kept
+// on the local disk and stored in the PNG as an iTXt chunk with the keyword
+// ManifestKeyword, alongside the public key needed to check it.
+//
+// This is a lightweight format in the spirit of C2PA, not a C2PA
+// implementation. Verify proves the image is unchanged since signing and
+// which key signed it; consumers decide whether to trust that key, for
+// example by comparing KeyID with the instance's published key.
+package provenance
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/image"
+)
+
+const (
+	// ManifestKeyword is the PNG text keyword the manifest is stored under.
+	ManifestKeyword = "weave:provenance"
+
+	// ManifestVersion is the version of the manifest format.
+	ManifestVersion = 1
+
+	// pemType is the PEM block type of the stored private key.
+	pemType = "PRIVATE KEY"
+)
+
+var (
+	// ErrNoManifest is returned when an image has no provenance manifest
+	ErrNoManifest = errors.New("no provenance manifest")
+	// ErrInvalidManifest is returned when a manifest cannot be parsed
+	ErrInvalidManifest = errors.New("invalid provenance manifest")
+	// ErrInvalidSignature is returned when a manifest's signature does not verify
+	ErrInvalidSignature = errors.New("provenance signature does not verify")
+	// ErrImageModified is returned when an image changed after it was signed
+	ErrImageModified = errors.New("image modified after signing")
+)
+
+// Claim describes an image being signed.
+type Claim struct {
+	// Generator identifies the software, e.g. "weave/0.1.0".
+	Generator string
+
+	// Model identifies the image model.
+	Model string
+
+	// Prompt is hashed into the manifest; it is not stored.
+	Prompt string
+}
+
+// Manifest is the signed provenance record embedded in an image.
+type Manifest struct {
+	Version      int       `json:"version"`
+	Generator    string    `json:"generator"`
+	Model        string    `json:"model"`
+	PromptSHA256 string    `json:"prompt_sha256"`
+	ImageSHA256  string    `json:"image_sha256"`
+	SignedAt     time.Time `json:"signed_at"`
+
+	// KeyID is a short fingerprint of PublicKey.
+	KeyID string `json:"key_id"`
+
+	// PublicKey is the base64 Ed25519 public key that made Signature.
+	PublicKey string `json:"public_key"`
+
+	// Signature is the base64 Ed25519 signature of the manifest encoded
+	// as JSON with Signature empty.
+	Signature string `json:"signature,omitempty"`
+}
+
+// Signer signs images with an Ed25519 key stored on disk.
+// The key is loaded, or created if missing, on first use.
+//
+// Signer is thread-safe.
+type Signer struct {
+	path string
+
+	mu  sync.Mutex
+	key ed25519.PrivateKey
+}
+
+// NewSigner returns a signer using the private key at path.
+func NewSigner(path string) *Signer {
+	return &Signer{path: path}
+}
+
+// PublicKey returns the signer's public key, loading or creating the key
+// if needed.
+func (s *Signer) PublicKey() (ed25519.PublicKey, error) {
+	key, err := s.privateKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.Public().(ed25519.PublicKey), nil
+}
+
+// Sign embeds a signed manifest for claim in a PNG image and returns the
+// new PNG. A manifest already in the image is replaced.
+func (s *Signer) Sign(pngData []byte, claim Claim) ([]byte, error) {
+	key, err := s.privateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash the image as it will be without a manifest, which is what
+	// Verify reconstructs
+	unsigned, err := image.RemovePNGText(pngData, ManifestKeyword)
+	if err != nil {
+		return nil, err
+	}
+
+	public := key.Public().(ed25519.PublicKey)
+	promptHash := sha256.Sum256([]byte(claim.Prompt))
+	imageHash := sha256.Sum256(unsigned)
+	m := Manifest{
+		Version:      ManifestVersion,
+		Generator:    claim.Generator,
+		Model:        claim.Model,
+		PromptSHA256: hex.EncodeToString(promptHash[:]),
+		ImageSHA256:  hex.EncodeToString(imageHash[:]),
+		SignedAt:     time.Now().UTC().Truncate(time.Second),
+		KeyID:        KeyID(public),
+		PublicKey:    base64.StdEncoding.EncodeToString(public),
+	}
+
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return image.SetPNGText(unsigned, ManifestKeyword, string(encoded))
+}
+
+// Verify checks the manifest embedded in a PNG image and returns it.
+// It fails if there is no manifest, the signature does not match the
+// embedded public key, or the image changed after signing.
+func Verify(pngData []byte) (Manifest, error) {
+	text, ok, err := image.PNGText(pngData, ManifestKeyword)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if !ok {
+		return Manifest{}, ErrNoManifest
+	}
+
+	var m Manifest
+	if err := json.Unmarshal([]byte(text), &m); err != nil {
+		return Manifest{}, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	public, err := base64.StdEncoding.DecodeString(m.PublicKey)
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		return Manifest{}, fmt.Errorf("%w: bad public key", ErrInvalidManifest)
+	}
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("%w: bad signature encoding", ErrInvalidManifest)
+	}
+
+	unsignedManifest := m
+	unsignedManifest.Signature = ""
+	payload, err := json.Marshal(unsignedManifest)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if !ed25519.Verify(public, payload, signature) || m.KeyID != KeyID(public) {
+		return Manifest{}, ErrInvalidSignature
+	}
+
+	unsigned, err := image.RemovePNGText(pngData, ManifestKeyword)
+	if err != nil {
+		return Manifest{}, err
+	}
+	imageHash := sha256.Sum256(unsigned)
+	if hex.EncodeToString(imageHash[:]) != m.ImageSHA256 {
+		return Manifest{}, ErrImageModified
+	}
+
+	return m, nil
+}
+
+// KeyID returns a short fingerprint of a public key: the first 8 bytes of
+// its SHA-256 in hex.
+func KeyID(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
+
+// privateKey returns the signing key, loading or creating it on first use.
+func (s *Signer) privateKey() (ed25519.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.key != nil {
+		return s.key, nil
+	}
+
+	key, err := loadKey(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err = createKey(s.path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.key = key
+	return key, nil
+}
+
+// loadKey reads a PKCS #8 PEM Ed25519 private key.
+func loadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemType {
+		return nil, fmt.Errorf("provenance key %s is not a PEM private key", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse provenance key %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("provenance key %s is not an Ed25519 key", path)
+	}
+	return key, nil
+}
+
+// createKey generates a new Ed25519 key and writes it to path.
+// SECURITY: The key file is readable by the owner only.
+func createKey(path string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate provenance key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode provenance key: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := pem.Encode(&buf, &pem.Block{Type: pemType, Bytes: der}); err != nil {
+		return nil, fmt.Errorf("failed to encode provenance key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create provenance key directory: %w", err)
+	}
+	// O_EXCL so two processes starting together can't overwrite each other's key
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return loadKey(path)
+		}
+		return nil, fmt.Errorf("failed to create provenance key: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write provenance key: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write provenance key: %w", err)
+	}
+	return key, nil
+}
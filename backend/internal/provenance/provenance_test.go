@@ -0,0 +1,195 @@
+package provenance
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/image"
+)
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	pngData, err := image.EncodePNG(2, 2, make([]byte, 12), image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	return pngData
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer := NewSigner(filepath.Join(t.TempDir(), "keys", "provenance.key"))
+	src := testPNG(t)
+
+	signed, err := signer.Sign(src, Claim{Generator: "weave/test", Model: "sd", Prompt: "a cat"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	m, err := Verify(signed)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	promptHash := sha256.Sum256([]byte("a cat"))
+	if m.Generator != "weave/test" || m.Model != "sd" || m.PromptSHA256 != hex.EncodeToString(promptHash[:]) {
+		t.Errorf("manifest = %+v, want the signed claim", m)
+	}
+	public, err := signer.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey() error = %v", err)
+	}
+	if m.KeyID != KeyID(public) {
+		t.Errorf("KeyID = %s, want %s", m.KeyID, KeyID(public))
+	}
+
+	// Re-signing replaces the manifest rather than stacking another
+	resigned, err := signer.Sign(signed, Claim{Generator: "weave/test", Model: "sd", Prompt: "a dog"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if _, err := Verify(resigned); err != nil {
+		t.Errorf("Verify() after re-sign error = %v", err)
+	}
+	stripped, err := image.RemovePNGText(resigned, ManifestKeyword)
+	if err != nil || string(stripped) != string(src) {
+		t.Errorf("removing the manifest did not restore the original image: %v", err)
+	}
+}
+
+// editManifest rewrites the manifest embedded in a signed PNG.
+func editManifest(t *testing.T, signed []byte, edit func(m *Manifest)) []byte {
+	t.Helper()
+
+	text, _, err := image.PNGText(signed, ManifestKeyword)
+	if err != nil {
+		t.Fatalf("PNGText() error = %v", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal([]byte(text), &m); err != nil {
+		t.Fatalf("failed to decode manifest: %v", err)
+	}
+	edit(&m)
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("failed to encode manifest: %v", err)
+	}
+	out, err := image.SetPNGText(signed, ManifestKeyword, string(encoded))
+	if err != nil {
+		t.Fatalf("SetPNGText() error = %v", err)
+	}
+	return out
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	dir := t.TempDir()
+	signer := NewSigner(filepath.Join(dir, "provenance.key"))
+	signed, err := signer.Sign(testPNG(t), Claim{Generator: "weave/test", Prompt: "a cat"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	manifest, _, _ := image.PNGText(signed, ManifestKeyword)
+
+	// The same manifest on different pixels
+	other, err := image.EncodePNG(2, 2, []byte{255, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	moved, err := image.SetPNGText(other, ManifestKeyword, manifest)
+	if err != nil {
+		t.Fatalf("SetPNGText() error = %v", err)
+	}
+
+	// Another key claiming this manifest
+	otherKey, err := NewSigner(filepath.Join(dir, "other.key")).PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey() error = %v", err)
+	}
+
+	garbage, err := image.SetPNGText(signed, ManifestKeyword, "not json")
+	if err != nil {
+		t.Fatalf("SetPNGText() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "unsigned image", data: testPNG(t), want: ErrNoManifest},
+		{name: "image modified", data: moved, want: ErrImageModified},
+		{
+			name: "claim altered",
+			data: editManifest(t, signed, func(m *Manifest) { m.Generator = "someone else" }),
+			want: ErrInvalidSignature,
+		},
+		{
+			name: "public key swapped",
+			data: editManifest(t, signed, func(m *Manifest) {
+				m.PublicKey = base64.StdEncoding.EncodeToString(otherKey)
+				m.KeyID = KeyID(otherKey)
+			}),
+			want: ErrInvalidSignature,
+		},
+		{
+			name: "key ID mismatch",
+			data: editManifest(t, signed, func(m *Manifest) { m.KeyID = KeyID(otherKey) }),
+			want: ErrInvalidSignature,
+		},
+		{
+			name: "malformed public key",
+			data: editManifest(t, signed, func(m *Manifest) { m.PublicKey = "short" }),
+			want: ErrInvalidManifest,
+		},
+		{name: "not JSON", data: garbage, want: ErrInvalidManifest},
+		{name: "not a PNG", data: []byte("nope"), want: image.ErrInvalidPNG},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSigner_KeyPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "provenance.key")
+
+	first, err := NewSigner(path).PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("key file not created: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("key file permissions = %o, want 600", perm)
+	}
+
+	// A new signer reuses the stored key
+	second, err := NewSigner(path).PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey() error = %v", err)
+	}
+	if !first.Equal(second) {
+		t.Error("reloaded key differs from the created key")
+	}
+}
+
+func TestSigner_InvalidKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "provenance.key")
+	if err := os.WriteFile(path, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if _, err := NewSigner(path).Sign(testPNG(t), Claim{}); err == nil {
+		t.Error("Sign() error = nil, want error for invalid key file")
+	}
+}
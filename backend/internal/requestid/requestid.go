@@ -0,0 +1,78 @@
+// Package requestid carries a per-request ID through contexts so that log
+// lines from the web server, the Ollama client and the compute process can
+// be tied back to the HTTP request that caused them.
+//
+// An ID is 14 hex digits holding 55 random bits, so the first digit is at
+// most 7. Compute protocol frames sent on behalf of a request use the ID
+// shifted left by 8 bits plus a per-request sequence number, so frame IDs
+// printed in hex start with the request ID while staying unique on the
+// multiplexed connection. Their top bit is clear, as the client reserves
+// it for pings.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// Header is the HTTP header carrying the request ID in responses and in
+// requests to Ollama.
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+// state is stored in the context; frames counts the compute frames sent.
+type state struct {
+	id     uint64
+	frames atomic.Uint32
+}
+
+// New returns a new random request ID.
+func New() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(fmt.Sprintf("failed to generate request ID: %v", err))
+	}
+	return format(binary.BigEndian.Uint64(b[:]) >> 9)
+}
+
+// NewContext returns a copy of ctx carrying id. IDs not produced by New
+// are ignored.
+func NewContext(ctx context.Context, id string) context.Context {
+	n, err := strconv.ParseUint(id, 16, 64)
+	if err != nil || len(id) != 14 || n>>55 != 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, &state{id: n})
+}
+
+// FromContext returns the request ID carried by ctx, or "" if none.
+func FromContext(ctx context.Context) string {
+	st, ok := ctx.Value(contextKey{}).(*state)
+	if !ok {
+		return ""
+	}
+	return format(st.id)
+}
+
+// NextFrameID returns a compute protocol request ID for the next frame sent
+// on behalf of the request carried by ctx. ok is false if ctx carries no
+// request ID. The top bit is always clear.
+func NextFrameID(ctx context.Context) (frameID uint64, ok bool) {
+	st, ok := ctx.Value(contextKey{}).(*state)
+	if !ok {
+		return 0, false
+	}
+	seq := st.frames.Add(1) & 0xff
+	return st.id<<8 | uint64(seq), true
+}
+
+// format renders a 56-bit ID as 14 hex digits.
+func format(id uint64) string {
+	return fmt.Sprintf("%014x", id)
+}
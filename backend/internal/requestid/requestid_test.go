@@ -0,0 +1,73 @@
+package requestid
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := New()
+		if len(id) != 14 {
+			t.Fatalf("New() = %q, want 14 hex digits", id)
+		}
+		if seen[id] {
+			t.Fatalf("New() returned %q twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestNewContext(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want string
+	}{
+		{"generated", "00a1b2c3d4e5f6", "00a1b2c3d4e5f6"},
+		{"empty", "", ""},
+		{"too short", "abc", ""},
+		{"too long", "00a1b2c3d4e5f6aa", ""},
+		{"not hex", "zzzzzzzzzzzzzz", ""},
+		{"top bit set", "80a1b2c3d4e5f6", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewContext(context.Background(), tt.id)
+			if got := FromContext(ctx); got != tt.want {
+				t.Errorf("FromContext() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextFrameID(t *testing.T) {
+	if _, ok := NextFrameID(context.Background()); ok {
+		t.Error("NextFrameID() ok = true for a context without an ID")
+	}
+
+	id := New()
+	ctx := NewContext(context.Background(), id)
+
+	first, ok := NextFrameID(ctx)
+	if !ok {
+		t.Fatal("NextFrameID() ok = false")
+	}
+	second, _ := NextFrameID(ctx)
+	if first == second {
+		t.Errorf("NextFrameID() returned %x twice", first)
+	}
+
+	for _, frameID := range []uint64{first, second} {
+		if frameID&(1<<63) != 0 {
+			t.Errorf("frame ID %x has the top bit set", frameID)
+		}
+		if hex := fmt.Sprintf("%016x", frameID); !strings.HasPrefix(hex, id) {
+			t.Errorf("frame ID %s does not start with request ID %s", hex, id)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package startup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/logging"
+	"github.com/hurricanerix/weave/internal/web"
+)
+
+// gpuListTimeout bounds weave-compute --list-gpus, which initializes the
+// Vulkan backend to enumerate devices
+const gpuListTimeout = 15 * time.Second
+
+// DetectGPUs returns the GPUs weave-compute can generate on, as listed by
+// weave-compute --list-gpus. Returns nil, with a warning, if the binary is
+// not found or fails; GET /system then lists none.
+func DetectGPUs(ctx context.Context, logger *logging.Logger) []web.GPU {
+	binaryPath, err := findComputeBinary()
+	if err != nil {
+		logger.Warn("Failed to list GPUs: %v", err)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gpuListTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, binaryPath, "--list-gpus").Output()
+	if err != nil {
+		logger.Warn("Failed to list GPUs: %v", err)
+		return nil
+	}
+
+	gpus := parseGPUList(out)
+	for _, gpu := range gpus {
+		logger.Info("GPU %d: %s, %d MB of %d MB VRAM free", gpu.Index, gpu.Name, gpu.VRAMFreeMB, gpu.VRAMTotalMB)
+	}
+	return gpus
+}
+
+// parseGPUList parses the output of weave-compute --list-gpus: one line per
+// device with its index, name, total and free VRAM in MB, separated by
+// tabs. Other lines, such as backend logging, are skipped.
+func parseGPUList(out []byte) []web.GPU {
+	var gpus []web.GPU
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		index, err := strconv.Atoi(fields[0])
+		if err != nil || index < 0 {
+			continue
+		}
+		total, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		free, err := strconv.Atoi(fields[3])
+		if err != nil {
+			continue
+		}
+		gpus = append(gpus, web.GPU{
+			Index:       index,
+			Name:        strings.TrimSpace(fields[1]),
+			VRAMTotalMB: total,
+			VRAMFreeMB:  free,
+		})
+	}
+	return gpus
+}
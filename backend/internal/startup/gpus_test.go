@@ -0,0 +1,27 @@
+package startup
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/web"
+)
+
+func TestParseGPUList(t *testing.T) {
+	out := "ggml_vulkan: Found 2 Vulkan devices:\n" +
+		"0\tAMD Radeon RX 7900 XTX (RADV NAVI31)\t24560\t9000\n" +
+		"1\tNVIDIA GeForce RTX 3060\t12288\t11800\n" +
+		"2\ttruncated\t12288\n" +
+		"x\tnot a device\t1\t1\n"
+
+	want := []web.GPU{
+		{Index: 0, Name: "AMD Radeon RX 7900 XTX (RADV NAVI31)", VRAMTotalMB: 24560, VRAMFreeMB: 9000},
+		{Index: 1, Name: "NVIDIA GeForce RTX 3060", VRAMTotalMB: 12288, VRAMFreeMB: 11800},
+	}
+	if got := parseGPUList([]byte(out)); !slices.Equal(got, want) {
+		t.Errorf("parseGPUList() = %+v, want %+v", got, want)
+	}
+	if got := parseGPUList(nil); len(got) != 0 {
+		t.Errorf("parseGPUList(nil) = %+v, want none", got)
+	}
+}
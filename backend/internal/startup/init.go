@@ -2,22 +2,29 @@ package startup
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/hurricanerix/weave/internal/client"
 	"github.com/hurricanerix/weave/internal/config"
 	"github.com/hurricanerix/weave/internal/conversation"
 	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/llm"
 	"github.com/hurricanerix/weave/internal/logging"
 	"github.com/hurricanerix/weave/internal/ollama"
 	"github.com/hurricanerix/weave/internal/persistence"
+	"github.com/hurricanerix/weave/internal/protocol"
+	"github.com/hurricanerix/weave/internal/store"
 	"github.com/hurricanerix/weave/internal/web"
 )
 
@@ -26,6 +33,17 @@ const (
 	socketDir = "weave"
 	// socketName is the name of the Unix domain socket file
 	socketName = "weave.sock"
+	// PassphraseEnv is the environment variable holding the passphrase for
+	// encrypted sessions
+	PassphraseEnv = "WEAVE_PASSPHRASE"
+	// OpenAIAPIKeyEnv is the environment variable holding the API key for
+	// --llm-backend openai
+	OpenAIAPIKeyEnv = "WEAVE_OPENAI_API_KEY"
+	// computeHeartbeatInterval is how often compute connections are pinged
+	computeHeartbeatInterval = 10 * time.Second
+	// ArchivedSessionsPath is where --expired-session-images archive moves
+	// the images of expired sessions
+	ArchivedSessionsPath = "config/archive/sessions"
 )
 
 var (
@@ -37,102 +55,211 @@ var (
 	ErrComputeBinaryNotFound = errors.New("compute binary not found")
 	// ErrComputeSpawnFailed is returned when spawning the compute process fails
 	ErrComputeSpawnFailed = errors.New("failed to spawn compute process")
+	// ErrComputeTokenRequired is returned when remote compute is configured
+	// but no token is set
+	ErrComputeTokenRequired = errors.New("remote compute requires " + client.TokenEnv + " to be set")
+	// ErrPassphraseRequired is returned when sessions are encrypted but no passphrase is set
+	ErrPassphraseRequired = errors.New("encrypted sessions require " + PassphraseEnv + " to be set")
 )
 
 // Components holds all initialized application components
 type Components struct {
-	OllamaClient      *ollama.Client
+	LLMClient         llm.Client
 	SessionManager    *conversation.SessionManager
 	ImageStore        *persistence.ImageStore
+	Store             *store.Store // Session database with --storage sqlite; nil otherwise
 	ComputeClient     *client.Conn
 	ComputeListener   net.Listener
 	ComputeSocketPath string
 	ComputeProcess    *exec.Cmd
 	ComputeStdin      io.WriteCloser
+	// ComputeWorkers are the compute processes besides ComputeProcess,
+	// with --compute-workers
+	ComputeWorkers []ComputeWorker
+	// ComputeRemote is the address of compute running on another machine,
+	// with --compute-addr; there are no compute processes then
+	ComputeRemote string
+	// ComputeCapabilities is what the compute process reported it can do
+	// when it connected, nil if it did not
+	ComputeCapabilities *protocol.Capabilities
+	// ComputeSupervisor restarts compute when it stops unexpectedly, nil
+	// if it is not supervised
+	ComputeSupervisor *Supervisor
 	WebServer         *web.Server
 	Logger            *logging.Logger
 	ImageStorage      *image.Storage
 }
 
-// CreateSocket creates the Unix socket for weave-compute communication.
-// It constructs the socket path from XDG_RUNTIME_DIR, creates the socket
-// directory with mode 0700 if it doesn't exist, removes any existing socket
-// file, and creates a listening Unix socket.
+// ComputeWorker is a spawned compute process and its stdin pipe.
+type ComputeWorker struct {
+	Process *exec.Cmd
+	Stdin   io.WriteCloser
+}
+
+// SetComputeWorkers sets the compute process fields from workers, as
+// returned by SpawnComputeWorkers: the first is ComputeProcess, the others
+// ComputeWorkers.
+func (c *Components) SetComputeWorkers(workers []ComputeWorker) {
+	c.ComputeProcess = workers[0].Process
+	c.ComputeStdin = workers[0].Stdin
+	c.ComputeWorkers = workers[1:]
+}
+
+// ComputeArgs returns the arguments compute worker n is spawned with for
+// cfg, after --socket-path: the LoRA directory, if any, and the GPU it
+// generates on when --gpu is set or there are several workers.
+func ComputeArgs(cfg *config.Config, n int) []string {
+	var args []string
+	if cfg.LoRADir != "" {
+		args = append(args, "--lora-dir", cfg.LoRADir)
+	}
+	if gpus := cfg.ComputeGPUs(); (len(cfg.GPUs) > 0 || len(gpus) > 1) && n < len(gpus) {
+		args = append(args, "--gpu", strconv.Itoa(gpus[n]))
+	}
+	return args
+}
+
+// SpawnCompute spawns the compute process as a child process.
+// It passes the socket path via the --socket-path CLI argument, followed by
+// args (see ComputeArgs), and sets up stdio pipes for lifecycle monitoring
+// and logging.
 //
-// CALLER MUST CLOSE THE LISTENER when done to avoid resource leaks.
+// The compute process will automatically terminate when:
+// - weave closes stdin (indicating parent process death)
+// - The socket connection is closed
 //
-// Returns the listener, socket path, and error if XDG_RUNTIME_DIR is not set,
-// not absolute, or if socket creation fails.
-func CreateSocket() (net.Listener, string, error) {
-	// Get XDG_RUNTIME_DIR
-	xdgRuntimeDir := os.Getenv("XDG_RUNTIME_DIR")
-	if xdgRuntimeDir == "" {
-		return nil, "", client.ErrXDGNotSet
+// CALLER MUST:
+// 1. Store the returned stdin pipe in Components.ComputeStdin and close it during shutdown
+// 2. Call cmd.Wait() to reap the child process and prevent zombies
+//
+// Closing stdin triggers graceful compute shutdown. After closing stdin, call
+// cmd.Wait() to collect the exit status and prevent zombie processes.
+//
+// Returns the *exec.Cmd and stdin WriteCloser, or error if spawning fails.
+func SpawnCompute(socketPath string, args ...string) (*exec.Cmd, io.WriteCloser, error) {
+	binaryPath, err := findComputeBinary()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Validate XDG_RUNTIME_DIR is an absolute path
-	if !filepath.IsAbs(xdgRuntimeDir) {
-		return nil, "", ErrXDGNotAbsolute
-	}
+	// Create command with --socket-path argument
+	cmd := exec.Command(binaryPath, append([]string{"--socket-path", socketPath}, args...)...)
 
-	// Clean path to remove .. and .
-	xdgRuntimeDir = filepath.Clean(xdgRuntimeDir)
+	// Set up stdin pipe for lifecycle monitoring
+	// When weave dies, stdin will be closed, triggering compute shutdown
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to create stdin pipe: %v", ErrComputeSpawnFailed, err)
+	}
 
-	// Verify path is still absolute after cleaning
-	if !filepath.IsAbs(xdgRuntimeDir) {
-		return nil, "", ErrXDGResolvesToRelative
+	if env := computeEnv(socketPath); env != nil {
+		cmd.Env = append(os.Environ(), env...)
 	}
 
-	// SECURITY: Validate cleaned path doesn't contain path traversal attempts
-	// After cleaning, the path should not contain .. components
-	if filepath.Clean(xdgRuntimeDir) != xdgRuntimeDir {
-		return nil, "", fmt.Errorf("XDG_RUNTIME_DIR contains path traversal elements")
+	// Connect stdout and stderr to parent's streams for logging
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Start the process
+	if err := cmd.Start(); err != nil {
+		stdin.Close() // Clean up stdin pipe on failure
+		return nil, nil, fmt.Errorf("%w: %v", ErrComputeSpawnFailed, err)
 	}
 
-	// Construct socket directory path
-	sockDir := filepath.Join(xdgRuntimeDir, socketDir)
+	return cmd, stdin, nil
+}
 
-	// Create socket directory with mode 0700 if it doesn't exist
-	if err := os.MkdirAll(sockDir, 0700); err != nil {
-		return nil, "", fmt.Errorf("failed to create socket directory: %w", err)
+// SpawnComputeWorkers spawns cfg.ComputeWorkers compute processes with
+// SpawnCompute, all connecting to socketPath. With more than one, worker n
+// generates on GPU n, or on the nth GPU given with --gpu. If a spawn fails,
+// the processes already spawned are stopped.
+func SpawnComputeWorkers(socketPath string, cfg *config.Config, logger *logging.Logger) ([]ComputeWorker, error) {
+	n := max(cfg.ComputeWorkers, 1)
+	workers := make([]ComputeWorker, 0, n)
+	for i := range n {
+		process, stdin, err := SpawnCompute(socketPath, ComputeArgs(cfg, i)...)
+		if err != nil {
+			for _, w := range workers {
+				stopCompute(w.Process, w.Stdin, logger)
+			}
+			return nil, err
+		}
+		logger.Info("Spawned weave-compute process (PID: %d)", process.Process.Pid)
+		workers = append(workers, ComputeWorker{Process: process, Stdin: stdin})
+	}
+	return workers, nil
+}
+
+// AcceptComputeWorkers accepts n compute connections on listener and
+// returns them as one connection: the connection itself for one worker, a
+// pool spreading requests over them for several (see client.NewPool).
+// Each connection is pinged every computeHeartbeatInterval and closed if
+// compute stops answering, so the supervisor restarts it.
+func AcceptComputeWorkers(ctx context.Context, listener net.Listener, n int) (*client.Conn, error) {
+	conns := make([]*client.Conn, 0, n)
+	for range n {
+		conn, err := client.AcceptConnection(ctx, listener)
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
 	}
+	pool := client.NewPool(conns...)
+	pool.StartHeartbeat(computeHeartbeatInterval)
+	return pool, nil
+}
 
-	// Construct full socket path
-	socketPath := filepath.Join(sockDir, socketName)
+// DialRemoteCompute connects to compute running on another machine at
+// cfg.ComputeAddr with the token in client.TokenEnv, over TLS with
+// cfg.ComputeTLS or cfg.ComputeCA. The connection is pinged like spawned
+// compute, so the supervisor reconnects when it drops.
+func DialRemoteCompute(ctx context.Context, cfg *config.Config, logger *logging.Logger) (*client.Conn, error) {
+	token := os.Getenv(client.TokenEnv)
+	if token == "" {
+		return nil, ErrComputeTokenRequired
+	}
 
-	// Remove any existing socket file (left over from previous crash)
-	// Ignore error if file doesn't exist
-	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
-		return nil, "", fmt.Errorf("failed to remove existing socket file: %w", err)
+	var tlsConfig *tls.Config
+	if cfg.ComputeTLS || cfg.ComputeCA != "" {
+		host, _, _ := net.SplitHostPort(cfg.ComputeAddr)
+		tlsConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		if cfg.ComputeCA != "" {
+			pem, err := os.ReadFile(cfg.ComputeCA)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read compute CA: %w", err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in compute CA %s", cfg.ComputeCA)
+			}
+		}
+	} else if host, _, _ := net.SplitHostPort(cfg.ComputeAddr); !isLoopback(host) {
+		logger.Warn("Connecting to compute at %s without --compute-tls: the token and images are sent unencrypted", cfg.ComputeAddr)
 	}
 
-	// Create and bind the Unix socket
-	listener, err := net.Listen("unix", socketPath)
+	conn, err := client.DialRemote(ctx, cfg.ComputeAddr, token, tlsConfig)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to create socket: %w", err)
+		return nil, fmt.Errorf("failed to connect to compute at %s: %w", cfg.ComputeAddr, err)
 	}
+	pool := client.NewPool(conn)
+	pool.StartHeartbeat(computeHeartbeatInterval)
+	return pool, nil
+}
 
-	return listener, socketPath, nil
+// isLoopback reports whether host, a name or IP, is this machine.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
 
-// SpawnCompute spawns the compute process as a child process.
-// It passes the socket path via the --socket-path CLI argument and sets up
-// stdio pipes for lifecycle monitoring and logging.
-//
-// The compute process will automatically terminate when:
-// - weave closes stdin (indicating parent process death)
-// - The socket connection is closed
-//
-// CALLER MUST:
-// 1. Store the returned stdin pipe in Components.ComputeStdin and close it during shutdown
-// 2. Call cmd.Wait() to reap the child process and prevent zombies
-//
-// Closing stdin triggers graceful compute shutdown. After closing stdin, call
-// cmd.Wait() to collect the exit status and prevent zombie processes.
-//
-// Returns the *exec.Cmd and stdin WriteCloser, or error if spawning fails.
-func SpawnCompute(socketPath string) (*exec.Cmd, io.WriteCloser, error) {
-	// Find the compute binary
+// findComputeBinary returns the path of the weave-compute binary.
+func findComputeBinary() (string, error) {
 	// Try multiple locations to handle both runtime and test contexts
 	candidatePaths := []string{
 		"compute/weave-compute",          // From project root
@@ -150,63 +277,119 @@ func SpawnCompute(socketPath string) (*exec.Cmd, io.WriteCloser, error) {
 		candidatePaths = append([]string{siblingPath}, candidatePaths...)
 	}
 
-	var binaryPath string
 	for _, path := range candidatePaths {
 		if _, err := os.Stat(path); err == nil {
-			binaryPath = path
-			break
+			return path, nil
 		}
 	}
+	return "", fmt.Errorf("%w: tried paths: %v", ErrComputeBinaryNotFound, candidatePaths)
+}
+
+// CreateLogger creates a logger with the configured log level
+func CreateLogger(cfg *config.Config) *logging.Logger {
+	return logging.NewFromString(cfg.LogLevel, nil)
+}
 
-	if binaryPath == "" {
-		return nil, nil, fmt.Errorf("%w: tried paths: %v", ErrComputeBinaryNotFound, candidatePaths)
+// CreateLLMClient creates the chat client for the configured backend: an
+// ollama client with the configured keep-alive and output mode (a pool of
+// them when several ollama URLs are given), or an OpenAI-compatible client
+// using the API key in $WEAVE_OPENAI_API_KEY. With --capture-llm, chats are
+// written to llm.DefaultCaptureDir.
+// It does NOT validate connection - use ValidateLLM() separately.
+func CreateLLMClient(cfg *config.Config) llm.Client {
+	var chatTransport http.RoundTripper
+	if cfg.CaptureLLM {
+		chatTransport = llm.NewCaptureTransport(llm.DefaultCaptureDir, nil)
+	}
+	if cfg.LLMBackend == config.LLMBackendOpenAI {
+		client := llm.NewOpenAIClient(cfg.OpenAIURL, cfg.OpenAIModel, os.Getenv(OpenAIAPIKeyEnv), 60*time.Second)
+		client.SetChatTransport(chatTransport)
+		return client
 	}
+	endpoints := cfg.OllamaEndpoints()
+	clients := make([]*ollama.Client, len(endpoints))
+	for i, endpoint := range endpoints {
+		clients[i] = ollama.NewClientWithConfig(endpoint, cfg.OllamaModel, 60*time.Second)
+		clients[i].SetKeepAlive(cfg.OllamaKeepAlive)
+		clients[i].SetStructuredOutput(cfg.OllamaStructuredOutput)
+		clients[i].SetChatTransport(chatTransport)
+	}
+	if len(clients) == 1 {
+		return clients[0]
+	}
+	return ollama.NewPool(clients...)
+}
 
-	// Create command with --socket-path argument
-	cmd := exec.Command(binaryPath, "--socket-path", socketPath)
+// CreateStore opens the session database at store.DefaultPath with
+// --storage sqlite, importing the sessions in config/sessions into it the
+// first time. Returns nil with --storage files. Conversations are
+// encrypted with encryptor, from CreateSessionEncryption, if it is not nil.
+//
+// CALLER MUST CLOSE THE STORE when done.
+func CreateStore(cfg *config.Config, encryptor *persistence.Encryptor, logger *logging.Logger) (*store.Store, error) {
+	if cfg.Storage != config.StorageSQLite {
+		return nil, nil
+	}
 
-	// Set up stdin pipe for lifecycle monitoring
-	// When weave dies, stdin will be closed, triggering compute shutdown
-	stdin, err := cmd.StdinPipe()
+	db, err := store.Open(store.DefaultPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("%w: failed to create stdin pipe: %v", ErrComputeSpawnFailed, err)
+		return nil, err
 	}
-
-	// Connect stdout and stderr to parent's streams for logging
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	// Start the process
-	if err := cmd.Start(); err != nil {
-		stdin.Close() // Clean up stdin pipe on failure
-		return nil, nil, fmt.Errorf("%w: %v", ErrComputeSpawnFailed, err)
+	files := persistence.NewSessionStore("config/sessions")
+	if encryptor != nil {
+		db.SetEncryptor(encryptor)
+		files.SetEncryptor(encryptor)
+		logger.Info("Stored conversations are encrypted")
 	}
 
-	return cmd, stdin, nil
-}
-
-// CreateLogger creates a logger with the configured log level
-func CreateLogger(cfg *config.Config) *logging.Logger {
-	return logging.NewFromString(cfg.LogLevel, nil)
-}
+	imported, err := db.Import(files, persistence.NewImageStore("config/sessions"))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to import sessions: %w", err)
+	}
+	if imported > 0 {
+		logger.Info("Imported %d sessions from config/sessions into %s", imported, store.DefaultPath)
+	}
 
-// CreateOllamaClient creates an ollama client with the configured URL and model.
-// It does NOT validate connection - use ValidateOllama() separately.
-func CreateOllamaClient(cfg *config.Config) *ollama.Client {
-	return ollama.NewClientWithConfig(cfg.OllamaURL, cfg.OllamaModel, 60*time.Second)
+	logger.Debug("Opened session store at %s", store.DefaultPath)
+	return db, nil
 }
 
 // CreateSessionManager creates a session manager with persistence support.
-// Sessions are stored in config/sessions/ and automatically loaded on-demand.
-func CreateSessionManager(logger *logging.Logger) *conversation.SessionManager {
+// Sessions are stored in db, or in config/sessions/ if db is nil, and
+// automatically loaded on-demand. Sessions in config/sessions/ are
+// encrypted with encryptor, from CreateSessionEncryption, if it is not nil.
+func CreateSessionManager(cfg *config.Config, db *store.Store, encryptor *persistence.Encryptor, logger *logging.Logger) (*conversation.SessionManager, error) {
+	if db != nil {
+		return conversation.NewSessionManagerWithPersistence(db), nil
+	}
+
 	// Create session store with base path
 	store := persistence.NewSessionStore("config/sessions")
+	if encryptor != nil {
+		store.SetEncryptor(encryptor)
+		logger.Info("Stored conversations are encrypted")
+	}
 
 	// Create session manager with persistence
 	sm := conversation.NewSessionManagerWithPersistence(store)
 
 	logger.Debug("Created session manager with persistence at config/sessions")
-	return sm
+	return sm, nil
+}
+
+// CreateSessionEncryption returns the encryptor for sessions stored in
+// basePath, or nil if they aren't encrypted. Encryption is turned on by
+// --encrypt-sessions and stays on once sessions have been encrypted, so
+// encrypted files are never read or overwritten without the passphrase.
+func CreateSessionEncryption(cfg *config.Config, basePath, passphrase string) (*persistence.Encryptor, error) {
+	if !cfg.EncryptSessions && !persistence.EncryptionConfigured(basePath) {
+		return nil, nil
+	}
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	return persistence.OpenEncryption(basePath, passphrase)
 }
 
 // CreateImageStore creates an image store for session-specific images.
@@ -217,19 +400,62 @@ func CreateImageStore(logger *logging.Logger) *persistence.ImageStore {
 	return store
 }
 
-// CreateImageStorage creates image storage and starts cleanup goroutine
-func CreateImageStorage(ctx context.Context, logger *logging.Logger) *image.Storage {
+// ConfigureSessionExpiry applies --session-idle-timeout to sm and sets what
+// happens to the images of the sessions it expires. It can be called again
+// with a new cfg to change both.
+func ConfigureSessionExpiry(cfg *config.Config, sm *conversation.SessionManager, images *persistence.ImageStore, logger *logging.Logger) {
+	sm.SetIdleTimeout(cfg.SessionIdleTimeout)
+
+	policy := cfg.ExpiredSessionImages
+	if policy == "" || policy == config.ExpiredSessionImagesKeep || images == nil {
+		sm.SetExpireFunc(nil)
+		return
+	}
+	sm.SetExpireFunc(func(sessionIDs []string) {
+		var total persistence.ReclaimedImages
+		for _, sessionID := range sessionIDs {
+			var reclaimed persistence.ReclaimedImages
+			var err error
+			if policy == config.ExpiredSessionImagesArchive {
+				reclaimed, err = images.ArchiveSession(sessionID, ArchivedSessionsPath)
+			} else {
+				reclaimed, err = images.DeleteSession(sessionID)
+			}
+			if err != nil {
+				logger.Warn("Failed to %s images of expired session %s: %v", policy, sessionID, err)
+			}
+			total.Files += reclaimed.Files
+			total.Bytes += reclaimed.Bytes
+		}
+
+		verb := "Deleted"
+		if policy == config.ExpiredSessionImagesArchive {
+			verb = "Archived"
+		}
+		logger.Info("%s %d images (%.1f MiB) of %d expired sessions", verb, total.Files, float64(total.Bytes)/(1<<20), len(sessionIDs))
+	})
+}
+
+// CreateImageStorage creates image storage and starts cleanup goroutine.
+// Images are kept in memory unless --image-storage-dir is set.
+func CreateImageStorage(ctx context.Context, cfg *config.Config, logger *logging.Logger) (*image.Storage, error) {
 	storage := image.NewStorage()
+	if cfg.ImageStorageDir != "" {
+		var err error
+		storage, err = image.NewDiskStorage(cfg.ImageStorageDir, int64(cfg.ImageMemoryMB)<<20, int64(cfg.ImageDiskMB)<<20)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Keeping generated images in %s (%d MiB cached in memory, %d MiB on disk)", cfg.ImageStorageDir, cfg.ImageMemoryMB, cfg.ImageDiskMB)
+	}
 	storage.StartCleanup(ctx, logger)
-	return storage
+	return storage, nil
 }
 
 // CreateWebServer creates the HTTP server with all dependencies wired
-func CreateWebServer(cfg *config.Config, ollamaClient *ollama.Client, sessionManager *conversation.SessionManager, imageStorage *image.Storage, imageStore *persistence.ImageStore, computeClient *client.Conn, logger *logging.Logger) (*web.Server, error) {
-	addr := fmt.Sprintf("localhost:%d", cfg.Port)
-
+func CreateWebServer(cfg *config.Config, llmClient llm.Client, sessionManager *conversation.SessionManager, imageStorage *image.Storage, imageStore *persistence.ImageStore, computeClient *client.Conn, logger *logging.Logger) (*web.Server, error) {
 	// Create server with dependencies including config for default generation settings
-	server, err := web.NewServerWithDeps(addr, ollamaClient, sessionManager, imageStorage, imageStore, computeClient, cfg)
+	server, err := web.NewServerWithDeps(cfg.Addr(), llmClient, sessionManager, imageStorage, imageStore, computeClient, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create web server: %w", err)
 	}
@@ -248,38 +474,121 @@ func CreateWebServer(cfg *config.Config, ollamaClient *ollama.Client, sessionMan
 func InitializeAll(ctx context.Context, cfg *config.Config, logger *logging.Logger, computeClient *client.Conn) (*Components, error) {
 	logger.Debug("Initializing components")
 
-	// Create ollama client
-	ollamaClient := CreateOllamaClient(cfg)
-	logger.Debug("Created ollama client: endpoint=%s, model=%s", cfg.OllamaURL, cfg.OllamaModel)
+	// Create LLM client
+	llmClient := CreateLLMClient(cfg)
+	logger.Debug("Created %s LLM client", llmBackend(cfg))
+
+	// Derive the key for encryption at rest once, as it is slow
+	encryptor, err := CreateSessionEncryption(cfg, "config/sessions", os.Getenv(PassphraseEnv))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session encryption: %w", err)
+	}
+
+	// Open the session database, with --storage sqlite
+	db, err := CreateStore(cfg, encryptor, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session store: %w", err)
+	}
 
 	// Create session manager with persistence
-	sessionManager := CreateSessionManager(logger)
+	sessionManager, err := CreateSessionManager(cfg, db, encryptor, logger)
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, fmt.Errorf("failed to create session manager: %w", err)
+	}
 
-	// Create image store for session-specific images
+	// Create image store for session-specific images, indexed in the
+	// session database if there is one
 	imageStore := CreateImageStore(logger)
+	if db != nil {
+		imageStore.SetIndex(db)
+	}
+	ConfigureSessionExpiry(cfg, sessionManager, imageStore, logger)
 
 	// Create image storage with cleanup goroutine
-	imageStorage := CreateImageStorage(ctx, logger)
+	imageStorage, err := CreateImageStorage(ctx, cfg, logger)
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, fmt.Errorf("failed to create image storage: %w", err)
+	}
 	logger.Debug("Created image storage with cleanup enabled")
 
 	// Create web server with compute client
-	webServer, err := CreateWebServer(cfg, ollamaClient, sessionManager, imageStorage, imageStore, computeClient, logger)
+	webServer, err := CreateWebServer(cfg, llmClient, sessionManager, imageStorage, imageStore, computeClient, logger)
 	if err != nil {
+		if db != nil {
+			db.Close()
+		}
 		return nil, fmt.Errorf("failed to create web server: %w", err)
 	}
-	logger.Debug("Created web server on port %d", cfg.Port)
+	webServer.SetEncryptor(encryptor)
+	logger.Debug("Created web server on %s", cfg.Addr())
+
+	// Ask the compute process what it can do, so the web server can check
+	// requests before sending them
+	var caps *protocol.Capabilities
+	if computeClient != nil {
+		caps = QueryComputeCapabilities(ctx, computeClient, logger)
+		webServer.SetComputeCapabilities(caps)
+		webServer.SetGPUs(DetectGPUs(ctx, logger))
+	}
 
 	return &Components{
-		OllamaClient:      ollamaClient,
-		SessionManager:    sessionManager,
-		ImageStore:        imageStore,
-		ComputeClient:     computeClient,
-		ComputeListener:   nil, // Set by caller
-		ComputeSocketPath: "",  // Set by caller
-		ComputeProcess:    nil, // Set by caller
-		ComputeStdin:      nil, // Set by caller
-		WebServer:         webServer,
-		Logger:            logger,
-		ImageStorage:      imageStorage,
+		LLMClient:           llmClient,
+		SessionManager:      sessionManager,
+		ImageStore:          imageStore,
+		Store:               db,
+		ComputeClient:       computeClient,
+		ComputeListener:     nil, // Set by caller
+		ComputeSocketPath:   "",  // Set by caller
+		ComputeProcess:      nil, // Set by caller
+		ComputeStdin:        nil, // Set by caller
+		ComputeCapabilities: caps,
+		WebServer:           webServer,
+		Logger:              logger,
+		ImageStorage:        imageStorage,
 	}, nil
 }
+
+// NegotiateComputeVersion agrees on a protocol version with the compute
+// processes on conn and logs it. Compute that predates version negotiation
+// does not answer; it is assumed to speak version 1 and a warning is
+// logged. Returns an error if compute speaks no version weave does, or
+// fails to answer otherwise.
+func NegotiateComputeVersion(ctx context.Context, conn *client.Conn, logger *logging.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, computeTimeout)
+	defer cancel()
+
+	version, err := conn.Negotiate(ctx)
+	switch {
+	case errors.Is(err, client.ErrVersionNotNegotiated):
+		logger.Warn("Compute did not negotiate a protocol version, assuming version %d; update weave-compute", version)
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to negotiate protocol version: %w", err)
+	}
+	logger.Debug("Speaking protocol version %d with compute", version)
+	return nil
+}
+
+// QueryComputeCapabilities asks the compute process on conn what it can do
+// and logs it. Returns nil, with a warning, if compute does not answer in
+// time, answers with an error or speaks another protocol version; requests
+// are then sent unchecked.
+func QueryComputeCapabilities(ctx context.Context, conn *client.Conn, logger *logging.Logger) *protocol.Capabilities {
+	ctx, cancel := context.WithTimeout(ctx, computeTimeout)
+	defer cancel()
+
+	caps, err := conn.Capabilities(ctx)
+	if err != nil {
+		logger.Warn("Failed to get compute capabilities, requests will not be checked: %v", err)
+		return nil
+	}
+	logger.Info("Compute capabilities: up to %dx%d, %d MB of %d MB VRAM free, %d models, request types %#x",
+		caps.MaxWidth, caps.MaxHeight, caps.VRAMFreeMB, caps.VRAMTotalMB, len(caps.Models), caps.RequestTypes)
+	return caps
+}
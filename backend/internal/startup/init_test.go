@@ -3,13 +3,20 @@ package startup
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/hurricanerix/weave/internal/client"
 	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/logging"
+	"github.com/hurricanerix/weave/internal/persistence"
 )
 
 func TestCreateLogger(t *testing.T) {
@@ -24,24 +31,64 @@ func TestCreateLogger(t *testing.T) {
 	}
 }
 
-func TestCreateOllamaClient(t *testing.T) {
-	cfg := &config.Config{
-		OllamaURL:   "http://localhost:11434",
-		OllamaModel: "llama3.2:1b",
-	}
-
-	client := CreateOllamaClient(cfg)
-
-	if client == nil {
-		t.Fatal("CreateOllamaClient() returned nil")
+func TestCreateLLMClient(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          *config.Config
+		wantEndpoint string
+		wantModel    string
+	}{
+		{
+			name:         "ollama",
+			cfg:          &config.Config{OllamaURL: "http://localhost:11434", OllamaModel: "llama3.2:1b"},
+			wantEndpoint: "http://localhost:11434",
+			wantModel:    "llama3.2:1b",
+		},
+		{
+			name: "ollama pool",
+			cfg: &config.Config{
+				OllamaURL:   "http://gpu1:11434",
+				OllamaURLs:  []string{"http://gpu1:11434", "http://gpu2:11434"},
+				OllamaModel: "llama3.2:1b",
+			},
+			wantEndpoint: "http://gpu1:11434,http://gpu2:11434",
+			wantModel:    "llama3.2:1b",
+		},
+		{
+			name: "openai",
+			cfg: &config.Config{
+				LLMBackend:  config.LLMBackendOpenAI,
+				OllamaURL:   "http://localhost:11434",
+				OllamaModel: "llama3.2:1b",
+				OpenAIURL:   "http://localhost:8000/v1",
+				OpenAIModel: "qwen2.5-7b-instruct",
+			},
+			wantEndpoint: "http://localhost:8000/v1",
+			wantModel:    "qwen2.5-7b-instruct",
+		},
 	}
 
-	if client.Endpoint() != cfg.OllamaURL {
-		t.Errorf("Endpoint() = %s, want %s", client.Endpoint(), cfg.OllamaURL)
-	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := CreateLLMClient(tt.cfg)
+			if client == nil {
+				t.Fatal("CreateLLMClient() returned nil")
+			}
 
-	if client.Model() != cfg.OllamaModel {
-		t.Errorf("Model() = %s, want %s", client.Model(), cfg.OllamaModel)
+			c, ok := client.(interface {
+				Endpoint() string
+				Model() string
+			})
+			if !ok {
+				t.Fatalf("CreateLLMClient() returned %T without Endpoint and Model", client)
+			}
+			if c.Endpoint() != tt.wantEndpoint {
+				t.Errorf("Endpoint() = %s, want %s", c.Endpoint(), tt.wantEndpoint)
+			}
+			if c.Model() != tt.wantModel {
+				t.Errorf("Model() = %s, want %s", c.Model(), tt.wantModel)
+			}
+		})
 	}
 }
 
@@ -51,13 +98,87 @@ func TestCreateSessionManager(t *testing.T) {
 	}
 	logger := CreateLogger(cfg)
 
-	manager := CreateSessionManager(logger)
-
+	manager, err := CreateSessionManager(cfg, nil, nil, logger)
+	if err != nil {
+		t.Fatalf("CreateSessionManager() error = %v, want nil", err)
+	}
 	if manager == nil {
 		t.Fatal("CreateSessionManager() returned nil")
 	}
 }
 
+func TestCreateStore(t *testing.T) {
+	t.Chdir(t.TempDir())
+	logger := CreateLogger(&config.Config{LogLevel: "info"})
+
+	db, err := CreateStore(&config.Config{Storage: config.StorageFiles}, nil, logger)
+	if err != nil || db != nil {
+		t.Fatalf("CreateStore() with files storage = %v, %v, want nil, nil", db, err)
+	}
+
+	sessionID := "0123456789abcdef0123456789abcdef"
+	if err := persistence.NewSessionStore("config/sessions").Save(sessionID, conversation.NewConversation()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	db, err = CreateStore(&config.Config{Storage: config.StorageSQLite}, nil, logger)
+	if err != nil {
+		t.Fatalf("CreateStore() error = %v", err)
+	}
+	defer db.Close()
+	if !db.Exists(sessionID) {
+		t.Error("session in config/sessions was not imported")
+	}
+
+	manager, err := CreateSessionManager(&config.Config{Storage: config.StorageSQLite}, db, nil, logger)
+	if err != nil || manager == nil {
+		t.Fatalf("CreateSessionManager() = %v, %v, want a manager", manager, err)
+	}
+	manager.Shutdown()
+}
+
+func TestCreateSessionEncryption(t *testing.T) {
+	encrypted := t.TempDir()
+	if _, err := persistence.OpenEncryption(encrypted, "secret"); err != nil {
+		t.Fatalf("OpenEncryption() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		enable     bool
+		basePath   string
+		passphrase string
+		wantNil    bool
+		wantErr    error
+	}{
+		{name: "disabled", basePath: t.TempDir(), wantNil: true},
+		{name: "disabled ignores passphrase", basePath: t.TempDir(), passphrase: "secret", wantNil: true},
+		{name: "enabled without passphrase", enable: true, basePath: t.TempDir(), wantErr: ErrPassphraseRequired},
+		{name: "enabled", enable: true, basePath: t.TempDir(), passphrase: "secret"},
+		{name: "already encrypted", basePath: encrypted, passphrase: "secret"},
+		{name: "already encrypted without passphrase", basePath: encrypted, wantErr: ErrPassphraseRequired},
+		{name: "wrong passphrase", basePath: encrypted, passphrase: "guess", wantErr: persistence.ErrWrongPassphrase},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{EncryptSessions: tt.enable}
+			enc, err := CreateSessionEncryption(cfg, tt.basePath, tt.passphrase)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("CreateSessionEncryption() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateSessionEncryption() error = %v", err)
+			}
+			if (enc == nil) != tt.wantNil {
+				t.Errorf("CreateSessionEncryption() = %v, want nil %v", enc, tt.wantNil)
+			}
+		})
+	}
+}
+
 func TestCreateWebServer(t *testing.T) {
 	cfg := &config.Config{
 		Port:        8080,
@@ -68,12 +189,18 @@ func TestCreateWebServer(t *testing.T) {
 
 	ctx := context.Background()
 	logger := CreateLogger(cfg)
-	ollamaClient := CreateOllamaClient(cfg)
-	sessionManager := CreateSessionManager(logger)
-	imageStorage := CreateImageStorage(ctx, logger)
+	llmClient := CreateLLMClient(cfg)
+	sessionManager, err := CreateSessionManager(cfg, nil, nil, logger)
+	if err != nil {
+		t.Fatalf("CreateSessionManager() error = %v, want nil", err)
+	}
+	imageStorage, err := CreateImageStorage(ctx, cfg, logger)
+	if err != nil {
+		t.Fatalf("CreateImageStorage() error = %v, want nil", err)
+	}
 	imageStore := CreateImageStore(logger)
 
-	server, err := CreateWebServer(cfg, ollamaClient, sessionManager, imageStorage, imageStore, nil, logger)
+	server, err := CreateWebServer(cfg, llmClient, sessionManager, imageStorage, imageStore, nil, logger)
 	if err != nil {
 		t.Fatalf("CreateWebServer() error = %v, want nil", err)
 	}
@@ -110,8 +237,8 @@ func TestInitializeAll(t *testing.T) {
 		t.Fatal("InitializeAll() returned nil components")
 	}
 
-	if components.OllamaClient == nil {
-		t.Error("OllamaClient is nil")
+	if components.LLMClient == nil {
+		t.Error("LLMClient is nil")
 	}
 
 	if components.SessionManager == nil {
@@ -156,6 +283,65 @@ func TestInitializeAll(t *testing.T) {
 	_ = output
 }
 
+func TestComputeArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		n    int
+		want string
+	}{
+		{name: "defaults", cfg: &config.Config{ComputeWorkers: 1}},
+		{name: "LoRA dir", cfg: &config.Config{ComputeWorkers: 1, LoRADir: "config/loras"}, want: "--lora-dir config/loras"},
+		{name: "GPU", cfg: &config.Config{ComputeWorkers: 1, GPUs: []int{1}}, want: "--gpu 1"},
+		{name: "second worker", cfg: &config.Config{ComputeWorkers: 2}, n: 1, want: "--gpu 1"},
+		{name: "second worker GPU", cfg: &config.Config{ComputeWorkers: 2, GPUs: []int{0, 2}, LoRADir: "loras"}, n: 1, want: "--lora-dir loras --gpu 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(ComputeArgs(tt.cfg, tt.n), " "); got != tt.want {
+				t.Errorf("ComputeArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDialRemoteCompute(t *testing.T) {
+	listener, err := client.ListenTCP()
+	if err != nil {
+		t.Fatalf("ListenTCP() failed: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	logger := logging.New(logging.LevelError, io.Discard)
+	cfg := &config.Config{ComputeAddr: strings.TrimPrefix(listener.Address(), client.TCPScheme)}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Setenv(client.TokenEnv, "")
+	if _, err := DialRemoteCompute(ctx, cfg, logger); !errors.Is(err, ErrComputeTokenRequired) {
+		t.Errorf("DialRemoteCompute() without a token error = %v, want %v", err, ErrComputeTokenRequired)
+	}
+
+	t.Setenv(client.TokenEnv, listener.Token())
+	caCfg := *cfg
+	caCfg.ComputeCA = filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := DialRemoteCompute(ctx, &caCfg, logger); err == nil {
+		t.Error("DialRemoteCompute() with a missing CA file succeeded")
+	}
+
+	conn, err := DialRemoteCompute(ctx, cfg, logger)
+	if err != nil {
+		t.Fatalf("DialRemoteCompute() failed: %v", err)
+	}
+	conn.Close()
+}
+
 func TestCreateSocket(t *testing.T) {
 	tests := []struct {
 		name          string
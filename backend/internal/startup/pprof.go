@@ -0,0 +1,49 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/logging"
+)
+
+// StartPprof serves the net/http/pprof handlers at /debug/pprof/ on
+// localhost:port until ctx is cancelled, and returns the listening address.
+// The profiles are kept off the main server so they are never exposed with
+// it, and so a stuck web server can still be profiled.
+func StartPprof(ctx context.Context, port int, logger *logging.Logger) (string, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		return "", fmt.Errorf("failed to listen for pprof: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// No write timeout: CPU profiles and traces stream for ?seconds=N
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("pprof server failed: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	return listener.Addr().String(), nil
+}
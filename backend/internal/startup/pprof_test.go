@@ -0,0 +1,47 @@
+package startup
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+func TestStartPprof(t *testing.T) {
+	logger := CreateLogger(&config.Config{LogLevel: "error"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addr, err := StartPprof(ctx, 0, logger)
+	if err != nil {
+		t.Fatalf("StartPprof() error = %v", err)
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/pprof/heap"} {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s status = %d, want %d", path, resp.StatusCode, http.StatusOK)
+		}
+	}
+
+	// Cancelling the context stops the server
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp, err := http.Get("http://" + addr + "/debug/pprof/")
+		if err != nil {
+			break
+		}
+		resp.Body.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("pprof server still serving after cancel")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,82 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/logging"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// pullLogInterval limits how often download progress is logged during a
+// model pull; each new step is logged as it starts.
+const pullLogInterval = 10 * time.Second
+
+// MissingOllamaModel returns the ollama endpoints that are reachable but
+// don't have cfg.OllamaModel. Unreachable endpoints are skipped: the pool
+// fails over from them, and ValidateLLM has checked that one is up.
+func MissingOllamaModel(cfg *config.Config) []string {
+	var missing []string
+	for _, endpoint := range cfg.OllamaEndpoints() {
+		ctx, cancel := context.WithTimeout(context.Background(), ollamaTimeout)
+		err := ollama.NewClientWithConfig(endpoint, cfg.OllamaModel, ollamaTimeout).Connect(ctx)
+		cancel()
+		if errors.Is(err, ollama.ErrModelNotFound) {
+			missing = append(missing, endpoint)
+		}
+	}
+	return missing
+}
+
+// PullOllamaModel pulls cfg.OllamaModel into ollama at each of endpoints,
+// logging its progress, and passes every update to progress if it is not
+// nil. It stops at the first endpoint that fails.
+func PullOllamaModel(ctx context.Context, cfg *config.Config, endpoints []string, logger *logging.Logger, progress ollama.PullFunc) error {
+	for _, endpoint := range endpoints {
+		logger.Info("Pulling model %s into ollama at %s...", cfg.OllamaModel, endpoint)
+		start := time.Now()
+		var lastStatus string
+		var lastLogged time.Time
+		err := ollama.NewClientWithConfig(endpoint, cfg.OllamaModel, ollamaTimeout).Pull(ctx, cfg.OllamaModel, func(p ollama.PullProgress) {
+			if p.Status != lastStatus || (p.Total > 0 && time.Since(lastLogged) >= pullLogInterval) {
+				logger.Info("Pulling %s: %s", cfg.OllamaModel, describePullProgress(p))
+				lastStatus, lastLogged = p.Status, time.Now()
+			}
+			if progress != nil {
+				progress(p)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to pull %s at %s: %w", cfg.OllamaModel, endpoint, err)
+		}
+		logger.Info("Pulled model %s at %s in %s", cfg.OllamaModel, endpoint, time.Since(start).Round(time.Second))
+	}
+	return nil
+}
+
+// describePullProgress describes a pull update for the log, with the
+// download progress if there is any.
+func describePullProgress(p ollama.PullProgress) string {
+	if p.Total <= 0 {
+		return p.Status
+	}
+	return fmt.Sprintf("%s %d%% (%s of %s)", p.Status, p.Completed*100/p.Total, formatSize(p.Completed), formatSize(p.Total))
+}
+
+// formatSize formats a byte count in the largest unit that keeps it at
+// least 1, as ollama does.
+func formatSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,123 @@
+package startup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/logging"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// newOllamaServer starts a fake ollama with the given models that answers
+// pulls with body.
+func newOllamaServer(t *testing.T, models []string, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ollama.EndpointTags:
+			var list []string
+			for _, m := range models {
+				list = append(list, fmt.Sprintf(`{"name":%q}`, m))
+			}
+			fmt.Fprintf(w, `{"models":[%s]}`, strings.Join(list, ","))
+		case ollama.EndpointPull:
+			w.Write([]byte(body))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMissingOllamaModel(t *testing.T) {
+	have := newOllamaServer(t, []string{"llama3.2:1b"}, "")
+	lacking := newOllamaServer(t, []string{"qwen2.5:7b"}, "")
+
+	tests := []struct {
+		name      string
+		endpoints []string
+		want      []string
+	}{
+		{"model present", []string{have.URL}, nil},
+		{"model missing", []string{lacking.URL}, []string{lacking.URL}},
+		{"missing on one endpoint", []string{have.URL, lacking.URL}, []string{lacking.URL}},
+		{"unreachable endpoint skipped", []string{"http://127.0.0.1:1", have.URL}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{OllamaModel: "llama3.2:1b", OllamaURLs: tt.endpoints}
+			got := MissingOllamaModel(cfg)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("MissingOllamaModel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPullOllamaModel(t *testing.T) {
+	pulled := newOllamaServer(t, nil, `{"status":"pulling manifest"}
+{"status":"pulling 6a0746a1ec1a","total":4000000000,"completed":1000000000}
+{"status":"pulling 6a0746a1ec1a","total":4000000000,"completed":2000000000}
+{"status":"success"}
+`)
+	failed := newOllamaServer(t, nil, `{"error":"pull model manifest: file does not exist"}`+"\n")
+
+	tests := []struct {
+		name         string
+		endpoints    []string
+		wantErr      error
+		wantProgress int
+		wantLog      string
+	}{
+		{name: "pulled", endpoints: []string{pulled.URL}, wantProgress: 4, wantLog: "pulling 6a0746a1ec1a 25% (1.0 GB of 4.0 GB)"},
+		{name: "pull error", endpoints: []string{failed.URL}, wantErr: ollama.ErrPullFailed},
+		{name: "stops at first failure", endpoints: []string{failed.URL, pulled.URL}, wantErr: ollama.ErrPullFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			cfg := &config.Config{OllamaModel: "llama3.2:1b"}
+			updates := 0
+			err := PullOllamaModel(context.Background(), cfg, tt.endpoints, logging.New(logging.LevelInfo, &logs), func(ollama.PullProgress) {
+				updates++
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PullOllamaModel() error = %v, want %v", err, tt.wantErr)
+			}
+			if updates != tt.wantProgress {
+				t.Errorf("progress updates = %d, want %d", updates, tt.wantProgress)
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("log = %q, want it to contain %q", logs.String(), tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{999, "999 B"},
+		{1500, "1.5 kB"},
+		{4700000000, "4.7 GB"},
+	}
+
+	for _, tt := range tests {
+		if got := formatSize(tt.n); got != tt.want {
+			t.Errorf("formatSize(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
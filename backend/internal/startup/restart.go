@@ -0,0 +1,196 @@
+package startup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/logging"
+	"github.com/hurricanerix/weave/internal/web"
+)
+
+// computeAcceptTimeout is how long a restart waits for the new compute
+// process to connect
+const computeAcceptTimeout = 10 * time.Second
+
+// Restarter performs soft restarts for POST /admin/restart. It re-reads
+// configuration, reconnects to the LLM backend, replaces the compute process and
+// reconfigures the web server. Sessions and the HTTP listener are kept.
+type Restarter struct {
+	mu         sync.Mutex
+	args       []string
+	cfg        *config.Config
+	components *Components
+	logger     *logging.Logger
+}
+
+// NewRestarter creates a Restarter for a server started with the given CLI
+// arguments and configuration.
+func NewRestarter(args []string, cfg *config.Config, components *Components, logger *logging.Logger) *Restarter {
+	return &Restarter{
+		args:       append([]string{}, args...),
+		cfg:        cfg,
+		components: components,
+		logger:     logger,
+	}
+}
+
+// Restart applies overrides after the current arguments and switches to the
+// resulting configuration. Overrides are kept for later restarts. On error
+// the running configuration, LLM client and compute process are kept.
+//
+// The port, log level, session encryption and pprof settings can't change
+// without a full restart; changes to them are logged and ignored.
+// Generations running on the old compute process fail when it is stopped.
+func (r *Restarter) Restart(ctx context.Context, overrides []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	args := append(append([]string{}, r.args...), overrides...)
+	cfg, err := config.Parse(args, io.Discard)
+	if err != nil {
+		return fmt.Errorf("%w: %v", web.ErrInvalidRestartConfig, err)
+	}
+	if cfg.GalleryOnly != r.cfg.GalleryOnly {
+		return fmt.Errorf("%w: gallery-only requires a full restart", web.ErrInvalidRestartConfig)
+	}
+	if (cfg.MCP == config.MCPStdio) != (r.cfg.MCP == config.MCPStdio) {
+		return fmt.Errorf("%w: mcp stdio requires a full restart", web.ErrInvalidRestartConfig)
+	}
+	if cfg.Addr() != r.cfg.Addr() {
+		r.logger.Warn("Listen address change to %s requires a full restart", cfg.Addr())
+	}
+	if cfg.LogLevel != r.cfg.LogLevel {
+		r.logger.Warn("Log level change to %s requires a full restart", cfg.LogLevel)
+	}
+	if cfg.EncryptSessions != r.cfg.EncryptSessions {
+		r.logger.Warn("Session encryption change requires a full restart")
+	}
+	if cfg.Storage != r.cfg.Storage {
+		r.logger.Warn("Storage change to %s requires a full restart", cfg.Storage)
+	}
+	if cfg.DebugPprof != r.cfg.DebugPprof || cfg.DebugPprofPort != r.cfg.DebugPprofPort {
+		r.logger.Warn("pprof changes require a full restart")
+	}
+
+	if err := ValidateLLM(cfg); err != nil {
+		return err
+	}
+	llmClient := CreateLLMClient(cfg)
+
+	compute, err := r.startCompute(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := r.components.WebServer.Reconfigure(llmClient, compute.ComputeClient, cfg); err != nil {
+		compute.ComputeClient.Close()
+		CleanupCompute(compute, r.logger)
+		return fmt.Errorf("%w: %v", web.ErrInvalidRestartConfig, err)
+	}
+	r.components.WebServer.SetComputeCapabilities(compute.ComputeCapabilities)
+	if r.components.SessionManager != nil {
+		ConfigureSessionExpiry(cfg, r.components.SessionManager, r.components.ImageStore, r.logger)
+	}
+
+	// The new listener took over the socket path, so only the old process,
+	// connection and listener are cleaned up
+	old := &Components{
+		ComputeProcess:  r.components.ComputeProcess,
+		ComputeStdin:    r.components.ComputeStdin,
+		ComputeWorkers:  r.components.ComputeWorkers,
+		ComputeListener: r.components.ComputeListener,
+	}
+	oldClient := r.components.ComputeClient
+
+	r.components.LLMClient = llmClient
+	r.components.ComputeClient = compute.ComputeClient
+	r.components.ComputeListener = compute.ComputeListener
+	r.components.ComputeSocketPath = compute.ComputeSocketPath
+	r.components.ComputeProcess = compute.ComputeProcess
+	r.components.ComputeStdin = compute.ComputeStdin
+	r.components.ComputeWorkers = compute.ComputeWorkers
+	r.components.ComputeRemote = compute.ComputeRemote
+	r.components.ComputeCapabilities = compute.ComputeCapabilities
+	r.args = args
+	r.cfg = cfg
+
+	if oldClient != nil {
+		if err := oldClient.Close(); err != nil {
+			r.logger.Debug("Failed to close old compute connection: %v", err)
+		}
+	}
+	CleanupCompute(old, r.logger)
+
+	r.logger.Info("Restarted with new configuration")
+	return nil
+}
+
+// startCompute creates a socket, spawns the compute processes for cfg,
+// waits for them to connect and asks what they can do. With
+// cfg.ComputeAddr it connects to remote compute instead. The returned
+// Components only has compute fields set.
+func (r *Restarter) startCompute(ctx context.Context, cfg *config.Config) (*Components, error) {
+	if cfg.ComputeAddr != "" {
+		return r.connectRemoteCompute(ctx, cfg)
+	}
+
+	listener, socketPath, err := CreateSocket()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket: %w", err)
+	}
+
+	workers, err := SpawnComputeWorkers(socketPath, cfg, r.logger)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	compute := &Components{
+		ComputeListener:   listener,
+		ComputeSocketPath: socketPath,
+	}
+	compute.SetComputeWorkers(workers)
+
+	acceptCtx, cancel := context.WithTimeout(ctx, computeAcceptTimeout)
+	defer cancel()
+
+	conn, err := AcceptComputeWorkers(acceptCtx, listener, len(workers))
+	if err != nil {
+		CleanupCompute(compute, r.logger)
+		return nil, fmt.Errorf("failed to accept compute connection: %w", err)
+	}
+	compute.ComputeClient = conn
+	conn.SetMaxResponseSize(cfg.ComputeMaxResponseMB << 20)
+	if err := NegotiateComputeVersion(ctx, conn, r.logger); err != nil {
+		conn.Close()
+		CleanupCompute(compute, r.logger)
+		return nil, err
+	}
+	compute.ComputeCapabilities = QueryComputeCapabilities(ctx, conn, r.logger)
+	return compute, nil
+}
+
+// connectRemoteCompute connects to compute at cfg.ComputeAddr and asks
+// what it can do, for startCompute.
+func (r *Restarter) connectRemoteCompute(ctx context.Context, cfg *config.Config) (*Components, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, computeAcceptTimeout)
+	defer cancel()
+
+	conn, err := DialRemoteCompute(dialCtx, cfg, r.logger)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxResponseSize(cfg.ComputeMaxResponseMB << 20)
+	if err := NegotiateComputeVersion(ctx, conn, r.logger); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Components{
+		ComputeClient:       conn,
+		ComputeRemote:       cfg.ComputeAddr,
+		ComputeCapabilities: QueryComputeCapabilities(ctx, conn, r.logger),
+	}, nil
+}
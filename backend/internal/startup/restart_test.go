@@ -0,0 +1,43 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/logging"
+	"github.com/hurricanerix/weave/internal/web"
+)
+
+func TestRestarter_InvalidConfig(t *testing.T) {
+	cfg, err := config.Parse(nil, io.Discard)
+	if err != nil {
+		t.Fatalf("config.Parse() error = %v", err)
+	}
+	logger := logging.New(logging.LevelError, io.Discard)
+
+	tests := []struct {
+		name      string
+		overrides []string
+	}{
+		{name: "out of range value", overrides: []string{"--steps=0"}},
+		{name: "unknown flag", overrides: []string{"--no-such-flag=1"}},
+		{name: "gallery-only change", overrides: []string{"--gallery-only=true"}},
+		{name: "mcp stdio change", overrides: []string{"--mcp=stdio"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRestarter(nil, cfg, &Components{}, logger)
+			err := r.Restart(context.Background(), tt.overrides)
+			if !errors.Is(err, web.ErrInvalidRestartConfig) {
+				t.Fatalf("Restart() error = %v, want ErrInvalidRestartConfig", err)
+			}
+			if len(r.args) != 0 {
+				t.Errorf("args = %v, want failed overrides discarded", r.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/llm"
+	"github.com/hurricanerix/weave/internal/logging"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+const (
+	// selfTestChatTimeout bounds the self-test LLM exchange, which may
+	// include loading the model
+	selfTestChatTimeout = 60 * time.Second
+	// selfTestGenerateTimeout bounds the self-test generation
+	selfTestGenerateTimeout = 120 * time.Second
+
+	// selfTestSize is the width and height of the self-test image
+	selfTestSize = 64
+	// selfTestSteps keeps the self-test generation short
+	selfTestSteps = 1
+	// selfTestSeed is used when --llm-seed and --seed are random, so the
+	// self-test is reproducible
+	selfTestSeed = 42
+	// selfTestRequestID marks the self-test generation; the web server's
+	// request IDs count up from 1 and never reach it
+	selfTestRequestID = 1 << 62
+
+	selfTestMessage = "This is a connection test. Reply with the single word OK."
+	selfTestPrompt  = "a red circle on a white background"
+)
+
+var (
+	// ErrSelfTestChat is returned when the self-test LLM exchange fails
+	ErrSelfTestChat = errors.New("self-test chat failed")
+	// ErrSelfTestGenerate is returned when the self-test generation fails
+	ErrSelfTestGenerate = errors.New("self-test generation failed")
+)
+
+// SelfTest exercises the whole stack once before the server accepts
+// requests: a one-message exchange with ollama using the configured LLM
+// seed, and a 64x64 single-step generation on the compute process whose
+// pixels are encoded as PNG. It returns an error wrapping ErrSelfTestChat
+// or ErrSelfTestGenerate on the first step that fails.
+func SelfTest(ctx context.Context, chat llm.Client, compute *client.Conn, cfg *config.Config, logger *logging.Logger) error {
+	start := time.Now()
+	if err := selfTestChat(ctx, chat, cfg); err != nil {
+		return err
+	}
+	logger.Info("Self-test: LLM replied in %v", time.Since(start).Round(time.Millisecond))
+
+	start = time.Now()
+	if err := selfTestGenerate(ctx, compute, cfg); err != nil {
+		return err
+	}
+	logger.Info("Self-test: generated a %dx%d image in %v", selfTestSize, selfTestSize, time.Since(start).Round(time.Millisecond))
+
+	return nil
+}
+
+// selfTestChat sends one message to ollama and checks for a non-empty reply.
+func selfTestChat(ctx context.Context, chat llm.Client, cfg *config.Config) error {
+	ctx, cancel := context.WithTimeout(ctx, selfTestChatTimeout)
+	defer cancel()
+
+	seed := cfg.LLMSeed
+	if seed == 0 {
+		seed = selfTestSeed
+	}
+	// Chat as the web UI would with the configured sampling
+	ctx = ollama.WithSampling(ctx, cfg.LLMSampling)
+
+	result, err := chat.Chat(ctx, []ollama.Message{{Role: ollama.RoleUser, Content: selfTestMessage}}, &seed, nil, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfTestChat, err)
+	}
+	if strings.TrimSpace(result.RawResponse) == "" {
+		return fmt.Errorf("%w: empty response", ErrSelfTestChat)
+	}
+	return nil
+}
+
+// selfTestGenerate runs one small generation and checks the returned image.
+func selfTestGenerate(ctx context.Context, compute *client.Conn, cfg *config.Config) error {
+	if compute == nil {
+		return fmt.Errorf("%w: compute not connected", ErrSelfTestGenerate)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, selfTestGenerateTimeout)
+	defer cancel()
+
+	seed := uint64(selfTestSeed)
+	if cfg.Seed >= 0 {
+		seed = uint64(cfg.Seed)
+	}
+
+	req, err := protocol.NewSD35GenerateRequest(selfTestRequestID, selfTestPrompt, selfTestSize, selfTestSize, selfTestSteps, float32(cfg.CFG), seed)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfTestGenerate, err)
+	}
+	data, err := protocol.EncodeSD35GenerateRequest(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfTestGenerate, err)
+	}
+
+	respData, err := compute.Send(ctx, data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfTestGenerate, err)
+	}
+	resp, err := protocol.DecodeResponse(respData)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfTestGenerate, err)
+	}
+
+	switch resp := resp.(type) {
+	case *protocol.SD35GenerateResponse:
+		if resp.ImageWidth != selfTestSize || resp.ImageHeight != selfTestSize {
+			return fmt.Errorf("%w: got a %dx%d image, want %dx%d", ErrSelfTestGenerate, resp.ImageWidth, resp.ImageHeight, selfTestSize, selfTestSize)
+		}
+		format := image.FormatRGBA
+		if resp.Channels == 3 {
+			format = image.FormatRGB
+		}
+		if _, err := image.EncodePNG(int(resp.ImageWidth), int(resp.ImageHeight), resp.ImageData, format); err != nil {
+			return fmt.Errorf("%w: %v", ErrSelfTestGenerate, err)
+		}
+		return nil
+	case *protocol.ErrorResponse:
+		return fmt.Errorf("%w: compute error %d: %s", ErrSelfTestGenerate, resp.ErrorCode, resp.ErrorMessage)
+	default:
+		return fmt.Errorf("%w: unexpected response %T", ErrSelfTestGenerate, resp)
+	}
+}
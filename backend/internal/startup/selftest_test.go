@@ -0,0 +1,153 @@
+package startup
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// fakeChatter returns a fixed reply and records the seed it was given.
+type fakeChatter struct {
+	reply string
+	err   error
+	seed  int64
+}
+
+func (f *fakeChatter) Chat(ctx context.Context, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error) {
+	if seed != nil {
+		f.seed = *seed
+	}
+	return ollama.ChatResult{Response: f.reply, RawResponse: f.reply}, f.err
+}
+
+// fakeCompute accepts a connection from a fake compute process that answers
+// each generate request with a width x height RGB image.
+func fakeCompute(t *testing.T, width, height uint32) *client.Conn {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "compute.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			header := make([]byte, 16)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+			payload := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+			if _, err := io.ReadFull(conn, payload); err != nil {
+				return
+			}
+
+			pixels := make([]byte, width*height*3)
+			resp := make([]byte, 16+16+16, 16+16+16+len(pixels))
+			binary.BigEndian.PutUint32(resp[0:4], protocol.MagicNumber)
+			binary.BigEndian.PutUint16(resp[4:6], protocol.ProtocolVersion1)
+			binary.BigEndian.PutUint16(resp[6:8], protocol.MsgGenerateResponse)
+			binary.BigEndian.PutUint32(resp[8:12], uint32(32+len(pixels)))
+			copy(resp[16:24], payload[0:8])
+			binary.BigEndian.PutUint32(resp[24:28], protocol.StatusOK)
+			binary.BigEndian.PutUint32(resp[32:36], width)
+			binary.BigEndian.PutUint32(resp[36:40], height)
+			binary.BigEndian.PutUint32(resp[40:44], 3)
+			binary.BigEndian.PutUint32(resp[44:48], uint32(len(pixels)))
+			conn.Write(append(resp, pixels...))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := client.AcceptConnection(ctx, listener)
+	if err != nil {
+		t.Fatalf("AcceptConnection() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestSelfTest(t *testing.T) {
+	tests := []struct {
+		name     string
+		chat     *fakeChatter
+		compute  func(t *testing.T) *client.Conn
+		llmSeed  int64
+		wantErr  error
+		wantSeed int64
+	}{
+		{
+			name:     "passes",
+			chat:     &fakeChatter{reply: "OK"},
+			compute:  func(t *testing.T) *client.Conn { return fakeCompute(t, 64, 64) },
+			wantSeed: selfTestSeed,
+		},
+		{
+			name:     "uses llm-seed",
+			chat:     &fakeChatter{reply: "OK"},
+			compute:  func(t *testing.T) *client.Conn { return fakeCompute(t, 64, 64) },
+			llmSeed:  7,
+			wantSeed: 7,
+		},
+		{
+			name:    "chat error",
+			chat:    &fakeChatter{err: ollama.ErrModelNotFound},
+			compute: func(t *testing.T) *client.Conn { return fakeCompute(t, 64, 64) },
+			wantErr: ErrSelfTestChat,
+		},
+		{
+			name:    "empty reply",
+			chat:    &fakeChatter{reply: "  "},
+			compute: func(t *testing.T) *client.Conn { return fakeCompute(t, 64, 64) },
+			wantErr: ErrSelfTestChat,
+		},
+		{
+			name:    "compute not connected",
+			chat:    &fakeChatter{reply: "OK"},
+			compute: func(t *testing.T) *client.Conn { return nil },
+			wantErr: ErrSelfTestGenerate,
+		},
+		{
+			name:    "wrong image size",
+			chat:    &fakeChatter{reply: "OK"},
+			compute: func(t *testing.T) *client.Conn { return fakeCompute(t, 128, 64) },
+			wantErr: ErrSelfTestGenerate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{LogLevel: "error", CFG: 3.5, Seed: -1, LLMSeed: tt.llmSeed}
+			err := SelfTest(context.Background(), tt.chat, tt.compute(t), cfg, CreateLogger(cfg))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("SelfTest() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelfTest() error = %v", err)
+			}
+			if tt.chat.seed != tt.wantSeed {
+				t.Errorf("chat seed = %d, want %d", tt.chat.seed, tt.wantSeed)
+			}
+		})
+	}
+}
@@ -3,12 +3,17 @@ package startup
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/hurricanerix/weave/internal/logging"
+	"github.com/hurricanerix/weave/internal/protocol"
 	"github.com/hurricanerix/weave/internal/web"
 )
 
@@ -23,7 +28,7 @@ const (
 	computeSigkillTimeout = 500 * time.Millisecond
 )
 
-// CleanupCompute terminates the compute process and cleans up resources.
+// CleanupCompute terminates the compute processes and cleans up resources.
 // It performs the following steps:
 //  1. Close stdin pipe to signal compute to shutdown
 //  2. Wait up to 1 second for graceful exit
@@ -32,6 +37,10 @@ const (
 //  5. Close the listening socket
 //  6. Remove the socket file from filesystem
 //
+// Steps 1-4 run for every compute worker at once. Shared memory segments
+// the processes left next to the socket, holding images no one read, are
+// removed as well.
+//
 // Errors during cleanup are logged but do not cause the function to fail.
 // This ensures cleanup proceeds even if individual steps fail.
 //
@@ -48,10 +57,57 @@ func CleanupCompute(components *Components, logger *logging.Logger) {
 
 	logger.Debug("Starting compute cleanup")
 
+	var wg sync.WaitGroup
+	wg.Go(func() { stopCompute(components.ComputeProcess, components.ComputeStdin, logger) })
+	for _, w := range components.ComputeWorkers {
+		wg.Go(func() { stopCompute(w.Process, w.Stdin, logger) })
+	}
+	wg.Wait()
+
+	// Step 5: Close the listening socket
+	if components.ComputeListener != nil {
+		logger.Debug("Closing compute listener socket")
+		if err := components.ComputeListener.Close(); err != nil {
+			logger.Error("Failed to close compute listener: %v", err)
+		}
+	}
+
+	// Step 6: Remove socket file from filesystem
+	if components.ComputeSocketPath != "" {
+		removeSharedSegments(filepath.Dir(components.ComputeSocketPath), components.ComputeProcess, logger)
+		for _, w := range components.ComputeWorkers {
+			removeSharedSegments(filepath.Dir(components.ComputeSocketPath), w.Process, logger)
+		}
+
+		removeSocket(components.ComputeSocketPath, logger)
+	}
+
+	logger.Debug("Compute cleanup complete")
+}
+
+// removeSharedSegments removes the shared memory segments the stopped
+// compute process left in dir. Segments of other processes, such as those
+// a soft restart started, are kept.
+func removeSharedSegments(dir string, process *exec.Cmd, logger *logging.Logger) {
+	if process == nil || process.Process == nil {
+		return
+	}
+	pattern := filepath.Join(dir, fmt.Sprintf("%s%d-*", protocol.SharedMemoryPrefix, process.Process.Pid))
+	matches, _ := filepath.Glob(pattern)
+	for _, path := range matches {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Error("Failed to remove shared memory segment: %v", err)
+		}
+	}
+}
+
+// stopCompute terminates one compute process: it closes stdin, then sends
+// SIGTERM and SIGKILL in turn to a process that does not exit.
+func stopCompute(process *exec.Cmd, stdin io.WriteCloser, logger *logging.Logger) {
 	// Step 1: Close stdin to signal graceful shutdown
-	if components.ComputeStdin != nil {
+	if stdin != nil {
 		logger.Debug("Closing compute stdin to signal shutdown")
-		if err := components.ComputeStdin.Close(); err != nil {
+		if err := stdin.Close(); err != nil {
 			logger.Error("Failed to close compute stdin: %v", err)
 		}
 	}
@@ -62,7 +118,7 @@ func CleanupCompute(components *Components, logger *logging.Logger) {
 	go func() {
 		// Wait() may block forever if already called elsewhere, but the buffered
 		// channel ensures this goroutine won't leak - it will send and exit.
-		done <- components.ComputeProcess.Wait()
+		done <- process.Wait()
 	}()
 
 	var processExited bool
@@ -81,9 +137,9 @@ func CleanupCompute(components *Components, logger *logging.Logger) {
 	}
 
 	// Step 3: Send SIGTERM if still running
-	if !processExited && components.ComputeProcess.Process != nil {
+	if !processExited && process.Process != nil {
 		logger.Debug("Sending SIGTERM to compute process")
-		if err := components.ComputeProcess.Process.Signal(syscall.SIGTERM); err != nil {
+		if err := process.Process.Signal(syscall.SIGTERM); err != nil {
 			logger.Error("Failed to send SIGTERM: %v", err)
 		} else {
 			select {
@@ -101,9 +157,9 @@ func CleanupCompute(components *Components, logger *logging.Logger) {
 	}
 
 	// Step 4: Send SIGKILL if still running
-	if !processExited && components.ComputeProcess.Process != nil {
+	if !processExited && process.Process != nil {
 		logger.Debug("Sending SIGKILL to compute process")
-		if err := components.ComputeProcess.Process.Kill(); err != nil {
+		if err := process.Process.Kill(); err != nil {
 			logger.Error("Failed to send SIGKILL: %v", err)
 		} else {
 			// Use non-blocking select with timeout to avoid hanging if goroutine is stuck
@@ -121,26 +177,6 @@ func CleanupCompute(components *Components, logger *logging.Logger) {
 			}
 		}
 	}
-
-	// Step 5: Close the listening socket
-	if components.ComputeListener != nil {
-		logger.Debug("Closing compute listener socket")
-		if err := components.ComputeListener.Close(); err != nil {
-			logger.Error("Failed to close compute listener: %v", err)
-		}
-	}
-
-	// Step 6: Remove socket file from filesystem
-	if components.ComputeSocketPath != "" {
-		logger.Debug("Removing socket file: %s", components.ComputeSocketPath)
-		if err := os.Remove(components.ComputeSocketPath); err != nil {
-			if !os.IsNotExist(err) {
-				logger.Error("Failed to remove socket file: %v", err)
-			}
-		}
-	}
-
-	logger.Debug("Compute cleanup complete")
 }
 
 // Run starts the web server and blocks until a shutdown signal is received.
@@ -153,17 +189,92 @@ func CleanupCompute(components *Components, logger *logging.Logger) {
 //
 // Returns nil on clean shutdown, error otherwise.
 func Run(ctx context.Context, server *web.Server, logger *logging.Logger) error {
+	return Serve(ctx, &Components{WebServer: server}, logger)
+}
+
+// Serve starts the web server and blocks until a shutdown signal is received
+// or ctx is cancelled, then stops the application with Shutdown.
+// It handles SIGTERM and SIGINT signals for graceful shutdown.
+//
+// Returns nil on clean shutdown, error otherwise.
+func Serve(ctx context.Context, components *Components, logger *logging.Logger) error {
 	// Create context that will be cancelled on signal
-	shutdownCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	signalCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	// Start server and wait for it to finish
-	// ListenAndServe blocks until context is cancelled or error occurs
-	// The web.Server itself logs "Shutting down..." and "Web server stopped"
-	err := server.ListenAndServe(shutdownCtx)
-	if err != nil {
-		return fmt.Errorf("server error: %w", err)
+	// Serve blocks until the context is cancelled or the server fails
+	serveErr := components.WebServer.Serve(signalCtx)
+	if serveErr != nil {
+		logger.Error("Web server failed: %v", serveErr)
 	}
 
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	shutdownErr := Shutdown(shutdownCtx, components, logger)
+
+	if serveErr != nil {
+		return fmt.Errorf("server error: %w", serveErr)
+	}
+	if shutdownErr != nil {
+		return fmt.Errorf("server error: %w", shutdownErr)
+	}
 	return nil
 }
+
+// Shutdown stops the application in dependency order, so nothing is torn
+// down while something still depends on it:
+//  1. Stop intake: close listeners; requests on open connections get 503
+//  2. Drain in-flight requests, including chat turns and image generations
+//  3. Flush session persistence and close the session database
+//  4. Send a final server-shutting-down event and close the SSE broker
+//  5. Terminate the compute process
+//
+// Compute supervision stops before the first stage, so compute is not
+// restarted while it is being terminated. A stage that fails or runs out of
+// time is logged and the remaining stages still run; compute is always
+// terminated. Returns the first error.
+func Shutdown(ctx context.Context, components *Components, logger *logging.Logger) error {
+	if components == nil {
+		return nil
+	}
+
+	var firstErr error
+	fail := func(stage string, err error) {
+		logger.Error("Shutdown: %s failed: %v", stage, err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	components.ComputeSupervisor.Stop()
+
+	if server := components.WebServer; server != nil {
+		logger.Debug("Shutdown: stopping intake")
+		server.StopIntake(ctx)
+
+		logger.Debug("Shutdown: draining in-flight requests")
+		if err := server.Drain(ctx); err != nil {
+			fail("drain", err)
+		}
+
+		logger.Debug("Shutdown: flushing sessions")
+		if err := server.FlushSessions(); err != nil {
+			fail("session flush", err)
+		}
+		if components.Store != nil {
+			if err := components.Store.Close(); err != nil {
+				fail("closing session store", err)
+			}
+		}
+
+		logger.Debug("Shutdown: closing event streams")
+		if err := server.CloseEvents(ctx); err != nil {
+			fail("closing event streams", err)
+		}
+	}
+
+	logger.Debug("Shutdown: terminating compute")
+	CleanupCompute(components, logger)
+
+	return firstErr
+}
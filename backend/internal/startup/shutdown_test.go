@@ -2,6 +2,7 @@ package startup
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"os"
 	"os/exec"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/hurricanerix/weave/internal/logging"
+	"github.com/hurricanerix/weave/internal/protocol"
 	"github.com/hurricanerix/weave/internal/web"
 )
 
@@ -124,6 +126,15 @@ func TestCleanupCompute_GracefulShutdown(t *testing.T) {
 		ComputeSocketPath: socketPath,
 	}
 
+	// Images the process left in shared memory, and one of another process
+	leftover := filepath.Join(tmpDir, fmt.Sprintf("%s%d-0", protocol.SharedMemoryPrefix, cmd.Process.Pid))
+	other := filepath.Join(tmpDir, protocol.SharedMemoryPrefix+"0-0")
+	for _, path := range []string{leftover, other} {
+		if err := os.WriteFile(path, []byte{1}, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
 	// Cleanup should succeed
 	CleanupCompute(components, logger)
 
@@ -131,6 +142,12 @@ func TestCleanupCompute_GracefulShutdown(t *testing.T) {
 	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
 		t.Errorf("Socket file still exists after cleanup")
 	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Error("Shared memory segment of the process still exists after cleanup")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("Shared memory segment of another process removed: %v", err)
+	}
 }
 
 func TestCleanupCompute_ForcedKill(t *testing.T) {
@@ -397,3 +414,59 @@ func TestCleanupCompute_ClosedStdin(t *testing.T) {
 		t.Errorf("Socket file still exists after cleanup")
 	}
 }
+
+func TestShutdown_NilComponents(t *testing.T) {
+	logger := logging.New(logging.LevelInfo, nil)
+
+	if err := Shutdown(context.Background(), nil, logger); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+}
+
+func TestShutdown_StopsServerAndCompute(t *testing.T) {
+	logger := logging.New(logging.LevelInfo, nil)
+
+	server, err := web.NewServer("localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to create listener: %v", err)
+	}
+
+	cmd := exec.Command("cat")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		listener.Close()
+		t.Fatalf("Failed to create stdin pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		listener.Close()
+		stdin.Close()
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	components := &Components{
+		WebServer:         server,
+		ComputeProcess:    cmd,
+		ComputeStdin:      stdin,
+		ComputeListener:   listener,
+		ComputeSocketPath: socketPath,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Shutdown(ctx, components, logger); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+
+	if cmd.ProcessState == nil {
+		t.Error("Compute process still running after Shutdown")
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("Socket file still exists after Shutdown")
+	}
+}
@@ -0,0 +1,91 @@
+//go:build !windows
+
+package startup
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/logging"
+)
+
+// CreateSocket creates the Unix socket for weave-compute communication.
+// It constructs the socket path from XDG_RUNTIME_DIR, creates the socket
+// directory with mode 0700 if it doesn't exist, removes any existing socket
+// file, and creates a listening Unix socket.
+//
+// CALLER MUST CLOSE THE LISTENER when done to avoid resource leaks.
+//
+// Returns the listener, socket path, and error if XDG_RUNTIME_DIR is not set,
+// not absolute, or if socket creation fails.
+func CreateSocket() (net.Listener, string, error) {
+	// Get XDG_RUNTIME_DIR
+	xdgRuntimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if xdgRuntimeDir == "" {
+		return nil, "", client.ErrXDGNotSet
+	}
+
+	// Validate XDG_RUNTIME_DIR is an absolute path
+	if !filepath.IsAbs(xdgRuntimeDir) {
+		return nil, "", ErrXDGNotAbsolute
+	}
+
+	// Clean path to remove .. and .
+	xdgRuntimeDir = filepath.Clean(xdgRuntimeDir)
+
+	// Verify path is still absolute after cleaning
+	if !filepath.IsAbs(xdgRuntimeDir) {
+		return nil, "", ErrXDGResolvesToRelative
+	}
+
+	// SECURITY: Validate cleaned path doesn't contain path traversal attempts
+	// After cleaning, the path should not contain .. components
+	if filepath.Clean(xdgRuntimeDir) != xdgRuntimeDir {
+		return nil, "", fmt.Errorf("XDG_RUNTIME_DIR contains path traversal elements")
+	}
+
+	// Construct socket directory path
+	sockDir := filepath.Join(xdgRuntimeDir, socketDir)
+
+	// Create socket directory with mode 0700 if it doesn't exist
+	if err := os.MkdirAll(sockDir, 0700); err != nil {
+		return nil, "", fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	// Construct full socket path
+	socketPath := filepath.Join(sockDir, socketName)
+
+	// Remove any existing socket file (left over from previous crash)
+	// Ignore error if file doesn't exist
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("failed to remove existing socket file: %w", err)
+	}
+
+	// Create and bind the Unix socket
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create socket: %w", err)
+	}
+
+	return listener, socketPath, nil
+}
+
+// computeEnv returns the environment compute needs, besides weave's own,
+// to connect to socketPath. A Unix socket needs none: compute is
+// authenticated by its UID (SO_PEERCRED).
+func computeEnv(socketPath string) []string {
+	return nil
+}
+
+// removeSocket removes the socket file at socketPath.
+func removeSocket(socketPath string, logger *logging.Logger) {
+	logger.Debug("Removing socket file: %s", socketPath)
+	if err := os.Remove(socketPath); err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("Failed to remove socket file: %v", err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+//go:build windows
+
+package startup
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/logging"
+)
+
+// computeTokens maps the addresses CreateSocket returned to the token
+// compute must send on them.
+var computeTokens sync.Map
+
+// CreateSocket creates the listener for weave-compute communication.
+// Windows has no Unix domain sockets with SO_PEERCRED, so this listens on
+// a free TCP port of the loopback interface and only accepts connections
+// that first send a random token (see client.ListenTCP). SpawnCompute
+// hands the token to compute in client.TokenEnv.
+//
+// CALLER MUST CLOSE THE LISTENER when done to avoid resource leaks.
+//
+// Returns the listener, the tcp:// address compute connects to, and error
+// if listening fails.
+func CreateSocket() (net.Listener, string, error) {
+	listener, err := client.ListenTCP()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create socket: %w", err)
+	}
+	computeTokens.Store(listener.Address(), listener.Token())
+	return listener, listener.Address(), nil
+}
+
+// computeEnv returns the environment compute needs, besides weave's own,
+// to connect to socketPath: the token of its listener.
+func computeEnv(socketPath string) []string {
+	token, ok := computeTokens.Load(socketPath)
+	if !ok {
+		return nil
+	}
+	return []string{client.TokenEnv + "=" + token.(string)}
+}
+
+// removeSocket forgets the token of socketPath; there is no file to remove.
+func removeSocket(socketPath string, logger *logging.Logger) {
+	logger.Debug("Forgetting compute token for %s", socketPath)
+	computeTokens.Delete(socketPath)
+}
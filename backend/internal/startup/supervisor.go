@@ -0,0 +1,234 @@
+package startup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/logging"
+	"github.com/hurricanerix/weave/internal/web"
+)
+
+const (
+	// supervisorMinBackoff is how long the supervisor waits before the
+	// first restart of a compute process that stopped
+	supervisorMinBackoff = 1 * time.Second
+	// supervisorMaxBackoff caps the wait, which doubles with every stop
+	// within crashLoopWindow
+	supervisorMaxBackoff = 30 * time.Second
+	// crashLoopWindow is how far back stops count towards crashLoopLimit
+	crashLoopWindow = 5 * time.Minute
+	// crashLoopLimit is how many times compute may stop, or fail to
+	// restart, within crashLoopWindow before the supervisor gives up
+	crashLoopLimit = 5
+)
+
+// Supervisor restarts the compute processes when the connection to them is
+// lost, which happens when one crashes or stops answering heartbeat pings
+// (see AcceptComputeWorkers). It stops the remaining processes,
+// spawns new ones with the running configuration, waits for them to
+// connect, asks what they can do and switches the web server over, as a
+// soft restart does. SSE clients are told through EventComputeStatus.
+//
+// Restarts wait a backoff that doubles with every recent stop. If compute
+// stops, or fails to restart, more than crashLoopLimit times within
+// crashLoopWindow it is left stopped and generations fail until weave is
+// restarted.
+type Supervisor struct {
+	logger *logging.Logger
+
+	// Replaced in tests
+	current     func() *client.Conn
+	reap        func(lost *client.Conn) bool
+	respawn     func(ctx context.Context) error
+	report      func(state string, attempt int)
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	crashWindow time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSupervisor creates a Supervisor for the compute processes managed by
+// r, so it does not race soft restarts.
+func NewSupervisor(r *Restarter) *Supervisor {
+	return &Supervisor{
+		logger: r.logger,
+		current: func() *client.Conn {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			return r.components.ComputeClient
+		},
+		reap:    r.reapCompute,
+		respawn: r.respawnCompute,
+		report: func(state string, attempt int) {
+			if r.components.WebServer != nil {
+				r.components.WebServer.ReportComputeStatus(state, attempt)
+			}
+		},
+		minBackoff:  supervisorMinBackoff,
+		maxBackoff:  supervisorMaxBackoff,
+		crashWindow: crashLoopWindow,
+	}
+}
+
+// Start supervises compute in the background until ctx is cancelled or
+// Stop is called.
+func (s *Supervisor) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		s.run(ctx)
+	}()
+}
+
+// Stop stops supervising and waits for a restart in progress to finish or
+// give up, so compute can be terminated without being restarted. It is a
+// no-op for a nil or unstarted Supervisor.
+func (s *Supervisor) Stop() {
+	if s == nil || s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+// run waits for the compute connection to be lost and restarts compute,
+// until ctx is done or compute keeps stopping.
+func (s *Supervisor) run(ctx context.Context) {
+	var stops []time.Time
+	for {
+		conn := s.current()
+		if conn == nil || conn.Done() == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-conn.Done():
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		// A soft restart closes the connection it replaces
+		if !s.reap(conn) {
+			continue
+		}
+		s.logger.Warn("Compute process stopped unexpectedly")
+
+		for {
+			stops = recentStops(append(stops, time.Now()), s.crashWindow)
+			attempt := len(stops)
+			if attempt > crashLoopLimit {
+				s.logger.Error("Compute stopped %d times within %v, not restarting it", attempt, s.crashWindow)
+				s.report(web.ComputeStatusFailed, attempt)
+				return
+			}
+
+			s.report(web.ComputeStatusRestarting, attempt)
+			delay := s.backoff(attempt)
+			s.logger.Info("Restarting compute in %v (attempt %d)", delay, attempt)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			err := s.respawn(ctx)
+			if err == nil {
+				s.logger.Info("Compute restarted")
+				s.report(web.ComputeStatusRunning, attempt)
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			s.logger.Error("Failed to restart compute: %v", err)
+		}
+	}
+}
+
+// backoff returns the wait before restart attempt: minBackoff doubled for
+// every earlier one, up to maxBackoff.
+func (s *Supervisor) backoff(attempt int) time.Duration {
+	delay := s.minBackoff
+	for i := 1; i < attempt && delay < s.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, s.maxBackoff)
+}
+
+// recentStops returns the times in stops, oldest first, that are within
+// window of the last one.
+func recentStops(stops []time.Time, window time.Duration) []time.Time {
+	last := stops[len(stops)-1]
+	for i, t := range stops {
+		if last.Sub(t) <= window {
+			return stops[i:]
+		}
+	}
+	return stops
+}
+
+// reapCompute closes lost, the lost connection to compute, and terminates
+// its processes. Returns false if lost is no longer the compute connection
+// because a soft restart replaced it.
+func (r *Restarter) reapCompute(lost *client.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.components.ComputeClient != lost {
+		return false
+	}
+	if err := lost.Close(); err != nil {
+		r.logger.Debug("Failed to close lost compute connection: %v", err)
+	}
+	CleanupCompute(r.components, r.logger)
+
+	// The web server keeps the closed connection, so generations fail
+	// until compute is back
+	r.components.ComputeListener = nil
+	r.components.ComputeSocketPath = ""
+	r.components.ComputeProcess = nil
+	r.components.ComputeStdin = nil
+	r.components.ComputeWorkers = nil
+	r.components.ComputeRemote = ""
+	return true
+}
+
+// respawnCompute starts compute processes, or reconnects to remote
+// compute, with the running configuration after reapCompute and switches
+// the web server to them. It is a no-op if a soft restart started them
+// meanwhile.
+func (r *Restarter) respawnCompute(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.components.ComputeProcess != nil || r.components.ComputeRemote != "" {
+		return nil
+	}
+
+	compute, err := r.startCompute(ctx, r.cfg)
+	if err != nil {
+		return err
+	}
+	if err := r.components.WebServer.Reconfigure(r.components.LLMClient, compute.ComputeClient, r.cfg); err != nil {
+		compute.ComputeClient.Close()
+		CleanupCompute(compute, r.logger)
+		return fmt.Errorf("failed to reconfigure web server: %w", err)
+	}
+	r.components.WebServer.SetComputeCapabilities(compute.ComputeCapabilities)
+
+	r.components.ComputeClient = compute.ComputeClient
+	r.components.ComputeListener = compute.ComputeListener
+	r.components.ComputeSocketPath = compute.ComputeSocketPath
+	r.components.ComputeProcess = compute.ComputeProcess
+	r.components.ComputeStdin = compute.ComputeStdin
+	r.components.ComputeWorkers = compute.ComputeWorkers
+	r.components.ComputeRemote = compute.ComputeRemote
+	r.components.ComputeCapabilities = compute.ComputeCapabilities
+	return nil
+}
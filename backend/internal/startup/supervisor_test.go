@@ -0,0 +1,227 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/logging"
+	"github.com/hurricanerix/weave/internal/web"
+)
+
+// fakeSupervised is compute managed by a Supervisor under test: respawns
+// connect a new fake compute unless failRespawns is set.
+type fakeSupervised struct {
+	t *testing.T
+
+	mu           sync.Mutex
+	conn         *client.Conn
+	reaped       int
+	respawns     int
+	failRespawns bool
+	states       []string
+	reported     chan string
+}
+
+func newFakeSupervised(t *testing.T) *fakeSupervised {
+	return &fakeSupervised{t: t, conn: fakeCompute(t, 1, 1), reported: make(chan string, 32)}
+}
+
+func (f *fakeSupervised) supervisor() *Supervisor {
+	return &Supervisor{
+		logger: logging.New(logging.LevelError, io.Discard),
+		current: func() *client.Conn {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			return f.conn
+		},
+		reap: func(lost *client.Conn) bool {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if lost != f.conn {
+				return false
+			}
+			f.reaped++
+			return true
+		},
+		respawn: func(ctx context.Context) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.respawns++
+			if f.failRespawns {
+				return errors.New("spawn failed")
+			}
+			f.conn = fakeCompute(f.t, 1, 1)
+			return nil
+		},
+		report: func(state string, attempt int) {
+			f.mu.Lock()
+			f.states = append(f.states, state)
+			f.mu.Unlock()
+			f.reported <- state
+		},
+		minBackoff:  time.Millisecond,
+		maxBackoff:  4 * time.Millisecond,
+		crashWindow: time.Minute,
+	}
+}
+
+// crash closes the current connection, as when the compute process dies.
+func (f *fakeSupervised) crash() {
+	f.mu.Lock()
+	conn := f.conn
+	f.mu.Unlock()
+	conn.Close()
+}
+
+// waitFor waits for the supervisor to report state.
+func (f *fakeSupervised) waitFor(state string) {
+	f.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-f.reported:
+			if got == state {
+				return
+			}
+		case <-timeout:
+			f.t.Fatalf("no %q status reported", state)
+		}
+	}
+}
+
+func TestSupervisor_RestartsLostCompute(t *testing.T) {
+	f := newFakeSupervised(t)
+	s := f.supervisor()
+	s.Start(context.Background())
+	defer s.Stop()
+
+	first := f.conn
+	f.crash()
+	f.waitFor(web.ComputeStatusRunning)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.reaped != 1 || f.respawns != 1 {
+		t.Errorf("reaped %d, respawned %d times, want once each", f.reaped, f.respawns)
+	}
+	if f.conn == first {
+		t.Error("connection not replaced")
+	}
+	if want := []string{web.ComputeStatusRestarting, web.ComputeStatusRunning}; len(f.states) != 2 || f.states[0] != want[0] || f.states[1] != want[1] {
+		t.Errorf("states = %v, want %v", f.states, want)
+	}
+}
+
+func TestSupervisor_GivesUpOnCrashLoop(t *testing.T) {
+	f := newFakeSupervised(t)
+	f.failRespawns = true
+	s := f.supervisor()
+	s.Start(context.Background())
+	defer s.Stop()
+
+	f.crash()
+	f.waitFor(web.ComputeStatusFailed)
+	// The supervisor stops after giving up
+	<-s.done
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.respawns != crashLoopLimit {
+		t.Errorf("respawns = %d, want %d", f.respawns, crashLoopLimit)
+	}
+}
+
+func TestSupervisor_IgnoresReplacedConnection(t *testing.T) {
+	f := newFakeSupervised(t)
+	s := f.supervisor()
+	s.Start(context.Background())
+
+	// A soft restart switches to a new connection before closing the old one
+	f.mu.Lock()
+	old := f.conn
+	f.conn = fakeCompute(t, 1, 1)
+	f.mu.Unlock()
+	old.Close()
+
+	f.crash()
+	f.waitFor(web.ComputeStatusRunning)
+	s.Stop()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.reaped != 1 || f.respawns != 1 {
+		t.Errorf("reaped %d, respawned %d times, want once each for the new connection", f.reaped, f.respawns)
+	}
+}
+
+func TestSupervisor_StopDoesNotRestart(t *testing.T) {
+	f := newFakeSupervised(t)
+	s := f.supervisor()
+	s.Start(context.Background())
+	s.Stop()
+
+	f.crash()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.reaped != 0 || f.respawns != 0 {
+		t.Errorf("reaped %d, respawned %d times after Stop, want none", f.reaped, f.respawns)
+	}
+
+	// Stop of an unstarted or nil Supervisor is a no-op
+	(&Supervisor{}).Stop()
+	var nilSupervisor *Supervisor
+	nilSupervisor.Stop()
+}
+
+func TestSupervisor_Backoff(t *testing.T) {
+	s := &Supervisor{minBackoff: time.Second, maxBackoff: 30 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 5, want: 16 * time.Second},
+		{attempt: 6, want: 30 * time.Second},
+		{attempt: 100, want: 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := s.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestRecentStops(t *testing.T) {
+	now := time.Now()
+	stops := []time.Time{now.Add(-10 * time.Minute), now.Add(-4 * time.Minute), now}
+	if got := recentStops(stops, 5*time.Minute); len(got) != 2 {
+		t.Errorf("recentStops() kept %d, want the 2 within the window", len(got))
+	}
+}
+
+func TestRestarter_ReapCompute(t *testing.T) {
+	conn := fakeCompute(t, 1, 1)
+	components := &Components{ComputeClient: conn, ComputeSocketPath: "/nonexistent/compute.sock"}
+	r := NewRestarter(nil, nil, components, logging.New(logging.LevelError, io.Discard))
+
+	if r.reapCompute(fakeCompute(t, 1, 1)) {
+		t.Error("reapCompute() = true for a connection that was replaced")
+	}
+	if !r.reapCompute(conn) {
+		t.Fatal("reapCompute() = false for the compute connection")
+	}
+	select {
+	case <-conn.Done():
+	default:
+		t.Error("lost connection not closed")
+	}
+	if components.ComputeSocketPath != "" {
+		t.Errorf("ComputeSocketPath = %q, want cleared", components.ComputeSocketPath)
+	}
+}
@@ -13,15 +13,20 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/llm"
 )
 
 var (
 	// ErrOllamaNotRunning is returned when ollama is not reachable
 	ErrOllamaNotRunning = errors.New("ollama not running")
+	// ErrLLMNotRunning is returned when the OpenAI-compatible server is not reachable
+	ErrLLMNotRunning = errors.New("OpenAI-compatible LLM server not running")
 	// ErrComputeNotRunning is returned when weave-compute socket doesn't exist
 	ErrComputeNotRunning = errors.New("weave-compute not running (socket not found)")
 	// ErrComputeNotAccepting is returned when weave-compute refuses connections
@@ -29,12 +34,47 @@ var (
 )
 
 const (
-	// ollamaTimeout is the timeout for ollama validation request
+	// ollamaTimeout is the timeout for ollama and OpenAI-compatible
+	// validation requests
 	ollamaTimeout = 5 * time.Second
 	// computeTimeout is the timeout for compute process connection test
 	computeTimeout = 5 * time.Second
 )
 
+// ValidateLLM checks that the configured chat backend is reachable: ollama
+// with ValidateOllama, or an OpenAI-compatible server by listing its models.
+// With several ollama URLs, one reachable endpoint is enough; the pool
+// fails over from the others until they come up.
+// Returns ErrOllamaNotRunning or ErrLLMNotRunning if it is not.
+func ValidateLLM(cfg *config.Config) error {
+	if cfg.LLMBackend != config.LLMBackendOpenAI {
+		var err error
+		for _, endpoint := range cfg.OllamaEndpoints() {
+			if err = ValidateOllama(endpoint); err == nil {
+				return nil
+			}
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ollamaTimeout)
+	defer cancel()
+
+	client := llm.NewOpenAIClient(cfg.OpenAIURL, cfg.OpenAIModel, os.Getenv(OpenAIAPIKeyEnv), ollamaTimeout)
+	if err := client.Connect(ctx); err != nil {
+		return fmt.Errorf("%w at %s: %v", ErrLLMNotRunning, cfg.OpenAIURL, err)
+	}
+	return nil
+}
+
+// llmBackend describes the configured chat backend for log messages.
+func llmBackend(cfg *config.Config) string {
+	if cfg.LLMBackend == config.LLMBackendOpenAI {
+		return fmt.Sprintf("OpenAI-compatible server at %s (model: %s)", cfg.OpenAIURL, cfg.OpenAIModel)
+	}
+	return fmt.Sprintf("ollama at %s (model: %s)", strings.Join(cfg.OllamaEndpoints(), ", "), cfg.OllamaModel)
+}
+
 // ValidateOllama checks if ollama is running and reachable at the given URL.
 // It sends an HTTP GET request to the /api/tags endpoint.
 // Returns nil if ollama is reachable, ErrOllamaNotRunning otherwise.
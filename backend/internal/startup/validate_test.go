@@ -7,8 +7,60 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
 )
 
+func TestValidateLLM(t *testing.T) {
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			w.Write([]byte(`{"models":[]}`))
+		case "/v1/models":
+			gotAuth = r.Header.Get("Authorization")
+			w.Write([]byte(`{"object":"list","data":[]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv(OpenAIAPIKeyEnv, "sk-test")
+
+	tests := []struct {
+		name    string
+		cfg     *config.Config
+		wantErr error
+	}{
+		{name: "ollama", cfg: &config.Config{OllamaURL: server.URL}},
+		{name: "ollama not running", cfg: &config.Config{OllamaURL: "http://localhost:99999"}, wantErr: ErrOllamaNotRunning},
+		{name: "ollama pool with one up", cfg: &config.Config{OllamaURLs: []string{"http://localhost:99999", server.URL}}},
+		{name: "ollama pool all down", cfg: &config.Config{OllamaURLs: []string{"http://localhost:99999", "http://127.0.0.1:1"}}, wantErr: ErrOllamaNotRunning},
+		{name: "openai", cfg: &config.Config{LLMBackend: config.LLMBackendOpenAI, OpenAIURL: server.URL + "/v1", OpenAIModel: "m"}},
+		{
+			name:    "openai not running",
+			cfg:     &config.Config{LLMBackend: config.LLMBackendOpenAI, OpenAIURL: "http://127.0.0.1:1/v1", OpenAIModel: "m"},
+			wantErr: ErrLLMNotRunning,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateLLM(tt.cfg)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("ValidateLLM() error = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateLLM() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if gotAuth != "Bearer sk-test" {
+		t.Errorf("Authorization = %q, want the key from %s", gotAuth, OpenAIAPIKeyEnv)
+	}
+}
+
 func TestValidateOllama_Success(t *testing.T) {
 	// Create test server that simulates ollama
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ImageRecord describes an image saved by persistence.ImageStore.
+// Alternate is 0 for a message's primary image.
+type ImageRecord struct {
+	SessionID string
+	MessageID int
+	Alternate int
+	Size      int64
+	CreatedAt time.Time
+}
+
+// RecordImage records that an image was saved, replacing the record of the
+// image it overwrote. It implements persistence.ImageIndex.
+func (s *Store) RecordImage(sessionID string, messageID, alternate int, size int64) error {
+	return recordImage(s.db, ImageRecord{
+		SessionID: sessionID,
+		MessageID: messageID,
+		Alternate: alternate,
+		Size:      size,
+		CreatedAt: time.Now(),
+	})
+}
+
+// recordImage inserts or replaces the record of an image with db, the
+// store's database or a transaction on it.
+func recordImage(db interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, r ImageRecord) error {
+	_, err := db.Exec(`
+		INSERT INTO images (session_id, message_id, alternate, size, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (session_id, message_id, alternate) DO UPDATE SET
+			size = excluded.size, created_at = excluded.created_at`,
+		r.SessionID, r.MessageID, r.Alternate, r.Size, r.CreatedAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to record image: %w", err)
+	}
+	return nil
+}
+
+// RemoveImage removes the record of one image. It implements
+// persistence.ImageIndex.
+func (s *Store) RemoveImage(sessionID string, messageID, alternate int) error {
+	_, err := s.db.Exec("DELETE FROM images WHERE session_id = ? AND message_id = ? AND alternate = ?",
+		sessionID, messageID, alternate)
+	if err != nil {
+		return fmt.Errorf("failed to remove image: %w", err)
+	}
+	return nil
+}
+
+// RemoveImages removes the records of a message's primary image and all of
+// its alternates. It implements persistence.ImageIndex.
+func (s *Store) RemoveImages(sessionID string, messageID int) error {
+	_, err := s.db.Exec("DELETE FROM images WHERE session_id = ? AND message_id = ?", sessionID, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to remove images: %w", err)
+	}
+	return nil
+}
+
+// Images returns the records of a session's images, ordered by message and
+// alternate.
+func (s *Store) Images(sessionID string) ([]ImageRecord, error) {
+	return s.queryImages(`
+		SELECT session_id, message_id, alternate, size, created_at FROM images
+		WHERE session_id = ? ORDER BY message_id, alternate`, sessionID)
+}
+
+// RecentImages returns the records of up to limit images of all sessions,
+// most recently saved first.
+func (s *Store) RecentImages(limit int) ([]ImageRecord, error) {
+	return s.queryImages(`
+		SELECT session_id, message_id, alternate, size, created_at FROM images
+		ORDER BY created_at DESC LIMIT ?`, limit)
+}
+
+// queryImages runs a query selecting image records.
+func (s *Store) queryImages(query string, args ...any) ([]ImageRecord, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	defer rows.Close()
+
+	records := []ImageRecord{}
+	for rows.Next() {
+		var r ImageRecord
+		var createdAt int64
+		if err := rows.Scan(&r.SessionID, &r.MessageID, &r.Alternate, &r.Size, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to list images: %w", err)
+		}
+		r.CreatedAt = time.Unix(0, createdAt)
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	return records, nil
+}
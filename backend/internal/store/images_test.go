@@ -0,0 +1,74 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// imageKeys returns the message ID and alternate of each record.
+func imageKeys(records []ImageRecord) [][2]int {
+	keys := [][2]int{}
+	for _, r := range records {
+		keys = append(keys, [2]int{r.MessageID, r.Alternate})
+	}
+	return keys
+}
+
+func TestStore_ImageIndex(t *testing.T) {
+	s := openTestStore(t)
+	images := persistence.NewImageStore(t.TempDir())
+	images.SetIndex(s)
+	sessionID := testSessionID(1)
+	png := []byte("\x89PNG fake image data")
+
+	if err := images.Save(sessionID, 2, png); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := images.SaveAlternate(sessionID, 2, 1, png); err != nil {
+		t.Fatalf("SaveAlternate() error = %v", err)
+	}
+	if err := images.Save(sessionID, 4, png[:8]); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := images.Save(testSessionID(2), 1, png); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	records, err := s.Images(sessionID)
+	if err != nil {
+		t.Fatalf("Images() error = %v", err)
+	}
+	if got, want := imageKeys(records), [][2]int{{2, 0}, {2, 1}, {4, 0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Images() = %v, want %v", got, want)
+	}
+	if records[2].Size != 8 || records[0].Size != int64(len(png)) || records[0].CreatedAt.IsZero() {
+		t.Errorf("Images() records = %+v, want the sizes and times of the saved images", records)
+	}
+
+	recent, err := s.RecentImages(2)
+	if err != nil {
+		t.Fatalf("RecentImages() error = %v", err)
+	}
+	if len(recent) != 2 || recent[0].SessionID != testSessionID(2) || recent[1].MessageID != 4 {
+		t.Errorf("RecentImages(2) = %+v, want the two most recently saved images", recent)
+	}
+
+	// Deleting the primary image keeps its alternates
+	if err := images.Delete(sessionID, 2); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	records, _ = s.Images(sessionID)
+	if got, want := imageKeys(records), [][2]int{{2, 1}, {4, 0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Images() after Delete() = %v, want %v", got, want)
+	}
+
+	if err := images.DeleteAll(sessionID, 2); err != nil {
+		t.Fatalf("DeleteAll() error = %v", err)
+	}
+	records, _ = s.Images(sessionID)
+	if got, want := imageKeys(records), [][2]int{{4, 0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Images() after DeleteAll() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// importedKey is the meta key set once the file layout has been imported.
+const importedKey = "imported_files"
+
+// Import copies the sessions of the file layout, read with files, and
+// records the images in images into the store, all in one transaction. It
+// only runs once for a store: sessions that appear in the file layout later
+// are not imported, so deleting a session from the store never brings it
+// back. The files are left in place. Returns the number of sessions
+// imported, 0 if the store had already imported them.
+func (s *Store) Import(files *persistence.SessionStore, images *persistence.ImageStore) (int, error) {
+	var done string
+	err := s.db.QueryRow("SELECT value FROM meta WHERE key = ?", importedKey).Scan(&done)
+	if err == nil {
+		return 0, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to read import state: %w", err)
+	}
+
+	sessionIDs, err := files.ListSessions()
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.inTx(func(tx *sql.Tx) error {
+		for _, sessionID := range sessionIDs {
+			if err := s.importSession(tx, files, sessionID); err != nil {
+				return fmt.Errorf("failed to import session %s: %w", sessionID, err)
+			}
+			if err := importImages(tx, images, sessionID); err != nil {
+				return fmt.Errorf("failed to import images of session %s: %w", sessionID, err)
+			}
+		}
+		if _, err := tx.Exec("INSERT INTO meta (key, value) VALUES (?, ?)", importedKey, "1"); err != nil {
+			return fmt.Errorf("failed to save import state: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(sessionIDs), nil
+}
+
+// importSession copies one session's chats, chat index and settings in tx.
+func (s *Store) importSession(tx *sql.Tx, files *persistence.SessionStore, sessionID string) error {
+	conv, err := files.Load(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := s.saveChat(tx, sessionID, conversation.DefaultChatID, conv); err != nil {
+		return err
+	}
+
+	index, err := files.LoadChatIndex(sessionID)
+	if err != nil {
+		return err
+	}
+	if index != nil {
+		for _, info := range index.Chats {
+			if info.ID == conversation.DefaultChatID {
+				continue
+			}
+			chat, err := files.LoadChat(sessionID, info.ID)
+			if err != nil {
+				return err
+			}
+			if err := s.saveChat(tx, sessionID, info.ID, chat); err != nil {
+				return err
+			}
+		}
+		if err := s.saveChatIndex(tx, sessionID, index); err != nil {
+			return err
+		}
+	}
+
+	settings, err := files.LoadSettings(sessionID)
+	if err != nil {
+		return err
+	}
+	if settings != nil {
+		return s.saveSettings(tx, sessionID, settings)
+	}
+	return nil
+}
+
+// importImages records the images of a session found on disk in tx, dated
+// by their modification time.
+func importImages(tx *sql.Tx, images *persistence.ImageStore, sessionID string) error {
+	entries, err := os.ReadDir(filepath.Join(images.BasePath(), sessionID, "images"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		messageID, alternate, ok := persistence.ParseImageFilename(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		err = recordImage(tx, ImageRecord{
+			SessionID: sessionID,
+			MessageID: messageID,
+			Alternate: alternate,
+			Size:      info.Size(),
+			CreatedAt: info.ModTime(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
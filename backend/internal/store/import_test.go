@@ -0,0 +1,97 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+func TestStore_Import(t *testing.T) {
+	dir := t.TempDir()
+	files := persistence.NewSessionStore(dir)
+	images := persistence.NewImageStore(dir)
+	sessionID := testSessionID(1)
+	chatID := "0123456789abcdef"
+
+	// A session with a second chat, settings and images
+	if err := files.Save(sessionID, testConversation()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	chat := conversation.NewConversation()
+	chat.SetMessages([]conversation.ConversationMessage{{ID: 1, Role: conversation.RoleUser, Content: "second chat"}})
+	if err := files.SaveChat(sessionID, chatID, chat); err != nil {
+		t.Fatalf("SaveChat() error = %v", err)
+	}
+	index := &conversation.ChatIndex{
+		ActiveChatID: chatID,
+		Chats: []conversation.ChatInfo{
+			{ID: conversation.DefaultChatID, Name: "Chat 1", CreatedAt: time.Unix(100, 0)},
+			{ID: chatID, Name: "Chat 2", CreatedAt: time.Unix(200, 0)},
+		},
+	}
+	if err := files.SaveChatIndex(sessionID, index); err != nil {
+		t.Fatalf("SaveChatIndex() error = %v", err)
+	}
+	if err := files.SaveSettings(sessionID, &conversation.SessionSettings{Persona: "critic"}); err != nil {
+		t.Fatalf("SaveSettings() error = %v", err)
+	}
+	if err := images.Save(sessionID, 2, []byte("png")); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := images.SaveAlternate(sessionID, 2, 3, []byte("png")); err != nil {
+		t.Fatalf("SaveAlternate() error = %v", err)
+	}
+	// Files that are not images are skipped
+	os.WriteFile(filepath.Join(dir, sessionID, "images", "2.png.tmp"), []byte("png"), 0600)
+	// A session with only a conversation
+	if err := files.Save(testSessionID(2), testConversation()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	s := openTestStore(t)
+	n, err := s.Import(files, images)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Import() = %d sessions, want 2", n)
+	}
+
+	conv, _ := s.Load(sessionID)
+	if messages := conv.GetMessages(); len(messages) != 2 || messages[1].Snapshot == nil ||
+		messages[1].Snapshot.Prompt != "a fluffy cat" || conv.GetCurrentPrompt() != "a fluffy cat" {
+		t.Errorf("imported default chat = %+v, want the saved messages", messages)
+	}
+	if chat, _ := s.LoadChat(sessionID, chatID); len(chat.GetMessages()) != 1 {
+		t.Errorf("imported chat has %d messages, want 1", len(chat.GetMessages()))
+	}
+	if got, err := s.LoadChatIndex(sessionID); err != nil || got.ActiveChatID != chatID || len(got.Chats) != 2 {
+		t.Errorf("imported chat index = %+v, %v, want %+v", got, err, index)
+	}
+	if settings, _ := s.LoadSettings(sessionID); settings == nil || settings.Persona != "critic" {
+		t.Errorf("imported settings = %+v, want persona critic", settings)
+	}
+	if settings, _ := s.LoadSettings(testSessionID(2)); settings != nil {
+		t.Errorf("imported settings of a session without any = %+v, want nil", settings)
+	}
+	records, _ := s.Images(sessionID)
+	if got, want := imageKeys(records), [][2]int{{2, 0}, {2, 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("imported images = %v, want %v", got, want)
+	}
+
+	// Sessions are imported only once
+	if err := files.Save(testSessionID(3), testConversation()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if n, err := s.Import(files, images); err != nil || n != 0 {
+		t.Errorf("second Import() = %d, %v, want 0, nil", n, err)
+	}
+	if s.Exists(testSessionID(3)) {
+		t.Error("session saved after the import was imported")
+	}
+}
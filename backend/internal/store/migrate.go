@@ -0,0 +1,109 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrNewerSchema is returned when the database was migrated by a newer
+// version of weave than this one.
+var ErrNewerSchema = errors.New("store was created by a newer version of weave")
+
+// migrations are the schema changes, oldest first. The schema version,
+// SQLite's user_version, is the number of them applied. Never change a
+// migration once released; append a new one instead.
+var migrations = []string{
+	// 1: sessions, their chats, messages and image metadata
+	`
+	CREATE TABLE sessions (
+		id             TEXT PRIMARY KEY,
+		active_chat_id TEXT NOT NULL DEFAULT '',
+		has_index      INTEGER NOT NULL DEFAULT 0,
+		settings       BLOB,
+		updated_at     INTEGER NOT NULL
+	);
+
+	-- The chat index: the chats listed in a session's chat menu
+	CREATE TABLE chats (
+		session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		id         TEXT NOT NULL,
+		name       BLOB NOT NULL,
+		created_at INTEGER NOT NULL,
+		position   INTEGER NOT NULL,
+		PRIMARY KEY (session_id, id)
+	);
+
+	-- A chat's conversation; the default chat's is stored under its ID too
+	CREATE TABLE conversations (
+		session_id      TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		chat_id         TEXT NOT NULL,
+		next_message_id INTEGER NOT NULL,
+		state           BLOB NOT NULL,
+		PRIMARY KEY (session_id, chat_id)
+	);
+
+	-- position is the message's place in the conversation; content is the
+	-- message text for searching, empty when encrypted; data is the whole
+	-- message
+	CREATE TABLE messages (
+		session_id TEXT NOT NULL,
+		chat_id    TEXT NOT NULL,
+		id         INTEGER NOT NULL,
+		position   INTEGER NOT NULL,
+		role       TEXT NOT NULL,
+		content    TEXT NOT NULL,
+		data       BLOB NOT NULL,
+		PRIMARY KEY (session_id, chat_id, position),
+		FOREIGN KEY (session_id, chat_id) REFERENCES conversations(session_id, chat_id) ON DELETE CASCADE
+	);
+
+	-- Images can be saved before their session is, so they don't reference it
+	CREATE TABLE images (
+		session_id TEXT NOT NULL,
+		message_id INTEGER NOT NULL,
+		alternate  INTEGER NOT NULL,
+		size       INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (session_id, message_id, alternate)
+	);
+	CREATE INDEX images_created_at ON images(created_at);
+
+	CREATE TABLE meta (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+	`,
+}
+
+// migrate brings db to the current schema, applying each missing migration
+// in its own transaction.
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("%w: schema version %d, this version supports %d", ErrNewerSchema, version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", version+1, err)
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version+1, err)
+		}
+		// PRAGMA does not take parameters; version is not user input
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
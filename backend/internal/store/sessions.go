@@ -0,0 +1,442 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+)
+
+// conversationState is the JSON representation of a conversation's prompt,
+// stored with it. Its messages are stored one row each.
+type conversationState struct {
+	CurrentPrompt  string                        `json:"current_prompt"`
+	PreviousPrompt string                        `json:"previous_prompt,omitempty"`
+	PromptEdited   bool                          `json:"prompt_edited,omitempty"`
+	PromptHistory  []conversation.PromptRevision `json:"prompt_history,omitempty"`
+}
+
+// MessageMatch is a message found by SearchMessages.
+type MessageMatch struct {
+	ChatID  string
+	Message conversation.ConversationMessage
+}
+
+// Save persists the default chat's conversation, replacing its messages in
+// one transaction.
+func (s *Store) Save(sessionID string, conv *conversation.Conversation) error {
+	return s.SaveChat(sessionID, conversation.DefaultChatID, conv)
+}
+
+// Load reads the default chat's conversation.
+// Returns an empty conversation if it was never saved or is corrupt.
+func (s *Store) Load(sessionID string) (*conversation.Conversation, error) {
+	return s.LoadChat(sessionID, conversation.DefaultChatID)
+}
+
+// SaveChat persists a chat's conversation, replacing its messages in one
+// transaction.
+func (s *Store) SaveChat(sessionID, chatID string, conv *conversation.Conversation) error {
+	if sessionID == "" {
+		return fmt.Errorf("session ID cannot be empty")
+	}
+	if chatID == "" {
+		return fmt.Errorf("chat ID cannot be empty")
+	}
+	if conv == nil {
+		return fmt.Errorf("conversation cannot be nil")
+	}
+
+	return s.inTx(func(tx *sql.Tx) error {
+		return s.saveChat(tx, sessionID, chatID, conv)
+	})
+}
+
+// saveChat writes a chat's conversation in tx.
+func (s *Store) saveChat(tx *sql.Tx, sessionID, chatID string, conv *conversation.Conversation) error {
+	state, err := json.Marshal(conversationState{
+		CurrentPrompt:  conv.GetCurrentPrompt(),
+		PreviousPrompt: conv.GetPreviousPrompt(),
+		PromptEdited:   conv.IsPromptEdited(),
+		PromptHistory:  conv.GetPromptHistory(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize conversation: %w", err)
+	}
+	if state, err = s.seal(state); err != nil {
+		return fmt.Errorf("failed to encrypt conversation: %w", err)
+	}
+
+	if err := touchSession(tx, sessionID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO conversations (session_id, chat_id, next_message_id, state) VALUES (?, ?, ?, ?)
+		ON CONFLICT (session_id, chat_id) DO UPDATE SET
+			next_message_id = excluded.next_message_id, state = excluded.state`,
+		sessionID, chatID, conv.GetNextMessageID(), state)
+	if err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM messages WHERE session_id = ? AND chat_id = ?", sessionID, chatID); err != nil {
+		return fmt.Errorf("failed to save messages: %w", err)
+	}
+	insert, err := tx.Prepare(`
+		INSERT INTO messages (session_id, chat_id, id, position, role, content, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to save messages: %w", err)
+	}
+	defer insert.Close()
+	for i, msg := range conv.GetMessages() {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to serialize message %d: %w", msg.ID, err)
+		}
+		if data, err = s.seal(data); err != nil {
+			return fmt.Errorf("failed to encrypt message %d: %w", msg.ID, err)
+		}
+		// Searchable text is only kept when it is not encrypted
+		content := msg.Content
+		if s.encryptor != nil {
+			content = ""
+		}
+		if _, err := insert.Exec(sessionID, chatID, msg.ID, i, msg.Role, content, data); err != nil {
+			return fmt.Errorf("failed to save message %d: %w", msg.ID, err)
+		}
+	}
+	return nil
+}
+
+// LoadChat reads a chat's conversation.
+// Returns an empty conversation if it was never saved or is corrupt.
+func (s *Store) LoadChat(sessionID, chatID string) (*conversation.Conversation, error) {
+	var nextMessageID int
+	var state []byte
+	err := s.db.QueryRow("SELECT next_message_id, state FROM conversations WHERE session_id = ? AND chat_id = ?",
+		sessionID, chatID).Scan(&nextMessageID, &state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return conversation.NewConversation(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversation: %w", err)
+	}
+
+	conv, err := s.readConversation(sessionID, chatID, nextMessageID, state)
+	if err != nil {
+		if errors.Is(err, errCorrupt) {
+			// Log corrupt rows but return an empty conversation to allow recovery
+			fmt.Fprintf(os.Stderr, "WARNING: corrupt conversation %s for session %s: %v\n", chatID, sessionID, err)
+			return conversation.NewConversation(), nil
+		}
+		return nil, err
+	}
+	return conv, nil
+}
+
+// errCorrupt marks rows that could be read but not parsed.
+var errCorrupt = errors.New("corrupt data")
+
+// readConversation reads the messages of a conversation whose row holds
+// nextMessageID and state.
+func (s *Store) readConversation(sessionID, chatID string, nextMessageID int, state []byte) (*conversation.Conversation, error) {
+	state, err := s.open(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt conversation: %w", err)
+	}
+	var cs conversationState
+	if err := json.Unmarshal(state, &cs); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorrupt, err)
+	}
+
+	rows, err := s.db.Query("SELECT data FROM messages WHERE session_id = ? AND chat_id = ? ORDER BY position",
+		sessionID, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+	defer rows.Close()
+	messages := []conversation.ConversationMessage{}
+	for rows.Next() {
+		msg, err := s.scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+
+	conv := conversation.NewConversation()
+	conv.SetMessages(messages)
+	conv.SetNextMessageID(nextMessageID)
+	conv.SetCurrentPrompt(cs.CurrentPrompt)
+	conv.SetPreviousPrompt(cs.PreviousPrompt)
+	conv.SetPromptEdited(cs.PromptEdited)
+	conv.SetPromptHistory(cs.PromptHistory)
+	return conv, nil
+}
+
+// scanMessage reads a message from the data column of the current row.
+func (s *Store) scanMessage(rows *sql.Rows) (conversation.ConversationMessage, error) {
+	var msg conversation.ConversationMessage
+	var data []byte
+	if err := rows.Scan(&data); err != nil {
+		return msg, fmt.Errorf("failed to read message: %w", err)
+	}
+	data, err := s.open(data)
+	if err != nil {
+		return msg, fmt.Errorf("failed to decrypt message: %w", err)
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, fmt.Errorf("%w: %v", errCorrupt, err)
+	}
+	return msg, nil
+}
+
+// DeleteChat removes a chat's conversation and its messages.
+// Returns nil if it was never saved.
+func (s *Store) DeleteChat(sessionID, chatID string) error {
+	if _, err := s.db.Exec("DELETE FROM conversations WHERE session_id = ? AND chat_id = ?", sessionID, chatID); err != nil {
+		return fmt.Errorf("failed to delete chat: %w", err)
+	}
+	return nil
+}
+
+// DeleteSession removes everything saved of a session, including the
+// records of its images. Returns nil if it was never saved.
+func (s *Store) DeleteSession(sessionID string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM sessions WHERE id = ?", sessionID); err != nil {
+			return fmt.Errorf("failed to delete session: %w", err)
+		}
+		if _, err := tx.Exec("DELETE FROM images WHERE session_id = ?", sessionID); err != nil {
+			return fmt.Errorf("failed to delete session images: %w", err)
+		}
+		return nil
+	})
+}
+
+// SaveChatIndex persists the session's chat list, replacing the previous one.
+func (s *Store) SaveChatIndex(sessionID string, index *conversation.ChatIndex) error {
+	if sessionID == "" {
+		return fmt.Errorf("session ID cannot be empty")
+	}
+	if index == nil {
+		return fmt.Errorf("chat index cannot be nil")
+	}
+
+	return s.inTx(func(tx *sql.Tx) error {
+		return s.saveChatIndex(tx, sessionID, index)
+	})
+}
+
+// saveChatIndex writes the session's chat list in tx.
+func (s *Store) saveChatIndex(tx *sql.Tx, sessionID string, index *conversation.ChatIndex) error {
+	if err := touchSession(tx, sessionID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE sessions SET active_chat_id = ?, has_index = 1 WHERE id = ?",
+		index.ActiveChatID, sessionID); err != nil {
+		return fmt.Errorf("failed to save chat index: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM chats WHERE session_id = ?", sessionID); err != nil {
+		return fmt.Errorf("failed to save chat index: %w", err)
+	}
+	for i, info := range index.Chats {
+		name, err := s.seal([]byte(info.Name))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt chat name: %w", err)
+		}
+		if _, err := tx.Exec("INSERT INTO chats (session_id, id, name, created_at, position) VALUES (?, ?, ?, ?, ?)",
+			sessionID, info.ID, name, info.CreatedAt.UnixNano(), i); err != nil {
+			return fmt.Errorf("failed to save chat %s: %w", info.ID, err)
+		}
+	}
+	return nil
+}
+
+// LoadChatIndex reads the session's chat list.
+// Returns nil (and no error) if the session has never had more than one chat.
+func (s *Store) LoadChatIndex(sessionID string) (*conversation.ChatIndex, error) {
+	var index conversation.ChatIndex
+	var hasIndex bool
+	err := s.db.QueryRow("SELECT active_chat_id, has_index FROM sessions WHERE id = ?", sessionID).
+		Scan(&index.ActiveChatID, &hasIndex)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !hasIndex) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chat index: %w", err)
+	}
+
+	rows, err := s.db.Query("SELECT id, name, created_at FROM chats WHERE session_id = ? ORDER BY position", sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chat index: %w", err)
+	}
+	defer rows.Close()
+	index.Chats = []conversation.ChatInfo{}
+	for rows.Next() {
+		var info conversation.ChatInfo
+		var name []byte
+		var createdAt int64
+		if err := rows.Scan(&info.ID, &name, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to read chat index: %w", err)
+		}
+		if name, err = s.open(name); err != nil {
+			return nil, fmt.Errorf("failed to decrypt chat name: %w", err)
+		}
+		info.Name = string(name)
+		info.CreatedAt = time.Unix(0, createdAt)
+		index.Chats = append(index.Chats, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chat index: %w", err)
+	}
+	return &index, nil
+}
+
+// SaveSettings persists the session's settings.
+func (s *Store) SaveSettings(sessionID string, settings *conversation.SessionSettings) error {
+	if sessionID == "" {
+		return fmt.Errorf("session ID cannot be empty")
+	}
+	if settings == nil {
+		return fmt.Errorf("settings cannot be nil")
+	}
+
+	return s.inTx(func(tx *sql.Tx) error {
+		return s.saveSettings(tx, sessionID, settings)
+	})
+}
+
+// saveSettings writes the session's settings in tx.
+func (s *Store) saveSettings(tx *sql.Tx, sessionID string, settings *conversation.SessionSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to serialize settings: %w", err)
+	}
+	if data, err = s.seal(data); err != nil {
+		return fmt.Errorf("failed to encrypt settings: %w", err)
+	}
+
+	if err := touchSession(tx, sessionID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE sessions SET settings = ? WHERE id = ?", data, sessionID); err != nil {
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+	return nil
+}
+
+// LoadSettings reads the session's settings.
+// Returns nil (and no error) if the session has never changed a setting.
+func (s *Store) LoadSettings(sessionID string) (*conversation.SessionSettings, error) {
+	var data []byte
+	err := s.db.QueryRow("SELECT settings FROM sessions WHERE id = ?", sessionID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && data == nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings: %w", err)
+	}
+	if data, err = s.open(data); err != nil {
+		return nil, fmt.Errorf("failed to decrypt settings: %w", err)
+	}
+
+	var settings conversation.SessionSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse settings: %w", err)
+	}
+	return &settings, nil
+}
+
+// Exists checks if anything of a session has been saved.
+func (s *Store) Exists(sessionID string) bool {
+	var one int
+	err := s.db.QueryRow("SELECT 1 FROM sessions WHERE id = ?", sessionID).Scan(&one)
+	return err == nil
+}
+
+// ListSessions returns the IDs of all saved sessions, most recently saved
+// first.
+func (s *Store) ListSessions() ([]string, error) {
+	rows, err := s.db.Query("SELECT id FROM sessions ORDER BY updated_at DESC, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		sessions = append(sessions, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// SearchMessages returns up to limit messages of a session, in any of its
+// chats, whose text contains query, ignoring case for ASCII letters. Matches
+// are ordered by chat and position in it. Returns ErrNotSearchable if the
+// store is encrypted.
+func (s *Store) SearchMessages(sessionID, query string, limit int) ([]MessageMatch, error) {
+	if s.encryptor != nil {
+		return nil, ErrNotSearchable
+	}
+	if query == "" || limit <= 0 {
+		return []MessageMatch{}, nil
+	}
+
+	// LIKE wildcards in query match themselves
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
+	rows, err := s.db.Query(`
+		SELECT chat_id, data FROM messages
+		WHERE session_id = ? AND content LIKE '%' || ? || '%' ESCAPE '\'
+		ORDER BY chat_id, position LIMIT ?`,
+		sessionID, escaped, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []MessageMatch{}
+	for rows.Next() {
+		var match MessageMatch
+		var data []byte
+		if err := rows.Scan(&match.ChatID, &data); err != nil {
+			return nil, fmt.Errorf("failed to search messages: %w", err)
+		}
+		if err := json.Unmarshal(data, &match.Message); err != nil {
+			continue // Skip corrupt rows rather than failing the search
+		}
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	return matches, nil
+}
+
+// touchSession creates the session's row if needed and marks it updated.
+func touchSession(tx *sql.Tx, sessionID string) error {
+	_, err := tx.Exec(`
+		INSERT INTO sessions (id, updated_at) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET updated_at = excluded.updated_at`,
+		sessionID, time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,403 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// testConversation returns a conversation with a user message and an
+// assistant message with a snapshot.
+func testConversation() *conversation.Conversation {
+	conv := conversation.NewConversation()
+	conv.SetMessages([]conversation.ConversationMessage{
+		{ID: 1, Role: conversation.RoleUser, Content: "I want a cat picture"},
+		{
+			ID:      2,
+			Role:    conversation.RoleAssistant,
+			Content: "Here's a prompt for you",
+			Snapshot: &conversation.StateSnapshot{
+				Prompt:        "a fluffy cat",
+				Steps:         20,
+				CFG:           3.5,
+				Seed:          -1,
+				PreviewStatus: conversation.PreviewStatusComplete,
+			},
+		},
+	})
+	conv.SetNextMessageID(3)
+	conv.SetCurrentPrompt("a fluffy cat")
+	conv.SetPreviousPrompt("a cat")
+	conv.SetPromptEdited(true)
+	conv.SetPromptHistory([]conversation.PromptRevision{
+		{Prompt: "a cat", Source: conversation.PromptSourceAgent, CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), Seq: 1},
+		{Prompt: "a fluffy cat", Source: conversation.PromptSourceUser, CreatedAt: time.Date(2025, 1, 2, 3, 5, 0, 0, time.UTC), Seq: 2},
+	})
+	return conv
+}
+
+func TestStore_SaveLoad(t *testing.T) {
+	s := openTestStore(t)
+	sessionID := testSessionID(1)
+
+	// Never saved
+	conv, err := s.Load(sessionID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(conv.GetMessages()) != 0 || s.Exists(sessionID) {
+		t.Fatalf("Load() of an unsaved session = %d messages, Exists() = %v, want an empty conversation",
+			len(conv.GetMessages()), s.Exists(sessionID))
+	}
+
+	want := testConversation()
+	if err := s.Save(sessionID, want); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	got, err := s.Load(sessionID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.GetMessages(), want.GetMessages()) {
+		t.Errorf("messages = %+v, want %+v", got.GetMessages(), want.GetMessages())
+	}
+	if got.GetNextMessageID() != 3 || got.GetCurrentPrompt() != "a fluffy cat" ||
+		got.GetPreviousPrompt() != "a cat" || !got.IsPromptEdited() {
+		t.Errorf("loaded state = %d, %q, %q, %v, want 3, %q, %q, true", got.GetNextMessageID(),
+			got.GetCurrentPrompt(), got.GetPreviousPrompt(), got.IsPromptEdited(), "a fluffy cat", "a cat")
+	}
+	if !reflect.DeepEqual(got.GetPromptHistory(), want.GetPromptHistory()) {
+		t.Errorf("prompt history = %+v, want %+v", got.GetPromptHistory(), want.GetPromptHistory())
+	}
+
+	// Saving again replaces the messages
+	want.SetMessages(want.GetMessages()[1:])
+	if err := s.Save(sessionID, want); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	got, _ = s.Load(sessionID)
+	if messages := got.GetMessages(); len(messages) != 1 || messages[0].ID != 2 {
+		t.Errorf("messages after saving fewer = %+v, want only message 2", messages)
+	}
+
+	if err := s.Save("", want); err == nil {
+		t.Error("Save() with an empty session ID succeeded")
+	}
+	if err := s.Save(sessionID, nil); err == nil {
+		t.Error("Save() of a nil conversation succeeded")
+	}
+}
+
+func TestStore_Chats(t *testing.T) {
+	s := openTestStore(t)
+	sessionID := testSessionID(2)
+	chatID := "0123456789abcdef"
+
+	index, err := s.LoadChatIndex(sessionID)
+	if err != nil || index != nil {
+		t.Fatalf("LoadChatIndex() with no index = %v, %v, want nil, nil", index, err)
+	}
+
+	if err := s.Save(sessionID, testConversation()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	chat := conversation.NewConversation()
+	chat.SetMessages([]conversation.ConversationMessage{{ID: 7, Role: conversation.RoleUser, Content: "second chat"}})
+	chat.SetNextMessageID(8)
+	if err := s.SaveChat(sessionID, chatID, chat); err != nil {
+		t.Fatalf("SaveChat() error = %v", err)
+	}
+
+	// Without an index, only having saved conversations doesn't make one
+	if index, _ := s.LoadChatIndex(sessionID); index != nil {
+		t.Errorf("LoadChatIndex() before SaveChatIndex() = %+v, want nil", index)
+	}
+
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	wantIndex := &conversation.ChatIndex{
+		ActiveChatID: chatID,
+		Chats: []conversation.ChatInfo{
+			{ID: conversation.DefaultChatID, Name: "Chat 1", CreatedAt: created},
+			{ID: chatID, Name: "Portraits", CreatedAt: created.Add(time.Hour)},
+		},
+	}
+	if err := s.SaveChatIndex(sessionID, wantIndex); err != nil {
+		t.Fatalf("SaveChatIndex() error = %v", err)
+	}
+	index, err = s.LoadChatIndex(sessionID)
+	if err != nil {
+		t.Fatalf("LoadChatIndex() error = %v", err)
+	}
+	if index.ActiveChatID != chatID || len(index.Chats) != 2 {
+		t.Fatalf("LoadChatIndex() = %+v, want %+v", index, wantIndex)
+	}
+	for i, info := range index.Chats {
+		want := wantIndex.Chats[i]
+		if info.ID != want.ID || info.Name != want.Name || !info.CreatedAt.Equal(want.CreatedAt) {
+			t.Errorf("chat %d = %+v, want %+v", i, info, want)
+		}
+	}
+
+	loaded, err := s.LoadChat(sessionID, chatID)
+	if err != nil {
+		t.Fatalf("LoadChat() error = %v", err)
+	}
+	if messages := loaded.GetMessages(); len(messages) != 1 || messages[0].Content != "second chat" || loaded.GetNextMessageID() != 8 {
+		t.Errorf("LoadChat() = %+v, next ID %d, want the saved chat", messages, loaded.GetNextMessageID())
+	}
+	// Chats don't share messages
+	if main, _ := s.Load(sessionID); len(main.GetMessages()) != 2 {
+		t.Errorf("default chat has %d messages, want 2", len(main.GetMessages()))
+	}
+
+	if err := s.DeleteChat(sessionID, chatID); err != nil {
+		t.Fatalf("DeleteChat() error = %v", err)
+	}
+	if loaded, _ := s.LoadChat(sessionID, chatID); len(loaded.GetMessages()) != 0 {
+		t.Errorf("LoadChat() after DeleteChat() = %d messages, want none", len(loaded.GetMessages()))
+	}
+	var messages int
+	s.db.QueryRow("SELECT COUNT(*) FROM messages WHERE chat_id = ?", chatID).Scan(&messages)
+	if messages != 0 {
+		t.Errorf("%d messages left after DeleteChat(), want none", messages)
+	}
+	if err := s.DeleteChat(sessionID, chatID); err != nil {
+		t.Errorf("DeleteChat() of a deleted chat error = %v", err)
+	}
+}
+
+func TestStore_Settings(t *testing.T) {
+	s := openTestStore(t)
+	sessionID := testSessionID(3)
+
+	settings, err := s.LoadSettings(sessionID)
+	if err != nil || settings != nil {
+		t.Fatalf("LoadSettings() with no settings = %v, %v, want nil, nil", settings, err)
+	}
+
+	// A session saved without settings has none either
+	if err := s.Save(sessionID, testConversation()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if settings, err := s.LoadSettings(sessionID); err != nil || settings != nil {
+		t.Fatalf("LoadSettings() of a session without settings = %v, %v, want nil, nil", settings, err)
+	}
+
+	temperature := 0.4
+	seed := int64(12)
+	want := &conversation.SessionSettings{
+		Generation: &conversation.GenerationSettings{Steps: 28, CFG: 4.5, Seed: 99},
+		Model:      "llama3.2",
+		LoRAs:      []conversation.LoRA{{Name: "watercolor", Weight: 0.8}},
+		Persona:    "critic",
+		Sampling:   ollama.Sampling{Temperature: &temperature},
+		LLMSeed:    &seed,
+		Width:      768,
+		Height:     512,
+	}
+	if err := s.SaveSettings(sessionID, want); err != nil {
+		t.Fatalf("SaveSettings() error = %v", err)
+	}
+	settings, err = s.LoadSettings(sessionID)
+	if err != nil {
+		t.Fatalf("LoadSettings() error = %v", err)
+	}
+	if !reflect.DeepEqual(settings, want) {
+		t.Errorf("LoadSettings() = %+v, want %+v", settings, want)
+	}
+
+	if err := s.SaveSettings(sessionID, nil); err == nil {
+		t.Error("SaveSettings() of nil settings succeeded")
+	}
+}
+
+func TestStore_ListSessions(t *testing.T) {
+	s := openTestStore(t)
+
+	sessions, err := s.ListSessions()
+	if err != nil || len(sessions) != 0 {
+		t.Fatalf("ListSessions() of an empty store = %v, %v, want none", sessions, err)
+	}
+
+	for _, n := range []int{4, 5, 6} {
+		if err := s.Save(testSessionID(n), testConversation()); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	// Saving settings counts as activity too
+	if err := s.SaveSettings(testSessionID(4), &conversation.SessionSettings{Persona: "critic"}); err != nil {
+		t.Fatalf("SaveSettings() error = %v", err)
+	}
+
+	sessions, err = s.ListSessions()
+	if err != nil {
+		t.Fatalf("ListSessions() error = %v", err)
+	}
+	want := []string{testSessionID(4), testSessionID(6), testSessionID(5)}
+	if !reflect.DeepEqual(sessions, want) {
+		t.Errorf("ListSessions() = %v, want %v (most recent first)", sessions, want)
+	}
+}
+
+func TestStore_DeleteSession(t *testing.T) {
+	s := openTestStore(t)
+	sessionID := testSessionID(7)
+	chatID := "0123456789abcdef"
+
+	if err := s.Save(sessionID, testConversation()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := s.SaveChat(sessionID, chatID, testConversation()); err != nil {
+		t.Fatalf("SaveChat() error = %v", err)
+	}
+	if err := s.RecordImage(sessionID, 2, 0, 100); err != nil {
+		t.Fatalf("RecordImage() error = %v", err)
+	}
+	if err := s.Save(testSessionID(8), testConversation()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if err := s.DeleteSession(sessionID); err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+	if s.Exists(sessionID) {
+		t.Error("Exists() after DeleteSession() = true, want false")
+	}
+	if chat, err := s.LoadChat(sessionID, chatID); err != nil || len(chat.GetMessages()) != 0 {
+		t.Errorf("LoadChat() after DeleteSession() = %v messages, %v, want none", len(chat.GetMessages()), err)
+	}
+	if records, err := s.Images(sessionID); err != nil || len(records) != 0 {
+		t.Errorf("Images() after DeleteSession() = %+v, %v, want none", records, err)
+	}
+	if !s.Exists(testSessionID(8)) {
+		t.Error("DeleteSession() removed another session")
+	}
+}
+
+func TestStore_SearchMessages(t *testing.T) {
+	s := openTestStore(t)
+	sessionID := testSessionID(7)
+	chatID := "0123456789abcdef"
+
+	if err := s.Save(sessionID, testConversation()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	chat := conversation.NewConversation()
+	chat.SetMessages([]conversation.ConversationMessage{
+		{ID: 1, Role: conversation.RoleUser, Content: "Another CAT, 100% orange"},
+		{ID: 2, Role: conversation.RoleUser, Content: "a dog"},
+	})
+	if err := s.SaveChat(sessionID, chatID, chat); err != nil {
+		t.Fatalf("SaveChat() error = %v", err)
+	}
+	// Other sessions are not searched
+	if err := s.Save(testSessionID(8), testConversation()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		want  []string // chat ID and content of each match
+	}{
+		{"case insensitive", "cat", 10, []string{chatID, "Another CAT, 100% orange", conversation.DefaultChatID, "I want a cat picture"}},
+		{"limit", "cat", 1, []string{chatID, "Another CAT, 100% orange"}},
+		{"wildcards are literal", "0%", 10, []string{chatID, "Another CAT, 100% orange"}},
+		{"underscore is literal", "a_dog", 10, nil},
+		{"no match", "lighthouse", 10, nil},
+		{"empty query", "", 10, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := s.SearchMessages(sessionID, tt.query, tt.limit)
+			if err != nil {
+				t.Fatalf("SearchMessages() error = %v", err)
+			}
+			var got []string
+			for _, m := range matches {
+				got = append(got, m.ChatID, m.Message.Content)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SearchMessages(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStore_Encrypted(t *testing.T) {
+	s := openTestStore(t)
+	enc, err := persistence.NewEncryptor(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("NewEncryptor() error = %v", err)
+	}
+	s.SetEncryptor(enc)
+	sessionID := testSessionID(9)
+
+	want := testConversation()
+	if err := s.Save(sessionID, want); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := s.SaveChatIndex(sessionID, &conversation.ChatIndex{
+		ActiveChatID: conversation.DefaultChatID,
+		Chats:        []conversation.ChatInfo{{ID: conversation.DefaultChatID, Name: "Secret plans"}},
+	}); err != nil {
+		t.Fatalf("SaveChatIndex() error = %v", err)
+	}
+	if err := s.SaveSettings(sessionID, &conversation.SessionSettings{Persona: "critic"}); err != nil {
+		t.Fatalf("SaveSettings() error = %v", err)
+	}
+
+	// Nothing is stored in plaintext
+	for _, query := range []string{
+		"SELECT content || CAST(data AS TEXT) FROM messages",
+		"SELECT CAST(state AS TEXT) FROM conversations",
+		"SELECT CAST(name AS TEXT) FROM chats",
+		"SELECT CAST(settings AS TEXT) FROM sessions",
+	} {
+		rows, err := s.db.Query(query)
+		if err != nil {
+			t.Fatalf("%s failed: %v", query, err)
+		}
+		for rows.Next() {
+			var text string
+			rows.Scan(&text)
+			for _, secret := range []string{"cat", "Secret", "critic"} {
+				if bytes.Contains([]byte(text), []byte(secret)) {
+					t.Errorf("%s returned plaintext %q", query, secret)
+				}
+			}
+		}
+		rows.Close()
+	}
+
+	got, err := s.Load(sessionID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.GetMessages(), want.GetMessages()) || got.GetCurrentPrompt() != "a fluffy cat" {
+		t.Errorf("Load() of an encrypted conversation = %+v, want the saved one", got.GetMessages())
+	}
+	if index, err := s.LoadChatIndex(sessionID); err != nil || index.Chats[0].Name != "Secret plans" {
+		t.Errorf("LoadChatIndex() = %+v, %v, want the saved index", index, err)
+	}
+	if settings, err := s.LoadSettings(sessionID); err != nil || settings.Persona != "critic" {
+		t.Errorf("LoadSettings() = %+v, %v, want the saved settings", settings, err)
+	}
+	if _, err := s.SearchMessages(sessionID, "cat", 10); !errors.Is(err, ErrNotSearchable) {
+		t.Errorf("SearchMessages() error = %v, want %v", err, ErrNotSearchable)
+	}
+
+	// Without the key, nothing is readable
+	s.SetEncryptor(nil)
+	if _, err := s.Load(sessionID); !errors.Is(err, persistence.ErrEncrypted) {
+		t.Errorf("Load() without the key error = %v, want %v", err, persistence.ErrEncrypted)
+	}
+}
@@ -0,0 +1,123 @@
+// Package store keeps sessions, their chats and messages, and the metadata
+// of their images in a single SQLite database, as an alternative to the
+// per-session files of package persistence. Writes are transactional, so a
+// crash never leaves a half-written conversation, messages can be searched,
+// and backing up weave's state means copying one file.
+//
+// Image data itself stays on disk in persistence.ImageStore; the store only
+// indexes it.
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hurricanerix/weave/internal/persistence"
+
+	// Registers the pure Go "sqlite" driver, so weave builds without cgo
+	_ "modernc.org/sqlite"
+)
+
+// DefaultPath is where the database is kept, next to config/sessions.
+const DefaultPath = "config/weave.db"
+
+// ErrNotSearchable is returned by SearchMessages when the store is
+// encrypted, as message text is then not stored in plaintext.
+var ErrNotSearchable = errors.New("encrypted messages cannot be searched")
+
+// Store is a SQLite database of sessions. It implements the persistence
+// interfaces of conversation.SessionManager, so it can replace
+// persistence.SessionStore, and persistence.ImageIndex.
+//
+// With SetEncryptor, conversations, chat names and settings are encrypted
+// at rest, as with persistence.SessionStore. Message text is then not
+// searchable.
+//
+// A Store is safe for concurrent use.
+type Store struct {
+	db        *sql.DB
+	encryptor *persistence.Encryptor // Encrypts rows at rest; nil stores plaintext
+}
+
+// Open opens the database at path, creating it if it doesn't exist, and
+// migrates it to the current schema.
+//
+// CALLER MUST CLOSE THE STORE when done to release the database.
+func Open(path string) (*Store, error) {
+	// 0700: owner-only access, as for config/sessions
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	// Created here rather than by SQLite, so it is owner-only too
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create store: %w", err)
+	}
+	f.Close()
+
+	// Write-ahead logging lets sessions be read while another is saved;
+	// busy_timeout makes concurrent writers wait for each other instead of
+	// failing
+	dsn := "file:" + filepath.ToSlash(path) +
+		"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store: %w", err)
+	}
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// SetEncryptor enables encryption at rest. It must be called before the
+// store is used.
+func (s *Store) SetEncryptor(e *persistence.Encryptor) {
+	s.encryptor = e
+}
+
+// seal encrypts data if encryption is enabled.
+func (s *Store) seal(data []byte) ([]byte, error) {
+	if s.encryptor == nil {
+		return data, nil
+	}
+	return s.encryptor.Seal(data)
+}
+
+// open decrypts data written by seal. Plaintext is returned as-is.
+func (s *Store) open(data []byte) ([]byte, error) {
+	if !persistence.IsEncrypted(data) {
+		return data, nil
+	}
+	if s.encryptor == nil {
+		return nil, persistence.ErrEncrypted
+	}
+	return s.encryptor.Open(data)
+}
+
+// inTx runs fn in a transaction, committed if fn returns nil and rolled
+// back otherwise.
+func (s *Store) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
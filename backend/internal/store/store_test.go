@@ -0,0 +1,81 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+)
+
+// testSessionID returns a valid 32-character hex session ID.
+func testSessionID(n int) string {
+	return fmt.Sprintf("%032x", n)
+}
+
+// openTestStore opens a store in a temporary directory, closed when the
+// test ends.
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "weave.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestOpen_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "weave.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	conv := conversation.NewConversation()
+	conv.SetCurrentPrompt("a lighthouse")
+	if err := s.Save(testSessionID(1), conv); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Migrations that were applied are not applied again
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() of an existing store error = %v", err)
+	}
+	defer s.Close()
+	loaded, err := s.Load(testSessionID(1))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.GetCurrentPrompt() != "a lighthouse" {
+		t.Errorf("GetCurrentPrompt() after reopening = %q, want %q", loaded.GetCurrentPrompt(), "a lighthouse")
+	}
+
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatalf("reading user_version failed: %v", err)
+	}
+	if version != len(migrations) {
+		t.Errorf("schema version = %d, want %d", version, len(migrations))
+	}
+}
+
+func TestOpen_NewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weave.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, err := s.db.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(migrations)+1)); err != nil {
+		t.Fatalf("setting user_version failed: %v", err)
+	}
+	s.Close()
+
+	if _, err := Open(path); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("Open() error = %v, want %v", err, ErrNewerSchema)
+	}
+}
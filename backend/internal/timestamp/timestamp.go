@@ -0,0 +1,89 @@
+// Package timestamp issues the timestamps and ordering sequence numbers
+// stored in weave's metadata.
+//
+// Timestamps are UTC and serialize as RFC3339 in JSON. Wall clocks can jump
+// backwards (NTP corrections, a device with a wrong clock), so every record
+// also carries a sequence number that is strictly increasing across the
+// process. Sequence numbers start from the current time in microseconds, so
+// records written after a restart still sort after earlier ones.
+package timestamp
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock issues UTC timestamps that never go backwards and strictly
+// increasing sequence numbers. The zero value is not usable; use New.
+type Clock struct {
+	mu   sync.Mutex
+	now  func() time.Time
+	last time.Time
+	seq  int64
+}
+
+// New creates a Clock backed by the system clock.
+func New() *Clock {
+	return &Clock{now: time.Now}
+}
+
+// defaultClock is the process-wide clock used by Next and Observe.
+var defaultClock = New()
+
+// Next returns a timestamp and sequence number from the process-wide clock.
+func Next() (time.Time, int64) {
+	return defaultClock.Next()
+}
+
+// Observe advances the process-wide clock past a loaded record.
+func Observe(t time.Time, seq int64) {
+	defaultClock.Observe(t, seq)
+}
+
+// Next returns the current UTC time, or the last issued time if the wall
+// clock went backwards, and a sequence number greater than any issued or
+// observed before.
+func (c *Clock) Next() (time.Time, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := Normalize(c.now())
+	if now.Before(c.last) {
+		now = c.last
+	}
+	c.last = now
+
+	c.seq = max(c.seq+1, now.UnixMicro())
+	return now, c.seq
+}
+
+// Observe advances the clock so later calls to Next don't issue a time or
+// sequence number older than a record loaded from storage.
+func (c *Clock) Observe(t time.Time, seq int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t = Normalize(t); t.After(c.last) {
+		c.last = t
+	}
+	c.seq = max(c.seq, seq)
+}
+
+// Normalize converts t to UTC at microsecond precision. Truncating also
+// drops the monotonic clock reading, so the result round-trips through
+// JSON unchanged.
+func Normalize(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// Migrate returns the normalized form of a timestamp stored before sequence
+// numbers existed, and a sequence number for the record. prev is the
+// sequence number of the record before it in time order; the result is
+// always greater.
+func Migrate(t time.Time, prev int64) (time.Time, int64) {
+	t = Normalize(t)
+	if t.IsZero() {
+		return t, prev + 1
+	}
+	return t, max(prev+1, t.UnixMicro())
+}
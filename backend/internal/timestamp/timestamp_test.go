@@ -0,0 +1,147 @@
+package timestamp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// fakeClock returns a Clock that reads times from the given list in order.
+func fakeClock(times ...time.Time) *Clock {
+	c := New()
+	c.now = func() time.Time {
+		t := times[0]
+		times = times[1:]
+		return t
+	}
+	return c
+}
+
+func TestClock_Next(t *testing.T) {
+	base := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	local := time.FixedZone("UTC-5", -5*60*60)
+
+	tests := []struct {
+		name  string
+		times []time.Time
+		want  []time.Time
+	}{
+		{
+			name:  "advancing clock",
+			times: []time.Time{base, base.Add(time.Second)},
+			want:  []time.Time{base, base.Add(time.Second)},
+		},
+		{
+			name:  "clock goes backwards",
+			times: []time.Time{base, base.Add(-time.Hour)},
+			want:  []time.Time{base, base},
+		},
+		{
+			name:  "same instant",
+			times: []time.Time{base, base},
+			want:  []time.Time{base, base},
+		},
+		{
+			name:  "local time converted to UTC",
+			times: []time.Time{base.In(local)},
+			want:  []time.Time{base},
+		},
+		{
+			name:  "sub-microsecond precision dropped",
+			times: []time.Time{base.Add(1500 * time.Nanosecond)},
+			want:  []time.Time{base.Add(time.Microsecond)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fakeClock(tt.times...)
+			var prevSeq int64
+			for i, want := range tt.want {
+				got, seq := c.Next()
+				if got != want {
+					t.Errorf("Next() #%d time = %v, want %v", i, got, want)
+				}
+				if seq <= prevSeq {
+					t.Errorf("Next() #%d seq = %d, want greater than %d", i, seq, prevSeq)
+				}
+				prevSeq = seq
+			}
+		})
+	}
+}
+
+func TestClock_Observe(t *testing.T) {
+	base := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	later := base.Add(time.Hour)
+
+	c := fakeClock(base)
+	c.Observe(later, later.UnixMicro()+100)
+
+	got, seq := c.Next()
+	if got != later {
+		t.Errorf("Next() time = %v, want observed time %v", got, later)
+	}
+	if seq <= later.UnixMicro()+100 {
+		t.Errorf("Next() seq = %d, want greater than observed seq", seq)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	stored := time.Date(2025, 6, 1, 14, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+
+	tests := []struct {
+		name     string
+		t        time.Time
+		prev     int64
+		wantTime time.Time
+		wantSeq  int64
+	}{
+		{
+			name:     "timestamp converted to UTC",
+			t:        stored,
+			wantTime: stored.UTC(),
+			wantSeq:  stored.UnixMicro(),
+		},
+		{
+			name:     "stays after previous record",
+			t:        stored,
+			prev:     stored.UnixMicro() + 5,
+			wantTime: stored.UTC(),
+			wantSeq:  stored.UnixMicro() + 6,
+		},
+		{
+			name:    "missing timestamp",
+			prev:    7,
+			wantSeq: 8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotTime, gotSeq := Migrate(tt.t, tt.prev)
+			if gotTime != tt.wantTime {
+				t.Errorf("Migrate() time = %v, want %v", gotTime, tt.wantTime)
+			}
+			if gotSeq != tt.wantSeq {
+				t.Errorf("Migrate() seq = %d, want %d", gotSeq, tt.wantSeq)
+			}
+		})
+	}
+}
+
+func TestNormalize_RoundTripsJSON(t *testing.T) {
+	want := Normalize(time.Now())
+
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var got time.Time
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("round trip = %v, want %v (JSON %s)", got, want, data)
+	}
+}
@@ -0,0 +1,143 @@
+// Package tools maps the functions the agent can call to server actions.
+//
+// The agent's update_generation call sets the prompt and settings of a reply
+// and is handled by the chat loop itself. Other tools, such as starring or
+// describing an image, are registered here with their definition and a
+// handler. Their definitions are sent to the LLM along with
+// update_generation, and calls to them are run after the reply is saved.
+// A handler's result is a short note shown to the user.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+var (
+	// ErrUnknownTool is returned when a call names a tool that is not registered
+	ErrUnknownTool = errors.New("unknown tool")
+	// ErrInvalidArguments is returned when a call's arguments don't fit its tool
+	ErrInvalidArguments = errors.New("invalid tool arguments")
+)
+
+// Call is a tool call made by the agent in a reply.
+type Call struct {
+	Name      string
+	SessionID string
+	ChatID    string
+	MessageID int // the assistant message that made the call
+
+	// Arguments as sent by the LLM: a JSON object, or a string holding one
+	Arguments json.RawMessage
+}
+
+// Decode unmarshals the call's arguments into v. Missing arguments decode
+// as an empty object. Returns ErrInvalidArguments if they don't fit v.
+func (c Call) Decode(v any) error {
+	args := c.Arguments
+	// Ollama may send the arguments as a JSON-encoded string
+	var encoded string
+	if err := json.Unmarshal(args, &encoded); err == nil {
+		args = json.RawMessage(encoded)
+	}
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("%w for %s: %v", ErrInvalidArguments, c.Name, err)
+	}
+	return nil
+}
+
+// Handler is implemented by anything that carries out a tool call.
+// The returned text tells the user what was done.
+type Handler interface {
+	Run(ctx context.Context, call Call) (string, error)
+}
+
+// HandlerFunc adapts an ordinary function to the Handler interface.
+type HandlerFunc func(ctx context.Context, call Call) (string, error)
+
+// Run calls f(ctx, call).
+func (f HandlerFunc) Run(ctx context.Context, call Call) (string, error) {
+	return f(ctx, call)
+}
+
+// Registry holds the tools the agent can call, by name.
+// It is safe for concurrent use.
+type Registry struct {
+	mu       sync.RWMutex
+	defs     []ollama.Tool
+	handlers map[string]Handler
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Register adds a tool. Registering a name again replaces the tool,
+// keeping its place in Tools.
+func (r *Registry) Register(def ollama.Tool, handler Handler) {
+	if handler == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := def.Function.Name
+	if _, ok := r.handlers[name]; ok {
+		for i := range r.defs {
+			if r.defs[i].Function.Name == name {
+				r.defs[i] = def
+			}
+		}
+	} else {
+		r.defs = append(r.defs, def)
+	}
+	r.handlers[name] = handler
+}
+
+// Tools returns the definitions of the registered tools, in the order they
+// were registered. A nil registry has no tools.
+func (r *Registry) Tools() []ollama.Tool {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]ollama.Tool(nil), r.defs...)
+}
+
+// Has reports whether a tool is registered under name.
+func (r *Registry) Has(name string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.handlers[name]
+	return ok
+}
+
+// Run carries out a call with the handler of its tool.
+// Returns ErrUnknownTool if no tool is registered under call.Name.
+func (r *Registry) Run(ctx context.Context, call Call) (string, error) {
+	var handler Handler
+	if r != nil {
+		r.mu.RLock()
+		handler = r.handlers[call.Name]
+		r.mu.RUnlock()
+	}
+	if handler == nil {
+		return "", fmt.Errorf("%w: %q", ErrUnknownTool, call.Name)
+	}
+	return handler.Run(ctx, call)
+}
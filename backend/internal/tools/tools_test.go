@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+func tool(name string) ollama.Tool {
+	return ollama.Tool{Type: "function", Function: ollama.ToolFunction{Name: name}}
+}
+
+func reply(text string) Handler {
+	return HandlerFunc(func(ctx context.Context, call Call) (string, error) {
+		return text, nil
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Register(tool("describe_image"), reply("first"))
+	r.Register(tool("favorite_image"), reply("starred"))
+	r.Register(tool("describe_image"), reply("second"))
+	r.Register(tool("ignored"), nil)
+
+	defs := r.Tools()
+	if len(defs) != 2 || defs[0].Function.Name != "describe_image" || defs[1].Function.Name != "favorite_image" {
+		t.Fatalf("Tools() = %+v, want describe_image then favorite_image", defs)
+	}
+	if !r.Has("favorite_image") || r.Has("ignored") {
+		t.Errorf("Has() = %v, %v, want true, false", r.Has("favorite_image"), r.Has("ignored"))
+	}
+
+	got, err := r.Run(context.Background(), Call{Name: "describe_image"})
+	if err != nil || got != "second" {
+		t.Errorf("Run() = %q, %v, want the replacing handler", got, err)
+	}
+	if _, err := r.Run(context.Background(), Call{Name: "upscale"}); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("Run() error = %v, want ErrUnknownTool", err)
+	}
+}
+
+func TestRegistry_Nil(t *testing.T) {
+	var r *Registry
+	if len(r.Tools()) != 0 || r.Has("describe_image") {
+		t.Error("nil registry has tools")
+	}
+	if _, err := r.Run(context.Background(), Call{Name: "describe_image"}); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("Run() error = %v, want ErrUnknownTool", err)
+	}
+}
+
+func TestCallDecode(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments string
+		want      int
+		wantErr   bool
+	}{
+		{"object", `{"message_id":3}`, 3, false},
+		{"encoded string", `"{\"message_id\":4}"`, 4, false},
+		{"missing", ``, 0, false},
+		{"null", `null`, 0, false},
+		{"wrong type", `{"message_id":"three"}`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args struct {
+				MessageID int `json:"message_id"`
+			}
+			err := Call{Name: "describe_image", Arguments: json.RawMessage(tt.arguments)}.Decode(&args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrInvalidArguments) {
+				t.Errorf("Decode() error = %v, want ErrInvalidArguments", err)
+			}
+			if args.MessageID != tt.want {
+				t.Errorf("message_id = %d, want %d", args.MessageID, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/requestid"
+)
+
+// captureLog redirects the standard logger to a buffer for the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prevOutput, prevFlags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(prevOutput)
+		log.SetFlags(prevFlags)
+	})
+	return &buf
+}
+
+func TestLogRequests(t *testing.T) {
+	buf := captureLog(t)
+
+	var seen string
+	handler := logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestid.FromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/a%20path", nil)
+	req.Header.Set(requestid.Header, "client-chosen")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	id := w.Header().Get(requestid.Header)
+	if !regexp.MustCompile(`^[0-9a-f]{14}$`).MatchString(id) {
+		t.Fatalf("%s = %q, want a generated ID", requestid.Header, id)
+	}
+	if seen != id {
+		t.Errorf("request context ID = %q, want %q", seen, id)
+	}
+
+	line := strings.TrimSpace(buf.String())
+	for _, want := range []string{
+		"access request_id=" + id,
+		"method=POST",
+		`path="/a path"`,
+		"status=418",
+		"bytes=15",
+		"duration_ms=",
+		"remote=192.0.2.1:1234",
+	} {
+		if !strings.Contains(line, want) {
+			t.Errorf("access log %q missing %q", line, want)
+		}
+	}
+}
+
+func TestLogRequests_UniqueIDs(t *testing.T) {
+	captureLog(t)
+	s := newGalleryTestServer(t, nil)
+
+	first := serveAs(s, http.MethodGet, "/gallery", "").Header().Get(requestid.Header)
+	second := serveAs(s, http.MethodGet, "/gallery", "").Header().Get(requestid.Header)
+	if first == "" || first == second {
+		t.Errorf("request IDs = %q, %q, want distinct IDs", first, second)
+	}
+}
@@ -0,0 +1,218 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hurricanerix/weave/internal/image"
+)
+
+// adjustResponse is the response for POST /images/{id}/adjust and
+// POST /images/{id}/upscale.
+type adjustResponse struct {
+	Status string `json:"status"`
+	// ID is the in-memory image, omitted for an upscale saved as an
+	// alternate of MessageID
+	ID         string           `json:"id,omitempty"`
+	URL        string           `json:"url"`
+	Width      int              `json:"width"`
+	Height     int              `json:"height"`
+	MessageID  int              `json:"message_id,omitempty"`
+	Alternate  int              `json:"alternate,omitempty"`
+	Derivation image.Derivation `json:"derivation"`
+}
+
+// histogramResponse is the response for GET /images/{id}/histogram.
+type histogramResponse struct {
+	image.Histogram
+	Status string `json:"status"`
+}
+
+// handleAdjustImage applies brightness, contrast, saturation and crop to an
+// image and stores the result as a new in-memory image.
+// POST /images/{id}/adjust
+// Form fields: brightness, contrast, saturation (-1 to 1, default 0),
+// crop_x, crop_y, crop_width, crop_height (pixels, optional).
+//
+// {id} is either an in-memory image ID or a message ID in the caller's
+// session, as for GET /images/compare. The source is never modified. The
+// derived image records its source, the adjustments, and the source's
+// generation parameters.
+func (s *Server) handleAdjustImage(w http.ResponseWriter, r *http.Request) {
+	ref := strings.TrimSuffix(r.PathValue("id"), ".png")
+	sessionID := GetSessionID(r.Context())
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	adj, err := parseAdjustments(r)
+	if err == nil {
+		err = adj.Validate()
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pngData, status := s.loadImageRef(sessionID, ref)
+	if status != http.StatusOK {
+		writeJSONError(w, status, strings.ToLower(http.StatusText(status)))
+		return
+	}
+
+	result, err := image.Adjust(pngData, adj)
+	if err != nil {
+		if errors.Is(err, image.ErrInvalidAdjustment) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("Failed to adjust image %s: %v", ref, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to adjust image")
+		return
+	}
+
+	derivation := image.Derivation{
+		Source:      ref,
+		Adjustments: adj,
+		Generation:  s.sourceGeneration(sessionID, ref),
+	}
+	id, err := s.imageStorage.StoreDerived(sessionID, result.PNG, result.Width, result.Height, derivation)
+	if err != nil {
+		log.Printf("Failed to store adjusted image from %s: %v", ref, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to store image")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	resp := adjustResponse{
+		Status:     "ok",
+		ID:         id,
+		URL:        fmt.Sprintf("/images/%s.png", id),
+		Width:      result.Width,
+		Height:     result.Height,
+		Derivation: derivation,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode adjust response: %v", err)
+	}
+}
+
+// handleImageHistogram returns per-channel histograms of an image.
+// GET /images/{id}/histogram
+//
+// {id} is resolved as for POST /images/{id}/adjust.
+func (s *Server) handleImageHistogram(w http.ResponseWriter, r *http.Request) {
+	ref := strings.TrimSuffix(r.PathValue("id"), ".png")
+
+	pngData, status := s.loadImageRef(GetSessionID(r.Context()), ref)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	hist, err := image.ComputeHistogram(pngData)
+	if err != nil {
+		log.Printf("Failed to compute histogram for %s: %v", ref, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(histogramResponse{Histogram: hist, Status: "ok"}); err != nil {
+		log.Printf("Failed to encode histogram response: %v", err)
+	}
+}
+
+// sourceGeneration returns the generation parameters behind an image
+// reference. Message images use their snapshot; derived in-memory images
+// inherit from their own source. Returns nil if unknown.
+func (s *Server) sourceGeneration(sessionID, ref string) *image.Generation {
+	if messageID, err := strconv.Atoi(ref); err == nil {
+		manager := s.sessionManager.GetSession(sessionID).ManagerForMessage(messageID)
+		if manager == nil {
+			return nil
+		}
+		msg := manager.GetMessage(messageID)
+		if msg == nil || msg.Snapshot == nil {
+			return nil
+		}
+		return &image.Generation{
+			Prompt: msg.Snapshot.Prompt,
+			Steps:  msg.Snapshot.Steps,
+			CFG:    msg.Snapshot.CFG,
+			Seed:   msg.Snapshot.Seed,
+		}
+	}
+
+	if derivation, ok := s.imageStorage.GetDerivation(ref); ok {
+		return derivation.Generation
+	}
+	return nil
+}
+
+// parseAdjustments reads adjustment form fields. Missing fields are zero.
+// Crop is set when crop_width or crop_height is present.
+func parseAdjustments(r *http.Request) (image.Adjustments, error) {
+	var adj image.Adjustments
+
+	floats := []struct {
+		name string
+		dst  *float64
+	}{
+		{"brightness", &adj.Brightness},
+		{"contrast", &adj.Contrast},
+		{"saturation", &adj.Saturation},
+	}
+	for _, f := range floats {
+		v := r.FormValue(f.name)
+		if v == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return image.Adjustments{}, fmt.Errorf("%s must be a number", f.name)
+		}
+		*f.dst = parsed
+	}
+
+	if r.FormValue("crop_width") == "" && r.FormValue("crop_height") == "" {
+		return adj, nil
+	}
+
+	crop := &image.CropRect{}
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"crop_x", &crop.X},
+		{"crop_y", &crop.Y},
+		{"crop_width", &crop.Width},
+		{"crop_height", &crop.Height},
+	}
+	for _, f := range ints {
+		v := r.FormValue(f.name)
+		if v == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			return image.Adjustments{}, fmt.Errorf("%s must be an integer", f.name)
+		}
+		*f.dst = parsed
+	}
+	adj.Crop = crop
+
+	return adj, nil
+}
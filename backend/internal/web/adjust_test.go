@@ -0,0 +1,175 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/image"
+)
+
+func doAdjust(t *testing.T, s *Server, ref, sessionID string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/images/"+ref+"/adjust", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", ref)
+	if sessionID != "" {
+		req = req.WithContext(setSessionID(req.Context(), sessionID))
+	}
+	w := httptest.NewRecorder()
+	s.handleAdjustImage(w, req)
+	return w
+}
+
+func TestHandleAdjustImage(t *testing.T) {
+	s, memoryID := newCompareTestServer(t)
+
+	tests := []struct {
+		name       string
+		ref        string
+		sessionID  string
+		form       url.Values
+		wantStatus int
+		wantWidth  int
+	}{
+		{
+			name:       "adjust in-memory image",
+			ref:        memoryID + ".png",
+			form:       url.Values{"brightness": {"0.5"}},
+			wantStatus: http.StatusCreated,
+			wantWidth:  2,
+		},
+		{
+			name:       "crop session image",
+			ref:        "1",
+			sessionID:  testCompareSessionID,
+			form:       url.Values{"crop_x": {"1"}, "crop_width": {"1"}, "crop_height": {"1"}},
+			wantStatus: http.StatusCreated,
+			wantWidth:  1,
+		},
+		{
+			name:       "out of range value",
+			ref:        memoryID,
+			form:       url.Values{"contrast": {"3"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "non-numeric value",
+			ref:        memoryID,
+			form:       url.Values{"saturation": {"lots"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "crop outside image",
+			ref:        memoryID,
+			form:       url.Values{"crop_width": {"5"}, "crop_height": {"1"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "session image requires session",
+			ref:        "1",
+			form:       url.Values{},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown image",
+			ref:        "00000000-0000-0000-0000-000000000000",
+			form:       url.Values{},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doAdjust(t, s, tt.ref, tt.sessionID, tt.form)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status code = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var resp adjustResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Width != tt.wantWidth {
+				t.Errorf("width = %d, want %d", resp.Width, tt.wantWidth)
+			}
+			if resp.Derivation.Source != strings.TrimSuffix(tt.ref, ".png") {
+				t.Errorf("derivation source = %q, want %q", resp.Derivation.Source, tt.ref)
+			}
+			if _, _, _, err := s.imageStorage.Get(resp.ID); err != nil {
+				t.Errorf("derived image not stored: %v", err)
+			}
+		})
+	}
+}
+
+func TestHandleAdjustImage_CarriesGeneration(t *testing.T) {
+	s, msgID := newExportTestServer(t)
+	pngData, err := image.EncodePNG(1, 1, []byte{128, 128, 128}, image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	if err := s.imageStore.Save(testExportSessionID, msgID, pngData); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	w := doAdjust(t, s, strconv.Itoa(msgID), testExportSessionID, url.Values{"contrast": {"0.2"}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status code = %d, want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	var first adjustResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &first); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	gen := first.Derivation.Generation
+	if gen == nil || gen.Prompt != "a fluffy cat" {
+		t.Fatalf("generation = %+v, want the message snapshot", gen)
+	}
+
+	// Adjusting a derived image keeps the original generation parameters
+	w = doAdjust(t, s, first.ID, testExportSessionID, url.Values{"saturation": {"-1"}})
+	var second adjustResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &second); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if second.Derivation.Source != first.ID || second.Derivation.Generation == nil || second.Derivation.Generation.Prompt != "a fluffy cat" {
+		t.Errorf("chained derivation = %+v, want source %s with original generation", second.Derivation, first.ID)
+	}
+
+	// The source image is untouched
+	stored, err := s.imageStore.Load(testExportSessionID, msgID)
+	if err != nil || string(stored) != string(pngData) {
+		t.Errorf("source image changed after adjust: %v", err)
+	}
+}
+
+func TestHandleImageHistogram(t *testing.T) {
+	s, memoryID := newCompareTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/images/"+memoryID+"/histogram", nil)
+	req.SetPathValue("id", memoryID)
+	w := httptest.NewRecorder()
+	s.handleImageHistogram(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", w.Code, http.StatusOK)
+	}
+	var resp struct {
+		Red  []int `json:"red"`
+		Luma []int `json:"luma"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Red) != 256 || resp.Red[0] != 2 || resp.Luma[0] != 2 {
+		t.Errorf("histogram red[0] = %d, luma[0] = %d, want 2 black pixels", resp.Red[0], resp.Luma[0])
+	}
+}
@@ -0,0 +1,338 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
+	"github.com/hurricanerix/weave/internal/tools"
+)
+
+// errNoToolImage is returned when a tool call refers to no stored image.
+var errNoToolImage = errors.New("no image to act on")
+
+// stylePresets are the looks set_style_preset can give the prompt, by name.
+// Each adds its words to the end of the prompt.
+var stylePresets = map[string]string{
+	"photo":        "photorealistic, natural lighting, 35mm photograph",
+	"anime":        "anime style, cel shading, vibrant colors",
+	"watercolor":   "watercolor painting, soft washes, paper texture",
+	"oil-painting": "oil painting, visible brush strokes, rich colors",
+	"pixel-art":    "pixel art, 16-bit, limited palette",
+	"line-art":     "black and white line art, clean ink lines",
+}
+
+// stylePresetNames returns the names of the style presets, sorted.
+func stylePresetNames() []string {
+	names := make([]string, 0, len(stylePresets))
+	for name := range stylePresets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// imageArgs are the arguments of tools acting on an image. Without a
+// message ID they act on the chat's latest image.
+type imageArgs struct {
+	MessageID int `json:"message_id"`
+}
+
+// imageIDParameter is the JSON schema of imageArgs.MessageID.
+var imageIDParameter = map[string]interface{}{
+	"type":        "integer",
+	"description": "Message ID of the image. Omit for the latest image in the chat.",
+}
+
+// newAgentTools creates the registry of tools the agent can call besides
+// update_generation.
+func (s *Server) newAgentTools() *tools.Registry {
+	r := tools.NewRegistry()
+	r.Register(ollama.Tool{
+		Type: "function",
+		Function: ollama.ToolFunction{
+			Name:        "set_style_preset",
+			Description: "Give the current prompt a ready-made visual style. Use it when the user asks for one of the listed looks.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"preset": map[string]interface{}{
+						"type":        "string",
+						"description": "Style to apply",
+						"enum":        stylePresetNames(),
+					},
+				},
+				"required": []string{"preset"},
+			},
+		},
+	}, tools.HandlerFunc(s.runSetStylePreset))
+	r.Register(ollama.Tool{
+		Type: "function",
+		Function: ollama.ToolFunction{
+			Name:        "favorite_image",
+			Description: "Star an image so the user can find it among their favorites. Use it when the user says they like or want to keep an image.",
+			Parameters: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"message_id": imageIDParameter},
+			},
+		},
+	}, tools.HandlerFunc(s.runFavoriteImage))
+	r.Register(ollama.Tool{
+		Type: "function",
+		Function: ollama.ToolFunction{
+			Name:        "tag_image",
+			Description: "Replace the tags of an image, so the user can search for it later.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"message_id": imageIDParameter,
+					"tags": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Short lowercase tags, such as \"pets\" or \"sunset\"",
+					},
+				},
+				"required": []string{"tags"},
+			},
+		},
+	}, tools.HandlerFunc(s.runTagImage))
+	r.Register(ollama.Tool{
+		Type: "function",
+		Function: ollama.ToolFunction{
+			Name:        "describe_image",
+			Description: "Show the prompt and settings an image was generated with. Use it when the user asks how an image was made.",
+			Parameters: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"message_id": imageIDParameter},
+			},
+		},
+	}, tools.HandlerFunc(s.runDescribeImage))
+	r.Register(ollama.Tool{
+		Type: "function",
+		Function: ollama.ToolFunction{
+			Name:        "upscale_image",
+			Description: "Enlarge an image without regenerating it, keeping its look. Use it when the user wants a bigger or higher resolution version of an image.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"message_id": imageIDParameter,
+					"size": map[string]interface{}{
+						"type":        "integer",
+						"description": "Long edge of the result in pixels. Omit for the largest allowed: four times the image, up to 2048.",
+					},
+				},
+			},
+		},
+	}, tools.HandlerFunc(s.runUpscaleImage))
+	return r
+}
+
+// isUpdateGenerationCall reports whether tc calls update_generation.
+func isUpdateGenerationCall(tc ollama.ToolCall) bool {
+	return tc.Function.Name == ollama.UpdateGenerationToolName
+}
+
+// runAgentTools carries out the calls of a saved reply to tools other than
+// update_generation, in order, and streams each result to the chat as a
+// note after the reply.
+func (s *Server) runAgentTools(ctx context.Context, sessionID, chatID string, messageID int, toolCalls []ollama.ToolCall) {
+	for _, tc := range toolCalls {
+		if isUpdateGenerationCall(tc) {
+			continue
+		}
+		name := tc.Function.Name
+		if !s.agentTools.Has(name) {
+			log.Printf("Ignoring call to unknown tool %q for session %s", name, sessionID)
+			continue
+		}
+
+		note, err := s.agentTools.Run(ctx, tools.Call{
+			Name:      name,
+			SessionID: sessionID,
+			ChatID:    chatID,
+			MessageID: messageID,
+			Arguments: tc.Function.Arguments,
+		})
+		if err != nil {
+			log.Printf("Tool %s failed for session %s: %v", name, sessionID, err)
+			note = fmt.Sprintf("%s failed: %s", name, toolErrorMessage(err))
+		}
+		_ = s.sendChatEvent(sessionID, chatID, EventAgentToken, map[string]string{
+			"token": "\n\n[" + note + "]",
+		})
+	}
+}
+
+// toolErrorMessage returns the text shown to the user for a failed tool
+// call. Unexpected errors are only logged.
+func toolErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, errNoToolImage):
+		return errNoToolImage.Error()
+	case errors.Is(err, tools.ErrInvalidArguments):
+		return "invalid arguments"
+	case errors.Is(err, persistence.ErrInvalidTag):
+		return "invalid tag"
+	case errors.Is(err, persistence.ErrTooManyTags):
+		return "too many tags"
+	case errors.Is(err, errInvalidUpscaleSize):
+		return err.Error()
+	case errors.Is(err, errUpscalerUnavailable), errors.Is(err, client.ErrComputeNotRunning):
+		return errUpscalerUnavailable.Error()
+	default:
+		return "internal error"
+	}
+}
+
+// toolManager returns the manager of the chat a tool call was made in.
+func (s *Server) toolManager(call tools.Call) *conversation.Manager {
+	return s.sessionManager.GetSession(call.SessionID).ManagerForMessage(call.MessageID)
+}
+
+// toolImage returns the message ID of the stored image a tool call acts
+// on: the one given, or the latest in the call's chat.
+func (s *Server) toolImage(call tools.Call, messageID int) (int, error) {
+	if messageID > 0 {
+		if !s.imageStore.Exists(call.SessionID, messageID) {
+			return 0, fmt.Errorf("%w: message %d", errNoToolImage, messageID)
+		}
+		return messageID, nil
+	}
+
+	if manager := s.toolManager(call); manager != nil {
+		messages := manager.GetMessages()
+		for i := len(messages) - 1; i >= 0; i-- {
+			if s.imageStore.Exists(call.SessionID, messages[i].ID) {
+				return messages[i].ID, nil
+			}
+		}
+	}
+	return 0, errNoToolImage
+}
+
+// runSetStylePreset adds a style preset's words to the current prompt.
+func (s *Server) runSetStylePreset(ctx context.Context, call tools.Call) (string, error) {
+	var args struct {
+		Preset string `json:"preset"`
+	}
+	if err := call.Decode(&args); err != nil {
+		return "", err
+	}
+	preset := strings.ToLower(strings.TrimSpace(args.Preset))
+	words, ok := stylePresets[preset]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown style preset %q", tools.ErrInvalidArguments, args.Preset)
+	}
+
+	manager := s.toolManager(call)
+	if manager == nil {
+		return "", errors.New("chat not found")
+	}
+	prompt := manager.GetCurrentPrompt()
+	if !strings.HasSuffix(prompt, words) {
+		if prompt != "" {
+			prompt += ", "
+		}
+		prompt += words
+		manager.UpdatePrompt(prompt)
+		_ = s.sendChatEvent(call.SessionID, call.ChatID, EventPromptUpdate, map[string]string{
+			"prompt": prompt,
+		})
+	}
+	return fmt.Sprintf("Style set to %s", preset), nil
+}
+
+// runFavoriteImage stars an image.
+func (s *Server) runFavoriteImage(ctx context.Context, call tools.Call) (string, error) {
+	var args imageArgs
+	if err := call.Decode(&args); err != nil {
+		return "", err
+	}
+	id, err := s.toolImage(call, args.MessageID)
+	if err != nil {
+		return "", err
+	}
+	if err := s.favoriteStore.Add(call.SessionID, id); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Added image %d to favorites", id), nil
+}
+
+// runTagImage replaces the tags of an image.
+func (s *Server) runTagImage(ctx context.Context, call tools.Call) (string, error) {
+	var args struct {
+		imageArgs
+		Tags []string `json:"tags"`
+	}
+	if err := call.Decode(&args); err != nil {
+		return "", err
+	}
+	id, err := s.toolImage(call, args.MessageID)
+	if err != nil {
+		return "", err
+	}
+	tags, err := s.tagIndex.SetTags(call.SessionID, id, args.Tags)
+	if err != nil {
+		return "", err
+	}
+	if len(tags) == 0 {
+		return fmt.Sprintf("Removed the tags of image %d", id), nil
+	}
+	return fmt.Sprintf("Tagged image %d: %s", id, strings.Join(tags, ", ")), nil
+}
+
+// runDescribeImage describes the prompt and settings of an image.
+func (s *Server) runDescribeImage(ctx context.Context, call tools.Call) (string, error) {
+	var args imageArgs
+	if err := call.Decode(&args); err != nil {
+		return "", err
+	}
+	id, err := s.toolImage(call, args.MessageID)
+	if err != nil {
+		return "", err
+	}
+
+	manager := s.sessionManager.GetSession(call.SessionID).ManagerForMessage(id)
+	if manager == nil {
+		return "", fmt.Errorf("%w: message %d", errNoToolImage, id)
+	}
+	msg := manager.GetMessage(id)
+	if msg == nil || msg.Snapshot == nil {
+		return fmt.Sprintf("Image %d has no recorded prompt", id), nil
+	}
+	return fmt.Sprintf("Image %d: %q, %d steps, CFG %.1f, seed %d",
+		id, msg.Snapshot.Prompt, msg.Snapshot.Steps, msg.Snapshot.CFG, msg.Snapshot.Seed), nil
+}
+
+// runUpscaleImage enlarges an image and links to the result.
+func (s *Server) runUpscaleImage(ctx context.Context, call tools.Call) (string, error) {
+	var args struct {
+		imageArgs
+		Size int `json:"size"`
+	}
+	if err := call.Decode(&args); err != nil {
+		return "", err
+	}
+	id, err := s.toolImage(call, args.MessageID)
+	if err != nil {
+		return "", err
+	}
+	pngData, err := s.imageStore.Load(call.SessionID, id)
+	if err != nil {
+		return "", err
+	}
+
+	upscaled, err := s.upscaleImage(ctx, call.SessionID, strconv.Itoa(id), pngData, args.Size)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Upscaled image %d to %dx%d: %s", id, upscaled.Width, upscaled.Height, upscaled.URL), nil
+}
@@ -0,0 +1,132 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// toolCallResult is a reply calling one tool with args.
+func toolCallResult(name, args string) ollama.ChatResult {
+	return ollama.ChatResult{
+		Response:  "Sure.",
+		ToolCalls: []ollama.ToolCall{{Function: ollama.ToolCallFunction{Name: name, Arguments: json.RawMessage(args)}}},
+	}
+}
+
+func TestRunChatTurn_AgentTools(t *testing.T) {
+	tests := []struct {
+		name     string
+		tool     string
+		args     string
+		wantNote string
+		check    func(t *testing.T, s *Server)
+	}{
+		{
+			name:     "favorite latest image",
+			tool:     "favorite_image",
+			args:     `{}`,
+			wantNote: "[Added image 1 to favorites]",
+			check: func(t *testing.T, s *Server) {
+				if ok, err := s.favoriteStore.IsFavorite(testGallerySessionID, 1); err != nil || !ok {
+					t.Errorf("IsFavorite() = %v, %v, want true", ok, err)
+				}
+			},
+		},
+		{
+			name:     "tag image",
+			tool:     "tag_image",
+			args:     `"{\"message_id\":1,\"tags\":[\"Sunset\",\"sky\"]}"`,
+			wantNote: "[Tagged image 1: sky, sunset]",
+			check: func(t *testing.T, s *Server) {
+				if tags, err := s.tagIndex.Tags(testGallerySessionID, 1); err != nil || len(tags) != 2 {
+					t.Errorf("Tags() = %v, %v, want 2 tags", tags, err)
+				}
+			},
+		},
+		{
+			name:     "describe image",
+			tool:     "describe_image",
+			args:     `{"message_id":1}`,
+			wantNote: `[Image 1: "a sunset"`,
+		},
+		{
+			name:     "style preset",
+			tool:     "set_style_preset",
+			args:     `{"preset":"watercolor"}`,
+			wantNote: "[Style set to watercolor]",
+			check: func(t *testing.T, s *Server) {
+				prompt := s.sessionManager.GetSession(testGallerySessionID).Manager().GetCurrentPrompt()
+				if want := "a sunset, " + stylePresets["watercolor"]; prompt != want {
+					t.Errorf("prompt = %q, want %q", prompt, want)
+				}
+			},
+		},
+		{
+			name:     "unknown preset",
+			tool:     "set_style_preset",
+			args:     `{"preset":"cubism"}`,
+			wantNote: "[set_style_preset failed: invalid arguments]",
+		},
+		{
+			name:     "missing image",
+			tool:     "describe_image",
+			args:     `{"message_id":99}`,
+			wantNote: "[describe_image failed: no image to act on]",
+		},
+		{
+			name: "unknown tool",
+			tool: "upscale_last_image",
+			args: `{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, nil)
+			s.setLLMClientForTesting(&mockOllamaClient{responses: []mockResponse{{result: toolCallResult(tt.tool, tt.args)}}})
+			events := recordEvents(s, testGallerySessionID)
+
+			session := s.sessionManager.GetSession(testGallerySessionID)
+			s.runChatTurn(context.Background(), session, testGallerySessionID, "", session.Manager(), "do it", 20, 3.5, -1)
+
+			body := events.Body.String()
+			if tt.wantNote == "" {
+				if strings.Contains(body, "[") {
+					t.Errorf("events = %q, want no tool note", body)
+				}
+			} else if !strings.Contains(body, jsonString(t, tt.wantNote)) {
+				t.Errorf("events = %q, want note %q", body, tt.wantNote)
+			}
+			if strings.Index(body, "event: "+EventAgentDone) < strings.LastIndex(body, "event: "+EventAgentToken) {
+				t.Error("tool note sent after agent-done")
+			}
+			if tt.check != nil {
+				tt.check(t, s)
+			}
+		})
+	}
+}
+
+// jsonString returns s as it appears inside a JSON string.
+func jsonString(t *testing.T, s string) string {
+	t.Helper()
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	return strings.Trim(string(data), `"`)
+}
+
+func TestBuildSystemPrompt_ListsAgentTools(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	prompt := s.buildSystemPrompt(s.agentPrompt)
+	for _, def := range s.agentTools.Tools() {
+		if !strings.Contains(prompt, "`"+def.Function.Name+"`") {
+			t.Errorf("system prompt does not mention %s", def.Function.Name)
+		}
+	}
+}
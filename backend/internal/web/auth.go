@@ -0,0 +1,177 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+const (
+	// APITokenCookieName is the cookie holding the API token for browsers,
+	// which can't set an Authorization header on EventSource or htmx requests
+	APITokenCookieName = "weave_api_token"
+
+	// apiTokenParam is the query parameter that sets APITokenCookieName, so
+	// a browser can be signed in by opening http://host:8080/?token=...
+	apiTokenParam = "token"
+)
+
+// apiTokens is the set of accepted API tokens. Tokens are kept as SHA-256
+// hashes so comparisons take the same time regardless of token length.
+type apiTokens struct {
+	hashes [][sha256.Size]byte
+
+	// users[i] is the user signed in by hashes[i], or "" for tokens from
+	// --api-token and --api-tokens-file that don't identify a user
+	users []string
+}
+
+// loadAPITokens returns the tokens from --api-token, --api-tokens-file and
+// --users-file, or nil if authentication is disabled.
+func loadAPITokens(cfg *config.Config) (*apiTokens, error) {
+	t := &apiTokens{}
+	if cfg.APIToken != "" {
+		t.add(cfg.APIToken, "")
+	}
+	if cfg.APITokensFile != "" {
+		fileTokens, err := config.LoadAPITokens(cfg.APITokensFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, token := range fileTokens {
+			t.add(token, "")
+		}
+	}
+	if cfg.UsersFile != "" {
+		users, err := config.LoadUsers(cfg.UsersFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			t.add(user.Token, user.Name)
+		}
+	}
+	if len(t.hashes) == 0 {
+		return nil, nil
+	}
+	return t, nil
+}
+
+// add accepts token, signing in user if it isn't empty.
+func (t *apiTokens) add(token, user string) {
+	t.hashes = append(t.hashes, sha256.Sum256([]byte(token)))
+	t.users = append(t.users, user)
+}
+
+// valid reports whether token is one of the accepted tokens.
+func (t *apiTokens) valid(token string) bool {
+	_, ok := t.lookup(token)
+	return ok
+}
+
+// lookup reports whether token is accepted and returns the user it signs in,
+// or "" if it doesn't identify a user. Every token is compared so the time
+// taken doesn't reveal which one matched.
+func (t *apiTokens) lookup(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	hash := sha256.Sum256([]byte(token))
+	match := 0
+	user := ""
+	for i, h := range t.hashes {
+		eq := subtle.ConstantTimeCompare(hash[:], h[:])
+		match |= eq
+		if eq == 1 {
+			user = t.users[i]
+		}
+	}
+	return user, match == 1
+}
+
+// requireAPIToken rejects mutating requests and GET /events with 401 unless
+// they carry an accepted API token, either as "Authorization: Bearer" or in
+// the APITokenCookieName cookie. Read-only requests pass through. When no
+// tokens are configured every request passes through.
+//
+// A GET request with ?token= sets the cookie and redirects to the same URL
+// without the token, so it doesn't stay in the address bar or history.
+func (s *Server) requireAPIToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens := s.apiTokens.Load()
+		if tokens == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method == http.MethodGet && r.URL.Query().Has(apiTokenParam) {
+			signIn(w, r, tokens)
+			return
+		}
+
+		if !requiresAPIToken(r) || tokens.valid(requestAPIToken(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="weave"`)
+		http.Error(w, "API token required", http.StatusUnauthorized)
+	})
+}
+
+// signIn handles a GET request with ?token=. A valid token is stored in the
+// APITokenCookieName cookie.
+func signIn(w http.ResponseWriter, r *http.Request, tokens *apiTokens) {
+	query := r.URL.Query()
+	token := query.Get(apiTokenParam)
+	if !tokens.valid(token) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="weave"`)
+		http.Error(w, "Invalid API token", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Secure flag requires HTTPS in production
+	http.SetCookie(w, &http.Cookie{
+		Name:     APITokenCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(SessionExpiry.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Secure:   true,
+	})
+
+	query.Del(apiTokenParam)
+	target := *r.URL
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.RequestURI(), http.StatusSeeOther)
+}
+
+// requiresAPIToken reports whether r changes state or opens the SSE stream.
+func requiresAPIToken(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return r.URL.Path == "/events" || r.URL.Path == "/mcp/sse"
+	default:
+		return true
+	}
+}
+
+// requestAPIToken returns the token from the Authorization header, or from
+// the APITokenCookieName cookie if there is no header.
+func requestAPIToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return ""
+		}
+		return strings.TrimSpace(token)
+	}
+	if cookie, err := r.Cookie(APITokenCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
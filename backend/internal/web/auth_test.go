@@ -0,0 +1,197 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+const (
+	testAPIToken      = "0123456789abcdef"
+	testOtherAPIToken = "fedcba9876543210"
+)
+
+// serveWithAuth sends a request through the full handler stack with the
+// gallery test session and the given Authorization header and API token
+// cookie (each omitted if empty).
+func serveWithAuth(s *Server, method, target, authorization, cookie string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+	req.Header.Set(CSRFHeaderName, s.csrfToken(testGallerySessionID))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: APITokenCookieName, Value: cookie})
+	}
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequireAPIToken(t *testing.T) {
+	publishPath := "/sessions/" + testGallerySessionID + "/images/1.png/publish"
+
+	tests := []struct {
+		name          string
+		method        string
+		target        string
+		authorization string
+		cookie        string
+		wantAuthorize bool
+	}{
+		{name: "mutation without token", method: http.MethodPost, target: publishPath},
+		{name: "mutation with bearer token", method: http.MethodPost, target: publishPath, authorization: "Bearer " + testAPIToken, wantAuthorize: true},
+		{name: "mutation with lowercase scheme", method: http.MethodPost, target: publishPath, authorization: "bearer " + testAPIToken, wantAuthorize: true},
+		{name: "mutation with cookie", method: http.MethodPost, target: publishPath, cookie: testAPIToken, wantAuthorize: true},
+		{name: "mutation with wrong token", method: http.MethodPost, target: publishPath, authorization: "Bearer " + testOtherAPIToken},
+		{name: "mutation with basic auth", method: http.MethodPost, target: publishPath, authorization: "Basic " + testAPIToken},
+		{name: "wrong header overrides cookie", method: http.MethodPost, target: publishPath, authorization: "Bearer " + testOtherAPIToken, cookie: testAPIToken},
+		{name: "delete without token", method: http.MethodDelete, target: "/sessions/" + testGallerySessionID + "/images/1.png"},
+		{name: "events without token", method: http.MethodGet, target: "/events"},
+		{name: "read without token", method: http.MethodGet, target: "/gallery", wantAuthorize: true},
+		{name: "health without token", method: http.MethodGet, target: "/ready", wantAuthorize: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, &config.Config{APIToken: testAPIToken})
+
+			w := serveWithAuth(s, tt.method, tt.target, tt.authorization, tt.cookie)
+			if tt.wantAuthorize {
+				if w.Code == http.StatusUnauthorized {
+					t.Fatalf("status = %d, want request to be authorized: %s", w.Code, w.Body.String())
+				}
+				return
+			}
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got == "" {
+				t.Error("WWW-Authenticate header not set")
+			}
+		})
+	}
+}
+
+func TestRequireAPIToken_Disabled(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{})
+
+	w := serveAs(s, http.MethodPost, "/sessions/"+testGallerySessionID+"/images/1.png/publish", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+}
+
+func TestRequireAPIToken_SignIn(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		wantCode     int
+		wantLocation string
+		wantCookie   bool
+	}{
+		{
+			name:         "valid token",
+			target:       "/?token=" + testAPIToken,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/",
+			wantCookie:   true,
+		},
+		{
+			name:         "keeps other parameters",
+			target:       "/gallery?limit=5&token=" + testAPIToken,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/gallery?limit=5",
+			wantCookie:   true,
+		},
+		{
+			name:     "invalid token",
+			target:   "/?token=" + testOtherAPIToken,
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, &config.Config{APIToken: testAPIToken})
+
+			w := serveWithAuth(s, http.MethodGet, tt.target, "", "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+
+			var cookie *http.Cookie
+			for _, c := range w.Result().Cookies() {
+				if c.Name == APITokenCookieName {
+					cookie = c
+				}
+			}
+			if !tt.wantCookie {
+				if cookie != nil {
+					t.Errorf("cookie %s set, want none", APITokenCookieName)
+				}
+				return
+			}
+			if cookie == nil {
+				t.Fatalf("cookie %s not set", APITokenCookieName)
+			}
+			if cookie.Value != testAPIToken || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+				t.Errorf("cookie = %+v, want HttpOnly SameSite=Strict with the token", cookie)
+			}
+		})
+	}
+}
+
+func TestRequireAPIToken_TokensFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(path, []byte("# phone\n"+testOtherAPIToken+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write tokens file: %v", err)
+	}
+	s := newGalleryTestServer(t, &config.Config{APIToken: testAPIToken, APITokensFile: path})
+	publishPath := "/sessions/" + testGallerySessionID + "/images/1.png/publish"
+
+	for _, token := range []string{testAPIToken, testOtherAPIToken} {
+		if w := serveWithAuth(s, http.MethodPost, publishPath, "Bearer "+token, ""); w.Code == http.StatusUnauthorized {
+			t.Errorf("token %q rejected", token)
+		}
+	}
+}
+
+func TestRequireAPIToken_Reconfigure(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{APIToken: testAPIToken})
+	publishPath := "/sessions/" + testGallerySessionID + "/images/1.png/publish"
+
+	if err := s.Reconfigure(nil, nil, &config.Config{APIToken: testOtherAPIToken}); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+	if w := serveWithAuth(s, http.MethodPost, publishPath, "Bearer "+testAPIToken, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("old token: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := serveWithAuth(s, http.MethodPost, publishPath, "Bearer "+testOtherAPIToken, ""); w.Code == http.StatusUnauthorized {
+		t.Error("new token rejected")
+	}
+
+	// A rejected configuration keeps the running tokens
+	missing := filepath.Join(t.TempDir(), "missing")
+	if err := s.Reconfigure(nil, nil, &config.Config{APITokensFile: missing}); err == nil {
+		t.Fatal("Reconfigure() with missing tokens file succeeded")
+	}
+	if w := serveWithAuth(s, http.MethodPost, publishPath, "Bearer "+testOtherAPIToken, ""); w.Code == http.StatusUnauthorized {
+		t.Error("token rejected after failed reconfigure")
+	}
+}
+
+func TestNewServerWithDeps_InvalidTokensFile(t *testing.T) {
+	cfg := &config.Config{APITokensFile: filepath.Join(t.TempDir(), "missing")}
+	if _, err := NewServerWithDeps("", nil, nil, nil, nil, nil, cfg); err == nil {
+		t.Error("NewServerWithDeps() succeeded with a missing tokens file")
+	}
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// errComputeUnsupported indicates the connected compute process can't carry
+// out a request, as reported in its capabilities.
+var errComputeUnsupported = errors.New("not supported by the compute process")
+
+// requestDescriptions describe the compute requests a user can trigger, for
+// errors about compute not accepting them.
+var requestDescriptions = map[uint16]string{
+	protocol.MsgGenerateRequest: "Image generation",
+	protocol.MsgImg2ImgRequest:  "Generating from an image",
+	protocol.MsgInpaintRequest:  "Inpainting",
+	protocol.MsgUpscaleRequest:  "Upscaling",
+	protocol.MsgControlRequest:  "Generating from a control image",
+}
+
+// SetComputeCapabilities records what the connected compute process can do,
+// as reported when it connected, so requests it can't carry out fail before
+// they are sent and the agent is not offered tools it can't use. A nil caps,
+// for a compute process that did not report them, disables the checks. It
+// is safe to call while the server is running, and carries over Reconfigure.
+func (s *Server) SetComputeCapabilities(caps *protocol.Capabilities) {
+	s.computeCaps.Store(caps)
+}
+
+// unsupportedByCompute returns why the compute process can't carry out a
+// request of type msgType for a width x height image, for the user, or ""
+// if it can. Size is not checked if width or height is 0.
+func (s *Server) unsupportedByCompute(msgType uint16, width, height uint32) string {
+	caps := s.computeCaps.Load()
+	if caps == nil {
+		return ""
+	}
+	if !caps.Supports(msgType) {
+		desc, ok := requestDescriptions[msgType]
+		if !ok {
+			desc = fmt.Sprintf("Request type 0x%04X", msgType)
+		}
+		return desc + " is not available with this compute process."
+	}
+	if width > 0 && height > 0 && (width > caps.MaxWidth || height > caps.MaxHeight) {
+		return fmt.Sprintf("%dx%d is larger than this compute process generates (up to %dx%d).",
+			width, height, caps.MaxWidth, caps.MaxHeight)
+	}
+	return ""
+}
+
+// agentToolDefs returns the definitions of the agent tools besides
+// update_generation that the compute process can carry out.
+func (s *Server) agentToolDefs() []ollama.Tool {
+	defs := s.agentTools.Tools()
+	caps := s.computeCaps.Load()
+	if caps == nil || caps.Supports(protocol.MsgUpscaleRequest) {
+		return defs
+	}
+	kept := make([]ollama.Tool, 0, len(defs))
+	for _, def := range defs {
+		if def.Function.Name != "upscale_image" {
+			kept = append(kept, def)
+		}
+	}
+	return kept
+}
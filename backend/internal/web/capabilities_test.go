@@ -0,0 +1,100 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// testCapabilities are those of a compute process that generates from text
+// and images up to 1024x1024 and can't upscale.
+var testCapabilities = &protocol.Capabilities{
+	MinVersion:   protocol.ProtocolVersion1,
+	MaxVersion:   protocol.ProtocolVersion1,
+	RequestTypes: 1<<protocol.MsgGenerateRequest | 1<<protocol.MsgImg2ImgRequest | 1<<protocol.MsgPing,
+	MaxWidth:     1024,
+	MaxHeight:    1024,
+}
+
+func TestUnsupportedByCompute(t *testing.T) {
+	tests := []struct {
+		name    string
+		caps    *protocol.Capabilities
+		msgType uint16
+		width   uint32
+		height  uint32
+		want    string
+	}{
+		{name: "unknown capabilities", msgType: protocol.MsgUpscaleRequest, width: 4096, height: 4096},
+		{name: "supported", caps: testCapabilities, msgType: protocol.MsgGenerateRequest, width: 1024, height: 768},
+		{name: "unsupported type", caps: testCapabilities, msgType: protocol.MsgControlRequest, width: 512, height: 512, want: "Generating from a control image is not available"},
+		{name: "too large", caps: testCapabilities, msgType: protocol.MsgGenerateRequest, width: 1024, height: 1088, want: "1024x1088 is larger"},
+		{name: "size unchecked", caps: testCapabilities, msgType: protocol.MsgImg2ImgRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDiffusionTestServer(t, nil)
+			s.SetComputeCapabilities(tt.caps)
+
+			got := s.unsupportedByCompute(tt.msgType, tt.width, tt.height)
+			if tt.want == "" && got != "" {
+				t.Errorf("unsupportedByCompute() = %q, want supported", got)
+			}
+			if !strings.HasPrefix(got, tt.want) {
+				t.Errorf("unsupportedByCompute() = %q, want prefix %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgentToolDefs_Upscale(t *testing.T) {
+	s := newDiffusionTestServer(t, nil)
+	hasUpscale := func() bool {
+		for _, def := range s.agentToolDefs() {
+			if def.Function.Name == "upscale_image" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !hasUpscale() {
+		t.Error("upscale_image missing with unknown capabilities")
+	}
+	s.SetComputeCapabilities(testCapabilities)
+	if hasUpscale() {
+		t.Error("upscale_image offered to the agent without compute upscaling")
+	}
+	if prompt := s.buildSystemPrompt(""); strings.Contains(prompt, "upscale_image") {
+		t.Error("system prompt lists upscale_image without compute upscaling")
+	}
+}
+
+func TestHandleGenerate_UnsupportedByCompute(t *testing.T) {
+	requests := make(chan []byte, 1)
+	s := newDiffusionTestServer(t, requests)
+	s.sessionManager.GetSession(testGallerySessionID).SetResolution(1024, 1024)
+	s.vaeTiling = true
+	s.SetComputeCapabilities(&protocol.Capabilities{RequestTypes: testCapabilities.RequestTypes, MaxWidth: 768, MaxHeight: 768})
+
+	form := url.Values{"prompt": {"a cat"}}
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(setSessionID(req.Context(), testGallerySessionID))
+	w := httptest.NewRecorder()
+	s.handleGenerate(w, req)
+
+	if w.Code == http.StatusOK {
+		t.Fatalf("status = %d, want an error", w.Code)
+	}
+	select {
+	case <-requests:
+		t.Error("request larger than compute generates was sent")
+	default:
+	}
+}
@@ -0,0 +1,132 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+)
+
+// interruptedMarker ends the saved reply of a chat response that was
+// cancelled, so the user and the agent can tell it was cut short.
+const interruptedMarker = "[interrupted]"
+
+// errChatCancelled is the cause of a chat stream cancelled by
+// POST /chat/cancel.
+var errChatCancelled = errors.New("chat response cancelled")
+
+// chatCancelResponse is the response for POST /chat/cancel.
+type chatCancelResponse struct {
+	Status    string `json:"status"`
+	Cancelled int    `json:"cancelled"`
+}
+
+// chatStreams holds the cancel functions of the chat responses being
+// streamed, by session. Shared with servers created by Reconfigure.
+type chatStreams struct {
+	mu      sync.Mutex
+	streams map[string]map[*chatStream]struct{}
+}
+
+// chatStream is a chat response being streamed from the LLM.
+type chatStream struct {
+	chatID string
+	cancel context.CancelCauseFunc
+}
+
+func newChatStreams() *chatStreams {
+	return &chatStreams{streams: make(map[string]map[*chatStream]struct{})}
+}
+
+// start returns a context for streaming a response in the chat that
+// POST /chat/cancel can cancel, and a function to call when the stream
+// ends.
+func (c *chatStreams) start(ctx context.Context, sessionID, chatID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	stream := &chatStream{chatID: chatID, cancel: cancel}
+
+	c.mu.Lock()
+	if c.streams[sessionID] == nil {
+		c.streams[sessionID] = make(map[*chatStream]struct{})
+	}
+	c.streams[sessionID][stream] = struct{}{}
+	c.mu.Unlock()
+
+	return ctx, func() {
+		c.mu.Lock()
+		delete(c.streams[sessionID], stream)
+		if len(c.streams[sessionID]) == 0 {
+			delete(c.streams, sessionID)
+		}
+		c.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancel cancels the session's responses streaming in the chat, or in
+// every chat if chatID is "". Returns how many were cancelled.
+func (c *chatStreams) cancel(sessionID, chatID string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for stream := range c.streams[sessionID] {
+		if chatID == "" || stream.chatID == chatID {
+			stream.cancel(errChatCancelled)
+			n++
+		}
+	}
+	return n
+}
+
+// handleCancelChat stops the agent's response streaming in the session.
+// The text received so far is saved with an interrupted marker and the
+// UI gets agent-done, as for a finished reply.
+// POST /chat/cancel (form: chat_id, optional; default every chat)
+func (s *Server) handleCancelChat(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	n := s.chatStreams.cancel(sessionID, r.FormValue("chat_id"))
+	if n > 0 {
+		log.Printf("Cancelled %d chat responses for session %s", n, sessionID)
+	}
+	writeChatJSON(w, http.StatusOK, chatCancelResponse{Status: "ok", Cancelled: n})
+}
+
+// finishCancelledChat saves a cancelled chat turn: the user's message and
+// the reply streamed so far, ending in interruptedMarker. The marker is
+// streamed too, so the reply shown matches the one saved.
+func (s *Server) finishCancelledChat(manager *conversation.Manager, sessionID, chatID, message, partial string) {
+	marker := interruptedMarker
+	if partial != "" {
+		marker = "\n\n" + interruptedMarker
+	}
+
+	manager.AddUserMessage(message)
+	messageID := manager.AddAssistantMessage(partial+marker, "", nil)
+	log.Printf("Chat response for session %s cancelled after %d bytes", sessionID, len(partial))
+
+	_ = s.sendChatEvent(sessionID, chatID, EventAgentToken, map[string]string{
+		"token": marker,
+	})
+	_ = s.sendChatEvent(sessionID, chatID, EventAgentDone, AgentDoneData{
+		Done:        true,
+		MessageID:   messageID,
+		Interrupted: true,
+	})
+}
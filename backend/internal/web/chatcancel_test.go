@@ -0,0 +1,140 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+func TestChatStreams_Cancel(t *testing.T) {
+	streams := newChatStreams()
+	ctxA, doneA := streams.start(context.Background(), "session-1", "chat-a")
+	ctxB, doneB := streams.start(context.Background(), "session-1", "chat-b")
+	ctxOther, doneOther := streams.start(context.Background(), "session-2", "chat-a")
+	defer doneB()
+	defer doneOther()
+
+	if n := streams.cancel("session-1", "chat-a"); n != 1 {
+		t.Errorf("cancel(chat-a) = %d, want 1", n)
+	}
+	if !errors.Is(context.Cause(ctxA), errChatCancelled) {
+		t.Errorf("chat-a cause = %v, want %v", context.Cause(ctxA), errChatCancelled)
+	}
+	if ctxB.Err() != nil || ctxOther.Err() != nil {
+		t.Error("cancel(chat-a) cancelled streams in other chats or sessions")
+	}
+
+	doneA()
+	if n := streams.cancel("session-1", ""); n != 1 {
+		t.Errorf("cancel(every chat) = %d, want 1 after chat-a finished", n)
+	}
+	if !errors.Is(context.Cause(ctxB), errChatCancelled) {
+		t.Errorf("chat-b cause = %v, want %v", context.Cause(ctxB), errChatCancelled)
+	}
+	if n := streams.cancel("session-3", ""); n != 0 {
+		t.Errorf("cancel(no streams) = %d, want 0", n)
+	}
+}
+
+func TestChatStreams_DoneDoesNotMarkCancelled(t *testing.T) {
+	streams := newChatStreams()
+	ctx, done := streams.start(context.Background(), "session-1", "")
+	done()
+
+	if ctx.Err() == nil {
+		t.Error("stream context not released when done")
+	}
+	if errors.Is(context.Cause(ctx), errChatCancelled) {
+		t.Error("finished stream reported as cancelled")
+	}
+	if len(streams.streams) != 0 {
+		t.Errorf("streams = %v, want none left", streams.streams)
+	}
+}
+
+// stallingClient streams one token, then waits for the request to be
+// cancelled, like a model that rambles on.
+type stallingClient struct {
+	mockOllamaClient
+	streaming chan struct{}
+}
+
+func (c *stallingClient) Chat(ctx context.Context, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error) {
+	if err := callback(ollama.StreamToken{Content: "Once upon a time"}); err != nil {
+		return ollama.ChatResult{}, err
+	}
+	close(c.streaming)
+	<-ctx.Done()
+	return ollama.ChatResult{}, ctx.Err()
+}
+
+func TestHandleCancelChat(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	client := &stallingClient{streaming: make(chan struct{})}
+	s.setLLMClientForTesting(client)
+	events := recordEvents(s, testGallerySessionID)
+
+	session := s.sessionManager.GetSession(testGallerySessionID)
+	manager := session.Manager()
+	before := len(manager.GetHistory())
+
+	turnDone := make(chan struct{})
+	go func() {
+		defer close(turnDone)
+		s.runChatTurn(context.Background(), session, testGallerySessionID, "", manager, "tell me a story", 20, 3.5, -1)
+	}()
+
+	select {
+	case <-client.streaming:
+	case <-time.After(5 * time.Second):
+		t.Fatal("chat did not start streaming")
+	}
+	w := serveAs(s, http.MethodPost, "/chat/cancel", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp chatCancelResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Cancelled != 1 {
+		t.Errorf("cancelled = %d, want 1", resp.Cancelled)
+	}
+
+	select {
+	case <-turnDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("chat turn did not stop after cancel")
+	}
+
+	history := manager.GetHistory()
+	if len(history) != before+2 {
+		t.Fatalf("history has %d messages, want %d", len(history), before+2)
+	}
+	user, reply := history[len(history)-2], history[len(history)-1]
+	if user.Role != conversation.RoleUser || user.Content != "tell me a story" {
+		t.Errorf("user message = %+v, want the cancelled message", user)
+	}
+	if want := "Once upon a time\n\n" + interruptedMarker; reply.Content != want {
+		t.Errorf("reply = %q, want %q", reply.Content, want)
+	}
+	if !strings.Contains(events.Body.String(), `"interrupted":true`) {
+		t.Errorf("events = %q, want an interrupted agent-done", events.Body.String())
+	}
+
+	// Nothing left to cancel
+	w = serveAs(s, http.MethodPost, "/chat/cancel", testGallerySessionID)
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Cancelled != 0 {
+		t.Errorf("cancelled = %d after the turn ended, want 0", resp.Cancelled)
+	}
+}
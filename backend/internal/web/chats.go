@@ -0,0 +1,283 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+)
+
+// chatResponse describes a chat in API responses.
+type chatResponse struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	CreatedAt    time.Time `json:"created_at"`
+	MessageCount int       `json:"message_count"`
+	Active       bool      `json:"active"`
+}
+
+// chatListResponse is the response for GET /chats.
+type chatListResponse struct {
+	Status       string         `json:"status"`
+	ActiveChatID string         `json:"active_chat_id"`
+	Chats        []chatResponse `json:"chats"`
+	Page         pageInfo       `json:"page"`
+}
+
+// chatMutationResponse is the response for chat create, rename and switch.
+type chatMutationResponse struct {
+	Status string       `json:"status"`
+	Chat   chatResponse `json:"chat"`
+}
+
+// resolveChat returns the chat a request targets: the chat with the given ID
+// if one was provided, otherwise the active chat. The manager is nil if the
+// requested chat does not exist.
+func resolveChat(session *conversation.Session, chatID string) (string, *conversation.Manager) {
+	if chatID == "" {
+		return session.ActiveChat()
+	}
+	return chatID, session.ChatManager(chatID)
+}
+
+// writeChatNotFound writes the JSON error for an unknown chat ID.
+func writeChatNotFound(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprintf(w, `{"status":"error","message":"chat not found"}`)
+}
+
+// sendChatEvent sends an SSE event produced by work in a specific chat.
+// Sessions have a single SSE connection, so events are only delivered while
+// the chat is active; background chats keep their results in history and the
+// UI reloads them when switching back. An empty chatID always delivers.
+func (s *Server) sendChatEvent(sessionID string, chatID string, eventType string, data interface{}) error {
+	if chatID != "" && s.sessionManager.GetSession(sessionID).ActiveChatID() != chatID {
+		return nil
+	}
+	return s.broker.SendEvent(sessionID, eventType, data)
+}
+
+// buildChatResponse describes one chat of a session.
+func buildChatResponse(session *conversation.Session, info conversation.ChatInfo, activeChatID string) chatResponse {
+	resp := chatResponse{
+		ID:        info.ID,
+		Name:      info.Name,
+		CreatedAt: info.CreatedAt,
+		Active:    info.ID == activeChatID,
+	}
+	if manager := session.ChatManager(info.ID); manager != nil {
+		resp.MessageCount = len(manager.GetMessages())
+	}
+	return resp
+}
+
+// writeChatJSON encodes a chat API response.
+func writeChatJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode chat response: %v", err)
+	}
+}
+
+// writeChatError maps conversation chat errors to JSON error responses.
+func writeChatError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	message := "internal error"
+	switch {
+	case errors.Is(err, conversation.ErrChatNotFound):
+		writeChatNotFound(w)
+		return
+	case errors.Is(err, conversation.ErrInvalidChatName):
+		status, message = http.StatusBadRequest, "invalid chat name"
+	case errors.Is(err, conversation.ErrTooManyChats):
+		status, message = http.StatusConflict, "too many chats"
+	case errors.Is(err, conversation.ErrLastChat):
+		status, message = http.StatusConflict, "cannot delete the last chat"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"status":"error","message":"%s"}`, message)
+}
+
+// notifyChatSwitched tells the UI that the active chat changed.
+func (s *Server) notifyChatSwitched(sessionID string, chat chatResponse) {
+	_ = s.broker.SendEvent(sessionID, EventChatSwitched, ChatSwitchedData{
+		ChatID: chat.ID,
+		Name:   chat.Name,
+	})
+}
+
+// handleListChats lists the session's chats in creation order.
+// GET /chats?limit=&offset=&since=&until=
+func (s *Server) handleListChats(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	activeChatID := session.ActiveChatID()
+
+	var infos []conversation.ChatInfo
+	for _, info := range session.Chats() {
+		if q.matchesTime(info.CreatedAt) {
+			infos = append(infos, info)
+		}
+	}
+	start, end, page := q.page(len(infos))
+
+	resp := chatListResponse{
+		Status:       "ok",
+		ActiveChatID: activeChatID,
+		Chats:        make([]chatResponse, 0, end-start),
+		Page:         page,
+	}
+	for _, info := range infos[start:end] {
+		resp.Chats = append(resp.Chats, buildChatResponse(session, info, activeChatID))
+	}
+
+	writeChatJSON(w, http.StatusOK, resp)
+}
+
+// handleCreateChat creates a new chat and makes it active.
+// POST /chats (form: name, optional)
+func (s *Server) handleCreateChat(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"status":"error","message":"failed to parse form"}`)
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	info, err := session.CreateChat(r.FormValue("name"))
+	if err != nil {
+		writeChatError(w, err)
+		return
+	}
+
+	log.Printf("Created chat %s for session %s", info.ID, sessionID)
+
+	chat := buildChatResponse(session, info, info.ID)
+	s.notifyChatSwitched(sessionID, chat)
+	writeChatJSON(w, http.StatusCreated, chatMutationResponse{Status: "ok", Chat: chat})
+}
+
+// handleRenameChat renames a chat.
+// PATCH /chats/{chatID} (form: name)
+func (s *Server) handleRenameChat(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"status":"error","message":"failed to parse form"}`)
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	info, err := session.RenameChat(r.PathValue("chatID"), r.FormValue("name"))
+	if err != nil {
+		writeChatError(w, err)
+		return
+	}
+
+	writeChatJSON(w, http.StatusOK, chatMutationResponse{
+		Status: "ok",
+		Chat:   buildChatResponse(session, info, session.ActiveChatID()),
+	})
+}
+
+// handleSwitchChat makes a chat active.
+// POST /chats/{chatID}/activate
+func (s *Server) handleSwitchChat(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	chatID := r.PathValue("chatID")
+	session := s.sessionManager.GetSession(sessionID)
+	if err := session.SwitchChat(chatID); err != nil {
+		writeChatError(w, err)
+		return
+	}
+
+	chat := chatResponse{ID: chatID}
+	for _, info := range session.Chats() {
+		if info.ID == chatID {
+			chat = buildChatResponse(session, info, chatID)
+			break
+		}
+	}
+
+	s.notifyChatSwitched(sessionID, chat)
+	writeChatJSON(w, http.StatusOK, chatMutationResponse{Status: "ok", Chat: chat})
+}
+
+// handleDeleteChat deletes a chat and its history.
+// DELETE /chats/{chatID}
+//
+// Images generated in the chat remain in session storage.
+func (s *Server) handleDeleteChat(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	chatID := r.PathValue("chatID")
+	session := s.sessionManager.GetSession(sessionID)
+	wasActive := session.ActiveChatID() == chatID
+
+	if err := session.DeleteChat(chatID); err != nil {
+		writeChatError(w, err)
+		return
+	}
+
+	log.Printf("Deleted chat %s for session %s", chatID, sessionID)
+
+	if wasActive {
+		activeChatID := session.ActiveChatID()
+		for _, info := range session.Chats() {
+			if info.ID == activeChatID {
+				s.notifyChatSwitched(sessionID, buildChatResponse(session, info, activeChatID))
+				break
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status":"ok","session_id":"%s"}`, sessionID)
+}
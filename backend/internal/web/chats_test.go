@@ -0,0 +1,160 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+)
+
+const testChatsSessionID = "abcdefabcdefabcdefabcdefabcdef01"
+
+func newChatsTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	s, err := NewServerWithDeps("", nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	return s
+}
+
+// doChatRequest routes a request through the server's mux so path values are set.
+func doChatRequest(t *testing.T, s *Server, method, target string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testChatsSessionID})
+	req.Header.Set(CSRFHeaderName, s.csrfToken(testChatsSessionID))
+
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+// recordEvents registers a recorder as the session's SSE connection.
+func recordEvents(s *Server, sessionID string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.broker.addConnection(&connection{
+		sessionID: sessionID,
+		writer:    w,
+		flusher:   w,
+		done:      make(chan struct{}),
+	})
+	return w
+}
+
+func TestChatEndpoints_Lifecycle(t *testing.T) {
+	s := newChatsTestServer(t)
+	events := recordEvents(s, testChatsSessionID)
+
+	// Create
+	w := doChatRequest(t, s, http.MethodPost, "/chats", url.Values{"name": {"Landscapes"}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status code = %d, want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	var created chatMutationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode create response: %v", err)
+	}
+	if created.Chat.Name != "Landscapes" || !created.Chat.Active {
+		t.Errorf("created chat = %+v, want active chat named Landscapes", created.Chat)
+	}
+	if !strings.Contains(events.Body.String(), "event: "+EventChatSwitched) {
+		t.Errorf("events = %q, want %s after create", events.Body.String(), EventChatSwitched)
+	}
+
+	// Rename
+	w = doChatRequest(t, s, http.MethodPatch, "/chats/"+created.Chat.ID, url.Values{"name": {"Mountains"}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"Mountains"`) {
+		t.Errorf("rename = %d %s, want 200 with new name", w.Code, w.Body.String())
+	}
+
+	// Switch back to the default chat
+	w = doChatRequest(t, s, http.MethodPost, "/chats/"+conversation.DefaultChatID+"/activate", nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("activate status code = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// List
+	w = doChatRequest(t, s, http.MethodGet, "/chats", nil)
+	var list chatListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode list response: %v", err)
+	}
+	if list.ActiveChatID != conversation.DefaultChatID || len(list.Chats) != 2 {
+		t.Fatalf("list = %+v, want 2 chats with default active", list)
+	}
+	if list.Chats[1].Name != "Mountains" || list.Chats[1].Active {
+		t.Errorf("second chat = %+v, want inactive chat named Mountains", list.Chats[1])
+	}
+
+	// Delete
+	w = doChatRequest(t, s, http.MethodDelete, "/chats/"+created.Chat.ID, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("delete status code = %d, want %d", w.Code, http.StatusOK)
+	}
+	if n := len(s.sessionManager.GetSession(testChatsSessionID).Chats()); n != 1 {
+		t.Errorf("%d chats after delete, want 1", n)
+	}
+}
+
+func TestChatEndpoints_Errors(t *testing.T) {
+	s := newChatsTestServer(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		form       url.Values
+		wantStatus int
+	}{
+		{name: "rename unknown chat", method: http.MethodPatch, target: "/chats/0000000000000000", form: url.Values{"name": {"x"}}, wantStatus: http.StatusNotFound},
+		{name: "rename to blank", method: http.MethodPatch, target: "/chats/main", form: url.Values{"name": {" "}}, wantStatus: http.StatusBadRequest},
+		{name: "activate unknown chat", method: http.MethodPost, target: "/chats/0000000000000000/activate", wantStatus: http.StatusNotFound},
+		{name: "delete last chat", method: http.MethodDelete, target: "/chats/main", wantStatus: http.StatusConflict},
+		{name: "chat message to unknown chat", method: http.MethodPost, target: "/chat", form: url.Values{"message": {"hi"}, "chat_id": {"0000000000000000"}}, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doChatRequest(t, s, tt.method, tt.target, tt.form)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), `"status":"error"`) {
+				t.Errorf("body = %s, want JSON error", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSendChatEvent_DropsInactiveChats(t *testing.T) {
+	s := newChatsTestServer(t)
+	events := recordEvents(s, testChatsSessionID)
+
+	session := s.sessionManager.GetSession(testChatsSessionID)
+	if _, err := session.CreateChat("background"); err != nil {
+		t.Fatalf("CreateChat() error = %v", err)
+	}
+
+	_ = s.sendChatEvent(testChatsSessionID, conversation.DefaultChatID, EventAgentDone, map[string]bool{"done": true})
+	if strings.Contains(events.Body.String(), EventAgentDone) {
+		t.Error("event from inactive chat was delivered")
+	}
+
+	_ = s.sendChatEvent(testChatsSessionID, session.ActiveChatID(), EventAgentDone, map[string]bool{"done": true})
+	if !strings.Contains(events.Body.String(), EventAgentDone) {
+		t.Error("event from active chat was not delivered")
+	}
+}
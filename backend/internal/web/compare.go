@@ -0,0 +1,101 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hurricanerix/weave/internal/image"
+)
+
+// handleCompareImages renders a perceptual difference heatmap of two images.
+// GET /images/compare?a={ref}&b={ref}
+//
+// Each ref is either an in-memory image ID (as served by /images/{id}) or a
+// message ID whose image is persisted in the caller's session. A ".png"
+// suffix is accepted on either. The mean difference and the fraction of
+// visibly changed pixels are reported in X-Weave-Diff-Mean and
+// X-Weave-Diff-Changed.
+func (s *Server) handleCompareImages(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	refA, refB := query.Get("a"), query.Get("b")
+	if refA == "" || refB == "" {
+		http.Error(w, "Missing a or b parameter", http.StatusBadRequest)
+		return
+	}
+
+	sessionID := GetSessionID(r.Context())
+
+	pngA, status := s.loadImageRef(sessionID, refA)
+	if status != http.StatusOK {
+		http.Error(w, fmt.Sprintf("Image a: %s", http.StatusText(status)), status)
+		return
+	}
+	pngB, status := s.loadImageRef(sessionID, refB)
+	if status != http.StatusOK {
+		http.Error(w, fmt.Sprintf("Image b: %s", http.StatusText(status)), status)
+		return
+	}
+
+	result, err := image.DiffHeatmap(pngA, pngB)
+	if err != nil {
+		if errors.Is(err, image.ErrDimensionMismatch) {
+			http.Error(w, "Images have different dimensions", http.StatusUnprocessableEntity)
+			return
+		}
+		log.Printf("Failed to compare images %s and %s: %v", refA, refB, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Weave-Diff-Mean", strconv.FormatFloat(result.MeanDelta, 'f', 4, 64))
+	w.Header().Set("X-Weave-Diff-Changed", strconv.FormatFloat(result.ChangedRatio, 'f', 4, 64))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(result.PNG); err != nil {
+		log.Printf("Failed to write comparison of %s and %s: %v", refA, refB, err)
+	}
+}
+
+// loadImageRef resolves an image reference to PNG data.
+// Numeric refs are message IDs in the caller's session; anything else is an
+// in-memory image ID. Returns the HTTP status describing the outcome.
+func (s *Server) loadImageRef(sessionID, ref string) ([]byte, int) {
+	ref = strings.TrimSuffix(ref, ".png")
+
+	if messageID, err := strconv.Atoi(ref); err == nil {
+		// SECURITY: Session images are only readable by their owner
+		if sessionID == "" {
+			return nil, http.StatusUnauthorized
+		}
+		if messageID <= 0 {
+			return nil, http.StatusBadRequest
+		}
+		pngData, err := s.imageStore.Load(sessionID, messageID)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, http.StatusNotFound
+			}
+			log.Printf("Failed to load image %d for session %s: %v", messageID, sessionID, err)
+			return nil, http.StatusInternalServerError
+		}
+		return pngData, http.StatusOK
+	}
+
+	pngData, _, _, err := s.imageStorage.Get(ref)
+	if err != nil {
+		if errors.Is(err, image.ErrNotFound) {
+			return nil, http.StatusNotFound
+		}
+		if errors.Is(err, image.ErrInvalidID) {
+			return nil, http.StatusBadRequest
+		}
+		return nil, http.StatusInternalServerError
+	}
+	return pngData, http.StatusOK
+}
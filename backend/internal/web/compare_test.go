@@ -0,0 +1,136 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+const testCompareSessionID = "0f1e2d3c4b5a69788796a5b4c3d2e1f0"
+
+// newCompareTestServer stores a 2x1 black image in memory and a 2x1 image
+// with one white pixel as message 1 in the test session.
+func newCompareTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+
+	store := persistence.NewImageStore(t.TempDir())
+	s, err := NewServerWithDeps("", nil, nil, nil, store, nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+
+	black, err := image.EncodePNG(2, 1, []byte{0, 0, 0, 0, 0, 0}, image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	halfWhite, err := image.EncodePNG(2, 1, []byte{0, 0, 0, 255, 255, 255}, image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	square, err := image.EncodePNG(1, 1, []byte{0, 0, 0}, image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+
+	id, err := s.imageStorage.Store("", black, 2, 1)
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := store.Save(testCompareSessionID, 1, halfWhite); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.Save(testCompareSessionID, 2, square); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	return s, id
+}
+
+func TestHandleCompareImages(t *testing.T) {
+	s, memoryID := newCompareTestServer(t)
+
+	tests := []struct {
+		name        string
+		query       string
+		sessionID   string
+		wantStatus  int
+		wantChanged string
+	}{
+		{
+			name:        "memory image against session image",
+			query:       "?a=" + memoryID + ".png&b=1.png",
+			sessionID:   testCompareSessionID,
+			wantStatus:  http.StatusOK,
+			wantChanged: "0.5000",
+		},
+		{
+			name:        "image against itself",
+			query:       "?a=1&b=1",
+			sessionID:   testCompareSessionID,
+			wantStatus:  http.StatusOK,
+			wantChanged: "0.0000",
+		},
+		{
+			name:       "missing parameter",
+			query:      "?a=1",
+			sessionID:  testCompareSessionID,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "different dimensions",
+			query:      "?a=1&b=2",
+			sessionID:  testCompareSessionID,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "unknown message",
+			query:      "?a=1&b=9",
+			sessionID:  testCompareSessionID,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unknown memory image",
+			query:      "?a=1&b=00000000-0000-0000-0000-000000000000",
+			sessionID:  testCompareSessionID,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "session image requires session",
+			query:      "?a=" + memoryID + "&b=1",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "other session's images are not visible",
+			query:      "?a=" + memoryID + "&b=1",
+			sessionID:  "ffffffffffffffffffffffffffffffff",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/images/compare"+tt.query, nil)
+			if tt.sessionID != "" {
+				req = req.WithContext(setSessionID(req.Context(), tt.sessionID))
+			}
+			w := httptest.NewRecorder()
+			s.handleCompareImages(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status code = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+				t.Errorf("Content-Type = %q, want image/png", ct)
+			}
+			if got := w.Header().Get("X-Weave-Diff-Changed"); got != tt.wantChanged {
+				t.Errorf("X-Weave-Diff-Changed = %q, want %q", got, tt.wantChanged)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package web
+
+// Compute states reported with EventComputeStatus.
+const (
+	// ComputeStatusRestarting means the compute process stopped and a new
+	// one is being started
+	ComputeStatusRestarting = "restarting"
+	// ComputeStatusRunning means a restarted compute process is connected
+	ComputeStatusRunning = "running"
+	// ComputeStatusFailed means compute kept stopping and is not restarted
+	// again; generating needs a restart of weave
+	ComputeStatusFailed = "failed"
+)
+
+// ReportComputeStatus tells every SSE client that the compute process is in
+// state, one of the ComputeStatus* constants, after attempt restarts.
+func (s *Server) ReportComputeStatus(state string, attempt int) {
+	s.broker.SendEventToAll(EventComputeStatus, ComputeStatusData{State: state, Attempt: attempt})
+}
@@ -0,0 +1,21 @@
+package web
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReportComputeStatus(t *testing.T) {
+	s := newShutdownTestServer(t)
+	events := recordEvents(s, testGallerySessionID)
+
+	s.ReportComputeStatus(ComputeStatusRestarting, 2)
+
+	body := events.Body.String()
+	if !strings.Contains(body, "event: "+EventComputeStatus+"\n") {
+		t.Errorf("events = %q, want a %s event", body, EventComputeStatus)
+	}
+	if !strings.Contains(body, `{"state":"restarting","attempt":2}`) {
+		t.Errorf("events = %q, want state restarting on attempt 2", body)
+	}
+}
@@ -0,0 +1,156 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// DefaultControlStrength is how closely generations follow a control image
+// set without a strength.
+const DefaultControlStrength = 0.9
+
+// controlTypes maps the control types of the API to the protocol's.
+var controlTypes = map[string]uint32{
+	"canny": protocol.ControlTypeCanny,
+	"depth": protocol.ControlTypeDepth,
+	"pose":  protocol.ControlTypePose,
+}
+
+// controlTypeName names a protocol.ControlType* value for API responses.
+func controlTypeName(controlType uint32) string {
+	for name, t := range controlTypes {
+		if t == controlType {
+			return name
+		}
+	}
+	return ""
+}
+
+// controlResponse is the response for GET and POST /settings/control. An
+// empty image means the session's images have no control image.
+type controlResponse struct {
+	Status   string  `json:"status"`
+	Image    string  `json:"image"`
+	Type     string  `json:"type,omitempty"`
+	Strength float32 `json:"strength,omitempty"`
+}
+
+// newControlResponse describes the session's control image.
+func newControlResponse(session *conversation.Session) controlResponse {
+	resp := controlResponse{Status: "ok"}
+	if c, ok := session.Control(); ok {
+		resp.Image = c.UploadID
+		resp.Type = controlTypeName(c.Type)
+		resp.Strength = c.Strength
+	}
+	return resp
+}
+
+// handleGetControl reports the control image of the session's images.
+// GET /settings/control
+func (s *Server) handleGetControl(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	writeChatJSON(w, http.StatusOK, newControlResponse(s.sessionManager.GetSession(sessionID)))
+}
+
+// handleSetControl sets the control image that guides the composition of
+// the session's images: an upload ID from POST /upload holding a canny edge
+// map, depth map or OpenPose skeleton, and how closely to follow it. An
+// empty image removes it. The image is used as is; compute does not
+// derive control maps from photos.
+// POST /settings/control (form: image, type, strength)
+func (s *Server) handleSetControl(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	uploadID := r.FormValue("image")
+	if uploadID == "" {
+		session.SetControl(nil)
+		writeChatJSON(w, http.StatusOK, newControlResponse(session))
+		return
+	}
+
+	controlType, ok := controlTypes[r.FormValue("type")]
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "type must be canny, depth or pose")
+		return
+	}
+	strength, err := parseControlStrength(r.FormValue("strength"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := s.imageStore.LoadUpload(sessionID, uploadID); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to load control image %s for session %s: %v", uploadID, sessionID, err)
+		}
+		writeJSONError(w, http.StatusNotFound, "control image not found")
+		return
+	}
+
+	session.SetControl(&conversation.Control{UploadID: uploadID, Type: controlType, Strength: strength})
+	log.Printf("Session %s set a %s control image", sessionID, r.FormValue("type"))
+	writeChatJSON(w, http.StatusOK, newControlResponse(session))
+}
+
+// parseControlStrength parses a control strength from form data. Returns
+// DefaultControlStrength if value is empty.
+func parseControlStrength(value string) (float32, error) {
+	if value == "" {
+		return DefaultControlStrength, nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 32)
+	// Written as a negation so NaN is rejected too
+	if err != nil || !(float32(parsed) > protocol.MinControlStrength && float32(parsed) <= protocol.MaxControlStrength) {
+		return 0, fmt.Errorf("strength must be greater than %.0f and at most %.0f", protocol.MinControlStrength, protocol.MaxControlStrength)
+	}
+	return float32(parsed), nil
+}
+
+// encodeControlRequest encodes req as a control request guided by control,
+// whose image is scaled to the request's dimensions.
+func (s *Server) encodeControlRequest(req *protocol.SD35GenerateRequest, sessionID string, control conversation.Control) ([]byte, error) {
+	data, err := s.imageStore.LoadUpload(sessionID, control.UploadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load control image: %w", err)
+	}
+	pixels, err := image.InitImageRGB(data, int(req.Width), int(req.Height))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare control image: %w", err)
+	}
+
+	req.Header.MsgType = protocol.MsgControlRequest
+	return protocol.EncodeSD35ControlRequest(&protocol.SD35ControlRequest{
+		SD35GenerateRequest: *req,
+		ControlType:         control.Type,
+		ControlStrength:     control.Strength,
+		ControlChannels:     protocol.SD35ChannelsRGB,
+		ControlImage:        pixels,
+	})
+}
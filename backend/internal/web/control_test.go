@@ -0,0 +1,185 @@
+package web
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// postControl posts a control image choice to /settings/control as the
+// test session.
+func postControl(s *Server, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/settings/control", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+	req.Header.Set(CSRFHeaderName, s.csrfToken(testGallerySessionID))
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+// saveControlUpload stores a 64x64 control map as an upload of the test
+// session and returns its ID.
+func saveControlUpload(t *testing.T, s *Server) string {
+	t.Helper()
+
+	png, err := image.EncodePNG(64, 64, bytes.Repeat([]byte{255, 255, 255}, 64*64), image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	id, err := s.imageStore.SaveUpload(testGallerySessionID, png)
+	if err != nil {
+		t.Fatalf("SaveUpload() error = %v", err)
+	}
+	return id
+}
+
+func TestParseControlStrength(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float32
+		wantErr bool
+	}{
+		{value: "", want: DefaultControlStrength},
+		{value: "0.5", want: 0.5},
+		{value: "2", want: 2},
+		{value: "0", wantErr: true},
+		{value: "2.5", wantErr: true},
+		{value: "NaN", wantErr: true},
+		{value: "strong", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseControlStrength(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseControlStrength(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseControlStrength(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleSetControl(t *testing.T) {
+	s := newDiffusionTestServer(t, nil)
+	uploadID := saveControlUpload(t, s)
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+		want       controlResponse
+	}{
+		{
+			name:       "depth map",
+			form:       url.Values{"image": {uploadID}, "type": {"depth"}, "strength": {"1.2"}},
+			wantStatus: http.StatusOK,
+			want:       controlResponse{Status: "ok", Image: uploadID, Type: "depth", Strength: 1.2},
+		},
+		{
+			name:       "default strength",
+			form:       url.Values{"image": {uploadID}, "type": {"canny"}},
+			wantStatus: http.StatusOK,
+			want:       controlResponse{Status: "ok", Image: uploadID, Type: "canny", Strength: DefaultControlStrength},
+		},
+		{
+			name:       "unknown type",
+			form:       url.Values{"image": {uploadID}, "type": {"scribble"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "strength out of range",
+			form:       url.Values{"image": {uploadID}, "type": {"pose"}, "strength": {"3"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown upload",
+			form:       url.Values{"image": {"0123456789abcdef"}, "type": {"pose"}},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "no image clears it",
+			form:       url.Values{},
+			wantStatus: http.StatusOK,
+			want:       controlResponse{Status: "ok"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postControl(s, tt.form)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp controlResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp != tt.want {
+				t.Errorf("response = %+v, want %+v", resp, tt.want)
+			}
+
+			// GET reports what POST set
+			w = serveAs(s, http.MethodGet, "/settings/control", testGallerySessionID)
+			var got controlResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode GET response: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GET response = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleGenerate_Control(t *testing.T) {
+	requests := make(chan []byte, 1)
+	s := newDiffusionTestServer(t, requests)
+	uploadID := saveControlUpload(t, s)
+	s.sessionManager.GetSession(testGallerySessionID).SetControl(&conversation.Control{
+		UploadID: uploadID,
+		Type:     protocol.ControlTypePose,
+		Strength: 0.6,
+	})
+
+	form := url.Values{"prompt": {"a dancer"}}
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(setSessionID(req.Context(), testGallerySessionID))
+	w := httptest.NewRecorder()
+	s.handleGenerate(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	msg := <-requests
+	if got := binary.BigEndian.Uint16(msg[6:8]); got != protocol.MsgControlRequest {
+		t.Fatalf("msg_type = 0x%04X, want control request", got)
+	}
+	if got := binary.BigEndian.Uint32(msg[76:80]); got != protocol.ControlTypePose {
+		t.Errorf("control_type = %d, want %d", got, protocol.ControlTypePose)
+	}
+	if got := math.Float32frombits(binary.BigEndian.Uint32(msg[80:84])); got != 0.6 {
+		t.Errorf("control_strength = %v, want 0.6", got)
+	}
+	// The 64x64 control map is scaled to the generation size
+	width, height := binary.BigEndian.Uint32(msg[28:32]), binary.BigEndian.Uint32(msg[32:36])
+	if got, want := binary.BigEndian.Uint32(msg[88:92]), width*height*3; got != want {
+		t.Errorf("control_data_len = %d, want %d", got, want)
+	}
+}
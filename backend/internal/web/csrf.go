@@ -0,0 +1,87 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+// CSRFHeaderName is the request header carrying the CSRF token. When CSRF
+// protection is enabled every response carries it too, so API clients can
+// pick up the token for their session.
+const CSRFHeaderName = "X-CSRF-Token"
+
+// csrfKeySize is the size of the key CSRF tokens are derived with.
+const csrfKeySize = 32
+
+// csrfExemptRoutes change state without relying on the session cookie, so
+// a forged request gains nothing from it.
+var csrfExemptRoutes = map[string]bool{
+	// Authenticated by the unguessable connection ID in the URL
+	"POST /mcp/message": true,
+	// Only checks the uploaded image
+	"POST /provenance/verify": true,
+}
+
+// newCSRFKey returns a random key for deriving CSRF tokens. The key lives
+// only as long as the process, so pages opened before a full restart need
+// a reload.
+func newCSRFKey() ([]byte, error) {
+	key := make([]byte, csrfKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate CSRF key: %w", err)
+	}
+	return key, nil
+}
+
+// csrfToken returns the CSRF token for sessionID. Tokens are derived from
+// the session rather than stored, so any page of the session can use them.
+func (s *Server) csrfToken(sessionID string) string {
+	mac := hmac.New(sha256.New, s.csrfKey)
+	mac.Write([]byte(sessionID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requireCSRFToken rejects every request that can change state, that is
+// anything but GET, HEAD and OPTIONS, with 403 unless the CSRFHeaderName
+// header holds the session's CSRF token. The session cookie is sent with any
+// request, so each must prove it came from a page served by weave, or from
+// a client that read the token from an earlier response. Requests that are
+// csrfExempt, such as those with an API token in the Authorization header,
+// which browsers don't add on their own, skip the check. It must run after
+// SessionMiddleware. Does nothing when --disable-csrf is set.
+func (s *Server) requireCSRFToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.csrfDisabled.Load() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := s.csrfToken(GetSessionID(r.Context()))
+		w.Header().Set(CSRFHeaderName, token)
+
+		if csrfExempt(r, s.apiTokens.Load()) || hmac.Equal([]byte(r.Header.Get(CSRFHeaderName)), []byte(token)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+	})
+}
+
+// csrfExempt reports whether r needs no CSRF token: it can't change state,
+// is to one of csrfExemptRoutes, or carries a valid API token in its
+// Authorization header. A token in the sign-in cookie doesn't count, since
+// the browser sends that too.
+func csrfExempt(r *http.Request, tokens *apiTokens) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if csrfExemptRoutes[r.Method+" "+r.URL.Path] {
+		return true
+	}
+	return tokens != nil && r.Header.Get("Authorization") != "" && tokens.valid(requestAPIToken(r))
+}
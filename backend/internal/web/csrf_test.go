@@ -0,0 +1,135 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+func TestRequireCSRFToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		token      string
+		apiToken   string
+		wantReject bool
+	}{
+		{name: "chat without token", method: http.MethodPost, target: "/chat", wantReject: true},
+		{name: "prompt without token", method: http.MethodPost, target: "/prompt", wantReject: true},
+		{name: "generate without token", method: http.MethodPost, target: "/generate", wantReject: true},
+		{name: "new chat without token", method: http.MethodPost, target: "/new-chat", wantReject: true},
+		{name: "prompt with another session's token", method: http.MethodPost, target: "/prompt", token: "other", wantReject: true},
+		{name: "prompt with token", method: http.MethodPost, target: "/prompt", token: testGallerySessionID},
+		{name: "create chat without token", method: http.MethodPost, target: "/chats", wantReject: true},
+		{name: "delete session without token", method: http.MethodPost, target: "/sessions/" + testResumeSessionID + "/delete", wantReject: true},
+		{name: "restart without token", method: http.MethodPost, target: "/admin/restart", wantReject: true},
+		{name: "delete image without token", method: http.MethodDelete, target: "/sessions/" + testGallerySessionID + "/images/1.png", wantReject: true},
+		{name: "set tags without token", method: http.MethodPut, target: "/images/1/tags", wantReject: true},
+		{name: "API token", method: http.MethodPost, target: "/chats", apiToken: "Bearer " + testAPIToken},
+		{name: "MCP message", method: http.MethodPost, target: "/mcp/message?sessionId=unknown"},
+		{name: "read", method: http.MethodGet, target: "/history"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The sign-in cookie gets every request past requireAPIToken,
+			// but only the Authorization header skips the CSRF check
+			s := newGalleryTestServer(t, &config.Config{APIToken: testAPIToken})
+
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+			req.AddCookie(&http.Cookie{Name: APITokenCookieName, Value: testAPIToken})
+			if tt.token != "" {
+				req.Header.Set(CSRFHeaderName, s.csrfToken(tt.token))
+			}
+			if tt.apiToken != "" {
+				req.Header.Set("Authorization", tt.apiToken)
+			}
+			w := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(w, req)
+
+			if rejected := w.Code == http.StatusForbidden && strings.Contains(w.Body.String(), "CSRF"); rejected != tt.wantReject {
+				t.Errorf("status = %d (%s), want rejected = %v", w.Code, strings.TrimSpace(w.Body.String()), tt.wantReject)
+			}
+			if got := w.Header().Get(CSRFHeaderName); got != s.csrfToken(testGallerySessionID) {
+				t.Errorf("%s response header = %q, want the session's token", CSRFHeaderName, got)
+			}
+		})
+	}
+}
+
+func TestRequireCSRFToken_Disabled(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+	}{
+		{name: "disable-csrf", cfg: &config.Config{DisableCSRF: true}},
+		{name: "gallery-only", cfg: &config.Config{GalleryOnly: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, tt.cfg)
+
+			req := httptest.NewRequest(http.MethodPost, "/prompt", nil)
+			req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+			w := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(w, req)
+
+			if w.Code == http.StatusForbidden {
+				t.Errorf("status = %d, want CSRF check skipped: %s", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get(CSRFHeaderName); got != "" {
+				t.Errorf("%s response header = %q, want none", CSRFHeaderName, got)
+			}
+		})
+	}
+}
+
+func TestRequireCSRFToken_Reconfigure(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{})
+	if err := s.Reconfigure(nil, nil, &config.Config{DisableCSRF: true}); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/prompt", nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	if w.Code == http.StatusForbidden {
+		t.Errorf("status = %d after disabling CSRF, want the request served", w.Code)
+	}
+}
+
+func TestHandleIndex_CSRFToken(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{})
+
+	w := serveAs(s, http.MethodGet, "/", testGallerySessionID)
+	want := `<meta name="csrf-token" content="` + s.csrfToken(testGallerySessionID) + `">`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("index page does not contain %s", want)
+	}
+}
+
+func TestCSRFToken(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{})
+	other := newGalleryTestServer(t, &config.Config{})
+
+	token := s.csrfToken(testGallerySessionID)
+	if len(token) != 64 {
+		t.Errorf("csrfToken() = %q, want 64 hex characters", token)
+	}
+	if s.csrfToken(testGallerySessionID) != token {
+		t.Error("csrfToken() is not stable for a session")
+	}
+	if s.csrfToken(testChatsSessionID) == token {
+		t.Error("csrfToken() is the same for different sessions")
+	}
+	if other.csrfToken(testGallerySessionID) == token {
+		t.Error("csrfToken() is the same for servers with different keys")
+	}
+}
@@ -0,0 +1,145 @@
+package web
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// diffusionModelListTimeout bounds a models request to compute. Compute
+// answers it between generations, so it may wait for one to finish.
+const diffusionModelListTimeout = 2 * time.Minute
+
+// diffusionModelResponse describes a compute model in API responses.
+type diffusionModelResponse struct {
+	ID     uint32 `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"` // "missing", "available" or "loaded"
+	VRAMMB uint32 `json:"vram_mb"`
+}
+
+// diffusionModelListResponse is the response for GET /models/diffusion.
+type diffusionModelListResponse struct {
+	Status  string                   `json:"status"`
+	Current string                   `json:"current"`
+	Models  []diffusionModelResponse `json:"models"`
+}
+
+// handleListDiffusionModels lists the image models compute knows, whether
+// each is installed or loaded, and the model the session generates with.
+// GET /models/diffusion
+func (s *Server) handleListDiffusionModels(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	models, ok := s.listDiffusionModels(r.Context(), w, sessionID)
+	if !ok {
+		return
+	}
+
+	current := s.sessionManager.GetSession(sessionID).DiffusionModel()
+	resp := diffusionModelListResponse{
+		Status: "ok",
+		Models: make([]diffusionModelResponse, 0, len(models)),
+	}
+	for _, m := range models {
+		if m.ModelID == current {
+			resp.Current = m.Name
+		}
+		resp.Models = append(resp.Models, diffusionModelResponse{
+			ID:     m.ModelID,
+			Name:   m.Name,
+			Status: diffusionModelStatus(m.Status),
+			VRAMMB: m.VRAMMB,
+		})
+	}
+	writeChatJSON(w, http.StatusOK, resp)
+}
+
+// handleSetDiffusionModel switches the image model for the session. The
+// model must be one compute has installed; an empty model reverts to SD 3.5.
+// Compute loads the model on the session's next generation, unloading the
+// one in VRAM.
+// POST /settings/diffusion-model (form: model)
+func (s *Server) handleSetDiffusionModel(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+	model := r.FormValue("model")
+	if len(model) > protocol.MaxModelNameLen {
+		writeJSONError(w, http.StatusBadRequest, "model name too long")
+		return
+	}
+
+	models, ok := s.listDiffusionModels(r.Context(), w, sessionID)
+	if !ok {
+		return
+	}
+
+	var chosen *protocol.ModelInfo
+	for i := range models {
+		if models[i].Name == model || (model == "" && models[i].ModelID == protocol.ModelIDSD35) {
+			chosen = &models[i]
+			break
+		}
+	}
+	if chosen == nil {
+		writeJSONError(w, http.StatusNotFound, "model not known to compute")
+		return
+	}
+	if chosen.Status == protocol.ModelStatusMissing {
+		writeJSONError(w, http.StatusNotFound, "model files are not installed")
+		return
+	}
+
+	s.sessionManager.GetSession(sessionID).SetDiffusionModel(chosen.ModelID)
+	log.Printf("Session %s switched image model to %s", sessionID, chosen.Name)
+	writeChatJSON(w, http.StatusOK, modelSettingResponse{Status: "ok", Model: chosen.Name})
+}
+
+// listDiffusionModels asks compute for its models. On failure it writes the
+// JSON error and returns false.
+func (s *Server) listDiffusionModels(ctx context.Context, w http.ResponseWriter, sessionID string) ([]protocol.ModelInfo, bool) {
+	if s.computeClient == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "compute process not connected")
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, diffusionModelListTimeout)
+	defer cancel()
+	models, err := s.computeClient.ListModels(ctx)
+	if err != nil {
+		log.Printf("Failed to list compute models for session %s: %v", sessionID, err)
+		writeJSONError(w, http.StatusBadGateway, "failed to list compute models")
+		return nil, false
+	}
+	return models, true
+}
+
+// diffusionModelStatus names a protocol.ModelStatus* value for API responses.
+func diffusionModelStatus(status uint32) string {
+	switch status {
+	case protocol.ModelStatusLoaded:
+		return "loaded"
+	case protocol.ModelStatusAvailable:
+		return "available"
+	default:
+		return "missing"
+	}
+}
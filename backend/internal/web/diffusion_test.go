@@ -0,0 +1,164 @@
+package web
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/persistence"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// testDiffusionModels are the models the fake compute of
+// recordingComputeConn reports: SD 3.5 loaded, SDXL installed, Flux missing.
+var testDiffusionModels = []protocol.ModelInfo{
+	{ModelID: protocol.ModelIDSD35, Status: protocol.ModelStatusLoaded, VRAMMB: 6000, Name: "sd3.5-medium"},
+	{ModelID: protocol.ModelIDSDXL, Status: protocol.ModelStatusAvailable, VRAMMB: 7000, Name: "sdxl-base-1.0"},
+	{ModelID: protocol.ModelIDFlux, Status: protocol.ModelStatusMissing, VRAMMB: 11000, Name: "flux1-schnell"},
+}
+
+// modelsResponseFor returns a models response listing testDiffusionModels
+// for requestID.
+func modelsResponseFor(requestID []byte) []byte {
+	resp := make([]byte, 28)
+	binary.BigEndian.PutUint32(resp[0:4], protocol.MagicNumber)
+	binary.BigEndian.PutUint16(resp[4:6], protocol.ProtocolVersion1)
+	binary.BigEndian.PutUint16(resp[6:8], protocol.MsgModelsResponse)
+	copy(resp[16:24], requestID)
+	binary.BigEndian.PutUint32(resp[24:28], uint32(len(testDiffusionModels)))
+	for _, m := range testDiffusionModels {
+		resp = binary.BigEndian.AppendUint32(resp, m.ModelID)
+		resp = binary.BigEndian.AppendUint32(resp, m.Status)
+		resp = binary.BigEndian.AppendUint32(resp, m.VRAMMB)
+		resp = binary.BigEndian.AppendUint32(resp, uint32(len(m.Name)))
+		resp = append(resp, m.Name...)
+	}
+	binary.BigEndian.PutUint32(resp[8:12], uint32(len(resp)-16))
+	return resp
+}
+
+// newDiffusionTestServer returns a server whose compute is the fake of
+// recordingComputeConn, sending its requests to requests if not nil.
+func newDiffusionTestServer(t *testing.T, requests chan []byte) *Server {
+	t.Helper()
+
+	s, err := NewServerWithDeps("", nil, nil, nil, persistence.NewImageStore(t.TempDir()), recordingComputeConn(t, requests), nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	return s
+}
+
+// postDiffusionModel posts an image model choice to
+// /settings/diffusion-model as the test session.
+func postDiffusionModel(s *Server, model string) *httptest.ResponseRecorder {
+	form := url.Values{"model": {model}}
+	req := httptest.NewRequest(http.MethodPost, "/settings/diffusion-model", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+	req.Header.Set(CSRFHeaderName, s.csrfToken(testGallerySessionID))
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleListDiffusionModels(t *testing.T) {
+	s := newDiffusionTestServer(t, nil)
+
+	w := serveAs(s, http.MethodGet, "/models/diffusion", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp diffusionModelListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Current != "sd3.5-medium" {
+		t.Errorf("current = %q, want sd3.5-medium", resp.Current)
+	}
+	want := []diffusionModelResponse{
+		{ID: 0, Name: "sd3.5-medium", Status: "loaded", VRAMMB: 6000},
+		{ID: 1, Name: "sdxl-base-1.0", Status: "available", VRAMMB: 7000},
+		{ID: 2, Name: "flux1-schnell", Status: "missing", VRAMMB: 11000},
+	}
+	if len(resp.Models) != len(want) {
+		t.Fatalf("models = %+v, want %+v", resp.Models, want)
+	}
+	for i := range want {
+		if resp.Models[i] != want[i] {
+			t.Errorf("model %d = %+v, want %+v", i, resp.Models[i], want[i])
+		}
+	}
+
+	// The session's choice is reported as current
+	if w := postDiffusionModel(s, "sdxl-base-1.0"); w.Code != http.StatusOK {
+		t.Fatalf("set model status = %d: %s", w.Code, w.Body.String())
+	}
+	w = serveAs(s, http.MethodGet, "/models/diffusion", testGallerySessionID)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Current != "sdxl-base-1.0" {
+		t.Errorf("current = %q, want sdxl-base-1.0", resp.Current)
+	}
+}
+
+func TestHandleListDiffusionModels_NoCompute(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	if w := serveAs(s, http.MethodGet, "/models/diffusion", testGallerySessionID); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHandleSetDiffusionModel(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		wantCode  int
+		wantModel uint32 // stored on the session
+	}{
+		{"installed model", "sdxl-base-1.0", http.StatusOK, protocol.ModelIDSDXL},
+		{"reset", "", http.StatusOK, protocol.ModelIDSD35},
+		{"missing model", "flux1-schnell", http.StatusNotFound, protocol.ModelIDSD35},
+		{"unknown model", "sd1.5", http.StatusNotFound, protocol.ModelIDSD35},
+		{"name too long", strings.Repeat("m", protocol.MaxModelNameLen+1), http.StatusBadRequest, protocol.ModelIDSD35},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDiffusionTestServer(t, nil)
+
+			w := postDiffusionModel(s, tt.model)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if got := s.sessionManager.GetSession(testGallerySessionID).DiffusionModel(); got != tt.wantModel {
+				t.Errorf("session model = %d, want %d", got, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestHandleGenerate_DiffusionModel(t *testing.T) {
+	requests := make(chan []byte, 1)
+	s := newDiffusionTestServer(t, requests)
+	s.sessionManager.GetSession(testGallerySessionID).SetDiffusionModel(protocol.ModelIDSDXL)
+
+	form := url.Values{"prompt": {"a cat"}}
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(setSessionID(req.Context(), testGallerySessionID))
+	w := httptest.NewRecorder()
+	s.handleGenerate(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	msg := <-requests
+	if got := binary.BigEndian.Uint32(msg[24:28]); got != protocol.ModelIDSDXL {
+		t.Errorf("model_id = %d, want %d", got, protocol.ModelIDSDXL)
+	}
+}
@@ -0,0 +1,134 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/hooks"
+)
+
+// handleEditMessage replaces an earlier user message and resends it.
+// POST /message/{id}/edit
+// Form fields: message (required), steps, cfg, seed (as for POST /chat).
+//
+// The conversation is rewound to just before the message, discarding it and
+// everything after it, then the edited text is sent to the agent as a new
+// chat message in the chat that owns it. The response streams via SSE as
+// for POST /chat, preceded by a history-rewound event. Images of discarded
+// messages are kept.
+func (s *Server) handleEditMessage(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Disable write deadline since LLM streaming can take a long time
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+
+	// SECURITY: Check rate limit
+	limit := s.rateLimiter.takeChat(sessionID)
+	if !limit.allowed {
+		log.Printf("Rate limit exceeded for session %s (edit)", sessionID)
+		writeRateLimited(w, limit)
+		return
+	}
+	limit.setHeaders(w)
+
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	messageID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || messageID <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "invalid message ID")
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	chatID, manager := session.ChatForMessage(messageID)
+	if manager == nil {
+		writeJSONError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	msg := manager.GetMessage(messageID)
+	if msg == nil {
+		writeJSONError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	if msg.Role != conversation.RoleUser {
+		writeJSONError(w, http.StatusBadRequest, "only user messages can be edited")
+		return
+	}
+
+	message := strings.TrimSpace(r.FormValue("message"))
+	if message == "" {
+		writeJSONError(w, http.StatusBadRequest, "message required")
+		return
+	}
+
+	// SECURITY: Validate message length
+	if len(message) > MaxMessageLength {
+		log.Printf("Edited message too long for session %s: %d bytes", sessionID, len(message))
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "message too long")
+		return
+	}
+
+	steps := s.parseSteps(r.FormValue("steps"))
+	cfg := s.parseCFG(r.FormValue("cfg"))
+	seed := s.parseSeed(r.FormValue("seed"))
+
+	// Run pre-prompt hooks before touching history so a rejected edit
+	// leaves the conversation as it was
+	if err := s.hooks.Fire(r.Context(), hooks.Payload{
+		Event:     hooks.EventPrePrompt,
+		SessionID: sessionID,
+		Message:   message,
+		Steps:     int(steps),
+		CFG:       cfg,
+		Seed:      seed,
+	}); err != nil {
+		log.Printf("Pre-prompt hook rejected edited message for session %s: %v", sessionID, err)
+		s.sendErrorEvent(sessionID, chatID, "Your message was rejected by a plugin hook.")
+		writeJSONError(w, http.StatusForbidden, "rejected by hook")
+		return
+	}
+
+	if err := manager.RewindTo(messageID); err != nil {
+		// The message was removed or replaced since it was looked up
+		if errors.Is(err, conversation.ErrMessageNotFound) {
+			writeJSONError(w, http.StatusNotFound, "message not found")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "only user messages can be edited")
+		return
+	}
+	log.Printf("Rewound session %s, chat %s to before message %d for edit", sessionID, chatID, messageID)
+
+	_ = s.sendChatEvent(sessionID, chatID, EventHistoryRewound, HistoryRewoundData{
+		MessageID: messageID,
+		Prompt:    manager.GetCurrentPrompt(),
+	})
+
+	session.SetGenerationSettings(int(steps), cfg, seed)
+	parseResolution(r, session)
+
+	// Run the agent turn; its response is streamed via SSE
+	s.runChatTurn(r.Context(), session, sessionID, chatID, manager, message, int(steps), cfg, seed)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status":"ok","session_id":"%s"}`, sessionID)
+}
@@ -0,0 +1,160 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+const testEditSessionID = "edit1234edit1234edit1234edit1234"
+
+func doEditMessage(t *testing.T, s *Server, sessionID, messageID string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/message/"+messageID+"/edit", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetPathValue("id", messageID)
+	if sessionID != "" {
+		req = req.WithContext(setSessionID(req.Context(), sessionID))
+	}
+	w := httptest.NewRecorder()
+	s.handleEditMessage(w, req)
+	return w
+}
+
+func TestHandleEditMessage(t *testing.T) {
+	s, err := NewServerWithDeps("", nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	s.setLLMClientForTesting(&mockOllamaClient{
+		responses: []mockResponse{
+			{result: ollama.ChatResult{Response: "A dog it is"}},
+		},
+	})
+	events := recordEvents(s, testEditSessionID)
+
+	manager := s.sessionManager.GetSession(testEditSessionID).Manager()
+	first := manager.AddUserMessage("draw a cat")
+	manager.AddAssistantMessage("Here's a cat", "a cat", &ollama.LLMMetadata{Prompt: "a cat"})
+	second := manager.AddUserMessage("make it blue")
+	reply := manager.AddAssistantMessage("Here's a blue cat", "a blue cat", &ollama.LLMMetadata{Prompt: "a blue cat"})
+
+	w := doEditMessage(t, s, testEditSessionID, strconv.Itoa(second), url.Values{"message": {"make it a dog"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	messages := manager.GetMessages()
+	if len(messages) != 4 {
+		t.Fatalf("got %d messages, want 4", len(messages))
+	}
+	if messages[0].ID != first || messages[2].Content != "make it a dog" || messages[3].Content != "A dog it is" {
+		t.Errorf("messages = %+v, want the first exchange followed by the edited message and reply", messages)
+	}
+	if messages[2].ID <= reply {
+		t.Errorf("edited message ID = %d, want a new ID after %d", messages[2].ID, reply)
+	}
+	if got := manager.GetCurrentPrompt(); got != "a cat" {
+		t.Errorf("current prompt = %q, want prompt rolled back to %q", got, "a cat")
+	}
+
+	body := events.Body.String()
+	if !strings.Contains(body, "event: "+EventHistoryRewound) || !strings.Contains(body, `"message_id":`+strconv.Itoa(second)) {
+		t.Errorf("events = %q, want %s for message %d", body, EventHistoryRewound, second)
+	}
+	if !strings.Contains(body, "event: "+EventAgentDone) {
+		t.Errorf("events = %q, want %s after the resent message", body, EventAgentDone)
+	}
+}
+
+func TestHandleEditMessage_Errors(t *testing.T) {
+	s, err := NewServerWithDeps("", nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+
+	manager := s.sessionManager.GetSession(testEditSessionID).Manager()
+	userID := manager.AddUserMessage("draw a cat")
+	assistantID := manager.AddAssistantMessage("Here's a cat", "a cat", &ollama.LLMMetadata{Prompt: "a cat"})
+	valid := url.Values{"message": {"draw a dog"}}
+
+	tests := []struct {
+		name        string
+		sessionID   string
+		messageID   string
+		form        url.Values
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			name:       "requires session",
+			messageID:  strconv.Itoa(userID),
+			form:       valid,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:        "invalid message ID",
+			sessionID:   testEditSessionID,
+			messageID:   "abc",
+			form:        valid,
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "invalid message ID",
+		},
+		{
+			name:        "unknown message",
+			sessionID:   testEditSessionID,
+			messageID:   "999",
+			form:        valid,
+			wantStatus:  http.StatusNotFound,
+			wantMessage: "message not found",
+		},
+		{
+			name:        "assistant message",
+			sessionID:   testEditSessionID,
+			messageID:   strconv.Itoa(assistantID),
+			form:        valid,
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "only user messages",
+		},
+		{
+			name:        "empty message",
+			sessionID:   testEditSessionID,
+			messageID:   strconv.Itoa(userID),
+			form:        url.Values{"message": {"   "}},
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "message required",
+		},
+		{
+			name:        "message too long",
+			sessionID:   testEditSessionID,
+			messageID:   strconv.Itoa(userID),
+			form:        url.Values{"message": {strings.Repeat("a", MaxMessageLength+1)}},
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantMessage: "message too long",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doEditMessage(t, s, tt.sessionID, tt.messageID, tt.form)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantMessage) {
+				t.Errorf("body = %s, want message containing %q", w.Body.String(), tt.wantMessage)
+			}
+		})
+	}
+
+	// Rejected edits leave the conversation untouched
+	if messages := manager.GetMessages(); len(messages) != 2 || messages[0].Role != conversation.RoleUser {
+		t.Errorf("messages = %+v, want the original exchange", messages)
+	}
+}
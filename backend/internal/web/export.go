@@ -0,0 +1,249 @@
+package web
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/timestamp"
+)
+
+const (
+	// ExportFormatVersion is the version of the export document layout.
+	// Bump it when making incompatible changes so import can reject old archives.
+	// Version 2 added message sequence numbers.
+	ExportFormatVersion = 2
+
+	// minImportFormatVersion is the oldest export version import accepts.
+	// Older documents are migrated when restored.
+	minImportFormatVersion = 1
+
+	// exportFormatJSON and exportFormatMarkdown are the supported ?format= values
+	exportFormatJSON     = "json"
+	exportFormatMarkdown = "md"
+)
+
+// exportDocument is the JSON representation of an exported session.
+type exportDocument struct {
+	Version       int             `json:"version"`
+	ExportedAt    time.Time       `json:"exported_at"`
+	CurrentPrompt string          `json:"current_prompt"`
+	Settings      exportSettings  `json:"settings"`
+	Messages      []exportMessage `json:"messages"`
+}
+
+// exportSettings holds the session's generation settings at export time.
+type exportSettings struct {
+	Steps int     `json:"steps"`
+	CFG   float64 `json:"cfg"`
+	Seed  int64   `json:"seed"`
+}
+
+// exportMessage is a conversation message plus a reference to its image.
+// Image is the archive-relative path ("images/{id}.png") and is only set
+// when the message has a persisted image.
+type exportMessage struct {
+	conversation.ConversationMessage
+	Image string `json:"image,omitempty"`
+}
+
+// exportImagePath returns the archive-relative path for a message image.
+func exportImagePath(messageID int) string {
+	return fmt.Sprintf("images/%d.png", messageID)
+}
+
+// handleExport serializes the session's conversation for download.
+// GET /export?format=md|json[&zip=true]
+//
+// format defaults to json. With zip=true the document is bundled with the
+// session's images in a zip archive; otherwise image references point at
+// files the caller does not receive.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatJSON
+	}
+	if format != exportFormatJSON && format != exportFormatMarkdown {
+		http.Error(w, "Invalid format (must be md or json)", http.StatusBadRequest)
+		return
+	}
+
+	bundle := false
+	if zipStr := r.URL.Query().Get("zip"); zipStr != "" {
+		var err error
+		bundle, err = strconv.ParseBool(zipStr)
+		if err != nil {
+			http.Error(w, "Invalid zip parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	doc := s.buildExportDocument(sessionID)
+
+	var body []byte
+	var contentType string
+	if format == exportFormatJSON {
+		var err error
+		body, err = json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			log.Printf("Failed to marshal export for session %s: %v", sessionID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		contentType = "application/json"
+	} else {
+		body = []byte(renderExportMarkdown(doc))
+		contentType = "text/markdown; charset=utf-8"
+	}
+
+	baseName := "weave-session-" + doc.ExportedAt.Format("20060102-150405")
+	documentName := "conversation." + format
+
+	if !bundle {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, baseName, format))
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(body); err != nil {
+			log.Printf("Failed to write export for session %s: %v", sessionID, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, baseName))
+	w.WriteHeader(http.StatusOK)
+
+	if err := s.writeExportZip(w, sessionID, doc, documentName, body); err != nil {
+		// Headers are already sent; the client receives a truncated archive
+		log.Printf("Failed to write export archive for session %s: %v", sessionID, err)
+	}
+}
+
+// buildExportDocument snapshots the session's conversation and settings.
+func (s *Server) buildExportDocument(sessionID string) exportDocument {
+	session := s.sessionManager.GetSession(sessionID)
+	manager := session.Manager()
+
+	settings := exportSettings{Steps: s.defaultSteps, CFG: s.defaultCFG, Seed: s.defaultSeed}
+	if steps, cfg, seed, ok := session.GetGenerationSettings(); ok {
+		settings = exportSettings{Steps: steps, CFG: cfg, Seed: seed}
+	}
+
+	history := manager.GetMessages()
+	messages := make([]exportMessage, len(history))
+	for i, msg := range history {
+		messages[i] = exportMessage{ConversationMessage: msg}
+		if s.imageStore.Exists(sessionID, msg.ID) {
+			messages[i].Image = exportImagePath(msg.ID)
+		}
+	}
+
+	exportedAt, _ := timestamp.Next()
+	return exportDocument{
+		Version:       ExportFormatVersion,
+		ExportedAt:    exportedAt,
+		CurrentPrompt: manager.GetCurrentPrompt(),
+		Settings:      settings,
+		Messages:      messages,
+	}
+}
+
+// writeExportZip writes the document and referenced images as a zip archive.
+func (s *Server) writeExportZip(w io.Writer, sessionID string, doc exportDocument, documentName string, document []byte) error {
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create(documentName)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", documentName, err)
+	}
+	if _, err := f.Write(document); err != nil {
+		return fmt.Errorf("failed to write %s: %w", documentName, err)
+	}
+
+	for _, msg := range doc.Messages {
+		if msg.Image == "" {
+			continue
+		}
+		pngData, err := s.imageStore.Load(sessionID, msg.ID)
+		if err != nil {
+			// Image removed between snapshot and archive; skip it
+			log.Printf("Skipping image %d in export for session %s: %v", msg.ID, sessionID, err)
+			continue
+		}
+		prompt := ""
+		if msg.Snapshot != nil {
+			prompt = msg.Snapshot.Prompt
+		}
+		pngData = s.signImage(pngData, prompt)
+
+		// PNG is already compressed, so store it as-is
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: msg.Image, Method: zip.Store})
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", msg.Image, err)
+		}
+		if _, err := f.Write(pngData); err != nil {
+			return fmt.Errorf("failed to write %s: %w", msg.Image, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+// renderExportMarkdown formats an export document as Markdown.
+func renderExportMarkdown(doc exportDocument) string {
+	var b strings.Builder
+
+	b.WriteString("# Weave Session\n\n")
+	fmt.Fprintf(&b, "Exported: %s\n\n", doc.ExportedAt.Format(time.RFC3339))
+	if doc.CurrentPrompt != "" {
+		fmt.Fprintf(&b, "**Current prompt:** %s\n\n", doc.CurrentPrompt)
+	}
+	fmt.Fprintf(&b, "**Settings:** steps=%d, cfg=%.1f, seed=%d\n\n",
+		doc.Settings.Steps, doc.Settings.CFG, doc.Settings.Seed)
+
+	for _, msg := range doc.Messages {
+		b.WriteString("---\n\n")
+		switch msg.Role {
+		case conversation.RoleUser:
+			b.WriteString("## User\n\n")
+		case conversation.RoleAssistant:
+			b.WriteString("## Assistant\n\n")
+		default:
+			fmt.Fprintf(&b, "## %s\n\n", msg.Role)
+		}
+
+		if !msg.CreatedAt.IsZero() {
+			fmt.Fprintf(&b, "_%s_\n\n", msg.CreatedAt.Format(time.RFC3339))
+		}
+
+		if msg.Content != "" {
+			b.WriteString(msg.Content)
+			b.WriteString("\n\n")
+		}
+
+		if msg.Snapshot != nil {
+			fmt.Fprintf(&b, "- Prompt: %s\n", msg.Snapshot.Prompt)
+			fmt.Fprintf(&b, "- Steps: %d, CFG: %.1f, Seed: %d\n\n",
+				msg.Snapshot.Steps, msg.Snapshot.CFG, msg.Snapshot.Seed)
+		}
+
+		if msg.Image != "" {
+			fmt.Fprintf(&b, "![Image %d](%s)\n\n", msg.ID, msg.Image)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,176 @@
+package web
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+const testExportSessionID = "00112233445566778899aabbccddeeff"
+
+// testExportPNG is the image of the assistant message of newExportTestServer.
+var testExportPNG, _ = image.EncodePNG(2, 2, make([]byte, 2*2*3), image.FormatRGB)
+
+// newExportTestServer creates a server with a two-message conversation whose
+// assistant message has a persisted image.
+func newExportTestServer(t *testing.T) (*Server, int) {
+	t.Helper()
+
+	store := persistence.NewImageStore(t.TempDir())
+	s, err := NewServerWithDeps("", nil, nil, nil, store, nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+
+	session := s.sessionManager.GetSession(testExportSessionID)
+	session.SetGenerationSettings(8, 2.5, 42)
+	manager := session.Manager()
+	manager.AddUserMessage("draw a cat")
+	msgID := manager.AddAssistantMessage("Here's a cat", "a fluffy cat", &ollama.LLMMetadata{Prompt: "a fluffy cat", Steps: 8, CFG: 2.5, Seed: 42})
+	manager.UpdateMessagePreview(msgID, conversation.PreviewStatusComplete, store.GetURL(testExportSessionID, msgID))
+
+	if err := store.Save(testExportSessionID, msgID, testExportPNG); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	return s, msgID
+}
+
+func doExport(t *testing.T, s *Server, query string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/export"+query, nil)
+	req = req.WithContext(setSessionID(req.Context(), testExportSessionID))
+	w := httptest.NewRecorder()
+	s.handleExport(w, req)
+	return w
+}
+
+func TestHandleExport_JSON(t *testing.T) {
+	s, msgID := newExportTestServer(t)
+
+	w := doExport(t, s, "?format=json")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, ".json") {
+		t.Errorf("Content-Disposition = %q, want .json attachment", cd)
+	}
+
+	var doc exportDocument
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+
+	if doc.Version != ExportFormatVersion {
+		t.Errorf("Version = %d, want %d", doc.Version, ExportFormatVersion)
+	}
+	if doc.CurrentPrompt != "a fluffy cat" {
+		t.Errorf("CurrentPrompt = %q, want %q", doc.CurrentPrompt, "a fluffy cat")
+	}
+	if doc.Settings.Steps != 8 || doc.Settings.Seed != 42 {
+		t.Errorf("Settings = %+v, want steps=8 seed=42", doc.Settings)
+	}
+	if len(doc.Messages) != 2 {
+		t.Fatalf("Messages length = %d, want 2", len(doc.Messages))
+	}
+	if doc.Messages[0].Image != "" {
+		t.Errorf("user message Image = %q, want empty", doc.Messages[0].Image)
+	}
+	assistant := doc.Messages[1]
+	if assistant.ID != msgID || assistant.Snapshot == nil || assistant.Snapshot.Prompt != "a fluffy cat" {
+		t.Errorf("assistant message = %+v, want snapshot with prompt", assistant)
+	}
+	if assistant.Image != exportImagePath(msgID) {
+		t.Errorf("assistant Image = %q, want %q", assistant.Image, exportImagePath(msgID))
+	}
+}
+
+func TestHandleExport_Markdown(t *testing.T) {
+	s, msgID := newExportTestServer(t)
+
+	w := doExport(t, s, "?format=md")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{"# Weave Session", "## User", "draw a cat", "## Assistant", "Prompt: a fluffy cat", exportImagePath(msgID)} {
+		if !strings.Contains(body, want) {
+			t.Errorf("markdown missing %q", want)
+		}
+	}
+}
+
+func TestHandleExport_Zip(t *testing.T) {
+	s, msgID := newExportTestServer(t)
+
+	w := doExport(t, s, "?format=json&zip=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q, want application/zip", ct)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("response is not a zip archive: %v", err)
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", f.Name, err)
+		}
+		files[f.Name] = data
+	}
+
+	if _, ok := files["conversation.json"]; !ok {
+		t.Error("archive missing conversation.json")
+	}
+	// Export signs the image, so only its format is checked
+	if got := files[exportImagePath(msgID)]; image.CheckPNG(got) != nil {
+		t.Errorf("archived image = %q, want the message's PNG", got)
+	}
+}
+
+func TestHandleExport_InvalidParams(t *testing.T) {
+	s, _ := newExportTestServer(t)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"unknown format", "?format=pdf"},
+		{"invalid zip flag", "?zip=maybe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doExport(t, s, tt.query)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status code = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// favoriteItem is one image in the GET /favorites response.
+type favoriteItem struct {
+	MessageID   int       `json:"message_id"`
+	URL         string    `json:"url"`
+	Prompt      string    `json:"prompt"`
+	FavoritedAt time.Time `json:"favorited_at"`
+	Seq         int64     `json:"seq"`
+}
+
+// favoritesResponse is the response for GET /favorites.
+type favoritesResponse struct {
+	Status    string         `json:"status"`
+	SessionID string         `json:"session_id"`
+	Favorites []favoriteItem `json:"favorites"`
+	Page      pageInfo       `json:"page"`
+}
+
+// parseImageMessageID returns the message ID from an /images/{id}/... path
+// that only applies to persisted session images, such as favorites and
+// tags. {id} is a message ID in the caller's session, optionally with a
+// .png extension.
+func parseImageMessageID(r *http.Request) (int, bool) {
+	messageID, err := strconv.Atoi(strings.TrimSuffix(r.PathValue("id"), ".png"))
+	if err != nil || messageID <= 0 {
+		return 0, false
+	}
+	return messageID, true
+}
+
+// handleFavoriteImage stars one of the session's images.
+// POST /images/{id}/favorite
+func (s *Server) handleFavoriteImage(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID, ok := parseImageMessageID(r)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "invalid message ID")
+		return
+	}
+	if !s.imageStore.Exists(sessionID, messageID) {
+		writeJSONError(w, http.StatusNotFound, "image not found")
+		return
+	}
+
+	if err := s.favoriteStore.Add(sessionID, messageID); err != nil {
+		if errors.Is(err, persistence.ErrFavoritesFull) {
+			writeJSONError(w, http.StatusConflict, "too many favorites")
+			return
+		}
+		log.Printf("Failed to favorite image %s/%d: %v", sessionID, messageID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to save favorite")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status":"ok","session_id":"%s"}`, sessionID)
+}
+
+// handleUnfavoriteImage removes the star from one of the session's images.
+// DELETE /images/{id}/favorite
+func (s *Server) handleUnfavoriteImage(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID, ok := parseImageMessageID(r)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "invalid message ID")
+		return
+	}
+
+	removed, err := s.favoriteStore.Remove(sessionID, messageID)
+	if err != nil {
+		log.Printf("Failed to unfavorite image %s/%d: %v", sessionID, messageID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to save favorite")
+		return
+	}
+	if !removed {
+		writeJSONError(w, http.StatusNotFound, "image is not a favorite")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status":"ok","session_id":"%s"}`, sessionID)
+}
+
+// handleListFavorites lists the session's starred images, most recently
+// starred first. Favorites whose image has since been deleted are skipped.
+// The time range filters on when the image was starred.
+// GET /favorites?limit=&offset=&since=&until=&prompt=
+func (s *Server) handleListFavorites(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	favorites, err := s.favoriteStore.List(sessionID)
+	if err != nil {
+		log.Printf("Failed to list favorites for session %s: %v", sessionID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	items := make([]favoriteItem, 0, len(favorites))
+	for _, fav := range favorites {
+		if !q.matchesTime(fav.FavoritedAt) || !q.matchesImage(true) || !s.imageStore.Exists(sessionID, fav.MessageID) {
+			continue
+		}
+		prompt := ""
+		if manager := session.ManagerForMessage(fav.MessageID); manager != nil {
+			if msg := manager.GetMessage(fav.MessageID); msg != nil && msg.Snapshot != nil {
+				prompt = msg.Snapshot.Prompt
+			}
+		}
+		if !q.matchesPrompt(prompt) {
+			continue
+		}
+		items = append(items, favoriteItem{
+			MessageID:   fav.MessageID,
+			URL:         s.imageStore.GetURL(sessionID, fav.MessageID),
+			Prompt:      prompt,
+			FavoritedAt: fav.FavoritedAt,
+			Seq:         fav.Seq,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	start, end, page := q.page(len(items))
+	resp := favoritesResponse{Status: "ok", SessionID: sessionID, Favorites: items[start:end], Page: page}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode favorites response: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+func listFavorites(t *testing.T, s *Server) favoritesResponse {
+	t.Helper()
+
+	w := serveAs(s, http.MethodGet, "/favorites", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var resp favoritesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("list response is not JSON: %v", err)
+	}
+	return resp
+}
+
+func TestFavorites_Flow(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	if got := listFavorites(t, s); len(got.Favorites) != 0 {
+		t.Fatalf("favorites = %+v, want none", got.Favorites)
+	}
+
+	w := serveAs(s, http.MethodPost, "/images/1.png/favorite", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("favorite status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	got := listFavorites(t, s)
+	if len(got.Favorites) != 1 {
+		t.Fatalf("favorites = %+v, want one", got.Favorites)
+	}
+	fav := got.Favorites[0]
+	if fav.MessageID != 1 || fav.Prompt != "a sunset" || fav.URL != s.imageStore.GetURL(testGallerySessionID, 1) {
+		t.Errorf("favorite = %+v, want message 1 with its prompt and URL", fav)
+	}
+
+	// Favorites survive a restart
+	reloaded := persistence.NewFavoriteStore(s.imageStore.BasePath())
+	if ok, err := reloaded.IsFavorite(testGallerySessionID, 1); err != nil || !ok {
+		t.Errorf("IsFavorite() after reload = %v, %v, want true", ok, err)
+	}
+
+	w = serveAs(s, http.MethodDelete, "/images/1/favorite", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unfavorite status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := listFavorites(t, s); len(got.Favorites) != 0 {
+		t.Errorf("favorites after unfavorite = %+v, want none", got.Favorites)
+	}
+}
+
+func TestFavorites_DeletedImageDropped(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	serveAs(s, http.MethodPost, "/images/1/favorite", testGallerySessionID)
+	w := serveAs(s, http.MethodDelete, "/sessions/"+testGallerySessionID+"/images/1.png", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if got := listFavorites(t, s); len(got.Favorites) != 0 {
+		t.Errorf("favorites after image delete = %+v, want none", got.Favorites)
+	}
+	if ok, _ := s.favoriteStore.IsFavorite(testGallerySessionID, 1); ok {
+		t.Error("favorite kept after its image was deleted")
+	}
+}
+
+func TestFavorites_Errors(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		sessionID  string
+		wantStatus int
+	}{
+		{name: "in-memory image ID", method: http.MethodPost, path: "/images/abc123/favorite", sessionID: testGallerySessionID, wantStatus: http.StatusBadRequest},
+		{name: "missing image", method: http.MethodPost, path: "/images/99/favorite", sessionID: testGallerySessionID, wantStatus: http.StatusNotFound},
+		{name: "another session's image", method: http.MethodPost, path: "/images/1/favorite", sessionID: testDeleteSessionID, wantStatus: http.StatusNotFound},
+		{name: "unfavorite non-favorite", method: http.MethodDelete, path: "/images/1/favorite", sessionID: testGallerySessionID, wantStatus: http.StatusNotFound},
+		{name: "unfavorite invalid ID", method: http.MethodDelete, path: "/images/0/favorite", sessionID: testGallerySessionID, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAs(s, tt.method, tt.path, tt.sessionID)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
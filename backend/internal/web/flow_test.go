@@ -239,7 +239,7 @@ func TestUserFlow_ChatStreaming(t *testing.T) {
 		},
 	}
 	// Replace the ollama client with mock for testing
-	s.setOllamaClientForTesting(mockClient)
+	s.setLLMClientForTesting(mockClient)
 
 	// Send chat request without SSE connection
 	// This simulates a client disconnect scenario
@@ -0,0 +1,342 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// galleryItem is a published image as shown on the public gallery page.
+// It deliberately omits the owning session ID.
+type galleryItem struct {
+	URL         string
+	Prompt      string
+	PublishedAt time.Time
+}
+
+// galleryTemplateData holds data passed to the gallery.html template.
+// PrevURL and NextURL link to the neighbouring pages and are empty on the
+// first and last page.
+type galleryTemplateData struct {
+	Items   []galleryItem
+	Page    pageInfo
+	PrevURL string
+	NextURL string
+}
+
+// galleryImageURL returns the public URL for a published image.
+func galleryImageURL(id string) string {
+	return fmt.Sprintf("/gallery/images/%s.png", id)
+}
+
+// galleryPageURL returns the gallery URL for the request's filters at
+// another offset.
+func galleryPageURL(r *http.Request, offset int) string {
+	values := r.URL.Query()
+	values.Set("offset", strconv.Itoa(offset))
+	return "/gallery?" + values.Encode()
+}
+
+// handleGallery serves the public, read-only gallery page.
+// GET /gallery?limit=&offset=&since=&until=&prompt=
+// The time range filters on when the image was published.
+func (s *Server) handleGallery(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := s.galleryStore.List()
+	if err != nil {
+		log.Printf("Failed to list gallery: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]galleryItem, 0, len(entries))
+	for _, e := range entries {
+		if !q.matchesTime(e.PublishedAt) || !q.matchesImage(true) || !q.matchesPrompt(e.Prompt) {
+			continue
+		}
+		// Skip entries whose image has since been removed from disk
+		if !s.imageStore.Exists(e.SessionID, e.MessageID) {
+			continue
+		}
+		items = append(items, galleryItem{
+			URL:         galleryImageURL(e.ID),
+			Prompt:      e.Prompt,
+			PublishedAt: e.PublishedAt,
+		})
+	}
+
+	start, end, page := q.page(len(items))
+	data := galleryTemplateData{Items: items[start:end], Page: page}
+	if start > 0 {
+		data.PrevURL = galleryPageURL(r, max(start-q.Limit, 0))
+	}
+	if page.NextOffset > 0 {
+		data.NextURL = galleryPageURL(r, page.NextOffset)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.executeTemplate(w, "gallery.html", data); err != nil {
+		log.Printf("Failed to execute template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleGalleryImage serves a published image by its public gallery ID.
+// GET /gallery/images/{id}?format=&quality=
+// No session is required; only images explicitly published are reachable.
+// Only PNGs carry a provenance manifest.
+func (s *Server) handleGalleryImage(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(r.PathValue("id"), ".png")
+	if id == "" {
+		http.Error(w, "Missing image ID", http.StatusBadRequest)
+		return
+	}
+
+	entry, ok, err := s.galleryStore.Get(id)
+	if err != nil {
+		log.Printf("Failed to look up gallery image %s: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+
+	file, err := s.imageStore.Open(entry.SessionID, entry.MessageID)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to open gallery image %s: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	stored := persistence.StoredFormat(file.Name())
+	format, quality, err := s.imageFormat(r, stored)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		log.Printf("Failed to stat gallery image %s: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Not immutable: the owner may unpublish at any time
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	// Watermarking and signing need the whole image, so answer revalidation
+	// before reading it
+	if notModifiedSince(r, info.ModTime()) {
+		w.Header().Add("Vary", "Accept")
+		w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		log.Printf("Failed to read gallery image %s: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Watermarking and signing work on PNGs
+	if stored != image.OutputPNG && (s.watermark != nil || format == image.OutputPNG) {
+		data, err = image.Convert(data, image.OutputPNG, 0)
+		if err != nil {
+			log.Printf("Failed to convert gallery image %s: %v", id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		stored = image.OutputPNG
+	}
+
+	if s.watermark != nil {
+		data, err = s.watermark.Apply(data)
+		if err != nil {
+			log.Printf("Failed to watermark gallery image %s: %v", id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// The manifest is a PNG text chunk, which other formats drop
+	if format == image.OutputPNG {
+		data = s.signImage(data, entry.Prompt)
+	}
+
+	serveImageAs(w, r, id+".png", info.ModTime(), bytes.NewReader(data), stored, "", format, quality)
+}
+
+// notModifiedSince reports whether a GET or HEAD request's If-Modified-Since
+// header is at or after modTime, as checked by http.ServeContent.
+func notModifiedSince(r *http.Request, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have one-second resolution
+	return !modTime.Truncate(time.Second).After(since)
+}
+
+// newWatermarkCache builds the gallery watermark from CLI flags.
+// Returns nil if no watermark is configured.
+func newWatermarkCache(cfg *config.Config) (*image.WatermarkCache, error) {
+	if cfg.WatermarkText == "" && cfg.WatermarkImage == "" {
+		return nil, nil
+	}
+
+	corner, err := image.ParseCorner(cfg.WatermarkCorner)
+	if err != nil {
+		return nil, err
+	}
+	wm := image.Watermark{
+		Text:    cfg.WatermarkText,
+		Corner:  corner,
+		Opacity: cfg.WatermarkOpacity,
+	}
+	if cfg.WatermarkImage != "" {
+		info, err := os.Stat(cfg.WatermarkImage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read watermark image: %w", err)
+		}
+		if info.Size() > image.MaxImageSize {
+			return nil, fmt.Errorf("watermark image %s: %w", cfg.WatermarkImage, image.ErrImageTooLarge)
+		}
+		wm.Overlay, err = os.ReadFile(cfg.WatermarkImage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read watermark image: %w", err)
+		}
+	}
+
+	return image.NewWatermarkCache(wm, image.DefaultWatermarkCacheSize)
+}
+
+// parseOwnedSessionImage validates a /sessions/{sessionID}/images/{filename}
+// request made by the owning session and returns the session and message IDs.
+// On failure it writes the error response and returns ok=false.
+func (s *Server) parseOwnedSessionImage(w http.ResponseWriter, r *http.Request) (sessionID string, messageID int, ok bool) {
+	// SECURITY: Get authenticated session ID from context
+	authenticatedSessionID := GetSessionID(r.Context())
+	if authenticatedSessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", 0, false
+	}
+
+	requestedSessionID := r.PathValue("sessionID")
+	filename := r.PathValue("filename")
+	if requestedSessionID == "" || filename == "" {
+		http.Error(w, "Missing session ID or filename", http.StatusBadRequest)
+		return "", 0, false
+	}
+
+	// SECURITY: Only the owning session may act on its images
+	if authenticatedSessionID != requestedSessionID {
+		log.Printf("SECURITY: Session %s attempted to modify images from session %s", authenticatedSessionID, requestedSessionID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return "", 0, false
+	}
+
+	messageID, err := strconv.Atoi(strings.TrimSuffix(filename, ".png"))
+	if err != nil || messageID <= 0 {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return "", 0, false
+	}
+
+	return requestedSessionID, messageID, true
+}
+
+// handlePublishImage adds a session image to the public gallery.
+// POST /sessions/{sessionID}/images/{filename}/publish
+func (s *Server) handlePublishImage(w http.ResponseWriter, r *http.Request) {
+	sessionID, messageID, ok := s.parseOwnedSessionImage(w, r)
+	if !ok {
+		return
+	}
+
+	if !s.imageStore.Exists(sessionID, messageID) {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+
+	// Caption the image with the prompt that produced it
+	prompt := ""
+	if manager := s.sessionManager.GetSession(sessionID).ManagerForMessage(messageID); manager != nil {
+		if msg := manager.GetMessage(messageID); msg != nil && msg.Snapshot != nil {
+			prompt = msg.Snapshot.Prompt
+		}
+	}
+
+	entry, err := s.galleryStore.Publish(sessionID, messageID, prompt)
+	if err != nil {
+		if errors.Is(err, persistence.ErrGalleryFull) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(w, `{"status":"error","message":"gallery is full"}`)
+			return
+		}
+		log.Printf("Failed to publish image %s/%d: %v", sessionID, messageID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Published image %s/%d as %s", sessionID, messageID, entry.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status":"ok","id":"%s","url":"%s"}`, entry.ID, galleryImageURL(entry.ID))
+}
+
+// handleUnpublishImage removes a session image from the public gallery.
+// DELETE /sessions/{sessionID}/images/{filename}/publish
+func (s *Server) handleUnpublishImage(w http.ResponseWriter, r *http.Request) {
+	sessionID, messageID, ok := s.parseOwnedSessionImage(w, r)
+	if !ok {
+		return
+	}
+
+	removed, err := s.galleryStore.Unpublish(sessionID, messageID)
+	if err != nil {
+		log.Printf("Failed to unpublish image %s/%d: %v", sessionID, messageID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "Image not published", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Unpublished image %s/%d", sessionID, messageID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status":"ok","session_id":"%s"}`, sessionID)
+}
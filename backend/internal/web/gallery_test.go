@@ -0,0 +1,360 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+const testGallerySessionID = "aabbccddeeff00112233445566778899"
+
+// newGalleryTestServer creates a server with one persisted image on message 1.
+func newGalleryTestServer(t *testing.T, cfg *config.Config) *Server {
+	t.Helper()
+
+	store := persistence.NewImageStore(t.TempDir())
+	s, err := NewServerWithDeps("", nil, nil, nil, store, nil, cfg)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+
+	manager := s.sessionManager.GetSession(testGallerySessionID).Manager()
+	msgID := manager.AddAssistantMessage("Here you go", "a sunset", &ollama.LLMMetadata{Prompt: "a sunset"})
+	manager.UpdateMessagePreview(msgID, conversation.PreviewStatusComplete, store.GetURL(testGallerySessionID, msgID))
+	if err := store.Save(testGallerySessionID, msgID, []byte("sunset-png")); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	return s
+}
+
+// serveAs sends a request through the full handler stack with a session cookie.
+func serveAs(s *Server, method, target, sessionID string) *httptest.ResponseRecorder {
+	return serveFrom(s, method, target, sessionID, "192.0.2.1:1234")
+}
+
+// serveFrom is serveAs for a request from remoteAddr, such as a loopback
+// address for the admin routes.
+func serveFrom(s *Server, method, target, sessionID, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.RemoteAddr = remoteAddr
+	if sessionID != "" {
+		req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: sessionID})
+		req.Header.Set(CSRFHeaderName, s.csrfToken(sessionID))
+	}
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestGallery_PublishFlow(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	publishPath := "/sessions/" + testGallerySessionID + "/images/1.png/publish"
+
+	// Publish the image as its owner
+	w := serveAs(s, http.MethodPost, publishPath, testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("publish status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("publish response is not JSON: %v", err)
+	}
+	if strings.Contains(resp.URL, testGallerySessionID) {
+		t.Errorf("gallery URL %q leaks the session ID", resp.URL)
+	}
+
+	// Anyone can view the gallery and the image without a session
+	w = serveAs(s, http.MethodGet, "/gallery", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("gallery status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), resp.URL) || !strings.Contains(w.Body.String(), "a sunset") {
+		t.Errorf("gallery page missing published image or caption")
+	}
+	if strings.Contains(w.Body.String(), testGallerySessionID) {
+		t.Error("gallery page leaks the session ID")
+	}
+
+	w = serveAs(s, http.MethodGet, resp.URL, "")
+	if w.Code != http.StatusOK || w.Body.String() != "sunset-png" {
+		t.Errorf("gallery image = %d %q, want 200 with image data", w.Code, w.Body.String())
+	}
+
+	// Unpublish removes it from the gallery
+	w = serveAs(s, http.MethodDelete, publishPath, testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unpublish status = %d, want %d", w.Code, http.StatusOK)
+	}
+	w = serveAs(s, http.MethodGet, resp.URL, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unpublished image status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestGallery_PublishErrors(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		sessionID  string
+		wantStatus int
+	}{
+		{
+			name:       "other session cannot publish",
+			method:     http.MethodPost,
+			path:       "/sessions/" + testGallerySessionID + "/images/1.png/publish",
+			sessionID:  "0123456789abcdef0123456789abcdef",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "missing image",
+			method:     http.MethodPost,
+			path:       "/sessions/" + testGallerySessionID + "/images/9.png/publish",
+			sessionID:  testGallerySessionID,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid message ID",
+			method:     http.MethodPost,
+			path:       "/sessions/" + testGallerySessionID + "/images/abc/publish",
+			sessionID:  testGallerySessionID,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unpublish image that is not published",
+			method:     http.MethodDelete,
+			path:       "/sessions/" + testGallerySessionID + "/images/1.png/publish",
+			sessionID:  testGallerySessionID,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unknown gallery image",
+			method:     http.MethodGet,
+			path:       "/gallery/images/ffffffffffffffffffffffffffffffff.png",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAs(s, tt.method, tt.path, tt.sessionID)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestGallery_DeleteUnpublishes(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	if _, err := s.galleryStore.Publish(testGallerySessionID, 1, "a sunset"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	w := serveAs(s, http.MethodDelete, "/sessions/"+testGallerySessionID+"/images/1.png", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	published, err := s.galleryStore.IsPublished(testGallerySessionID, 1)
+	if err != nil || published {
+		t.Errorf("IsPublished() = %v, %v, want false after delete", published, err)
+	}
+}
+
+func TestGallery_Pagination(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	prompts := []string{"a sunset", "a mountain", "a sunset over water"}
+	for i, prompt := range prompts {
+		messageID := i + 1
+		if err := s.imageStore.Save(testGallerySessionID, messageID, []byte(prompt)); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if _, err := s.galleryStore.Publish(testGallerySessionID, messageID, prompt); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		wantPrompts []string
+		wantNext    bool
+	}{
+		{name: "first page", query: "?limit=2", wantPrompts: []string{"a sunset over water", "a mountain"}, wantNext: true},
+		{name: "second page", query: "?limit=2&offset=2", wantPrompts: []string{"a sunset"}},
+		{name: "prompt filter", query: "?prompt=SUNSET", wantPrompts: []string{"a sunset over water", "a sunset"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAs(s, http.MethodGet, "/gallery"+tt.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status code = %d, want %d", w.Code, http.StatusOK)
+			}
+			body := w.Body.String()
+			if got := strings.Count(body, "<figure"); got != len(tt.wantPrompts) {
+				t.Errorf("page has %d images, want %d", got, len(tt.wantPrompts))
+			}
+			for _, prompt := range tt.wantPrompts {
+				if !strings.Contains(body, `alt="`+prompt+`"`) {
+					t.Errorf("page is missing %q", prompt)
+				}
+			}
+			if hasNext := strings.Contains(body, "Older"); hasNext != tt.wantNext {
+				t.Errorf("next link shown = %v, want %v", hasNext, tt.wantNext)
+			}
+		})
+	}
+
+	if w := serveAs(s, http.MethodGet, "/gallery?limit=-1", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid limit status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestGallery_GalleryOnlyMode(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{GalleryOnly: true})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"gallery is served", http.MethodGet, "/gallery", http.StatusOK},
+		{"index redirects to gallery", http.MethodGet, "/", http.StatusFound},
+		{"chat is disabled", http.MethodPost, "/chat", http.StatusMethodNotAllowed},
+		{"generate is disabled", http.MethodPost, "/generate", http.StatusMethodNotAllowed},
+		{"session images are not served", http.MethodGet, "/sessions/" + testGallerySessionID + "/images/1.png", http.StatusFound},
+		{"publishing is disabled", http.MethodPost, "/sessions/" + testGallerySessionID + "/images/1.png/publish", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAs(s, tt.method, tt.path, testGallerySessionID)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestGallery_Watermark(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{WatermarkText: "weave", WatermarkOpacity: 1})
+	source, err := image.EncodePNG(64, 64, make([]byte, 64*64*3), image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	if err := s.imageStore.Save(testGallerySessionID, 1, source); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	w := serveAs(s, http.MethodPost, "/sessions/"+testGallerySessionID+"/images/1.png/publish", testGallerySessionID)
+	var resp struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("publish response is not JSON: %v", err)
+	}
+
+	w = serveAs(s, http.MethodGet, resp.URL, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("gallery image status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if bytes.Equal(w.Body.Bytes(), source) {
+		t.Error("gallery image served without watermark")
+	}
+	if s.watermark.Len() != 1 {
+		t.Errorf("watermark cache holds %d images, want 1", s.watermark.Len())
+	}
+
+	// The owner's copy is never watermarked
+	w = serveAs(s, http.MethodGet, "/sessions/"+testGallerySessionID+"/images/1.png", testGallerySessionID)
+	if !bytes.Equal(w.Body.Bytes(), source) {
+		t.Error("session image was modified by the gallery watermark")
+	}
+}
+
+func TestImageServing_Revalidation(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	w := serveAs(s, http.MethodPost, "/sessions/"+testGallerySessionID+"/images/1.png/publish", testGallerySessionID)
+	var resp struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("publish response is not JSON: %v", err)
+	}
+
+	sessionURL := "/sessions/" + testGallerySessionID + "/images/1.png"
+	for _, target := range []string{sessionURL, resp.URL} {
+		t.Run(target, func(t *testing.T) {
+			w := serveAs(s, http.MethodGet, target, testGallerySessionID)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			lastModified := w.Header().Get("Last-Modified")
+			if lastModified == "" {
+				t.Fatal("Last-Modified not set")
+			}
+
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+			req.Header.Set("If-Modified-Since", lastModified)
+			w = httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(w, req)
+			if w.Code != http.StatusNotModified {
+				t.Errorf("revalidation status = %d, want %d", w.Code, http.StatusNotModified)
+			}
+			if w.Body.Len() != 0 {
+				t.Errorf("revalidation sent %d body bytes", w.Body.Len())
+			}
+		})
+	}
+
+	// Session images support range requests for large files
+	req := httptest.NewRequest(http.MethodGet, sessionURL, nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+	req.Header.Set("Range", "bytes=0-5")
+	w = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "sunset" {
+		t.Errorf("range response = %d %q, want %d %q", w.Code, w.Body.String(), http.StatusPartialContent, "sunset")
+	}
+}
+
+func TestNewServer_InvalidWatermark(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+	}{
+		{"missing image", &config.Config{WatermarkImage: filepath.Join(t.TempDir(), "missing.png"), WatermarkOpacity: 0.5}},
+		{"zero opacity", &config.Config{WatermarkText: "weave"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := persistence.NewImageStore(t.TempDir())
+			if _, err := NewServerWithDeps("", nil, nil, nil, store, nil, tt.cfg); err == nil {
+				t.Error("NewServerWithDeps() error = nil, want watermark error")
+			}
+		})
+	}
+}
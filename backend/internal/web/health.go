@@ -0,0 +1,221 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/llm"
+)
+
+const (
+	// healthCheckTimeout bounds each dependency check in GET /healthz
+	healthCheckTimeout = 2 * time.Second
+
+	// minFreeDiskBytes is the free space below which the image store is
+	// reported as degraded
+	minFreeDiskBytes = 100 * 1024 * 1024
+)
+
+// Dependency statuses reported by GET /healthz. Only healthFail makes the
+// overall status degraded.
+const (
+	healthOK       = "ok"
+	healthBusy     = "busy"
+	healthDisabled = "disabled"
+	healthSkipped  = "skipped"
+	healthFail     = "fail"
+)
+
+// healthCheck is the status of one dependency.
+type healthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	// Ollama
+	Model string `json:"model,omitempty"`
+
+	// Compute
+	Pending           *int           `json:"pending,omitempty"`
+	HeartbeatFailures *int           `json:"heartbeat_failures,omitempty"`
+	Workers           []workerHealth `json:"workers,omitempty"`
+
+	// Disk
+	Path       string  `json:"path,omitempty"`
+	FreeBytes  *uint64 `json:"free_bytes,omitempty"`
+	UsedBytes  *int64  `json:"used_bytes,omitempty"`
+	LimitBytes *int64  `json:"limit_bytes,omitempty"`
+
+	// SSE
+	Connections    *int `json:"connections,omitempty"`
+	MaxConnections *int `json:"max_connections,omitempty"`
+}
+
+// workerHealth is the status of one compute process of a pool, with
+// --compute-workers.
+type workerHealth struct {
+	Status  string `json:"status"`
+	Pending int    `json:"pending"`
+	Served  uint64 `json:"served"`
+}
+
+// healthResponse is the response for GET /healthz.
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+// handleHealthz reports the status of each dependency: ollama and its
+// model, the compute process, free disk space and usage of the image
+// store, and SSE connections. It returns 503 when any dependency fails. A compute process
+// that is busy with a generation and doesn't answer the ping in time is
+// reported as busy, not failed.
+// GET /healthz
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	var ollamaHealth, computeHealth healthCheck
+	var wg sync.WaitGroup
+	wg.Go(func() { ollamaHealth = s.checkOllama(ctx) })
+	wg.Go(func() { computeHealth = s.checkCompute(ctx) })
+	wg.Wait()
+
+	disk := checkDisk(s.imageStore.BasePath())
+	s.checkStorageQuota(&disk)
+
+	resp := healthResponse{
+		Status: healthOK,
+		Checks: map[string]healthCheck{
+			"ollama":  ollamaHealth,
+			"compute": computeHealth,
+			"disk":    disk,
+			"sse":     s.checkSSE(),
+		},
+	}
+	code := http.StatusOK
+	for _, check := range resp.Checks {
+		if check.Status == healthFail {
+			resp.Status = "degraded"
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode health response: %v", err)
+	}
+}
+
+// checkOllama checks that ollama is reachable and the model is available.
+func (s *Server) checkOllama(ctx context.Context) healthCheck {
+	if s.galleryOnly {
+		return healthCheck{Status: healthDisabled}
+	}
+	if s.llmClient == nil {
+		return healthCheck{Status: healthFail, Error: "ollama client not configured"}
+	}
+	checker, ok := s.llmClient.(llm.Checker)
+	if !ok {
+		return healthCheck{Status: healthSkipped}
+	}
+	if err := checker.Connect(ctx); err != nil {
+		return healthCheck{Status: healthFail, Model: checker.Model(), Error: err.Error()}
+	}
+	return healthCheck{Status: healthOK, Model: checker.Model()}
+}
+
+// checkCompute pings the compute process.
+func (s *Server) checkCompute(ctx context.Context) healthCheck {
+	if s.galleryOnly {
+		return healthCheck{Status: healthDisabled}
+	}
+	if s.computeClient == nil {
+		return healthCheck{Status: healthFail, Error: "compute not connected"}
+	}
+	return pingCompute(ctx, s.computeClient)
+}
+
+// pingCompute pings conn. The ping waits behind requests already sent, so a
+// timeout while requests are pending means compute is busy. Failed
+// heartbeat pings are reported too.
+func pingCompute(ctx context.Context, conn *client.Conn) healthCheck {
+	pending := conn.Pending()
+	err := conn.Ping(ctx)
+	var check healthCheck
+	switch {
+	case err == nil:
+		check = healthCheck{Status: healthOK, Pending: &pending}
+	case pending > 0 && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, client.ErrReadTimeout)):
+		check = healthCheck{Status: healthBusy, Pending: &pending}
+	default:
+		check = healthCheck{Status: healthFail, Pending: &pending, Error: err.Error()}
+	}
+
+	// Heartbeat pings find a compute process that stopped answering
+	// between checks; its connection is closed once they keep failing
+	if failures, err := conn.HeartbeatFailures(); failures > 0 {
+		check.HeartbeatFailures = &failures
+		if failures >= client.MaxHeartbeatFailures {
+			check.Status = healthFail
+			check.Error = err.Error()
+		}
+	}
+
+	// A pool also reports each worker, as of after the ping
+	for _, w := range conn.Workers() {
+		status := healthOK
+		if !w.Healthy {
+			status = healthFail
+		}
+		check.Workers = append(check.Workers, workerHealth{Status: status, Pending: w.Pending, Served: w.Served})
+	}
+	return check
+}
+
+// checkDisk reports the free space on the filesystem holding path. The
+// image store directory is created on first save, so the nearest existing
+// parent is checked.
+func checkDisk(path string) healthCheck {
+	dir := path
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	free, err := freeDiskBytes(dir)
+	if err != nil {
+		return healthCheck{Status: healthFail, Path: path, Error: err.Error()}
+	}
+
+	check := healthCheck{Status: healthOK, Path: path, FreeBytes: &free}
+	if free < minFreeDiskBytes {
+		check.Status = healthFail
+		check.Error = "low disk space"
+	}
+	return check
+}
+
+// checkSSE reports SSE connections. The broker failing new connections at
+// its limit counts as degraded.
+func (s *Server) checkSSE() healthCheck {
+	connections := s.broker.ConnectionCount()
+	maxConnections := MaxConnections
+	check := healthCheck{Status: healthOK, Connections: &connections, MaxConnections: &maxConnections}
+	if connections >= maxConnections {
+		check.Status = healthFail
+		check.Error = "connection limit reached"
+	}
+	return check
+}
@@ -0,0 +1,240 @@
+package web
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/llm"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// checkingOllamaClient is an ollama client whose Connect returns err.
+type checkingOllamaClient struct {
+	mockOllamaClient
+	err error
+}
+
+func (c *checkingOllamaClient) Connect(ctx context.Context) error { return c.err }
+func (c *checkingOllamaClient) Model() string                     { return "test-model" }
+
+// fakeComputeConn returns a compute connection to a fake compute process
+// that answers pings when answer is true and otherwise never responds.
+func fakeComputeConn(t *testing.T, answer bool) *client.Conn {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "compute.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			request := make([]byte, 24)
+			if _, err := io.ReadFull(conn, request); err != nil {
+				return
+			}
+			if !answer {
+				continue
+			}
+			binary.BigEndian.PutUint16(request[6:8], protocol.MsgPong)
+			conn.Write(request)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := client.AcceptConnection(ctx, listener)
+	if err != nil {
+		t.Fatalf("AcceptConnection() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestHandleHealthz(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         *config.Config
+		ollama      llm.Client
+		compute     func(t *testing.T) *client.Conn
+		wantCode    int
+		wantStatus  string
+		wantOllama  string
+		wantCompute string
+	}{
+		{
+			name:        "healthy",
+			ollama:      &checkingOllamaClient{},
+			compute:     func(t *testing.T) *client.Conn { return fakeComputeConn(t, true) },
+			wantCode:    http.StatusOK,
+			wantStatus:  "ok",
+			wantOllama:  healthOK,
+			wantCompute: healthOK,
+		},
+		{
+			name:        "ollama model missing",
+			ollama:      &checkingOllamaClient{err: ollama.ErrModelNotFound},
+			compute:     func(t *testing.T) *client.Conn { return fakeComputeConn(t, true) },
+			wantCode:    http.StatusServiceUnavailable,
+			wantStatus:  "degraded",
+			wantOllama:  healthFail,
+			wantCompute: healthOK,
+		},
+		{
+			name:        "compute not connected",
+			ollama:      &checkingOllamaClient{},
+			wantCode:    http.StatusServiceUnavailable,
+			wantStatus:  "degraded",
+			wantOllama:  healthOK,
+			wantCompute: healthFail,
+		},
+		{
+			name:        "compute not responding",
+			ollama:      &checkingOllamaClient{},
+			compute:     func(t *testing.T) *client.Conn { return fakeComputeConn(t, false) },
+			wantCode:    http.StatusServiceUnavailable,
+			wantStatus:  "degraded",
+			wantOllama:  healthOK,
+			wantCompute: healthFail,
+		},
+		{
+			name:        "ollama client without checks",
+			ollama:      &mockOllamaClient{},
+			compute:     func(t *testing.T) *client.Conn { return fakeComputeConn(t, true) },
+			wantCode:    http.StatusOK,
+			wantStatus:  "ok",
+			wantOllama:  healthSkipped,
+			wantCompute: healthOK,
+		},
+		{
+			name:        "gallery-only",
+			cfg:         &config.Config{GalleryOnly: true},
+			wantCode:    http.StatusOK,
+			wantStatus:  "ok",
+			wantOllama:  healthDisabled,
+			wantCompute: healthDisabled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, tt.cfg)
+			s.llmClient = tt.ollama
+			if tt.compute != nil {
+				s.computeClient = tt.compute(t)
+			}
+
+			w := serveAs(s, http.MethodGet, "/healthz", "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+
+			var resp healthResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", resp.Status, tt.wantStatus)
+			}
+			if got := resp.Checks["ollama"].Status; got != tt.wantOllama {
+				t.Errorf("ollama status = %q, want %q", got, tt.wantOllama)
+			}
+			if got := resp.Checks["compute"].Status; got != tt.wantCompute {
+				t.Errorf("compute status = %q, want %q", got, tt.wantCompute)
+			}
+			if got := resp.Checks["disk"].Status; got != healthOK {
+				t.Errorf("disk status = %q, want %q", got, healthOK)
+			}
+			if sse := resp.Checks["sse"]; sse.Status != healthOK || sse.Connections == nil || *sse.Connections != 0 {
+				t.Errorf("sse = %+v, want ok with 0 connections", sse)
+			}
+		})
+	}
+}
+
+func TestPingCompute_BusyWhenPending(t *testing.T) {
+	conn := fakeComputeConn(t, false)
+
+	// A generation that compute never answers holds the queue
+	genCtx, cancelGen := context.WithCancel(context.Background())
+	defer cancelGen()
+	go conn.Send(genCtx, make([]byte, 24))
+	for conn.Pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	check := pingCompute(ctx, conn)
+	if check.Status != healthBusy {
+		t.Errorf("status = %q, want %q (error %q)", check.Status, healthBusy, check.Error)
+	}
+}
+
+func TestPingCompute_Workers(t *testing.T) {
+	up, down := fakeComputeConn(t, true), fakeComputeConn(t, true)
+	down.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	check := pingCompute(ctx, client.NewPool(up, down))
+	if check.Status != healthOK {
+		t.Errorf("status = %q, want %q with one worker up (error %q)", check.Status, healthOK, check.Error)
+	}
+	if len(check.Workers) != 2 || check.Workers[0].Status != healthOK || check.Workers[1].Status != healthFail {
+		t.Errorf("workers = %+v, want the first ok and the second failed", check.Workers)
+	}
+	if single := pingCompute(ctx, up); single.Workers != nil {
+		t.Errorf("workers = %+v for a single compute process, want none", single.Workers)
+	}
+}
+
+func TestPingCompute_HeartbeatLost(t *testing.T) {
+	conn := fakeComputeConn(t, false)
+	conn.StartHeartbeat(10 * time.Millisecond)
+	select {
+	case <-conn.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("heartbeat did not close the connection")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	check := pingCompute(ctx, conn)
+	if check.Status != healthFail || !strings.Contains(check.Error, "stopped answering pings") {
+		t.Errorf("status = %q, error = %q, want fail for lost heartbeat", check.Status, check.Error)
+	}
+	if check.HeartbeatFailures == nil || *check.HeartbeatFailures != client.MaxHeartbeatFailures {
+		t.Errorf("HeartbeatFailures = %v, want %d", check.HeartbeatFailures, client.MaxHeartbeatFailures)
+	}
+}
+
+func TestCheckDisk_MissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not", "created")
+
+	check := checkDisk(path)
+	if check.Status != healthOK {
+		t.Errorf("status = %q, want %q (error %q)", check.Status, healthOK, check.Error)
+	}
+	if check.FreeBytes == nil || *check.FreeBytes == 0 {
+		t.Error("FreeBytes not reported")
+	}
+}
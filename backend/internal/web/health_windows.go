@@ -0,0 +1,19 @@
+//go:build windows
+
+package web
+
+import "golang.org/x/sys/windows"
+
+// freeDiskBytes returns the bytes available to weave on the volume holding
+// dir.
+func freeDiskBytes(dir string) (uint64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
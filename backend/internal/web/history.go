@@ -0,0 +1,84 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+)
+
+// historyMessage is a conversation message plus the URL of its stored image.
+// ImageURL is only set when the message has a persisted image.
+type historyMessage struct {
+	conversation.ConversationMessage
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// historyResponse is the response for GET /history.
+type historyResponse struct {
+	Status    string           `json:"status"`
+	SessionID string           `json:"session_id"`
+	ChatID    string           `json:"chat_id"`
+	Messages  []historyMessage `json:"messages"`
+	Page      pageInfo         `json:"page"`
+}
+
+// handleHistory lists a chat's messages, oldest first.
+// GET /history?chat_id=&limit=&offset=&since=&until=&has_image=&prompt=
+//
+// chat_id defaults to the active chat. The prompt filter matches the
+// snapshot prompt, so it only returns messages that set one.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	chatID, manager := resolveChat(session, r.URL.Query().Get("chat_id"))
+	if manager == nil {
+		http.Error(w, "Chat not found", http.StatusNotFound)
+		return
+	}
+
+	var matched []historyMessage
+	for _, msg := range manager.GetMessages() {
+		hasImage := s.imageStore.Exists(sessionID, msg.ID)
+		prompt := ""
+		if msg.Snapshot != nil {
+			prompt = msg.Snapshot.Prompt
+		}
+		if !q.matchesTime(msg.CreatedAt) || !q.matchesImage(hasImage) || !q.matchesPrompt(prompt) {
+			continue
+		}
+
+		item := historyMessage{ConversationMessage: msg}
+		if hasImage {
+			item.ImageURL = s.imageStore.GetURL(sessionID, msg.ID)
+		}
+		matched = append(matched, item)
+	}
+
+	start, end, page := q.page(len(matched))
+	resp := historyResponse{
+		Status:    "ok",
+		SessionID: sessionID,
+		ChatID:    chatID,
+		Messages:  append([]historyMessage{}, matched[start:end]...),
+		Page:      page,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode history response: %v", err)
+	}
+}
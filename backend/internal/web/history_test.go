@@ -0,0 +1,108 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+func getHistory(t *testing.T, s *Server, query string) historyResponse {
+	t.Helper()
+
+	w := serveAs(s, http.MethodGet, "/history"+query, testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("history status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp historyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("history response is not JSON: %v", err)
+	}
+	return resp
+}
+
+func TestHistory_Filters(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	manager := s.sessionManager.GetSession(testGallerySessionID).Manager()
+	manager.AddUserMessage("make it a mountain")
+	manager.AddAssistantMessage("Sure", "a mountain", &ollama.LLMMetadata{Prompt: "a mountain"})
+
+	tests := []struct {
+		name    string
+		query   string
+		wantIDs []int
+	}{
+		{name: "all", query: "", wantIDs: []int{1, 2, 3}},
+		{name: "has image", query: "?has_image=true", wantIDs: []int{1}},
+		{name: "without image", query: "?has_image=false", wantIDs: []int{2, 3}},
+		{name: "prompt contains", query: "?prompt=MOUNT", wantIDs: []int{3}},
+		{name: "future range", query: "?since=2999-01-01", wantIDs: nil},
+		{name: "current range", query: "?since=2000-01-01&until=2999-01-01", wantIDs: []int{1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getHistory(t, s, tt.query)
+			if len(got.Messages) != len(tt.wantIDs) {
+				t.Fatalf("messages = %+v, want IDs %v", got.Messages, tt.wantIDs)
+			}
+			for i, msg := range got.Messages {
+				if msg.ID != tt.wantIDs[i] {
+					t.Errorf("messages[%d].ID = %d, want %d", i, msg.ID, tt.wantIDs[i])
+				}
+			}
+		})
+	}
+
+	if got := getHistory(t, s, "?has_image=true"); got.Messages[0].ImageURL != s.imageStore.GetURL(testGallerySessionID, 1) {
+		t.Errorf("image_url = %q, want the stored image URL", got.Messages[0].ImageURL)
+	}
+}
+
+func TestHistory_Pagination(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	manager := s.sessionManager.GetSession(testGallerySessionID).Manager()
+	for i := 0; i < 4; i++ {
+		manager.AddUserMessage("more")
+	}
+
+	first := getHistory(t, s, "?limit=2")
+	if len(first.Messages) != 2 || first.Messages[0].ID != 1 {
+		t.Fatalf("first page = %+v, want messages 1-2", first.Messages)
+	}
+	if first.Page.Total != 5 || first.Page.NextOffset != 2 {
+		t.Errorf("first page info = %+v, want total 5, next offset 2", first.Page)
+	}
+
+	last := getHistory(t, s, "?limit=2&offset=4")
+	if len(last.Messages) != 1 || last.Messages[0].ID != 5 {
+		t.Fatalf("last page = %+v, want message 5", last.Messages)
+	}
+	if last.Page.NextOffset != 0 {
+		t.Errorf("last page next offset = %d, want 0", last.Page.NextOffset)
+	}
+}
+
+func TestHistory_Errors(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{name: "unknown chat", query: "?chat_id=nope", wantStatus: http.StatusNotFound},
+		{name: "invalid limit", query: "?limit=abc", wantStatus: http.StatusBadRequest},
+		{name: "invalid since", query: "?since=soon", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAs(s, http.MethodGet, "/history"+tt.query, testGallerySessionID)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/hooks"
+)
+
+// TestHooks_PrePromptRejectsMessage verifies a failing pre-prompt hook
+// stops the message before it reaches the LLM.
+func TestHooks_PrePromptRejectsMessage(t *testing.T) {
+	s, err := NewServer("")
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	var gotMessage string
+	s.Hooks().Register(hooks.EventPrePrompt, hooks.HookFunc(func(ctx context.Context, p hooks.Payload) error {
+		gotMessage = p.Message
+		return errors.New("blocked")
+	}))
+
+	mockClient := &mockOllamaClient{err: errors.New("LLM should not be called")}
+	s.setLLMClientForTesting(mockClient)
+
+	req := httptest.NewRequest("POST", "/chat", strings.NewReader("message=draw+a+cat"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(setSessionID(req.Context(), "test-hook-session"))
+	w := httptest.NewRecorder()
+
+	s.handleChat(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status code = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if gotMessage != "draw a cat" {
+		t.Errorf("hook message = %q, want %q", gotMessage, "draw a cat")
+	}
+	if history := s.sessionManager.GetOrCreate("test-hook-session").GetHistory(); len(history) != 0 {
+		t.Errorf("history length = %d, want 0", len(history))
+	}
+}
+
+// TestHooks_PreGenerateCancelsGeneration verifies a failing pre-generate
+// hook cancels generation before the compute process is contacted.
+func TestHooks_PreGenerateCancelsGeneration(t *testing.T) {
+	s, err := NewServer("")
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	var got hooks.Payload
+	s.Hooks().Register(hooks.EventPreGenerate, hooks.HookFunc(func(ctx context.Context, p hooks.Payload) error {
+		got = p
+		return errors.New("blocked")
+	}))
+
+	req := httptest.NewRequest("POST", "/generate", strings.NewReader("prompt=a+red+fox&steps=8&cfg=2.0&seed=7"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(setSessionID(req.Context(), "test-hook-generate"))
+	w := httptest.NewRecorder()
+
+	s.handleGenerate(w, req)
+
+	// Without a hook the nil compute client would produce 503; the hook fails first
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status code = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if got.Prompt != "a red fox" || got.Steps != 8 || got.Seed != 7 {
+		t.Errorf("hook payload = %+v, want prompt/steps/seed from request", got)
+	}
+}
+
+func TestNewServerWithDeps_ConfiguredWebhook(t *testing.T) {
+	cfg := &config.Config{
+		Steps:        20,
+		CFG:          3.5,
+		Width:        1024,
+		Height:       1024,
+		HookURL:      "http://localhost:9000/hook",
+		HookEvents:   "pre-generate,post-save",
+		HookTimeout:  hooks.DefaultTimeout,
+		Webhooks:     []string{"http://localhost:9001/done", "https://example.com/weave"},
+		PostSaveExec: "scripts/sync.sh",
+	}
+
+	s, err := NewServerWithDeps("", nil, nil, nil, nil, nil, cfg)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+
+	wantCounts := map[hooks.Event]int{
+		hooks.EventPrePrompt:      0,
+		hooks.EventPreGenerate:    1,
+		hooks.EventPostGenerate:   0,
+		hooks.EventPostSave:       4,
+		hooks.EventGenerateFailed: 2,
+	}
+	for event, want := range wantCounts {
+		if got := s.Hooks().Count(event); got != want {
+			t.Errorf("Count(%s) = %d, want %d", event, got, want)
+		}
+	}
+}
+
+// TestHooks_GenerateFailed verifies a failed generation fires
+// generate-failed hooks with the prompt, settings and error.
+func TestHooks_GenerateFailed(t *testing.T) {
+	s, err := NewServer("")
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	var got hooks.Payload
+	s.Hooks().Register(hooks.EventGenerateFailed, hooks.HookFunc(func(ctx context.Context, p hooks.Payload) error {
+		got = p
+		return nil
+	}))
+
+	req := httptest.NewRequest("POST", "/generate", strings.NewReader("prompt=a+red+fox&steps=8&cfg=2.0&seed=7"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(setSessionID(req.Context(), "test-hook-failed"))
+	w := httptest.NewRecorder()
+
+	// No compute client, so generation fails
+	s.handleGenerate(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status code = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got.Event != hooks.EventGenerateFailed || got.SessionID != "test-hook-failed" {
+		t.Errorf("hook payload = %+v, want generate-failed for the session", got)
+	}
+	if got.Prompt != "a red fox" || got.Steps != 8 || got.CFG != 2.0 || got.Seed != 7 {
+		t.Errorf("hook payload = %+v, want prompt and settings from request", got)
+	}
+	if got.Error == "" {
+		t.Error("hook payload has no error")
+	}
+}
@@ -0,0 +1,184 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+const testDeleteSessionID = "0123456789abcdef0123456789abcdef"
+
+func TestHandleDeleteImage(t *testing.T) {
+	storage := image.NewStorage()
+	s, err := NewServerWithDeps("", nil, nil, storage, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+
+	id, err := storage.Store(testDeleteSessionID, []byte{0x89, 0x50, 0x4E, 0x47}, 64, 64)
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	events := recordEvents(s, testDeleteSessionID)
+
+	tests := []struct {
+		name       string
+		sessionID  string
+		id         string
+		wantStatus int
+	}{
+		{name: "other session is forbidden", sessionID: "fedcba9876543210fedcba9876543210", id: id, wantStatus: http.StatusForbidden},
+		{name: "existing image with extension", sessionID: testDeleteSessionID, id: id + ".png", wantStatus: http.StatusOK},
+		{name: "already deleted", sessionID: testDeleteSessionID, id: id, wantStatus: http.StatusNotFound},
+		{name: "unknown image", sessionID: testDeleteSessionID, id: "not-an-image", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/images/"+tt.id, nil)
+			req.SetPathValue("id", tt.id)
+			req = req.WithContext(setSessionID(req.Context(), tt.sessionID))
+			w := httptest.NewRecorder()
+
+			s.handleDeleteImage(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK {
+				var resp map[string]string
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp["session_id"] != testDeleteSessionID {
+					t.Errorf("response = %s, %v, want the owning session", w.Body.String(), err)
+				}
+			}
+		})
+	}
+
+	if storage.Count() != 0 {
+		t.Errorf("storage count = %d, want 0", storage.Count())
+	}
+	want := `event: image-deleted
+data: {"url":"/images/` + id + `.png"}`
+	if !strings.Contains(events.Body.String(), want) {
+		t.Errorf("events = %q, want an image-deleted event without a message ID", events.Body.String())
+	}
+}
+
+func TestHandleDeleteSessionImage(t *testing.T) {
+	tests := []struct {
+		name              string
+		authSessionID     string
+		pathSessionID     string
+		messageID         string
+		saveImage         bool
+		wantStatus        int
+		wantPreviewStatus string
+	}{
+		{
+			name:              "deletes image and resets preview",
+			authSessionID:     testDeleteSessionID,
+			pathSessionID:     testDeleteSessionID,
+			messageID:         "1",
+			saveImage:         true,
+			wantStatus:        http.StatusOK,
+			wantPreviewStatus: conversation.PreviewStatusNone,
+		},
+		{
+			name:              "accepts png suffix",
+			authSessionID:     testDeleteSessionID,
+			pathSessionID:     testDeleteSessionID,
+			messageID:         "1.png",
+			saveImage:         true,
+			wantStatus:        http.StatusOK,
+			wantPreviewStatus: conversation.PreviewStatusNone,
+		},
+		{
+			name:              "missing image",
+			authSessionID:     testDeleteSessionID,
+			pathSessionID:     testDeleteSessionID,
+			messageID:         "1",
+			saveImage:         false,
+			wantStatus:        http.StatusNotFound,
+			wantPreviewStatus: conversation.PreviewStatusComplete,
+		},
+		{
+			name:              "other session is forbidden",
+			authSessionID:     "fedcba9876543210fedcba9876543210",
+			pathSessionID:     testDeleteSessionID,
+			messageID:         "1",
+			saveImage:         true,
+			wantStatus:        http.StatusForbidden,
+			wantPreviewStatus: conversation.PreviewStatusComplete,
+		},
+		{
+			name:              "invalid message ID",
+			authSessionID:     testDeleteSessionID,
+			pathSessionID:     testDeleteSessionID,
+			messageID:         "abc",
+			saveImage:         false,
+			wantStatus:        http.StatusBadRequest,
+			wantPreviewStatus: conversation.PreviewStatusComplete,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := persistence.NewImageStore(t.TempDir())
+			s, err := NewServerWithDeps("", nil, nil, nil, store, nil, nil)
+			if err != nil {
+				t.Fatalf("NewServerWithDeps() error = %v", err)
+			}
+
+			manager := s.sessionManager.GetSession(testDeleteSessionID).Manager()
+			msgID := manager.AddAssistantMessage("Here you go", "a cat", &ollama.LLMMetadata{Prompt: "a cat"})
+			manager.UpdateMessagePreview(msgID, conversation.PreviewStatusComplete, store.GetURL(testDeleteSessionID, msgID))
+
+			if tt.saveImage {
+				if err := store.Save(testDeleteSessionID, msgID, []byte{0x89, 0x50, 0x4E, 0x47}); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/sessions/"+tt.pathSessionID+"/images/"+tt.messageID, nil)
+			req.SetPathValue("sessionID", tt.pathSessionID)
+			req.SetPathValue("filename", tt.messageID)
+			req = req.WithContext(setSessionID(req.Context(), tt.authSessionID))
+			w := httptest.NewRecorder()
+
+			s.handleDeleteSessionImage(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus == http.StatusOK && store.Exists(testDeleteSessionID, msgID) {
+				t.Error("image still exists after delete")
+			}
+
+			msg := manager.GetMessage(msgID)
+			if msg.Snapshot.PreviewStatus != tt.wantPreviewStatus {
+				t.Errorf("PreviewStatus = %q, want %q", msg.Snapshot.PreviewStatus, tt.wantPreviewStatus)
+			}
+		})
+	}
+}
+
+func TestDeleteImageRoutes(t *testing.T) {
+	s, err := NewServer("")
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	w := serveAs(s, http.MethodDelete, "/images/00000000-0000-0000-0000-000000000000.png", testGallerySessionID)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("DELETE /images/{id} status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
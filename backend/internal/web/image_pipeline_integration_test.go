@@ -46,7 +46,7 @@ func TestImagePipeline_EndToEnd(t *testing.T) {
 	}
 
 	// 2. Store image
-	imageID, err := storage.Store(pngData, width, height)
+	imageID, err := storage.Store("", pngData, width, height)
 	if err != nil {
 		t.Fatalf("Store failed: %v", err)
 	}
@@ -114,7 +114,7 @@ func TestImagePipeline_FullWorkflow(t *testing.T) {
 			t.Fatalf("EncodePNG failed: %v", err)
 		}
 
-		imageID, err := storage.Store(pngData, 32, 32)
+		imageID, err := storage.Store("", pngData, 32, 32)
 		if err != nil {
 			t.Fatalf("Store failed: %v", err)
 		}
@@ -0,0 +1,162 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/image"
+)
+
+// imageFormat returns the format and quality to serve an image stored in
+// stored in: the format and quality query parameters if given, otherwise
+// the format negotiated from the Accept header at the configured quality.
+func (s *Server) imageFormat(r *http.Request, stored image.OutputFormat) (image.OutputFormat, int, error) {
+	quality := s.imageQuality
+	if value := r.URL.Query().Get("quality"); value != "" {
+		q, err := strconv.Atoi(value)
+		if err != nil || q < image.MinQuality || q > image.MaxQuality {
+			return "", 0, fmt.Errorf("quality must be between %d and %d", image.MinQuality, image.MaxQuality)
+		}
+		quality = q
+	}
+
+	if name := r.URL.Query().Get("format"); name != "" {
+		format, err := image.ParseOutputFormat(name)
+		if err != nil {
+			return "", 0, err
+		}
+		return format, quality, nil
+	}
+	return negotiateImageFormat(r.Header.Get("Accept"), stored), quality, nil
+}
+
+// negotiateImageFormat picks the format an Accept header ranks highest.
+// The stored format wins ties, so it is served without converting: browsers
+// accept image/* or */* as well as WebP and keep getting the stored format,
+// while clients that rank another format higher, or don't accept the
+// stored one, get that. Falls back to the stored format if none is
+// acceptable.
+func negotiateImageFormat(accept string, stored image.OutputFormat) image.OutputFormat {
+	best, bestQuality := stored, 0.0
+	if accept == "" {
+		return best
+	}
+	for _, format := range []image.OutputFormat{stored, image.OutputPNG, image.OutputWebP, image.OutputJPEG} {
+		if q := acceptQuality(accept, format.ContentType()); q > bestQuality {
+			best, bestQuality = format, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the q-value an Accept header gives a media type:
+// that of the most specific media range matching it, or 0 if none does.
+func acceptQuality(accept, mediaType string) float64 {
+	majorType, _, _ := strings.Cut(mediaType, "/")
+
+	quality, specificity := 0.0, -1
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		var rangeSpecificity int
+		switch strings.ToLower(strings.TrimSpace(params[0])) {
+		case mediaType:
+			rangeSpecificity = 2
+		case majorType + "/*":
+			rangeSpecificity = 1
+		case "*/*":
+			rangeSpecificity = 0
+		default:
+			continue
+		}
+		if rangeSpecificity < specificity {
+			continue
+		}
+
+		rangeQuality := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					rangeQuality = q
+				}
+			}
+		}
+		quality, specificity = rangeQuality, rangeSpecificity
+	}
+	return quality
+}
+
+// serveImageAs serves an image stored in stored in format with
+// http.ServeContent. The image is only converted once the request's
+// preconditions have been checked, so revalidations are answered without
+// re-encoding it. hash is the stored image's ContentHash, from which the
+// ETag is derived; "" sends no ETag. The caller sets Cache-Control.
+func serveImageAs(w http.ResponseWriter, r *http.Request, name string, modTime time.Time, data io.ReadSeeker, stored image.OutputFormat, hash string, format image.OutputFormat, quality int) {
+	// The format can depend on the Accept header
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", format.ContentType())
+
+	if format == stored {
+		if hash != "" {
+			w.Header().Set("ETag", contentETag(hash))
+		}
+		http.ServeContent(w, r, name, modTime, data)
+		return
+	}
+
+	if hash != "" {
+		w.Header().Set("ETag", contentETag(fmt.Sprintf("%s-%s-%d", hash, format, quality)))
+	}
+	name = strings.TrimSuffix(name, ".png") + format.Extension()
+	http.ServeContent(w, r, name, modTime, &convertedImage{source: data, format: format, quality: quality})
+}
+
+// convertedImage is an io.ReadSeeker over an image converted to another
+// format, which is only converted when first read or seeked.
+type convertedImage struct {
+	source  io.ReadSeeker
+	format  image.OutputFormat
+	quality int
+
+	converted *bytes.Reader
+}
+
+// Read implements io.Reader.
+func (c *convertedImage) Read(p []byte) (int, error) {
+	if err := c.convert(); err != nil {
+		return 0, err
+	}
+	return c.converted.Read(p)
+}
+
+// Seek implements io.Seeker.
+func (c *convertedImage) Seek(offset int64, whence int) (int64, error) {
+	if err := c.convert(); err != nil {
+		return 0, err
+	}
+	return c.converted.Seek(offset, whence)
+}
+
+// convert converts the image on first use.
+func (c *convertedImage) convert() error {
+	if c.converted != nil {
+		return nil
+	}
+	source, err := io.ReadAll(c.source)
+	if err != nil {
+		return err
+	}
+	data, err := image.Convert(source, c.format, c.quality)
+	if err != nil {
+		log.Printf("Failed to convert image to %s: %v", c.format, err)
+		return err
+	}
+	c.converted = bytes.NewReader(data)
+	return nil
+}
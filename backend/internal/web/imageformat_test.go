@@ -0,0 +1,153 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gen2brain/webp"
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+func TestNegotiateImageFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		stored image.OutputFormat
+		want   image.OutputFormat
+	}{
+		{name: "no header", accept: "", want: image.OutputPNG},
+		{name: "browser img", accept: "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8", want: image.OutputPNG},
+		{name: "any", accept: "*/*", want: image.OutputPNG},
+		{name: "webp only", accept: "image/webp", want: image.OutputWebP},
+		{name: "webp preferred", accept: "image/webp, image/png;q=0.5", want: image.OutputWebP},
+		{name: "png excluded", accept: "image/png;q=0, image/*", want: image.OutputWebP},
+		{name: "jpeg only", accept: "image/jpeg", want: image.OutputJPEG},
+		{name: "nothing acceptable", accept: "text/html", want: image.OutputPNG},
+		{name: "stored webp to browser", accept: "image/avif,image/webp,*/*", stored: image.OutputWebP, want: image.OutputWebP},
+		{name: "stored webp to png client", accept: "image/png", stored: image.OutputWebP, want: image.OutputPNG},
+		{name: "stored jpeg without header", accept: "", stored: image.OutputJPEG, want: image.OutputJPEG},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := tt.stored
+			if stored == "" {
+				stored = image.OutputPNG
+			}
+			if got := negotiateImageFormat(tt.accept, stored); got != tt.want {
+				t.Errorf("negotiateImageFormat(%q, %s) = %q, want %q", tt.accept, stored, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleImage_Format(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{ImageQuality: 80})
+	pngData, err := image.EncodePNG(2, 2, make([]byte, 2*2*3), image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	id, err := s.imageStorage.Store("", pngData, 2, 2)
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	png := get("/images/"+id, "image/avif,image/webp,*/*")
+	if png.Code != http.StatusOK || png.Header().Get("Content-Type") != "image/png" || !bytes.Equal(png.Body.Bytes(), pngData) {
+		t.Fatalf("GET /images/%s from a browser = %d %s, want the PNG", id, png.Code, png.Header().Get("Content-Type"))
+	}
+
+	for _, tt := range []struct{ target, accept string }{
+		{"/images/" + id + "?format=webp", ""},
+		{"/images/" + id, "image/webp"},
+	} {
+		w := get(tt.target, tt.accept)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/webp" {
+			t.Fatalf("GET %s (Accept %q) = %d %s, want a WebP", tt.target, tt.accept, w.Code, w.Header().Get("Content-Type"))
+		}
+		if _, err := webp.Decode(bytes.NewReader(w.Body.Bytes())); err != nil {
+			t.Errorf("GET %s body is not a WebP: %v", tt.target, err)
+		}
+		if w.Header().Get("ETag") == png.Header().Get("ETag") {
+			t.Errorf("GET %s ETag = PNG's %s, want a different one", tt.target, w.Header().Get("ETag"))
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("GET %s Vary = %q, want Accept", tt.target, w.Header().Get("Vary"))
+		}
+	}
+
+	// Revalidation is answered without converting again
+	webpETag := get("/images/"+id+"?format=webp", "").Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, "/images/"+id+"?format=webp", nil)
+	req.Header.Set("If-None-Match", webpETag)
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	// Other qualities are other representations
+	if etag := get("/images/"+id+"?format=webp&quality=40", "").Header().Get("ETag"); etag == webpETag {
+		t.Errorf("quality 40 ETag = quality 80's %s, want a different one", etag)
+	}
+
+	// Session images too
+	if err := s.imageStore.Save(testGallerySessionID, 1, pngData); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	target := "/sessions/" + testGallerySessionID + "/images/1.png?format=jpg"
+	if w := serveAs(s, http.MethodGet, target, testGallerySessionID); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("GET %s = %d %s, want a JPEG", target, w.Code, w.Header().Get("Content-Type"))
+	}
+
+	for _, target := range []string{"/images/" + id + "?format=gif", "/images/" + id + "?format=webp&quality=0"} {
+		if w := get(target, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d, want %d", target, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandleSessionImage_StoredAsWebP(t *testing.T) {
+	s, err := NewServerWithDeps("", nil, nil, nil, persistence.NewImageStore(t.TempDir()), nil, &config.Config{ImageQuality: 80, ImageFormat: "webp"})
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	pngData, err := image.EncodePNG(2, 2, make([]byte, 2*2*3), image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	if err := s.imageStore.Save(testGallerySessionID, 1, pngData); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	target := "/sessions/" + testGallerySessionID + "/images/1.png"
+	w := serveAs(s, http.MethodGet, target, testGallerySessionID)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/webp" {
+		t.Fatalf("GET %s = %d %s, want the stored WebP", target, w.Code, w.Header().Get("Content-Type"))
+	}
+	if _, err := webp.Decode(bytes.NewReader(w.Body.Bytes())); err != nil {
+		t.Errorf("GET %s body is not a WebP: %v", target, err)
+	}
+
+	w = serveAs(s, http.MethodGet, target+"?format=png", testGallerySessionID)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("GET %s?format=png = %d %s, want a PNG", target, w.Code, w.Header().Get("Content-Type"))
+	}
+	if format, err := image.DetectFormat(w.Body.Bytes()); err != nil || format != image.OutputPNG {
+		t.Errorf("GET %s?format=png body = %q, %v, want a PNG", target, format, err)
+	}
+}
@@ -0,0 +1,175 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// DefaultStrength is the img2img denoise strength used when a /generate
+// request has an init image but no strength: it keeps the composition and
+// redraws the details.
+const DefaultStrength = 0.75
+
+var (
+	// errInvalidStrength indicates a strength outside (0, 1].
+	errInvalidStrength = errors.New("strength must be greater than 0 and at most 1")
+
+	// errInitImageNotFound indicates the upload or message named as the
+	// init image, or the upload named as the mask, has no image.
+	errInitImageNotFound = errors.New("init image not found")
+
+	// errMaskWithoutInitImage indicates an inpaint mask with nothing to
+	// inpaint.
+	errMaskWithoutInitImage = errors.New("mask requires an init image")
+)
+
+// initImage is the starting point of an img2img generation.
+type initImage struct {
+	// png is the image, in any size; it is scaled to the generation size.
+	png []byte
+
+	// strength is how much of the image is redrawn, in (0, 1].
+	strength float64
+
+	// mask, if set, makes this an inpaint generation: a PNG in which white
+	// marks what to redraw. It is scaled like png.
+	mask []byte
+}
+
+// withInitImage returns a context that makes generations started with it
+// img2img generations from img.
+func withInitImage(ctx context.Context, img initImage) context.Context {
+	return context.WithValue(ctx, initImageKey, img)
+}
+
+// initImageFromContext returns the init image set by withInitImage.
+func initImageFromContext(ctx context.Context) (initImage, bool) {
+	img, ok := ctx.Value(initImageKey).(initImage)
+	return img, ok
+}
+
+// parseInitImage reads the optional init image of a /generate request: an
+// upload ID from POST /upload in "init_image", or the ID of a message whose
+// image to start from in "init_message_id", with the denoise strength in
+// "strength" and, to inpaint, the upload ID of a mask in "mask". Reports
+// false if the request names no init image.
+//
+// Returns errInvalidStrength, errInitImageNotFound or
+// errMaskWithoutInitImage for bad requests.
+func (s *Server) parseInitImage(r *http.Request, sessionID string) (initImage, bool, error) {
+	uploadID := r.FormValue("init_image")
+	messageIDStr := r.FormValue("init_message_id")
+	maskID := r.FormValue("mask")
+	if uploadID == "" && messageIDStr == "" {
+		if maskID != "" {
+			return initImage{}, false, errMaskWithoutInitImage
+		}
+		return initImage{}, false, nil
+	}
+
+	strength, err := parseStrength(r.FormValue("strength"))
+	if err != nil {
+		return initImage{}, false, err
+	}
+
+	var data []byte
+	if uploadID != "" {
+		data, err = s.imageStore.LoadUpload(sessionID, uploadID)
+	} else {
+		messageID, convErr := strconv.Atoi(messageIDStr)
+		if convErr != nil || messageID <= 0 {
+			return initImage{}, false, fmt.Errorf("%w: invalid init_message_id %q", errInitImageNotFound, messageIDStr)
+		}
+		data, err = s.imageStore.Load(sessionID, messageID)
+	}
+	if err != nil {
+		return initImage{}, false, notFoundError(err)
+	}
+
+	var mask []byte
+	if maskID != "" {
+		if mask, err = s.imageStore.LoadUpload(sessionID, maskID); err != nil {
+			return initImage{}, false, notFoundError(err)
+		}
+	}
+
+	return initImage{png: data, strength: strength, mask: mask}, true, nil
+}
+
+// notFoundError wraps an error loading an init image or mask as
+// errInitImageNotFound.
+func notFoundError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return errInitImageNotFound
+	}
+	return fmt.Errorf("%w: %v", errInitImageNotFound, err)
+}
+
+// parseStrength parses the img2img denoise strength from form data.
+// Returns DefaultStrength if value is empty, or errInvalidStrength if it is
+// not a number in (0, 1].
+func parseStrength(value string) (float64, error) {
+	if value == "" {
+		return DefaultStrength, nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	// Written as a negation so NaN is rejected too
+	if err != nil || !(parsed > 0 && parsed <= 1) {
+		return 0, errInvalidStrength
+	}
+	return parsed, nil
+}
+
+// encodeImg2ImgRequest encodes req as an img2img request starting from img,
+// scaled to the request's dimensions, or an inpaint request if img has a
+// mask.
+func encodeImg2ImgRequest(req *protocol.SD35GenerateRequest, img initImage) ([]byte, error) {
+	pixels, err := image.InitImageRGB(img.png, int(req.Width), int(req.Height))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare init image: %w", err)
+	}
+
+	img2img := &protocol.SD35Img2ImgRequest{
+		SD35GenerateRequest: *req,
+		Strength:            float32(img.strength),
+		InitChannels:        protocol.SD35ChannelsRGB,
+		InitImage:           pixels,
+	}
+	if img.mask == nil {
+		img2img.Header.MsgType = protocol.MsgImg2ImgRequest
+		return protocol.EncodeSD35Img2ImgRequest(img2img)
+	}
+
+	mask, err := image.InpaintMask(img.mask, int(req.Width), int(req.Height))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare mask: %w", err)
+	}
+	img2img.Header.MsgType = protocol.MsgInpaintRequest
+	return protocol.EncodeSD35InpaintRequest(&protocol.SD35InpaintRequest{
+		SD35Img2ImgRequest: *img2img,
+		Mask:               mask,
+	})
+}
+
+// compositeInpaint puts the pixels of img outside its mask back over
+// generated, the RGB result of inpainting img at width x height. Compute
+// redraws the whole image, so without this the kept area would drift.
+func compositeInpaint(img initImage, width, height int, generated []byte) ([]byte, error) {
+	base, err := image.InitImageRGB(img.png, width, height)
+	if err != nil {
+		return nil, err
+	}
+	mask, err := image.InpaintMask(img.mask, width, height)
+	if err != nil {
+		return nil, err
+	}
+	return image.CompositeMasked(base, generated, mask)
+}
@@ -0,0 +1,215 @@
+package web
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/persistence"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+func TestParseStrength(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{value: "", want: DefaultStrength},
+		{value: "0.4", want: 0.4},
+		{value: "1", want: 1},
+		{value: "0", wantErr: true},
+		{value: "-0.5", wantErr: true},
+		{value: "1.01", wantErr: true},
+		{value: "NaN", wantErr: true},
+		{value: "half", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseStrength(tt.value)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidStrength) {
+					t.Errorf("parseStrength(%q) error = %v, want %v", tt.value, err, errInvalidStrength)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parseStrength(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleGenerate_Img2Img(t *testing.T) {
+	const sessionID = testGallerySessionID
+
+	initPNG, err := image.EncodePNG(64, 64, bytes.Repeat([]byte{200, 10, 10}, 64*64), image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+
+	requests := make(chan []byte, 1)
+	store := persistence.NewImageStore(t.TempDir())
+	s, err := NewServerWithDeps("", nil, nil, nil, store, recordingComputeConn(t, requests), nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	if err := store.Save(sessionID, 3, initPNG); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	uploadID, err := store.SaveUpload(sessionID, initPNG)
+	if err != nil {
+		t.Fatalf("SaveUpload() error = %v", err)
+	}
+	maskID, err := store.SaveUpload(sessionID, initPNG)
+	if err != nil {
+		t.Fatalf("SaveUpload() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		form         url.Values
+		wantStatus   int
+		wantImg2Img  bool
+		wantInpaint  bool
+		wantStrength float32
+	}{
+		{
+			name:       "no init image",
+			form:       url.Values{"prompt": {"a cat"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "prior generation",
+			form:         url.Values{"prompt": {"a cat"}, "init_message_id": {"3"}, "strength": {"0.4"}},
+			wantStatus:   http.StatusOK,
+			wantImg2Img:  true,
+			wantStrength: 0.4,
+		},
+		{
+			name:         "upload with default strength",
+			form:         url.Values{"prompt": {"a cat"}, "init_image": {uploadID}},
+			wantStatus:   http.StatusOK,
+			wantImg2Img:  true,
+			wantStrength: DefaultStrength,
+		},
+		{
+			name:         "inpaint",
+			form:         url.Values{"prompt": {"a hat"}, "init_message_id": {"3"}, "mask": {maskID}, "strength": {"1"}},
+			wantStatus:   http.StatusOK,
+			wantImg2Img:  true,
+			wantInpaint:  true,
+			wantStrength: 1,
+		},
+		{
+			name:       "mask without init image",
+			form:       url.Values{"prompt": {"a hat"}, "mask": {maskID}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown mask",
+			form:       url.Values{"prompt": {"a hat"}, "init_message_id": {"3"}, "mask": {"0123456789abcdef"}},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unknown upload",
+			form:       url.Values{"prompt": {"a cat"}, "init_image": {"0123456789abcdef"}},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "message without image",
+			form:       url.Values{"prompt": {"a cat"}, "init_message_id": {"9"}},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "strength out of range",
+			form:       url.Values{"prompt": {"a cat"}, "init_message_id": {"3"}, "strength": {"1.5"}},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each case is a fresh request as far as rate limiting goes
+			s.rateLimiter = newRateLimiter()
+
+			req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(setSessionID(req.Context(), sessionID))
+			w := httptest.NewRecorder()
+
+			s.handleGenerate(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			msg := <-requests
+			msgType := binary.BigEndian.Uint16(msg[6:8])
+			if !tt.wantImg2Img {
+				if msgType != protocol.MsgGenerateRequest {
+					t.Errorf("msg_type = 0x%04X, want generate request", msgType)
+				}
+				return
+			}
+			if tt.wantInpaint {
+				if msgType != protocol.MsgInpaintRequest {
+					t.Fatalf("msg_type = 0x%04X, want inpaint request", msgType)
+				}
+				// The mask is one byte per pixel at the end of the message
+				width, height := binary.BigEndian.Uint32(msg[28:32]), binary.BigEndian.Uint32(msg[32:36])
+				if got := binary.BigEndian.Uint32(msg[88:92]); got != width*height {
+					t.Errorf("mask_data_len = %d, want %d", got, width*height)
+				}
+				return
+			}
+			if msgType != protocol.MsgImg2ImgRequest {
+				t.Fatalf("msg_type = 0x%04X, want img2img request", msgType)
+			}
+			if got := math.Float32frombits(binary.BigEndian.Uint32(msg[76:80])); got != tt.wantStrength {
+				t.Errorf("strength = %v, want %v", got, tt.wantStrength)
+			}
+			// The 64x64 init image is scaled to the generation size
+			width, height := binary.BigEndian.Uint32(msg[28:32]), binary.BigEndian.Uint32(msg[32:36])
+			if got, want := binary.BigEndian.Uint32(msg[84:88]), width*height*3; got != want {
+				t.Errorf("init_data_len = %d, want %d", got, want)
+			}
+			if pixels := msg[len(msg)-3:]; !bytes.Equal(pixels, []byte{200, 10, 10}) {
+				t.Errorf("last init pixel = %v, want the init image colour", pixels)
+			}
+		})
+	}
+}
+
+func TestCompositeInpaint(t *testing.T) {
+	red := bytes.Repeat([]byte{255, 0, 0}, 2)
+	initPNG, err := image.EncodePNG(2, 1, red, image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	// Redraw the left pixel only
+	maskPNG, err := image.EncodePNG(2, 1, []byte{255, 255, 255, 0, 0, 0}, image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+
+	generated := bytes.Repeat([]byte{0, 0, 255}, 2)
+	got, err := compositeInpaint(initImage{png: initPNG, mask: maskPNG}, 2, 1, generated)
+	if err != nil {
+		t.Fatalf("compositeInpaint() error = %v", err)
+	}
+	if want := []byte{0, 0, 255, 255, 0, 0}; !bytes.Equal(got, want) {
+		t.Errorf("compositeInpaint() = %v, want %v", got, want)
+	}
+}
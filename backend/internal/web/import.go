@@ -0,0 +1,307 @@
+package web
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+const (
+	// MaxImportSize is the maximum size of an uploaded export archive (256MB).
+	// Archives carry up to MaxHistorySize images, so this is much larger
+	// than MaxRequestBodySize.
+	MaxImportSize = 256 * 1024 * 1024
+
+	// maxImportDocumentSize is the maximum size of an export document, the
+	// whole body of a JSON import or the document in an archive. Documents
+	// hold at most MaxHistorySize messages and no images.
+	maxImportDocumentSize = 32 * 1024 * 1024
+
+	// importDocumentName is the document read from zip archives.
+	// Only JSON exports can be imported; Markdown is for reading.
+	importDocumentName = "conversation." + exportFormatJSON
+)
+
+// zipMagic is the local file header signature that starts every zip archive.
+var zipMagic = []byte("PK\x03\x04")
+
+// errInvalidImport wraps validation failures that are reported to the caller.
+var errInvalidImport = errors.New("invalid import")
+
+// handleImport restores a previously exported session into the caller's session.
+// POST /import
+//
+// The body is either a JSON export document or a zip archive produced by
+// GET /export?format=json&zip=true. The active chat's conversation and current
+// prompt, and the session's generation settings, are replaced. Images from the
+// archive are written to the image store under the caller's session and
+// snapshot preview URLs are rewritten to point at them.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Archives can be large; don't let the server's ReadTimeout cut them off
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+
+	// SECURITY: Limit request body size, and spool it to a temporary file
+	// so concurrent imports of large archives aren't held in memory
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportSize)
+	spool, err := os.CreateTemp("", "weave-import-*")
+	if err != nil {
+		log.Printf("Failed to create import file for session %s: %v", sessionID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read request body")
+		return
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	size, err := io.Copy(spool, r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "archive too large")
+			return
+		}
+		log.Printf("Failed to read import for session %s: %v", sessionID, err)
+		writeJSONError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+
+	doc, images, err := parseImport(spool, size)
+	if err != nil {
+		log.Printf("Rejected import for session %s: %v", sessionID, err)
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.restoreImport(sessionID, doc, images); err != nil {
+		log.Printf("Failed to import session %s: %v", sessionID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to restore session")
+		return
+	}
+
+	log.Printf("Imported %d messages and %d images into session %s", len(doc.Messages), len(images), sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status":"ok","session_id":"%s","messages":%d,"images":%d}`, sessionID, len(doc.Messages), len(images))
+}
+
+// writeJSONError writes a JSON error response.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	msg, _ := json.Marshal(message)
+	fmt.Fprintf(w, `{"status":"error","message":%s}`, msg)
+}
+
+// parseImport decodes and validates an uploaded export of size bytes.
+// It returns the document and the archive member holding the PNG image of
+// each message with one, keyed by message ID. The images are checked but
+// not kept, so only one is in memory at a time. Plain JSON documents carry
+// no images.
+func parseImport(body io.ReaderAt, size int64) (exportDocument, map[int]*zip.File, error) {
+	magic := make([]byte, len(zipMagic))
+	if n, _ := body.ReadAt(magic, 0); n < len(magic) || !bytes.Equal(magic, zipMagic) {
+		if size > maxImportDocumentSize {
+			return exportDocument{}, nil, fmt.Errorf("%w: document is too large", errInvalidImport)
+		}
+		data, err := io.ReadAll(io.NewSectionReader(body, 0, size))
+		if err != nil {
+			return exportDocument{}, nil, fmt.Errorf("failed to read import: %w", err)
+		}
+		doc, err := decodeImportDocument(data)
+		return doc, map[int]*zip.File{}, err
+	}
+
+	zr, err := zip.NewReader(body, size)
+	if err != nil {
+		return exportDocument{}, nil, fmt.Errorf("%w: unreadable zip archive", errInvalidImport)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	docFile, ok := files[importDocumentName]
+	if !ok {
+		return exportDocument{}, nil, fmt.Errorf("%w: archive does not contain %s", errInvalidImport, importDocumentName)
+	}
+	docData, err := readZipFile(docFile, maxImportDocumentSize)
+	if err != nil {
+		return exportDocument{}, nil, err
+	}
+
+	doc, err := decodeImportDocument(docData)
+	if err != nil {
+		return exportDocument{}, nil, err
+	}
+
+	images := make(map[int]*zip.File)
+	for _, msg := range doc.Messages {
+		if msg.Image == "" {
+			continue
+		}
+		f, ok := files[msg.Image]
+		if !ok {
+			// Export skips images removed mid-archive; treat as no image
+			continue
+		}
+		data, err := readZipFile(f, persistence.MaxImageSizeBytes)
+		if err != nil {
+			return exportDocument{}, nil, err
+		}
+		// SECURITY: Images are served as PNG, so refuse anything else
+		if err := image.CheckPNG(data); err != nil {
+			return exportDocument{}, nil, fmt.Errorf("%w: %s: %v", errInvalidImport, f.Name, err)
+		}
+		images[msg.ID] = f
+	}
+
+	return doc, images, nil
+}
+
+// readZipFile reads an archive member, refusing members larger than limit.
+func readZipFile(f *zip.File, limit int64) ([]byte, error) {
+	// SECURITY: Check both the declared and actual size to stop zip bombs
+	if f.UncompressedSize64 > uint64(limit) {
+		return nil, fmt.Errorf("%w: %s is too large", errInvalidImport, f.Name)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot open %s", errInvalidImport, f.Name)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read %s", errInvalidImport, f.Name)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: %s is too large", errInvalidImport, f.Name)
+	}
+	return data, nil
+}
+
+// decodeImportDocument parses and validates an export document.
+func decodeImportDocument(data []byte) (exportDocument, error) {
+	var doc exportDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return exportDocument{}, fmt.Errorf("%w: malformed export document", errInvalidImport)
+	}
+
+	if doc.Version < minImportFormatVersion || doc.Version > ExportFormatVersion {
+		return exportDocument{}, fmt.Errorf("%w: unsupported export version %d", errInvalidImport, doc.Version)
+	}
+	if len(doc.Messages) > conversation.MaxHistorySize {
+		return exportDocument{}, fmt.Errorf("%w: too many messages (max %d)", errInvalidImport, conversation.MaxHistorySize)
+	}
+
+	settings := doc.Settings
+	if settings.Steps < 1 || settings.Steps > 100 {
+		return exportDocument{}, fmt.Errorf("%w: steps must be between 1 and 100", errInvalidImport)
+	}
+	if settings.CFG < 0 || settings.CFG > 20 {
+		return exportDocument{}, fmt.Errorf("%w: cfg must be between 0 and 20", errInvalidImport)
+	}
+	if settings.Seed < -1 {
+		return exportDocument{}, fmt.Errorf("%w: seed must be -1 or greater", errInvalidImport)
+	}
+
+	seen := make(map[int]bool, len(doc.Messages))
+	for _, msg := range doc.Messages {
+		if msg.ID <= 0 || seen[msg.ID] {
+			return exportDocument{}, fmt.Errorf("%w: message IDs must be positive and unique", errInvalidImport)
+		}
+		seen[msg.ID] = true
+
+		switch msg.Role {
+		case conversation.RoleUser, conversation.RoleAssistant, conversation.RoleSystem:
+		default:
+			return exportDocument{}, fmt.Errorf("%w: message %d has unknown role %q", errInvalidImport, msg.ID, msg.Role)
+		}
+
+		// SECURITY: Only accept the path export writes, never arbitrary archive names
+		if msg.Image != "" && msg.Image != exportImagePath(msg.ID) {
+			return exportDocument{}, fmt.Errorf("%w: message %d has invalid image path", errInvalidImport, msg.ID)
+		}
+	}
+
+	return doc, nil
+}
+
+// restoreImport writes imported images, read from the archive members
+// parseImport checked, and replaces the active chat's state.
+// Messages are renumbered with fresh session-wide IDs so they cannot collide
+// with messages (and images) in the session's other chats. Images are stored
+// before the conversation is swapped so the restored history never points at
+// files that failed to write.
+func (s *Server) restoreImport(sessionID string, doc exportDocument, images map[int]*zip.File) error {
+	session := s.sessionManager.GetSession(sessionID)
+	_, manager := session.ActiveChat()
+	firstID := session.ReserveMessageIDs(len(doc.Messages))
+
+	messages := make([]conversation.ConversationMessage, len(doc.Messages))
+	for i, msg := range doc.Messages {
+		id := firstID + i
+		messages[i] = msg.ConversationMessage
+		messages[i].ID = id
+
+		// Archives only carry primary images
+		messages[i].Alternates = nil
+
+		// Clear anything left at this ID by a previous run of the session
+		if _, err := s.galleryStore.Unpublish(sessionID, id); err != nil {
+			log.Printf("Failed to unpublish image %d for session %s: %v", id, sessionID, err)
+		}
+
+		f, ok := images[msg.ID]
+		if ok {
+			pngData, err := readZipFile(f, persistence.MaxImageSizeBytes)
+			if err != nil {
+				return err
+			}
+			if err := s.imageStore.Save(sessionID, id, pngData); err != nil {
+				return fmt.Errorf("failed to save image %d: %w", id, err)
+			}
+		} else if err := s.imageStore.Delete(sessionID, id); err != nil {
+			log.Printf("Failed to remove stale image %d for session %s: %v", id, sessionID, err)
+		}
+
+		if messages[i].Snapshot == nil {
+			continue
+		}
+		snapshot := *messages[i].Snapshot
+		if ok {
+			snapshot.PreviewStatus = conversation.PreviewStatusComplete
+			snapshot.PreviewURL = s.imageStore.GetURL(sessionID, id)
+		} else {
+			snapshot.PreviewStatus = conversation.PreviewStatusNone
+			snapshot.PreviewURL = ""
+		}
+		messages[i].Snapshot = &snapshot
+	}
+
+	manager.Restore(messages, doc.CurrentPrompt)
+	session.SetGenerationSettings(doc.Settings.Steps, doc.Settings.CFG, doc.Settings.Seed)
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package web
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/image"
+)
+
+const testImportSessionID = "ffeeddccbbaa99887766554433221100"
+
+func doImport(t *testing.T, s *Server, sessionID string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/import", bytes.NewReader(body))
+	req = req.WithContext(setSessionID(req.Context(), sessionID))
+	w := httptest.NewRecorder()
+	s.handleImport(w, req)
+	return w
+}
+
+// buildZip creates a zip archive from name/content pairs.
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Create(%s) error = %v", name, err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatalf("Write(%s) error = %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestHandleImport_RoundTripZip(t *testing.T) {
+	s, msgID := newExportTestServer(t)
+
+	w := doExport(t, s, "?format=json&zip=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("export status code = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	w = doImport(t, s, testImportSessionID, w.Body.Bytes())
+	if w.Code != http.StatusOK {
+		t.Fatalf("import status code = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"images":1`) {
+		t.Errorf("response = %s, want 1 image restored", w.Body.String())
+	}
+
+	session := s.sessionManager.GetSession(testImportSessionID)
+	manager := session.Manager()
+
+	messages := manager.GetMessages()
+	if len(messages) != 2 {
+		t.Fatalf("imported %d messages, want 2", len(messages))
+	}
+	if manager.GetCurrentPrompt() != "a fluffy cat" {
+		t.Errorf("current prompt = %q, want %q", manager.GetCurrentPrompt(), "a fluffy cat")
+	}
+	if steps, cfg, seed, ok := session.GetGenerationSettings(); !ok || steps != 8 || cfg != 2.5 || seed != 42 {
+		t.Errorf("settings = %d, %v, %d, %v, want 8, 2.5, 42, true", steps, cfg, seed, ok)
+	}
+
+	// Images are bound to the importing session, not the exporting one
+	snapshot := manager.GetMessage(msgID).Snapshot
+	wantURL := s.imageStore.GetURL(testImportSessionID, msgID)
+	if snapshot.PreviewURL != wantURL || snapshot.PreviewStatus != conversation.PreviewStatusComplete {
+		t.Errorf("snapshot preview = %q (%s), want %q (complete)", snapshot.PreviewURL, snapshot.PreviewStatus, wantURL)
+	}
+	data, err := s.imageStore.Load(testImportSessionID, msgID)
+	if err != nil || image.CheckPNG(data) != nil {
+		t.Errorf("imported image = %q, %v, want the exported PNG", data, err)
+	}
+	if w := serveAs(s, http.MethodGet, wantURL, testImportSessionID); w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("image status = %d, X-Content-Type-Options = %q, want nosniff", w.Code, w.Header().Get("X-Content-Type-Options"))
+	}
+}
+
+func TestHandleImport_JSONWithoutImages(t *testing.T) {
+	s, msgID := newExportTestServer(t)
+
+	w := doExport(t, s, "?format=json")
+	w = doImport(t, s, testImportSessionID, w.Body.Bytes())
+	if w.Code != http.StatusOK {
+		t.Fatalf("import status code = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	snapshot := s.sessionManager.GetSession(testImportSessionID).Manager().GetMessage(msgID).Snapshot
+	if snapshot.PreviewStatus != conversation.PreviewStatusNone || snapshot.PreviewURL != "" {
+		t.Errorf("snapshot preview = %q (%s), want no preview", snapshot.PreviewURL, snapshot.PreviewStatus)
+	}
+	if s.imageStore.Exists(testImportSessionID, msgID) {
+		t.Error("image exists after JSON-only import, want none")
+	}
+}
+
+func TestHandleImport_Invalid(t *testing.T) {
+	s, _ := newExportTestServer(t)
+
+	validSettings := `"settings":{"steps":4,"cfg":1,"seed":-1}`
+
+	tests := []struct {
+		name        string
+		body        []byte
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			name:        "malformed JSON",
+			body:        []byte("{not json"),
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "malformed export document",
+		},
+		{
+			name:        "unsupported version",
+			body:        []byte(`{"version":99,` + validSettings + `,"messages":[]}`),
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "unsupported export version",
+		},
+		{
+			name:        "steps out of range",
+			body:        []byte(`{"version":1,"settings":{"steps":0,"cfg":1,"seed":-1},"messages":[]}`),
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "steps must be between",
+		},
+		{
+			name:        "duplicate message IDs",
+			body:        []byte(`{"version":1,` + validSettings + `,"messages":[{"id":1,"role":"user"},{"id":1,"role":"user"}]}`),
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "positive and unique",
+		},
+		{
+			name:        "unknown role",
+			body:        []byte(`{"version":1,` + validSettings + `,"messages":[{"id":1,"role":"tool"}]}`),
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "unknown role",
+		},
+		{
+			name:        "image path traversal",
+			body:        []byte(`{"version":1,` + validSettings + `,"messages":[{"id":1,"role":"assistant","image":"../1.png"}]}`),
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "invalid image path",
+		},
+		{
+			name:        "zip without document",
+			body:        buildZip(t, map[string]string{"conversation.md": "# Weave Session"}),
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "does not contain conversation.json",
+		},
+		{
+			name:        "document too large",
+			body:        bytes.Repeat([]byte(" "), maxImportDocumentSize+1),
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "document is too large",
+		},
+		{
+			name: "image that is not a PNG",
+			body: buildZip(t, map[string]string{
+				"conversation.json": `{"version":1,` + validSettings + `,"messages":[{"id":1,"role":"assistant","image":"` + exportImagePath(1) + `"}]}`,
+				exportImagePath(1):  "<script>alert(1)</script>",
+			}),
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "not a PNG image",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doImport(t, s, testImportSessionID, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantMessage) {
+				t.Errorf("body = %s, want message containing %q", w.Body.String(), tt.wantMessage)
+			}
+		})
+	}
+
+	// Rejected imports leave the session untouched
+	if n := len(s.sessionManager.GetSession(testImportSessionID).Manager().GetMessages()); n != 0 {
+		t.Errorf("session has %d messages after rejected imports, want 0", n)
+	}
+}
+
+func TestHandleImport_DoesNotCollideWithOtherChats(t *testing.T) {
+	s, _ := newExportTestServer(t)
+
+	// The importing session already has an image on message 2 in its first chat
+	session := s.sessionManager.GetSession(testImportSessionID)
+	session.Manager().AddUserMessage("first chat")
+	existingID := session.Manager().AddAssistantMessage("first reply", "", nil)
+	if err := s.imageStore.Save(testImportSessionID, existingID, []byte("old-png")); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := session.CreateChat("imported"); err != nil {
+		t.Fatalf("CreateChat() error = %v", err)
+	}
+
+	body := buildZip(t, map[string]string{
+		"conversation.json": `{"version":1,"settings":{"steps":4,"cfg":1,"seed":-1},"messages":[` +
+			`{"id":2,"role":"assistant","content":"new","image":"images/2.png","snapshot":{"prompt":"new"}}]}`,
+		"images/2.png": string(testExportPNG),
+	})
+
+	w := doImport(t, s, testImportSessionID, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("import status code = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	// The first chat's image is untouched
+	data, err := s.imageStore.Load(testImportSessionID, existingID)
+	if err != nil || string(data) != "old-png" {
+		t.Errorf("existing image = %q, %v, want %q", data, err, "old-png")
+	}
+
+	// The imported message was renumbered and its image follows it
+	messages := session.Manager().GetMessages()
+	if len(messages) != 1 {
+		t.Fatalf("imported chat has %d messages, want 1", len(messages))
+	}
+	importedID := messages[0].ID
+	if importedID == existingID {
+		t.Fatalf("imported message reused ID %d", existingID)
+	}
+	data, err = s.imageStore.Load(testImportSessionID, importedID)
+	if err != nil || !bytes.Equal(data, testExportPNG) {
+		t.Errorf("imported image = %q, %v, want the archived image", data, err)
+	}
+	if url := messages[0].Snapshot.PreviewURL; url != s.imageStore.GetURL(testImportSessionID, importedID) {
+		t.Errorf("PreviewURL = %q, want renumbered image URL", url)
+	}
+
+	// Version 1 documents predate sequence numbers; import assigns one
+	if messages[0].Seq == 0 {
+		t.Error("imported version 1 message has no Seq")
+	}
+}
+
+func TestHandleImport_Unauthorized(t *testing.T) {
+	s, _ := newExportTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/import", strings.NewReader("{}"))
+	w := httptest.NewRecorder()
+	s.handleImport(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status code = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+
+	"github.com/hurricanerix/weave/internal/llm"
+)
+
+// handleLLMCapture downloads the latest LLM chat request and raw response
+// captured with --capture-llm, for debugging replies the agent got wrong.
+// Captures hold every session's conversations, so like GET
+// /sessions?all=true this requires an API token, or a loopback request when
+// no tokens are configured.
+// GET /admin/llm/capture
+func (s *Server) handleLLMCapture(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !s.canAccessAllSessions(r) {
+		writeJSONError(w, http.StatusForbidden, "downloading LLM captures requires an API token")
+		return
+	}
+
+	if s.llmCaptureDir == "" {
+		writeJSONError(w, http.StatusNotFound, "LLM capture is off (start with --capture-llm)")
+		return
+	}
+
+	path, err := llm.LatestCapture(s.llmCaptureDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "no LLM requests captured yet")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to find the latest LLM capture: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read LLM captures")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	http.ServeFile(w, r, path)
+}
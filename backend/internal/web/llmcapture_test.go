@@ -0,0 +1,48 @@
+package web
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleLLMCapture(t *testing.T) {
+	captured := t.TempDir()
+	capture := "POST http://localhost:11434/api/chat\n\n{}\n\nHTTP/1.1 200 OK\n\n{\"done\":true}\n"
+	if err := os.WriteFile(filepath.Join(captured, "llm-20260102-090000.000000-000001.txt"), []byte(capture), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		dir        string
+		remoteAddr string
+		wantStatus int
+		wantBody   string
+	}{
+		{"capture off", "", "127.0.0.1:1234", http.StatusNotFound, "--capture-llm"},
+		{"nothing captured", t.TempDir(), "127.0.0.1:1234", http.StatusNotFound, "no LLM requests captured"},
+		{"latest capture", captured, "127.0.0.1:1234", http.StatusOK, capture},
+		{"remote request without a token", captured, "192.0.2.1:1234", http.StatusForbidden, "requires an API token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, nil)
+			s.llmCaptureDir = tt.dir
+
+			w := serveFrom(s, http.MethodGet, "/admin/llm/capture", testGallerySessionID, tt.remoteAddr)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", w.Body.String(), tt.wantBody)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+				t.Errorf("Content-Disposition = %q, want an attachment", w.Header().Get("Content-Disposition"))
+			}
+		})
+	}
+}
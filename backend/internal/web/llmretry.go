@@ -0,0 +1,78 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/llm"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// llmReconnectAttempts is the number of times a chat request is retried
+// after a connection error before the error reaches the user.
+const llmReconnectAttempts = 4
+
+// llmReconnectBaseDelay is the wait before the first reconnect attempt. It
+// doubles with every attempt up to llmReconnectMaxDelay, so the retries
+// cover an LLM server restart of roughly ten seconds.
+var (
+	llmReconnectBaseDelay = 500 * time.Millisecond
+	llmReconnectMaxDelay  = 8 * time.Second
+)
+
+// isTransientLLMError reports whether err means the LLM server could not be
+// reached, which a restart of the server explains. Errors in the reply
+// itself, such as ollama.ErrMissingFields, are not transient.
+func isTransientLLMError(err error) bool {
+	return errors.Is(err, ollama.ErrNotRunning) ||
+		errors.Is(err, ollama.ErrConnectionTimeout) ||
+		errors.Is(err, ollama.ErrConnectionFailed) ||
+		errors.Is(err, llm.ErrNotRunning) ||
+		errors.Is(err, llm.ErrConnectionTimeout) ||
+		errors.Is(err, llm.ErrConnectionFailed)
+}
+
+// llmReconnectDelay returns the wait before reconnect attempt n (starting at
+// 1): exponential backoff with jitter in its upper half, so sessions that
+// lost the server together do not retry in lockstep.
+func llmReconnectDelay(n int) time.Duration {
+	delay := llmReconnectMaxDelay
+	if shift := n - 1; shift < 16 {
+		delay = min(llmReconnectBaseDelay<<shift, llmReconnectMaxDelay)
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// chatWithReconnect calls the LLM client's Chat method, retrying with
+// backoff while the LLM server cannot be reached. Before each retry it sends
+// EventAgentReconnecting so the UI can drop any partial reply and show that
+// the agent is reconnecting. Other errors, the last connection error and
+// ctx cancellation are returned as they are.
+func (s *Server) chatWithReconnect(ctx context.Context, sessionID, chatID string, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := s.llmClient.Chat(ctx, messages, seed, tools, callback)
+		if err == nil || !isTransientLLMError(err) || attempt > llmReconnectAttempts {
+			return result, err
+		}
+
+		delay := llmReconnectDelay(attempt)
+		log.Printf("LLM unreachable for session %s, reconnecting in %v (attempt %d of %d): %v",
+			sessionID, delay, attempt, llmReconnectAttempts, err)
+		_ = s.sendChatEvent(sessionID, chatID, EventAgentReconnecting, map[string]int64{
+			"attempt":  int64(attempt),
+			"delay_ms": delay.Milliseconds(),
+		})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ollama.ChatResult{}, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/llm"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// fastReconnect shortens the reconnect backoff for the test.
+func fastReconnect(t *testing.T) {
+	t.Helper()
+	base, maxDelay := llmReconnectBaseDelay, llmReconnectMaxDelay
+	llmReconnectBaseDelay, llmReconnectMaxDelay = time.Millisecond, 4*time.Millisecond
+	t.Cleanup(func() { llmReconnectBaseDelay, llmReconnectMaxDelay = base, maxDelay })
+}
+
+func TestIsTransientLLMError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{ollama.ErrNotRunning, true},
+		{fmt.Errorf("chat: %w", ollama.ErrConnectionTimeout), true},
+		{ollama.ErrConnectionFailed, true},
+		{llm.ErrNotRunning, true},
+		{llm.ErrConnectionTimeout, true},
+		{ollama.ErrMissingFields, false},
+		{ollama.ErrRequestFailed, false},
+		{context.Canceled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if got := isTransientLLMError(tt.err); got != tt.want {
+				t.Errorf("isTransientLLMError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLLMReconnectDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, llmReconnectBaseDelay},
+		{2, 2 * llmReconnectBaseDelay},
+		{5, llmReconnectMaxDelay},
+		{100, llmReconnectMaxDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempt), func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				if got := llmReconnectDelay(tt.attempt); got < tt.want/2 || got > tt.want {
+					t.Fatalf("llmReconnectDelay(%d) = %v, want between %v and %v", tt.attempt, got, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestChatWithReconnect(t *testing.T) {
+	fastReconnect(t)
+	ok := mockResponse{result: ollama.ChatResult{Response: "ok"}}
+	down := mockResponse{err: ollama.ErrNotRunning}
+
+	tests := []struct {
+		name           string
+		responses      []mockResponse
+		wantErr        error
+		wantCalls      int
+		wantReconnects int
+	}{
+		{"first try", []mockResponse{ok}, nil, 1, 0},
+		{"server restarts", []mockResponse{down, {err: llm.ErrConnectionFailed}, ok}, nil, 3, 2},
+		{"server stays down", []mockResponse{down, down, down, down, down, ok}, ollama.ErrNotRunning, llmReconnectAttempts + 1, llmReconnectAttempts},
+		{"format error", []mockResponse{{err: ollama.ErrMissingFields}, ok}, ollama.ErrMissingFields, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockOllamaClient{responses: tt.responses}
+			s, err := NewServerWithDeps("", mock, nil, nil, nil, nil, nil)
+			if err != nil {
+				t.Fatalf("NewServerWithDeps failed: %v", err)
+			}
+			events := recordEvents(s, "test-session")
+
+			result, err := s.chatWithReconnect(context.Background(), "test-session", "", nil, nil, nil, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("chatWithReconnect() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && result.Response != "ok" {
+				t.Errorf("response = %q, want %q", result.Response, "ok")
+			}
+			if mock.callCount != tt.wantCalls {
+				t.Errorf("call count = %d, want %d", mock.callCount, tt.wantCalls)
+			}
+			if got := strings.Count(events.Body.String(), "event: "+EventAgentReconnecting); got != tt.wantReconnects {
+				t.Errorf("%s events = %d, want %d", EventAgentReconnecting, got, tt.wantReconnects)
+			}
+		})
+	}
+}
+
+func TestChatWithReconnect_Canceled(t *testing.T) {
+	mock := &mockOllamaClient{responses: []mockResponse{{err: ollama.ErrNotRunning}}}
+	s, err := NewServerWithDeps("", mock, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.chatWithReconnect(ctx, "test-session", "", nil, nil, nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("chatWithReconnect() error = %v, want context.Canceled", err)
+	}
+	if mock.callCount != 1 {
+		t.Errorf("call count = %d, want 1", mock.callCount)
+	}
+}
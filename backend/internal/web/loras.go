@@ -0,0 +1,228 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/protocol"
+	"github.com/hurricanerix/weave/internal/tools"
+)
+
+// loraExtensions are the file extensions compute loads LoRAs from.
+var loraExtensions = []string{".safetensors", ".ckpt", ".gguf"}
+
+// defaultLoRAWeight is the weight of a LoRA the agent names without one.
+const defaultLoRAWeight = 1.0
+
+// loraResponse describes a LoRA applied to the session's generations.
+type loraResponse struct {
+	Name   string  `json:"name"`
+	Weight float32 `json:"weight"`
+}
+
+// loraListResponse is the response for GET /loras.
+type loraListResponse struct {
+	Status string         `json:"status"`
+	LoRAs  []string       `json:"loras"`
+	Active []loraResponse `json:"active"`
+}
+
+// handleListLoRAs lists the LoRAs installed in the LoRA directory and the
+// ones the session's generations apply.
+// GET /loras
+func (s *Server) handleListLoRAs(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	names, err := listLoRAs(s.loraDir)
+	if err != nil {
+		log.Printf("Failed to list LoRAs in %s: %v", s.loraDir, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list LoRAs")
+		return
+	}
+
+	resp := loraListResponse{Status: "ok", LoRAs: names, Active: []loraResponse{}}
+	for _, l := range s.sessionManager.GetSession(sessionID).LoRAs() {
+		resp.Active = append(resp.Active, loraResponse{Name: l.Name, Weight: l.Weight})
+	}
+	writeChatJSON(w, http.StatusOK, resp)
+}
+
+// listLoRAs returns the names of the LoRAs installed in dir, sorted: the
+// files with a LoRA extension, without it. Files whose names compute would
+// refuse are left out. A missing or unset dir has no LoRAs.
+func listLoRAs(dir string) ([]string, error) {
+	names := []string{}
+	if dir == "" {
+		return names, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return names, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(e.Name())
+		if !hasLoRAExtension(ext) {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ext)
+		if !protocol.ValidLoRAName(name) || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// hasLoRAExtension reports whether ext is one of loraExtensions.
+func hasLoRAExtension(ext string) bool {
+	for _, e := range loraExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// loraArguments are the update_generation arguments that set LoRAs.
+// Weights may be numbers or numeric strings; small models send both.
+type loraArguments struct {
+	LoRAs *[]struct {
+		Name   string `json:"name"`
+		Weight any    `json:"weight"`
+	} `json:"loras"`
+}
+
+// applyAgentLoRAs sets the session's LoRAs from the agent's
+// update_generation call, if it names any. Weights outside the protocol's
+// range are clamped, LoRAs that are not installed are dropped, and only the
+// first protocol.MaxLoRAs are kept; each change is returned for the agent
+// feedback. Calls without loras keep the session's LoRAs.
+func (s *Server) applyAgentLoRAs(session *conversation.Session, sessionID string, toolCalls []ollama.ToolCall) []clampedSetting {
+	var args loraArguments
+	found := false
+	for _, tc := range toolCalls {
+		if !isUpdateGenerationCall(tc) {
+			continue
+		}
+		call := tools.Call{Name: tc.Function.Name, Arguments: tc.Function.Arguments}
+		if err := call.Decode(&args); err != nil {
+			log.Printf("Ignoring LoRAs of update_generation for session %s: %v", sessionID, err)
+			return nil
+		}
+		found = true
+	}
+	if !found || args.LoRAs == nil {
+		return nil
+	}
+
+	installed, err := listLoRAs(s.loraDir)
+	if err != nil {
+		log.Printf("Failed to list LoRAs in %s: %v", s.loraDir, err)
+	}
+	available := make(map[string]bool, len(installed))
+	for _, name := range installed {
+		available[name] = true
+	}
+
+	var clamped []clampedSetting
+	loras := make([]conversation.LoRA, 0, len(*args.LoRAs))
+	for _, l := range *args.LoRAs {
+		if !available[l.Name] {
+			clamped = append(clamped, clampedSetting{
+				name:     "lora " + l.Name,
+				original: "requested",
+				clamped:  "dropped",
+				reason:   "not installed",
+			})
+			continue
+		}
+		if len(loras) == protocol.MaxLoRAs {
+			clamped = append(clamped, clampedSetting{
+				name:     "lora " + l.Name,
+				original: "requested",
+				clamped:  "dropped",
+				reason:   fmt.Sprintf("at most %d LoRAs", protocol.MaxLoRAs),
+			})
+			continue
+		}
+
+		weight, ok := loraWeight(l.Weight)
+		if !ok {
+			weight = defaultLoRAWeight
+		}
+		clampedWeight := weight
+		if weight < float64(protocol.MinLoRAWeight) {
+			clampedWeight = float64(protocol.MinLoRAWeight)
+		} else if weight > float64(protocol.MaxLoRAWeight) {
+			clampedWeight = float64(protocol.MaxLoRAWeight)
+		}
+		if clampedWeight != weight {
+			clamped = append(clamped, clampedSetting{
+				name:     "lora " + l.Name,
+				original: fmt.Sprintf("%.2f", weight),
+				clamped:  fmt.Sprintf("%.2f", clampedWeight),
+				reason:   fmt.Sprintf("weights range %.1f to %.1f", protocol.MinLoRAWeight, protocol.MaxLoRAWeight),
+			})
+		}
+		loras = append(loras, conversation.LoRA{Name: l.Name, Weight: float32(clampedWeight)})
+	}
+
+	session.SetLoRAs(loras)
+	return clamped
+}
+
+// loraWeight reads a LoRA weight sent as a number or a numeric string.
+// NaN and infinite weights are refused.
+func loraWeight(v any) (float64, bool) {
+	var w float64
+	switch x := v.(type) {
+	case float64:
+		w = x
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return 0, false
+		}
+		w = f
+	default:
+		return 0, false
+	}
+	if math.IsNaN(w) || math.IsInf(w, 0) {
+		return 0, false
+	}
+	return w, true
+}
+
+// sessionLoRAs returns the session's LoRAs as sent to compute.
+func sessionLoRAs(session *conversation.Session) []protocol.LoRA {
+	var loras []protocol.LoRA
+	for _, l := range session.LoRAs() {
+		loras = append(loras, protocol.LoRA{Name: l.Name, Weight: l.Weight})
+	}
+	return loras
+}
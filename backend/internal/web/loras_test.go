@@ -0,0 +1,178 @@
+package web
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// installLoRAs creates empty LoRA files named files in a temporary
+// directory and returns it.
+func installLoRAs(t *testing.T, files ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", f, err)
+		}
+	}
+	return dir
+}
+
+func TestListLoRAs(t *testing.T) {
+	dir := installLoRAs(t, "watercolor.safetensors", "ink.gguf", "ink.ckpt", "notes.txt", ".hidden.safetensors", "bad name.safetensors")
+	if err := os.Mkdir(filepath.Join(dir, "sub.safetensors"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := listLoRAs(dir)
+	if err != nil {
+		t.Fatalf("listLoRAs() error = %v", err)
+	}
+	if want := []string{"ink", "watercolor"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("listLoRAs() = %v, want %v", got, want)
+	}
+
+	for _, dir := range []string{"", filepath.Join(t.TempDir(), "missing")} {
+		got, err := listLoRAs(dir)
+		if err != nil || len(got) != 0 {
+			t.Errorf("listLoRAs(%q) = %v, %v, want empty", dir, got, err)
+		}
+	}
+}
+
+func TestHandleListLoRAs(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	s.loraDir = installLoRAs(t, "watercolor.safetensors")
+	s.sessionManager.GetSession(testGallerySessionID).SetLoRAs([]conversation.LoRA{{Name: "watercolor", Weight: 0.5}})
+
+	w := serveAs(s, http.MethodGet, "/loras", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp loraListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.LoRAs) != 1 || resp.LoRAs[0] != "watercolor" {
+		t.Errorf("loras = %v, want [watercolor]", resp.LoRAs)
+	}
+	if len(resp.Active) != 1 || resp.Active[0] != (loraResponse{Name: "watercolor", Weight: 0.5}) {
+		t.Errorf("active = %+v, want watercolor at 0.5", resp.Active)
+	}
+}
+
+func TestApplyAgentLoRAs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        string
+		want        []conversation.LoRA
+		wantClamped []string // names of the adjusted settings
+	}{
+		{
+			name: "no loras keeps the current ones",
+			args: `{"prompt":"a cat"}`,
+			want: []conversation.LoRA{{Name: "ink", Weight: 0.3}},
+		},
+		{
+			name: "empty list removes them",
+			args: `{"loras":[]}`,
+			want: []conversation.LoRA{},
+		},
+		{
+			name: "weights default, parse and clamp",
+			args: `{"loras":[{"name":"watercolor"},{"name":"ink","weight":"0.5"},{"name":"film","weight":3}]}`,
+			want: []conversation.LoRA{
+				{Name: "watercolor", Weight: 1},
+				{Name: "ink", Weight: 0.5},
+				{Name: "film", Weight: 2},
+			},
+			wantClamped: []string{"lora film"},
+		},
+		{
+			name:        "unknown names are dropped",
+			args:        `{"loras":[{"name":"../etc/passwd","weight":1},{"name":"ink","weight":-0.5}]}`,
+			want:        []conversation.LoRA{{Name: "ink", Weight: -0.5}},
+			wantClamped: []string{"lora ../etc/passwd"},
+		},
+		{
+			name: "at most MaxLoRAs",
+			args: `{"loras":[{"name":"a"},{"name":"b"},{"name":"film"},{"name":"ink"},{"name":"watercolor"}]}`,
+			want: []conversation.LoRA{
+				{Name: "a", Weight: 1},
+				{Name: "b", Weight: 1},
+				{Name: "film", Weight: 1},
+				{Name: "ink", Weight: 1},
+			},
+			wantClamped: []string{"lora watercolor"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, nil)
+			s.loraDir = installLoRAs(t, "a.safetensors", "b.safetensors", "film.ckpt", "ink.gguf", "watercolor.safetensors")
+			session := s.sessionManager.GetSession(testGallerySessionID)
+			session.SetLoRAs([]conversation.LoRA{{Name: "ink", Weight: 0.3}})
+
+			calls := []ollama.ToolCall{{Function: ollama.ToolCallFunction{
+				Name:      ollama.UpdateGenerationToolName,
+				Arguments: json.RawMessage(tt.args),
+			}}}
+			clamped := s.applyAgentLoRAs(session, "test", calls)
+
+			got := session.LoRAs()
+			if len(got) != len(tt.want) {
+				t.Fatalf("LoRAs() = %+v, want %+v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("LoRA %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+			if len(clamped) != len(tt.wantClamped) {
+				t.Fatalf("clamped = %+v, want %v", clamped, tt.wantClamped)
+			}
+			for i, name := range tt.wantClamped {
+				if clamped[i].name != name {
+					t.Errorf("clamped %d = %q, want %q", i, clamped[i].name, name)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleGenerate_LoRAs(t *testing.T) {
+	requests := make(chan []byte, 1)
+	s := newDiffusionTestServer(t, requests)
+	s.sessionManager.GetSession(testGallerySessionID).SetLoRAs([]conversation.LoRA{{Name: "watercolor", Weight: 0.75}})
+
+	form := url.Values{"prompt": {"a cat"}}
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(setSessionID(req.Context(), testGallerySessionID))
+	w := httptest.NewRecorder()
+	s.handleGenerate(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	msg := <-requests
+	if got := binary.BigEndian.Uint32(msg[12:16]); got != protocol.FlagLoRAs {
+		t.Errorf("flags = %#x, want %#x", got, protocol.FlagLoRAs)
+	}
+	if !strings.Contains(string(msg), "watercolor") {
+		t.Error("request does not name the session's LoRA")
+	}
+}
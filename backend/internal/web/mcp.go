@@ -0,0 +1,491 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+// MCP (Model Context Protocol) server mode. Image generation is exposed as
+// the generate_image tool to MCP clients such as desktop LLM apps, over one
+// of two transports:
+//
+//   - stdio (ServeMCP): the client launches weave with --mcp stdio and
+//     exchanges newline-delimited JSON-RPC messages on stdin and stdout
+//   - HTTP with Server-Sent Events (--mcp sse): the client opens
+//     GET /mcp/sse, which names the URL to POST messages to, and receives
+//     responses on the stream
+//
+// Tool calls run the same generation path as POST /generate. Over HTTP they
+// count against the caller's generation rate limit and daily quota.
+
+const (
+	// mcpToolGenerateImage is the name of the image generation tool
+	mcpToolGenerateImage = "generate_image"
+
+	// mcpStdioSessionID attributes stdio generations in logs and hooks
+	mcpStdioSessionID = "mcp-stdio"
+
+	// maxMCPMessageSize bounds one JSON-RPC message
+	maxMCPMessageSize = 1 * 1024 * 1024
+
+	// MaxMCPConnections bounds concurrent MCP event streams
+	MaxMCPConnections = 16
+
+	// mcpOutboxSize is the number of messages queued for an event stream
+	mcpOutboxSize = 16
+)
+
+// mcpProtocolVersions are the supported MCP protocol versions, newest
+// first. A client asking for another version is offered the newest.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes
+const (
+	jsonRPCParseError     = -32700
+	jsonRPCInvalidRequest = -32600
+	jsonRPCMethodNotFound = -32601
+	jsonRPCInvalidParams  = -32602
+)
+
+// mcpMessage is a JSON-RPC request or notification from the client.
+// Notifications have no ID.
+type mcpMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// mcpResponse is a JSON-RPC response. Exactly one of Result and Error is set.
+type mcpResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpContent is one item of a tool result.
+type mcpContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MIMEType string `json:"mimeType,omitempty"`
+}
+
+// mcpToolResult is the result of tools/call. Tool failures are reported
+// with IsError so the calling model can see them.
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+// mcpGenerateArgs are the arguments of generate_image. Unset settings use
+// the server defaults.
+type mcpGenerateArgs struct {
+	Prompt string   `json:"prompt"`
+	Steps  *int     `json:"steps"`
+	CFG    *float64 `json:"cfg"`
+	Seed   *int64   `json:"seed"`
+}
+
+// mcpTools is the result of tools/list.
+var mcpTools = map[string]any{
+	"tools": []map[string]any{{
+		"name":        mcpToolGenerateImage,
+		"title":       "Generate image",
+		"description": "Generate an image from a text prompt with weave's local Stable Diffusion model. Returns a PNG image.",
+		"inputSchema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"prompt": map[string]any{"type": "string", "description": "Description of the image to generate"},
+				"steps":  map[string]any{"type": "integer", "minimum": 1, "maximum": 100, "description": "Inference steps; more is slower and more detailed"},
+				"cfg":    map[string]any{"type": "number", "minimum": 0, "maximum": 20, "description": "How closely to follow the prompt"},
+				"seed":   map[string]any{"type": "integer", "minimum": -1, "description": "Seed for reproducible images; -1 for random"},
+			},
+			"required": []string{"prompt"},
+		},
+	}},
+}
+
+// mcpPeer is one connected MCP client.
+type mcpPeer struct {
+	// sessionID attributes the client's generations; with rateLimited they
+	// count against the session's generation limits
+	sessionID   string
+	rateLimited bool
+
+	// send delivers a response to the client
+	send func(*mcpResponse)
+
+	// inflight cancels running requests on notifications/cancelled
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc
+}
+
+func newMCPPeer(sessionID string, rateLimited bool, send func(*mcpResponse)) *mcpPeer {
+	return &mcpPeer{
+		sessionID:   sessionID,
+		rateLimited: rateLimited,
+		send:        send,
+		inflight:    make(map[string]context.CancelFunc),
+	}
+}
+
+// handle processes one message from the client. Requests run in the
+// background so a long generation doesn't hold up pings or cancellations;
+// the response is delivered with send.
+func (p *mcpPeer) handle(ctx context.Context, s *Server, data []byte) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		p.send(mcpErrorResponse(nil, jsonRPCInvalidRequest, "batches are not supported"))
+		return
+	}
+	var msg mcpMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		p.send(mcpErrorResponse(nil, jsonRPCParseError, "invalid JSON"))
+		return
+	}
+	if msg.JSONRPC != "2.0" || msg.Method == "" {
+		if msg.ID != nil {
+			p.send(mcpErrorResponse(msg.ID, jsonRPCInvalidRequest, "invalid request"))
+		}
+		return
+	}
+
+	// Notifications get no response
+	if msg.ID == nil {
+		if msg.Method == "notifications/cancelled" {
+			p.cancel(msg.Params)
+		}
+		return
+	}
+
+	reqCtx, cancel := context.WithCancel(ctx)
+	key := string(msg.ID)
+	p.mu.Lock()
+	p.inflight[key] = cancel
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			delete(p.inflight, key)
+			p.mu.Unlock()
+			cancel()
+		}()
+		resp := s.dispatchMCP(reqCtx, p, msg)
+		// A cancelled request gets no response
+		if reqCtx.Err() == nil {
+			p.send(resp)
+		}
+	}()
+}
+
+// cancel cancels the request named by a notifications/cancelled message.
+func (p *mcpPeer) cancel(params json.RawMessage) {
+	var cancelled struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if err := json.Unmarshal(params, &cancelled); err != nil {
+		return
+	}
+	p.mu.Lock()
+	cancel := p.inflight[string(cancelled.RequestID)]
+	p.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// dispatchMCP runs a request and returns its response.
+func (s *Server) dispatchMCP(ctx context.Context, p *mcpPeer, msg mcpMessage) *mcpResponse {
+	switch msg.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(msg.Params, &params)
+		version := mcpProtocolVersions[0]
+		for _, supported := range mcpProtocolVersions {
+			if params.ProtocolVersion == supported {
+				version = supported
+			}
+		}
+		return mcpResult(msg.ID, map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "weave", "version": config.Version},
+		})
+	case "ping":
+		return mcpResult(msg.ID, map[string]any{})
+	case "tools/list":
+		return mcpResult(msg.ID, mcpTools)
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return mcpErrorResponse(msg.ID, jsonRPCInvalidParams, "invalid params")
+		}
+		if params.Name != mcpToolGenerateImage {
+			return mcpErrorResponse(msg.ID, jsonRPCInvalidParams, fmt.Sprintf("unknown tool: %s", params.Name))
+		}
+		var args mcpGenerateArgs
+		if len(params.Arguments) > 0 {
+			if err := json.Unmarshal(params.Arguments, &args); err != nil {
+				return mcpErrorResponse(msg.ID, jsonRPCInvalidParams, "invalid arguments")
+			}
+		}
+		return mcpResult(msg.ID, s.mcpGenerateImage(ctx, p, args))
+	default:
+		return mcpErrorResponse(msg.ID, jsonRPCMethodNotFound, fmt.Sprintf("method not found: %s", msg.Method))
+	}
+}
+
+// mcpGenerateImage runs the generate_image tool.
+func (s *Server) mcpGenerateImage(ctx context.Context, p *mcpPeer, args mcpGenerateArgs) mcpToolResult {
+	prompt := strings.TrimSpace(args.Prompt)
+	if prompt == "" {
+		return mcpToolError("prompt is required")
+	}
+	steps, cfg, seed := s.defaultSteps, s.defaultCFG, s.defaultSeed
+	if args.Steps != nil {
+		if *args.Steps < 1 || *args.Steps > 100 {
+			return mcpToolError("steps must be between 1 and 100")
+		}
+		steps = *args.Steps
+	}
+	if args.CFG != nil {
+		if *args.CFG < 0 || *args.CFG > 20 {
+			return mcpToolError("cfg must be between 0 and 20")
+		}
+		cfg = *args.CFG
+	}
+	if args.Seed != nil {
+		if *args.Seed < -1 {
+			return mcpToolError("seed must be -1 (random) or a non-negative number")
+		}
+		seed = *args.Seed
+	}
+
+	if p.rateLimited {
+		limit := s.rateLimiter.takeGenerate(p.sessionID)
+		if !limit.allowed {
+			log.Printf("Rate limit exceeded for session %s (mcp)", p.sessionID)
+			return mcpToolError(fmt.Sprintf("Too many generation requests; retry in %d seconds.", limit.retryAfterSeconds()))
+		}
+	}
+
+	img, err := s.renderImage(ctx, p.sessionID, "", prompt, steps, cfg, seed, 0)
+	if err != nil {
+		return mcpToolError(fmt.Sprintf("Image generation failed: %v", err))
+	}
+	return mcpToolResult{Content: []mcpContent{
+		{Type: "image", Data: base64.StdEncoding.EncodeToString(img.png), MIMEType: "image/png"},
+		{Type: "text", Text: fmt.Sprintf("Generated a %dx%d image in %d ms (steps=%d, cfg=%g, seed=%d).",
+			img.width, img.height, img.generationTime, steps, cfg, img.seed)},
+	}}
+}
+
+func mcpResult(id json.RawMessage, result any) *mcpResponse {
+	return &mcpResponse{JSONRPC: "2.0", ID: id, Result: result}
+}
+
+func mcpErrorResponse(id json.RawMessage, code int, message string) *mcpResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &mcpResponse{JSONRPC: "2.0", ID: id, Error: &mcpError{Code: code, Message: message}}
+}
+
+func mcpToolError(message string) mcpToolResult {
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: message}}, IsError: true}
+}
+
+// ServeMCP serves the MCP stdio transport: newline-delimited JSON-RPC
+// messages are read from in and responses written to out. Generations are
+// not rate limited, since the client runs weave itself. ServeMCP returns
+// when in reaches EOF or ctx is done; requests still running are cancelled.
+func (s *Server) ServeMCP(ctx context.Context, in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var writeMu sync.Mutex
+	peer := newMCPPeer(mcpStdioSessionID, false, func(resp *mcpResponse) {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			log.Printf("MCP: failed to encode response: %v", err)
+			return
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if _, err := out.Write(append(data, '\n')); err != nil {
+			log.Printf("MCP: failed to write response: %v", err)
+		}
+	})
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxMCPMessageSize)
+		for scanner.Scan() {
+			line := bytes.Clone(scanner.Bytes())
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case line := <-lines:
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			// Restarts replace the server handling requests
+			peer.handle(ctx, s.active.Load(), line)
+		case err := <-readErr:
+			if err != nil {
+				return fmt.Errorf("failed to read MCP message: %w", err)
+			}
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// mcpConnections holds the MCP clients connected over HTTP, by connection
+// ID. Shared with servers created by Reconfigure.
+type mcpConnections struct {
+	mu    sync.Mutex
+	peers map[string]*mcpConnection
+}
+
+// mcpConnection is an MCP client connected over HTTP.
+type mcpConnection struct {
+	peer *mcpPeer
+	// user who opened the connection ("" without users); messages must
+	// come from the same user
+	user string
+	ctx  context.Context
+}
+
+func newMCPConnections() *mcpConnections {
+	return &mcpConnections{peers: make(map[string]*mcpConnection)}
+}
+
+// handleMCPEvents opens an MCP event stream. The first event names the
+// URL to POST messages to; responses follow as "message" events.
+// GET /mcp/sse
+func (s *Server) handleMCPEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	connID, err := GenerateSessionID()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	outbox := make(chan []byte, mcpOutboxSize)
+	conn := &mcpConnection{
+		user: GetUser(r.Context()),
+		ctx:  ctx,
+		peer: newMCPPeer(GetSessionID(r.Context()), true, func(resp *mcpResponse) {
+			data, err := json.Marshal(resp)
+			if err != nil {
+				log.Printf("MCP: failed to encode response: %v", err)
+				return
+			}
+			select {
+			case outbox <- data:
+			case <-ctx.Done():
+			}
+		}),
+	}
+
+	s.mcpConns.mu.Lock()
+	if len(s.mcpConns.peers) >= MaxMCPConnections {
+		s.mcpConns.mu.Unlock()
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	s.mcpConns.peers[connID] = conn
+	s.mcpConns.mu.Unlock()
+	defer func() {
+		s.mcpConns.mu.Lock()
+		delete(s.mcpConns.peers, connID)
+		s.mcpConns.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	// The stream outlives the server's WriteTimeout, as /events does
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	fmt.Fprintf(w, "event: endpoint\ndata: /mcp/message?sessionId=%s\n\n", connID)
+	flusher.Flush()
+
+	for {
+		select {
+		case data := <-outbox:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			flusher.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleMCPMessage accepts a message for an MCP event stream. The response
+// is delivered on the stream.
+// POST /mcp/message?sessionId=<id>
+func (s *Server) handleMCPMessage(w http.ResponseWriter, r *http.Request) {
+	s.mcpConns.mu.Lock()
+	conn := s.mcpConns.peers[r.URL.Query().Get("sessionId")]
+	s.mcpConns.mu.Unlock()
+	// Connection IDs are unguessable, but with users they must also not
+	// work for anyone else
+	if conn == nil || conn.user != GetUser(r.Context()) {
+		http.Error(w, "MCP connection not found", http.StatusNotFound)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMCPMessageSize))
+	if err != nil {
+		http.Error(w, "Message too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	conn.peer.handle(conn.ctx, s, data)
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,427 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/persistence"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// generatingComputeConn returns a compute connection to a fake compute
+// process that answers each generate request with a 64x64 RGB image, and
+// models requests with testDiffusionModels. Generations report their seed,
+// fakeComputeSeed for a random one, and fakeComputeMetadata.
+func generatingComputeConn(t *testing.T) *client.Conn {
+	t.Helper()
+	return recordingComputeConn(t, nil)
+}
+
+// fakeComputeSeed is the seed generatingComputeConn reports for generations
+// with a random seed.
+const fakeComputeSeed = 777
+
+// fakeComputeMetadata is how generatingComputeConn says it generated images.
+var fakeComputeMetadata = protocol.GenerationMetadata{
+	ModelHash:    "a1b2c3d4",
+	Sampler:      "euler",
+	Scheduler:    "discrete",
+	TextEncodeMS: 250,
+	DiffusionMS:  9000,
+	VAEMS:        700,
+}
+
+// recordingComputeConn is generatingComputeConn, also sending each request
+// message received, header included, to requests if it is not nil.
+func recordingComputeConn(t *testing.T, requests chan<- []byte) *client.Conn {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "compute.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			header := make([]byte, 16)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+			payload := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+			if _, err := io.ReadFull(conn, payload); err != nil {
+				return
+			}
+			if requests != nil {
+				requests <- append(header, payload...)
+			}
+			if binary.BigEndian.Uint16(header[6:8]) == protocol.MsgModelsRequest {
+				conn.Write(modelsResponseFor(payload[0:8]))
+				continue
+			}
+
+			pixels := make([]byte, 64*64*3)
+			resp := make([]byte, 48, 48+len(pixels))
+			binary.BigEndian.PutUint32(resp[0:4], protocol.MagicNumber)
+			binary.BigEndian.PutUint16(resp[4:6], protocol.ProtocolVersion1)
+			binary.BigEndian.PutUint16(resp[6:8], protocol.MsgGenerateResponse)
+			binary.BigEndian.PutUint32(resp[8:12], uint32(32+len(pixels)))
+			copy(resp[16:24], payload[0:8])
+			binary.BigEndian.PutUint32(resp[24:28], protocol.StatusOK)
+			binary.BigEndian.PutUint32(resp[32:36], 64)
+			binary.BigEndian.PutUint32(resp[36:40], 64)
+			binary.BigEndian.PutUint32(resp[40:44], 3)
+			binary.BigEndian.PutUint32(resp[44:48], uint32(len(pixels)))
+			resp = append(resp, pixels...)
+			switch binary.BigEndian.Uint16(header[6:8]) {
+			case protocol.MsgGenerateRequest, protocol.MsgImg2ImgRequest, protocol.MsgInpaintRequest, protocol.MsgControlRequest:
+				seed := binary.BigEndian.Uint64(payload[28:36])
+				if seed == 0 {
+					seed = fakeComputeSeed
+				}
+				resp = binary.BigEndian.AppendUint64(resp, seed)
+				m := fakeComputeMetadata
+				for _, str := range []string{m.ModelHash, m.Sampler, m.Scheduler} {
+					resp = binary.BigEndian.AppendUint16(resp, uint16(len(str)))
+					resp = append(resp, str...)
+				}
+				resp = binary.BigEndian.AppendUint32(resp, m.TextEncodeMS)
+				resp = binary.BigEndian.AppendUint32(resp, m.DiffusionMS)
+				resp = binary.BigEndian.AppendUint32(resp, m.VAEMS)
+				binary.BigEndian.PutUint32(resp[8:12], uint32(len(resp)-16))
+				binary.BigEndian.PutUint32(resp[12:16], protocol.FlagSeed|protocol.FlagMetadata)
+			}
+			conn.Write(resp)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := client.AcceptConnection(ctx, listener)
+	if err != nil {
+		t.Fatalf("AcceptConnection() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// mcpTestResponse is a decoded JSON-RPC response.
+type mcpTestResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *mcpError       `json:"error"`
+}
+
+// stdioMCP runs ServeMCP over pipes. call sends a message and, unless the
+// message is a notification, returns the response.
+type stdioMCP struct {
+	t   *testing.T
+	in  *io.PipeWriter
+	out *bufio.Reader
+}
+
+func startStdioMCP(t *testing.T, s *Server) *stdioMCP {
+	t.Helper()
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- s.ServeMCP(context.Background(), inR, outW) }()
+	t.Cleanup(func() {
+		inW.Close()
+		if err := <-done; err != nil {
+			t.Errorf("ServeMCP() error = %v", err)
+		}
+		outR.Close()
+	})
+	return &stdioMCP{t: t, in: inW, out: bufio.NewReader(outR)}
+}
+
+func (m *stdioMCP) call(message string) mcpTestResponse {
+	m.t.Helper()
+
+	if _, err := io.WriteString(m.in, message+"\n"); err != nil {
+		m.t.Fatalf("write error = %v", err)
+	}
+	line, err := m.out.ReadBytes('\n')
+	if err != nil {
+		m.t.Fatalf("read error = %v", err)
+	}
+	var resp mcpTestResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		m.t.Fatalf("invalid response %q: %v", line, err)
+	}
+	return resp
+}
+
+func TestServeMCP_Protocol(t *testing.T) {
+	s, err := NewServerWithDeps("", nil, nil, nil, persistence.NewImageStore(t.TempDir()), nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	mcp := startStdioMCP(t, s)
+
+	tests := []struct {
+		name      string
+		message   string
+		wantID    string
+		wantError int
+		want      string // substring of the result
+	}{
+		{
+			name:    "initialize with supported version",
+			message: `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`,
+			wantID:  "1",
+			want:    `"protocolVersion":"2024-11-05"`,
+		},
+		{
+			name:    "initialize with unknown version",
+			message: `{"jsonrpc":"2.0","id":2,"method":"initialize","params":{"protocolVersion":"1999-01-01"}}`,
+			wantID:  "2",
+			want:    `"protocolVersion":"` + mcpProtocolVersions[0] + `"`,
+		},
+		{
+			name:    "tools list",
+			message: `{"jsonrpc":"2.0","id":"list","method":"tools/list"}`,
+			wantID:  `"list"`,
+			want:    `"name":"generate_image"`,
+		},
+		{
+			name:    "ping",
+			message: `{"jsonrpc":"2.0","id":3,"method":"ping"}`,
+			wantID:  "3",
+			want:    `{}`,
+		},
+		{
+			name:    "missing prompt is a tool error",
+			message: `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"generate_image","arguments":{"prompt":" "}}}`,
+			wantID:  "4",
+			want:    `"isError":true`,
+		},
+		{
+			name:    "steps out of range is a tool error",
+			message: `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"generate_image","arguments":{"prompt":"a fox","steps":500}}}`,
+			wantID:  "5",
+			want:    `steps must be between 1 and 100`,
+		},
+		{
+			name:    "compute unavailable is a tool error",
+			message: `{"jsonrpc":"2.0","id":6,"method":"tools/call","params":{"name":"generate_image","arguments":{"prompt":"a fox"}}}`,
+			wantID:  "6",
+			want:    `Image generation failed`,
+		},
+		{
+			name:      "unknown tool",
+			message:   `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"delete_everything"}}`,
+			wantID:    "7",
+			wantError: jsonRPCInvalidParams,
+		},
+		{
+			name:      "unknown method",
+			message:   `{"jsonrpc":"2.0","id":8,"method":"resources/list"}`,
+			wantID:    "8",
+			wantError: jsonRPCMethodNotFound,
+		},
+		{
+			name:      "invalid JSON",
+			message:   `{"jsonrpc":`,
+			wantID:    "null",
+			wantError: jsonRPCParseError,
+		},
+		{
+			name:      "batch",
+			message:   `[{"jsonrpc":"2.0","id":9,"method":"ping"}]`,
+			wantID:    "null",
+			wantError: jsonRPCInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := mcp.call(tt.message)
+			if string(resp.ID) != tt.wantID {
+				t.Errorf("id = %s, want %s", resp.ID, tt.wantID)
+			}
+			if tt.wantError != 0 {
+				if resp.Error == nil || resp.Error.Code != tt.wantError {
+					t.Errorf("error = %+v, want code %d", resp.Error, tt.wantError)
+				}
+				return
+			}
+			if resp.Error != nil {
+				t.Fatalf("error = %+v, want result", resp.Error)
+			}
+			if !strings.Contains(string(resp.Result), tt.want) {
+				t.Errorf("result = %s, want it to contain %s", resp.Result, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeMCP_NotificationsGetNoResponse(t *testing.T) {
+	s, err := NewServerWithDeps("", nil, nil, nil, persistence.NewImageStore(t.TempDir()), nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	mcp := startStdioMCP(t, s)
+
+	if _, err := io.WriteString(mcp.in, `{"jsonrpc":"2.0","method":"notifications/initialized"}`+"\n"); err != nil {
+		t.Fatalf("write error = %v", err)
+	}
+	// The next response answers the ping, not the notification
+	if resp := mcp.call(`{"jsonrpc":"2.0","id":1,"method":"ping"}`); string(resp.ID) != "1" {
+		t.Errorf("id = %s, want 1", resp.ID)
+	}
+}
+
+func TestServeMCP_GenerateImage(t *testing.T) {
+	store := persistence.NewImageStore(t.TempDir())
+	s, err := NewServerWithDeps("", nil, nil, nil, store, generatingComputeConn(t), nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	mcp := startStdioMCP(t, s)
+
+	resp := mcp.call(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"generate_image","arguments":{"prompt":"a fox","steps":4,"cfg":1,"seed":42}}}`)
+	if resp.Error != nil {
+		t.Fatalf("error = %+v", resp.Error)
+	}
+	var result mcpToolResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatalf("invalid result: %v", err)
+	}
+	if result.IsError || len(result.Content) != 2 {
+		t.Fatalf("result = %+v, want an image and a description", result)
+	}
+
+	image := result.Content[0]
+	if image.Type != "image" || image.MIMEType != "image/png" {
+		t.Errorf("content[0] = %s %s, want image image/png", image.Type, image.MIMEType)
+	}
+	png, err := base64.StdEncoding.DecodeString(image.Data)
+	if err != nil || !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Errorf("image data is not a base64 PNG: %v", err)
+	}
+	if text := result.Content[1].Text; !strings.Contains(text, "64x64") || !strings.Contains(text, "seed=42") {
+		t.Errorf("description = %q, want size and seed", text)
+	}
+
+	// A random seed is described as the one compute picked
+	resp = mcp.call(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"generate_image","arguments":{"prompt":"a fox","seed":-1}}}`)
+	if resp.Error != nil {
+		t.Fatalf("error = %+v", resp.Error)
+	}
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		t.Fatalf("invalid result: %v", err)
+	}
+	if text := result.Content[len(result.Content)-1].Text; !strings.Contains(text, "seed=777") {
+		t.Errorf("description = %q, want the seed compute picked", text)
+	}
+}
+
+func TestMCP_SSETransport(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{MCP: config.MCPSSE})
+	ts := httptest.NewServer(s.server.Handler)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/mcp/sse", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /mcp/sse error = %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", got)
+	}
+	events := bufio.NewReader(resp.Body)
+
+	// readEvent returns the type and data of the next event
+	readEvent := func() (string, string) {
+		t.Helper()
+		var eventType, data string
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read event error = %v", err)
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case line == "":
+				return eventType, data
+			case strings.HasPrefix(line, "event: "):
+				eventType = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}
+
+	eventType, endpoint := readEvent()
+	if eventType != "endpoint" || !strings.HasPrefix(endpoint, "/mcp/message?sessionId=") {
+		t.Fatalf("first event = %s %q, want endpoint", eventType, endpoint)
+	}
+
+	post, err := http.Post(ts.URL+endpoint, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	if err != nil {
+		t.Fatalf("POST %s error = %v", endpoint, err)
+	}
+	post.Body.Close()
+	if post.StatusCode != http.StatusAccepted {
+		t.Errorf("POST status = %d, want %d", post.StatusCode, http.StatusAccepted)
+	}
+
+	eventType, data := readEvent()
+	if eventType != "message" || !strings.Contains(data, `"name":"generate_image"`) {
+		t.Errorf("response event = %s %s, want the tools list", eventType, data)
+	}
+
+	// Unknown connections are rejected
+	post, err = http.Post(ts.URL+"/mcp/message?sessionId=unknown", "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	if err != nil {
+		t.Fatalf("POST error = %v", err)
+	}
+	post.Body.Close()
+	if post.StatusCode != http.StatusNotFound {
+		t.Errorf("POST to unknown connection status = %d, want %d", post.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestMCP_SSERequiresAPIToken(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{MCP: config.MCPSSE, APIToken: testAPIToken})
+
+	w := serveAs(s, http.MethodGet, "/mcp/sse", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("GET /mcp/sse without token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestMCP_SSEDisabledByDefault(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	w := serveAs(s, http.MethodPost, "/mcp/message?sessionId=x", testGallerySessionID)
+	if w.Code != http.StatusMethodNotAllowed && w.Code != http.StatusNotFound {
+		t.Errorf("POST /mcp/message status = %d, want 404 or 405", w.Code)
+	}
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+)
+
+func TestHandleDeleteMessage(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	manager := s.sessionManager.GetSession(testGallerySessionID).Manager()
+	if err := s.imageStore.SaveAlternate(testGallerySessionID, 1, 1, []byte("alternate-png")); err != nil {
+		t.Fatalf("SaveAlternate() error = %v", err)
+	}
+	manager.AddMessageAlternate(1, conversation.ImageAlternate{URL: s.imageStore.GetAlternateURL(testGallerySessionID, 1, 1), Seed: 7})
+
+	w := serveAs(s, http.MethodPost, "/sessions/"+testGallerySessionID+"/images/1.png/publish", testGallerySessionID)
+	var published struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &published); err != nil {
+		t.Fatalf("publish response is not JSON: %v", err)
+	}
+
+	events := recordEvents(s, testGallerySessionID)
+	w = serveAs(s, http.MethodDelete, "/message/1", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	if manager.GetMessage(1) != nil {
+		t.Error("message still in history after delete")
+	}
+	if manager.GetCurrentPrompt() != "" {
+		t.Errorf("current prompt = %q, want rolled back to empty", manager.GetCurrentPrompt())
+	}
+	if s.imageStore.Exists(testGallerySessionID, 1) {
+		t.Error("message image still stored after delete")
+	}
+	if _, err := s.imageStore.LoadAlternate(testGallerySessionID, 1, 1); err == nil {
+		t.Error("message alternate still stored after delete")
+	}
+	if w := serveAs(s, http.MethodGet, published.URL, ""); w.Code != http.StatusNotFound {
+		t.Errorf("gallery image status = %d after delete, want %d", w.Code, http.StatusNotFound)
+	}
+	if !strings.Contains(events.Body.String(), "event: "+EventMessageDeleted) {
+		t.Errorf("events = %q, want a %s event", events.Body.String(), EventMessageDeleted)
+	}
+}
+
+func TestHandleDeleteMessage_Errors(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	tests := []struct {
+		name       string
+		path       string
+		sessionID  string
+		wantStatus int
+	}{
+		{name: "invalid ID", path: "/message/abc", sessionID: testGallerySessionID, wantStatus: http.StatusBadRequest},
+		{name: "zero ID", path: "/message/0", sessionID: testGallerySessionID, wantStatus: http.StatusBadRequest},
+		{name: "unknown message", path: "/message/99", sessionID: testGallerySessionID, wantStatus: http.StatusNotFound},
+		{name: "another session's message", path: "/message/1", sessionID: testDeleteSessionID, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAs(s, http.MethodDelete, tt.path, tt.sessionID)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	if s.sessionManager.GetSession(testGallerySessionID).Manager().GetMessage(1) == nil {
+		t.Error("message deleted by a failed request")
+	}
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/hurricanerix/weave/internal/conversation"
 	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
 )
 
 func TestHandleMessageState(t *testing.T) {
@@ -44,6 +46,21 @@ func TestHandleMessageState(t *testing.T) {
 				PreviewURL:    "",
 			},
 		},
+		{
+			name:      "generation metadata",
+			messageID: "1",
+			setupConv: func(m *conversation.Manager) {
+				id := m.AddAssistantMessage("Here's your cat!", "a cat", &ollama.LLMMetadata{Prompt: "a cat", GenerateImage: true})
+				m.SetMessageGeneration(id, &conversation.GenerationMetadata{ModelHash: "a1b2c3d4", Sampler: "euler", Scheduler: "discrete", TextEncodeMS: 250, DiffusionMS: 9000, VAEMS: 700})
+			},
+			wantStatus: http.StatusOK,
+			wantResponse: &messageStateResponse{
+				MessageID:     1,
+				Prompt:        "a cat",
+				PreviewStatus: "none",
+				Generation:    &conversation.GenerationMetadata{ModelHash: "a1b2c3d4", Sampler: "euler", Scheduler: "discrete", TextEncodeMS: 250, DiffusionMS: 9000, VAEMS: 700},
+			},
+		},
 		{
 			name:      "message without snapshot",
 			messageID: "1",
@@ -54,6 +71,23 @@ func TestHandleMessageState(t *testing.T) {
 			wantStatus:     http.StatusNotFound,
 			wantErrMessage: "Message has no snapshot",
 		},
+		{
+			name:      "conversational message with usage",
+			messageID: "2",
+			setupConv: func(m *conversation.Manager) {
+				first := m.AddAssistantMessage("Hello!", "", nil)
+				m.SetMessageUsage(first, ollama.Usage{PromptTokens: 300, CompletionTokens: 5})
+				second := m.AddAssistantMessage("What should I draw?", "", nil)
+				m.SetMessageUsage(second, ollama.Usage{PromptTokens: 320, CompletionTokens: 7})
+			},
+			wantStatus: http.StatusOK,
+			wantResponse: &messageStateResponse{
+				MessageID:     2,
+				PreviewStatus: "none",
+				Usage:         &ollama.Usage{PromptTokens: 320, CompletionTokens: 7},
+				ChatUsage:     ollama.Usage{PromptTokens: 620, CompletionTokens: 12},
+			},
+		},
 		{
 			name:           "message not found",
 			messageID:      "999",
@@ -139,6 +173,17 @@ func TestHandleMessageState(t *testing.T) {
 				if response.PreviewURL != tt.wantResponse.PreviewURL {
 					t.Errorf("PreviewURL = %q, want %q", response.PreviewURL, tt.wantResponse.PreviewURL)
 				}
+				if (response.Usage == nil) != (tt.wantResponse.Usage == nil) ||
+					(response.Usage != nil && *response.Usage != *tt.wantResponse.Usage) {
+					t.Errorf("Usage = %+v, want %+v", response.Usage, tt.wantResponse.Usage)
+				}
+				if response.ChatUsage != tt.wantResponse.ChatUsage {
+					t.Errorf("ChatUsage = %+v, want %+v", response.ChatUsage, tt.wantResponse.ChatUsage)
+				}
+				if (response.Generation == nil) != (tt.wantResponse.Generation == nil) ||
+					(response.Generation != nil && *response.Generation != *tt.wantResponse.Generation) {
+					t.Errorf("Generation = %+v, want %+v", response.Generation, tt.wantResponse.Generation)
+				}
 			}
 
 			// Check error message if expected
@@ -152,6 +197,45 @@ func TestHandleMessageState(t *testing.T) {
 	}
 }
 
+func TestComputeImage_GenerationMetadata(t *testing.T) {
+	s, err := NewServerWithDeps("", nil, nil, nil, persistence.NewImageStore(t.TempDir()), generatingComputeConn(t), nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+
+	img, err := s.computeImage(context.Background(), "", "", "a cat", 4, 1, 42, 0)
+	if err != nil {
+		t.Fatalf("computeImage() error = %v", err)
+	}
+	want := generationMetadata(&fakeComputeMetadata)
+	if img.generation == nil || *img.generation != *want {
+		t.Errorf("generation = %+v, want %+v", img.generation, want)
+	}
+}
+
+func TestRunChatTurn_RecordsUsage(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	s.setLLMClientForTesting(&mockOllamaClient{responses: []mockResponse{{
+		result: ollama.ChatResult{Response: "Hello", Usage: ollama.Usage{PromptTokens: 812, CompletionTokens: 37}, Model: "llama3.2:3b"},
+		tokens: []string{},
+	}}})
+
+	recordEvents(s, testGallerySessionID)
+
+	session := s.sessionManager.GetSession(testGallerySessionID)
+	manager := session.Manager()
+	s.runChatTurn(context.Background(), session, testGallerySessionID, "", manager, "hi", 20, 3.5, -1)
+
+	messages := manager.GetMessages()
+	last := messages[len(messages)-1]
+	if last.Role != conversation.RoleAssistant || last.Usage == nil || last.Usage.PromptTokens != 812 || last.Usage.CompletionTokens != 37 {
+		t.Errorf("last message = %+v, want the reply with its usage", last)
+	}
+	if last.Model != "llama3.2:3b" {
+		t.Errorf("last message model = %q, want the model that wrote it", last.Model)
+	}
+}
+
 // contains checks if s contains substr (case-sensitive).
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
@@ -0,0 +1,105 @@
+package web
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/hurricanerix/weave/internal/metrics"
+)
+
+// Web server metrics, exported at GET /metrics
+var (
+	httpRequests       = metrics.NewCounterVec("weave_http_requests_total", "HTTP requests handled, by method and status code.", "method", "code")
+	generationDuration = metrics.NewHistogram("weave_generation_duration_seconds", "Time to generate and encode an image, for successful generations.", metrics.SlowBuckets)
+	sseConnections     = metrics.NewGauge("weave_sse_connections", "Open server-sent event connections.")
+)
+
+// statusRecorder captures the status code and body size written by a
+// handler. It implements http.Flusher for SSE, io.ReaderFrom so http.ServeContent
+// can use sendfile, and Unwrap for http.ResponseController.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	var n int64
+	var err error
+	if rf, ok := r.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(r.ResponseWriter, src)
+	}
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// countRequests wraps the handler to count requests by method and status.
+func countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			httpRequests.With(metricMethod(r.Method), strconv.Itoa(status)).Inc()
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// metricMethod limits the method label to standard methods so clients
+// cannot create unbounded label values.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
+
+// handleMetrics serves metrics in the Prometheus text format.
+// GET /metrics
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.updateStorageMetrics()
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := metrics.Default.WriteTo(w); err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+	}{
+		{name: "normal mode"},
+		{name: "gallery-only mode", cfg: &config.Config{GalleryOnly: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, tt.cfg)
+
+			// Count a request before scraping
+			serveAs(s, http.MethodGet, "/gallery", "")
+
+			w := serveAs(s, http.MethodGet, "/metrics", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+				t.Errorf("Content-Type = %q, want Prometheus text format", got)
+			}
+
+			body := w.Body.String()
+			for _, want := range []string{
+				`weave_http_requests_total{method="GET",code="200"}`,
+				"# TYPE weave_sse_connections gauge",
+				"# TYPE weave_generation_duration_seconds histogram",
+				"# TYPE weave_ollama_chat_duration_seconds histogram",
+				"# TYPE weave_ollama_tokens_streamed_total counter",
+				"# TYPE weave_compute_queue_depth gauge",
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("metrics missing %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestCountRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		handler http.HandlerFunc
+		labels  []string
+	}{
+		{
+			name:    "explicit status",
+			method:  http.MethodPost,
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) },
+			labels:  []string{"POST", "418"},
+		},
+		{
+			name:    "implicit 200",
+			method:  http.MethodDelete,
+			handler: func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) },
+			labels:  []string{"DELETE", "200"},
+		},
+		{
+			name:   "implicit 200 from ReadFrom",
+			method: http.MethodPut,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.(io.ReaderFrom).ReadFrom(strings.NewReader("ok"))
+			},
+			labels: []string{"PUT", "200"},
+		},
+		{
+			name:    "nonstandard method",
+			method:  "BREW",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			labels:  []string{"other", "200"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := httpRequests.With(tt.labels...)
+			before := counter.Value()
+
+			countRequests(tt.handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, "/", nil))
+
+			if got := counter.Value() - before; got != 1 {
+				t.Errorf("counter %v increased by %v, want 1", tt.labels, got)
+			}
+		})
+	}
+}
+
+func TestStatusRecorder_Flush(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &statusRecorder{ResponseWriter: w}
+
+	// SSE requires the wrapped writer to stay flushable
+	var _ http.Flusher = rec
+	rec.Flush()
+	if !w.Flushed {
+		t.Error("Flush() did not flush the underlying writer")
+	}
+	if err := http.NewResponseController(rec).Flush(); err != nil {
+		t.Errorf("ResponseController.Flush() error = %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package web
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/hurricanerix/weave/internal/llm"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// MaxModelNameLength is the longest model name accepted by
+// POST /settings/model.
+const MaxModelNameLength = 256
+
+// modelResponse describes an ollama model in API responses.
+type modelResponse struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	ModifiedAt string `json:"modified_at,omitempty"`
+}
+
+// modelListResponse is the response for GET /models.
+type modelListResponse struct {
+	Status  string          `json:"status"`
+	Default string          `json:"default"`
+	Current string          `json:"current"`
+	Models  []modelResponse `json:"models"`
+}
+
+// modelSettingResponse is the response for POST /settings/model.
+type modelSettingResponse struct {
+	Status string `json:"status"`
+	Model  string `json:"model"`
+}
+
+// handleListModels lists the models available in ollama, the configured
+// default, and the model the session's chats use.
+// GET /models
+func (s *Server) handleListModels(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	lister, ok := s.llmClient.(llm.ModelLister)
+	if !ok {
+		writeJSONError(w, http.StatusServiceUnavailable, "model listing is not available")
+		return
+	}
+	models, err := lister.ListModels(r.Context())
+	if err != nil {
+		writeModelListError(w, sessionID, err)
+		return
+	}
+
+	resp := modelListResponse{
+		Status:  "ok",
+		Default: lister.Model(),
+		Current: lister.Model(),
+		Models:  make([]modelResponse, 0, len(models)),
+	}
+	if model := s.sessionManager.GetSession(sessionID).Model(); model != "" {
+		resp.Current = model
+	}
+	for _, m := range models {
+		resp.Models = append(resp.Models, modelResponse{Name: m.Name, Size: m.Size, ModifiedAt: m.ModifiedAt})
+	}
+	writeChatJSON(w, http.StatusOK, resp)
+}
+
+// handleSetModel switches the chat model for the session. The model must be
+// one ollama has; an empty model reverts to the configured default.
+// POST /settings/model (form: model)
+func (s *Server) handleSetModel(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+	model := r.FormValue("model")
+	if len(model) > MaxModelNameLength {
+		writeJSONError(w, http.StatusBadRequest, "model name too long")
+		return
+	}
+
+	lister, ok := s.llmClient.(llm.ModelLister)
+	if !ok {
+		writeJSONError(w, http.StatusServiceUnavailable, "model switching is not available")
+		return
+	}
+
+	if model != "" && model != lister.Model() {
+		models, err := lister.ListModels(r.Context())
+		if err != nil {
+			writeModelListError(w, sessionID, err)
+			return
+		}
+		found := false
+		for _, m := range models {
+			if m.Name == model {
+				found = true
+				break
+			}
+		}
+		if !found {
+			writeJSONError(w, http.StatusNotFound, "model not available in ollama")
+			return
+		}
+	}
+
+	// Storing the default as "" keeps the session on the configured model
+	// if the server is restarted with a different one
+	if model == lister.Model() {
+		model = ""
+	}
+	s.sessionManager.GetSession(sessionID).SetModel(model)
+
+	current := model
+	if current == "" {
+		current = lister.Model()
+	}
+	log.Printf("Session %s switched chat model to %s", sessionID, current)
+	writeChatJSON(w, http.StatusOK, modelSettingResponse{Status: "ok", Model: current})
+}
+
+// writeModelListError writes the JSON error for a failed ollama model list.
+func writeModelListError(w http.ResponseWriter, sessionID string, err error) {
+	log.Printf("Failed to list ollama models for session %s: %v", sessionID, err)
+	if errors.Is(err, ollama.ErrNotRunning) || errors.Is(err, ollama.ErrConnectionTimeout) ||
+		errors.Is(err, llm.ErrNotRunning) || errors.Is(err, llm.ErrConnectionTimeout) {
+		writeJSONError(w, http.StatusServiceUnavailable, "ollama is not reachable")
+		return
+	}
+	writeJSONError(w, http.StatusBadGateway, "failed to list ollama models")
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// newModelTestServer returns a test server whose ollama client talks to a
+// fake ollama with the given models; "llama3.1:8b" is the default.
+func newModelTestServer(t *testing.T, models ...string) *Server {
+	t.Helper()
+
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tags ollama.TagsResponse
+		for _, name := range models {
+			tags.Models = append(tags.Models, ollama.ModelInfo{Name: name, Size: 1000})
+		}
+		json.NewEncoder(w).Encode(tags)
+	}))
+	t.Cleanup(fake.Close)
+
+	s := newGalleryTestServer(t, nil)
+	s.setLLMClientForTesting(ollama.NewClientWithConfig(fake.URL, "llama3.1:8b", 5*time.Second))
+	return s
+}
+
+// postModel posts a model choice to /settings/model as the test session.
+func postModel(s *Server, model string) *httptest.ResponseRecorder {
+	form := url.Values{"model": {model}}
+	req := httptest.NewRequest(http.MethodPost, "/settings/model", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+	req.Header.Set(CSRFHeaderName, s.csrfToken(testGallerySessionID))
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleListModels(t *testing.T) {
+	s := newModelTestServer(t, "llama3.1:8b", "qwen2.5:7b")
+
+	w := serveAs(s, http.MethodGet, "/models", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp modelListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Default != "llama3.1:8b" || resp.Current != "llama3.1:8b" {
+		t.Errorf("default, current = %q, %q, want llama3.1:8b for both", resp.Default, resp.Current)
+	}
+	if len(resp.Models) != 2 || resp.Models[1].Name != "qwen2.5:7b" {
+		t.Errorf("models = %+v, want llama3.1:8b and qwen2.5:7b", resp.Models)
+	}
+
+	// The session's choice is reported as current
+	if w := postModel(s, "qwen2.5:7b"); w.Code != http.StatusOK {
+		t.Fatalf("set model status = %d: %s", w.Code, w.Body.String())
+	}
+	w = serveAs(s, http.MethodGet, "/models", testGallerySessionID)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Current != "qwen2.5:7b" {
+		t.Errorf("current = %q, want %q", resp.Current, "qwen2.5:7b")
+	}
+}
+
+func TestHandleListModels_OllamaDown(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	s.setLLMClientForTesting(ollama.NewClientWithConfig("http://127.0.0.1:1", "llama3.1:8b", time.Second))
+
+	w := serveAs(s, http.MethodGet, "/models", testGallerySessionID)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHandleSetModel(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		wantCode  int
+		wantModel string // stored on the session
+	}{
+		{"available model", "qwen2.5:7b", http.StatusOK, "qwen2.5:7b"},
+		{"default model", "llama3.1:8b", http.StatusOK, ""},
+		{"reset", "", http.StatusOK, ""},
+		{"unknown model", "mistral:7b", http.StatusNotFound, ""},
+		{"name too long", strings.Repeat("m", MaxModelNameLength+1), http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newModelTestServer(t, "llama3.1:8b", "qwen2.5:7b")
+
+			w := postModel(s, tt.model)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if got := s.sessionManager.GetSession(testGallerySessionID).Model(); got != tt.wantModel {
+				t.Errorf("session model = %q, want %q", got, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestHandleSetModel_Unsupported(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	s.setLLMClientForTesting(&mockOllamaClient{})
+
+	if w := postModel(s, "qwen2.5:7b"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
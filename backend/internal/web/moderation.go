@@ -0,0 +1,146 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/moderation"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// errModerationUnavailable is returned when a prompt can't be checked in
+// block mode, so it isn't generated unchecked.
+var errModerationUnavailable = errors.New("content moderation is unavailable")
+
+// moderationAuditResponse is the response for GET /moderation/audit.
+type moderationAuditResponse struct {
+	Status  string                        `json:"status"`
+	Entries []persistence.ModerationEntry `json:"entries"`
+}
+
+// configureModeration builds the moderators enabled by cfg: the keyword
+// list first, since it is cheap, then the LLM classifier.
+func (s *Server) configureModeration(cfg *config.Config) error {
+	if cfg.ModerationMode != "" {
+		mode, err := moderation.ParseMode(cfg.ModerationMode)
+		if err != nil {
+			return err
+		}
+		s.moderationMode = mode
+	}
+
+	var chain moderation.Chain
+	if cfg.ModerationList != "" {
+		list, err := moderation.LoadKeywordList(cfg.ModerationList)
+		if err != nil {
+			return err
+		}
+		chain = append(chain, list)
+	}
+	if cfg.ModerationLLM {
+		chain = append(chain, moderation.NewClassifier(s.classifyChat))
+	}
+	if len(chain) > 0 {
+		s.moderator = chain
+	}
+	return nil
+}
+
+// classifyChat sends a moderation classifier request to the chat LLM.
+func (s *Server) classifyChat(ctx context.Context, system, user string) (string, error) {
+	result, err := s.llmClient.Chat(ctx, []ollama.Message{
+		{Role: ollama.RoleSystem, Content: system},
+		{Role: ollama.RoleUser, Content: user},
+	}, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return result.Response, nil
+}
+
+// moderatePrompt checks an image prompt against the content rules. Flagged
+// prompts are recorded in the session's audit; in block mode they return
+// moderation.ErrBlocked after an SSE error, and in warn mode a
+// prompt-flagged event is sent and generation goes ahead.
+//
+// If the check itself fails, block mode refuses the prompt and warn mode
+// lets it through. The reason a prompt was flagged is kept out of errors
+// and events, since it would reveal the rules.
+func (s *Server) moderatePrompt(ctx context.Context, sessionID, chatID string, messageID int, prompt string) error {
+	if s.moderator == nil {
+		return nil
+	}
+
+	result, err := s.moderator.Moderate(ctx, prompt)
+	if err != nil {
+		if s.moderationMode == moderation.ModeWarn {
+			log.Printf("Moderation check failed for session %s, generating unchecked: %v", sessionID, err)
+			return nil
+		}
+		log.Printf("Moderation check failed for session %s: %v", sessionID, err)
+		s.sendErrorEvent(sessionID, chatID, "The prompt couldn't be checked against the content rules. Please try again.")
+		return fmt.Errorf("%w: %v", errModerationUnavailable, err)
+	}
+	if !result.Flagged {
+		return nil
+	}
+
+	action := persistence.ModerationBlocked
+	if s.moderationMode == moderation.ModeWarn {
+		action = persistence.ModerationWarned
+	}
+	log.Printf("Moderation %s prompt for session %s: %s", action, sessionID, result.Reason)
+	if err := s.moderationLog.Record(sessionID, persistence.ModerationEntry{
+		Time:      time.Now().UTC(),
+		MessageID: messageID,
+		Prompt:    prompt,
+		Reason:    result.Reason,
+		Action:    action,
+	}); err != nil {
+		log.Printf("Failed to record moderation audit for session %s: %v", sessionID, err)
+	}
+
+	if action == persistence.ModerationWarned {
+		_ = s.sendChatEvent(sessionID, chatID, EventPromptFlagged, PromptFlaggedData{MessageID: messageID})
+		return nil
+	}
+	s.sendErrorEvent(sessionID, chatID, "This prompt was blocked by the content filter. Try describing something else.")
+	return moderation.ErrBlocked
+}
+
+// handleModerationAudit lists the session's prompts flagged by moderation,
+// oldest first.
+// GET /moderation/audit
+func (s *Server) handleModerationAudit(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	entries, err := s.moderationLog.List(sessionID)
+	if err != nil {
+		log.Printf("Failed to list moderation audit for session %s: %v", sessionID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to load moderation audit")
+		return
+	}
+	writeChatJSON(w, http.StatusOK, moderationAuditResponse{Status: "ok", Entries: entries})
+}
+
+// moderationError returns the HTTP status and message for a generation
+// refused by moderation. ok is false if err isn't a moderation error.
+func moderationError(err error) (status int, message string, ok bool) {
+	switch {
+	case errors.Is(err, moderation.ErrBlocked):
+		return http.StatusUnprocessableEntity, moderation.ErrBlocked.Error(), true
+	case errors.Is(err, errModerationUnavailable):
+		return http.StatusServiceUnavailable, errModerationUnavailable.Error(), true
+	}
+	return 0, "", false
+}
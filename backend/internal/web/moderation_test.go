@@ -0,0 +1,196 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/moderation"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// postGenerate calls handleGenerate for the gallery test session.
+func postGenerate(s *Server, prompt string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader("prompt="+prompt+"&steps=8&cfg=2.0&seed=7"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(setSessionID(req.Context(), testGallerySessionID))
+	w := httptest.NewRecorder()
+	s.handleGenerate(w, req)
+	return w
+}
+
+func TestModeratePrompt_Generate(t *testing.T) {
+	list, err := moderation.ParseKeywordList("gore\n")
+	if err != nil {
+		t.Fatalf("ParseKeywordList() error = %v", err)
+	}
+	failing := moderation.ModeratorFunc(func(context.Context, string) (moderation.Result, error) {
+		return moderation.Result{}, errors.New("classifier down")
+	})
+
+	tests := []struct {
+		name       string
+		moderator  moderation.Moderator
+		mode       moderation.Mode
+		prompt     string
+		wantStatus int
+		wantBody   string
+		wantAudit  string
+		wantEvent  string
+	}{
+		{
+			// The nil compute client fails generation once moderation passes
+			name: "clean prompt", moderator: list, mode: moderation.ModeBlock, prompt: "a+red+fox",
+			wantStatus: http.StatusServiceUnavailable, wantBody: "generation failed",
+		},
+		{
+			name: "blocked", moderator: list, mode: moderation.ModeBlock, prompt: "lots+of+gore",
+			wantStatus: http.StatusUnprocessableEntity, wantBody: moderation.ErrBlocked.Error(),
+			wantAudit: persistence.ModerationBlocked, wantEvent: EventError,
+		},
+		{
+			name: "warned", moderator: list, mode: moderation.ModeWarn, prompt: "lots+of+gore",
+			wantStatus: http.StatusServiceUnavailable, wantBody: "generation failed",
+			wantAudit: persistence.ModerationWarned, wantEvent: EventPromptFlagged,
+		},
+		{
+			name: "check fails in block mode", moderator: failing, mode: moderation.ModeBlock, prompt: "a+red+fox",
+			wantStatus: http.StatusServiceUnavailable, wantBody: errModerationUnavailable.Error(),
+		},
+		{
+			name: "check fails in warn mode", moderator: failing, mode: moderation.ModeWarn, prompt: "a+red+fox",
+			wantStatus: http.StatusServiceUnavailable, wantBody: "generation failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, nil)
+			s.moderator = tt.moderator
+			s.moderationMode = tt.mode
+			events := recordEvents(s, testGallerySessionID)
+
+			w := postGenerate(s, tt.prompt)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if strings.Contains(w.Body.String()+events.Body.String(), "matched keyword") {
+				t.Error("the moderation reason was shown to the user")
+			}
+
+			entries, err := s.moderationLog.List(testGallerySessionID)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if tt.wantAudit == "" {
+				if len(entries) != 0 {
+					t.Errorf("audit = %+v, want empty", entries)
+				}
+				return
+			}
+			if len(entries) != 1 || entries[0].Action != tt.wantAudit || entries[0].Prompt != "lots of gore" || entries[0].Reason != `matched keyword "gore"` {
+				t.Errorf("audit = %+v, want one %s entry for the prompt", entries, tt.wantAudit)
+			}
+			if !strings.Contains(events.Body.String(), "event: "+tt.wantEvent) {
+				t.Errorf("events = %q, want %s", events.Body.String(), tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestModeratePrompt_Classifier(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	s.setLLMClientForTesting(&mockOllamaClient{responses: []mockResponse{
+		{result: ollama.ChatResult{Response: "UNSAFE: graphic violence"}},
+	}})
+	if err := s.configureModeration(&config.Config{ModerationLLM: true}); err != nil {
+		t.Fatalf("configureModeration() error = %v", err)
+	}
+
+	err := s.moderatePrompt(context.Background(), testGallerySessionID, "", 0, "a duel")
+	if !errors.Is(err, moderation.ErrBlocked) {
+		t.Fatalf("moderatePrompt() error = %v, want ErrBlocked", err)
+	}
+	entries, _ := s.moderationLog.List(testGallerySessionID)
+	if len(entries) != 1 || entries[0].Reason != "classified unsafe: graphic violence" {
+		t.Errorf("audit = %+v, want the classifier's reason", entries)
+	}
+}
+
+func TestConfigureModeration(t *testing.T) {
+	listPath := filepath.Join(t.TempDir(), "blocked.txt")
+	if err := os.WriteFile(listPath, []byte("gore\n"), 0644); err != nil {
+		t.Fatalf("failed to write list: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		cfg       config.Config
+		wantCount int
+		wantMode  moderation.Mode
+		wantErr   bool
+	}{
+		{name: "disabled", cfg: config.Config{}, wantMode: moderation.ModeBlock},
+		{name: "keyword list", cfg: config.Config{ModerationList: listPath}, wantCount: 1, wantMode: moderation.ModeBlock},
+		{name: "list and llm warn", cfg: config.Config{ModerationList: listPath, ModerationLLM: true, ModerationMode: "warn"}, wantCount: 2, wantMode: moderation.ModeWarn},
+		{name: "missing list", cfg: config.Config{ModerationList: filepath.Join(t.TempDir(), "missing.txt")}, wantErr: true},
+		{name: "unknown mode", cfg: config.Config{ModerationMode: "log"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{moderationMode: moderation.ModeBlock}
+			err := s.configureModeration(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("configureModeration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			chain, _ := s.moderator.(moderation.Chain)
+			if len(chain) != tt.wantCount || (tt.wantCount == 0 && s.moderator != nil) {
+				t.Errorf("moderators = %d, want %d", len(chain), tt.wantCount)
+			}
+			if s.moderationMode != tt.wantMode {
+				t.Errorf("mode = %q, want %q", s.moderationMode, tt.wantMode)
+			}
+		})
+	}
+}
+
+func TestHandleModerationAudit(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	if err := s.moderationLog.Record(testGallerySessionID, persistence.ModerationEntry{Prompt: "lots of gore", Reason: "matched", Action: persistence.ModerationBlocked}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	w := serveAs(s, http.MethodGet, "/moderation/audit", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp moderationAuditResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Entries) != 1 || resp.Entries[0].Prompt != "lots of gore" {
+		t.Errorf("entries = %+v, want the recorded entry", resp.Entries)
+	}
+
+	// Other sessions have their own audit
+	w = serveAs(s, http.MethodGet, "/moderation/audit", "00112233445566778899aabbccddeeff")
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Entries) != 0 {
+		t.Errorf("other session entries = %+v, want empty", resp.Entries)
+	}
+}
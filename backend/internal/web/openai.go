@@ -0,0 +1,203 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/hooks"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/moderation"
+)
+
+// OpenAI-compatible image generation, so tools and SDKs written for the
+// OpenAI Images API can use weave as a local backend. The API key is
+// weave's API token when one is configured and ignored otherwise.
+
+const (
+	// openAIMaxImages bounds n; more images than the per-minute
+	// generation limit could never be generated in one request
+	openAIMaxImages = MaxGenerateRequestsPerMinute
+)
+
+// OpenAI response formats
+const (
+	openAIFormatURL    = "url"
+	openAIFormatBase64 = "b64_json"
+)
+
+// openAIImageRequest is the body of POST /v1/images/generations. Fields
+// weave has no equivalent for, such as model, quality and style, are
+// accepted and ignored.
+type openAIImageRequest struct {
+	Prompt         string `json:"prompt"`
+	N              *int   `json:"n"`
+	Size           string `json:"size"`
+	ResponseFormat string `json:"response_format"`
+}
+
+type openAIImageResponse struct {
+	Created int64             `json:"created"`
+	Data    []openAIImageData `json:"data"`
+}
+
+type openAIImageData struct {
+	URL     string `json:"url,omitempty"`
+	B64JSON string `json:"b64_json,omitempty"`
+}
+
+// openAIErrorResponse is the OpenAI error body.
+type openAIErrorResponse struct {
+	Error openAIError `json:"error"`
+}
+
+type openAIError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+// writeOpenAIError writes an error in the OpenAI format. param names the
+// offending request field ("" for none).
+func writeOpenAIError(w http.ResponseWriter, statusCode int, errType, param, message string) {
+	body := openAIErrorResponse{Error: openAIError{Message: message, Type: errType}}
+	if param != "" {
+		body.Error.Param = &param
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// handleOpenAIImageGenerations generates images in the OpenAI Images API
+// format. Each image counts as one generation against the rate limits.
+// POST /v1/images/generations
+func (s *Server) handleOpenAIImageGenerations(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+
+	// Only JSON bodies: browsers can't send them cross-site without CORS
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeOpenAIError(w, http.StatusUnsupportedMediaType, "invalid_request_error", "", "Content-Type must be application/json")
+		return
+	}
+
+	var req openAIImageRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxRequestBodySize)).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", "Request body must be a JSON object")
+		return
+	}
+
+	prompt := strings.TrimSpace(req.Prompt)
+	if prompt == "" {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "prompt", "prompt is required")
+		return
+	}
+	n := 1
+	if req.N != nil {
+		n = *req.N
+	}
+	if n < 1 || n > openAIMaxImages {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "n",
+			fmt.Sprintf("n must be between 1 and %d", openAIMaxImages))
+		return
+	}
+	// weave renders the session's size; the default and "auto" select it
+	width, height := s.generateSize(sessionID)
+	if size := fmt.Sprintf("%dx%d", width, height); req.Size != "" && req.Size != "auto" && req.Size != size {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "size",
+			fmt.Sprintf("size must be %s or auto", size))
+		return
+	}
+	format := req.ResponseFormat
+	if format == "" {
+		format = openAIFormatURL
+	}
+	if format != openAIFormatURL && format != openAIFormatBase64 {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "response_format",
+			"response_format must be url or b64_json")
+		return
+	}
+
+	// Reserve all generations before starting any
+	var limit rateLimit
+	for range n {
+		limit = s.rateLimiter.takeGenerate(sessionID)
+		if !limit.allowed {
+			log.Printf("Rate limit exceeded for session %s (openai)", sessionID)
+			limit.setHeaders(w)
+			writeOpenAIError(w, http.StatusTooManyRequests, "rate_limit_error", "",
+				fmt.Sprintf("Rate limit exceeded; retry in %d seconds", limit.retryAfterSeconds()))
+			return
+		}
+	}
+	limit.setHeaders(w)
+
+	resp := openAIImageResponse{Created: time.Now().Unix(), Data: make([]openAIImageData, 0, n)}
+	for i := range n {
+		// A fixed seed would make every image the same
+		seed := s.defaultSeed
+		if seed != -1 {
+			seed += int64(i)
+		}
+
+		img, err := s.renderImage(r.Context(), sessionID, "", prompt, s.defaultSteps, s.defaultCFG, seed, 0)
+		if err != nil {
+			if errors.Is(err, moderation.ErrBlocked) {
+				writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "prompt", "The prompt was rejected by content moderation")
+			} else if errors.Is(err, client.ErrComputeNotRunning) || errors.Is(err, client.ErrXDGNotSet) || errors.Is(err, errModerationUnavailable) {
+				writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "", "Image generation is not available")
+			} else {
+				writeOpenAIError(w, http.StatusInternalServerError, "server_error", "", "Image generation failed")
+			}
+			return
+		}
+
+		if format == openAIFormatBase64 {
+			resp.Data = append(resp.Data, openAIImageData{B64JSON: base64.StdEncoding.EncodeToString(img.png)})
+			continue
+		}
+
+		imageID, err := s.imageStorage.Store(sessionID, img.png, img.width, img.height)
+		if err != nil {
+			log.Printf("Failed to store image for session %s: %v", sessionID, err)
+			s.fireGenerateFailed(r.Context(), img.hookPayload, fmt.Errorf("failed to store image: %w", err))
+			if errors.Is(err, image.ErrImageTooLarge) {
+				writeOpenAIError(w, http.StatusInternalServerError, "server_error", "", "Image is too large to store; use response_format b64_json")
+			} else {
+				writeOpenAIError(w, http.StatusInternalServerError, "server_error", "", "Failed to store image")
+			}
+			return
+		}
+		imageURL := fmt.Sprintf("/images/%s.png", imageID)
+
+		hookPayload := img.hookPayload
+		hookPayload.Event = hooks.EventPostSave
+		hookPayload.ImageURL = imageURL
+		if err := s.hooks.Fire(r.Context(), hookPayload); err != nil {
+			log.Printf("Post-save hook failed for session %s: %v", sessionID, err)
+		}
+
+		resp.Data = append(resp.Data, openAIImageData{URL: absoluteURL(r, imageURL)})
+	}
+
+	log.Printf("Generated %d image(s) for session %s via the OpenAI API", n, sessionID)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// absoluteURL returns path as an absolute URL on the host r was sent to.
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
@@ -0,0 +1,166 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// postOpenAI sends a JSON body to the OpenAI images endpoint.
+func postOpenAI(s *Server, body, contentType string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/images/generations", strings.NewReader(body))
+	req.Host = "weave.test"
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+	req.Header.Set(CSRFHeaderName, s.csrfToken(testGallerySessionID))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func newOpenAITestServer(t *testing.T) *Server {
+	t.Helper()
+
+	s, err := NewServerWithDeps("", nil, nil, nil, persistence.NewImageStore(t.TempDir()), generatingComputeConn(t), nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	return s
+}
+
+func TestOpenAIImageGenerations_Validation(t *testing.T) {
+	s := newOpenAITestServer(t)
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		wantStatus  int
+		wantParam   string
+	}{
+		{name: "form body", body: "prompt=a+fox", contentType: "application/x-www-form-urlencoded", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "invalid JSON", body: `{"prompt":`, contentType: "application/json", wantStatus: http.StatusBadRequest},
+		{name: "missing prompt", body: `{"prompt":"  "}`, contentType: "application/json", wantStatus: http.StatusBadRequest, wantParam: "prompt"},
+		{name: "n zero", body: `{"prompt":"a fox","n":0}`, contentType: "application/json", wantStatus: http.StatusBadRequest, wantParam: "n"},
+		{name: "n too large", body: `{"prompt":"a fox","n":6}`, contentType: "application/json", wantStatus: http.StatusBadRequest, wantParam: "n"},
+		{name: "unsupported size", body: `{"prompt":"a fox","size":"1024x1024"}`, contentType: "application/json", wantStatus: http.StatusBadRequest, wantParam: "size"},
+		{name: "unknown response format", body: `{"prompt":"a fox","response_format":"png"}`, contentType: "application/json", wantStatus: http.StatusBadRequest, wantParam: "response_format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postOpenAI(s, tt.body, tt.contentType)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var resp openAIErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("error body is not JSON: %v", err)
+			}
+			if resp.Error.Type != "invalid_request_error" {
+				t.Errorf("error type = %q, want invalid_request_error", resp.Error.Type)
+			}
+			if tt.wantParam != "" && (resp.Error.Param == nil || *resp.Error.Param != tt.wantParam) {
+				t.Errorf("error param = %v, want %q", resp.Error.Param, tt.wantParam)
+			}
+		})
+	}
+}
+
+func TestOpenAIImageGenerations_Formats(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantN   int
+		wantURL bool
+	}{
+		{name: "default is one url", body: `{"prompt":"a fox","model":"dall-e-3"}`, wantN: 1, wantURL: true},
+		{name: "auto size", body: `{"prompt":"a fox","size":"auto","response_format":"url"}`, wantN: 1, wantURL: true},
+		{name: "base64", body: `{"prompt":"a fox","n":2,"size":"768x768","response_format":"b64_json"}`, wantN: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newOpenAITestServer(t)
+
+			w := postOpenAI(s, tt.body, "application/json; charset=utf-8")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			var resp openAIImageResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+			if resp.Created == 0 {
+				t.Error("created is not set")
+			}
+			if len(resp.Data) != tt.wantN {
+				t.Fatalf("len(data) = %d, want %d", len(resp.Data), tt.wantN)
+			}
+
+			for _, data := range resp.Data {
+				if tt.wantURL {
+					if !strings.HasPrefix(data.URL, "http://weave.test/images/") || data.B64JSON != "" {
+						t.Errorf("data = %+v, want only an absolute url", data)
+					}
+					path := strings.TrimPrefix(data.URL, "http://weave.test")
+					if img := serveAs(s, http.MethodGet, path, testGallerySessionID); img.Code != http.StatusOK {
+						t.Errorf("GET %s status = %d, want %d", path, img.Code, http.StatusOK)
+					}
+					continue
+				}
+				png, err := base64.StdEncoding.DecodeString(data.B64JSON)
+				if err != nil || data.URL != "" {
+					t.Fatalf("data = %+v, want only b64_json (decode error %v)", data, err)
+				}
+				if !strings.HasPrefix(string(png), "\x89PNG") {
+					t.Error("b64_json is not a PNG")
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAIImageGenerations_RateLimited(t *testing.T) {
+	s := newOpenAITestServer(t)
+
+	body := `{"prompt":"a fox","n":3,"response_format":"b64_json"}`
+	if w := postOpenAI(s, body, "application/json"); w.Code != http.StatusOK {
+		t.Fatalf("first status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	// Three more would exceed the per-minute limit
+	w := postOpenAI(s, body, "application/json")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header is not set")
+	}
+	var resp openAIErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error body is not JSON: %v", err)
+	}
+	if resp.Error.Type != "rate_limit_error" {
+		t.Errorf("error type = %q, want rate_limit_error", resp.Error.Type)
+	}
+}
+
+func TestOpenAIImageGenerations_ComputeNotRunning(t *testing.T) {
+	s, err := NewServerWithDeps("", nil, nil, nil, persistence.NewImageStore(t.TempDir()), nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+
+	w := postOpenAI(s, `{"prompt":"a fox"}`, "application/json")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusServiceUnavailable, w.Body.String())
+	}
+}
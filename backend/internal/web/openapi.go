@@ -0,0 +1,36 @@
+package web
+
+import (
+	_ "embed"
+	"log"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 document describing every route in registerRoutes.
+// Keep it in sync when adding or changing routes; TestOpenAPISpec_CoversRoutes
+// fails if a registered route is missing from the document.
+//
+//go:embed api/openapi.json
+var openAPISpec []byte
+
+// handleOpenAPI serves the embedded OpenAPI document.
+// GET /api/openapi.json
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(openAPISpec); err != nil {
+		log.Printf("Failed to write OpenAPI spec: %v", err)
+	}
+}
+
+// handleAPIDocs serves a Swagger UI page that renders the OpenAPI document.
+// GET /api/docs
+func (s *Server) handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := s.executeTemplate(w, "api-docs.html", nil); err != nil {
+		log.Printf("Failed to execute template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
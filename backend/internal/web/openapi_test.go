@@ -0,0 +1,122 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// openAPIDocument is the subset of the OpenAPI document checked by tests.
+type openAPIDocument struct {
+	OpenAPI string                                `json:"openapi"`
+	Paths   map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+// routePattern matches mux registrations like mux.HandleFunc("GET /path", ...).
+var routePattern = regexp.MustCompile(`mux\.Handle(?:Func)?\("([A-Z]+) ([^"]+)"`)
+
+// registeredRoutes extracts method/path pairs from registerRoutes in server.go.
+// ServeMux subtree patterns ("/static/") and "{name...}" wildcards are
+// converted to OpenAPI path templates.
+func registeredRoutes(t *testing.T) [][2]string {
+	t.Helper()
+
+	src, err := os.ReadFile("server.go")
+	if err != nil {
+		t.Fatalf("failed to read server.go: %v", err)
+	}
+
+	var routes [][2]string
+	for _, m := range routePattern.FindAllStringSubmatch(string(src), -1) {
+		method, path := strings.ToLower(m[1]), m[2]
+		path = strings.ReplaceAll(path, "...}", "}")
+		if path != "/" && strings.HasSuffix(path, "/") {
+			path += "{path}"
+		}
+		routes = append(routes, [2]string{method, path})
+	}
+	return routes
+}
+
+func loadOpenAPIDocument(t *testing.T) openAPIDocument {
+	t.Helper()
+
+	var doc openAPIDocument
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("embedded OpenAPI spec is not valid JSON: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPISpec_CoversRoutes(t *testing.T) {
+	doc := loadOpenAPIDocument(t)
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want 3.x", doc.OpenAPI)
+	}
+
+	routes := registeredRoutes(t)
+	if len(routes) == 0 {
+		t.Fatal("no routes found in server.go")
+	}
+
+	for _, route := range routes {
+		method, path := route[0], route[1]
+		ops, ok := doc.Paths[path]
+		if !ok {
+			t.Errorf("route %s %s missing from OpenAPI spec", strings.ToUpper(method), path)
+			continue
+		}
+		if _, ok := ops[method]; !ok {
+			t.Errorf("route %s %s missing operation in OpenAPI spec", strings.ToUpper(method), path)
+		}
+	}
+}
+
+func TestHandleOpenAPI(t *testing.T) {
+	s, err := NewServer("")
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	var doc openAPIDocument
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+	if _, ok := doc.Paths["/chat"]; !ok {
+		t.Error("response missing /chat path")
+	}
+}
+
+func TestHandleAPIDocs(t *testing.T) {
+	s, err := NewServer("")
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/docs", nil)
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), "/api/openapi.json") {
+		t.Error("docs page does not reference /api/openapi.json")
+	}
+}
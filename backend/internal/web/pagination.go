@@ -0,0 +1,150 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultPageLimit is the page size used when a list request has no limit
+	defaultPageLimit = 50
+
+	// maxPageLimit bounds the page size a client can request
+	maxPageLimit = 200
+
+	// maxPromptFilterLength limits the length of the prompt filter
+	maxPromptFilterLength = 200
+)
+
+// listQuery holds the pagination and filter parameters shared by list
+// endpoints:
+//
+//	limit      page size (default 50, max 200)
+//	offset     number of matching items to skip
+//	since      only items at or after this time (RFC3339 or YYYY-MM-DD)
+//	until      only items before this time (RFC3339 or YYYY-MM-DD)
+//	has_image  only items with (true) or without (false) a stored image
+//	prompt     only items whose prompt contains this text, ignoring case
+//
+// Endpoints ignore filters that don't apply to their items.
+type listQuery struct {
+	Limit    int
+	Offset   int
+	Since    time.Time
+	Until    time.Time
+	HasImage *bool
+	Prompt   string
+}
+
+// pageInfo describes the page returned by a list endpoint.
+// NextOffset is omitted on the last page.
+type pageInfo struct {
+	Total      int `json:"total"`
+	Limit      int `json:"limit"`
+	Offset     int `json:"offset"`
+	NextOffset int `json:"next_offset,omitempty"`
+}
+
+// parseListQuery reads pagination and filter parameters from the request
+// query string.
+func parseListQuery(r *http.Request) (listQuery, error) {
+	values := r.URL.Query()
+	q := listQuery{Limit: defaultPageLimit}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return listQuery{}, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		q.Limit = limit
+	}
+
+	if v := values.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return listQuery{}, fmt.Errorf("offset must be a non-negative integer")
+		}
+		q.Offset = offset
+	}
+
+	var err error
+	if q.Since, err = parseListTime(values, "since"); err != nil {
+		return listQuery{}, err
+	}
+	if q.Until, err = parseListTime(values, "until"); err != nil {
+		return listQuery{}, err
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Since.Before(q.Until) {
+		return listQuery{}, fmt.Errorf("since must be before until")
+	}
+
+	if v := values.Get("has_image"); v != "" {
+		hasImage, err := strconv.ParseBool(v)
+		if err != nil {
+			return listQuery{}, fmt.Errorf("has_image must be true or false")
+		}
+		q.HasImage = &hasImage
+	}
+
+	q.Prompt = strings.TrimSpace(values.Get("prompt"))
+	if len(q.Prompt) > maxPromptFilterLength {
+		return listQuery{}, fmt.Errorf("prompt filter must be at most %d characters", maxPromptFilterLength)
+	}
+
+	return q, nil
+}
+
+// parseListTime parses a since/until parameter. Dates without a time
+// mean midnight UTC.
+func parseListTime(values url.Values, name string) (time.Time, error) {
+	v := values.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC3339 time or YYYY-MM-DD date", name)
+}
+
+// matchesTime reports whether t falls within the since/until range.
+// Items without a timestamp only match when no range is set.
+func (q listQuery) matchesTime(t time.Time) bool {
+	if !q.Since.IsZero() && t.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && (t.IsZero() || !t.Before(q.Until)) {
+		return false
+	}
+	return true
+}
+
+// matchesPrompt reports whether prompt contains the prompt filter.
+func (q listQuery) matchesPrompt(prompt string) bool {
+	return q.Prompt == "" || strings.Contains(strings.ToLower(prompt), strings.ToLower(q.Prompt))
+}
+
+// matchesImage reports whether an item with or without an image passes
+// the has_image filter.
+func (q listQuery) matchesImage(hasImage bool) bool {
+	return q.HasImage == nil || *q.HasImage == hasImage
+}
+
+// page returns the bounds of the requested page within total matching
+// items, for slicing as items[start:end].
+func (q listQuery) page(total int) (start, end int, info pageInfo) {
+	start = min(q.Offset, total)
+	end = min(start+q.Limit, total)
+	info = pageInfo{Total: total, Limit: q.Limit, Offset: q.Offset}
+	if end < total {
+		info.NextOffset = end
+	}
+	return start, end, info
+}
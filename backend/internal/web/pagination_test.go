@@ -0,0 +1,114 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseListQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    func(listQuery) bool
+		wantErr bool
+	}{
+		{name: "defaults", query: "", want: func(q listQuery) bool {
+			return q.Limit == defaultPageLimit && q.Offset == 0 && q.Since.IsZero() && q.HasImage == nil && q.Prompt == ""
+		}},
+		{name: "limit and offset", query: "limit=10&offset=20", want: func(q listQuery) bool {
+			return q.Limit == 10 && q.Offset == 20
+		}},
+		{name: "date range", query: "since=2025-01-31&until=2025-02-01T12:00:00Z", want: func(q listQuery) bool {
+			return q.Since.Equal(time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)) && q.Until.Equal(time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC))
+		}},
+		{name: "has image", query: "has_image=false", want: func(q listQuery) bool {
+			return q.HasImage != nil && !*q.HasImage
+		}},
+		{name: "prompt", query: "prompt=+Cat+", want: func(q listQuery) bool {
+			return q.Prompt == "Cat"
+		}},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "limit too large", query: "limit=201", wantErr: true},
+		{name: "negative offset", query: "offset=-1", wantErr: true},
+		{name: "bad date", query: "since=yesterday", wantErr: true},
+		{name: "empty range", query: "since=2025-02-01&until=2025-02-01", wantErr: true},
+		{name: "bad has_image", query: "has_image=maybe", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/history?"+tt.query, nil)
+			q, err := parseListQuery(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseListQuery() error = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseListQuery() error = %v", err)
+			}
+			if !tt.want(q) {
+				t.Errorf("parseListQuery() = %+v", q)
+			}
+		})
+	}
+}
+
+func TestListQuery_Page(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		offset    int
+		total     int
+		wantStart int
+		wantEnd   int
+		wantNext  int
+	}{
+		{name: "first page", limit: 2, offset: 0, total: 5, wantStart: 0, wantEnd: 2, wantNext: 2},
+		{name: "last page", limit: 2, offset: 4, total: 5, wantStart: 4, wantEnd: 5, wantNext: 0},
+		{name: "exact fit", limit: 5, offset: 0, total: 5, wantStart: 0, wantEnd: 5, wantNext: 0},
+		{name: "past the end", limit: 2, offset: 10, total: 5, wantStart: 5, wantEnd: 5, wantNext: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := listQuery{Limit: tt.limit, Offset: tt.offset}
+			start, end, info := q.page(tt.total)
+			if start != tt.wantStart || end != tt.wantEnd || info.NextOffset != tt.wantNext || info.Total != tt.total {
+				t.Errorf("page(%d) = %d, %d, %+v, want %d, %d, next %d", tt.total, start, end, info, tt.wantStart, tt.wantEnd, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestListQuery_MatchesTime(t *testing.T) {
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	q := listQuery{Since: day, Until: day.Add(24 * time.Hour)}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		{name: "start of range", t: day, want: true},
+		{name: "within range", t: day.Add(time.Hour), want: true},
+		{name: "end of range", t: day.Add(24 * time.Hour), want: false},
+		{name: "before range", t: day.Add(-time.Second), want: false},
+		{name: "no timestamp", t: time.Time{}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := q.matchesTime(tt.t); got != tt.want {
+				t.Errorf("matchesTime(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+
+	if !(listQuery{}).matchesTime(time.Time{}) {
+		t.Error("matchesTime() without a range = false for message without timestamp, want true")
+	}
+}
@@ -0,0 +1,172 @@
+package web
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/conversation"
+)
+
+// personaResponse describes an agent persona in API responses. Settings
+// the persona leaves to the server are omitted.
+type personaResponse struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Steps       *int     `json:"steps,omitempty"`
+	CFG         *float64 `json:"cfg,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+}
+
+// personaListResponse is the response for GET /personas.
+type personaListResponse struct {
+	Status   string            `json:"status"`
+	Default  string            `json:"default"`
+	Current  string            `json:"current"`
+	Personas []personaResponse `json:"personas"`
+}
+
+// personaSettingResponse is the response for POST /settings/persona: the
+// persona now in use and the generation settings it started the session on.
+type personaSettingResponse struct {
+	Status  string  `json:"status"`
+	Persona string  `json:"persona"`
+	Steps   int     `json:"steps"`
+	CFG     float64 `json:"cfg"`
+	Seed    int64   `json:"seed"`
+}
+
+// handleListPersonas lists the agent personas, the default, and the one the
+// session's chats use.
+// GET /personas
+func (s *Server) handleListPersonas(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	personas := s.loadedPersonas()
+	resp := personaListResponse{
+		Status:   "ok",
+		Personas: make([]personaResponse, 0, len(personas)),
+	}
+	if len(personas) > 0 {
+		resp.Default = personas[0].ID
+		resp.Current = sessionPersona(personas, s.sessionManager.GetSession(sessionID)).ID
+	}
+	for _, p := range personas {
+		resp.Personas = append(resp.Personas, personaResponse{
+			ID:          p.ID,
+			Name:        p.Name,
+			Description: p.Description,
+			Steps:       p.Steps,
+			CFG:         p.CFG,
+			Seed:        p.Seed,
+		})
+	}
+	writeChatJSON(w, http.StatusOK, resp)
+}
+
+// handleSetPersona switches the agent persona for the session and applies
+// the generation settings it defines; the server defaults fill in the rest.
+// An empty persona reverts to the default.
+// POST /settings/persona (form: persona)
+func (s *Server) handleSetPersona(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	personas := s.loadedPersonas()
+	if len(personas) == 0 {
+		writeJSONError(w, http.StatusServiceUnavailable, "no agent personas are configured")
+		return
+	}
+	id := r.FormValue("persona")
+	if id == "" {
+		id = personas[0].ID
+	}
+	persona, ok := findPersona(personas, id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "persona not found")
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	// Storing the default as "" keeps the session on the default persona if
+	// the server is restarted with a different one
+	if id == personas[0].ID {
+		id = ""
+	}
+	session.SetPersona(id)
+
+	steps, cfg, seed := s.defaultSteps, s.defaultCFG, s.defaultSeed
+	if persona.Steps != nil {
+		steps = *persona.Steps
+	}
+	if persona.CFG != nil {
+		cfg = *persona.CFG
+	}
+	if persona.Seed != nil {
+		seed = *persona.Seed
+	}
+	session.SetGenerationSettings(steps, cfg, seed)
+	_ = s.sendChatEvent(sessionID, "", EventSettingsUpdate, map[string]interface{}{
+		"steps": steps,
+		"cfg":   cfg,
+		"seed":  seed,
+	})
+
+	log.Printf("Session %s switched agent persona to %s", sessionID, persona.ID)
+	writeChatJSON(w, http.StatusOK, personaSettingResponse{
+		Status:  "ok",
+		Persona: persona.ID,
+		Steps:   steps,
+		CFG:     cfg,
+		Seed:    seed,
+	})
+}
+
+// findPersona returns the persona with the given ID.
+func findPersona(personas []config.Persona, id string) (config.Persona, bool) {
+	for _, p := range personas {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return config.Persona{}, false
+}
+
+// sessionPersona returns the persona chosen for a session, or the default
+// if none was chosen or it is no longer configured. Requires at least one
+// persona.
+func sessionPersona(personas []config.Persona, session *conversation.Session) config.Persona {
+	if persona, ok := findPersona(personas, session.Persona()); ok {
+		return persona
+	}
+	return personas[0]
+}
+
+// sessionAgentPrompt returns the agent prompt for a session's chats: that
+// of its persona, or the default prompt.
+func (s *Server) sessionAgentPrompt(session *conversation.Session) string {
+	s.promptMu.RLock()
+	personas, agentPrompt := s.personas, s.agentPrompt
+	s.promptMu.RUnlock()
+
+	if len(personas) == 0 {
+		return agentPrompt
+	}
+	return sessionPersona(personas, session).Prompt
+}
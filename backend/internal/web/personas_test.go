@@ -0,0 +1,161 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+// newPersonaTestServer returns a test server with a photography coach as
+// the default persona and a pixel-art assistant that sets steps and cfg.
+func newPersonaTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	steps, cfg := 12, 7.0
+	s := newGalleryTestServer(t, nil)
+	s.personas = []config.Persona{
+		{ID: "coach", Name: "Photography coach", Prompt: "You coach photographers."},
+		{ID: "pixel-art", Name: "Pixel-art assistant", Description: "Retro sprites", Prompt: "You draw pixel art.", Steps: &steps, CFG: &cfg},
+	}
+	s.agentPrompt = s.personas[0].Prompt
+	return s
+}
+
+// postPersona posts a persona choice to /settings/persona as the test session.
+func postPersona(s *Server, persona string) *httptest.ResponseRecorder {
+	form := url.Values{"persona": {persona}}
+	req := httptest.NewRequest(http.MethodPost, "/settings/persona", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+	req.Header.Set(CSRFHeaderName, s.csrfToken(testGallerySessionID))
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleListPersonas(t *testing.T) {
+	s := newPersonaTestServer(t)
+
+	w := serveAs(s, http.MethodGet, "/personas", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp personaListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Default != "coach" || resp.Current != "coach" {
+		t.Errorf("default, current = %q, %q, want coach for both", resp.Default, resp.Current)
+	}
+	if len(resp.Personas) != 2 || resp.Personas[1].Name != "Pixel-art assistant" || resp.Personas[1].Steps == nil || *resp.Personas[1].Steps != 12 {
+		t.Errorf("personas = %+v, want coach and pixel-art with steps 12", resp.Personas)
+	}
+	if strings.Contains(w.Body.String(), "You draw pixel art.") {
+		t.Error("response includes the persona prompt")
+	}
+
+	// The session's choice is reported as current
+	if w := postPersona(s, "pixel-art"); w.Code != http.StatusOK {
+		t.Fatalf("set persona status = %d: %s", w.Code, w.Body.String())
+	}
+	w = serveAs(s, http.MethodGet, "/personas", testGallerySessionID)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Current != "pixel-art" {
+		t.Errorf("current = %q, want %q", resp.Current, "pixel-art")
+	}
+}
+
+func TestHandleSetPersona(t *testing.T) {
+	tests := []struct {
+		name       string
+		persona    string
+		wantStatus int
+		wantID     string
+		wantPrompt string
+		wantSteps  int
+		wantCFG    float64
+	}{
+		{name: "persona settings", persona: "pixel-art", wantStatus: http.StatusOK, wantID: "pixel-art", wantPrompt: "You draw pixel art.", wantSteps: 12, wantCFG: 7.0},
+		{name: "server defaults", persona: "coach", wantStatus: http.StatusOK, wantID: "coach", wantPrompt: "You coach photographers.", wantSteps: 20, wantCFG: 3.5},
+		{name: "empty reverts to default", persona: "", wantStatus: http.StatusOK, wantID: "coach", wantPrompt: "You coach photographers.", wantSteps: 20, wantCFG: 3.5},
+		{name: "unknown persona", persona: "chef", wantStatus: http.StatusNotFound, wantPrompt: "You coach photographers."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newPersonaTestServer(t)
+
+			w := postPersona(s, tt.persona)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			session := s.sessionManager.GetSession(testGallerySessionID)
+			if got := s.sessionAgentPrompt(session); got != tt.wantPrompt {
+				t.Errorf("agent prompt = %q, want %q", got, tt.wantPrompt)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp personaSettingResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Persona != tt.wantID || resp.Steps != tt.wantSteps || resp.CFG != tt.wantCFG {
+				t.Errorf("response = %+v, want persona %q steps %d cfg %v", resp, tt.wantID, tt.wantSteps, tt.wantCFG)
+			}
+			steps, cfg, _, ok := session.GetGenerationSettings()
+			if !ok || steps != tt.wantSteps || cfg != tt.wantCFG {
+				t.Errorf("session settings = %d, %v (set %v), want %d, %v", steps, cfg, ok, tt.wantSteps, tt.wantCFG)
+			}
+		})
+	}
+}
+
+func TestHandleSetPersona_NoPersonas(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	w := postPersona(s, "coach")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestNewServerWithDeps_PersonaDirectory(t *testing.T) {
+	// Within the current test directory: prompt paths must be relative
+	dir := "testdata_web_personas"
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"coach.md":     "You coach photographers.",
+		"pixel-art.md": "---\nname: Pixel-art assistant\n---\nYou draw pixel art.",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	server, err := NewServerWithDeps("", nil, nil, nil, nil, nil, &config.Config{
+		Steps: 4, CFG: 1.0, Width: 1024, Height: 1024, AgentPromptPath: dir,
+	})
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	if len(server.personas) != 2 || server.personas[1].Name != "Pixel-art assistant" {
+		t.Errorf("personas = %+v, want coach and pixel-art", server.personas)
+	}
+	if server.agentPrompt != "You coach photographers." {
+		t.Errorf("agentPrompt = %q, want the first persona's", server.agentPrompt)
+	}
+}
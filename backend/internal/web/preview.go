@@ -0,0 +1,53 @@
+package web
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// previewJPEGQuality is the JPEG quality of generation previews. They are
+// small and replaced every few steps, so size matters more than fidelity.
+const previewJPEGQuality = 70
+
+// previewForwarder returns an onPreview callback for
+// client.Conn.SendWithPreviews that sends each frame to the session's chat
+// as an EventGenerationPreview. Frames that do not decode are logged and
+// skipped; a bad preview never fails the generation.
+func (s *Server) previewForwarder(sessionID, chatID string, messageID int) func(frame []byte) {
+	return func(frame []byte) {
+		data, err := previewEventData(frame)
+		if err != nil {
+			log.Printf("Dropping preview frame for session %s: %v", sessionID, err)
+			return
+		}
+		data.MessageID = messageID
+		_ = s.sendChatEvent(sessionID, chatID, EventGenerationPreview, data)
+	}
+}
+
+// previewEventData decodes a protocol.MsgPreview message and encodes its
+// pixels as a JPEG data URI.
+func previewEventData(frame []byte) (GenerationPreviewData, error) {
+	msg, err := protocol.DecodeResponse(frame)
+	if err != nil {
+		return GenerationPreviewData{}, err
+	}
+	preview, ok := msg.(*protocol.PreviewFrame)
+	if !ok {
+		return GenerationPreviewData{}, fmt.Errorf("unexpected message %T", msg)
+	}
+
+	jpegData, err := image.EncodeJPEG(int(preview.Width), int(preview.Height), preview.ImageData, previewJPEGQuality)
+	if err != nil {
+		return GenerationPreviewData{}, fmt.Errorf("failed to encode preview: %w", err)
+	}
+	return GenerationPreviewData{
+		Image: "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(jpegData),
+		Step:  int(preview.Step),
+		Steps: int(preview.Steps),
+	}, nil
+}
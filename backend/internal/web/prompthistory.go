@@ -0,0 +1,239 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// promptDiffContext is the number of unchanged clauses shown around
+	// each change in a prompt diff
+	promptDiffContext = 3
+
+	// maxPromptDiffCells bounds the table used to diff two prompts. Larger
+	// prompts are diffed as a replacement of every clause.
+	maxPromptDiffCells = 1 << 20
+)
+
+// promptRevisionResponse is one revision in the GET /prompt/history response.
+type promptRevisionResponse struct {
+	Prompt    string    `json:"prompt"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+	Seq       int64     `json:"seq"`
+	Diff      string    `json:"diff"`
+}
+
+// promptHistoryResponse is the response for GET /prompt/history.
+type promptHistoryResponse struct {
+	Status        string                   `json:"status"`
+	ChatID        string                   `json:"chat_id"`
+	CurrentPrompt string                   `json:"current_prompt"`
+	Revisions     []promptRevisionResponse `json:"revisions"`
+	Page          pageInfo                 `json:"page"`
+}
+
+// handlePromptHistory lists the revisions of a chat's prompt, oldest first,
+// each with a unified diff from the revision before it. The first revision
+// is diffed against an empty prompt. Filters don't change what a revision
+// is diffed against.
+// GET /prompt/history?chat_id=&limit=&offset=&since=&until=&prompt=
+func (s *Server) handlePromptHistory(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	chatID, manager := resolveChat(session, r.URL.Query().Get("chat_id"))
+	if manager == nil {
+		writeChatNotFound(w)
+		return
+	}
+
+	var revisions []promptRevisionResponse
+	previous := ""
+	for _, revision := range manager.PromptHistory() {
+		before := previous
+		previous = revision.Prompt
+		if !q.matchesTime(revision.CreatedAt) || !q.matchesPrompt(revision.Prompt) {
+			continue
+		}
+		revisions = append(revisions, promptRevisionResponse{
+			Prompt:    revision.Prompt,
+			Source:    revision.Source,
+			CreatedAt: revision.CreatedAt,
+			Seq:       revision.Seq,
+			Diff:      diffPrompts(before, revision.Prompt),
+		})
+	}
+
+	start, end, page := q.page(len(revisions))
+	writeChatJSON(w, http.StatusOK, promptHistoryResponse{
+		Status:        "ok",
+		ChatID:        chatID,
+		CurrentPrompt: manager.GetCurrentPrompt(),
+		Revisions:     append([]promptRevisionResponse{}, revisions[start:end]...),
+		Page:          page,
+	})
+}
+
+// diffPrompts returns a unified diff from one prompt to another. Prompts
+// are compared one comma-separated clause per line: most prompts are a
+// single line, which a plain line diff would only show replaced whole.
+func diffPrompts(from, to string) string {
+	return unifiedDiff("a/prompt", "b/prompt", promptClauses(from), promptClauses(to))
+}
+
+// promptClauses splits a prompt at commas and newlines into trimmed,
+// non-empty clauses.
+func promptClauses(prompt string) []string {
+	var clauses []string
+	for _, clause := range strings.FieldsFunc(prompt, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if clause = strings.TrimSpace(clause); clause != "" {
+			clauses = append(clauses, clause)
+		}
+	}
+	return clauses
+}
+
+// diffLine is a line of a diff: ' ' if unchanged, '-' if removed or '+'
+// if added.
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// diffLines returns the edit script turning a into b, based on their
+// longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	if len(a)*len(b) > maxPromptDiffCells {
+		lines := make([]diffLine, 0, len(a)+len(b))
+		for _, text := range a {
+			lines = append(lines, diffLine{'-', text})
+		}
+		for _, text := range b {
+			lines = append(lines, diffLine{'+', text})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+	return lines
+}
+
+// unifiedDiff formats the diff from a to b in unified format with
+// promptDiffContext lines of context. It returns "" if they are equal.
+func unifiedDiff(fromLabel, toLabel string, a, b []string) string {
+	lines := diffLines(a, b)
+
+	// oldPos[k] and newPos[k] count the lines of a and b before lines[k]
+	oldPos := make([]int, len(lines)+1)
+	newPos := make([]int, len(lines)+1)
+	for k, line := range lines {
+		oldPos[k+1], newPos[k+1] = oldPos[k], newPos[k]
+		if line.kind != '+' {
+			oldPos[k+1]++
+		}
+		if line.kind != '-' {
+			newPos[k+1]++
+		}
+	}
+
+	var out strings.Builder
+	for next := 0; next < len(lines); {
+		first := next
+		for first < len(lines) && lines[first].kind == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+
+		// A hunk ends once more unchanged lines follow a change than the
+		// context of two hunks would show
+		end := first
+		for k := first; k < len(lines); k++ {
+			if lines[k].kind != ' ' {
+				end = k + 1
+			} else if k-end >= 2*promptDiffContext {
+				break
+			}
+		}
+		start := max(first-promptDiffContext, next)
+		stop := min(end+promptDiffContext, len(lines))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromLabel, toLabel)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(oldPos[start], oldPos[stop]-oldPos[start]),
+			hunkRange(newPos[start], newPos[stop]-newPos[start]))
+		for _, line := range lines[start:stop] {
+			out.WriteByte(line.kind)
+			out.WriteString(line.text)
+			out.WriteByte('\n')
+		}
+		next = stop
+	}
+	return out.String()
+}
+
+// hunkRange formats the range of a hunk header for count lines after the
+// first skipped lines. An empty range names the line before it, as GNU diff
+// does.
+func hunkRange(skipped, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", skipped)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", skipped+1)
+	}
+	return fmt.Sprintf("%d,%d", skipped+1, count)
+}
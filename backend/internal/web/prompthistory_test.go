@@ -0,0 +1,78 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDiffPrompts(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{"equal", "a cat, watercolor", "a cat,watercolor", ""},
+		{"from empty", "", "a cat, watercolor", "--- a/prompt\n+++ b/prompt\n@@ -0,0 +1,2 @@\n+a cat\n+watercolor\n"},
+		{"to empty", "a cat", "", "--- a/prompt\n+++ b/prompt\n@@ -1 +0,0 @@\n-a cat\n"},
+		{
+			"changed clause",
+			"a cat, watercolor, soft light",
+			"a fluffy cat, watercolor, soft light",
+			"--- a/prompt\n+++ b/prompt\n@@ -1,3 +1,3 @@\n-a cat\n+a fluffy cat\n watercolor\n soft light\n",
+		},
+		{
+			"separate hunks",
+			"a, b, c, d, e, f, g, h, i, j",
+			"A, b, c, d, e, f, g, h, i, J",
+			"--- a/prompt\n+++ b/prompt\n@@ -1,4 +1,4 @@\n-a\n+A\n b\n c\n d\n@@ -7,4 +7,4 @@\n g\n h\n i\n-j\n+J\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffPrompts(tt.from, tt.to); got != tt.want {
+				t.Errorf("diffPrompts(%q, %q) =\n%s\nwant\n%s", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlePromptHistory(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	manager := s.sessionManager.GetSession(testResumeSessionID).Manager()
+	manager.AddAssistantMessage("Here you go", "a cat, watercolor", nil)
+	manager.UpdatePrompt("a fluffy cat, watercolor")
+
+	w := serveAs(s, http.MethodGet, "/prompt/history", testResumeSessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /prompt/history status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp promptHistoryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.CurrentPrompt != "a fluffy cat, watercolor" || len(resp.Revisions) != 2 {
+		t.Fatalf("GET /prompt/history = %+v, want 2 revisions", resp)
+	}
+	if got := resp.Revisions[0]; got.Source != "agent" || !strings.Contains(got.Diff, "+a cat\n") {
+		t.Errorf("first revision = %+v, want the agent's prompt diffed against nothing", got)
+	}
+	if got := resp.Revisions[1]; got.Source != "user" || !strings.Contains(got.Diff, "-a cat\n+a fluffy cat\n watercolor\n") {
+		t.Errorf("second revision = %+v, want the user's edit diffed against the agent's prompt", got)
+	}
+
+	// Filtering keeps diffs against the revision before
+	w = serveAs(s, http.MethodGet, "/prompt/history?prompt=fluffy", testResumeSessionID)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Revisions) != 1 || !strings.Contains(resp.Revisions[0].Diff, "-a cat\n") {
+		t.Errorf("GET /prompt/history?prompt=fluffy = %+v, want the user's edit with its diff", resp.Revisions)
+	}
+
+	if w := serveAs(s, http.MethodGet, "/prompt/history?chat_id=nope", testResumeSessionID); w.Code != http.StatusNotFound {
+		t.Errorf("GET /prompt/history for an unknown chat status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
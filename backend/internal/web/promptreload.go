@@ -0,0 +1,147 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+// AgentPromptPollInterval is how often the agent prompt files are checked
+// for changes.
+const AgentPromptPollInterval = 2 * time.Second
+
+// loadAgentPrompt loads the personas at s.agentPromptPath and records the
+// version of the files loaded.
+func (s *Server) loadAgentPrompt() error {
+	// Stamped before loading: a write in between is picked up by the next
+	// check rather than missed
+	stamp, err := agentPromptStamp(s.agentPromptPath)
+	if err != nil {
+		return err
+	}
+	personas, err := config.LoadPersonas(s.agentPromptPath)
+	if err != nil {
+		return err
+	}
+
+	s.promptMu.Lock()
+	defer s.promptMu.Unlock()
+	s.personas = personas
+	s.agentPrompt = personas[0].Prompt
+	s.agentPromptStamp = stamp
+	return nil
+}
+
+// watchAgentPrompt starts a background goroutine that reloads the agent
+// prompt of the active server when its files change, so prompts can be
+// iterated on without a restart. The goroutine stops when ctx is cancelled.
+//
+// WHY POLLING: checking modification times every AgentPromptPollInterval
+// is cheap for a handful of files, works on every platform and filesystem,
+// and needs no dependency.
+func (s *Server) watchAgentPrompt(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(AgentPromptPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if active := s.active.Load(); active != nil {
+					active.reloadAgentPrompt()
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// reloadAgentPrompt reloads the agent prompt if its files changed since
+// they were loaded, and tells every session. Chats pick the new prompt up
+// on their next turn. If the new files can't be loaded, the prompt in use
+// is kept. Returns whether the prompt was reloaded.
+func (s *Server) reloadAgentPrompt() bool {
+	if s.agentPromptPath == "" {
+		return false
+	}
+
+	stamp, err := agentPromptStamp(s.agentPromptPath)
+	s.promptMu.RLock()
+	unchanged := stamp == s.agentPromptStamp
+	s.promptMu.RUnlock()
+	if err != nil || unchanged {
+		// A missing file is usually an editor mid-save; the next check
+		// sees the new one
+		return false
+	}
+
+	if err := s.loadAgentPrompt(); err != nil {
+		log.Printf("Failed to reload agent prompt, keeping the current one: %v", err)
+		// Don't retry until the files change again
+		s.promptMu.Lock()
+		s.agentPromptStamp = stamp
+		s.promptMu.Unlock()
+		return false
+	}
+
+	personas := s.loadedPersonas()
+	ids := make([]string, 0, len(personas))
+	for _, p := range personas {
+		ids = append(ids, p.ID)
+	}
+	log.Printf("Reloaded agent prompt from %s (%d personas)", s.agentPromptPath, len(personas))
+	s.broker.SendEventToAll(EventAgentPromptReloaded, AgentPromptReloadedData{Personas: ids})
+	return true
+}
+
+// agentPromptStamp identifies the version of the prompt file, or of the
+// prompt files in a directory, by their names, sizes and modification
+// times.
+func agentPromptStamp(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to check agent prompt: %w", err)
+	}
+	if !info.IsDir() {
+		return fileStamp(info), nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to check agent prompts: %w", err)
+	}
+	var stamp strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".md" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return "", fmt.Errorf("failed to check agent prompts: %w", err)
+		}
+		stamp.WriteString(entry.Name())
+		stamp.WriteByte(' ')
+		stamp.WriteString(fileStamp(info))
+		stamp.WriteByte('\n')
+	}
+	return stamp.String(), nil
+}
+
+// fileStamp identifies a version of a file by its size and modification time.
+func fileStamp(info os.FileInfo) string {
+	return fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano())
+}
+
+// loadedPersonas returns the personas currently loaded. The slice is
+// replaced, never modified, on reload.
+func (s *Server) loadedPersonas() []config.Persona {
+	s.promptMu.RLock()
+	defer s.promptMu.RUnlock()
+	return s.personas
+}
@@ -0,0 +1,113 @@
+package web
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+// writePromptFile writes a prompt file and moves its modification time
+// forward, so a rewrite within the filesystem's timestamp resolution still
+// looks changed.
+func writePromptFile(t *testing.T, path, content string, age time.Duration) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	mtime := time.Now().Add(age)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("failed to set mtime of %s: %v", path, err)
+	}
+}
+
+// newPromptReloadTestServer returns a server whose personas are loaded
+// from a directory within the current test directory (prompt paths must
+// be relative), starting with coach.md.
+func newPromptReloadTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+
+	// The agent prompt path must be relative
+	t.Chdir(t.TempDir())
+	dir := "agents"
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	writePromptFile(t, filepath.Join(dir, "coach.md"), "You coach photographers.", -time.Hour)
+
+	s, err := NewServerWithDeps("", nil, nil, nil, nil, nil, &config.Config{
+		Steps: 4, CFG: 1.0, Width: 1024, Height: 1024, AgentPromptPath: dir,
+	})
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	return s, dir
+}
+
+func TestReloadAgentPrompt(t *testing.T) {
+	s, dir := newPromptReloadTestServer(t)
+	events := recordEvents(s, "reload-session")
+
+	if s.reloadAgentPrompt() {
+		t.Fatal("reloadAgentPrompt() = true with unchanged files, want false")
+	}
+
+	// Edit the prompt and add a persona
+	writePromptFile(t, filepath.Join(dir, "coach.md"), "You coach landscape photographers.", 0)
+	writePromptFile(t, filepath.Join(dir, "pixel-art.md"), "You draw pixel art.", 0)
+	if !s.reloadAgentPrompt() {
+		t.Fatal("reloadAgentPrompt() = false after edit, want true")
+	}
+	if s.agentPrompt != "You coach landscape photographers." {
+		t.Errorf("agentPrompt = %q, want the edited prompt", s.agentPrompt)
+	}
+	if got := len(s.loadedPersonas()); got != 2 {
+		t.Errorf("personas = %d, want 2", got)
+	}
+	body := events.Body.String()
+	if !strings.Contains(body, "event: "+EventAgentPromptReloaded) || !strings.Contains(body, `"personas":["coach","pixel-art"]`) {
+		t.Errorf("events = %q, want %s listing both personas", body, EventAgentPromptReloaded)
+	}
+
+	// The session's persona prompt is used on its next turn
+	session := s.sessionManager.GetSession("reload-session")
+	session.SetPersona("pixel-art")
+	if got := s.sessionAgentPrompt(session); got != "You draw pixel art." {
+		t.Errorf("session agent prompt = %q, want the new persona's", got)
+	}
+}
+
+func TestReloadAgentPrompt_InvalidKeepsCurrent(t *testing.T) {
+	s, dir := newPromptReloadTestServer(t)
+	events := recordEvents(s, "reload-session")
+
+	writePromptFile(t, filepath.Join(dir, "coach.md"), "---\nsteps: many\n---\nYou coach.", 0)
+	if s.reloadAgentPrompt() {
+		t.Fatal("reloadAgentPrompt() = true for invalid front matter, want false")
+	}
+	if s.agentPrompt != "You coach photographers." {
+		t.Errorf("agentPrompt = %q, want the previous prompt", s.agentPrompt)
+	}
+	if strings.Contains(events.Body.String(), EventAgentPromptReloaded) {
+		t.Error("reload event sent for a failed reload")
+	}
+
+	// Fixing the file reloads it
+	writePromptFile(t, filepath.Join(dir, "coach.md"), "---\nsteps: 8\n---\nYou coach.", time.Second)
+	if !s.reloadAgentPrompt() {
+		t.Fatal("reloadAgentPrompt() = false after fix, want true")
+	}
+	if s.agentPrompt != "You coach." {
+		t.Errorf("agentPrompt = %q, want the fixed prompt", s.agentPrompt)
+	}
+}
+
+func TestReloadAgentPrompt_NoPath(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	if s.reloadAgentPrompt() {
+		t.Error("reloadAgentPrompt() = true without an agent prompt, want false")
+	}
+}
@@ -0,0 +1,179 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// savedPromptResponse describes a saved prompt in API responses.
+type savedPromptResponse struct {
+	Name    string    `json:"name"`
+	Prompt  string    `json:"prompt"`
+	SavedAt time.Time `json:"saved_at"`
+	Seq     int64     `json:"seq"`
+}
+
+// savedPromptListResponse is the response for GET /prompts.
+type savedPromptListResponse struct {
+	Status  string                `json:"status"`
+	Prompts []savedPromptResponse `json:"prompts"`
+	Page    pageInfo              `json:"page"`
+}
+
+// savedPromptMutationResponse is the response for saving and loading a
+// prompt.
+type savedPromptMutationResponse struct {
+	Status string              `json:"status"`
+	ChatID string              `json:"chat_id"`
+	Prompt savedPromptResponse `json:"prompt"`
+}
+
+// buildSavedPromptResponse describes a saved prompt.
+func buildSavedPromptResponse(saved persistence.SavedPrompt) savedPromptResponse {
+	return savedPromptResponse{
+		Name:    saved.Name,
+		Prompt:  saved.Prompt,
+		SavedAt: saved.SavedAt,
+		Seq:     saved.Seq,
+	}
+}
+
+// handleListSavedPrompts lists the session's prompt library, most recently
+// saved first. The time range filters on when the prompt was saved.
+// GET /prompts?limit=&offset=&since=&until=&prompt=
+func (s *Server) handleListSavedPrompts(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	prompts, err := s.promptStore.List(sessionID)
+	if err != nil {
+		log.Printf("Failed to list saved prompts for session %s: %v", sessionID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list saved prompts")
+		return
+	}
+
+	items := make([]savedPromptResponse, 0, len(prompts))
+	for _, saved := range prompts {
+		if q.matchesTime(saved.SavedAt) && q.matchesPrompt(saved.Prompt) {
+			items = append(items, buildSavedPromptResponse(saved))
+		}
+	}
+
+	start, end, page := q.page(len(items))
+	writeChatJSON(w, http.StatusOK, savedPromptListResponse{Status: "ok", Prompts: items[start:end], Page: page})
+}
+
+// handleSavePrompt saves a chat's current prompt to the session's prompt
+// library, replacing a prompt saved under the same name.
+// POST /prompts (form: name; chat_id, optional, defaults to the active chat)
+func (s *Server) handleSavePrompt(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	chatID, manager := resolveChat(session, r.FormValue("chat_id"))
+	if manager == nil {
+		writeChatNotFound(w)
+		return
+	}
+	prompt := manager.GetCurrentPrompt()
+	if prompt == "" {
+		writeJSONError(w, http.StatusBadRequest, "no prompt to save")
+		return
+	}
+
+	saved, err := s.promptStore.Save(sessionID, r.FormValue("name"), prompt)
+	if err != nil {
+		switch {
+		case errors.Is(err, persistence.ErrInvalidPromptName):
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("name must be 1-%d characters", persistence.MaxPromptNameLength))
+		case errors.Is(err, persistence.ErrPromptLibraryFull):
+			writeJSONError(w, http.StatusConflict, "too many saved prompts")
+		default:
+			log.Printf("Failed to save prompt for session %s: %v", sessionID, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to save prompt")
+		}
+		return
+	}
+
+	writeChatJSON(w, http.StatusCreated, savedPromptMutationResponse{
+		Status: "ok",
+		ChatID: chatID,
+		Prompt: buildSavedPromptResponse(saved),
+	})
+}
+
+// handleLoadSavedPrompt makes a saved prompt a chat's current prompt, as if
+// the user had typed it, and sends it to the UI.
+// POST /prompts/{name}/load (form: chat_id, optional, defaults to the active chat)
+func (s *Server) handleLoadSavedPrompt(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	chatID, manager := resolveChat(session, r.FormValue("chat_id"))
+	if manager == nil {
+		writeChatNotFound(w)
+		return
+	}
+
+	saved, ok, err := s.promptStore.Get(sessionID, r.PathValue("name"))
+	if err != nil {
+		log.Printf("Failed to load saved prompt for session %s: %v", sessionID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to load saved prompt")
+		return
+	}
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "saved prompt not found")
+		return
+	}
+
+	// Same as an edit in the prompt box, so the agent learns of the change
+	manager.UpdatePrompt(saved.Prompt)
+	manager.NotifyPromptEdited()
+	_ = s.sendChatEvent(sessionID, chatID, EventPromptUpdate, map[string]string{
+		"prompt": saved.Prompt,
+	})
+
+	writeChatJSON(w, http.StatusOK, savedPromptMutationResponse{
+		Status: "ok",
+		ChatID: chatID,
+		Prompt: buildSavedPromptResponse(saved),
+	})
+}
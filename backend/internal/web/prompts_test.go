@@ -0,0 +1,95 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// postPrompts posts a form to target as the test session.
+func postPrompts(s *Server, target string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+	req.Header.Set(CSRFHeaderName, s.csrfToken(testGallerySessionID))
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleSavePrompt(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	manager := s.sessionManager.GetSession(testGallerySessionID).Manager()
+
+	// Nothing to save yet
+	manager.UpdatePrompt("")
+	if w := postPrompts(s, "/prompts", url.Values{"name": {"Portrait"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("POST /prompts without a prompt status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	manager.UpdatePrompt("a portrait, soft light")
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+	}{
+		{"saved", url.Values{"name": {"Portrait"}}, http.StatusCreated},
+		{"empty name", url.Values{"name": {" "}}, http.StatusBadRequest},
+		{"unknown chat", url.Values{"name": {"Portrait"}, "chat_id": {"nope"}}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := postPrompts(s, "/prompts", tt.form); w.Code != tt.wantStatus {
+				t.Errorf("POST /prompts status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	w := serveAs(s, http.MethodGet, "/prompts", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /prompts status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var resp savedPromptListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Prompts) != 1 || resp.Prompts[0].Name != "Portrait" || resp.Prompts[0].Prompt != "a portrait, soft light" {
+		t.Errorf("GET /prompts = %+v, want the saved prompt", resp.Prompts)
+	}
+
+	// Other sessions have their own library
+	w = serveAs(s, http.MethodGet, "/prompts", testResumeSessionID)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Prompts) != 0 {
+		t.Errorf("GET /prompts from another session = %s, want no prompts", w.Body.String())
+	}
+}
+
+func TestHandleLoadSavedPrompt(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	manager := s.sessionManager.GetSession(testGallerySessionID).Manager()
+	if _, err := s.promptStore.Save(testGallerySessionID, "Foggy harbor", "a harbor in the fog"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if w := postPrompts(s, "/prompts/missing/load", nil); w.Code != http.StatusNotFound {
+		t.Errorf("POST /prompts/missing/load status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	w := postPrompts(s, "/prompts/"+url.PathEscape("foggy harbor")+"/load", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST load status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got := manager.GetCurrentPrompt(); got != "a harbor in the fog" {
+		t.Errorf("current prompt = %q, want the saved prompt", got)
+	}
+	var resp savedPromptMutationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Prompt.Name != "Foggy harbor" || resp.ChatID == "" {
+		t.Errorf("POST load = %+v, want the saved prompt and the active chat", resp)
+	}
+}
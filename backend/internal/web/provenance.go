@@ -0,0 +1,130 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/provenance"
+)
+
+const (
+	// provenanceKeyFileName is the signing key's name within the image store's base path
+	provenanceKeyFileName = "provenance.key"
+
+	// provenanceModel identifies the image model in provenance manifests
+	provenanceModel = "stable-diffusion-3.5"
+)
+
+// provenanceKeyResponse is the response for GET /provenance/key.
+type provenanceKeyResponse struct {
+	Status    string `json:"status"`
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	PublicKey string `json:"public_key"`
+}
+
+// provenanceVerifyResponse is the response for POST /provenance/verify.
+type provenanceVerifyResponse struct {
+	Status string `json:"status"`
+
+	// Valid is true if the manifest's signature checks out and the image
+	// is unchanged since signing.
+	Valid bool `json:"valid"`
+
+	// Trusted is true if the image was signed with this instance's key.
+	Trusted bool `json:"trusted"`
+
+	// Error explains why the image is not valid.
+	Error    string               `json:"error,omitempty"`
+	Manifest *provenance.Manifest `json:"manifest,omitempty"`
+}
+
+// signImage embeds a provenance manifest in an image leaving the server.
+// Signing failures are logged and the image is returned unsigned, so a
+// broken key never blocks an export or download.
+func (s *Server) signImage(pngData []byte, prompt string) []byte {
+	signed, err := s.provenance.Sign(pngData, provenance.Claim{
+		Generator: "weave/" + config.Version,
+		Model:     provenanceModel,
+		Prompt:    prompt,
+	})
+	if err != nil {
+		log.Printf("Failed to sign image provenance: %v", err)
+		return pngData
+	}
+	return signed
+}
+
+// handleProvenanceKey returns the public key this instance signs images with.
+// GET /provenance/key
+func (s *Server) handleProvenanceKey(w http.ResponseWriter, r *http.Request) {
+	public, err := s.provenance.PublicKey()
+	if err != nil {
+		log.Printf("Failed to load provenance key: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resp := provenanceKeyResponse{
+		Status:    "ok",
+		Algorithm: "ed25519",
+		KeyID:     provenance.KeyID(public),
+		PublicKey: base64.StdEncoding.EncodeToString(public),
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode provenance key response: %v", err)
+	}
+}
+
+// handleVerifyProvenance checks the provenance manifest of an uploaded PNG.
+// POST /provenance/verify
+// Body: the PNG image (maximum image.MaxImageSize bytes).
+//
+// Images that fail verification still get HTTP 200 with valid=false and
+// the reason; only unreadable uploads are rejected.
+func (s *Server) handleVerifyProvenance(w http.ResponseWriter, r *http.Request) {
+	// SECURITY: Limit upload size
+	r.Body = http.MaxBytesReader(w, r.Body, image.MaxImageSize)
+	pngData, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "image too large")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "failed to read image")
+		return
+	}
+
+	resp := provenanceVerifyResponse{Status: "ok"}
+	manifest, err := provenance.Verify(pngData)
+	switch {
+	case errors.Is(err, image.ErrInvalidPNG):
+		writeJSONError(w, http.StatusBadRequest, "not a PNG image")
+		return
+	case err != nil:
+		resp.Error = err.Error()
+	default:
+		resp.Valid = true
+		resp.Manifest = &manifest
+		if public, err := s.provenance.PublicKey(); err == nil {
+			resp.Trusted = manifest.KeyID == provenance.KeyID(public)
+		} else {
+			log.Printf("Failed to load provenance key: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode provenance verify response: %v", err)
+	}
+}
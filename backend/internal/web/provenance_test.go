@@ -0,0 +1,153 @@
+package web
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/provenance"
+)
+
+// verifyImage posts an image to /provenance/verify.
+func verifyImage(t *testing.T, s *Server, body []byte) (int, provenanceVerifyResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/provenance/verify", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "image/png")
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+
+	var resp provenanceVerifyResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("verify response is not JSON: %v", err)
+		}
+	}
+	return w.Code, resp
+}
+
+func TestProvenance_GalleryImageVerifies(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	source, err := image.EncodePNG(4, 4, make([]byte, 4*4*3), image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	if err := s.imageStore.Save(testGallerySessionID, 1, source); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	w := serveAs(s, http.MethodPost, "/sessions/"+testGallerySessionID+"/images/1.png/publish", testGallerySessionID)
+	var published struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &published); err != nil {
+		t.Fatalf("publish response is not JSON: %v", err)
+	}
+	served := serveAs(s, http.MethodGet, published.URL, "").Body.Bytes()
+
+	code, resp := verifyImage(t, s, served)
+	if code != http.StatusOK {
+		t.Fatalf("verify status = %d, want %d", code, http.StatusOK)
+	}
+	if !resp.Valid || !resp.Trusted {
+		t.Fatalf("verify = valid %v trusted %v (%s), want both true", resp.Valid, resp.Trusted, resp.Error)
+	}
+	if resp.Manifest.Model != provenanceModel {
+		t.Errorf("manifest model = %q, want %q", resp.Manifest.Model, provenanceModel)
+	}
+
+	// The published key matches the manifest
+	w = serveAs(s, http.MethodGet, "/provenance/key", "")
+	var key provenanceKeyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &key); err != nil {
+		t.Fatalf("key response is not JSON: %v", err)
+	}
+	if key.KeyID != resp.Manifest.KeyID || key.Algorithm != "ed25519" {
+		t.Errorf("key = %+v, want key_id %s", key, resp.Manifest.KeyID)
+	}
+
+	// The owner's copy is stored unsigned
+	w = serveAs(s, http.MethodGet, "/sessions/"+testGallerySessionID+"/images/1.png", testGallerySessionID)
+	if !bytes.Equal(w.Body.Bytes(), source) {
+		t.Error("session image was modified by signing")
+	}
+}
+
+func TestProvenance_ExportZipSigned(t *testing.T) {
+	s, msgID := newExportTestServer(t)
+	source, err := image.EncodePNG(4, 4, make([]byte, 4*4*3), image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	if err := s.imageStore.Save(testExportSessionID, msgID, source); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	w := doExport(t, s, "?format=json&zip=true")
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("response is not a zip archive: %v", err)
+	}
+	f, err := zr.Open(exportImagePath(msgID))
+	if err != nil {
+		t.Fatalf("archive missing image: %v", err)
+	}
+	archived, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+
+	m, err := provenance.Verify(archived)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if m.PromptSHA256 == "" || m.Generator == "" {
+		t.Errorf("manifest = %+v, want generator and prompt hash", m)
+	}
+}
+
+func TestProvenance_VerifyRejects(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	unsigned, err := image.EncodePNG(2, 2, make([]byte, 2*2*3), image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	foreign, err := provenance.NewSigner(t.TempDir()+"/other.key").Sign(unsigned, provenance.Claim{Prompt: "a cat"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		body        []byte
+		wantCode    int
+		wantValid   bool
+		wantTrusted bool
+	}{
+		{name: "not a PNG", body: []byte("hello"), wantCode: http.StatusBadRequest},
+		{name: "too large", body: make([]byte, image.MaxImageSize+1), wantCode: http.StatusRequestEntityTooLarge},
+		{name: "unsigned", body: unsigned, wantCode: http.StatusOK},
+		{name: "signed by another instance", body: foreign, wantCode: http.StatusOK, wantValid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := verifyImage(t, s, tt.body)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", code, tt.wantCode)
+			}
+			if resp.Valid != tt.wantValid || resp.Trusted != tt.wantTrusted {
+				t.Errorf("verify = valid %v trusted %v, want valid %v trusted %v", resp.Valid, resp.Trusted, tt.wantValid, tt.wantTrusted)
+			}
+			if code == http.StatusOK && !resp.Valid && resp.Error == "" {
+				t.Error("invalid image reported without a reason")
+			}
+		})
+	}
+}
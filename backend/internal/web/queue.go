@@ -0,0 +1,274 @@
+package web
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// generationQueue admits generations to compute, which works on one per
+// worker at a time. Generations over the limit wait: higher priorities
+// first, then the session whose last generation was admitted longest ago,
+// so one session's agent autogenerating in a loop does not starve a Generate
+// click in another, then in arrival order.
+type generationQueue struct {
+	mu      sync.Mutex
+	limit   int // generations admitted at once, from the last acquire
+	running int
+	waiting []*queuedGeneration
+
+	// served is the turn each session last had a generation admitted in,
+	// reset when the queue is idle
+	served map[string]uint64
+	turn   uint64
+	seq    uint64
+}
+
+// queuedGeneration is a generation waiting in a generationQueue.
+type queuedGeneration struct {
+	sessionID string
+	priority  protocol.Priority
+	seq       uint64
+	ready     chan struct{} // closed when admitted
+
+	// position is the place in the queue, 1 for next, 0 once admitted; set
+	// under the queue's mu
+	position atomic.Int64
+
+	notifyMu sync.Mutex
+	notify   func(position int)
+	reported int64 // last position passed to notify, under notifyMu
+}
+
+func newGenerationQueue() *generationQueue {
+	return &generationQueue{served: make(map[string]uint64)}
+}
+
+// acquire waits until a generation of sessionID may be sent to compute, at
+// most limit at a time, and returns the func to call once it is done.
+// While it waits, notify is called with its place in the queue, 1 being
+// next, whenever that changes, and then with 0 when it is admitted. notify
+// is not called for a generation admitted straight away. Returns ctx's error
+// if ctx is done first.
+func (q *generationQueue) acquire(ctx context.Context, sessionID string, priority protocol.Priority, limit int, notify func(position int)) (release func(), err error) {
+	q.mu.Lock()
+	q.limit = max(limit, 1)
+	if q.running < q.limit && len(q.waiting) == 0 {
+		q.admit(sessionID)
+		q.mu.Unlock()
+		return q.releaser(), nil
+	}
+
+	q.seq++
+	g := &queuedGeneration{
+		sessionID: sessionID,
+		priority:  priority,
+		seq:       q.seq,
+		ready:     make(chan struct{}),
+		notify:    notify,
+	}
+	q.waiting = append(q.waiting, g)
+	moved := q.reorder()
+	q.mu.Unlock()
+	reportPositions(moved)
+
+	select {
+	case <-g.ready:
+		g.report()
+		return q.releaser(), nil
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	select {
+	case <-g.ready:
+		// Admitted while giving up
+		q.mu.Unlock()
+		q.releaser()()
+		return nil, ctx.Err()
+	default:
+	}
+	for i, w := range q.waiting {
+		if w == g {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			break
+		}
+	}
+	moved = q.reorder()
+	q.mu.Unlock()
+	reportPositions(moved)
+	return nil, ctx.Err()
+}
+
+// releaser returns the func that gives an admitted generation's slot to the
+// next one waiting. Calls after the first do nothing.
+func (q *generationQueue) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			q.running--
+			moved := q.dispatch()
+			q.mu.Unlock()
+			reportPositions(moved)
+		})
+	}
+}
+
+// dispatch admits waiting generations while there is room and returns the
+// ones whose position changed. Callers hold mu.
+func (q *generationQueue) dispatch() []*queuedGeneration {
+	var moved []*queuedGeneration
+	for q.running < q.limit && len(q.waiting) > 0 {
+		next := q.order()[0]
+		for i, w := range q.waiting {
+			if w == next {
+				q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+				break
+			}
+		}
+		q.admit(next.sessionID)
+		next.position.Store(0)
+		close(next.ready)
+		moved = append(moved, next)
+	}
+	if q.running == 0 && len(q.waiting) == 0 {
+		clear(q.served)
+	}
+	return append(moved, q.reorder()...)
+}
+
+// admit counts a generation of sessionID as running. Callers hold mu.
+func (q *generationQueue) admit(sessionID string) {
+	q.running++
+	q.turn++
+	q.served[sessionID] = q.turn
+}
+
+// reorder updates the positions of the waiting generations and returns the
+// ones that changed. Callers hold mu.
+func (q *generationQueue) reorder() []*queuedGeneration {
+	var moved []*queuedGeneration
+	for i, g := range q.order() {
+		if g.position.Swap(int64(i+1)) != int64(i+1) {
+			moved = append(moved, g)
+		}
+	}
+	return moved
+}
+
+// order returns the waiting generations in the order they will be admitted
+// if no others arrive. Callers hold mu.
+func (q *generationQueue) order() []*queuedGeneration {
+	served := make(map[string]uint64, len(q.waiting))
+	for _, g := range q.waiting {
+		served[g.sessionID] = q.served[g.sessionID]
+	}
+	turn := q.turn
+
+	left := append([]*queuedGeneration(nil), q.waiting...)
+	ordered := make([]*queuedGeneration, 0, len(left))
+	for len(left) > 0 {
+		best := 0
+		for i, g := range left[1:] {
+			if g.before(left[best], served) {
+				best = i + 1
+			}
+		}
+		g := left[best]
+		left = append(left[:best], left[best+1:]...)
+		turn++
+		served[g.sessionID] = turn
+		ordered = append(ordered, g)
+	}
+	return ordered
+}
+
+// before reports whether g is admitted before other, given the turn each
+// session was last served in.
+func (g *queuedGeneration) before(other *queuedGeneration, served map[string]uint64) bool {
+	if rank, otherRank := priorityRank(g.priority), priorityRank(other.priority); rank != otherRank {
+		return rank > otherRank
+	}
+	if served[g.sessionID] != served[other.sessionID] {
+		return served[g.sessionID] < served[other.sessionID]
+	}
+	return g.seq < other.seq
+}
+
+// priorityRank orders priorities by urgency; protocol.PriorityNormal is 0
+// on the wire but between low and high.
+func priorityRank(p protocol.Priority) int {
+	switch p {
+	case protocol.PriorityLow:
+		return 0
+	case protocol.PriorityHigh:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// report passes the current position of g to its notify if it changed
+// since the last call. It reads the position again rather than taking one,
+// so reports racing each other never leave a stale position last.
+func (g *queuedGeneration) report() {
+	if g.notify == nil {
+		return
+	}
+	g.notifyMu.Lock()
+	defer g.notifyMu.Unlock()
+	position := g.position.Load()
+	if position == g.reported {
+		return
+	}
+	g.reported = position
+	g.notify(int(position))
+}
+
+// reportPositions reports the positions of moved, outside the queue's mu since
+// notify may block on a slow SSE client.
+func reportPositions(moved []*queuedGeneration) {
+	for _, g := range moved {
+		g.report()
+	}
+}
+
+// computeSlots returns how many generations compute works on at once: one
+// per worker of a pool.
+func (s *Server) computeSlots() int {
+	if s.computeClient == nil {
+		return 1
+	}
+	return max(len(s.computeClient.Workers()), 1)
+}
+
+// queuePositionNotifier returns the notify func for generationQueue.acquire
+// that sends the queue position to the session's chat as an
+// EventQueuePosition. Generations without a session are not told.
+func (s *Server) queuePositionNotifier(sessionID, chatID string, messageID int) func(position int) {
+	if sessionID == "" {
+		return nil
+	}
+	return func(position int) {
+		_ = s.sendChatEvent(sessionID, chatID, EventQueuePosition, QueuePositionData{
+			Position:  position,
+			MessageID: messageID,
+		})
+	}
+}
+
+// withPriority returns a context that gives generations started with it
+// priority p in the generation queue and on the wire.
+func withPriority(ctx context.Context, p protocol.Priority) context.Context {
+	return context.WithValue(ctx, priorityKey, p)
+}
+
+// priorityFromContext returns the priority set by withPriority, or
+// protocol.PriorityNormal.
+func priorityFromContext(ctx context.Context) protocol.Priority {
+	p, _ := ctx.Value(priorityKey).(protocol.Priority)
+	return p
+}
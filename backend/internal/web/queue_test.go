@@ -0,0 +1,216 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// queueTester queues generations on a generationQueue and records the order
+// they are admitted in.
+type queueTester struct {
+	t *testing.T
+	q *generationQueue
+
+	mu       sync.Mutex
+	admitted []string
+	releases map[string]func()
+}
+
+func newQueueTester(t *testing.T) *queueTester {
+	return &queueTester{t: t, q: newGenerationQueue(), releases: make(map[string]func())}
+}
+
+// start acquires a slot for the generation name of sessionID in the
+// background and waits until it is admitted or queued.
+func (qt *queueTester) start(ctx context.Context, name, sessionID string, priority protocol.Priority, notify func(int)) <-chan error {
+	qt.t.Helper()
+	qt.q.mu.Lock()
+	waiting := len(qt.q.waiting)
+	qt.q.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		release, err := qt.q.acquire(ctx, sessionID, priority, 1, notify)
+		if err == nil {
+			qt.mu.Lock()
+			qt.admitted = append(qt.admitted, name)
+			qt.releases[name] = release
+			qt.mu.Unlock()
+		}
+		done <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		qt.q.mu.Lock()
+		queued := len(qt.q.waiting) > waiting
+		qt.q.mu.Unlock()
+		qt.mu.Lock()
+		_, admitted := qt.releases[name]
+		qt.mu.Unlock()
+		if queued || admitted {
+			return done
+		}
+		time.Sleep(time.Millisecond)
+	}
+	qt.t.Fatalf("%s neither admitted nor queued", name)
+	return nil
+}
+
+// finish releases the slot of name and waits for the next generation, if
+// any is waiting, to be admitted.
+func (qt *queueTester) finish(name string) {
+	qt.t.Helper()
+	qt.mu.Lock()
+	release := qt.releases[name]
+	before := len(qt.admitted)
+	qt.mu.Unlock()
+	qt.q.mu.Lock()
+	waiting := len(qt.q.waiting)
+	qt.q.mu.Unlock()
+
+	release()
+	if waiting == 0 {
+		return
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		qt.mu.Lock()
+		n := len(qt.admitted)
+		qt.mu.Unlock()
+		if n > before {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	qt.t.Fatalf("nothing admitted after %s finished", name)
+}
+
+// order returns the generations admitted so far, in order.
+func (qt *queueTester) order() []string {
+	qt.mu.Lock()
+	defer qt.mu.Unlock()
+	return slices.Clone(qt.admitted)
+}
+
+func TestGenerationQueue_Priority(t *testing.T) {
+	qt := newQueueTester(t)
+	ctx := context.Background()
+
+	qt.start(ctx, "running", "a", protocol.PriorityNormal, nil)
+	qt.start(ctx, "low", "b", protocol.PriorityLow, nil)
+	qt.start(ctx, "normal", "c", protocol.PriorityNormal, nil)
+	qt.start(ctx, "high", "d", protocol.PriorityHigh, nil)
+
+	qt.finish("running")
+	qt.finish("high")
+	qt.finish("normal")
+	qt.finish("low")
+
+	want := []string{"running", "high", "normal", "low"}
+	if got := qt.order(); !slices.Equal(got, want) {
+		t.Errorf("admitted %v, want %v", got, want)
+	}
+}
+
+func TestGenerationQueue_FairAcrossSessions(t *testing.T) {
+	qt := newQueueTester(t)
+	ctx := context.Background()
+
+	// Session a's agent autogenerates three times while its first
+	// generation runs; session b asks for one after
+	qt.start(ctx, "a1", "a", protocol.PriorityLow, nil)
+	qt.start(ctx, "a2", "a", protocol.PriorityLow, nil)
+	qt.start(ctx, "a3", "a", protocol.PriorityLow, nil)
+	qt.start(ctx, "a4", "a", protocol.PriorityLow, nil)
+	qt.start(ctx, "b1", "b", protocol.PriorityLow, nil)
+	qt.start(ctx, "b2", "b", protocol.PriorityLow, nil)
+
+	for _, name := range []string{"a1", "b1", "a2", "b2", "a3", "a4"} {
+		qt.finish(name)
+	}
+
+	want := []string{"a1", "b1", "a2", "b2", "a3", "a4"}
+	if got := qt.order(); !slices.Equal(got, want) {
+		t.Errorf("admitted %v, want %v", got, want)
+	}
+}
+
+func TestGenerationQueue_Positions(t *testing.T) {
+	qt := newQueueTester(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	positions := make(map[string][]int)
+	notifier := func(name string) func(int) {
+		return func(position int) {
+			mu.Lock()
+			positions[name] = append(positions[name], position)
+			mu.Unlock()
+		}
+	}
+
+	qt.start(ctx, "running", "a", protocol.PriorityNormal, notifier("running"))
+	qt.start(ctx, "low", "b", protocol.PriorityLow, notifier("low"))
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancelled := qt.start(cancelCtx, "cancelled", "c", protocol.PriorityNormal, notifier("cancelled"))
+	qt.start(ctx, "high", "d", protocol.PriorityHigh, notifier("high"))
+
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("acquire() error = %v, want context.Canceled", err)
+	}
+	qt.finish("running")
+	qt.finish("high")
+	qt.finish("low")
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string][]int{
+		// Admitted straight away, so never told
+		"running":   nil,
+		"low":       {1, 2, 3, 2, 1, 0},
+		"cancelled": {1, 2},
+		"high":      {1, 0},
+	}
+	for name, w := range want {
+		if got := positions[name]; !slices.Equal(got, w) {
+			t.Errorf("%s positions = %v, want %v", name, got, w)
+		}
+	}
+}
+
+func TestGenerationQueue_ReleaseOnce(t *testing.T) {
+	q := newGenerationQueue()
+	release, err := q.acquire(context.Background(), "a", protocol.PriorityNormal, 2, nil)
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	if _, err := q.acquire(context.Background(), "b", protocol.PriorityNormal, 2, nil); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	release()
+	release()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.running != 1 {
+		t.Errorf("running = %d after releasing one of two twice, want 1", q.running)
+	}
+}
+
+func TestPriorityFromContext(t *testing.T) {
+	ctx := context.Background()
+	if got := priorityFromContext(ctx); got != protocol.PriorityNormal {
+		t.Errorf("priorityFromContext() = %d without a priority, want normal", got)
+	}
+	if got := priorityFromContext(withPriority(ctx, protocol.PriorityLow)); got != protocol.PriorityLow {
+		t.Errorf("priorityFromContext() = %d, want low", got)
+	}
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"log"
+	"sort"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/metrics"
+)
+
+// storageFullMessage tells the user why an image wasn't saved with
+// --sessions-full refuse
+const storageFullMessage = "Image storage is full. Delete old images or sessions to make room."
+
+// Session storage metrics, exported at GET /metrics
+var (
+	sessionStorageBytes      = metrics.NewGauge("weave_session_storage_bytes", "Size of config/sessions: conversations, uploads and images.")
+	sessionStorageLimitBytes = metrics.NewGauge("weave_session_storage_limit_bytes", "Largest size of config/sessions set by --sessions-max-mb; 0 if unlimited.")
+	sessionImagesEvicted     = metrics.NewCounter("weave_session_images_evicted_total", "Images deleted to keep config/sessions under --sessions-max-mb.")
+)
+
+// configureStorageQuota applies --sessions-max-mb and --sessions-full to
+// the image store.
+func (s *Server) configureStorageQuota(cfg *config.Config) {
+	s.storageRefuses = false
+	if cfg == nil || cfg.SessionsMaxMB <= 0 {
+		s.imageStore.SetQuota(0, nil)
+		return
+	}
+	maxBytes := int64(cfg.SessionsMaxMB) << 20
+	if cfg.SessionsFull == config.SessionsFullRefuse {
+		s.storageRefuses = true
+		s.imageStore.SetQuota(maxBytes, nil)
+		return
+	}
+	s.imageStore.SetQuota(maxBytes, s.evictImages)
+}
+
+// evictImages deletes the least recently saved primary images that aren't
+// favorites until need bytes are freed, and tells each affected session
+// with an images-evicted event. Alternates are kept. Returns the bytes
+// freed. It implements persistence.ReclaimFunc.
+func (s *Server) evictImages(need int64) int64 {
+	images, err := s.imageStore.Images()
+	if err != nil {
+		log.Printf("Failed to list images to evict: %v", err)
+		return 0
+	}
+
+	var freed int64
+	evicted := make(map[string]*ImagesEvictedData)
+	for _, img := range images {
+		if freed >= need {
+			break
+		}
+		if img.Alternate != 0 {
+			continue
+		}
+		favorite, err := s.favoriteStore.IsFavorite(img.SessionID, img.MessageID)
+		if err != nil {
+			log.Printf("Failed to check favorite %s/%d before evicting it: %v", img.SessionID, img.MessageID, err)
+			continue
+		}
+		if favorite {
+			continue
+		}
+		if err := s.deleteSessionImage(img.SessionID, img.MessageID); err != nil {
+			log.Printf("Failed to evict image %s/%d: %v", img.SessionID, img.MessageID, err)
+			continue
+		}
+		freed += img.Size
+		data := evicted[img.SessionID]
+		if data == nil {
+			data = &ImagesEvictedData{}
+			evicted[img.SessionID] = data
+		}
+		data.MessageIDs = append(data.MessageIDs, img.MessageID)
+		data.FreedBytes += img.Size
+	}
+
+	count := 0
+	for sessionID, data := range evicted {
+		sort.Ints(data.MessageIDs)
+		_ = s.broker.SendEvent(sessionID, EventImagesEvicted, *data)
+		count += len(data.MessageIDs)
+	}
+	sessionImagesEvicted.Add(float64(count))
+	log.Printf("Evicted %d images (%.1f MiB) of %d sessions to stay under the session storage limit", count, float64(freed)/(1<<20), len(evicted))
+	return freed
+}
+
+// checkStorageQuota adds the size of config/sessions and its limit to the
+// disk health check. With --sessions-full refuse, reaching the limit fails
+// the check, since new images can't be saved.
+func (s *Server) checkStorageQuota(check *healthCheck) {
+	used, quota, err := s.imageStore.Usage()
+	if err != nil {
+		if check.Status == healthOK {
+			check.Status = healthFail
+			check.Error = "failed to measure session storage: " + err.Error()
+		}
+		return
+	}
+	check.UsedBytes = &used
+	if quota <= 0 {
+		return
+	}
+	check.LimitBytes = &quota
+	if s.storageRefuses && used >= quota && check.Status == healthOK {
+		check.Status = healthFail
+		check.Error = "session storage limit reached"
+	}
+}
+
+// updateStorageMetrics sets the session storage gauges.
+func (s *Server) updateStorageMetrics() {
+	used, quota, err := s.imageStore.Usage()
+	if err != nil {
+		log.Printf("Failed to measure session storage: %v", err)
+		return
+	}
+	sessionStorageBytes.Set(float64(used))
+	sessionStorageLimitBytes.Set(float64(quota))
+}
@@ -0,0 +1,86 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+func TestEvictImages(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	store := s.imageStore
+	for id := 2; id <= 3; id++ {
+		if err := store.Save(testGallerySessionID, id, []byte("image-png")); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	if err := store.SaveAlternate(testGallerySessionID, 2, 1, []byte("alternate")); err != nil {
+		t.Fatalf("SaveAlternate() error = %v", err)
+	}
+	// Message 1 is the oldest, but a favorite
+	if err := s.favoriteStore.Add(testGallerySessionID, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	base := time.Now().Add(-time.Hour)
+	for i, path := range []string{
+		store.GetPath(testGallerySessionID, 1),
+		store.GetAlternatePath(testGallerySessionID, 2, 1),
+		store.GetPath(testGallerySessionID, 2),
+		store.GetPath(testGallerySessionID, 3),
+	} {
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events := recordEvents(s, testGallerySessionID)
+
+	if freed := s.evictImages(1); freed != int64(len("image-png")) {
+		t.Errorf("evictImages() = %d, want %d", freed, len("image-png"))
+	}
+	if !store.Exists(testGallerySessionID, 1) || store.Exists(testGallerySessionID, 2) || !store.Exists(testGallerySessionID, 3) {
+		t.Error("evictImages() did not delete only the oldest image that isn't a favorite")
+	}
+	if _, err := os.Stat(store.GetAlternatePath(testGallerySessionID, 2, 1)); err != nil {
+		t.Error("evictImages() deleted an alternate")
+	}
+	body := events.Body.String()
+	if !strings.Contains(body, "event: "+EventImageDeleted) {
+		t.Errorf("events = %q, want %s", body, EventImageDeleted)
+	}
+	if !strings.Contains(body, "event: "+EventImagesEvicted) || !strings.Contains(body, `"message_ids":[2]`) {
+		t.Errorf("events = %q, want %s for message 2", body, EventImagesEvicted)
+	}
+}
+
+func TestStorageQuota_Refuse(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{SessionsMaxMB: 1, SessionsFull: config.SessionsFullRefuse})
+
+	// Fill the quota exactly; the fixture image is 10 bytes
+	if err := s.imageStore.Save(testGallerySessionID, 2, make([]byte, 1<<20-len("sunset-png"))); err != nil {
+		t.Fatalf("Save() up to the quota error = %v", err)
+	}
+	if err := s.imageStore.Save(testGallerySessionID, 3, []byte("image-png")); !errors.Is(err, persistence.ErrQuotaExceeded) {
+		t.Fatalf("Save() over the quota error = %v, want %v", err, persistence.ErrQuotaExceeded)
+	}
+	if !s.imageStore.Exists(testGallerySessionID, 1) {
+		t.Error("refusing a save deleted an older image")
+	}
+
+	w := serveAs(s, http.MethodGet, "/healthz", "")
+	var resp healthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	disk := resp.Checks["disk"]
+	if disk.Status != healthFail || disk.UsedBytes == nil || *disk.UsedBytes != 1<<20 || disk.LimitBytes == nil || *disk.LimitBytes != 1<<20 {
+		t.Errorf("disk = %+v, want fail with 1 MiB used of 1 MiB", disk)
+	}
+}
@@ -2,6 +2,9 @@ package web
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -20,6 +23,24 @@ const (
 	maxSessionAge = 30 * time.Minute
 )
 
+// rateLimit is the state of a session's limit after a request, reported in
+// the X-RateLimit-* and Retry-After response headers.
+type rateLimit struct {
+	allowed bool
+
+	// limit is the number of requests allowed per minute, or per day when
+	// the daily generation quota is the tighter limit
+	limit     int
+	remaining int
+
+	// reset is when remaining is back to limit
+	reset time.Time
+
+	// retryAfter is how long until the next request is allowed (0 if
+	// remaining is above zero)
+	retryAfter time.Duration
+}
+
 // tokenBucket implements a simple token bucket rate limiter.
 type tokenBucket struct {
 	capacity   int
@@ -44,6 +65,11 @@ func newTokenBucket(capacity int) *tokenBucket {
 // allow checks if a request can proceed and consumes a token if so.
 // Returns true if the request is allowed, false if rate limited.
 func (tb *tokenBucket) allow() bool {
+	return tb.take().allowed
+}
+
+// take consumes a token if one is available and returns the resulting state.
+func (tb *tokenBucket) take() rateLimit {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
@@ -65,19 +91,40 @@ func (tb *tokenBucket) allow() bool {
 	tb.lastAccess = now
 
 	// Check if we have tokens available
-	if tb.tokens > 0 {
+	allowed := tb.tokens > 0
+	if allowed {
 		tb.tokens--
-		return true
 	}
 
-	return false
+	// Tokens are added one per interval, counted from the last refill
+	interval := time.Minute / time.Duration(tb.capacity)
+	lim := rateLimit{
+		allowed:   allowed,
+		limit:     tb.capacity,
+		remaining: tb.tokens,
+		reset:     now,
+	}
+	if missing := tb.capacity - tb.tokens; missing > 0 {
+		lim.reset = tb.lastRefill.Add(interval * time.Duration(missing))
+	}
+	if tb.tokens == 0 {
+		lim.retryAfter = max(tb.lastRefill.Add(interval).Sub(now), 0)
+	}
+	return lim
 }
 
-// rateLimiter tracks rate limits per session.
+// rateLimiter tracks rate limits per session. When users are configured
+// each user has one session, so the limits apply per user.
 type rateLimiter struct {
 	mu       sync.RWMutex
 	chat     map[string]*tokenBucket
 	generate map[string]*tokenBucket
+
+	// Daily generation quota per session (0 = unlimited). generated counts
+	// the generations allowed on quotaDay, the current UTC date.
+	dailyGenerations int
+	quotaDay         string
+	generated        map[string]int
 }
 
 // newRateLimiter creates a new rate limiter.
@@ -88,8 +135,73 @@ func newRateLimiter() *rateLimiter {
 	}
 }
 
+// setHeaders sets the X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset (Unix seconds) headers, and Retry-After (seconds) when
+// the request was rejected.
+func (lim rateLimit) setHeaders(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(lim.limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(lim.remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(lim.resetUnix(), 10))
+	if !lim.allowed {
+		h.Set("Retry-After", strconv.Itoa(lim.retryAfterSeconds()))
+	}
+}
+
+// resetUnix returns reset in Unix seconds, rounded up so a client waiting
+// until then isn't rejected again.
+func (lim rateLimit) resetUnix() int64 {
+	return lim.reset.Add(time.Second - 1).Unix()
+}
+
+// retryAfterSeconds returns retryAfter in whole seconds, rounded up and at
+// least one.
+func (lim rateLimit) retryAfterSeconds() int {
+	return max(int((lim.retryAfter+time.Second-1)/time.Second), 1)
+}
+
+// writeRateLimited rejects a request with 429, the rate limit headers and a
+// JSON body describing the limit.
+func writeRateLimited(w http.ResponseWriter, lim rateLimit) {
+	lim.setHeaders(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(rateLimitedResponse{
+		Status:     "error",
+		Message:    "rate limit exceeded",
+		Limit:      lim.limit,
+		Remaining:  lim.remaining,
+		Reset:      lim.resetUnix(),
+		RetryAfter: lim.retryAfterSeconds(),
+	})
+}
+
+// rateLimitedResponse is the body of a 429 response.
+type rateLimitedResponse struct {
+	Status     string `json:"status"`
+	Message    string `json:"message"`
+	Limit      int    `json:"limit"`
+	Remaining  int    `json:"remaining"`
+	Reset      int64  `json:"reset"`
+	RetryAfter int    `json:"retry_after"`
+}
+
+// setDailyGenerationQuota limits each session to n generations per UTC day.
+// Zero removes the limit. Counts made under a previous quota are kept.
+func (rl *rateLimiter) setDailyGenerationQuota(n int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.dailyGenerations = n
+}
+
 // allowChat checks if a chat request is allowed for the given session.
 func (rl *rateLimiter) allowChat(sessionID string) bool {
+	return rl.takeChat(sessionID).allowed
+}
+
+// takeChat counts a chat request for the given session and returns the
+// state of its limit.
+func (rl *rateLimiter) takeChat(sessionID string) rateLimit {
 	rl.mu.Lock()
 	bucket, ok := rl.chat[sessionID]
 	if !ok {
@@ -98,20 +210,65 @@ func (rl *rateLimiter) allowChat(sessionID string) bool {
 	}
 	rl.mu.Unlock()
 
-	return bucket.allow()
+	return bucket.take()
 }
 
-// allowGenerate checks if a generate request is allowed for the given session.
+// allowGenerate checks if a generate request is allowed for the given session,
+// both by the per-minute rate limit and the daily generation quota.
 func (rl *rateLimiter) allowGenerate(sessionID string) bool {
+	return rl.takeGenerate(sessionID).allowed
+}
+
+// takeGenerate counts a generate request for the given session against the
+// per-minute rate limit and the daily generation quota, and returns the
+// state of whichever limit is tighter.
+func (rl *rateLimiter) takeGenerate(sessionID string) rateLimit {
 	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
 	bucket, ok := rl.generate[sessionID]
 	if !ok {
 		bucket = newTokenBucket(MaxGenerateRequestsPerMinute)
 		rl.generate[sessionID] = bucket
 	}
-	rl.mu.Unlock()
 
-	return bucket.allow()
+	if rl.dailyGenerations == 0 {
+		return bucket.take()
+	}
+
+	// Counts reset at midnight UTC
+	now := time.Now().UTC()
+	today := now.Format(time.DateOnly)
+	if rl.quotaDay != today {
+		rl.quotaDay = today
+		rl.generated = make(map[string]int)
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	quota := rateLimit{
+		limit:     rl.dailyGenerations,
+		remaining: rl.dailyGenerations - rl.generated[sessionID],
+		reset:     midnight,
+	}
+	if quota.remaining <= 0 {
+		quota.remaining = 0
+		quota.retryAfter = midnight.Sub(now)
+		return quota
+	}
+
+	lim := bucket.take()
+	if !lim.allowed {
+		return lim
+	}
+	rl.generated[sessionID]++
+	quota.allowed = true
+	quota.remaining--
+	if quota.remaining < lim.remaining {
+		if quota.remaining == 0 {
+			quota.retryAfter = midnight.Sub(now)
+		}
+		return quota
+	}
+	return lim
 }
 
 // cleanup removes rate limit state for a deleted session.
@@ -2,6 +2,10 @@ package web
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -77,6 +81,123 @@ func TestTokenBucket_Refill(t *testing.T) {
 	}
 }
 
+func TestTokenBucket_Take(t *testing.T) {
+	tb := newTokenBucket(6)
+	start := tb.lastRefill
+
+	lim := tb.take()
+	if !lim.allowed || lim.limit != 6 || lim.remaining != 5 {
+		t.Errorf("first take() = %+v, want allowed with 5 of 6 remaining", lim)
+	}
+	// One token is restored every 10 seconds
+	if want := start.Add(10 * time.Second); !lim.reset.Equal(want) {
+		t.Errorf("reset = %v, want %v", lim.reset, want)
+	}
+	if lim.retryAfter != 0 {
+		t.Errorf("retryAfter = %v, want 0 while tokens remain", lim.retryAfter)
+	}
+
+	for i := 0; i < 5; i++ {
+		tb.take()
+	}
+	lim = tb.take()
+	if lim.allowed || lim.remaining != 0 {
+		t.Errorf("take() when empty = %+v, want rejected with none remaining", lim)
+	}
+	if want := start.Add(time.Minute); !lim.reset.Equal(want) {
+		t.Errorf("reset = %v, want %v", lim.reset, want)
+	}
+	if lim.retryAfter <= 0 || lim.retryAfter > 10*time.Second {
+		t.Errorf("retryAfter = %v, want up to 10s", lim.retryAfter)
+	}
+}
+
+func TestRateLimiter_TakeGenerateReportsQuota(t *testing.T) {
+	rl := newRateLimiter()
+	rl.setDailyGenerationQuota(10)
+
+	// The per-minute limit is tighter until the quota runs low
+	lim := rl.takeGenerate("alice")
+	if !lim.allowed || lim.limit != MaxGenerateRequestsPerMinute {
+		t.Errorf("first takeGenerate() = %+v, want the per-minute limit", lim)
+	}
+
+	rl.mu.Lock()
+	rl.generated["alice"] = 9
+	rl.mu.Unlock()
+	lim = rl.takeGenerate("alice")
+	if !lim.allowed || lim.limit != 10 || lim.remaining != 0 {
+		t.Errorf("last takeGenerate() = %+v, want the quota with none remaining", lim)
+	}
+
+	lim = rl.takeGenerate("alice")
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	if lim.allowed || !lim.reset.Equal(midnight) {
+		t.Errorf("takeGenerate() over quota = %+v, want rejected until %v", lim, midnight)
+	}
+	if lim.retryAfter <= 0 || lim.retryAfter > 24*time.Hour {
+		t.Errorf("retryAfter = %v, want the time until midnight UTC", lim.retryAfter)
+	}
+}
+
+func TestWriteRateLimited(t *testing.T) {
+	reset := time.Unix(1767225600, 0)
+	w := httptest.NewRecorder()
+	writeRateLimited(w, rateLimit{limit: 5, remaining: 0, reset: reset, retryAfter: 11500 * time.Millisecond})
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	wantHeaders := map[string]string{
+		"X-RateLimit-Limit":     "5",
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     "1767225600",
+		"Retry-After":           "12",
+		"Content-Type":          "application/json",
+	}
+	for name, want := range wantHeaders {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	var body rateLimitedResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	want := rateLimitedResponse{Status: "error", Message: "rate limit exceeded", Limit: 5, Reset: 1767225600, RetryAfter: 12}
+	if body != want {
+		t.Errorf("body = %+v, want %+v", body, want)
+	}
+}
+
+func TestRateLimitHeaders_Handler(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	target := "/regenerate/1"
+
+	// Allowed requests report the remaining budget; no compute is running,
+	// so the regeneration itself fails
+	w := serveAs(s, http.MethodPost, target, testGallerySessionID)
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != strconv.Itoa(MaxGenerateRequestsPerMinute-1) {
+		t.Errorf("X-RateLimit-Remaining = %q, want %d", got, MaxGenerateRequestsPerMinute-1)
+	}
+	if got := w.Header().Get("Retry-After"); got != "" {
+		t.Errorf("Retry-After = %q on an allowed request", got)
+	}
+
+	for i := 1; i < MaxGenerateRequestsPerMinute; i++ {
+		s.rateLimiter.allowGenerate(testGallerySessionID)
+	}
+	w = serveAs(s, http.MethodPost, target, testGallerySessionID)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got == "" {
+		t.Error("Retry-After not set on a rejected request")
+	}
+}
+
 func TestRateLimiter_AllowChat(t *testing.T) {
 	rl := newRateLimiter()
 	sessionID := "test-session"
@@ -111,6 +232,42 @@ func TestRateLimiter_AllowGenerate(t *testing.T) {
 	}
 }
 
+func TestRateLimiter_DailyGenerationQuota(t *testing.T) {
+	rl := newRateLimiter()
+	rl.setDailyGenerationQuota(2)
+
+	for i := 0; i < 2; i++ {
+		if !rl.allowGenerate("alice") {
+			t.Fatalf("expected generation %d to be allowed", i)
+		}
+	}
+	if rl.allowGenerate("alice") {
+		t.Error("expected alice to be over quota")
+	}
+	if !rl.allowGenerate("bob") {
+		t.Error("expected bob to be allowed (different session)")
+	}
+
+	// A new day starts a new count
+	rl.mu.Lock()
+	rl.quotaDay = "2000-01-01"
+	rl.mu.Unlock()
+	if !rl.allowGenerate("alice") {
+		t.Error("expected alice to be allowed on a new day")
+	}
+}
+
+func TestRateLimiter_DailyGenerationQuotaDisabled(t *testing.T) {
+	rl := newRateLimiter()
+	rl.setDailyGenerationQuota(1)
+	rl.allowGenerate("alice")
+	rl.setDailyGenerationQuota(0)
+
+	if !rl.allowGenerate("alice") {
+		t.Error("expected generation to be allowed without a quota")
+	}
+}
+
 func TestRateLimiter_DifferentSessions(t *testing.T) {
 	rl := newRateLimiter()
 	session1 := "session1"
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Readiness statuses reported by GET /ready
+const (
+	// ReadinessReady means the server can chat and generate
+	ReadinessReady = "ready"
+	// ReadinessPulling means the chat model is being downloaded
+	ReadinessPulling = "pulling"
+	// ReadinessFailed means the server can't become ready, for example
+	// because the model pull failed
+	ReadinessFailed = "failed"
+)
+
+// Readiness describes why the server isn't ready yet, as reported by
+// GET /ready. Progress fields are those of the download under way.
+type Readiness struct {
+	Status    string `json:"status"`
+	Model     string `json:"model,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SetReadiness sets what GET /ready reports. A status of ReadinessReady, or
+// a nil r, marks the server ready. It is safe to call while the server is
+// running, and carries over Reconfigure.
+func (s *Server) SetReadiness(r *Readiness) {
+	if r != nil && r.Status == ReadinessReady {
+		r = nil
+	}
+	s.readiness.Store(r)
+}
+
+// handleReady is a health check endpoint for Electron.
+// Returns HTTP 200 with JSON {"status":"ready"} when the server is ready,
+// or 503 with the Readiness while it isn't, such as during a model pull.
+// GET /healthz reports the status of each dependency.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	readiness := s.readiness.Load()
+	if readiness == nil {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"status":"ready"}`)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if err := json.NewEncoder(w).Encode(readiness); err != nil {
+		log.Printf("Failed to encode readiness response: %v", err)
+	}
+}
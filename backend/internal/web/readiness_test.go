@@ -0,0 +1,83 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServer_SetReadiness(t *testing.T) {
+	tests := []struct {
+		name       string
+		readiness  *Readiness
+		wantStatus int
+		want       Readiness
+	}{
+		{
+			name:       "pulling",
+			readiness:  &Readiness{Status: ReadinessPulling, Model: "llama3.2:1b", Detail: "pulling 6a0746a1ec1a", Completed: 1000, Total: 4000},
+			wantStatus: http.StatusServiceUnavailable,
+			want:       Readiness{Status: ReadinessPulling, Model: "llama3.2:1b", Detail: "pulling 6a0746a1ec1a", Completed: 1000, Total: 4000},
+		},
+		{
+			name:       "failed",
+			readiness:  &Readiness{Status: ReadinessFailed, Model: "llama3.2:1b", Error: "ollama pull failed"},
+			wantStatus: http.StatusServiceUnavailable,
+			want:       Readiness{Status: ReadinessFailed, Model: "llama3.2:1b", Error: "ollama pull failed"},
+		},
+		{
+			name:       "ready",
+			readiness:  &Readiness{Status: ReadinessReady},
+			wantStatus: http.StatusOK,
+			want:       Readiness{Status: ReadinessReady},
+		},
+		{
+			name:       "nil is ready",
+			wantStatus: http.StatusOK,
+			want:       Readiness{Status: ReadinessReady},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewServer("")
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+			s.SetReadiness(&Readiness{Status: ReadinessPulling})
+			s.SetReadiness(tt.readiness)
+
+			w := httptest.NewRecorder()
+			s.handleReady(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var got Readiness
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("readiness = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_Readiness_SurvivesReconfigure(t *testing.T) {
+	s, err := NewServer("")
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	if err := s.Reconfigure(nil, nil, nil); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+	s.SetReadiness(&Readiness{Status: ReadinessPulling})
+
+	w := httptest.NewRecorder()
+	s.active.Load().handleReady(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status code = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,203 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/hooks"
+	"github.com/hurricanerix/weave/internal/persistence"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// regenerateResponse is the response for POST /regenerate/{messageID}.
+type regenerateResponse struct {
+	Status    string `json:"status"`
+	SessionID string `json:"session_id"`
+	MessageID int    `json:"message_id"`
+	Alternate int    `json:"alternate"`
+	URL       string `json:"url"`
+	Seed      int64  `json:"seed"`
+}
+
+// handleRegenerate reruns generation for a message with a fresh random seed.
+// POST /regenerate/{messageID}
+//
+// The prompt comes from the message's snapshot, as do steps and CFG when the
+// snapshot recorded them; otherwise the session's settings are used. The new image
+// is stored as the next alternate of the message; the message's own preview
+// is left unchanged. Events are sent to the chat that owns the message.
+func (s *Server) handleRegenerate(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Check rate limit
+	limit := s.rateLimiter.takeGenerate(sessionID)
+	if !limit.allowed {
+		log.Printf("Rate limit exceeded for session %s (regenerate)", sessionID)
+		writeRateLimited(w, limit)
+		return
+	}
+	limit.setHeaders(w)
+
+	messageID, err := strconv.Atoi(r.PathValue("messageID"))
+	if err != nil || messageID <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "invalid message ID")
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	chatID, manager := session.ChatForMessage(messageID)
+	if manager == nil {
+		writeJSONError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	msg := manager.GetMessage(messageID)
+	if msg == nil {
+		writeJSONError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	if msg.Snapshot == nil || strings.TrimSpace(msg.Snapshot.Prompt) == "" {
+		writeJSONError(w, http.StatusBadRequest, "message has no prompt to regenerate")
+		return
+	}
+	if len(msg.Alternates) >= conversation.MaxAlternatesPerMessage {
+		writeJSONError(w, http.StatusConflict, "too many alternates")
+		return
+	}
+	prompt := msg.Snapshot.Prompt
+	steps, cfg := msg.Snapshot.Steps, msg.Snapshot.CFG
+	if steps <= 0 {
+		// Snapshots from the agent don't record settings; use what the
+		// session last generated with
+		steps, cfg = s.defaultSteps, s.defaultCFG
+		if sessionSteps, sessionCFG, _, ok := session.GetGenerationSettings(); ok {
+			steps, cfg = sessionSteps, sessionCFG
+		}
+	}
+	seed := randomSeed()
+
+	_ = s.sendChatEvent(sessionID, chatID, EventGenerationStarted, map[string]interface{}{
+		"source":     "regenerate",
+		"message_id": messageID,
+	})
+
+	img, err := s.renderImage(withPriority(r.Context(), protocol.PriorityHigh), sessionID, chatID, prompt, steps, cfg, seed, messageID)
+	if err != nil {
+		// Error already sent via SSE and logged
+		if status, message, ok := moderationError(err); ok {
+			writeJSONError(w, status, message)
+			return
+		}
+		status := http.StatusInternalServerError
+		if errors.Is(err, client.ErrComputeNotRunning) || errors.Is(err, client.ErrXDGNotSet) {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSONError(w, status, "generation failed")
+		return
+	}
+
+	// Number, save and record the alternate as one step so concurrent
+	// regenerations of the same message cannot claim the same file
+	s.alternateMu.Lock()
+	alternate := 0
+	if current := manager.GetMessage(messageID); current != nil {
+		alternate = len(current.Alternates) + 1
+	}
+	if alternate == 0 || alternate > conversation.MaxAlternatesPerMessage {
+		s.alternateMu.Unlock()
+		writeJSONError(w, http.StatusConflict, "message changed during regeneration")
+		return
+	}
+	if err := s.imageStore.SaveAlternate(sessionID, messageID, alternate, img.png); err != nil {
+		s.alternateMu.Unlock()
+		log.Printf("Failed to save alternate %d for session %s, message %d: %v", alternate, sessionID, messageID, err)
+		s.fireGenerateFailed(r.Context(), img.hookPayload, fmt.Errorf("failed to save alternate: %w", err))
+		if errors.Is(err, persistence.ErrQuotaExceeded) {
+			s.sendErrorEvent(sessionID, chatID, storageFullMessage)
+			writeJSONError(w, http.StatusInsufficientStorage, "image storage is full")
+			return
+		}
+		s.sendErrorEvent(sessionID, chatID, "Failed to save image. Please try again.")
+		writeJSONError(w, http.StatusInternalServerError, "failed to save image")
+		return
+	}
+	imageURL := s.imageStore.GetAlternateURL(sessionID, messageID, alternate)
+	manager.AddMessageAlternate(messageID, conversation.ImageAlternate{URL: imageURL, Seed: seed})
+	s.alternateMu.Unlock()
+
+	hookPayload := img.hookPayload
+	hookPayload.Event = hooks.EventPostSave
+	hookPayload.ImageURL = imageURL
+	hookPayload.ImagePath = s.imageStore.GetAlternatePath(sessionID, messageID, alternate)
+	if err := s.hooks.Fire(r.Context(), hookPayload); err != nil {
+		log.Printf("Post-save hook failed for session %s: %v", sessionID, err)
+	}
+
+	log.Printf("Regenerated image for session %s, message %d as alternate %d (seed %d)", sessionID, messageID, alternate, seed)
+
+	_ = s.sendChatEvent(sessionID, chatID, EventImageReady, ImageReadyData{
+		URL:       imageURL,
+		Width:     img.width,
+		Height:    img.height,
+		MessageID: messageID,
+		Alternate: alternate,
+		Seed:      seed,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	resp := regenerateResponse{
+		Status:    "ok",
+		SessionID: sessionID,
+		MessageID: messageID,
+		Alternate: alternate,
+		URL:       imageURL,
+		Seed:      seed,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode regenerate response: %v", err)
+	}
+}
+
+// randomSeed returns a positive random seed.
+// Seeds stay within 32 bits so they survive a round trip through the
+// UI's number inputs; 0 is avoided because the compute protocol treats it
+// as "pick a seed".
+func randomSeed() int64 {
+	return 1 + rand.Int64N(math.MaxInt32)
+}
+
+// parseSessionImageFilename splits a session image filename into its message
+// ID and alternate number (0 for the primary image).
+// Accepts "{messageID}.png" and "{messageID}-{alternate}.png".
+func parseSessionImageFilename(filename string) (messageID int, alternate int, err error) {
+	name, ok := strings.CutSuffix(filename, ".png")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid image filename (must be .png)")
+	}
+
+	idPart, altPart, hasAlt := strings.Cut(name, "-")
+	messageID, err = strconv.Atoi(idPart)
+	if err != nil || messageID <= 0 {
+		return 0, 0, fmt.Errorf("invalid message ID")
+	}
+	if hasAlt {
+		alternate, err = strconv.Atoi(altPart)
+		if err != nil || alternate <= 0 {
+			return 0, 0, fmt.Errorf("invalid alternate")
+		}
+	}
+	return messageID, alternate, nil
+}
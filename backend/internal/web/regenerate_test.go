@@ -0,0 +1,163 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+const testRegenerateSessionID = "1234abcd1234abcd1234abcd1234abcd"
+
+func doRegenerate(t *testing.T, s *Server, sessionID, messageID string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/regenerate/"+messageID, nil)
+	req.SetPathValue("messageID", messageID)
+	if sessionID != "" {
+		req = req.WithContext(setSessionID(req.Context(), sessionID))
+	}
+	w := httptest.NewRecorder()
+	s.handleRegenerate(w, req)
+	return w
+}
+
+func TestHandleRegenerate(t *testing.T) {
+	store := persistence.NewImageStore(t.TempDir())
+	s, err := NewServerWithDeps("", nil, nil, nil, store, nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+
+	manager := s.sessionManager.GetSession(testRegenerateSessionID).Manager()
+	userID := manager.AddUserMessage("draw a cat")
+	withPrompt := manager.AddAssistantMessage("Here's a cat", "a cat", &ollama.LLMMetadata{Prompt: "a cat", Steps: 4, CFG: 1})
+	full := manager.AddAssistantMessage("Another cat", "another cat", &ollama.LLMMetadata{Prompt: "another cat"})
+	for i := 0; i < conversation.MaxAlternatesPerMessage; i++ {
+		manager.AddMessageAlternate(full, conversation.ImageAlternate{URL: "/x.png"})
+	}
+
+	tests := []struct {
+		name        string
+		sessionID   string
+		messageID   string
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			name:       "requires session",
+			messageID:  strconv.Itoa(withPrompt),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:        "invalid message ID",
+			sessionID:   testRegenerateSessionID,
+			messageID:   "abc",
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "invalid message ID",
+		},
+		{
+			name:        "unknown message",
+			sessionID:   testRegenerateSessionID,
+			messageID:   "999",
+			wantStatus:  http.StatusNotFound,
+			wantMessage: "message not found",
+		},
+		{
+			name:        "message without prompt",
+			sessionID:   testRegenerateSessionID,
+			messageID:   strconv.Itoa(userID),
+			wantStatus:  http.StatusBadRequest,
+			wantMessage: "no prompt",
+		},
+		{
+			name:        "alternate limit reached",
+			sessionID:   testRegenerateSessionID,
+			messageID:   strconv.Itoa(full),
+			wantStatus:  http.StatusConflict,
+			wantMessage: "too many alternates",
+		},
+		{
+			name:        "compute not connected",
+			sessionID:   testRegenerateSessionID,
+			messageID:   strconv.Itoa(withPrompt),
+			wantStatus:  http.StatusServiceUnavailable,
+			wantMessage: "generation failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRegenerate(t, s, tt.sessionID, tt.messageID)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantMessage) {
+				t.Errorf("body = %s, want message containing %q", w.Body.String(), tt.wantMessage)
+			}
+		})
+	}
+
+	// Failed regenerations leave the message untouched
+	if n := len(manager.GetMessage(withPrompt).Alternates); n != 0 {
+		t.Errorf("message has %d alternates after failed regenerate, want 0", n)
+	}
+}
+
+func TestHandleSessionImage_Alternate(t *testing.T) {
+	store := persistence.NewImageStore(t.TempDir())
+	s, err := NewServerWithDeps("", nil, nil, nil, store, nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	if err := store.Save(testRegenerateSessionID, 3, []byte("primary")); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.SaveAlternate(testRegenerateSessionID, 3, 1, []byte("alternate")); err != nil {
+		t.Fatalf("SaveAlternate() error = %v", err)
+	}
+
+	tests := []struct {
+		filename   string
+		wantStatus int
+		wantBody   string
+	}{
+		{filename: "3.png", wantStatus: http.StatusOK, wantBody: "primary"},
+		{filename: "3-1.png", wantStatus: http.StatusOK, wantBody: "alternate"},
+		{filename: "3-2.png", wantStatus: http.StatusNotFound},
+		{filename: "3-0.png", wantStatus: http.StatusBadRequest},
+		{filename: "3-x.png", wantStatus: http.StatusBadRequest},
+		{filename: "3-1", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/sessions/"+testRegenerateSessionID+"/images/"+tt.filename, nil)
+			req.SetPathValue("sessionID", testRegenerateSessionID)
+			req.SetPathValue("filename", tt.filename)
+			req = req.WithContext(setSessionID(req.Context(), testRegenerateSessionID))
+			w := httptest.NewRecorder()
+			s.handleSessionImage(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status code = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRandomSeed(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if seed := randomSeed(); seed < 1 || seed > 1<<31-1 {
+			t.Fatalf("randomSeed() = %d, want 1 to 2^31-1", seed)
+		}
+	}
+}
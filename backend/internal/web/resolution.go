@@ -0,0 +1,119 @@
+package web
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+// maxGeneratePixels bounds width x height of a generation. SD 3.5 Medium
+// runs out of VRAM during VAE decode at 1024x1024 on the GPUs weave
+// targets; 768x768 fits, so larger sizes are scaled down to this area.
+const maxGeneratePixels = 768 * 768
+
+// maxTiledGeneratePixels bounds width x height of a generation with
+// --vae-tiling. Decoding in tiles needs far less VRAM, so 1024x1024 fits.
+const maxTiledGeneratePixels = 1024 * 1024
+
+// generateSize returns the size to generate the session's images at: the
+// session's resolution, or the server's default if none was set, fitted by
+// fitResolution.
+func (s *Server) generateSize(sessionID string) (int, int) {
+	width, height := s.requestedSize(sessionID)
+	return fitResolution(width, height, s.maxPixels())
+}
+
+// requestedSize returns the session's resolution, or the server's default
+// if none was set.
+func (s *Server) requestedSize(sessionID string) (int, int) {
+	width, height := s.defaultWidth, s.defaultHeight
+	if sessionID != "" {
+		if w, h := s.sessionManager.GetSession(sessionID).Resolution(); w > 0 && h > 0 {
+			width, height = w, h
+		}
+	}
+	return width, height
+}
+
+// maxPixels returns the largest width x height generations fit in:
+// maxTiledGeneratePixels with VAE tiling, maxGeneratePixels without.
+func (s *Server) maxPixels() int {
+	if s.vaeTiling {
+		return maxTiledGeneratePixels
+	}
+	return maxGeneratePixels
+}
+
+// resolutionClamp reports the session's resolution being scaled down to fit
+// VRAM, for the agent feedback, or nil if it fits. Without VAE tiling the
+// reason names --vae-tiling, which would fit more.
+func (s *Server) resolutionClamp(sessionID string) []clampedSetting {
+	width, height := s.requestedSize(sessionID)
+	if snapDimension(width)*snapDimension(height) <= s.maxPixels() {
+		return nil
+	}
+
+	fitW, fitH := s.generateSize(sessionID)
+	reason := "VAE decode would run out of VRAM"
+	if !s.vaeTiling {
+		reason += "; --vae-tiling allows up to 1024x1024"
+	}
+	return []clampedSetting{{
+		name:     "resolution",
+		original: fmt.Sprintf("%dx%d", width, height),
+		clamped:  fmt.Sprintf("%dx%d", fitW, fitH),
+		reason:   reason,
+	}}
+}
+
+// fitResolution snaps width and height to multiples of
+// protocol.SD35DimensionAlign within the compute limits and, if the result
+// exceeds maxPixels, scales it down keeping the aspect ratio.
+func fitResolution(width, height, maxPixels int) (int, int) {
+	width, height = snapDimension(width), snapDimension(height)
+	if width*height <= maxPixels {
+		return width, height
+	}
+
+	scale := math.Sqrt(float64(maxPixels) / float64(width*height))
+	width = alignDown(int(float64(width) * scale))
+	height = alignDown(int(float64(height) * scale))
+	return max(width, int(protocol.SD35MinWidth)), max(height, int(protocol.SD35MinHeight))
+}
+
+// snapDimension rounds n to the nearest multiple of
+// protocol.SD35DimensionAlign between the compute minimum and maximum.
+func snapDimension(n int) int {
+	align := int(protocol.SD35DimensionAlign)
+	n = (n + align/2) / align * align
+	return min(max(n, int(protocol.SD35MinWidth)), int(protocol.SD35MaxWidth))
+}
+
+// parseResolution applies the width and height form fields to the
+// session's resolution. Both must be given; a value that is not a positive
+// integer leaves the resolution unchanged, and an empty pair reverts to the
+// server's default.
+func parseResolution(r *http.Request, session *conversation.Session) {
+	if !r.Form.Has("width") || !r.Form.Has("height") {
+		return
+	}
+	widthStr, heightStr := r.FormValue("width"), r.FormValue("height")
+	if widthStr == "" && heightStr == "" {
+		session.SetResolution(0, 0)
+		return
+	}
+
+	width, err := strconv.Atoi(widthStr)
+	if err != nil || width <= 0 {
+		return
+	}
+	height, err := strconv.Atoi(heightStr)
+	if err != nil || height <= 0 {
+		return
+	}
+	session.SetResolution(width, height)
+}
@@ -0,0 +1,169 @@
+package web
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/persistence"
+	"github.com/hurricanerix/weave/internal/protocol"
+)
+
+func TestFitResolution(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		wantW, wantH  int
+	}{
+		{name: "fits", width: 512, height: 768, wantW: 512, wantH: 768},
+		{name: "snaps to multiples of 64", width: 500, height: 700, wantW: 512, wantH: 704},
+		{name: "below minimum", width: 10, height: 20, wantW: 64, wantH: 64},
+		{name: "square over budget", width: 1024, height: 1024, wantW: 768, wantH: 768},
+		{name: "keeps aspect ratio", width: 1536, height: 768, wantW: 1024, wantH: 512},
+		{name: "beyond maximum", width: 4096, height: 64, wantW: 2048, wantH: 64},
+		{name: "at the budget", width: 576, height: 1024, wantW: 576, wantH: 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h := fitResolution(tt.width, tt.height, maxGeneratePixels)
+			if w != tt.wantW || h != tt.wantH {
+				t.Errorf("fitResolution(%d, %d) = %dx%d, want %dx%d", tt.width, tt.height, w, h, tt.wantW, tt.wantH)
+			}
+			if w*h > maxGeneratePixels {
+				t.Errorf("fitResolution(%d, %d) = %dx%d, over %d pixels", tt.width, tt.height, w, h, maxGeneratePixels)
+			}
+		})
+	}
+}
+
+func TestFitResolution_VAETiling(t *testing.T) {
+	if w, h := fitResolution(1024, 1024, maxTiledGeneratePixels); w != 1024 || h != 1024 {
+		t.Errorf("fitResolution(1024, 1024) = %dx%d, want 1024x1024", w, h)
+	}
+	if w, h := fitResolution(2048, 2048, maxTiledGeneratePixels); w != 1024 || h != 1024 {
+		t.Errorf("fitResolution(2048, 2048) = %dx%d, want 1024x1024", w, h)
+	}
+}
+
+func TestResolutionClamp(t *testing.T) {
+	tests := []struct {
+		name          string
+		width         int
+		height        int
+		vaeTiling     bool
+		wantClamped   string
+		wantTilingTip bool
+	}{
+		{name: "fits", width: 768, height: 768},
+		{name: "over budget", width: 1024, height: 1024, wantClamped: "768x768", wantTilingTip: true},
+		{name: "fits with tiling", width: 1024, height: 1024, vaeTiling: true},
+		{name: "over budget with tiling", width: 2048, height: 2048, vaeTiling: true, wantClamped: "1024x1024"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, nil)
+			s.vaeTiling = tt.vaeTiling
+			s.sessionManager.GetSession(testGallerySessionID).SetResolution(tt.width, tt.height)
+
+			clamped := s.resolutionClamp(testGallerySessionID)
+			if tt.wantClamped == "" {
+				if len(clamped) != 0 {
+					t.Errorf("resolutionClamp() = %+v, want none", clamped)
+				}
+				return
+			}
+			if len(clamped) != 1 || clamped[0].clamped != tt.wantClamped {
+				t.Fatalf("resolutionClamp() = %+v, want %s", clamped, tt.wantClamped)
+			}
+			if got := strings.Contains(clamped[0].reason, "--vae-tiling"); got != tt.wantTilingTip {
+				t.Errorf("reason %q mentions --vae-tiling = %v, want %v", clamped[0].reason, got, tt.wantTilingTip)
+			}
+		})
+	}
+}
+
+func TestParseResolution(t *testing.T) {
+	tests := []struct {
+		name         string
+		form         url.Values
+		wantW, wantH int
+	}{
+		{name: "sets resolution", form: url.Values{"width": {"512"}, "height": {"768"}}, wantW: 512, wantH: 768},
+		{name: "missing height", form: url.Values{"width": {"512"}}, wantW: 640, wantH: 640},
+		{name: "empty reverts to default", form: url.Values{"width": {""}, "height": {""}}},
+		{name: "not a number", form: url.Values{"width": {"big"}, "height": {"768"}}, wantW: 640, wantH: 640},
+		{name: "zero", form: url.Values{"width": {"0"}, "height": {"768"}}, wantW: 640, wantH: 640},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := conversation.NewSessionManager().GetSession("session-1")
+			session.SetResolution(640, 640)
+
+			req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if err := req.ParseForm(); err != nil {
+				t.Fatalf("ParseForm() error = %v", err)
+			}
+			parseResolution(req, session)
+
+			if w, h := session.Resolution(); w != tt.wantW || h != tt.wantH {
+				t.Errorf("Resolution() = %dx%d, want %dx%d", w, h, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestHandleGenerate_Resolution(t *testing.T) {
+	tests := []struct {
+		name         string
+		form         url.Values
+		vaeTiling    bool
+		wantW, wantH uint32
+	}{
+		{name: "VAE tiling", form: url.Values{"prompt": {"a cat"}}, vaeTiling: true, wantW: 1024, wantH: 1024},
+		{name: "server default fitted", form: url.Values{"prompt": {"a cat"}}, wantW: 768, wantH: 768},
+		{name: "session resolution", form: url.Values{"prompt": {"a cat"}, "width": {"512"}, "height": {"640"}}, wantW: 512, wantH: 640},
+		{name: "snapped", form: url.Values{"prompt": {"a cat"}, "width": {"500"}, "height": {"300"}}, wantW: 512, wantH: 320},
+		{name: "scaled to fit VRAM", form: url.Values{"prompt": {"a cat"}, "width": {"2048"}, "height": {"1024"}}, wantW: 1024, wantH: 512},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make(chan []byte, 1)
+			store := persistence.NewImageStore(t.TempDir())
+			s, err := NewServerWithDeps("", nil, nil, nil, store, recordingComputeConn(t, requests), nil)
+			if err != nil {
+				t.Fatalf("NewServerWithDeps() error = %v", err)
+			}
+			s.vaeTiling = tt.vaeTiling
+
+			req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(setSessionID(req.Context(), testGallerySessionID))
+			w := httptest.NewRecorder()
+			s.handleGenerate(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			msg := <-requests
+			if width, height := binary.BigEndian.Uint32(msg[28:32]), binary.BigEndian.Uint32(msg[32:36]); width != tt.wantW || height != tt.wantH {
+				t.Errorf("sent size = %dx%d, want %dx%d", width, height, tt.wantW, tt.wantH)
+			}
+			wantFlags := uint32(0)
+			if tt.vaeTiling {
+				wantFlags = protocol.FlagVAETiling
+			}
+			if got := binary.BigEndian.Uint32(msg[12:16]); got != wantFlags {
+				t.Errorf("flags = %#x, want %#x", got, wantFlags)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/llm"
+)
+
+// ErrInvalidRestartConfig is returned by a RestartFunc when the new
+// configuration is invalid. The running configuration is kept.
+var ErrInvalidRestartConfig = errors.New("invalid configuration")
+
+// restartFlags are the CLI flags a restart request may override: generation
+// defaults and model tuning. Flags that run commands, send data elsewhere,
+// read files, listen, or change authentication are never overridable, so a
+// caller can't turn a restart into code execution or a way around auth.
+var restartFlags = map[string]bool{
+	"steps":                    true,
+	"cfg":                      true,
+	"width":                    true,
+	"height":                   true,
+	"seed":                     true,
+	"vae-tiling":               true,
+	"generate-timeout":         true,
+	"image-quality":            true,
+	"llm-seed":                 true,
+	"ollama-model":             true,
+	"ollama-keep-alive":        true,
+	"ollama-structured-output": true,
+	"openai-model":             true,
+	"llm-temperature":          true,
+	"llm-top-p":                true,
+	"llm-top-k":                true,
+	"llm-repeat-penalty":       true,
+	"llm-summarize":            true,
+	"llm-fallback-model":       true,
+	"moderation-mode":          true,
+	"moderation-llm":           true,
+}
+
+// RestartFunc re-reads configuration, applying overrides as CLI flags
+// ("--name=value") after the original arguments, reconnects to Ollama and
+// compute, and calls Reconfigure on the server.
+type RestartFunc func(ctx context.Context, overrides []string) error
+
+// SetRestartFunc enables POST /admin/restart. It must be called before the
+// server starts.
+func (s *Server) SetRestartFunc(fn RestartFunc) {
+	s.restart = fn
+}
+
+// Reconfigure switches the server to a new configuration, LLM client and
+// compute connection without closing the HTTP listener.
+//
+// A replacement server is built that shares sessions, image stores, the SSE
+// broker and rate limits with this one, and its routes become active for new
+// requests. Requests already running finish on the old server. Hooks
+// registered through Hooks() are replaced by those from cfg.
+func (s *Server) Reconfigure(llmClient llm.Client, computeClient *client.Conn, cfg *config.Config) error {
+	next := &Server{
+		addr:           s.addr,
+		server:         s.server,
+		broker:         s.broker,
+		llmClient:      llmClient,
+		sessionManager: s.sessionManager,
+		rateLimiter:    s.rateLimiter,
+		imageStorage:   s.imageStorage,
+		imageStore:     s.imageStore,
+		galleryStore:   s.galleryStore,
+		favoriteStore:  s.favoriteStore,
+		tagIndex:       s.tagIndex,
+		vectorStore:    s.vectorStore,
+		promptStore:    s.promptStore,
+		shareTokens:    s.shareTokens,
+		moderationLog:  s.moderationLog,
+		provenance:     s.provenance,
+		computeClient:  computeClient,
+		alternateMu:    s.alternateMu,
+		routes:         s.routes,
+		apiTokens:      s.apiTokens,
+		userAuth:       s.userAuth,
+		csrfKey:        s.csrfKey,
+		csrfDisabled:   s.csrfDisabled,
+		active:         s.active,
+		readiness:      s.readiness,
+		computeCaps:    s.computeCaps,
+		gpus:           s.gpus,
+		mcpConns:       s.mcpConns,
+		chatStreams:    s.chatStreams,
+		generations:    s.generations,
+		restart:        s.restart,
+	}
+	if err := next.configure(cfg); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	next.registerRoutes(mux)
+	s.routes.Store(mux)
+	s.active.Store(next)
+	return nil
+}
+
+// restartOverrides converts the form values of a restart request into CLI
+// flags, sorted by name so restarts are reproducible. Returns an error
+// naming the first field that isn't in restartFlags.
+func restartOverrides(r *http.Request) ([]string, error) {
+	names := make([]string, 0, len(r.PostForm))
+	for name := range r.PostForm {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	overrides := make([]string, 0, len(names))
+	for _, name := range names {
+		if !restartFlags[name] {
+			return nil, fmt.Errorf("%s can't be changed by a restart", name)
+		}
+		overrides = append(overrides, fmt.Sprintf("--%s=%s", name, r.PostForm.Get(name)))
+	}
+	return overrides, nil
+}
+
+// handleRestart re-reads configuration and reconnects to Ollama and compute
+// while keeping sessions and the HTTP listener. Like listing every session,
+// it requires an API token, or a request from this machine if there are no
+// tokens.
+// POST /admin/restart (form: optional overrides of restartFlags, e.g. ollama-model)
+func (s *Server) handleRestart(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !s.canAccessAllSessions(r) {
+		writeJSONError(w, http.StatusForbidden, "restarting requires an API token")
+		return
+	}
+
+	if s.restart == nil {
+		writeJSONError(w, http.StatusNotImplemented, "restart is not available")
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+	overrides, err := restartOverrides(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid configuration: "+err.Error())
+		return
+	}
+
+	log.Printf("Restart requested by session %s", sessionID)
+	if err := s.restart(r.Context(), overrides); err != nil {
+		if errors.Is(err, ErrInvalidRestartConfig) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("Restart failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "restart failed: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status":"ok","session_id":"%s"}`, sessionID)
+}
@@ -0,0 +1,158 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+// postRestart sends POST /admin/restart with a form body as sessionID from
+// remoteAddr.
+func postRestart(s *Server, form, sessionID, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/restart", strings.NewReader(form))
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if sessionID != "" {
+		req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: sessionID})
+		req.Header.Set(CSRFHeaderName, s.csrfToken(sessionID))
+	}
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleRestart(t *testing.T) {
+	tests := []struct {
+		name       string
+		form       string
+		restartErr error
+		noRestart  bool
+		remoteAddr string
+		wantStatus int
+		wantArgs   []string
+	}{
+		{
+			name:       "no overrides",
+			wantStatus: http.StatusOK,
+			wantArgs:   []string{},
+		},
+		{
+			name:       "overrides sorted by name",
+			form:       "steps=30&ollama-model=llama3",
+			wantStatus: http.StatusOK,
+			wantArgs:   []string{"--ollama-model=llama3", "--steps=30"},
+		},
+		{
+			name:       "invalid config",
+			form:       "steps=0",
+			restartErr: ErrInvalidRestartConfig,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "restart failure",
+			restartErr: errors.New("compute did not connect"),
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "help flag rejected",
+			form:       "help=true",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "exec flag rejected",
+			form:       "steps=30&post-save-exec=sh+-c+id",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "auth flag rejected",
+			form:       "disable-csrf=true",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "remote request without a token",
+			remoteAddr: "192.0.2.1:1234",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "not available",
+			noRestart:  true,
+			wantStatus: http.StatusNotImplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, nil)
+			var gotArgs []string
+			if !tt.noRestart {
+				s.SetRestartFunc(func(ctx context.Context, overrides []string) error {
+					gotArgs = overrides
+					return tt.restartErr
+				})
+			}
+
+			remoteAddr := tt.remoteAddr
+			if remoteAddr == "" {
+				remoteAddr = "127.0.0.1:1234"
+			}
+			w := postRestart(s, tt.form, testGallerySessionID, remoteAddr)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK && tt.restartErr == nil && gotArgs != nil {
+				t.Errorf("restart ran with %v, want it refused", gotArgs)
+			}
+			if tt.wantArgs != nil && !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("overrides = %v, want %v", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestReconfigure_KeepsSessions(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	if err := s.Reconfigure(nil, nil, &config.Config{Steps: 12}); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+
+	w := serveAs(s, http.MethodGet, "/history", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("history status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), "a sunset") {
+		t.Errorf("history after reconfigure lost the session message: %s", w.Body.String())
+	}
+	if w := serveAs(s, http.MethodGet, "/prompts", testGallerySessionID); w.Code != http.StatusOK {
+		t.Errorf("prompts status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := serveAs(s, http.MethodPost, "/sessions/"+testGallerySessionID+"/share", testGallerySessionID); w.Code != http.StatusCreated {
+		t.Errorf("share status = %d, want %d", w.Code, http.StatusCreated)
+	}
+}
+
+func TestReconfigure_ReplacesRoutes(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	if w := serveAs(s, http.MethodGet, "/favorites", testGallerySessionID); w.Code != http.StatusOK {
+		t.Fatalf("favorites status before = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if err := s.Reconfigure(nil, nil, &config.Config{GalleryOnly: true}); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+
+	// Gallery-only mode redirects everything else to the gallery
+	if w := serveAs(s, http.MethodGet, "/favorites", testGallerySessionID); w.Code != http.StatusFound {
+		t.Errorf("favorites status after = %d, want %d", w.Code, http.StatusFound)
+	}
+	if w := serveAs(s, http.MethodGet, "/gallery", ""); w.Code != http.StatusOK {
+		t.Errorf("gallery status after = %d, want %d", w.Code, http.StatusOK)
+	}
+}
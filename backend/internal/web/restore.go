@@ -0,0 +1,81 @@
+package web
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// messageRestoreResponse is the response for POST /message/{id}/restore.
+type messageRestoreResponse struct {
+	Status           string  `json:"status"`
+	ChatID           string  `json:"chat_id"`
+	MessageID        int     `json:"message_id"`
+	Prompt           string  `json:"prompt"`
+	Steps            int     `json:"steps"`
+	CFG              float64 `json:"cfg"`
+	Seed             int64   `json:"seed"`
+	SettingsRestored bool    `json:"settings_restored"`
+}
+
+// handleRestoreMessage makes a message's snapshot the live state again: its
+// prompt becomes the current prompt of the chat holding the message, as if
+// the user had typed it, and the steps, CFG and seed of its image become the
+// session's generation settings. Settings are only recorded once an image
+// is generated, so messages without one restore just the prompt. The UI is
+// sent prompt-update and settings-update events if the chat is active.
+// POST /message/{id}/restore
+func (s *Server) handleRestoreMessage(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || messageID <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "invalid message ID")
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	chatID, manager := session.ChatForMessage(messageID)
+	if manager == nil {
+		writeJSONError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	msg := manager.GetMessage(messageID)
+	if msg == nil || msg.Snapshot == nil {
+		writeJSONError(w, http.StatusNotFound, "message has no snapshot")
+		return
+	}
+	snapshot := msg.Snapshot
+
+	// Same as an edit in the prompt box, so the agent learns of the change
+	manager.UpdatePrompt(snapshot.Prompt)
+	manager.NotifyPromptEdited()
+	_ = s.sendChatEvent(sessionID, chatID, EventPromptUpdate, map[string]string{
+		"prompt": snapshot.Prompt,
+	})
+
+	resp := messageRestoreResponse{
+		Status:    "ok",
+		ChatID:    chatID,
+		MessageID: messageID,
+		Prompt:    snapshot.Prompt,
+	}
+	if snapshot.Steps > 0 {
+		steps, cfg, seed, _ := clampGenerationSettings(snapshot.Steps, snapshot.CFG, snapshot.Seed)
+		session.SetGenerationSettings(steps, cfg, seed)
+		_ = s.sendChatEvent(sessionID, chatID, EventSettingsUpdate, map[string]interface{}{
+			"steps": steps,
+			"cfg":   cfg,
+			"seed":  seed,
+		})
+		resp.Steps, resp.CFG, resp.Seed = steps, cfg, seed
+		resp.SettingsRestored = true
+	}
+
+	log.Printf("Restored message %d of session %s (settings: %v)", messageID, sessionID, resp.SettingsRestored)
+	writeChatJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+func TestGenerateImage_RecordsSettings(t *testing.T) {
+	s, err := NewServerWithDeps("", nil, nil, nil, persistence.NewImageStore(t.TempDir()), generatingComputeConn(t), nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	session := s.sessionManager.GetSession(testGallerySessionID)
+	chatID, manager := session.ActiveChat()
+	msgID := manager.AddAssistantMessage("Here you go", "a cat", &ollama.LLMMetadata{Prompt: "a cat"})
+
+	if err := s.generateImage(context.Background(), testGallerySessionID, chatID, "a cat", 4, 1.5, 42, msgID); err != nil {
+		t.Fatalf("generateImage() error = %v", err)
+	}
+
+	snapshot := manager.GetMessage(msgID).Snapshot
+	if snapshot.Steps != 4 || snapshot.CFG != 1.5 || snapshot.Seed != 42 {
+		t.Errorf("snapshot settings = %d, %v, %d, want 4, 1.5, 42", snapshot.Steps, snapshot.CFG, snapshot.Seed)
+	}
+}
+
+func TestHandleRestoreMessage(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	session := s.sessionManager.GetSession(testGallerySessionID)
+	manager := session.Manager()
+
+	generatedID := manager.AddAssistantMessage("Here's a cat", "a cat, watercolor", &ollama.LLMMetadata{Prompt: "a cat, watercolor"})
+	manager.SetMessageSettings(generatedID, 30, 7.5, 42)
+	promptOnlyID := manager.AddAssistantMessage("Here's a dog", "a dog", &ollama.LLMMetadata{Prompt: "a dog"})
+	userID := manager.AddUserMessage("now a bird")
+	manager.UpdatePrompt("a bird")
+	session.SetGenerationSettings(4, 1, -1)
+
+	w := serveAs(s, http.MethodPost, "/message/"+strconv.Itoa(generatedID)+"/restore", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST restore status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp messageRestoreResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !resp.SettingsRestored || resp.Prompt != "a cat, watercolor" || resp.Steps != 30 || resp.CFG != 7.5 || resp.Seed != 42 {
+		t.Errorf("POST restore = %+v, want the snapshot's prompt and settings", resp)
+	}
+	if got := manager.GetCurrentPrompt(); got != "a cat, watercolor" {
+		t.Errorf("current prompt = %q, want the restored prompt", got)
+	}
+	if steps, cfg, seed, _ := session.GetGenerationSettings(); steps != 30 || cfg != 7.5 || seed != 42 {
+		t.Errorf("generation settings = %d, %v, %d, want 30, 7.5, 42", steps, cfg, seed)
+	}
+	messages := manager.GetMessages()
+	if last := messages[len(messages)-1]; last.Content != `[user edited prompt to: "a cat, watercolor"]` {
+		t.Errorf("last message = %q, want the agent told of the edit", last.Content)
+	}
+
+	// Without a generated image only the prompt is restored
+	w = serveAs(s, http.MethodPost, "/message/"+strconv.Itoa(promptOnlyID)+"/restore", testGallerySessionID)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.SettingsRestored || manager.GetCurrentPrompt() != "a dog" {
+		t.Errorf("POST restore without settings = %+v, prompt %q, want only the prompt restored", resp, manager.GetCurrentPrompt())
+	}
+	if steps, _, _, _ := session.GetGenerationSettings(); steps != 30 {
+		t.Errorf("steps = %d, want the settings left alone", steps)
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+	}{
+		{"no snapshot", strconv.Itoa(userID), http.StatusNotFound},
+		{"unknown message", "999", http.StatusNotFound},
+		{"invalid ID", "abc", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveAs(s, http.MethodPost, "/message/"+tt.id+"/restore", testGallerySessionID); w.Code != tt.wantStatus {
+				t.Errorf("POST restore status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// samplingResponse is the response for GET and POST /settings/sampling.
+// Sampling is what the session's chats send: the session's overrides on
+// top of the server's defaults. Parameters missing from both are left to
+// the model.
+type samplingResponse struct {
+	Status   string          `json:"status"`
+	Default  ollama.Sampling `json:"default"`
+	Sampling ollama.Sampling `json:"sampling"`
+}
+
+// handleGetSampling reports the sampling parameters for the session's chats.
+// GET /settings/sampling
+func (s *Server) handleGetSampling(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	writeChatJSON(w, http.StatusOK, s.samplingResponse(session.Sampling()))
+}
+
+// handleSetSampling sets the session's sampling parameters. Each form field
+// overrides the server's default; an empty or missing field reverts to it.
+// POST /settings/sampling (form: temperature, top_p, top_k, repeat_penalty)
+func (s *Server) handleSetSampling(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	var sampling ollama.Sampling
+	var err error
+	if sampling.Temperature, err = parseOptionalFloat(r.FormValue("temperature")); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "temperature must be a number")
+		return
+	}
+	if sampling.TopP, err = parseOptionalFloat(r.FormValue("top_p")); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "top_p must be a number")
+		return
+	}
+	if v := r.FormValue("top_k"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "top_k must be an integer")
+			return
+		}
+		sampling.TopK = &n
+	}
+	if sampling.RepeatPenalty, err = parseOptionalFloat(r.FormValue("repeat_penalty")); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "repeat_penalty must be a number")
+		return
+	}
+	if err := sampling.Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.sessionManager.GetSession(sessionID).SetSampling(sampling)
+	log.Printf("Session %s changed sampling parameters", sessionID)
+	writeChatJSON(w, http.StatusOK, s.samplingResponse(sampling))
+}
+
+// samplingResponse builds the response for a session with the given
+// overrides.
+func (s *Server) samplingResponse(override ollama.Sampling) samplingResponse {
+	return samplingResponse{
+		Status:   "ok",
+		Default:  s.defaultSampling,
+		Sampling: s.defaultSampling.Merge(override),
+	}
+}
+
+// parseOptionalFloat parses a float form value; "" yields nil.
+func parseOptionalFloat(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// llmSeed returns the LLM seed for a session's chats: its own, or the
+// server's default. 0 means a random seed.
+func (s *Server) llmSeed(session *conversation.Session) int64 {
+	if seed := session.LLMSeed(); seed != nil {
+		return *seed
+	}
+	return s.defaultLLMSeed
+}
+
+// chatSeed returns the seed to send with a session's chat requests, or nil
+// to let the model pick a random one.
+func (s *Server) chatSeed(session *conversation.Session) *int64 {
+	seed := s.llmSeed(session)
+	if seed == 0 {
+		return nil
+	}
+	return &seed
+}
+
+// parseLLMSeed parses an llm_seed form value; "" yields nil, the server's
+// default. Like --llm-seed, it must not be negative.
+func parseLLMSeed(value string) (*int64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	seed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if seed < 0 {
+		return nil, fmt.Errorf("llm seed %d is negative", seed)
+	}
+	return &seed, nil
+}
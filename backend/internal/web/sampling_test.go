@@ -0,0 +1,211 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// postSampling posts sampling parameters to /settings/sampling as the test
+// session.
+func postSampling(s *Server, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/settings/sampling", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+	req.Header.Set(CSRFHeaderName, s.csrfToken(testGallerySessionID))
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+// samplingRecordingClient records the sampling parameters each chat sends.
+type samplingRecordingClient struct {
+	mockOllamaClient
+	got []ollama.Sampling
+}
+
+func (c *samplingRecordingClient) Chat(ctx context.Context, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error) {
+	c.got = append(c.got, ollama.SamplingFromContext(ctx))
+	return c.mockOllamaClient.Chat(ctx, messages, seed, tools, callback)
+}
+
+func newSamplingTestServer(t *testing.T) *Server {
+	t.Helper()
+	cfg, err := config.Parse([]string{"--llm-temperature", "0.7", "--llm-top-k", "40"}, &strings.Builder{})
+	if err != nil {
+		t.Fatalf("config.Parse() error = %v", err)
+	}
+	cfg.AgentPromptPath = ""
+	return newGalleryTestServer(t, cfg)
+}
+
+func TestHandleSampling(t *testing.T) {
+	s := newSamplingTestServer(t)
+
+	w := serveAs(s, http.MethodGet, "/settings/sampling", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got, want := strings.TrimSpace(w.Body.String()), `{"status":"ok","default":{"temperature":0.7,"top_k":40},"sampling":{"temperature":0.7,"top_k":40}}`; got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+
+	// Overrides replace the defaults; empty fields keep them
+	w = postSampling(s, url.Values{"temperature": {"1.2"}, "top_p": {"0.9"}, "top_k": {""}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("set status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp samplingResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	got := resp.Sampling
+	if got.Temperature == nil || *got.Temperature != 1.2 || got.TopP == nil || *got.TopP != 0.9 || got.TopK == nil || *got.TopK != 40 {
+		t.Errorf("sampling = %s, want temperature 1.2, top_p 0.9, top_k 40", w.Body.String())
+	}
+
+	// The overrides are kept for the session only
+	w = serveAs(s, http.MethodGet, "/settings/sampling", "other-session")
+	var other samplingResponse
+	json.Unmarshal(w.Body.Bytes(), &other)
+	if other.Sampling.TopP != nil {
+		t.Errorf("other session top_p = %v, want unset", *other.Sampling.TopP)
+	}
+}
+
+func TestHandleSetSampling_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		form url.Values
+	}{
+		{"not a number", url.Values{"temperature": {"warm"}}},
+		{"temperature out of range", url.Values{"temperature": {"3"}}},
+		{"top_p out of range", url.Values{"top_p": {"-0.1"}}},
+		{"top_k not an integer", url.Values{"top_k": {"4.5"}}},
+		{"top_k out of range", url.Values{"top_k": {"0"}}},
+		{"repeat_penalty out of range", url.Values{"repeat_penalty": {"2.5"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSamplingTestServer(t)
+			if w := postSampling(s, tt.form); w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			if got := s.sessionManager.GetSession(testGallerySessionID).Sampling(); !got.IsZero() {
+				t.Errorf("session sampling = %+v, want unchanged", got)
+			}
+		})
+	}
+}
+
+func TestRunChatTurn_Sampling(t *testing.T) {
+	s := newSamplingTestServer(t)
+	client := &samplingRecordingClient{mockOllamaClient: mockOllamaClient{response: "ok"}}
+	s.setLLMClientForTesting(client)
+
+	session := s.sessionManager.GetSession(testGallerySessionID)
+	topP := 0.5
+	session.SetSampling(ollama.Sampling{TopP: &topP})
+
+	s.runChatTurn(context.Background(), session, testGallerySessionID, "", session.Manager(), "a cat", 20, 3.5, -1)
+
+	if len(client.got) == 0 {
+		t.Fatal("Chat() was not called")
+	}
+	got := client.got[0]
+	if got.Temperature == nil || *got.Temperature != 0.7 || got.TopK == nil || *got.TopK != 40 || got.TopP == nil || *got.TopP != topP {
+		t.Errorf("chat sampling = %+v, want defaults with top_p %v", got, topP)
+	}
+}
+
+func int64Ptr(v int64) *int64 { return &v }
+
+// seedRecordingClient records the seed each chat sends.
+type seedRecordingClient struct {
+	mockOllamaClient
+	got []*int64
+}
+
+func (c *seedRecordingClient) Chat(ctx context.Context, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error) {
+	c.got = append(c.got, seed)
+	return c.mockOllamaClient.Chat(ctx, messages, seed, tools, callback)
+}
+
+func TestRunChatTurn_LLMSeed(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultSeed int64
+		sessionSeed *int64
+		want        *int64
+	}{
+		{name: "random by default", want: nil},
+		{name: "server default", defaultSeed: 42, want: int64Ptr(42)},
+		{name: "session seed", defaultSeed: 42, sessionSeed: int64Ptr(7), want: int64Ptr(7)},
+		{name: "session asks for random", defaultSeed: 42, sessionSeed: int64Ptr(0), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSamplingTestServer(t)
+			s.defaultLLMSeed = tt.defaultSeed
+			client := &seedRecordingClient{mockOllamaClient: mockOllamaClient{response: "ok"}}
+			s.setLLMClientForTesting(client)
+
+			session := s.sessionManager.GetSession(testGallerySessionID)
+			session.SetLLMSeed(tt.sessionSeed)
+
+			s.runChatTurn(context.Background(), session, testGallerySessionID, "", session.Manager(), "a cat", 20, 3.5, -1)
+
+			if len(client.got) == 0 {
+				t.Fatal("Chat() was not called")
+			}
+			got := client.got[0]
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("chat seed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleChat_LLMSeed(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantSeed   *int64
+	}{
+		{name: "sets session seed", query: "&llm_seed=123", wantStatus: http.StatusOK, wantSeed: int64Ptr(123)},
+		{name: "empty reverts to default", query: "&llm_seed=", wantStatus: http.StatusOK},
+		{name: "missing leaves session alone", query: "", wantStatus: http.StatusOK, wantSeed: int64Ptr(5)},
+		{name: "negative", query: "&llm_seed=-1", wantStatus: http.StatusBadRequest, wantSeed: int64Ptr(5)},
+		{name: "not a number", query: "&llm_seed=abc", wantStatus: http.StatusBadRequest, wantSeed: int64Ptr(5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSamplingTestServer(t)
+			s.setLLMClientForTesting(&mockOllamaClient{responses: []mockResponse{{result: ollama.ChatResult{Response: "ok"}}}})
+			session := s.sessionManager.GetSession(testGallerySessionID)
+			start := int64(5)
+			session.SetLLMSeed(&start)
+
+			w := serveAs(s, http.MethodPost, "/chat?message=a+cat"+tt.query, testGallerySessionID)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			got := session.LLMSeed()
+			if (got == nil) != (tt.wantSeed == nil) || (got != nil && *got != *tt.wantSeed) {
+				t.Errorf("session LLMSeed() = %v, want %v", got, tt.wantSeed)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/llm"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// maxEmbedPerSearch limits how many prompts and replies one search embeds,
+// so the first search of a long session doesn't stall. Texts left over are
+// embedded by the following searches.
+const maxEmbedPerSearch = 100
+
+// semanticResultItem is one match in the GET /search/semantic response.
+// URL is set when the message's image is stored.
+type semanticResultItem struct {
+	MessageID int     `json:"message_id"`
+	ChatID    string  `json:"chat_id"`
+	Kind      string  `json:"kind"`
+	Text      string  `json:"text"`
+	Score     float64 `json:"score"`
+	URL       string  `json:"url,omitempty"`
+}
+
+// semanticSearchResponse is the response for GET /search/semantic.
+type semanticSearchResponse struct {
+	Status    string               `json:"status"`
+	SessionID string               `json:"session_id"`
+	Query     string               `json:"query"`
+	Results   []semanticResultItem `json:"results"`
+	Page      pageInfo             `json:"page"`
+}
+
+// semanticText is a prompt or reply of the session that can be searched.
+type semanticText struct {
+	chatID    string
+	text      string
+	createdAt time.Time
+}
+
+// handleSemanticSearch finds the session's prompts and assistant replies
+// closest in meaning to a description, best match first. Texts are embedded
+// with --embedding-model the first time they are searched.
+// GET /search/semantic?q=
+func (s *Server) handleSemanticSearch(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	embedder, ok := s.llmClient.(llm.Embedder)
+	if !ok || s.embeddingModel == "" {
+		writeJSONError(w, http.StatusNotImplemented, "semantic search is not enabled (see --embedding-model)")
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" || len(query) > maxSearchQueryLength {
+		http.Error(w, "Invalid search query", http.StatusBadRequest)
+		return
+	}
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	texts := s.semanticTexts(sessionID)
+	if err := s.indexTexts(r.Context(), sessionID, embedder, texts); err != nil {
+		log.Printf("Failed to index session %s for semantic search: %v", sessionID, err)
+		writeEmbeddingError(w, err)
+		return
+	}
+
+	vector, err := embedder.Embed(r.Context(), s.embeddingModel, query)
+	if err != nil {
+		log.Printf("Failed to embed search query for session %s: %v", sessionID, err)
+		writeEmbeddingError(w, err)
+		return
+	}
+
+	matches, err := s.vectorStore.Search(sessionID, s.embeddingModel, vector, 0)
+	if err != nil {
+		log.Printf("Failed to search embeddings for session %s: %v", sessionID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]semanticResultItem, 0, len(matches))
+	for _, match := range matches {
+		// Embeddings outlive messages that were rewound or deleted
+		text, ok := texts[match.EmbeddingKey]
+		if !ok {
+			continue
+		}
+		hasImage := s.imageStore.Exists(sessionID, match.MessageID)
+		if !q.matchesTime(text.createdAt) || !q.matchesImage(hasImage) {
+			continue
+		}
+		item := semanticResultItem{
+			MessageID: match.MessageID,
+			ChatID:    text.chatID,
+			Kind:      match.Kind,
+			Text:      text.text,
+			Score:     match.Score,
+		}
+		if hasImage {
+			item.URL = s.imageStore.GetURL(sessionID, match.MessageID)
+		}
+		results = append(results, item)
+	}
+
+	start, end, page := q.page(len(results))
+	writeTagsJSON(w, semanticSearchResponse{
+		Status:    "ok",
+		SessionID: sessionID,
+		Query:     query,
+		Results:   results[start:end],
+		Page:      page,
+	})
+}
+
+// semanticTexts returns the prompts and assistant replies in every chat of
+// the session.
+func (s *Server) semanticTexts(sessionID string) map[persistence.EmbeddingKey]semanticText {
+	texts := make(map[persistence.EmbeddingKey]semanticText)
+	session := s.sessionManager.GetSession(sessionID)
+	for _, info := range session.Chats() {
+		manager := session.ChatManager(info.ID)
+		if manager == nil {
+			continue
+		}
+		for _, msg := range manager.GetMessages() {
+			if msg.Role != conversation.RoleAssistant {
+				continue
+			}
+			if content := strings.TrimSpace(msg.Content); content != "" {
+				key := persistence.EmbeddingKey{MessageID: msg.ID, Kind: persistence.EmbeddingReply}
+				texts[key] = semanticText{chatID: info.ID, text: content, createdAt: msg.CreatedAt}
+			}
+			if msg.Snapshot != nil && strings.TrimSpace(msg.Snapshot.Prompt) != "" {
+				key := persistence.EmbeddingKey{MessageID: msg.ID, Kind: persistence.EmbeddingPrompt}
+				texts[key] = semanticText{chatID: info.ID, text: msg.Snapshot.Prompt, createdAt: msg.CreatedAt}
+			}
+		}
+	}
+	return texts
+}
+
+// indexTexts embeds up to maxEmbedPerSearch texts that have no embedding
+// yet, newest first. Embeddings computed before an error are kept.
+func (s *Server) indexTexts(ctx context.Context, sessionID string, embedder llm.Embedder, texts map[persistence.EmbeddingKey]semanticText) error {
+	indexed, err := s.vectorStore.Keys(sessionID, s.embeddingModel)
+	if err != nil {
+		return err
+	}
+
+	var missing []persistence.EmbeddingKey
+	for key := range texts {
+		if !indexed[key] {
+			missing = append(missing, key)
+		}
+	}
+	slices.SortFunc(missing, func(a, b persistence.EmbeddingKey) int {
+		if a.MessageID != b.MessageID {
+			return b.MessageID - a.MessageID
+		}
+		return strings.Compare(a.Kind, b.Kind)
+	})
+	if len(missing) > maxEmbedPerSearch {
+		missing = missing[:maxEmbedPerSearch]
+	}
+
+	embeddings := make([]persistence.Embedding, 0, len(missing))
+	var embedErr error
+	for _, key := range missing {
+		vector, err := embedder.Embed(ctx, s.embeddingModel, texts[key].text)
+		if err != nil {
+			embedErr = err
+			break
+		}
+		embeddings = append(embeddings, persistence.Embedding{EmbeddingKey: key, Vector: vector})
+	}
+
+	if len(embeddings) > 0 {
+		if err := s.vectorStore.Add(sessionID, s.embeddingModel, embeddings); err != nil {
+			return err
+		}
+	}
+	return embedErr
+}
+
+// writeEmbeddingError writes the response for a failed semantic search.
+func writeEmbeddingError(w http.ResponseWriter, err error) {
+	switch {
+	case isTransientLLMError(err):
+		writeJSONError(w, http.StatusServiceUnavailable, "ollama is not reachable")
+	case errors.Is(err, ollama.ErrModelNotFound):
+		writeJSONError(w, http.StatusBadGateway, "embedding model not available in ollama")
+	default:
+		writeJSONError(w, http.StatusInternalServerError, "semantic search failed")
+	}
+}
@@ -0,0 +1,133 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// embeddingClient embeds text as counts of a few words, so texts sharing
+// words are similar.
+type embeddingClient struct {
+	mockOllamaClient
+	embedded []string
+	err      error
+}
+
+var embeddingWords = []string{"cat", "dog", "snow", "beach"}
+
+func (c *embeddingClient) Embed(ctx context.Context, model, text string) ([]float32, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.embedded = append(c.embedded, text)
+	vector := make([]float32, len(embeddingWords))
+	for i, word := range embeddingWords {
+		vector[i] = float32(strings.Count(strings.ToLower(text), word))
+	}
+	return vector, nil
+}
+
+// newSemanticTestServer returns a server whose session has a sunset image
+// (message 1) and a cat in the snow reply without an image.
+func newSemanticTestServer(t *testing.T, client *embeddingClient) *Server {
+	t.Helper()
+	s := newGalleryTestServer(t, nil)
+	s.setLLMClientForTesting(client)
+	s.embeddingModel = "nomic-embed-text"
+
+	manager := s.sessionManager.GetSession(testGallerySessionID).Manager()
+	manager.AddUserMessage("something with my cat")
+	manager.AddAssistantMessage("How about a cat playing in the snow?", "", nil)
+	return s
+}
+
+func semanticSearch(t *testing.T, s *Server, query string) semanticSearchResponse {
+	t.Helper()
+
+	w := serveAs(s, http.MethodGet, "/search/semantic?q="+url.QueryEscape(query), testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp semanticSearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("search response is not JSON: %v", err)
+	}
+	return resp
+}
+
+func TestSemanticSearch(t *testing.T) {
+	client := &embeddingClient{}
+	s := newSemanticTestServer(t, client)
+
+	resp := semanticSearch(t, s, "kitten in snow")
+	if len(resp.Results) != 3 {
+		t.Fatalf("results = %+v, want the sunset prompt and reply and the cat reply", resp.Results)
+	}
+	best := resp.Results[0]
+	if best.MessageID != 3 || best.Kind != persistence.EmbeddingReply || best.URL != "" {
+		t.Errorf("best match = %+v, want the cat reply, message 3, without an image", best)
+	}
+	if best.ChatID == "" || !strings.Contains(best.Text, "snow") || best.Score <= resp.Results[1].Score {
+		t.Errorf("best match = %+v, want its chat, text and the highest score", best)
+	}
+	for _, result := range resp.Results[1:] {
+		if result.MessageID != 1 || result.URL == "" {
+			t.Errorf("result = %+v, want the sunset message with its image", result)
+		}
+	}
+
+	// Later searches only embed the query
+	before := len(client.embedded)
+	semanticSearch(t, s, "cat")
+	if n := len(client.embedded) - before; n != 1 {
+		t.Errorf("second search embedded %d texts, want only the query", n)
+	}
+}
+
+func TestSemanticSearch_DeletedMessageDropped(t *testing.T) {
+	s := newSemanticTestServer(t, &embeddingClient{})
+	semanticSearch(t, s, "cat")
+
+	manager := s.sessionManager.GetSession(testGallerySessionID).Manager()
+	if err := manager.RewindTo(2); err != nil {
+		t.Fatalf("RewindTo() error = %v", err)
+	}
+	for _, result := range semanticSearch(t, s, "cat").Results {
+		if result.MessageID != 1 {
+			t.Errorf("result = %+v, want only messages still in the chat", result)
+		}
+	}
+}
+
+func TestSemanticSearch_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(s *Server)
+		query  string
+		status int
+	}{
+		{"disabled", func(s *Server) { s.embeddingModel = "" }, "cat", http.StatusNotImplemented},
+		{"backend without embeddings", func(s *Server) { s.setLLMClientForTesting(&mockOllamaClient{}) }, "cat", http.StatusNotImplemented},
+		{"ollama down", func(s *Server) { s.llmClient.(*embeddingClient).err = ollama.ErrNotRunning }, "cat", http.StatusServiceUnavailable},
+		{"model not pulled", func(s *Server) { s.llmClient.(*embeddingClient).err = ollama.ErrModelNotFound }, "cat", http.StatusBadGateway},
+		{"empty query", func(s *Server) {}, "%20", http.StatusBadRequest},
+		{"query too long", func(s *Server) {}, strings.Repeat("a", maxSearchQueryLength+1), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSemanticTestServer(t, &embeddingClient{})
+			tt.setup(s)
+			if w := serveAs(s, http.MethodGet, "/search/semantic?q="+tt.query, testGallerySessionID); w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
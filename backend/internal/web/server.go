@@ -1,17 +1,25 @@
 package web
 
 import (
+	"bytes"
 	"context"
 	"embed"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unicode/utf8"
@@ -19,19 +27,25 @@ import (
 	"github.com/hurricanerix/weave/internal/client"
 	"github.com/hurricanerix/weave/internal/config"
 	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/hooks"
 	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/llm"
+	"github.com/hurricanerix/weave/internal/moderation"
 	"github.com/hurricanerix/weave/internal/ollama"
 	"github.com/hurricanerix/weave/internal/persistence"
 	"github.com/hurricanerix/weave/internal/protocol"
+	"github.com/hurricanerix/weave/internal/provenance"
+	"github.com/hurricanerix/weave/internal/requestid"
+	"github.com/hurricanerix/weave/internal/tools"
 )
 
 //go:embed templates/* static/*
 var embeddedFS embed.FS
 
-const (
-	// DefaultAddr is the default address the server listens on.
-	DefaultAddr = "localhost:8080"
+// DefaultAddr is the default address the server listens on.
+var DefaultAddr = config.DefaultAddr
 
+const (
 	// ReadTimeout is the maximum duration for reading the entire request.
 	ReadTimeout = 15 * time.Second
 
@@ -54,12 +68,6 @@ const (
 	MaxPromptLength = 50 * 1024
 )
 
-// ollamaClient is an interface for ollama client operations.
-// This allows for mocking in tests.
-type ollamaClient interface {
-	Chat(ctx context.Context, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error)
-}
-
 // Server provides HTTP serving for the web UI.
 // It handles routes for the index page, SSE events, and API endpoints.
 type Server struct {
@@ -68,8 +76,22 @@ type Server struct {
 	broker    *Broker
 	templates *template.Template
 
+	// assets holds templates/ and static/: embeddedFS, or the --dev-dir
+	// directory with templates re-parsed on every request in --dev mode
+	assets          fs.FS
+	reloadTemplates bool
+
+	// Shutdown state; see shutdown.go
+	intakeMu      sync.Mutex
+	intakeStopped bool
+	inflight      sync.WaitGroup
+	stopOnce      sync.Once
+	closeOnce     sync.Once
+	httpStopped   chan error
+	httpErr       error
+
 	// Dependencies for chat functionality
-	ollamaClient   ollamaClient
+	llmClient      llm.Client
 	sessionManager *conversation.SessionManager
 	rateLimiter    *rateLimiter
 
@@ -79,9 +101,43 @@ type Server struct {
 	// Image store for session-specific persistent images
 	imageStore *persistence.ImageStore
 
+	// Gallery index of published images
+	galleryStore *persistence.GalleryStore
+	galleryOnly  bool
+
+	// Starred session images
+	favoriteStore *persistence.FavoriteStore
+
+	// Named prompts saved for reuse
+	promptStore *persistence.PromptStore
+
+	// User tags on session images, indexed for search
+	tagIndex *persistence.TagIndex
+
+	// Embeddings of session prompts and replies for semantic search
+	vectorStore *persistence.VectorStore
+
+	// Audit of each session's prompts flagged by moderation
+	moderationLog *persistence.ModerationLog
+
+	// Watermark drawn on served gallery images (nil if disabled)
+	watermark *image.WatermarkCache
+
+	// Signs provenance manifests into exported and published images
+	provenance *provenance.Signer
+
+	// Issues and checks the tokens of read-only share links
+	shareTokens *shareTokens
+
 	// Compute client for image generation (persistent connection)
 	computeClient *client.Conn
 
+	// Plugin hooks fired during the generation lifecycle
+	hooks *hooks.Registry
+
+	// Tools the agent can call besides update_generation
+	agentTools *tools.Registry
+
 	// Default generation settings from CLI flags
 	defaultSteps  int
 	defaultCFG    float64
@@ -89,11 +145,129 @@ type Server struct {
 	defaultWidth  int
 	defaultHeight int
 
-	// Agent prompt loaded from file
-	agentPrompt string
+	// Default LLM sampling parameters from CLI flags; sessions may
+	// override them
+	defaultSampling ollama.Sampling
+
+	// Default LLM seed from --llm-seed (0 = random); sessions may override it
+	defaultLLMSeed int64
+
+	// Model to retry with when replies keep failing ("" = none)
+	fallbackModel string
+
+	// Directory LLM chats are captured to (--capture-llm; "" = off)
+	llmCaptureDir string
+
+	// Summarize conversation history left out of the LLM context with the
+	// LLM itself (--llm-summarize)
+	llmSummarize bool
+
+	// Ollama model embedding texts for semantic search (--embedding-model;
+	// "" = disabled)
+	embeddingModel string
+
+	// Directory of LoRA files the agent may apply (--lora-dir; "" = none)
+	loraDir string
+
+	// VAE-decode generations in tiles so up to 1024x1024 fits in VRAM
+	// (--vae-tiling)
+	vaeTiling bool
+
+	// How long a 20-step 1024x1024 generation may take; larger ones get
+	// longer (--generate-timeout, see timeout.go)
+	generateTimeout time.Duration
+
+	// Quality of images served or stored as JPEG or WebP (--image-quality,
+	// see imageformat.go)
+	imageQuality int
+
+	// Whether images are refused rather than evicted once config/sessions
+	// reaches --sessions-max-mb (--sessions-full, see quota.go)
+	storageRefuses bool
+
+	// GPUs the compute workers generate on, one per worker (--gpu)
+	computeGPUs []int
+
+	// Checks image prompts before generation (nil = moderation disabled),
+	// and what happens to the prompts it flags
+	moderator      moderation.Moderator
+	moderationMode moderation.Mode
 
-	// Request ID counter for compute process requests
+	// promptMu guards agentPrompt, personas and agentPromptStamp, which
+	// are reloaded when the prompt files change (see watchAgentPrompt)
+	promptMu sync.RWMutex
+	// Agent prompt of the default persona
+	agentPrompt string
+	// Personas users can choose from, default first (--agent-prompt)
+	personas []config.Persona
+	// agentPromptPath is the prompt file or directory, "" if none
+	agentPromptPath string
+	// agentPromptStamp identifies the version of the prompt files loaded
+	agentPromptStamp string
+
+	// Request ID counter for compute process requests made outside an HTTP
+	// request (frame IDs are otherwise derived from the request ID)
 	requestID uint64
+
+	// alternateMu serializes numbering and saving of regenerated alternates.
+	// Shared with servers created by Reconfigure.
+	alternateMu *sync.Mutex
+
+	// routes holds the active route mux. Reconfigure swaps in the routes of
+	// a replacement server while the listener keeps running; see restart.go
+	routes *atomic.Pointer[http.ServeMux]
+
+	// apiTokens holds the accepted API tokens (nil if authentication is
+	// disabled). Shared with servers created by Reconfigure so a restart
+	// reloads them; see auth.go
+	apiTokens *atomic.Pointer[apiTokens]
+
+	// userAuth holds the source of user identity (nil if sessions are
+	// anonymous), shared like apiTokens; see users.go
+	userAuth *atomic.Pointer[userAuth]
+
+	// Key for deriving CSRF tokens, and whether checking them is disabled.
+	// Shared with servers created by Reconfigure; see csrf.go
+	csrfKey      []byte
+	csrfDisabled *atomic.Bool
+
+	// active is the server currently handling requests, which Reconfigure
+	// replaces. Long-lived callers such as ServeMCP use it to reach the
+	// current configuration.
+	active *atomic.Pointer[Server]
+
+	// computeCaps is what the compute process reported it can do when it
+	// connected (nil if unknown), shared with servers created by
+	// Reconfigure; see capabilities.go
+	computeCaps *atomic.Pointer[protocol.Capabilities]
+
+	// gpus are the GPUs compute detected (nil if unknown), shared with
+	// servers created by Reconfigure; see system.go
+	gpus *atomic.Pointer[[]GPU]
+
+	// readiness is what GET /ready reports while the server isn't ready,
+	// such as during a model pull (nil once ready). Shared with servers
+	// created by Reconfigure; see readiness.go
+	readiness *atomic.Pointer[Readiness]
+
+	// MCP clients connected over HTTP, shared with servers created by
+	// Reconfigure, and whether the HTTP transport is enabled; see mcp.go
+	mcpConns *mcpConnections
+	mcpSSE   bool
+
+	// chatStreams lets POST /chat/cancel stop chat responses being
+	// streamed, shared with servers created by Reconfigure; see
+	// chatcancel.go
+	chatStreams *chatStreams
+
+	// generations queues generations for compute by priority and fairly
+	// across sessions, shared with servers created by Reconfigure; see
+	// queue.go
+	generations *generationQueue
+
+	// restart re-reads configuration and reconnects dependencies (nil if
+	// restarting is not supported)
+	restart RestartFunc
 }
 
 // indexTemplateData holds data passed to the index.html template.
@@ -104,6 +278,12 @@ type indexTemplateData struct {
 	Seed   int64
 	Width  int
 	Height int
+
+	// LLMSeed is the session's LLM seed, 0 for random
+	LLMSeed int64
+
+	// CSRFToken is sent with the page's form requests ("" if disabled)
+	CSRFToken string
 }
 
 // NewServer creates a new Server listening on the given address.
@@ -118,21 +298,21 @@ func NewServer(addr string) (*Server, error) {
 
 // NewServerWithDeps creates a new Server with injected dependencies.
 // If addr is empty, DefaultAddr is used.
-// If ollamaClient is nil, a default client is created.
+// If llmClient is nil, a default ollama client is created.
 // If sessionManager is nil, a default session manager is created.
 // If imageStorage is nil, a default image storage is created.
 // If imageStore is nil, a default image store is created.
 // If computeClient is nil, generation requests will fail (for testing only).
 // If cfg is nil, default generation settings are used (steps=20, cfg=3.5, seed=0).
 // Returns an error if templates cannot be parsed or agent prompt file cannot be loaded.
-func NewServerWithDeps(addr string, ollamaClient ollamaClient, sessionManager *conversation.SessionManager, imageStorage *image.Storage, imageStore *persistence.ImageStore, computeClient *client.Conn, cfg *config.Config) (*Server, error) {
+func NewServerWithDeps(addr string, llmClient llm.Client, sessionManager *conversation.SessionManager, imageStorage *image.Storage, imageStore *persistence.ImageStore, computeClient *client.Conn, cfg *config.Config) (*Server, error) {
 	if addr == "" {
 		addr = DefaultAddr
 	}
 
 	// Use provided dependencies or create defaults
-	if ollamaClient == nil {
-		ollamaClient = ollama.NewClient()
+	if llmClient == nil {
+		llmClient = ollama.NewClient()
 	}
 	if sessionManager == nil {
 		sessionManager = conversation.NewSessionManager()
@@ -144,62 +324,57 @@ func NewServerWithDeps(addr string, ollamaClient ollamaClient, sessionManager *c
 		imageStore = persistence.NewImageStore("config/sessions")
 	}
 
-	// Extract default generation settings from config
-	defaultSteps := 20
-	defaultCFG := 3.5
-	defaultSeed := int64(0)
-	defaultWidth := 1024
-	defaultHeight := 1024
-	var agentPromptPath string
-	if cfg != nil {
-		defaultSteps = cfg.Steps
-		defaultCFG = cfg.CFG
-		defaultSeed = cfg.Seed
-		defaultWidth = cfg.Width
-		defaultHeight = cfg.Height
-		agentPromptPath = cfg.AgentPromptPath
-	}
-
-	// Load agent prompt from file (only if config provided)
-	// When cfg is nil (deprecated NewServer for testing), use empty prompt
-	var agentPrompt string
-	if agentPromptPath != "" {
-		var err error
-		agentPrompt, err = config.LoadAgentPrompt(agentPromptPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load agent prompt: %w", err)
-		}
-	}
-
-	// Parse templates from embedded filesystem
-	tmpl, err := template.ParseFS(embeddedFS, "templates/*.html")
+	csrfKey, err := newCSRFKey()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse templates: %w", err)
+		return nil, err
 	}
 
 	s := &Server{
 		addr:           addr,
 		broker:         NewBroker(),
-		templates:      tmpl,
-		ollamaClient:   ollamaClient,
+		httpStopped:    make(chan error, 1),
+		llmClient:      llmClient,
 		sessionManager: sessionManager,
 		rateLimiter:    newRateLimiter(),
 		imageStorage:   imageStorage,
 		imageStore:     imageStore,
+		galleryStore:   persistence.NewGalleryStore(imageStore.BasePath()),
+		favoriteStore:  persistence.NewFavoriteStore(imageStore.BasePath()),
+		promptStore:    persistence.NewPromptStore(imageStore.BasePath()),
+		tagIndex:       persistence.NewTagIndex(imageStore.BasePath()),
+		vectorStore:    persistence.NewVectorStore(imageStore.BasePath()),
+		moderationLog:  persistence.NewModerationLog(imageStore.BasePath()),
+		provenance:     provenance.NewSigner(filepath.Join(imageStore.BasePath(), provenanceKeyFileName)),
+		shareTokens:    newShareTokens(filepath.Join(imageStore.BasePath(), shareKeyFileName)),
 		computeClient:  computeClient,
-		defaultSteps:   defaultSteps,
-		defaultCFG:     defaultCFG,
-		defaultSeed:    defaultSeed,
-		defaultWidth:   defaultWidth,
-		defaultHeight:  defaultHeight,
-		agentPrompt:    agentPrompt,
-	}
+		alternateMu:    &sync.Mutex{},
+		routes:         &atomic.Pointer[http.ServeMux]{},
+		apiTokens:      &atomic.Pointer[apiTokens]{},
+		userAuth:       &atomic.Pointer[userAuth]{},
+		csrfKey:        csrfKey,
+		csrfDisabled:   &atomic.Bool{},
+		active:         &atomic.Pointer[Server]{},
+		readiness:      &atomic.Pointer[Readiness]{},
+		computeCaps:    &atomic.Pointer[protocol.Capabilities]{},
+		gpus:           &atomic.Pointer[[]GPU]{},
+		mcpConns:       newMCPConnections(),
+		chatStreams:    newChatStreams(),
+		generations:    newGenerationQueue(),
+	}
+	if err := s.configure(cfg); err != nil {
+		return nil, err
+	}
+	s.active.Store(s)
 
 	mux := http.NewServeMux()
 	s.registerRoutes(mux)
+	s.routes.Store(mux)
 
-	// Wrap handler with session middleware to ensure all requests have a session ID
-	handler := SessionMiddleware(mux)
+	// Wrap handler with session middleware to ensure all requests have a session ID,
+	// check CSRF tokens, scope sessions to users and require an API token if
+	// configured, track requests so shutdown can drain them, and tag and log
+	// every request with a request ID
+	handler := logRequests(countRequests(s.trackIntake(s.requireAPIToken(s.identifyUser(SessionMiddleware(s.requireCSRFToken(http.HandlerFunc(s.serveRoutes))))))))
 
 	s.server = &http.Server{
 		Addr:         addr,
@@ -212,44 +387,404 @@ func NewServerWithDeps(addr string, ollamaClient ollamaClient, sessionManager *c
 	return s, nil
 }
 
+// configure applies the settings derived from cfg: default generation
+// settings, gallery-only mode, hooks, watermark, the agent personas, API
+// tokens, users, the per-user generation quota and CSRF protection.
+// If cfg is nil, default generation settings are used (steps=20, cfg=3.5, seed=0).
+func (s *Server) configure(cfg *config.Config) error {
+	// Extract default generation settings from config
+	s.defaultSteps = 20
+	s.defaultCFG = 3.5
+	s.defaultSeed = 0
+	s.defaultWidth = 1024
+	s.defaultHeight = 1024
+	s.defaultSampling = ollama.Sampling{}
+	s.defaultLLMSeed = 0
+	s.fallbackModel = ""
+	s.llmCaptureDir = ""
+	s.llmSummarize = false
+	s.embeddingModel = ""
+	s.loraDir = ""
+	s.vaeTiling = false
+	s.generateTimeout = defaultGenerateTimeout
+	s.imageQuality = image.DefaultQuality
+	s.computeGPUs = []int{0}
+	s.moderator = nil
+	s.moderationMode = moderation.ModeBlock
+	s.hooks = hooks.NewRegistry()
+	s.agentTools = s.newAgentTools()
+	if err := s.loadAssets(cfg); err != nil {
+		return err
+	}
+	s.configureStorageQuota(cfg)
+	s.imageStore.SetStorageFormat(image.OutputPNG, image.DefaultQuality)
+	if cfg == nil {
+		// Deprecated NewServer for testing: no agent prompt
+		s.apiTokens.Store(nil)
+		s.userAuth.Store(nil)
+		s.rateLimiter.setDailyGenerationQuota(0)
+		s.csrfDisabled.Store(false)
+		return nil
+	}
+
+	s.defaultSteps = cfg.Steps
+	s.defaultCFG = cfg.CFG
+	s.defaultSeed = cfg.Seed
+	s.defaultWidth = cfg.Width
+	s.defaultHeight = cfg.Height
+	s.defaultSampling = cfg.LLMSampling
+	s.defaultLLMSeed = cfg.LLMSeed
+	s.fallbackModel = cfg.LLMFallbackModel
+	if cfg.CaptureLLM {
+		s.llmCaptureDir = llm.DefaultCaptureDir
+	}
+	s.llmSummarize = cfg.LLMSummarize
+	s.embeddingModel = cfg.EmbeddingModel
+	s.loraDir = cfg.LoRADir
+	s.vaeTiling = cfg.VAETiling
+	if cfg.GenerateTimeout > 0 {
+		s.generateTimeout = cfg.GenerateTimeout
+	}
+	if cfg.ImageQuality > 0 {
+		s.imageQuality = cfg.ImageQuality
+	}
+	if cfg.ImageFormat != "" {
+		format, err := image.ParseOutputFormat(cfg.ImageFormat)
+		if err != nil {
+			return fmt.Errorf("invalid image format: %w", err)
+		}
+		s.imageStore.SetStorageFormat(format, s.imageQuality)
+	}
+	s.computeGPUs = cfg.ComputeGPUs()
+	s.galleryOnly = cfg.GalleryOnly
+	s.mcpSSE = cfg.MCP == config.MCPSSE
+	if err := registerConfiguredHooks(s.hooks, cfg); err != nil {
+		return fmt.Errorf("failed to configure hooks: %w", err)
+	}
+	if err := s.configureModeration(cfg); err != nil {
+		return fmt.Errorf("failed to configure moderation: %w", err)
+	}
+	wm, err := newWatermarkCache(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to configure watermark: %w", err)
+	}
+	s.watermark = wm
+
+	// Load the agent prompt file, or directory of personas
+	if cfg.AgentPromptPath != "" {
+		s.agentPromptPath = cfg.AgentPromptPath
+		if err := s.loadAgentPrompt(); err != nil {
+			return fmt.Errorf("failed to load agent prompt: %w", err)
+		}
+	}
+
+	// Stored last: tokens, users and the quota are shared with the running
+	// server, so they only change once the rest of cfg has been accepted
+	tokens, err := loadAPITokens(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load api tokens: %w", err)
+	}
+	s.rateLimiter.setDailyGenerationQuota(cfg.UserDailyGenerations)
+	s.userAuth.Store(newUserAuth(cfg))
+	// Gallery-only mode has no form endpoints to protect
+	s.csrfDisabled.Store(cfg.DisableCSRF || cfg.GalleryOnly)
+	s.apiTokens.Store(tokens)
+	return nil
+}
+
+// serveRoutes dispatches a request to the active route mux.
+func (s *Server) serveRoutes(w http.ResponseWriter, r *http.Request) {
+	// SECURITY: Browsers must not guess a content type, such as for a file
+	// served as an image that isn't one
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	s.routes.Load().ServeHTTP(w, r)
+}
+
 // Broker returns the SSE broker for sending events to connected clients.
 func (s *Server) Broker() *Broker {
 	return s.broker
 }
 
+// Hooks returns the plugin hook registry so callers can register
+// additional lifecycle hooks before the server starts.
+func (s *Server) Hooks() *hooks.Registry {
+	return s.hooks
+}
+
+// SetEncryptor encrypts the files the server keeps in session directories,
+// such as saved prompts, uploads and the moderation audit, at rest with e.
+// It must be called before the server starts, and carries over
+// Reconfigure.
+func (s *Server) SetEncryptor(e *persistence.Encryptor) {
+	s.imageStore.SetEncryptor(e)
+	s.promptStore.SetEncryptor(e)
+	s.moderationLog.SetEncryptor(e)
+}
+
+// registerConfiguredHooks registers the hooks described by CLI flags.
+func registerConfiguredHooks(registry *hooks.Registry, cfg *config.Config) error {
+	registry.SetTimeout(cfg.HookTimeout)
+
+	if cfg.HookURL != "" {
+		webhook, err := hooks.NewWebhookHook(cfg.HookURL)
+		if err != nil {
+			return err
+		}
+		events, err := hooks.ParseEvents(cfg.HookEvents)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			registry.Register(event, webhook)
+		}
+	}
+
+	// Notification webhooks run in the background so a slow receiver
+	// never delays image-ready
+	for _, rawURL := range cfg.Webhooks {
+		webhook, err := hooks.NewWebhookHook(rawURL)
+		if err != nil {
+			return err
+		}
+		notify := hooks.NewAsyncHook(webhook, func(err error) {
+			log.Printf("Webhook %s failed: %v", rawURL, err)
+		})
+		registry.Register(hooks.EventPostSave, notify)
+		registry.Register(hooks.EventGenerateFailed, notify)
+	}
+
+	if strings.TrimSpace(cfg.PostSaveExec) != "" {
+		execHook, err := hooks.NewExecHook(cfg.PostSaveExec)
+		if err != nil {
+			return err
+		}
+		// Also in the background: the command's output isn't needed and it
+		// may run as long as the hook timeout
+		registry.Register(hooks.EventPostSave, hooks.NewAsyncHook(execHook, func(err error) {
+			log.Printf("Post-save command failed: %v", err)
+		}))
+	}
+
+	return nil
+}
+
+// loadAssets selects where templates and static files come from and parses
+// the templates. With --dev they are read from cfg.DevDir, so edits show up
+// on the next request without rebuilding.
+func (s *Server) loadAssets(cfg *config.Config) error {
+	s.assets = embeddedFS
+	s.reloadTemplates = false
+	if cfg != nil && cfg.Dev {
+		s.assets = os.DirFS(cfg.DevDir)
+		s.reloadTemplates = true
+		log.Printf("Development mode: serving templates and static files from %s", cfg.DevDir)
+	}
+
+	tmpl, err := template.ParseFS(s.assets, "templates/*.html")
+	if err != nil {
+		return fmt.Errorf("failed to parse templates: %w", err)
+	}
+	s.templates = tmpl
+	return nil
+}
+
+// executeTemplate renders the named template, re-parsing the templates
+// first in --dev mode.
+func (s *Server) executeTemplate(w io.Writer, name string, data any) error {
+	tmpl := s.templates
+	if s.reloadTemplates {
+		var err error
+		tmpl, err = template.ParseFS(s.assets, "templates/*.html")
+		if err != nil {
+			return fmt.Errorf("failed to parse templates: %w", err)
+		}
+	}
+	return tmpl.ExecuteTemplate(w, name, data)
+}
+
+// staticHandler serves static/ from the assets. In --dev mode browsers are
+// told not to cache files, so edits show up on reload.
+func (s *Server) staticHandler() http.Handler {
+	files := http.FileServer(http.FS(s.assets))
+	if !s.reloadTemplates {
+		return files
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		files.ServeHTTP(w, r)
+	})
+}
+
 // registerRoutes sets up all HTTP routes.
 func (s *Server) registerRoutes(mux *http.ServeMux) {
-	// Index page
+	// Index page (redirects to the gallery in gallery-only mode)
 	mux.HandleFunc("GET /", s.handleIndex)
 
 	// Static files (if we add CSS/JS later)
-	mux.Handle("GET /static/", http.FileServer(http.FS(embeddedFS)))
+	mux.Handle("GET /static/", s.staticHandler())
+
+	// Public read-only gallery of published images
+	mux.HandleFunc("GET /gallery", s.handleGallery)
+	mux.HandleFunc("GET /gallery/images/{id}", s.handleGalleryImage)
+
+	// Health check endpoint for Electron
+	mux.HandleFunc("GET /ready", s.handleReady)
+
+	// Per-dependency health: ollama, compute, disk and SSE
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+
+	// GPUs compute can generate on and which ones it uses
+	mux.HandleFunc("GET /system", s.handleSystem)
+
+	// Prometheus metrics
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+
+	// Image provenance: the signing key and manifest verification
+	mux.HandleFunc("GET /provenance/key", s.handleProvenanceKey)
+	mux.HandleFunc("POST /provenance/verify", s.handleVerifyProvenance)
+
+	// Gallery-only mode exposes nothing that can read sessions or generate
+	if s.galleryOnly {
+		return
+	}
 
 	// SSE endpoint for real-time updates
 	mux.HandleFunc("GET /events", s.handleEvents)
 
+	// MCP tool server over HTTP (--mcp sse)
+	if s.mcpSSE {
+		mux.HandleFunc("GET /mcp/sse", s.handleMCPEvents)
+		mux.HandleFunc("POST /mcp/message", s.handleMCPMessage)
+	}
+
+	// Soft restart: reload config and reconnect without dropping sessions
+	mux.HandleFunc("POST /admin/restart", s.handleRestart)
+
+	// Free the LLM's VRAM before large generations
+	mux.HandleFunc("POST /admin/llm/unload", s.handleUnloadLLM)
+
+	// Download the latest LLM request and response captured with --capture-llm
+	mux.HandleFunc("GET /admin/llm/capture", s.handleLLMCapture)
+
 	// API endpoints (placeholders)
 	mux.HandleFunc("POST /chat", s.handleChat)
+	mux.HandleFunc("POST /chat/cancel", s.handleCancelChat)
 	mux.HandleFunc("POST /prompt", s.handlePrompt)
+	mux.HandleFunc("GET /prompt/history", s.handlePromptHistory)
 	mux.HandleFunc("POST /generate", s.handleGenerate)
+	mux.HandleFunc("POST /regenerate/{messageID}", s.handleRegenerate)
 	mux.HandleFunc("POST /new-chat", s.handleNewChat)
 
+	// OpenAI-compatible image generation for existing SDKs and tools
+	mux.HandleFunc("POST /v1/images/generations", s.handleOpenAIImageGenerations)
+
+	// Chat and image models and sampling parameters per session
+	mux.HandleFunc("GET /models", s.handleListModels)
+	mux.HandleFunc("POST /settings/model", s.handleSetModel)
+	mux.HandleFunc("GET /models/diffusion", s.handleListDiffusionModels)
+	mux.HandleFunc("GET /loras", s.handleListLoRAs)
+	mux.HandleFunc("POST /settings/diffusion-model", s.handleSetDiffusionModel)
+	mux.HandleFunc("GET /settings/control", s.handleGetControl)
+	mux.HandleFunc("POST /settings/control", s.handleSetControl)
+	mux.HandleFunc("GET /personas", s.handleListPersonas)
+	mux.HandleFunc("POST /settings/persona", s.handleSetPersona)
+	mux.HandleFunc("GET /settings/sampling", s.handleGetSampling)
+	mux.HandleFunc("POST /settings/sampling", s.handleSetSampling)
+
+	// Named chats within a session
+	mux.HandleFunc("GET /chats", s.handleListChats)
+	mux.HandleFunc("POST /chats", s.handleCreateChat)
+	mux.HandleFunc("PATCH /chats/{chatID}", s.handleRenameChat)
+	mux.HandleFunc("DELETE /chats/{chatID}", s.handleDeleteChat)
+	mux.HandleFunc("POST /chats/{chatID}/activate", s.handleSwitchChat)
+
+	// Sessions, for reattaching a browser that lost its session cookie or
+	// wiping one from a shared machine
+	mux.HandleFunc("GET /sessions", s.handleListSessions)
+	mux.HandleFunc("POST /sessions/{sessionID}/resume", s.handleResumeSession)
+	mux.HandleFunc("POST /sessions/{sessionID}/delete", s.handleDeleteSession)
+
+	// Read-only share links, viewable without the session's cookie
+	mux.HandleFunc("POST /sessions/{sessionID}/share", s.handleShareSession)
+	mux.HandleFunc("GET /share/{token}", s.handleSharedSession)
+	mux.HandleFunc("GET /share/{token}/images/{filename}", s.handleSharedImage)
+
+	// Conversation history
+	mux.HandleFunc("GET /history", s.handleHistory)
+
 	// Image serving endpoints
 	mux.HandleFunc("GET /images/{id}", s.handleImage)
+	mux.HandleFunc("GET /images/compare", s.handleCompareImages)
+	mux.HandleFunc("GET /images/search", s.handleSearchImages)
+	mux.HandleFunc("GET /search/semantic", s.handleSemanticSearch)
+	mux.HandleFunc("GET /images/{id}/histogram", s.handleImageHistogram)
+	mux.HandleFunc("POST /images/{id}/adjust", s.handleAdjustImage)
+	mux.HandleFunc("POST /images/{id}/upscale", s.handleUpscaleImage)
 	mux.HandleFunc("GET /sessions/{sessionID}/images/{filename}", s.handleSessionImage)
 
+	// Image deletion endpoints
+	mux.HandleFunc("DELETE /images/{id}", s.handleDeleteImage)
+	mux.HandleFunc("DELETE /sessions/{sessionID}/images/{filename}", s.handleDeleteSessionImage)
+
+	// Gallery publishing, gated by the owning session
+	mux.HandleFunc("POST /sessions/{sessionID}/images/{filename}/publish", s.handlePublishImage)
+	mux.HandleFunc("DELETE /sessions/{sessionID}/images/{filename}/publish", s.handleUnpublishImage)
+
+	// Starred images
+	mux.HandleFunc("POST /images/{id}/favorite", s.handleFavoriteImage)
+	mux.HandleFunc("DELETE /images/{id}/favorite", s.handleUnfavoriteImage)
+	mux.HandleFunc("GET /favorites", s.handleListFavorites)
+
+	// Prompt library
+	mux.HandleFunc("GET /prompts", s.handleListSavedPrompts)
+	mux.HandleFunc("POST /prompts", s.handleSavePrompt)
+	mux.HandleFunc("POST /prompts/{name}/load", s.handleLoadSavedPrompt)
+
+	// Image tags
+	mux.HandleFunc("PUT /images/{id}/tags", s.handleSetImageTags)
+
+	// Prompts flagged by content moderation
+	mux.HandleFunc("GET /moderation/audit", s.handleModerationAudit)
+
 	// Message state endpoint for loading historical snapshots
 	mux.HandleFunc("GET /message/{id}/state", s.handleMessageState)
+	mux.HandleFunc("POST /message/{id}/restore", s.handleRestoreMessage)
+	mux.HandleFunc("POST /message/{id}/edit", s.handleEditMessage)
+	mux.HandleFunc("DELETE /message/{id}", s.handleDeleteMessage)
 
-	// Health check endpoint for Electron
-	mux.HandleFunc("GET /ready", s.handleReady)
+	// Conversation export and import
+	mux.HandleFunc("GET /export", s.handleExport)
+	mux.HandleFunc("POST /import", s.handleImport)
+
+	// Reference images for img2img and inpainting
+	mux.HandleFunc("POST /upload", s.handleUpload)
+	mux.HandleFunc("POST /upload/{id}/apply", s.handleApplyUploadParameters)
+
+	// API documentation
+	mux.HandleFunc("GET /api/openapi.json", s.handleOpenAPI)
+	mux.HandleFunc("GET /api/docs", s.handleAPIDocs)
 }
 
-// ListenAndServe starts the HTTP server and blocks until the context is cancelled.
+// ListenAndServe starts the HTTP server and blocks until the context is cancelled,
+// then shuts the server down with Shutdown.
 // Returns an error if the server fails to start or encounters a non-graceful shutdown error.
 func (s *Server) ListenAndServe(ctx context.Context) error {
+	if err := s.Serve(ctx); err != nil {
+		return err
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
+
+// Serve starts the HTTP server and blocks until the context is cancelled or
+// the server fails. It does not shut the server down; the caller runs
+// Shutdown or its stages afterwards.
+func (s *Server) Serve(ctx context.Context) error {
 	// Start rate limiter cleanup goroutine
 	s.rateLimiter.startCleanup(ctx)
+	s.watchAgentPrompt(ctx)
 
 	// Channel to capture server errors
 	errCh := make(chan error, 1)
@@ -265,23 +800,7 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 	// Wait for context cancellation or server error
 	select {
 	case <-ctx.Done():
-		// Context cancelled, initiate graceful shutdown
-		log.Println("Shutting down web server...")
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
-		defer cancel()
-
-		if err := s.server.Shutdown(shutdownCtx); err != nil {
-			return fmt.Errorf("server shutdown failed: %w", err)
-		}
-
-		// Shutdown SSE broker
-		if err := s.broker.Shutdown(shutdownCtx); err != nil {
-			return fmt.Errorf("broker shutdown failed: %w", err)
-		}
-
-		log.Println("Web server stopped")
 		return nil
-
 	case err := <-errCh:
 		// Server failed to start or encountered error
 		return fmt.Errorf("server error: %w", err)
@@ -290,6 +809,11 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 
 // handleIndex serves the index page.
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if s.galleryOnly {
+		http.Redirect(w, r, "/gallery", http.StatusFound)
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	// Populate template data with default generation settings from CLI flags
@@ -300,8 +824,14 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 		Width:  s.defaultWidth,
 		Height: s.defaultHeight,
 	}
+	if sessionID := GetSessionID(r.Context()); sessionID != "" {
+		data.LLMSeed = s.llmSeed(s.sessionManager.GetSession(sessionID))
+	}
+	if !s.csrfDisabled.Load() {
+		data.CSRFToken = s.csrfToken(GetSessionID(r.Context()))
+	}
 
-	if err := s.templates.ExecuteTemplate(w, "index.html", data); err != nil {
+	if err := s.executeTemplate(w, "index.html", data); err != nil {
 		log.Printf("Failed to execute template: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -329,28 +859,37 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
 
 	// SECURITY: Check rate limit
-	if !s.rateLimiter.allowChat(sessionID) {
+	limit := s.rateLimiter.takeChat(sessionID)
+	if !limit.allowed {
 		log.Printf("Rate limit exceeded for session %s (chat)", sessionID)
-		s.sendErrorEvent(sessionID, "Too many requests. Please wait a moment.")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusTooManyRequests)
-		fmt.Fprintf(w, `{"status":"error","message":"rate limit exceeded"}`)
+		s.sendErrorEvent(sessionID, "", "Too many requests. Please wait a moment.")
+		writeRateLimited(w, limit)
 		return
 	}
+	limit.setHeaders(w)
 
 	// Parse form data
 	if err := r.ParseForm(); err != nil {
 		log.Printf("Failed to parse form: %v", err)
-		s.sendErrorEvent(sessionID, "Failed to parse message")
+		s.sendErrorEvent(sessionID, "", "Failed to parse message")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, `{"status":"error","message":"failed to parse form"}`)
 		return
 	}
 
+	// Pin the target chat for the whole request so switching chats while
+	// the agent is responding doesn't redirect the response
+	session := s.sessionManager.GetSession(sessionID)
+	chatID, manager := resolveChat(session, r.FormValue("chat_id"))
+	if manager == nil {
+		writeChatNotFound(w)
+		return
+	}
+
 	message := strings.TrimSpace(r.FormValue("message"))
 	if message == "" {
-		s.sendErrorEvent(sessionID, "Message cannot be empty")
+		s.sendErrorEvent(sessionID, chatID, "Message cannot be empty")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, `{"status":"error","message":"message required"}`)
@@ -360,7 +899,7 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 	// SECURITY: Validate message length
 	if len(message) > MaxMessageLength {
 		log.Printf("Message too long for session %s: %d bytes", sessionID, len(message))
-		s.sendErrorEvent(sessionID, "Message is too long. Please shorten your message.")
+		s.sendErrorEvent(sessionID, chatID, "Message is too long. Please shorten your message.")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusRequestEntityTooLarge)
 		fmt.Fprintf(w, `{"status":"error","message":"message too long"}`)
@@ -372,28 +911,96 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 	cfg := s.parseCFG(r.FormValue("cfg"))
 	seed := s.parseSeed(r.FormValue("seed"))
 
-	// Get session and update generation settings
-	session := s.sessionManager.GetSession(sessionID)
+	// An llm_seed field sets the LLM seed for the session's chats; leaving
+	// it empty reverts to the server's default
+	if r.Form.Has("llm_seed") {
+		llmSeed, err := parseLLMSeed(r.FormValue("llm_seed"))
+		if err != nil {
+			s.sendErrorEvent(sessionID, chatID, "LLM seed must be a whole number, 0 or more.")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"status":"error","message":"invalid llm_seed"}`)
+			return
+		}
+		session.SetLLMSeed(llmSeed)
+	}
+
+	// Run pre-prompt hooks; a failing hook rejects the message
+	if err := s.hooks.Fire(r.Context(), hooks.Payload{
+		Event:     hooks.EventPrePrompt,
+		SessionID: sessionID,
+		Message:   message,
+		Steps:     int(steps),
+		CFG:       cfg,
+		Seed:      seed,
+	}); err != nil {
+		log.Printf("Pre-prompt hook rejected message for session %s: %v", sessionID, err)
+		s.sendErrorEvent(sessionID, chatID, "Your message was rejected by a plugin hook.")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `{"status":"error","message":"rejected by hook"}`)
+		return
+	}
+
+	// Update session generation settings
 	session.SetGenerationSettings(int(steps), cfg, seed)
+	parseResolution(r, session)
 
-	// Get conversation manager for this session
-	manager := session.Manager()
+	// Run the agent turn; its response is streamed via SSE
+	s.runChatTurn(r.Context(), session, sessionID, chatID, manager, message, int(steps), cfg, seed)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status":"ok","session_id":"%s"}`, sessionID)
+}
 
+// runChatTurn sends a user message to the agent on behalf of a chat request.
+// It streams the response via SSE, records the user and assistant messages,
+// applies any prompt and settings update, and triggers generation if the
+// agent asked for it. Failures are reported to the UI via SSE events.
+func (s *Server) runChatTurn(ctx context.Context, session *conversation.Session, sessionID, chatID string, manager *conversation.Manager, message string, steps int, cfg float64, seed int64) {
 	// Build system prompt by combining agent prompt (behavioral) with function calling instructions.
 	// We do NOT call AddUserMessage yet - only add to history after successful response.
 	// This prevents orphaned user messages when chatWithRetry fails or is interrupted.
-	systemPrompt := s.buildSystemPrompt()
-	context := manager.BuildLLMContext(systemPrompt, int(steps), cfg, seed)
+	systemPrompt := s.buildSystemPrompt(s.sessionAgentPrompt(session))
 
-	// Append the new user message to the context (but not to history yet)
-	context = append(context, conversation.Message{
+	// Build tools array for function calling
+	tools := append([]ollama.Tool{ollama.UpdateGenerationTool()}, s.agentToolDefs()...)
+
+	// Use the session's chosen model, if it switched from the default
+	if model := session.Model(); model != "" {
+		ctx = ollama.WithModel(ctx, model)
+	}
+	if sampling := s.defaultSampling.Merge(session.Sampling()); !sampling.IsZero() {
+		ctx = ollama.WithSampling(ctx, sampling)
+	}
+
+	// Leave out the oldest turns if the conversation would overflow the
+	// model's context window
+	userMessage := conversation.Message{
 		Role:    conversation.RoleUser,
 		Content: message,
-	})
+	}
+	maxTokens := s.contextBudget(ctx, session, userMessage, tools)
+	llmContext, dropped := manager.BuildLLMContextWithin(systemPrompt, steps, cfg, seed, maxTokens)
+	// A new summary reserves room for the longest one and may push more
+	// messages out, so it can take a second pass to cover them all
+	for pass := 0; s.llmSummarize && dropped > 0 && pass < 2; pass++ {
+		if !s.summarizeDropped(ctx, sessionID, manager, dropped) {
+			break
+		}
+		llmContext, dropped = manager.BuildLLMContextWithin(systemPrompt, steps, cfg, seed, maxTokens)
+	}
+	if dropped > 0 {
+		log.Printf("Left %d old messages out of the LLM context for session %s to fit %d tokens", dropped, sessionID, maxTokens)
+	}
+
+	// Append the new user message to the context (but not to history yet)
+	llmContext = append(llmContext, userMessage)
 
 	// DEBUG: Log the context being sent to LLM
-	log.Printf("DEBUG: Sending %d messages to LLM for session %s:", len(context), sessionID)
-	for i, msg := range context {
+	log.Printf("DEBUG: Sending %d messages to LLM for session %s:", len(llmContext), sessionID)
+	for i, msg := range llmContext {
 		contentPreview := msg.Content
 		if len(contentPreview) > 200 {
 			contentPreview = contentPreview[:200] + "..."
@@ -402,8 +1009,8 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Convert conversation messages to ollama messages
-	ollamaMessages := make([]ollama.Message, len(context))
-	for i, msg := range context {
+	ollamaMessages := make([]ollama.Message, len(llmContext))
+	for i, msg := range llmContext {
 		ollamaMessages[i] = ollama.Message{
 			Role:    msg.Role,
 			Content: msg.Content,
@@ -411,28 +1018,49 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Send thinking event to UI before LLM processing begins
-	if err := s.broker.SendEvent(sessionID, EventAgentThinking, map[string]bool{
+	if err := s.sendChatEvent(sessionID, chatID, EventAgentThinking, map[string]bool{
 		"started": true,
 	}); err != nil {
 		log.Printf("Failed to send thinking event for session %s: %v", sessionID, err)
 		// Continue anyway - this is a UI convenience, not critical
 	}
 
-	// Build tools array for function calling
-	tools := []ollama.Tool{ollama.UpdateGenerationTool()}
-
-	// Stream response from ollama with automatic retry on format errors
+	// Stream response from ollama with automatic retry on format errors.
+	// POST /chat/cancel can stop the stream, but not what follows it.
 	tokenCount := 0
-	result, err := s.chatWithRetry(r.Context(), sessionID, ollamaMessages, nil, tools, func(token ollama.StreamToken) error {
+	var announced *ollama.LLMMetadata
+	var partial strings.Builder
+	streamCtx, streamDone := s.chatStreams.start(ctx, sessionID, chatID)
+	result, err := s.chatWithRetry(streamCtx, sessionID, chatID, ollamaMessages, s.chatSeed(session), tools, func(token ollama.StreamToken) error {
+		// Apply a tool call as soon as it arrives so the UI shows the new
+		// prompt and settings while the reply is still streaming
+		if announced == nil && slices.ContainsFunc(token.ToolCalls, isUpdateGenerationCall) {
+			metadata, err := ollama.ParseToolCalls(token.ToolCalls)
+			if err != nil {
+				// The final result reports it and may be retried
+				log.Printf("DEBUG: Ignoring streamed tool call for session %s: %v", sessionID, err)
+				return nil
+			}
+			announced = &metadata
+			s.applyAgentSettings(session, sessionID, chatID, metadata)
+			if metadata.GenerateImage && metadata.Prompt != "" {
+				// No message ID yet; generation itself starts once the
+				// reply is saved
+				_ = s.sendChatEvent(sessionID, chatID, EventGenerationStarted, map[string]interface{}{
+					"source": "agent",
+				})
+			}
+		}
 		// Send each token via SSE
 		if token.Content != "" {
 			tokenCount++
+			partial.WriteString(token.Content)
 			// Log first few tokens to debug truncation issues
 			if tokenCount <= 10 {
 				log.Printf("DEBUG: Token %d for session %s: %q", tokenCount, sessionID, token.Content)
 			}
 			// Check for send errors to detect client disconnection
-			if err := s.broker.SendEvent(sessionID, EventAgentToken, map[string]string{
+			if err := s.sendChatEvent(sessionID, chatID, EventAgentToken, map[string]string{
 				"token": token.Content,
 			}); err != nil {
 				// Client disconnected - abort streaming to avoid wasting resources
@@ -441,6 +1069,12 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 		}
 		return nil
 	})
+	streamDone()
+
+	if err != nil && errors.Is(context.Cause(streamCtx), errChatCancelled) {
+		s.finishCancelledChat(manager, sessionID, chatID, message, partial.String())
+		return
+	}
 
 	if err != nil {
 		// Check if this is a missing fields error after retry (needs context reset)
@@ -459,24 +1093,21 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 			manager.Clear()
 
 			// Send error event to user with friendly message
-			s.sendErrorEvent(sessionID, "I'm having trouble responding. Let's start fresh.")
+			s.sendErrorEvent(sessionID, chatID, "I'm having trouble responding. Let's start fresh.")
 		} else {
 			// Non-retryable error - send generic error message
 			// SECURITY: Log full error server-side but send generic message to client
 			log.Printf("Ollama chat error for session %s: %v", sessionID, err)
-			s.sendErrorEvent(sessionID, "An error occurred while processing your message. Please try again.")
+			s.sendErrorEvent(sessionID, chatID, "An error occurred while processing your message. Please try again.")
 		}
 
 		// Send agent-done to finalize any partial message
 		// No message ID available in error case (use 0 as sentinel)
-		_ = s.broker.SendEvent(sessionID, EventAgentDone, AgentDoneData{
+		_ = s.sendChatEvent(sessionID, chatID, EventAgentDone, AgentDoneData{
 			Done:        true,
 			MessageID:   0,
 			HasSnapshot: false,
 		})
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK) // Return OK so HTMX doesn't show error
-		fmt.Fprintf(w, `{"status":"ok","session_id":"%s"}`, sessionID)
 		return
 	}
 
@@ -496,15 +1127,14 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 	if !result.HasToolCall {
 		// Just save the conversational response and send done event
 		messageID := manager.AddAssistantMessage(result.Response, "", nil)
-		_ = s.broker.SendEvent(sessionID, EventAgentDone, AgentDoneData{
+		s.recordUsage(manager, sessionID, messageID, result.Usage)
+		manager.SetMessageModel(messageID, result.Model)
+		s.runAgentTools(ctx, sessionID, chatID, messageID, result.ToolCalls)
+		_ = s.sendChatEvent(sessionID, chatID, EventAgentDone, AgentDoneData{
 			Done:        true,
 			MessageID:   messageID,
 			HasSnapshot: false, // No snapshot since metadata is nil
 		})
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok","session_id":"%s"}`, sessionID)
 		return
 	}
 
@@ -524,7 +1154,7 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 		responseText = generateFallbackResponse()
 		log.Printf("DEBUG: Using fallback response: %s", responseText)
 		// Send fallback text via SSE so user sees it
-		_ = s.broker.SendEvent(sessionID, EventAgentToken, map[string]string{
+		_ = s.sendChatEvent(sessionID, chatID, EventAgentToken, map[string]string{
 			"token": responseText,
 		})
 	}
@@ -533,46 +1163,41 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 	// Storing RawResponse would pollute history with tool call markers and JSON metadata,
 	// which confuses the LLM on subsequent turns.
 	messageID := manager.AddAssistantMessage(responseText, prompt, &result.Metadata)
+	s.recordUsage(manager, sessionID, messageID, result.Usage)
+	manager.SetMessageModel(messageID, result.Model)
 
 	// Determine if message has a snapshot (prompt changed)
 	hasSnapshot := prompt != ""
 
-	// Send prompt-update event if prompt was extracted
-	if prompt != "" {
-		_ = s.broker.SendEvent(sessionID, EventPromptUpdate, map[string]string{
-			"prompt": prompt,
-		})
+	// Send the prompt and settings to the UI, unless the streamed tool call
+	// already did
+	if announced == nil || *announced != result.Metadata {
+		s.applyAgentSettings(session, sessionID, chatID, result.Metadata)
 	}
-
-	// Process agent-provided generation settings
-	// Clamp to valid ranges and send update to UI
 	clampedSteps, clampedCFG, clampedSeed, clampedList := clampGenerationSettings(
 		result.Metadata.Steps,
 		result.Metadata.CFG,
 		result.Metadata.Seed,
 	)
-
-	// Update session with clamped values
-	session.SetGenerationSettings(clampedSteps, clampedCFG, clampedSeed)
-
-	// Send settings-update event to UI
-	_ = s.broker.SendEvent(sessionID, EventSettingsUpdate, map[string]interface{}{
-		"steps": clampedSteps,
-		"cfg":   clampedCFG,
-		"seed":  clampedSeed,
-	})
+	clampedList = append(clampedList, s.applyAgentLoRAs(session, sessionID, result.ToolCalls)...)
+	if result.Metadata.GenerateImage {
+		clampedList = append(clampedList, s.resolutionClamp(sessionID)...)
+	}
 
 	// If values were clamped, send feedback message via agent-token
 	if feedback := formatClampedFeedback(clampedList); feedback != "" {
 		log.Printf("Settings clamped for session %s: %s", sessionID, feedback)
-		_ = s.broker.SendEvent(sessionID, EventAgentToken, map[string]string{
+		_ = s.sendChatEvent(sessionID, chatID, EventAgentToken, map[string]string{
 			"token": "\n\n[" + feedback + "]",
 		})
 	}
 
+	// Carry out calls to other tools, which may change the prompt to generate
+	s.runAgentTools(ctx, sessionID, chatID, messageID, result.ToolCalls)
+
 	// Send agent-done event BEFORE generation starts
 	// This finalizes the agent's message bubble so generation indicator appears separately
-	_ = s.broker.SendEvent(sessionID, EventAgentDone, AgentDoneData{
+	_ = s.sendChatEvent(sessionID, chatID, EventAgentDone, AgentDoneData{
 		Done:        true,
 		MessageID:   messageID,
 		HasSnapshot: hasSnapshot,
@@ -585,32 +1210,49 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 		// Check generation rate limit before triggering
 		if !s.rateLimiter.allowGenerate(sessionID) {
 			log.Printf("Rate limit exceeded for session %s (agent-triggered generation)", sessionID)
-			s.sendErrorEvent(sessionID, "Too many generation requests. Please wait a moment.")
+			s.sendErrorEvent(sessionID, chatID, "Too many generation requests. Please wait a moment.")
 		} else {
 			// Use session's current prompt and settings
-			currentPrompt := session.Manager().GetCurrentPrompt()
+			currentPrompt := manager.GetCurrentPrompt()
 			if currentPrompt != "" {
 				// Notify UI that generation is starting with message ID
-				_ = s.broker.SendEvent(sessionID, EventGenerationStarted, map[string]interface{}{
+				_ = s.sendChatEvent(sessionID, chatID, EventGenerationStarted, map[string]interface{}{
 					"source":     "agent",
 					"message_id": messageID,
 				})
 				// Associate generated image with the assistant message that triggered it
-				_ = s.generateImage(r.Context(), sessionID, currentPrompt, clampedSteps, clampedCFG, clampedSeed, messageID)
+				// so it waits behind generations users asked for
+				_ = s.generateImage(withPriority(ctx, protocol.PriorityLow), sessionID, chatID, currentPrompt, clampedSteps, clampedCFG, clampedSeed, messageID)
 			} else {
 				log.Printf("Skipping auto-generation for session %s: empty prompt", sessionID)
-				s.sendErrorEvent(sessionID, "Cannot generate: no prompt available")
+				s.sendErrorEvent(sessionID, chatID, "Cannot generate: no prompt available")
 			}
 		}
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ok","session_id":"%s"}`, sessionID)
+// applyAgentSettings sends the prompt of an update_generation call to the
+// UI, clamps its generation settings to valid ranges, stores them in the
+// session and sends them too.
+func (s *Server) applyAgentSettings(session *conversation.Session, sessionID, chatID string, metadata ollama.LLMMetadata) {
+	if metadata.Prompt != "" {
+		_ = s.sendChatEvent(sessionID, chatID, EventPromptUpdate, map[string]string{
+			"prompt": metadata.Prompt,
+		})
+	}
+
+	steps, cfg, seed, _ := clampGenerationSettings(metadata.Steps, metadata.CFG, metadata.Seed)
+	session.SetGenerationSettings(steps, cfg, seed)
+	_ = s.sendChatEvent(sessionID, chatID, EventSettingsUpdate, map[string]interface{}{
+		"steps": steps,
+		"cfg":   cfg,
+		"seed":  seed,
+	})
 }
 
 // buildSystemPrompt builds the complete system prompt by combining the agent
-// behavioral prompt (from ara.md) with function calling instructions.
+// behavioral prompt (from ara.md, or the session's persona) with function
+// calling instructions.
 //
 // WHY SEPARATE PROMPTS:
 // - Behavioral prompt (ara.md): Defines personality, interaction style, when to generate
@@ -619,11 +1261,11 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 // This separation allows us to:
 // - Update behavioral instructions without changing code
 // - Keep function schema in sync with actual implementation
-func (s *Server) buildSystemPrompt() string {
+func (s *Server) buildSystemPrompt(agentPrompt string) string {
 	// Start with behavioral prompt from file
 	var prompt strings.Builder
-	if s.agentPrompt != "" {
-		prompt.WriteString(s.agentPrompt)
+	if agentPrompt != "" {
+		prompt.WriteString(agentPrompt)
 		prompt.WriteString("\n\n")
 	} else {
 		// If agent prompt is not loaded, return minimal fallback with just function instructions.
@@ -645,13 +1287,27 @@ func (s *Server) buildSystemPrompt() string {
 	prompt.WriteString("- `cfg` (number, 0-20): Guidance scale, default 1.0\n")
 	prompt.WriteString("- `seed` (integer): Random seed, -1 for random\n")
 	prompt.WriteString("- `generate_image` (boolean): true to generate, false to just update settings\n")
+	if names, err := listLoRAs(s.loraDir); err == nil && len(names) > 0 {
+		fmt.Fprintf(&prompt, "- `loras` (array of {name, weight -2 to 2}, optional): LoRAs to apply, at most %d; omit to keep the current ones. Installed: %s\n",
+			protocol.MaxLoRAs, strings.Join(names, ", "))
+	}
+
+	// List the other tools so the model knows when to reach for them
+	if defs := s.agentToolDefs(); len(defs) > 0 {
+		prompt.WriteString("\nYou can also call these functions when the user asks for them, along with or instead of `update_generation`:\n")
+		for _, def := range defs {
+			fmt.Fprintf(&prompt, "- `%s`: %s\n", def.Function.Name, def.Function.Description)
+		}
+	}
 
 	return prompt.String()
 }
 
 // sendErrorEvent sends an error event to the client via SSE.
-func (s *Server) sendErrorEvent(sessionID string, message string) {
-	_ = s.broker.SendEvent(sessionID, EventError, map[string]string{
+// chatID scopes the error to a chat as in sendChatEvent; pass "" for errors
+// raised before a chat is resolved.
+func (s *Server) sendErrorEvent(sessionID string, chatID string, message string) {
+	_ = s.sendChatEvent(sessionID, chatID, EventError, map[string]string{
 		"message": message,
 	})
 }
@@ -754,7 +1410,8 @@ func generateFallbackResponse() string {
 //
 // The compaction strategy is rule-based (not LLM-based): it extracts key words
 // from user messages to summarize what the user wants. This reduces cognitive
-// load on the LLM.
+// load on the LLM. With --llm-summarize, chatWithRetry asks the LLM for the
+// summary instead and falls back to this if that fails.
 //
 // Parameters:
 //   - messages: Full conversation history
@@ -835,6 +1492,12 @@ func (s *Server) compactContext(messages []ollama.Message) []ollama.Message {
 		content = content[:maxSummaryLen] + "..."
 	}
 
+	return compactedContext(content)
+}
+
+// compactedContext builds the compacted context for compactContext from a
+// summary of what the user wants.
+func compactedContext(content string) []ollama.Message {
 	// Build compacted system message
 	// WHY INCLUDE USER SUMMARY: The LLM still needs to know what the user wants
 	// to generate a valid prompt. The summary preserves this context while
@@ -858,16 +1521,58 @@ Set generate_image to true if you have enough information to create a prompt, fa
 	}
 }
 
+// contextReplyReserve is the part of the model's context window kept free
+// for its reply when trimming the conversation.
+const contextReplyReserve = 1024
+
+// contextBudget returns the tokens the conversation may use in a chat
+// request: the session model's context window less the reply reserve, the
+// new user message and the tool definitions. Returns 0 (no limit) if the
+// LLM client cannot report its context window.
+func (s *Server) contextBudget(ctx context.Context, session *conversation.Session, userMessage conversation.Message, tools []ollama.Tool) int {
+	sizer, ok := s.llmClient.(llm.ContextSizer)
+	if !ok {
+		return 0
+	}
+	contextLength, err := sizer.ContextLength(ctx, session.Model())
+	if err != nil {
+		log.Printf("Failed to get LLM context length, not trimming context: %v", err)
+		return 0
+	}
+
+	toolTokens := 0
+	if data, err := json.Marshal(tools); err == nil {
+		toolTokens = conversation.EstimateTokens(conversation.Message{Content: string(data)})
+	}
+	// Always pass a positive budget so a tiny window drops history rather
+	// than lifting the limit
+	return max(contextLength-contextReplyReserve-conversation.EstimateTokens(userMessage)-toolTokens, 1)
+}
+
+// recordUsage stores the token usage of a reply on its message, if the LLM
+// reported any.
+func (s *Server) recordUsage(manager *conversation.Manager, sessionID string, messageID int, usage ollama.Usage) {
+	if usage == (ollama.Usage{}) {
+		return
+	}
+	manager.SetMessageUsage(messageID, usage)
+	log.Printf("Token usage for session %s message %d: prompt=%d, completion=%d",
+		sessionID, messageID, usage.PromptTokens, usage.CompletionTokens)
+}
+
 // chatWithRetry calls the ollama client's Chat method with automatic retry
 // on context overflow errors.
 //
 // This implements context compaction recovery: when the conversation context
 // becomes too large or the LLM fails to respond properly, we compact the
-// conversation history into a summary and retry once.
+// conversation history into a summary and retry once. If that fails too and
+// --llm-fallback-model is set, the compacted history is sent to the fallback
+// model as a last attempt.
 //
 // Parameters:
 //   - ctx: Context for cancellation and timeout
 //   - sessionID: Session ID for SSE event routing
+//   - chatID: Chat the image belongs to; events are dropped if it is not active
 //   - messages: Conversation history
 //   - seed: Optional seed for deterministic responses
 //   - tools: Function calling tools to send with the request
@@ -879,12 +1584,14 @@ Set generate_image to true if you have enough information to create a prompt, fa
 //
 // Retry behavior:
 //   - Missing fields errors trigger compaction retry (likely context issue)
-//   - Other errors (connection, timeout, etc.) are returned immediately
-//   - Maximum 2 total attempts (initial + 1 compaction retry)
+//   - Connection errors are retried with backoff by chatWithReconnect
+//   - Other errors are returned immediately
+//   - Maximum 2 attempts with distinct contexts (initial + 1 compaction retry),
+//     plus 1 with the fallback model if the compaction retry has missing fields
 //   - Retry count is per-request, not cumulative across conversation
-func (s *Server) chatWithRetry(ctx context.Context, sessionID string, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error) {
+func (s *Server) chatWithRetry(ctx context.Context, sessionID string, chatID string, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error) {
 	// Try initial request
-	result, err := s.ollamaClient.Chat(ctx, messages, seed, tools, callback)
+	result, err := s.chatWithReconnect(ctx, sessionID, chatID, messages, seed, tools, callback)
 	if err == nil {
 		return result, nil
 	}
@@ -904,13 +1611,20 @@ func (s *Server) chatWithRetry(ctx context.Context, sessionID string, messages [
 	log.Printf("Missing fields error, trying context compaction: %v", err)
 
 	// Send retry event to UI so it can clear the partial streaming message
-	_ = s.broker.SendEvent(sessionID, EventAgentRetry, map[string]int{
+	_ = s.sendChatEvent(sessionID, chatID, EventAgentRetry, map[string]int{
 		"attempt": 2, // Compaction retry attempt
 	})
 
 	// Compact conversation context to reduce cognitive load
 	compactedMessages := s.compactContext(messages)
-	result, compactErr := s.ollamaClient.Chat(ctx, compactedMessages, seed, tools, callback)
+	if s.llmSummarize {
+		if summary, err := s.summarize(ctx, "", messages); err != nil {
+			log.Printf("Failed to summarize conversation, using keywords: %v", err)
+		} else {
+			compactedMessages = compactedContext(summary)
+		}
+	}
+	result, compactErr := s.chatWithReconnect(ctx, sessionID, chatID, compactedMessages, seed, tools, callback)
 
 	if compactErr == nil {
 		// Compaction retry succeeded
@@ -918,9 +1632,25 @@ func (s *Server) chatWithRetry(ctx context.Context, sessionID string, messages [
 		return result, nil
 	}
 
-	// Compaction retry failed - return the error
 	log.Printf("Context compaction retry failed: %v", compactErr)
-	return ollama.ChatResult{}, compactErr
+	if !errors.Is(compactErr, ollama.ErrMissingFields) || s.fallbackModel == "" || s.fallbackModel == ollama.ModelFromContext(ctx) {
+		return ollama.ChatResult{}, compactErr
+	}
+
+	// WHY A FALLBACK MODEL: a model that keeps leaving out fields despite a
+	// short context is unlikely to manage on a third try, but a smaller,
+	// more format-reliable model often does
+	log.Printf("Retrying session %s with fallback model %s", sessionID, s.fallbackModel)
+	_ = s.sendChatEvent(sessionID, chatID, EventAgentRetry, map[string]int{
+		"attempt": 3, // Fallback model attempt
+	})
+	result, fallbackErr := s.chatWithReconnect(ollama.WithModel(ctx, s.fallbackModel), sessionID, chatID, compactedMessages, seed, tools, callback)
+	if fallbackErr != nil {
+		log.Printf("Fallback model retry failed: %v", fallbackErr)
+		return ollama.ChatResult{}, fallbackErr
+	}
+	log.Printf("Fallback model retry succeeded")
+	return result, nil
 }
 
 // handlePrompt handles prompt updates from the user.
@@ -993,6 +1723,7 @@ func (s *Server) handleNewChat(w http.ResponseWriter, r *http.Request) {
 // Parameters:
 //   - ctx: Context for cancellation and timeout
 //   - sessionID: Session ID for SSE event routing
+//   - chatID: Chat the image belongs to; events are dropped if it is not active
 //   - prompt: Image generation prompt (already validated and truncated)
 //   - steps: Number of inference steps (1-100)
 //   - cfg: CFG scale (0-20)
@@ -1001,7 +1732,161 @@ func (s *Server) handleNewChat(w http.ResponseWriter, r *http.Request) {
 //
 // Returns:
 //   - error: Connection or generation error (for HTTP status code handling in handleGenerate)
-func (s *Server) generateImage(ctx context.Context, sessionID string, prompt string, steps int, cfg float64, seed int64, messageID int) error {
+func (s *Server) generateImage(ctx context.Context, sessionID string, chatID string, prompt string, steps int, cfg float64, seed int64, messageID int) error {
+	img, err := s.renderImage(ctx, sessionID, chatID, prompt, steps, cfg, seed, messageID)
+	if err != nil {
+		return err
+	}
+
+	// Determine storage strategy based on message ID
+	var imageURL string
+	if messageID > 0 {
+		// Save to persistent session-specific storage
+		if err := s.imageStore.Save(sessionID, messageID, img.png); err != nil {
+			log.Printf("Failed to save session image for session %s, message %d: %v", sessionID, messageID, err)
+			if errors.Is(err, persistence.ErrQuotaExceeded) {
+				s.sendErrorEvent(sessionID, chatID, storageFullMessage)
+			} else {
+				s.sendErrorEvent(sessionID, chatID, "Failed to save image. Please try again.")
+			}
+			err = fmt.Errorf("failed to save session image: %w", err)
+			s.fireGenerateFailed(ctx, img.hookPayload, err)
+			return err
+		}
+
+		// The message may have been deleted while generating. Checking after
+		// the save means either this or the delete handler removes the file.
+		session := s.sessionManager.GetSession(sessionID)
+		manager := session.ChatManager(chatID)
+		if manager == nil || manager.GetMessage(messageID) == nil {
+			log.Printf("Discarding image for deleted message %d in session %s", messageID, sessionID)
+			if err := s.imageStore.Delete(sessionID, messageID); err != nil {
+				log.Printf("Failed to delete image for session %s, message %d: %v", sessionID, messageID, err)
+			}
+			return nil
+		}
+
+		// Update message preview status to complete
+		manager.UpdateMessagePreview(messageID, conversation.PreviewStatusComplete, s.imageStore.GetURL(sessionID, messageID))
+		manager.SetMessageSettings(messageID, steps, cfg, seed)
+		if img.seed > 0 {
+			manager.SetMessageImageSeed(messageID, img.seed)
+		}
+		manager.SetMessageGeneration(messageID, img.generation)
+
+		imageURL = s.imageStore.GetURL(sessionID, messageID)
+		log.Printf("Saved image to session storage: %s", imageURL)
+
+		// Name the session once it has its first image
+		s.titleSessionAsync(ctx, sessionID, session, manager)
+	} else {
+		// Use in-memory storage (fallback for legacy/non-message generation)
+		imageID, err := s.imageStorage.Store(sessionID, img.png, img.width, img.height)
+		if err != nil {
+			log.Printf("Failed to store image for session %s: %v", sessionID, err)
+			if errors.Is(err, image.ErrImageTooLarge) {
+				s.sendErrorEvent(sessionID, chatID, "Image is too large to store")
+			} else {
+				s.sendErrorEvent(sessionID, chatID, "Failed to store image. Please try again.")
+			}
+			err = fmt.Errorf("failed to store image: %w", err)
+			s.fireGenerateFailed(ctx, img.hookPayload, err)
+			return err
+		}
+		imageURL = fmt.Sprintf("/images/%s.png", imageID)
+	}
+
+	// Run post-save hooks; in-memory images have no file path
+	hookPayload := img.hookPayload
+	hookPayload.Event = hooks.EventPostSave
+	hookPayload.ImageURL = imageURL
+	if messageID > 0 {
+		hookPayload.ImagePath = s.imageStore.GetPath(sessionID, messageID)
+	}
+	if err := s.hooks.Fire(ctx, hookPayload); err != nil {
+		log.Printf("Post-save hook failed for session %s: %v", sessionID, err)
+	}
+
+	log.Printf("Generated image for session %s: %dx%d in %dms",
+		sessionID, img.width, img.height, img.generationTime)
+
+	// Send image-ready event with message ID
+	_ = s.sendChatEvent(sessionID, chatID, EventImageReady, ImageReadyData{
+		URL:       imageURL,
+		Width:     img.width,
+		Height:    img.height,
+		MessageID: messageID,
+		Seed:      max(img.seed, 0),
+	})
+
+	return nil
+}
+
+// renderedImage is a generated image that has not been stored yet.
+type renderedImage struct {
+	png            []byte
+	width          int
+	height         int
+	generationTime uint32
+
+	// seed the image was generated with: the one compute picked for a
+	// random seed, or the requested one if compute did not say
+	seed int64
+
+	// generation is how compute generated the image, nil if it did not say
+	generation *conversation.GenerationMetadata
+
+	// hookPayload describes the generation for post-save hooks.
+	hookPayload hooks.Payload
+}
+
+// generationMetadata converts the metadata of a generate response for the
+// message snapshot. Returns nil for nil.
+func generationMetadata(m *protocol.GenerationMetadata) *conversation.GenerationMetadata {
+	if m == nil {
+		return nil
+	}
+	return &conversation.GenerationMetadata{
+		ModelHash:    m.ModelHash,
+		Sampler:      m.Sampler,
+		Scheduler:    m.Scheduler,
+		TextEncodeMS: int64(m.TextEncodeMS),
+		DiffusionMS:  int64(m.DiffusionMS),
+		VAEMS:        int64(m.VAEMS),
+	}
+}
+
+// renderImage runs a generation request on the compute process and encodes
+// the result as PNG. Pre- and post-generate hooks are fired; storing the image
+// is left to the caller. Errors are sent to the session via SSE and fire
+// generate-failed hooks before being returned.
+func (s *Server) renderImage(ctx context.Context, sessionID string, chatID string, prompt string, steps int, cfg float64, seed int64, messageID int) (renderedImage, error) {
+	img, err := s.computeImage(ctx, sessionID, chatID, prompt, steps, cfg, seed, messageID)
+	if err != nil {
+		s.fireGenerateFailed(ctx, hooks.Payload{
+			SessionID: sessionID,
+			MessageID: messageID,
+			Prompt:    prompt,
+			Steps:     steps,
+			CFG:       cfg,
+			Seed:      seed,
+		}, err)
+	}
+	return img, err
+}
+
+// fireGenerateFailed runs generate-failed hooks for a generation described
+// by payload. Hook errors are logged.
+func (s *Server) fireGenerateFailed(ctx context.Context, payload hooks.Payload, cause error) {
+	payload.Event = hooks.EventGenerateFailed
+	payload.Error = cause.Error()
+	if err := s.hooks.Fire(ctx, payload); err != nil {
+		log.Printf("Generate-failed hook failed for session %s: %v", payload.SessionID, err)
+	}
+}
+
+// computeImage does the work of renderImage.
+func (s *Server) computeImage(ctx context.Context, sessionID string, chatID string, prompt string, steps int, cfg float64, seed int64, messageID int) (renderedImage, error) {
 	// Truncate prompt if it exceeds maximum length
 	// This works around the CLIP/T5 token mismatch bug in stable-diffusion.cpp
 	// where T5 producing more tokens than CLIP causes GGML assertion failures.
@@ -1021,15 +1906,21 @@ func (s *Server) generateImage(ctx context.Context, sessionID string, prompt str
 			originalLen, len(prompt), sessionID)
 	}
 
-	log.Printf("Generation settings for session %s: steps=%d, cfg=%.2f, seed=%d",
-		sessionID, steps, cfg, seed)
+	// The session's resolution, fitted to what the GPU can decode
+	genWidth, genHeight := s.generateSize(sessionID)
+	width, height := uint32(genWidth), uint32(genHeight)
+
+	log.Printf("Generation settings for session %s (request %s): steps=%d, cfg=%.2f, seed=%d, size=%dx%d",
+		sessionID, requestid.FromContext(ctx), steps, cfg, seed, width, height)
 
-	// Generate unique request ID
-	reqID := atomic.AddUint64(&s.requestID, 1)
+	// Generate a unique frame ID, derived from the HTTP request ID when there
+	// is one so compute logs can be matched to the request
+	reqID, ok := requestid.NextFrameID(ctx)
+	if !ok {
+		reqID = atomic.AddUint64(&s.requestID, 1)
+	}
 
 	// Create protocol request
-	// 768x768 balances quality and VRAM usage; 1024x1024 causes OOM during VAE decode
-	width, height := uint32(768), uint32(768)
 	cfgScale := float32(cfg)
 
 	// Convert seed to uint64 for protocol
@@ -1042,53 +1933,121 @@ func (s *Server) generateImage(ctx context.Context, sessionID string, prompt str
 	protoReq, err := protocol.NewSD35GenerateRequest(reqID, prompt, width, height, uint32(steps), cfgScale, seedValue)
 	if err != nil {
 		log.Printf("Failed to create protocol request for session %s: %v", sessionID, err)
-		s.sendErrorEvent(sessionID, "Failed to create generation request: invalid prompt")
-		return fmt.Errorf("failed to create protocol request: %w", err)
+		s.sendErrorEvent(sessionID, chatID, "Failed to create generation request: invalid prompt")
+		return renderedImage{}, fmt.Errorf("failed to create protocol request: %w", err)
+	}
+	// The session's image model; compute swaps it into VRAM if another is loaded
+	// and the LoRAs the agent chose
+	if sessionID != "" {
+		session := s.sessionManager.GetSession(sessionID)
+		protoReq.ModelID = session.DiffusionModel()
+		protoReq.LoRAs = sessionLoRAs(session)
+	}
+	// Decode in tiles if --vae-tiling allowed a size that needs it
+	protoReq.VAETiling = s.vaeTiling
+	priority := priorityFromContext(ctx)
+	protoReq.Priority = priority
+
+	// Encode request, as img2img if the generation starts from an image,
+	// or guided by the session's control image if it has one
+	var requestData []byte
+	var control conversation.Control
+	hasControl := false
+	if sessionID != "" {
+		control, hasControl = s.sessionManager.GetSession(sessionID).Control()
+	}
+	if initImg, ok := initImageFromContext(ctx); ok {
+		requestData, err = encodeImg2ImgRequest(protoReq, initImg)
+	} else if hasControl {
+		requestData, err = s.encodeControlRequest(protoReq, sessionID, control)
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Control image %s of session %s is gone", control.UploadID, sessionID)
+			s.sendErrorEvent(sessionID, chatID, "The control image of this chat is no longer available. Set another one.")
+			return renderedImage{}, fmt.Errorf("failed to encode request: %w", err)
+		}
+	} else {
+		requestData, err = protocol.EncodeSD35GenerateRequest(protoReq)
 	}
-
-	// Encode request
-	requestData, err := protocol.EncodeSD35GenerateRequest(protoReq)
 	if err != nil {
 		log.Printf("Failed to encode protocol request for session %s: %v", sessionID, err)
-		s.sendErrorEvent(sessionID, "Failed to encode generation request")
-		return fmt.Errorf("failed to encode request: %w", err)
+		s.sendErrorEvent(sessionID, chatID, "Failed to encode generation request")
+		return renderedImage{}, fmt.Errorf("failed to encode request: %w", err)
+	}
+	// The header's message type says which kind of request was encoded
+	if reason := s.unsupportedByCompute(binary.BigEndian.Uint16(requestData[6:8]), width, height); reason != "" {
+		log.Printf("Compute process can't carry out the request of session %s: %s", sessionID, reason)
+		s.sendErrorEvent(sessionID, chatID, reason)
+		return renderedImage{}, fmt.Errorf("%w: %s", errComputeUnsupported, reason)
+	}
+
+	// Check the prompt against the content rules before hooks or compute
+	// see it
+	if err := s.moderatePrompt(ctx, sessionID, chatID, messageID, prompt); err != nil {
+		return renderedImage{}, err
+	}
+
+	// Run pre-generate hooks; a failing hook cancels generation
+	if err := s.hooks.Fire(ctx, hooks.Payload{
+		Event:     hooks.EventPreGenerate,
+		SessionID: sessionID,
+		MessageID: messageID,
+		Prompt:    prompt,
+		Steps:     steps,
+		CFG:       cfg,
+		Seed:      seed,
+		Width:     int(width),
+		Height:    int(height),
+	}); err != nil {
+		log.Printf("Pre-generate hook cancelled generation for session %s: %v", sessionID, err)
+		s.sendErrorEvent(sessionID, chatID, "Image generation was cancelled by a plugin hook.")
+		return renderedImage{}, fmt.Errorf("pre-generate hook failed: %w", err)
 	}
 
 	// Use persistent compute connection
 	if s.computeClient == nil {
 		log.Printf("Compute client not available for session %s", sessionID)
-		s.sendErrorEvent(sessionID, "Image generation is not available (compute process not connected)")
-		return client.ErrComputeNotRunning
+		s.sendErrorEvent(sessionID, chatID, "Image generation is not available (compute process not connected)")
+		return renderedImage{}, client.ErrComputeNotRunning
 	}
 
+	// Wait for compute to be free before the generation timeout starts
+	release, err := s.generations.acquire(ctx, sessionID, priority, s.computeSlots(), s.queuePositionNotifier(sessionID, chatID, messageID))
+	if err != nil {
+		log.Printf("Generation for session %s cancelled while queued: %v", sessionID, err)
+		s.sendErrorEvent(sessionID, chatID, "Image generation was cancelled while waiting for its turn.")
+		return renderedImage{}, fmt.Errorf("generation cancelled while queued: %w", err)
+	}
+	defer release()
+
 	// Send request and receive response over persistent connection
-	genCtx, cancel := context.WithTimeout(ctx, 120*time.Second) // 2 min timeout for generation
+	timeout := s.generationTimeout(steps, width, height)
+	genCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	responseData, err := s.computeClient.Send(genCtx, requestData)
+	genStart := time.Now()
+	responseData, err := s.computeClient.SendWithPreviews(genCtx, requestData, s.previewForwarder(sessionID, chatID, messageID))
 	if err != nil {
-		log.Printf("Failed to send request to compute process for session %s: %v", sessionID, err)
-		if errors.Is(err, client.ErrConnectionClosed) || errors.Is(err, client.ErrReaderDead) {
-			s.sendErrorEvent(sessionID, "Connection to image generation service was closed")
-		} else if errors.Is(err, client.ErrReadTimeout) {
-			s.sendErrorEvent(sessionID, "Image generation timed out. Try a simpler prompt.")
-		} else {
-			s.sendErrorEvent(sessionID, "Failed to generate image")
-		}
-		return fmt.Errorf("failed to send request: %w", err)
+		log.Printf("Failed to send request to compute process for session %s (timeout %s): %v", sessionID, timeout, err)
+		s.sendErrorEvent(sessionID, chatID, generationErrorMessage(ctx, err, timeout))
+		return renderedImage{}, fmt.Errorf("failed to send request: %w", err)
 	}
 
 	// Decode response
 	response, err := protocol.DecodeResponse(responseData)
 	if err != nil {
 		log.Printf("Failed to decode response for session %s: %v", sessionID, err)
-		s.sendErrorEvent(sessionID, "Failed to decode image generation response")
-		return fmt.Errorf("failed to decode response: %w", err)
+		s.sendErrorEvent(sessionID, chatID, "Failed to decode image generation response")
+		return renderedImage{}, fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	// Handle response type
 	switch resp := response.(type) {
 	case *protocol.SD35GenerateResponse:
+		// Compute reports the seed it picked when asked for a random one
+		if resp.Seed != 0 && resp.Seed <= math.MaxInt64 {
+			seed = int64(resp.Seed)
+		}
+
 		// Success - convert raw pixels to PNG
 		var format image.PixelFormat
 		if resp.Channels == 3 {
@@ -1097,69 +2056,79 @@ func (s *Server) generateImage(ctx context.Context, sessionID string, prompt str
 			format = image.FormatRGBA
 		}
 
-		pngData, err := image.EncodePNG(int(resp.ImageWidth), int(resp.ImageHeight), resp.ImageData, format)
-		if err != nil {
-			log.Printf("Failed to encode PNG for session %s: %v", sessionID, err)
-			s.sendErrorEvent(sessionID, "Failed to encode generated image")
-			return fmt.Errorf("failed to encode PNG: %w", err)
-		}
-
-		// Determine storage strategy based on message ID
-		var imageURL string
-		if messageID > 0 {
-			// Save to persistent session-specific storage
-			if err := s.imageStore.Save(sessionID, messageID, pngData); err != nil {
-				log.Printf("Failed to save session image for session %s, message %d: %v", sessionID, messageID, err)
-				s.sendErrorEvent(sessionID, "Failed to save image. Please try again.")
-				return fmt.Errorf("failed to save session image: %w", err)
-			}
-
-			// Update message preview status to complete
-			session := s.sessionManager.GetSession(sessionID)
-			manager := session.Manager()
-			manager.UpdateMessagePreview(messageID, conversation.PreviewStatusComplete, s.imageStore.GetURL(sessionID, messageID))
-
-			imageURL = s.imageStore.GetURL(sessionID, messageID)
-			log.Printf("Saved image to session storage: %s", imageURL)
-		} else {
-			// Use in-memory storage (fallback for legacy/non-message generation)
-			imageID, err := s.imageStorage.Store(pngData, int(resp.ImageWidth), int(resp.ImageHeight))
+		// Inpainting keeps the init image outside the mask
+		pixels := resp.ImageData
+		if initImg, ok := initImageFromContext(ctx); ok && initImg.mask != nil && format == image.FormatRGB {
+			composited, err := compositeInpaint(initImg, int(resp.ImageWidth), int(resp.ImageHeight), pixels)
 			if err != nil {
-				log.Printf("Failed to store image for session %s: %v", sessionID, err)
-				if errors.Is(err, image.ErrImageTooLarge) {
-					s.sendErrorEvent(sessionID, "Image is too large to store")
-				} else {
-					s.sendErrorEvent(sessionID, "Failed to store image. Please try again.")
-				}
-				return fmt.Errorf("failed to store image: %w", err)
+				log.Printf("Failed to composite inpainted image for session %s, keeping it as generated: %v", sessionID, err)
+			} else {
+				pixels = composited
 			}
-			imageURL = fmt.Sprintf("/images/%s.png", imageID)
 		}
 
-		log.Printf("Generated image for session %s: %dx%d in %dms",
-			sessionID, resp.ImageWidth, resp.ImageHeight, resp.GenerationTime)
+		pngData, err := image.EncodePNG(int(resp.ImageWidth), int(resp.ImageHeight), pixels, format)
+		if err != nil {
+			log.Printf("Failed to encode PNG for session %s: %v", sessionID, err)
+			s.sendErrorEvent(sessionID, chatID, "Failed to encode generated image")
+			return renderedImage{}, fmt.Errorf("failed to encode PNG: %w", err)
+		}
+		generationDuration.ObserveSince(genStart)
 
-		// Send image-ready event with message ID
-		_ = s.broker.SendEvent(sessionID, EventImageReady, ImageReadyData{
-			URL:       imageURL,
+		hookPayload := hooks.Payload{
+			SessionID: sessionID,
+			MessageID: messageID,
+			Prompt:    prompt,
+			Steps:     steps,
+			CFG:       cfg,
+			Seed:      seed,
 			Width:     int(resp.ImageWidth),
 			Height:    int(resp.ImageHeight),
-			MessageID: messageID,
-		})
+		}
+
+		// Run post-generate hooks; failures are logged but do not discard the image
+		hookPayload.Event = hooks.EventPostGenerate
+		if err := s.hooks.Fire(ctx, hookPayload); err != nil {
+			log.Printf("Post-generate hook failed for session %s: %v", sessionID, err)
+		}
+
+		return renderedImage{
+			png:            pngData,
+			width:          int(resp.ImageWidth),
+			height:         int(resp.ImageHeight),
+			generationTime: resp.GenerationTime,
+			seed:           seed,
+			generation:     generationMetadata(resp.Metadata),
+			hookPayload:    hookPayload,
+		}, nil
 
 	case *protocol.ErrorResponse:
 		log.Printf("Compute process error for session %s: code=%d, msg=%s",
 			sessionID, resp.ErrorCode, resp.ErrorMessage)
-		s.sendErrorEvent(sessionID, fmt.Sprintf("Image generation failed: %s", resp.ErrorMessage))
-		return fmt.Errorf("compute error: %s", resp.ErrorMessage)
+		if resp.ErrorCode == protocol.ErrCodeModelUnavailable {
+			s.sendErrorEvent(sessionID, chatID, "The selected image model is not installed or failed to load.")
+			return renderedImage{}, fmt.Errorf("%w: %s", protocol.ErrModelUnavailable, resp.ErrorMessage)
+		}
+		if resp.ErrorCode == protocol.ErrCodeInvalidLoRA {
+			s.sendErrorEvent(sessionID, chatID, "A LoRA of this chat is not installed for the image generator.")
+			return renderedImage{}, fmt.Errorf("%w: %s", protocol.ErrInvalidLoRA, resp.ErrorMessage)
+		}
+		if resp.ErrorCode == protocol.ErrCodeControlNetUnavailable {
+			s.sendErrorEvent(sessionID, chatID, "The selected image model has no ControlNet installed for this control image.")
+			return renderedImage{}, fmt.Errorf("%w: %s", protocol.ErrControlNetUnavailable, resp.ErrorMessage)
+		}
+		if resp.ErrorCode == protocol.ErrCodeInvalidControl {
+			s.sendErrorEvent(sessionID, chatID, "The control image of this chat was rejected by the image generator.")
+			return renderedImage{}, fmt.Errorf("%w: %s", protocol.ErrInvalidControl, resp.ErrorMessage)
+		}
+		s.sendErrorEvent(sessionID, chatID, fmt.Sprintf("Image generation failed: %s", resp.ErrorMessage))
+		return renderedImage{}, fmt.Errorf("compute error: %s", resp.ErrorMessage)
 
 	default:
 		log.Printf("Unexpected response type for session %s: %T", sessionID, response)
-		s.sendErrorEvent(sessionID, "Unexpected response from image generation service")
-		return fmt.Errorf("unexpected response type: %T", response)
+		s.sendErrorEvent(sessionID, chatID, "Unexpected response from image generation service")
+		return renderedImage{}, fmt.Errorf("unexpected response type: %T", response)
 	}
-
-	return nil
 }
 
 // handleGenerate handles image generation requests.
@@ -1172,14 +2141,14 @@ func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
 
 	// SECURITY: Check rate limit
-	if !s.rateLimiter.allowGenerate(sessionID) {
+	limit := s.rateLimiter.takeGenerate(sessionID)
+	if !limit.allowed {
 		log.Printf("Rate limit exceeded for session %s (generate)", sessionID)
-		s.sendErrorEvent(sessionID, "Too many generation requests. Please wait a moment.")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusTooManyRequests)
-		fmt.Fprintf(w, `{"status":"error","message":"rate limit exceeded"}`)
+		s.sendErrorEvent(sessionID, "", "Too many generation requests. Please wait a moment.")
+		writeRateLimited(w, limit)
 		return
 	}
+	limit.setHeaders(w)
 
 	// Parse form data to get prompt from request
 	if err := r.ParseForm(); err != nil {
@@ -1190,9 +2159,13 @@ func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get session for this request
+	// Get session and pin the target chat for this request
 	session := s.sessionManager.GetSession(sessionID)
-	manager := session.Manager()
+	chatID, manager := resolveChat(session, r.FormValue("chat_id"))
+	if manager == nil {
+		writeChatNotFound(w)
+		return
+	}
 
 	// Get prompt from request, fall back to stored prompt
 	// The request includes the prompt to avoid race conditions when the
@@ -1207,7 +2180,7 @@ func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if prompt == "" {
-		s.sendErrorEvent(sessionID, "No prompt available. Chat with the agent first to create a prompt.")
+		s.sendErrorEvent(sessionID, chatID, "No prompt available. Chat with the agent first to create a prompt.")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, `{"status":"ok","session_id":"%s"}`, sessionID)
@@ -1231,8 +2204,25 @@ func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// An init image makes this an img2img generation
+	ctx := r.Context()
+	initImg, ok, err := s.parseInitImage(r, sessionID)
+	if err != nil {
+		log.Printf("Invalid init image for session %s: %v", sessionID, err)
+		if errors.Is(err, errInitImageNotFound) {
+			writeJSONError(w, http.StatusNotFound, "init image or mask not found")
+		} else {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+	if ok {
+		ctx = withInitImage(ctx, initImg)
+	}
+
 	// Store settings in session for consistency
 	session.SetGenerationSettings(int(steps), cfg, seed)
+	parseResolution(r, session)
 
 	// Send generation-started event with message ID if provided
 	eventData := map[string]interface{}{
@@ -1241,12 +2231,17 @@ func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
 	if messageID > 0 {
 		eventData["message_id"] = messageID
 	}
-	_ = s.broker.SendEvent(sessionID, EventGenerationStarted, eventData)
+	_ = s.sendChatEvent(sessionID, chatID, EventGenerationStarted, eventData)
 
 	// Call shared generation logic
-	err := s.generateImage(r.Context(), sessionID, prompt, int(steps), cfg, seed, messageID)
+	err = s.generateImage(withPriority(ctx, protocol.PriorityHigh), sessionID, chatID, prompt, int(steps), cfg, seed, messageID)
 	if err != nil {
 		// Error already sent via SSE and logged
+		if status, message, ok := moderationError(err); ok {
+			writeJSONError(w, status, message)
+			return
+		}
+
 		// Determine appropriate HTTP status code based on error type
 		var statusCode int
 		if errors.Is(err, client.ErrComputeNotRunning) || errors.Is(err, client.ErrXDGNotSet) {
@@ -1281,8 +2276,17 @@ func generatePlaceholderPixels(width, height int) []byte {
 	return pixels
 }
 
+// contentETag returns a strong ETag for an image's content hash.
+func contentETag(hash string) string {
+	return `"` + hash + `"`
+}
+
 // handleImage serves a generated image by ID.
-// GET /images/{id}
+// GET /images/{id}?format=&quality=
+//
+// The response carries an ETag and Last-Modified, so revalidation with
+// If-None-Match or If-Modified-Since is answered with 304 Not Modified.
+// The image is PNG unless another format is asked for (see imageFormat).
 func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
 	// Extract ID from path parameter
 	id := r.PathValue("id")
@@ -1294,8 +2298,14 @@ func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
 	// Remove .png extension if present
 	id = strings.TrimSuffix(id, ".png")
 
+	format, quality, err := s.imageFormat(r, image.OutputPNG)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Get image from storage
-	pngData, _, _, err := s.imageStorage.Get(id)
+	img, err := s.imageStorage.GetImage(id)
 	if err != nil {
 		if errors.Is(err, image.ErrNotFound) {
 			http.Error(w, "Image not found", http.StatusNotFound)
@@ -1309,19 +2319,12 @@ func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set headers for image serving
-	w.Header().Set("Content-Type", "image/png")
 	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
-
-	// Write PNG data
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(pngData); err != nil {
-		log.Printf("Failed to write image data for %s: %v", id, err)
-	}
+	serveImageAs(w, r, id+".png", img.CreatedAt, bytes.NewReader(img.Data), image.OutputPNG, img.Hash, format, quality)
 }
 
 // handleSessionImage serves a session-specific image by message ID.
-// GET /sessions/{sessionID}/images/{messageID}.png
+// GET /sessions/{sessionID}/images/{messageID}.png?format=&quality=
 func (s *Server) handleSessionImage(w http.ResponseWriter, r *http.Request) {
 	// SECURITY: Get authenticated session ID from context
 	authenticatedSessionID := GetSessionID(r.Context())
@@ -1339,10 +2342,9 @@ func (s *Server) handleSessionImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract message ID from filename (format: {messageID}.png)
-	messageIDStr := strings.TrimSuffix(filename, ".png")
-	if messageIDStr == filename {
-		// No .png extension found
+	// Extract message ID and alternate from filename
+	// (format: {messageID}.png or {messageID}-{alternate}.png)
+	if !strings.HasSuffix(filename, ".png") {
 		http.Error(w, "Invalid image filename (must be .png)", http.StatusBadRequest)
 		return
 	}
@@ -1355,40 +2357,222 @@ func (s *Server) handleSessionImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse message ID as integer
-	messageID, err := strconv.Atoi(messageIDStr)
-	if err != nil || messageID <= 0 {
+	messageID, alternate, err := parseSessionImageFilename(filename)
+	if err != nil {
 		http.Error(w, "Invalid message ID", http.StatusBadRequest)
 		return
 	}
 
-	// Load image from persistent storage
-	pngData, err := s.imageStore.Load(requestedSessionID, messageID)
+	// Stream the image from persistent storage rather than reading it into
+	// memory; ServeContent handles Range, If-None-Match, If-Modified-Since
+	// and sendfile. Only images served in another format than they are
+	// stored in are read whole.
+	var file *os.File
+	if alternate > 0 {
+		file, err = s.imageStore.OpenAlternate(requestedSessionID, messageID, alternate)
+	} else {
+		file, err = s.imageStore.Open(requestedSessionID, messageID)
+	}
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			http.Error(w, "Image not found", http.StatusNotFound)
 			return
 		}
-		log.Printf("Failed to load session image %s/%d: %v", requestedSessionID, messageID, err)
+		log.Printf("Failed to open session image %s/%d: %v", requestedSessionID, messageID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	stored := persistence.StoredFormat(file.Name())
+	format, quality, err := s.imageFormat(r, stored)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		log.Printf("Failed to stat session image %s/%d: %v", requestedSessionID, messageID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	hash, err := s.imageStore.ContentHash(file, info)
+	if err != nil {
+		log.Printf("Failed to hash session image %s/%d: %v", requestedSessionID, messageID, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Set headers for image serving
-	w.Header().Set("Content-Type", "image/png")
 	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	serveImageAs(w, r, filename, info.ModTime(), file, stored, hash, format, quality)
+}
 
-	// Write PNG data
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(pngData); err != nil {
-		log.Printf("Failed to write image data for session %s, message %d: %v", requestedSessionID, messageID, err)
+// handleDeleteImage removes a generated image from in-memory storage.
+// DELETE /images/{id}
+// Only the session that produced the image may delete it. Sends an
+// image-deleted event to that session so the UI can drop the thumbnail.
+func (s *Server) handleDeleteImage(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "Missing image ID", http.StatusBadRequest)
+		return
+	}
+
+	// Remove .png extension if present
+	id = strings.TrimSuffix(id, ".png")
+
+	owner, err := s.imageStorage.Owner(id)
+	if err != nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+
+	// SECURITY: Only the session that produced an image may delete it
+	if owner != sessionID {
+		log.Printf("SECURITY: Session %s attempted to delete image %s of session %s", sessionID, id, owner)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if !s.imageStorage.Delete(id) {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Deleted image %s for session %s", id, owner)
+
+	// In-memory images belong to no message
+	_ = s.broker.SendEvent(owner, EventImageDeleted, ImageDeletedData{
+		URL: fmt.Sprintf("/images/%s.png", id),
+	})
+
+	writeChatJSON(w, http.StatusOK, map[string]string{"status": "ok", "session_id": owner})
+}
+
+// handleDeleteSessionImage removes a session-specific image from persistent storage.
+// DELETE /sessions/{sessionID}/images/{filename}
+// The owning message's preview status is reset to "none" and an image-deleted
+// event is sent so the UI can drop the thumbnail.
+func (s *Server) handleDeleteSessionImage(w http.ResponseWriter, r *http.Request) {
+	requestedSessionID, messageID, ok := s.parseOwnedSessionImage(w, r)
+	if !ok {
+		return
+	}
+
+	if !s.imageStore.Exists(requestedSessionID, messageID) {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.deleteSessionImage(requestedSessionID, messageID); err != nil {
+		log.Printf("Failed to delete session image %s/%d: %v", requestedSessionID, messageID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Deleted session image %s/%d", requestedSessionID, messageID)
+
+	writeChatJSON(w, http.StatusOK, map[string]string{"status": "ok", "session_id": requestedSessionID})
+}
+
+// deleteSessionImage deletes a message's primary image along with its
+// gallery entry, favorite and tags, resets the message's preview so history
+// no longer points at the file, and sends an image-deleted event.
+func (s *Server) deleteSessionImage(sessionID string, messageID int) error {
+	if err := s.imageStore.Delete(sessionID, messageID); err != nil {
+		return err
+	}
+
+	// A deleted image can no longer be shown in the gallery
+	if _, err := s.galleryStore.Unpublish(sessionID, messageID); err != nil {
+		log.Printf("Failed to unpublish deleted image %s/%d: %v", sessionID, messageID, err)
+	}
+	if _, err := s.favoriteStore.Remove(sessionID, messageID); err != nil {
+		log.Printf("Failed to unfavorite deleted image %s/%d: %v", sessionID, messageID, err)
+	}
+	if err := s.tagIndex.Remove(sessionID, messageID); err != nil {
+		log.Printf("Failed to untag deleted image %s/%d: %v", sessionID, messageID, err)
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	if manager := session.ManagerForMessage(messageID); manager != nil {
+		manager.UpdateMessagePreview(messageID, conversation.PreviewStatusNone, "")
+	}
+
+	_ = s.broker.SendEvent(sessionID, EventImageDeleted, ImageDeletedData{
+		URL:       s.imageStore.GetURL(sessionID, messageID),
+		MessageID: messageID,
+	})
+	return nil
+}
+
+// handleDeleteMessage removes a message from the conversation.
+// DELETE /message/{id}
+// The message's image, alternates, gallery entry, favorite and tags are deleted
+// with it, and a message-deleted event is sent to the chat that owned it.
+func (s *Server) handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || messageID <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "invalid message ID")
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	chatID, manager := session.ChatForMessage(messageID)
+	if manager == nil {
+		writeJSONError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	if _, err := manager.DeleteMessage(messageID); err != nil {
+		// Deleted by a concurrent request
+		writeJSONError(w, http.StatusNotFound, "message not found")
+		return
+	}
+
+	// The message is already gone, so file cleanup failures only leave
+	// orphaned files behind
+	if err := s.imageStore.DeleteAll(sessionID, messageID); err != nil {
+		log.Printf("Failed to delete images for session %s, message %d: %v", sessionID, messageID, err)
+	}
+	if _, err := s.galleryStore.Unpublish(sessionID, messageID); err != nil {
+		log.Printf("Failed to unpublish deleted message %s/%d: %v", sessionID, messageID, err)
+	}
+	if _, err := s.favoriteStore.Remove(sessionID, messageID); err != nil {
+		log.Printf("Failed to unfavorite deleted message %s/%d: %v", sessionID, messageID, err)
 	}
+	if err := s.tagIndex.Remove(sessionID, messageID); err != nil {
+		log.Printf("Failed to untag deleted message %s/%d: %v", sessionID, messageID, err)
+	}
+
+	log.Printf("Deleted message %d for session %s", messageID, sessionID)
+
+	_ = s.sendChatEvent(sessionID, chatID, EventMessageDeleted, MessageDeletedData{
+		MessageID: messageID,
+		Prompt:    manager.GetCurrentPrompt(),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"status":"ok","session_id":"%s"}`, sessionID)
 }
 
-// setOllamaClientForTesting replaces the ollama client with a test mock.
+// setLLMClientForTesting replaces the LLM client with a test mock.
 // This is only used in tests to inject mock implementations.
-func (s *Server) setOllamaClientForTesting(client ollamaClient) {
-	s.ollamaClient = client
+func (s *Server) setLLMClientForTesting(client llm.Client) {
+	s.llmClient = client
 }
 
 // parseSteps parses the steps value from form data.
@@ -1447,6 +2631,20 @@ type messageStateResponse struct {
 	Seed          int64   `json:"seed"`
 	PreviewStatus string  `json:"preview_status"`
 	PreviewURL    string  `json:"preview_url"`
+
+	// ImageSeed is the seed the preview was generated with, if known
+	ImageSeed int64 `json:"image_seed,omitempty"`
+
+	// Generation is how compute generated the preview, if it said
+	Generation *conversation.GenerationMetadata `json:"generation,omitempty"`
+
+	// Usage is the token count of the LLM request behind the message;
+	// ChatUsage sums it over the messages in the chat's history
+	Usage     *ollama.Usage `json:"usage,omitempty"`
+	ChatUsage ollama.Usage  `json:"chat_usage"`
+
+	// Model is the LLM model that wrote the message, if recorded
+	Model string `json:"model,omitempty"`
 }
 
 // handleMessageState handles requests to load historical message state.
@@ -1469,19 +2667,22 @@ func (s *Server) handleMessageState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get session and manager
+	// Look up message by ID in whichever chat holds it
 	session := s.sessionManager.GetSession(sessionID)
-	manager := session.Manager()
-
-	// Look up message by ID
+	manager := session.ManagerForMessage(messageID)
+	if manager == nil {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
 	msg := manager.GetMessage(messageID)
 	if msg == nil {
 		http.Error(w, "Message not found", http.StatusNotFound)
 		return
 	}
 
-	// Check if message has a snapshot
-	if msg.Snapshot == nil {
+	// Check if message has a snapshot; conversational replies only have
+	// their token usage to report
+	if msg.Snapshot == nil && msg.Usage == nil {
 		http.Error(w, "Message has no snapshot", http.StatusNotFound)
 		return
 	}
@@ -1489,12 +2690,20 @@ func (s *Server) handleMessageState(w http.ResponseWriter, r *http.Request) {
 	// Build response from snapshot
 	response := messageStateResponse{
 		MessageID:     msg.ID,
-		Prompt:        msg.Snapshot.Prompt,
-		Steps:         msg.Snapshot.Steps,
-		CFG:           msg.Snapshot.CFG,
-		Seed:          msg.Snapshot.Seed,
-		PreviewStatus: msg.Snapshot.PreviewStatus,
-		PreviewURL:    msg.Snapshot.PreviewURL,
+		PreviewStatus: conversation.PreviewStatusNone,
+		Usage:         msg.Usage,
+		ChatUsage:     manager.TokenUsage(),
+		Model:         msg.Model,
+	}
+	if msg.Snapshot != nil {
+		response.Prompt = msg.Snapshot.Prompt
+		response.Steps = msg.Snapshot.Steps
+		response.CFG = msg.Snapshot.CFG
+		response.Seed = msg.Snapshot.Seed
+		response.PreviewStatus = msg.Snapshot.PreviewStatus
+		response.PreviewURL = msg.Snapshot.PreviewURL
+		response.ImageSeed = msg.Snapshot.ImageSeed
+		response.Generation = msg.Snapshot.Generation
 	}
 
 	// Return JSON response
@@ -1506,11 +2715,3 @@ func (s *Server) handleMessageState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
-
-// handleReady is a health check endpoint for Electron.
-// Returns HTTP 200 with JSON {"status":"ready"} when the server is ready.
-func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ready"}`)
-}
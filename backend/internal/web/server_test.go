@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -141,6 +142,8 @@ func TestServer_Routes(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+			req.Header.Set(CSRFHeaderName, s.csrfToken(testGallerySessionID))
 			w := httptest.NewRecorder()
 
 			s.server.Handler.ServeHTTP(w, req)
@@ -615,8 +618,24 @@ func TestServer_APIEndpoints_Integration(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			// Load the page first, as the UI does, for a session cookie and
+			// its CSRF token
+			page := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(page, httptest.NewRequest("GET", "/", nil))
+			var sessionCookie *http.Cookie
+			for _, cookie := range page.Result().Cookies() {
+				if cookie.Name == SessionCookieName {
+					sessionCookie = cookie
+				}
+			}
+			if sessionCookie == nil {
+				t.Fatal("session cookie not set")
+			}
+
 			// Use httptest for a simpler integration test
 			req := httptest.NewRequest("POST", tt.path, nil)
+			req.AddCookie(sessionCookie)
+			req.Header.Set(CSRFHeaderName, page.Header().Get(CSRFHeaderName))
 			w := httptest.NewRecorder()
 
 			// Run through the full handler chain (including SessionMiddleware)
@@ -636,22 +655,9 @@ func TestServer_APIEndpoints_Integration(t *testing.T) {
 				t.Errorf("body should contain status ok, got %q", body)
 			}
 
-			// Verify session_id is present (SessionMiddleware adds it)
-			if !strings.Contains(body, `"session_id":`) {
-				t.Errorf("body should contain session_id, got %q", body)
-			}
-
-			// Verify the Set-Cookie header was sent by SessionMiddleware
-			cookies := w.Result().Cookies()
-			found := false
-			for _, cookie := range cookies {
-				if cookie.Name == SessionCookieName {
-					found = true
-					break
-				}
-			}
-			if !found {
-				t.Error("session cookie not set")
+			// Verify the session from the cookie is used (SessionMiddleware adds it)
+			if !strings.Contains(body, `"session_id":"`+sessionCookie.Value+`"`) {
+				t.Errorf("body should contain session_id %s, got %q", sessionCookie.Value, body)
 			}
 		})
 	}
@@ -666,7 +672,7 @@ func TestHandleImage_ValidImage(t *testing.T) {
 
 	// Store a test image
 	pngData := []byte{1, 2, 3, 4, 5}
-	id, err := storage.Store(pngData, 100, 100)
+	id, err := storage.Store("", pngData, 100, 100)
 	if err != nil {
 		t.Fatalf("Store failed: %v", err)
 	}
@@ -783,7 +789,7 @@ func TestChatWithRetry_CompactionAfterMissingFieldsError(t *testing.T) {
 		{Role: ollama.RoleUser, Content: "test message"},
 	}
 
-	result, err := server.chatWithRetry(context.Background(), "test-session", messages, nil, nil, nil)
+	result, err := server.chatWithRetry(context.Background(), "test-session", "", messages, nil, nil, nil)
 
 	if err != nil {
 		t.Fatalf("chatWithRetry failed: %v", err)
@@ -820,7 +826,7 @@ func TestChatWithRetry_ErrorReturnedAfterCompactionFails(t *testing.T) {
 		{Role: ollama.RoleUser, Content: "test message"},
 	}
 
-	_, err = server.chatWithRetry(context.Background(), "test-session", messages, nil, nil, nil)
+	_, err = server.chatWithRetry(context.Background(), "test-session", "", messages, nil, nil, nil)
 
 	if err == nil {
 		t.Fatal("expected error after all retries fail, got nil")
@@ -837,6 +843,92 @@ func TestChatWithRetry_ErrorReturnedAfterCompactionFails(t *testing.T) {
 	}
 }
 
+// modelRecordingClient records the model each chat asks for.
+type modelRecordingClient struct {
+	mockOllamaClient
+	models []string
+}
+
+func (c *modelRecordingClient) Chat(ctx context.Context, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error) {
+	c.models = append(c.models, ollama.ModelFromContext(ctx))
+	return c.mockOllamaClient.Chat(ctx, messages, seed, tools, callback)
+}
+
+func TestChatWithRetry_FallbackModel(t *testing.T) {
+	tests := []struct {
+		name          string
+		fallbackModel string
+		responses     []mockResponse
+		wantModels    []string
+		wantErr       error
+	}{
+		{
+			name:          "fallback succeeds",
+			fallbackModel: "llama3.2:3b",
+			responses: []mockResponse{
+				{err: ollama.ErrMissingFields},
+				{err: ollama.ErrMissingFields},
+				{result: ollama.ChatResult{Response: "Here you go.", Model: "llama3.2:3b"}},
+			},
+			wantModels: []string{"", "", "llama3.2:3b"},
+		},
+		{
+			name:          "fallback fails",
+			fallbackModel: "llama3.2:3b",
+			responses: []mockResponse{
+				{err: ollama.ErrMissingFields},
+				{err: ollama.ErrMissingFields},
+				{err: ollama.ErrMissingFields},
+			},
+			wantModels: []string{"", "", "llama3.2:3b"},
+			wantErr:    ollama.ErrMissingFields,
+		},
+		{
+			name: "no fallback configured",
+			responses: []mockResponse{
+				{err: ollama.ErrMissingFields},
+				{err: ollama.ErrMissingFields},
+			},
+			wantModels: []string{"", ""},
+			wantErr:    ollama.ErrMissingFields,
+		},
+		{
+			name:          "compaction retry succeeds",
+			fallbackModel: "llama3.2:3b",
+			responses: []mockResponse{
+				{err: ollama.ErrMissingFields},
+				{result: ollama.ChatResult{Response: "Here you go."}},
+			},
+			wantModels: []string{"", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &modelRecordingClient{mockOllamaClient: mockOllamaClient{responses: tt.responses}}
+			server, err := NewServerWithDeps("", mock, nil, nil, nil, nil, nil)
+			if err != nil {
+				t.Fatalf("NewServerWithDeps failed: %v", err)
+			}
+			server.fallbackModel = tt.fallbackModel
+
+			messages := []ollama.Message{
+				{Role: ollama.RoleUser, Content: "test message"},
+			}
+			result, err := server.chatWithRetry(context.Background(), "test-session", "", messages, nil, nil, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("chatWithRetry() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && result.Response != "Here you go." {
+				t.Errorf("response = %q, want %q", result.Response, "Here you go.")
+			}
+			if !slices.Equal(mock.models, tt.wantModels) {
+				t.Errorf("models = %q, want %q", mock.models, tt.wantModels)
+			}
+		})
+	}
+}
+
 func TestChatWithRetry_NonRetryableErrorReturnsImmediately(t *testing.T) {
 	connectionErr := errors.New("connection failed")
 	mock := &mockOllamaClient{
@@ -855,7 +947,7 @@ func TestChatWithRetry_NonRetryableErrorReturnsImmediately(t *testing.T) {
 	}
 
 	// Should fail immediately without retry
-	_, err = server.chatWithRetry(context.Background(), "test-session", messages, nil, nil, nil)
+	_, err = server.chatWithRetry(context.Background(), "test-session", "", messages, nil, nil, nil)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -864,7 +956,7 @@ func TestChatWithRetry_NonRetryableErrorReturnsImmediately(t *testing.T) {
 		t.Errorf("expected connection error, got %v", err)
 	}
 
-	// Should have tried only once (no retry for connection errors)
+	// Should have tried only once (unclassified errors are not retried)
 	if mock.callCount != 1 {
 		t.Errorf("call count = %d, want 1", mock.callCount)
 	}
@@ -877,7 +969,7 @@ func TestCompactContext_CorrectFormat(t *testing.T) {
 	}
 
 	messages := []ollama.Message{
-		{Role: ollama.RoleSystem, Content: server.buildSystemPrompt()},
+		{Role: ollama.RoleSystem, Content: server.buildSystemPrompt(server.agentPrompt)},
 		{Role: ollama.RoleUser, Content: "I want a cat in a hat"},
 		{Role: ollama.RoleAssistant, Content: "What kind of cat?\n---\n{\"prompt\":\"\",\"generate_image\":false}"},
 		{Role: ollama.RoleUser, Content: "A tabby cat wearing a wizard hat"},
@@ -928,7 +1020,7 @@ func TestCompactContext_SkipsSystemInjectedMessages(t *testing.T) {
 	}
 
 	messages := []ollama.Message{
-		{Role: ollama.RoleSystem, Content: server.buildSystemPrompt()},
+		{Role: ollama.RoleSystem, Content: server.buildSystemPrompt(server.agentPrompt)},
 		{Role: ollama.RoleUser, Content: "I want a cat"},
 		{Role: ollama.RoleUser, Content: "[user edited prompt to: cat in hat]"}, // Should be skipped
 		{Role: ollama.RoleUser, Content: "[Current prompt: cat in space]"},      // Should be skipped
@@ -1506,3 +1598,235 @@ func TestGenerateFallbackResponse(t *testing.T) {
 		t.Errorf("generateFallbackResponse() = %q, want %q", got, want)
 	}
 }
+
+func TestDevMode_ReloadsAssets(t *testing.T) {
+	dir := t.TempDir()
+	writeAsset := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create asset dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write asset: %v", err)
+		}
+	}
+	writeAsset("templates/api-docs.html", `{{define "api-docs.html"}}first{{end}}`)
+	writeAsset("static/app.css", "body {}")
+
+	s := newGalleryTestServer(t, &config.Config{Dev: true, DevDir: dir})
+
+	if w := serveAs(s, http.MethodGet, "/api/docs", ""); w.Body.String() != "first" {
+		t.Fatalf("GET /api/docs = %q, want %q", w.Body.String(), "first")
+	}
+
+	// Template edits show up without restarting
+	writeAsset("templates/api-docs.html", `{{define "api-docs.html"}}second{{end}}`)
+	if w := serveAs(s, http.MethodGet, "/api/docs", ""); w.Body.String() != "second" {
+		t.Errorf("GET /api/docs after edit = %q, want %q", w.Body.String(), "second")
+	}
+
+	// Static files come from disk and are not cached
+	w := serveAs(s, http.MethodGet, "/static/app.css", "")
+	if w.Code != http.StatusOK || w.Body.String() != "body {}" {
+		t.Errorf("GET /static/app.css = %d %q, want the file from disk", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+}
+
+func TestDevMode_MissingTemplates(t *testing.T) {
+	cfg := &config.Config{Dev: true, DevDir: t.TempDir()}
+	if _, err := NewServerWithDeps("", nil, nil, nil, nil, nil, cfg); err == nil {
+		t.Error("NewServerWithDeps() error = nil, want error for a directory without templates")
+	}
+}
+
+func TestImageEndpoints_ETag(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	memoryID, err := s.imageStorage.Store("", []byte("memory-png"), 64, 64)
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		wantETag string
+	}{
+		{
+			name:     "in-memory image",
+			target:   "/images/" + memoryID + ".png",
+			wantETag: contentETag(image.ContentHash([]byte("memory-png"))),
+		},
+		{
+			name:     "session image",
+			target:   "/sessions/" + testGallerySessionID + "/images/1.png",
+			wantETag: contentETag(image.ContentHash([]byte("sunset-png"))),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+				req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+				if ifNoneMatch != "" {
+					req.Header.Set("If-None-Match", ifNoneMatch)
+				}
+				w := httptest.NewRecorder()
+				s.server.Handler.ServeHTTP(w, req)
+				return w
+			}
+
+			w := get("")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("ETag = %q, want %q", got, tt.wantETag)
+			}
+			if w.Header().Get("Last-Modified") == "" {
+				t.Error("Last-Modified is not set")
+			}
+
+			// A matching ETag is answered without the body
+			w = get(tt.wantETag)
+			if w.Code != http.StatusNotModified {
+				t.Errorf("matching If-None-Match status = %d, want %d", w.Code, http.StatusNotModified)
+			}
+			if w.Body.Len() != 0 {
+				t.Errorf("304 body length = %d, want 0", w.Body.Len())
+			}
+
+			if w := get(`"stale"`); w.Code != http.StatusOK {
+				t.Errorf("stale If-None-Match status = %d, want %d", w.Code, http.StatusOK)
+			}
+		})
+	}
+}
+
+// contextSizedClient reports a fixed context window and records the
+// messages of each chat.
+type contextSizedClient struct {
+	mockOllamaClient
+	contextLength int
+	got           [][]ollama.Message
+}
+
+func (c *contextSizedClient) ContextLength(ctx context.Context, model string) (int, error) {
+	return c.contextLength, nil
+}
+
+func (c *contextSizedClient) Chat(ctx context.Context, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error) {
+	c.got = append(c.got, messages)
+	return c.mockOllamaClient.Chat(ctx, messages, seed, tools, callback)
+}
+
+func TestRunChatTurn_TrimsToContextLength(t *testing.T) {
+	tests := []struct {
+		name          string
+		contextLength int
+		wantTrimmed   bool
+	}{
+		{"large window", 128000, false},
+		{"small window", 2048, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, nil)
+			client := &contextSizedClient{mockOllamaClient: mockOllamaClient{response: "ok"}, contextLength: tt.contextLength}
+			s.setLLMClientForTesting(client)
+
+			session := s.sessionManager.GetSession(testGallerySessionID)
+			manager := session.Manager()
+			for i := 0; i < 20; i++ {
+				manager.AddUserMessage(strings.Repeat("user ", 80))
+				manager.AddAssistantMessage(strings.Repeat("reply ", 80), "", nil)
+			}
+			history := len(manager.GetMessages())
+
+			s.runChatTurn(context.Background(), session, testGallerySessionID, "", manager, "a cat", 20, 3.5, -1)
+
+			if len(client.got) == 0 {
+				t.Fatal("Chat() was not called")
+			}
+			sent := client.got[0]
+			trimmed := len(sent) < history
+			if trimmed != tt.wantTrimmed {
+				t.Fatalf("sent %d messages for %d in history, want trimmed = %v", len(sent), history, tt.wantTrimmed)
+			}
+			if sent[len(sent)-1].Content != "a cat" {
+				t.Errorf("last message = %q, want the new user message", sent[len(sent)-1].Content)
+			}
+			if tt.wantTrimmed && !strings.Contains(sent[2].Content, "earlier messages were left out") {
+				t.Errorf("message after settings = %q, want dropped note", sent[2].Content)
+			}
+		})
+	}
+}
+
+// toolCallStreamingClient streams a reply with an update_generation call
+// in the middle of its text, as ollama does.
+type toolCallStreamingClient struct {
+	mockOllamaClient
+	args string
+}
+
+func (c *toolCallStreamingClient) Chat(ctx context.Context, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error) {
+	toolCalls := []ollama.ToolCall{{Function: ollama.ToolCallFunction{Name: "update_generation", Arguments: []byte(c.args)}}}
+	for _, token := range []ollama.StreamToken{{Content: "Here is "}, {ToolCalls: toolCalls}, {Content: "your cat."}} {
+		if err := callback(token); err != nil {
+			return ollama.ChatResult{}, err
+		}
+	}
+	return ollama.ResultFromStream("Here is your cat.", toolCalls)
+}
+
+func TestRunChatTurn_StreamedToolCall(t *testing.T) {
+	tests := []struct {
+		name               string
+		args               string
+		wantEarly          bool
+		wantEarlyGenerated bool
+	}{
+		{"generate", `{"prompt":"a cat","steps":8,"cfg":2.5,"seed":7,"generate_image":true}`, true, true},
+		{"settings only", `{"prompt":"a cat","steps":8,"cfg":2.5,"seed":7,"generate_image":false}`, true, false},
+		{"missing fields", `{"prompt":"a cat"}`, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, nil)
+			s.setLLMClientForTesting(&toolCallStreamingClient{args: tt.args})
+			events := recordEvents(s, testGallerySessionID)
+
+			session := s.sessionManager.GetSession(testGallerySessionID)
+			s.runChatTurn(context.Background(), session, testGallerySessionID, "", session.Manager(), "a cat", 20, 3.5, -1)
+
+			body := events.Body.String()
+			rest := strings.Index(body, "your cat.")
+			if rest < 0 {
+				t.Fatalf("events = %q, want the rest of the reply", body)
+			}
+			settings := strings.Index(body, "event: "+EventSettingsUpdate)
+			if early := settings >= 0 && settings < rest; early != tt.wantEarly {
+				t.Errorf("settings-update before the rest of the reply = %v, want %v", early, tt.wantEarly)
+			}
+			generation := strings.Index(body, "event: "+EventGenerationStarted)
+			if early := generation >= 0 && generation < rest; early != tt.wantEarlyGenerated {
+				t.Errorf("generation-started before the rest of the reply = %v, want %v", early, tt.wantEarlyGenerated)
+			}
+			if tt.wantEarly && strings.Count(body, "event: "+EventSettingsUpdate) != 1 {
+				t.Errorf("settings-update sent %d times, want once", strings.Count(body, "event: "+EventSettingsUpdate))
+			}
+			if tt.wantEarly {
+				if steps, _, _, _ := session.GetGenerationSettings(); steps != 8 {
+					t.Errorf("session steps = %d, want 8", steps)
+				}
+			}
+		})
+	}
+}
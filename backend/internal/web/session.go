@@ -26,6 +26,9 @@ type contextKey int
 
 const (
 	sessionIDKey contextKey = iota
+	userKey
+	initImageKey
+	priorityKey
 )
 
 // GenerateSessionID creates a new cryptographically secure session ID.
@@ -68,11 +71,18 @@ func ValidateSessionID(sessionID string) bool {
 }
 
 // SessionMiddleware ensures every request has a session ID.
+// If the context already has a session ID, it is kept.
 // If the request has a valid session cookie, it uses that ID.
 // Otherwise, it generates a new ID and sets a cookie.
 // The session ID is stored in the request context for handlers to access.
 func SessionMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A signed-in user's session was already chosen by identifyUser
+		if GetSessionID(r.Context()) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		var sessionID string
 
 		// Try to get session ID from cookie
@@ -60,6 +60,7 @@ func TestSessionIntegration_ServerWithMiddleware(t *testing.T) {
 	// Using POST /prompt since POST /chat now requires message content
 	req2 := httptest.NewRequest("POST", "/prompt", nil)
 	req2.AddCookie(sessionCookie)
+	req2.Header.Set(CSRFHeaderName, rec1.Header().Get(CSRFHeaderName))
 	rec2 := httptest.NewRecorder()
 
 	server.server.Handler.ServeHTTP(rec2, req2)
@@ -0,0 +1,247 @@
+package web
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// sessionResponse describes a session in API responses.
+type sessionResponse struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	MessageCount int       `json:"message_count"`
+	ImageCount   int       `json:"image_count"`
+	LastActivity time.Time `json:"last_activity,omitzero"`
+	Current      bool      `json:"current"`
+}
+
+// sessionListResponse is the response for GET /sessions.
+type sessionListResponse struct {
+	Status   string            `json:"status"`
+	Sessions []sessionResponse `json:"sessions"`
+	Page     pageInfo          `json:"page"`
+}
+
+// sessionResumeResponse is the response for POST /sessions/{sessionID}/resume.
+type sessionResumeResponse struct {
+	Status  string          `json:"status"`
+	Session sessionResponse `json:"session"`
+}
+
+// sessionDeleteResponse is the response for POST /sessions/{sessionID}/delete.
+type sessionDeleteResponse struct {
+	Status        string `json:"status"`
+	ImagesDeleted int    `json:"images_deleted"`
+	Unpublished   int    `json:"unpublished"`
+}
+
+// buildSessionResponse describes a session for the session making the
+// request.
+func (s *Server) buildSessionResponse(summary conversation.SessionSummary, currentID string) sessionResponse {
+	return sessionResponse{
+		ID:           summary.ID,
+		Title:        summary.Title,
+		MessageCount: summary.MessageCount,
+		ImageCount:   s.imageStore.Count(summary.ID),
+		LastActivity: summary.LastActivity,
+		Current:      summary.ID == currentID,
+	}
+}
+
+// canAccessAllSessions reports whether r may list and resume any session:
+// it must carry a valid API token, or come from this machine if no tokens
+// are configured. Session IDs are the only credential of anonymous
+// sessions, so they are never shown to other browsers on the network.
+func (s *Server) canAccessAllSessions(r *http.Request) bool {
+	if tokens := s.apiTokens.Load(); tokens != nil {
+		return tokens.valid(requestAPIToken(r))
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handleListSessions lists sessions with messages, most recently active
+// first. A signed-in user sees only their own session; otherwise every
+// session is listed if canAccessAllSessions allows it.
+// GET /sessions (query: limit, offset, since, until)
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var summaries []conversation.SessionSummary
+	if GetUser(r.Context()) != "" {
+		if summary, ok := s.sessionManager.SessionSummary(sessionID); ok {
+			summaries = append(summaries, summary)
+		}
+	} else {
+		if !s.canAccessAllSessions(r) {
+			writeJSONError(w, http.StatusForbidden, "listing sessions requires an API token")
+			return
+		}
+		summaries, err = s.sessionManager.Sessions()
+		if err != nil {
+			log.Printf("Failed to list sessions: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to list sessions")
+			return
+		}
+	}
+
+	var matching []conversation.SessionSummary
+	for _, summary := range summaries {
+		if q.matchesTime(summary.LastActivity) {
+			matching = append(matching, summary)
+		}
+	}
+	start, end, page := q.page(len(matching))
+
+	resp := sessionListResponse{
+		Status:   "ok",
+		Sessions: make([]sessionResponse, 0, end-start),
+		Page:     page,
+	}
+	for _, summary := range matching[start:end] {
+		resp.Sessions = append(resp.Sessions, s.buildSessionResponse(summary, sessionID))
+	}
+
+	writeChatJSON(w, http.StatusOK, resp)
+}
+
+// handleResumeSession points the browser's session cookie at a previous
+// session, for when the cookie was lost. Signed-in users always get their
+// own session, so there is nothing to resume.
+// POST /sessions/{sessionID}/resume
+func (s *Server) handleResumeSession(w http.ResponseWriter, r *http.Request) {
+	if GetSessionID(r.Context()) == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if GetUser(r.Context()) != "" {
+		writeJSONError(w, http.StatusConflict, "sessions follow the signed-in user and cannot be resumed")
+		return
+	}
+
+	targetID := r.PathValue("sessionID")
+	if !ValidateSessionID(targetID) {
+		writeJSONError(w, http.StatusBadRequest, "invalid session ID")
+		return
+	}
+	if !s.canAccessAllSessions(r) {
+		writeJSONError(w, http.StatusForbidden, "resuming a session requires an API token")
+		return
+	}
+
+	summary, ok := s.sessionManager.SessionSummary(targetID)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	// SECURITY: Secure flag requires HTTPS in production
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    targetID,
+		Path:     "/",
+		MaxAge:   int(SessionExpiry.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Secure:   true,
+	})
+
+	writeChatJSON(w, http.StatusOK, sessionResumeResponse{
+		Status:  "ok",
+		Session: s.buildSessionResponse(summary, targetID),
+	})
+}
+
+// handleDeleteSession wipes the caller's session, for leaving a shared
+// machine: replies still streaming are cancelled, its conversations,
+// settings, images, gallery entries, favorites, saved prompts and tags are
+// deleted, and the session cookie is cleared. The next request starts a new
+// session.
+// POST /sessions/{sessionID}/delete
+func (s *Server) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	// SECURITY: Get authenticated session ID from context
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Only the owning session may delete itself
+	if requestedID := r.PathValue("sessionID"); requestedID != sessionID {
+		log.Printf("SECURITY: Session %s attempted to delete session %s", sessionID, requestedID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	s.chatStreams.cancel(sessionID, "")
+
+	// Every step is tried, so a failure deletes as much as possible
+	failed := false
+	unpublished, err := s.galleryStore.UnpublishSession(sessionID)
+	if err != nil {
+		log.Printf("Failed to unpublish images of deleted session %s: %v", sessionID, err)
+		failed = true
+	}
+	reclaimed, err := s.imageStore.DeleteSession(sessionID)
+	if err != nil {
+		log.Printf("Failed to delete images of session %s: %v", sessionID, err)
+		failed = true
+	}
+	if err := s.tagIndex.DeleteSession(sessionID); err != nil {
+		log.Printf("Failed to delete tags of session %s: %v", sessionID, err)
+		failed = true
+	}
+	if err := s.sessionManager.Erase(sessionID); err != nil {
+		log.Printf("Failed to delete session %s: %v", sessionID, err)
+		failed = true
+	}
+	// Removes what the session manager's store doesn't know about, such as
+	// favorites and saved prompts, or files left behind by a switch to
+	// --storage sqlite
+	if err := persistence.NewSessionStore(s.imageStore.BasePath()).DeleteSession(sessionID); err != nil {
+		log.Printf("Failed to delete files of session %s: %v", sessionID, err)
+		failed = true
+	}
+	if failed {
+		writeJSONError(w, http.StatusInternalServerError, "failed to delete all of the session")
+		return
+	}
+
+	log.Printf("Deleted session %s (%d images, %d gallery entries)", sessionID, reclaimed.Files, unpublished)
+
+	// SECURITY: Secure flag requires HTTPS in production
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Secure:   true,
+	})
+
+	writeChatJSON(w, http.StatusOK, sessionDeleteResponse{
+		Status:        "ok",
+		ImagesDeleted: reclaimed.Files,
+		Unpublished:   unpublished,
+	})
+}
@@ -0,0 +1,204 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+const testResumeSessionID = "0123456789abcdef0123456789abcdef"
+
+// serveSessionsRequest sends a request from remoteAddr with the session
+// cookie and, if set, an API token.
+func serveSessionsRequest(s *Server, method, target, remoteAddr, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.RemoteAddr = remoteAddr
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testResumeSessionID})
+	req.Header.Set(CSRFHeaderName, s.csrfToken(testResumeSessionID))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleListSessions(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{})
+	s.sessionManager.GetSession(testResumeSessionID).Manager().AddUserMessage("a foggy harbor")
+
+	// Session IDs are not shown to other machines without an API token
+	if w := serveSessionsRequest(s, http.MethodGet, "/sessions", "192.0.2.1:1234", ""); w.Code != http.StatusForbidden {
+		t.Errorf("GET /sessions from another machine status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w := serveSessionsRequest(s, http.MethodGet, "/sessions", "127.0.0.1:1234", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /sessions status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp sessionListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Page.Total != 2 || len(resp.Sessions) != 2 {
+		t.Fatalf("GET /sessions = %+v, want 2 sessions", resp)
+	}
+	byID := map[string]sessionResponse{}
+	for _, session := range resp.Sessions {
+		byID[session.ID] = session
+	}
+	if got := byID[testResumeSessionID]; got.Title != "a foggy harbor" || got.MessageCount != 1 || !got.Current {
+		t.Errorf("caller's session = %+v, want its title, 1 message and current", got)
+	}
+	if got := byID[testGallerySessionID]; got.ImageCount != 1 || got.Current {
+		t.Errorf("other session = %+v, want 1 image and not current", got)
+	}
+
+	if w := serveSessionsRequest(s, http.MethodGet, "/sessions?limit=0", "127.0.0.1:1234", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("GET /sessions?limit=0 status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleListSessions_APIToken(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{APIToken: testAPIToken})
+
+	if w := serveSessionsRequest(s, http.MethodGet, "/sessions", "127.0.0.1:1234", ""); w.Code != http.StatusForbidden {
+		t.Errorf("GET /sessions without a token status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := serveSessionsRequest(s, http.MethodGet, "/sessions", "192.0.2.1:1234", testAPIToken); w.Code != http.StatusOK {
+		t.Errorf("GET /sessions with a token status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestHandleListSessions_Users(t *testing.T) {
+	s := newUsersTestServer(t, &config.Config{})
+	s.sessionManager.GetSession(userSessionID("alice")).Manager().AddUserMessage("a windmill")
+
+	w := serveSessionsRequest(s, http.MethodGet, "/sessions", "192.0.2.1:1234", testAPIToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /sessions status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp sessionListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Sessions) != 1 || resp.Sessions[0].ID != userSessionID("alice") {
+		t.Errorf("GET /sessions as alice = %+v, want only alice's session", resp.Sessions)
+	}
+}
+
+func TestHandleResumeSession(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{})
+	target := "/sessions/" + testGallerySessionID + "/resume"
+
+	tests := []struct {
+		name       string
+		target     string
+		remoteAddr string
+		wantStatus int
+	}{
+		{"resume", target, "127.0.0.1:1234", http.StatusOK},
+		{"another machine", target, "192.0.2.1:1234", http.StatusForbidden},
+		{"invalid ID", "/sessions/nope/resume", "127.0.0.1:1234", http.StatusBadRequest},
+		{"unknown session", "/sessions/" + testResumeSessionID + "/resume", "127.0.0.1:1234", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveSessionsRequest(s, http.MethodPost, tt.target, tt.remoteAddr, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("POST %s status = %d, want %d: %s", tt.target, w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var cookie *http.Cookie
+			for _, c := range w.Result().Cookies() {
+				if c.Name == SessionCookieName {
+					cookie = c
+				}
+			}
+			if cookie == nil || cookie.Value != testGallerySessionID || !cookie.HttpOnly {
+				t.Errorf("session cookie = %+v, want the resumed session", cookie)
+			}
+			var resp sessionResumeResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Session.ID != testGallerySessionID || !resp.Session.Current {
+				t.Errorf("resumed session = %+v, want %s as current", resp.Session, testGallerySessionID)
+			}
+		})
+	}
+}
+
+func TestHandleResumeSession_Users(t *testing.T) {
+	s := newUsersTestServer(t, &config.Config{})
+
+	target := "/sessions/" + testGallerySessionID + "/resume"
+	if w := serveSessionsRequest(s, http.MethodPost, target, "127.0.0.1:1234", testAPIToken); w.Code != http.StatusConflict {
+		t.Errorf("POST %s as a user status = %d, want %d", target, w.Code, http.StatusConflict)
+	}
+}
+
+func TestHandleDeleteSession(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{})
+	target := "/sessions/" + testGallerySessionID + "/delete"
+
+	if _, err := s.galleryStore.Publish(testGallerySessionID, 1, "a sunset"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := s.favoriteStore.Add(testGallerySessionID, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := s.tagIndex.SetTags(testGallerySessionID, 1, []string{"sky"}); err != nil {
+		t.Fatalf("SetTags() error = %v", err)
+	}
+
+	// Only the owning session may delete itself
+	if w := serveAs(s, http.MethodPost, target, testResumeSessionID); w.Code != http.StatusForbidden {
+		t.Fatalf("POST %s from another session status = %d, want %d", target, w.Code, http.StatusForbidden)
+	}
+
+	w := serveAs(s, http.MethodPost, target, testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST %s status = %d, want %d: %s", target, w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp sessionDeleteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.ImagesDeleted != 1 || resp.Unpublished != 1 {
+		t.Errorf("POST %s = %+v, want 1 image deleted and 1 unpublished", target, resp)
+	}
+
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == SessionCookieName {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.MaxAge >= 0 || cookie.Value != "" {
+		t.Errorf("session cookie = %+v, want it cleared", cookie)
+	}
+
+	if n := s.imageStore.Count(testGallerySessionID); n != 0 {
+		t.Errorf("images after deleting the session = %d, want 0", n)
+	}
+	if entries, _ := s.galleryStore.List(); len(entries) != 0 {
+		t.Errorf("gallery after deleting the session = %+v, want empty", entries)
+	}
+	if favorites, _ := s.favoriteStore.List(testGallerySessionID); len(favorites) != 0 {
+		t.Errorf("favorites after deleting the session = %+v, want none", favorites)
+	}
+	if ids, _ := s.tagIndex.Find(testGallerySessionID, "sky"); len(ids) != 0 {
+		t.Errorf("tagged images after deleting the session = %v, want none", ids)
+	}
+	if s.sessionManager.Get(testGallerySessionID) != nil {
+		t.Error("deleted session is still in memory")
+	}
+}
@@ -0,0 +1,329 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+const (
+	// shareKeyFileName is the share token key's name within the image store's base path
+	shareKeyFileName = "share.key"
+
+	// shareKeySize is the length of the share token key (AES-256)
+	shareKeySize = 32
+)
+
+// errInvalidShareToken is returned for share tokens this instance didn't issue.
+var errInvalidShareToken = errors.New("invalid share token")
+
+// shareTokens issues and checks the tokens of read-only share links.
+//
+// A token is the session ID sealed with AES-GCM under a key kept next to
+// the sessions. The session ID is the credential of an anonymous session,
+// so it is encrypted rather than only signed: a share link must not let
+// its viewers take over the session. Tokens stay valid until the session
+// is deleted or the key file is removed.
+type shareTokens struct {
+	mu   sync.Mutex
+	path string
+	enc  *persistence.Encryptor
+}
+
+// newShareTokens creates a token issuer whose key is stored at path. The
+// key is loaded or created on first use.
+func newShareTokens(path string) *shareTokens {
+	return &shareTokens{path: path}
+}
+
+// Issue returns a share token for a session.
+func (t *shareTokens) Issue(sessionID string) (string, error) {
+	enc, err := t.encryptor()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := enc.Seal([]byte(sessionID))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// SessionID returns the session a share token was issued for.
+// Returns errInvalidShareToken if the token was not issued by Issue.
+func (t *shareTokens) SessionID(token string) (string, error) {
+	enc, err := t.encryptor()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", errInvalidShareToken
+	}
+	sessionID, err := enc.Open(sealed)
+	if err != nil || !ValidateSessionID(string(sessionID)) {
+		return "", errInvalidShareToken
+	}
+	return string(sessionID), nil
+}
+
+// encryptor returns the token cipher, loading or creating its key on
+// first use.
+func (t *shareTokens) encryptor() (*persistence.Encryptor, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.enc != nil {
+		return t.enc, nil
+	}
+
+	key, err := os.ReadFile(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err = createShareKey(t.path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load share key: %w", err)
+	}
+	enc, err := persistence.NewEncryptor(key)
+	if err != nil {
+		return nil, fmt.Errorf("share key %s: %w", t.path, err)
+	}
+	t.enc = enc
+	return enc, nil
+}
+
+// createShareKey generates a random key and writes it to path.
+// SECURITY: The key file is readable by the owner only.
+func createShareKey(path string) ([]byte, error) {
+	key := make([]byte, shareKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	// O_EXCL so two processes starting together can't overwrite each other's key
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return os.ReadFile(path)
+		}
+		return nil, err
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// shareURL returns the path of the read-only page for a share token.
+func shareURL(token string) string {
+	return "/share/" + token
+}
+
+// shareResponse is the response for POST /sessions/{sessionID}/share.
+type shareResponse struct {
+	Status string `json:"status"`
+	Token  string `json:"token"`
+	URL    string `json:"url"`
+}
+
+// shareMessage is a message as shown on a shared session's page.
+// ImageURL is empty if the message has no image.
+type shareMessage struct {
+	Role      string
+	Content   string
+	Prompt    string
+	ImageURL  string
+	CreatedAt time.Time
+}
+
+// shareChat is one of a shared session's chats.
+type shareChat struct {
+	Name     string
+	Messages []shareMessage
+}
+
+// shareTemplateData holds data passed to the share.html template.
+type shareTemplateData struct {
+	Title string
+	Chats []shareChat
+}
+
+// handleShareSession issues a read-only share link for the caller's session.
+// POST /sessions/{sessionID}/share
+func (s *Server) handleShareSession(w http.ResponseWriter, r *http.Request) {
+	// SECURITY: Get authenticated session ID from context
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Only the owning session may share itself
+	if requestedID := r.PathValue("sessionID"); requestedID != sessionID {
+		log.Printf("SECURITY: Session %s attempted to share session %s", sessionID, requestedID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	token, err := s.shareTokens.Issue(sessionID)
+	if err != nil {
+		log.Printf("Failed to issue share token for session %s: %v", sessionID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to create share link")
+		return
+	}
+
+	writeChatJSON(w, http.StatusCreated, shareResponse{
+		Status: "ok",
+		Token:  token,
+		URL:    shareURL(token),
+	})
+}
+
+// sharedSession returns the session named by the request's share token.
+// Writes a 404 and returns false if the token is invalid or the session
+// no longer has any messages. The session is looked up before it is
+// loaded, so an old token never recreates a deleted session.
+func (s *Server) sharedSession(w http.ResponseWriter, r *http.Request) (string, *conversation.Session, bool) {
+	sessionID, err := s.shareTokens.SessionID(r.PathValue("token"))
+	if err != nil {
+		if !errors.Is(err, errInvalidShareToken) {
+			log.Printf("Failed to read share token: %v", err)
+		}
+		http.Error(w, "Shared session not found", http.StatusNotFound)
+		return "", nil, false
+	}
+	if _, ok := s.sessionManager.SessionSummary(sessionID); !ok {
+		http.Error(w, "Shared session not found", http.StatusNotFound)
+		return "", nil, false
+	}
+	return sessionID, s.sessionManager.GetSession(sessionID), true
+}
+
+// handleSharedSession serves the read-only page of a shared session.
+// GET /share/{token}
+// No session is required, and the viewer never receives the shared
+// session's cookie.
+func (s *Server) handleSharedSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, session, ok := s.sharedSession(w, r)
+	if !ok {
+		return
+	}
+	token := r.PathValue("token")
+
+	var chats []shareChat
+	for _, info := range session.Chats() {
+		manager := session.ChatManager(info.ID)
+		if manager == nil {
+			continue
+		}
+		chat := shareChat{Name: info.Name}
+		for _, msg := range manager.GetMessages() {
+			if msg.Role != "user" && msg.Role != "assistant" {
+				continue
+			}
+			shared := shareMessage{Role: msg.Role, Content: msg.Content, CreatedAt: msg.CreatedAt}
+			if msg.Snapshot != nil {
+				shared.Prompt = msg.Snapshot.Prompt
+			}
+			if s.imageStore.Exists(sessionID, msg.ID) {
+				shared.ImageURL = fmt.Sprintf("%s/images/%d.png", shareURL(token), msg.ID)
+			}
+			chat.Messages = append(chat.Messages, shared)
+		}
+		if len(chat.Messages) > 0 {
+			chats = append(chats, chat)
+		}
+	}
+	// Chat names only tell chats apart
+	if len(chats) == 1 {
+		chats[0].Name = ""
+	}
+
+	data := shareTemplateData{Title: session.Title(), Chats: chats}
+	if data.Title == "" {
+		summary, _ := s.sessionManager.SessionSummary(sessionID)
+		data.Title = summary.Title
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// SECURITY: Share tokens are credentials; keep them out of Referer headers
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	if err := s.executeTemplate(w, "share.html", data); err != nil {
+		log.Printf("Failed to execute template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleSharedImage serves an image of a shared session.
+// GET /share/{token}/images/{filename}?format=&quality=
+// filename is {messageID}.png or {messageID}-{alternate}.png.
+func (s *Server) handleSharedImage(w http.ResponseWriter, r *http.Request) {
+	sessionID, _, ok := s.sharedSession(w, r)
+	if !ok {
+		return
+	}
+
+	filename := r.PathValue("filename")
+	if !strings.HasSuffix(filename, ".png") {
+		http.Error(w, "Invalid image filename (must be .png)", http.StatusBadRequest)
+		return
+	}
+	messageID, alternate, err := parseSessionImageFilename(filename)
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+	var file *os.File
+	if alternate > 0 {
+		file, err = s.imageStore.OpenAlternate(sessionID, messageID, alternate)
+	} else {
+		file, err = s.imageStore.Open(sessionID, messageID)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to open shared image %s/%d: %v", sessionID, messageID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	stored := persistence.StoredFormat(file.Name())
+	format, quality, err := s.imageFormat(r, stored)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		log.Printf("Failed to stat shared image %s/%d: %v", sessionID, messageID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Short-lived so deleted images and sessions stop being served soon
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	serveImageAs(w, r, filename, info.ModTime(), file, stored, "", format, quality)
+}
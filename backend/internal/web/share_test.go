@@ -0,0 +1,146 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+// shareSession creates a share link for testGallerySessionID.
+func shareSession(t *testing.T, s *Server) shareResponse {
+	t.Helper()
+
+	target := "/sessions/" + testGallerySessionID + "/share"
+	w := serveAs(s, http.MethodPost, target, testGallerySessionID)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST %s status = %d, want %d: %s", target, w.Code, http.StatusCreated, w.Body.String())
+	}
+	var resp shareResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestHandleShareSession(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{})
+	s.sessionManager.GetSession(testGallerySessionID).Manager().AddUserMessage("make it <b>pink</b>")
+
+	// Only the owning session may share itself
+	target := "/sessions/" + testGallerySessionID + "/share"
+	if w := serveAs(s, http.MethodPost, target, testResumeSessionID); w.Code != http.StatusForbidden {
+		t.Fatalf("POST %s from another session status = %d, want %d", target, w.Code, http.StatusForbidden)
+	}
+
+	resp := shareSession(t, s)
+	if resp.URL != "/share/"+resp.Token {
+		t.Errorf("url = %q, want /share/%s", resp.URL, resp.Token)
+	}
+	// SECURITY: The link must not reveal the session ID, which is the
+	// session's credential
+	if strings.Contains(resp.Token, testGallerySessionID) {
+		t.Errorf("token %q contains the session ID", resp.Token)
+	}
+
+	// Viewed without any cookie
+	w := serveAs(s, http.MethodGet, resp.URL, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %d, want %d: %s", resp.URL, w.Code, http.StatusOK, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{"Here you go", "a sunset", resp.URL + "/images/1.png", "make it &lt;b&gt;pink&lt;/b&gt;"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("shared page does not contain %q", want)
+		}
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Value == testGallerySessionID {
+			t.Errorf("shared page set cookie %s to the shared session's ID", c.Name)
+		}
+	}
+
+	// The viewer's own session can't use the link to act on the shared one
+	viewer := serveAs(s, http.MethodGet, "/history", testResumeSessionID)
+	if strings.Contains(viewer.Body.String(), "Here you go") {
+		t.Error("viewer's history contains the shared session's messages")
+	}
+
+	img := serveAs(s, http.MethodGet, resp.URL+"/images/1.png", "")
+	if img.Code != http.StatusOK {
+		t.Fatalf("GET shared image status = %d, want %d", img.Code, http.StatusOK)
+	}
+	if got := img.Body.String(); got != "sunset-png" {
+		t.Errorf("shared image = %q, want sunset-png", got)
+	}
+	if w := serveAs(s, http.MethodGet, resp.URL+"/images/2.png", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET missing shared image status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleSharedSession_InvalidToken(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{})
+	resp := shareSession(t, s)
+
+	// Flip a character in the middle of the token
+	tampered := []byte(resp.Token)
+	mid := len(tampered) / 2
+	if tampered[mid] == 'A' {
+		tampered[mid] = 'B'
+	} else {
+		tampered[mid] = 'A'
+	}
+
+	for _, target := range []string{
+		"/share/" + string(tampered),
+		"/share/" + string(tampered) + "/images/1.png",
+		"/share/not-a-token",
+		"/share/" + testGallerySessionID,
+	} {
+		if w := serveAs(s, http.MethodGet, target, ""); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s status = %d, want %d", target, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestHandleSharedSession_DeletedSession(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{})
+	resp := shareSession(t, s)
+
+	target := "/sessions/" + testGallerySessionID + "/delete"
+	if w := serveAs(s, http.MethodPost, target, testGallerySessionID); w.Code != http.StatusOK {
+		t.Fatalf("POST %s status = %d, want %d", target, w.Code, http.StatusOK)
+	}
+
+	if w := serveAs(s, http.MethodGet, resp.URL, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET %s after deleting the session status = %d, want %d", resp.URL, w.Code, http.StatusNotFound)
+	}
+	if s.sessionManager.Get(testGallerySessionID) != nil {
+		t.Error("viewing a share link recreated the deleted session")
+	}
+}
+
+func TestShareTokens_KeyPersists(t *testing.T) {
+	path := t.TempDir() + "/share.key"
+
+	token, err := newShareTokens(path).Issue(testGallerySessionID)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	// A restarted server reads the same key
+	sessionID, err := newShareTokens(path).SessionID(token)
+	if err != nil {
+		t.Fatalf("SessionID() error = %v", err)
+	}
+	if sessionID != testGallerySessionID {
+		t.Errorf("SessionID() = %q, want %q", sessionID, testGallerySessionID)
+	}
+
+	// Another instance's key doesn't accept it
+	if _, err := newShareTokens(t.TempDir() + "/share.key").SessionID(token); err != errInvalidShareToken {
+		t.Errorf("SessionID() with another key error = %v, want %v", err, errInvalidShareToken)
+	}
+}
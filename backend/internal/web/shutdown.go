@@ -0,0 +1,118 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// trackIntake wraps the handler so shutdown can stop intake and drain
+// in-flight requests. Once intake stops, new requests get 503.
+//
+// SSE streams are not counted as in-flight: they last until the broker
+// closes them, which is a later shutdown stage.
+func (s *Server) trackIntake(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.intakeMu.Lock()
+		if s.intakeStopped {
+			s.intakeMu.Unlock()
+			w.Header().Set("Connection", "close")
+			http.Error(w, "Server shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		tracked := r.URL.Path != "/events"
+		if tracked {
+			s.inflight.Add(1)
+		}
+		s.intakeMu.Unlock()
+
+		if tracked {
+			defer s.inflight.Done()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Shutdown stops the server in order: StopIntake, Drain, FlushSessions,
+// then CloseEvents. Callers that need to run their own steps between
+// stages (such as stopping the compute process last) call them directly.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.StopIntake(ctx)
+	if err := s.Drain(ctx); err != nil {
+		return err
+	}
+	if err := s.FlushSessions(); err != nil {
+		// Sessions that could not be saved are lost either way; keep
+		// shutting down rather than leave clients connected
+		log.Printf("Failed to flush sessions: %v", err)
+	}
+	return s.CloseEvents(ctx)
+}
+
+// StopIntake stops accepting work: listeners are closed and requests on
+// already-open connections get 503. The HTTP server finishes stopping in the
+// background once in-flight requests and SSE streams end; CloseEvents waits
+// for it. Calling StopIntake again has no effect.
+func (s *Server) StopIntake(ctx context.Context) {
+	s.stopOnce.Do(func() {
+		log.Println("Shutting down web server...")
+
+		s.intakeMu.Lock()
+		s.intakeStopped = true
+		s.intakeMu.Unlock()
+
+		go func() {
+			s.httpStopped <- s.server.Shutdown(ctx)
+		}()
+	})
+}
+
+// Drain waits for in-flight requests, including chat turns and image
+// generations, to finish. Returns an error if ctx ends first.
+func (s *Server) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("in-flight requests did not finish: %w", ctx.Err())
+	}
+}
+
+// FlushSessions saves every in-memory session. Images need no flush: they
+// are written before the request that produced them returns.
+func (s *Server) FlushSessions() error {
+	return s.sessionManager.Flush()
+}
+
+// CloseEvents sends a server-shutting-down event to every SSE client, closes
+// the streams, and waits for the HTTP server to finish stopping. Intake is
+// stopped first if it is still open.
+func (s *Server) CloseEvents(ctx context.Context) error {
+	s.StopIntake(ctx)
+
+	s.broker.SendEventToAll(EventServerShuttingDown, ServerShuttingDownData{ShuttingDown: true})
+	if err := s.broker.Shutdown(ctx); err != nil {
+		return fmt.Errorf("broker shutdown failed: %w", err)
+	}
+
+	s.closeOnce.Do(func() {
+		select {
+		case s.httpErr = <-s.httpStopped:
+		case <-ctx.Done():
+			s.httpErr = ctx.Err()
+		}
+	})
+	if s.httpErr != nil {
+		return fmt.Errorf("server shutdown failed: %w", s.httpErr)
+	}
+
+	log.Println("Web server stopped")
+	return nil
+}
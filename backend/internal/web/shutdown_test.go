@@ -0,0 +1,125 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+func newShutdownTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	s, err := NewServerWithDeps("", nil, nil, nil, persistence.NewImageStore(t.TempDir()), nil, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	return s
+}
+
+func TestShutdown_StopIntakeRejectsRequests(t *testing.T) {
+	s := newShutdownTestServer(t)
+
+	if w := serveAs(s, http.MethodGet, "/favorites", testGallerySessionID); w.Code != http.StatusOK {
+		t.Fatalf("status before shutdown = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	s.StopIntake(context.Background())
+
+	w := serveAs(s, http.MethodGet, "/favorites", testGallerySessionID)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status after StopIntake = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := w.Header().Get("Connection"); got != "close" {
+		t.Errorf("Connection header = %q, want close", got)
+	}
+}
+
+func TestShutdown_DrainWaitsForInflight(t *testing.T) {
+	s := newShutdownTestServer(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := s.trackIntake(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	finished := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/chat", nil))
+		close(finished)
+	}()
+	<-started
+
+	s.StopIntake(context.Background())
+
+	// Drain gives up when its context ends first
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Drain(ctx); err == nil {
+		t.Fatal("Drain() error = nil while a request is in flight")
+	}
+
+	close(release)
+	if err := s.Drain(context.Background()); err != nil {
+		t.Errorf("Drain() error = %v", err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Error("Drain() returned before the in-flight request finished")
+	}
+}
+
+func TestShutdown_EventStreamsNotDrained(t *testing.T) {
+	s := newShutdownTestServer(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := s.trackIntake(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events", nil))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Drain(ctx); err != nil {
+		t.Errorf("Drain() error = %v, want SSE streams to be left for CloseEvents", err)
+	}
+}
+
+func TestShutdown_SendsShuttingDownEvent(t *testing.T) {
+	s := newShutdownTestServer(t)
+	events := recordEvents(s, testGallerySessionID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	body := events.Body.String()
+	if !strings.Contains(body, "event: "+EventServerShuttingDown+"\n") {
+		t.Errorf("events = %q, want a %s event", body, EventServerShuttingDown)
+	}
+	if !strings.Contains(body, `"shutting_down":true`) {
+		t.Errorf("events = %q, want shutting_down true", body)
+	}
+	if n := s.broker.ConnectionCount(); n != 0 {
+		t.Errorf("ConnectionCount() = %d after Shutdown, want 0", n)
+	}
+
+	// Stages are safe to repeat
+	if err := s.Shutdown(ctx); err != nil {
+		t.Errorf("second Shutdown() error = %v", err)
+	}
+}
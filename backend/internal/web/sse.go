@@ -29,8 +29,14 @@ const (
 	EventPromptUpdate = "prompt-update"
 
 	// EventImageReady indicates a generated image is available for download.
-	// Data schema: {"url": string, "width": int, "height": int, "message_id": int}
-	// Example: {"url": "/images/abc123.png", "width": 512, "height": 512, "message_id": 42}
+	// alternate is set (1-based) when the image was regenerated as an
+	// alternate for message_id rather than replacing its preview. width and
+	// height are the size generated, which is smaller than the session's
+	// resolution when that does not fit in VRAM. seed is the seed the image
+	// was generated with, the one compute picked when a random seed was
+	// asked for, so the image can be reproduced.
+	// Data schema: {"url": string, "width": int, "height": int, "message_id": int, "alternate"?: int, "seed"?: int}
+	// Example: {"url": "/images/abc123.png", "width": 512, "height": 512, "message_id": 42, "seed": 1234567890}
 	EventImageReady = "image-ready"
 
 	// EventError indicates an error occurred during processing.
@@ -46,22 +52,110 @@ const (
 
 	// EventGenerationStarted indicates image generation has started.
 	// Sent before agent-triggered generation so the UI can show progress.
+	// The agent's tool call also sends it as soon as it streams, without a
+	// message_id, while the reply that triggers generation is unfinished.
 	// Data schema: {"source": string}
-	// Example: {"source": "agent"} or {"source": "manual"}
+	// Example: {"source": "agent"}, {"source": "manual"} or {"source": "regenerate", "message_id": 42}
 	EventGenerationStarted = "generation-started"
 
+	// EventGenerationPreview carries a low-resolution preview of an image
+	// being generated, sent every few diffusion steps so the UI can show it
+	// forming. image is a JPEG data URI; the image-ready event replaces it.
+	// Data schema: {"image": string, "step": int, "steps": int, "message_id"?: int}
+	// Example: {"image": "data:image/jpeg;base64,/9j/4AAQ...", "step": 8, "steps": 20, "message_id": 42}
+	EventGenerationPreview = "generation-preview"
+
 	// EventAgentRetry indicates the agent response failed validation and is being retried.
 	// The UI should clear any partial streaming message.
 	// Data schema: {"attempt": int}
 	// Example: {"attempt": 2}
 	EventAgentRetry = "agent-retry"
 
+	// EventAgentReconnecting indicates the LLM server could not be reached and
+	// the request will be retried after delay_ms. The UI should clear any
+	// partial streaming message and keep showing that the agent is working.
+	// Data schema: {"attempt": int, "delay_ms": int}
+	// Example: {"attempt": 1, "delay_ms": 412}
+	EventAgentReconnecting = "agent-reconnecting"
+
 	// EventAgentThinking indicates the agent has begun processing the user's request.
 	// Sent immediately before the LLM call starts so the UI can show thinking state.
 	// Data schema: {"started": bool}
 	// Example: {"started": true}
 	EventAgentThinking = "agent-thinking"
 
+	// EventImageDeleted indicates a stored image was removed.
+	// The UI should drop any thumbnail or preview showing the URL.
+	// message_id is 0 for in-memory images not associated with a message.
+	// Data schema: {"url": string, "message_id": int}
+	// Example: {"url": "/sessions/abc/images/42.png", "message_id": 42}
+	EventImageDeleted = "image-deleted"
+
+	// EventChatSwitched indicates the session's active chat changed.
+	// Sent when a chat is created, switched to, or the active chat is deleted.
+	// The UI should reload the conversation for the new chat.
+	// Data schema: {"chat_id": string, "name": string}
+	// Example: {"chat_id": "3f9a1c2b7d4e5f60", "name": "Chat 2"}
+	EventChatSwitched = "chat-switched"
+
+	// EventHistoryRewound indicates a user message was edited and resent.
+	// The UI should remove the message with message_id and every message after
+	// it, and show prompt as the current prompt. The agent's response to the
+	// edited message follows as the usual streaming events.
+	// Data schema: {"message_id": int, "prompt": string}
+	// Example: {"message_id": 7, "prompt": "a fluffy cat"}
+	EventHistoryRewound = "history-rewound"
+
+	// EventMessageDeleted indicates a single message was removed from history.
+	// The UI should remove the message with message_id and its images, and
+	// show prompt as the current prompt (it rolls back if the deleted message
+	// set it).
+	// Data schema: {"message_id": int, "prompt": string}
+	// Example: {"message_id": 7, "prompt": "a fluffy cat"}
+	EventMessageDeleted = "message-deleted"
+
+	// EventServerShuttingDown is the last event sent before the server closes
+	// every SSE stream on shutdown. In-flight requests have finished and
+	// sessions are saved; the UI should stop reconnecting and tell the user.
+	// Data schema: {"shutting_down": bool}
+	// Example: {"shutting_down": true}
+	EventServerShuttingDown = "server-shutting-down"
+
+	// EventAgentPromptReloaded is sent to every session when the agent
+	// prompt files changed and were reloaded. Chats use the new prompt from
+	// their next turn; personas lists the persona IDs now available.
+	// Data schema: {"personas": [string]}
+	// Example: {"personas": ["ara", "pixel-art"]}
+	EventAgentPromptReloaded = "agent-prompt-reloaded"
+
+	// EventPromptFlagged indicates content moderation flagged an image
+	// prompt in warn mode; the image is still generated. Blocked prompts
+	// are reported with an error event instead.
+	// Data schema: {"message_id": int}
+	// Example: {"message_id": 5}
+	EventPromptFlagged = "prompt-flagged"
+
+	// EventComputeStatus is sent to every session when the compute process
+	// stopped unexpectedly and is being restarted, is back, or could not be
+	// restarted. Generations fail until state is "running" again.
+	// Data schema: {"state": "restarting"|"running"|"failed", "attempt": int}
+	// Example: {"state": "restarting", "attempt": 2}
+	EventComputeStatus = "compute-status"
+
+	// EventQueuePosition is sent when a generation waits for compute to
+	// finish others: its place in the queue, 1 being next, whenever that
+	// changes, and position 0 once it starts.
+	// Data schema: {"position": int, "message_id": int (optional)}
+	// Example: {"position": 2, "message_id": 5}
+	EventQueuePosition = "queue-position"
+
+	// EventImagesEvicted indicates images of the session were deleted to
+	// keep config/sessions under --sessions-max-mb, oldest first and
+	// favorites spared. Each image was also reported with image-deleted.
+	// Data schema: {"message_ids": [int], "freed_bytes": int}
+	// Example: {"message_ids": [3, 5], "freed_bytes": 2483027}
+	EventImagesEvicted = "images-evicted"
+
 	// MaxConnections is the maximum number of concurrent SSE connections.
 	MaxConnections = 1000
 )
@@ -75,9 +169,12 @@ type Event struct {
 // connection represents a single SSE connection for a session.
 type connection struct {
 	sessionID string
-	writer    http.ResponseWriter
-	flusher   http.Flusher
-	done      chan struct{}
+	// mu serializes writes: events for a session are sent from the
+	// goroutines of different requests
+	mu      sync.Mutex
+	writer  http.ResponseWriter
+	flusher http.Flusher
+	done    chan struct{}
 }
 
 // Broker manages SSE connections and routes events to the correct sessions.
@@ -213,6 +310,7 @@ func (b *Broker) CloseSession(sessionID string) {
 	if ok {
 		close(conn.done)
 		delete(b.connections, sessionID)
+		sseConnections.Dec()
 	}
 	b.mu.Unlock()
 }
@@ -244,6 +342,7 @@ func (b *Broker) addConnection(conn *connection) bool {
 	}
 
 	b.connections[conn.sessionID] = conn
+	sseConnections.Inc()
 	return true
 }
 
@@ -256,6 +355,7 @@ func (b *Broker) removeConnection(sessionID string, conn *connection) {
 	// Only delete if this connection is still the registered one
 	if current, ok := b.connections[sessionID]; ok && current == conn {
 		delete(b.connections, sessionID)
+		sseConnections.Dec()
 	}
 }
 
@@ -276,6 +376,9 @@ func (b *Broker) sendToConnection(conn *connection, event Event) error {
 		return fmt.Errorf("failed to marshal event data: %w", err)
 	}
 
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
 	// Format SSE event
 	// event: <type>\n
 	// data: <json>\n
@@ -300,6 +403,7 @@ func (b *Broker) Shutdown(ctx context.Context) error {
 	for sessionID, conn := range b.connections {
 		close(conn.done)
 		delete(b.connections, sessionID)
+		sseConnections.Dec()
 	}
 
 	return nil
@@ -312,13 +416,88 @@ type AgentDoneData struct {
 	Done        bool `json:"done"`
 	MessageID   int  `json:"message_id"`
 	HasSnapshot bool `json:"has_snapshot"`
+	// Interrupted is set when the reply was cut short by POST /chat/cancel
+	Interrupted bool `json:"interrupted,omitempty"`
 }
 
 // ImageReadyData represents the data sent with EventImageReady.
-// It includes the URL, dimensions, and message ID the image is associated with.
+// It includes the URL, the dimensions generated, and message ID the image is
+// associated with.
 type ImageReadyData struct {
 	URL       string `json:"url"`
 	Width     int    `json:"width"`
 	Height    int    `json:"height"`
 	MessageID int    `json:"message_id"`
+	Alternate int    `json:"alternate,omitempty"`
+	// Seed the image was generated with, also when a random one was
+	// asked for; omitted if compute did not report it
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// GenerationPreviewData represents the data sent with EventGenerationPreview.
+type GenerationPreviewData struct {
+	Image     string `json:"image"`
+	Step      int    `json:"step"`
+	Steps     int    `json:"steps"`
+	MessageID int    `json:"message_id,omitempty"`
+}
+
+// ImageDeletedData represents the data sent with EventImageDeleted.
+type ImageDeletedData struct {
+	URL string `json:"url"`
+	// MessageID is the message the image belonged to; 0 (omitted) for
+	// in-memory images, which belong to no message
+	MessageID int `json:"message_id,omitempty"`
+}
+
+// ChatSwitchedData represents the data sent with EventChatSwitched.
+type ChatSwitchedData struct {
+	ChatID string `json:"chat_id"`
+	Name   string `json:"name"`
+}
+
+// HistoryRewoundData represents the data sent with EventHistoryRewound.
+type HistoryRewoundData struct {
+	MessageID int    `json:"message_id"`
+	Prompt    string `json:"prompt"`
+}
+
+// MessageDeletedData represents the data sent with EventMessageDeleted.
+type MessageDeletedData struct {
+	MessageID int    `json:"message_id"`
+	Prompt    string `json:"prompt"`
+}
+
+// ServerShuttingDownData represents the data sent with EventServerShuttingDown.
+type ServerShuttingDownData struct {
+	ShuttingDown bool `json:"shutting_down"`
+}
+
+// AgentPromptReloadedData represents the data sent with EventAgentPromptReloaded.
+type AgentPromptReloadedData struct {
+	Personas []string `json:"personas"`
+}
+
+// ComputeStatusData represents the data sent with EventComputeStatus.
+// Attempt counts the restarts since compute last ran for a while.
+type ComputeStatusData struct {
+	State   string `json:"state"`
+	Attempt int    `json:"attempt,omitempty"`
+}
+
+// QueuePositionData represents the data sent with EventQueuePosition.
+type QueuePositionData struct {
+	Position  int `json:"position"`
+	MessageID int `json:"message_id,omitempty"`
+}
+
+// ImagesEvictedData represents the data sent with EventImagesEvicted.
+type ImagesEvictedData struct {
+	MessageIDs []int `json:"message_ids"`
+	FreedBytes int64 `json:"freed_bytes"`
+}
+
+// PromptFlaggedData represents the data sent with EventPromptFlagged.
+type PromptFlaggedData struct {
+	MessageID int `json:"message_id,omitempty"`
 }
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// summaryPrompt instructs the LLM to summarize a conversation for
+// --llm-summarize. The summary replaces messages the agent no longer sees,
+// so it has to keep every requirement, especially the negative ones that
+// keyword extraction loses.
+const summaryPrompt = `You summarize conversations between a user and an image generation assistant.
+Write what the user currently wants as short lines in this format, leaving out lines that do not apply:
+Subject: ...
+Style: ...
+Details: ...
+Avoid: ...
+Keep every requirement and exclusion the user stated, such as "no hats" or "not realistic", and drop ones the user later took back.
+Reply with the summary only.`
+
+// errEmptySummary is returned when the LLM replies to a summary request
+// without any text.
+var errEmptySummary = errors.New("LLM returned an empty summary")
+
+// summarize asks the LLM for a short summary of what the user wants in
+// messages. If previous is set, it summarizes earlier messages and the new
+// summary extends it. System messages are skipped.
+func (s *Server) summarize(ctx context.Context, previous string, messages []ollama.Message) (string, error) {
+	var request strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&request, "Summary so far:\n%s\n\nLater messages:\n", previous)
+	}
+	for _, msg := range messages {
+		if msg.Role == ollama.RoleSystem || msg.Content == "" {
+			continue
+		}
+		fmt.Fprintf(&request, "%s: %s\n", msg.Role, msg.Content)
+	}
+
+	result, err := s.llmClient.Chat(ctx, []ollama.Message{
+		{Role: ollama.RoleSystem, Content: summaryPrompt},
+		{Role: ollama.RoleUser, Content: request.String()},
+	}, nil, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	summary := strings.TrimSpace(result.Response)
+	if summary == "" {
+		return "", errEmptySummary
+	}
+	return summary, nil
+}
+
+// summarizeDropped makes sure the manager's summary covers exactly the
+// oldest dropped history messages, which BuildLLMContextWithin left out.
+// A summary of fewer messages is extended with the rest; one of more is
+// rewritten. Returns true if the summary changed. Failures are logged and
+// leave the summary as it was, so the context falls back to a plain note.
+func (s *Server) summarizeDropped(ctx context.Context, sessionID string, manager *conversation.Manager, dropped int) bool {
+	history := manager.GetMessages()
+	if dropped > len(history) {
+		dropped = len(history)
+	}
+	if dropped == 0 {
+		return false
+	}
+	through := history[dropped-1].ID
+
+	previous, covered := manager.Summary()
+	if covered == through {
+		return false
+	}
+	if covered > through {
+		previous, covered = "", 0
+	}
+
+	var messages []ollama.Message
+	for _, msg := range history[:dropped] {
+		if msg.ID > covered {
+			messages = append(messages, ollama.Message{Role: msg.Role, Content: msg.Content})
+		}
+	}
+
+	summary, err := s.summarize(ctx, previous, messages)
+	if err != nil {
+		log.Printf("Failed to summarize old messages for session %s: %v", sessionID, err)
+		return false
+	}
+	manager.SetSummary(summary, through)
+	log.Printf("Summarized %d old messages for session %s", len(messages), sessionID)
+	return true
+}
@@ -0,0 +1,147 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// summarizingClient answers summary requests with a fixed summary and other
+// chats with "ok", recording both. Other chats fail with chatErrs in turn
+// until it runs out.
+type summarizingClient struct {
+	mockOllamaClient
+	contextLength int
+	summary       string
+	summaryErr    error
+	chatErrs      []error
+	summaries     []string
+	chats         [][]ollama.Message
+}
+
+func (c *summarizingClient) ContextLength(ctx context.Context, model string) (int, error) {
+	return c.contextLength, nil
+}
+
+func (c *summarizingClient) Chat(ctx context.Context, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error) {
+	if messages[0].Content == summaryPrompt {
+		c.summaries = append(c.summaries, messages[1].Content)
+		return ollama.ChatResult{Response: c.summary}, c.summaryErr
+	}
+	c.chats = append(c.chats, messages)
+	if len(c.chatErrs) > 0 {
+		err := c.chatErrs[0]
+		c.chatErrs = c.chatErrs[1:]
+		return ollama.ChatResult{}, err
+	}
+	return ollama.ChatResult{Response: "ok"}, nil
+}
+
+func TestRunChatTurn_SummarizesDroppedMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		summarize   bool
+		summaryErr  error
+		wantSummary bool
+	}{
+		{"disabled", false, nil, false},
+		{"enabled", true, nil, true},
+		{"summary fails", true, errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, nil)
+			s.llmSummarize = tt.summarize
+			// Leave the other tools' definitions out of the context budget,
+			// so the second turn drops no more messages than the first
+			s.agentTools = nil
+			client := &summarizingClient{contextLength: 2048, summary: "Subject: cat\nAvoid: hats", summaryErr: tt.summaryErr}
+			s.setLLMClientForTesting(client)
+
+			session := s.sessionManager.GetSession(testGallerySessionID)
+			manager := session.Manager()
+			manager.AddUserMessage("a cat, no hats")
+			for i := 0; i < 20; i++ {
+				manager.AddAssistantMessage(strings.Repeat("reply ", 80), "", nil)
+				manager.AddUserMessage(strings.Repeat("user ", 80))
+			}
+
+			s.runChatTurn(context.Background(), session, testGallerySessionID, "", manager, "a cat", 20, 3.5, -1)
+
+			if len(client.chats) == 0 {
+				t.Fatal("Chat() was not called")
+			}
+			note := client.chats[0][2].Content
+			if got := strings.Contains(note, "Avoid: hats"); got != tt.wantSummary {
+				t.Errorf("message after settings = %q, want summary %v", note, tt.wantSummary)
+			}
+			if !tt.wantSummary && !strings.Contains(note, "earlier messages were left out") {
+				t.Errorf("message after settings = %q, want dropped note", note)
+			}
+			if tt.summarize && !strings.Contains(client.summaries[0], "user: a cat, no hats") {
+				t.Errorf("summary request = %q, want the oldest user message", client.summaries[0])
+			}
+			if !tt.wantSummary {
+				return
+			}
+
+			// The next turn reuses the cached summary
+			requests := len(client.summaries)
+			s.runChatTurn(context.Background(), session, testGallerySessionID, "", manager, "a cat", 20, 3.5, -1)
+			if len(client.summaries) != requests {
+				t.Errorf("summary requests = %d after second turn, want %d", len(client.summaries), requests)
+			}
+			if note := client.chats[1][2].Content; !strings.Contains(note, "Avoid: hats") {
+				t.Errorf("second turn message after settings = %q, want summary", note)
+			}
+		})
+	}
+}
+
+func TestChatWithRetry_CompactsWithSummary(t *testing.T) {
+	tests := []struct {
+		name       string
+		summaryErr error
+		wantWants  string
+	}{
+		{"summary", nil, "User wants: Subject: cat\nAvoid: hats"},
+		{"summary fails", errors.New("boom"), "User wants: cat, no hats"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &summarizingClient{
+				summary:    "Subject: cat\nAvoid: hats",
+				summaryErr: tt.summaryErr,
+				chatErrs:   []error{ollama.ErrMissingFields},
+			}
+			s, err := NewServerWithDeps("", client, nil, nil, nil, nil, nil)
+			if err != nil {
+				t.Fatalf("NewServerWithDeps failed: %v", err)
+			}
+			s.llmSummarize = true
+
+			messages := []ollama.Message{
+				{Role: ollama.RoleSystem, Content: "system prompt"},
+				{Role: ollama.RoleUser, Content: "a cat, no hats"},
+			}
+			if _, err := s.chatWithRetry(context.Background(), "test-session", "", messages, nil, nil, nil); err != nil {
+				t.Fatalf("chatWithRetry failed: %v", err)
+			}
+
+			if len(client.chats) != 2 {
+				t.Fatalf("chat calls = %d, want 2", len(client.chats))
+			}
+			if got := client.chats[1][0].Content; !strings.HasPrefix(got, tt.wantWants) {
+				t.Errorf("compacted context = %q, want prefix %q", got, tt.wantWants)
+			}
+			if strings.Contains(client.summaries[0], "system prompt") {
+				t.Errorf("summary request = %q, want system messages skipped", client.summaries[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// GPU is a GPU compute can generate on, as listed by weave-compute
+// --list-gpus.
+type GPU struct {
+	// Index is the device index --gpu selects it with
+	Index       int    `json:"index"`
+	Name        string `json:"name"`
+	VRAMTotalMB int    `json:"vram_total_mb"`
+	VRAMFreeMB  int    `json:"vram_free_mb"`
+}
+
+// systemResponse is the response for GET /system.
+type systemResponse struct {
+	// GPUs are the GPUs compute detected; empty if it found none or could
+	// not be asked
+	GPUs []GPU `json:"gpus"`
+	// ComputeGPUs are the indexes of the GPUs the compute workers generate
+	// on, one per worker
+	ComputeGPUs []int `json:"compute_gpus"`
+}
+
+// SetGPUs records the GPUs compute detected when weave started, for
+// GET /system. It is safe to call while the server is running, and carries
+// over Reconfigure.
+func (s *Server) SetGPUs(gpus []GPU) {
+	s.gpus.Store(&gpus)
+}
+
+// handleSystem reports the GPUs compute can generate on and the ones the
+// compute workers use, so users with several GPUs can pick one for
+// diffusion with --gpu and leave the others to the LLM.
+// GET /system
+func (s *Server) handleSystem(w http.ResponseWriter, r *http.Request) {
+	resp := systemResponse{GPUs: []GPU{}, ComputeGPUs: s.computeGPUs}
+	if gpus := s.gpus.Load(); gpus != nil && *gpus != nil {
+		resp.GPUs = *gpus
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode system response: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+func TestHandleSystem(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         *config.Config
+		gpus        []GPU
+		wantGPUs    []GPU
+		wantCompute []int
+	}{
+		{
+			name:        "not detected",
+			wantGPUs:    []GPU{},
+			wantCompute: []int{0},
+		},
+		{
+			name: "dedicated GPU",
+			cfg:  &config.Config{ComputeWorkers: 1, GPUs: []int{1}},
+			gpus: []GPU{
+				{Index: 0, Name: "AMD Radeon RX 7900 XTX", VRAMTotalMB: 24560, VRAMFreeMB: 9000},
+				{Index: 1, Name: "NVIDIA GeForce RTX 3060", VRAMTotalMB: 12288, VRAMFreeMB: 11800},
+			},
+			wantGPUs: []GPU{
+				{Index: 0, Name: "AMD Radeon RX 7900 XTX", VRAMTotalMB: 24560, VRAMFreeMB: 9000},
+				{Index: 1, Name: "NVIDIA GeForce RTX 3060", VRAMTotalMB: 12288, VRAMFreeMB: 11800},
+			},
+			wantCompute: []int{1},
+		},
+		{
+			name:        "one per worker",
+			cfg:         &config.Config{ComputeWorkers: 2},
+			wantGPUs:    []GPU{},
+			wantCompute: []int{0, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, tt.cfg)
+			if tt.gpus != nil {
+				s.SetGPUs(tt.gpus)
+			}
+
+			w := serveAs(s, http.MethodGet, "/system", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			var resp systemResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if !slices.Equal(resp.GPUs, tt.wantGPUs) {
+				t.Errorf("gpus = %+v, want %+v", resp.GPUs, tt.wantGPUs)
+			}
+			if !slices.Equal(resp.ComputeGPUs, tt.wantCompute) {
+				t.Errorf("compute_gpus = %v, want %v", resp.ComputeGPUs, tt.wantCompute)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+// maxSearchQueryLength limits the length of an image search query.
+const maxSearchQueryLength = 200
+
+// imageTagsResponse is the response for PUT /images/{id}/tags.
+type imageTagsResponse struct {
+	Status    string   `json:"status"`
+	SessionID string   `json:"session_id"`
+	MessageID int      `json:"message_id"`
+	Tags      []string `json:"tags"`
+}
+
+// searchResultItem is one image in the GET /images/search response.
+type searchResultItem struct {
+	MessageID int      `json:"message_id"`
+	URL       string   `json:"url"`
+	Prompt    string   `json:"prompt"`
+	Tags      []string `json:"tags"`
+}
+
+// searchResponse is the response for GET /images/search.
+type searchResponse struct {
+	Status    string             `json:"status"`
+	SessionID string             `json:"session_id"`
+	Query     string             `json:"query"`
+	Results   []searchResultItem `json:"results"`
+	Page      pageInfo           `json:"page"`
+}
+
+// writeTagsJSON encodes a tag API response.
+func writeTagsJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode tags response: %v", err)
+	}
+}
+
+// handleSetImageTags replaces the tags of one of the session's images.
+// PUT /images/{id}/tags (form: tags, comma-separated; empty clears)
+func (s *Server) handleSetImageTags(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID, ok := parseImageMessageID(r)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "invalid message ID")
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	if !s.imageStore.Exists(sessionID, messageID) {
+		writeJSONError(w, http.StatusNotFound, "image not found")
+		return
+	}
+
+	tags, err := s.tagIndex.SetTags(sessionID, messageID, strings.Split(r.FormValue("tags"), ","))
+	if err != nil {
+		switch {
+		case errors.Is(err, persistence.ErrInvalidTag):
+			writeJSONError(w, http.StatusBadRequest, "invalid tag")
+		case errors.Is(err, persistence.ErrTooManyTags):
+			writeJSONError(w, http.StatusBadRequest, "too many tags")
+		default:
+			log.Printf("Failed to tag image %s/%d: %v", sessionID, messageID, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to save tags")
+		}
+		return
+	}
+
+	writeTagsJSON(w, imageTagsResponse{
+		Status:    "ok",
+		SessionID: sessionID,
+		MessageID: messageID,
+		Tags:      tags,
+	})
+}
+
+// handleSearchImages finds the session's images with a tag equal to the
+// query or a prompt containing it, ignoring case. Results are newest first
+// and can be narrowed with the list filters; the time range applies to when
+// the image's message was created.
+// GET /images/search?q=&limit=&offset=&since=&until=&prompt=
+func (s *Server) handleSearchImages(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" || len(query) > maxSearchQueryLength {
+		http.Error(w, "Invalid search query", http.StatusBadRequest)
+		return
+	}
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tagged, err := s.tagIndex.Find(sessionID, query)
+	if err != nil {
+		log.Printf("Failed to search tags for session %s: %v", sessionID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	matches := make(map[int]bool, len(tagged))
+	for _, id := range tagged {
+		matches[id] = true
+	}
+
+	// Prompts live in the conversation history of each chat
+	session := s.sessionManager.GetSession(sessionID)
+	needle := strings.ToLower(query)
+	for _, info := range session.Chats() {
+		manager := session.ChatManager(info.ID)
+		if manager == nil {
+			continue
+		}
+		for _, msg := range manager.GetMessages() {
+			if msg.Snapshot != nil && strings.Contains(strings.ToLower(msg.Snapshot.Prompt), needle) {
+				matches[msg.ID] = true
+			}
+		}
+	}
+
+	ids := make([]int, 0, len(matches))
+	for id := range matches {
+		if s.imageStore.Exists(sessionID, id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+
+	results := make([]searchResultItem, 0, len(ids))
+	for _, id := range ids {
+		prompt := ""
+		var createdAt time.Time
+		if manager := session.ManagerForMessage(id); manager != nil {
+			if msg := manager.GetMessage(id); msg != nil {
+				createdAt = msg.CreatedAt
+				if msg.Snapshot != nil {
+					prompt = msg.Snapshot.Prompt
+				}
+			}
+		}
+		if !q.matchesTime(createdAt) || !q.matchesImage(true) || !q.matchesPrompt(prompt) {
+			continue
+		}
+
+		tags, err := s.tagIndex.Tags(sessionID, id)
+		if err != nil {
+			log.Printf("Failed to load tags for image %s/%d: %v", sessionID, id, err)
+			tags = []string{}
+		}
+		results = append(results, searchResultItem{
+			MessageID: id,
+			URL:       s.imageStore.GetURL(sessionID, id),
+			Prompt:    prompt,
+			Tags:      tags,
+		})
+	}
+
+	start, end, page := q.page(len(results))
+	writeTagsJSON(w, searchResponse{
+		Status:    "ok",
+		SessionID: sessionID,
+		Query:     query,
+		Results:   results[start:end],
+		Page:      page,
+	})
+}
@@ -0,0 +1,150 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+func setTagsAs(s *Server, target, sessionID, tags string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, target, strings.NewReader(url.Values{"tags": {tags}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: sessionID})
+	req.Header.Set(CSRFHeaderName, s.csrfToken(sessionID))
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+func searchImages(t *testing.T, s *Server, query string) searchResponse {
+	t.Helper()
+
+	w := serveAs(s, http.MethodGet, "/images/search?q="+url.QueryEscape(query), testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp searchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("search response is not JSON: %v", err)
+	}
+	return resp
+}
+
+func TestImageTags_SetAndSearch(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	w := setTagsAs(s, "/images/1.png/tags", testGallerySessionID, "Evening, beach ,evening")
+	if w.Code != http.StatusOK {
+		t.Fatalf("set tags status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var set imageTagsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &set); err != nil {
+		t.Fatalf("set tags response is not JSON: %v", err)
+	}
+	if want := []string{"beach", "evening"}; !reflect.DeepEqual(set.Tags, want) {
+		t.Errorf("tags = %q, want %q", set.Tags, want)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{name: "tag", query: "EVENING", want: 1},
+		{name: "prompt substring", query: "suns", want: 1},
+		{name: "partial tag", query: "even", want: 0},
+		{name: "no match", query: "mountain", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := searchImages(t, s, tt.query)
+			if len(got.Results) != tt.want {
+				t.Fatalf("results = %+v, want %d", got.Results, tt.want)
+			}
+			if tt.want == 0 {
+				return
+			}
+			result := got.Results[0]
+			if result.MessageID != 1 || result.Prompt != "a sunset" || result.URL != s.imageStore.GetURL(testGallerySessionID, 1) {
+				t.Errorf("result = %+v, want message 1 with its prompt and URL", result)
+			}
+			if !reflect.DeepEqual(result.Tags, []string{"beach", "evening"}) {
+				t.Errorf("result tags = %q, want [beach evening]", result.Tags)
+			}
+		})
+	}
+
+	// Clearing the tags leaves the prompt searchable
+	if w := setTagsAs(s, "/images/1/tags", testGallerySessionID, ""); w.Code != http.StatusOK {
+		t.Fatalf("clear tags status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := searchImages(t, s, "evening"); len(got.Results) != 0 {
+		t.Errorf("results after clearing tags = %+v, want none", got.Results)
+	}
+	if got := searchImages(t, s, "sunset"); len(got.Results) != 1 {
+		t.Errorf("prompt results after clearing tags = %+v, want one", got.Results)
+	}
+}
+
+func TestImageTags_DeletedImageDropped(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	setTagsAs(s, "/images/1/tags", testGallerySessionID, "beach")
+	w := serveAs(s, http.MethodDelete, "/sessions/"+testGallerySessionID+"/images/1.png", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if got := searchImages(t, s, "beach"); len(got.Results) != 0 {
+		t.Errorf("results after image delete = %+v, want none", got.Results)
+	}
+	if ids, _ := s.tagIndex.Find(testGallerySessionID, "beach"); len(ids) != 0 {
+		t.Errorf("tags kept after image delete: %v", ids)
+	}
+}
+
+func TestImageTags_Errors(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	tooMany := make([]string, persistence.MaxTagsPerImage+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag%d", i)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		sessionID  string
+		tags       string
+		wantStatus int
+	}{
+		{name: "in-memory image ID", path: "/images/abc123/tags", sessionID: testGallerySessionID, tags: "a", wantStatus: http.StatusBadRequest},
+		{name: "missing image", path: "/images/99/tags", sessionID: testGallerySessionID, tags: "a", wantStatus: http.StatusNotFound},
+		{name: "another session's image", path: "/images/1/tags", sessionID: testDeleteSessionID, tags: "a", wantStatus: http.StatusNotFound},
+		{name: "tag too long", path: "/images/1/tags", sessionID: testGallerySessionID, tags: strings.Repeat("a", 33), wantStatus: http.StatusBadRequest},
+		{name: "too many tags", path: "/images/1/tags", sessionID: testGallerySessionID, tags: strings.Join(tooMany, ","), wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := setTagsAs(s, tt.path, tt.sessionID, tt.tags)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	for _, query := range []string{"", "%20", strings.Repeat("a", maxSearchQueryLength+1)} {
+		if w := serveAs(s, http.MethodGet, "/images/search?q="+query, testGallerySessionID); w.Code != http.StatusBadRequest {
+			t.Errorf("search %q status = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/client"
+)
+
+// defaultGenerateTimeout is the --generate-timeout of servers created
+// without one.
+const defaultGenerateTimeout = 2 * time.Minute
+
+// Generations the generate timeout is for (--generate-timeout); larger
+// ones get proportionally longer.
+const (
+	timeoutReferenceSteps  = 20
+	timeoutReferencePixels = 1024 * 1024
+)
+
+// generationTimeout returns how long a generation of steps at width x
+// height may take: the generate timeout, scaled by how much more work the
+// generation is than timeoutReferenceSteps at timeoutReferencePixels.
+// Smaller generations get the generate timeout as it is.
+func (s *Server) generationTimeout(steps int, width, height uint32) time.Duration {
+	base := s.generateTimeout
+	if base <= 0 {
+		base = defaultGenerateTimeout
+	}
+	work := float64(steps) * float64(width) * float64(height)
+	scale := work / (timeoutReferenceSteps * timeoutReferencePixels)
+	if scale <= 1 {
+		return base
+	}
+	return time.Duration(float64(base) * scale).Round(time.Second)
+}
+
+// generationErrorMessage returns the message to show the user for err, the
+// error of sending a generation to compute with the timeout limit. ctx is
+// the context the generation's timeout was derived from, so a generation
+// the user cancelled is not reported as timed out.
+func generationErrorMessage(ctx context.Context, err error, limit time.Duration) string {
+	switch {
+	case ctx.Err() == nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, client.ErrReadTimeout)):
+		return fmt.Sprintf("Image generation took longer than %s and was stopped. Try fewer steps or a smaller size, or raise --generate-timeout.", limit)
+	case errors.Is(err, client.ErrConnectionClosed) || errors.Is(err, client.ErrReaderDead) ||
+		errors.Is(err, client.ErrHeartbeatLost) || errors.Is(err, net.ErrClosed):
+		return "The image generation process stopped unexpectedly, possibly crashed. Try again in a moment."
+	default:
+		return "Failed to generate image"
+	}
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/client"
+)
+
+func TestGenerationTimeout(t *testing.T) {
+	s := &Server{generateTimeout: 2 * time.Minute}
+	tests := []struct {
+		name          string
+		steps         int
+		width, height uint32
+		want          time.Duration
+	}{
+		{name: "reference", steps: 20, width: 1024, height: 1024, want: 2 * time.Minute},
+		{name: "smaller", steps: 4, width: 512, height: 512, want: 2 * time.Minute},
+		{name: "100 steps at 1024x1024", steps: 100, width: 1024, height: 1024, want: 10 * time.Minute},
+		{name: "40 steps at 768x768", steps: 40, width: 768, height: 768, want: 135 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.generationTimeout(tt.steps, tt.width, tt.height); got != tt.want {
+				t.Errorf("generationTimeout(%d, %d, %d) = %v, want %v", tt.steps, tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+
+	// Servers created without a timeout use the default
+	if got := (&Server{}).generationTimeout(20, 1024, 1024); got != defaultGenerateTimeout {
+		t.Errorf("generationTimeout() without a generate timeout = %v, want %v", got, defaultGenerateTimeout)
+	}
+}
+
+func TestGenerationErrorMessage(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{name: "deadline", ctx: context.Background(), err: context.DeadlineExceeded, want: "took longer than 5m0s"},
+		{name: "read timeout", ctx: context.Background(), err: client.ErrReadTimeout, want: "took longer than 5m0s"},
+		{name: "connection closed", ctx: context.Background(), err: client.ErrConnectionClosed, want: "stopped unexpectedly"},
+		{name: "heartbeat lost", ctx: context.Background(), err: fmt.Errorf("send: %w", client.ErrHeartbeatLost), want: "stopped unexpectedly"},
+		{name: "cancelled by the user", ctx: cancelled, err: context.Canceled, want: "Failed to generate image"},
+		{name: "other", ctx: context.Background(), err: errors.New("boom"), want: "Failed to generate image"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := generationErrorMessage(tt.ctx, tt.err, 5*time.Minute); !strings.Contains(got, tt.want) {
+				t.Errorf("generationErrorMessage() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
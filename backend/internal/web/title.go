@@ -0,0 +1,97 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// titlePrompt instructs the LLM to name a conversation for the session
+// list.
+const titlePrompt = `You name conversations between a user and an image generation assistant.
+Reply with a title of at most six words describing what the user is making, such as "Lighthouse on a stormy coast".
+Reply with the title only, without quotes or a trailing period.`
+
+const (
+	// titleTimeout is how long the LLM may take to title a session
+	titleTimeout = 30 * time.Second
+
+	// titleMessages is how many of the first messages a title is based on
+	titleMessages = 6
+)
+
+// errEmptyTitle is returned when the LLM replies to a title request
+// without any text.
+var errEmptyTitle = errors.New("LLM returned an empty title")
+
+// titleSessionAsync titles the session in the background if it has no
+// title yet, so the request that generated its first image isn't held up.
+// Shutdown waits for it like for a request.
+func (s *Server) titleSessionAsync(ctx context.Context, sessionID string, session *conversation.Session, manager *conversation.Manager) {
+	if s.llmClient == nil || session.Title() != "" {
+		return
+	}
+
+	s.inflight.Add(1)
+	go func() {
+		defer s.inflight.Done()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), titleTimeout)
+		defer cancel()
+		s.titleSession(ctx, sessionID, session, manager)
+	}()
+}
+
+// titleSession asks the LLM for a title based on the chat's first
+// messages. Failures are logged; the session then stays listed under its
+// first message. A title set in the meantime is kept.
+func (s *Server) titleSession(ctx context.Context, sessionID string, session *conversation.Session, manager *conversation.Manager) {
+	messages := manager.GetMessages()
+	if len(messages) > titleMessages {
+		messages = messages[:titleMessages]
+	}
+
+	title, err := s.generateTitle(ctx, messages)
+	if err != nil {
+		log.Printf("Failed to title session %s: %v", sessionID, err)
+		return
+	}
+	if session.Title() != "" {
+		return
+	}
+	session.SetTitle(title)
+	log.Printf("Titled session %s: %q", sessionID, session.Title())
+}
+
+// generateTitle asks the LLM for a short title for messages. Quotes and a
+// trailing period are stripped, and only the first line is kept.
+func (s *Server) generateTitle(ctx context.Context, messages []conversation.ConversationMessage) (string, error) {
+	var request strings.Builder
+	for _, msg := range messages {
+		if msg.Role == conversation.RoleSystem || msg.Content == "" {
+			continue
+		}
+		fmt.Fprintf(&request, "%s: %s\n", msg.Role, msg.Content)
+	}
+
+	result, err := s.llmClient.Chat(ctx, []ollama.Message{
+		{Role: ollama.RoleSystem, Content: titlePrompt},
+		{Role: ollama.RoleUser, Content: request.String()},
+	}, nil, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to title conversation: %w", err)
+	}
+
+	title, _, _ := strings.Cut(strings.TrimSpace(result.Response), "\n")
+	title = strings.TrimSuffix(strings.Trim(strings.TrimSpace(title), `"'`), ".")
+	if title == "" {
+		return "", errEmptyTitle
+	}
+	return title, nil
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// titlingClient answers every chat with a fixed reply, recording the
+// messages it was sent.
+type titlingClient struct {
+	mockOllamaClient
+	reply    string
+	err      error
+	messages []ollama.Message
+}
+
+func (c *titlingClient) Chat(ctx context.Context, messages []ollama.Message, seed *int64, tools []ollama.Tool, callback ollama.StreamCallback) (ollama.ChatResult, error) {
+	c.messages = messages
+	return ollama.ChatResult{Response: c.reply}, c.err
+}
+
+func TestTitleSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		reply     string
+		err       error
+		existing  string
+		wantTitle string
+	}{
+		{"titled", "\"Foggy harbor.\"\nIt shows a harbor", nil, "", "Foggy harbor"},
+		{"keeps existing title", "Foggy harbor", nil, "Red barn", "Red barn"},
+		{"empty reply", "  \n", nil, "", ""},
+		{"LLM fails", "", errors.New("boom"), "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, nil)
+			client := &titlingClient{reply: tt.reply, err: tt.err}
+			s.setLLMClientForTesting(client)
+
+			session := s.sessionManager.GetSession(testGallerySessionID)
+			session.Manager().AddUserMessage("a harbor in the fog")
+			if tt.existing != "" {
+				session.SetTitle(tt.existing)
+			}
+
+			s.titleSessionAsync(context.Background(), testGallerySessionID, session, session.Manager())
+			s.inflight.Wait()
+
+			if got := session.Title(); got != tt.wantTitle {
+				t.Errorf("Title() = %q, want %q", got, tt.wantTitle)
+			}
+			if tt.existing != "" && client.messages != nil {
+				t.Error("LLM was asked to title a session that already has a title")
+			}
+			if tt.existing == "" && (len(client.messages) != 2 || client.messages[0].Content != titlePrompt) {
+				t.Errorf("Chat() messages = %+v, want the title prompt and the conversation", client.messages)
+			}
+		})
+	}
+}
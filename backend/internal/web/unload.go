@@ -0,0 +1,54 @@
+package web
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/hurricanerix/weave/internal/llm"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+// unloadResponse is the response for POST /admin/llm/unload.
+type unloadResponse struct {
+	Status   string   `json:"status"`
+	Unloaded []string `json:"unloaded"`
+}
+
+// handleUnloadLLM unloads the LLM's models from memory so their VRAM is
+// free for image generation. Clients on low-VRAM machines call it before
+// large generations; the next chat loads the model again. It affects every
+// session, so like restarting it requires an API token, or a request from
+// this machine if there are no tokens.
+// POST /admin/llm/unload
+func (s *Server) handleUnloadLLM(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !s.canAccessAllSessions(r) {
+		writeJSONError(w, http.StatusForbidden, "unloading the model requires an API token")
+		return
+	}
+
+	unloader, ok := s.llmClient.(llm.Unloader)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, "unloading is not supported by the LLM backend")
+		return
+	}
+
+	unloaded, err := unloader.Unload(r.Context())
+	if err != nil {
+		log.Printf("Failed to unload LLM models for session %s: %v", sessionID, err)
+		if errors.Is(err, ollama.ErrNotRunning) || errors.Is(err, ollama.ErrConnectionTimeout) {
+			writeJSONError(w, http.StatusServiceUnavailable, "ollama is not reachable")
+			return
+		}
+		writeJSONError(w, http.StatusBadGateway, "failed to unload models")
+		return
+	}
+
+	log.Printf("Session %s unloaded LLM models: %v", sessionID, unloaded)
+	writeChatJSON(w, http.StatusOK, unloadResponse{Status: "ok", Unloaded: unloaded})
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/llm"
+	"github.com/hurricanerix/weave/internal/ollama"
+)
+
+func TestHandleUnloadLLM(t *testing.T) {
+	var unloaded []string
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ollama.EndpointPs:
+			json.NewEncoder(w).Encode(ollama.PsResponse{Models: []ollama.ModelInfo{{Name: "llama3.1:8b"}}})
+		case ollama.EndpointChat:
+			var req ollama.ChatRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			unloaded = append(unloaded, req.Model)
+			w.Write([]byte(`{"done":true}`))
+		}
+	}))
+	defer fake.Close()
+
+	s := newGalleryTestServer(t, nil)
+	s.setLLMClientForTesting(ollama.NewClientWithConfig(fake.URL, "llama3.1:8b", 5*time.Second))
+
+	w := serveFrom(s, http.MethodPost, "/admin/llm/unload", testGallerySessionID, "127.0.0.1:1234")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp unloadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Unloaded) != 1 || resp.Unloaded[0] != "llama3.1:8b" {
+		t.Errorf("unloaded = %v, want [llama3.1:8b]", resp.Unloaded)
+	}
+	if len(unloaded) != 1 {
+		t.Errorf("ollama received %d unload requests, want 1", len(unloaded))
+	}
+}
+
+func TestHandleUnloadLLM_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		client     llm.Client
+		remoteAddr string
+		want       int
+	}{
+		{"ollama down", ollama.NewClientWithConfig("http://127.0.0.1:1", "llama3.1:8b", time.Second), "127.0.0.1:1234", http.StatusServiceUnavailable},
+		{"not supported", &mockOllamaClient{}, "127.0.0.1:1234", http.StatusNotImplemented},
+		{"remote request without a token", &mockOllamaClient{}, "192.0.2.1:1234", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, nil)
+			s.setLLMClientForTesting(tt.client)
+
+			if w := serveFrom(s, http.MethodPost, "/admin/llm/unload", testGallerySessionID, tt.remoteAddr); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/persistence"
+)
+
+const (
+	// MaxUploadSize is the maximum size of an uploaded reference image (10MB).
+	MaxUploadSize = 10 * 1024 * 1024
+
+	// uploadFormField is the multipart field holding the image.
+	uploadFormField = "image"
+
+	// maxUploadFormOverhead allows for multipart boundaries and headers
+	// around the image.
+	maxUploadFormOverhead = 64 * 1024
+)
+
+// uploadResponse describes a stored reference image.
+type uploadResponse struct {
+	Status     string            `json:"status"`
+	ID         string            `json:"id"`
+	Width      int               `json:"width"`
+	Height     int               `json:"height"`
+	Parameters *uploadParameters `json:"parameters,omitempty"`
+}
+
+// uploadParameters are the generation parameters found in an upload.
+type uploadParameters struct {
+	Source         string  `json:"source"`
+	Prompt         string  `json:"prompt"`
+	NegativePrompt string  `json:"negative_prompt,omitempty"`
+	Steps          int     `json:"steps,omitempty"`
+	CFG            float64 `json:"cfg,omitempty"`
+	Seed           int64   `json:"seed"`
+	Sampler        string  `json:"sampler,omitempty"`
+	Width          int     `json:"width,omitempty"`
+	Height         int     `json:"height,omitempty"`
+	Model          string  `json:"model,omitempty"`
+}
+
+// buildUploadParameters converts parsed generation parameters for a response.
+func buildUploadParameters(meta *image.EmbeddedParameters) *uploadParameters {
+	if meta == nil {
+		return nil
+	}
+	return &uploadParameters{
+		Source:         meta.Source,
+		Prompt:         meta.Prompt,
+		NegativePrompt: meta.NegativePrompt,
+		Steps:          meta.Steps,
+		CFG:            meta.CFG,
+		Seed:           meta.Seed,
+		Sampler:        meta.Sampler,
+		Width:          meta.Width,
+		Height:         meta.Height,
+		Model:          meta.Model,
+	}
+}
+
+// handleUpload stores a reference image for later img2img and inpainting
+// requests.
+// POST /upload
+//
+// The body is a multipart form with the PNG or JPEG in the "image" field.
+// The image is validated, re-encoded as PNG and stored in the session's
+// image store; the response carries the ID to reference it by. PNGs from
+// AUTOMATIC1111 or ComfyUI keep their generation parameters, which are
+// returned as parameters and can be applied with POST /upload/{id}/apply.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxUploadSize+maxUploadFormOverhead)
+	file, _, err := r.FormFile(uploadFormField)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "image too large")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "missing image field")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, MaxUploadSize+1))
+	if err != nil {
+		log.Printf("Failed to read upload for session %s: %v", sessionID, err)
+		writeJSONError(w, http.StatusBadRequest, "failed to read image")
+		return
+	}
+	if len(data) > MaxUploadSize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "image too large")
+		return
+	}
+
+	upload, err := image.NormalizeUpload(data)
+	if err != nil {
+		log.Printf("Rejected upload for session %s: %v", sessionID, err)
+		switch {
+		case errors.Is(err, image.ErrUnsupportedFormat):
+			writeJSONError(w, http.StatusUnsupportedMediaType, "image must be PNG or JPEG")
+		case errors.Is(err, image.ErrInvalidDimensions):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeJSONError(w, http.StatusBadRequest, "invalid image")
+		}
+		return
+	}
+
+	uploadID, err := s.imageStore.SaveUpload(sessionID, upload.PNG)
+	if err != nil {
+		log.Printf("Failed to save upload for session %s: %v", sessionID, err)
+		if errors.Is(err, persistence.ErrTooManyUploads) {
+			writeJSONError(w, http.StatusConflict, "too many uploaded images")
+			return
+		}
+		if errors.Is(err, persistence.ErrQuotaExceeded) {
+			writeJSONError(w, http.StatusInsufficientStorage, "image storage is full")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to save image")
+		return
+	}
+
+	log.Printf("Stored %dx%d upload %s for session %s (parameters: %v)", upload.Width, upload.Height, uploadID, sessionID, upload.Parameters != nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(uploadResponse{
+		Status:     "ok",
+		ID:         uploadID,
+		Width:      upload.Width,
+		Height:     upload.Height,
+		Parameters: buildUploadParameters(upload.Parameters),
+	})
+}
+
+// uploadApplyResponse is the response for POST /upload/{id}/apply.
+type uploadApplyResponse struct {
+	Status          string            `json:"status"`
+	ChatID          string            `json:"chat_id"`
+	Prompt          string            `json:"prompt"`
+	Steps           int               `json:"steps"`
+	CFG             float64           `json:"cfg"`
+	Seed            int64             `json:"seed"`
+	SettingsApplied bool              `json:"settings_applied"`
+	Width           int               `json:"width,omitempty"`
+	Height          int               `json:"height,omitempty"`
+	Parameters      *uploadParameters `json:"parameters"`
+}
+
+// handleApplyUploadParameters seeds a chat from the generation parameters of an
+// uploaded image: its prompt becomes the chat's prompt, as if the user had
+// typed it, and its steps, CFG, seed and size become the session's
+// generation settings. Settings outside weave's ranges are clamped, and
+// those weave has no control for, such as the sampler and negative prompt,
+// are ignored. The UI is sent prompt-update and settings-update events if
+// the chat is active.
+// POST /upload/{id}/apply
+func (s *Server) handleApplyUploadParameters(w http.ResponseWriter, r *http.Request) {
+	sessionID := GetSessionID(r.Context())
+	if sessionID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	session := s.sessionManager.GetSession(sessionID)
+	chatID, manager := resolveChat(session, r.FormValue("chat_id"))
+	if manager == nil {
+		writeChatNotFound(w)
+		return
+	}
+
+	data, err := s.imageStore.LoadUpload(sessionID, r.PathValue("id"))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to load upload %s for session %s: %v", r.PathValue("id"), sessionID, err)
+		}
+		writeJSONError(w, http.StatusNotFound, "upload not found")
+		return
+	}
+	meta, ok := image.ParseEmbeddedParameters(data)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "upload has no generation parameters")
+		return
+	}
+
+	// Same as an edit in the prompt box, so the agent learns of the change
+	manager.UpdatePrompt(meta.Prompt)
+	manager.NotifyPromptEdited()
+	_ = s.sendChatEvent(sessionID, chatID, EventPromptUpdate, map[string]string{
+		"prompt": meta.Prompt,
+	})
+
+	resp := uploadApplyResponse{
+		Status:     "ok",
+		ChatID:     chatID,
+		Prompt:     meta.Prompt,
+		Parameters: buildUploadParameters(&meta),
+	}
+	if meta.Width > 0 && meta.Height > 0 {
+		session.SetResolution(meta.Width, meta.Height)
+		resp.Width, resp.Height = meta.Width, meta.Height
+	}
+	if meta.Steps > 0 {
+		steps, cfg, seed, _ := clampGenerationSettings(meta.Steps, meta.CFG, meta.Seed)
+		session.SetGenerationSettings(steps, cfg, seed)
+		_ = s.sendChatEvent(sessionID, chatID, EventSettingsUpdate, map[string]interface{}{
+			"steps": steps,
+			"cfg":   cfg,
+			"seed":  seed,
+		})
+		resp.Steps, resp.CFG, resp.Seed = steps, cfg, seed
+		resp.SettingsApplied = true
+	}
+
+	log.Printf("Applied %s parameters of an upload to session %s (settings: %v)", meta.Source, sessionID, resp.SettingsApplied)
+	writeChatJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,185 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	weaveimage "github.com/hurricanerix/weave/internal/image"
+)
+
+// postUpload sends data as the image field of a multipart form.
+func postUpload(t *testing.T, s *Server, field string, data []byte, csrfToken string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile(field, "reference.png")
+	if err != nil {
+		t.Fatalf("CreateFormFile() error = %v", err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: testGallerySessionID})
+	req.Header.Set(CSRFHeaderName, csrfToken)
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	return w
+}
+
+// encodeUploadImage encodes a blank image in the given format.
+func encodeUploadImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("failed to encode %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+func TestHandleUpload(t *testing.T) {
+	tests := []struct {
+		name       string
+		field      string
+		data       []byte
+		wantStatus int
+	}{
+		{name: "png", field: "image", data: encodeUploadImage(t, "png", 128, 96), wantStatus: http.StatusCreated},
+		{name: "jpeg", field: "image", data: encodeUploadImage(t, "jpeg", 128, 96), wantStatus: http.StatusCreated},
+		{name: "gif", field: "image", data: encodeUploadImage(t, "gif", 128, 96), wantStatus: http.StatusUnsupportedMediaType},
+		{name: "too small", field: "image", data: encodeUploadImage(t, "png", 16, 16), wantStatus: http.StatusBadRequest},
+		{name: "too large", field: "image", data: make([]byte, MaxUploadSize+1), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "wrong field", field: "file", data: encodeUploadImage(t, "png", 128, 96), wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newGalleryTestServer(t, nil)
+
+			w := postUpload(t, s, tt.field, tt.data, s.csrfToken(testGallerySessionID))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var resp uploadResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+			if resp.Width != 128 || resp.Height != 96 {
+				t.Errorf("size = %dx%d, want 128x96", resp.Width, resp.Height)
+			}
+
+			// The stored upload is a PNG whatever was uploaded
+			stored, err := s.imageStore.LoadUpload(testGallerySessionID, resp.ID)
+			if err != nil {
+				t.Fatalf("LoadUpload(%q) error = %v", resp.ID, err)
+			}
+			if _, err := png.DecodeConfig(bytes.NewReader(stored)); err != nil {
+				t.Errorf("stored upload is not a PNG: %v", err)
+			}
+		})
+	}
+}
+
+func TestHandleUpload_RequiresCSRFToken(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+
+	w := postUpload(t, s, "image", encodeUploadImage(t, "png", 64, 64), "")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestHandleApplyUploadParameters(t *testing.T) {
+	s := newGalleryTestServer(t, nil)
+	session := s.sessionManager.GetSession(testGallerySessionID)
+
+	parameters := "a lighthouse at dusk\nNegative prompt: blurry\nSteps: 150, Sampler: Euler a, CFG scale: 7, Seed: 1234, Size: 512x768, Model: v1-5"
+	data, err := weaveimage.SetPNGText(encodeUploadImage(t, "png", 128, 96), "parameters", parameters)
+	if err != nil {
+		t.Fatalf("SetPNGText() error = %v", err)
+	}
+	w := postUpload(t, s, "image", data, s.csrfToken(testGallerySessionID))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /upload status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	var upload uploadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &upload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if upload.Parameters == nil || upload.Parameters.Source != "a1111" || upload.Parameters.NegativePrompt != "blurry" {
+		t.Fatalf("upload parameters = %+v, want the A1111 parameters", upload.Parameters)
+	}
+
+	w = serveAs(s, http.MethodPost, "/upload/"+upload.ID+"/apply", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST apply status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp uploadApplyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	// Steps are clamped to weave's maximum
+	if !resp.SettingsApplied || resp.Steps != 100 || resp.CFG != 7 || resp.Seed != 1234 {
+		t.Errorf("POST apply = %+v, want the clamped settings", resp)
+	}
+	if got := session.Manager().GetCurrentPrompt(); got != "a lighthouse at dusk" {
+		t.Errorf("current prompt = %q, want the uploaded image's prompt", got)
+	}
+	if steps, cfg, seed, _ := session.GetGenerationSettings(); steps != 100 || cfg != 7 || seed != 1234 {
+		t.Errorf("generation settings = %d, %v, %d, want 100, 7, 1234", steps, cfg, seed)
+	}
+	if width, height := session.Resolution(); width != 512 || height != 768 {
+		t.Errorf("resolution = %dx%d, want 512x768", width, height)
+	}
+
+	// Uploads without parameters report none and can't be applied
+	w = postUpload(t, s, "image", encodeUploadImage(t, "png", 128, 96), s.csrfToken(testGallerySessionID))
+	var plain uploadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &plain); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if plain.Parameters != nil {
+		t.Errorf("upload parameters = %+v, want none", plain.Parameters)
+	}
+
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{"no parameters", plain.ID},
+		{"unknown upload", "0123456789abcdef"},
+		{"invalid ID", "not-an-id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveAs(s, http.MethodPost, "/upload/"+tt.id+"/apply", testGallerySessionID); w.Code != http.StatusNotFound {
+				t.Errorf("POST apply status = %d, want %d", w.Code, http.StatusNotFound)
+			}
+		})
+	}
+}
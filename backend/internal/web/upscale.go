@@ -0,0 +1,318 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/conversation"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/persistence"
+	"github.com/hurricanerix/weave/internal/protocol"
+	"github.com/hurricanerix/weave/internal/requestid"
+)
+
+var (
+	// errInvalidUpscaleSize indicates a size the image cannot be upscaled
+	// to: not larger than the image, beyond the compute limit, or more than
+	// protocol.UpscaleMaxFactor times the image.
+	errInvalidUpscaleSize = errors.New("invalid upscale size")
+
+	// errUpscalerUnavailable indicates the compute process has no upscaler
+	// model.
+	errUpscalerUnavailable = errors.New("upscaling is not available")
+
+	// errTooManyAlternates indicates the source message already has
+	// conversation.MaxAlternatesPerMessage alternates, so an upscale of its
+	// image can't be kept with it.
+	errTooManyAlternates = errors.New("too many alternates")
+)
+
+// handleUpscaleImage enlarges an image with the compute process's ESRGAN
+// upscaler. An upscale of a message's image is saved in the session as the
+// message's next alternate; an upscale of an in-memory image is stored as a
+// new in-memory image.
+// POST /images/{id}/upscale
+// Form fields: size (long edge in pixels; default the largest allowed:
+// four times the image, up to 2048).
+//
+// {id} is resolved as for POST /images/{id}/adjust. The aspect ratio is
+// kept and nothing is regenerated, so the result looks like the source,
+// only sharper at the larger size. Upscaling counts against the generation
+// rate limit.
+func (s *Server) handleUpscaleImage(w http.ResponseWriter, r *http.Request) {
+	ref := strings.TrimSuffix(r.PathValue("id"), ".png")
+	sessionID := GetSessionID(r.Context())
+
+	// SECURITY: Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Failed to parse form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "failed to parse form")
+		return
+	}
+
+	size := 0
+	if v := r.FormValue("size"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "size must be an integer")
+			return
+		}
+		size = parsed
+	}
+
+	pngData, status := s.loadImageRef(sessionID, ref)
+	if status != http.StatusOK {
+		writeJSONError(w, status, strings.ToLower(http.StatusText(status)))
+		return
+	}
+
+	// SECURITY: Upscaling uses the GPU like a generation
+	limit := s.rateLimiter.takeGenerate(sessionID)
+	if !limit.allowed {
+		log.Printf("Rate limit exceeded for session %s (upscale)", sessionID)
+		writeRateLimited(w, limit)
+		return
+	}
+	limit.setHeaders(w)
+
+	resp, err := s.upscaleImage(r.Context(), sessionID, ref, pngData, size)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidUpscaleSize), errors.Is(err, image.ErrInvalidDimensions):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, errUpscalerUnavailable), errors.Is(err, client.ErrComputeNotRunning):
+			writeJSONError(w, http.StatusServiceUnavailable, errUpscalerUnavailable.Error())
+		case errors.Is(err, os.ErrNotExist):
+			writeJSONError(w, http.StatusNotFound, "message not found")
+		case errors.Is(err, errTooManyAlternates):
+			writeJSONError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, persistence.ErrQuotaExceeded):
+			writeJSONError(w, http.StatusInsufficientStorage, "image storage is full")
+		default:
+			log.Printf("Failed to upscale image %s: %v", ref, err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to upscale image")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode upscale response: %v", err)
+	}
+}
+
+// upscaleImage enlarges pngData, the image ref points to, so its long edge
+// is size pixels (0 for the largest allowed). The result is saved as an
+// alternate of the message a numeric ref names, as regenerated images are,
+// or otherwise stored as a derived in-memory image.
+func (s *Server) upscaleImage(ctx context.Context, sessionID, ref string, pngData []byte, size int) (adjustResponse, error) {
+	pixels, width, height, err := image.DecodeRGB(pngData)
+	if err != nil {
+		return adjustResponse{}, err
+	}
+	targetWidth, targetHeight, err := upscaleTarget(width, height, size)
+	if err != nil {
+		return adjustResponse{}, err
+	}
+
+	if s.computeClient == nil {
+		return adjustResponse{}, client.ErrComputeNotRunning
+	}
+	if reason := s.unsupportedByCompute(protocol.MsgUpscaleRequest, 0, 0); reason != "" {
+		return adjustResponse{}, fmt.Errorf("%w: %s", errUpscalerUnavailable, reason)
+	}
+
+	reqID, ok := requestid.NextFrameID(ctx)
+	if !ok {
+		reqID = atomic.AddUint64(&s.requestID, 1)
+	}
+	requestData, err := protocol.EncodeUpscaleRequest(&protocol.UpscaleRequest{
+		RequestID:    reqID,
+		Width:        uint32(width),
+		Height:       uint32(height),
+		Channels:     protocol.SD35ChannelsRGB,
+		TargetWidth:  uint32(targetWidth),
+		TargetHeight: uint32(targetHeight),
+		Image:        pixels,
+	})
+	if err != nil {
+		return adjustResponse{}, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	// Upscales take their turn with generations
+	release, err := s.generations.acquire(ctx, sessionID, priorityFromContext(ctx), s.computeSlots(), nil)
+	if err != nil {
+		return adjustResponse{}, fmt.Errorf("upscale cancelled while queued: %w", err)
+	}
+	defer release()
+
+	// An upscale has no steps, so only its output size scales the timeout
+	upscaleCtx, cancel := context.WithTimeout(ctx, s.generationTimeout(timeoutReferenceSteps, uint32(targetWidth), uint32(targetHeight)))
+	defer cancel()
+
+	responseData, err := s.computeClient.Send(upscaleCtx, requestData)
+	if err != nil {
+		return adjustResponse{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	response, err := protocol.DecodeResponse(responseData)
+	if err != nil {
+		return adjustResponse{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	var upscaled []byte
+	switch resp := response.(type) {
+	case *protocol.SD35GenerateResponse:
+		if int(resp.ImageWidth) != targetWidth || int(resp.ImageHeight) != targetHeight {
+			return adjustResponse{}, fmt.Errorf("compute returned %dx%d, want %dx%d",
+				resp.ImageWidth, resp.ImageHeight, targetWidth, targetHeight)
+		}
+		format := image.FormatRGB
+		if resp.Channels == protocol.SD35ChannelsRGBA {
+			format = image.FormatRGBA
+		}
+		upscaled, err = image.EncodePNG(targetWidth, targetHeight, resp.ImageData, format)
+		if err != nil {
+			return adjustResponse{}, fmt.Errorf("failed to encode PNG: %w", err)
+		}
+
+	case *protocol.ErrorResponse:
+		if resp.ErrorCode == protocol.ErrCodeUpscalerUnavailable {
+			return adjustResponse{}, fmt.Errorf("%w: %s", errUpscalerUnavailable, resp.ErrorMessage)
+		}
+		return adjustResponse{}, fmt.Errorf("compute error: %s", resp.ErrorMessage)
+
+	default:
+		return adjustResponse{}, fmt.Errorf("unexpected response type: %T", response)
+	}
+
+	derivation := image.Derivation{
+		Source:     ref,
+		Upscaled:   true,
+		Generation: s.sourceGeneration(sessionID, ref),
+	}
+	if messageID, err := strconv.Atoi(ref); err == nil {
+		return s.saveUpscaledAlternate(sessionID, messageID, upscaled, targetWidth, targetHeight, derivation)
+	}
+	id, err := s.imageStorage.StoreDerived(sessionID, upscaled, targetWidth, targetHeight, derivation)
+	if err != nil {
+		return adjustResponse{}, fmt.Errorf("failed to store image: %w", err)
+	}
+
+	return adjustResponse{
+		Status:     "ok",
+		ID:         id,
+		URL:        fmt.Sprintf("/images/%s.png", id),
+		Width:      targetWidth,
+		Height:     targetHeight,
+		Derivation: derivation,
+	}, nil
+}
+
+// saveUpscaledAlternate saves pngData, an upscale of a message's image, as
+// the message's next alternate in the session's image store, so it is kept
+// with the session like a regenerated image. Returns an error wrapping
+// os.ErrNotExist if the message is gone.
+func (s *Server) saveUpscaledAlternate(sessionID string, messageID int, pngData []byte, width, height int, derivation image.Derivation) (adjustResponse, error) {
+	chatID, manager := s.sessionManager.GetSession(sessionID).ChatForMessage(messageID)
+	if manager == nil {
+		return adjustResponse{}, fmt.Errorf("message %d: %w", messageID, os.ErrNotExist)
+	}
+
+	// Number, save and record the alternate as one step, as
+	// handleRegenerate does
+	s.alternateMu.Lock()
+	msg := manager.GetMessage(messageID)
+	if msg == nil || msg.Snapshot == nil {
+		s.alternateMu.Unlock()
+		return adjustResponse{}, fmt.Errorf("message %d: %w", messageID, os.ErrNotExist)
+	}
+	alternate := len(msg.Alternates) + 1
+	if alternate > conversation.MaxAlternatesPerMessage {
+		s.alternateMu.Unlock()
+		return adjustResponse{}, errTooManyAlternates
+	}
+	if err := s.imageStore.SaveAlternate(sessionID, messageID, alternate, pngData); err != nil {
+		s.alternateMu.Unlock()
+		return adjustResponse{}, fmt.Errorf("failed to save alternate: %w", err)
+	}
+	imageURL := s.imageStore.GetAlternateURL(sessionID, messageID, alternate)
+	manager.AddMessageAlternate(messageID, conversation.ImageAlternate{URL: imageURL, Seed: msg.Snapshot.ImageSeed})
+	s.alternateMu.Unlock()
+
+	log.Printf("Upscaled image for session %s, message %d to %dx%d as alternate %d", sessionID, messageID, width, height, alternate)
+
+	_ = s.sendChatEvent(sessionID, chatID, EventImageReady, ImageReadyData{
+		URL:       imageURL,
+		Width:     width,
+		Height:    height,
+		MessageID: messageID,
+		Alternate: alternate,
+		Seed:      msg.Snapshot.ImageSeed,
+	})
+
+	return adjustResponse{
+		Status:     "ok",
+		URL:        imageURL,
+		Width:      width,
+		Height:     height,
+		MessageID:  messageID,
+		Alternate:  alternate,
+		Derivation: derivation,
+	}, nil
+}
+
+// upscaleTarget returns the size a width x height image is upscaled to so
+// its long edge is size pixels, keeping the aspect ratio. A size of 0 picks
+// the largest allowed. Both edges are rounded up to a multiple of
+// protocol.SD35DimensionAlign, as compute responses require.
+//
+// Returns errInvalidUpscaleSize if that does not enlarge the image, exceeds
+// the compute limit, or is more than protocol.UpscaleMaxFactor times it.
+func upscaleTarget(width, height, size int) (int, int, error) {
+	long := max(width, height)
+	maxSize := alignDown(min(int(protocol.SD35MaxWidth), long*int(protocol.UpscaleMaxFactor)))
+	if long >= maxSize {
+		return 0, 0, fmt.Errorf("%w: a %dx%d image is already at the maximum size", errInvalidUpscaleSize, width, height)
+	}
+	if size == 0 {
+		size = maxSize
+	}
+	if size <= long || size > maxSize {
+		return 0, 0, fmt.Errorf("%w: a %dx%d image can be upscaled to a long edge of %d to %d pixels",
+			errInvalidUpscaleSize, width, height, long+1, maxSize)
+	}
+
+	scale := float64(size) / float64(long)
+	targetWidth := alignUp(int(math.Round(float64(width) * scale)))
+	targetHeight := alignUp(int(math.Round(float64(height) * scale)))
+	factor := int(protocol.UpscaleMaxFactor)
+	if targetWidth > width*factor || targetHeight > height*factor {
+		return 0, 0, fmt.Errorf("%w: a %dx%d image is too narrow to upscale to %dx%d",
+			errInvalidUpscaleSize, width, height, targetWidth, targetHeight)
+	}
+	return targetWidth, targetHeight, nil
+}
+
+// alignUp rounds n up to a multiple of protocol.SD35DimensionAlign.
+func alignUp(n int) int {
+	align := int(protocol.SD35DimensionAlign)
+	return (n + align - 1) / align * align
+}
+
+// alignDown rounds n down to a multiple of protocol.SD35DimensionAlign.
+func alignDown(n int) int {
+	align := int(protocol.SD35DimensionAlign)
+	return n / align * align
+}
@@ -0,0 +1,203 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/client"
+	"github.com/hurricanerix/weave/internal/image"
+	"github.com/hurricanerix/weave/internal/ollama"
+	"github.com/hurricanerix/weave/internal/persistence"
+	"github.com/hurricanerix/weave/internal/protocol"
+	"github.com/hurricanerix/weave/internal/tools"
+)
+
+func TestUpscaleTarget(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		size          int
+		wantW, wantH  int
+		wantErr       bool
+	}{
+		{name: "square to 2048", width: 768, height: 768, size: 2048, wantW: 2048, wantH: 2048},
+		{name: "keeps aspect ratio", width: 768, height: 512, size: 1536, wantW: 1536, wantH: 1024},
+		{name: "rounds up to a multiple of 64", width: 768, height: 500, size: 2048, wantW: 2048, wantH: 1344},
+		{name: "default is a multiple of 64", width: 100, height: 50, wantW: 384, wantH: 192},
+		{name: "short edge too narrow", width: 400, height: 10, size: 1600, wantErr: true},
+		{name: "largest allowed by default", width: 768, height: 768, wantW: 2048, wantH: 2048},
+		{name: "default is at most 4x", width: 64, height: 32, wantW: 256, wantH: 128},
+		{name: "not larger", width: 768, height: 768, size: 768, wantErr: true},
+		{name: "more than 4x", width: 256, height: 256, size: 1025, wantErr: true},
+		{name: "beyond compute limit", width: 768, height: 768, size: 2049, wantErr: true},
+		{name: "already at the limit", width: 2048, height: 1024, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h, err := upscaleTarget(tt.width, tt.height, tt.size)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidUpscaleSize) {
+					t.Errorf("upscaleTarget() error = %v, want %v", err, errInvalidUpscaleSize)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("upscaleTarget() error = %v", err)
+			}
+			if w != tt.wantW || h != tt.wantH {
+				t.Errorf("upscaleTarget() = %dx%d, want %dx%d", w, h, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+// newUpscaleTestServer returns a server with a 32x32 image as message 1 of
+// testGallerySessionID. If requests is not nil, compute requests are sent
+// to it; the fake compute returns 64x64 images.
+func newUpscaleTestServer(t *testing.T, requests chan []byte) *Server {
+	t.Helper()
+
+	store := persistence.NewImageStore(t.TempDir())
+	var computeConn *client.Conn
+	if requests != nil {
+		computeConn = recordingComputeConn(t, requests)
+	}
+	s, err := NewServerWithDeps("", nil, nil, nil, store, computeConn, nil)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+
+	src, err := image.EncodePNG(32, 32, bytes.Repeat([]byte{10, 200, 10}, 32*32), image.FormatRGB)
+	if err != nil {
+		t.Fatalf("EncodePNG() error = %v", err)
+	}
+	manager := s.sessionManager.GetSession(testGallerySessionID).Manager()
+	msgID := manager.AddAssistantMessage("Here you go", "a meadow", &ollama.LLMMetadata{Prompt: "a meadow"})
+	if err := store.Save(testGallerySessionID, msgID, src); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	return s
+}
+
+func TestHandleUpscaleImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		ref        string
+		form       url.Values
+		noCompute  bool
+		wantStatus int
+	}{
+		{name: "upscale message image", ref: "1", form: url.Values{"size": {"64"}}, wantStatus: http.StatusCreated},
+		{name: "upscale in-memory image", form: url.Values{"size": {"64"}}, wantStatus: http.StatusCreated},
+		{name: "size not larger", ref: "1", form: url.Values{"size": {"32"}}, wantStatus: http.StatusBadRequest},
+		{name: "size more than 4x", ref: "1", form: url.Values{"size": {"129"}}, wantStatus: http.StatusBadRequest},
+		{name: "non-integer size", ref: "1", form: url.Values{"size": {"big"}}, wantStatus: http.StatusBadRequest},
+		{name: "unknown image", ref: "9", form: url.Values{}, wantStatus: http.StatusNotFound},
+		{name: "no compute", ref: "1", form: url.Values{"size": {"64"}}, noCompute: true, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests chan []byte
+			if !tt.noCompute {
+				requests = make(chan []byte, 1)
+			}
+			s := newUpscaleTestServer(t, requests)
+			ref := tt.ref
+			if ref == "" {
+				src, _ := s.imageStore.Load(testGallerySessionID, 1)
+				id, err := s.imageStorage.Store("", src, 32, 32)
+				if err != nil {
+					t.Fatalf("Store() error = %v", err)
+				}
+				ref = id
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/images/"+ref+"/upscale", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetPathValue("id", ref)
+			req = req.WithContext(setSessionID(req.Context(), testGallerySessionID))
+			w := httptest.NewRecorder()
+			s.handleUpscaleImage(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var resp adjustResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if resp.Width != 64 || resp.Height != 64 {
+				t.Errorf("size = %dx%d, want 64x64", resp.Width, resp.Height)
+			}
+			if !resp.Derivation.Upscaled || resp.Derivation.Source != ref {
+				t.Errorf("derivation = %+v, want upscaled from %s", resp.Derivation, ref)
+			}
+			if tt.ref == "" {
+				if _, _, _, err := s.imageStorage.Get(resp.ID); err != nil {
+					t.Errorf("Get(%s) error = %v", resp.ID, err)
+				}
+			} else {
+				// Upscales of message images are kept with the session
+				if resp.MessageID != 1 || resp.Alternate != 1 || resp.URL != s.imageStore.GetAlternateURL(testGallerySessionID, 1, 1) {
+					t.Errorf("response = %+v, want alternate 1 of message 1", resp)
+				}
+				if _, err := s.imageStore.LoadAlternate(testGallerySessionID, 1, 1); err != nil {
+					t.Errorf("LoadAlternate() error = %v", err)
+				}
+				msg := s.sessionManager.GetSession(testGallerySessionID).Manager().GetMessage(1)
+				if len(msg.Alternates) != 1 || msg.Alternates[0].URL != resp.URL {
+					t.Errorf("alternates = %+v, want the upscale", msg.Alternates)
+				}
+			}
+
+			sent := <-requests
+			if got := binary.BigEndian.Uint16(sent[6:8]); got != protocol.MsgUpscaleRequest {
+				t.Errorf("msg_type = 0x%04X, want upscale", got)
+			}
+			if w, h := binary.BigEndian.Uint32(sent[24:28]), binary.BigEndian.Uint32(sent[28:32]); w != 32 || h != 32 {
+				t.Errorf("sent image size = %dx%d, want 32x32", w, h)
+			}
+			if w, h := binary.BigEndian.Uint32(sent[36:40]), binary.BigEndian.Uint32(sent[40:44]); w != 64 || h != 64 {
+				t.Errorf("sent target size = %dx%d, want 64x64", w, h)
+			}
+		})
+	}
+}
+
+func TestRunUpscaleImage(t *testing.T) {
+	requests := make(chan []byte, 1)
+	s := newUpscaleTestServer(t, requests)
+
+	call := tools.Call{
+		Name:      "upscale_image",
+		SessionID: testGallerySessionID,
+		Arguments: json.RawMessage(`{"message_id":1,"size":64}`),
+	}
+	note, err := s.runUpscaleImage(context.Background(), call)
+	if err != nil {
+		t.Fatalf("runUpscaleImage() error = %v", err)
+	}
+	if want := "Upscaled image 1 to 64x64: " + s.imageStore.GetAlternateURL(testGallerySessionID, 1, 1); note != want {
+		t.Errorf("note = %q, want %q", note, want)
+	}
+	<-requests
+
+	call.Arguments = json.RawMessage(`{"message_id":1,"size":4096}`)
+	if _, err := s.runUpscaleImage(context.Background(), call); !errors.Is(err, errInvalidUpscaleSize) {
+		t.Errorf("runUpscaleImage() error = %v, want %v", err, errInvalidUpscaleSize)
+	}
+}
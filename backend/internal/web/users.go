@@ -0,0 +1,119 @@
+package web
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+// userAuth is the configured source of user identity. It is nil unless
+// --users-file or --user-header is set, in which case sessions belong to
+// users rather than to browser cookies.
+type userAuth struct {
+	// header is the request header naming the user, set by a trusted
+	// reverse proxy ("" to only accept tokens from the users file)
+	header string
+}
+
+// newUserAuth returns the user identity settings from cfg, or nil if
+// sessions are anonymous.
+func newUserAuth(cfg *config.Config) *userAuth {
+	if cfg.UsersFile == "" && cfg.UserHeader == "" {
+		return nil
+	}
+	return &userAuth{header: cfg.UserHeader}
+}
+
+// GetUser returns the signed-in user from the request context, or "" if
+// the session is anonymous.
+func GetUser(ctx context.Context) string {
+	if user, ok := ctx.Value(userKey).(string); ok {
+		return user
+	}
+	return ""
+}
+
+// setUser stores the signed-in user in the context.
+func setUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// userSessionID returns the session ID owned by user. It is derived from the
+// name so a user gets the same conversations, images and rate limits from
+// every browser. The ID is not a secret: identifyUser never takes it from
+// a cookie once users are configured.
+func userSessionID(user string) string {
+	sum := sha256.Sum256([]byte("weave user\x00" + user))
+	return hex.EncodeToString(sum[:SessionIDLength])
+}
+
+// identifyUser scopes each request to the signed-in user's session when
+// users are configured. The user is named by a token from --users-file or
+// by the --user-header header. Requests without a user get 401, except
+// for public pages such as the gallery, which keep an anonymous session.
+func (s *Server) identifyUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		users := s.userAuth.Load()
+		if users == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user := s.requestUser(r, users)
+		if user == "" {
+			if publicPath(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if s.apiTokens.Load() != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="weave"`)
+			}
+			http.Error(w, "Sign in required", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := setSessionID(setUser(r.Context(), user), userSessionID(user))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestUser returns the user named by the request's API token, or by the
+// user header if the token doesn't name one. Returns "" if neither does.
+func (s *Server) requestUser(r *http.Request, users *userAuth) string {
+	if tokens := s.apiTokens.Load(); tokens != nil {
+		if user, ok := tokens.lookup(requestAPIToken(r)); ok && user != "" {
+			return user
+		}
+	}
+	if users.header != "" {
+		if user := strings.TrimSpace(r.Header.Get(users.header)); config.ValidUserName(user) {
+			return user
+		}
+	}
+	return ""
+}
+
+// publicPath reports whether r is for a page that doesn't read or change a
+// session, or reads one only through a share link, so it is served without
+// a signed-in user.
+func publicPath(r *http.Request) bool {
+	path := r.URL.Path
+	if r.Method == http.MethodPost {
+		return path == "/provenance/verify"
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	switch path {
+	case "/gallery", "/ready", "/healthz", "/metrics", "/provenance/key":
+		return true
+	}
+	return strings.HasPrefix(path, "/static/") ||
+		strings.HasPrefix(path, "/gallery/images/") ||
+		strings.HasPrefix(path, "/share/") ||
+		strings.HasPrefix(path, "/api/")
+}
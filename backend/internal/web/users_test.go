@@ -0,0 +1,170 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hurricanerix/weave/internal/config"
+)
+
+// newUsersTestServer returns a gallery test server with alice signed in by
+// testAPIToken and bob by testOtherAPIToken.
+func newUsersTestServer(t *testing.T, cfg *config.Config) *Server {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "users")
+	content := "alice " + testAPIToken + "\nbob " + testOtherAPIToken + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write users file: %v", err)
+	}
+	cfg.UsersFile = path
+	return newGalleryTestServer(t, cfg)
+}
+
+// historyOf sends GET /history with the given headers and returns the
+// decoded response, or fails if the request isn't served.
+func historyOf(t *testing.T, s *Server, header http.Header) historyResponse {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/history", nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /history status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var resp historyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode history: %v", err)
+	}
+	return resp
+}
+
+func TestIdentifyUser(t *testing.T) {
+	aliceSession := userSessionID("alice")
+
+	tests := []struct {
+		name          string
+		method        string
+		target        string
+		authorization string
+		cookie        string
+		sessionCookie string
+		wantStatus    int
+	}{
+		{name: "history with token", method: http.MethodGet, target: "/history", authorization: "Bearer " + testAPIToken, wantStatus: http.StatusOK},
+		{name: "history with token cookie", method: http.MethodGet, target: "/history", cookie: testOtherAPIToken, wantStatus: http.StatusOK},
+		{name: "history without token", method: http.MethodGet, target: "/history", wantStatus: http.StatusUnauthorized},
+		{name: "index without token", method: http.MethodGet, target: "/", wantStatus: http.StatusUnauthorized},
+		{name: "session cookie alone", method: http.MethodGet, target: "/history", sessionCookie: aliceSession, wantStatus: http.StatusUnauthorized},
+		{name: "gallery without token", method: http.MethodGet, target: "/gallery", wantStatus: http.StatusOK},
+		{name: "health without token", method: http.MethodGet, target: "/ready", wantStatus: http.StatusOK},
+		{name: "api docs without token", method: http.MethodGet, target: "/api/openapi.json", wantStatus: http.StatusOK},
+		{name: "share link without token", method: http.MethodGet, target: "/share/not-a-token", wantStatus: http.StatusNotFound},
+		{
+			name:          "other user's images",
+			method:        http.MethodGet,
+			target:        "/sessions/" + aliceSession + "/images/1.png",
+			authorization: "Bearer " + testOtherAPIToken,
+			wantStatus:    http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newUsersTestServer(t, &config.Config{})
+
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: APITokenCookieName, Value: tt.cookie})
+			}
+			if tt.sessionCookie != "" {
+				req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: tt.sessionCookie})
+			}
+			w := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestIdentifyUser_IsolatesSessions(t *testing.T) {
+	s := newUsersTestServer(t, &config.Config{})
+	s.sessionManager.GetSession(userSessionID("alice")).Manager().AddUserMessage("draw a fox")
+
+	alice := historyOf(t, s, http.Header{"Authorization": {"Bearer " + testAPIToken}})
+	if alice.SessionID != userSessionID("alice") || alice.Page.Total != 1 {
+		t.Errorf("alice's history = session %s with %d messages, want %s with 1", alice.SessionID, alice.Page.Total, userSessionID("alice"))
+	}
+
+	bob := historyOf(t, s, http.Header{"Authorization": {"Bearer " + testOtherAPIToken}})
+	if bob.SessionID != userSessionID("bob") || bob.Page.Total != 0 {
+		t.Errorf("bob's history = session %s with %d messages, want %s with 0", bob.SessionID, bob.Page.Total, userSessionID("bob"))
+	}
+}
+
+func TestIdentifyUser_Header(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{UserHeader: "X-Forwarded-User"})
+
+	resp := historyOf(t, s, http.Header{"X-Forwarded-User": {"alice"}})
+	if resp.SessionID != userSessionID("alice") {
+		t.Errorf("session = %s, want alice's session %s", resp.SessionID, userSessionID("alice"))
+	}
+
+	for _, user := range []string{"", "../alice", "alice smith"} {
+		req := httptest.NewRequest(http.MethodGet, "/history", nil)
+		req.Header.Set("X-Forwarded-User", user)
+		w := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("user %q: status = %d, want %d", user, w.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestIdentifyUser_TokenOverridesHeader(t *testing.T) {
+	s := newUsersTestServer(t, &config.Config{UserHeader: "X-Forwarded-User"})
+
+	resp := historyOf(t, s, http.Header{
+		"Authorization":    {"Bearer " + testAPIToken},
+		"X-Forwarded-User": {"bob"},
+	})
+	if resp.SessionID != userSessionID("alice") {
+		t.Errorf("session = %s, want alice's session %s", resp.SessionID, userSessionID("alice"))
+	}
+}
+
+func TestIdentifyUser_Disabled(t *testing.T) {
+	s := newGalleryTestServer(t, &config.Config{})
+
+	w := serveAs(s, http.MethodGet, "/history", testGallerySessionID)
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestUserSessionID(t *testing.T) {
+	id := userSessionID("alice")
+	if !ValidateSessionID(id) {
+		t.Errorf("userSessionID() = %q, want a valid session ID", id)
+	}
+	if userSessionID("alice") != id {
+		t.Error("userSessionID() is not stable")
+	}
+	if userSessionID("bob") == id {
+		t.Error("userSessionID() is the same for different users")
+	}
+}
@@ -0,0 +1,68 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hurricanerix/weave/internal/config"
+	"github.com/hurricanerix/weave/internal/persistence"
+	"github.com/hurricanerix/weave/pkg/weaveclient"
+)
+
+// TestWeaveClient runs the Go client SDK against the real handler stack so
+// changes to the API that break the client are caught here.
+func TestWeaveClient(t *testing.T) {
+	cfg := &config.Config{Steps: 4, CFG: 1, Seed: -1, APIToken: testAPIToken}
+	s, err := NewServerWithDeps("", nil, nil, nil, persistence.NewImageStore(t.TempDir()), nil, cfg)
+	if err != nil {
+		t.Fatalf("NewServerWithDeps() error = %v", err)
+	}
+	s.setLLMClientForTesting(&mockOllamaClient{
+		response: "Hello there",
+		tokens:   []string{"Hello", " there"},
+	})
+	server := httptest.NewServer(s.server.Handler)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c, err := weaveclient.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := c.Events(ctx); !errors.Is(err, weaveclient.ErrUnauthorized) {
+		t.Fatalf("Events() without token error = %v, want ErrUnauthorized", err)
+	}
+
+	c.SetToken(testAPIToken)
+	events, err := c.Events(ctx)
+	if err != nil {
+		t.Fatalf("Events() error = %v", err)
+	}
+	defer events.Close()
+
+	reply, err := c.Chat(ctx, events, weaveclient.ChatRequest{Message: "hi"}, nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if reply.Text != "Hello there" || reply.MessageID == 0 {
+		t.Errorf("Chat() = %+v, want the streamed reply", reply)
+	}
+
+	messages, page, err := c.History(ctx, 0, 0)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if page.Total != 2 || len(messages) != 2 || messages[1].ID != reply.MessageID {
+		t.Errorf("History() = %+v, %+v; want the user message and the reply", messages, page)
+	}
+
+	// No compute process: the generation fails with 503
+	if _, err := c.Generate(ctx, events, weaveclient.GenerateRequest{Prompt: "a red fox"}); !errors.Is(err, weaveclient.ErrUnavailable) && !errors.Is(err, weaveclient.ErrGenerateFailed) {
+		t.Errorf("Generate() error = %v, want ErrUnavailable or ErrGenerateFailed", err)
+	}
+}
@@ -0,0 +1,174 @@
+package weaveclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrChatFailed is returned when the agent couldn't respond to a message.
+var ErrChatFailed = errors.New("chat failed")
+
+// Settings are the generation settings of a request or a message.
+type Settings struct {
+	Steps int     `json:"steps"`
+	CFG   float64 `json:"cfg"`
+	// Seed is -1 for a random seed
+	Seed int64 `json:"seed"`
+}
+
+// form adds the settings to a request form. Nil settings leave the
+// server's defaults in place.
+func (s *Settings) form(form url.Values) {
+	if s == nil {
+		return
+	}
+	form.Set("steps", strconv.Itoa(s.Steps))
+	form.Set("cfg", strconv.FormatFloat(s.CFG, 'f', -1, 64))
+	form.Set("seed", strconv.FormatInt(s.Seed, 10))
+}
+
+// ChatRequest is a message to the agent in the session's active chat.
+type ChatRequest struct {
+	Message string
+	// Settings used if the agent generates an image (nil for the server
+	// defaults)
+	Settings *Settings
+}
+
+// ChatReply is the agent's response to a ChatRequest.
+type ChatReply struct {
+	// MessageID identifies the assistant message in the chat history
+	MessageID int
+	// Text is the agent's response as streamed, including notes the server
+	// appends such as clamped settings
+	Text string
+	// Prompt is the new image prompt, if the agent changed it
+	Prompt string
+	// Settings are the generation settings chosen by the agent, if any
+	Settings *Settings
+	// ImageURL is the image generated for the reply, if the agent asked for
+	// one and generation succeeded; see DownloadImage
+	ImageURL string
+}
+
+// Chat sends a message to the agent and waits for the response, which the
+// server streams on events. onToken, if not nil, is called with each piece
+// of the response as it arrives; after a retry the response starts over.
+// If the agent generates an image, Chat waits for the generation too.
+func (c *Client) Chat(ctx context.Context, events *EventStream, chat ChatRequest, onToken func(string)) (*ChatReply, error) {
+	if strings.TrimSpace(chat.Message) == "" {
+		return nil, fmt.Errorf("%w: message required", ErrChatFailed)
+	}
+
+	form := url.Values{"message": {chat.Message}}
+	chat.Settings.form(form)
+	req, err := c.newRequest(ctx, http.MethodPost, "/chat", form)
+	if err != nil {
+		return nil, err
+	}
+
+	events.discard()
+	posted := make(chan error, 1)
+	go func() {
+		resp, err := c.do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		posted <- err
+	}()
+
+	// The server sends agent-done before starting a generation the agent
+	// asked for, and answers the POST once the generation has finished
+	var reply ChatReply
+	var text strings.Builder
+	var lastError string
+	done := false
+	for !done || posted != nil {
+		var event Event
+		select {
+		case err := <-posted:
+			if err != nil {
+				return nil, err
+			}
+			posted = nil
+			continue
+		case next, ok := <-events.events:
+			if !ok {
+				return nil, fmt.Errorf("%w: %v", ErrStreamClosed, events.err)
+			}
+			event = next
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		switch event.Type {
+		case EventAgentToken:
+			var data struct {
+				Token string `json:"token"`
+			}
+			if err := event.Decode(&data); err != nil {
+				return nil, err
+			}
+			text.WriteString(data.Token)
+			if onToken != nil {
+				onToken(data.Token)
+			}
+		case EventAgentRetry, EventAgentReconnecting:
+			text.Reset()
+		case EventPromptUpdate:
+			var data struct {
+				Prompt string `json:"prompt"`
+			}
+			if err := event.Decode(&data); err != nil {
+				return nil, err
+			}
+			reply.Prompt = data.Prompt
+		case EventSettingsUpdate:
+			var settings Settings
+			if err := event.Decode(&settings); err != nil {
+				return nil, err
+			}
+			reply.Settings = &settings
+		case EventError:
+			var data struct {
+				Message string `json:"message"`
+			}
+			if err := event.Decode(&data); err != nil {
+				return nil, err
+			}
+			lastError = data.Message
+		case EventAgentDone:
+			var data struct {
+				MessageID int `json:"message_id"`
+			}
+			if err := event.Decode(&data); err != nil {
+				return nil, err
+			}
+			reply.MessageID = data.MessageID
+			done = true
+		}
+	}
+
+	if reply.MessageID == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrChatFailed, lastError)
+	}
+	reply.Text = text.String()
+
+	// The generated image is recorded on the message before the POST is
+	// answered, so its state is current
+	if reply.Prompt != "" {
+		state, err := c.MessageState(ctx, reply.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		if state.PreviewStatus == PreviewStatusComplete {
+			reply.ImageURL = state.PreviewURL
+		}
+	}
+	return &reply, nil
+}
@@ -0,0 +1,177 @@
+package weaveclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChat(t *testing.T) {
+	tests := []struct {
+		name string
+		// turn sends the server's events for the chat request
+		turn         func(send func(string, any))
+		status       int
+		wantText     string
+		wantPrompt   string
+		wantSettings *Settings
+		wantImageURL string
+		wantErr      error
+	}{
+		{
+			name: "conversational reply",
+			turn: func(send func(string, any)) {
+				send(EventAgentThinking, map[string]bool{"started": true})
+				send(EventAgentToken, map[string]string{"token": "Hello"})
+				send(EventAgentToken, map[string]string{"token": " there"})
+				send(EventAgentDone, map[string]any{"done": true, "message_id": 2, "has_snapshot": false})
+			},
+			wantText: "Hello there",
+		},
+		{
+			name: "reply with generation",
+			turn: func(send func(string, any)) {
+				send(EventAgentToken, map[string]string{"token": "Here's a fox"})
+				send(EventPromptUpdate, map[string]string{"prompt": "a red fox"})
+				send(EventSettingsUpdate, map[string]any{"steps": 4, "cfg": 1.0, "seed": -1})
+				send(EventAgentDone, map[string]any{"done": true, "message_id": 2, "has_snapshot": true})
+				send(EventGenerationStarted, map[string]any{"source": "agent", "message_id": 2})
+				send(EventImageReady, map[string]any{"url": "/sessions/" + testSessionID + "/images/2.png", "width": 64, "height": 64, "message_id": 2})
+			},
+			wantText:     "Here's a fox",
+			wantPrompt:   "a red fox",
+			wantSettings: &Settings{Steps: 4, CFG: 1, Seed: -1},
+			wantImageURL: "/sessions/" + testSessionID + "/images/2.png",
+		},
+		{
+			name: "retry starts over",
+			turn: func(send func(string, any)) {
+				send(EventAgentToken, map[string]string{"token": "broken"})
+				send(EventAgentRetry, map[string]int{"attempt": 2})
+				send(EventAgentToken, map[string]string{"token": "fixed"})
+				send(EventAgentDone, map[string]any{"done": true, "message_id": 2, "has_snapshot": false})
+			},
+			wantText: "fixed",
+		},
+		{
+			name: "reconnect starts over",
+			turn: func(send func(string, any)) {
+				send(EventAgentToken, map[string]string{"token": "cut "})
+				send(EventAgentReconnecting, map[string]int{"attempt": 1, "delay_ms": 400})
+				send(EventAgentToken, map[string]string{"token": "whole"})
+				send(EventAgentDone, map[string]any{"done": true, "message_id": 2, "has_snapshot": false})
+			},
+			wantText: "whole",
+		},
+		{
+			name: "agent failed",
+			turn: func(send func(string, any)) {
+				send(EventError, map[string]string{"message": "An error occurred"})
+				send(EventAgentDone, map[string]any{"done": true, "message_id": 0, "has_snapshot": false})
+			},
+			wantErr: ErrChatFailed,
+		},
+		{
+			name: "rejected",
+			turn: func(send func(string, any)) {
+				send(EventError, map[string]string{"message": "Too many requests"})
+			},
+			status:  http.StatusTooManyRequests,
+			wantErr: ErrRateLimited,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotMessage string
+			s := newFakeServer(t, map[string]func(http.ResponseWriter, *http.Request, func(string, any)){
+				"POST /chat": func(w http.ResponseWriter, r *http.Request, send func(string, any)) {
+					gotMessage = r.FormValue("message")
+					tt.turn(send)
+					if tt.status != 0 {
+						w.WriteHeader(tt.status)
+						fmt.Fprint(w, `{"status":"error","message":"rejected"}`)
+						return
+					}
+					fmt.Fprintf(w, `{"status":"ok","session_id":%q}`, testSessionID)
+				},
+				"GET /message/{id}/state": func(w http.ResponseWriter, r *http.Request, send func(string, any)) {
+					fmt.Fprintf(w, `{"message_id":2,"prompt":"a red fox","preview_status":"complete","preview_url":"/sessions/%s/images/2.png"}`, testSessionID)
+				},
+			})
+			c, events := connect(t, s)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var streamed strings.Builder
+			reply, err := c.Chat(ctx, events, ChatRequest{Message: "draw a fox"}, func(token string) {
+				streamed.WriteString(token)
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Chat() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+
+			if gotMessage != "draw a fox" {
+				t.Errorf("message = %q, want %q", gotMessage, "draw a fox")
+			}
+			if reply.MessageID != 2 {
+				t.Errorf("MessageID = %d, want 2", reply.MessageID)
+			}
+			if reply.Text != tt.wantText {
+				t.Errorf("Text = %q, want %q", reply.Text, tt.wantText)
+			}
+			if !strings.HasSuffix(streamed.String(), tt.wantText) {
+				t.Errorf("streamed = %q, want it to end with %q", streamed.String(), tt.wantText)
+			}
+			if reply.Prompt != tt.wantPrompt {
+				t.Errorf("Prompt = %q, want %q", reply.Prompt, tt.wantPrompt)
+			}
+			if (reply.Settings == nil) != (tt.wantSettings == nil) || (reply.Settings != nil && *reply.Settings != *tt.wantSettings) {
+				t.Errorf("Settings = %+v, want %+v", reply.Settings, tt.wantSettings)
+			}
+			if reply.ImageURL != tt.wantImageURL {
+				t.Errorf("ImageURL = %q, want %q", reply.ImageURL, tt.wantImageURL)
+			}
+		})
+	}
+}
+
+func TestChat_SendsSettings(t *testing.T) {
+	var got [3]string
+	s := newFakeServer(t, map[string]func(http.ResponseWriter, *http.Request, func(string, any)){
+		"POST /chat": func(w http.ResponseWriter, r *http.Request, send func(string, any)) {
+			got = [3]string{r.FormValue("steps"), r.FormValue("cfg"), r.FormValue("seed")}
+			send(EventAgentDone, map[string]any{"done": true, "message_id": 2})
+			fmt.Fprint(w, `{"status":"ok"}`)
+		},
+	})
+	c, events := connect(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.Chat(ctx, events, ChatRequest{Message: "hi", Settings: &Settings{Steps: 8, CFG: 2.5, Seed: 42}}, nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if got != [3]string{"8", "2.5", "42"} {
+		t.Errorf("steps, cfg, seed = %q, want 8, 2.5, 42", got)
+	}
+}
+
+func TestChat_EmptyMessage(t *testing.T) {
+	s := newFakeServer(t, nil)
+	c, events := connect(t, s)
+
+	if _, err := c.Chat(context.Background(), events, ChatRequest{Message: "  "}, nil); !errors.Is(err, ErrChatFailed) {
+		t.Errorf("Chat() error = %v, want ErrChatFailed", err)
+	}
+}
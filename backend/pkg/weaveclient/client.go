@@ -0,0 +1,307 @@
+// Package weaveclient is a Go client for the weave HTTP API.
+//
+// A Client holds one weave session. Agent responses and generated images are
+// delivered over the session's Server-Sent Events stream, so open it with
+// Events before calling Chat or Generate, and pass it to them:
+//
+//	c, err := weaveclient.NewClient("http://localhost:8080")
+//	if err != nil {
+//		return err
+//	}
+//	c.SetToken(os.Getenv("WEAVE_API_TOKEN")) // only if the server requires one
+//
+//	events, err := c.Events(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer events.Close()
+//
+//	reply, err := c.Chat(ctx, events, weaveclient.ChatRequest{Message: "a red fox in snow"}, func(token string) {
+//		fmt.Print(token)
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	if reply.ImageURL != "" {
+//		err = c.SaveImage(ctx, reply.ImageURL, "fox.png")
+//	}
+//
+// The server delivers events for the session's active chat only, and a
+// session has one event stream, so a Client runs one Chat or Generate at a
+// time.
+package weaveclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SessionCookieName is the cookie identifying the weave session.
+	SessionCookieName = "weave_session"
+
+	// CSRFHeaderName is the header carrying the session's CSRF token. The
+	// server sends it on every response and requires it on every request
+	// that changes state, unless the client has an API token.
+	CSRFHeaderName = "X-CSRF-Token"
+
+	// maxErrorBodySize bounds how much of an error response is read.
+	maxErrorBodySize = 4096
+)
+
+// Sentinel errors for weave client operations
+var (
+	// ErrRequestFailed is returned when the server rejects a request
+	ErrRequestFailed = errors.New("weave request failed")
+	// ErrUnauthorized is returned when the server requires an API token and
+	// none or a wrong one was set
+	ErrUnauthorized = errors.New("weave API token required")
+	// ErrNotFound is returned when the requested resource doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited is returned when the session sent too many requests
+	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrUnavailable is returned when a dependency of the server, such as
+	// the compute process, is not available
+	ErrUnavailable = errors.New("weave service unavailable")
+)
+
+// Client provides methods to communicate with the weave API.
+// The Set methods must be called before the client is used.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+
+	mu        sync.Mutex
+	sessionID string
+	csrfToken string
+}
+
+// NewClient creates a client for the weave server at baseURL, for example
+// "http://localhost:8080". The session is created by the server on the
+// first request.
+func NewClient(baseURL string) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("base URL must be an absolute http or https URL: %q", baseURL)
+	}
+	return &Client{
+		baseURL: u,
+		// No timeout: the event stream and chat requests are long-lived.
+		// Use contexts to bound calls.
+		httpClient: &http.Client{},
+	}, nil
+}
+
+// SetToken sets the API token sent as "Authorization: Bearer" on every
+// request. Required when the server was started with --api-token.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// SetHTTPClient replaces the HTTP client used for requests. It must not
+// time out requests, or the event stream will be closed.
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+	c.httpClient = httpClient
+}
+
+// SetSessionID resumes an existing session instead of starting a new one.
+func (c *Client) SetSessionID(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sessionID != c.sessionID {
+		// The CSRF token belongs to the old session; the next response
+		// carries the new one
+		c.csrfToken = ""
+	}
+	c.sessionID = sessionID
+}
+
+// SessionID returns the session ID, or "" before the first request.
+func (c *Client) SessionID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionID
+}
+
+// resolve returns the absolute URL for a path or URL returned by the server.
+// URLs for other hosts are rejected so the API token isn't sent elsewhere.
+func (c *Client) resolve(ref string) (string, error) {
+	u, err := c.baseURL.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %w", ref, err)
+	}
+	if u.Scheme != c.baseURL.Scheme || u.Host != c.baseURL.Host {
+		return "", fmt.Errorf("URL %q is not on %s", ref, c.baseURL.Host)
+	}
+	return u.String(), nil
+}
+
+// newRequest creates a request for path. A non-nil form is sent as a
+// URL-encoded body.
+func (c *Client) newRequest(ctx context.Context, method, path string, form url.Values) (*http.Request, error) {
+	target, err := c.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return req, nil
+}
+
+// do sends req with the session cookie and API token and records the
+// session ID the server assigns. Responses other than 2xx are returned as
+// errors. The caller must close the body of a returned response.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	c.mu.Lock()
+	sessionID, csrfToken := c.sessionID, c.csrfToken
+	c.mu.Unlock()
+	if sessionID != "" {
+		req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: sessionID})
+	}
+	if csrfToken != "" {
+		req.Header.Set(CSRFHeaderName, csrfToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
+	}
+
+	// The session cookie is Secure, which a cookie jar won't send over
+	// plain http, so it is tracked here
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == SessionCookieName && cookie.Value != "" {
+			c.SetSessionID(cookie.Value)
+		}
+	}
+	if token := resp.Header.Get(CSRFHeaderName); token != "" {
+		c.mu.Lock()
+		c.csrfToken = token
+		c.mu.Unlock()
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// doJSON sends a request and decodes the JSON response into out.
+// If out is nil the response body is discarded.
+func (c *Client) doJSON(ctx context.Context, method, path string, form url.Values, out any) error {
+	req, err := c.newRequest(ctx, method, path, form)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: invalid response: %v", ErrRequestFailed, err)
+	}
+	return nil
+}
+
+// responseError converts an error response to an error wrapping one of the
+// sentinel errors. The server's message is included: JSON error responses
+// carry it in "message", other responses are plain text.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+
+	message := strings.TrimSpace(string(body))
+	var jsonErr struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &jsonErr) == nil && jsonErr.Message != "" {
+		message = jsonErr.Message
+	}
+
+	var sentinel error
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		sentinel = ErrUnauthorized
+	case http.StatusNotFound:
+		sentinel = ErrNotFound
+	case http.StatusTooManyRequests:
+		rateErr := &RateLimitError{
+			Limit:      headerInt(resp.Header, "X-RateLimit-Limit"),
+			RetryAfter: time.Duration(headerInt(resp.Header, "Retry-After")) * time.Second,
+			Message:    message,
+		}
+		if reset := headerInt(resp.Header, "X-RateLimit-Reset"); reset > 0 {
+			rateErr.Reset = time.Unix(int64(reset), 0)
+		}
+		return rateErr
+	case http.StatusServiceUnavailable:
+		sentinel = ErrUnavailable
+	default:
+		sentinel = ErrRequestFailed
+	}
+	return fmt.Errorf("%w: %d: %s", sentinel, resp.StatusCode, message)
+}
+
+// RateLimitError is returned when the server rejects a request with 429.
+// It matches ErrRateLimited with errors.Is; use errors.As to read how long
+// to wait before retrying.
+type RateLimitError struct {
+	// Limit is the number of requests allowed per minute, or per day when
+	// the daily generation quota was reached
+	Limit int
+
+	// Reset is when the limit is fully restored (zero if not reported)
+	Reset time.Time
+
+	// RetryAfter is how long to wait before the next request
+	RetryAfter time.Duration
+
+	// Message is the server's error message
+	Message string
+}
+
+// Error implements error.
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v: %d: %s (retry after %s)", ErrRateLimited, http.StatusTooManyRequests, e.Message, e.RetryAfter)
+}
+
+// Unwrap returns ErrRateLimited.
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// headerInt returns the integer value of a response header, or 0 if it is
+// missing or malformed.
+func headerInt(h http.Header, name string) int {
+	n, _ := strconv.Atoi(h.Get(name))
+	return n
+}
@@ -0,0 +1,298 @@
+package weaveclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSessionID = "0123456789abcdef0123456789abcdef"
+
+// fakeServer is a weave server that serves an event stream and the given
+// routes. Handlers send events with send, which returns once the event has
+// been written, as the real server does.
+type fakeServer struct {
+	*httptest.Server
+	frames chan sseFrame
+}
+
+type sseFrame struct {
+	data    string
+	written chan struct{}
+}
+
+// newFakeServer starts a fake server. routes are keyed by mux pattern.
+func newFakeServer(t *testing.T, routes map[string]func(w http.ResponseWriter, r *http.Request, send func(eventType string, data any))) *fakeServer {
+	t.Helper()
+
+	s := &fakeServer{frames: make(chan sseFrame)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events", s.handleEvents)
+	for pattern, handler := range routes {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r, s.send)
+		})
+	}
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: SessionCookieName, Value: testSessionID, Secure: true})
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprintf(w, "event: connected\ndata: {\"session\":%q}\n\n", testSessionID)
+	w.(http.Flusher).Flush()
+
+	for {
+		select {
+		case frame := <-s.frames:
+			fmt.Fprint(w, frame.data)
+			w.(http.Flusher).Flush()
+			close(frame.written)
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// send writes an event to the connected event stream.
+func (s *fakeServer) send(eventType string, data any) {
+	jsonData, _ := json.Marshal(data)
+	frame := sseFrame{
+		data:    fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, jsonData),
+		written: make(chan struct{}),
+	}
+	s.frames <- frame
+	<-frame.written
+}
+
+// connect creates a client for s and opens its event stream.
+func connect(t *testing.T, s *fakeServer) (*Client, *EventStream) {
+	t.Helper()
+
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, err := c.Events(ctx)
+	if err != nil {
+		t.Fatalf("Events() error = %v", err)
+	}
+	t.Cleanup(func() { events.Close() })
+	return c, events
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		wantErr bool
+	}{
+		{"http", "http://localhost:8080", false},
+		{"trailing slash", "http://localhost:8080/", false},
+		{"https", "https://weave.example.com", false},
+		{"no scheme", "localhost:8080", true},
+		{"other scheme", "ftp://localhost", true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(tt.baseURL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClient(%q) error = %v, wantErr %v", tt.baseURL, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_SessionAndToken(t *testing.T) {
+	var gotAuth, gotSession []string
+	s := newFakeServer(t, map[string]func(http.ResponseWriter, *http.Request, func(string, any)){
+		"GET /history": func(w http.ResponseWriter, r *http.Request, send func(string, any)) {
+			gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+			cookie, err := r.Cookie(SessionCookieName)
+			if err != nil {
+				gotSession = append(gotSession, "")
+				http.SetCookie(w, &http.Cookie{Name: SessionCookieName, Value: testSessionID, Secure: true})
+			} else {
+				gotSession = append(gotSession, cookie.Value)
+			}
+			fmt.Fprint(w, `{"status":"ok","messages":[],"page":{"total":0,"limit":50,"offset":0}}`)
+		},
+	})
+
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	c.SetToken("0123456789abcdef")
+
+	for range 2 {
+		if _, _, err := c.History(context.Background(), 0, 0); err != nil {
+			t.Fatalf("History() error = %v", err)
+		}
+	}
+
+	if gotSession[0] != "" || gotSession[1] != testSessionID {
+		t.Errorf("session cookies = %q, want none then %q", gotSession, testSessionID)
+	}
+	if c.SessionID() != testSessionID {
+		t.Errorf("SessionID() = %q, want %q", c.SessionID(), testSessionID)
+	}
+	for _, auth := range gotAuth {
+		if auth != "Bearer 0123456789abcdef" {
+			t.Errorf("Authorization = %q, want bearer token", auth)
+		}
+	}
+}
+
+func TestClient_CSRFToken(t *testing.T) {
+	var gotTokens []string
+	s := newFakeServer(t, map[string]func(http.ResponseWriter, *http.Request, func(string, any)){
+		"GET /history": func(w http.ResponseWriter, r *http.Request, send func(string, any)) {
+			gotTokens = append(gotTokens, r.Header.Get(CSRFHeaderName))
+			w.Header().Set(CSRFHeaderName, "token-for-"+requestSession(r))
+			fmt.Fprint(w, `{"status":"ok","messages":[],"page":{"total":0,"limit":50,"offset":0}}`)
+		},
+	})
+
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	c.SetSessionID("a")
+	for range 2 {
+		if _, _, err := c.History(context.Background(), 0, 0); err != nil {
+			t.Fatalf("History() error = %v", err)
+		}
+	}
+
+	// Switching sessions drops the old session's token
+	c.SetSessionID("b")
+	if _, _, err := c.History(context.Background(), 0, 0); err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+
+	want := []string{"", "token-for-a", ""}
+	if strings.Join(gotTokens, ",") != strings.Join(want, ",") {
+		t.Errorf("%s headers = %q, want %q", CSRFHeaderName, gotTokens, want)
+	}
+}
+
+// requestSession returns the session cookie value of r, or "".
+func requestSession(r *http.Request) string {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func TestClient_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        error
+		wantMessage string
+	}{
+		{"unauthorized", http.StatusUnauthorized, "text/plain", "API token required\n", ErrUnauthorized, "API token required"},
+		{"not found", http.StatusNotFound, "text/plain", "Message not found\n", ErrNotFound, "Message not found"},
+		{"rate limited", http.StatusTooManyRequests, "application/json", `{"status":"error","message":"rate limit exceeded"}`, ErrRateLimited, "rate limit exceeded"},
+		{"unavailable", http.StatusServiceUnavailable, "application/json", `{"status":"error","message":"generation failed"}`, ErrUnavailable, "generation failed"},
+		{"bad request", http.StatusBadRequest, "application/json", `{"status":"error","message":"message required"}`, ErrRequestFailed, "message required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeServer(t, map[string]func(http.ResponseWriter, *http.Request, func(string, any)){
+				"GET /message/{id}/state": func(w http.ResponseWriter, r *http.Request, send func(string, any)) {
+					w.Header().Set("Content-Type", tt.contentType)
+					w.WriteHeader(tt.status)
+					fmt.Fprint(w, tt.body)
+				},
+			})
+			c, err := NewClient(s.URL)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			_, err = c.MessageState(context.Background(), 1)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if want := fmt.Sprintf("%d: %s", tt.status, tt.wantMessage); !strings.Contains(err.Error(), want) {
+				t.Errorf("error = %q, want it to contain %q", err, want)
+			}
+		})
+	}
+}
+
+func TestClient_RateLimitError(t *testing.T) {
+	s := newFakeServer(t, map[string]func(http.ResponseWriter, *http.Request, func(string, any)){
+		"POST /regenerate/{messageID}": func(w http.ResponseWriter, r *http.Request, send func(string, any)) {
+			w.Header().Set("X-RateLimit-Limit", "5")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "1767225600")
+			w.Header().Set("Retry-After", "12")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"status":"error","message":"rate limit exceeded","retry_after":12}`)
+		},
+	})
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	_, err = c.Regenerate(context.Background(), 1)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("error = %v, want ErrRateLimited", err)
+	}
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("error = %T, want *RateLimitError", err)
+	}
+	want := RateLimitError{Limit: 5, Reset: time.Unix(1767225600, 0), RetryAfter: 12 * time.Second, Message: "rate limit exceeded"}
+	if *rateErr != want {
+		t.Errorf("RateLimitError = %+v, want %+v", *rateErr, want)
+	}
+}
+
+func TestClient_ResolveRejectsOtherHosts(t *testing.T) {
+	c, err := NewClient("http://localhost:8080")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{ref: "/sessions/abc/images/1.png", want: "http://localhost:8080/sessions/abc/images/1.png"},
+		{ref: "http://localhost:8080/images/1.png", want: "http://localhost:8080/images/1.png"},
+		{ref: "http://example.com/images/1.png", wantErr: true},
+		{ref: "https://localhost:8080/images/1.png", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := c.resolve(tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolve(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolve(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
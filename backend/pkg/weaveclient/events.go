@@ -0,0 +1,194 @@
+package weaveclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Event types sent on the event stream. See the weave API documentation at
+// /api/docs for the data of each event.
+const (
+	EventConnected          = "connected"
+	EventAgentThinking      = "agent-thinking"
+	EventAgentToken         = "agent-token"
+	EventAgentRetry         = "agent-retry"
+	EventAgentReconnecting  = "agent-reconnecting"
+	EventAgentDone          = "agent-done"
+	EventPromptUpdate       = "prompt-update"
+	EventSettingsUpdate     = "settings-update"
+	EventGenerationStarted  = "generation-started"
+	EventImageReady         = "image-ready"
+	EventImageDeleted       = "image-deleted"
+	EventChatSwitched       = "chat-switched"
+	EventHistoryRewound     = "history-rewound"
+	EventMessageDeleted     = "message-deleted"
+	EventError              = "error"
+	EventServerShuttingDown = "server-shutting-down"
+	EventComputeStatus      = "compute-status"
+	EventQueuePosition      = "queue-position"
+
+	// eventBufferSize is the number of events read ahead of the consumer
+	eventBufferSize = 256
+)
+
+// ErrStreamClosed is returned by EventStream.Next after the stream ends.
+var ErrStreamClosed = errors.New("event stream closed")
+
+// Event is one Server-Sent Event.
+type Event struct {
+	Type string
+	Data json.RawMessage
+}
+
+// Decode unmarshals the event data into v.
+func (e Event) Decode(v any) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("invalid %s event: %w", e.Type, err)
+	}
+	return nil
+}
+
+// EventStream is the session's Server-Sent Events stream. Events are read
+// in the background and buffered until Next is called.
+type EventStream struct {
+	body   io.ReadCloser
+	events chan Event
+	done   chan struct{}
+
+	closeOnce sync.Once
+	err       error // why the stream ended; set before events is closed
+}
+
+// Events opens the session's event stream and waits until the server has
+// registered it, so no events of a following request are missed. ctx only
+// bounds the wait; the stream stays open until Close.
+// The server allows one stream per session; a second stream for the same
+// session is never registered and Events waits until ctx is done.
+func (c *Client) Events(ctx context.Context) (*EventStream, error) {
+	req, err := c.newRequest(context.WithoutCancel(ctx), http.MethodGet, "/events", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &EventStream{
+		body:   resp.Body,
+		events: make(chan Event, eventBufferSize),
+		done:   make(chan struct{}),
+	}
+	go s.read()
+
+	event, err := s.Next(ctx)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	if event.Type != EventConnected {
+		s.Close()
+		return nil, fmt.Errorf("%w: expected %s event, got %s", ErrRequestFailed, EventConnected, event.Type)
+	}
+	return s, nil
+}
+
+// Next returns the next event. It returns an error wrapping ErrStreamClosed
+// when the stream has ended, or ctx.Err() if ctx is done first.
+func (s *EventStream) Next(ctx context.Context) (Event, error) {
+	select {
+	case event, ok := <-s.events:
+		if !ok {
+			return Event{}, fmt.Errorf("%w: %v", ErrStreamClosed, s.err)
+		}
+		return event, nil
+	case <-ctx.Done():
+		return Event{}, ctx.Err()
+	}
+}
+
+// Close closes the stream.
+func (s *EventStream) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		err = s.body.Close()
+	})
+	return err
+}
+
+// discard drops buffered events, such as those left over from an earlier
+// request.
+func (s *EventStream) discard() {
+	for {
+		select {
+		case _, ok := <-s.events:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// read parses events from the response body until it ends or the stream is
+// closed:
+//
+//	event: <type>
+//	data: <json>
+//	<blank line>
+func (s *EventStream) read() {
+	defer close(s.events)
+
+	reader := bufio.NewReader(s.body)
+	var eventType string
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			s.err = err
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "":
+			if eventType == "" && data.Len() == 0 {
+				continue
+			}
+			if eventType == "" {
+				eventType = "message"
+			}
+			select {
+			case s.events <- Event{Type: eventType, Data: json.RawMessage(data.String())}:
+			case <-s.done:
+				s.err = errors.New("closed")
+				return
+			}
+			eventType = ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// Comment
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
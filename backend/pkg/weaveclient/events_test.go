@@ -0,0 +1,87 @@
+package weaveclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	s := newFakeServer(t, nil)
+	c, events := connect(t, s)
+
+	if c.SessionID() != testSessionID {
+		t.Errorf("SessionID() = %q, want %q", c.SessionID(), testSessionID)
+	}
+
+	go s.send(EventPromptUpdate, map[string]string{"prompt": "a red fox"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	event, err := events.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if event.Type != EventPromptUpdate {
+		t.Errorf("Type = %q, want %q", event.Type, EventPromptUpdate)
+	}
+	var data struct {
+		Prompt string `json:"prompt"`
+	}
+	if err := event.Decode(&data); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if data.Prompt != "a red fox" {
+		t.Errorf("prompt = %q, want %q", data.Prompt, "a red fox")
+	}
+}
+
+func TestEventStream_Parse(t *testing.T) {
+	tests := []struct {
+		name     string
+		stream   string
+		wantType string
+		wantData string
+	}{
+		{"event", "event: agent-token\ndata: {\"token\":\"Hi\"}\n\n", "agent-token", `{"token":"Hi"}`},
+		{"CRLF", "event: agent-token\r\ndata: {\"token\":\"Hi\"}\r\n\r\n", "agent-token", `{"token":"Hi"}`},
+		{"comment", ": keepalive\n\nevent: error\ndata: {}\n\n", "error", `{}`},
+		{"multi-line data", "event: x\ndata: [1,\ndata: 2]\n\n", "x", "[1,\n2]"},
+		{"no event type", "data: {}\n\n", "message", `{}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr, pw := io.Pipe()
+			s := &EventStream{body: pr, events: make(chan Event, 1), done: make(chan struct{})}
+			go s.read()
+			go pw.Write([]byte(tt.stream))
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			event, err := s.Next(ctx)
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			if event.Type != tt.wantType || string(event.Data) != tt.wantData {
+				t.Errorf("Next() = %q %q, want %q %q", event.Type, event.Data, tt.wantType, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestEventStream_Closed(t *testing.T) {
+	s := newFakeServer(t, nil)
+	_, events := connect(t, s)
+
+	s.CloseClientConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := events.Next(ctx); !errors.Is(err, ErrStreamClosed) {
+		t.Errorf("Next() error = %v, want ErrStreamClosed", err)
+	}
+}
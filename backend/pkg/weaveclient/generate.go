@@ -0,0 +1,116 @@
+package weaveclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ErrGenerateFailed is returned when the server reports a failed generation.
+var ErrGenerateFailed = errors.New("generation failed")
+
+// GenerateRequest is a generation in the session's active chat.
+type GenerateRequest struct {
+	// Prompt to generate; empty uses the chat's current prompt
+	Prompt string
+	// MessageID attaches the image to an assistant message (0 for none)
+	MessageID int
+	// Settings for the generation (nil for the server defaults)
+	Settings *Settings
+}
+
+// Image is a generated image.
+type Image struct {
+	// URL of the image on the server; see DownloadImage
+	URL       string `json:"url"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	MessageID int    `json:"message_id"`
+	// Alternate is set (1-based) for images from Regenerate
+	Alternate int `json:"alternate,omitempty"`
+	// Seed is the seed the image was generated with, also when a random
+	// one was asked for; 0 if the server's compute did not report it
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// Generate generates an image and waits until it is ready. The image URL is
+// delivered on events.
+func (c *Client) Generate(ctx context.Context, events *EventStream, gen GenerateRequest) (*Image, error) {
+	form := url.Values{}
+	if gen.Prompt != "" {
+		form.Set("prompt", gen.Prompt)
+	}
+	if gen.MessageID > 0 {
+		form.Set("message_id", strconv.Itoa(gen.MessageID))
+	}
+	gen.Settings.form(form)
+	req, err := c.newRequest(ctx, http.MethodPost, "/generate", form)
+	if err != nil {
+		return nil, err
+	}
+
+	events.discard()
+	posted := make(chan error, 1)
+	go func() {
+		resp, err := c.do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		posted <- err
+	}()
+
+	// The server sends image-ready before answering the POST. A request
+	// without a prompt is answered with 200 and an error event.
+	for {
+		var event Event
+		select {
+		case err := <-posted:
+			if err != nil {
+				return nil, err
+			}
+			posted = nil
+			continue
+		case next, ok := <-events.events:
+			if !ok {
+				return nil, fmt.Errorf("%w: %v", ErrStreamClosed, events.err)
+			}
+			event = next
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		switch event.Type {
+		case EventImageReady:
+			var image Image
+			if err := event.Decode(&image); err != nil {
+				return nil, err
+			}
+			// Images for other messages were started before this request
+			if image.MessageID == gen.MessageID && image.Alternate == 0 {
+				return &image, nil
+			}
+		case EventError:
+			var data struct {
+				Message string `json:"message"`
+			}
+			if err := event.Decode(&data); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %s", ErrGenerateFailed, data.Message)
+		}
+	}
+}
+
+// Regenerate generates another image for an assistant message from its
+// snapshot with a new random seed. The image is stored as the message's
+// next alternate; the server keeps up to 10.
+func (c *Client) Regenerate(ctx context.Context, messageID int) (*Image, error) {
+	var image Image
+	if err := c.doJSON(ctx, http.MethodPost, "/regenerate/"+strconv.Itoa(messageID), url.Values{}, &image); err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
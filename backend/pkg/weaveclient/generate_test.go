@@ -0,0 +1,120 @@
+package weaveclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name    string
+		request GenerateRequest
+		// generate sends the server's events for the generation request
+		generate func(send func(string, any))
+		status   int
+		wantURL  string
+		wantErr  error
+	}{
+		{
+			name:    "image",
+			request: GenerateRequest{Prompt: "a red fox"},
+			generate: func(send func(string, any)) {
+				send(EventGenerationStarted, map[string]string{"source": "manual"})
+				send(EventImageReady, map[string]any{"url": "/images/abc.png", "width": 64, "height": 64, "message_id": 0})
+			},
+			wantURL: "/images/abc.png",
+		},
+		{
+			name:    "image for message skips others",
+			request: GenerateRequest{MessageID: 3},
+			generate: func(send func(string, any)) {
+				send(EventImageReady, map[string]any{"url": "/sessions/x/images/2.png", "message_id": 2})
+				send(EventImageReady, map[string]any{"url": "/sessions/x/images/3.png", "message_id": 3})
+			},
+			wantURL: "/sessions/x/images/3.png",
+		},
+		{
+			name:    "no prompt",
+			request: GenerateRequest{},
+			generate: func(send func(string, any)) {
+				send(EventError, map[string]string{"message": "No prompt available"})
+			},
+			wantErr: ErrGenerateFailed,
+		},
+		{
+			name:    "compute not running",
+			request: GenerateRequest{Prompt: "a red fox"},
+			generate: func(send func(string, any)) {
+				send(EventGenerationStarted, map[string]string{"source": "manual"})
+			},
+			status:  http.StatusServiceUnavailable,
+			wantErr: ErrUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPrompt, gotMessageID string
+			s := newFakeServer(t, map[string]func(http.ResponseWriter, *http.Request, func(string, any)){
+				"POST /generate": func(w http.ResponseWriter, r *http.Request, send func(string, any)) {
+					gotPrompt, gotMessageID = r.FormValue("prompt"), r.FormValue("message_id")
+					tt.generate(send)
+					if tt.status != 0 {
+						w.WriteHeader(tt.status)
+						fmt.Fprint(w, `{"status":"error","message":"generation failed"}`)
+						return
+					}
+					fmt.Fprint(w, `{"status":"ok"}`)
+				},
+			})
+			c, events := connect(t, s)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			image, err := c.Generate(ctx, events, tt.request)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Generate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			if image.URL != tt.wantURL {
+				t.Errorf("URL = %q, want %q", image.URL, tt.wantURL)
+			}
+			if gotPrompt != tt.request.Prompt {
+				t.Errorf("prompt = %q, want %q", gotPrompt, tt.request.Prompt)
+			}
+			if tt.request.MessageID > 0 && gotMessageID != fmt.Sprint(tt.request.MessageID) {
+				t.Errorf("message_id = %q, want %d", gotMessageID, tt.request.MessageID)
+			}
+		})
+	}
+}
+
+func TestRegenerate(t *testing.T) {
+	s := newFakeServer(t, map[string]func(http.ResponseWriter, *http.Request, func(string, any)){
+		"POST /regenerate/{messageID}": func(w http.ResponseWriter, r *http.Request, send func(string, any)) {
+			fmt.Fprintf(w, `{"status":"ok","message_id":%s,"alternate":1,"url":"/sessions/x/images/%s-1.png","seed":99}`, r.PathValue("messageID"), r.PathValue("messageID"))
+		},
+	})
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	image, err := c.Regenerate(context.Background(), 4)
+	if err != nil {
+		t.Fatalf("Regenerate() error = %v", err)
+	}
+	want := Image{URL: "/sessions/x/images/4-1.png", MessageID: 4, Alternate: 1, Seed: 99}
+	if *image != want {
+		t.Errorf("Regenerate() = %+v, want %+v", *image, want)
+	}
+}
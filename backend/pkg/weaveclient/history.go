@@ -0,0 +1,83 @@
+package weaveclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Preview statuses of a message snapshot.
+const (
+	PreviewStatusNone       = "none"
+	PreviewStatusGenerating = "generating"
+	PreviewStatusComplete   = "complete"
+)
+
+// Snapshot is the generation state recorded on an assistant message that
+// changed the prompt or settings.
+type Snapshot struct {
+	Prompt        string  `json:"prompt"`
+	Steps         int     `json:"steps"`
+	CFG           float64 `json:"cfg"`
+	Seed          int64   `json:"seed"`
+	PreviewStatus string  `json:"preview_status"`
+	PreviewURL    string  `json:"preview_url"`
+}
+
+// Message is one message of a chat.
+type Message struct {
+	ID      int    `json:"id"`
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Snapshot is nil for user messages and purely conversational replies
+	Snapshot *Snapshot `json:"snapshot,omitempty"`
+	// ImageURL is set when an image is stored for the message
+	ImageURL  string    `json:"image_url,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+}
+
+// Page describes the part of a list returned by a paginated request.
+type Page struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	// NextOffset is the offset of the next page, or 0 on the last page
+	NextOffset int `json:"next_offset,omitempty"`
+}
+
+// History returns messages of the session's active chat, oldest first.
+// limit is the page size (0 for the server default).
+func (c *Client) History(ctx context.Context, limit, offset int) ([]Message, Page, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	path := "/history"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var resp struct {
+		Messages []Message `json:"messages"`
+		Page     Page      `json:"page"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, Page{}, err
+	}
+	return resp.Messages, resp.Page, nil
+}
+
+// MessageState returns the snapshot of an assistant message. Returns an
+// error wrapping ErrNotFound if the message has no snapshot.
+func (c *Client) MessageState(ctx context.Context, messageID int) (*Snapshot, error) {
+	var snapshot Snapshot
+	if err := c.doJSON(ctx, http.MethodGet, "/message/"+strconv.Itoa(messageID)+"/state", nil, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
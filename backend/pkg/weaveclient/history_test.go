@@ -0,0 +1,54 @@
+package weaveclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	var gotQuery string
+	s := newFakeServer(t, map[string]func(http.ResponseWriter, *http.Request, func(string, any)){
+		"GET /history": func(w http.ResponseWriter, r *http.Request, send func(string, any)) {
+			gotQuery = r.URL.RawQuery
+			fmt.Fprint(w, `{
+				"status": "ok",
+				"messages": [
+					{"id": 1, "role": "user", "content": "draw a fox", "created_at": "2025-01-31T12:00:00Z"},
+					{"id": 2, "role": "assistant", "content": "Here's a fox",
+					 "snapshot": {"prompt": "a red fox", "steps": 4, "cfg": 1, "seed": -1, "preview_status": "complete", "preview_url": "/sessions/x/images/2.png"},
+					 "image_url": "/sessions/x/images/2.png"}
+				],
+				"page": {"total": 5, "limit": 2, "offset": 1, "next_offset": 3}
+			}`)
+		},
+	})
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	messages, page, err := c.History(context.Background(), 2, 1)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if gotQuery != "limit=2&offset=1" {
+		t.Errorf("query = %q, want %q", gotQuery, "limit=2&offset=1")
+	}
+	if page != (Page{Total: 5, Limit: 2, Offset: 1, NextOffset: 3}) {
+		t.Errorf("page = %+v", page)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(messages))
+	}
+	if messages[0].Snapshot != nil || messages[0].CreatedAt.IsZero() {
+		t.Errorf("user message = %+v, want no snapshot and a creation time", messages[0])
+	}
+	if snap := messages[1].Snapshot; snap == nil || snap.Prompt != "a red fox" || snap.PreviewStatus != PreviewStatusComplete {
+		t.Errorf("snapshot = %+v, want complete with prompt", snap)
+	}
+	if messages[1].ImageURL != "/sessions/x/images/2.png" {
+		t.Errorf("ImageURL = %q", messages[1].ImageURL)
+	}
+}
@@ -0,0 +1,53 @@
+package weaveclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// DownloadImage writes the image at imageURL, as returned in Image.URL,
+// ChatReply.ImageURL or Message.ImageURL, to w. Returns the number of bytes
+// written.
+func (c *Client) DownloadImage(ctx context.Context, imageURL string, w io.Writer) (int64, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, fmt.Errorf("failed to download %s: %w", imageURL, err)
+	}
+	return n, nil
+}
+
+// SaveImage downloads the image at imageURL to path. The file is written
+// to a temporary file first, so path never holds a partial image.
+func (c *Client) SaveImage(ctx context.Context, imageURL, path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create image file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := c.DownloadImage(ctx, imageURL, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write image file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write image file: %w", err)
+	}
+	return nil
+}
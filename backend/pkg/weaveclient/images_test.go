@@ -0,0 +1,93 @@
+package weaveclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadImage(t *testing.T) {
+	s := newFakeServer(t, map[string]func(http.ResponseWriter, *http.Request, func(string, any)){
+		"GET /sessions/{sessionID}/images/{filename}": func(w http.ResponseWriter, r *http.Request, send func(string, any)) {
+			if r.PathValue("filename") != "2.png" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("fox-png"))
+		},
+	})
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr error
+	}{
+		{name: "path", url: "/sessions/x/images/2.png", want: "fox-png"},
+		{name: "absolute URL", url: s.URL + "/sessions/x/images/2.png", want: "fox-png"},
+		{name: "missing", url: "/sessions/x/images/3.png", wantErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := c.DownloadImage(context.Background(), tt.url, &buf)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("DownloadImage() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadImage() error = %v", err)
+			}
+			if buf.String() != tt.want || n != int64(len(tt.want)) {
+				t.Errorf("DownloadImage() = %q (%d bytes), want %q", buf.String(), n, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveImage(t *testing.T) {
+	s := newFakeServer(t, map[string]func(http.ResponseWriter, *http.Request, func(string, any)){
+		"GET /images/{id}": func(w http.ResponseWriter, r *http.Request, send func(string, any)) {
+			if r.PathValue("id") != "abc.png" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte("fox-png"))
+		},
+	})
+	c, err := NewClient(s.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "fox.png")
+	if err := c.SaveImage(context.Background(), "/images/abc.png", path); err != nil {
+		t.Fatalf("SaveImage() error = %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "fox-png" {
+		t.Errorf("saved file = %q, %v; want %q", data, err, "fox-png")
+	}
+
+	// A failed download leaves nothing behind
+	missing := filepath.Join(dir, "missing.png")
+	if err := c.SaveImage(context.Background(), "/images/missing.png", missing); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("SaveImage() error = %v, want ErrNotFound", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only fox.png", len(entries))
+	}
+}
@@ -0,0 +1,7 @@
+// Package weavepb contains the Go types and gRPC stubs for the weave gRPC
+// API defined in proto/weave/v1/weave.proto. The gRPC API is served by the
+// weave-grpc gateway (cmd/weave-grpc).
+//
+// The files *.pb.go are generated; run "buf generate" in the backend
+// directory after changing the .proto file.
+package weavepb
@@ -0,0 +1,799 @@
+// Weave gRPC API.
+//
+// The service mirrors the weave HTTP API and is served by the weave-grpc
+// gateway, which forwards calls to a weave server. Calls are tied to a weave
+// session through the "weave-session" metadata key: the gateway returns it
+// in the response headers of the first call, and later calls send it to stay
+// in the same session. Servers started with --api-token or --users-file
+// also require an "authorization: Bearer <token>" metadata entry.
+//
+// A session has a single event stream, so a session runs one call at a
+// time. A call made while another is running in the same session, including
+// an open StreamEvents, fails with ABORTED.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: weave/v1/weave.proto
+
+package weavepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Settings are the generation settings of a request or a reply.
+type Settings struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Steps int32                  `protobuf:"varint,1,opt,name=steps,proto3" json:"steps,omitempty"`
+	Cfg   float64                `protobuf:"fixed64,2,opt,name=cfg,proto3" json:"cfg,omitempty"`
+	// seed is -1 for a random seed
+	Seed          int64 `protobuf:"varint,3,opt,name=seed,proto3" json:"seed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Settings) Reset() {
+	*x = Settings{}
+	mi := &file_weave_v1_weave_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Settings) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Settings) ProtoMessage() {}
+
+func (x *Settings) ProtoReflect() protoreflect.Message {
+	mi := &file_weave_v1_weave_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Settings.ProtoReflect.Descriptor instead.
+func (*Settings) Descriptor() ([]byte, []int) {
+	return file_weave_v1_weave_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Settings) GetSteps() int32 {
+	if x != nil {
+		return x.Steps
+	}
+	return 0
+}
+
+func (x *Settings) GetCfg() float64 {
+	if x != nil {
+		return x.Cfg
+	}
+	return 0
+}
+
+func (x *Settings) GetSeed() int64 {
+	if x != nil {
+		return x.Seed
+	}
+	return 0
+}
+
+type ChatRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Message string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	// settings used if the agent generates an image; unset for the server
+	// defaults
+	Settings *Settings `protobuf:"bytes,2,opt,name=settings,proto3" json:"settings,omitempty"`
+	// include_image returns the generated image's bytes in the reply
+	IncludeImage  bool `protobuf:"varint,3,opt,name=include_image,json=includeImage,proto3" json:"include_image,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChatRequest) Reset() {
+	*x = ChatRequest{}
+	mi := &file_weave_v1_weave_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChatRequest) ProtoMessage() {}
+
+func (x *ChatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_weave_v1_weave_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChatRequest.ProtoReflect.Descriptor instead.
+func (*ChatRequest) Descriptor() ([]byte, []int) {
+	return file_weave_v1_weave_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ChatRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ChatRequest) GetSettings() *Settings {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+func (x *ChatRequest) GetIncludeImage() bool {
+	if x != nil {
+		return x.IncludeImage
+	}
+	return false
+}
+
+type ChatResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Response:
+	//
+	//	*ChatResponse_Token
+	//	*ChatResponse_Retry
+	//	*ChatResponse_Reply
+	Response      isChatResponse_Response `protobuf_oneof:"response"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChatResponse) Reset() {
+	*x = ChatResponse{}
+	mi := &file_weave_v1_weave_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChatResponse) ProtoMessage() {}
+
+func (x *ChatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_weave_v1_weave_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChatResponse.ProtoReflect.Descriptor instead.
+func (*ChatResponse) Descriptor() ([]byte, []int) {
+	return file_weave_v1_weave_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ChatResponse) GetResponse() isChatResponse_Response {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+func (x *ChatResponse) GetToken() string {
+	if x != nil {
+		if x, ok := x.Response.(*ChatResponse_Token); ok {
+			return x.Token
+		}
+	}
+	return ""
+}
+
+func (x *ChatResponse) GetRetry() bool {
+	if x != nil {
+		if x, ok := x.Response.(*ChatResponse_Retry); ok {
+			return x.Retry
+		}
+	}
+	return false
+}
+
+func (x *ChatResponse) GetReply() *ChatReply {
+	if x != nil {
+		if x, ok := x.Response.(*ChatResponse_Reply); ok {
+			return x.Reply
+		}
+	}
+	return nil
+}
+
+type isChatResponse_Response interface {
+	isChatResponse_Response()
+}
+
+type ChatResponse_Token struct {
+	// token is the next piece of the agent's response
+	Token string `protobuf:"bytes,1,opt,name=token,proto3,oneof"`
+}
+
+type ChatResponse_Retry struct {
+	// retry means the agent's response starts over; discard the tokens
+	// received so far
+	Retry bool `protobuf:"varint,2,opt,name=retry,proto3,oneof"`
+}
+
+type ChatResponse_Reply struct {
+	Reply *ChatReply `protobuf:"bytes,3,opt,name=reply,proto3,oneof"`
+}
+
+func (*ChatResponse_Token) isChatResponse_Response() {}
+
+func (*ChatResponse_Retry) isChatResponse_Response() {}
+
+func (*ChatResponse_Reply) isChatResponse_Response() {}
+
+// ChatReply is the agent's completed response.
+type ChatReply struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// message_id identifies the assistant message in the chat history
+	MessageId int32  `protobuf:"varint,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Text      string `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	// prompt is the new image prompt, if the agent changed it
+	Prompt string `protobuf:"bytes,3,opt,name=prompt,proto3" json:"prompt,omitempty"`
+	// settings chosen by the agent, if any
+	Settings *Settings `protobuf:"bytes,4,opt,name=settings,proto3" json:"settings,omitempty"`
+	// image generated for the reply, if the agent asked for one and
+	// generation succeeded
+	Image         *Image `protobuf:"bytes,5,opt,name=image,proto3" json:"image,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChatReply) Reset() {
+	*x = ChatReply{}
+	mi := &file_weave_v1_weave_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChatReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChatReply) ProtoMessage() {}
+
+func (x *ChatReply) ProtoReflect() protoreflect.Message {
+	mi := &file_weave_v1_weave_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChatReply.ProtoReflect.Descriptor instead.
+func (*ChatReply) Descriptor() ([]byte, []int) {
+	return file_weave_v1_weave_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ChatReply) GetMessageId() int32 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *ChatReply) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *ChatReply) GetPrompt() string {
+	if x != nil {
+		return x.Prompt
+	}
+	return ""
+}
+
+func (x *ChatReply) GetSettings() *Settings {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+func (x *ChatReply) GetImage() *Image {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+type GenerateRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// prompt to generate; empty uses the chat's current prompt
+	Prompt string `protobuf:"bytes,1,opt,name=prompt,proto3" json:"prompt,omitempty"`
+	// message_id attaches the image to an assistant message (0 for none)
+	MessageId int32 `protobuf:"varint,2,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	// settings for the generation; unset for the server defaults
+	Settings *Settings `protobuf:"bytes,3,opt,name=settings,proto3" json:"settings,omitempty"`
+	// include_image returns the image's bytes along with its URL
+	IncludeImage  bool `protobuf:"varint,4,opt,name=include_image,json=includeImage,proto3" json:"include_image,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GenerateRequest) Reset() {
+	*x = GenerateRequest{}
+	mi := &file_weave_v1_weave_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GenerateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GenerateRequest) ProtoMessage() {}
+
+func (x *GenerateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_weave_v1_weave_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GenerateRequest.ProtoReflect.Descriptor instead.
+func (*GenerateRequest) Descriptor() ([]byte, []int) {
+	return file_weave_v1_weave_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GenerateRequest) GetPrompt() string {
+	if x != nil {
+		return x.Prompt
+	}
+	return ""
+}
+
+func (x *GenerateRequest) GetMessageId() int32 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *GenerateRequest) GetSettings() *Settings {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+func (x *GenerateRequest) GetIncludeImage() bool {
+	if x != nil {
+		return x.IncludeImage
+	}
+	return false
+}
+
+type GenerateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Image         *Image                 `protobuf:"bytes,1,opt,name=image,proto3" json:"image,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GenerateResponse) Reset() {
+	*x = GenerateResponse{}
+	mi := &file_weave_v1_weave_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GenerateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GenerateResponse) ProtoMessage() {}
+
+func (x *GenerateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_weave_v1_weave_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GenerateResponse.ProtoReflect.Descriptor instead.
+func (*GenerateResponse) Descriptor() ([]byte, []int) {
+	return file_weave_v1_weave_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GenerateResponse) GetImage() *Image {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+type Image struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// url of the image on the weave server, relative to its base URL
+	Url       string `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	Width     int32  `protobuf:"varint,2,opt,name=width,proto3" json:"width,omitempty"`
+	Height    int32  `protobuf:"varint,3,opt,name=height,proto3" json:"height,omitempty"`
+	MessageId int32  `protobuf:"varint,4,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	// data is the PNG image, if include_image was set
+	Data          []byte `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Image) Reset() {
+	*x = Image{}
+	mi := &file_weave_v1_weave_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Image) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Image) ProtoMessage() {}
+
+func (x *Image) ProtoReflect() protoreflect.Message {
+	mi := &file_weave_v1_weave_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Image.ProtoReflect.Descriptor instead.
+func (*Image) Descriptor() ([]byte, []int) {
+	return file_weave_v1_weave_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Image) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Image) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *Image) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *Image) GetMessageId() int32 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *Image) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type StreamEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventsRequest) Reset() {
+	*x = StreamEventsRequest{}
+	mi := &file_weave_v1_weave_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventsRequest) ProtoMessage() {}
+
+func (x *StreamEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_weave_v1_weave_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamEventsRequest) Descriptor() ([]byte, []int) {
+	return file_weave_v1_weave_proto_rawDescGZIP(), []int{7}
+}
+
+type StreamEventsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Event         *Event                 `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventsResponse) Reset() {
+	*x = StreamEventsResponse{}
+	mi := &file_weave_v1_weave_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventsResponse) ProtoMessage() {}
+
+func (x *StreamEventsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_weave_v1_weave_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventsResponse.ProtoReflect.Descriptor instead.
+func (*StreamEventsResponse) Descriptor() ([]byte, []int) {
+	return file_weave_v1_weave_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *StreamEventsResponse) GetEvent() *Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+// Event is one event of the session's event stream. See the weave API
+// documentation at /api/docs for the event types and their data.
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Type  string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	// data is the event's JSON data
+	Data          string `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_weave_v1_weave_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_weave_v1_weave_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_weave_v1_weave_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
+var File_weave_v1_weave_proto protoreflect.FileDescriptor
+
+const file_weave_v1_weave_proto_rawDesc = "" +
+	"\n" +
+	"\x14weave/v1/weave.proto\x12\bweave.v1\"F\n" +
+	"\bSettings\x12\x14\n" +
+	"\x05steps\x18\x01 \x01(\x05R\x05steps\x12\x10\n" +
+	"\x03cfg\x18\x02 \x01(\x01R\x03cfg\x12\x12\n" +
+	"\x04seed\x18\x03 \x01(\x03R\x04seed\"|\n" +
+	"\vChatRequest\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12.\n" +
+	"\bsettings\x18\x02 \x01(\v2\x12.weave.v1.SettingsR\bsettings\x12#\n" +
+	"\rinclude_image\x18\x03 \x01(\bR\fincludeImage\"w\n" +
+	"\fChatResponse\x12\x16\n" +
+	"\x05token\x18\x01 \x01(\tH\x00R\x05token\x12\x16\n" +
+	"\x05retry\x18\x02 \x01(\bH\x00R\x05retry\x12+\n" +
+	"\x05reply\x18\x03 \x01(\v2\x13.weave.v1.ChatReplyH\x00R\x05replyB\n" +
+	"\n" +
+	"\bresponse\"\xad\x01\n" +
+	"\tChatReply\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\x05R\tmessageId\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\x12\x16\n" +
+	"\x06prompt\x18\x03 \x01(\tR\x06prompt\x12.\n" +
+	"\bsettings\x18\x04 \x01(\v2\x12.weave.v1.SettingsR\bsettings\x12%\n" +
+	"\x05image\x18\x05 \x01(\v2\x0f.weave.v1.ImageR\x05image\"\x9d\x01\n" +
+	"\x0fGenerateRequest\x12\x16\n" +
+	"\x06prompt\x18\x01 \x01(\tR\x06prompt\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x02 \x01(\x05R\tmessageId\x12.\n" +
+	"\bsettings\x18\x03 \x01(\v2\x12.weave.v1.SettingsR\bsettings\x12#\n" +
+	"\rinclude_image\x18\x04 \x01(\bR\fincludeImage\"9\n" +
+	"\x10GenerateResponse\x12%\n" +
+	"\x05image\x18\x01 \x01(\v2\x0f.weave.v1.ImageR\x05image\"z\n" +
+	"\x05Image\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x14\n" +
+	"\x05width\x18\x02 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x03 \x01(\x05R\x06height\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x04 \x01(\x05R\tmessageId\x12\x12\n" +
+	"\x04data\x18\x05 \x01(\fR\x04data\"\x15\n" +
+	"\x13StreamEventsRequest\"=\n" +
+	"\x14StreamEventsResponse\x12%\n" +
+	"\x05event\x18\x01 \x01(\v2\x0f.weave.v1.EventR\x05event\"/\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\tR\x04data2\xdb\x01\n" +
+	"\fWeaveService\x127\n" +
+	"\x04Chat\x12\x15.weave.v1.ChatRequest\x1a\x16.weave.v1.ChatResponse0\x01\x12A\n" +
+	"\bGenerate\x12\x19.weave.v1.GenerateRequest\x1a\x1a.weave.v1.GenerateResponse\x12O\n" +
+	"\fStreamEvents\x12\x1d.weave.v1.StreamEventsRequest\x1a\x1e.weave.v1.StreamEventsResponse0\x01B+Z)github.com/hurricanerix/weave/pkg/weavepbb\x06proto3"
+
+var (
+	file_weave_v1_weave_proto_rawDescOnce sync.Once
+	file_weave_v1_weave_proto_rawDescData []byte
+)
+
+func file_weave_v1_weave_proto_rawDescGZIP() []byte {
+	file_weave_v1_weave_proto_rawDescOnce.Do(func() {
+		file_weave_v1_weave_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_weave_v1_weave_proto_rawDesc), len(file_weave_v1_weave_proto_rawDesc)))
+	})
+	return file_weave_v1_weave_proto_rawDescData
+}
+
+var file_weave_v1_weave_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_weave_v1_weave_proto_goTypes = []any{
+	(*Settings)(nil),             // 0: weave.v1.Settings
+	(*ChatRequest)(nil),          // 1: weave.v1.ChatRequest
+	(*ChatResponse)(nil),         // 2: weave.v1.ChatResponse
+	(*ChatReply)(nil),            // 3: weave.v1.ChatReply
+	(*GenerateRequest)(nil),      // 4: weave.v1.GenerateRequest
+	(*GenerateResponse)(nil),     // 5: weave.v1.GenerateResponse
+	(*Image)(nil),                // 6: weave.v1.Image
+	(*StreamEventsRequest)(nil),  // 7: weave.v1.StreamEventsRequest
+	(*StreamEventsResponse)(nil), // 8: weave.v1.StreamEventsResponse
+	(*Event)(nil),                // 9: weave.v1.Event
+}
+var file_weave_v1_weave_proto_depIdxs = []int32{
+	0,  // 0: weave.v1.ChatRequest.settings:type_name -> weave.v1.Settings
+	3,  // 1: weave.v1.ChatResponse.reply:type_name -> weave.v1.ChatReply
+	0,  // 2: weave.v1.ChatReply.settings:type_name -> weave.v1.Settings
+	6,  // 3: weave.v1.ChatReply.image:type_name -> weave.v1.Image
+	0,  // 4: weave.v1.GenerateRequest.settings:type_name -> weave.v1.Settings
+	6,  // 5: weave.v1.GenerateResponse.image:type_name -> weave.v1.Image
+	9,  // 6: weave.v1.StreamEventsResponse.event:type_name -> weave.v1.Event
+	1,  // 7: weave.v1.WeaveService.Chat:input_type -> weave.v1.ChatRequest
+	4,  // 8: weave.v1.WeaveService.Generate:input_type -> weave.v1.GenerateRequest
+	7,  // 9: weave.v1.WeaveService.StreamEvents:input_type -> weave.v1.StreamEventsRequest
+	2,  // 10: weave.v1.WeaveService.Chat:output_type -> weave.v1.ChatResponse
+	5,  // 11: weave.v1.WeaveService.Generate:output_type -> weave.v1.GenerateResponse
+	8,  // 12: weave.v1.WeaveService.StreamEvents:output_type -> weave.v1.StreamEventsResponse
+	10, // [10:13] is the sub-list for method output_type
+	7,  // [7:10] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_weave_v1_weave_proto_init() }
+func file_weave_v1_weave_proto_init() {
+	if File_weave_v1_weave_proto != nil {
+		return
+	}
+	file_weave_v1_weave_proto_msgTypes[2].OneofWrappers = []any{
+		(*ChatResponse_Token)(nil),
+		(*ChatResponse_Retry)(nil),
+		(*ChatResponse_Reply)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_weave_v1_weave_proto_rawDesc), len(file_weave_v1_weave_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_weave_v1_weave_proto_goTypes,
+		DependencyIndexes: file_weave_v1_weave_proto_depIdxs,
+		MessageInfos:      file_weave_v1_weave_proto_msgTypes,
+	}.Build()
+	File_weave_v1_weave_proto = out.File
+	file_weave_v1_weave_proto_goTypes = nil
+	file_weave_v1_weave_proto_depIdxs = nil
+}
@@ -0,0 +1,231 @@
+// Weave gRPC API.
+//
+// The service mirrors the weave HTTP API and is served by the weave-grpc
+// gateway, which forwards calls to a weave server. Calls are tied to a weave
+// session through the "weave-session" metadata key: the gateway returns it
+// in the response headers of the first call, and later calls send it to stay
+// in the same session. Servers started with --api-token or --users-file
+// also require an "authorization: Bearer <token>" metadata entry.
+//
+// A session has a single event stream, so a session runs one call at a
+// time. A call made while another is running in the same session, including
+// an open StreamEvents, fails with ABORTED.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: weave/v1/weave.proto
+
+package weavepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	WeaveService_Chat_FullMethodName         = "/weave.v1.WeaveService/Chat"
+	WeaveService_Generate_FullMethodName     = "/weave.v1.WeaveService/Generate"
+	WeaveService_StreamEvents_FullMethodName = "/weave.v1.WeaveService/StreamEvents"
+)
+
+// WeaveServiceClient is the client API for WeaveService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type WeaveServiceClient interface {
+	// Chat sends a message to the agent in the session's active chat. The
+	// response is streamed as tokens and ends with the reply. If the agent
+	// generates an image, the reply is sent once the generation has finished.
+	Chat(ctx context.Context, in *ChatRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ChatResponse], error)
+	// Generate generates an image in the session's active chat and returns it
+	// once it is ready.
+	Generate(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (*GenerateResponse, error)
+	// StreamEvents forwards the session's events until the call is cancelled
+	// or the weave server closes the stream.
+	StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamEventsResponse], error)
+}
+
+type weaveServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWeaveServiceClient(cc grpc.ClientConnInterface) WeaveServiceClient {
+	return &weaveServiceClient{cc}
+}
+
+func (c *weaveServiceClient) Chat(ctx context.Context, in *ChatRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ChatResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WeaveService_ServiceDesc.Streams[0], WeaveService_Chat_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ChatRequest, ChatResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WeaveService_ChatClient = grpc.ServerStreamingClient[ChatResponse]
+
+func (c *weaveServiceClient) Generate(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (*GenerateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GenerateResponse)
+	err := c.cc.Invoke(ctx, WeaveService_Generate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *weaveServiceClient) StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamEventsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WeaveService_ServiceDesc.Streams[1], WeaveService_StreamEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamEventsRequest, StreamEventsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WeaveService_StreamEventsClient = grpc.ServerStreamingClient[StreamEventsResponse]
+
+// WeaveServiceServer is the server API for WeaveService service.
+// All implementations must embed UnimplementedWeaveServiceServer
+// for forward compatibility.
+type WeaveServiceServer interface {
+	// Chat sends a message to the agent in the session's active chat. The
+	// response is streamed as tokens and ends with the reply. If the agent
+	// generates an image, the reply is sent once the generation has finished.
+	Chat(*ChatRequest, grpc.ServerStreamingServer[ChatResponse]) error
+	// Generate generates an image in the session's active chat and returns it
+	// once it is ready.
+	Generate(context.Context, *GenerateRequest) (*GenerateResponse, error)
+	// StreamEvents forwards the session's events until the call is cancelled
+	// or the weave server closes the stream.
+	StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[StreamEventsResponse]) error
+	mustEmbedUnimplementedWeaveServiceServer()
+}
+
+// UnimplementedWeaveServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedWeaveServiceServer struct{}
+
+func (UnimplementedWeaveServiceServer) Chat(*ChatRequest, grpc.ServerStreamingServer[ChatResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Chat not implemented")
+}
+func (UnimplementedWeaveServiceServer) Generate(context.Context, *GenerateRequest) (*GenerateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Generate not implemented")
+}
+func (UnimplementedWeaveServiceServer) StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[StreamEventsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedWeaveServiceServer) mustEmbedUnimplementedWeaveServiceServer() {}
+func (UnimplementedWeaveServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeWeaveServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WeaveServiceServer will
+// result in compilation errors.
+type UnsafeWeaveServiceServer interface {
+	mustEmbedUnimplementedWeaveServiceServer()
+}
+
+func RegisterWeaveServiceServer(s grpc.ServiceRegistrar, srv WeaveServiceServer) {
+	// If the following call pancis, it indicates UnimplementedWeaveServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&WeaveService_ServiceDesc, srv)
+}
+
+func _WeaveService_Chat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ChatRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WeaveServiceServer).Chat(m, &grpc.GenericServerStream[ChatRequest, ChatResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WeaveService_ChatServer = grpc.ServerStreamingServer[ChatResponse]
+
+func _WeaveService_Generate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GenerateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WeaveServiceServer).Generate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WeaveService_Generate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WeaveServiceServer).Generate(ctx, req.(*GenerateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WeaveService_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WeaveServiceServer).StreamEvents(m, &grpc.GenericServerStream[StreamEventsRequest, StreamEventsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WeaveService_StreamEventsServer = grpc.ServerStreamingServer[StreamEventsResponse]
+
+// WeaveService_ServiceDesc is the grpc.ServiceDesc for WeaveService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WeaveService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "weave.v1.WeaveService",
+	HandlerType: (*WeaveServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Generate",
+			Handler:    _WeaveService_Generate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Chat",
+			Handler:       _WeaveService_Chat_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _WeaveService_StreamEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "weave/v1/weave.proto",
+}
@@ -28,7 +28,7 @@
  * AFL mode - Read input from stdin
  */
 int main(void) {
-    uint8_t buffer[MAX_MESSAGE_SIZE];
+    static uint8_t buffer[MAX_MESSAGE_SIZE];
     size_t len = fread(buffer, 1, sizeof(buffer), stdin);
 
     sd35_generate_request_t req;
@@ -15,22 +15,70 @@
 #pragma once
 
 #include <stdint.h>
+#include "weave/models.h"
 #include "weave/protocol.h"
 #include "weave/sd_wrapper.h"
 
+/**
+ * Receives preview frames of generations in progress; see
+ * set_preview_handler(). frame and its image data are valid only during
+ * the call.
+ */
+typedef void (*preview_handler_fn)(const preview_frame_t *frame, void *data);
+
+/** Sampling steps between preview frames */
+#define PREVIEW_INTERVAL_STEPS 4
+
+/**
+ * Send preview frames of the generations run by process_generate_request(),
+ * process_img2img_request(), process_inpaint_request() and
+ * process_control_request() to fn, every
+ * PREVIEW_INTERVAL_STEPS sampling steps. Frames larger than
+ * PREVIEW_MAX_DIMENSION are dropped.
+ *
+ * @param fn    Handler for preview frames (NULL disables previews)
+ * @param data  Passed to fn
+ */
+void set_preview_handler(preview_handler_fn fn, void *data);
+
+/**
+ * Record which model ctx was created with, so generations for other models
+ * know to replace it. Call after sd_wrapper_create().
+ *
+ * @param model_id  ID of the loaded model (MODEL_ID_NONE if none)
+ */
+void set_loaded_model(uint32_t model_id);
+
+/**
+ * Get the ID of the model generations currently run with.
+ *
+ * @return  Model ID, or MODEL_ID_NONE if no model is loaded
+ */
+uint32_t loaded_model(void);
+
 /**
  * Process a generation request and produce a response.
  *
  * This function orchestrates the complete generation pipeline:
  * 1. Validates protocol request parameters
  * 2. Converts protocol parameters to SD wrapper format
- * 3. Calls SD wrapper to generate image
- * 4. Builds protocol response with image data
- * 5. Maps errors to appropriate status codes
+ * 3. Loads the request's model if another one is loaded
+ * 4. Calls SD wrapper to generate image
+ * 5. Builds protocol response with image data
+ * 6. Maps errors to appropriate status codes
+ *
+ * Only one model is kept in VRAM: switching models unloads the current
+ * one first. If the requested model fails to load, the previous one is
+ * loaded again.
  *
  * Error mapping:
  * - Invalid dimensions/steps/cfg → STATUS_BAD_REQUEST (400)
  * - Invalid prompt → STATUS_BAD_REQUEST (400)
+ * - Unknown model ID → ERR_INVALID_MODEL_ID (400)
+ * - LoRA not installed in the LoRA directory → ERR_INVALID_LORA (400)
+ * - No installed ControlNet of the type for the model →
+ *   ERR_CONTROLNET_UNAVAILABLE (500)
+ * - Model not installed or failed to load → ERR_MODEL_UNAVAILABLE (500)
  * - Model not loaded → STATUS_INTERNAL_SERVER_ERROR (500)
  * - GPU/OOM errors → STATUS_INTERNAL_SERVER_ERROR (500)
  *
@@ -49,7 +97,89 @@ error_code_t process_generate_request(sd_wrapper_ctx_t *ctx,
                                        sd35_generate_response_t *resp);
 
 /**
- * Free response image data allocated by process_generate_request().
+ * Process an img2img request and produce a response.
+ *
+ * As process_generate_request(), but the diffusion starts from the request's
+ * init image instead of noise. The strength sets how much of it is redrawn:
+ * near 0 keeps it almost unchanged, 1 ignores it.
+ *
+ * @param ctx   SD wrapper context (must not be NULL, must be initialized)
+ * @param req   Decoded protocol request (borrowed, not modified)
+ * @param resp  Output response structure (populated on success)
+ * @return      ERR_NONE on success, error code on failure
+ *
+ * @note On success, resp->image_data is allocated and must be freed by caller
+ * @note req->prompt_data and req->init_data must remain valid during this call
+ */
+error_code_t process_img2img_request(sd_wrapper_ctx_t *ctx,
+                                      const sd35_img2img_request_t *req,
+                                      sd35_generate_response_t *resp);
+
+/**
+ * Process an inpaint request and produce a response.
+ *
+ * As process_img2img_request(), but only the pixels set in the request's
+ * mask are redrawn; the rest of the init image is kept.
+ *
+ * @param ctx   SD wrapper context (must not be NULL, must be initialized)
+ * @param req   Decoded protocol request (borrowed, not modified)
+ * @param resp  Output response structure (populated on success)
+ * @return      ERR_NONE on success, error code on failure
+ *
+ * @note On success, resp->image_data is allocated and must be freed by caller
+ * @note The request's prompt, init and mask data must remain valid during
+ *       this call
+ */
+error_code_t process_inpaint_request(sd_wrapper_ctx_t *ctx,
+                                     const sd35_inpaint_request_t *req,
+                                     sd35_generate_response_t *resp);
+
+/**
+ * Process a control request and produce a response.
+ *
+ * As process_generate_request(), but the model's ControlNet of the
+ * request's control type guides the composition with the control image,
+ * how closely set by its control strength. The ControlNet is loaded with
+ * the model, so changing control type reloads the model.
+ *
+ * @param ctx   SD wrapper context (must not be NULL, must be initialized)
+ * @param req   Decoded protocol request (borrowed, not modified)
+ * @param resp  Output response structure (populated on success)
+ * @return      ERR_NONE on success, error code on failure
+ *
+ * @note On success, resp->image_data is allocated and must be freed by caller
+ * @note req->prompt_data and req->control_data must remain valid during
+ *       this call
+ */
+error_code_t process_control_request(sd_wrapper_ctx_t *ctx,
+                                     const sd35_control_request_t *req,
+                                     sd35_generate_response_t *resp);
+
+/**
+ * Process an upscale request and produce a response.
+ *
+ * Enlarges the request's image to its target size with the ESRGAN upscaler.
+ * Nothing is regenerated, so the SD context is not reset.
+ *
+ * Error mapping: as process_generate_request(), except that a missing or
+ * unloadable upscaler model is ERR_UPSCALER_UNAVAILABLE.
+ *
+ * @param ctx   SD wrapper context (must not be NULL, must be initialized)
+ * @param req   Decoded protocol request (borrowed, not modified)
+ * @param resp  Output response structure (populated on success)
+ * @return      ERR_NONE on success, error code on failure
+ *
+ * @note On success, resp->image_data is allocated and must be freed by caller
+ * @note req->image_data must remain valid during this call
+ */
+error_code_t process_upscale_request(sd_wrapper_ctx_t *ctx,
+                                     const upscale_request_t *req,
+                                     sd35_generate_response_t *resp);
+
+/**
+ * Free response image data allocated by process_generate_request(),
+ * process_img2img_request(), process_inpaint_request(),
+ * process_control_request() or process_upscale_request().
  *
  * This is a convenience wrapper around sd_wrapper_free_image().
  * Safe to call with NULL or already-freed image data.
@@ -0,0 +1,134 @@
+/**
+ * Weave Compute - Model Registry
+ *
+ * The checkpoint models compute can generate with, where their files live
+ * and roughly how much VRAM each takes. One model is loaded at a time; a
+ * request for another model replaces it (see generate.h).
+ */
+
+#pragma once
+
+#include <stdbool.h>
+#include <stddef.h>
+#include <stdint.h>
+#include "weave/protocol.h"
+#include "weave/sd_wrapper.h"
+
+/** Model ID meaning no model is loaded */
+#define MODEL_ID_NONE 0xFFFFFFFFu
+
+/** Control type meaning no ControlNet is loaded */
+#define CONTROL_TYPE_NONE 0xFFFFFFFFu
+
+/**
+ * Model Entry
+ *
+ * Paths are relative to the working directory; NULL paths are not used by
+ * the model.
+ */
+typedef struct {
+    uint32_t model_id;                /**< Model identifier (MODEL_ID_*) */
+    const char *name;                 /**< Name reported in models responses */
+    const char *model_path;           /**< Full checkpoint (NULL if split) */
+    const char *diffusion_model_path; /**< Standalone diffusion model (NULL if in the checkpoint) */
+    const char *clip_l_path;          /**< CLIP-L encoder */
+    const char *clip_g_path;          /**< CLIP-G encoder */
+    const char *t5xxl_path;           /**< T5-XXL encoder */
+    const char *vae_path;             /**< VAE */
+    uint32_t vram_mb;                 /**< Approximate VRAM in use when loaded (MB) */
+    const char *control_net_paths[CONTROL_TYPE_COUNT]; /**< ControlNet per CONTROL_TYPE_* (NULL if none fits the model) */
+} model_entry_t;
+
+/**
+ * Look up a model by ID.
+ *
+ * @param model_id  Model identifier
+ * @return          Model entry, or NULL if model_id is unknown
+ */
+const model_entry_t *model_lookup(uint32_t model_id);
+
+/**
+ * Check whether all files of a model are installed and readable.
+ *
+ * @param entry  Model entry (NULL returns false)
+ * @return       true if the model can be loaded
+ */
+bool model_available(const model_entry_t *entry);
+
+/**
+ * Get the ControlNet a model generates with for a control type.
+ *
+ * ControlNets are trained for one model architecture, so each model has
+ * its own; a model without one for the type cannot take control requests
+ * of it.
+ *
+ * @param entry         Model entry (NULL returns NULL)
+ * @param control_type  Control type (CONTROL_TYPE_*)
+ * @return              Path of the ControlNet, or NULL if the model has
+ *                      none for control_type or it is not installed
+ */
+const char *model_control_net(const model_entry_t *entry, uint32_t control_type);
+
+/**
+ * Set the directory LoRAs are loaded from, for configurations filled by
+ * model_config() from then on. dir must stay valid while in use.
+ *
+ * @param dir  LoRA directory (NULL disables LoRAs)
+ */
+void model_set_lora_dir(const char *dir);
+
+/**
+ * Check whether a LoRA is installed: a readable file named name with a
+ * .safetensors, .ckpt or .gguf extension in the LoRA directory.
+ *
+ * @param name  LoRA name, as validated by the protocol decoder
+ * @return      true if the LoRA can be loaded; false if it is missing or
+ *              no LoRA directory is set
+ */
+bool lora_available(const char *name);
+
+/**
+ * Fill an SD wrapper configuration for loading a model.
+ *
+ * The configuration has the model's paths, the upscaler, the LoRA
+ * directory, and the offloading weave-compute uses for every model. No
+ * ControlNet is set; see model_control_net().
+ *
+ * @param entry   Model entry (must not be NULL)
+ * @param config  Output configuration
+ */
+void model_config(const model_entry_t *entry, sd_wrapper_config_t *config);
+
+/** Length of a model hash in hex digits, null terminator not included */
+#define MODEL_HASH_LENGTH 8
+
+/** Where in the weights file the bytes a model hash covers start, and how many */
+#define MODEL_HASH_OFFSET 0x100000
+#define MODEL_HASH_CHUNK 0x10000
+
+/**
+ * Hash a model's weights for generation metadata.
+ *
+ * The hash is the short "model hash" the AUTOMATIC1111 web UI reports: the
+ * first MODEL_HASH_LENGTH hex digits of the SHA-256 of MODEL_HASH_CHUNK
+ * bytes at MODEL_HASH_OFFSET in the checkpoint, or in the standalone
+ * diffusion model of a split model. It reads 64 KiB rather than the
+ * whole multi-GB file, so it tells apart checkpoints and quantizations
+ * but not the text encoders or VAE loaded with them.
+ *
+ * @param entry  Model entry (NULL returns false)
+ * @param out    Output, MODEL_HASH_LENGTH + 1 bytes
+ * @return       true on success; false if the file cannot be read
+ */
+bool model_hash(const model_entry_t *entry, char *out);
+
+/**
+ * List all models with their status, for a models response.
+ *
+ * @param loaded_id  ID of the loaded model, reported as MODEL_STATUS_LOADED
+ *                   (MODEL_ID_NONE if none)
+ * @param out        Output array
+ * @param max        Size of out (MODEL_COUNT lists all models)
+ * @return           Number of entries written
+ */
+uint32_t model_list(uint32_t loaded_id, model_info_t *out, uint32_t max);
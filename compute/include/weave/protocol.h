@@ -17,6 +17,7 @@
 
 #pragma once
 
+#include <stdbool.h>
 #include <stdint.h>
 #include <stddef.h>
 
@@ -36,8 +37,8 @@
 /** Maximum supported protocol version */
 #define MAX_SUPPORTED_VERSION PROTOCOL_VERSION_1
 
-/** Maximum total message size: 10 MB */
-#define MAX_MESSAGE_SIZE (10 * 1024 * 1024)
+/** Maximum total message size: 20 MB (a 2048x2048 RGBA image is 16 MB) */
+#define MAX_MESSAGE_SIZE (20 * 1024 * 1024)
 
 /**
  * Model Identifiers
@@ -46,6 +47,18 @@
 /** Stable Diffusion 3.5 model ID */
 #define MODEL_ID_SD35 0x00000000
 
+/** Stable Diffusion XL model ID */
+#define MODEL_ID_SDXL 0x00000001
+
+/** Flux model ID */
+#define MODEL_ID_FLUX 0x00000002
+
+/** Number of model IDs; IDs run from 0 to MODEL_COUNT - 1 */
+#define MODEL_COUNT 3
+
+/** Maximum length of a model name in a models response (bytes) */
+#define MAX_MODEL_NAME_LENGTH 64
+
 /**
  * SD 3.5 Parameter Bounds
  */
@@ -59,6 +72,9 @@
 /** Required alignment for dimensions (must be multiple of 64) */
 #define SD35_DIMENSION_ALIGNMENT 64
 
+/** Maximum preview frame dimension (pixels) */
+#define PREVIEW_MAX_DIMENSION 256
+
 /** Minimum denoising steps */
 #define SD35_MIN_STEPS 1
 
@@ -90,12 +106,167 @@
 /** Maximum total prompt data size (3 encoders × 256 bytes) */
 #define SD35_MAX_PROMPT_DATA_SIZE (3 * SD35_MAX_PROMPT_LENGTH)
 
+/** Minimum img2img denoise strength (exclusive: 0 would return the init image) */
+#define SD35_MIN_STRENGTH 0.0f
+
+/** Maximum img2img denoise strength (1 ignores the init image) */
+#define SD35_MAX_STRENGTH 1.0f
+
+/**
+ * Upscale Parameter Bounds
+ */
+
+/** Maximum upscale factor per dimension (the ESRGAN model upscales 4x) */
+#define UPSCALE_MAX_FACTOR 4
+
+/**
+ * LoRA Bounds
+ */
+
+/**
+ * Header flag: the request carries a LoRA section after its fixed fields.
+ * Set in the header's reserved field of generate, img2img, inpaint and
+ * control requests; bits other than the HEADER_FLAG_* must be 0.
+ */
+#define HEADER_FLAG_LORAS 0x00000001
+
+/**
+ * Header flag: VAE-decode the image in tiles. Slower, but the decode of a
+ * large image then fits in little VRAM (1024x1024 on 8GB cards).
+ */
+#define HEADER_FLAG_VAE_TILING 0x00000002
+
+/**
+ * Header flag: image data may be returned in a shared memory segment.
+ * Set by weave in the header of image requests when compute accepts it.
+ * Set by compute in the header of a generate response whose image data is
+ * a segment name (see encode_generate_response) instead of the pixels.
+ */
+#define HEADER_FLAG_SHARED_MEMORY 0x00000004
+
+/**
+ * Header bits 3-4: the priority of the request (PRIORITY_*). Weave queues
+ * requests by priority before sending them; compute handles them in the
+ * order received and only validates the value.
+ */
+#define HEADER_PRIORITY_MASK 0x00000018
+#define HEADER_PRIORITY_SHIFT 3
+
+/** Request priorities */
+#define PRIORITY_NORMAL 0 /**< Not set by the client */
+#define PRIORITY_LOW 1    /**< Background work, such as agent autogeneration */
+#define PRIORITY_HIGH 2   /**< Explicitly asked for by the user */
+
+/**
+ * Header flag: report the seed the image was generated with. Set by weave
+ * in generate, img2img, inpaint and control requests when compute accepts
+ * it, so a random seed (0) can be reproduced. Set by compute in the header
+ * of a generate response that ends with the seed (see
+ * encode_generate_response).
+ */
+#define HEADER_FLAG_SEED 0x00000020
+
+/**
+ * Header flag: report how the image was generated (generation_metadata_t).
+ * Set by weave in generate, img2img, inpaint and control requests when
+ * compute accepts it. Set by compute in the header of a generate response
+ * that ends with the metadata (see encode_generate_response).
+ */
+#define HEADER_FLAG_METADATA 0x00000040
+
+/**
+ * Header flag: the response may be split into frames. Set by weave in the
+ * header of any request when compute accepts it. Set by compute in the
+ * header of every frame of a split response but the last; each frame
+ * repeats the header with payload_len the length of its part of the
+ * payload (see CHUNK_SIZE).
+ */
+#define HEADER_FLAG_CHUNKED 0x00000080
+
+/**
+ * Header flag: the payload ends with a CRC-32 (IEEE) of the rest of it,
+ * CHECKSUM_SIZE bytes big-endian, counted in payload_len. Set by weave in
+ * the header of requests when compute accepts it. Set by compute in the
+ * header of every frame it sends in response to such a request, previews
+ * and chunks included (see verify_checksum).
+ */
+#define HEADER_FLAG_CHECKSUM 0x00000100
+
+/** Header flags compute accepts, advertised in the hello response */
+#define HEADER_FLAGS_SUPPORTED \
+    (HEADER_FLAG_LORAS | HEADER_FLAG_VAE_TILING | HEADER_FLAG_SHARED_MEMORY | \
+     HEADER_PRIORITY_MASK | HEADER_FLAG_SEED | HEADER_FLAG_METADATA | \
+     HEADER_FLAG_CHUNKED | HEADER_FLAG_CHECKSUM)
+
+/** Size of the CRC-32 that ends a payload with HEADER_FLAG_CHECKSUM */
+#define CHECKSUM_SIZE 4
+
+/** Largest payload of one frame of a response split with HEADER_FLAG_CHUNKED */
+#define CHUNK_SIZE (1024 * 1024)
+
+/** Maximum length of a shared memory segment name, null terminator included */
+#define SHARED_MEMORY_NAME_MAX 64
+
+/** Maximum LoRAs applied to one generation */
+#define MAX_LORAS 4
+
+/**
+ * Maximum LoRA name length (bytes). Names are file names in the LoRA
+ * directory without extension: [A-Za-z0-9._-], not starting with '.'.
+ */
+#define MAX_LORA_NAME_LENGTH 64
+
+/** Minimum LoRA weight (negative weights invert the LoRA) */
+#define MIN_LORA_WEIGHT -2.0f
+
+/** Maximum LoRA weight */
+#define MAX_LORA_WEIGHT 2.0f
+
+/**
+ * ControlNet Conditioning
+ *
+ * A control request's conditioning image is already a control map of its
+ * type (an edge map, a depth map or a pose skeleton); compute does not
+ * derive one from a photo.
+ */
+
+/** Edge map, as from a Canny edge detector */
+#define CONTROL_TYPE_CANNY 0x00000000
+
+/** Depth map, near is bright */
+#define CONTROL_TYPE_DEPTH 0x00000001
+
+/** OpenPose skeleton */
+#define CONTROL_TYPE_POSE 0x00000002
+
+/** Number of control types (valid types are 0 to CONTROL_TYPE_COUNT - 1) */
+#define CONTROL_TYPE_COUNT 3
+
+/** Minimum control strength (exclusive: 0 would ignore the control image) */
+#define MIN_CONTROL_STRENGTH 0.0f
+
+/** Maximum control strength */
+#define MAX_CONTROL_STRENGTH 2.0f
+
 /**
  * Message Types
  */
 typedef enum {
     MSG_GENERATE_REQUEST  = 0x0001,  /**< Generation request */
     MSG_GENERATE_RESPONSE = 0x0002,  /**< Generation response (success) */
+    MSG_PING              = 0x0003,  /**< Liveness check */
+    MSG_PONG              = 0x0004,  /**< Liveness check response */
+    MSG_IMG2IMG_REQUEST   = 0x0005,  /**< Generation request from an init image */
+    MSG_INPAINT_REQUEST   = 0x0006,  /**< Img2img request limited to a mask */
+    MSG_UPSCALE_REQUEST   = 0x0007,  /**< Enlarge an image without regenerating it */
+    MSG_PREVIEW           = 0x0008,  /**< Low-resolution frame of a generation in progress */
+    MSG_MODELS_REQUEST    = 0x0009,  /**< List the models compute can load */
+    MSG_MODELS_RESPONSE   = 0x000A,  /**< Models list response */
+    MSG_CONTROL_REQUEST   = 0x000B,  /**< Generation request guided by a ControlNet */
+    MSG_CAPABILITIES_REQUEST  = 0x000C,  /**< Ask what compute supports */
+    MSG_CAPABILITIES_RESPONSE = 0x000D,  /**< Capabilities response */
+    MSG_HELLO_REQUEST         = 0x000E,  /**< Agree on a protocol version */
+    MSG_HELLO_RESPONSE        = 0x000F,  /**< Hello response */
     MSG_ERROR             = 0x00FF,  /**< Error response */
 } message_type_t;
 
@@ -117,9 +288,12 @@ typedef enum {
  * Error codes map to HTTP status codes:
  * - Client errors (400): ERR_INVALID_MAGIC, ERR_UNSUPPORTED_VERSION,
  *   ERR_INVALID_MODEL_ID, ERR_INVALID_PROMPT, ERR_INVALID_DIMENSIONS,
- *   ERR_INVALID_STEPS, ERR_INVALID_CFG
+ *   ERR_INVALID_STEPS, ERR_INVALID_CFG, ERR_INVALID_INIT_IMAGE,
+ *   ERR_INVALID_MASK, ERR_INVALID_LORA, ERR_INVALID_CONTROL,
+ *   ERR_CHECKSUM_MISMATCH
  * - Server errors (500): ERR_OUT_OF_MEMORY, ERR_GPU_ERROR,
- *   ERR_TIMEOUT, ERR_INTERNAL
+ *   ERR_TIMEOUT, ERR_UPSCALER_UNAVAILABLE, ERR_MODEL_UNAVAILABLE,
+ *   ERR_CONTROLNET_UNAVAILABLE, ERR_INTERNAL
  */
 typedef enum {
     ERR_NONE                = 0,   /**< No error */
@@ -133,6 +307,14 @@ typedef enum {
     ERR_OUT_OF_MEMORY       = 8,   /**< Out of memory (500) */
     ERR_GPU_ERROR           = 9,   /**< GPU error (500) */
     ERR_TIMEOUT             = 10,  /**< Operation timeout (500) */
+    ERR_INVALID_INIT_IMAGE  = 11,  /**< Invalid img2img init image or strength (400) */
+    ERR_INVALID_MASK        = 12,  /**< Invalid inpaint mask (400) */
+    ERR_UPSCALER_UNAVAILABLE = 13, /**< No upscaler model could be loaded (500) */
+    ERR_MODEL_UNAVAILABLE   = 14,  /**< Requested model is not installed or failed to load (500) */
+    ERR_INVALID_LORA        = 15,  /**< Invalid LoRA count, name or weight (400) */
+    ERR_INVALID_CONTROL     = 16,  /**< Invalid control type, strength or image (400) */
+    ERR_CONTROLNET_UNAVAILABLE = 17, /**< Model has no installed ControlNet of the type (500) */
+    ERR_CHECKSUM_MISMATCH   = 18,  /**< Payload does not match its CRC-32 (400) */
     ERR_INTERNAL            = 99,  /**< Internal error (500) */
 } error_code_t;
 
@@ -149,9 +331,19 @@ typedef struct {
     uint16_t version;      /**< Protocol version */
     uint16_t msg_type;     /**< Message type (message_type_t) */
     uint32_t payload_len;  /**< Length of data following header */
-    uint32_t reserved;     /**< Reserved (must be 0) */
+    uint32_t reserved;     /**< Flags (HEADER_FLAG_*), otherwise 0 */
 } protocol_header_t;
 
+/**
+ * LoRA
+ *
+ * A LoRA applied to a generation. The weight scales its effect.
+ */
+typedef struct {
+    char name[MAX_LORA_NAME_LENGTH + 1]; /**< File name without extension (NUL-terminated) */
+    float weight;                        /**< Weight (-2.0 to 2.0) */
+} lora_t;
+
 /**
  * SD 3.5 Generation Request
  *
@@ -160,7 +352,7 @@ typedef struct {
  *
  * Wire format payload structure (after common header):
  * - request_id: 8 bytes (uint64)
- * - model_id: 4 bytes (uint32, must be 0x00000000 for SD 3.5)
+ * - model_id: 4 bytes (uint32, MODEL_ID_SD35, MODEL_ID_SDXL or MODEL_ID_FLUX)
  * - width: 4 bytes (uint32)
  * - height: 4 bytes (uint32)
  * - steps: 4 bytes (uint32)
@@ -172,12 +364,16 @@ typedef struct {
  * - clip_g_length: 4 bytes (uint32)
  * - t5_offset: 4 bytes (uint32)
  * - t5_length: 4 bytes (uint32)
+ * - LoRA section, only if the header has HEADER_FLAG_LORAS:
+ *   - lora_count: 4 bytes (uint32, 0 to MAX_LORAS)
+ *   - per LoRA: weight (4 bytes, float32), name_len (4 bytes, uint32),
+ *     name (name_len bytes)
  * - prompt_data: variable bytes (UTF-8 encoded prompts)
  */
 typedef struct {
     /* Common request fields */
     uint64_t request_id;   /**< Unique request identifier (echoed in response) */
-    uint32_t model_id;     /**< Model identifier (must be MODEL_ID_SD35) */
+    uint32_t model_id;     /**< Model identifier (below MODEL_COUNT) */
 
     /* Generation parameters */
     uint32_t width;        /**< Image width (64-2048, multiple of 64) */
@@ -194,11 +390,160 @@ typedef struct {
     uint32_t t5_offset;     /**< Byte offset of T5 prompt in prompt_data */
     uint32_t t5_length;     /**< Length of T5 prompt (1-1024 bytes) */
 
+    /* LoRAs (copied out of the received buffer) */
+    lora_t loras[MAX_LORAS]; /**< LoRAs to apply, in request order */
+    uint32_t lora_count;     /**< Number of entries in loras */
+
+    bool vae_tiling;         /**< Decode in tiles (HEADER_FLAG_VAE_TILING) */
+    uint8_t priority;        /**< PRIORITY_* (HEADER_PRIORITY_MASK) */
+
     /* Prompt data (not owned by this struct, points into received buffer) */
     const uint8_t *prompt_data;  /**< Pointer to prompt data buffer */
     size_t prompt_data_len;      /**< Total size of prompt_data buffer */
 } sd35_generate_request_t;
 
+/**
+ * SD 3.5 Img2Img Request
+ *
+ * In-memory representation of a Stable Diffusion 3.5 image-to-image request:
+ * a generation request that starts from an init image instead of noise.
+ * This struct is NOT for wire format - use encoding/decoding functions.
+ *
+ * Wire format payload structure (after common header with
+ * msg_type = MSG_IMG2IMG_REQUEST):
+ * - request_id, model_id and SD 3.5 parameters: 60 bytes, as in
+ *   sd35_generate_request_t
+ * - strength: 4 bytes (float32, IEEE 754, 0.0 exclusive to 1.0)
+ * - init_channels: 4 bytes (uint32, 3 = RGB, 4 = RGBA)
+ * - init_data_len: 4 bytes (uint32, width * height * init_channels)
+ * - LoRA section: as in sd35_generate_request_t
+ * - prompt_data: variable bytes (UTF-8 encoded prompts)
+ * - init_data: init_data_len bytes (raw pixels, width x height)
+ */
+typedef struct {
+    sd35_generate_request_t base; /**< Prompt and generation parameters */
+
+    float strength;          /**< How much to change the init image (0.0-1.0) */
+    uint32_t init_channels;  /**< Init image channels (3 = RGB, 4 = RGBA) */
+    uint32_t init_data_len;  /**< Size of init_data in bytes */
+
+    /* Init image (not owned by this struct, points into received buffer) */
+    const uint8_t *init_data; /**< Raw pixels, base.width x base.height */
+} sd35_img2img_request_t;
+
+/**
+ * SD 3.5 Inpaint Request
+ *
+ * In-memory representation of a Stable Diffusion 3.5 inpaint request: an
+ * img2img request that only redraws where the mask is set. The mask has one
+ * byte per pixel; 255 redraws the pixel, 0 keeps it.
+ * This struct is NOT for wire format - use encoding/decoding functions.
+ *
+ * Wire format payload structure (after common header with
+ * msg_type = MSG_INPAINT_REQUEST):
+ * - request_id, model_id and SD 3.5 parameters: 60 bytes, as in
+ *   sd35_generate_request_t
+ * - strength, init_channels, init_data_len: 12 bytes, as in
+ *   sd35_img2img_request_t
+ * - mask_data_len: 4 bytes (uint32, width * height)
+ * - LoRA section: as in sd35_generate_request_t
+ * - prompt_data: variable bytes (UTF-8 encoded prompts)
+ * - init_data: init_data_len bytes (raw pixels, width x height)
+ * - mask_data: mask_data_len bytes (one byte per pixel, width x height)
+ */
+typedef struct {
+    sd35_img2img_request_t base; /**< Init image and generation parameters */
+
+    uint32_t mask_data_len;  /**< Size of mask_data in bytes */
+
+    /* Mask (not owned by this struct, points into received buffer) */
+    const uint8_t *mask_data; /**< One byte per pixel, base.base.width x base.base.height */
+} sd35_inpaint_request_t;
+
+/**
+ * SD 3.5 Control Request
+ *
+ * In-memory representation of a generation request guided by a ControlNet:
+ * the diffusion starts from noise, as for a generation request, and follows
+ * the composition of the control image. The control image is a control map
+ * of control_type at the generation size.
+ * This struct is NOT for wire format - use encoding/decoding functions.
+ *
+ * Wire format payload structure (after common header with
+ * msg_type = MSG_CONTROL_REQUEST):
+ * - request_id, model_id and SD 3.5 parameters: 60 bytes, as in
+ *   sd35_generate_request_t
+ * - control_type: 4 bytes (uint32, CONTROL_TYPE_*)
+ * - control_strength: 4 bytes (float32, IEEE 754, 0.0 exclusive to 2.0)
+ * - control_channels: 4 bytes (uint32, 3 = RGB, 4 = RGBA)
+ * - control_data_len: 4 bytes (uint32, width * height * control_channels)
+ * - LoRA section: as in sd35_generate_request_t
+ * - prompt_data: variable bytes (UTF-8 encoded prompts)
+ * - control_data: control_data_len bytes (raw pixels, width x height)
+ */
+typedef struct {
+    sd35_generate_request_t base; /**< Prompt and generation parameters */
+
+    uint32_t control_type;      /**< Kind of control map (CONTROL_TYPE_*) */
+    float control_strength;     /**< How closely to follow the control image (0.0-2.0) */
+    uint32_t control_channels;  /**< Control image channels (3 = RGB, 4 = RGBA) */
+    uint32_t control_data_len;  /**< Size of control_data in bytes */
+
+    /* Control image (not owned by this struct, points into received buffer) */
+    const uint8_t *control_data; /**< Raw pixels, base.width x base.height */
+} sd35_control_request_t;
+
+/**
+ * Upscale Request
+ *
+ * In-memory representation of a request to enlarge an image. The compute
+ * process upscales it with its ESRGAN model and resizes the result to the
+ * target size, which may not exceed UPSCALE_MAX_FACTOR times the input.
+ * The response is an ordinary generation response.
+ * This struct is NOT for wire format - use encoding/decoding functions.
+ *
+ * Wire format payload structure (after common header with
+ * msg_type = MSG_UPSCALE_REQUEST):
+ * - request_id: 8 bytes (uint64)
+ * - width: 4 bytes (uint32, 1-2048)
+ * - height: 4 bytes (uint32, 1-2048)
+ * - channels: 4 bytes (uint32, 3 = RGB, 4 = RGBA)
+ * - target_width: 4 bytes (uint32, width to width * 4, at most 2048)
+ * - target_height: 4 bytes (uint32, height to height * 4, at most 2048)
+ * - image_data_len: 4 bytes (uint32, width * height * channels)
+ * - image_data: image_data_len bytes (raw pixels)
+ */
+typedef struct {
+    uint64_t request_id;     /**< Unique request identifier (echoed in response) */
+    uint32_t width;          /**< Input image width */
+    uint32_t height;         /**< Input image height */
+    uint32_t channels;       /**< Input image channels (3 = RGB, 4 = RGBA) */
+    uint32_t target_width;   /**< Width of the upscaled image */
+    uint32_t target_height;  /**< Height of the upscaled image */
+    uint32_t image_data_len; /**< Size of image_data in bytes */
+
+    /* Image (not owned by this struct, points into received buffer) */
+    const uint8_t *image_data; /**< Raw pixels, width x height */
+} upscale_request_t;
+
+/** Longest generation metadata string, null terminator included */
+#define GENERATION_METADATA_STRING_MAX 32
+
+/**
+ * Generation Metadata
+ *
+ * How an image was generated, for comparing configurations. Strings are
+ * null-terminated ASCII, empty if unknown; timings are wall clock.
+ */
+typedef struct {
+    char model_hash[GENERATION_METADATA_STRING_MAX]; /**< Short hash of the model weights (see model_hash()) */
+    char sampler[GENERATION_METADATA_STRING_MAX];    /**< Sampling method, as stable-diffusion.cpp names it */
+    char scheduler[GENERATION_METADATA_STRING_MAX];  /**< Noise schedule, as stable-diffusion.cpp names it */
+    uint32_t text_encode_ms; /**< Conditioning: prompt encoding, and the init image for img2img */
+    uint32_t diffusion_ms;   /**< Sampling steps */
+    uint32_t vae_ms;         /**< VAE decode of the final latent */
+} generation_metadata_t;
+
 /**
  * SD 3.5 Generation Response
  *
@@ -214,6 +559,22 @@ typedef struct {
  * - channels: 4 bytes (uint32, 3 = RGB, 4 = RGBA)
  * - image_data_len: 4 bytes (uint32)
  * - image_data: variable bytes (raw pixel data)
+ *
+ * With HEADER_FLAG_SHARED_MEMORY, image_data is replaced by the name of the
+ * segment holding the image_data_len bytes of pixels:
+ * - name_len: 2 bytes (uint16)
+ * - name: name_len bytes
+ *
+ * With HEADER_FLAG_SEED, the payload goes on with:
+ * - seed: 8 bytes (uint64, never 0)
+ *
+ * With HEADER_FLAG_METADATA, the payload ends with generation_metadata_t:
+ * - model_hash_len: 2 bytes (uint16), model_hash: model_hash_len bytes
+ * - sampler_len: 2 bytes (uint16), sampler: sampler_len bytes
+ * - scheduler_len: 2 bytes (uint16), scheduler: scheduler_len bytes
+ * - text_encode_ms: 4 bytes (uint32)
+ * - diffusion_ms: 4 bytes (uint32)
+ * - vae_ms: 4 bytes (uint32)
  */
 typedef struct {
     /* Common response fields */
@@ -229,8 +590,115 @@ typedef struct {
 
     /* Image data (not owned by this struct, points into buffer) */
     const uint8_t *image_data; /**< Pointer to raw pixel data (RGB/RGBA) */
+
+    /**
+     * Name of a shared memory segment holding image_data, sent instead of
+     * the pixels; NULL to send them inline
+     */
+    const char *shm_name;
+
+    /**
+     * Seed the image was generated with, sent with HEADER_FLAG_SEED; 0 to
+     * leave it out
+     */
+    uint64_t seed;
+
+    /** How the image was generated, sent with HEADER_FLAG_METADATA */
+    generation_metadata_t metadata;
+    bool has_metadata; /**< Whether to send metadata */
 } sd35_generate_response_t;
 
+/**
+ * Preview Frame
+ *
+ * In-memory representation of a preview frame: a low-resolution look at a
+ * generation in progress. Compute may send any number of them for a request
+ * before its response; they are never the reply to a request.
+ * This struct is NOT for wire format - use encoding/decoding functions.
+ *
+ * Wire format payload structure (after common header with msg_type = MSG_PREVIEW):
+ * - request_id: 8 bytes (uint64, of the generation being previewed)
+ * - step: 4 bytes (uint32, sampling steps done, 1 to steps)
+ * - steps: 4 bytes (uint32, sampling steps in the generation)
+ * - width: 4 bytes (uint32, 1-PREVIEW_MAX_DIMENSION)
+ * - height: 4 bytes (uint32, 1-PREVIEW_MAX_DIMENSION)
+ * - channels: 4 bytes (uint32, must be 3 = RGB)
+ * - image_data_len: 4 bytes (uint32, width * height * 3)
+ * - image_data: image_data_len bytes (raw pixels)
+ */
+typedef struct {
+    uint64_t request_id;     /**< Request ID of the generation */
+    uint32_t step;           /**< Sampling steps done */
+    uint32_t steps;          /**< Sampling steps in the generation */
+    uint32_t width;          /**< Preview width */
+    uint32_t height;         /**< Preview height */
+    uint32_t channels;       /**< Number of channels (3 = RGB) */
+    uint32_t image_data_len; /**< Size of image_data in bytes */
+
+    /* Image data (not owned by this struct) */
+    const uint8_t *image_data; /**< Pointer to raw RGB pixels */
+} preview_frame_t;
+
+/**
+ * Model Status
+ *
+ * Whether a model can be used, as reported in a models response.
+ */
+typedef enum {
+    MODEL_STATUS_MISSING   = 0,  /**< Model files are not installed */
+    MODEL_STATUS_AVAILABLE = 1,  /**< Installed; loaded on first use */
+    MODEL_STATUS_LOADED    = 2,  /**< Loaded in VRAM */
+} model_status_t;
+
+/**
+ * Model Info
+ *
+ * One entry of a models response.
+ * This struct is NOT for wire format - use encoding/decoding functions.
+ *
+ * Wire format of each entry:
+ * - model_id: 4 bytes (uint32)
+ * - status: 4 bytes (uint32, model_status_t)
+ * - vram_mb: 4 bytes (uint32, approximate VRAM the model uses when loaded)
+ * - name_len: 4 bytes (uint32, 1-MAX_MODEL_NAME_LENGTH)
+ * - name: name_len bytes (UTF-8, no null terminator)
+ */
+typedef struct {
+    uint32_t model_id;  /**< Model identifier (MODEL_ID_*) */
+    uint32_t status;    /**< Model status (model_status_t) */
+    uint32_t vram_mb;   /**< Approximate VRAM in use when loaded (MB) */
+    const char *name;   /**< Model name (null-terminated, not owned) */
+} model_info_t;
+
+/**
+ * Capabilities
+ *
+ * What compute supports, sent in a capabilities response when a client
+ * connects. This struct is NOT for wire format - use encode_capabilities_response().
+ *
+ * Wire format payload structure (after common header with
+ * msg_type = MSG_CAPABILITIES_RESPONSE):
+ * - request_id: 8 bytes (uint64, echoed from the request)
+ * - min_version: 2 bytes (uint16, MIN_SUPPORTED_VERSION)
+ * - max_version: 2 bytes (uint16, MAX_SUPPORTED_VERSION)
+ * - request_types: 4 bytes (uint32, bit n set if message type n is accepted)
+ * - max_width: 4 bytes (uint32)
+ * - max_height: 4 bytes (uint32)
+ * - vram_total_mb: 4 bytes (uint32, 0 if unknown)
+ * - vram_free_mb: 4 bytes (uint32, 0 if unknown)
+ * - model_count: 4 bytes (uint32, at most MODEL_COUNT)
+ * - model_count entries as described for model_info_t
+ */
+typedef struct {
+    uint32_t request_types;      /**< Bit n set if message type n is accepted */
+    uint32_t max_width;          /**< Widest image compute generates */
+    uint32_t max_height;         /**< Tallest image compute generates */
+    uint32_t vram_total_mb;      /**< GPU memory (MB), 0 if unknown */
+    uint32_t vram_free_mb;       /**< Free GPU memory (MB), 0 if unknown */
+    const model_info_t *models;  /**< Models compute knows (not owned) */
+    uint32_t model_count;        /**< Number of entries in models */
+} capabilities_t;
+
 /**
  * Error Response
  *
@@ -269,6 +737,50 @@ typedef struct {
 error_code_t decode_generate_request(const uint8_t *data, size_t data_len,
                                      sd35_generate_request_t *req);
 
+/**
+ * decode_img2img_request - Decode and validate SD 3.5 img2img request
+ *
+ * @param data      Input buffer containing complete message
+ * @param data_len  Size of input buffer
+ * @param req       Output request structure (populated on success)
+ * @return          ERR_NONE on success, error code on failure
+ */
+error_code_t decode_img2img_request(const uint8_t *data, size_t data_len,
+                                    sd35_img2img_request_t *req);
+
+/**
+ * decode_inpaint_request - Decode and validate SD 3.5 inpaint request
+ *
+ * @param data      Input buffer containing complete message
+ * @param data_len  Size of input buffer
+ * @param req       Output request structure (populated on success)
+ * @return          ERR_NONE on success, error code on failure
+ */
+error_code_t decode_inpaint_request(const uint8_t *data, size_t data_len,
+                                    sd35_inpaint_request_t *req);
+
+/**
+ * decode_control_request - Decode and validate SD 3.5 control request
+ *
+ * @param data      Input buffer containing complete message
+ * @param data_len  Size of input buffer
+ * @param req       Output request structure (populated on success)
+ * @return          ERR_NONE on success, error code on failure
+ */
+error_code_t decode_control_request(const uint8_t *data, size_t data_len,
+                                    sd35_control_request_t *req);
+
+/**
+ * decode_upscale_request - Decode and validate an upscale request
+ *
+ * @param data      Input buffer containing complete message
+ * @param data_len  Size of input buffer
+ * @param req       Output request structure (populated on success)
+ * @return          ERR_NONE on success, error code on failure
+ */
+error_code_t decode_upscale_request(const uint8_t *data, size_t data_len,
+                                    upscale_request_t *req);
+
 /**
  * encode_generate_response - Encode SD 3.5 generation response
  *
@@ -282,6 +794,165 @@ error_code_t encode_generate_response(const sd35_generate_response_t *resp,
                                       uint8_t *buffer, size_t buf_size,
                                       size_t *out_len);
 
+/**
+ * encode_preview_frame - Encode a preview frame
+ *
+ * @param frame     Preview frame to encode
+ * @param buffer    Output buffer for encoded message
+ * @param buf_size  Size of output buffer in bytes
+ * @param out_len   Pointer to store actual encoded length
+ * @return          ERR_NONE on success, error code on failure
+ */
+error_code_t encode_preview_frame(const preview_frame_t *frame,
+                                  uint8_t *buffer, size_t buf_size,
+                                  size_t *out_len);
+
+/**
+ * decode_ping_request - Decode and validate a ping request
+ *
+ * @param data        Input buffer containing complete message
+ * @param data_len    Size of input buffer
+ * @param request_id  Output request ID (populated on success)
+ * @return            ERR_NONE on success, error code on failure
+ */
+error_code_t decode_ping_request(const uint8_t *data, size_t data_len,
+                                 uint64_t *request_id);
+
+/**
+ * encode_pong_response - Encode the response to a ping request
+ *
+ * @param request_id  Request ID echoed from the ping
+ * @param buffer      Output buffer for encoded message
+ * @param buf_size    Size of output buffer in bytes
+ * @param out_len     Pointer to store actual encoded length
+ * @return            ERR_NONE on success, ERR_INTERNAL on failure
+ */
+error_code_t encode_pong_response(uint64_t request_id, uint8_t *buffer,
+                                  size_t buf_size, size_t *out_len);
+
+/**
+ * decode_models_request - Decode and validate a models request
+ *
+ * The payload is only the request ID, as in a ping.
+ *
+ * @param data        Input buffer containing complete message
+ * @param data_len    Size of input buffer
+ * @param request_id  Output request ID (populated on success)
+ * @return            ERR_NONE on success, error code on failure
+ */
+error_code_t decode_models_request(const uint8_t *data, size_t data_len,
+                                   uint64_t *request_id);
+
+/**
+ * encode_models_response - Encode the response to a models request
+ *
+ * Wire format payload structure (after common header with
+ * msg_type = MSG_MODELS_RESPONSE):
+ * - request_id: 8 bytes (uint64, echoed from the request)
+ * - model_count: 4 bytes (uint32, at most MODEL_COUNT)
+ * - model_count entries as described for model_info_t
+ *
+ * @param request_id  Request ID echoed from the request
+ * @param models      Models to list
+ * @param count       Number of models
+ * @param buffer      Output buffer for encoded message
+ * @param buf_size    Size of output buffer in bytes
+ * @param out_len     Pointer to store actual encoded length
+ * @return            ERR_NONE on success, ERR_INTERNAL on failure
+ */
+error_code_t encode_models_response(uint64_t request_id,
+                                    const model_info_t *models, uint32_t count,
+                                    uint8_t *buffer, size_t buf_size,
+                                    size_t *out_len);
+
+/**
+ * decode_capabilities_request - Decode and validate a capabilities request
+ *
+ * The payload is only the request ID, as in a ping.
+ *
+ * @param data        Input buffer containing complete message
+ * @param data_len    Size of input buffer
+ * @param request_id  Output request ID (populated on success)
+ * @return            ERR_NONE on success, error code on failure
+ */
+error_code_t decode_capabilities_request(const uint8_t *data, size_t data_len,
+                                         uint64_t *request_id);
+
+/**
+ * encode_capabilities_response - Encode the response to a capabilities request
+ *
+ * See capabilities_t for the payload structure.
+ *
+ * @param request_id  Request ID echoed from the request
+ * @param caps        Capabilities to send
+ * @param buffer      Output buffer for encoded message
+ * @param buf_size    Size of output buffer in bytes
+ * @param out_len     Pointer to store actual encoded length
+ * @return            ERR_NONE on success, ERR_INTERNAL on failure
+ */
+error_code_t encode_capabilities_response(uint64_t request_id,
+                                          const capabilities_t *caps,
+                                          uint8_t *buffer, size_t buf_size,
+                                          size_t *out_len);
+
+/**
+ * decode_hello_request - Decode and validate a hello request
+ *
+ * Hello messages always carry PROTOCOL_VERSION_1 in their header, so that
+ * any compute can read them whatever the versions they offer.
+ *
+ * Wire format payload structure (after common header with
+ * msg_type = MSG_HELLO_REQUEST):
+ * - request_id: 8 bytes (uint64)
+ * - min_version: 2 bytes (uint16, oldest version the client speaks)
+ * - max_version: 2 bytes (uint16, newest version the client speaks)
+ *
+ * @param data         Input buffer containing complete message
+ * @param data_len     Size of input buffer
+ * @param request_id   Output request ID (populated on success)
+ * @param min_version  Output oldest version the client speaks
+ * @param max_version  Output newest version the client speaks
+ * @return             ERR_NONE on success, error code on failure
+ */
+error_code_t decode_hello_request(const uint8_t *data, size_t data_len,
+                                  uint64_t *request_id, uint16_t *min_version,
+                                  uint16_t *max_version);
+
+/**
+ * negotiate_version - Pick the protocol version to speak with a client
+ *
+ * @param min_version  Oldest version the client speaks
+ * @param max_version  Newest version the client speaks
+ * @param version      Output newest version both sides speak
+ * @return             ERR_NONE on success, ERR_UNSUPPORTED_VERSION if the
+ *                     ranges don't overlap
+ */
+error_code_t negotiate_version(uint16_t min_version, uint16_t max_version,
+                               uint16_t *version);
+
+/**
+ * encode_hello_response - Encode the response to a hello request
+ *
+ * Wire format payload structure (after common header with
+ * msg_type = MSG_HELLO_RESPONSE):
+ * - request_id: 8 bytes (uint64, echoed from the request)
+ * - version: 2 bytes (uint16, the version both sides speak from now on)
+ * - min_version: 2 bytes (uint16, MIN_SUPPORTED_VERSION)
+ * - max_version: 2 bytes (uint16, MAX_SUPPORTED_VERSION)
+ * - flags: 2 bytes (uint16, HEADER_FLAGS_SUPPORTED: the header flags compute
+ *   accepts)
+ *
+ * @param request_id  Request ID echoed from the request
+ * @param version     Version from negotiate_version()
+ * @param buffer      Output buffer for encoded message
+ * @param buf_size    Size of output buffer in bytes
+ * @param out_len     Pointer to store actual encoded length
+ * @return            ERR_NONE on success, ERR_INTERNAL on failure
+ */
+error_code_t encode_hello_response(uint64_t request_id, uint16_t version,
+                                   uint8_t *buffer, size_t buf_size,
+                                   size_t *out_len);
+
 /**
  * encode_error_response - Encode error response
  *
@@ -294,3 +965,27 @@ error_code_t encode_generate_response(const sd35_generate_response_t *resp,
 error_code_t encode_error_response(const error_response_t *resp,
                                    uint8_t *buffer, size_t buf_size,
                                    size_t *out_len);
+
+/**
+ * protocol_crc32 - CRC-32 (IEEE 802.3, as zlib computes it) of data
+ *
+ * @param data  Input buffer
+ * @param len   Length of data in bytes
+ * @return      The checksum
+ */
+uint32_t protocol_crc32(const uint8_t *data, size_t len);
+
+/**
+ * verify_checksum - Check and remove the checksum of a message
+ *
+ * A message without HEADER_FLAG_CHECKSUM is left as is. Otherwise the
+ * CRC-32 at the end of the payload is checked and removed: payload_len
+ * and *message_len shrink by CHECKSUM_SIZE and the flag is cleared, so
+ * the message decodes as if it had been sent without one.
+ *
+ * @param message      Complete message (header + payload), modified in place
+ * @param message_len  Length of message, updated on success
+ * @return             ERR_NONE on success, ERR_CHECKSUM_MISMATCH if the
+ *                     payload does not match, ERR_INTERNAL on invalid input
+ */
+error_code_t verify_checksum(uint8_t *message, size_t *message_len);
@@ -41,6 +41,7 @@ typedef struct sd_wrapper_ctx sd_wrapper_ctx_t;
  */
 typedef struct {
     const char* model_path;           /* Path to main model file (.safetensors or .gguf) */
+    const char* diffusion_model_path; /* Path to a standalone diffusion model, as Flux ships (NULL if model_path has it) */
     const char* clip_l_path;          /* Path to CLIP-L encoder (NULL for auto-detect) */
     const char* clip_g_path;          /* Path to CLIP-G encoder (NULL for auto-detect) */
     const char* t5xxl_path;           /* Path to T5-XXL encoder (NULL for auto-detect) */
@@ -49,8 +50,28 @@ typedef struct {
     bool keep_clip_on_cpu;            /* Keep text encoders on CPU (saves VRAM) */
     bool keep_vae_on_cpu;             /* Keep VAE on CPU (saves VRAM) */
     bool enable_flash_attn;           /* Enable flash attention (faster) */
+    const char* upscaler_path;        /* ESRGAN upscaler model (NULL disables upscaling) */
+    const char* lora_model_dir;       /* Directory LoRAs are loaded from (NULL disables LoRAs) */
+    const char* control_net_path;     /* ControlNet for control images (NULL for none) */
 } sd_wrapper_config_t;
 
+/**
+ * A LoRA to apply to a generation.
+ */
+typedef struct {
+    const char* name;                 /* File name in lora_model_dir, without extension */
+    float weight;                     /* Weight (1.0 applies the LoRA as trained) */
+} sd_wrapper_lora_t;
+
+/**
+ * Receives a preview of an image being generated, after step of steps
+ * sampling steps. pixels is RGB, width x height (a fraction of the image
+ * size), and valid only during the call.
+ */
+typedef void (*sd_wrapper_preview_fn)(uint32_t step, uint32_t steps,
+                                      uint32_t width, uint32_t height,
+                                      const uint8_t* pixels, void* data);
+
 /**
  * Parameters for image generation.
  */
@@ -63,6 +84,19 @@ typedef struct {
     float cfg_scale;                  /* Guidance scale (0.0-20.0) */
     int64_t seed;                     /* Random seed (0 for random) */
     int clip_skip;                    /* CLIP skip layers (0 for default) */
+    const uint8_t* init_image;        /* img2img init pixels, width x height (NULL for txt2img) */
+    uint32_t init_channels;           /* Init image channels (3=RGB, 4=RGBA) */
+    float strength;                   /* img2img denoise strength (0.0-1.0] */
+    const uint8_t* mask_image;        /* Inpaint mask, one byte per pixel, 255 = redraw (NULL for none) */
+    sd_wrapper_preview_fn preview_fn; /* Called with previews (NULL for none) */
+    void* preview_data;               /* Passed to preview_fn */
+    uint32_t preview_interval;        /* Sampling steps between previews */
+    const sd_wrapper_lora_t* loras;   /* LoRAs to apply (NULL for none) */
+    uint32_t lora_count;              /* Number of entries in loras */
+    const uint8_t* control_image;     /* ControlNet control map, width x height (NULL for none) */
+    uint32_t control_channels;        /* Control image channels (3=RGB, 4=RGBA) */
+    float control_strength;           /* How closely to follow the control image (0.0-2.0] */
+    bool vae_tiling;                  /* VAE-decode in tiles (slower, far less VRAM) */
 } sd_wrapper_gen_params_t;
 
 /**
@@ -74,8 +108,37 @@ typedef struct {
     uint32_t channels;                /* Number of channels (3=RGB, 4=RGBA) */
     uint8_t* data;                    /* Raw pixel data (caller must free) */
     size_t data_size;                 /* Size of data buffer in bytes */
+    const char* sampler;              /* Sampling method generated with (static, NULL if unknown) */
+    const char* scheduler;            /* Noise schedule generated with (static, NULL if unknown) */
+    uint32_t text_encode_ms;          /* Time spent before sampling: prompt and init image encoding */
+    uint32_t diffusion_ms;            /* Time spent sampling */
+    uint32_t vae_ms;                  /* Time spent after sampling: VAE decode */
 } sd_wrapper_image_t;
 
+/**
+ * Parameters for upscaling an image.
+ */
+typedef struct {
+    const uint8_t* image;             /* Input pixels, width x height (required) */
+    uint32_t width;                   /* Input width (1-2048) */
+    uint32_t height;                  /* Input height (1-2048) */
+    uint32_t channels;                /* Input channels (3=RGB, 4=RGBA) */
+    uint32_t target_width;            /* Output width (up to 4x width, at most 2048) */
+    uint32_t target_height;           /* Output height (up to 4x height, at most 2048) */
+} sd_wrapper_upscale_params_t;
+
+/* Longest GPU name, null terminator included */
+#define SD_WRAPPER_GPU_NAME_MAX 128
+
+/**
+ * A GPU the Vulkan backend can run generations on.
+ */
+typedef struct {
+    char name[SD_WRAPPER_GPU_NAME_MAX]; /* Device description */
+    uint32_t vram_total_mb;             /* GPU memory (MB) */
+    uint32_t vram_free_mb;              /* Free GPU memory (MB) */
+} sd_wrapper_gpu_t;
+
 /**
  * Initialize wrapper configuration with defaults.
  *
@@ -127,6 +190,9 @@ void sd_wrapper_free(sd_wrapper_ctx_t* ctx);
  * @param image   Output image (caller must free image->data)
  * @return        SD_WRAPPER_OK on success, error code on failure
  *
+ * The image also reports the sampler and scheduler used and how long each
+ * phase took, timed from stable-diffusion.cpp's sampling progress.
+ *
  * @note image->data must be freed by caller using free()
  * @note Generation time depends on steps and resolution (1-10s typical)
  */
@@ -134,6 +200,46 @@ sd_wrapper_error_t sd_wrapper_generate(sd_wrapper_ctx_t* ctx,
                                         const sd_wrapper_gen_params_t* params,
                                         sd_wrapper_image_t* image);
 
+/**
+ * Upscale an image with the ESRGAN upscaler model.
+ *
+ * The upscaler is loaded from config->upscaler_path on first use and kept
+ * until sd_wrapper_free() or sd_wrapper_load_model(); sd_wrapper_reset()
+ * does not reload it. The model output is resized to the target size.
+ *
+ * @param ctx     SD wrapper context (must not be NULL)
+ * @param params  Upscale parameters
+ * @param image   Output image, RGB (caller must free image->data)
+ * @return        SD_WRAPPER_OK on success, SD_WRAPPER_ERR_MODEL_NOT_FOUND
+ *                if no upscaler is configured or it fails to load, other
+ *                error code on failure
+ *
+ * @note image->data must be freed by caller using free()
+ */
+sd_wrapper_error_t sd_wrapper_upscale(sd_wrapper_ctx_t* ctx,
+                                       const sd_wrapper_upscale_params_t* params,
+                                       sd_wrapper_image_t* image);
+
+/**
+ * Replace the loaded model with the one config describes.
+ *
+ * Only one model fits in VRAM, so the current model and the upscaler are
+ * freed before the new model is loaded; the upscaler is reloaded on the
+ * next upscale. The other settings of config (threads, offloading) apply
+ * from then on, including to sd_wrapper_reset().
+ *
+ * If the new model fails to load, no model is loaded: generations fail
+ * until a model is loaded again.
+ *
+ * @param ctx     SD wrapper context (must not be NULL)
+ * @param config  Configuration of the model to load
+ * @return        SD_WRAPPER_OK on success, error code on failure
+ *
+ * @note This function may take several seconds to complete
+ */
+sd_wrapper_error_t sd_wrapper_load_model(sd_wrapper_ctx_t* ctx,
+                                          const sd_wrapper_config_t* config);
+
 /**
  * Free image data allocated by sd_wrapper_generate().
  *
@@ -161,6 +267,27 @@ sd_wrapper_error_t sd_wrapper_get_model_info(sd_wrapper_ctx_t* ctx,
                                               char* model_name,
                                               size_t buf_size);
 
+/**
+ * Get the memory of the GPU generations run on.
+ *
+ * @param total_mb  Output total GPU memory (MB)
+ * @param free_mb   Output free GPU memory (MB)
+ * @return          SD_WRAPPER_OK on success, SD_WRAPPER_ERR_GPU_ERROR if there
+ *                  is no GPU to query
+ */
+sd_wrapper_error_t sd_wrapper_get_vram(uint32_t* total_mb, uint32_t* free_mb);
+
+/**
+ * List the GPUs the Vulkan backend sees, by device index. With
+ * GGML_VK_VISIBLE_DEVICES set, only those are seen.
+ *
+ * @param gpus  Output array
+ * @param max   Number of entries in gpus
+ * @return      Number of GPUs, which may exceed max; only the first max
+ *              are written
+ */
+int sd_wrapper_get_gpus(sd_wrapper_gpu_t* gpus, int max);
+
 /**
  * Reset the SD context to clean state.
  *
@@ -0,0 +1,49 @@
+/**
+ * Weave Compute - SHA-256
+ *
+ * A small SHA-256 (FIPS 180-4) for identifying model files; compute has
+ * no crypto library to link against.
+ */
+
+#pragma once
+
+#include <stddef.h>
+#include <stdint.h>
+
+/** Size of a SHA-256 digest in bytes */
+#define SHA256_DIGEST_SIZE 32
+
+/**
+ * SHA-256 state; see sha256_init().
+ */
+typedef struct {
+    uint32_t state[8];  /**< Intermediate hash value */
+    uint64_t length;    /**< Bytes hashed so far */
+    uint8_t block[64];  /**< Bytes not yet hashed */
+    size_t block_len;   /**< Bytes in block */
+} sha256_ctx_t;
+
+/**
+ * Start a new hash.
+ *
+ * @param ctx  State to initialize
+ */
+void sha256_init(sha256_ctx_t *ctx);
+
+/**
+ * Add data to a hash.
+ *
+ * @param ctx   State from sha256_init()
+ * @param data  Bytes to hash
+ * @param len   Number of bytes
+ */
+void sha256_update(sha256_ctx_t *ctx, const uint8_t *data, size_t len);
+
+/**
+ * Finish a hash.
+ *
+ * @param ctx     State from sha256_init(); must be initialized again to
+ *                be reused
+ * @param digest  Output digest
+ */
+void sha256_final(sha256_ctx_t *ctx, uint8_t digest[SHA256_DIGEST_SIZE]);
@@ -49,6 +49,9 @@ typedef enum {
     SOCKET_ERR_ACCEPT_FAILED = -15,   /**< Failed to accept connection */
     SOCKET_ERR_NULL_HANDLER = -16,    /**< NULL handler provided to accept loop */
     SOCKET_ERR_CONNECT_FAILED = -17,  /**< Failed to connect to socket */
+    SOCKET_ERR_SHARE_FAILED = -18,    /**< Failed to create shared memory segment */
+    SOCKET_ERR_TOKEN_NOT_SET = -19,   /**< SOCKET_TOKEN_ENV not set for a TCP address */
+    SOCKET_ERR_AUTH_TOKEN = -20,      /**< TCP client did not send the token */
 } socket_error_t;
 
 /**
@@ -67,6 +70,19 @@ typedef enum {
  */
 #define SOCKET_FILE_NAME "weave.sock"
 
+/**
+ * Prefix of socket paths that are a TCP address on the loopback interface,
+ * as in tcp://127.0.0.1:50123, used where Unix domain sockets are not
+ * available.
+ */
+#define SOCKET_TCP_PREFIX "tcp://"
+
+/**
+ * Environment variable holding the token weave requires as the first bytes
+ * of a TCP connection.
+ */
+#define SOCKET_TOKEN_ENV "WEAVE_COMPUTE_TOKEN"
+
 /**
  * socket_get_path - Get the full socket path
  *
@@ -144,6 +160,10 @@ socket_error_t socket_create(int *listen_fd);
  * It only connects to an already-listening socket. This is the client-side
  * connection logic for weave-compute to use when spawned by weave.
  *
+ * A socket_path starting with SOCKET_TCP_PREFIX is a host:port to connect
+ * to over TCP instead; the token in SOCKET_TOKEN_ENV is sent first to
+ * authenticate, as SO_PEERCRED cannot.
+ *
  * @param socket_path  Path to the existing socket file
  * @param connected_fd Pointer to store the connected socket file descriptor
  * @return             SOCKET_OK on success, error code on failure
@@ -153,6 +173,7 @@ socket_error_t socket_create(int *listen_fd);
  * - SOCKET_ERR_PATH_TOO_LONG: Socket path exceeds system limit
  * - SOCKET_ERR_SOCKET_FAILED: Could not create socket
  * - SOCKET_ERR_CONNECT_FAILED: Could not connect to socket
+ * - SOCKET_ERR_TOKEN_NOT_SET: TCP address without SOCKET_TOKEN_ENV
  *
  * On success, the caller owns the socket and must close it when done.
  * Do NOT call socket_cleanup() when using socket_connect() - the parent
@@ -177,6 +198,39 @@ socket_error_t socket_connect(const char *socket_path, int *connected_fd);
  */
 socket_error_t socket_cleanup(void);
 
+/**
+ * Prefix of the names of shared memory segments created by
+ * socket_share_data(); weave only reads segments named like this.
+ */
+#define SOCKET_SHM_PREFIX "weave-shm-"
+
+/**
+ * socket_share_data - Copy data into a new shared memory segment
+ *
+ * Creates a file named SOCKET_SHM_PREFIX<pid>-<n> in dir, the socket
+ * directory (tmpfs under $XDG_RUNTIME_DIR), maps it and copies data into
+ * it, so the peer can map it instead of reading the data from the socket.
+ * The peer unlinks the segment once read.
+ *
+ * @param dir        Directory for the segment, mode 0700
+ * @param data       Data to share
+ * @param len        Size of data in bytes, at least 1
+ * @param name_buf   Output buffer for the segment name (not the path)
+ * @param name_size  Size of name_buf
+ * @return           SOCKET_OK on success, error code on failure
+ *
+ * Error codes:
+ * - SOCKET_ERR_NULL_POINTER: dir, data or name_buf is NULL
+ * - SOCKET_ERR_PATH_TOO_LONG: name or path does not fit
+ * - SOCKET_ERR_SHARE_FAILED: len is 0, or the segment could not be
+ *   created, sized or mapped (nothing is left behind)
+ *
+ * Security:
+ * - The segment is created with O_EXCL and mode 0600
+ */
+socket_error_t socket_share_data(const char *dir, const void *data, size_t len,
+                                 char *name_buf, size_t name_size);
+
 /**
  * socket_auth_connection - Authenticate a client connection via SO_PEERCRED
  *
@@ -203,6 +257,52 @@ socket_error_t socket_cleanup(void);
  */
 socket_error_t socket_auth_connection(int client_fd);
 
+/**
+ * Shortest token socket_auth_token() accepts; remote compute is reachable
+ * from the network, so a guessable token is refused at startup.
+ */
+#define SOCKET_TOKEN_MIN_LEN 16
+
+/**
+ * socket_listen_tcp - Create a listening TCP socket for remote weave
+ *
+ * Used by --listen, where compute runs on another machine than weave and
+ * weave connects to it. SO_PEERCRED does not work over TCP; authenticate
+ * each accepted connection with socket_auth_token() instead.
+ *
+ * @param address    host:port to listen on, such as 0.0.0.0:7860
+ * @param listen_fd  Pointer to store the listening socket file descriptor
+ * @return           SOCKET_OK on success, error code on failure
+ *
+ * Error codes:
+ * - SOCKET_ERR_NULL_POINTER: address or listen_fd is NULL
+ * - SOCKET_ERR_SOCKET_FAILED: address invalid or socket() failed
+ * - SOCKET_ERR_BIND_FAILED: Could not bind to address
+ * - SOCKET_ERR_LISTEN_FAILED: Could not listen
+ */
+socket_error_t socket_listen_tcp(const char *address, int *listen_fd);
+
+/**
+ * socket_auth_token - Authenticate a TCP connection by its token
+ *
+ * Reads strlen(token) bytes, which the client must send before any
+ * message, and compares them with token in constant time. The client has
+ * DEFAULT_READ_TIMEOUT_S to send them.
+ *
+ * On authentication failure the client_fd is NOT closed (caller must
+ * handle this) and nothing is sent to the client.
+ *
+ * @param client_fd  Connected client socket file descriptor
+ * @param token      Expected token
+ * @return           SOCKET_OK if the client sent token, error code otherwise
+ *
+ * Error codes:
+ * - SOCKET_ERR_INVALID_FD: client_fd is negative
+ * - SOCKET_ERR_NULL_POINTER: token is NULL
+ * - SOCKET_ERR_AUTH_TOKEN: Client sent something else or nothing
+ */
+socket_error_t socket_auth_token(int client_fd, const char *token);
+
 /**
  * Log levels for socket module.
  * Only DEBUG level logs authentication rejections.
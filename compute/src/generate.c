@@ -14,6 +14,7 @@
 #define _POSIX_C_SOURCE 199309L
 #include <stdbool.h>
 #include <stdint.h>
+#include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
 #include <time.h>
@@ -26,20 +27,35 @@
  * The protocol allows different prompts per encoder, but for simplicity
  * we use the CLIP-L prompt as the main prompt.
  *
+ * The request's LoRAs must all be installed; see lora_available().
+ *
  * @param req     Protocol request
  * @param params  Output SD wrapper parameters
  * @param prompt  Output buffer for null-terminated prompt string
  * @param prompt_buf_size  Size of prompt buffer
+ * @param loras   Output buffer for the LoRAs (MAX_LORAS entries)
  * @return        ERR_NONE on success, error code on failure
  */
 static error_code_t convert_request_params(const sd35_generate_request_t *req,
                                             sd_wrapper_gen_params_t *params,
                                             char *prompt,
-                                            size_t prompt_buf_size) {
-    if (req == NULL || params == NULL || prompt == NULL) {
+                                            size_t prompt_buf_size,
+                                            sd_wrapper_lora_t *loras) {
+    if (req == NULL || params == NULL || prompt == NULL || loras == NULL) {
         return ERR_INTERNAL;
     }
 
+    if (req->lora_count > MAX_LORAS) {
+        return ERR_INVALID_LORA;
+    }
+    for (uint32_t i = 0; i < req->lora_count; i++) {
+        if (!lora_available(req->loras[i].name)) {
+            return ERR_INVALID_LORA;
+        }
+        loras[i].name = req->loras[i].name;
+        loras[i].weight = req->loras[i].weight;
+    }
+
     if (req->prompt_data == NULL) {
         return ERR_INVALID_PROMPT;
     }
@@ -64,6 +80,9 @@ static error_code_t convert_request_params(const sd35_generate_request_t *req,
     params->cfg_scale = req->cfg_scale;
     params->seed = (int64_t)req->seed;
     params->clip_skip = 0;
+    params->loras = (req->lora_count > 0) ? loras : NULL;
+    params->lora_count = req->lora_count;
+    params->vae_tiling = req->vae_tiling;
 
     return ERR_NONE;
 }
@@ -103,6 +122,40 @@ static error_code_t map_sd_error(sd_wrapper_error_t sd_err, uint32_t *status) {
     }
 }
 
+/* Where preview frames go; see set_preview_handler() */
+static preview_handler_fn preview_handler = NULL;
+static void *preview_handler_data = NULL;
+
+void set_preview_handler(preview_handler_fn fn, void *data) {
+    preview_handler = fn;
+    preview_handler_data = data;
+}
+
+/**
+ * Pass an SD wrapper preview on to the preview handler as a frame of the
+ * request whose ID data points to.
+ */
+static void forward_preview(uint32_t step, uint32_t steps,
+                            uint32_t width, uint32_t height,
+                            const uint8_t *pixels, void *data) {
+    if (preview_handler == NULL || data == NULL || pixels == NULL ||
+        width < 1 || width > PREVIEW_MAX_DIMENSION ||
+        height < 1 || height > PREVIEW_MAX_DIMENSION) {
+        return;
+    }
+
+    preview_frame_t frame;
+    frame.request_id = *(const uint64_t *)data;
+    frame.step = step;
+    frame.steps = steps;
+    frame.width = width;
+    frame.height = height;
+    frame.channels = 3;
+    frame.image_data_len = width * height * 3;
+    frame.image_data = pixels;
+    preview_handler(&frame, preview_handler_data);
+}
+
 /**
  * Get current time in milliseconds.
  *
@@ -114,6 +167,33 @@ static uint64_t get_time_ms(void) {
     return (uint64_t)ts.tv_sec * 1000 + (uint64_t)ts.tv_nsec / 1000000;
 }
 
+/**
+ * Pick a seed for a request that asked for a random one.
+ *
+ * Seeds stay within 31 bits, as the seeds weave picks do, so they survive
+ * a round trip through the UI's number inputs. Falls back to the clock if
+ * /dev/urandom can't be read.
+ *
+ * @return  Seed from 1 to INT32_MAX
+ */
+static int64_t random_seed(void) {
+    FILE *f;
+    uint32_t value = 0;
+
+    f = fopen("/dev/urandom", "rb");
+    if (f != NULL) {
+        if (fread(&value, sizeof(value), 1, f) != 1) {
+            value = 0;
+        }
+        fclose(f);
+    }
+    if (value == 0) {
+        value = (uint32_t)(get_time_ms() * 2654435761u);
+    }
+    value &= 0x7FFFFFFF;
+    return value == 0 ? 1 : (int64_t)value;
+}
+
 /**
  * Process a generation request and produce a response.
  *
@@ -150,6 +230,124 @@ static uint64_t get_time_ms(void) {
  */
 static bool generation_performed = false;
 
+/* Model ctx currently holds; main loads SD 3.5 at startup */
+static uint32_t current_model_id = MODEL_ID_SD35;
+
+/* ControlNet loaded with the model (CONTROL_TYPE_NONE if none) */
+static uint32_t current_control_type = CONTROL_TYPE_NONE;
+
+/*
+ * Hash of the weights of hashed_model_id, reported in generation metadata;
+ * taken on the model's first generation rather than at every reset
+ */
+static uint32_t hashed_model_id = MODEL_ID_NONE;
+static char current_model_hash[MODEL_HASH_LENGTH + 1];
+
+void set_loaded_model(uint32_t model_id) {
+    current_model_id = model_id;
+    current_control_type = CONTROL_TYPE_NONE;
+    generation_performed = false;
+}
+
+uint32_t loaded_model(void) {
+    return current_model_id;
+}
+
+/**
+ * Fill the metadata of a generation of the loaded model from the image
+ * the SD wrapper returned.
+ *
+ * @param image     Generated image
+ * @param metadata  Output metadata; strings unknown are left empty
+ */
+static void fill_metadata(const sd_wrapper_image_t *image, generation_metadata_t *metadata) {
+    memset(metadata, 0, sizeof(*metadata));
+
+    if (hashed_model_id != current_model_id) {
+        if (!model_hash(model_lookup(current_model_id), current_model_hash)) {
+            current_model_hash[0] = '\0';
+        }
+        hashed_model_id = current_model_id;
+    }
+    memcpy(metadata->model_hash, current_model_hash, sizeof(current_model_hash));
+    if (image->sampler != NULL) {
+        strncpy(metadata->sampler, image->sampler, sizeof(metadata->sampler) - 1);
+    }
+    if (image->scheduler != NULL) {
+        strncpy(metadata->scheduler, image->scheduler, sizeof(metadata->scheduler) - 1);
+    }
+    metadata->text_encode_ms = image->text_encode_ms;
+    metadata->diffusion_ms = image->diffusion_ms;
+    metadata->vae_ms = image->vae_ms;
+}
+
+/**
+ * Replace the loaded model with the one model_id names, with the ControlNet
+ * of control_type if not CONTROL_TYPE_NONE.
+ *
+ * Only one model fits in VRAM, so the current one is unloaded first. If the
+ * new model fails to load, the previous one is loaded again, with its
+ * ControlNet, so later requests for it still work.
+ *
+ * @param ctx           SD wrapper context
+ * @param model_id      Model to load
+ * @param control_type  ControlNet to load with it (CONTROL_TYPE_NONE for none)
+ * @return              ERR_NONE on success, ERR_INVALID_MODEL_ID for an
+ *                      unknown model, ERR_MODEL_UNAVAILABLE if it is not
+ *                      installed or fails to load,
+ *                      ERR_CONTROLNET_UNAVAILABLE if the model has no
+ *                      installed ControlNet of control_type
+ */
+static error_code_t switch_model(sd_wrapper_ctx_t *ctx, uint32_t model_id,
+                                 uint32_t control_type) {
+    const model_entry_t *entry = model_lookup(model_id);
+    if (entry == NULL) {
+        return ERR_INVALID_MODEL_ID;
+    }
+
+    /* Checked up front so a missing file does not unload the current model */
+    const char *control_net = NULL;
+    if (control_type != CONTROL_TYPE_NONE) {
+        control_net = model_control_net(entry, control_type);
+        if (control_net == NULL) {
+            return ERR_CONTROLNET_UNAVAILABLE;
+        }
+    }
+    if (!model_available(entry)) {
+        return ERR_MODEL_UNAVAILABLE;
+    }
+
+    sd_wrapper_config_t config;
+    model_config(entry, &config);
+    config.control_net_path = control_net;
+    if (sd_wrapper_load_model(ctx, &config) == SD_WRAPPER_OK) {
+        set_loaded_model(model_id);
+        current_control_type = control_type;
+        return ERR_NONE;
+    }
+
+    const model_entry_t *previous = model_lookup(current_model_id);
+    uint32_t previous_control = current_control_type;
+    set_loaded_model(MODEL_ID_NONE);
+    if (previous != NULL) {
+        model_config(previous, &config);
+        config.control_net_path = model_control_net(previous, previous_control);
+        if (sd_wrapper_load_model(ctx, &config) == SD_WRAPPER_OK) {
+            set_loaded_model(previous->model_id);
+            if (config.control_net_path != NULL) {
+                current_control_type = previous_control;
+            }
+        }
+    }
+    return ERR_MODEL_UNAVAILABLE;
+}
+
+static error_code_t run_generation(sd_wrapper_ctx_t *ctx,
+                                   const sd35_generate_request_t *req,
+                                   uint32_t control_type,
+                                   const sd_wrapper_gen_params_t *params,
+                                   sd35_generate_response_t *resp);
+
 error_code_t process_generate_request(sd_wrapper_ctx_t *ctx,
                                        const sd35_generate_request_t *req,
                                        sd35_generate_response_t *resp) {
@@ -158,15 +356,172 @@ error_code_t process_generate_request(sd_wrapper_ctx_t *ctx,
     }
 
     char prompt[SD35_MAX_PROMPT_LENGTH + 1];
+    sd_wrapper_lora_t loras[MAX_LORAS];
     sd_wrapper_gen_params_t params;
     error_code_t err;
-    sd_wrapper_error_t sd_err;
 
-    err = convert_request_params(req, &params, prompt, sizeof(prompt));
+    err = convert_request_params(req, &params, prompt, sizeof(prompt), loras);
+    if (err != ERR_NONE) {
+        return err;
+    }
+
+    return run_generation(ctx, req, CONTROL_TYPE_NONE, &params, resp);
+}
+
+/**
+ * Process an img2img request and produce a response.
+ *
+ * As process_generate_request(), but the diffusion starts from the request's
+ * init image, noised according to its strength, instead of pure noise.
+ *
+ * @param ctx   SD wrapper context (must not be NULL, must be initialized)
+ * @param req   Decoded protocol request (borrowed, not modified)
+ * @param resp  Output response structure (populated on success)
+ * @return      ERR_NONE on success, error code on failure
+ *
+ * @note On success, resp->image_data is allocated and must be freed by caller
+ * @note req->prompt_data and req->init_data must remain valid during this call
+ */
+error_code_t process_img2img_request(sd_wrapper_ctx_t *ctx,
+                                      const sd35_img2img_request_t *req,
+                                      sd35_generate_response_t *resp) {
+    if (ctx == NULL || req == NULL || resp == NULL) {
+        return ERR_INTERNAL;
+    }
+
+    if (req->init_data == NULL) {
+        return ERR_INVALID_INIT_IMAGE;
+    }
+
+    char prompt[SD35_MAX_PROMPT_LENGTH + 1];
+    sd_wrapper_lora_t loras[MAX_LORAS];
+    sd_wrapper_gen_params_t params;
+    error_code_t err;
+
+    err = convert_request_params(&req->base, &params, prompt, sizeof(prompt), loras);
     if (err != ERR_NONE) {
         return err;
     }
 
+    params.init_image = req->init_data;
+    params.init_channels = req->init_channels;
+    params.strength = req->strength;
+
+    return run_generation(ctx, &req->base, CONTROL_TYPE_NONE, &params, resp);
+}
+
+/**
+ * Process an inpaint request and produce a response.
+ *
+ * As process_img2img_request(), but only the pixels set in the request's
+ * mask are redrawn.
+ *
+ * @param ctx   SD wrapper context (must not be NULL, must be initialized)
+ * @param req   Decoded protocol request (borrowed, not modified)
+ * @param resp  Output response structure (populated on success)
+ * @return      ERR_NONE on success, error code on failure
+ *
+ * @note On success, resp->image_data is allocated and must be freed by caller
+ * @note The request's prompt, init and mask data must remain valid during
+ *       this call
+ */
+error_code_t process_inpaint_request(sd_wrapper_ctx_t *ctx,
+                                     const sd35_inpaint_request_t *req,
+                                     sd35_generate_response_t *resp) {
+    if (ctx == NULL || req == NULL || resp == NULL) {
+        return ERR_INTERNAL;
+    }
+
+    if (req->base.init_data == NULL) {
+        return ERR_INVALID_INIT_IMAGE;
+    }
+
+    if (req->mask_data == NULL) {
+        return ERR_INVALID_MASK;
+    }
+
+    char prompt[SD35_MAX_PROMPT_LENGTH + 1];
+    sd_wrapper_lora_t loras[MAX_LORAS];
+    sd_wrapper_gen_params_t params;
+    error_code_t err;
+
+    err = convert_request_params(&req->base.base, &params, prompt, sizeof(prompt), loras);
+    if (err != ERR_NONE) {
+        return err;
+    }
+
+    params.init_image = req->base.init_data;
+    params.init_channels = req->base.init_channels;
+    params.strength = req->base.strength;
+    params.mask_image = req->mask_data;
+
+    return run_generation(ctx, &req->base.base, CONTROL_TYPE_NONE, &params, resp);
+}
+
+/**
+ * Process a control request and produce a response.
+ *
+ * As process_generate_request(), but the model's ControlNet of the
+ * request's control type guides the composition with the control image.
+ * The ControlNet is loaded with the model, so a request for another control
+ * type reloads the model.
+ *
+ * @param ctx   SD wrapper context (must not be NULL, must be initialized)
+ * @param req   Decoded protocol request (borrowed, not modified)
+ * @param resp  Output response structure (populated on success)
+ * @return      ERR_NONE on success, error code on failure
+ *
+ * @note On success, resp->image_data is allocated and must be freed by caller
+ * @note req->prompt_data and req->control_data must remain valid during
+ *       this call
+ */
+error_code_t process_control_request(sd_wrapper_ctx_t *ctx,
+                                     const sd35_control_request_t *req,
+                                     sd35_generate_response_t *resp) {
+    if (ctx == NULL || req == NULL || resp == NULL) {
+        return ERR_INTERNAL;
+    }
+
+    if (req->control_data == NULL || req->control_type >= CONTROL_TYPE_COUNT) {
+        return ERR_INVALID_CONTROL;
+    }
+
+    char prompt[SD35_MAX_PROMPT_LENGTH + 1];
+    sd_wrapper_lora_t loras[MAX_LORAS];
+    sd_wrapper_gen_params_t params;
+    error_code_t err;
+
+    err = convert_request_params(&req->base, &params, prompt, sizeof(prompt), loras);
+    if (err != ERR_NONE) {
+        return err;
+    }
+
+    params.control_image = req->control_data;
+    params.control_channels = req->control_channels;
+    params.control_strength = req->control_strength;
+
+    return run_generation(ctx, &req->base, req->control_type, &params, resp);
+}
+
+/**
+ * Run a generation with converted parameters and build the response.
+ *
+ * @param ctx           SD wrapper context
+ * @param req           Protocol request the parameters came from
+ * @param control_type  ControlNet the generation needs (CONTROL_TYPE_NONE
+ *                      for none; a loaded one is then left unused)
+ * @param params        SD wrapper parameters
+ * @param resp          Output response structure (populated on success)
+ * @return              ERR_NONE on success, error code on failure
+ */
+static error_code_t run_generation(sd_wrapper_ctx_t *ctx,
+                                   const sd35_generate_request_t *req,
+                                   uint32_t control_type,
+                                   const sd_wrapper_gen_params_t *params,
+                                   sd35_generate_response_t *resp) {
+    error_code_t err;
+    sd_wrapper_error_t sd_err;
+
     /*
      * WORKAROUND: Reset SD context between generations to avoid segfault.
      *
@@ -181,18 +536,37 @@ error_code_t process_generate_request(sd_wrapper_ctx_t *ctx,
      * Performance impact: ~2-3 seconds model reload per generation (after first).
      * This should be removed once the upstream bug is fixed.
      */
-    if (generation_performed) {
+    if (req->model_id != current_model_id ||
+        (control_type != CONTROL_TYPE_NONE && control_type != current_control_type)) {
+        /* A freshly loaded model needs no reset */
+        err = switch_model(ctx, req->model_id, control_type);
+        if (err != ERR_NONE) {
+            return err;
+        }
+    } else if (generation_performed) {
         sd_err = sd_wrapper_reset(ctx);
         if (sd_err != SD_WRAPPER_OK) {
             return ERR_INTERNAL;
         }
     }
 
+    sd_wrapper_gen_params_t gen_params = *params;
+    uint64_t request_id = req->request_id;
+    /* Pick the random seed here, so the response can report it */
+    if (gen_params.seed <= 0) {
+        gen_params.seed = random_seed();
+    }
+    if (preview_handler != NULL) {
+        gen_params.preview_fn = forward_preview;
+        gen_params.preview_data = &request_id;
+        gen_params.preview_interval = PREVIEW_INTERVAL_STEPS;
+    }
+
     sd_wrapper_image_t image;
     memset(&image, 0, sizeof(image));
 
     uint64_t start_time = get_time_ms();
-    sd_err = sd_wrapper_generate(ctx, &params, &image);
+    sd_err = sd_wrapper_generate(ctx, &gen_params, &image);
     uint64_t end_time = get_time_ms();
 
     uint32_t status;
@@ -250,6 +624,9 @@ error_code_t process_generate_request(sd_wrapper_ctx_t *ctx,
     resp->channels = image.channels;
     resp->image_data_len = (uint32_t)image.data_size;
     resp->image_data = image.data;
+    resp->seed = (uint64_t)gen_params.seed;
+    fill_metadata(&image, &resp->metadata);
+    resp->has_metadata = true;
 
     /* Mark that a generation has been performed for reset logic */
     generation_performed = true;
@@ -258,7 +635,91 @@ error_code_t process_generate_request(sd_wrapper_ctx_t *ctx,
 }
 
 /**
- * Free response image data allocated by process_generate_request().
+ * Process an upscale request and produce a response.
+ *
+ * Enlarges the request's image with the ESRGAN upscaler. The SD context is
+ * not used, so it is not reset and the reset logic is left as it was.
+ *
+ * @param ctx   SD wrapper context (must not be NULL, must be initialized)
+ * @param req   Decoded protocol request (borrowed, not modified)
+ * @param resp  Output response structure (populated on success)
+ * @return      ERR_NONE on success, error code on failure
+ *
+ * @note On success, resp->image_data is allocated and must be freed by caller
+ * @note req->image_data must remain valid during this call
+ */
+error_code_t process_upscale_request(sd_wrapper_ctx_t *ctx,
+                                     const upscale_request_t *req,
+                                     sd35_generate_response_t *resp) {
+    if (ctx == NULL || req == NULL || resp == NULL) {
+        return ERR_INTERNAL;
+    }
+
+    if (req->image_data == NULL) {
+        return ERR_INVALID_INIT_IMAGE;
+    }
+
+    sd_wrapper_upscale_params_t params;
+    memset(&params, 0, sizeof(params));
+    params.image = req->image_data;
+    params.width = req->width;
+    params.height = req->height;
+    params.channels = req->channels;
+    params.target_width = req->target_width;
+    params.target_height = req->target_height;
+
+    sd_wrapper_image_t image;
+    memset(&image, 0, sizeof(image));
+
+    uint64_t start_time = get_time_ms();
+    sd_wrapper_error_t sd_err = sd_wrapper_upscale(ctx, &params, &image);
+    uint64_t end_time = get_time_ms();
+
+    if (sd_err == SD_WRAPPER_ERR_MODEL_NOT_FOUND) {
+        return ERR_UPSCALER_UNAVAILABLE;
+    }
+    if (sd_err == SD_WRAPPER_ERR_INVALID_PARAM) {
+        return ERR_INVALID_DIMENSIONS;
+    }
+
+    uint32_t status;
+    error_code_t err = map_sd_error(sd_err, &status);
+    if (err != ERR_NONE) {
+        return err;
+    }
+
+    if (image.data == NULL) {
+        return ERR_INTERNAL;
+    }
+
+    if (image.width != req->target_width || image.height != req->target_height ||
+        (image.channels != 3 && image.channels != 4) ||
+        image.data_size > UINT32_MAX) {
+        sd_wrapper_free_image(&image);
+        return ERR_INTERNAL;
+    }
+
+    uint64_t upscale_time = end_time - start_time;
+    if (upscale_time > UINT32_MAX) {
+        upscale_time = UINT32_MAX;
+    }
+
+    resp->request_id = req->request_id;
+    resp->status = STATUS_OK;
+    resp->generation_time_ms = (uint32_t)upscale_time;
+    resp->image_width = image.width;
+    resp->image_height = image.height;
+    resp->channels = image.channels;
+    resp->image_data_len = (uint32_t)image.data_size;
+    resp->image_data = image.data;
+
+    return ERR_NONE;
+}
+
+/**
+ * Free response image data allocated by process_generate_request(),
+ * process_img2img_request(), process_inpaint_request(),
+ * process_control_request() or process_upscale_request().
  *
  * This is a convenience wrapper around sd_wrapper_free_image().
  * Safe to call with NULL or already-freed image data.
@@ -17,6 +17,7 @@
  * Usage:
  *   weave-compute                      # Server mode (backward compatibility)
  *   weave-compute --socket-path PATH   # Client mode (spawned by weave)
+ *   weave-compute --lora-dir PATH      # Allow LoRAs from PATH (either mode)
  *
  * weave-compute authenticates connections using SO_PEERCRED (same-UID only).
  */
@@ -30,26 +31,37 @@
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
+#include <sys/socket.h>
 #include <unistd.h>
 
 #include "weave/generate.h"
+#include "weave/models.h"
 #include "weave/protocol.h"
 #include "weave/sd_wrapper.h"
 #include "weave/socket.h"
 
 /**
  * Maximum message size for reading requests.
- * Must match MAX_MESSAGE_SIZE from protocol.h (10 MB).
+ * Must match MAX_MESSAGE_SIZE from protocol.h (20 MB).
  */
-#define MAX_REQUEST_SIZE (10 * 1024 * 1024)
+#define MAX_REQUEST_SIZE (20 * 1024 * 1024)
 
 /**
- * Model paths (hardcoded for MVP).
+ * Model loaded at startup. Requests for other models replace it; see
+ * models.h for the model files.
  */
-#define MODEL_PATH "./config/models/sd3.5_medium.safetensors"
-#define CLIP_L_PATH "./config/models/clip_l.safetensors"
-#define CLIP_G_PATH "./config/models/clip_g.safetensors"
-#define T5XXL_PATH "./config/models/t5xxl_fp8_e4m3fn.safetensors"
+#define STARTUP_MODEL_ID MODEL_ID_SD35
+
+/**
+ * Environment variable limiting the Vulkan devices ggml sees. --gpu sets
+ * it, so the chosen device is the first and only one.
+ */
+#define GPU_DEVICE_ENV "GGML_VK_VISIBLE_DEVICES"
+
+/**
+ * Most GPUs --list-gpus reports
+ */
+#define MAX_LISTED_GPUS 16
 
 /**
  * Global socket file descriptor for cleanup in main thread only.
@@ -67,6 +79,19 @@ static int g_socket_fd = -1;
  */
 static int g_socket_owned = 0;
 
+/**
+ * Directory of the socket, where images are put in shared memory segments
+ * for weave (see socket_share_data). Empty if unknown, in which case images
+ * are always sent inline.
+ */
+static char g_shm_dir[SOCKET_PATH_MAX] = "";
+
+/**
+ * HEADER_FLAG_CHECKSUM if the request being handled had it, so every frame
+ * sent in response to it ends with a checksum too; 0 otherwise.
+ */
+static uint32_t g_response_checksum = 0;
+
 /**
  * Global SD wrapper context for cleanup.
  * NOT accessed from signal handlers.
@@ -99,14 +124,77 @@ static void print_usage(const char *program_name, int exit_code) {
     fprintf(stream, "\n");
     fprintf(stream, "Options:\n");
     fprintf(stream, "  --socket-path PATH  Unix socket path (default: $XDG_RUNTIME_DIR/weave/weave.sock)\n");
+    fprintf(stream, "  --listen HOST:PORT  Accept weave from other machines over TCP instead; weave\n");
+    fprintf(stream, "                      must send the token in $%s first\n", SOCKET_TOKEN_ENV);
+    fprintf(stream, "  --lora-dir PATH     Directory of LoRAs requests may apply (default: none)\n");
+    fprintf(stream, "  --gpu INDEX         Vulkan device to generate on (default: the first)\n");
+    fprintf(stream, "  --list-gpus         Print the Vulkan devices, one per line as\n");
+    fprintf(stream, "                      index<TAB>name<TAB>vram_total_mb<TAB>vram_free_mb, and exit\n");
     fprintf(stream, "  -h, --help          Show this help message and exit\n");
     fprintf(stream, "\n");
-    fprintf(stream, "weave-compute loads SD 3.5 Medium and processes image generation requests.\n");
-    fprintf(stream, "It uses SO_PEERCRED authentication (same-UID only).\n");
+    fprintf(stream, "weave-compute loads SD 3.5 Medium and processes image generation requests,\n");
+    fprintf(stream, "switching to SDXL or Flux when a request asks for them.\n");
+    fprintf(stream, "It uses SO_PEERCRED authentication (same-UID only), or with --listen the\n");
+    fprintf(stream, "token in $%s. --listen does not encrypt; use TLS in front of it.\n", SOCKET_TOKEN_ENV);
 
     exit(exit_code);
 }
 
+/**
+ * list_gpus - Print the Vulkan devices for --list-gpus
+ *
+ * One line per device: index, name, total and free VRAM in MB, separated
+ * by tabs. Tabs and newlines in names are replaced by spaces.
+ *
+ * @return  EXIT_SUCCESS, or EXIT_FAILURE if no device was found
+ */
+static int list_gpus(void) {
+    sd_wrapper_gpu_t gpus[MAX_LISTED_GPUS];
+    int count;
+    int i;
+    char *c;
+
+    count = sd_wrapper_get_gpus(gpus, MAX_LISTED_GPUS);
+    if (count > MAX_LISTED_GPUS) {
+        count = MAX_LISTED_GPUS;
+    }
+    for (i = 0; i < count; i++) {
+        for (c = gpus[i].name; *c != '\0'; c++) {
+            if (*c == '\t' || *c == '\n' || *c == '\r') {
+                *c = ' ';
+            }
+        }
+        printf("%d\t%s\t%u\t%u\n", i, gpus[i].name,
+               gpus[i].vram_total_mb, gpus[i].vram_free_mb);
+    }
+    if (count < 1) {
+        fprintf(stderr, "no Vulkan devices found\n");
+        return EXIT_FAILURE;
+    }
+    return EXIT_SUCCESS;
+}
+
+/**
+ * valid_gpu_index - Check the argument of --gpu
+ *
+ * @param index  Argument
+ * @return       1 if index is 1 to 3 digits, 0 otherwise
+ */
+static int valid_gpu_index(const char *index) {
+    size_t len = strlen(index);
+    size_t i;
+
+    if (len == 0 || len > 3) {
+        return 0;
+    }
+    for (i = 0; i < len; i++) {
+        if (index[i] < '0' || index[i] > '9') {
+            return 0;
+        }
+    }
+    return 1;
+}
+
 /**
  * stdin_monitor_thread - Monitor stdin for closure to detect parent death
  *
@@ -273,6 +361,90 @@ static int write_full(int fd, const uint8_t *buf, size_t count) {
     return 0;
 }
 
+/**
+ * write_u32 - Store value big-endian in buf
+ */
+static void write_u32(uint8_t *buf, uint32_t value) {
+    buf[0] = (uint8_t)(value >> 24);
+    buf[1] = (uint8_t)(value >> 16);
+    buf[2] = (uint8_t)(value >> 8);
+    buf[3] = (uint8_t)value;
+}
+
+/**
+ * write_frame - Write one frame: header, payload and, with
+ * HEADER_FLAG_CHECKSUM in flags, the CRC-32 of the payload
+ *
+ * @param fd       Socket file descriptor
+ * @param message  Message the frame belongs to; its first 8 header bytes
+ *                 are repeated
+ * @param payload  Payload of the frame
+ * @param len      Length of payload in bytes
+ * @param flags    Header flags of the frame
+ * @return         0 on success, -1 on error or timeout
+ */
+static int write_frame(int fd, const uint8_t *message, const uint8_t *payload,
+                       size_t len, uint32_t flags) {
+    uint8_t header[16];
+    uint8_t checksum[CHECKSUM_SIZE];
+    int checksummed = (flags & HEADER_FLAG_CHECKSUM) != 0;
+
+    memcpy(header, message, 8);
+    write_u32(header + 8, (uint32_t)(checksummed ? len + CHECKSUM_SIZE : len));
+    write_u32(header + 12, flags);
+
+    if (write_full(fd, header, sizeof(header)) != 0 ||
+        write_full(fd, payload, len) != 0) {
+        return -1;
+    }
+    if (checksummed) {
+        write_u32(checksum, protocol_crc32(payload, len));
+        return write_full(fd, checksum, sizeof(checksum));
+    }
+    return 0;
+}
+
+/**
+ * write_message - Write an encoded message in response to the current request
+ *
+ * With chunked, the message is written in frames of CHUNK_SIZE: every frame
+ * repeats the message header with payload_len the length of its part of the
+ * payload, and all but the last have HEADER_FLAG_CHUNKED. Weave reads the
+ * frames one at a time, so a large image is never buffered as a single
+ * read. Every frame ends with a checksum if the request did.
+ *
+ * @param fd       Socket file descriptor
+ * @param message  Encoded message, header included
+ * @param len      Length of message in bytes
+ * @param chunked  Nonzero if the request had HEADER_FLAG_CHUNKED
+ * @return         0 on success, -1 on error or timeout
+ */
+static int write_message(int fd, const uint8_t *message, size_t len, int chunked) {
+    const uint8_t *payload = message + 16;
+    size_t remaining = len - 16;
+    uint32_t flags = ((uint32_t)message[12] << 24 |
+                      (uint32_t)message[13] << 16 |
+                      (uint32_t)message[14] << 8 |
+                      (uint32_t)message[15]) | g_response_checksum;
+
+    if (!chunked) {
+        return write_frame(fd, message, payload, remaining, flags);
+    }
+
+    do {
+        size_t n = remaining < CHUNK_SIZE ? remaining : CHUNK_SIZE;
+        uint32_t frame_flags = n < remaining ? flags | HEADER_FLAG_CHUNKED : flags;
+
+        if (write_frame(fd, message, payload, n, frame_flags) != 0) {
+            return -1;
+        }
+        payload += n;
+        remaining -= n;
+    } while (remaining > 0);
+
+    return 0;
+}
+
 /**
  * is_server_error - Check if error code indicates a server-side error
  *
@@ -289,6 +461,9 @@ static int is_server_error(error_code_t code) {
     case ERR_OUT_OF_MEMORY:
     case ERR_GPU_ERROR:
     case ERR_TIMEOUT:
+    case ERR_UPSCALER_UNAVAILABLE:
+    case ERR_MODEL_UNAVAILABLE:
+    case ERR_CONTROLNET_UNAVAILABLE:
     case ERR_INTERNAL:
         return 1;
 
@@ -301,6 +476,11 @@ static int is_server_error(error_code_t code) {
     case ERR_INVALID_DIMENSIONS:
     case ERR_INVALID_STEPS:
     case ERR_INVALID_CFG:
+    case ERR_INVALID_INIT_IMAGE:
+    case ERR_INVALID_MASK:
+    case ERR_INVALID_LORA:
+    case ERR_INVALID_CONTROL:
+    case ERR_CHECKSUM_MISMATCH:
     default:
         return 0;
     }
@@ -342,13 +522,213 @@ static int send_error_response(int client_fd, uint64_t request_id,
         return -1;
     }
 
-    if (write_full(client_fd, response_buf, response_len) != 0) {
+    if (write_message(client_fd, response_buf, response_len, 0) != 0) {
+        return -1;
+    }
+
+    return 0;
+}
+
+/**
+ * handle_ping - Answer a ping request with a pong
+ *
+ * Pings let weave check that the process is alive and reading requests.
+ * They are answered between generations; a ping sent during a generation
+ * waits for it to finish.
+ *
+ * @param client_fd  Client socket
+ * @param message    Complete ping message (header + payload)
+ * @param len        Size of message in bytes
+ * @return           0 on success (continue), -1 on connection close (exit)
+ */
+static int handle_ping(int client_fd, const uint8_t *message, size_t len) {
+    uint64_t request_id;
+    uint8_t response[24];
+    size_t response_len;
+    error_code_t err;
+
+    err = decode_ping_request(message, len, &request_id);
+    if (err != ERR_NONE) {
+        fprintf(stderr, "failed to decode ping: %d\n", err);
+        send_error_response(client_fd, 0, err, "invalid ping");
+        return 0;
+    }
+
+    err = encode_pong_response(request_id, response, sizeof(response), &response_len);
+    if (err != ERR_NONE) {
+        return -1;
+    }
+
+    if (write_message(client_fd, response, response_len, 0) != 0) {
+        return -1;
+    }
+    return 0;
+}
+
+/**
+ * handle_models - Answer a models request with the models compute knows
+ *
+ * @param client_fd  Client socket
+ * @param message    Complete models request (header + payload)
+ * @param len        Length of message
+ * @return           0 to keep processing requests, -1 if the connection is gone
+ */
+static int handle_models(int client_fd, const uint8_t *message, size_t len) {
+    uint64_t request_id;
+    model_info_t models[MODEL_COUNT];
+    uint32_t count;
+    /* Header, request ID, count, and per model 16 bytes plus its name */
+    uint8_t response[16 + 8 + 4 + MODEL_COUNT * (16 + MAX_MODEL_NAME_LENGTH)];
+    size_t response_len;
+
+    error_code_t err = decode_models_request(message, len, &request_id);
+    if (err != ERR_NONE) {
+        fprintf(stderr, "invalid models request: %d\n", err);
+        send_error_response(client_fd, 0, err, "invalid models request");
+        return 0;
+    }
+
+    count = model_list(loaded_model(), models, MODEL_COUNT);
+    if (encode_models_response(request_id, models, count, response,
+                               sizeof(response), &response_len) != ERR_NONE) {
+        send_error_response(client_fd, request_id, ERR_INTERNAL, "failed to list models");
+        return 0;
+    }
+    if (write_message(client_fd, response, response_len, 0) != 0) {
+        return -1;
+    }
+    return 0;
+}
+
+/**
+ * handle_hello - Answer a hello request with the protocol version to speak
+ *
+ * The newest version both sides speak is picked. If there is none, the
+ * request is rejected with ERR_UNSUPPORTED_VERSION and a message naming the
+ * versions compute speaks, so weave can report which side to update.
+ *
+ * @param client_fd  Client socket
+ * @param message    Complete hello request (header + payload)
+ * @param len        Length of message
+ * @return           0 to keep processing requests, -1 if the connection is gone
+ */
+static int handle_hello(int client_fd, const uint8_t *message, size_t len) {
+    uint64_t request_id;
+    uint16_t min_version;
+    uint16_t max_version;
+    uint16_t version;
+    uint8_t response[32];
+    size_t response_len;
+    char msg[64];
+    error_code_t err;
+
+    err = decode_hello_request(message, len, &request_id, &min_version, &max_version);
+    if (err != ERR_NONE) {
+        fprintf(stderr, "invalid hello request: %d\n", err);
+        send_error_response(client_fd, 0, err, "invalid hello request");
+        return 0;
+    }
+
+    err = negotiate_version(min_version, max_version, &version);
+    if (err != ERR_NONE) {
+        fprintf(stderr, "no common protocol version: client speaks %u to %u\n",
+                (unsigned)min_version, (unsigned)max_version);
+        snprintf(msg, sizeof(msg), "compute speaks protocol versions %u to %u",
+                 (unsigned)MIN_SUPPORTED_VERSION, (unsigned)MAX_SUPPORTED_VERSION);
+        send_error_response(client_fd, request_id, err, msg);
+        return 0;
+    }
+
+    if (encode_hello_response(request_id, version, response, sizeof(response),
+                              &response_len) != ERR_NONE) {
+        send_error_response(client_fd, request_id, ERR_INTERNAL, "failed to answer hello");
+        return 0;
+    }
+    if (write_message(client_fd, response, response_len, 0) != 0) {
         return -1;
     }
+    return 0;
+}
+
+/**
+ * Message types compute accepts, as capabilities_t.request_types bits
+ */
+static const uint32_t accepted_request_types =
+    (1u << MSG_GENERATE_REQUEST) | (1u << MSG_PING) |
+    (1u << MSG_IMG2IMG_REQUEST) | (1u << MSG_INPAINT_REQUEST) |
+    (1u << MSG_UPSCALE_REQUEST) | (1u << MSG_MODELS_REQUEST) |
+    (1u << MSG_CONTROL_REQUEST) | (1u << MSG_CAPABILITIES_REQUEST) |
+    (1u << MSG_HELLO_REQUEST);
 
+/**
+ * handle_capabilities - Answer a capabilities request
+ *
+ * Reports the protocol versions and message types compute accepts, the
+ * largest image size, the GPU's memory and the models compute knows.
+ *
+ * @param client_fd  Client socket
+ * @param message    Complete capabilities request (header + payload)
+ * @param len        Length of message
+ * @return           0 to keep processing requests, -1 if the connection is gone
+ */
+static int handle_capabilities(int client_fd, const uint8_t *message, size_t len) {
+    uint64_t request_id;
+    model_info_t models[MODEL_COUNT];
+    capabilities_t caps;
+    /* Header, request ID, fixed fields, count, and the models */
+    uint8_t response[16 + 8 + 24 + 4 + MODEL_COUNT * (16 + MAX_MODEL_NAME_LENGTH)];
+    size_t response_len;
+
+    error_code_t err = decode_capabilities_request(message, len, &request_id);
+    if (err != ERR_NONE) {
+        fprintf(stderr, "invalid capabilities request: %d\n", err);
+        send_error_response(client_fd, 0, err, "invalid capabilities request");
+        return 0;
+    }
+
+    memset(&caps, 0, sizeof(caps));
+    caps.request_types = accepted_request_types;
+    caps.max_width = SD35_MAX_DIMENSION;
+    caps.max_height = SD35_MAX_DIMENSION;
+    if (sd_wrapper_get_vram(&caps.vram_total_mb, &caps.vram_free_mb) != SD_WRAPPER_OK) {
+        caps.vram_total_mb = 0;
+        caps.vram_free_mb = 0;
+    }
+    caps.model_count = model_list(loaded_model(), models, MODEL_COUNT);
+    caps.models = models;
+
+    if (encode_capabilities_response(request_id, &caps, response,
+                                     sizeof(response), &response_len) != ERR_NONE) {
+        send_error_response(client_fd, request_id, ERR_INTERNAL, "failed to report capabilities");
+        return 0;
+    }
+    if (write_message(client_fd, response, response_len, 0) != 0) {
+        return -1;
+    }
     return 0;
 }
 
+/**
+ * send_preview_frame - Send a preview frame of the current generation
+ *
+ * Preview handler for set_preview_handler(); data points to the client
+ * socket. Write errors are ignored: if the connection is gone, sending the
+ * response fails too and ends the request loop.
+ *
+ * @param frame  Preview frame to send
+ * @param data   Pointer to the client socket
+ */
+static void send_preview_frame(const preview_frame_t *frame, void *data) {
+    /* Frames are at most PREVIEW_MAX_DIMENSION square, RGB */
+    static uint8_t buffer[16 + 32 + PREVIEW_MAX_DIMENSION * PREVIEW_MAX_DIMENSION * 3];
+    size_t len;
+
+    if (encode_preview_frame(frame, buffer, sizeof(buffer), &len) != ERR_NONE) {
+        return;
+    }
+    (void)write_message(*(const int *)data, buffer, len, 0);
+}
+
 /**
  * handle_connection - Process a single request on a client connection
  *
@@ -358,7 +738,7 @@ static int send_error_response(int client_fd, uint64_t request_id,
  * 3. Processes generation request
  * 4. Encodes and sends response (reusing request buffer)
  *
- * Note: We reuse request_buf for the response to save memory (10MB).
+ * Note: We reuse request_buf for the response to save memory (20MB).
  * This is safe because we're done with the request data by the time we encode.
  *
  * Return value semantics:
@@ -378,11 +758,19 @@ static int handle_connection(int client_fd) {
     uint8_t *buffer = NULL;
     uint32_t magic;
     uint32_t payload_len;
+    uint16_t msg_type;
+    uint32_t flags;
     size_t total_size;
     sd35_generate_request_t req;
+    sd35_img2img_request_t img2img_req;
+    sd35_inpaint_request_t inpaint_req;
+    sd35_control_request_t control_req;
+    upscale_request_t upscale_req;
+    uint64_t request_id;
     sd35_generate_response_t resp;
     error_code_t err;
     size_t response_len;
+    char shm_name[SHARED_MEMORY_NAME_MAX];
 
     /*
      * Security: Read header into small stack buffer first, validate payload
@@ -401,6 +789,13 @@ static int handle_connection(int client_fd) {
         return -1;
     }
 
+    /* Responses to a request with a checksum get one too */
+    flags = (uint32_t)header[12] << 24 |
+            (uint32_t)header[13] << 16 |
+            (uint32_t)header[14] << 8 |
+            (uint32_t)header[15];
+    g_response_checksum = flags & HEADER_FLAG_CHECKSUM;
+
     /* Step 2: Validate magic number before any allocation */
     magic = (uint32_t)header[0] << 24 |
             (uint32_t)header[1] << 16 |
@@ -448,7 +843,61 @@ static int handle_connection(int client_fd) {
         }
     }
 
-    err = decode_generate_request(buffer, 16 + payload_len, &req);
+    /*
+     * Step 6: Check and remove the checksum. A corrupted request is
+     * answered with an error for the request ID it appears to have.
+     */
+    if (verify_checksum(buffer, &total_size) != ERR_NONE) {
+        fprintf(stderr, "request checksum mismatch\n");
+        request_id = 0;
+        if (payload_len >= 8) {
+            request_id = (uint64_t)buffer[16] << 56 | (uint64_t)buffer[17] << 48 |
+                         (uint64_t)buffer[18] << 40 | (uint64_t)buffer[19] << 32 |
+                         (uint64_t)buffer[20] << 24 | (uint64_t)buffer[21] << 16 |
+                         (uint64_t)buffer[22] << 8 | (uint64_t)buffer[23];
+        }
+        send_error_response(client_fd, request_id, ERR_CHECKSUM_MISMATCH, "checksum mismatch");
+        free(buffer);
+        /* Protocol error - send error response and continue processing */
+        return 0;
+    }
+    payload_len = (uint32_t)(total_size - 16);
+
+    /* Pings are answered without touching the model */
+    msg_type = (uint16_t)((uint16_t)header[6] << 8 | (uint16_t)header[7]);
+    if (msg_type == MSG_PING) {
+        int result = handle_ping(client_fd, buffer, total_size);
+        free(buffer);
+        return result;
+    }
+    if (msg_type == MSG_MODELS_REQUEST) {
+        int result = handle_models(client_fd, buffer, total_size);
+        free(buffer);
+        return result;
+    }
+    if (msg_type == MSG_CAPABILITIES_REQUEST) {
+        int result = handle_capabilities(client_fd, buffer, total_size);
+        free(buffer);
+        return result;
+    }
+    if (msg_type == MSG_HELLO_REQUEST) {
+        int result = handle_hello(client_fd, buffer, total_size);
+        free(buffer);
+        return result;
+    }
+
+    /* img2img, inpaint and control requests carry images after the prompt data */
+    if (msg_type == MSG_IMG2IMG_REQUEST) {
+        err = decode_img2img_request(buffer, 16 + payload_len, &img2img_req);
+    } else if (msg_type == MSG_INPAINT_REQUEST) {
+        err = decode_inpaint_request(buffer, 16 + payload_len, &inpaint_req);
+    } else if (msg_type == MSG_CONTROL_REQUEST) {
+        err = decode_control_request(buffer, 16 + payload_len, &control_req);
+    } else if (msg_type == MSG_UPSCALE_REQUEST) {
+        err = decode_upscale_request(buffer, 16 + payload_len, &upscale_req);
+    } else {
+        err = decode_generate_request(buffer, 16 + payload_len, &req);
+    }
     if (err != ERR_NONE) {
         fprintf(stderr, "failed to decode request: %d\n", err);
         send_error_response(client_fd, 0, err, "invalid request");
@@ -459,22 +908,60 @@ static int handle_connection(int client_fd) {
 
     memset(&resp, 0, sizeof(resp));
 
-    err = process_generate_request(g_sd_ctx, &req, &resp);
+    if (msg_type == MSG_IMG2IMG_REQUEST) {
+        request_id = img2img_req.base.request_id;
+        err = process_img2img_request(g_sd_ctx, &img2img_req, &resp);
+    } else if (msg_type == MSG_INPAINT_REQUEST) {
+        request_id = inpaint_req.base.base.request_id;
+        err = process_inpaint_request(g_sd_ctx, &inpaint_req, &resp);
+    } else if (msg_type == MSG_CONTROL_REQUEST) {
+        request_id = control_req.base.request_id;
+        err = process_control_request(g_sd_ctx, &control_req, &resp);
+    } else if (msg_type == MSG_UPSCALE_REQUEST) {
+        request_id = upscale_req.request_id;
+        err = process_upscale_request(g_sd_ctx, &upscale_req, &resp);
+    } else {
+        request_id = req.request_id;
+        err = process_generate_request(g_sd_ctx, &req, &resp);
+    }
     if (err != ERR_NONE) {
         fprintf(stderr, "generation failed: %d\n", err);
-        send_error_response(client_fd, req.request_id, err, "generation failed");
+        send_error_response(client_fd, request_id, err,
+                            err == ERR_MODEL_UNAVAILABLE ? "model not available" :
+                            err == ERR_CONTROLNET_UNAVAILABLE ? "controlnet not available" :
+                            "generation failed");
         free(buffer);
         /* Generation error - send error response and continue processing */
         return 0;
     }
 
+    /*
+     * Weave that can read the image from shared memory says so in the
+     * request header. If the segment cannot be created the image is sent
+     * inline as usual.
+     */
+    if ((flags & HEADER_FLAG_SHARED_MEMORY) != 0 && g_shm_dir[0] != '\0' &&
+        socket_share_data(g_shm_dir, resp.image_data, resp.image_data_len,
+                          shm_name, sizeof(shm_name)) == SOCKET_OK) {
+        resp.shm_name = shm_name;
+    }
+    /* Only weave that asked for the seed expects it after the image */
+    if ((flags & HEADER_FLAG_SEED) == 0) {
+        resp.seed = 0;
+    }
+    if ((flags & HEADER_FLAG_METADATA) == 0) {
+        resp.has_metadata = false;
+    }
+
     /*
      * Response may be larger than request (contains image data).
      * Reallocate buffer to hold the response.
-     * Response size = header (16) + response metadata (16) + image metadata (16) + image data.
+     * Response size = header (16) + response metadata (16) + image metadata (16) + image data
+     * + seed (8) + generation metadata (3 strings with their lengths, 12).
      */
     {
-        size_t response_buf_size = 16 + 16 + 16 + resp.image_data_len;
+        size_t response_buf_size = 16 + 16 + 16 + resp.image_data_len + 8 +
+                                   3 * (2 + GENERATION_METADATA_STRING_MAX) + 12;
         uint8_t *response_buf = realloc(buffer, response_buf_size);
         if (response_buf == NULL) {
             fprintf(stderr, "failed to allocate response buffer (%zu bytes)\n",
@@ -497,7 +984,9 @@ static int handle_connection(int client_fd) {
         return -1;
     }
 
-    if (write_full(client_fd, buffer, response_len) != 0) {
+    /* Weave that reads responses in frames says so in the request header */
+    if (write_message(client_fd, buffer, response_len,
+                      (flags & HEADER_FLAG_CHUNKED) != 0) != 0) {
         /* Connection closed or I/O error - exit loop */
         free(buffer);
         return -1;
@@ -508,6 +997,46 @@ static int handle_connection(int client_fd) {
     return 0;
 }
 
+/**
+ * serve_remote - Serve weave on other machines for --listen
+ *
+ * Accepts one weave connection at a time, authenticated by token, and
+ * processes its requests until it disconnects, like a spawned compute
+ * does on its socket. Runs until shutdown is requested.
+ *
+ * @param listen_fd  Socket from socket_listen_tcp()
+ * @param token      Token weave must send first
+ * @return           SOCKET_OK on shutdown, error code if accept() failed
+ */
+static socket_error_t serve_remote(int listen_fd, const char *token) {
+    while (!socket_is_shutdown_requested()) {
+        int client_fd = accept(listen_fd, NULL, NULL);
+        if (client_fd < 0) {
+            if (errno == EINTR) {
+                continue;
+            }
+            fprintf(stderr, "accept() failed: %s\n", strerror(errno));
+            return SOCKET_ERR_ACCEPT_FAILED;
+        }
+        if (socket_auth_token(client_fd, token) != SOCKET_OK) {
+            fprintf(stderr, "rejected connection with an invalid token\n");
+            close(client_fd);
+            continue;
+        }
+        /* Requests may be minutes apart; weave's heartbeat keeps it alive */
+        socket_set_timeouts(client_fd, 0, 0);
+
+        fprintf(stderr, "weave connected\n");
+        set_preview_handler(send_preview_frame, &client_fd);
+        while (!socket_is_shutdown_requested() && handle_connection(client_fd) == 0) {
+        }
+        set_preview_handler(NULL, NULL);
+        close(client_fd);
+        fprintf(stderr, "weave disconnected\n");
+    }
+    return SOCKET_OK;
+}
+
 /**
  * cleanup - Clean up resources before exit
  */
@@ -537,22 +1066,43 @@ int main(int argc, char *argv[]) {
     int exit_code = EXIT_FAILURE;
     socket_error_t err;
     const char *custom_socket_path = NULL;
+    const char *listen_address = NULL;
+    const char *token = NULL;
+    const char *lora_dir = NULL;
+    const char *gpu = NULL;
+    int list_only = 0;
     char socket_path[SOCKET_PATH_MAX];
     int opt;
 
     /* Long options for getopt_long */
     static struct option long_options[] = {
         {"socket-path", required_argument, 0, 's'},
+        {"listen",      required_argument, 0, 'A'},
+        {"lora-dir",    required_argument, 0, 'l'},
+        {"gpu",         required_argument, 0, 'g'},
+        {"list-gpus",   no_argument,       0, 'L'},
         {"help",        no_argument,       0, 'h'},
         {0, 0, 0, 0}
     };
 
     /* Parse command line arguments */
-    while ((opt = getopt_long(argc, argv, "hs:", long_options, NULL)) != -1) {
+    while ((opt = getopt_long(argc, argv, "hs:A:l:g:L", long_options, NULL)) != -1) {
         switch (opt) {
         case 's':
             custom_socket_path = optarg;
             break;
+        case 'A':
+            listen_address = optarg;
+            break;
+        case 'l':
+            lora_dir = optarg;
+            break;
+        case 'g':
+            gpu = optarg;
+            break;
+        case 'L':
+            list_only = 1;
+            break;
         case 'h':
             print_usage(argv[0], 0);
             break;
@@ -578,39 +1128,87 @@ int main(int argc, char *argv[]) {
         }
     }
 
+    /*
+     * --listen accepts weave over the network, so it needs a token that
+     * can't be guessed.
+     */
+    if (listen_address != NULL) {
+        if (custom_socket_path != NULL) {
+            fprintf(stderr, "error: --listen and --socket-path are mutually exclusive\n");
+            return EXIT_FAILURE;
+        }
+        token = getenv(SOCKET_TOKEN_ENV);
+        if (token == NULL || strlen(token) < SOCKET_TOKEN_MIN_LEN) {
+            fprintf(stderr, "error: --listen requires %s with at least %d characters\n",
+                    SOCKET_TOKEN_ENV, SOCKET_TOKEN_MIN_LEN);
+            return EXIT_FAILURE;
+        }
+    }
+
+    /*
+     * Restrict ggml to the chosen GPU before anything initializes Vulkan.
+     * --list-gpus lists every device ggml sees.
+     */
+    if (list_only) {
+        return list_gpus();
+    }
+    if (gpu != NULL) {
+        if (!valid_gpu_index(gpu)) {
+            fprintf(stderr, "error: --gpu must be a device index, got '%s'\n", gpu);
+            return EXIT_FAILURE;
+        }
+        if (setenv(GPU_DEVICE_ENV, gpu, 1) != 0) {
+            fprintf(stderr, "error: failed to select GPU %s: %s\n", gpu, strerror(errno));
+            return EXIT_FAILURE;
+        }
+    }
+
     fprintf(stderr, "weave-compute starting...\n");
+    if (gpu != NULL) {
+        fprintf(stderr, "generating on GPU %s\n", gpu);
+    }
 
     if (setup_signals() != 0) {
         fprintf(stderr, "failed to set up signal handlers\n");
         return EXIT_FAILURE;
     }
 
-    fprintf(stderr, "loading model from %s...\n", MODEL_PATH);
+    if (lora_dir != NULL && lora_dir[0] != '\0') {
+        model_set_lora_dir(lora_dir);
+        fprintf(stderr, "loading LoRAs from %s\n", lora_dir);
+    }
+
+    const model_entry_t *startup_model = model_lookup(STARTUP_MODEL_ID);
+    fprintf(stderr, "loading model from %s...\n", startup_model->model_path);
     sd_wrapper_config_t config;
-    sd_wrapper_config_init(&config);
-    config.model_path = MODEL_PATH;
-    config.clip_l_path = CLIP_L_PATH;
-    config.clip_g_path = CLIP_G_PATH;
-    config.t5xxl_path = T5XXL_PATH;
-    config.n_threads = -1;
-    config.keep_clip_on_cpu = true;   /* Text encoders on CPU to save VRAM */
-    config.keep_vae_on_cpu = false;
-    config.enable_flash_attn = true;
+    model_config(startup_model, &config);
 
     g_sd_ctx = sd_wrapper_create(&config);
     if (g_sd_ctx == NULL) {
-        fprintf(stderr, "failed to load model: %s\n", MODEL_PATH);
+        fprintf(stderr, "failed to load model: %s\n", startup_model->model_path);
         fprintf(stderr, "ensure model file exists and is a valid SD 3.5 Medium model\n");
         return EXIT_FAILURE;
     }
+    set_loaded_model(STARTUP_MODEL_ID);
 
     fprintf(stderr, "model loaded successfully\n");
 
     /*
-     * Socket initialization: connect to existing socket if path is provided,
-     * otherwise create our own socket (backward compatibility).
+     * Socket initialization: listen for remote weave with --listen, connect
+     * to existing socket if path is provided, otherwise create our own
+     * socket (backward compatibility).
      */
-    if (custom_socket_path != NULL) {
+    if (listen_address != NULL) {
+        err = socket_listen_tcp(listen_address, &g_socket_fd);
+        if (err != SOCKET_OK) {
+            fprintf(stderr, "failed to listen on %s: %s\n", listen_address, socket_error_string(err));
+            cleanup();
+            return EXIT_FAILURE;
+        }
+        fprintf(stderr, "listening on %s%s\n", SOCKET_TCP_PREFIX, listen_address);
+        /* A weave that disconnects mid-response must not kill compute */
+        signal(SIGPIPE, SIG_IGN);
+    } else if (custom_socket_path != NULL) {
         /* Connect to existing socket created by weave */
         err = socket_connect(custom_socket_path, &g_socket_fd);
         if (err != SOCKET_OK) {
@@ -622,6 +1220,18 @@ int main(int argc, char *argv[]) {
         g_socket_owned = 0; /* Socket owned by parent process */
         snprintf(socket_path, sizeof(socket_path), "%s", custom_socket_path);
         fprintf(stderr, "connected to socket: %s\n", socket_path);
+
+        /* Shared memory segments go next to the socket; over TCP there is none */
+        if (strncmp(socket_path, SOCKET_TCP_PREFIX, strlen(SOCKET_TCP_PREFIX)) != 0) {
+            char *slash;
+            snprintf(g_shm_dir, sizeof(g_shm_dir), "%s", socket_path);
+            slash = strrchr(g_shm_dir, '/');
+            if (slash != NULL) {
+                *slash = '\0';
+            } else {
+                snprintf(g_shm_dir, sizeof(g_shm_dir), ".");
+            }
+        }
     } else {
         /* Create and own the socket (backward compatibility) */
         err = socket_create(&g_socket_fd);
@@ -637,13 +1247,30 @@ int main(int argc, char *argv[]) {
             snprintf(socket_path, sizeof(socket_path), "(unknown)");
         }
         fprintf(stderr, "listening on %s\n", socket_path);
+
+        if (socket_get_dir_path(g_shm_dir, sizeof(g_shm_dir)) != SOCKET_OK) {
+            g_shm_dir[0] = '\0';
+        }
     }
 
     /*
-     * Connection mode: client mode (connected to existing socket) or
-     * server mode (created own socket and accepting connections).
+     * Connection mode: remote mode (weave connects over TCP), client mode
+     * (connected to existing socket) or server mode (created own socket and
+     * accepting connections).
      */
-    if (custom_socket_path != NULL) {
+    if (listen_address != NULL) {
+        /*
+         * Remote mode: weave runs on another machine, so there is no parent
+         * whose stdin to monitor; signals stop compute.
+         */
+        err = serve_remote(g_socket_fd, token);
+        if (err == SOCKET_OK) {
+            fprintf(stderr, "shutting down gracefully\n");
+            exit_code = EXIT_SUCCESS;
+        } else {
+            fprintf(stderr, "accept loop failed: %s\n", socket_error_string(err));
+        }
+    } else if (custom_socket_path != NULL) {
         /*
          * Client mode: Run request/response loop on the connected socket.
          * The socket is already connected from socket_connect() above.
@@ -701,6 +1328,9 @@ int main(int argc, char *argv[]) {
             fprintf(stderr, "stdin monitor thread started\n");
         }
 
+        /* Stream previews of generations to weave as they form */
+        set_preview_handler(send_preview_frame, &g_socket_fd);
+
         fprintf(stderr, "entering request/response loop\n");
 
         while (!socket_is_shutdown_requested()) {
@@ -0,0 +1,205 @@
+/**
+ * Weave Compute - Model Registry Implementation
+ *
+ * Model files are looked up in ./config/models/ (see docs/DEVELOPMENT.md
+ * for where to get them). SD 3.5 Medium and Flux take their text encoders
+ * as separate files; the SDXL checkpoint includes its own. Only SDXL has
+ * ControlNets that stable-diffusion.cpp can load.
+ */
+
+#define _POSIX_C_SOURCE 200112L
+#include <stddef.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <unistd.h>
+#include "weave/models.h"
+#include "weave/sha256.h"
+
+/**
+ * ESRGAN upscaler model, loaded on the first upscale request. Upscale
+ * requests fail with ERR_UPSCALER_UNAVAILABLE if it is missing.
+ */
+#define UPSCALER_PATH "./config/models/RealESRGAN_x4plus.pth"
+
+/** Text encoders shared by SD 3.5 and Flux */
+#define CLIP_L_PATH "./config/models/clip_l.safetensors"
+#define CLIP_G_PATH "./config/models/clip_g.safetensors"
+#define T5XXL_PATH "./config/models/t5xxl_fp8_e4m3fn.safetensors"
+
+/** File extensions LoRAs are looked up with, in order */
+static const char *const lora_extensions[] = {".safetensors", ".ckpt", ".gguf"};
+
+/** Directory LoRAs are loaded from (NULL if LoRAs are disabled) */
+static const char *lora_dir = NULL;
+
+/**
+ * Known models, indexed by model ID.
+ *
+ * VRAM figures are for FP16 weights with the text encoders kept on the
+ * CPU, as model_config() sets up.
+ */
+static const model_entry_t models[MODEL_COUNT] = {
+    {
+        .model_id = MODEL_ID_SD35,
+        .name = "sd3.5-medium",
+        .model_path = "./config/models/sd3.5_medium.safetensors",
+        .clip_l_path = CLIP_L_PATH,
+        .clip_g_path = CLIP_G_PATH,
+        .t5xxl_path = T5XXL_PATH,
+        .vram_mb = 6000,
+    },
+    {
+        .model_id = MODEL_ID_SDXL,
+        .name = "sdxl-base-1.0",
+        .model_path = "./config/models/sd_xl_base_1.0.safetensors",
+        .vram_mb = 7000,
+        .control_net_paths = {
+            [CONTROL_TYPE_CANNY] = "./config/models/controlnet-canny-sdxl-1.0.safetensors",
+            [CONTROL_TYPE_DEPTH] = "./config/models/controlnet-depth-sdxl-1.0.safetensors",
+            [CONTROL_TYPE_POSE] = "./config/models/controlnet-openpose-sdxl-1.0.safetensors",
+        },
+    },
+    {
+        .model_id = MODEL_ID_FLUX,
+        .name = "flux1-schnell",
+        .diffusion_model_path = "./config/models/flux1-schnell-q8_0.gguf",
+        .clip_l_path = CLIP_L_PATH,
+        .t5xxl_path = T5XXL_PATH,
+        .vae_path = "./config/models/ae.safetensors",
+        .vram_mb = 11000,
+    },
+};
+
+const model_entry_t *model_lookup(uint32_t model_id) {
+    if (model_id >= MODEL_COUNT) {
+        return NULL;
+    }
+    return &models[model_id];
+}
+
+/**
+ * Check that path is NULL (unused) or a readable file.
+ */
+static bool path_ok(const char *path) {
+    return path == NULL || access(path, R_OK) == 0;
+}
+
+bool model_available(const model_entry_t *entry) {
+    if (entry == NULL) {
+        return false;
+    }
+    return path_ok(entry->model_path) &&
+           path_ok(entry->diffusion_model_path) &&
+           path_ok(entry->clip_l_path) &&
+           path_ok(entry->clip_g_path) &&
+           path_ok(entry->t5xxl_path) &&
+           path_ok(entry->vae_path);
+}
+
+const char *model_control_net(const model_entry_t *entry, uint32_t control_type) {
+    if (entry == NULL || control_type >= CONTROL_TYPE_COUNT) {
+        return NULL;
+    }
+    const char *path = entry->control_net_paths[control_type];
+    if (path == NULL || access(path, R_OK) != 0) {
+        return NULL;
+    }
+    return path;
+}
+
+void model_set_lora_dir(const char *dir) {
+    lora_dir = dir;
+}
+
+bool lora_available(const char *name) {
+    char path[4096];
+
+    if (lora_dir == NULL || name == NULL) {
+        return false;
+    }
+
+    for (size_t i = 0; i < sizeof(lora_extensions) / sizeof(lora_extensions[0]); i++) {
+        int n = snprintf(path, sizeof(path), "%s/%s%s", lora_dir, name, lora_extensions[i]);
+        if (n > 0 && (size_t)n < sizeof(path) && access(path, R_OK) == 0) {
+            return true;
+        }
+    }
+    return false;
+}
+
+void model_config(const model_entry_t *entry, sd_wrapper_config_t *config) {
+    sd_wrapper_config_init(config);
+    config->model_path = entry->model_path;
+    config->diffusion_model_path = entry->diffusion_model_path;
+    config->clip_l_path = entry->clip_l_path;
+    config->clip_g_path = entry->clip_g_path;
+    config->t5xxl_path = entry->t5xxl_path;
+    config->vae_path = entry->vae_path;
+    config->upscaler_path = UPSCALER_PATH;
+    config->lora_model_dir = lora_dir;
+    config->n_threads = -1;
+    config->keep_clip_on_cpu = true;   /* Text encoders on CPU to save VRAM */
+    config->keep_vae_on_cpu = false;
+    config->enable_flash_attn = true;
+}
+
+bool model_hash(const model_entry_t *entry, char *out) {
+    static const char hex[] = "0123456789abcdef";
+    uint8_t chunk[MODEL_HASH_CHUNK];
+    uint8_t digest[SHA256_DIGEST_SIZE];
+    sha256_ctx_t sha;
+
+    if (entry == NULL || out == NULL) {
+        return false;
+    }
+    const char *path = entry->model_path != NULL ? entry->model_path : entry->diffusion_model_path;
+    FILE *f = fopen(path, "rb");
+    if (f == NULL) {
+        return false;
+    }
+    /* A file shorter than the offset hashes no bytes, as the web UI does */
+    size_t n = 0;
+    if (fseek(f, MODEL_HASH_OFFSET, SEEK_SET) == 0) {
+        n = fread(chunk, 1, sizeof(chunk), f);
+    }
+    bool ok = ferror(f) == 0;
+    fclose(f);
+    if (!ok) {
+        return false;
+    }
+
+    sha256_init(&sha);
+    sha256_update(&sha, chunk, n);
+    sha256_final(&sha, digest);
+    for (int i = 0; i < MODEL_HASH_LENGTH / 2; i++) {
+        out[i * 2] = hex[digest[i] >> 4];
+        out[i * 2 + 1] = hex[digest[i] & 0xF];
+    }
+    out[MODEL_HASH_LENGTH] = '\0';
+    return true;
+}
+
+uint32_t model_list(uint32_t loaded_id, model_info_t *out, uint32_t max) {
+    uint32_t count = 0;
+
+    if (out == NULL) {
+        return 0;
+    }
+
+    for (uint32_t i = 0; i < MODEL_COUNT && count < max; i++) {
+        const model_entry_t *entry = &models[i];
+        out[count].model_id = entry->model_id;
+        out[count].vram_mb = entry->vram_mb;
+        out[count].name = entry->name;
+        if (entry->model_id == loaded_id) {
+            out[count].status = MODEL_STATUS_LOADED;
+        } else if (model_available(entry)) {
+            out[count].status = MODEL_STATUS_AVAILABLE;
+        } else {
+            out[count].status = MODEL_STATUS_MISSING;
+        }
+        count++;
+    }
+
+    return count;
+}
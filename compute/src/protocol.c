@@ -14,6 +14,7 @@
  * Specification: docs/protocol/SPEC.md, docs/protocol/SPEC_SD35.md
  */
 
+#include <stdbool.h>
 #include <stdint.h>
 #include <stddef.h>
 #include <string.h>
@@ -86,10 +87,12 @@ static inline void write_u64_be(uint8_t *buf, uint64_t value) {
  *
  * @param data      Input buffer (must be at least 16 bytes)
  * @param data_len  Size of input buffer
+ * @param msg_type  Expected message type
  * @param header    Output header structure
  * @return          ERR_NONE on success, error code on failure
  */
 static error_code_t decode_protocol_header(const uint8_t *data, size_t data_len,
+                                           uint16_t msg_type,
                                            protocol_header_t *header) {
     if (data_len < 16) {
         return ERR_INTERNAL;
@@ -110,7 +113,7 @@ static error_code_t decode_protocol_header(const uint8_t *data, size_t data_len,
         return ERR_UNSUPPORTED_VERSION;
     }
 
-    if (header->msg_type != MSG_GENERATE_REQUEST) {
+    if (header->msg_type != msg_type) {
         return ERR_INTERNAL;
     }
 
@@ -121,6 +124,231 @@ static error_code_t decode_protocol_header(const uint8_t *data, size_t data_len,
     return ERR_NONE;
 }
 
+/**
+ * decode_sd35_params - Decode and validate the SD 3.5 request fields
+ *
+ * Reads the request ID, model ID and the 48 bytes of SD 3.5 parameters at
+ * the start of a generation or img2img payload, and validates them against
+ * the given prompt data.
+ *
+ * @param payload          Payload (at least 12 + 48 bytes)
+ * @param prompt_data      Prompt data referenced by the offset table
+ * @param prompt_data_len  Size of prompt_data
+ * @param req              Output request structure (populated on success)
+ * @return                 ERR_NONE on success, error code on failure
+ */
+static error_code_t decode_sd35_params(const uint8_t *payload,
+                                       const uint8_t *prompt_data,
+                                       size_t prompt_data_len,
+                                       sd35_generate_request_t *req) {
+    const uint8_t *ptr = payload;
+
+    req->request_id = read_u64_be(ptr);
+    ptr += 8;
+
+    req->model_id = read_u32_be(ptr);
+    ptr += 4;
+
+    /* All models take the SD 3.5 parameters; compute picks the weights */
+    if (req->model_id >= MODEL_COUNT) {
+        return ERR_INVALID_MODEL_ID;
+    }
+
+    req->width = read_u32_be(ptr);
+    ptr += 4;
+
+    req->height = read_u32_be(ptr);
+    ptr += 4;
+
+    req->steps = read_u32_be(ptr);
+    ptr += 4;
+
+    req->cfg_scale = read_f32_be(ptr);
+    ptr += 4;
+
+    req->seed = read_u64_be(ptr);
+    ptr += 8;
+
+    req->clip_l_offset = read_u32_be(ptr);
+    ptr += 4;
+
+    req->clip_l_length = read_u32_be(ptr);
+    ptr += 4;
+
+    req->clip_g_offset = read_u32_be(ptr);
+    ptr += 4;
+
+    req->clip_g_length = read_u32_be(ptr);
+    ptr += 4;
+
+    req->t5_offset = read_u32_be(ptr);
+    ptr += 4;
+
+    req->t5_length = read_u32_be(ptr);
+
+    req->prompt_data = prompt_data;
+    req->prompt_data_len = prompt_data_len;
+
+    if (req->width < SD35_MIN_DIMENSION || req->width > SD35_MAX_DIMENSION ||
+        req->width % SD35_DIMENSION_ALIGNMENT != 0) {
+        return ERR_INVALID_DIMENSIONS;
+    }
+
+    if (req->height < SD35_MIN_DIMENSION || req->height > SD35_MAX_DIMENSION ||
+        req->height % SD35_DIMENSION_ALIGNMENT != 0) {
+        return ERR_INVALID_DIMENSIONS;
+    }
+
+    if (req->steps < SD35_MIN_STEPS || req->steps > SD35_MAX_STEPS) {
+        return ERR_INVALID_STEPS;
+    }
+
+    if (req->cfg_scale < SD35_MIN_CFG || req->cfg_scale > SD35_MAX_CFG ||
+        isnan(req->cfg_scale) || isinf(req->cfg_scale)) {
+        return ERR_INVALID_CFG;
+    }
+
+    if (req->clip_l_length < SD35_MIN_PROMPT_LENGTH ||
+        req->clip_l_length > SD35_MAX_PROMPT_LENGTH) {
+        return ERR_INVALID_PROMPT;
+    }
+
+    if (req->clip_g_length < SD35_MIN_PROMPT_LENGTH ||
+        req->clip_g_length > SD35_MAX_PROMPT_LENGTH) {
+        return ERR_INVALID_PROMPT;
+    }
+
+    if (req->t5_length < SD35_MIN_PROMPT_LENGTH ||
+        req->t5_length > SD35_MAX_PROMPT_LENGTH) {
+        return ERR_INVALID_PROMPT;
+    }
+
+    if (req->clip_l_offset > req->prompt_data_len) {
+        return ERR_INVALID_PROMPT;
+    }
+
+    if (req->clip_l_length > req->prompt_data_len - req->clip_l_offset) {
+        return ERR_INVALID_PROMPT;
+    }
+
+    if (req->clip_g_offset > req->prompt_data_len) {
+        return ERR_INVALID_PROMPT;
+    }
+
+    if (req->clip_g_length > req->prompt_data_len - req->clip_g_offset) {
+        return ERR_INVALID_PROMPT;
+    }
+
+    if (req->t5_offset > req->prompt_data_len) {
+        return ERR_INVALID_PROMPT;
+    }
+
+    if (req->t5_length > req->prompt_data_len - req->t5_offset) {
+        return ERR_INVALID_PROMPT;
+    }
+
+    return ERR_NONE;
+}
+
+/**
+ * lora_name_valid - Check a LoRA name from the wire
+ *
+ * Names are file names without extension, so they may not contain path
+ * separators or start with '.'.
+ */
+static bool lora_name_valid(const uint8_t *name, uint32_t len) {
+    if (len == 0 || len > MAX_LORA_NAME_LENGTH || name[0] == '.') {
+        return false;
+    }
+    for (uint32_t i = 0; i < len; i++) {
+        uint8_t c = name[i];
+        if (!((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+              (c >= '0' && c <= '9') || c == '.' || c == '_' || c == '-')) {
+            return false;
+        }
+    }
+    return true;
+}
+
+/**
+ * decode_lora_section - Decode the header flags and the LoRA section of a
+ * request
+ *
+ * Sets req->vae_tiling from HEADER_FLAG_VAE_TILING and req->priority from
+ * HEADER_PRIORITY_MASK. If the header does not
+ * have HEADER_FLAG_LORAS, the request has no LoRA section and
+ * req->lora_count is set to 0.
+ *
+ * @param header       Decoded header
+ * @param data         Start of the LoRA section
+ * @param data_len     Bytes left in the payload from data
+ * @param req          Output request structure (loras and lora_count)
+ * @param section_len  Output size of the LoRA section
+ * @return             ERR_NONE on success, ERR_INVALID_LORA for a bad
+ *                     count, name or weight, ERR_INTERNAL if truncated,
+ *                     for unknown flags or an unknown priority
+ */
+static error_code_t decode_lora_section(const protocol_header_t *header,
+                                        const uint8_t *data, size_t data_len,
+                                        sd35_generate_request_t *req,
+                                        size_t *section_len) {
+    req->lora_count = 0;
+    req->vae_tiling = false;
+    req->priority = PRIORITY_NORMAL;
+    *section_len = 0;
+
+    if ((header->reserved & ~(uint32_t)HEADER_FLAGS_SUPPORTED) != 0) {
+        return ERR_INTERNAL;
+    }
+    uint32_t priority = (header->reserved & HEADER_PRIORITY_MASK) >> HEADER_PRIORITY_SHIFT;
+    if (priority > PRIORITY_HIGH) {
+        return ERR_INTERNAL;
+    }
+    req->priority = (uint8_t)priority;
+    req->vae_tiling = (header->reserved & HEADER_FLAG_VAE_TILING) != 0;
+    if ((header->reserved & HEADER_FLAG_LORAS) == 0) {
+        return ERR_NONE;
+    }
+
+    if (data_len < 4) {
+        return ERR_INTERNAL;
+    }
+    uint32_t count = read_u32_be(data);
+    size_t pos = 4;
+    if (count > MAX_LORAS) {
+        return ERR_INVALID_LORA;
+    }
+
+    for (uint32_t i = 0; i < count; i++) {
+        if (data_len - pos < 8) {
+            return ERR_INTERNAL;
+        }
+        float weight = read_f32_be(data + pos);
+        uint32_t name_len = read_u32_be(data + pos + 4);
+        pos += 8;
+        if (name_len > data_len - pos) {
+            return ERR_INTERNAL;
+        }
+
+        /* Written as a negation so NaN is rejected too */
+        if (!(weight >= MIN_LORA_WEIGHT && weight <= MAX_LORA_WEIGHT)) {
+            return ERR_INVALID_LORA;
+        }
+        if (!lora_name_valid(data + pos, name_len)) {
+            return ERR_INVALID_LORA;
+        }
+
+        memcpy(req->loras[i].name, data + pos, name_len);
+        req->loras[i].name[name_len] = '\0';
+        req->loras[i].weight = weight;
+        pos += name_len;
+    }
+
+    req->lora_count = count;
+    *section_len = pos;
+    return ERR_NONE;
+}
+
 /**
  * decode_generate_request - Decode and validate SD 3.5 generation request
  *
@@ -133,6 +361,7 @@ static error_code_t decode_protocol_header(const uint8_t *data, size_t data_len,
  * - Request ID (8 bytes)
  * - Model ID (4 bytes)
  * - SD 3.5 parameters (48 bytes)
+ * - LoRA section (variable, only with HEADER_FLAG_LORAS)
  * - Prompt data (variable)
  *
  * @param data      Input buffer containing complete message
@@ -143,11 +372,12 @@ static error_code_t decode_protocol_header(const uint8_t *data, size_t data_len,
  * Error codes:
  * - ERR_INVALID_MAGIC: Magic number mismatch
  * - ERR_UNSUPPORTED_VERSION: Protocol version not supported
- * - ERR_INVALID_MODEL_ID: model_id is not 0 (SD 3.5)
+ * - ERR_INVALID_MODEL_ID: model_id is not below MODEL_COUNT
  * - ERR_INVALID_DIMENSIONS: width/height out of range or not aligned
  * - ERR_INVALID_STEPS: steps out of range
  * - ERR_INVALID_CFG: cfg_scale out of range, NaN, or Inf
  * - ERR_INVALID_PROMPT: prompt offset/length out of bounds
+ * - ERR_INVALID_LORA: too many LoRAs, or a bad LoRA name or weight
  * - ERR_INTERNAL: Truncated message or other structural error
  */
 error_code_t decode_generate_request(const uint8_t *data, size_t data_len,
@@ -161,7 +391,7 @@ error_code_t decode_generate_request(const uint8_t *data, size_t data_len,
     }
 
     protocol_header_t header;
-    error_code_t err = decode_protocol_header(data, data_len, &header);
+    error_code_t err = decode_protocol_header(data, data_len, MSG_GENERATE_REQUEST, &header);
     if (err != ERR_NONE) {
         return err;
     }
@@ -174,119 +404,361 @@ error_code_t decode_generate_request(const uint8_t *data, size_t data_len,
         return ERR_INTERNAL;
     }
 
-    const uint8_t *ptr = data + 16;
-    size_t remaining = header.payload_len;
+    const uint8_t *ptr = data + 16 + 12 + 48;
+    size_t remaining = header.payload_len - 12 - 48;
+    size_t lora_len;
+    err = decode_lora_section(&header, ptr, remaining, req, &lora_len);
+    if (err != ERR_NONE) {
+        return err;
+    }
 
-    req->request_id = read_u64_be(ptr);
-    ptr += 8;
-    remaining -= 8;
+    return decode_sd35_params(data + 16, ptr + lora_len, remaining - lora_len, req);
+}
 
-    req->model_id = read_u32_be(ptr);
-    ptr += 4;
-    remaining -= 4;
+/**
+ * decode_init_image_request - Decode the parts img2img and inpaint share
+ *
+ * Inpaint requests carry a mask_data_len after init_data_len and the mask
+ * after the init image; for them mask_data_len and mask_data are filled in.
+ * Both are NULL for img2img requests.
+ *
+ * @param data           Input buffer containing complete message
+ * @param data_len       Size of input buffer
+ * @param msg_type       MSG_IMG2IMG_REQUEST or MSG_INPAINT_REQUEST
+ * @param req            Output request structure (populated on success)
+ * @param mask_data_len  Output mask size (inpaint only, else NULL)
+ * @param mask_data      Output mask pointer (inpaint only, else NULL)
+ * @return               ERR_NONE on success, error code on failure
+ */
+static error_code_t decode_init_image_request(const uint8_t *data, size_t data_len,
+                                              uint16_t msg_type,
+                                              sd35_img2img_request_t *req,
+                                              uint32_t *mask_data_len,
+                                              const uint8_t **mask_data) {
+    if (data == NULL || req == NULL) {
+        return ERR_INTERNAL;
+    }
 
-    if (req->model_id != MODEL_ID_SD35) {
-        return ERR_INVALID_MODEL_ID;
+    if (data_len < 16) {
+        return ERR_INTERNAL;
+    }
+
+    protocol_header_t header;
+    error_code_t err = decode_protocol_header(data, data_len, msg_type, &header);
+    if (err != ERR_NONE) {
+        return err;
     }
 
-    if (remaining < 48) {
+    if (data_len < 16 + header.payload_len) {
         return ERR_INTERNAL;
     }
 
-    req->width = read_u32_be(ptr);
-    ptr += 4;
+    /* strength, init_channels, init_data_len, and mask_data_len if inpaint */
+    size_t fields_len = (mask_data != NULL) ? 16 : 12;
+    if (header.payload_len < 12 + 48 + fields_len) {
+        return ERR_INTERNAL;
+    }
 
-    req->height = read_u32_be(ptr);
-    ptr += 4;
+    const uint8_t *ptr = data + 16 + 12 + 48;
+    req->strength = read_f32_be(ptr);
+    req->init_channels = read_u32_be(ptr + 4);
+    req->init_data_len = read_u32_be(ptr + 8);
 
-    req->steps = read_u32_be(ptr);
-    ptr += 4;
+    size_t remaining = header.payload_len - 12 - 48 - fields_len;
+    size_t lora_len;
+    err = decode_lora_section(&header, ptr + fields_len, remaining, &req->base, &lora_len);
+    if (err != ERR_NONE) {
+        return err;
+    }
+    remaining -= lora_len;
 
-    req->cfg_scale = read_f32_be(ptr);
-    ptr += 4;
+    /* The images end the payload; the prompt data is what precedes them */
+    uint64_t images_len = req->init_data_len; /* Sum of two uint32: no overflow */
+    if (mask_data != NULL) {
+        *mask_data_len = read_u32_be(ptr + 12);
+        images_len += *mask_data_len;
+    }
+    if (images_len > remaining) {
+        return ERR_INTERNAL;
+    }
+    size_t prompt_data_len = remaining - images_len;
+    const uint8_t *prompt_data = ptr + fields_len + lora_len;
+    req->init_data = prompt_data + prompt_data_len;
+    if (mask_data != NULL) {
+        *mask_data = req->init_data + req->init_data_len;
+    }
 
-    req->seed = read_u64_be(ptr);
-    ptr += 8;
+    err = decode_sd35_params(data + 16, prompt_data, prompt_data_len, &req->base);
+    if (err != ERR_NONE) {
+        return err;
+    }
 
-    req->clip_l_offset = read_u32_be(ptr);
-    ptr += 4;
+    if (!(req->strength > SD35_MIN_STRENGTH && req->strength <= SD35_MAX_STRENGTH)) {
+        return ERR_INVALID_INIT_IMAGE;
+    }
 
-    req->clip_l_length = read_u32_be(ptr);
-    ptr += 4;
+    if (req->init_channels != 3 && req->init_channels != 4) {
+        return ERR_INVALID_INIT_IMAGE;
+    }
 
-    req->clip_g_offset = read_u32_be(ptr);
-    ptr += 4;
+    /* Dimensions are validated above, so this cannot overflow */
+    if ((uint64_t)req->init_data_len !=
+        (uint64_t)req->base.width * req->base.height * req->init_channels) {
+        return ERR_INVALID_INIT_IMAGE;
+    }
 
-    req->clip_g_length = read_u32_be(ptr);
-    ptr += 4;
+    return ERR_NONE;
+}
 
-    req->t5_offset = read_u32_be(ptr);
-    ptr += 4;
+/**
+ * decode_img2img_request - Decode and validate SD 3.5 img2img request
+ *
+ * Message structure:
+ * - Common header (16 bytes, msg_type = MSG_IMG2IMG_REQUEST)
+ * - Request ID, model ID and SD 3.5 parameters (60 bytes), as for
+ *   MSG_GENERATE_REQUEST
+ * - strength (4), init_channels (4), init_data_len (4)
+ * - LoRA section (variable, only with HEADER_FLAG_LORAS)
+ * - Prompt data (variable)
+ * - Init image data (init_data_len bytes, width x height pixels)
+ *
+ * @param data      Input buffer containing complete message
+ * @param data_len  Size of input buffer (must include header + payload)
+ * @param req       Output request structure (populated on success)
+ * @return          ERR_NONE on success, error code on failure
+ *
+ * Error codes: as decode_generate_request, plus
+ * - ERR_INVALID_INIT_IMAGE: strength out of range, channels not 3 or 4,
+ *   or init_data_len not width * height * init_channels
+ */
+error_code_t decode_img2img_request(const uint8_t *data, size_t data_len,
+                                    sd35_img2img_request_t *req) {
+    return decode_init_image_request(data, data_len, MSG_IMG2IMG_REQUEST, req, NULL, NULL);
+}
 
-    req->t5_length = read_u32_be(ptr);
-    ptr += 4;
+/**
+ * decode_inpaint_request - Decode and validate SD 3.5 inpaint request
+ *
+ * Message structure:
+ * - Common header (16 bytes, msg_type = MSG_INPAINT_REQUEST)
+ * - Request ID, model ID and SD 3.5 parameters (60 bytes), as for
+ *   MSG_GENERATE_REQUEST
+ * - strength (4), init_channels (4), init_data_len (4), mask_data_len (4)
+ * - LoRA section (variable, only with HEADER_FLAG_LORAS)
+ * - Prompt data (variable)
+ * - Init image data (init_data_len bytes, width x height pixels)
+ * - Mask data (mask_data_len bytes, width x height, one byte per pixel)
+ *
+ * @param data      Input buffer containing complete message
+ * @param data_len  Size of input buffer (must include header + payload)
+ * @param req       Output request structure (populated on success)
+ * @return          ERR_NONE on success, error code on failure
+ *
+ * Error codes: as decode_img2img_request, plus
+ * - ERR_INVALID_MASK: mask_data_len not width * height
+ */
+error_code_t decode_inpaint_request(const uint8_t *data, size_t data_len,
+                                    sd35_inpaint_request_t *req) {
+    if (req == NULL) {
+        return ERR_INTERNAL;
+    }
 
-    remaining -= 48;
+    error_code_t err = decode_init_image_request(data, data_len, MSG_INPAINT_REQUEST,
+                                                 &req->base, &req->mask_data_len,
+                                                 &req->mask_data);
+    if (err != ERR_NONE) {
+        return err;
+    }
 
-    req->prompt_data = ptr;
-    req->prompt_data_len = remaining;
+    /* Dimensions are validated, so this cannot overflow */
+    if ((uint64_t)req->mask_data_len !=
+        (uint64_t)req->base.base.width * req->base.base.height) {
+        return ERR_INVALID_MASK;
+    }
 
-    if (req->width < SD35_MIN_DIMENSION || req->width > SD35_MAX_DIMENSION ||
-        req->width % SD35_DIMENSION_ALIGNMENT != 0) {
-        return ERR_INVALID_DIMENSIONS;
+    return ERR_NONE;
+}
+
+/**
+ * decode_control_request - Decode and validate SD 3.5 control request
+ *
+ * Message structure:
+ * - Common header (16 bytes, msg_type = MSG_CONTROL_REQUEST)
+ * - Request ID, model ID and SD 3.5 parameters (60 bytes), as for
+ *   MSG_GENERATE_REQUEST
+ * - control_type (4), control_strength (4), control_channels (4),
+ *   control_data_len (4)
+ * - LoRA section (variable, only with HEADER_FLAG_LORAS)
+ * - Prompt data (variable)
+ * - Control image data (control_data_len bytes, width x height pixels)
+ *
+ * @param data      Input buffer containing complete message
+ * @param data_len  Size of input buffer (must include header + payload)
+ * @param req       Output request structure (populated on success)
+ * @return          ERR_NONE on success, error code on failure
+ *
+ * Error codes: as decode_generate_request, plus
+ * - ERR_INVALID_CONTROL: unknown control type, strength out of range,
+ *   channels not 3 or 4, or control_data_len not
+ *   width * height * control_channels
+ */
+error_code_t decode_control_request(const uint8_t *data, size_t data_len,
+                                    sd35_control_request_t *req) {
+    if (data == NULL || req == NULL) {
+        return ERR_INTERNAL;
     }
 
-    if (req->height < SD35_MIN_DIMENSION || req->height > SD35_MAX_DIMENSION ||
-        req->height % SD35_DIMENSION_ALIGNMENT != 0) {
-        return ERR_INVALID_DIMENSIONS;
+    if (data_len < 16) {
+        return ERR_INTERNAL;
     }
 
-    if (req->steps < SD35_MIN_STEPS || req->steps > SD35_MAX_STEPS) {
-        return ERR_INVALID_STEPS;
+    protocol_header_t header;
+    error_code_t err = decode_protocol_header(data, data_len, MSG_CONTROL_REQUEST, &header);
+    if (err != ERR_NONE) {
+        return err;
     }
 
-    if (req->cfg_scale < SD35_MIN_CFG || req->cfg_scale > SD35_MAX_CFG ||
-        isnan(req->cfg_scale) || isinf(req->cfg_scale)) {
-        return ERR_INVALID_CFG;
+    if (data_len < 16 + header.payload_len) {
+        return ERR_INTERNAL;
     }
 
-    if (req->clip_l_length < SD35_MIN_PROMPT_LENGTH ||
-        req->clip_l_length > SD35_MAX_PROMPT_LENGTH) {
-        return ERR_INVALID_PROMPT;
+    if (header.payload_len < 12 + 48 + 16) {
+        return ERR_INTERNAL;
     }
 
-    if (req->clip_g_length < SD35_MIN_PROMPT_LENGTH ||
-        req->clip_g_length > SD35_MAX_PROMPT_LENGTH) {
-        return ERR_INVALID_PROMPT;
+    const uint8_t *ptr = data + 16 + 12 + 48;
+    req->control_type = read_u32_be(ptr);
+    req->control_strength = read_f32_be(ptr + 4);
+    req->control_channels = read_u32_be(ptr + 8);
+    req->control_data_len = read_u32_be(ptr + 12);
+
+    size_t remaining = header.payload_len - 12 - 48 - 16;
+    size_t lora_len;
+    err = decode_lora_section(&header, ptr + 16, remaining, &req->base, &lora_len);
+    if (err != ERR_NONE) {
+        return err;
+    }
+    remaining -= lora_len;
+
+    /* The control image ends the payload; the prompt data precedes it */
+    if (req->control_data_len > remaining) {
+        return ERR_INTERNAL;
+    }
+    size_t prompt_data_len = remaining - req->control_data_len;
+    const uint8_t *prompt_data = ptr + 16 + lora_len;
+    req->control_data = prompt_data + prompt_data_len;
+
+    err = decode_sd35_params(data + 16, prompt_data, prompt_data_len, &req->base);
+    if (err != ERR_NONE) {
+        return err;
+    }
+
+    if (req->control_type >= CONTROL_TYPE_COUNT) {
+        return ERR_INVALID_CONTROL;
+    }
+
+    /* Written as a negation so NaN is rejected too */
+    if (!(req->control_strength > MIN_CONTROL_STRENGTH &&
+          req->control_strength <= MAX_CONTROL_STRENGTH)) {
+        return ERR_INVALID_CONTROL;
+    }
+
+    if (req->control_channels != 3 && req->control_channels != 4) {
+        return ERR_INVALID_CONTROL;
+    }
+
+    /* Dimensions are validated above, so this cannot overflow */
+    if ((uint64_t)req->control_data_len !=
+        (uint64_t)req->base.width * req->base.height * req->control_channels) {
+        return ERR_INVALID_CONTROL;
+    }
+
+    return ERR_NONE;
+}
+
+/**
+ * decode_upscale_request - Decode and validate an upscale request
+ *
+ * Message structure:
+ * - Common header (16 bytes, msg_type = MSG_UPSCALE_REQUEST)
+ * - Request ID (8 bytes)
+ * - width (4), height (4), channels (4)
+ * - target_width (4), target_height (4), image_data_len (4)
+ * - Image data (image_data_len bytes, width x height pixels)
+ *
+ * @param data      Input buffer containing complete message
+ * @param data_len  Size of input buffer (must include header + payload)
+ * @param req       Output request structure (populated on success)
+ * @return          ERR_NONE on success, error code on failure
+ *
+ * Error codes:
+ * - ERR_INVALID_MAGIC, ERR_UNSUPPORTED_VERSION: as decode_generate_request
+ * - ERR_INVALID_DIMENSIONS: input size out of range, or target size smaller
+ *   than the input, larger than SD35_MAX_DIMENSION or more than
+ *   UPSCALE_MAX_FACTOR times the input
+ * - ERR_INVALID_INIT_IMAGE: channels not 3 or 4, or image_data_len not
+ *   width * height * channels
+ * - ERR_INTERNAL: Truncated message or other structural error
+ */
+error_code_t decode_upscale_request(const uint8_t *data, size_t data_len,
+                                    upscale_request_t *req) {
+    if (data == NULL || req == NULL) {
+        return ERR_INTERNAL;
+    }
+
+    if (data_len < 16) {
+        return ERR_INTERNAL;
+    }
+
+    protocol_header_t header;
+    error_code_t err = decode_protocol_header(data, data_len, MSG_UPSCALE_REQUEST, &header);
+    if (err != ERR_NONE) {
+        return err;
     }
 
-    if (req->t5_length < SD35_MIN_PROMPT_LENGTH ||
-        req->t5_length > SD35_MAX_PROMPT_LENGTH) {
-        return ERR_INVALID_PROMPT;
+    if (data_len < 16 + header.payload_len) {
+        return ERR_INTERNAL;
     }
 
-    if (req->clip_l_offset > req->prompt_data_len) {
-        return ERR_INVALID_PROMPT;
+    if (header.payload_len < 32) {
+        return ERR_INTERNAL;
     }
 
-    if (req->clip_l_length > req->prompt_data_len - req->clip_l_offset) {
-        return ERR_INVALID_PROMPT;
+    const uint8_t *ptr = data + 16;
+    req->request_id = read_u64_be(ptr);
+    req->width = read_u32_be(ptr + 8);
+    req->height = read_u32_be(ptr + 12);
+    req->channels = read_u32_be(ptr + 16);
+    req->target_width = read_u32_be(ptr + 20);
+    req->target_height = read_u32_be(ptr + 24);
+    req->image_data_len = read_u32_be(ptr + 28);
+    req->image_data = ptr + 32;
+
+    if (req->image_data_len != header.payload_len - 32) {
+        return ERR_INTERNAL;
     }
 
-    if (req->clip_g_offset > req->prompt_data_len) {
-        return ERR_INVALID_PROMPT;
+    if (req->width == 0 || req->width > SD35_MAX_DIMENSION ||
+        req->height == 0 || req->height > SD35_MAX_DIMENSION) {
+        return ERR_INVALID_DIMENSIONS;
     }
 
-    if (req->clip_g_length > req->prompt_data_len - req->clip_g_offset) {
-        return ERR_INVALID_PROMPT;
+    /* Input dimensions are at most 2048, so these cannot overflow */
+    if (req->target_width < req->width || req->target_height < req->height ||
+        req->target_width > SD35_MAX_DIMENSION ||
+        req->target_height > SD35_MAX_DIMENSION ||
+        req->target_width > req->width * UPSCALE_MAX_FACTOR ||
+        req->target_height > req->height * UPSCALE_MAX_FACTOR) {
+        return ERR_INVALID_DIMENSIONS;
     }
 
-    if (req->t5_offset > req->prompt_data_len) {
-        return ERR_INVALID_PROMPT;
+    if (req->channels != 3 && req->channels != 4) {
+        return ERR_INVALID_INIT_IMAGE;
     }
 
-    if (req->t5_length > req->prompt_data_len - req->t5_offset) {
-        return ERR_INVALID_PROMPT;
+    if ((uint64_t)req->image_data_len !=
+        (uint64_t)req->width * req->height * req->channels) {
+        return ERR_INVALID_INIT_IMAGE;
     }
 
     return ERR_NONE;
@@ -303,7 +775,13 @@ error_code_t decode_generate_request(const uint8_t *data, size_t data_len,
  * - Common header (16 bytes)
  * - Common response fields: request_id (8), status (4), generation_time_ms (4)
  * - Image metadata: width (4), height (4), channels (4), image_data_len (4)
- * - Raw image data (width * height * channels bytes)
+ * - Raw image data (width * height * channels bytes), or with
+ *   resp->shm_name set, HEADER_FLAG_SHARED_MEMORY in the header and
+ *   name_len (2) and the name of the segment holding it
+ * - With resp->seed set, HEADER_FLAG_SEED in the header and the seed (8)
+ * - With resp->has_metadata set, HEADER_FLAG_METADATA in the header and
+ *   the model hash, sampler and scheduler, each as length (2) and bytes,
+ *   then text_encode_ms (4), diffusion_ms (4) and vae_ms (4)
  *
  * @param resp      Response structure to encode
  * @param buffer    Output buffer for encoded message
@@ -366,6 +844,36 @@ error_code_t encode_generate_response(const sd35_generate_response_t *resp,
     }
 
     uint32_t payload_len = 16 + 16 + resp->image_data_len;
+    uint32_t flags = 0;
+    size_t name_len = 0;
+    if (resp->shm_name != NULL) {
+        name_len = strlen(resp->shm_name);
+        if (name_len == 0 || name_len >= SHARED_MEMORY_NAME_MAX) {
+            return ERR_INTERNAL;
+        }
+        payload_len = 16 + 16 + 2 + (uint32_t)name_len;
+        flags = HEADER_FLAG_SHARED_MEMORY;
+    }
+    if (resp->seed != 0) {
+        payload_len += 8;
+        flags |= HEADER_FLAG_SEED;
+    }
+    const char *metadata_strings[3] = {
+        resp->metadata.model_hash, resp->metadata.sampler, resp->metadata.scheduler,
+    };
+    size_t metadata_lens[3] = {0, 0, 0};
+    if (resp->has_metadata) {
+        for (int i = 0; i < 3; i++) {
+            const char *end = memchr(metadata_strings[i], '\0', GENERATION_METADATA_STRING_MAX);
+            if (end == NULL) {
+                return ERR_INTERNAL;
+            }
+            metadata_lens[i] = (size_t)(end - metadata_strings[i]);
+            payload_len += 2 + (uint32_t)metadata_lens[i];
+        }
+        payload_len += 12;
+        flags |= HEADER_FLAG_METADATA;
+    }
     size_t total_len = 16 + payload_len;
 
     if (total_len > buf_size) {
@@ -382,7 +890,7 @@ error_code_t encode_generate_response(const sd35_generate_response_t *resp,
     ptr += 2;
     write_u32_be(ptr, payload_len);
     ptr += 4;
-    write_u32_be(ptr, 0);
+    write_u32_be(ptr, flags);
     ptr += 4;
 
     write_u64_be(ptr, resp->request_id);
@@ -401,8 +909,100 @@ error_code_t encode_generate_response(const sd35_generate_response_t *resp,
     write_u32_be(ptr, resp->image_data_len);
     ptr += 4;
 
-    memcpy(ptr, resp->image_data, resp->image_data_len);
-    ptr += resp->image_data_len;
+    if (resp->shm_name != NULL) {
+        write_u16_be(ptr, (uint16_t)name_len);
+        ptr += 2;
+        memcpy(ptr, resp->shm_name, name_len);
+        ptr += name_len;
+    } else {
+        memcpy(ptr, resp->image_data, resp->image_data_len);
+        ptr += resp->image_data_len;
+    }
+
+    if (resp->seed != 0) {
+        write_u64_be(ptr, resp->seed);
+        ptr += 8;
+    }
+
+    if (resp->has_metadata) {
+        for (int i = 0; i < 3; i++) {
+            write_u16_be(ptr, (uint16_t)metadata_lens[i]);
+            ptr += 2;
+            memcpy(ptr, metadata_strings[i], metadata_lens[i]);
+            ptr += metadata_lens[i];
+        }
+        write_u32_be(ptr, resp->metadata.text_encode_ms);
+        ptr += 4;
+        write_u32_be(ptr, resp->metadata.diffusion_ms);
+        ptr += 4;
+        write_u32_be(ptr, resp->metadata.vae_ms);
+        ptr += 4;
+    }
+
+    *out_len = total_len;
+    return ERR_NONE;
+}
+
+/**
+ * encode_preview_frame - Encode a preview frame
+ *
+ * Message structure:
+ * - Common header (16 bytes, msg_type = MSG_PREVIEW)
+ * - request_id (8), step (4), steps (4)
+ * - Image metadata: width (4), height (4), channels (4), image_data_len (4)
+ * - Raw RGB image data (width * height * 3 bytes)
+ *
+ * @param frame     Preview frame to encode
+ * @param buffer    Output buffer for encoded message
+ * @param buf_size  Size of output buffer in bytes
+ * @param out_len   Pointer to store actual encoded length (bytes written)
+ * @return          ERR_NONE on success, error code on failure
+ *
+ * Error codes:
+ * - ERR_INTERNAL: NULL pointer or buffer too small
+ * - ERR_INVALID_DIMENSIONS: Size beyond PREVIEW_MAX_DIMENSION, step not in
+ *   1-steps, channels not 3, or data length mismatched
+ */
+error_code_t encode_preview_frame(const preview_frame_t *frame,
+                                  uint8_t *buffer, size_t buf_size,
+                                  size_t *out_len) {
+    if (frame == NULL || buffer == NULL || out_len == NULL ||
+        frame->image_data == NULL) {
+        return ERR_INTERNAL;
+    }
+
+    if (frame->width < 1 || frame->width > PREVIEW_MAX_DIMENSION ||
+        frame->height < 1 || frame->height > PREVIEW_MAX_DIMENSION ||
+        frame->channels != 3 ||
+        frame->step < 1 || frame->step > frame->steps) {
+        return ERR_INVALID_DIMENSIONS;
+    }
+
+    /* PREVIEW_MAX_DIMENSION keeps this from overflowing */
+    if (frame->image_data_len != frame->width * frame->height * 3) {
+        return ERR_INVALID_DIMENSIONS;
+    }
+
+    uint32_t payload_len = 32 + frame->image_data_len;
+    size_t total_len = 16 + payload_len;
+    if (total_len > buf_size) {
+        return ERR_INTERNAL;
+    }
+
+    write_u32_be(buffer, PROTOCOL_MAGIC);
+    write_u16_be(buffer + 4, PROTOCOL_VERSION_1);
+    write_u16_be(buffer + 6, MSG_PREVIEW);
+    write_u32_be(buffer + 8, payload_len);
+    write_u32_be(buffer + 12, 0);
+
+    write_u64_be(buffer + 16, frame->request_id);
+    write_u32_be(buffer + 24, frame->step);
+    write_u32_be(buffer + 28, frame->steps);
+    write_u32_be(buffer + 32, frame->width);
+    write_u32_be(buffer + 36, frame->height);
+    write_u32_be(buffer + 40, frame->channels);
+    write_u32_be(buffer + 44, frame->image_data_len);
+    memcpy(buffer + 48, frame->image_data, frame->image_data_len);
 
     *out_len = total_len;
     return ERR_NONE;
@@ -490,3 +1090,472 @@ error_code_t encode_error_response(const error_response_t *resp,
     *out_len = total_len;
     return ERR_NONE;
 }
+
+/**
+ * decode_id_only_request - Decode a request whose payload is its request ID
+ *
+ * @param data        Input buffer containing complete message
+ * @param data_len    Size of input buffer
+ * @param msg_type    Expected message type
+ * @param request_id  Output request ID (populated on success)
+ * @return            ERR_NONE on success, error code on failure
+ */
+static error_code_t decode_id_only_request(const uint8_t *data, size_t data_len,
+                                           uint16_t msg_type,
+                                           uint64_t *request_id) {
+    if (data == NULL || request_id == NULL || data_len < 16) {
+        return ERR_INTERNAL;
+    }
+
+    if (read_u32_be(data) != PROTOCOL_MAGIC) {
+        return ERR_INVALID_MAGIC;
+    }
+
+    uint16_t version = read_u16_be(data + 4);
+    if (version < MIN_SUPPORTED_VERSION || version > MAX_SUPPORTED_VERSION) {
+        return ERR_UNSUPPORTED_VERSION;
+    }
+
+    if (read_u16_be(data + 6) != msg_type) {
+        return ERR_INTERNAL;
+    }
+
+    /* The payload is exactly the request ID */
+    if (read_u32_be(data + 8) != 8 || data_len < 16 + 8) {
+        return ERR_INTERNAL;
+    }
+
+    *request_id = read_u64_be(data + 16);
+    return ERR_NONE;
+}
+
+/**
+ * decode_ping_request - Decode and validate a ping request
+ *
+ * Message structure:
+ * - Common header (16 bytes, msg_type = MSG_PING)
+ * - request_id (8 bytes)
+ *
+ * @param data        Input buffer containing complete message
+ * @param data_len    Size of input buffer
+ * @param request_id  Output request ID (populated on success)
+ * @return            ERR_NONE on success, error code on failure
+ *
+ * Error codes:
+ * - ERR_INVALID_MAGIC: Magic number mismatch
+ * - ERR_UNSUPPORTED_VERSION: Version outside supported range
+ * - ERR_INTERNAL: NULL pointer, wrong message type, or bad payload length
+ */
+error_code_t decode_ping_request(const uint8_t *data, size_t data_len,
+                                 uint64_t *request_id) {
+    return decode_id_only_request(data, data_len, MSG_PING, request_id);
+}
+
+/**
+ * encode_pong_response - Encode the response to a ping request
+ *
+ * Message structure:
+ * - Common header (16 bytes, msg_type = MSG_PONG)
+ * - request_id (8 bytes, echoed from the ping)
+ *
+ * @param request_id  Request ID echoed from the ping
+ * @param buffer      Output buffer for encoded message
+ * @param buf_size    Size of output buffer in bytes
+ * @param out_len     Pointer to store actual encoded length
+ * @return            ERR_NONE on success, ERR_INTERNAL on failure
+ */
+error_code_t encode_pong_response(uint64_t request_id, uint8_t *buffer,
+                                  size_t buf_size, size_t *out_len) {
+    if (buffer == NULL || out_len == NULL || buf_size < 16 + 8) {
+        return ERR_INTERNAL;
+    }
+
+    write_u32_be(buffer, PROTOCOL_MAGIC);
+    write_u16_be(buffer + 4, PROTOCOL_VERSION_1);
+    write_u16_be(buffer + 6, MSG_PONG);
+    write_u32_be(buffer + 8, 8);
+    write_u32_be(buffer + 12, 0);
+    write_u64_be(buffer + 16, request_id);
+
+    *out_len = 16 + 8;
+    return ERR_NONE;
+}
+
+/**
+ * model_list_size - Size a model list: model_count and the entries
+ *
+ * @param models  Models to list
+ * @param count   Number of models (at most MODEL_COUNT)
+ * @param size    Output size in bytes
+ * @return        false for NULL models with a count, too many models, or a
+ *                name that is empty or longer than MAX_MODEL_NAME_LENGTH
+ */
+static bool model_list_size(const model_info_t *models, uint32_t count,
+                            size_t *size) {
+    if ((models == NULL && count > 0) || count > MODEL_COUNT) {
+        return false;
+    }
+
+    *size = 4;
+    for (uint32_t i = 0; i < count; i++) {
+        if (models[i].name == NULL) {
+            return false;
+        }
+        size_t name_len = strlen(models[i].name);
+        if (name_len == 0 || name_len > MAX_MODEL_NAME_LENGTH) {
+            return false;
+        }
+        *size += 16 + name_len;
+    }
+    return true;
+}
+
+/**
+ * write_model_list - Write a model list sized by model_list_size()
+ *
+ * Per model: model_id (4), status (4), vram_mb (4), name_len (4), name
+ */
+static void write_model_list(uint8_t *ptr, const model_info_t *models,
+                             uint32_t count) {
+    write_u32_be(ptr, count);
+    ptr += 4;
+    for (uint32_t i = 0; i < count; i++) {
+        uint32_t name_len = (uint32_t)strlen(models[i].name);
+        write_u32_be(ptr, models[i].model_id);
+        write_u32_be(ptr + 4, models[i].status);
+        write_u32_be(ptr + 8, models[i].vram_mb);
+        write_u32_be(ptr + 12, name_len);
+        memcpy(ptr + 16, models[i].name, name_len);
+        ptr += 16 + name_len;
+    }
+}
+
+/**
+ * decode_models_request - Decode and validate a models request
+ *
+ * Message structure:
+ * - Common header (16 bytes, msg_type = MSG_MODELS_REQUEST)
+ * - request_id (8 bytes)
+ *
+ * @param data        Input buffer containing complete message
+ * @param data_len    Size of input buffer
+ * @param request_id  Output request ID (populated on success)
+ * @return            ERR_NONE on success, error code on failure
+ *
+ * Error codes: as decode_ping_request()
+ */
+error_code_t decode_models_request(const uint8_t *data, size_t data_len,
+                                   uint64_t *request_id) {
+    return decode_id_only_request(data, data_len, MSG_MODELS_REQUEST, request_id);
+}
+
+/**
+ * encode_models_response - Encode the response to a models request
+ *
+ * Message structure:
+ * - Common header (16 bytes, msg_type = MSG_MODELS_RESPONSE)
+ * - request_id (8 bytes, echoed from the request)
+ * - model_count (4 bytes)
+ * - Per model: model_id (4), status (4), vram_mb (4), name_len (4), name
+ *
+ * @param request_id  Request ID echoed from the request
+ * @param models      Models to list
+ * @param count       Number of models (at most MODEL_COUNT)
+ * @param buffer      Output buffer for encoded message
+ * @param buf_size    Size of output buffer in bytes
+ * @param out_len     Pointer to store actual encoded length
+ * @return            ERR_NONE on success, ERR_INTERNAL on failure
+ *
+ * Error codes:
+ * - ERR_INTERNAL: NULL pointer, too many models, a name that is empty or
+ *   longer than MAX_MODEL_NAME_LENGTH, or buffer too small
+ */
+error_code_t encode_models_response(uint64_t request_id,
+                                    const model_info_t *models, uint32_t count,
+                                    uint8_t *buffer, size_t buf_size,
+                                    size_t *out_len) {
+    if (buffer == NULL || out_len == NULL) {
+        return ERR_INTERNAL;
+    }
+
+    /* Size the message first so nothing is written on failure */
+    size_t list_len;
+    if (!model_list_size(models, count, &list_len)) {
+        return ERR_INTERNAL;
+    }
+    size_t total_len = 16 + 8 + list_len;
+    if (total_len > buf_size) {
+        return ERR_INTERNAL;
+    }
+
+    write_u32_be(buffer, PROTOCOL_MAGIC);
+    write_u16_be(buffer + 4, PROTOCOL_VERSION_1);
+    write_u16_be(buffer + 6, MSG_MODELS_RESPONSE);
+    write_u32_be(buffer + 8, (uint32_t)(total_len - 16));
+    write_u32_be(buffer + 12, 0);
+    write_u64_be(buffer + 16, request_id);
+    write_model_list(buffer + 24, models, count);
+
+    *out_len = total_len;
+    return ERR_NONE;
+}
+
+/**
+ * decode_capabilities_request - Decode and validate a capabilities request
+ *
+ * Message structure:
+ * - Common header (16 bytes, msg_type = MSG_CAPABILITIES_REQUEST)
+ * - request_id (8 bytes)
+ *
+ * @param data        Input buffer containing complete message
+ * @param data_len    Size of input buffer
+ * @param request_id  Output request ID (populated on success)
+ * @return            ERR_NONE on success, error code on failure
+ *
+ * Error codes: as decode_ping_request()
+ */
+error_code_t decode_capabilities_request(const uint8_t *data, size_t data_len,
+                                         uint64_t *request_id) {
+    return decode_id_only_request(data, data_len, MSG_CAPABILITIES_REQUEST, request_id);
+}
+
+/**
+ * encode_capabilities_response - Encode the response to a capabilities request
+ *
+ * Message structure:
+ * - Common header (16 bytes, msg_type = MSG_CAPABILITIES_RESPONSE)
+ * - request_id (8 bytes, echoed from the request)
+ * - min_version (2), max_version (2), request_types (4)
+ * - max_width (4), max_height (4), vram_total_mb (4), vram_free_mb (4)
+ * - model_count (4) and the models, as in a models response
+ *
+ * @param request_id  Request ID echoed from the request
+ * @param caps        Capabilities to send
+ * @param buffer      Output buffer for encoded message
+ * @param buf_size    Size of output buffer in bytes
+ * @param out_len     Pointer to store actual encoded length
+ * @return            ERR_NONE on success, ERR_INTERNAL on failure
+ *
+ * Error codes:
+ * - ERR_INTERNAL: NULL pointer, a model list encode_models_response()
+ *   would refuse, or buffer too small
+ */
+error_code_t encode_capabilities_response(uint64_t request_id,
+                                          const capabilities_t *caps,
+                                          uint8_t *buffer, size_t buf_size,
+                                          size_t *out_len) {
+    if (caps == NULL || buffer == NULL || out_len == NULL) {
+        return ERR_INTERNAL;
+    }
+
+    size_t list_len;
+    if (!model_list_size(caps->models, caps->model_count, &list_len)) {
+        return ERR_INTERNAL;
+    }
+    size_t total_len = 16 + 8 + 24 + list_len;
+    if (total_len > buf_size) {
+        return ERR_INTERNAL;
+    }
+
+    write_u32_be(buffer, PROTOCOL_MAGIC);
+    write_u16_be(buffer + 4, PROTOCOL_VERSION_1);
+    write_u16_be(buffer + 6, MSG_CAPABILITIES_RESPONSE);
+    write_u32_be(buffer + 8, (uint32_t)(total_len - 16));
+    write_u32_be(buffer + 12, 0);
+    write_u64_be(buffer + 16, request_id);
+    write_u16_be(buffer + 24, MIN_SUPPORTED_VERSION);
+    write_u16_be(buffer + 26, MAX_SUPPORTED_VERSION);
+    write_u32_be(buffer + 28, caps->request_types);
+    write_u32_be(buffer + 32, caps->max_width);
+    write_u32_be(buffer + 36, caps->max_height);
+    write_u32_be(buffer + 40, caps->vram_total_mb);
+    write_u32_be(buffer + 44, caps->vram_free_mb);
+    write_model_list(buffer + 48, caps->models, caps->model_count);
+
+    *out_len = total_len;
+    return ERR_NONE;
+}
+
+/**
+ * decode_hello_request - Decode and validate a hello request
+ *
+ * Message structure:
+ * - Common header (16 bytes, version = PROTOCOL_VERSION_1,
+ *   msg_type = MSG_HELLO_REQUEST)
+ * - request_id (8 bytes)
+ * - min_version (2 bytes), max_version (2 bytes)
+ *
+ * @param data         Input buffer containing complete message
+ * @param data_len     Size of input buffer
+ * @param request_id   Output request ID (populated on success)
+ * @param min_version  Output oldest version the client speaks
+ * @param max_version  Output newest version the client speaks
+ * @return             ERR_NONE on success, error code on failure
+ *
+ * Error codes:
+ * - ERR_INVALID_MAGIC: Magic number mismatch
+ * - ERR_UNSUPPORTED_VERSION: Header version is not PROTOCOL_VERSION_1
+ * - ERR_INTERNAL: NULL pointer, wrong message type, bad payload length, or
+ *   min_version greater than max_version
+ */
+error_code_t decode_hello_request(const uint8_t *data, size_t data_len,
+                                  uint64_t *request_id, uint16_t *min_version,
+                                  uint16_t *max_version) {
+    if (data == NULL || request_id == NULL || min_version == NULL ||
+        max_version == NULL || data_len < 16) {
+        return ERR_INTERNAL;
+    }
+
+    if (read_u32_be(data) != PROTOCOL_MAGIC) {
+        return ERR_INVALID_MAGIC;
+    }
+
+    if (read_u16_be(data + 4) != PROTOCOL_VERSION_1) {
+        return ERR_UNSUPPORTED_VERSION;
+    }
+
+    if (read_u16_be(data + 6) != MSG_HELLO_REQUEST) {
+        return ERR_INTERNAL;
+    }
+
+    if (read_u32_be(data + 8) != 12 || data_len < 16 + 12) {
+        return ERR_INTERNAL;
+    }
+
+    *request_id = read_u64_be(data + 16);
+    *min_version = read_u16_be(data + 24);
+    *max_version = read_u16_be(data + 26);
+    if (*min_version > *max_version) {
+        return ERR_INTERNAL;
+    }
+    return ERR_NONE;
+}
+
+/**
+ * negotiate_version - Pick the protocol version to speak with a client
+ *
+ * @param min_version  Oldest version the client speaks
+ * @param max_version  Newest version the client speaks
+ * @param version      Output newest version both sides speak
+ * @return             ERR_NONE on success, ERR_UNSUPPORTED_VERSION if the
+ *                     ranges don't overlap, ERR_INTERNAL for NULL version
+ */
+error_code_t negotiate_version(uint16_t min_version, uint16_t max_version,
+                               uint16_t *version) {
+    if (version == NULL) {
+        return ERR_INTERNAL;
+    }
+
+    uint16_t newest = max_version < MAX_SUPPORTED_VERSION ? max_version : MAX_SUPPORTED_VERSION;
+    if (newest < min_version || newest < MIN_SUPPORTED_VERSION) {
+        return ERR_UNSUPPORTED_VERSION;
+    }
+
+    *version = newest;
+    return ERR_NONE;
+}
+
+/**
+ * encode_hello_response - Encode the response to a hello request
+ *
+ * Message structure:
+ * - Common header (16 bytes, version = PROTOCOL_VERSION_1,
+ *   msg_type = MSG_HELLO_RESPONSE)
+ * - request_id (8 bytes, echoed from the request)
+ * - version (2), min_version (2), max_version (2)
+ * - flags (2): the HEADER_FLAG_* compute accepts
+ *
+ * @param request_id  Request ID echoed from the request
+ * @param version     Version from negotiate_version()
+ * @param buffer      Output buffer for encoded message
+ * @param buf_size    Size of output buffer in bytes
+ * @param out_len     Pointer to store actual encoded length
+ * @return            ERR_NONE on success, ERR_INTERNAL on failure
+ */
+error_code_t encode_hello_response(uint64_t request_id, uint16_t version,
+                                   uint8_t *buffer, size_t buf_size,
+                                   size_t *out_len) {
+    if (buffer == NULL || out_len == NULL || buf_size < 16 + 16) {
+        return ERR_INTERNAL;
+    }
+
+    write_u32_be(buffer, PROTOCOL_MAGIC);
+    write_u16_be(buffer + 4, PROTOCOL_VERSION_1);
+    write_u16_be(buffer + 6, MSG_HELLO_RESPONSE);
+    write_u32_be(buffer + 8, 16);
+    write_u32_be(buffer + 12, 0);
+    write_u64_be(buffer + 16, request_id);
+    write_u16_be(buffer + 24, version);
+    write_u16_be(buffer + 26, MIN_SUPPORTED_VERSION);
+    write_u16_be(buffer + 28, MAX_SUPPORTED_VERSION);
+    write_u16_be(buffer + 30, (uint16_t)HEADER_FLAGS_SUPPORTED);
+
+    *out_len = 16 + 16;
+    return ERR_NONE;
+}
+
+/**
+ * CRC-32 of each 4-bit value, for the reflected polynomial 0xEDB88320.
+ * Two lookups per byte keep the table small.
+ */
+static const uint32_t crc32_nibbles[16] = {
+    0x00000000, 0x1DB71064, 0x3B6E20C8, 0x26D930AC,
+    0x76DC4190, 0x6B6B51F4, 0x4DB26158, 0x5005713C,
+    0xEDB88320, 0xF00F9344, 0xD6D6A3E8, 0xCB61B38C,
+    0x9B64C2B0, 0x86D3D2D4, 0xA00AE278, 0xBDBDF21C,
+};
+
+/**
+ * protocol_crc32 - CRC-32 (IEEE 802.3, as zlib computes it) of data
+ *
+ * @param data  Input buffer
+ * @param len   Length of data in bytes
+ * @return      The checksum
+ */
+uint32_t protocol_crc32(const uint8_t *data, size_t len) {
+    uint32_t crc = 0xFFFFFFFFu;
+    size_t i;
+
+    for (i = 0; i < len; i++) {
+        crc ^= data[i];
+        crc = (crc >> 4) ^ crc32_nibbles[crc & 0x0F];
+        crc = (crc >> 4) ^ crc32_nibbles[crc & 0x0F];
+    }
+    return ~crc;
+}
+
+/**
+ * verify_checksum - Check and remove the checksum of a message
+ *
+ * @param message      Complete message (header + payload), modified in place
+ * @param message_len  Length of message, updated on success
+ * @return             ERR_NONE on success, ERR_CHECKSUM_MISMATCH if the
+ *                     payload does not match, ERR_INTERNAL on invalid input
+ */
+error_code_t verify_checksum(uint8_t *message, size_t *message_len) {
+    uint32_t flags;
+    uint32_t payload_len;
+
+    if (message == NULL || message_len == NULL || *message_len < 16) {
+        return ERR_INTERNAL;
+    }
+
+    flags = read_u32_be(message + 12);
+    if ((flags & HEADER_FLAG_CHECKSUM) == 0) {
+        return ERR_NONE;
+    }
+
+    payload_len = read_u32_be(message + 8);
+    if ((size_t)payload_len != *message_len - 16 || payload_len < CHECKSUM_SIZE) {
+        return ERR_CHECKSUM_MISMATCH;
+    }
+    payload_len -= CHECKSUM_SIZE;
+    if (protocol_crc32(message + 16, payload_len) != read_u32_be(message + 16 + payload_len)) {
+        return ERR_CHECKSUM_MISMATCH;
+    }
+
+    write_u32_be(message + 8, payload_len);
+    write_u32_be(message + 12, flags & ~(uint32_t)HEADER_FLAG_CHECKSUM);
+    *message_len = 16 + payload_len;
+    return ERR_NONE;
+}
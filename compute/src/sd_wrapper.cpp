@@ -6,6 +6,8 @@
 
 #include "weave/sd_wrapper.h"
 
+#include <chrono>
+#include <cstdio>
 #include <cstdlib>
 #include <cstring>
 #include <new>      /* For std::nothrow */
@@ -14,12 +16,16 @@
 /* Include stable-diffusion.cpp C API */
 #include "stable-diffusion.h"
 
+/* Device memory queries of the ggml Vulkan backend */
+#include "ggml-vulkan.h"
+
 /**
  * Internal context structure.
  * Holds stable-diffusion.cpp context and error state.
  */
 struct sd_wrapper_ctx {
     sd_ctx_t* sd_ctx;           /* stable-diffusion.cpp context */
+    upscaler_ctx_t* upscaler_ctx; /* ESRGAN upscaler, loaded on first use */
     std::string error_msg;      /* Last error message */
     sd_wrapper_config_t config; /* Configuration used to create context */
 };
@@ -28,6 +34,34 @@ struct sd_wrapper_ctx {
 static void sd_wrapper_log_callback(enum sd_log_level_t level,
                                      const char* text,
                                      void* data);
+static void sd_wrapper_preview_callback(int step,
+                                         int frame_count,
+                                         sd_image_t* frames,
+                                         bool is_noisy,
+                                         void* data);
+static void sd_wrapper_progress_callback(int step, int steps, float time, void* data);
+
+/**
+ * Where stable-diffusion.cpp previews of the current generation go.
+ */
+struct preview_target {
+    sd_wrapper_preview_fn fn;
+    void* data;
+    uint32_t steps;
+};
+
+/**
+ * When the phases of the current generation started, from
+ * stable-diffusion.cpp's progress reports. The first run of reports is
+ * taken as the sampling and later ones (VAE tiles) are ignored, so the
+ * split is off for img2img with VAE tiling, whose encode tiles come first.
+ */
+struct phase_timer {
+    std::chrono::steady_clock::time_point sampling_start;
+    std::chrono::steady_clock::time_point sampling_end;
+    int steps;          /* Steps of the sampling run, 0 before the first report */
+    bool sampling_done;
+};
 
 /**
  * Initialize wrapper configuration with defaults.
@@ -41,6 +75,7 @@ void sd_wrapper_config_init(sd_wrapper_config_t* config) {
 
     /* Defaults for SD 3.5 Medium on RTX 4070 Super (12GB VRAM) */
     config->model_path = NULL;
+    config->diffusion_model_path = NULL;
     config->clip_l_path = NULL;
     config->clip_g_path = NULL;
     config->t5xxl_path = NULL;
@@ -49,6 +84,9 @@ void sd_wrapper_config_init(sd_wrapper_config_t* config) {
     config->keep_clip_on_cpu = true;  /* Save VRAM */
     config->keep_vae_on_cpu = false;  /* VAE on GPU for speed */
     config->enable_flash_attn = true; /* Faster attention */
+    config->upscaler_path = NULL;     /* No upscaling */
+    config->lora_model_dir = NULL;    /* No LoRAs */
+    config->control_net_path = NULL;  /* No ControlNet */
 }
 
 /**
@@ -70,13 +108,26 @@ void sd_wrapper_gen_params_init(sd_wrapper_gen_params_t* params) {
     params->cfg_scale = 4.5f;  /* SD 3.5 Medium default */
     params->seed = 0;          /* Random */
     params->clip_skip = 0;     /* No skip */
+    params->init_image = NULL; /* txt2img */
+    params->init_channels = 0;
+    params->strength = 0.75f;  /* Keeps the composition, redraws details */
+    params->mask_image = NULL; /* Redraw the whole image */
+    params->preview_fn = NULL; /* No previews */
+    params->preview_data = NULL;
+    params->preview_interval = 1;
+    params->loras = NULL;      /* No LoRAs */
+    params->lora_count = 0;
+    params->control_image = NULL; /* Unguided */
+    params->control_channels = 0;
+    params->control_strength = 0.9f;
 }
 
 /**
  * Create a new SD wrapper context and load model.
  */
 sd_wrapper_ctx_t* sd_wrapper_create(const sd_wrapper_config_t* config) {
-    if (config == NULL || config->model_path == NULL) {
+    if (config == NULL ||
+        (config->model_path == NULL && config->diffusion_model_path == NULL)) {
         return NULL;
     }
 
@@ -88,6 +139,7 @@ sd_wrapper_ctx_t* sd_wrapper_create(const sd_wrapper_config_t* config) {
 
     /* Initialize context with default error message before model load */
     ctx->sd_ctx = NULL;
+    ctx->upscaler_ctx = NULL;
     ctx->error_msg = "Model load failed";  /* Default error before attempting load */
     ctx->config = *config;
 
@@ -100,10 +152,13 @@ sd_wrapper_ctx_t* sd_wrapper_create(const sd_wrapper_config_t* config) {
 
     /* Set model paths */
     sd_params.model_path = config->model_path;
+    sd_params.diffusion_model_path = config->diffusion_model_path;
     sd_params.clip_l_path = config->clip_l_path;
     sd_params.clip_g_path = config->clip_g_path;
     sd_params.t5xxl_path = config->t5xxl_path;
     sd_params.vae_path = config->vae_path;
+    sd_params.lora_model_dir = config->lora_model_dir;
+    sd_params.control_net_path = config->control_net_path;
 
     /* Set CPU/GPU offloading */
     sd_params.keep_clip_on_cpu = config->keep_clip_on_cpu;
@@ -156,9 +211,26 @@ void sd_wrapper_free(sd_wrapper_ctx_t* ctx) {
         ctx->sd_ctx = NULL;
     }
 
+    if (ctx->upscaler_ctx != NULL) {
+        free_upscaler_ctx(ctx->upscaler_ctx);
+        ctx->upscaler_ctx = NULL;
+    }
+
     delete ctx;
 }
 
+/**
+ * Milliseconds from from to to, clamped to uint32_t.
+ */
+static uint32_t elapsed_ms(std::chrono::steady_clock::time_point from,
+                           std::chrono::steady_clock::time_point to) {
+    long long ms = std::chrono::duration_cast<std::chrono::milliseconds>(to - from).count();
+    if (ms < 0) {
+        return 0;
+    }
+    return ms > (long long)UINT32_MAX ? UINT32_MAX : (uint32_t)ms;
+}
+
 /**
  * Generate an image from text prompt.
  */
@@ -198,8 +270,29 @@ sd_wrapper_error_t sd_wrapper_generate(sd_wrapper_ctx_t* ctx,
     sd_img_gen_params_t gen_params;
     sd_img_gen_params_init(&gen_params);
 
+    /*
+     * stable-diffusion.cpp applies LoRAs named by <lora:name:weight> tags
+     * in the prompt. Tags already in the prompt are refused so only the
+     * LoRAs in params are loaded.
+     */
+    if (strstr(params->prompt, "<lora:") != NULL) {
+        ctx->error_msg = "Invalid prompt: LoRA tags are not allowed";
+        return SD_WRAPPER_ERR_INVALID_PARAM;
+    }
+    if (params->lora_count > 0 &&
+        (params->loras == NULL || ctx->config.lora_model_dir == NULL)) {
+        ctx->error_msg = "Invalid LoRAs: no LoRA directory configured";
+        return SD_WRAPPER_ERR_INVALID_PARAM;
+    }
+    std::string prompt = params->prompt;
+    for (uint32_t i = 0; i < params->lora_count; i++) {
+        char weight[32];
+        snprintf(weight, sizeof(weight), "%.3f", params->loras[i].weight);
+        prompt += std::string(" <lora:") + params->loras[i].name + ":" + weight + ">";
+    }
+
     /* Set prompts */
-    gen_params.prompt = params->prompt;
+    gen_params.prompt = prompt.c_str();
     gen_params.negative_prompt = params->negative_prompt;
 
     /* Set dimensions */
@@ -222,8 +315,70 @@ sd_wrapper_error_t sd_wrapper_generate(sd_wrapper_ctx_t* ctx,
     /* Set CLIP skip */
     gen_params.clip_skip = params->clip_skip;
 
+    /* Start from the init image for img2img */
+    if (params->init_image != NULL) {
+        if ((params->init_channels != 3 && params->init_channels != 4) ||
+            !(params->strength > 0.0f && params->strength <= 1.0f)) {
+            ctx->error_msg = "Invalid init image: channels must be 3 or 4 and strength 0.0-1.0";
+            return SD_WRAPPER_ERR_INVALID_PARAM;
+        }
+        gen_params.init_image.width = params->width;
+        gen_params.init_image.height = params->height;
+        gen_params.init_image.channel = params->init_channels;
+        gen_params.init_image.data = const_cast<uint8_t*>(params->init_image);
+        gen_params.strength = params->strength;
+
+        /* Inpainting: only the masked pixels are redrawn */
+        if (params->mask_image != NULL) {
+            gen_params.mask_image.width = params->width;
+            gen_params.mask_image.height = params->height;
+            gen_params.mask_image.channel = 1;
+            gen_params.mask_image.data = const_cast<uint8_t*>(params->mask_image);
+        }
+    }
+
+    /* Guide the composition with the ControlNet loaded with the model */
+    if (params->control_image != NULL) {
+        if (ctx->config.control_net_path == NULL) {
+            ctx->error_msg = "Invalid control image: no ControlNet loaded";
+            return SD_WRAPPER_ERR_INVALID_PARAM;
+        }
+        if ((params->control_channels != 3 && params->control_channels != 4) ||
+            !(params->control_strength > 0.0f && params->control_strength <= 2.0f)) {
+            ctx->error_msg = "Invalid control image: channels must be 3 or 4 and strength 0.0-2.0";
+            return SD_WRAPPER_ERR_INVALID_PARAM;
+        }
+        gen_params.control_image.width = params->width;
+        gen_params.control_image.height = params->height;
+        gen_params.control_image.channel = params->control_channels;
+        gen_params.control_image.data = const_cast<uint8_t*>(params->control_image);
+        gen_params.control_strength = params->control_strength;
+    }
+
+    /* Decode in tiles so large images fit in VRAM */
+    gen_params.vae_tiling_params.enabled = params->vae_tiling;
+
+    /*
+     * Previews project the latent straight to RGB, which costs next to
+     * nothing but yields an image 1/8 of the output size.
+     */
+    preview_target preview = {params->preview_fn, params->preview_data, params->steps};
+    if (params->preview_fn != NULL) {
+        int interval = params->preview_interval > 0 ? (int)params->preview_interval : 1;
+        sd_set_preview_callback(sd_wrapper_preview_callback, PREVIEW_PROJ,
+                                interval, true, false, &preview);
+    }
+
     /* Generate image */
+    phase_timer timer = {};
+    sd_set_progress_callback(sd_wrapper_progress_callback, &timer);
+    auto start = std::chrono::steady_clock::now();
     sd_image_t* sd_img = generate_image(ctx->sd_ctx, &gen_params);
+    auto end = std::chrono::steady_clock::now();
+    sd_set_progress_callback(NULL, NULL);
+    if (params->preview_fn != NULL) {
+        sd_set_preview_callback(NULL, PREVIEW_NONE, 1, false, false, NULL);
+    }
     if (sd_img == NULL) {
         ctx->error_msg = "Image generation failed. Check GPU memory and model.";
         return SD_WRAPPER_ERR_GENERATION_FAILED;
@@ -261,6 +416,139 @@ sd_wrapper_error_t sd_wrapper_generate(sd_wrapper_ctx_t* ctx,
     free(sd_img->data);
     free(sd_img);
 
+    image->sampler = sd_sample_method_name(gen_params.sample_params.sample_method);
+    image->scheduler = sd_scheduler_name(gen_params.sample_params.scheduler);
+    if (timer.steps == 0) {
+        /* No progress reported: count it all as diffusion */
+        timer.sampling_start = start;
+        timer.sampling_end = end;
+    } else if (!timer.sampling_done) {
+        timer.sampling_end = end;
+    }
+    image->text_encode_ms = elapsed_ms(start, timer.sampling_start);
+    image->diffusion_ms = elapsed_ms(timer.sampling_start, timer.sampling_end);
+    image->vae_ms = elapsed_ms(timer.sampling_end, end);
+
+    return SD_WRAPPER_OK;
+}
+
+/**
+ * Resize RGB pixels with bilinear sampling.
+ */
+static void resize_rgb(const uint8_t* src, uint32_t src_w, uint32_t src_h,
+                       uint8_t* dst, uint32_t dst_w, uint32_t dst_h) {
+    for (uint32_t y = 0; y < dst_h; y++) {
+        /* Sample at pixel centres */
+        float fy = ((float)y + 0.5f) * (float)src_h / (float)dst_h - 0.5f;
+        if (fy < 0.0f) {
+            fy = 0.0f;
+        }
+        uint32_t y0 = (uint32_t)fy;
+        uint32_t y1 = (y0 + 1 < src_h) ? y0 + 1 : y0;
+        float wy = fy - (float)y0;
+
+        for (uint32_t x = 0; x < dst_w; x++) {
+            float fx = ((float)x + 0.5f) * (float)src_w / (float)dst_w - 0.5f;
+            if (fx < 0.0f) {
+                fx = 0.0f;
+            }
+            uint32_t x0 = (uint32_t)fx;
+            uint32_t x1 = (x0 + 1 < src_w) ? x0 + 1 : x0;
+            float wx = fx - (float)x0;
+
+            for (uint32_t c = 0; c < 3; c++) {
+                float top = src[((size_t)y0 * src_w + x0) * 3 + c] * (1.0f - wx) +
+                            src[((size_t)y0 * src_w + x1) * 3 + c] * wx;
+                float bottom = src[((size_t)y1 * src_w + x0) * 3 + c] * (1.0f - wx) +
+                               src[((size_t)y1 * src_w + x1) * 3 + c] * wx;
+                dst[((size_t)y * dst_w + x) * 3 + c] =
+                    (uint8_t)(top * (1.0f - wy) + bottom * wy + 0.5f);
+            }
+        }
+    }
+}
+
+/**
+ * Upscale an image with the ESRGAN upscaler model.
+ */
+sd_wrapper_error_t sd_wrapper_upscale(sd_wrapper_ctx_t* ctx,
+                                       const sd_wrapper_upscale_params_t* params,
+                                       sd_wrapper_image_t* image) {
+    if (ctx == NULL) {
+        return SD_WRAPPER_ERR_INVALID_PARAM;
+    }
+
+    if (params == NULL || params->image == NULL || image == NULL) {
+        ctx->error_msg = "Invalid parameters: params, image, or output is NULL";
+        return SD_WRAPPER_ERR_INVALID_PARAM;
+    }
+
+    if (params->width == 0 || params->height == 0 ||
+        params->target_width < params->width || params->target_width > 2048 ||
+        params->target_height < params->height || params->target_height > 2048 ||
+        (params->channels != 3 && params->channels != 4)) {
+        ctx->error_msg = "Invalid upscale: target must be 1-2048 and not smaller than the image";
+        return SD_WRAPPER_ERR_INVALID_PARAM;
+    }
+
+    if (ctx->config.upscaler_path == NULL) {
+        ctx->error_msg = "No upscaler model configured";
+        return SD_WRAPPER_ERR_MODEL_NOT_FOUND;
+    }
+
+    /* Load the upscaler on first use so startup does not pay for it */
+    if (ctx->upscaler_ctx == NULL) {
+        int n_threads = ctx->config.n_threads > 0 ? ctx->config.n_threads
+                                                  : sd_get_num_physical_cores();
+        /* Tiles keep ESRGAN's memory use bounded at 2048px */
+        ctx->upscaler_ctx = new_upscaler_ctx(ctx->config.upscaler_path,
+                                             false, false, n_threads, 128);
+        if (ctx->upscaler_ctx == NULL) {
+            ctx->error_msg = "Upscaler model load failed";
+            return SD_WRAPPER_ERR_MODEL_NOT_FOUND;
+        }
+    }
+
+    /* ESRGAN takes RGB: drop the alpha channel */
+    size_t pixels = (size_t)params->width * params->height;
+    uint8_t* rgb = (uint8_t*)malloc(pixels * 3);
+    if (rgb == NULL) {
+        ctx->error_msg = "Out of memory allocating upscale input";
+        return SD_WRAPPER_ERR_OUT_OF_MEMORY;
+    }
+    for (size_t i = 0; i < pixels; i++) {
+        memcpy(rgb + i * 3, params->image + i * params->channels, 3);
+    }
+
+    sd_image_t input;
+    input.width = params->width;
+    input.height = params->height;
+    input.channel = 3;
+    input.data = rgb;
+
+    /* The model's own scale is used; the factor only names the intent */
+    sd_image_t upscaled = upscale(ctx->upscaler_ctx, input, 4);
+    free(rgb);
+    if (upscaled.data == NULL) {
+        ctx->error_msg = "Upscaling failed. Check GPU memory and upscaler model.";
+        return SD_WRAPPER_ERR_GENERATION_FAILED;
+    }
+
+    image->width = params->target_width;
+    image->height = params->target_height;
+    image->channels = 3;
+    image->data_size = (size_t)image->width * image->height * 3;
+    image->data = (uint8_t*)malloc(image->data_size);
+    if (image->data == NULL) {
+        free(upscaled.data);
+        ctx->error_msg = "Out of memory allocating image buffer";
+        return SD_WRAPPER_ERR_OUT_OF_MEMORY;
+    }
+
+    resize_rgb(upscaled.data, upscaled.width, upscaled.height,
+               image->data, image->width, image->height);
+    free(upscaled.data);
+
     return SD_WRAPPER_OK;
 }
 
@@ -297,6 +585,40 @@ const char* sd_wrapper_get_error(sd_wrapper_ctx_t* ctx) {
 /**
  * Get model information.
  */
+sd_wrapper_error_t sd_wrapper_get_vram(uint32_t* total_mb, uint32_t* free_mb) {
+    if (total_mb == NULL || free_mb == NULL) {
+        return SD_WRAPPER_ERR_INVALID_PARAM;
+    }
+    if (ggml_backend_vk_get_device_count() < 1) {
+        return SD_WRAPPER_ERR_GPU_ERROR;
+    }
+
+    /* Generations run on the first visible device (see --gpu) */
+    size_t free_bytes = 0;
+    size_t total_bytes = 0;
+    ggml_backend_vk_get_device_memory(0, &free_bytes, &total_bytes);
+    *total_mb = (uint32_t)(total_bytes / (1024 * 1024));
+    *free_mb = (uint32_t)(free_bytes / (1024 * 1024));
+    return SD_WRAPPER_OK;
+}
+
+/**
+ * List the GPUs of the Vulkan backend.
+ */
+int sd_wrapper_get_gpus(sd_wrapper_gpu_t* gpus, int max) {
+    int count = ggml_backend_vk_get_device_count();
+
+    for (int i = 0; i < count && i < max && gpus != NULL; i++) {
+        size_t free_bytes = 0;
+        size_t total_bytes = 0;
+        ggml_backend_vk_get_device_description(i, gpus[i].name, sizeof(gpus[i].name));
+        ggml_backend_vk_get_device_memory(i, &free_bytes, &total_bytes);
+        gpus[i].vram_total_mb = (uint32_t)(total_bytes / (1024 * 1024));
+        gpus[i].vram_free_mb = (uint32_t)(free_bytes / (1024 * 1024));
+    }
+    return count;
+}
+
 sd_wrapper_error_t sd_wrapper_get_model_info(sd_wrapper_ctx_t* ctx,
                                               char* model_name,
                                               size_t buf_size) {
@@ -358,10 +680,13 @@ sd_wrapper_error_t sd_wrapper_reset(sd_wrapper_ctx_t* ctx) {
 
     /* Set model paths from stored config */
     sd_params.model_path = ctx->config.model_path;
+    sd_params.diffusion_model_path = ctx->config.diffusion_model_path;
     sd_params.clip_l_path = ctx->config.clip_l_path;
     sd_params.clip_g_path = ctx->config.clip_g_path;
     sd_params.t5xxl_path = ctx->config.t5xxl_path;
     sd_params.vae_path = ctx->config.vae_path;
+    sd_params.lora_model_dir = ctx->config.lora_model_dir;
+    sd_params.control_net_path = ctx->config.control_net_path;
 
     /* Set CPU/GPU offloading */
     sd_params.keep_clip_on_cpu = ctx->config.keep_clip_on_cpu;
@@ -391,6 +716,76 @@ sd_wrapper_error_t sd_wrapper_reset(sd_wrapper_ctx_t* ctx) {
     return SD_WRAPPER_OK;
 }
 
+/**
+ * Replace the loaded model with the one config describes.
+ */
+sd_wrapper_error_t sd_wrapper_load_model(sd_wrapper_ctx_t* ctx,
+                                          const sd_wrapper_config_t* config) {
+    if (ctx == NULL || config == NULL ||
+        (config->model_path == NULL && config->diffusion_model_path == NULL)) {
+        return SD_WRAPPER_ERR_INVALID_PARAM;
+    }
+
+    /* Free the upscaler too, so the new model has all the VRAM */
+    if (ctx->upscaler_ctx != NULL) {
+        free_upscaler_ctx(ctx->upscaler_ctx);
+        ctx->upscaler_ctx = NULL;
+    }
+
+    /* sd_wrapper_reset() frees the current model before loading */
+    ctx->config = *config;
+    sd_wrapper_error_t err = sd_wrapper_reset(ctx);
+    if (err != SD_WRAPPER_OK) {
+        ctx->error_msg = "Failed to load model";
+    }
+    return err;
+}
+
+/**
+ * Preview callback for stable-diffusion.cpp.
+ * Passes the first RGB frame on to the generation's preview function.
+ */
+static void sd_wrapper_preview_callback(int step,
+                                         int frame_count,
+                                         sd_image_t* frames,
+                                         bool is_noisy,
+                                         void* data) {
+    (void)is_noisy;
+    preview_target* preview = static_cast<preview_target*>(data);
+    if (preview == NULL || preview->fn == NULL || frame_count < 1 ||
+        frames == NULL || frames[0].data == NULL || frames[0].channel != 3 ||
+        step < 1) {
+        return;
+    }
+    preview->fn((uint32_t)step, preview->steps, frames[0].width,
+                frames[0].height, frames[0].data, preview->data);
+}
+
+/**
+ * Progress callback for stable-diffusion.cpp.
+ * Times the sampling run: it starts with step 0, or one step's time before
+ * step 1 if step 0 is not reported, and ends at its last step.
+ */
+static void sd_wrapper_progress_callback(int step, int steps, float time, void* data) {
+    phase_timer* timer = static_cast<phase_timer*>(data);
+    if (timer == NULL || timer->sampling_done || steps < 1) {
+        return;
+    }
+    auto now = std::chrono::steady_clock::now();
+    if (timer->steps == 0) {
+        timer->steps = steps;
+        timer->sampling_start = now;
+        if (step > 0 && time > 0.0f) {
+            timer->sampling_start -= std::chrono::duration_cast<std::chrono::steady_clock::duration>(
+                std::chrono::duration<float>(time));
+        }
+    }
+    if (step >= timer->steps) {
+        timer->sampling_end = now;
+        timer->sampling_done = true;
+    }
+}
+
 /**
  * Logging callback for stable-diffusion.cpp.
  */
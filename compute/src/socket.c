@@ -21,11 +21,15 @@
 #define _GNU_SOURCE
 
 #include <errno.h>
+#include <fcntl.h>
+#include <limits.h>
+#include <netdb.h>
 #include <signal.h>
 #include <stdarg.h>
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
+#include <sys/mman.h>
 #include <sys/socket.h>
 #include <sys/stat.h>
 #include <sys/un.h>
@@ -466,6 +470,174 @@ socket_error_t socket_auth_connection(int client_fd) {
     return SOCKET_OK;
 }
 
+/**
+ * split_tcp_address - Split host:port at the last colon
+ *
+ * @return  Pointer to the port in address, or NULL if address is invalid
+ */
+static const char *split_tcp_address(const char *address, char *host, size_t host_size) {
+    const char *colon = strrchr(address, ':');
+    if (colon == NULL || colon[1] == '\0' || (size_t)(colon - address) >= host_size) {
+        return NULL;
+    }
+    memcpy(host, address, (size_t)(colon - address));
+    host[colon - address] = '\0';
+    return colon + 1;
+}
+
+/**
+ * socket_listen_tcp - Create a listening TCP socket for remote weave
+ */
+socket_error_t socket_listen_tcp(const char *address, int *listen_fd) {
+    if (address == NULL || listen_fd == NULL) {
+        return SOCKET_ERR_NULL_POINTER;
+    }
+
+    *listen_fd = -1;
+
+    char host[SOCKET_PATH_MAX];
+    const char *port = split_tcp_address(address, host, sizeof(host));
+    if (port == NULL) {
+        socket_log(SOCKET_LOG_ERROR, "invalid TCP address: %s", address);
+        return SOCKET_ERR_SOCKET_FAILED;
+    }
+
+    struct addrinfo hints;
+    struct addrinfo *addrs = NULL;
+    memset(&hints, 0, sizeof(hints));
+    hints.ai_family = AF_UNSPEC;
+    hints.ai_socktype = SOCK_STREAM;
+    hints.ai_flags = AI_PASSIVE | AI_NUMERICSERV;
+    int gai_err = getaddrinfo(host[0] != '\0' ? host : NULL, port, &hints, &addrs);
+    if (gai_err != 0) {
+        socket_log(SOCKET_LOG_ERROR, "invalid TCP address %s: %s", address, gai_strerror(gai_err));
+        return SOCKET_ERR_SOCKET_FAILED;
+    }
+
+    int sock_fd = socket(addrs->ai_family, addrs->ai_socktype, addrs->ai_protocol);
+    if (sock_fd < 0) {
+        socket_log(SOCKET_LOG_ERROR, "socket() failed: %s", strerror(errno));
+        freeaddrinfo(addrs);
+        return SOCKET_ERR_SOCKET_FAILED;
+    }
+
+    /* Restarting compute must not wait for TIME_WAIT to expire */
+    int reuse = 1;
+    setsockopt(sock_fd, SOL_SOCKET, SO_REUSEADDR, &reuse, sizeof(reuse));
+
+    if (bind(sock_fd, addrs->ai_addr, addrs->ai_addrlen) != 0) {
+        socket_log(SOCKET_LOG_ERROR, "bind() failed for %s: %s", address, strerror(errno));
+        freeaddrinfo(addrs);
+        close(sock_fd);
+        return SOCKET_ERR_BIND_FAILED;
+    }
+    freeaddrinfo(addrs);
+
+    if (listen(sock_fd, LISTEN_BACKLOG) != 0) {
+        socket_log(SOCKET_LOG_ERROR, "listen() failed: %s", strerror(errno));
+        close(sock_fd);
+        return SOCKET_ERR_LISTEN_FAILED;
+    }
+
+    socket_log(SOCKET_LOG_INFO, "listening on %s%s", SOCKET_TCP_PREFIX, address);
+
+    *listen_fd = sock_fd;
+    return SOCKET_OK;
+}
+
+/**
+ * socket_auth_token - Authenticate a TCP connection by its token
+ */
+socket_error_t socket_auth_token(int client_fd, const char *token) {
+    if (client_fd < 0) {
+        return SOCKET_ERR_INVALID_FD;
+    }
+    if (token == NULL) {
+        return SOCKET_ERR_NULL_POINTER;
+    }
+
+    if (socket_set_timeouts(client_fd, DEFAULT_READ_TIMEOUT_S, DEFAULT_WRITE_TIMEOUT_S) != SOCKET_OK) {
+        return SOCKET_ERR_AUTH_TOKEN;
+    }
+
+    /* Read all of it before comparing so timing reveals nothing */
+    size_t token_len = strlen(token);
+    unsigned char diff = 0;
+    size_t received = 0;
+    while (received < token_len) {
+        unsigned char c;
+        ssize_t n = recv(client_fd, &c, 1, 0);
+        if (n < 0 && errno == EINTR) {
+            continue;
+        }
+        if (n != 1) {
+            socket_log(SOCKET_LOG_DEBUG, "auth rejected: connection closed before the token");
+            return SOCKET_ERR_AUTH_TOKEN;
+        }
+        diff |= (unsigned char)(c ^ (unsigned char)token[received]);
+        received++;
+    }
+    if (diff != 0) {
+        socket_log(SOCKET_LOG_DEBUG, "auth rejected: invalid token");
+        return SOCKET_ERR_AUTH_TOKEN;
+    }
+
+    socket_log(SOCKET_LOG_DEBUG, "auth accepted: valid token");
+    return SOCKET_OK;
+}
+
+/**
+ * socket_share_data - Copy data into a new shared memory segment
+ */
+socket_error_t socket_share_data(const char *dir, const void *data, size_t len,
+                                 char *name_buf, size_t name_size) {
+    static unsigned long segment_count = 0;
+
+    if (dir == NULL || data == NULL || name_buf == NULL) {
+        return SOCKET_ERR_NULL_POINTER;
+    }
+    if (len == 0) {
+        return SOCKET_ERR_SHARE_FAILED;
+    }
+
+    int written = snprintf(name_buf, name_size, "%s%ld-%lu", SOCKET_SHM_PREFIX,
+                           (long)getpid(), segment_count++);
+    if (written < 0 || (size_t)written >= name_size) {
+        return SOCKET_ERR_PATH_TOO_LONG;
+    }
+
+    char path[PATH_MAX];
+    written = snprintf(path, sizeof(path), "%s/%s", dir, name_buf);
+    if (written < 0 || (size_t)written >= sizeof(path)) {
+        return SOCKET_ERR_PATH_TOO_LONG;
+    }
+
+    int fd = open(path, O_RDWR | O_CREAT | O_EXCL | O_CLOEXEC, 0600);
+    if (fd < 0) {
+        socket_log(SOCKET_LOG_WARN, "failed to create %s: %s", path, strerror(errno));
+        return SOCKET_ERR_SHARE_FAILED;
+    }
+
+    if (ftruncate(fd, (off_t)len) != 0) {
+        socket_log(SOCKET_LOG_WARN, "failed to size %s: %s", path, strerror(errno));
+        close(fd);
+        unlink(path);
+        return SOCKET_ERR_SHARE_FAILED;
+    }
+
+    void *segment = mmap(NULL, len, PROT_READ | PROT_WRITE, MAP_SHARED, fd, 0);
+    close(fd);
+    if (segment == MAP_FAILED) {
+        socket_log(SOCKET_LOG_WARN, "failed to map %s: %s", path, strerror(errno));
+        unlink(path);
+        return SOCKET_ERR_SHARE_FAILED;
+    }
+
+    memcpy(segment, data, len);
+    munmap(segment, len);
+    return SOCKET_OK;
+}
+
 /**
  * socket_error_string - Get human-readable error message
  */
@@ -507,6 +679,12 @@ const char *socket_error_string(socket_error_t err) {
             return "null handler provided to accept loop";
         case SOCKET_ERR_CONNECT_FAILED:
             return "failed to connect to socket";
+        case SOCKET_ERR_SHARE_FAILED:
+            return "failed to create shared memory segment";
+        case SOCKET_ERR_TOKEN_NOT_SET:
+            return SOCKET_TOKEN_ENV " not set";
+        case SOCKET_ERR_AUTH_TOKEN:
+            return "client sent an invalid token";
         default:
             return "unknown error";
     }
@@ -571,6 +749,76 @@ void socket_reset_shutdown(void) {
     g_shutdown_requested = 0;
 }
 
+/**
+ * socket_connect_tcp - Connect to weave over TCP and send the token
+ *
+ * @param address      host:port to connect to
+ * @param connected_fd Pointer to store the connected socket file descriptor
+ * @return             SOCKET_OK on success, error code on failure
+ */
+static socket_error_t socket_connect_tcp(const char *address, int *connected_fd) {
+    const char *token = getenv(SOCKET_TOKEN_ENV);
+    if (token == NULL || token[0] == '\0') {
+        socket_log(SOCKET_LOG_ERROR, "%s not set for %s%s",
+                   SOCKET_TOKEN_ENV, SOCKET_TCP_PREFIX, address);
+        return SOCKET_ERR_TOKEN_NOT_SET;
+    }
+
+    char host[SOCKET_PATH_MAX];
+    const char *port = split_tcp_address(address, host, sizeof(host));
+    if (port == NULL || host[0] == '\0') {
+        socket_log(SOCKET_LOG_ERROR, "invalid TCP address: %s", address);
+        return SOCKET_ERR_CONNECT_FAILED;
+    }
+
+    struct addrinfo hints;
+    struct addrinfo *addrs = NULL;
+    memset(&hints, 0, sizeof(hints));
+    hints.ai_family = AF_UNSPEC;
+    hints.ai_socktype = SOCK_STREAM;
+    hints.ai_flags = AI_NUMERICHOST | AI_NUMERICSERV;
+    int gai_err = getaddrinfo(host, port, &hints, &addrs);
+    if (gai_err != 0) {
+        socket_log(SOCKET_LOG_ERROR, "invalid TCP address %s: %s", address, gai_strerror(gai_err));
+        return SOCKET_ERR_CONNECT_FAILED;
+    }
+
+    int sock_fd = socket(addrs->ai_family, addrs->ai_socktype, addrs->ai_protocol);
+    if (sock_fd < 0) {
+        socket_log(SOCKET_LOG_ERROR, "socket() failed: %s", strerror(errno));
+        freeaddrinfo(addrs);
+        return SOCKET_ERR_SOCKET_FAILED;
+    }
+    if (connect(sock_fd, addrs->ai_addr, addrs->ai_addrlen) != 0) {
+        socket_log(SOCKET_LOG_ERROR, "connect() failed for %s: %s", address, strerror(errno));
+        freeaddrinfo(addrs);
+        close(sock_fd);
+        return SOCKET_ERR_CONNECT_FAILED;
+    }
+    freeaddrinfo(addrs);
+
+    /* Authenticate: the token is the first thing weave reads */
+    size_t token_len = strlen(token);
+    size_t sent = 0;
+    while (sent < token_len) {
+        ssize_t n = send(sock_fd, token + sent, token_len - sent, MSG_NOSIGNAL);
+        if (n < 0) {
+            if (errno == EINTR) {
+                continue;
+            }
+            socket_log(SOCKET_LOG_ERROR, "failed to send token: %s", strerror(errno));
+            close(sock_fd);
+            return SOCKET_ERR_CONNECT_FAILED;
+        }
+        sent += (size_t)n;
+    }
+
+    socket_log(SOCKET_LOG_INFO, "connected to %s%s", SOCKET_TCP_PREFIX, address);
+
+    *connected_fd = sock_fd;
+    return SOCKET_OK;
+}
+
 /**
  * socket_connect - Connect to an existing Unix domain socket
  *
@@ -598,6 +846,10 @@ socket_error_t socket_connect(const char *socket_path, int *connected_fd) {
 
     *connected_fd = -1;
 
+    if (strncmp(socket_path, SOCKET_TCP_PREFIX, strlen(SOCKET_TCP_PREFIX)) == 0) {
+        return socket_connect_tcp(socket_path + strlen(SOCKET_TCP_PREFIX), connected_fd);
+    }
+
     /* Verify path fits in sockaddr_un */
     size_t path_len = strlen(socket_path);
     if (path_len >= sizeof(((struct sockaddr_un *)0)->sun_path)) {
@@ -5,10 +5,12 @@
  * They use a mock SD wrapper to avoid GPU dependencies.
  */
 
+#define _POSIX_C_SOURCE 200809L
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
 #include <assert.h>
+#include <unistd.h>
 #include "weave/generate.h"
 
 /**
@@ -18,8 +20,12 @@
 typedef struct {
     sd_wrapper_error_t error_to_return;
     sd_wrapper_gen_params_t last_params;
+    sd_wrapper_upscale_params_t last_upscale_params;
     char last_prompt[2048];
+    char last_lora_name[MAX_LORA_NAME_LENGTH + 1];
+    float last_lora_weight;
     uint32_t generate_call_count;
+    uint32_t load_model_call_count;
 } mock_sd_ctx_t;
 
 static mock_sd_ctx_t mock_ctx;
@@ -41,6 +47,20 @@ sd_wrapper_error_t sd_wrapper_generate(sd_wrapper_ctx_t* ctx,
         mock->last_params.prompt = mock->last_prompt;
     }
 
+    /* params->loras points into the caller's stack: keep the first one */
+    mock->last_params.loras = NULL;
+    if (params->lora_count > 0) {
+        strncpy(mock->last_lora_name, params->loras[0].name, sizeof(mock->last_lora_name) - 1);
+        mock->last_lora_weight = params->loras[0].weight;
+    }
+
+    /* Preview halfway through: one frame in range, one too large */
+    if (params->preview_fn != NULL) {
+        static const uint8_t pixels[2 * 1 * 3] = {1, 2, 3, 4, 5, 6};
+        params->preview_fn(params->steps / 2, params->steps, 2, 1, pixels, params->preview_data);
+        params->preview_fn(params->steps / 2, params->steps, PREVIEW_MAX_DIMENSION + 1, 1, pixels, params->preview_data);
+    }
+
     if (mock->error_to_return != SD_WRAPPER_OK) {
         return mock->error_to_return;
     }
@@ -55,6 +75,35 @@ sd_wrapper_error_t sd_wrapper_generate(sd_wrapper_ctx_t* ctx,
         return SD_WRAPPER_ERR_OUT_OF_MEMORY;
     }
 
+    image->sampler = "euler";
+    image->scheduler = "discrete";
+    image->text_encode_ms = 250;
+    image->diffusion_ms = 9000;
+    image->vae_ms = 700;
+
+    return SD_WRAPPER_OK;
+}
+
+sd_wrapper_error_t sd_wrapper_upscale(sd_wrapper_ctx_t* ctx,
+                                       const sd_wrapper_upscale_params_t* params,
+                                       sd_wrapper_image_t* image) {
+    mock_sd_ctx_t* mock = (mock_sd_ctx_t*)ctx;
+    memcpy(&mock->last_upscale_params, params, sizeof(*params));
+
+    if (mock->error_to_return != SD_WRAPPER_OK) {
+        return mock->error_to_return;
+    }
+
+    image->width = params->target_width;
+    image->height = params->target_height;
+    image->channels = 3;
+    image->data_size = params->target_width * params->target_height * 3;
+    image->data = (uint8_t*)calloc(1, image->data_size);
+
+    if (image->data == NULL) {
+        return SD_WRAPPER_ERR_OUT_OF_MEMORY;
+    }
+
     return SD_WRAPPER_OK;
 }
 
@@ -71,6 +120,18 @@ sd_wrapper_error_t sd_wrapper_reset(sd_wrapper_ctx_t* ctx) {
     return SD_WRAPPER_OK;
 }
 
+void sd_wrapper_config_init(sd_wrapper_config_t* config) {
+    memset(config, 0, sizeof(*config));
+}
+
+sd_wrapper_error_t sd_wrapper_load_model(sd_wrapper_ctx_t* ctx,
+                                          const sd_wrapper_config_t* config) {
+    mock_sd_ctx_t* mock = (mock_sd_ctx_t*)ctx;
+    (void)config;
+    mock->load_model_call_count++;
+    return mock->error_to_return;
+}
+
 /**
  * Test helpers
  */
@@ -369,6 +430,359 @@ void test_double_free_response(void) {
     printf("PASS: test_double_free_response\n");
 }
 
+void test_process_img2img_request(void) {
+    reset_mock();
+
+    static const uint8_t pixels[512 * 512 * 3];
+    sd35_img2img_request_t req;
+    memset(&req, 0, sizeof(req));
+    req.base = create_valid_request();
+    req.strength = 0.6f;
+    req.init_channels = 3;
+    req.init_data_len = sizeof(pixels);
+    req.init_data = pixels;
+
+    sd35_generate_response_t resp;
+
+    error_code_t err = process_img2img_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+
+    assert(err == ERR_NONE);
+    assert(mock_ctx.last_params.init_image == pixels);
+    assert(mock_ctx.last_params.init_channels == 3);
+    assert(mock_ctx.last_params.strength == 0.6f);
+    assert(strcmp(mock_ctx.last_params.prompt, "a cat in space") == 0);
+
+    free_generate_response(&resp);
+
+    req.init_data = NULL;
+    err = process_img2img_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_INVALID_INIT_IMAGE);
+
+    printf("PASS: test_process_img2img_request\n");
+}
+
+void test_process_inpaint_request(void) {
+    reset_mock();
+
+    static const uint8_t pixels[512 * 512 * 3];
+    static const uint8_t mask[512 * 512];
+    sd35_inpaint_request_t req;
+    memset(&req, 0, sizeof(req));
+    req.base.base = create_valid_request();
+    req.base.strength = 1.0f;
+    req.base.init_channels = 3;
+    req.base.init_data_len = sizeof(pixels);
+    req.base.init_data = pixels;
+    req.mask_data_len = sizeof(mask);
+    req.mask_data = mask;
+
+    sd35_generate_response_t resp;
+
+    error_code_t err = process_inpaint_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+
+    assert(err == ERR_NONE);
+    assert(mock_ctx.last_params.init_image == pixels);
+    assert(mock_ctx.last_params.mask_image == mask);
+    assert(mock_ctx.last_params.strength == 1.0f);
+
+    free_generate_response(&resp);
+
+    req.mask_data = NULL;
+    err = process_inpaint_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_INVALID_MASK);
+
+    printf("PASS: test_process_inpaint_request\n");
+}
+
+void test_process_control_request(void) {
+    reset_mock();
+    set_loaded_model(MODEL_ID_SD35);
+
+    static const uint8_t pixels[512 * 512 * 3];
+    sd35_control_request_t req;
+    memset(&req, 0, sizeof(req));
+    req.base = create_valid_request();
+    req.control_type = CONTROL_TYPE_CANNY;
+    req.control_strength = 0.9f;
+    req.control_channels = 3;
+    req.control_data_len = sizeof(pixels);
+    req.control_data = pixels;
+
+    sd35_generate_response_t resp;
+
+    /* SD 3.5 has no ControlNet: the loaded model is kept */
+    error_code_t err = process_control_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_CONTROLNET_UNAVAILABLE);
+    assert(mock_ctx.load_model_call_count == 0);
+    assert(mock_ctx.generate_call_count == 0);
+    assert(loaded_model() == MODEL_ID_SD35);
+    assert(model_control_net(model_lookup(MODEL_ID_SD35), CONTROL_TYPE_CANNY) == NULL);
+
+    /* The test tree has no model files, so SDXL's ControlNets are missing */
+    req.base.model_id = MODEL_ID_SDXL;
+    err = process_control_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_CONTROLNET_UNAVAILABLE);
+    assert(model_control_net(model_lookup(MODEL_ID_SDXL), CONTROL_TYPE_DEPTH) == NULL);
+
+    req.control_type = CONTROL_TYPE_COUNT;
+    err = process_control_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_INVALID_CONTROL);
+
+    req.control_type = CONTROL_TYPE_POSE;
+    req.control_data = NULL;
+    err = process_control_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_INVALID_CONTROL);
+
+    printf("PASS: test_process_control_request\n");
+}
+
+void test_process_upscale_request(void) {
+    reset_mock();
+
+    static const uint8_t pixels[64 * 48 * 4];
+    upscale_request_t req;
+    memset(&req, 0, sizeof(req));
+    req.request_id = 7;
+    req.width = 64;
+    req.height = 48;
+    req.channels = 4;
+    req.target_width = 256;
+    req.target_height = 192;
+    req.image_data_len = sizeof(pixels);
+    req.image_data = pixels;
+
+    sd35_generate_response_t resp;
+
+    error_code_t err = process_upscale_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+
+    assert(err == ERR_NONE);
+    assert(mock_ctx.last_upscale_params.image == pixels);
+    assert(mock_ctx.last_upscale_params.channels == 4);
+    assert(mock_ctx.last_upscale_params.target_width == 256);
+    assert(resp.request_id == 7);
+    assert(resp.image_width == 256);
+    assert(resp.image_height == 192);
+    assert(resp.image_data_len == 256 * 192 * 3);
+    assert(mock_ctx.generate_call_count == 0);
+
+    free_generate_response(&resp);
+
+    mock_ctx.error_to_return = SD_WRAPPER_ERR_MODEL_NOT_FOUND;
+    err = process_upscale_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_UPSCALER_UNAVAILABLE);
+
+    mock_ctx.error_to_return = SD_WRAPPER_ERR_GPU_ERROR;
+    err = process_upscale_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_GPU_ERROR);
+
+    req.image_data = NULL;
+    err = process_upscale_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_INVALID_INIT_IMAGE);
+
+    printf("PASS: test_process_upscale_request\n");
+}
+
+/* Preview frames received by record_preview */
+static preview_frame_t last_preview;
+static uint8_t last_preview_pixels[6];
+static int preview_count;
+
+static void record_preview(const preview_frame_t *frame, void *data) {
+    assert(data == &preview_count);
+    preview_count++;
+    last_preview = *frame;
+    memcpy(last_preview_pixels, frame->image_data, sizeof(last_preview_pixels));
+    last_preview.image_data = last_preview_pixels;
+}
+
+void test_preview_frames(void) {
+    reset_mock();
+    preview_count = 0;
+
+    sd35_generate_request_t req = create_valid_request();
+    req.request_id = 77;
+    req.steps = 20;
+    sd35_generate_response_t resp;
+
+    /* No handler: the wrapper is not asked for previews */
+    error_code_t err = process_generate_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_NONE);
+    assert(mock_ctx.last_params.preview_fn == NULL);
+    assert(preview_count == 0);
+    free_generate_response(&resp);
+
+    set_preview_handler(record_preview, &preview_count);
+    err = process_generate_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    set_preview_handler(NULL, NULL);
+    assert(err == ERR_NONE);
+    assert(mock_ctx.last_params.preview_interval == PREVIEW_INTERVAL_STEPS);
+
+    /* The oversized frame is dropped */
+    assert(preview_count == 1);
+    assert(last_preview.request_id == 77);
+    assert(last_preview.step == 10);
+    assert(last_preview.steps == 20);
+    assert(last_preview.width == 2);
+    assert(last_preview.height == 1);
+    assert(last_preview.channels == 3);
+    assert(last_preview.image_data_len == 6);
+    assert(last_preview_pixels[5] == 6);
+    free_generate_response(&resp);
+
+    printf("PASS: test_preview_frames\n");
+}
+
+void test_model_switch_rejected(void) {
+    reset_mock();
+    set_loaded_model(MODEL_ID_SD35);
+
+    sd35_generate_request_t req = create_valid_request();
+    sd35_generate_response_t resp;
+
+    /* Unknown models are rejected without touching the loaded one */
+    req.model_id = MODEL_COUNT;
+    error_code_t err = process_generate_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_INVALID_MODEL_ID);
+
+    /* The test tree has no model files, so SDXL is not installed */
+    req.model_id = MODEL_ID_SDXL;
+    err = process_generate_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_MODEL_UNAVAILABLE);
+
+    assert(mock_ctx.load_model_call_count == 0);
+    assert(mock_ctx.generate_call_count == 0);
+    assert(loaded_model() == MODEL_ID_SD35);
+
+    printf("PASS: test_model_switch_rejected\n");
+}
+
+void test_model_list(void) {
+    model_info_t models[MODEL_COUNT];
+
+    uint32_t count = model_list(MODEL_ID_FLUX, models, MODEL_COUNT);
+    assert(count == MODEL_COUNT);
+    for (uint32_t i = 0; i < count; i++) {
+        assert(models[i].model_id == i);
+        assert(models[i].name != NULL && strlen(models[i].name) <= MAX_MODEL_NAME_LENGTH);
+        assert(models[i].vram_mb > 0);
+    }
+    assert(models[MODEL_ID_FLUX].status == MODEL_STATUS_LOADED);
+    assert(models[MODEL_ID_SDXL].status == MODEL_STATUS_MISSING);
+
+    /* The list is cut to the space given */
+    assert(model_list(MODEL_ID_NONE, models, 1) == 1);
+    assert(models[0].status != MODEL_STATUS_LOADED);
+
+    assert(model_lookup(MODEL_COUNT) == NULL);
+    assert(model_lookup(MODEL_ID_SD35)->model_id == MODEL_ID_SD35);
+
+    printf("PASS: test_model_list\n");
+}
+
+void test_lora_params(void) {
+    reset_mock();
+    set_loaded_model(MODEL_ID_SD35);
+
+    char dir[] = "/tmp/weave-loras-XXXXXX";
+    assert(mkdtemp(dir) != NULL);
+    char path[64];
+    snprintf(path, sizeof(path), "%s/style.safetensors", dir);
+    FILE *f = fopen(path, "w");
+    assert(f != NULL);
+    fclose(f);
+
+    sd35_generate_request_t req = create_valid_request();
+    req.lora_count = 1;
+    strcpy(req.loras[0].name, "style");
+    req.loras[0].weight = 0.8f;
+    sd35_generate_response_t resp;
+
+    /* Without a LoRA directory no LoRA is installed */
+    model_set_lora_dir(NULL);
+    error_code_t err = process_generate_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_INVALID_LORA);
+    assert(mock_ctx.generate_call_count == 0);
+
+    model_set_lora_dir(dir);
+    err = process_generate_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_NONE);
+    assert(mock_ctx.last_params.lora_count == 1);
+    assert(strcmp(mock_ctx.last_lora_name, "style") == 0);
+    assert(mock_ctx.last_lora_weight == 0.8f);
+    free_generate_response(&resp);
+
+    /* LoRAs missing from the directory are rejected */
+    strcpy(req.loras[0].name, "missing");
+    err = process_generate_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_INVALID_LORA);
+    assert(mock_ctx.generate_call_count == 1);
+
+    model_set_lora_dir(NULL);
+    unlink(path);
+    rmdir(dir);
+
+    printf("PASS: test_lora_params\n");
+}
+
+void test_generation_metadata(void) {
+    reset_mock();
+    set_loaded_model(MODEL_ID_SD35);
+
+    sd35_generate_request_t req = create_valid_request();
+    sd35_generate_response_t resp;
+    memset(&resp, 0, sizeof(resp));
+
+    error_code_t err = process_generate_request((sd_wrapper_ctx_t*)&mock_ctx, &req, &resp);
+    assert(err == ERR_NONE);
+    assert(resp.has_metadata);
+    assert(strcmp(resp.metadata.sampler, "euler") == 0);
+    assert(strcmp(resp.metadata.scheduler, "discrete") == 0);
+    assert(resp.metadata.text_encode_ms == 250);
+    assert(resp.metadata.diffusion_ms == 9000);
+    assert(resp.metadata.vae_ms == 700);
+    free_generate_response(&resp);
+
+    printf("PASS: test_generation_metadata\n");
+}
+
+void test_model_hash(void) {
+    char path[] = "/tmp/weave-model-XXXXXX";
+    int fd = mkstemp(path);
+    assert(fd >= 0);
+    FILE *f = fdopen(fd, "wb");
+    assert(f != NULL);
+    for (uint32_t i = 0; i < MODEL_HASH_OFFSET + MODEL_HASH_CHUNK; i++) {
+        fputc((int)(i & 0xFF), f);
+    }
+    fclose(f);
+
+    model_entry_t entry;
+    memset(&entry, 0, sizeof(entry));
+    entry.model_path = path;
+    char hash[MODEL_HASH_LENGTH + 1];
+
+    /* SHA-256 of the bytes at MODEL_HASH_OFFSET, as the web UI hashes them */
+    assert(model_hash(&entry, hash));
+    assert(strcmp(hash, "7daca209") == 0);
+
+    /* Split models are hashed by their diffusion model */
+    entry.model_path = NULL;
+    entry.diffusion_model_path = path;
+    assert(model_hash(&entry, hash));
+    assert(strcmp(hash, "7daca209") == 0);
+
+    /* Files shorter than the offset hash no bytes */
+    assert(truncate(path, 16) == 0);
+    assert(model_hash(&entry, hash));
+    assert(strcmp(hash, "e3b0c442") == 0);
+
+    unlink(path);
+    assert(!model_hash(&entry, hash));
+    assert(!model_hash(NULL, hash));
+
+    printf("PASS: test_model_hash\n");
+}
+
 int main(void) {
     printf("Running generate pipeline tests...\n\n");
 
@@ -390,6 +804,16 @@ int main(void) {
     test_free_null_response();
     test_free_empty_response();
     test_double_free_response();
+    test_process_img2img_request();
+    test_process_inpaint_request();
+    test_process_control_request();
+    test_process_upscale_request();
+    test_preview_frames();
+    test_model_switch_rejected();
+    test_model_list();
+    test_lora_params();
+    test_generation_metadata();
+    test_model_hash();
 
     printf("\nAll tests passed!\n");
     return 0;
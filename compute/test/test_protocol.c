@@ -24,12 +24,47 @@
 
 extern error_code_t decode_generate_request(const uint8_t *data, size_t data_len,
                                             sd35_generate_request_t *req);
+extern error_code_t decode_img2img_request(const uint8_t *data, size_t data_len,
+                                           sd35_img2img_request_t *req);
+extern error_code_t decode_inpaint_request(const uint8_t *data, size_t data_len,
+                                           sd35_inpaint_request_t *req);
+extern error_code_t decode_control_request(const uint8_t *data, size_t data_len,
+                                           sd35_control_request_t *req);
 extern error_code_t encode_generate_response(const sd35_generate_response_t *resp,
                                              uint8_t *buffer, size_t buf_size,
                                              size_t *out_len);
 extern error_code_t encode_error_response(const error_response_t *resp,
                                           uint8_t *buffer, size_t buf_size,
                                           size_t *out_len);
+extern error_code_t decode_ping_request(const uint8_t *data, size_t data_len,
+                                        uint64_t *request_id);
+extern error_code_t encode_pong_response(uint64_t request_id, uint8_t *buffer,
+                                         size_t buf_size, size_t *out_len);
+extern error_code_t decode_models_request(const uint8_t *data, size_t data_len,
+                                          uint64_t *request_id);
+extern error_code_t encode_models_response(uint64_t request_id,
+                                           const model_info_t *models, uint32_t count,
+                                           uint8_t *buffer, size_t buf_size,
+                                           size_t *out_len);
+extern error_code_t decode_capabilities_request(const uint8_t *data, size_t data_len,
+                                                uint64_t *request_id);
+extern error_code_t encode_capabilities_response(uint64_t request_id,
+                                                 const capabilities_t *caps,
+                                                 uint8_t *buffer, size_t buf_size,
+                                                 size_t *out_len);
+extern error_code_t decode_hello_request(const uint8_t *data, size_t data_len,
+                                         uint64_t *request_id, uint16_t *min_version,
+                                         uint16_t *max_version);
+extern error_code_t negotiate_version(uint16_t min_version, uint16_t max_version,
+                                      uint16_t *version);
+extern error_code_t encode_hello_response(uint64_t request_id, uint16_t version,
+                                          uint8_t *buffer, size_t buf_size,
+                                          size_t *out_len);
+extern uint32_t protocol_crc32(const uint8_t *data, size_t len);
+extern error_code_t verify_checksum(uint8_t *message, size_t *message_len);
+extern error_code_t encode_preview_frame(const preview_frame_t *frame,
+                                         uint8_t *buffer, size_t buf_size,
+                                         size_t *out_len);
 
 /**
  * Test result tracking
@@ -347,13 +382,18 @@ void test_invalid_model_id(void) {
     size_t len = build_valid_request(buffer, sizeof(buffer),
                                      1, 512, 512, 28, 7.0f, 0, "test");
 
-    write_u32_be(buffer + 24, 1);
+    write_u32_be(buffer + 24, MODEL_COUNT);
 
     sd35_generate_request_t req;
     error_code_t err = decode_generate_request(buffer, len, &req);
 
     ASSERT_EQ(ERR_INVALID_MODEL_ID, err);
 
+    /* Every registered model is accepted */
+    write_u32_be(buffer + 24, MODEL_ID_FLUX);
+    ASSERT_EQ(ERR_NONE, decode_generate_request(buffer, len, &req));
+    ASSERT_EQ(MODEL_ID_FLUX, req.model_id);
+
     TEST_PASS();
 }
 
@@ -710,6 +750,153 @@ void test_encode_generate_response_valid(void) {
     TEST_PASS();
 }
 
+/**
+ * Test: Encode a generate response whose image is in shared memory
+ */
+void test_encode_generate_response_shared_memory(void) {
+    TEST("test_encode_generate_response_shared_memory");
+
+    uint8_t test_image[64 * 64 * 3];
+    memset(test_image, 0x7F, sizeof(test_image));
+
+    sd35_generate_response_t resp = {
+        .request_id = 7,
+        .status = STATUS_OK,
+        .generation_time_ms = 100,
+        .image_width = 64,
+        .image_height = 64,
+        .channels = 3,
+        .image_data_len = 64 * 64 * 3,
+        .image_data = test_image,
+        .shm_name = "weave-shm-1-0",
+    };
+
+    uint8_t buffer[256];
+    size_t encoded_len;
+
+    ASSERT_EQ(ERR_NONE, encode_generate_response(&resp, buffer, sizeof(buffer), &encoded_len));
+    ASSERT_EQ(16 + 32 + 2 + 13, encoded_len);
+    ASSERT_EQ(32 + 2 + 13, read_u32_be(buffer + 8));
+    ASSERT_EQ(HEADER_FLAG_SHARED_MEMORY, read_u32_be(buffer + 12));
+    ASSERT_EQ(64 * 64 * 3, read_u32_be(buffer + 44));
+    ASSERT_EQ(13, read_u16_be(buffer + 48));
+    ASSERT_TRUE(memcmp(buffer + 50, "weave-shm-1-0", 13) == 0);
+
+    resp.shm_name = "";
+    ASSERT_EQ(ERR_INTERNAL, encode_generate_response(&resp, buffer, sizeof(buffer), &encoded_len));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Encode a generate response that reports its seed, inline and in
+ * shared memory
+ */
+void test_encode_generate_response_seed(void) {
+    TEST("test_encode_generate_response_seed");
+
+    static uint8_t test_image[64 * 64 * 3];
+    static uint8_t buffer[16 + 32 + 64 * 64 * 3 + 8];
+    memset(test_image, 0x7F, sizeof(test_image));
+
+    sd35_generate_response_t resp = {
+        .request_id = 7,
+        .status = STATUS_OK,
+        .generation_time_ms = 100,
+        .image_width = 64,
+        .image_height = 64,
+        .channels = 3,
+        .image_data_len = 64 * 64 * 3,
+        .image_data = test_image,
+        .seed = 1234567890,
+    };
+    size_t encoded_len;
+
+    ASSERT_EQ(ERR_NONE, encode_generate_response(&resp, buffer, sizeof(buffer), &encoded_len));
+    ASSERT_EQ(sizeof(buffer), encoded_len);
+    ASSERT_EQ(32 + 64 * 64 * 3 + 8, read_u32_be(buffer + 8));
+    ASSERT_EQ(HEADER_FLAG_SEED, read_u32_be(buffer + 12));
+    ASSERT_EQ(0x7F, buffer[48 + 64 * 64 * 3 - 1]);
+    ASSERT_EQ(1234567890, read_u64_be(buffer + 48 + 64 * 64 * 3));
+
+    /* The seed follows the segment name */
+    resp.shm_name = "weave-shm-1-0";
+    ASSERT_EQ(ERR_NONE, encode_generate_response(&resp, buffer, sizeof(buffer), &encoded_len));
+    ASSERT_EQ(16 + 32 + 2 + 13 + 8, encoded_len);
+    ASSERT_EQ(HEADER_FLAG_SHARED_MEMORY | HEADER_FLAG_SEED, read_u32_be(buffer + 12));
+    ASSERT_EQ(1234567890, read_u64_be(buffer + 50 + 13));
+
+    /* No room for the seed */
+    resp.shm_name = NULL;
+    ASSERT_EQ(ERR_INTERNAL, encode_generate_response(&resp, buffer, sizeof(buffer) - 1, &encoded_len));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Encode a generate response that reports how it was generated, after
+ * the seed
+ */
+void test_encode_generate_response_metadata(void) {
+    TEST("test_encode_generate_response_metadata");
+
+    static uint8_t test_image[64 * 64 * 3];
+    static uint8_t buffer[16 + 32 + 64 * 64 * 3 + 8 + 2 + 8 + 2 + 5 + 2 + 8 + 12];
+    memset(test_image, 0x7F, sizeof(test_image));
+
+    sd35_generate_response_t resp = {
+        .request_id = 7,
+        .status = STATUS_OK,
+        .generation_time_ms = 100,
+        .image_width = 64,
+        .image_height = 64,
+        .channels = 3,
+        .image_data_len = 64 * 64 * 3,
+        .image_data = test_image,
+        .seed = 1234567890,
+        .metadata = {
+            .model_hash = "a1b2c3d4",
+            .sampler = "euler",
+            .scheduler = "discrete",
+            .text_encode_ms = 250,
+            .diffusion_ms = 9000,
+            .vae_ms = 700,
+        },
+        .has_metadata = true,
+    };
+    size_t encoded_len;
+
+    ASSERT_EQ(ERR_NONE, encode_generate_response(&resp, buffer, sizeof(buffer), &encoded_len));
+    ASSERT_EQ(sizeof(buffer), encoded_len);
+    ASSERT_EQ(encoded_len - 16, read_u32_be(buffer + 8));
+    ASSERT_EQ(HEADER_FLAG_SEED | HEADER_FLAG_METADATA, read_u32_be(buffer + 12));
+
+    const uint8_t *ptr = buffer + 48 + 64 * 64 * 3;
+    ASSERT_EQ(1234567890, read_u64_be(ptr));
+    ptr += 8;
+    ASSERT_EQ(8, read_u16_be(ptr));
+    ASSERT_EQ(0, memcmp(ptr + 2, "a1b2c3d4", 8));
+    ptr += 2 + 8;
+    ASSERT_EQ(5, read_u16_be(ptr));
+    ASSERT_EQ(0, memcmp(ptr + 2, "euler", 5));
+    ptr += 2 + 5;
+    ASSERT_EQ(8, read_u16_be(ptr));
+    ASSERT_EQ(0, memcmp(ptr + 2, "discrete", 8));
+    ptr += 2 + 8;
+    ASSERT_EQ(250, read_u32_be(ptr));
+    ASSERT_EQ(9000, read_u32_be(ptr + 4));
+    ASSERT_EQ(700, read_u32_be(ptr + 8));
+
+    /* No room for the metadata */
+    ASSERT_EQ(ERR_INTERNAL, encode_generate_response(&resp, buffer, sizeof(buffer) - 1, &encoded_len));
+
+    /* Strings must be terminated */
+    memset(resp.metadata.sampler, 'x', sizeof(resp.metadata.sampler));
+    ASSERT_EQ(ERR_INTERNAL, encode_generate_response(&resp, buffer, sizeof(buffer), &encoded_len));
+
+    TEST_PASS();
+}
+
 /**
  * Test: Encode minimum dimensions (64x64)
  */
@@ -1106,9 +1293,1081 @@ void test_encode_error_response_buffer_too_small(void) {
     TEST_PASS();
 }
 
+/**
+ * Helper: Build an img2img request from a generate request
+ *
+ * The init image bytes are filled with 0x80; init_data_len is written as
+ * given so tests can send a length that does not match the pixels.
+ */
+static size_t build_img2img_request(uint8_t *buffer, size_t buffer_size,
+                                    uint32_t width, uint32_t height,
+                                    float strength, uint32_t init_channels,
+                                    uint32_t init_data_len,
+                                    const char *prompt) {
+    uint8_t generate[4096];
+    size_t gen_len = build_valid_request(generate, sizeof(generate), 7,
+                                         width, height, 28, 7.0f, 42, prompt);
+    if (gen_len == 0) {
+        return 0;
+    }
+
+    size_t prompt_data_size = gen_len - 16 - 60;
+    size_t payload_len = 60 + 12 + prompt_data_size + init_data_len;
+    size_t total_len = 16 + payload_len;
+    if (total_len > buffer_size) {
+        return 0;
+    }
+
+    memcpy(buffer, generate, 16 + 60);
+    write_u16_be(buffer + 6, MSG_IMG2IMG_REQUEST);
+    write_u32_be(buffer + 8, (uint32_t)payload_len);
+
+    uint8_t *ptr = buffer + 16 + 60;
+    write_f32_be(ptr, strength);
+    write_u32_be(ptr + 4, init_channels);
+    write_u32_be(ptr + 8, init_data_len);
+    ptr += 12;
+
+    memcpy(ptr, generate + 16 + 60, prompt_data_size);
+    ptr += prompt_data_size;
+    memset(ptr, 0x80, init_data_len);
+
+    return total_len;
+}
+
+/**
+ * Test: Valid img2img request
+ */
+void test_img2img_request_valid(void) {
+    TEST("test_img2img_request_valid");
+
+    static uint8_t buffer[64 * 64 * 4 + 4096];
+    size_t len = build_img2img_request(buffer, sizeof(buffer), 64, 64,
+                                       0.6f, 3, 64 * 64 * 3, "a cat");
+    ASSERT_TRUE(len > 0);
+
+    sd35_img2img_request_t req;
+    ASSERT_EQ(ERR_NONE, decode_img2img_request(buffer, len, &req));
+    ASSERT_EQ(7, req.base.request_id);
+    ASSERT_EQ(64, req.base.width);
+    ASSERT_EQ(64, req.base.height);
+    ASSERT_EQ(5, req.base.clip_l_length);
+    ASSERT_TRUE(memcmp(req.base.prompt_data, "a cat", 5) == 0);
+    ASSERT_TRUE(fabsf(req.strength - 0.6f) < 0.001f);
+    ASSERT_EQ(3, req.init_channels);
+    ASSERT_EQ(64 * 64 * 3, req.init_data_len);
+    ASSERT_EQ(0x80, req.init_data[0]);
+    ASSERT_TRUE(req.init_data + req.init_data_len == buffer + len);
+
+    len = build_img2img_request(buffer, sizeof(buffer), 64, 64,
+                                1.0f, 4, 64 * 64 * 4, "a cat");
+    ASSERT_EQ(ERR_NONE, decode_img2img_request(buffer, len, &req));
+    ASSERT_EQ(4, req.init_channels);
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Reject invalid img2img requests
+ */
+void test_img2img_request_invalid(void) {
+    TEST("test_img2img_request_invalid");
+
+    static uint8_t buffer[64 * 64 * 4 + 4096];
+    sd35_img2img_request_t req;
+    size_t len;
+
+    len = build_img2img_request(buffer, sizeof(buffer), 64, 64,
+                                0.0f, 3, 64 * 64 * 3, "a cat");
+    ASSERT_EQ(ERR_INVALID_INIT_IMAGE, decode_img2img_request(buffer, len, &req));
+
+    len = build_img2img_request(buffer, sizeof(buffer), 64, 64,
+                                1.5f, 3, 64 * 64 * 3, "a cat");
+    ASSERT_EQ(ERR_INVALID_INIT_IMAGE, decode_img2img_request(buffer, len, &req));
+
+    len = build_img2img_request(buffer, sizeof(buffer), 64, 64,
+                                NAN, 3, 64 * 64 * 3, "a cat");
+    ASSERT_EQ(ERR_INVALID_INIT_IMAGE, decode_img2img_request(buffer, len, &req));
+
+    len = build_img2img_request(buffer, sizeof(buffer), 64, 64,
+                                0.5f, 1, 64 * 64, "a cat");
+    ASSERT_EQ(ERR_INVALID_INIT_IMAGE, decode_img2img_request(buffer, len, &req));
+
+    len = build_img2img_request(buffer, sizeof(buffer), 64, 64,
+                                0.5f, 3, 32 * 32 * 3, "a cat");
+    ASSERT_EQ(ERR_INVALID_INIT_IMAGE, decode_img2img_request(buffer, len, &req));
+
+    len = build_img2img_request(buffer, sizeof(buffer), 64, 64,
+                                0.5f, 3, 64 * 64 * 3, "a cat");
+    ASSERT_EQ(ERR_INTERNAL, decode_img2img_request(buffer, len - 1, &req));
+
+    /* init_data_len larger than the payload */
+    write_u32_be(buffer + 16 + 60 + 8, 0xFFFFFFFF);
+    ASSERT_EQ(ERR_INTERNAL, decode_img2img_request(buffer, len, &req));
+
+    /* A generate request is not an img2img request, nor the reverse */
+    len = build_img2img_request(buffer, sizeof(buffer), 64, 64,
+                                0.5f, 3, 64 * 64 * 3, "a cat");
+    sd35_generate_request_t gen;
+    ASSERT_EQ(ERR_INTERNAL, decode_generate_request(buffer, len, &gen));
+    write_u16_be(buffer + 6, MSG_GENERATE_REQUEST);
+    ASSERT_EQ(ERR_INTERNAL, decode_img2img_request(buffer, len, &req));
+
+    TEST_PASS();
+}
+
+/**
+ * Helper: Build an inpaint request from an img2img request
+ *
+ * The mask bytes are filled with 0xFF; mask_data_len is written as given.
+ */
+static size_t build_inpaint_request(uint8_t *buffer, size_t buffer_size,
+                                    uint32_t width, uint32_t height,
+                                    uint32_t init_channels,
+                                    uint32_t mask_data_len,
+                                    const char *prompt) {
+    static uint8_t img2img[64 * 64 * 4 + 4096];
+    uint32_t init_data_len = width * height * init_channels;
+    size_t len = build_img2img_request(img2img, sizeof(img2img), width, height,
+                                       0.8f, init_channels, init_data_len, prompt);
+    if (len == 0 || len + 4 + mask_data_len > buffer_size) {
+        return 0;
+    }
+
+    size_t fields_end = 16 + 60 + 12;
+    size_t total_len = len + 4 + mask_data_len;
+
+    memcpy(buffer, img2img, fields_end);
+    write_u16_be(buffer + 6, MSG_INPAINT_REQUEST);
+    write_u32_be(buffer + 8, (uint32_t)(total_len - 16));
+    write_u32_be(buffer + fields_end, mask_data_len);
+    memcpy(buffer + fields_end + 4, img2img + fields_end, len - fields_end);
+    memset(buffer + len + 4, 0xFF, mask_data_len);
+
+    return total_len;
+}
+
+/**
+ * Test: Valid inpaint request
+ */
+void test_inpaint_request_valid(void) {
+    TEST("test_inpaint_request_valid");
+
+    static uint8_t buffer[64 * 64 * 7 + 4096];
+    size_t len = build_inpaint_request(buffer, sizeof(buffer), 64, 64, 3,
+                                       64 * 64, "a hat");
+    ASSERT_TRUE(len > 0);
+
+    sd35_inpaint_request_t req;
+    ASSERT_EQ(ERR_NONE, decode_inpaint_request(buffer, len, &req));
+    ASSERT_EQ(64, req.base.base.width);
+    ASSERT_EQ(5, req.base.base.clip_l_length);
+    ASSERT_TRUE(memcmp(req.base.base.prompt_data, "a hat", 5) == 0);
+    ASSERT_TRUE(fabsf(req.base.strength - 0.8f) < 0.001f);
+    ASSERT_EQ(64 * 64 * 3, req.base.init_data_len);
+    ASSERT_EQ(0x80, req.base.init_data[0]);
+    ASSERT_EQ(64 * 64, req.mask_data_len);
+    ASSERT_TRUE(req.mask_data == req.base.init_data + req.base.init_data_len);
+    ASSERT_EQ(0xFF, req.mask_data[0]);
+    ASSERT_TRUE(req.mask_data + req.mask_data_len == buffer + len);
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Reject invalid inpaint requests
+ */
+void test_inpaint_request_invalid(void) {
+    TEST("test_inpaint_request_invalid");
+
+    static uint8_t buffer[64 * 64 * 7 + 4096];
+    sd35_inpaint_request_t req;
+    size_t len;
+
+    /* Mask must be one byte per pixel */
+    len = build_inpaint_request(buffer, sizeof(buffer), 64, 64, 3,
+                                64 * 64 * 3, "a hat");
+    ASSERT_EQ(ERR_INVALID_MASK, decode_inpaint_request(buffer, len, &req));
+
+    len = build_inpaint_request(buffer, sizeof(buffer), 64, 64, 3,
+                                100, "a hat");
+    ASSERT_EQ(ERR_INVALID_MASK, decode_inpaint_request(buffer, len, &req));
+
+    /* Mask larger than the payload */
+    len = build_inpaint_request(buffer, sizeof(buffer), 64, 64, 3,
+                                64 * 64, "a hat");
+    write_u32_be(buffer + 16 + 60 + 12, 0xFFFFFFFF);
+    ASSERT_EQ(ERR_INTERNAL, decode_inpaint_request(buffer, len, &req));
+
+    /* Init image rules still apply */
+    len = build_inpaint_request(buffer, sizeof(buffer), 64, 64, 3,
+                                64 * 64, "a hat");
+    write_f32_be(buffer + 16 + 60, 0.0f);
+    ASSERT_EQ(ERR_INVALID_INIT_IMAGE, decode_inpaint_request(buffer, len, &req));
+
+    /* An img2img request is not an inpaint request */
+    len = build_img2img_request(buffer, sizeof(buffer), 64, 64,
+                                0.5f, 3, 64 * 64 * 3, "a hat");
+    ASSERT_EQ(ERR_INTERNAL, decode_inpaint_request(buffer, len, &req));
+    ASSERT_EQ(ERR_INTERNAL, decode_inpaint_request(NULL, len, &req));
+    ASSERT_EQ(ERR_INTERNAL, decode_inpaint_request(buffer, len, NULL));
+
+    TEST_PASS();
+}
+
+/**
+ * Helper: Build an upscale request
+ *
+ * The pixels are filled with 0x80; image_data_len is written as given.
+ */
+static size_t build_upscale_request(uint8_t *buffer, size_t buffer_size,
+                                    uint32_t width, uint32_t height,
+                                    uint32_t channels,
+                                    uint32_t target_width, uint32_t target_height,
+                                    uint32_t image_data_len) {
+    size_t total_len = 16 + 32 + (size_t)image_data_len;
+    if (total_len > buffer_size) {
+        return 0;
+    }
+
+    write_u32_be(buffer, PROTOCOL_MAGIC);
+    write_u16_be(buffer + 4, PROTOCOL_VERSION_1);
+    write_u16_be(buffer + 6, MSG_UPSCALE_REQUEST);
+    write_u32_be(buffer + 8, (uint32_t)(total_len - 16));
+    write_u32_be(buffer + 12, 0);
+
+    write_u64_be(buffer + 16, 77);
+    write_u32_be(buffer + 24, width);
+    write_u32_be(buffer + 28, height);
+    write_u32_be(buffer + 32, channels);
+    write_u32_be(buffer + 36, target_width);
+    write_u32_be(buffer + 40, target_height);
+    write_u32_be(buffer + 44, image_data_len);
+    memset(buffer + 48, 0x80, image_data_len);
+
+    return total_len;
+}
+
+/**
+ * Test: Valid upscale request
+ */
+void test_upscale_request_valid(void) {
+    TEST("test_upscale_request_valid");
+
+    static uint8_t buffer[64 * 48 * 4 + 64];
+    size_t len = build_upscale_request(buffer, sizeof(buffer), 64, 48, 3,
+                                       170, 128, 64 * 48 * 3);
+    ASSERT_TRUE(len > 0);
+
+    upscale_request_t req;
+    ASSERT_EQ(ERR_NONE, decode_upscale_request(buffer, len, &req));
+    ASSERT_EQ(77, req.request_id);
+    ASSERT_EQ(64, req.width);
+    ASSERT_EQ(48, req.height);
+    ASSERT_EQ(3, req.channels);
+    ASSERT_EQ(170, req.target_width);
+    ASSERT_EQ(128, req.target_height);
+    ASSERT_EQ(64 * 48 * 3, req.image_data_len);
+    ASSERT_TRUE(req.image_data == buffer + 48);
+    ASSERT_EQ(0x80, req.image_data[0]);
+
+    /* Unaligned sizes and RGBA are accepted */
+    len = build_upscale_request(buffer, sizeof(buffer), 50, 30, 4,
+                                200, 120, 50 * 30 * 4);
+    ASSERT_EQ(ERR_NONE, decode_upscale_request(buffer, len, &req));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Reject invalid upscale requests
+ */
+void test_upscale_request_invalid(void) {
+    TEST("test_upscale_request_invalid");
+
+    static uint8_t buffer[64 * 64 * 4 + 64];
+    upscale_request_t req;
+    size_t len;
+
+    /* Target smaller than the input */
+    len = build_upscale_request(buffer, sizeof(buffer), 64, 64, 3,
+                                32, 128, 64 * 64 * 3);
+    ASSERT_EQ(ERR_INVALID_DIMENSIONS, decode_upscale_request(buffer, len, &req));
+
+    /* More than UPSCALE_MAX_FACTOR times the input */
+    len = build_upscale_request(buffer, sizeof(buffer), 64, 64, 3,
+                                257, 256, 64 * 64 * 3);
+    ASSERT_EQ(ERR_INVALID_DIMENSIONS, decode_upscale_request(buffer, len, &req));
+
+    /* Larger than SD35_MAX_DIMENSION */
+    len = build_upscale_request(buffer, sizeof(buffer), 1, 1, 3,
+                                1, 2049, 3);
+    ASSERT_EQ(ERR_INVALID_DIMENSIONS, decode_upscale_request(buffer, len, &req));
+
+    len = build_upscale_request(buffer, sizeof(buffer), 0, 64, 3,
+                                0, 128, 0);
+    ASSERT_EQ(ERR_INVALID_DIMENSIONS, decode_upscale_request(buffer, len, &req));
+
+    /* Pixels must match the size and channels */
+    len = build_upscale_request(buffer, sizeof(buffer), 64, 64, 2,
+                                128, 128, 64 * 64 * 2);
+    ASSERT_EQ(ERR_INVALID_INIT_IMAGE, decode_upscale_request(buffer, len, &req));
+
+    len = build_upscale_request(buffer, sizeof(buffer), 64, 64, 3,
+                                128, 128, 64 * 64 * 4);
+    ASSERT_EQ(ERR_INVALID_INIT_IMAGE, decode_upscale_request(buffer, len, &req));
+
+    /* image_data_len must cover the rest of the payload */
+    len = build_upscale_request(buffer, sizeof(buffer), 64, 64, 3,
+                                128, 128, 64 * 64 * 3);
+    write_u32_be(buffer + 44, 0xFFFFFFFF);
+    ASSERT_EQ(ERR_INTERNAL, decode_upscale_request(buffer, len, &req));
+
+    /* Truncated and mistyped messages */
+    len = build_upscale_request(buffer, sizeof(buffer), 64, 64, 3,
+                                128, 128, 64 * 64 * 3);
+    ASSERT_EQ(ERR_INTERNAL, decode_upscale_request(buffer, len - 1, &req));
+    write_u16_be(buffer + 6, MSG_IMG2IMG_REQUEST);
+    ASSERT_EQ(ERR_INTERNAL, decode_upscale_request(buffer, len, &req));
+    ASSERT_EQ(ERR_INTERNAL, decode_upscale_request(NULL, len, &req));
+    ASSERT_EQ(ERR_INTERNAL, decode_upscale_request(buffer, len, NULL));
+
+    TEST_PASS();
+}
+
 /**
  * Main test runner
  */
+/**
+ * build_ping - Build a ping message for tests
+ */
+static void build_ping(uint8_t *buf, uint16_t msg_type, uint32_t payload_len,
+                       uint64_t request_id) {
+    write_u32_be(buf, PROTOCOL_MAGIC);
+    write_u16_be(buf + 4, PROTOCOL_VERSION_1);
+    write_u16_be(buf + 6, msg_type);
+    write_u32_be(buf + 8, payload_len);
+    write_u32_be(buf + 12, 0);
+    write_u64_be(buf + 16, request_id);
+}
+
+/**
+ * Test: Decode valid ping request
+ */
+void test_decode_ping_valid(void) {
+    TEST("test_decode_ping_valid");
+
+    uint8_t buffer[24];
+    uint64_t request_id = 0;
+    build_ping(buffer, MSG_PING, 8, 0x8000000000000001ULL);
+
+    ASSERT_EQ(ERR_NONE, decode_ping_request(buffer, sizeof(buffer), &request_id));
+    ASSERT_TRUE(request_id == 0x8000000000000001ULL);
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Reject malformed ping requests
+ */
+void test_decode_ping_invalid(void) {
+    TEST("test_decode_ping_invalid");
+
+    uint8_t buffer[24];
+    uint64_t request_id;
+
+    build_ping(buffer, MSG_GENERATE_REQUEST, 8, 1);
+    ASSERT_EQ(ERR_INTERNAL, decode_ping_request(buffer, sizeof(buffer), &request_id));
+
+    build_ping(buffer, MSG_PING, 4, 1);
+    ASSERT_EQ(ERR_INTERNAL, decode_ping_request(buffer, sizeof(buffer), &request_id));
+
+    build_ping(buffer, MSG_PING, 8, 1);
+    ASSERT_EQ(ERR_INTERNAL, decode_ping_request(buffer, 20, &request_id));
+    ASSERT_EQ(ERR_INTERNAL, decode_ping_request(NULL, sizeof(buffer), &request_id));
+
+    write_u32_be(buffer, 0xDEADBEEF);
+    ASSERT_EQ(ERR_INVALID_MAGIC, decode_ping_request(buffer, sizeof(buffer), &request_id));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Encode pong response
+ */
+void test_encode_pong_valid(void) {
+    TEST("test_encode_pong_valid");
+
+    uint8_t buffer[24];
+    size_t encoded_len;
+
+    ASSERT_EQ(ERR_NONE, encode_pong_response(42, buffer, sizeof(buffer), &encoded_len));
+    ASSERT_EQ(24, encoded_len);
+    ASSERT_EQ(PROTOCOL_MAGIC, read_u32_be(buffer));
+    ASSERT_EQ(MSG_PONG, read_u16_be(buffer + 6));
+    ASSERT_EQ(8, read_u32_be(buffer + 8));
+    ASSERT_EQ(42, read_u64_be(buffer + 16));
+
+    ASSERT_EQ(ERR_INTERNAL, encode_pong_response(42, buffer, 16, &encoded_len));
+
+    TEST_PASS();
+}
+
+/**
+ * Helper: Add a LoRA section to a request after its fixed fields
+ *
+ * Sets HEADER_FLAG_LORAS and grows payload_len by section_len.
+ */
+static size_t add_lora_section(uint8_t *buffer, size_t len, size_t buffer_size,
+                               size_t fixed_len,
+                               const uint8_t *section, size_t section_len) {
+    size_t at = 16 + fixed_len;
+    if (len + section_len > buffer_size) {
+        return 0;
+    }
+    memmove(buffer + at + section_len, buffer + at, len - at);
+    memcpy(buffer + at, section, section_len);
+    write_u32_be(buffer + 8, read_u32_be(buffer + 8) + (uint32_t)section_len);
+    write_u32_be(buffer + 12, HEADER_FLAG_LORAS);
+    return len + section_len;
+}
+
+/**
+ * Helper: Write one LoRA section entry; returns its size
+ */
+static size_t write_lora_entry(uint8_t *buf, float weight, const char *name) {
+    size_t name_len = strlen(name);
+    write_f32_be(buf, weight);
+    write_u32_be(buf + 4, (uint32_t)name_len);
+    memcpy(buf + 8, name, name_len);
+    return 8 + name_len;
+}
+
+/**
+ * Test: Decode requests with a LoRA section
+ */
+void test_lora_section_valid(void) {
+    TEST("test_lora_section_valid");
+
+    uint8_t section[256];
+    size_t section_len = 4;
+    write_u32_be(section, 2);
+    section_len += write_lora_entry(section + section_len, 0.8f, "film-grain_v2");
+    section_len += write_lora_entry(section + section_len, -1.5f, "Sketch.XL");
+
+    uint8_t buffer[4096];
+    size_t len = build_valid_request(buffer, sizeof(buffer), 1, 512, 512, 28, 7.0f, 0, "a cat");
+    len = add_lora_section(buffer, len, sizeof(buffer), 60, section, section_len);
+    ASSERT_TRUE(len > 0);
+
+    sd35_generate_request_t req;
+    ASSERT_EQ(ERR_NONE, decode_generate_request(buffer, len, &req));
+    ASSERT_EQ(2, req.lora_count);
+    ASSERT_TRUE(strcmp(req.loras[0].name, "film-grain_v2") == 0);
+    ASSERT_TRUE(fabsf(req.loras[0].weight - 0.8f) < 0.001f);
+    ASSERT_TRUE(strcmp(req.loras[1].name, "Sketch.XL") == 0);
+    ASSERT_TRUE(fabsf(req.loras[1].weight + 1.5f) < 0.001f);
+    ASSERT_EQ(15, req.prompt_data_len);
+    ASSERT_TRUE(memcmp(req.prompt_data, "a cat", 5) == 0);
+
+    /* No flag, no section */
+    len = build_valid_request(buffer, sizeof(buffer), 1, 512, 512, 28, 7.0f, 0, "a cat");
+    ASSERT_EQ(ERR_NONE, decode_generate_request(buffer, len, &req));
+    ASSERT_EQ(0, req.lora_count);
+
+    /* img2img: the section sits between the img2img fields and the prompts */
+    static uint8_t image[64 * 64 * 3 + 4096];
+    len = build_img2img_request(image, sizeof(image), 64, 64, 0.6f, 3, 64 * 64 * 3, "a cat");
+    len = add_lora_section(image, len, sizeof(image), 72, section, section_len);
+    ASSERT_TRUE(len > 0);
+
+    sd35_img2img_request_t img2img;
+    ASSERT_EQ(ERR_NONE, decode_img2img_request(image, len, &img2img));
+    ASSERT_EQ(2, img2img.base.lora_count);
+    ASSERT_TRUE(memcmp(img2img.base.prompt_data, "a cat", 5) == 0);
+    ASSERT_TRUE(img2img.init_data + img2img.init_data_len == image + len);
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Reject bad LoRA sections
+ */
+void test_lora_section_invalid(void) {
+    TEST("test_lora_section_invalid");
+
+    static const struct {
+        uint32_t count;
+        float weight;
+        const char *name;
+        error_code_t want;
+    } cases[] = {
+        {MAX_LORAS + 1, 1.0f, "style", ERR_INVALID_LORA},
+        {1, 2.5f, "style", ERR_INVALID_LORA},
+        {1, -2.5f, "style", ERR_INVALID_LORA},
+        {1, NAN, "style", ERR_INVALID_LORA},
+        {1, 1.0f, "", ERR_INVALID_LORA},
+        {1, 1.0f, "../style", ERR_INVALID_LORA},
+        {1, 1.0f, ".hidden", ERR_INVALID_LORA},
+        {1, 1.0f, "sty le", ERR_INVALID_LORA},
+        {1, 1.0f, "a-lora-name-that-goes-on-and-on-and-on-well-past-the-sixty-four-byte-limit", ERR_INVALID_LORA},
+        {2, 1.0f, "style", ERR_INTERNAL}, /* Second entry missing */
+    };
+
+    for (size_t i = 0; i < sizeof(cases) / sizeof(cases[0]); i++) {
+        uint8_t section[256];
+        size_t section_len = 4;
+        write_u32_be(section, cases[i].count);
+        section_len += write_lora_entry(section + section_len, cases[i].weight, cases[i].name);
+
+        /* Without prompts after it, the truncated case runs out of payload */
+        uint8_t buffer[4096];
+        size_t len = build_valid_request(buffer, sizeof(buffer), 1, 512, 512, 28, 7.0f, 0, "a cat");
+        len = add_lora_section(buffer, len, sizeof(buffer), 60, section, section_len);
+        if (cases[i].want == ERR_INTERNAL) {
+            len -= 15;
+            write_u32_be(buffer + 8, (uint32_t)(len - 16));
+        }
+
+        sd35_generate_request_t req;
+        ASSERT_EQ(cases[i].want, decode_generate_request(buffer, len, &req));
+    }
+
+    /* Header flags other than the HEADER_FLAG_* */
+    uint8_t buffer[4096];
+    size_t len = build_valid_request(buffer, sizeof(buffer), 1, 512, 512, 28, 7.0f, 0, "a cat");
+    write_u32_be(buffer + 12, 0x200);
+    sd35_generate_request_t req;
+    ASSERT_EQ(ERR_INTERNAL, decode_generate_request(buffer, len, &req));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: HEADER_FLAG_VAE_TILING sets vae_tiling, alone or with LoRAs
+ */
+void test_vae_tiling_flag(void) {
+    TEST("test_vae_tiling_flag");
+
+    uint8_t buffer[4096];
+    sd35_generate_request_t req;
+    size_t len = build_valid_request(buffer, sizeof(buffer), 1, 1024, 1024, 28, 7.0f, 0, "a cat");
+    ASSERT_EQ(ERR_NONE, decode_generate_request(buffer, len, &req));
+    ASSERT_TRUE(!req.vae_tiling);
+
+    write_u32_be(buffer + 12, HEADER_FLAG_VAE_TILING);
+    ASSERT_EQ(ERR_NONE, decode_generate_request(buffer, len, &req));
+    ASSERT_TRUE(req.vae_tiling);
+    ASSERT_EQ(0, req.lora_count);
+
+    uint8_t section[64];
+    size_t section_len = 4;
+    write_u32_be(section, 1);
+    section_len += write_lora_entry(section + section_len, 1.0f, "style");
+    len = build_valid_request(buffer, sizeof(buffer), 1, 1024, 1024, 28, 7.0f, 0, "a cat");
+    len = add_lora_section(buffer, len, sizeof(buffer), 60, section, section_len);
+    ASSERT_TRUE(len > 0);
+    write_u32_be(buffer + 12, HEADER_FLAG_LORAS | HEADER_FLAG_VAE_TILING);
+    ASSERT_EQ(ERR_NONE, decode_generate_request(buffer, len, &req));
+    ASSERT_TRUE(req.vae_tiling);
+    ASSERT_EQ(1, req.lora_count);
+
+    TEST_PASS();
+}
+
+/**
+ * Test: HEADER_FLAG_SHARED_MEMORY is accepted in requests
+ */
+void test_shared_memory_flag(void) {
+    TEST("test_shared_memory_flag");
+
+    uint8_t buffer[4096];
+    sd35_generate_request_t req;
+    size_t len = build_valid_request(buffer, sizeof(buffer), 1, 1024, 1024, 28, 7.0f, 0, "a cat");
+
+    write_u32_be(buffer + 12, HEADER_FLAG_SHARED_MEMORY | HEADER_FLAG_VAE_TILING);
+    ASSERT_EQ(ERR_NONE, decode_generate_request(buffer, len, &req));
+    ASSERT_TRUE(req.vae_tiling);
+
+    TEST_PASS();
+}
+
+/**
+ * Test: HEADER_PRIORITY_MASK sets priority; the unused value is rejected
+ */
+void test_priority_flags(void) {
+    TEST("test_priority_flags");
+
+    uint8_t buffer[4096];
+    sd35_generate_request_t req;
+    size_t len = build_valid_request(buffer, sizeof(buffer), 1, 1024, 1024, 28, 7.0f, 0, "a cat");
+    ASSERT_EQ(ERR_NONE, decode_generate_request(buffer, len, &req));
+    ASSERT_EQ(PRIORITY_NORMAL, req.priority);
+
+    write_u32_be(buffer + 12, PRIORITY_LOW << HEADER_PRIORITY_SHIFT);
+    ASSERT_EQ(ERR_NONE, decode_generate_request(buffer, len, &req));
+    ASSERT_EQ(PRIORITY_LOW, req.priority);
+
+    write_u32_be(buffer + 12, (PRIORITY_HIGH << HEADER_PRIORITY_SHIFT) | HEADER_FLAG_VAE_TILING);
+    ASSERT_EQ(ERR_NONE, decode_generate_request(buffer, len, &req));
+    ASSERT_EQ(PRIORITY_HIGH, req.priority);
+    ASSERT_TRUE(req.vae_tiling);
+
+    write_u32_be(buffer + 12, HEADER_PRIORITY_MASK);
+    ASSERT_EQ(ERR_INTERNAL, decode_generate_request(buffer, len, &req));
+
+    TEST_PASS();
+}
+
+/**
+ * Helper: Build a control request
+ *
+ * The control image bytes are filled with 0x40; control_data_len is
+ * written as given.
+ */
+static size_t build_control_request(uint8_t *buffer, size_t buffer_size,
+                                    uint32_t width, uint32_t height,
+                                    uint32_t control_type, float strength,
+                                    uint32_t control_channels,
+                                    uint32_t control_data_len,
+                                    const char *prompt) {
+    uint8_t generate[4096];
+    size_t gen_len = build_valid_request(generate, sizeof(generate), 9,
+                                         width, height, 28, 7.0f, 42, prompt);
+    if (gen_len == 0) {
+        return 0;
+    }
+
+    size_t prompt_data_size = gen_len - 16 - 60;
+    size_t payload_len = 60 + 16 + prompt_data_size + control_data_len;
+    size_t total_len = 16 + payload_len;
+    if (total_len > buffer_size) {
+        return 0;
+    }
+
+    memcpy(buffer, generate, 16 + 60);
+    write_u16_be(buffer + 6, MSG_CONTROL_REQUEST);
+    write_u32_be(buffer + 8, (uint32_t)payload_len);
+
+    uint8_t *ptr = buffer + 16 + 60;
+    write_u32_be(ptr, control_type);
+    write_f32_be(ptr + 4, strength);
+    write_u32_be(ptr + 8, control_channels);
+    write_u32_be(ptr + 12, control_data_len);
+    ptr += 16;
+
+    memcpy(ptr, generate + 16 + 60, prompt_data_size);
+    ptr += prompt_data_size;
+    memset(ptr, 0x40, control_data_len);
+
+    return total_len;
+}
+
+/**
+ * Test: Valid control request
+ */
+void test_control_request_valid(void) {
+    TEST("test_control_request_valid");
+
+    static uint8_t buffer[64 * 64 * 4 + 4096];
+    size_t len = build_control_request(buffer, sizeof(buffer), 64, 64,
+                                       CONTROL_TYPE_DEPTH, 0.9f, 3, 64 * 64 * 3,
+                                       "a house");
+    ASSERT_TRUE(len > 0);
+
+    sd35_control_request_t req;
+    ASSERT_EQ(ERR_NONE, decode_control_request(buffer, len, &req));
+    ASSERT_EQ(9, req.base.request_id);
+    ASSERT_EQ(64, req.base.width);
+    ASSERT_EQ(7, req.base.clip_l_length);
+    ASSERT_TRUE(memcmp(req.base.prompt_data, "a house", 7) == 0);
+    ASSERT_EQ(CONTROL_TYPE_DEPTH, req.control_type);
+    ASSERT_TRUE(fabsf(req.control_strength - 0.9f) < 0.001f);
+    ASSERT_EQ(3, req.control_channels);
+    ASSERT_EQ(64 * 64 * 3, req.control_data_len);
+    ASSERT_EQ(0x40, req.control_data[0]);
+    ASSERT_TRUE(req.control_data + req.control_data_len == buffer + len);
+    ASSERT_EQ(0, req.base.lora_count);
+
+    /* LoRAs sit between the control fields and the prompts */
+    uint8_t section[64];
+    size_t section_len = 4;
+    write_u32_be(section, 1);
+    section_len += write_lora_entry(section + section_len, 0.5f, "style");
+    len = add_lora_section(buffer, len, sizeof(buffer), 76, section, section_len);
+    ASSERT_TRUE(len > 0);
+    ASSERT_EQ(ERR_NONE, decode_control_request(buffer, len, &req));
+    ASSERT_EQ(1, req.base.lora_count);
+    ASSERT_TRUE(memcmp(req.base.prompt_data, "a house", 7) == 0);
+    ASSERT_TRUE(req.control_data + req.control_data_len == buffer + len);
+
+    len = build_control_request(buffer, sizeof(buffer), 64, 64,
+                                CONTROL_TYPE_POSE, MAX_CONTROL_STRENGTH, 4,
+                                64 * 64 * 4, "a house");
+    ASSERT_EQ(ERR_NONE, decode_control_request(buffer, len, &req));
+    ASSERT_EQ(4, req.control_channels);
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Reject invalid control requests
+ */
+void test_control_request_invalid(void) {
+    TEST("test_control_request_invalid");
+
+    static uint8_t buffer[64 * 64 * 4 + 4096];
+    sd35_control_request_t req;
+    size_t len;
+
+    static const struct {
+        uint32_t type;
+        float strength;
+        uint32_t channels;
+        uint32_t data_len;
+    } cases[] = {
+        {CONTROL_TYPE_COUNT, 1.0f, 3, 64 * 64 * 3},
+        {CONTROL_TYPE_CANNY, 0.0f, 3, 64 * 64 * 3},
+        {CONTROL_TYPE_CANNY, 2.5f, 3, 64 * 64 * 3},
+        {CONTROL_TYPE_CANNY, NAN, 3, 64 * 64 * 3},
+        {CONTROL_TYPE_CANNY, 1.0f, 1, 64 * 64},
+        {CONTROL_TYPE_CANNY, 1.0f, 3, 32 * 32 * 3},
+    };
+    for (size_t i = 0; i < sizeof(cases) / sizeof(cases[0]); i++) {
+        len = build_control_request(buffer, sizeof(buffer), 64, 64, cases[i].type,
+                                    cases[i].strength, cases[i].channels,
+                                    cases[i].data_len, "a house");
+        ASSERT_EQ(ERR_INVALID_CONTROL, decode_control_request(buffer, len, &req));
+    }
+
+    len = build_control_request(buffer, sizeof(buffer), 64, 64, CONTROL_TYPE_CANNY,
+                                1.0f, 3, 64 * 64 * 3, "a house");
+    ASSERT_EQ(ERR_INTERNAL, decode_control_request(buffer, len - 1, &req));
+
+    /* control_data_len larger than the payload */
+    write_u32_be(buffer + 16 + 60 + 12, 0xFFFFFFFF);
+    ASSERT_EQ(ERR_INTERNAL, decode_control_request(buffer, len, &req));
+
+    /* An img2img request is not a control request */
+    len = build_img2img_request(buffer, sizeof(buffer), 64, 64,
+                                0.5f, 3, 64 * 64 * 3, "a house");
+    ASSERT_EQ(ERR_INTERNAL, decode_control_request(buffer, len, &req));
+    ASSERT_EQ(ERR_INTERNAL, decode_control_request(NULL, len, &req));
+    ASSERT_EQ(ERR_INTERNAL, decode_control_request(buffer, len, NULL));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Encode a preview frame and reject invalid ones
+ */
+static void test_encode_preview_frame(void) {
+    TEST("test_encode_preview_frame");
+
+    uint8_t pixels[4 * 2 * 3];
+    memset(pixels, 0x7F, sizeof(pixels));
+    preview_frame_t frame = {
+        .request_id = 42,
+        .step = 3,
+        .steps = 20,
+        .width = 4,
+        .height = 2,
+        .channels = 3,
+        .image_data_len = sizeof(pixels),
+        .image_data = pixels,
+    };
+
+    uint8_t buffer[16 + 32 + sizeof(pixels)];
+    size_t encoded_len;
+
+    ASSERT_EQ(ERR_NONE, encode_preview_frame(&frame, buffer, sizeof(buffer), &encoded_len));
+    ASSERT_EQ(sizeof(buffer), encoded_len);
+    ASSERT_EQ(PROTOCOL_MAGIC, read_u32_be(buffer));
+    ASSERT_EQ(MSG_PREVIEW, read_u16_be(buffer + 6));
+    ASSERT_EQ(32 + sizeof(pixels), read_u32_be(buffer + 8));
+    ASSERT_EQ(42, read_u64_be(buffer + 16));
+    ASSERT_EQ(3, read_u32_be(buffer + 24));
+    ASSERT_EQ(20, read_u32_be(buffer + 28));
+    ASSERT_EQ(4, read_u32_be(buffer + 32));
+    ASSERT_EQ(2, read_u32_be(buffer + 36));
+    ASSERT_EQ(3, read_u32_be(buffer + 40));
+    ASSERT_EQ(sizeof(pixels), read_u32_be(buffer + 44));
+    ASSERT_EQ(0x7F, buffer[48]);
+
+    ASSERT_EQ(ERR_INTERNAL, encode_preview_frame(&frame, buffer, sizeof(buffer) - 1, &encoded_len));
+    ASSERT_EQ(ERR_INTERNAL, encode_preview_frame(NULL, buffer, sizeof(buffer), &encoded_len));
+
+    preview_frame_t bad = frame;
+    bad.step = 21;
+    ASSERT_EQ(ERR_INVALID_DIMENSIONS, encode_preview_frame(&bad, buffer, sizeof(buffer), &encoded_len));
+    bad = frame;
+    bad.channels = 4;
+    ASSERT_EQ(ERR_INVALID_DIMENSIONS, encode_preview_frame(&bad, buffer, sizeof(buffer), &encoded_len));
+    bad = frame;
+    bad.width = PREVIEW_MAX_DIMENSION + 1;
+    ASSERT_EQ(ERR_INVALID_DIMENSIONS, encode_preview_frame(&bad, buffer, sizeof(buffer), &encoded_len));
+    bad = frame;
+    bad.image_data_len--;
+    ASSERT_EQ(ERR_INVALID_DIMENSIONS, encode_preview_frame(&bad, buffer, sizeof(buffer), &encoded_len));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Decode a models request
+ */
+static void test_decode_models_request(void) {
+    TEST("test_decode_models_request");
+
+    uint8_t buffer[24];
+    uint64_t request_id = 0;
+
+    build_ping(buffer, MSG_MODELS_REQUEST, 8, 0x8000000000000002ULL);
+    ASSERT_EQ(ERR_NONE, decode_models_request(buffer, sizeof(buffer), &request_id));
+    ASSERT_TRUE(request_id == 0x8000000000000002ULL);
+
+    build_ping(buffer, MSG_PING, 8, 1);
+    ASSERT_EQ(ERR_INTERNAL, decode_models_request(buffer, sizeof(buffer), &request_id));
+    build_ping(buffer, MSG_MODELS_REQUEST, 4, 1);
+    ASSERT_EQ(ERR_INTERNAL, decode_models_request(buffer, sizeof(buffer), &request_id));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Encode a models response and reject invalid model lists
+ */
+static void test_encode_models_response(void) {
+    TEST("test_encode_models_response");
+
+    model_info_t models[2] = {
+        { .model_id = MODEL_ID_SD35, .status = MODEL_STATUS_LOADED, .vram_mb = 6000, .name = "sd" },
+        { .model_id = MODEL_ID_FLUX, .status = MODEL_STATUS_MISSING, .vram_mb = 11000, .name = "flux" },
+    };
+    uint8_t buffer[16 + 8 + 4 + 16 + 2 + 16 + 4];
+    size_t encoded_len;
+
+    ASSERT_EQ(ERR_NONE, encode_models_response(7, models, 2, buffer, sizeof(buffer), &encoded_len));
+    ASSERT_EQ(sizeof(buffer), encoded_len);
+    ASSERT_EQ(PROTOCOL_MAGIC, read_u32_be(buffer));
+    ASSERT_EQ(MSG_MODELS_RESPONSE, read_u16_be(buffer + 6));
+    ASSERT_EQ(sizeof(buffer) - 16, read_u32_be(buffer + 8));
+    ASSERT_EQ(7, read_u64_be(buffer + 16));
+    ASSERT_EQ(2, read_u32_be(buffer + 24));
+    ASSERT_EQ(MODEL_ID_SD35, read_u32_be(buffer + 28));
+    ASSERT_EQ(MODEL_STATUS_LOADED, read_u32_be(buffer + 32));
+    ASSERT_EQ(6000, read_u32_be(buffer + 36));
+    ASSERT_EQ(2, read_u32_be(buffer + 40));
+    ASSERT_TRUE(memcmp(buffer + 44, "sd", 2) == 0);
+    ASSERT_EQ(MODEL_ID_FLUX, read_u32_be(buffer + 46));
+    ASSERT_EQ(MODEL_STATUS_MISSING, read_u32_be(buffer + 50));
+    ASSERT_EQ(11000, read_u32_be(buffer + 54));
+    ASSERT_EQ(4, read_u32_be(buffer + 58));
+    ASSERT_TRUE(memcmp(buffer + 62, "flux", 4) == 0);
+
+    ASSERT_EQ(ERR_INTERNAL, encode_models_response(7, models, 2, buffer, sizeof(buffer) - 1, &encoded_len));
+    ASSERT_EQ(ERR_INTERNAL, encode_models_response(7, models, MODEL_COUNT + 1, buffer, sizeof(buffer), &encoded_len));
+    models[1].name = "";
+    ASSERT_EQ(ERR_INTERNAL, encode_models_response(7, models, 2, buffer, sizeof(buffer), &encoded_len));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Decode a capabilities request
+ */
+static void test_decode_capabilities_request(void) {
+    TEST("test_decode_capabilities_request");
+
+    uint8_t buffer[24];
+    uint64_t request_id = 0;
+
+    build_ping(buffer, MSG_CAPABILITIES_REQUEST, 8, 0x8000000000000003ULL);
+    ASSERT_EQ(ERR_NONE, decode_capabilities_request(buffer, sizeof(buffer), &request_id));
+    ASSERT_TRUE(request_id == 0x8000000000000003ULL);
+
+    build_ping(buffer, MSG_MODELS_REQUEST, 8, 1);
+    ASSERT_EQ(ERR_INTERNAL, decode_capabilities_request(buffer, sizeof(buffer), &request_id));
+    build_ping(buffer, MSG_CAPABILITIES_REQUEST, 4, 1);
+    ASSERT_EQ(ERR_INTERNAL, decode_capabilities_request(buffer, sizeof(buffer), &request_id));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Encode a capabilities response
+ */
+static void test_encode_capabilities_response(void) {
+    TEST("test_encode_capabilities_response");
+
+    model_info_t models[1] = {
+        { .model_id = MODEL_ID_SD35, .status = MODEL_STATUS_LOADED, .vram_mb = 6000, .name = "sd" },
+    };
+    capabilities_t caps = {
+        .request_types = (1u << MSG_GENERATE_REQUEST) | (1u << MSG_PING),
+        .max_width = 1024,
+        .max_height = 768,
+        .vram_total_mb = 12288,
+        .vram_free_mb = 4096,
+        .models = models,
+        .model_count = 1,
+    };
+    uint8_t buffer[16 + 8 + 24 + 4 + 16 + 2];
+    size_t encoded_len;
+
+    ASSERT_EQ(ERR_NONE, encode_capabilities_response(9, &caps, buffer, sizeof(buffer), &encoded_len));
+    ASSERT_EQ(sizeof(buffer), encoded_len);
+    ASSERT_EQ(MSG_CAPABILITIES_RESPONSE, read_u16_be(buffer + 6));
+    ASSERT_EQ(sizeof(buffer) - 16, read_u32_be(buffer + 8));
+    ASSERT_EQ(9, read_u64_be(buffer + 16));
+    ASSERT_EQ(MIN_SUPPORTED_VERSION, read_u16_be(buffer + 24));
+    ASSERT_EQ(MAX_SUPPORTED_VERSION, read_u16_be(buffer + 26));
+    ASSERT_EQ(caps.request_types, read_u32_be(buffer + 28));
+    ASSERT_EQ(1024, read_u32_be(buffer + 32));
+    ASSERT_EQ(768, read_u32_be(buffer + 36));
+    ASSERT_EQ(12288, read_u32_be(buffer + 40));
+    ASSERT_EQ(4096, read_u32_be(buffer + 44));
+    ASSERT_EQ(1, read_u32_be(buffer + 48));
+    ASSERT_EQ(MODEL_ID_SD35, read_u32_be(buffer + 52));
+    ASSERT_TRUE(memcmp(buffer + 68, "sd", 2) == 0);
+
+    ASSERT_EQ(ERR_INTERNAL, encode_capabilities_response(9, &caps, buffer, sizeof(buffer) - 1, &encoded_len));
+    ASSERT_EQ(ERR_INTERNAL, encode_capabilities_response(9, NULL, buffer, sizeof(buffer), &encoded_len));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Decode a hello request
+ */
+static void test_decode_hello_request(void) {
+    TEST("test_decode_hello_request");
+
+    uint8_t buffer[28];
+    uint64_t request_id = 0;
+    uint16_t min_version = 0;
+    uint16_t max_version = 0;
+
+    build_ping(buffer, MSG_HELLO_REQUEST, 12, 0x8000000000000004ULL);
+    write_u16_be(buffer + 24, 1);
+    write_u16_be(buffer + 26, 3);
+    ASSERT_EQ(ERR_NONE, decode_hello_request(buffer, sizeof(buffer), &request_id,
+                                             &min_version, &max_version));
+    ASSERT_TRUE(request_id == 0x8000000000000004ULL);
+    ASSERT_EQ(1, min_version);
+    ASSERT_EQ(3, max_version);
+
+    /* min_version after max_version */
+    write_u16_be(buffer + 24, 4);
+    ASSERT_EQ(ERR_INTERNAL, decode_hello_request(buffer, sizeof(buffer), &request_id,
+                                                 &min_version, &max_version));
+
+    /* Hello headers are always version 1 */
+    write_u16_be(buffer + 24, 1);
+    write_u16_be(buffer + 4, 2);
+    ASSERT_EQ(ERR_UNSUPPORTED_VERSION, decode_hello_request(buffer, sizeof(buffer), &request_id,
+                                                            &min_version, &max_version));
+
+    build_ping(buffer, MSG_HELLO_REQUEST, 8, 1);
+    ASSERT_EQ(ERR_INTERNAL, decode_hello_request(buffer, sizeof(buffer), &request_id,
+                                                 &min_version, &max_version));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Negotiate a protocol version
+ */
+static void test_negotiate_version(void) {
+    TEST("test_negotiate_version");
+
+    uint16_t version = 0;
+
+    ASSERT_EQ(ERR_NONE, negotiate_version(MIN_SUPPORTED_VERSION, MAX_SUPPORTED_VERSION, &version));
+    ASSERT_EQ(MAX_SUPPORTED_VERSION, version);
+
+    /* A newer client is downgraded to the newest version compute speaks */
+    ASSERT_EQ(ERR_NONE, negotiate_version(MIN_SUPPORTED_VERSION, MAX_SUPPORTED_VERSION + 5, &version));
+    ASSERT_EQ(MAX_SUPPORTED_VERSION, version);
+
+    ASSERT_EQ(ERR_UNSUPPORTED_VERSION,
+              negotiate_version(MAX_SUPPORTED_VERSION + 1, MAX_SUPPORTED_VERSION + 2, &version));
+    ASSERT_EQ(ERR_UNSUPPORTED_VERSION, negotiate_version(0, 0, &version));
+    ASSERT_EQ(ERR_INTERNAL, negotiate_version(1, 1, NULL));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: Encode a hello response
+ */
+static void test_encode_hello_response(void) {
+    TEST("test_encode_hello_response");
+
+    uint8_t buffer[32];
+    size_t encoded_len;
+
+    ASSERT_EQ(ERR_NONE, encode_hello_response(11, PROTOCOL_VERSION_1, buffer, sizeof(buffer), &encoded_len));
+    ASSERT_EQ(sizeof(buffer), encoded_len);
+    ASSERT_EQ(PROTOCOL_VERSION_1, read_u16_be(buffer + 4));
+    ASSERT_EQ(MSG_HELLO_RESPONSE, read_u16_be(buffer + 6));
+    ASSERT_EQ(16, read_u32_be(buffer + 8));
+    ASSERT_EQ(11, read_u64_be(buffer + 16));
+    ASSERT_EQ(PROTOCOL_VERSION_1, read_u16_be(buffer + 24));
+    ASSERT_EQ(MIN_SUPPORTED_VERSION, read_u16_be(buffer + 26));
+    ASSERT_EQ(MAX_SUPPORTED_VERSION, read_u16_be(buffer + 28));
+    ASSERT_EQ(HEADER_FLAGS_SUPPORTED, read_u16_be(buffer + 30));
+
+    ASSERT_EQ(ERR_INTERNAL, encode_hello_response(11, PROTOCOL_VERSION_1, buffer, sizeof(buffer) - 1, &encoded_len));
+
+    TEST_PASS();
+}
+
+/**
+ * Test: CRC-32 of known input, and checking and removing a checksum
+ */
+static void test_checksum(void) {
+    TEST("test_checksum");
+
+    const uint8_t check[] = "123456789";
+    uint8_t buffer[28];
+    size_t len = sizeof(buffer);
+
+    ASSERT_TRUE(protocol_crc32(check, 9) == 0xCBF43926u);
+    ASSERT_TRUE(protocol_crc32(check, 0) == 0);
+
+    /* A ping with its request ID checksummed */
+    build_ping(buffer, MSG_PING, 12, 7);
+    write_u32_be(buffer + 12, HEADER_FLAG_CHECKSUM);
+    write_u32_be(buffer + 24, protocol_crc32(buffer + 16, 8));
+    ASSERT_EQ(ERR_NONE, verify_checksum(buffer, &len));
+    ASSERT_EQ(24, len);
+    ASSERT_EQ(8, read_u32_be(buffer + 8));
+    ASSERT_EQ(0, read_u32_be(buffer + 12));
+
+    /* Without the flag nothing changes */
+    ASSERT_EQ(ERR_NONE, verify_checksum(buffer, &len));
+    ASSERT_EQ(24, len);
+
+    /* A flipped bit */
+    build_ping(buffer, MSG_PING, 12, 7);
+    write_u32_be(buffer + 12, HEADER_FLAG_CHECKSUM);
+    write_u32_be(buffer + 24, protocol_crc32(buffer + 16, 8));
+    buffer[20] ^= 0x10;
+    len = sizeof(buffer);
+    ASSERT_EQ(ERR_CHECKSUM_MISMATCH, verify_checksum(buffer, &len));
+    ASSERT_EQ(sizeof(buffer), len);
+
+    /* A payload too short to hold a checksum */
+    build_ping(buffer, MSG_PING, 2, 7);
+    write_u32_be(buffer + 12, HEADER_FLAG_CHECKSUM);
+    len = 18;
+    ASSERT_EQ(ERR_CHECKSUM_MISMATCH, verify_checksum(buffer, &len));
+    ASSERT_EQ(ERR_INTERNAL, verify_checksum(buffer, NULL));
+
+    TEST_PASS();
+}
+
 int main(void) {
     printf("Running protocol tests...\n\n");
 
@@ -1150,6 +2409,9 @@ int main(void) {
 
     printf("\n=== Encoder Tests ===\n");
     test_encode_generate_response_valid();
+    test_encode_generate_response_shared_memory();
+    test_encode_generate_response_seed();
+    test_encode_generate_response_metadata();
     test_encode_generate_response_min_dimensions();
     test_encode_generate_response_max_dimensions();
     test_encode_generate_response_rgba();
@@ -1165,6 +2427,49 @@ int main(void) {
     test_encode_error_response_null_pointers();
     test_encode_error_response_buffer_too_small();
 
+    printf("\n=== Img2Img Tests ===\n");
+    test_img2img_request_valid();
+    test_img2img_request_invalid();
+
+    printf("\n=== Inpaint Tests ===\n");
+    test_inpaint_request_valid();
+    test_inpaint_request_invalid();
+
+    printf("\n=== Upscale Tests ===\n");
+    test_upscale_request_valid();
+    test_upscale_request_invalid();
+
+    printf("\n=== Ping Tests ===\n");
+    test_decode_ping_valid();
+    test_decode_ping_invalid();
+    test_encode_pong_valid();
+
+    printf("\n=== Models Tests ===\n");
+    test_decode_models_request();
+    test_encode_models_response();
+    test_decode_capabilities_request();
+    test_encode_capabilities_response();
+
+    printf("\n=== Hello Tests ===\n");
+    test_decode_hello_request();
+    test_negotiate_version();
+    test_encode_hello_response();
+    test_checksum();
+
+    printf("\n=== LoRA Tests ===\n");
+    test_lora_section_valid();
+    test_lora_section_invalid();
+    test_vae_tiling_flag();
+    test_shared_memory_flag();
+    test_priority_flags();
+
+    printf("\n=== Control Tests ===\n");
+    test_control_request_valid();
+    test_control_request_invalid();
+
+    printf("\n=== Preview Tests ===\n");
+    test_encode_preview_frame();
+
     printf("\n========================================\n");
     printf("Tests run: %d\n", tests_run);
     printf("Tests passed: %d\n", tests_passed);
@@ -21,6 +21,7 @@
 
 #include <errno.h>
 #include <fcntl.h>
+#include <stdint.h>
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
@@ -28,6 +29,8 @@
 #include <sys/stat.h>
 #include <sys/time.h>
 #include <sys/un.h>
+#include <netinet/in.h>
+#include <arpa/inet.h>
 #include <sys/wait.h>
 #include <unistd.h>
 
@@ -1128,6 +1131,95 @@ void test_connect_success(void) {
     TEST_PASS();
 }
 
+/**
+ * Test: socket_connect to a TCP address sends the token first
+ */
+void test_connect_tcp(void) {
+    TEST("test_connect_tcp");
+
+    int listen_fd = socket(AF_INET, SOCK_STREAM, 0);
+    ASSERT_TRUE(listen_fd >= 0);
+    struct sockaddr_in addr;
+    memset(&addr, 0, sizeof(addr));
+    addr.sin_family = AF_INET;
+    addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+    socklen_t addr_len = sizeof(addr);
+    ASSERT_EQ(0, bind(listen_fd, (struct sockaddr *)&addr, sizeof(addr)));
+    ASSERT_EQ(0, listen(listen_fd, 1));
+    ASSERT_EQ(0, getsockname(listen_fd, (struct sockaddr *)&addr, &addr_len));
+
+    char address[64];
+    snprintf(address, sizeof(address), SOCKET_TCP_PREFIX "127.0.0.1:%d", ntohs(addr.sin_port));
+
+    int fd = -1;
+    unsetenv(SOCKET_TOKEN_ENV);
+    ASSERT_EQ(SOCKET_ERR_TOKEN_NOT_SET, socket_connect(address, &fd));
+
+    setenv(SOCKET_TOKEN_ENV, "0123abcd", 1);
+    ASSERT_EQ(SOCKET_ERR_CONNECT_FAILED, socket_connect(SOCKET_TCP_PREFIX "no-port", &fd));
+    ASSERT_EQ(SOCKET_OK, socket_connect(address, &fd));
+
+    int accepted_fd = accept(listen_fd, NULL, NULL);
+    ASSERT_TRUE(accepted_fd >= 0);
+    char token[9] = {0};
+    ASSERT_EQ(8, (int)read(accepted_fd, token, 8));
+    ASSERT_EQ(0, strcmp(token, "0123abcd"));
+
+    unsetenv(SOCKET_TOKEN_ENV);
+    close(fd);
+    close(accepted_fd);
+    close(listen_fd);
+
+    TEST_PASS();
+}
+
+/**
+ * Test: socket_listen_tcp accepts connections that socket_auth_token checks
+ */
+void test_listen_tcp_auth_token(void) {
+    TEST("test_listen_tcp_auth_token");
+
+    int listen_fd = -1;
+    ASSERT_EQ(SOCKET_ERR_NULL_POINTER, socket_listen_tcp(NULL, &listen_fd));
+    ASSERT_EQ(SOCKET_ERR_SOCKET_FAILED, socket_listen_tcp("no-port", &listen_fd));
+    ASSERT_EQ(SOCKET_OK, socket_listen_tcp("127.0.0.1:0", &listen_fd));
+
+    struct sockaddr_in addr;
+    socklen_t addr_len = sizeof(addr);
+    ASSERT_EQ(0, getsockname(listen_fd, (struct sockaddr *)&addr, &addr_len));
+    char address[64];
+    snprintf(address, sizeof(address), SOCKET_TCP_PREFIX "127.0.0.1:%d", ntohs(addr.sin_port));
+
+    const char *token = "0123456789abcdef";
+    const char *tokens[] = {"0123456789abcdeX", token};
+    for (int i = 0; i < 2; i++) {
+        int fd = -1;
+        setenv(SOCKET_TOKEN_ENV, tokens[i], 1);
+        ASSERT_EQ(SOCKET_OK, socket_connect(address, &fd));
+        int accepted_fd = accept(listen_fd, NULL, NULL);
+        ASSERT_TRUE(accepted_fd >= 0);
+        ASSERT_EQ(i == 0 ? SOCKET_ERR_AUTH_TOKEN : SOCKET_OK, socket_auth_token(accepted_fd, token));
+        close(accepted_fd);
+        close(fd);
+    }
+    unsetenv(SOCKET_TOKEN_ENV);
+
+    /* A client that closes before sending the whole token is rejected */
+    int fd = socket(AF_INET, SOCK_STREAM, 0);
+    ASSERT_EQ(0, connect(fd, (struct sockaddr *)&addr, sizeof(addr)));
+    ASSERT_EQ(4, (int)write(fd, "0123", 4));
+    close(fd);
+    int accepted_fd = accept(listen_fd, NULL, NULL);
+    ASSERT_TRUE(accepted_fd >= 0);
+    ASSERT_EQ(SOCKET_ERR_AUTH_TOKEN, socket_auth_token(accepted_fd, token));
+    close(accepted_fd);
+
+    ASSERT_EQ(SOCKET_ERR_INVALID_FD, socket_auth_token(-1, token));
+    close(listen_fd);
+
+    TEST_PASS();
+}
+
 /**
  * ==========================================================================
  * Request/Response Loop Tests (Client Mode)
@@ -1560,6 +1652,81 @@ void test_client_handles_partial_io(void) {
     TEST_PASS();
 }
 
+/**
+ * ==========================================================================
+ * Shared Memory Tests
+ * ==========================================================================
+ */
+
+/**
+ * Test: socket_share_data creates a private segment holding the data
+ */
+void test_share_data(void) {
+    TEST("test_share_data");
+
+    if (create_temp_dir() != 0) {
+        printf("  SKIP: Could not create temp directory\n");
+        tests_passed++;
+        return;
+    }
+
+    uint8_t data[4096];
+    for (size_t i = 0; i < sizeof(data); i++) {
+        data[i] = (uint8_t)(i % 251);
+    }
+
+    char name[64];
+    socket_error_t err = socket_share_data(temp_dir, data, sizeof(data), name, sizeof(name));
+    ASSERT_EQ(SOCKET_OK, err);
+    ASSERT_TRUE(strncmp(name, SOCKET_SHM_PREFIX, strlen(SOCKET_SHM_PREFIX)) == 0);
+
+    char path[512];
+    snprintf(path, sizeof(path), "%s/%s", temp_dir, name);
+    struct stat st;
+    ASSERT_EQ(0, stat(path, &st));
+    ASSERT_EQ(0600, st.st_mode & 0777);
+    ASSERT_EQ((int)sizeof(data), (int)st.st_size);
+
+    uint8_t read_back[sizeof(data)];
+    int fd = open(path, O_RDONLY);
+    ASSERT_TRUE(fd >= 0);
+    ASSERT_EQ((int)sizeof(read_back), (int)read(fd, read_back, sizeof(read_back)));
+    close(fd);
+    ASSERT_TRUE(memcmp(data, read_back, sizeof(data)) == 0);
+
+    /* Every segment gets a new name */
+    char second[64];
+    ASSERT_EQ(SOCKET_OK, socket_share_data(temp_dir, data, 1, second, sizeof(second)));
+    ASSERT_TRUE(strcmp(name, second) != 0);
+
+    unlink(path);
+    snprintf(path, sizeof(path), "%s/%s", temp_dir, second);
+    unlink(path);
+    cleanup_temp_dir();
+
+    TEST_PASS();
+}
+
+/**
+ * Test: socket_share_data error conditions
+ */
+void test_share_data_errors(void) {
+    TEST("test_share_data_errors");
+
+    uint8_t data[16] = {0};
+    char name[64];
+
+    ASSERT_EQ(SOCKET_ERR_NULL_POINTER, socket_share_data(NULL, data, sizeof(data), name, sizeof(name)));
+    ASSERT_EQ(SOCKET_ERR_NULL_POINTER, socket_share_data("/tmp", NULL, sizeof(data), name, sizeof(name)));
+    ASSERT_EQ(SOCKET_ERR_NULL_POINTER, socket_share_data("/tmp", data, sizeof(data), NULL, sizeof(name)));
+    ASSERT_EQ(SOCKET_ERR_SHARE_FAILED, socket_share_data("/tmp", data, 0, name, sizeof(name)));
+    ASSERT_EQ(SOCKET_ERR_PATH_TOO_LONG, socket_share_data("/tmp", data, sizeof(data), name, 4));
+    ASSERT_EQ(SOCKET_ERR_SHARE_FAILED,
+              socket_share_data("/nonexistent/weave", data, sizeof(data), name, sizeof(name)));
+
+    TEST_PASS();
+}
+
 /**
  * ==========================================================================
  * Error String Tests
@@ -1589,6 +1756,9 @@ void test_error_strings(void) {
     ASSERT_STR_CONTAINS(socket_error_string(SOCKET_ERR_ACCEPT_FAILED), "accept");
     ASSERT_STR_CONTAINS(socket_error_string(SOCKET_ERR_NULL_HANDLER), "handler");
     ASSERT_STR_CONTAINS(socket_error_string(SOCKET_ERR_CONNECT_FAILED), "connect");
+    ASSERT_STR_CONTAINS(socket_error_string(SOCKET_ERR_SHARE_FAILED), "shared memory");
+    ASSERT_STR_CONTAINS(socket_error_string(SOCKET_ERR_TOKEN_NOT_SET), SOCKET_TOKEN_ENV);
+    ASSERT_STR_CONTAINS(socket_error_string(SOCKET_ERR_AUTH_TOKEN), "token");
 
     /* Unknown error should not crash */
     const char *unknown = socket_error_string((socket_error_t)-999);
@@ -1651,6 +1821,8 @@ int main(void) {
     test_connect_path_too_long();
     test_connect_nonexistent_socket();
     test_connect_success();
+    test_connect_tcp();
+    test_listen_tcp_auth_token();
 
     printf("\n=== Request/Response Loop Tests (Client Mode) ===\n");
     test_client_send_receive();
@@ -1658,6 +1830,10 @@ int main(void) {
     test_client_terminates_on_close();
     test_client_handles_partial_io();
 
+    printf("\n=== Shared Memory Tests ===\n");
+    test_share_data();
+    test_share_data_errors();
+
     printf("\n=== Error String Tests ===\n");
     test_error_strings();
 
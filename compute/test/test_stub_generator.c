@@ -18,8 +18,6 @@
 #include <string.h>
 #include "weave/protocol.h"
 
-#define MAX_MESSAGE_SIZE (10 * 1024 * 1024)
-
 /**
  * generate_checkerboard - Create a checkerboard test pattern
  *
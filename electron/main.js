@@ -1,5 +1,6 @@
-const { app, BrowserWindow, dialog } = require('electron');
+const { app, BrowserWindow, dialog, safeStorage } = require('electron');
 const { spawn } = require('child_process');
+const crypto = require('crypto');
 const path = require('path');
 const fs = require('fs');
 
@@ -10,12 +11,48 @@ const POLL_INTERVAL_MS = 100;
 const STARTUP_TIMEOUT_MS = 10000;
 const MIN_SPLASH_DURATION_MS = 1500;
 
+// File in userData holding the session passphrase, encrypted with the OS keychain
+const SESSION_KEY_FILE = 'session-key.bin';
+
 // Global reference to Go server child process
 let goProcess = null;
 
 // Flag to prevent re-entrant shutdown
 let shuttingDown = false;
 
+/**
+ * Returns the passphrase for encrypted sessions, or null if encryption is off.
+ *
+ * Encryption is turned on by launching with WEAVE_ENCRYPT_SESSIONS=1. A random
+ * passphrase is generated and stored in userData, encrypted with the OS keychain
+ * (safeStorage). Once it exists it is always used, because the backend refuses
+ * to start on encrypted sessions without a passphrase. A WEAVE_PASSPHRASE set
+ * in the environment takes precedence and is passed through unchanged.
+ */
+function sessionPassphrase() {
+  if (process.env.WEAVE_PASSPHRASE) {
+    return null;
+  }
+
+  const keyPath = path.join(app.getPath('userData'), SESSION_KEY_FILE);
+  const exists = fs.existsSync(keyPath);
+  if (!exists && process.env.WEAVE_ENCRYPT_SESSIONS !== '1') {
+    return null;
+  }
+  if (!safeStorage.isEncryptionAvailable()) {
+    throw new Error('Session encryption requires an OS keychain, which is not available');
+  }
+
+  if (exists) {
+    return safeStorage.decryptString(fs.readFileSync(keyPath));
+  }
+
+  const passphrase = crypto.randomBytes(32).toString('hex');
+  fs.writeFileSync(keyPath, safeStorage.encryptString(passphrase), { mode: 0o600 });
+  console.log('[electron] Created session encryption key in the OS keychain');
+  return passphrase;
+}
+
 /**
  * Spawns the Go server binary as a child process.
  * Returns a Promise that resolves with the child process reference,
@@ -41,8 +78,24 @@ function spawnGoServer() {
 
     console.log(`[electron] Spawning Go server: ${binaryPath}`);
 
-    // Spawn Go process with port flag
-    const child = spawn(binaryPath, [`--port=${PORT}`]);
+    // Spawn Go process with port flag; the passphrase goes in the environment
+    // so it doesn't show up in the process list
+    const args = [`--port=${PORT}`];
+    const env = { ...process.env };
+    let passphrase;
+    try {
+      passphrase = sessionPassphrase();
+    } catch (err) {
+      reject(err);
+      return;
+    }
+    if (passphrase) {
+      args.push('--encrypt-sessions');
+      env.WEAVE_PASSPHRASE = passphrase;
+    } else if (process.env.WEAVE_PASSPHRASE) {
+      args.push('--encrypt-sessions');
+    }
+    const child = spawn(binaryPath, args, { env });
 
     // Track if we've already resolved/rejected
     let settled = false;